@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Ability target types
+const (
+	AbilityTargetSelf   = "self"   // no target; cast on the caster
+	AbilityTargetPoint  = "point"  // a world position (x, y)
+	AbilityTargetPlayer = "player" // another player (targetId)
+	AbilityTargetObject = "object" // a scripted object (objectId)
+)
+
+// Ability resources that can pay an ability's cost
+const (
+	AbilityResourceStamina = "stamina"
+	AbilityResourceHealth  = "health"
+)
+
+// abilityBroadcastRange is how far (pixels) ability results are relayed from the caster
+const abilityBroadcastRange = 800.0
+
+// AbilityDefinition describes a castable ability
+type AbilityDefinition struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Target    string   `json:"target,omitempty"`    // one of the AbilityTarget* types (default self)
+	Cooldown  float64  `json:"cooldown,omitempty"`  // seconds
+	Cost      float64  `json:"cost,omitempty"`      // amount of Resource spent per cast
+	Resource  string   `json:"resource,omitempty"`  // AbilityResource* (default stamina)
+	Range     float64  `json:"range,omitempty"`     // max distance from caster to target in pixels (0 = unlimited)
+	Script    string   `json:"script,omitempty"`    // effect script run with the cast context
+	Knockback float64  `json:"knockback,omitempty"` // impulse applied to a target player away from the caster
+	Effects   []string `json:"effects,omitempty"`   // status effects applied to the target player (the caster for self abilities)
+
+	Projectile *ProjectileSpec `json:"projectile,omitempty"` // fired at the target (along the caster's facing for self abilities)
+	AoE        *AoESpec        `json:"aoe,omitempty"`        // circles are centered on the target; cones and rects reach from the caster towards it
+}
+
+// AbilityCast is the result relayed to players near the caster (OpCodeAbilityResult)
+type AbilityCast struct {
+	CasterID  string   `json:"casterId"`
+	AbilityID string   `json:"abilityId"`
+	TargetID  string   `json:"targetId,omitempty"`
+	ObjectID  int      `json:"objectId,omitempty"`
+	X         float64  `json:"x"`
+	Y         float64  `json:"y"`
+	Messages  []string `json:"messages,omitempty"` // effect_ack messages from the effect script
+
+	ProjectileID int `json:"projectileId,omitempty"` // projectile fired by the cast
+	AoEHits      int `json:"aoeHits,omitempty"`      // targets the cast's area effect hit
+}
+
+// AbilityCatalog holds the ability definitions loaded from the abilities data file
+type AbilityCatalog struct {
+	logger    runtime.Logger
+	abilities map[string]*AbilityDefinition
+	mu        sync.RWMutex
+}
+
+// NewAbilityCatalog creates a catalog and loads definitions from path (a JSON object keyed by ability ID)
+func NewAbilityCatalog(logger runtime.Logger, path string) *AbilityCatalog {
+	ac := &AbilityCatalog{
+		logger:    logger,
+		abilities: make(map[string]*AbilityDefinition),
+	}
+	if err := ac.Load(path); err != nil {
+		logger.Warn("Failed to load ability definitions from %s: %v", path, err)
+	}
+	return ac
+}
+
+// Load replaces the catalog with the definitions found in path
+func (ac *AbilityCatalog) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var abilities map[string]*AbilityDefinition
+	if err := json.Unmarshal(data, &abilities); err != nil {
+		return err
+	}
+	for id, def := range abilities {
+		def.ID = id
+		if def.Target == "" {
+			def.Target = AbilityTargetSelf
+		}
+		if def.Resource == "" {
+			def.Resource = AbilityResourceStamina
+		}
+		if def.Projectile != nil {
+			def.Projectile.normalize()
+		}
+		if def.AoE != nil {
+			def.AoE.normalize()
+		}
+	}
+
+	ac.mu.Lock()
+	ac.abilities = abilities
+	ac.mu.Unlock()
+
+	ac.logger.Info("Loaded %d ability definitions from %s", len(abilities), path)
+	return nil
+}
+
+// Get returns the definition for an ability ID
+func (ac *AbilityCatalog) Get(abilityID string) (*AbilityDefinition, bool) {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	def, ok := ac.abilities[abilityID]
+	return def, ok
+}
@@ -0,0 +1,133 @@
+package main
+
+// ActionLimit holds the anti-spam constraints ProcessPlayerInput enforces for an action before
+// its handler runs. Gameplay cooldowns reported to the client (dash, abilities) stay in the handlers.
+type ActionLimit struct {
+	MinIntervalTicks int64 // ticks that must pass after an approved input before the next one (0 = none)
+	MaxPerTick       int   // inputs of this action accepted per tick (0 = unlimited)
+	RequiresAlive    bool  // rejected with RejectDead while the player is dead (every action but respawn)
+	RequiresStill    bool  // rejected with RejectMoving while the player's body is moving
+}
+
+// maxInputsPerTick caps how many inputs a player may send in a single tick across all actions;
+// extra ones are rejected with RejectRateLimited
+const maxInputsPerTick = 8
+
+// defaultActionLimit applies to actions missing from actionLimits, so new actions are throttled
+// and blocked for dead players until they get an entry of their own
+var defaultActionLimit = ActionLimit{MaxPerTick: 1, RequiresAlive: true}
+
+// actionLimits is the per-action constraint table
+var actionLimits = map[string]ActionLimit{
+	"spawn":            {MinIntervalTicks: TickRate, MaxPerTick: 1, RequiresAlive: true},
+	"move":             {MaxPerTick: 4, RequiresAlive: true},
+	"respawn":          {MinIntervalTicks: TickRate / 4, MaxPerTick: 1},
+	"aim":              {MaxPerTick: 4, RequiresAlive: true},
+	"dash":             {MaxPerTick: 1, RequiresAlive: true},
+	"use_item":         {MinIntervalTicks: TickRate / 10, MaxPerTick: 1, RequiresAlive: true},
+	"pickup":           {MaxPerTick: 2, RequiresAlive: true},
+	"drop":             {MinIntervalTicks: TickRate / 10, MaxPerTick: 1, RequiresAlive: true},
+	"cast":             {MaxPerTick: 1, RequiresAlive: true},
+	"place":            {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true, RequiresStill: true},
+	"mount":            {MinIntervalTicks: TickRate / 2, MaxPerTick: 1, RequiresAlive: true},
+	"dismount":         {MaxPerTick: 1, RequiresAlive: true},
+	"grab":             {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true},
+	"release":          {MaxPerTick: 1, RequiresAlive: true},
+	"command":          {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true},
+	"target":           {MaxPerTick: 2, RequiresAlive: true},
+	"untarget":         {MaxPerTick: 2, RequiresAlive: true},
+	"flag_pvp":         {MaxPerTick: 1, RequiresAlive: true},
+	"unflag_pvp":       {MaxPerTick: 1, RequiresAlive: true},
+	"duel_request":     {MinIntervalTicks: TickRate, MaxPerTick: 1, RequiresAlive: true},
+	"duel_accept":      {MaxPerTick: 1, RequiresAlive: true},
+	"duel_decline":     {MaxPerTick: 1, RequiresAlive: true},
+	"party_invite":     {MinIntervalTicks: TickRate, MaxPerTick: 1},
+	"party_accept":     {MaxPerTick: 1},
+	"party_decline":    {MaxPerTick: 1},
+	"party_leave":      {MaxPerTick: 1},
+	"party_kick":       {MinIntervalTicks: TickRate / 2, MaxPerTick: 1},
+	"party_loot_rule":  {MinIntervalTicks: TickRate / 2, MaxPerTick: 1},
+	"loot_roll":        {MaxPerTick: 4},
+	"till":             {MinIntervalTicks: TickRate / 2, MaxPerTick: 1, RequiresAlive: true, RequiresStill: true},
+	"plant":            {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true},
+	"harvest":          {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true},
+	"talk":             {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true},
+	"quest_accept":     {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true},
+	"quest_turn_in":    {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true},
+	"quest_abandon":    {MinIntervalTicks: TickRate / 4, MaxPerTick: 1},
+	"summon_pet":       {MinIntervalTicks: TickRate, MaxPerTick: 1, RequiresAlive: true},
+	"dismiss_pet":      {MinIntervalTicks: TickRate / 2, MaxPerTick: 1},
+	"rename_pet":       {MinIntervalTicks: TickRate, MaxPerTick: 1},
+	"fish_cast":        {MinIntervalTicks: TickRate / 2, MaxPerTick: 1, RequiresAlive: true, RequiresStill: true},
+	"fish_reel":        {MaxPerTick: 1, RequiresAlive: true},
+	"claim_plot":       {MinIntervalTicks: TickRate, MaxPerTick: 1, RequiresAlive: true},
+	"release_plot":     {MinIntervalTicks: TickRate, MaxPerTick: 1, RequiresAlive: true},
+	"remove_furniture": {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true},
+	"emote":            {MinIntervalTicks: TickRate / 2, MaxPerTick: 1, RequiresAlive: true},
+	"interact":         {MinIntervalTicks: TickRate / 10, MaxPerTick: 1, RequiresAlive: true},
+	"gather":           {MinIntervalTicks: TickRate / 2, MaxPerTick: 1, RequiresAlive: true, RequiresStill: true},
+	"disarm":           {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true, RequiresStill: true},
+	"travel":           {MinIntervalTicks: TickRate / 2, MaxPerTick: 1, RequiresAlive: true},
+	"buy":              {MinIntervalTicks: TickRate / 4, MaxPerTick: 1, RequiresAlive: true},
+	"watch_vars":       {MaxPerTick: 2, RequiresAlive: true},
+	"unwatch_vars":     {MaxPerTick: 2, RequiresAlive: true},
+}
+
+// limitFor returns the constraints for an action
+func limitFor(action string) ActionLimit {
+	if limit, ok := actionLimits[action]; ok {
+		return limit
+	}
+	return defaultActionLimit
+}
+
+// actionUsage tracks one player's recent use of one action
+type actionUsage struct {
+	lastApprovedTick int64 // tick of the last approved input (-1 before the first)
+	tick             int64 // tick countThisTick counts for
+	countThisTick    int
+}
+
+// checkActionLimit applies the action's limits for the player and returns a rejection reason,
+// or "" if the input may be handled. moving reports whether the player's body is moving.
+func (ps *PlayerState) checkActionLimit(action string, tick int64, moving bool) string {
+	limit := limitFor(action)
+	if limit.RequiresAlive && ps.IsDead() {
+		return RejectDead
+	}
+	if limit.RequiresStill && moving {
+		return RejectMoving
+	}
+
+	usage := ps.usage(action)
+	if usage.tick != tick {
+		usage.tick = tick
+		usage.countThisTick = 0
+	}
+	usage.countThisTick++
+	if limit.MaxPerTick > 0 && usage.countThisTick > limit.MaxPerTick {
+		return RejectRateLimited
+	}
+	if limit.MinIntervalTicks > 0 && usage.lastApprovedTick >= 0 && tick-usage.lastApprovedTick < limit.MinIntervalTicks {
+		return RejectRateLimited
+	}
+	return ""
+}
+
+// recordApproved starts the action's min interval after its handler approved the input
+func (ps *PlayerState) recordApproved(action string, tick int64) {
+	ps.usage(action).lastApprovedTick = tick
+}
+
+// usage returns the player's usage record for an action, creating it if needed
+func (ps *PlayerState) usage(action string) *actionUsage {
+	if ps.actionUsage == nil {
+		ps.actionUsage = make(map[string]*actionUsage)
+	}
+	u, ok := ps.actionUsage[action]
+	if !ok {
+		u = &actionUsage{lastApprovedTick: -1}
+		ps.actionUsage[action] = u
+	}
+	return u
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// gRPC status codes used for RPC errors returned to clients
+const (
+	rpcCodeInvalidArgument    = 3
+	rpcCodeNotFound           = 5
+	rpcCodePermissionDenied   = 7
+	rpcCodeFailedPrecondition = 9
+	rpcCodeInternal           = 13
+	rpcCodeUnavailable        = 14
+	rpcCodeUnauthenticated    = 16
+)
+
+var (
+	errAdminRequired   = runtime.NewError("admin permission required", rpcCodePermissionDenied)
+	errInvalidPayload  = runtime.NewError("invalid request payload", rpcCodeInvalidArgument)
+	errMatchNotFound   = runtime.NewError("match not found", rpcCodeNotFound)
+	errInternalFailure = runtime.NewError("internal server error", rpcCodeInternal)
+)
+
+// RegisterAdminRpcs registers RPCs used by operators and tooling
+func RegisterAdminRpcs(initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("admin_script_stats", rpcScriptStats); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_script_upload", rpcScriptUpload); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_script_manifest_set", rpcScriptManifestSet); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_replay_export", rpcReplayExport); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_replay_run", rpcReplayRun); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_bots", rpcBots); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_log", rpcAdminLog); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_announce", rpcAnnounce); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_world_settings", rpcWorldSettings); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_world_reset", rpcWorldReset); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_live_ops", rpcLiveOps); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_game_config", rpcGameConfig); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_tune", rpcTune); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_load", rpcAdminLoad); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_journal", rpcAdminJournal); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_cheat_reports", rpcAdminCheatReports); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_rng_audit", rpcAdminRNGAudit); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_moderation", rpcAdminModeration); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_economy", rpcAdminEconomy); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("admin_static_geometry", rpcStaticGeometry); err != nil {
+		return err
+	}
+	return nil
+}
+
+// isAdmin reports whether the RPC caller may use admin functionality.
+// Server-to-server calls (http key, no user in context) are trusted; users need
+// `"role": "admin"` in their account metadata.
+func isAdmin(ctx context.Context, nk runtime.NakamaModule) bool {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return true
+	}
+	return accountHasRole(ctx, nk, userID, "admin")
+}
+
+// accountHasRole checks the "role" field in a user's account metadata
+func accountHasRole(ctx context.Context, nk runtime.NakamaModule, userID string, roles ...string) bool {
+	role := accountRole(ctx, nk, userID)
+	if role == "" {
+		return false
+	}
+	for _, r := range roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// accountRole returns the "role" field of a user's account metadata ("" if unset or unreadable)
+func accountRole(ctx context.Context, nk runtime.NakamaModule, userID string) string {
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil || account.GetUser() == nil {
+		return ""
+	}
+	var metadata struct {
+		Role string `json:"role"`
+	}
+	if err := json.Unmarshal([]byte(account.GetUser().GetMetadata()), &metadata); err != nil {
+		return ""
+	}
+	return metadata.Role
+}
+
+// signalMatches sends a signal to one match (if matchID is set) or to every open world shard of
+// every map and returns the responses keyed by match ID
+func signalMatches(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, matchID string, signal MatchSignalRequest) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(signal)
+	if err != nil {
+		return nil, errInternalFailure
+	}
+
+	matchIDs := []string{matchID}
+	if matchID == "" {
+		shards, err := ListShards(ctx, nk, "")
+		if err != nil {
+			logger.Error("Failed to list matches for signal %s: %v", signal.Type, err)
+			return nil, errInternalFailure
+		}
+		matchIDs = matchIDs[:0]
+		for _, shard := range shards {
+			matchIDs = append(matchIDs, shard.MatchID)
+		}
+	}
+
+	responses := make(map[string]json.RawMessage, len(matchIDs))
+	for _, id := range matchIDs {
+		resp, err := nk.MatchSignal(ctx, id, string(data))
+		if err != nil {
+			logger.Warn("Failed to signal match %s with %s: %v", id, signal.Type, err)
+			if matchID != "" {
+				return nil, errMatchNotFound
+			}
+			continue
+		}
+		if resp == "" {
+			resp = "null"
+		}
+		responses[id] = json.RawMessage(resp)
+	}
+	return responses, nil
+}
+
+// rpcStaticGeometry returns the static colliders of each match (walls and the colliders of map
+// and placed objects) for debug overlays; world updates only carry the bodies that move.
+// Payload: {"matchId": "optional"}
+func rpcStaticGeometry(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		MatchID string `json:"matchId"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+
+	responses, err := signalMatches(ctx, logger, nk, req.MatchID, MatchSignalRequest{Type: SignalStaticGeometry})
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(map[string]interface{}{"matches": responses})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// rpcScriptStats returns per-script execution statistics (hottest scripts first) for each match.
+// Payload: {"matchId": "optional", "reset": false}
+func rpcScriptStats(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		MatchID string `json:"matchId"`
+		Reset   bool   `json:"reset"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+
+	signalPayload, _ := json.Marshal(map[string]bool{"reset": req.Reset})
+	responses, err := signalMatches(ctx, logger, nk, req.MatchID, MatchSignalRequest{
+		Type:    SignalScriptStats,
+		Payload: signalPayload,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(map[string]interface{}{"matches": responses})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
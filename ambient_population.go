@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Ambient population tuning
+const (
+	ambientCheckInterval  = 5 * TickRate // ticks between population checks
+	ambientSightRadius    = 480.0        // px; ambient NPCs appear and vanish only this far from every player
+	ambientSpawnAttempts  = 8            // random points tried per spawn before giving up until the next check
+	ambientSpawnsPerCheck = 2            // NPCs a population gains per check once the match runs
+)
+
+// AmbientPopulation keeps Target NPCs of one type alive inside a region: the critters, wildlife
+// and passers-by set with the region's "population" property instead of hand-placed spawners
+type AmbientPopulation struct {
+	Region string
+	NPC    string
+	Target int
+	alive  int
+}
+
+// parsePopulation parses a region's "population" property: "deer:12, rabbit:4"
+func parsePopulation(s string) (map[string]int, error) {
+	population := make(map[string]int)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		npcType, count, ok := strings.Cut(entry, ":")
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if !ok || strings.TrimSpace(npcType) == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid entry %q, want <npc type>:<count>", entry)
+		}
+		population[strings.TrimSpace(npcType)] += n
+	}
+	return population, nil
+}
+
+// createPopulations creates the ambient populations of the current map's regions, in region
+// and NPC type order. A region's budget is read from the first of its rectangles that has one.
+func (nm *NPCManager) createPopulations(gameState *GameMatchState) {
+	seen := make(map[string]bool)
+	for _, region := range gameState.currentMap.Regions {
+		if seen[region.ID] || len(region.Population) == 0 {
+			continue
+		}
+		seen[region.ID] = true
+		for _, npcType := range sortedKeys(region.Population) {
+			if target := region.Population[npcType]; target > 0 {
+				nm.populations = append(nm.populations, &AmbientPopulation{Region: region.ID, NPC: npcType, Target: target})
+			}
+		}
+	}
+}
+
+// updatePopulations replaces the ambient NPCs that died or strayed from their region, out of the
+// players' sight. Called from Update every ambientCheckInterval ticks.
+func (nm *NPCManager) updatePopulations(gameState *GameMatchState) {
+	if len(nm.populations) == 0 || gameState.currentTick%ambientCheckInterval != 0 {
+		return
+	}
+
+	// Idle NPCs that wandered or were pushed out of their region leave and are replaced
+	nm.mu.RLock()
+	var strays []int
+	for id, npc := range nm.live() {
+		if npc.ambient != nil && npc.State == NPCStateIdle && !gameState.inRegion(npc.ambient.Region, npc.Body.Position) &&
+			!gameState.playerWithin(npc.Body.Position, ambientSightRadius) {
+			strays = append(strays, id)
+		}
+	}
+	nm.mu.RUnlock()
+	for _, id := range strays {
+		nm.Despawn(gameState, id)
+	}
+
+	for _, population := range nm.populations {
+		nm.fillPopulation(gameState, population, ambientSpawnsPerCheck)
+	}
+}
+
+// fillPopulation spawns up to limit NPCs for a population below its target, at random walkable
+// points of its region that no player can see
+func (nm *NPCManager) fillPopulation(gameState *GameMatchState, population *AmbientPopulation, limit int) {
+	rects := gameState.regionRects(population.Region)
+	for spawned := 0; spawned < limit && population.alive < population.Target; spawned++ {
+		position, ok := gameState.ambientSpawnPoint(rects)
+		if !ok {
+			return
+		}
+		id := nm.Spawn(gameState, population.NPC, position, nil)
+		if id == 0 {
+			// The definitions don't change at runtime, so stop retrying every check
+			nm.logger.Warn("Region %s population references unknown NPC type %q; dropping it", population.Region, population.NPC)
+			population.Target = 0
+			return
+		}
+		nm.mu.Lock()
+		nm.npcs[id].ambient = population
+		population.alive++
+		nm.mu.Unlock()
+	}
+}
+
+// ambientSpawnPoint picks a random walkable point of a region's rectangles, weighted by their
+// area, that is out of every player's sight
+func (gs *GameMatchState) ambientSpawnPoint(rects []*Region) (vector.Vector, bool) {
+	total := 0.0
+	for _, rect := range rects {
+		total += (rect.Max.X - rect.Min.X) * (rect.Max.Y - rect.Min.Y)
+	}
+	if total <= 0 {
+		return vector.Vector{}, false
+	}
+	for attempt := 0; attempt < ambientSpawnAttempts; attempt++ {
+		pick := gs.rng.Float64() * total
+		rect := rects[len(rects)-1]
+		for _, r := range rects {
+			area := (r.Max.X - r.Min.X) * (r.Max.Y - r.Min.Y)
+			if pick < area {
+				rect = r
+				break
+			}
+			pick -= area
+		}
+		point := vector.Vector{
+			X: rect.Min.X + gs.rng.Float64()*(rect.Max.X-rect.Min.X),
+			Y: rect.Min.Y + gs.rng.Float64()*(rect.Max.Y-rect.Min.Y),
+		}
+		if gs.pathfinder.WalkableAt(gs, point) && !gs.playerWithin(point, ambientSightRadius) {
+			return point, true
+		}
+	}
+	return vector.Vector{}, false
+}
+
+// regionRects returns the rectangles of a region
+func (gs *GameMatchState) regionRects(id string) []*Region {
+	var rects []*Region
+	if gs.currentMap == nil {
+		return rects
+	}
+	for i := range gs.currentMap.Regions {
+		if gs.currentMap.Regions[i].ID == id {
+			rects = append(rects, &gs.currentMap.Regions[i])
+		}
+	}
+	return rects
+}
+
+// playerWithin reports whether a player's body is within radius of a point
+func (gs *GameMatchState) playerWithin(p vector.Vector, radius float64) bool {
+	for _, rb := range gs.PlayerBodies() {
+		if rb.Position.Sub(p).Magnitude() <= radius {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Announcement severities; clients pick the banner style from them
+const (
+	AnnouncementInfo     = "info"
+	AnnouncementWarning  = "warning"
+	AnnouncementCritical = "critical"
+)
+
+// Announcement limits
+const (
+	maxAnnouncementLength          = 500
+	defaultAnnouncementSeconds     = 10.0
+	maxAnnouncementSeconds         = 3600.0
+	maxAnnouncementScheduleSeconds = 7 * 24 * 3600.0 // how far ahead an announcement may be scheduled
+)
+
+var errInvalidAnnouncement = runtime.NewError("announcements need a message of at most 500 characters or a message key, a severity of info, warning or critical, a duration of at most an hour and a display time within a week", rpcCodeInvalidArgument)
+
+// Announcement is a server-wide banner (OpCodeAnnouncement). Every match shows it from DisplayAt
+// for Duration seconds; players who join meanwhile get it too. Announcements with a message key
+// are sent with Message rendered in each player's locale.
+type Announcement struct {
+	ID        string         `json:"id"`
+	Message   string         `json:"message"`
+	Key       string         `json:"key,omitempty"`
+	Params    map[string]any `json:"params,omitempty"`
+	Severity  string         `json:"severity"`
+	DisplayAt int64          `json:"displayAt"` // unix seconds
+	Duration  float64        `json:"duration"`  // seconds the banner stays up
+}
+
+// expiresAt is the unix time the announcement stops showing
+func (a *Announcement) expiresAt() int64 {
+	return a.DisplayAt + int64(a.Duration)
+}
+
+// AnnouncementBoard holds the announcements a match was sent until they are over. It is only
+// used from the match loop and match signals.
+type AnnouncementBoard struct {
+	logger        runtime.Logger
+	announcements []*Announcement // scheduled and showing
+	shown         map[string]bool // IDs already broadcast
+}
+
+// NewAnnouncementBoard creates an empty announcement board
+func NewAnnouncementBoard(logger runtime.Logger) *AnnouncementBoard {
+	return &AnnouncementBoard{logger: logger, shown: make(map[string]bool)}
+}
+
+// Schedule adds an announcement; it is broadcast by the next Update at or after its display time
+func (ab *AnnouncementBoard) Schedule(a *Announcement) {
+	ab.announcements = append(ab.announcements, a)
+}
+
+// Update broadcasts the announcements whose display time came and forgets the ones that are over.
+// Called from the match loop.
+func (ab *AnnouncementBoard) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if len(ab.announcements) == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	kept := ab.announcements[:0]
+	for _, a := range ab.announcements {
+		if now >= a.expiresAt() {
+			delete(ab.shown, a.ID)
+			continue
+		}
+		kept = append(kept, a)
+		if now >= a.DisplayAt && !ab.shown[a.ID] {
+			ab.shown[a.ID] = true
+			ab.send(gs, a, nil, dispatcher)
+		}
+	}
+	ab.announcements = kept
+}
+
+// Join sends a joining player the announcements currently showing
+func (ab *AnnouncementBoard) Join(gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	if !ok {
+		return
+	}
+	for _, a := range ab.announcements {
+		if ab.shown[a.ID] {
+			ab.send(gs, a, []runtime.Presence{presence}, dispatcher)
+		}
+	}
+}
+
+// send broadcasts an announcement to recipients (everyone when nil). Keyed announcements go out
+// once per locale.
+func (ab *AnnouncementBoard) send(gs *GameMatchState, a *Announcement, recipients []runtime.Presence, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	if a.Key == "" {
+		ab.broadcast(a, recipients, dispatcher)
+		return
+	}
+	for locale, presences := range gs.presencesByLocale(recipients) {
+		localized := *a
+		if template, ok := messageCatalog.Lookup(locale, a.Key); ok {
+			localized.Message = fillTemplate(template, a.Params)
+		}
+		ab.broadcast(&localized, presences, dispatcher)
+	}
+}
+
+// broadcast sends an announcement as it is
+func (ab *AnnouncementBoard) broadcast(a *Announcement, recipients []runtime.Presence, dispatcher runtime.MatchDispatcher) {
+	data, err := EncodeMessage(OpCodeAnnouncement, "announcement", a)
+	if err != nil {
+		ab.logger.Error("Failed to marshal announcement %s: %v", a.ID, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeAnnouncement, data, recipients, nil, true)
+}
+
+// rpcAnnounce sends a server announcement to every open world match (or one match). Without a
+// display time it shows right away. A message key (with params) makes every player read it in
+// their own language; message is then the fallback text.
+// Payload: {"message": "required without key", "key": "optional", "params": {}, "severity": "info|warning|critical", "displayAt": 0, "duration": 10, "matchId": "optional"}
+func rpcAnnounce(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		MatchID   string         `json:"matchId"`
+		Message   string         `json:"message"`
+		Key       string         `json:"key"`
+		Params    map[string]any `json:"params"`
+		Severity  string         `json:"severity"`
+		DisplayAt int64          `json:"displayAt"`
+		Duration  float64        `json:"duration"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil {
+		return "", errInvalidPayload
+	}
+
+	now := time.Now()
+	if req.Severity == "" {
+		req.Severity = AnnouncementInfo
+	}
+	if req.Duration == 0 {
+		req.Duration = defaultAnnouncementSeconds
+	}
+	if req.DisplayAt < now.Unix() {
+		req.DisplayAt = now.Unix()
+	}
+	if req.Message == "" && req.Key != "" {
+		req.Message = messageCatalog.Render(defaultLocale, req.Key, req.Params)
+	}
+	switch {
+	case req.Message == "" || len(req.Message) > maxAnnouncementLength,
+		req.Severity != AnnouncementInfo && req.Severity != AnnouncementWarning && req.Severity != AnnouncementCritical,
+		req.Duration < 0 || req.Duration > maxAnnouncementSeconds,
+		float64(req.DisplayAt-now.Unix()) > maxAnnouncementScheduleSeconds:
+		return "", errInvalidAnnouncement
+	}
+
+	announcement := &Announcement{
+		ID:        strconv.FormatInt(now.UnixNano(), 36),
+		Message:   req.Message,
+		Key:       req.Key,
+		Params:    req.Params,
+		Severity:  req.Severity,
+		DisplayAt: req.DisplayAt,
+		Duration:  req.Duration,
+	}
+	signalPayload, err := json.Marshal(announcement)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	responses, err := signalMatches(ctx, logger, nk, req.MatchID, MatchSignalRequest{
+		Type:    SignalAnnounce,
+		Payload: signalPayload,
+	})
+	if err != nil {
+		return "", err
+	}
+	logger.Info("Announcement %s (%s) scheduled for %d in %d matches", announcement.ID, announcement.Severity, announcement.DisplayAt, len(responses))
+
+	out, err := json.Marshal(map[string]interface{}{"announcement": announcement, "matches": len(responses)})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Area shapes
+const (
+	AoEShapeCircle = "circle" // around the origin
+	AoEShapeCone   = "cone"   // from the origin towards the direction
+	AoEShapeRect   = "rect"   // a box reaching from the origin along the direction
+)
+
+// Area defaults
+const (
+	defaultAoERadius = 64.0  // circle radius and cone length
+	defaultAoEAngle  = 90.0  // cone width in degrees
+	defaultAoELength = 128.0 // rect extent along the direction
+	defaultAoEWidth  = 32.0  // rect extent across the direction
+)
+
+// AoESpec describes an area effect of an ability ("aoe" in abilities.json), a projectile's
+// explosion or a script
+type AoESpec struct {
+	Shape          string   `json:"shape,omitempty"`          // AoEShape* (default circle)
+	Radius         float64  `json:"radius,omitempty"`         // circle radius and cone length in pixels
+	Angle          float64  `json:"angle,omitempty"`          // cone width in degrees
+	Length         float64  `json:"length,omitempty"`         // rect length in pixels
+	Width          float64  `json:"width,omitempty"`          // rect width in pixels
+	Damage         float64  `json:"damage,omitempty"`         // dealt at the origin
+	DamageType     string   `json:"damageType,omitempty"`     // default physical
+	CritChance     float64  `json:"critChance,omitempty"`     // chance (0..1) the hit on each target is critical
+	CritMultiplier float64  `json:"critMultiplier,omitempty"` // damage factor of critical hits (default 2)
+	Falloff        float64  `json:"falloff,omitempty"`        // share of the damage lost at the edge (0..1), linear with distance from the origin
+	Effects        []string `json:"effects,omitempty"`        // status effects applied to players hit
+	MaxTargets     int      `json:"maxTargets,omitempty"`     // nearest targets hit (0 = all)
+	FriendlyFire   bool     `json:"friendlyFire,omitempty"`   // also hit the owner's allies, as for projectiles
+}
+
+// normalize fills in the defaults of unset fields
+func (spec *AoESpec) normalize() {
+	switch spec.Shape {
+	case AoEShapeCone, AoEShapeRect:
+	default:
+		spec.Shape = AoEShapeCircle
+	}
+	if spec.Radius <= 0 {
+		spec.Radius = defaultAoERadius
+	}
+	if spec.Angle <= 0 || spec.Angle > 360 {
+		spec.Angle = defaultAoEAngle
+	}
+	if spec.Length <= 0 {
+		spec.Length = defaultAoELength
+	}
+	if spec.Width <= 0 {
+		spec.Width = defaultAoEWidth
+	}
+	if spec.DamageType == "" {
+		spec.DamageType = DamagePhysical
+	}
+	spec.Falloff = math.Max(0, math.Min(spec.Falloff, 1))
+	spec.CritChance = math.Max(0, math.Min(spec.CritChance, 1))
+	if spec.CritMultiplier <= 0 {
+		spec.CritMultiplier = defaultCritMultiplier
+	}
+}
+
+// reach returns the center and radius of a circle enclosing the area
+func (spec *AoESpec) reach(origin vector.Vector, direction float64) (vector.Vector, float64) {
+	if spec.Shape == AoEShapeRect {
+		dir := vector.Vector{X: math.Cos(direction), Y: math.Sin(direction)}
+		return origin.Add(dir.Scale(spec.Length / 2)), math.Hypot(spec.Length/2, spec.Width/2)
+	}
+	return origin, spec.Radius
+}
+
+// covers reports whether a target's circle touches the area, and how far along the area it is
+// (0 at the origin, 1 at the edge) for the damage falloff
+func (spec *AoESpec) covers(origin vector.Vector, direction float64, target combatTarget) (bool, float64) {
+	rel := target.position.Sub(origin)
+	distance := rel.Magnitude()
+	switch spec.Shape {
+	case AoEShapeCone:
+		// Targets standing on the origin are always inside
+		if distance > target.radius && !inFacingCone(origin, direction, target.position, spec.Angle*math.Pi/360, spec.Radius+target.radius) {
+			return false, 0
+		}
+		return true, math.Min(distance/spec.Radius, 1)
+	case AoEShapeRect:
+		along := rel.X*math.Cos(direction) + rel.Y*math.Sin(direction)
+		across := -rel.X*math.Sin(direction) + rel.Y*math.Cos(direction)
+		if along < -target.radius || along > spec.Length+target.radius || math.Abs(across) > spec.Width/2+target.radius {
+			return false, 0
+		}
+		return true, math.Max(0, math.Min(along/spec.Length, 1))
+	default:
+		return distance <= spec.Radius+target.radius, math.Min(distance/spec.Radius, 1)
+	}
+}
+
+// AoEHit is one target an area effect hit
+type AoEHit struct {
+	TargetType string       `json:"targetType"` // "player" or "npc"
+	TargetID   string       `json:"targetId"`
+	Damage     float64      `json:"damage,omitempty"` // after falloff and the damage pipeline
+	Health     float64      `json:"health"`
+	MaxHealth  float64      `json:"maxHealth"`
+	Killed     bool         `json:"killed,omitempty"`
+	Crit       bool         `json:"crit,omitempty"`      // a critical hit
+	Effects    []string     `json:"effects,omitempty"`   // status effects that were applied
+	Breakdown  []DamageStep `json:"breakdown,omitempty"` // the damage after each pipeline stage
+}
+
+// AoEEvent describes a resolved area effect and everything it hit. It is relayed as one combat
+// event (OpCodeCombat aoe) instead of a damage event per target.
+type AoEEvent struct {
+	Source    DamageSource `json:"source"`
+	AbilityID string       `json:"abilityId,omitempty"`
+	Shape     string       `json:"shape"`
+	X         float64      `json:"x"`
+	Y         float64      `json:"y"`
+	Direction float64      `json:"direction"` // radians, for cones and rects
+	Radius    float64      `json:"radius,omitempty"`
+	Angle     float64      `json:"angle,omitempty"`
+	Length    float64      `json:"length,omitempty"`
+	Width     float64      `json:"width,omitempty"`
+	Tick      int64        `json:"tick"` // tick whose positions the hits were resolved against
+	Hits      []AoEHit     `json:"hits"`
+}
+
+// ResolveAoE applies an area effect from origin. Targets are found with a physics overlap query
+// against where they stood at tick (see RewindTick), must be in the line of sight of the origin
+// and take the damage reduced by the falloff, nearest first. The result is relayed to nearby
+// players as a single combat event and returned.
+func (gs *GameMatchState) ResolveAoE(spec *AoESpec, source DamageSource, abilityID string, origin vector.Vector, direction float64, tick int64, dispatcher runtime.MatchDispatcher, logger runtime.Logger) AoEEvent {
+	event := AoEEvent{
+		Source:    source,
+		AbilityID: abilityID,
+		Shape:     spec.Shape,
+		X:         origin.X,
+		Y:         origin.Y,
+		Direction: direction,
+		Tick:      tick,
+		Hits:      []AoEHit{},
+	}
+	switch spec.Shape {
+	case AoEShapeCone:
+		event.Radius, event.Angle = spec.Radius, spec.Angle
+	case AoEShapeRect:
+		event.Length, event.Width = spec.Length, spec.Width
+	default:
+		event.Radius = spec.Radius
+	}
+
+	// Broad phase: the physics overlap query against the snapshot bodies
+	center, radius := spec.reach(origin, direction)
+	targets := gs.CombatTargets(source, spec.FriendlyFire, tick, nil)
+	byBody := make(map[*rigidbody.RigidBody]combatTarget, len(targets))
+	bodies := make([]*rigidbody.RigidBody, 0, len(targets))
+	for _, target := range targets {
+		byBody[target.body] = target
+		bodies = append(bodies, target.body)
+	}
+	probe := acquireCircleProbe(center.X, center.Y, radius)
+	overlapping := gs.physicsEngine.QueryOverlap(probe, bodies)
+	releaseProbe(probe)
+	var hit []combatTarget
+	for _, body := range overlapping {
+		target := byBody[body]
+		inside, along := spec.covers(origin, direction, target)
+		if !inside || !gs.HasLineOfSight(origin, target.position, 0) {
+			continue
+		}
+		target.t = along
+		hit = append(hit, target)
+	}
+	sort.SliceStable(hit, func(i, j int) bool { return hit[i].t < hit[j].t })
+	if spec.MaxTargets > 0 && len(hit) > spec.MaxTargets {
+		hit = hit[:spec.MaxTargets]
+	}
+
+	var killed []*NPC
+	for _, target := range hit {
+		entry := AoEHit{TargetType: target.kind, TargetID: target.id}
+		amount, crit := gs.RollCrit(critPlayer(source, target.kind, target.id), source, target.id, spec.Damage*(1-spec.Falloff*target.t), spec.CritChance, spec.CritMultiplier)
+		switch target.kind {
+		case "player":
+			if amount > 0 {
+				if damage, ok := gs.hurtPlayer(target.id, source, amount, spec.DamageType, playerInvulnerabilityTicks); ok {
+					entry.Damage, entry.Crit, entry.Breakdown = damage.Amount, crit, damage.Breakdown
+				}
+			}
+			for _, effectID := range spec.Effects {
+				if gs.ApplyEffect(target.id, effectID, source, 0) {
+					entry.Effects = append(entry.Effects, effectID)
+				}
+			}
+			state := gs.GetPlayerState(target.id)
+			entry.Health, entry.MaxHealth, entry.Killed = state.Health, state.MaxHealth, state.IsDead()
+		case "npc":
+			if amount <= 0 {
+				continue
+			}
+			damage, npc, ok := gs.npcManager.hurt(gs, target.npcID, source, amount, spec.DamageType)
+			if !ok {
+				continue
+			}
+			entry.Damage, entry.Health, entry.MaxHealth, entry.Killed, entry.Crit, entry.Breakdown = damage.Amount, damage.Health, damage.MaxHealth, damage.Killed, crit, damage.Breakdown
+			if damage.Killed {
+				killed = append(killed, npc)
+			}
+		}
+		if entry.Damage > 0 || len(entry.Effects) > 0 {
+			event.Hits = append(event.Hits, entry)
+		}
+	}
+
+	if dispatcher != nil {
+		if recipients := gs.PresencesInRange(center, damageEventRange+radius); len(recipients) > 0 {
+			if data, err := EncodeMessage(OpCodeCombat, "aoe", event); err != nil {
+				logger.Error("Failed to marshal aoe event: %v", err)
+			} else {
+				dispatcher.BroadcastMessage(OpCodeCombat, data, recipients, nil, true)
+			}
+		}
+	}
+	// Deaths are announced after the hits that caused them
+	for _, npc := range killed {
+		gs.npcManager.handleDeath(gs, npc, dispatcher)
+	}
+	return event
+}
+
+// combatTarget is a player or NPC that projectiles and area effects can hit
+type combatTarget struct {
+	kind     string // "player" or "npc"
+	id       string
+	npcID    int
+	body     *rigidbody.RigidBody // copy of the body at the resolved tick's position
+	position vector.Vector
+	radius   float64
+	t        float64 // sort key: position along a sweep, or distance
+}
+
+// key identifies the target in hit sets
+func (t combatTarget) key() string {
+	return t.kind + ":" + t.id
+}
+
+// CombatTargets lists the living players and NPCs an attack by owner may hit, where they stood at
+// tick, skipping the keys in exclude. Players' attacks follow the PvP rules and, without
+// friendlyFire, pass their guild or team mates and those players' pets; attacks of pets count as
+// their owners'. Other NPCs' attacks only hit players and pets unless friendlyFire is set.
+func (gs *GameMatchState) CombatTargets(owner DamageSource, friendlyFire bool, tick int64, exclude map[string]bool) []combatTarget {
+	ownerPlayer := gs.npcManager.creditedPlayer(owner)
+	ownerNPC := -1
+	if owner.Type == DamageSourceNPC && ownerPlayer == "" {
+		ownerNPC, _ = strconv.Atoi(owner.ID)
+	}
+
+	var out []combatTarget
+	for playerID, rb := range gs.PlayerBodies() {
+		if exclude["player:"+playerID] || playerID == ownerPlayer || gs.GetPlayerState(playerID).IsDead() {
+			continue
+		}
+		if ownerPlayer != "" {
+			if !gs.CanDamagePlayer(ownerPlayer, playerID) || (!friendlyFire && gs.areAllies(ownerPlayer, playerID)) {
+				continue
+			}
+		}
+		position, _ := gs.PlayerAt(playerID, tick)
+		out = append(out, newCombatTarget("player", playerID, 0, rb, position))
+	}
+
+	nm := gs.npcManager
+	nm.mu.RLock()
+	for id, npc := range nm.live() {
+		if exclude["npc:"+strconv.Itoa(id)] || npc.Health <= 0 || id == ownerNPC {
+			continue
+		}
+		switch {
+		case ownerPlayer != "" && npc.Pet != nil:
+			if npc.Pet.OwnerID == ownerPlayer || (!friendlyFire && gs.areAllies(ownerPlayer, npc.Pet.OwnerID)) {
+				continue
+			}
+		case ownerNPC >= 0 && npc.Pet == nil && !friendlyFire:
+			continue
+		}
+		out = append(out, newCombatTarget("npc", strconv.Itoa(id), id, npc.Body, gs.npcAt(npc, tick)))
+	}
+	nm.mu.RUnlock()
+
+	// Map order is random; sort so hits resolve the same way on every run
+	sort.Slice(out, func(i, j int) bool { return out[i].key() < out[j].key() })
+	return out
+}
+
+// newCombatTarget snapshots a body at a position
+func newCombatTarget(kind, id string, npcID int, rb *rigidbody.RigidBody, position vector.Vector) combatTarget {
+	snapshot := *rb
+	snapshot.Position = position
+	return combatTarget{kind: kind, id: id, npcID: npcID, body: &snapshot, position: position, radius: bodyRadius(rb)}
+}
+
+// areAllies reports whether two different players capture for the same guild or team
+func (gs *GameMatchState) areAllies(a, b string) bool {
+	if a == b {
+		return false
+	}
+	faction := gs.factionOf(a)
+	return faction != "" && faction == gs.factionOf(b)
+}
+
+// bodyRadius approximates a body by a circle for projectile and area hits
+func bodyRadius(rb *rigidbody.RigidBody) float64 {
+	if strings.ToLower(rb.Shape) == "circle" {
+		return rb.Radius
+	}
+	return math.Max(rb.Width, rb.Height) / 2
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var errUnknownMap = runtime.NewError("no world or dungeon uses that map", rpcCodeNotFound)
+
+// MapTileset is a tileset of a map as a client needs it to draw the map: where its image is and
+// how its tiles are laid out. Paths are relative to the maps directory.
+type MapTileset struct {
+	Name        string `json:"name"`
+	FirstGID    int    `json:"firstGid"`
+	LastGID     int    `json:"lastGid"`          // 0 when the tile count is unknown
+	Source      string `json:"source,omitempty"` // the external tileset file
+	Image       string `json:"image,omitempty"`
+	ImageWidth  int    `json:"imageWidth,omitempty"`
+	ImageHeight int    `json:"imageHeight,omitempty"`
+	TileWidth   int    `json:"tileWidth"`
+	TileHeight  int    `json:"tileHeight"`
+	TileCount   int    `json:"tileCount"`
+	Columns     int    `json:"columns"`
+}
+
+// GIDRange is a run of consecutive tile GIDs the server may show on objects
+type GIDRange struct {
+	First   uint32 `json:"first"`
+	Last    uint32 `json:"last"`
+	Tileset string `json:"tileset,omitempty"` // "" when no tileset of the map holds them
+}
+
+// AssetManifest is what a client loads to draw a map
+type AssetManifest struct {
+	Map        string       `json:"map"`
+	Width      int          `json:"width"`  // tiles
+	Height     int          `json:"height"` // tiles
+	TileWidth  int          `json:"tileWidth"`
+	TileHeight int          `json:"tileHeight"`
+	Tilesets   []MapTileset `json:"tilesets"`
+	GIDRanges  []GIDRange   `json:"gidRanges"`
+}
+
+// assetManifests caches the manifest of each map; maps only change with a deploy
+var assetManifests sync.Map // map name -> *AssetManifest
+
+// describeTileset describes a tileset embedded in a map file (or an external one that failed to load)
+func describeTileset(tileset *TiledTileset, mapFile string) MapTileset {
+	ts := MapTileset{
+		Name:        tileset.Name,
+		FirstGID:    tileset.FirstGID,
+		Image:       tileset.Image,
+		ImageWidth:  tileset.ImageWidth,
+		ImageHeight: tileset.ImageHeight,
+		TileWidth:   tileset.TileWidth,
+		TileHeight:  tileset.TileHeight,
+		TileCount:   tileset.TileCount,
+		Columns:     tileset.Columns,
+	}
+	if tileset.Source != "" {
+		ts.Source = filepath.ToSlash(filepath.Join(filepath.Dir(mapFile), tileset.Source))
+	}
+	if ts.Image != "" {
+		ts.Image = filepath.ToSlash(filepath.Join(filepath.Dir(mapFile), ts.Image))
+	}
+	if ts.TileCount > 0 {
+		ts.LastGID = ts.FirstGID + ts.TileCount - 1
+	}
+	return ts
+}
+
+// describeExternalTileset describes a tileset loaded from its own file (path relative to the maps directory)
+func describeExternalTileset(firstGID int, path string, data *TiledTilesetData) MapTileset {
+	ts := MapTileset{
+		Name:        data.Name,
+		FirstGID:    firstGID,
+		Source:      filepath.ToSlash(path),
+		ImageWidth:  data.ImageWidth,
+		ImageHeight: data.ImageHeight,
+		TileWidth:   data.TileWidth,
+		TileHeight:  data.TileHeight,
+		TileCount:   data.TileCount,
+		Columns:     data.Columns,
+	}
+	if data.Image != "" {
+		ts.Image = filepath.ToSlash(filepath.Join(filepath.Dir(path), data.Image))
+	}
+	if ts.TileCount > 0 {
+		ts.LastGID = ts.FirstGID + ts.TileCount - 1
+	}
+	return ts
+}
+
+// tilesetOf returns the name of the tileset holding a GID
+func tilesetOf(tilesets []MapTileset, gid uint32) string {
+	for _, ts := range tilesets {
+		if int(gid) >= ts.FirstGID && (ts.LastGID == 0 || int(gid) <= ts.LastGID) {
+			return ts.Name
+		}
+	}
+	return ""
+}
+
+// gidRanges collapses GIDs into runs of consecutive GIDs within one tileset
+func gidRanges(gids []uint32, tilesets []MapTileset) []GIDRange {
+	slices.Sort(gids)
+	gids = slices.Compact(gids)
+	ranges := make([]GIDRange, 0)
+	for _, gid := range gids {
+		if gid == 0 {
+			continue
+		}
+		tileset := tilesetOf(tilesets, gid)
+		if n := len(ranges); n > 0 && ranges[n-1].Last+1 == gid && ranges[n-1].Tileset == tileset {
+			ranges[n-1].Last = gid
+			continue
+		}
+		ranges = append(ranges, GIDRange{First: gid, Last: gid, Tileset: tileset})
+	}
+	return ranges
+}
+
+// BuildAssetManifest describes what a client needs to draw a map. The GID ranges cover the tiles
+// the server may put on objects besides those in the map's tile layers: the scripted objects'
+// tiles, open doors and active mechanisms, crop stages, placed buildings and items, spawned and
+// dropped.
+func BuildAssetManifest(logger runtime.Logger, mapName string) (*AssetManifest, error) {
+	lm, err := NewMapLoader(logger, mapDirectory).LoadMap(mapName)
+	if err != nil {
+		return nil, err
+	}
+
+	var gids []uint32
+	for _, obj := range lm.Objects {
+		gids = append(gids, obj.GID)
+		for _, key := range []string{"opengid", "activegid"} {
+			if v, ok := obj.Props[key].(float64); ok && v > 0 {
+				gids = append(gids, uint32(v))
+			}
+		}
+	}
+	items := NewItemCatalog(logger, "/nakama/data/items.json")
+	for _, def := range items.items {
+		gids = append(gids, def.SpawnGID, def.WorldGID)
+	}
+	buildables := NewBuildableCatalog(logger, "/nakama/data/buildables.json")
+	for _, def := range buildables.buildables {
+		gids = append(gids, def.GID)
+	}
+	crops := NewCropCatalog(logger, "/nakama/data/crops.json")
+	for _, def := range crops.crops {
+		gids = append(gids, def.StageGIDs...)
+	}
+
+	tilesets := slices.Clone(lm.Tilesets)
+	slices.SortFunc(tilesets, func(a, b MapTileset) int { return a.FirstGID - b.FirstGID })
+	return &AssetManifest{
+		Map:        mapName,
+		Width:      lm.Width,
+		Height:     lm.Height,
+		TileWidth:  lm.TileWidth,
+		TileHeight: lm.TileHeight,
+		Tilesets:   tilesets,
+		GIDRanges:  gidRanges(gids, tilesets),
+	}, nil
+}
+
+// manifestMapAllowed reports whether players may ask for a map's manifest: the default world,
+// a map with a running shard or a dungeon's map, so the RPC doesn't read arbitrary files
+func manifestMapAllowed(ctx context.Context, nk runtime.NakamaModule, mapName string) bool {
+	if mapName == defaultWorldMap {
+		return true
+	}
+	if strings.Contains(mapName, "..") {
+		return false
+	}
+	if shards, err := ListShards(ctx, nk, mapName); err == nil && len(shards) > 0 {
+		return true
+	}
+	dungeons, err := LoadDungeonDefinitions(dungeonDefinitionsPath)
+	if err != nil {
+		return false
+	}
+	for _, def := range dungeons {
+		if def.Map == mapName {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcAssetManifest returns the asset manifest of a match's map, or of a map by name, so clients
+// load tilesets from the server's description of the map instead of hardcoding their layouts.
+// Payload: {"matchId": "<open world match>"} or {"map": "world.json"} (default: the default world)
+func rpcAssetManifest(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req struct {
+		MatchID string `json:"matchId"`
+		Map     string `json:"map"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+	mapName := req.Map
+	if req.MatchID != "" {
+		match, err := nk.MatchGet(ctx, req.MatchID)
+		if err != nil || match == nil {
+			return "", errUnknownWorld
+		}
+		var label ShardLabel
+		if err := json.Unmarshal([]byte(match.GetLabel().GetValue()), &label); err != nil || label.Map == "" {
+			return "", errUnknownWorld
+		}
+		mapName = label.Map
+	}
+	if mapName == "" {
+		mapName = defaultWorldMap
+	}
+	if !manifestMapAllowed(ctx, nk, mapName) {
+		return "", errUnknownMap
+	}
+
+	manifest, ok := assetManifests.Load(mapName)
+	if !ok {
+		built, err := BuildAssetManifest(logger, mapName)
+		if err != nil {
+			logger.Error("Failed to build the asset manifest of %s: %v", mapName, err)
+			return "", errInternalFailure
+		}
+		manifest, _ = assetManifests.LoadOrStore(mapName, built)
+	}
+	out, err := json.Marshal(manifest)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
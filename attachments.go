@@ -0,0 +1,303 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// EventDetached is published when an attachment ends because its parent left the world
+const EventDetached = "detached" // kind, id, parent
+
+// maxAttachments bounds the attachments of a match
+const maxAttachments = 512
+
+// Attachment kinds: what follows the parent
+const (
+	AttachObject = "object" // a map or runtime object: its position and colliders
+	AttachLight  = "light"  // a light entity
+	AttachEntity = "entity" // a player's or NPC's body (riders, carried NPCs)
+)
+
+// attachKey identifies the child of an attachment
+type attachKey struct {
+	kind string
+	id   string // object or light ID, or entity ID
+}
+
+// Attachment makes a child follow its parent, a player (user ID) or NPC (ID), at an offset from
+// the parent's center
+type Attachment struct {
+	Kind   string        `json:"kind"`
+	ID     string        `json:"id"`
+	Parent string        `json:"parent"`
+	Offset vector.Vector `json:"offset"`
+}
+
+// AttachmentManager keeps colliders, lights and bodies attached to moving players and NPCs: a
+// player's torch, a mount's rider, a boss's weak point. Every tick after physics each child is
+// put at its parent's new position plus its offset, so scripts don't move owned colliders
+// themselves. Attached colliders don't collide with their parent. When the parent leaves the
+// world the attachment ends: objects stay where they are, lights go out with it and bodies are
+// let go. It is only used from the match loop.
+type AttachmentManager struct {
+	logger      runtime.Logger
+	attachments map[attachKey]*Attachment
+}
+
+// NewAttachmentManager creates a manager without attachments
+func NewAttachmentManager(logger runtime.Logger) *AttachmentManager {
+	return &AttachmentManager{
+		logger:      logger,
+		attachments: make(map[attachKey]*Attachment),
+	}
+}
+
+// Attach makes a child follow a parent at an offset, replacing the child's attachment if it has
+// one. It returns false when the child or parent isn't in the world, an object is held by a
+// player, a body would follow itself (also through other bodies) or the match has too many
+// attachments.
+func (am *AttachmentManager) Attach(gs *GameMatchState, kind, id, parent string, offset vector.Vector, dispatcher runtime.MatchDispatcher, logger runtime.Logger) bool {
+	key := attachKey{kind: kind, id: id}
+	if _, replaced := am.attachments[key]; !replaced && len(am.attachments) >= maxAttachments {
+		return false
+	}
+	parentBody := gs.EntityBody(parent)
+	if parentBody == nil {
+		return false
+	}
+
+	switch kind {
+	case AttachObject:
+		oid, err := strconv.Atoi(id)
+		if err != nil {
+			return false
+		}
+		gs.mu.Lock()
+		obj, ok := gs.Object(oid)
+		if ok {
+			_, hasPosition := obj.Position()
+			holder, _ := obj.Props["heldby"].(string)
+			ok = hasPosition && holder == ""
+		}
+		gs.mu.Unlock()
+		if !ok {
+			return false
+		}
+	case AttachLight:
+		lightID, err := strconv.Atoi(id)
+		if err != nil || !gs.lights.Exists(lightID) {
+			return false
+		}
+	case AttachEntity:
+		if gs.EntityBody(id) == nil || am.follows(parent, id) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if previous, ok := am.attachments[key]; ok {
+		am.release(gs, previous)
+	}
+	a := &Attachment{Kind: kind, ID: id, Parent: parent, Offset: offset}
+	am.attachments[key] = a
+	am.place(gs, a, parentBody)
+	if kind == AttachObject {
+		// Clients draw the object at its parent, like a held object at its carrier
+		oid, _ := strconv.Atoi(id)
+		gs.mu.Lock()
+		obj, _ := gs.Object(oid)
+		obj.Props["attachedto"] = parent
+		obj.Props["attachx"] = offset.X
+		obj.Props["attachy"] = offset.Y
+		gs.mu.Unlock()
+		gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+	}
+	return true
+}
+
+// follows reports whether an entity is, directly or through other bodies, attached to another
+func (am *AttachmentManager) follows(entityID, ancestor string) bool {
+	for depth := 0; depth <= len(am.attachments); depth++ {
+		if entityID == ancestor {
+			return true
+		}
+		a, ok := am.attachments[attachKey{kind: AttachEntity, id: entityID}]
+		if !ok {
+			return false
+		}
+		entityID = a.Parent
+	}
+	return true
+}
+
+// Detach ends a child's attachment; an object keeps its current position. It reports whether
+// the child was attached.
+func (am *AttachmentManager) Detach(gs *GameMatchState, kind, id string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) bool {
+	key := attachKey{kind: kind, id: id}
+	a, ok := am.attachments[key]
+	if !ok {
+		return false
+	}
+	delete(am.attachments, key)
+	am.release(gs, a)
+	if kind == AttachObject {
+		if oid, err := strconv.Atoi(id); err == nil {
+			gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+		}
+	}
+	return true
+}
+
+// Get returns a child's attachment
+func (am *AttachmentManager) Get(kind, id string) (Attachment, bool) {
+	a, ok := am.attachments[attachKey{kind: kind, id: id}]
+	if !ok {
+		return Attachment{}, false
+	}
+	return *a, true
+}
+
+// release lets the physics engine collide a child's bodies with its parent again and drops the
+// attachment props of an object
+func (am *AttachmentManager) release(gs *GameMatchState, a *Attachment) {
+	pe := gs.physicsEngine
+	switch a.Kind {
+	case AttachObject:
+		oid, _ := strconv.Atoi(a.ID)
+		gs.mu.Lock()
+		for _, rb := range gs.entities.ObjectColliders(oid) {
+			delete(pe.attachedTo, rb)
+		}
+		// The colliders block nav cells again, where they were left
+		gs.pathfinder.Invalidate()
+		if obj, ok := gs.Object(oid); ok {
+			delete(obj.Props, "attachedto")
+			delete(obj.Props, "attachx")
+			delete(obj.Props, "attachy")
+		}
+		gs.mu.Unlock()
+	case AttachLight:
+		lightID, _ := strconv.Atoi(a.ID)
+		gs.lights.Follow(lightID, vector.Vector{}, "", false)
+	case AttachEntity:
+		if rb := gs.EntityBody(a.ID); rb != nil {
+			delete(pe.attachedTo, rb)
+		}
+	}
+}
+
+// ordered returns the attachments with bodies before the children attached to them, then by
+// kind and ID
+func (am *AttachmentManager) ordered() []*Attachment {
+	depth := func(a *Attachment) int {
+		d := 0
+		for parent := a.Parent; d <= len(am.attachments); d++ {
+			p, ok := am.attachments[attachKey{kind: AttachEntity, id: parent}]
+			if !ok {
+				break
+			}
+			parent = p.Parent
+		}
+		return d
+	}
+	attachments := make([]*Attachment, 0, len(am.attachments))
+	for _, a := range am.attachments {
+		attachments = append(attachments, a)
+	}
+	slices.SortFunc(attachments, func(a, b *Attachment) int {
+		return cmp.Or(cmp.Compare(depth(a), depth(b)), cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.ID, b.ID))
+	})
+	return attachments
+}
+
+// Update moves the children to their parents' new positions and ends the attachments whose
+// parent or child left the world. Called from the match loop after physics.
+func (am *AttachmentManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if len(am.attachments) == 0 {
+		return
+	}
+	for _, a := range am.ordered() {
+		parent := gs.EntityBody(a.Parent)
+		if parent == nil {
+			am.Detach(gs, a.Kind, a.ID, dispatcher, logger)
+			if a.Kind == AttachLight {
+				lightID, _ := strconv.Atoi(a.ID)
+				gs.lights.Remove(lightID)
+			}
+			gs.eventBus.Publish(EventDetached, map[string]any{"kind": a.Kind, "id": a.ID, "parent": a.Parent})
+			continue
+		}
+		if !am.place(gs, a, parent) {
+			delete(am.attachments, attachKey{kind: a.Kind, id: a.ID})
+			am.release(gs, a)
+		}
+	}
+}
+
+// place puts a child at its parent's position plus its offset. It returns false when the child
+// left the world.
+func (am *AttachmentManager) place(gs *GameMatchState, a *Attachment, parent *rigidbody.RigidBody) bool {
+	target := parent.Position.Add(a.Offset)
+	pe := gs.physicsEngine
+	switch a.Kind {
+	case AttachObject:
+		oid, _ := strconv.Atoi(a.ID)
+		gs.mu.Lock()
+		defer gs.mu.Unlock()
+		obj, ok := gs.Object(oid)
+		if !ok {
+			return false
+		}
+		current, ok := obj.Position()
+		if !ok {
+			return false
+		}
+		// Colliders keep their layout around the object's center; rebuilt ones are picked up too.
+		// Polygon colliders move their vertices along.
+		delta := target.Sub(current)
+		for _, rb := range gs.entities.ObjectColliders(oid) {
+			rb.Position = rb.Position.Add(delta)
+			pe.UpdatePolygonVertices(rb)
+			if pe.attachedTo[rb] == nil {
+				// Attached colliders leave the nav grid (Attached), so the cells they blocked
+				// free up; moving along after that doesn't change the grid
+				gs.pathfinder.Invalidate()
+			}
+			pe.attachedTo[rb] = parent
+		}
+		obj.Props["x"] = target.X
+		obj.Props["y"] = target.Y
+	case AttachLight:
+		lightID, _ := strconv.Atoi(a.ID)
+		playerID := ""
+		if _, err := strconv.Atoi(a.Parent); err != nil {
+			playerID = a.Parent // hidden with the player who carries it
+		}
+		return gs.lights.Follow(lightID, target, playerID, true)
+	case AttachEntity:
+		rb := gs.EntityBody(a.ID)
+		if rb == nil {
+			return false
+		}
+		rb.Position = target
+		rb.Velocity = parent.Velocity
+		pe.attachedTo[rb] = parent
+	}
+	return true
+}
+
+// attachedPair reports whether one of two bodies is attached to the other
+func (pe *PhysicsEngine) attachedPair(a, b *rigidbody.RigidBody) bool {
+	return pe.attachedTo[a] == b || pe.attachedTo[b] == a
+}
+
+// Attached reports whether a body follows a parent; pathfinding leaves such colliders out
+func (pe *PhysicsEngine) Attached(rb *rigidbody.RigidBody) bool {
+	return pe.attachedTo[rb] != nil
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Auction house tuning
+const (
+	defaultAuctionHours    = 24.0
+	minAuctionHours        = 1.0
+	maxAuctionHours        = 72.0
+	defaultAuctionCurrency = "gold"
+	auctionHouseCut        = 0.05          // share of the sale price the house keeps, unless the auction_cut rate says otherwise
+	auctionBidIncrement    = 0.05          // a bid must beat the current one by this share (at least 1)
+	auctionCheckInterval   = 30 * TickRate // ticks between two expiry runs
+	auctionScanLimit       = 1000          // listings read per browse or expiry run
+	auctionPageSize        = 100           // storage list page size, and the most listings a browse returns
+	defaultAuctionBrowse   = 50
+)
+
+// Reasons of auction claims: what the items or currency are for
+const (
+	AuctionClaimBought    = "bought"    // bought out
+	AuctionClaimWon       = "won"       // the highest bid when the listing ended
+	AuctionClaimSold      = "sold"      // the seller's payout (currency only, already in the wallet)
+	AuctionClaimExpired   = "expired"   // ended without bids; the items go back to the seller
+	AuctionClaimCancelled = "cancelled" // taken down by the seller
+)
+
+// Auction events published on the event bus
+const EventAuctionListed = "auction_listed" // listingId, sellerId, itemId, count
+
+var (
+	errAuctionPlayersOnly = runtime.NewError("only players can use the auction house", rpcCodeUnauthenticated)
+	errUnknownListing     = runtime.NewError("no such auction listing", rpcCodeNotFound)
+	errAuctionOwnListing  = runtime.NewError("sellers can't bid on their own listing", rpcCodeFailedPrecondition)
+	errAuctionEnded       = runtime.NewError("the auction has ended", rpcCodeFailedPrecondition)
+	errAuctionNoBuyout    = runtime.NewError("the listing has no buyout price", rpcCodeFailedPrecondition)
+	errAuctionHasBids     = runtime.NewError("listings with bids can't be cancelled", rpcCodeFailedPrecondition)
+	errAuctionNotSeller   = runtime.NewError("only the seller can cancel a listing", rpcCodePermissionDenied)
+	errBidTooLow          = runtime.NewError("the bid is below the minimum bid", rpcCodeFailedPrecondition)
+	errAuctionFunds       = runtime.NewError("not enough currency", rpcCodeFailedPrecondition)
+	errAuctionChanged     = runtime.NewError("the listing changed meanwhile; try again", rpcCodeFailedPrecondition)
+)
+
+// AuctionData is a listing as returned by auction_browse
+type AuctionData struct {
+	*PersistedAuction
+	MinBid int64 `json:"minBid"`
+}
+
+// AuctionDelivery is sent to a player when claims from the auction house reach them
+type AuctionDelivery struct {
+	Claims []*PersistedAuctionClaim `json:"claims"`
+}
+
+// minBid returns the lowest bid the listing accepts
+func (a *PersistedAuction) minBid() int64 {
+	if a.BidderID == "" {
+		return a.StartPrice
+	}
+	return a.Bid + int64(math.Max(1, math.Ceil(float64(a.Bid)*auctionBidIncrement)))
+}
+
+// ended reports whether the listing is past its expiry
+func (a *PersistedAuction) ended(now time.Time) bool {
+	return !now.Before(a.ExpiresAt)
+}
+
+// AuctionHouse is the match side of the auction house: it escrows the items of new listings,
+// hands out the items and payouts waiting for players, and ends expired listings. Listings,
+// bids and claims live in storage, and every change that moves items or currency is one
+// conditional MultiUpdate, so a listing is settled exactly once.
+type AuctionHouse struct {
+	logger runtime.Logger
+	db     *DatabaseManager
+}
+
+// NewAuctionHouse creates the auction house of a match
+func NewAuctionHouse(logger runtime.Logger, db *DatabaseManager) *AuctionHouse {
+	return &AuctionHouse{logger: logger, db: db}
+}
+
+// List puts items up for auction. The items leave the inventory first, then the listing fee (the
+// listing rate's share of the starting price) is charged; both come back if the listing can't be
+// written. The listing keeps the house cut in effect now. It returns a reject reason, or "" on
+// success.
+func (ah *AuctionHouse) List(ctx context.Context, gs *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher) string {
+	if _, ok := gs.itemCatalog.Get(input.ItemID); !ok {
+		return RejectUnknownItem
+	}
+	count := input.Count
+	if count <= 0 {
+		count = 1
+	}
+	hours := input.Duration
+	if hours == 0 {
+		hours = defaultAuctionHours
+	}
+	if input.Price <= 0 || (input.Buyout != 0 && input.Buyout < input.Price) || hours < minAuctionHours || hours > maxAuctionHours {
+		return RejectInvalidListing
+	}
+	currency := input.Currency
+	if currency == "" {
+		currency = defaultAuctionCurrency
+	}
+
+	if err := gs.inventoryManager.Remove(ctx, input.PlayerID, input.ItemID, count); err != nil {
+		if err != errNotEnoughItems {
+			ah.logger.Error("Auction: failed to escrow %d x %s from %s: %v", count, input.ItemID, input.PlayerID, err)
+			return RejectStorageError
+		}
+		return RejectNotOwned
+	}
+	fee := gs.Price(SinkListing, input.Price)
+	if reason := gs.ChargeFee(ctx, input.PlayerID, SinkListing, currency, fee); reason != "" {
+		if err := gs.inventoryManager.Add(ctx, input.PlayerID, input.ItemID, count); err != nil {
+			ah.logger.Error("Auction: failed to return %d x %s to %s: %v", count, input.ItemID, input.PlayerID, err)
+		}
+		return reason
+	}
+
+	cut := economyRate(gs.worldSettings, SinkAuctionCut)
+	now := time.Now().UTC()
+	listing := &PersistedAuction{
+		ID:         newAuctionID(),
+		SellerID:   input.PlayerID,
+		SellerName: gs.usernameOf(input.PlayerID),
+		ItemID:     input.ItemID,
+		Count:      count,
+		Currency:   currency,
+		StartPrice: input.Price,
+		Buyout:     input.Buyout,
+		ListingFee: fee,
+		HouseCut:   &cut,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Duration(hours * float64(time.Hour))),
+	}
+	if err := ah.db.CommitAuction(ctx, []*runtime.StorageWrite{auctionWrite(listing, "*")}, nil, nil); err != nil {
+		if err := gs.inventoryManager.Add(ctx, input.PlayerID, input.ItemID, count); err != nil {
+			ah.logger.Error("Auction: failed to return %d x %s to %s: %v", count, input.ItemID, input.PlayerID, err)
+		}
+		if err := gs.RefundFee(ctx, input.PlayerID, SinkListing, currency, fee); err != nil {
+			ah.logger.Error("Auction: failed to refund the listing fee of %d %s to %s: %v", fee, currency, input.PlayerID, err)
+		}
+		return RejectStorageError
+	}
+
+	ack.ItemID = input.ItemID
+	gs.inventoryManager.SyncToClient(ctx, gs, input.PlayerID, dispatcher)
+	gs.eventBus.Publish(EventAuctionListed, map[string]any{"listingId": listing.ID, "sellerId": listing.SellerID, "itemId": listing.ItemID, "count": listing.Count})
+	ah.send(gs, input.PlayerID, "auction_listed", listing, dispatcher)
+	ah.logger.Info("Auction %s: %s listed %d x %s for %d %s (fee %d)", listing.ID, input.PlayerID, count, input.ItemID, input.Price, currency, fee)
+	return ""
+}
+
+// Deliver hands a player the claims waiting for them: items go into the inventory, payouts are
+// only reported. Each claim is deleted at the version it was read at before its items are
+// added, so a claim delivered by two matches at once only pays out once.
+func (ah *AuctionHouse) Deliver(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	claims, err := ah.db.ListAuctionClaims(ctx, playerID)
+	if err != nil || len(claims) == 0 {
+		return
+	}
+
+	delivered := make([]*PersistedAuctionClaim, 0, len(claims))
+	items := false
+	for _, claim := range claims {
+		if err := ah.db.DeleteAuctionClaim(ctx, playerID, claim); err != nil {
+			continue
+		}
+		if claim.ItemID != "" && claim.Count > 0 {
+			entry := &JournalEntry{Key: gs.journal.Key("auction_claim", claim.ListingID, gs.currentTick), Kind: JournalItemGrant, PlayerID: playerID, Items: map[string]int{claim.ItemID: claim.Count}, Source: "auction:" + claim.ListingID}
+			// The versioned delete above already keeps the claim from being delivered twice
+			_ = gs.journal.Begin(ctx, entry)
+			err := gs.inventoryManager.Add(ctx, playerID, claim.ItemID, claim.Count)
+			gs.journal.Finish(ctx, entry, err)
+			if err != nil {
+				ah.logger.Error("Auction: failed to deliver %d x %s to %s: %v", claim.Count, claim.ItemID, playerID, err)
+				if err := ah.db.CommitAuction(ctx, []*runtime.StorageWrite{auctionClaimWrite(playerID, claim)}, nil, nil); err != nil {
+					ah.logger.Error("Auction: lost claim %s of %s: %v", claim.ListingID, playerID, err)
+				}
+				continue
+			}
+			items = true
+		}
+		delivered = append(delivered, claim)
+	}
+	if len(delivered) == 0 {
+		return
+	}
+	if items {
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	}
+	ah.send(gs, playerID, "auction_delivered", AuctionDelivery{Claims: delivered}, dispatcher)
+}
+
+// Update ends the expired listings every auctionCheckInterval. Only the primary shard of the
+// default world map runs it; the conditional writes keep a listing from being settled twice
+// anyway. Players online here get their claims at once, the others on their next join or
+// auction_collect. Called from the match loop.
+func (ah *AuctionHouse) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick%auctionCheckInterval != 0 || gs.instanced() || !gs.shard.Primary() || gs.currentMapName != defaultWorldMap {
+		return
+	}
+	now := time.Now().UTC()
+	listings, err := ah.db.ListAuctions(ctx, StoreFilter{Field: "expiresAt", Before: now.Format(time.RFC3339Nano)})
+	if err != nil {
+		return
+	}
+	for _, listing := range listings {
+		if !listing.ended(now) {
+			continue
+		}
+		recipients, err := ah.Settle(ctx, listing)
+		if err != nil {
+			continue
+		}
+		for _, playerID := range recipients {
+			if _, online := gs.presences[playerID]; online {
+				ah.Deliver(ctx, gs, playerID, dispatcher)
+			}
+		}
+	}
+}
+
+// Settle ends a listing: the highest bidder gets the items and the seller the bid minus the
+// house cut, or the items go back to the seller without bids. It returns the players who got
+// claims.
+func (ah *AuctionHouse) Settle(ctx context.Context, listing *PersistedAuction) ([]string, error) {
+	if listing.BidderID == "" {
+		claim := &PersistedAuctionClaim{ListingID: listing.ID, ItemID: listing.ItemID, Count: listing.Count, Reason: AuctionClaimExpired, At: time.Now().UTC()}
+		writes := []*runtime.StorageWrite{auctionClaimWrite(listing.SellerID, claim)}
+		if err := ah.db.CommitAuction(ctx, writes, []*runtime.StorageDelete{auctionDelete(listing)}, nil); err != nil {
+			return nil, err
+		}
+		ah.logger.Info("Auction %s expired without bids", listing.ID)
+		return []string{listing.SellerID}, nil
+	}
+
+	writes, wallets := saleWrites(listing, listing.BidderID, listing.Bid, AuctionClaimWon)
+	if err := ah.db.CommitAuction(ctx, writes, []*runtime.StorageDelete{auctionDelete(listing)}, wallets); err != nil {
+		return nil, err
+	}
+	ah.logger.Info("Auction %s won by %s for %d %s", listing.ID, listing.BidderID, listing.Bid, listing.Currency)
+	recordHouseCut(listing, listing.Bid)
+	notifyAuctionSold(ctx, listing, listing.BidderName, listing.Bid)
+	return []string{listing.BidderID, listing.SellerID}, nil
+}
+
+// saleWrites returns the claims and wallet updates of selling a listing to buyerID at price:
+// the buyer's items claim, and the seller's payout (minus the house cut) with a claim telling
+// them about it, plus the trade's journal records. Charging the buyer is up to the caller.
+func saleWrites(listing *PersistedAuction, buyerID string, price int64, reason string) ([]*runtime.StorageWrite, []*runtime.WalletUpdate) {
+	now := time.Now().UTC()
+	payout := auctionPayout(listing, price)
+	writes := []*runtime.StorageWrite{
+		auctionClaimWrite(buyerID, &PersistedAuctionClaim{ListingID: listing.ID, ItemID: listing.ItemID, Count: listing.Count, Reason: reason, Currency: listing.Currency, Amount: price, At: now}),
+		auctionClaimWrite(listing.SellerID, &PersistedAuctionClaim{ListingID: listing.ID, Reason: AuctionClaimSold, Currency: listing.Currency, Amount: payout, At: now}),
+	}
+	source := "auction:" + listing.ID
+	writes = append(writes, tradeJournalWrites(source, buyerID, listing.SellerID, source, map[string]int{listing.ItemID: listing.Count},
+		map[string]int64{listing.Currency: -price}, map[string]int64{listing.Currency: payout})...)
+	wallets := []*runtime.WalletUpdate{{
+		UserID:    listing.SellerID,
+		Changeset: map[string]int64{listing.Currency: payout},
+		Metadata:  map[string]interface{}{"reason": "auction_sale", "listing": listing.ID},
+	}}
+	return writes, wallets
+}
+
+// auctionPayout is what the seller gets for a sale at price: the price minus the listing's house
+// cut
+func auctionPayout(listing *PersistedAuction, price int64) int64 {
+	cut := auctionHouseCut
+	if listing.HouseCut != nil {
+		cut = *listing.HouseCut
+	}
+	return price - int64(math.Floor(float64(price)*cut))
+}
+
+// recordHouseCut counts the house cut of a committed sale as currency leaving the economy
+func recordHouseCut(listing *PersistedAuction, price int64) {
+	economy.Record("fee:"+SinkAuctionCut, map[string]int64{listing.Currency: auctionPayout(listing, price) - price})
+}
+
+// notifyAuctionSold tells the seller of a listing that it sold, wherever they are
+func notifyAuctionSold(ctx context.Context, listing *PersistedAuction, buyerName string, price int64) {
+	notifier.Queue(ctx, listing.SellerID, notificationAuctionSold, "Auction sold", map[string]interface{}{
+		"listingId": listing.ID,
+		"itemId":    listing.ItemID,
+		"count":     listing.Count,
+		"buyer":     buyerName,
+		"price":     price,
+		"payout":    auctionPayout(listing, price),
+		"currency":  listing.Currency,
+	}, "", true)
+}
+
+// send delivers an OpCodeAuction message to one player if they are online
+func (ah *AuctionHouse) send(gs *GameMatchState, playerID, msgType string, data interface{}, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+	payload, err := EncodeMessage(OpCodeAuction, msgType, data)
+	if err != nil {
+		ah.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeAuction, payload, []runtime.Presence{presence}, nil, true)
+}
+
+// newAuctionID returns a random listing ID
+func newAuctionID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// auctionSignal tells the open world shards that players have claims waiting, so those online
+// get them at once
+func auctionSignal(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, playerIDs ...string) {
+	payload, err := json.Marshal(map[string][]string{"playerIds": playerIDs})
+	if err != nil {
+		return
+	}
+	if _, err := signalMatches(ctx, logger, nk, "", MatchSignalRequest{Type: SignalAuctionClaims, Payload: payload}); err != nil {
+		logger.Warn("Failed to signal auction claims: %v", err)
+	}
+}
+
+// RegisterAuctionRpcs registers the auction house RPCs
+func RegisterAuctionRpcs(initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("auction_browse", rpcAuctionBrowse); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("auction_bid", rpcAuctionBid); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("auction_buyout", rpcAuctionBuyout); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("auction_cancel", rpcAuctionCancel); err != nil {
+		return err
+	}
+	return nil
+}
+
+// rpcAuctionBrowse lists the running auctions, filtered and sorted.
+// Payload: {"itemId": "", "sellerId": "", "currency": "", "maxPrice": 0, "sort": "ending|price|newest", "offset": 0, "limit": 50}
+func rpcAuctionBrowse(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req struct {
+		ItemID   string `json:"itemId"`
+		SellerID string `json:"sellerId"`
+		Currency string `json:"currency"`
+		MaxPrice int64  `json:"maxPrice"`
+		Sort     string `json:"sort"`
+		Offset   int    `json:"offset"`
+		Limit    int    `json:"limit"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+	if req.Limit <= 0 || req.Limit > auctionPageSize {
+		req.Limit = defaultAuctionBrowse
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	// The seller and item are looked up by index; the other criteria filter what that finds
+	var filter StoreFilter
+	switch {
+	case req.SellerID != "":
+		filter = StoreFilter{Field: "sellerId", Equals: req.SellerID}
+	case req.ItemID != "":
+		filter = StoreFilter{Field: "itemId", Equals: req.ItemID}
+	}
+	listings, err := NewDatabaseManager(logger, nk).ListAuctions(ctx, filter)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	now := time.Now().UTC()
+	matches := make([]AuctionData, 0, len(listings))
+	for _, listing := range listings {
+		if listing.ended(now) ||
+			(req.ItemID != "" && listing.ItemID != req.ItemID) ||
+			(req.SellerID != "" && listing.SellerID != req.SellerID) ||
+			(req.Currency != "" && listing.Currency != req.Currency) ||
+			(req.MaxPrice > 0 && listing.minBid() > req.MaxPrice && (listing.Buyout == 0 || listing.Buyout > req.MaxPrice)) {
+			continue
+		}
+		matches = append(matches, AuctionData{PersistedAuction: listing, MinBid: listing.minBid()})
+	}
+	switch req.Sort {
+	case "price":
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].MinBid < matches[j].MinBid })
+	case "newest":
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].CreatedAt.After(matches[j].CreatedAt) })
+	default:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].ExpiresAt.Before(matches[j].ExpiresAt) })
+	}
+
+	total := len(matches)
+	page := matches[:0]
+	if req.Offset < total {
+		page = matches[req.Offset:]
+		if len(page) > req.Limit {
+			page = page[:req.Limit]
+		}
+	}
+	out, err := json.Marshal(map[string]interface{}{"listings": page, "total": total})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// rpcAuctionBid places a bid. The bid is taken from the bidder's wallet and the previous bid
+// returned in the same transaction as the listing update. A bid at or above the buyout price
+// buys the listing out.
+// Payload: {"listingId": "...", "amount": 120}
+func rpcAuctionBid(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errAuctionPlayersOnly
+	}
+	var req struct {
+		ListingID string `json:"listingId"`
+		Amount    int64  `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.ListingID == "" {
+		return "", errInvalidPayload
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	listing, err := auctionForBuyer(ctx, dm, req.ListingID, userID)
+	if err != nil {
+		return "", err
+	}
+	if listing.Buyout > 0 && req.Amount >= listing.Buyout {
+		return buyout(ctx, logger, nk, dm, listing, userID)
+	}
+	if req.Amount < listing.minBid() {
+		return "", errBidTooLow
+	}
+	username, wallet, err := accountWallet(ctx, nk, userID)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	if wallet[listing.Currency] < req.Amount {
+		return "", errAuctionFunds
+	}
+
+	wallets := []*runtime.WalletUpdate{{
+		UserID:    userID,
+		Changeset: map[string]int64{listing.Currency: -req.Amount},
+		Metadata:  map[string]interface{}{"reason": "auction_bid", "listing": listing.ID},
+	}}
+	if listing.BidderID != "" {
+		wallets = append(wallets, &runtime.WalletUpdate{
+			UserID:    listing.BidderID,
+			Changeset: map[string]int64{listing.Currency: listing.Bid},
+			Metadata:  map[string]interface{}{"reason": "auction_outbid", "listing": listing.ID},
+		})
+	}
+	outbid := listing.BidderID
+	version := listing.version
+	listing.Bid = req.Amount
+	listing.BidderID = userID
+	listing.BidderName = username
+	listing.Bids++
+	if err := dm.CommitAuction(ctx, []*runtime.StorageWrite{auctionWrite(listing, version)}, nil, wallets); err != nil {
+		return "", errAuctionChanged
+	}
+	logger.Info("Auction %s: %s bid %d %s", listing.ID, userID, req.Amount, listing.Currency)
+
+	out, err := json.Marshal(map[string]interface{}{"listing": AuctionData{PersistedAuction: listing, MinBid: listing.minBid()}, "outbid": outbid})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// rpcAuctionBuyout buys a listing at its buyout price.
+// Payload: {"listingId": "..."}
+func rpcAuctionBuyout(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errAuctionPlayersOnly
+	}
+	var req struct {
+		ListingID string `json:"listingId"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.ListingID == "" {
+		return "", errInvalidPayload
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	listing, err := auctionForBuyer(ctx, dm, req.ListingID, userID)
+	if err != nil {
+		return "", err
+	}
+	if listing.Buyout == 0 {
+		return "", errAuctionNoBuyout
+	}
+	return buyout(ctx, logger, nk, dm, listing, userID)
+}
+
+// buyout sells a listing to userID at its buyout price: the buyer pays, the previous bidder is
+// refunded, the seller is paid and the listing removed in one transaction
+func buyout(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dm *DatabaseManager, listing *PersistedAuction, userID string) (string, error) {
+	username, wallet, err := accountWallet(ctx, nk, userID)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	if wallet[listing.Currency] < listing.Buyout {
+		return "", errAuctionFunds
+	}
+	writes, wallets := saleWrites(listing, userID, listing.Buyout, AuctionClaimBought)
+	wallets = append(wallets, &runtime.WalletUpdate{
+		UserID:    userID,
+		Changeset: map[string]int64{listing.Currency: -listing.Buyout},
+		Metadata:  map[string]interface{}{"reason": "auction_buyout", "listing": listing.ID},
+	})
+	if listing.BidderID != "" {
+		wallets = append(wallets, &runtime.WalletUpdate{
+			UserID:    listing.BidderID,
+			Changeset: map[string]int64{listing.Currency: listing.Bid},
+			Metadata:  map[string]interface{}{"reason": "auction_outbid", "listing": listing.ID},
+		})
+	}
+	if err := dm.CommitAuction(ctx, writes, []*runtime.StorageDelete{auctionDelete(listing)}, wallets); err != nil {
+		return "", errAuctionChanged
+	}
+	logger.Info("Auction %s bought out by %s for %d %s", listing.ID, userID, listing.Buyout, listing.Currency)
+	recordHouseCut(listing, listing.Buyout)
+	auctionSignal(ctx, logger, nk, userID, listing.SellerID)
+	notifyAuctionSold(ctx, listing, username, listing.Buyout)
+
+	out, err := json.Marshal(map[string]interface{}{"listingId": listing.ID, "itemId": listing.ItemID, "count": listing.Count, "price": listing.Buyout, "currency": listing.Currency})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// rpcAuctionCancel takes down a listing without bids; its items go back to the seller.
+// Payload: {"listingId": "..."}
+func rpcAuctionCancel(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errAuctionPlayersOnly
+	}
+	var req struct {
+		ListingID string `json:"listingId"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.ListingID == "" {
+		return "", errInvalidPayload
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	listing, err := dm.LoadAuction(ctx, req.ListingID)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	if listing == nil {
+		return "", errUnknownListing
+	}
+	if listing.SellerID != userID {
+		return "", errAuctionNotSeller
+	}
+	if listing.BidderID != "" {
+		return "", errAuctionHasBids
+	}
+	claim := &PersistedAuctionClaim{ListingID: listing.ID, ItemID: listing.ItemID, Count: listing.Count, Reason: AuctionClaimCancelled, At: time.Now().UTC()}
+	if err := dm.CommitAuction(ctx, []*runtime.StorageWrite{auctionClaimWrite(userID, claim)}, []*runtime.StorageDelete{auctionDelete(listing)}, nil); err != nil {
+		return "", errAuctionChanged
+	}
+	auctionSignal(ctx, logger, nk, userID)
+
+	out, err := json.Marshal(map[string]interface{}{"listingId": listing.ID, "cancelled": true})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// auctionForBuyer loads a listing someone other than its seller may bid on or buy
+func auctionForBuyer(ctx context.Context, dm *DatabaseManager, listingID, userID string) (*PersistedAuction, error) {
+	listing, err := dm.LoadAuction(ctx, listingID)
+	if err != nil {
+		return nil, errInternalFailure
+	}
+	if listing == nil {
+		return nil, errUnknownListing
+	}
+	if listing.SellerID == userID {
+		return nil, errAuctionOwnListing
+	}
+	if listing.ended(time.Now().UTC()) {
+		return nil, errAuctionEnded
+	}
+	return listing, nil
+}
+
+// accountWallet returns a player's username and wallet. Bids check the wallet first for a clear
+// error; the wallet update itself still fails on overdraft.
+func accountWallet(ctx context.Context, nk runtime.NakamaModule, userID string) (string, map[string]int64, error) {
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	wallet := make(map[string]int64)
+	if account.GetWallet() != "" {
+		if err := json.Unmarshal([]byte(account.GetWallet()), &wallet); err != nil {
+			return "", nil, err
+		}
+	}
+	return account.GetUser().GetUsername(), wallet, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+const audioCueObjectType = "audio_cue"
+
+// Audio cue channels: a client plays one music track at a time and mixes ambience tracks
+const (
+	AudioChannelMusic    = "music"
+	AudioChannelAmbience = "ambience"
+)
+
+// Audio cue tuning
+const (
+	defaultAudioCueRadius = 128.0 // px, for point cues without a radius property
+	audioCueExitMargin    = 16.0  // px a player must move past a cue's edge before it is exited, so standing on the edge doesn't flap
+	audioCueCheckInterval = 10    // ticks between position checks
+)
+
+// AudioCue is a sound authored in the map ("audio_cue" objects): a rectangle, or a point or
+// ellipse with a radius, that starts a track when a player walks in and stops it when they
+// leave. Properties: "track" (required), "channel" (music or ambience, default ambience),
+// "loop" (default true), "volume" (0-1, default 1) and "radius" for point cues.
+type AudioCue struct {
+	ID      int     `json:"id"` // object ID
+	Name    string  `json:"name,omitempty"`
+	Track   string  `json:"track"`
+	Channel string  `json:"channel"`
+	Loop    bool    `json:"loop"`
+	Volume  float64 `json:"volume"`
+	X       float64 `json:"x"` // center
+	Y       float64 `json:"y"`
+	Radius  float64 `json:"radius,omitempty"` // circle cues
+	Width   float64 `json:"width,omitempty"`  // rectangle cues
+	Height  float64 `json:"height,omitempty"`
+}
+
+// Contains reports whether a point lies inside the cue grown by margin
+func (c *AudioCue) Contains(p vector.Vector, margin float64) bool {
+	if c.Radius > 0 {
+		dx, dy := p.X-c.X, p.Y-c.Y
+		r := c.Radius + margin
+		return dx*dx+dy*dy <= r*r
+	}
+	return p.X >= c.X-c.Width/2-margin && p.X <= c.X+c.Width/2+margin &&
+		p.Y >= c.Y-c.Height/2-margin && p.Y <= c.Y+c.Height/2+margin
+}
+
+// parseAudioCue reads an "audio_cue" object. Rectangles are areas; points and ellipses are
+// circles around their center.
+func (ml *MapLoader) parseAudioCue(obj *TiledObject, worldX, worldY float64) (AudioCue, bool) {
+	cue := AudioCue{ID: obj.ID, Name: obj.Name, Channel: AudioChannelAmbience, Loop: true, Volume: 1, X: worldX, Y: worldY}
+	for _, p := range obj.Properties {
+		switch strings.ToLower(p.Name) {
+		case "track":
+			cue.Track, _ = p.Value.(string)
+		case "channel":
+			if v, ok := p.Value.(string); ok {
+				cue.Channel = strings.ToLower(v)
+			}
+		case "loop":
+			if v, ok := p.Value.(bool); ok {
+				cue.Loop = v
+			}
+		case "volume":
+			if v, ok := p.Value.(float64); ok && v >= 0 && v <= 1 {
+				cue.Volume = v
+			}
+		case "radius":
+			if v, ok := p.Value.(float64); ok && v > 0 {
+				cue.Radius = v
+			}
+		}
+	}
+	if cue.Track == "" {
+		ml.logger.Warn("Audio cue %q (id %d) has no track property; skipping", obj.Name, obj.ID)
+		return AudioCue{}, false
+	}
+	if cue.Channel != AudioChannelMusic && cue.Channel != AudioChannelAmbience {
+		ml.logger.Warn("Audio cue %q (id %d) has unknown channel %q; using ambience", obj.Name, obj.ID, cue.Channel)
+		cue.Channel = AudioChannelAmbience
+	}
+	switch {
+	case obj.Ellipse && obj.Width > 0:
+		if cue.Radius == 0 {
+			cue.Radius = obj.Width / 2
+		}
+	case obj.Width > 0 && obj.Height > 0 && cue.Radius == 0:
+		cue.Width, cue.Height = obj.Width, obj.Height
+	case cue.Radius == 0:
+		cue.Radius = defaultAudioCueRadius
+	}
+	return cue, true
+}
+
+// AudioCueUpdate tells a player which audio cues they walked into and out of
+type AudioCueUpdate struct {
+	Enter []AudioCue `json:"enter,omitempty"`
+	Exit  []int      `json:"exit,omitempty"` // cue IDs
+}
+
+// AudioCueManager follows the players through the map's audio cues and sends each player an
+// audio_cues message (OpCodeAudio) when they enter or leave some, so audio direction lives in
+// the map instead of the client. A joining player gets the cues they stand in on the first
+// check. It is only used from the match loop.
+type AudioCueManager struct {
+	logger  runtime.Logger
+	players map[string]map[int]bool // player ID -> IDs of the cues they are in
+}
+
+// NewAudioCueManager creates an audio cue manager with no players
+func NewAudioCueManager(logger runtime.Logger) *AudioCueManager {
+	return &AudioCueManager{
+		logger:  logger,
+		players: make(map[string]map[int]bool),
+	}
+}
+
+// Leave forgets a player who left the match
+func (am *AudioCueManager) Leave(playerID string) {
+	delete(am.players, playerID)
+}
+
+// Update sends the players the cues they entered and exited since the last check. Called from
+// the match loop.
+func (am *AudioCueManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick%audioCueCheckInterval != 0 || gs.currentMap == nil || len(gs.currentMap.AudioCues) == 0 {
+		return
+	}
+	for playerID, presence := range gs.Presences() {
+		rb := gs.PlayerBody(playerID)
+		if rb == nil {
+			continue
+		}
+		active, ok := am.players[playerID]
+		if !ok {
+			active = make(map[int]bool)
+			am.players[playerID] = active
+		}
+
+		var update AudioCueUpdate
+		for i := range gs.currentMap.AudioCues {
+			cue := &gs.currentMap.AudioCues[i]
+			if active[cue.ID] {
+				if !cue.Contains(rb.Position, audioCueExitMargin) {
+					delete(active, cue.ID)
+					update.Exit = append(update.Exit, cue.ID)
+				}
+			} else if cue.Contains(rb.Position, 0) {
+				active[cue.ID] = true
+				update.Enter = append(update.Enter, *cue)
+			}
+		}
+		if len(update.Enter) == 0 && len(update.Exit) == 0 || dispatcher == nil {
+			continue
+		}
+		sort.Ints(update.Exit)
+
+		data, err := EncodeMessage(OpCodeAudio, "audio_cues", update)
+		if err != nil {
+			am.logger.Error("Failed to marshal audio cues for %s: %v", playerID, err)
+			continue
+		}
+		dispatcher.BroadcastMessage(OpCodeAudio, data, []runtime.Presence{presence}, nil, true)
+	}
+}
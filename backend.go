@@ -8,6 +8,29 @@ import (
 )
 
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	// Where records are kept: Nakama storage, and SQL tables for the collections the runtime env
+	// names in persistence_sql_collections
+	persistence = NewPersistenceStore(ctx, logger, db, nk)
+
+	// Notifications reach players outside matches; matches and RPCs queue them for batching
+	notifier = StartNotifier(logger, nk)
+
+	// Translations of the server messages; the built-in English ones are used without them
+	if err := messageCatalog.Load(logger, "/nakama/data/messages.json"); err != nil {
+		logger.Warn("Failed to load message translations: %v", err)
+	}
+
+	// Currency created and destroyed, exported as metrics and reported by admin_economy
+	economy = NewEconomyStats(nk)
+
+	// Content filter for chat, guild and pet names and mail: the word list, or the moderation
+	// service set in the runtime env
+	moderator = NewContentModerator(ctx, logger, nk, "/nakama/data/wordlist.json")
+	if err := initializer.RegisterBeforeRt("ChannelMessageSend", beforeChannelMessageSend); err != nil {
+		logger.Error("unable to register chat moderation hook: %v", err)
+		return err
+	}
+
 	// Register the game match
 	if err := initializer.RegisterMatch("game", func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (runtime.Match, error) {
 		return &GameMatch{}, nil
@@ -16,6 +39,69 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		return err
 	}
 
+	// Register admin RPCs
+	if err := RegisterAdminRpcs(initializer); err != nil {
+		logger.Error("unable to register admin rpcs: %v", err)
+		return err
+	}
+
+	// Register dungeon RPCs
+	if err := RegisterDungeonRpcs(initializer); err != nil {
+		logger.Error("unable to register dungeon rpcs: %v", err)
+		return err
+	}
+
+	// Register the RPC players use to find an open world shard
+	if err := RegisterWorldRpcs(initializer); err != nil {
+		logger.Error("unable to register world rpcs: %v", err)
+		return err
+	}
+	if err := RegisterCustomWorldRpcs(initializer); err != nil {
+		logger.Error("unable to register custom world rpcs: %v", err)
+		return err
+	}
+
+	// Register the RPCs showing where players were last seen
+	if err := RegisterPlayerLocationRpcs(initializer); err != nil {
+		logger.Error("unable to register player location rpcs: %v", err)
+		return err
+	}
+
+	// Register the RPC players keep their client settings with
+	if err := RegisterPreferenceRpcs(initializer); err != nil {
+		logger.Error("unable to register preference rpcs: %v", err)
+		return err
+	}
+
+	// Register the RPC external services (the companion web app) read player profiles from
+	if err := initializer.RegisterRpc("player_profile", rpcPlayerProfile); err != nil {
+		logger.Error("unable to register player profile rpc: %v", err)
+		return err
+	}
+
+	// Register the RPC clients fetch message templates from
+	if err := initializer.RegisterRpc("messages", rpcMessages); err != nil {
+		logger.Error("unable to register messages rpc: %v", err)
+		return err
+	}
+
+	// Register the RPC clients fetch the tilesets and tile ranges of a map from
+	if err := initializer.RegisterRpc("asset_manifest", rpcAssetManifest); err != nil {
+		logger.Error("unable to register asset manifest rpc: %v", err)
+		return err
+	}
+
+	// Register the auction house RPCs
+	if err := RegisterAuctionRpcs(initializer); err != nil {
+		logger.Error("unable to register auction rpcs: %v", err)
+		return err
+	}
+
+	// Duel wins are ranked on a leaderboard; duels still work without it
+	if err := EnsureDuelLeaderboard(ctx, nk, logger); err != nil {
+		logger.Error("failed to create duel leaderboard: %v", err)
+	}
+
 	// Ensure the default game match exists
 	if err := EnsureDefaultMatch(ctx, nk, logger); err != nil {
 		logger.Error("failed to ensure default match exists: %v", err)
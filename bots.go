@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Bot tuning
+const (
+	botIDPrefix         = "bot-"
+	maxBots             = 500
+	botMoveInterval     = 3 // ticks between move inputs (20 per second, like a client)
+	botMinTurnTicks     = TickRate
+	botMaxTurnTicks     = 4 * TickRate
+	botStopChance       = 0.2 // chance a bot stands still instead of picking a new direction
+	botSpeedFactor      = 0.8 // bots walk at this fraction of their maximum speed
+	botMinInteractTicks = 5 * TickRate
+	botMaxInteractTicks = 15 * TickRate
+	botReportInterval   = 10 * TickRate
+)
+
+// botPresence stands in for a connected client so bots show up in world updates like players
+type botPresence struct {
+	userID   string
+	username string
+}
+
+func (p *botPresence) GetHidden() bool                   { return false }
+func (p *botPresence) GetPersistence() bool              { return false }
+func (p *botPresence) GetUsername() string               { return p.username }
+func (p *botPresence) GetStatus() string                 { return "" }
+func (p *botPresence) GetReason() runtime.PresenceReason { return runtime.PresenceReasonUnknown }
+func (p *botPresence) GetUserId() string                 { return p.userID }
+func (p *botPresence) GetSessionId() string              { return p.userID }
+func (p *botPresence) GetNodeId() string                 { return "" }
+
+// bot is a simulated player wandering the map
+type bot struct {
+	presence     *botPresence
+	velocity     vector.Vector
+	nextTurn     int64
+	nextInteract int64
+	sequence     uint64
+}
+
+// BotSignalReport is the response to the bots signal: the bots running and the last load report
+type BotSignalReport struct {
+	Bots   int        `json:"bots"`
+	Report *BotReport `json:"report"` // nil before the first report
+}
+
+// BotReport summarizes the load of the match over the last report interval
+type BotReport struct {
+	Bots              int     `json:"bots"`
+	Players           int     `json:"players"` // connected players, bots excluded
+	Seconds           float64 `json:"seconds"` // length of the measured window
+	Ticks             int     `json:"ticks"`
+	AvgTickMs         float64 `json:"avgTickMs"`
+	MaxTickMs         float64 `json:"maxTickMs"`
+	TickBudgetMs      float64 `json:"tickBudgetMs"`
+	OverBudget        int     `json:"overBudget"`        // ticks that took longer than the budget
+	BytesOutPerSec    float64 `json:"bytesOutPerSec"`    // everything the match sent, to players and bots
+	MessagesOutPerSec float64 `json:"messagesOutPerSec"` // messages per recipient
+	BytesPerBotPerSec float64 `json:"bytesPerBotPerSec"` // what each bot received on average
+	BytesInPerSec     float64 `json:"bytesInPerSec"`     // bot inputs
+}
+
+// BotDriver runs headless bots inside the match for load testing: each bot is a player body
+// driven by generated move and interact inputs that go through the normal input processing,
+// and receives the match's broadcasts like a client would. While bots run, the driver measures
+// tick time and bandwidth. It is only used from the match loop.
+type BotDriver struct {
+	logger runtime.Logger
+	rng    *rand.Rand // separate from the match's rng so bots don't change seeded gameplay
+	bots   map[string]*bot
+	nextID int
+
+	windowStart int64
+	ticks       int
+	tickTotal   time.Duration
+	tickMax     time.Duration
+	overBudget  int
+	bytesOut    int64
+	messagesOut int64
+	botBytes    int64
+	bytesIn     int64
+	report      *BotReport
+}
+
+// NewBotDriver creates a driver without bots
+func NewBotDriver(logger runtime.Logger) *BotDriver {
+	return &BotDriver{
+		logger: logger,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		bots:   make(map[string]*bot),
+	}
+}
+
+// Count returns how many bots are running
+func (bd *BotDriver) Count() int {
+	return len(bd.bots)
+}
+
+// IsBot reports whether a player ID belongs to a bot
+func IsBot(playerID string) bool {
+	return strings.HasPrefix(playerID, botIDPrefix)
+}
+
+// SetCount spawns or removes bots until count are running (capped at maxBots)
+func (bd *BotDriver) SetCount(gs *GameMatchState, count int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	count = int(math.Max(0, math.Min(float64(count), maxBots)))
+	for len(bd.bots) < count {
+		bd.nextID++
+		presence := &botPresence{userID: fmt.Sprintf("%s%d", botIDPrefix, bd.nextID), username: fmt.Sprintf("Bot %d", bd.nextID)}
+		position := vector.Vector{X: 100, Y: 100}
+		if gs.currentMap != nil {
+			position = gs.spawnPoint()
+		}
+		gs.addPresence(presence)
+		gs.inputProcessor.CreatePlayerObject(gs, presence.userID, position)
+		bd.bots[presence.userID] = &bot{presence: presence}
+	}
+	for _, botID := range sortedKeys(bd.bots) {
+		if len(bd.bots) <= count {
+			break
+		}
+		gs.Dismount(botID, dispatcher, logger)
+		gs.Release(botID, true, dispatcher, logger)
+		gs.inputProcessor.RemovePlayerObject(gs, botID)
+		gs.removePresence(botID)
+		delete(bd.bots, botID)
+	}
+	if count == 0 {
+		bd.report = nil
+	}
+	bd.resetWindow(gs.currentTick)
+	logger.Info("Running %d bots", len(bd.bots))
+}
+
+// Inputs generates this tick's bot inputs and processes them like player messages, returning
+// their ACKs
+func (bd *BotDriver) Inputs(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) []*InputACK {
+	if len(bd.bots) == 0 {
+		return nil
+	}
+	acks := make([]*InputACK, 0, len(bd.bots))
+	for botID, b := range bd.bots {
+		input := bd.nextInput(gs, botID, b)
+		if input == nil {
+			continue
+		}
+		if data, err := json.Marshal(input); err == nil {
+			bd.bytesIn += int64(len(data))
+		}
+		if ack := gs.inputProcessor.ProcessPlayerInput(ctx, gs, input, dispatcher, logger); ack != nil {
+			acks = append(acks, ack)
+		}
+	}
+	return acks
+}
+
+// nextInput decides what a bot does this tick: respawn when dead, now and then interact with a
+// scripted object nearby, and otherwise wander, changing direction every few seconds
+func (bd *BotDriver) nextInput(gs *GameMatchState, botID string, b *bot) *PlayerInput {
+	rb := gs.PlayerBody(botID)
+	if rb == nil {
+		return nil
+	}
+	tick := gs.currentTick
+	state := gs.GetPlayerState(botID)
+	if state.IsDead() {
+		if tick%TickRate != 0 {
+			return nil
+		}
+		b.sequence++
+		return &PlayerInput{PlayerID: botID, Action: "respawn", InputSequence: b.sequence}
+	}
+
+	if tick >= b.nextInteract {
+		b.nextInteract = tick + botMinInteractTicks + bd.rng.Int63n(botMaxInteractTicks-botMinInteractTicks)
+		if oid, ok := gs.nearestScriptedObject(rb.Position, 2*defaultInteractRange); ok {
+			b.sequence++
+			return &PlayerInput{PlayerID: botID, Action: "interact", ObjectID: oid, InputSequence: b.sequence}
+		}
+	}
+
+	if tick >= b.nextTurn {
+		b.nextTurn = tick + botMinTurnTicks + bd.rng.Int63n(botMaxTurnTicks-botMinTurnTicks)
+		if bd.rng.Float64() < botStopChance {
+			b.velocity = vector.Vector{}
+		} else {
+			angle := bd.rng.Float64() * 2 * math.Pi
+			speed := state.MaxSpeed(gs.config.PlayerMaxSpeed, tick) * botSpeedFactor
+			b.velocity = vector.Vector{X: math.Cos(angle) * speed, Y: math.Sin(angle) * speed}
+		}
+	}
+	if tick%botMoveInterval != 0 {
+		return nil
+	}
+	b.sequence++
+	return &PlayerInput{
+		PlayerID:      botID,
+		Action:        "move",
+		InputSequence: b.sequence,
+		VelocityX:     b.velocity.X,
+		VelocityY:     b.velocity.Y,
+		DeltaTime:     float64(botMoveInterval) / TickRate,
+	}
+}
+
+// Dispatcher returns the dispatcher the match loop should use: while bots run, one that
+// measures what the match sends and keeps messages addressed only to bots from Nakama
+func (bd *BotDriver) Dispatcher(gs *GameMatchState, dispatcher runtime.MatchDispatcher) runtime.MatchDispatcher {
+	if len(bd.bots) == 0 {
+		return dispatcher
+	}
+	return &botDispatcher{MatchDispatcher: dispatcher, driver: bd, gs: gs}
+}
+
+// RecordTick adds the duration of the tick that started at started, and logs a report at the
+// end of each report interval. Deferred at the start of the match loop.
+func (bd *BotDriver) RecordTick(gs *GameMatchState, started time.Time) {
+	if len(bd.bots) == 0 {
+		return
+	}
+	elapsed := time.Since(started)
+	bd.ticks++
+	bd.tickTotal += elapsed
+	if elapsed > bd.tickMax {
+		bd.tickMax = elapsed
+	}
+	if elapsed > time.Second/TickRate {
+		bd.overBudget++
+	}
+	if gs.currentTick-bd.windowStart < botReportInterval {
+		return
+	}
+
+	seconds := float64(gs.currentTick-bd.windowStart) / TickRate
+	report := &BotReport{
+		Bots:              len(bd.bots),
+		Players:           len(gs.presences) - len(bd.bots),
+		Seconds:           seconds,
+		Ticks:             bd.ticks,
+		AvgTickMs:         float64(bd.tickTotal) / float64(bd.ticks) / float64(time.Millisecond),
+		MaxTickMs:         float64(bd.tickMax) / float64(time.Millisecond),
+		TickBudgetMs:      1000.0 / TickRate,
+		OverBudget:        bd.overBudget,
+		BytesOutPerSec:    float64(bd.bytesOut) / seconds,
+		MessagesOutPerSec: float64(bd.messagesOut) / seconds,
+		BytesPerBotPerSec: float64(bd.botBytes) / seconds / float64(len(bd.bots)),
+		BytesInPerSec:     float64(bd.bytesIn) / seconds,
+	}
+	bd.report = report
+	bd.logger.Info("Bot load: %d bots, %d players, tick avg %.2fms max %.2fms (%d over budget), out %.0f B/s, %.0f B/s per bot, in %.0f B/s",
+		report.Bots, report.Players, report.AvgTickMs, report.MaxTickMs, report.OverBudget, report.BytesOutPerSec, report.BytesPerBotPerSec, report.BytesInPerSec)
+	bd.resetWindow(gs.currentTick)
+}
+
+// Report returns the last completed report (nil before the first one)
+func (bd *BotDriver) Report() *BotReport {
+	return bd.report
+}
+
+// resetWindow starts a new measuring window
+func (bd *BotDriver) resetWindow(tick int64) {
+	bd.windowStart = tick
+	bd.ticks = 0
+	bd.tickTotal = 0
+	bd.tickMax = 0
+	bd.overBudget = 0
+	bd.bytesOut = 0
+	bd.messagesOut = 0
+	bd.botBytes = 0
+	bd.bytesIn = 0
+}
+
+// botDispatcher counts the bytes each message costs and drops the copies addressed to bots
+type botDispatcher struct {
+	runtime.MatchDispatcher
+	driver *BotDriver
+	gs     *GameMatchState
+}
+
+func (d *botDispatcher) BroadcastMessage(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	presences, send := d.meter(data, presences)
+	if !send {
+		return nil
+	}
+	return d.MatchDispatcher.BroadcastMessage(opCode, data, presences, sender, reliable)
+}
+
+func (d *botDispatcher) BroadcastMessageDeferred(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	presences, send := d.meter(data, presences)
+	if !send {
+		return nil
+	}
+	return d.MatchDispatcher.BroadcastMessageDeferred(opCode, data, presences, sender, reliable)
+}
+
+// meter counts a message for each recipient (every presence when presences is nil) and returns
+// the recipients that aren't bots; send is false when only bots were addressed
+func (d *botDispatcher) meter(data []byte, presences []runtime.Presence) ([]runtime.Presence, bool) {
+	size := int64(len(data))
+	if presences == nil {
+		d.driver.bytesOut += size * int64(len(d.gs.presences))
+		d.driver.messagesOut += int64(len(d.gs.presences))
+		d.driver.botBytes += size * int64(len(d.driver.bots))
+		return nil, true
+	}
+	recipients := make([]runtime.Presence, 0, len(presences))
+	for _, presence := range presences {
+		d.driver.bytesOut += size
+		d.driver.messagesOut++
+		if IsBot(presence.GetUserId()) {
+			d.driver.botBytes += size
+			continue
+		}
+		recipients = append(recipients, presence)
+	}
+	return recipients, len(recipients) > 0
+}
+
+// nearestScriptedObject returns the closest object with a script within maxRange of p
+func (gs *GameMatchState) nearestScriptedObject(p vector.Vector, maxRange float64) (int, bool) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	best, bestDistance := 0, maxRange
+	for oid, obj := range gs.Objects() {
+		if script, _ := obj.Props["script"].(string); script == "" {
+			continue
+		}
+		pos, ok := obj.Position()
+		if !ok {
+			continue
+		}
+		if distance := pos.Sub(p).Magnitude(); distance <= bestDistance {
+			best, bestDistance = oid, distance
+		}
+	}
+	return best, best != 0
+}
+
+// botCountParam reads the "bots" match parameter, which may arrive as a number or a string
+func botCountParam(params map[string]interface{}) int {
+	switch v := params["bots"].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+// rpcBots starts, resizes or stops the bots of a match and returns its latest load report.
+// Payload: {"matchId": "required", "count": 50}; without "count" only the report is returned
+func rpcBots(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		MatchID string `json:"matchId"`
+		Count   *int   `json:"count"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.MatchID == "" {
+		return "", errInvalidPayload
+	}
+
+	signalPayload, _ := json.Marshal(map[string]*int{"count": req.Count})
+	responses, err := signalMatches(ctx, logger, nk, req.MatchID, MatchSignalRequest{
+		Type:    SignalBots,
+		Payload: signalPayload,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(responses[req.MatchID]), nil
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+)
+
+// BroadcastEncoder encodes what the match loop sends most often, world updates and input ACKs,
+// into buffers the match keeps from tick to tick. Each entity of a world update is encoded once;
+// the views of players who see less of the world (stealth, darkness) are spliced together from
+// the same fragments rather than encoding the world again for each of them. Only the match loop
+// uses it, and the bytes it returns are valid until its next call: hand them to
+// BroadcastMessage, which has sent them when it returns, never to BroadcastMessageDeferred.
+type BroadcastEncoder struct {
+	frags     bytes.Buffer  // the fragments of the current world update
+	fragEnc   *json.Encoder // encodes into frags
+	out       bytes.Buffer  // the message being sent
+	outEnc    *json.Encoder // encodes into out
+	objects   fragment      // the game objects, the same in every view that sees every player
+	bodies    int           // how many game objects the fragment holds
+	players   map[string]fragment
+	playerIDs []string // sorted, as encoding/json orders map keys
+	npcs      map[int]fragment
+	pets      map[int]fragment
+}
+
+// fragment is where an encoded value lies in the fragment buffer, and the hash of its bytes
+type fragment struct {
+	start, end int
+	hash       uint64
+}
+
+// size is the length of the encoded value
+func (f fragment) size() int {
+	return f.end - f.start
+}
+
+// NewBroadcastEncoder creates the encode buffers of a match
+func NewBroadcastEncoder() *BroadcastEncoder {
+	be := &BroadcastEncoder{players: make(map[string]fragment), npcs: make(map[int]fragment), pets: make(map[int]fragment)}
+	be.fragEnc = json.NewEncoder(&be.frags)
+	be.outEnc = json.NewEncoder(&be.out)
+	return be
+}
+
+// Message encodes a game message: the same bytes as its codec in protocolV1 (message_codec.go),
+// in the reused buffer
+func (be *BroadcastEncoder) Message(msgType string, data any) ([]byte, error) {
+	be.out.Reset()
+	if err := be.encode(GameMessage{Type: msgType, Data: data}); err != nil {
+		return nil, err
+	}
+	return be.out.Bytes(), nil
+}
+
+// Begin encodes the entities of a tick's world update, for the views View assembles
+func (be *BroadcastEncoder) Begin(world GameState) error {
+	be.frags.Reset()
+	clear(be.players)
+	clear(be.npcs)
+	clear(be.pets)
+	be.playerIDs = be.playerIDs[:0]
+
+	var err error
+	if be.objects, err = be.fragment(world.GameObjects); err != nil {
+		return err
+	}
+	be.bodies = len(world.GameObjects)
+	for playerID, data := range world.Players {
+		if be.players[playerID], err = be.fragment(data); err != nil {
+			return err
+		}
+		be.playerIDs = append(be.playerIDs, playerID)
+	}
+	sort.Strings(be.playerIDs)
+	for _, npc := range world.NPCs {
+		if be.npcs[npc.ID], err = be.fragment(npc); err != nil {
+			return err
+		}
+	}
+	for _, pet := range world.Pets {
+		if be.pets[pet.ID], err = be.fragment(pet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// View assembles the world_update message of a view of the world Begin encoded: the world
+// itself, or a copy leaving out what a viewer doesn't see. The bytes are those json.Marshal
+// gives for the view.
+func (be *BroadcastEncoder) View(view GameState) ([]byte, error) {
+	be.out.Reset()
+	be.out.WriteString(`{"type":"world_update","data":{"tick":`)
+	if err := be.encode(view.Tick); err != nil {
+		return nil, err
+	}
+	be.out.WriteString(`,"gameObjects":`)
+	if err := be.writeObjects(view.GameObjects); err != nil {
+		return nil, err
+	}
+
+	be.out.WriteString(`,"players":`)
+	if view.Players == nil {
+		be.out.WriteString("null")
+	} else {
+		be.out.WriteByte('{')
+		first := true
+		for _, playerID := range be.playerIDs {
+			if _, ok := view.Players[playerID]; !ok {
+				continue
+			}
+			if !first {
+				be.out.WriteByte(',')
+			}
+			first = false
+			if err := be.encode(playerID); err != nil {
+				return nil, err
+			}
+			be.out.WriteByte(':')
+			be.out.Write(be.bytes(be.players[playerID]))
+		}
+		be.out.WriteByte('}')
+	}
+
+	be.out.WriteString(`,"npcs":`)
+	if view.NPCs == nil {
+		be.out.WriteString("null")
+	} else {
+		be.out.WriteByte('[')
+		for i, npc := range view.NPCs {
+			if i > 0 {
+				be.out.WriteByte(',')
+			}
+			if err := be.splice(be.npcs, npc.ID, npc); err != nil {
+				return nil, err
+			}
+		}
+		be.out.WriteByte(']')
+	}
+
+	be.out.WriteString(`,"pets":`)
+	if view.Pets == nil {
+		be.out.WriteString("null")
+	} else {
+		be.out.WriteByte('[')
+		for i, pet := range view.Pets {
+			if i > 0 {
+				be.out.WriteByte(',')
+			}
+			if err := be.splice(be.pets, pet.ID, pet); err != nil {
+				return nil, err
+			}
+		}
+		be.out.WriteByte(']')
+	}
+
+	// Lights are few and filtered per view; they're encoded as they are
+	if len(view.Lights) > 0 {
+		be.out.WriteString(`,"lights":`)
+		if err := be.encode(view.Lights); err != nil {
+			return nil, err
+		}
+	}
+	if err := be.writeColliders(view.Colliders); err != nil {
+		return nil, err
+	}
+	be.out.WriteString("}}")
+	return be.out.Bytes(), nil
+}
+
+// writeColliders writes the viewer's static collider changes, if they have any. They are rare
+// and per viewer, so they're encoded as they are.
+func (be *BroadcastEncoder) writeColliders(changes []ColliderChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	be.out.WriteString(`,"colliders":`)
+	return be.encode(changes)
+}
+
+// PartialView assembles a world_update carrying only the part of a view the viewer's update
+// priority selected (update_priority.go), marked "partial", with the entities the viewer no
+// longer sees listed under "gone"
+func (be *BroadcastEncoder) PartialView(view GameState, sel *UpdateSelection) ([]byte, error) {
+	be.out.Reset()
+	be.out.WriteString(`{"type":"world_update","data":{"tick":`)
+	if err := be.encode(view.Tick); err != nil {
+		return nil, err
+	}
+	be.out.WriteString(`,"partial":true`)
+	if sel.Objects {
+		be.out.WriteString(`,"gameObjects":`)
+		if err := be.writeObjects(view.GameObjects); err != nil {
+			return nil, err
+		}
+	}
+
+	be.out.WriteString(`,"players":{`)
+	first := true
+	for _, playerID := range be.playerIDs {
+		if _, ok := view.Players[playerID]; !ok || !sel.Players[playerID] {
+			continue
+		}
+		if !first {
+			be.out.WriteByte(',')
+		}
+		first = false
+		if err := be.encode(playerID); err != nil {
+			return nil, err
+		}
+		be.out.WriteByte(':')
+		be.out.Write(be.bytes(be.players[playerID]))
+	}
+	be.out.WriteByte('}')
+
+	be.out.WriteString(`,"npcs":[`)
+	first = true
+	for _, npc := range view.NPCs {
+		if !sel.NPCs[npc.ID] {
+			continue
+		}
+		if !first {
+			be.out.WriteByte(',')
+		}
+		first = false
+		if err := be.splice(be.npcs, npc.ID, npc); err != nil {
+			return nil, err
+		}
+	}
+	be.out.WriteByte(']')
+
+	be.out.WriteString(`,"pets":[`)
+	first = true
+	for _, pet := range view.Pets {
+		if !sel.Pets[pet.ID] {
+			continue
+		}
+		if !first {
+			be.out.WriteByte(',')
+		}
+		first = false
+		if err := be.splice(be.pets, pet.ID, pet); err != nil {
+			return nil, err
+		}
+	}
+	be.out.WriteByte(']')
+
+	if len(view.Lights) > 0 {
+		be.out.WriteString(`,"lights":`)
+		if err := be.encode(view.Lights); err != nil {
+			return nil, err
+		}
+	}
+	if err := be.writeColliders(view.Colliders); err != nil {
+		return nil, err
+	}
+	if !sel.Gone.empty() {
+		be.out.WriteString(`,"gone":`)
+		if err := be.encode(sel.Gone); err != nil {
+			return nil, err
+		}
+	}
+	be.out.WriteString("}}")
+	return be.out.Bytes(), nil
+}
+
+// entity returns the fragment Begin encoded for an entity of the world update
+func (be *BroadcastEncoder) entity(key entityKey) (fragment, bool) {
+	switch key.kind {
+	case entityPlayer:
+		frag, ok := be.players[key.player]
+		return frag, ok
+	case entityNPC:
+		frag, ok := be.npcs[key.id]
+		return frag, ok
+	case entityPet:
+		frag, ok := be.pets[key.id]
+		return frag, ok
+	}
+	return be.objects, true
+}
+
+// writeObjects writes the game objects of a view: the fragment Begin encoded, or, for views
+// leaving out the bodies of players the viewer doesn't see, the bodies encoded as they are
+func (be *BroadcastEncoder) writeObjects(objects []*rigidbody.RigidBody) error {
+	if len(objects) == be.bodies {
+		be.out.Write(be.bytes(be.objects))
+		return nil
+	}
+	return be.encode(objects)
+}
+
+// splice writes the fragment of an entity, or encodes it when Begin didn't see it
+func (be *BroadcastEncoder) splice(frags map[int]fragment, id int, v any) error {
+	if frag, ok := frags[id]; ok {
+		be.out.Write(be.bytes(frag))
+		return nil
+	}
+	return be.encode(v)
+}
+
+// fragment encodes a value into the fragment buffer
+func (be *BroadcastEncoder) fragment(v any) (fragment, error) {
+	start := be.frags.Len()
+	if err := be.fragEnc.Encode(v); err != nil {
+		be.frags.Truncate(start)
+		return fragment{}, err
+	}
+	be.frags.Truncate(be.frags.Len() - 1) // the newline Encode ends with
+	return fragment{start: start, end: be.frags.Len(), hash: hashBytes(be.frags.Bytes()[start:])}, nil
+}
+
+// hashBytes is the 64-bit FNV-1a hash of b, to notice entities whose encoding changed
+func hashBytes(b []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
+
+func (be *BroadcastEncoder) bytes(frag fragment) []byte {
+	return be.frags.Bytes()[frag.start:frag.end]
+}
+
+// encode appends a value to the message being sent
+func (be *BroadcastEncoder) encode(v any) error {
+	start := be.out.Len()
+	if err := be.outEnc.Encode(v); err != nil {
+		be.out.Truncate(start)
+		return err
+	}
+	be.out.Truncate(be.out.Len() - 1) // the newline Encode ends with
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// World update rate bounds, in updates per second. Players outside regions with an
+// "updateRate" property get the default.
+const (
+	defaultWorldUpdateRate = float64(TickRate / worldUpdateIntervalTicks)
+	minWorldUpdateRate     = 1.0
+	maxWorldUpdateRate     = float64(TickRate)
+)
+
+// validUpdateRate reports whether a region's update rate can be honored
+func validUpdateRate(rate float64) bool {
+	return rate >= minWorldUpdateRate && rate <= maxWorldUpdateRate
+}
+
+// updateIntervalTicks turns an update rate into the ticks between world updates
+func updateIntervalTicks(rate float64) int64 {
+	if !validUpdateRate(rate) {
+		rate = defaultWorldUpdateRate
+	}
+	return int64(math.Max(1, math.Round(TickRate/rate)))
+}
+
+// worldUpdateInterval is how many ticks apart a player gets world updates: the update rate of
+// the region they stand in, so a quiet town can be sent at 10Hz and an arena at 30Hz (halved
+// while the match sheds load)
+func (gs *GameMatchState) worldUpdateInterval(playerID string) int64 {
+	region := gs.regionByID(gs.GetPlayerState(playerID).Region)
+	if region == nil || region.UpdateRate == 0 {
+		return gs.load.UpdateInterval(gs.tuning.UpdateIntervalTicks())
+	}
+	return gs.load.UpdateInterval(updateIntervalTicks(region.UpdateRate))
+}
+
+// worldUpdateRecipients returns the players due a world update this tick. Updates are due on the
+// ticks that are multiples of a player's interval, so players sharing a rate share one message.
+// all reports whether every player is due.
+func (gs *GameMatchState) worldUpdateRecipients(tick int64) (due []runtime.Presence, all bool) {
+	due = make([]runtime.Presence, 0, len(gs.presences))
+	for playerID, presence := range gs.Presences() {
+		if tick%gs.worldUpdateInterval(playerID) == 0 {
+			due = append(due, presence)
+		}
+	}
+	return due, len(due) == len(gs.presences)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Building tuning
+const (
+	placeRange         = 128.0      // max distance (pixels) from the player to the placed object's center
+	buildingObjectType = "building" // ObjectData.Type of placed buildables
+)
+
+// BuildableDefinition describes an object players may place. Only IDs present in the
+// buildables data file can be placed, so the file doubles as the whitelist.
+type BuildableDefinition struct {
+	ID     string         `json:"id"`
+	Name   string         `json:"name"`
+	GID    uint32         `json:"gid"`              // tile GID of the placed object (its collision template is used if present)
+	Width  float64        `json:"width,omitempty"`  // footprint in pixels (default one tile)
+	Height float64        `json:"height,omitempty"` // footprint in pixels (default one tile)
+	Cost   map[string]int `json:"cost,omitempty"`   // item ID -> count taken from the inventory
+	Script string         `json:"script,omitempty"` // script run when players interact with the placed object
+	Role   string         `json:"role,omitempty"`   // minimum role allowed to place it (default everyone)
+
+	Permissions EntityPermissions `json:"permissions,omitempty"` // who besides the owner may move, damage or remove it
+}
+
+// BuildZone is a rectangular map area ("build_zone" objects) that changes where players may build.
+// AllowBuild false forbids building inside unless the player has at least Role.
+type BuildZone struct {
+	Name       string
+	Min        vector.Vector
+	Max        vector.Vector
+	AllowBuild bool
+	Role       string
+}
+
+// Contains reports whether a point lies inside the zone
+func (z *BuildZone) Contains(p vector.Vector) bool {
+	return p.X >= z.Min.X && p.X <= z.Max.X && p.Y >= z.Min.Y && p.Y <= z.Max.Y
+}
+
+// BuildableCatalog holds the buildable definitions loaded from the buildables data file
+type BuildableCatalog struct {
+	logger     runtime.Logger
+	buildables map[string]*BuildableDefinition
+	mu         sync.RWMutex
+}
+
+// NewBuildableCatalog creates a catalog and loads definitions from path (a JSON object keyed by buildable ID)
+func NewBuildableCatalog(logger runtime.Logger, path string) *BuildableCatalog {
+	bc := &BuildableCatalog{
+		logger:     logger,
+		buildables: make(map[string]*BuildableDefinition),
+	}
+	if err := bc.Load(path); err != nil {
+		logger.Warn("Failed to load buildable definitions from %s: %v", path, err)
+	}
+	return bc
+}
+
+// Load replaces the catalog with the definitions found in path
+func (bc *BuildableCatalog) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var buildables map[string]*BuildableDefinition
+	if err := json.Unmarshal(data, &buildables); err != nil {
+		return err
+	}
+	for id, def := range buildables {
+		def.ID = id
+		if def.Width <= 0 {
+			def.Width = TileSize
+		}
+		if def.Height <= 0 {
+			def.Height = TileSize
+		}
+		if !def.Permissions.valid() {
+			bc.logger.Warn("Buildable %s has unknown permissions %+v; only its owner may affect it", id, def.Permissions)
+			def.Permissions = EntityPermissions{}
+		}
+	}
+
+	bc.mu.Lock()
+	bc.buildables = buildables
+	bc.mu.Unlock()
+
+	bc.logger.Info("Loaded %d buildable definitions from %s", len(buildables), path)
+	return nil
+}
+
+// Get returns the definition for a buildable ID
+func (bc *BuildableCatalog) Get(buildableID string) (*BuildableDefinition, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	def, ok := bc.buildables[buildableID]
+	return def, ok
+}
+
+// CanBuildAt checks the map's build zones for a player with the given role. Maps with the
+// "buildonlyinzones" property only allow building inside zones that allow it.
+func (gs *GameMatchState) CanBuildAt(position vector.Vector, role string) bool {
+	if gs.currentMap == nil {
+		return false
+	}
+	insideAllowed := false
+	for i := range gs.currentMap.BuildZones {
+		zone := &gs.currentMap.BuildZones[i]
+		if !zone.Contains(position) {
+			continue
+		}
+		if !zone.AllowBuild && (zone.Role == "" || !roleAllows(role, zone.Role)) {
+			return false
+		}
+		insideAllowed = true
+	}
+	for name, value := range gs.currentMap.Properties {
+		if only, _ := value.(bool); only && strings.EqualFold(name, "buildonlyinzones") {
+			return insideAllowed
+		}
+	}
+	return true
+}
+
+// FootprintBlocked reports whether a footprint overlaps any collider, player or placed building
+func (gs *GameMatchState) FootprintBlocked(footprint *rigidbody.RigidBody) bool {
+	pe := gs.physicsEngine
+
+	gs.mu.Lock()
+	bodies := append([]*rigidbody.RigidBody(nil), gs.gameObjects...)
+	for _, obj := range gs.Objects() {
+		if obj.Type != buildingObjectType {
+			continue
+		}
+		pos, ok := obj.Position()
+		w, _ := obj.Props["width"].(float64)
+		h, _ := obj.Props["height"].(float64)
+		if ok && w > 0 && h > 0 {
+			bodies = append(bodies, MakeRectangleRigidBody(pos.X, pos.Y, w, h))
+		}
+	}
+	gs.mu.Unlock()
+
+	for _, rb := range bodies {
+		if pe.aabbOverlap(footprint, rb) && pe.detectCollision(footprint, rb).collided {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Carrying tuning
+const (
+	grabRange      = 64.0 // max distance (pixels) from the player's center to the object's center
+	carryClearance = 4.0  // gap kept between the carrier's body and the held object
+)
+
+// carryableSize returns the footprint of a carryable object ("width"/"height" props, default one tile)
+func carryableSize(obj *ObjectData) (float64, float64) {
+	w, _ := obj.Props["width"].(float64)
+	h, _ := obj.Props["height"].(float64)
+	if w <= 0 {
+		w = TileSize
+	}
+	if h <= 0 {
+		h = TileSize
+	}
+	return w, h
+}
+
+// carryPosition returns where an object of the given size sits in front of the carrier
+func (gs *GameMatchState) carryPosition(playerID string, w, h float64) (vector.Vector, bool) {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return vector.Vector{}, false
+	}
+	reach := max(rb.Width, rb.Height)/2 + max(w, h)/2 + carryClearance
+	return rb.Position.Add(gs.GetPlayerState(playerID).FacingVector().Scale(reach)), true
+}
+
+// Grab picks up the carryable object oid. While held, the object has no colliders and follows
+// the carrier every tick. It returns a rejection reason, or "".
+func (gs *GameMatchState) Grab(playerID string, oid int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+	state := gs.GetPlayerState(playerID)
+	if state.HeldObjectID != 0 {
+		return RejectAlreadyHolding
+	}
+
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	gs.mu.Unlock()
+	if !ok {
+		return RejectUnknownObject
+	}
+	if carryable, _ := obj.Props["carryable"].(bool); !carryable {
+		return RejectNotCarryable
+	}
+	if holder, _ := obj.Props["heldby"].(string); holder != "" {
+		return RejectOccupied
+	}
+	if !gs.CanAffectObject(playerID, oid, EntityMove) {
+		return RejectPermissionDenied
+	}
+	pos, ok := obj.Position()
+	if !ok || pos.Sub(rb.Position).Magnitude() > grabRange {
+		return RejectOutOfRange
+	}
+	if !gs.HasLineOfSight(rb.Position, pos, oid) {
+		return RejectNoLineOfSight
+	}
+
+	gs.mu.Lock()
+	obj.Props["heldby"] = playerID
+	gs.mu.Unlock()
+	gs.RemoveOwnerColliders(oid)
+	state.HeldObjectID = oid
+
+	gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+	return ""
+}
+
+// Release puts the held object down in front of the player. A voluntary release fails with
+// RejectBlocked if the spot is taken; a forced one (damage, death, leaving) drops the object at
+// the player's position instead. It returns a rejection reason, or "".
+func (gs *GameMatchState) Release(playerID string, force bool, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	state, ok := gs.playerStates[playerID]
+	if !ok || state.HeldObjectID == 0 {
+		return RejectNotHolding
+	}
+	oid := state.HeldObjectID
+
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	gs.mu.Unlock()
+	if !ok {
+		// The object was removed while held
+		state.HeldObjectID = 0
+		return ""
+	}
+
+	w, h := carryableSize(obj)
+	spot, ok := gs.carryPosition(playerID, w, h)
+	if ok && gs.FootprintBlocked(MakeRectangleRigidBody(spot.X, spot.Y, w, h)) {
+		if !force {
+			return RejectBlocked
+		}
+		spot = gs.PlayerBody(playerID).Position
+	}
+
+	gs.mu.Lock()
+	delete(obj.Props, "heldby")
+	if ok {
+		obj.Props["x"] = spot.X
+		obj.Props["y"] = spot.Y
+	}
+	gs.mu.Unlock()
+	state.HeldObjectID = 0
+
+	gs.RebuildObjectColliders(oid, logger)
+	gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+	return ""
+}
+
+// UpdateHeldObjects keeps held objects in front of their carriers and makes carriers who took
+// damage drop what they hold. Called from the match loop after physics.
+func (gs *GameMatchState) UpdateHeldObjects(dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	for playerID, state := range inOrder(sortedKeys(gs.playerStates), gs.playerStates) {
+		if state.HeldObjectID == 0 {
+			state.lastHealth = state.Health
+			continue
+		}
+		if state.Health < state.lastHealth {
+			gs.Release(playerID, true, dispatcher, logger)
+			state.lastHealth = state.Health
+			continue
+		}
+		state.lastHealth = state.Health
+
+		gs.mu.Lock()
+		obj, ok := gs.Object(state.HeldObjectID)
+		gs.mu.Unlock()
+		if !ok {
+			state.HeldObjectID = 0
+			continue
+		}
+		w, h := carryableSize(obj)
+		if spot, ok := gs.carryPosition(playerID, w, h); ok {
+			gs.mu.Lock()
+			obj.Props["x"] = spot.X
+			obj.Props["y"] = spot.Y
+			gs.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Anti-cheat signal kinds
+const (
+	CheatSpeed       = "speed"       // a move faster than the player's max speed allows
+	CheatInteraction = "interaction" // an action the player can't do from where they are (no line of sight, input for another player)
+	CheatRateLimit   = "rate_limit"  // an input over the flood or per-action limits
+	CheatTeleport    = "teleport"    // a client-claimed position the server refused
+)
+
+// cheatSignalWeights is how much one signal of each kind adds to a player's score
+var cheatSignalWeights = map[string]float64{
+	CheatSpeed:       1,
+	CheatInteraction: 2,
+	CheatRateLimit:   0.5,
+	CheatTeleport:    5,
+}
+
+// Anti-cheat tuning. A kind counts at most once per cheatSignalCooldown per player, so one lag
+// spike or a client that is a little out of sync adds a point, not a point per input.
+const (
+	cheatSignalCooldown   = TickRate // ticks between counted signals of one kind
+	cheatSpeedTolerance   = 1.25     // moves up to this share of the max speed are not signals
+	cheatSpeedWindow      = TickRate // ticks a max speed counts for after it drops
+	cheatScoreDecay       = 5.0      // score lost per minute without signals
+	cheatFlagScore        = 50.0     // the player is shadow-flagged at this score
+	cheatKickScore        = 100.0    // the player is kicked from the match at this score
+	cheatEvaluateInterval = TickRate // ticks between threshold checks
+	maxCheatRecentSignals = 20       // signals kept in a report for review
+	maxCheatReportPage    = 100      // reports one admin_cheat_reports call returns at most
+)
+
+// CheatSignal is a counted anti-cheat signal as kept in a report
+type CheatSignal struct {
+	Kind   string    `json:"kind"`
+	Detail string    `json:"detail,omitempty"` // e.g. the action or the distance
+	Map    string    `json:"map,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// playerCheats is the report of an online player and when each kind last counted
+type playerCheats struct {
+	report     *PersistedCheatReport
+	lastSignal map[string]int64 // kind -> tick
+	dirty      bool
+}
+
+// CheatMonitor aggregates the anti-cheat signals of the online players into their persisted
+// cheat reports. Each signal adds its weight to the player's score, which decays over time;
+// crossing cheatFlagScore shadow-flags the player for review (they aren't told) and crossing
+// cheatKickScore kicks them from the match. Both actions are written to the admin log. It is
+// only used from the match loop.
+type CheatMonitor struct {
+	logger     runtime.Logger
+	db         *DatabaseManager
+	players    map[string]*playerCheats // player ID -> online player's report
+	nextUpdate int64
+}
+
+// NewCheatMonitor creates a cheat monitor with no players
+func NewCheatMonitor(logger runtime.Logger, db *DatabaseManager) *CheatMonitor {
+	return &CheatMonitor{
+		logger:  logger,
+		db:      db,
+		players: make(map[string]*playerCheats),
+	}
+}
+
+// LoadPlayer reads a joining player's cheat report (bots have none)
+func (cm *CheatMonitor) LoadPlayer(ctx context.Context, playerID, username string) {
+	if IsBot(playerID) {
+		return
+	}
+	report, err := cm.db.LoadCheatReport(ctx, playerID)
+	if err != nil {
+		cm.logger.Error("Failed to load cheat report for %s: %v", playerID, err)
+		return
+	}
+	report.Username = username
+	cm.players[playerID] = &playerCheats{report: report, lastSignal: make(map[string]int64)}
+}
+
+// UnloadPlayer saves a leaving player's report if it changed and releases it
+func (cm *CheatMonitor) UnloadPlayer(ctx context.Context, playerID string) {
+	pc, ok := cm.players[playerID]
+	delete(cm.players, playerID)
+	if !ok || !pc.dirty {
+		return
+	}
+	if err := cm.db.SaveCheatReport(ctx, pc.report); err != nil {
+		cm.logger.Error("Failed to save cheat report for %s on leave: %v", playerID, err)
+	}
+}
+
+// Report counts a signal of a kind for a player, unless one of that kind counted less than
+// cheatSignalCooldown ago
+func (cm *CheatMonitor) Report(gs *GameMatchState, playerID, kind, detail string) {
+	pc, ok := cm.players[playerID]
+	if !ok {
+		return
+	}
+	if last, seen := pc.lastSignal[kind]; seen && gs.currentTick-last < cheatSignalCooldown {
+		return
+	}
+	pc.lastSignal[kind] = gs.currentTick
+
+	now := time.Now().UTC()
+	report := pc.report
+	report.Score = report.scoreAt(now) + cheatSignalWeights[kind]
+	report.ScoreAt = now
+	if report.Counts == nil {
+		report.Counts = make(map[string]int)
+	}
+	report.Counts[kind]++
+	report.Recent = append(report.Recent, CheatSignal{Kind: kind, Detail: detail, Map: gs.currentMapName, Time: now})
+	if len(report.Recent) > maxCheatRecentSignals {
+		report.Recent = report.Recent[len(report.Recent)-maxCheatRecentSignals:]
+	}
+	report.UpdatedAt = now
+	pc.dirty = true
+}
+
+// ReportACK counts the rejections of an input that point at a cheating client: rate limits and
+// interactions through walls or for another player. Out of range isn't counted: honest clients
+// act on positions a few ticks old and get it near the edge of a range.
+func (cm *CheatMonitor) ReportACK(gs *GameMatchState, ack *InputACK) {
+	if ack == nil || ack.Approved {
+		return
+	}
+	switch ack.Reason {
+	case RejectRateLimited:
+		cm.Report(gs, ack.PlayerID, CheatRateLimit, ack.Action)
+	case RejectNoLineOfSight, RejectInvalidPlayer:
+		cm.Report(gs, ack.PlayerID, CheatInteraction, ack.Action+": "+ack.Reason)
+	}
+}
+
+// legitSpeed returns the highest max speed the player had within the last cheatSpeedWindow
+// ticks, given their max speed now. Slows, terrain, swimming and running out of stamina lower
+// the max speed on the server before the client hears of it, so moves are checked against it.
+func (ps *PlayerState) legitSpeed(maxSpeed float64, tick int64) float64 {
+	if maxSpeed >= ps.speedPeak || tick-ps.speedPeakTick > cheatSpeedWindow {
+		ps.speedPeak, ps.speedPeakTick = maxSpeed, tick
+	}
+	return ps.speedPeak
+}
+
+// Update shadow-flags and kicks the players whose score crossed a threshold. Called from the
+// match loop.
+func (cm *CheatMonitor) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick < cm.nextUpdate {
+		return
+	}
+	cm.nextUpdate = gs.currentTick + cheatEvaluateInterval
+
+	now := time.Now().UTC()
+	for playerID, pc := range cm.players {
+		report := pc.report
+		score := report.scoreAt(now)
+		if score >= cheatFlagScore && !report.Flagged {
+			report.Flagged = true
+			report.FlaggedAt = now
+			pc.dirty = true
+			cm.logger.Warn("Anti-cheat: shadow-flagged %s (score %.0f, %v)", playerID, score, report.Counts)
+			cm.audit(ctx, gs, report, "shadow_flag", score)
+		}
+		if score >= cheatKickScore {
+			// A kick halves the score, so the player is kicked again only for new signals
+			report.Score, report.ScoreAt = score/2, now
+			report.Kicks++
+			report.LastKickAt = now
+			pc.dirty = true
+			cm.logger.Warn("Anti-cheat: kicking %s (score %.0f, %v)", playerID, score, report.Counts)
+			cm.audit(ctx, gs, report, "kick", score)
+			if presence, ok := gs.presences[playerID]; ok && dispatcher != nil {
+				if err := dispatcher.MatchKick([]runtime.Presence{presence}); err != nil {
+					cm.logger.Error("Anti-cheat: failed to kick %s: %v", playerID, err)
+				}
+			}
+		}
+	}
+}
+
+// Save writes the reports that changed since the last save
+func (cm *CheatMonitor) Save(ctx context.Context) error {
+	var lastErr error
+	for _, playerID := range sortedKeys(cm.players) {
+		pc := cm.players[playerID]
+		if !pc.dirty {
+			continue
+		}
+		if err := cm.db.SaveCheatReport(ctx, pc.report); err != nil {
+			cm.logger.Error("Failed to save cheat report for %s: %v", playerID, err)
+			lastErr = err
+			continue
+		}
+		pc.dirty = false
+	}
+	return lastErr
+}
+
+// audit writes an automatic anti-cheat action to the admin log
+func (cm *CheatMonitor) audit(ctx context.Context, gs *GameMatchState, report *PersistedCheatReport, action string, score float64) {
+	matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	entry := &AdminLogEntry{
+		Time:      time.Now().UTC(),
+		ActorName: "anti-cheat",
+		Role:      "system",
+		Action:    action,
+		Args:      []string{report.PlayerID, report.Username},
+		MatchID:   matchID,
+		Map:       gs.currentMapName,
+		OK:        true,
+		Result:    fmt.Sprintf("score %.0f", score),
+	}
+	if err := cm.db.AppendAdminLog(ctx, entry); err != nil {
+		cm.logger.Error("Anti-cheat: failed to audit %s of %s: %v", action, report.PlayerID, err)
+	}
+}
+
+// scoreAt returns the report's score decayed to a time
+func (r *PersistedCheatReport) scoreAt(now time.Time) float64 {
+	if r.Score <= 0 {
+		return 0
+	}
+	decayed := r.Score - now.Sub(r.ScoreAt).Minutes()*cheatScoreDecay
+	if decayed < 0 {
+		return 0
+	}
+	return decayed
+}
+
+// rpcAdminCheatReports returns the cheat report of a player, or pages through the reports
+// (optionally only flagged ones), highest score first within the page.
+// Payload: {"playerId": "optional", "flagged": false, "limit": 50, "cursor": "optional"}
+func rpcAdminCheatReports(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	req := struct {
+		PlayerID string `json:"playerId"`
+		Flagged  bool   `json:"flagged"`
+		Limit    int    `json:"limit"`
+		Cursor   string `json:"cursor"`
+	}{Limit: 50}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+	if req.Limit <= 0 || req.Limit > maxCheatReportPage {
+		req.Limit = maxCheatReportPage
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	now := time.Now().UTC()
+	if req.PlayerID != "" {
+		report, err := dm.LoadCheatReport(ctx, req.PlayerID)
+		if err != nil {
+			return "", errInternalFailure
+		}
+		report.Score, report.ScoreAt = report.scoreAt(now), now
+		out, err := json.Marshal(map[string]interface{}{"reports": []*PersistedCheatReport{report}})
+		if err != nil {
+			return "", errInternalFailure
+		}
+		return string(out), nil
+	}
+
+	reports, cursor, err := dm.ListCheatReports(ctx, req.Limit, req.Cursor)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	filtered := reports[:0]
+	for _, report := range reports {
+		if req.Flagged && !report.Flagged {
+			continue
+		}
+		report.Score, report.ScoreAt = report.scoreAt(now), now
+		filtered = append(filtered, report)
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Score > filtered[j].Score })
+
+	out, err := json.Marshal(map[string]interface{}{"reports": filtered, "cursor": cursor})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Clock sync tuning
+const (
+	clockPingInterval = 2 * TickRate // ticks between the match's RTT pings
+	clockPongInterval = 5            // players get at most one pong per this many ticks
+	clockRTTSmoothing = 0.125        // weight of a new sample in the smoothed RTT
+	clockMaxSampleMs  = 5000.0       // samples slower than this are dropped (the reply was stuck)
+)
+
+// ClockMessage is the data of OpCodeClock pings and pongs, and what players send on OpCodeClock.
+// Players send clientTime to sync their clock and get it back with the match's time; they echo
+// serverTime from the match's pings so the match can measure their round trip.
+type ClockMessage struct {
+	ClientTime float64 `json:"clientTime,omitempty"` // client clock, echoed as is
+	ServerTime int64   `json:"serverTime,omitempty"` // unix milliseconds
+	Tick       int64   `json:"tick,omitempty"`
+	RTT        float64 `json:"rtt,omitempty"` // the player's smoothed round trip in milliseconds
+}
+
+// clockPlayer is the round trip measured for one player
+type clockPlayer struct {
+	rtt      float64 // smoothed, milliseconds; 0 until the first sample
+	nextPong int64
+}
+
+// ClockSync answers clock sync requests and measures every player's round trip time, which sizes
+// their lag compensation. It is only used from the match loop.
+type ClockSync struct {
+	logger   runtime.Logger
+	players  map[string]*clockPlayer
+	nextPing int64
+}
+
+// NewClockSync creates a clock sync with no measurements
+func NewClockSync(logger runtime.Logger) *ClockSync {
+	return &ClockSync{logger: logger, players: make(map[string]*clockPlayer)}
+}
+
+// HandleMessage processes an OpCodeClock message: a clientTime gets a pong, an echoed serverTime
+// is an RTT sample
+func (cs *ClockSync) HandleMessage(gs *GameMatchState, playerID string, data []byte, dispatcher runtime.MatchDispatcher) {
+	var msg ClockMessage
+	if err := DecodeMessage(OpCodeClock, data, &msg); err != nil {
+		return
+	}
+	player := cs.player(playerID)
+	now := time.Now().UnixMilli()
+
+	if msg.ServerTime > 0 {
+		if sample := float64(now - msg.ServerTime); sample >= 0 && sample <= clockMaxSampleMs {
+			if player.rtt == 0 {
+				player.rtt = sample
+			} else {
+				player.rtt += clockRTTSmoothing * (sample - player.rtt)
+			}
+		}
+	}
+
+	if msg.ClientTime > 0 && gs.currentTick >= player.nextPong {
+		player.nextPong = gs.currentTick + clockPongInterval
+		presence, ok := gs.presences[playerID]
+		if !ok {
+			return
+		}
+		cs.send("pong", ClockMessage{ClientTime: msg.ClientTime, ServerTime: now, Tick: gs.currentTick, RTT: player.rtt}, []runtime.Presence{presence}, dispatcher)
+	}
+}
+
+// Update pings every player every clockPingInterval. Called from the match loop.
+func (cs *ClockSync) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick < cs.nextPing {
+		return
+	}
+	cs.nextPing = gs.currentTick + clockPingInterval
+	if len(gs.presences) == 0 {
+		return
+	}
+	cs.send("ping", ClockMessage{ServerTime: time.Now().UnixMilli(), Tick: gs.currentTick}, nil, dispatcher)
+}
+
+// RTT returns a player's smoothed round trip time in milliseconds, and false before the first sample
+func (cs *ClockSync) RTT(playerID string) (float64, bool) {
+	player, ok := cs.players[playerID]
+	if !ok || player.rtt == 0 {
+		return 0, false
+	}
+	return player.rtt, true
+}
+
+// Stats returns the average and highest RTT over the players measured, in milliseconds
+func (cs *ClockSync) Stats() (avg, highest float64, measured int) {
+	for _, player := range cs.players {
+		if player.rtt == 0 {
+			continue
+		}
+		avg += player.rtt
+		highest = math.Max(highest, player.rtt)
+		measured++
+	}
+	if measured > 0 {
+		avg /= float64(measured)
+	}
+	return avg, highest, measured
+}
+
+// UnloadPlayer forgets a player who left
+func (cs *ClockSync) UnloadPlayer(playerID string) {
+	delete(cs.players, playerID)
+}
+
+// player returns the measurements of a player, creating them on first use
+func (cs *ClockSync) player(playerID string) *clockPlayer {
+	player, ok := cs.players[playerID]
+	if !ok {
+		player = &clockPlayer{}
+		cs.players[playerID] = player
+	}
+	return player
+}
+
+// send sends a ping or pong to recipients (everyone when nil)
+func (cs *ClockSync) send(msgType string, msg ClockMessage, recipients []runtime.Presence, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeClock, msgType, msg)
+	if err != nil {
+		cs.logger.Error("Failed to marshal clock message: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeClock, data, recipients, nil, false)
+}
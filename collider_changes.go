@@ -0,0 +1,126 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+)
+
+// ColliderChange is an object's static colliders as they are after a change made once the map
+// was loaded: attached or removed by a script, rebuilt with a new tile, placed with a building, or
+// their collision filtering toggled. Clients replace what they hold for the object with it.
+type ColliderChange struct {
+	ObjectID  int                    `json:"objectId"`
+	Colliders []*rigidbody.RigidBody `json:"colliders"`           // the object's static colliders now; empty once it has none
+	Collision *ObjectCollision       `json:"collision,omitempty"` // how they filter collisions, when a script set it
+}
+
+// ColliderChanges tracks the objects whose colliders changed since the map was loaded and which
+// change each player was sent last. World updates leave static colliders out, since clients have
+// them from the map, so the ones that change later reach clients as explicit changes: all of them
+// in world_state, and those a player hasn't been sent yet in their next world_update. Guarded by
+// gs.mu.
+type ColliderChanges struct {
+	seq     int64
+	changed map[int]int64    // object ID -> number of its last change
+	sent    map[string]int64 // player ID -> number of the last change they were sent
+}
+
+// NewColliderChanges creates an empty tracker
+func NewColliderChanges() *ColliderChanges {
+	return &ColliderChanges{changed: make(map[int]int64), sent: make(map[string]int64)}
+}
+
+// Reset forgets the changes recorded while the map's own colliders were put in place. The caller
+// holds gs.mu.
+func (cc *ColliderChanges) Reset() {
+	clear(cc.changed)
+	clear(cc.sent)
+	cc.seq = 0
+}
+
+// Mark records a change to an object's colliders. The caller holds gs.mu.
+func (cc *ColliderChanges) Mark(oid int) {
+	cc.seq++
+	cc.changed[oid] = cc.seq
+}
+
+// colliderChange returns an object's static colliders as clients are sent them. The caller
+// holds gs.mu.
+func (gs *GameMatchState) colliderChange(oid int) ColliderChange {
+	change := ColliderChange{ObjectID: oid, Colliders: make([]*rigidbody.RigidBody, 0)}
+	for _, rb := range gs.entities.ObjectColliders(oid) {
+		if rb.IsMovable {
+			continue
+		}
+		copied := *rb
+		change.Colliders = append(change.Colliders, &copied)
+	}
+	if obj, ok := gs.Object(oid); ok {
+		change.Collision = obj.Collision
+	}
+	return change
+}
+
+// changesSince returns the objects changed after change number seq, ordered by object ID. The
+// caller holds gs.mu.
+func (gs *GameMatchState) changesSince(seq int64) []ColliderChange {
+	ids := make([]int, 0)
+	for oid, changed := range gs.colliders.changed {
+		if changed > seq {
+			ids = append(ids, oid)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Ints(ids)
+	changes := make([]ColliderChange, 0, len(ids))
+	for _, oid := range ids {
+		changes = append(changes, gs.colliderChange(oid))
+	}
+	return changes
+}
+
+// AllColliderChanges returns every collider change since the map was loaded, for world_state,
+// and counts them as sent to the players it goes to
+func (gs *GameMatchState) AllColliderChanges(playerIDs []string) []ColliderChange {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, playerID := range playerIDs {
+		gs.colliders.sent[playerID] = gs.colliders.seq
+	}
+	return gs.changesSince(0)
+}
+
+// TakeColliderChanges returns the collider changes each recipient of a world update hasn't been
+// sent yet (none for those who are up to date) and counts them as sent
+func (gs *GameMatchState) TakeColliderChanges(recipients []runtime.Presence) map[string][]ColliderChange {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	pending := make(map[string][]ColliderChange)
+	bySeq := make(map[int64][]ColliderChange)
+	for _, presence := range recipients {
+		playerID := presence.GetUserId()
+		seq := gs.colliders.sent[playerID]
+		if seq >= gs.colliders.seq {
+			continue
+		}
+		changes, ok := bySeq[seq]
+		if !ok {
+			changes = gs.changesSince(seq)
+			bySeq[seq] = changes
+		}
+		pending[playerID] = changes
+		gs.colliders.sent[playerID] = gs.colliders.seq
+	}
+	return pending
+}
+
+// ForgetColliderChanges drops a leaving player
+func (gs *GameMatchState) ForgetColliderChanges(playerID string) {
+	gs.mu.Lock()
+	delete(gs.colliders.sent, playerID)
+	gs.mu.Unlock()
+}
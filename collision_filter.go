@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+)
+
+// CollisionFilter limits what a body collides with. Bodies sharing a non-empty Group never
+// collide with each other, and a body passes through the bodies whose group is in Ignore (the
+// rule holds whichever of the two bodies lists the other).
+type CollisionFilter struct {
+	Group  string
+	Ignore []string
+}
+
+// ObjectCollision is how a scripted object's colliders filter their collisions, set with the
+// set_object_collision script API. Its colliders are always in the object's own group.
+type ObjectCollision struct {
+	IgnoreOwner bool     // the player who owns the object passes through it
+	Ignore      []string // further groups, e.g. "object/12" or "player/<user id>"
+}
+
+// bodyPair is two bodies kept from colliding until they separate
+type bodyPair struct {
+	a, b *rigidbody.RigidBody
+}
+
+// playerCollisionGroup is the collision group of a player's body
+func playerCollisionGroup(playerID string) string {
+	return "player/" + playerID
+}
+
+// objectCollisionGroup is the collision group of the colliders of an object
+func objectCollisionGroup(oid int) string {
+	return "object/" + strconv.Itoa(oid)
+}
+
+// SetCollisionFilter sets which bodies a body collides with
+func (pe *PhysicsEngine) SetCollisionFilter(rb *rigidbody.RigidBody, filter CollisionFilter) {
+	if filter.Group == "" && len(filter.Ignore) == 0 {
+		delete(pe.filters, rb)
+		return
+	}
+	pe.filters[rb] = filter
+}
+
+// SeparateBodies keeps two bodies from colliding until their bounding boxes stop overlapping.
+// A collider appearing on top of a body (a chest whose GID a script swapped under a player) lets
+// it walk off instead of ejecting it.
+func (pe *PhysicsEngine) SeparateBodies(a, b *rigidbody.RigidBody) {
+	pe.separating[bodyPair{a, b}] = true
+}
+
+// canCollide reports whether the filters, separating pairs and no-clip let two bodies collide
+func (pe *PhysicsEngine) canCollide(a, b *rigidbody.RigidBody) bool {
+	if pe.separating[bodyPair{a, b}] || pe.separating[bodyPair{b, a}] || pe.passesStatic(a, b) || pe.attachedPair(a, b) {
+		return false
+	}
+	fa, fb := pe.filters[a], pe.filters[b]
+	if fa.Group != "" && fa.Group == fb.Group {
+		return false
+	}
+	return !filterIgnores(fa, fb.Group) && !filterIgnores(fb, fa.Group)
+}
+
+// filterIgnores reports whether a filter lists a group
+func filterIgnores(filter CollisionFilter, group string) bool {
+	if group == "" {
+		return false
+	}
+	for _, ignored := range filter.Ignore {
+		if ignored == group {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseSeparated lets the separating pairs that no longer overlap collide again
+func (pe *PhysicsEngine) releaseSeparated() {
+	for pair := range pe.separating {
+		if !pe.aabbOverlap(pair.a, pair.b) {
+			delete(pe.separating, pair)
+		}
+	}
+}
+
+// forgetFilters drops the filter, separating pairs and attachments of a body leaving the world
+func (pe *PhysicsEngine) forgetFilters(rb *rigidbody.RigidBody) {
+	delete(pe.filters, rb)
+	delete(pe.oneWay, rb)
+	delete(pe.attachedTo, rb)
+	for child, parent := range pe.attachedTo {
+		if parent == rb {
+			delete(pe.attachedTo, child)
+		}
+	}
+	for pair := range pe.separating {
+		if pair.a == rb || pair.b == rb {
+			delete(pe.separating, pair)
+		}
+	}
+}
+
+// objectColliderFilter returns the filter of an object's colliders. The caller holds gs.mu.
+func (gs *GameMatchState) objectColliderFilter(oid int) CollisionFilter {
+	filter := CollisionFilter{Group: objectCollisionGroup(oid)}
+	obj, ok := gs.Object(oid)
+	if !ok || obj.Collision == nil {
+		return filter
+	}
+	filter.Ignore = append(filter.Ignore, obj.Collision.Ignore...)
+	if obj.Collision.IgnoreOwner && obj.Ownership != nil {
+		filter.Ignore = append(filter.Ignore, playerCollisionGroup(obj.Ownership.Owner))
+	}
+	return filter
+}
+
+// SetObjectCollision changes how an object's colliders filter their collisions, including the
+// colliders it already has. It returns false for unknown objects.
+func (gs *GameMatchState) SetObjectCollision(oid int, collision *ObjectCollision) bool {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	obj, ok := gs.Object(oid)
+	if !ok {
+		return false
+	}
+	obj.Collision = collision
+	gs.colliders.Mark(oid)
+	if gs.physicsEngine != nil {
+		filter := gs.objectColliderFilter(oid)
+		for _, rb := range gs.entities.ObjectColliders(oid) {
+			gs.physicsEngine.SetCollisionFilter(rb, filter)
+		}
+	}
+	return true
+}
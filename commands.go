@@ -0,0 +1,614 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Command permission roles, taken from the "role" field of the account metadata
+const (
+	RolePlayer = ""
+	RoleGM     = "gm"
+	RoleAdmin  = "admin"
+)
+
+// roleLevels orders roles so higher roles can run every command of lower ones
+var roleLevels = map[string]int{
+	RolePlayer: 0,
+	RoleGM:     1,
+	RoleAdmin:  2,
+}
+
+// CommandContext is passed to command handlers
+type CommandContext struct {
+	ctx        context.Context
+	gameState  *GameMatchState
+	playerID   string
+	name       string
+	args       []string
+	audited    bool // GM commands and commands run in GM mode go to the admin log
+	dispatcher runtime.MatchDispatcher
+	logger     runtime.Logger
+}
+
+// errCommandPending is returned by handlers that answer later, e.g. once the content filter
+// judged the command's text: they send their result with reply instead
+var errCommandPending = errors.New("command pending")
+
+// reply sends the result of the command, its message or error, to the player who ran it
+func (cc *CommandContext) reply(message *LocalizedText, err error) {
+	gs := cc.gameState
+	result := CommandResult{Command: cc.name, OK: true}
+	if err != nil {
+		result.OK = false
+		message = localizedError(err)
+	}
+	if message != nil {
+		result.Key, result.Params = message.Key, message.Params
+		result.Message = messageCatalog.Render(gs.Locale(cc.playerID), message.Key, message.Params)
+	}
+	if cc.audited {
+		gs.auditCommand(cc.ctx, cc.playerID, cc.name, cc.args, result, cc.logger)
+	}
+
+	presence, ok := gs.presences[cc.playerID]
+	if !ok || cc.dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeCommandResult, "command_result", result)
+	if err != nil {
+		cc.logger.Error("Failed to marshal command result: %v", err)
+		return
+	}
+	cc.dispatcher.BroadcastMessage(OpCodeCommandResult, data, []runtime.Presence{presence}, nil, true)
+}
+
+// ChatCommand is an entry of the slash command table
+type ChatCommand struct {
+	Name        string
+	Usage       string
+	Description string
+	Role        string // minimum role allowed to run the command
+	Handler     func(cc *CommandContext) (*LocalizedText, error)
+}
+
+// CommandResult is sent back to the player who ran a command (OpCodeCommandResult). Message is
+// rendered in the player's locale from Key and Params.
+type CommandResult struct {
+	Command string         `json:"command"`
+	OK      bool           `json:"ok"`
+	Message string         `json:"message"`
+	Key     string         `json:"key,omitempty"`
+	Params  map[string]any `json:"params,omitempty"`
+}
+
+// chatCommands is the command table, keyed by command name (without the leading slash)
+var chatCommands = map[string]*ChatCommand{}
+
+func init() {
+	for _, c := range []*ChatCommand{
+		{Name: "help", Usage: "/help", Description: "list the commands you can use", Role: RolePlayer, Handler: cmdHelp},
+		{Name: "where", Usage: "/where", Description: "show your position", Role: RolePlayer, Handler: cmdWhere},
+		{Name: "players", Usage: "/players", Description: "list connected players", Role: RolePlayer, Handler: cmdPlayers},
+		{Name: "gm", Usage: "/gm [on|off]", Description: "turn GM mode on or off; the other GM commands need it", Role: RoleGM, Handler: cmdGM},
+		{Name: "invisible", Usage: "/invisible [on|off]", Description: "hide yourself from players and NPCs", Role: RoleGM, Handler: cmdInvisible},
+		{Name: "god", Usage: "/god [on|off]", Description: "ignore all damage", Role: RoleGM, Handler: cmdGod},
+		{Name: "noclip", Usage: "/noclip [on|off]", Description: "walk through walls", Role: RoleGM, Handler: cmdNoClip},
+		{Name: "freeze", Usage: "/freeze <player> [on|off]", Description: "hold a player in place", Role: RoleGM, Handler: cmdFreeze},
+		{Name: "spawn_item", Usage: "/spawn_item <item> [count]", Description: "drop items at your position", Role: RoleGM, Handler: cmdSpawnItem},
+		{Name: "tp", Usage: "/tp <x> <y> | /tp <player> | /tp <player> <x> <y>", Description: "teleport yourself or another player", Role: RoleGM, Handler: cmdTeleport},
+		{Name: "give", Usage: "/give <item> [count] [player]", Description: "give items to yourself or another player", Role: RoleGM, Handler: cmdGive},
+		{Name: "spawn_npc", Usage: "/spawn_npc <type>", Description: "spawn an NPC at your position", Role: RoleGM, Handler: cmdSpawnNPC},
+		{Name: "weather", Usage: "/weather [state] [seconds]", Description: "show the weather, or set it (GM)", Role: RolePlayer, Handler: cmdWeather},
+		{Name: "event", Usage: "/event [start|stop <id>]", Description: "list world events, or start/stop one (GM)", Role: RolePlayer, Handler: cmdEvent},
+		{Name: "pvp", Usage: "/pvp [on|off]", Description: "show your PvP status, or flag/unflag yourself", Role: RolePlayer, Handler: cmdPvP},
+		{Name: "guild", Usage: "/guild [create <tag> <name>|invite <player>|accept|leave|kick <player>|promote <player>|demote <player>|deposit <item> [count]|withdraw <item> [count]|disband]", Description: "show your guild, or manage it", Role: RolePlayer, Handler: cmdGuild},
+		{Name: "g", Usage: "/g <message>", Description: "talk to the online members of your guild", Role: RolePlayer, Handler: cmdGuildChat},
+		{Name: "global", Usage: "/global <message>", Description: "talk to the players of every map", Role: RolePlayer, Handler: cmdGlobalChat},
+		{Name: "lfg", Usage: "/lfg [message]", Description: "tell the players of every map you are looking for a group", Role: RolePlayer, Handler: cmdLFG},
+		{Name: "plot", Usage: "/plot [access <owner|guild|everyone>|allow <player>|deny <player>]", Description: "show the plot you stand on, or manage your plot", Role: RolePlayer, Handler: cmdPlot},
+		{Name: "time", Usage: "/time [hour]", Description: "show the time of day, or set it (GM)", Role: RolePlayer, Handler: cmdTime},
+		{Name: "language", Usage: "/language [code]", Description: "show your language, or change it", Role: RolePlayer, Handler: cmdLanguage},
+	} {
+		chatCommands[c.Name] = c
+	}
+}
+
+// ParseCommand splits "/name arg1 arg2" into the command name and its arguments.
+// The leading slash is optional.
+func ParseCommand(text string) (string, []string) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.ToLower(strings.TrimPrefix(fields[0], "/")), fields[1:]
+}
+
+// text renders a message in the locale of the player running the command, for the parts of
+// longer outputs
+func (cc *CommandContext) text(key string, pairs ...any) string {
+	lt := msg(key, pairs...)
+	return messageCatalog.Render(cc.gameState.Locale(cc.playerID), lt.Key, lt.Params)
+}
+
+// roleAllows reports whether role may run commands that require minRole
+func roleAllows(role, minRole string) bool {
+	return roleLevels[role] >= roleLevels[minRole]
+}
+
+// findPlayerByName resolves a player by username (case-insensitive) or user ID
+func (gs *GameMatchState) findPlayerByName(name string) (string, bool) {
+	if _, ok := gs.presences[name]; ok {
+		return name, true
+	}
+	for userID, presence := range gs.Presences() {
+		if strings.EqualFold(presence.GetUsername(), name) {
+			return userID, true
+		}
+	}
+	return "", false
+}
+
+func cmdHelp(cc *CommandContext) (*LocalizedText, error) {
+	role := cc.gameState.GetPlayerState(cc.playerID).Role
+	lines := make([]string, 0, len(chatCommands))
+	for _, c := range chatCommands {
+		if roleAllows(role, c.Role) {
+			description, ok := messageCatalog.Lookup(cc.gameState.Locale(cc.playerID), "command."+c.Name)
+			if !ok {
+				description = c.Description
+			}
+			lines = append(lines, cc.text("cmd.help.line", "usage", c.Usage, "description", description))
+		}
+	}
+	sort.Strings(lines)
+	return msg("cmd.help", "commands", strings.Join(lines, "\n")), nil
+}
+
+func cmdWhere(cc *CommandContext) (*LocalizedText, error) {
+	rb := cc.gameState.PlayerBody(cc.playerID)
+	if rb == nil {
+		return nil, msg("error.no_body")
+	}
+	return msg("cmd.where", "x", math.Round(rb.Position.X*10)/10, "y", math.Round(rb.Position.Y*10)/10,
+		"tileX", int(rb.Position.X/TileSize), "tileY", int(rb.Position.Y/TileSize), "map", cc.gameState.currentMapName), nil
+}
+
+func cmdPlayers(cc *CommandContext) (*LocalizedText, error) {
+	names := make([]string, 0, len(cc.gameState.presences))
+	for _, presence := range cc.gameState.presences {
+		names = append(names, presence.GetUsername())
+	}
+	sort.Strings(names)
+	return msg("cmd.players", "count", len(names), "names", strings.Join(names, ", ")), nil
+}
+
+func cmdTeleport(cc *CommandContext) (*LocalizedText, error) {
+	gs := cc.gameState
+	targetID := cc.playerID
+	var destination vector.Vector
+
+	switch len(cc.args) {
+	case 1:
+		// /tp <player>: move yourself to another player
+		otherID, ok := gs.findPlayerByName(cc.args[0])
+		if !ok || gs.PlayerBody(otherID) == nil {
+			return nil, msg("error.unknown_player", "player", cc.args[0])
+		}
+		destination = gs.PlayerBody(otherID).Position
+	case 2, 3:
+		coords := cc.args
+		if len(cc.args) == 3 {
+			otherID, ok := gs.findPlayerByName(cc.args[0])
+			if !ok {
+				return nil, msg("error.unknown_player", "player", cc.args[0])
+			}
+			targetID = otherID
+			coords = cc.args[1:]
+		}
+		x, errX := strconv.ParseFloat(coords[0], 64)
+		y, errY := strconv.ParseFloat(coords[1], 64)
+		if errX != nil || errY != nil {
+			return nil, msg("cmd.tp.bad_coords")
+		}
+		destination = vector.Vector{X: x, Y: y}
+	default:
+		return nil, msg("cmd.usage", "usage", chatCommands["tp"].Usage)
+	}
+
+	if gs.PlayerBody(targetID) == nil {
+		return nil, msg("cmd.tp.no_body")
+	}
+	position, ok := gs.Teleport(targetID, destination, CorrectionTeleport)
+	if !ok {
+		return nil, msg("cmd.tp.blocked")
+	}
+	return msg("cmd.tp.done", "x", math.Round(position.X*10)/10, "y", math.Round(position.Y*10)/10), nil
+}
+
+func cmdGive(cc *CommandContext) (*LocalizedText, error) {
+	if len(cc.args) == 0 {
+		return nil, msg("cmd.usage", "usage", chatCommands["give"].Usage)
+	}
+	gs := cc.gameState
+	itemID := cc.args[0]
+	if _, ok := gs.itemCatalog.Get(itemID); !ok {
+		return nil, msg("error.unknown_item", "item", itemID)
+	}
+	count := 1
+	if len(cc.args) > 1 {
+		n, err := strconv.Atoi(cc.args[1])
+		if err != nil || n <= 0 {
+			return nil, msg("error.bad_count")
+		}
+		count = n
+	}
+	targetID := cc.playerID
+	if len(cc.args) > 2 {
+		otherID, ok := gs.findPlayerByName(cc.args[2])
+		if !ok {
+			return nil, msg("error.unknown_player", "player", cc.args[2])
+		}
+		targetID = otherID
+	}
+
+	entry := &JournalEntry{Key: gs.journal.UniqueKey("give", cc.playerID), Kind: JournalItemGrant, PlayerID: targetID, Items: map[string]int{itemID: count}, Source: "give:" + cc.playerID}
+	if err := gs.journal.Begin(cc.ctx, entry); err != nil {
+		return nil, msg("cmd.give.failed")
+	}
+	err := gs.inventoryManager.Add(cc.ctx, targetID, itemID, count)
+	gs.journal.Finish(cc.ctx, entry, err)
+	if err != nil {
+		cc.logger.Error("Command give failed for %s: %v", targetID, err)
+		return nil, msg("cmd.give.failed")
+	}
+	gs.inventoryManager.SyncToClient(cc.ctx, gs, targetID, cc.dispatcher)
+	return msg("cmd.give.done", "count", count, "item", itemID), nil
+}
+
+func cmdSpawnNPC(cc *CommandContext) (*LocalizedText, error) {
+	if len(cc.args) != 1 {
+		return nil, msg("cmd.usage", "usage", chatCommands["spawn_npc"].Usage)
+	}
+	rb := cc.gameState.PlayerBody(cc.playerID)
+	if rb == nil {
+		return nil, msg("error.no_body")
+	}
+	id := cc.gameState.npcManager.Spawn(cc.gameState, cc.args[0], rb.Position, nil)
+	if id == 0 {
+		return nil, msg("cmd.spawn_npc.unknown", "type", cc.args[0])
+	}
+	return msg("cmd.spawn_npc.done", "type", cc.args[0], "npcId", id), nil
+}
+
+// cmdTime shows the world time; GMs can pass an hour to set it
+func cmdTime(cc *CommandContext) (*LocalizedText, error) {
+	clock := cc.gameState.worldClock
+	if len(cc.args) > 0 {
+		if !cc.gameState.inGMMode(cc.playerID) {
+			return nil, msg("cmd.time.gm_only")
+		}
+		hour, err := strconv.ParseFloat(cc.args[0], 64)
+		if err != nil {
+			return nil, msg("cmd.usage", "usage", chatCommands["time"].Usage)
+		}
+		clock.SetTime(cc.gameState, hour, cc.dispatcher, cc.logger)
+	}
+	snap := clock.Snapshot()
+	period := cc.text("time.night")
+	if snap.IsDay {
+		period = cc.text("time.day")
+	}
+	return msg("cmd.time.now", "day", snap.Day, "time", fmt.Sprintf("%02d:%02d", snap.Hour, snap.Minute), "period", period), nil
+}
+
+// cmdWeather shows the weather; GMs can pass a state (and optionally how long it lasts) to set it
+func cmdWeather(cc *CommandContext) (*LocalizedText, error) {
+	weather := cc.gameState.weather
+	if len(cc.args) > 0 {
+		if !cc.gameState.inGMMode(cc.playerID) {
+			return nil, msg("cmd.weather.gm_only")
+		}
+		duration := 0.0
+		if len(cc.args) > 1 {
+			var err error
+			if duration, err = strconv.ParseFloat(cc.args[1], 64); err != nil {
+				return nil, msg("cmd.usage", "usage", chatCommands["weather"].Usage)
+			}
+		}
+		if !weather.Set(cc.gameState, strings.ToLower(cc.args[0]), duration, cc.dispatcher, cc.logger) {
+			return nil, msg("cmd.weather.unknown", "weather", cc.args[0])
+		}
+	}
+	snap := weather.Snapshot(cc.gameState.currentTick)
+	return msg("cmd.weather.now", "weather", snap.State, "seconds", math.Round(snap.Remaining)), nil
+}
+
+// cmdEvent lists the map's world events; GMs can start or stop one
+func cmdEvent(cc *CommandContext) (*LocalizedText, error) {
+	gs := cc.gameState
+	if len(cc.args) == 0 {
+		lines := make([]string, 0)
+		for _, id := range gs.worldEvents.Definitions(gs.currentMapName) {
+			status := cc.text("event.status.scheduled")
+			if gs.worldEvents.IsActive(id) {
+				status = cc.text("event.status.running")
+			}
+			lines = append(lines, cc.text("cmd.event.line", "event", id, "status", status))
+		}
+		if len(lines) == 0 {
+			return msg("cmd.event.none"), nil
+		}
+		return msg("cmd.event.list", "events", strings.Join(lines, "\n")), nil
+	}
+	if len(cc.args) != 2 {
+		return nil, msg("cmd.usage", "usage", chatCommands["event"].Usage)
+	}
+	if !gs.inGMMode(cc.playerID) {
+		return nil, msg("cmd.event.gm_only")
+	}
+	id := cc.args[1]
+	switch strings.ToLower(cc.args[0]) {
+	case "start":
+		if err := gs.worldEvents.Start(gs, id, cc.dispatcher); err != nil {
+			return nil, err
+		}
+		return msg("cmd.event.started", "event", id), nil
+	case "stop":
+		if !gs.worldEvents.End(cc.ctx, gs, id, WorldEventCancelled, cc.dispatcher) {
+			return nil, msg("cmd.event.not_running", "event", id)
+		}
+		return msg("cmd.event.stopped", "event", id), nil
+	default:
+		return nil, msg("cmd.usage", "usage", chatCommands["event"].Usage)
+	}
+}
+
+// cmdPvP shows the player's PvP zone, flag and karma, or turns the flag on or off
+func cmdPvP(cc *CommandContext) (*LocalizedText, error) {
+	state := cc.gameState.GetPlayerState(cc.playerID)
+	if len(cc.args) > 0 {
+		var flagged bool
+		switch strings.ToLower(cc.args[0]) {
+		case "on":
+			flagged = true
+		case "off":
+			flagged = false
+		default:
+			return nil, msg("cmd.usage", "usage", chatCommands["pvp"].Usage)
+		}
+		ack := &InputACK{}
+		switch cc.gameState.SetPvPFlag(cc.playerID, flagged, ack) {
+		case "":
+		case RejectOnCooldown:
+			return nil, msg("cmd.pvp.cooldown", "seconds", math.Round(ack.Cooldown))
+		case RejectInCombat:
+			return nil, msg("cmd.pvp.in_combat", "seconds", math.Round(ack.Cooldown))
+		case RejectOutlaw:
+			return nil, msg("cmd.pvp.outlaw")
+		}
+	}
+	flag := cc.text("common.off")
+	if state.Attackable() {
+		flag = cc.text("common.on")
+	}
+	key := "cmd.pvp.status"
+	if state.Outlaw() {
+		key = "cmd.pvp.status_outlaw"
+	}
+	return msg(key, "zone", state.PvPZone, "flag", flag, "karma", state.Karma), nil
+}
+
+// cmdGuild shows the player's guild, or runs one of the guild subcommands
+func cmdGuild(cc *CommandContext) (*LocalizedText, error) {
+	gs := cc.gameState
+	guilds := gs.guilds
+	if len(cc.args) == 0 {
+		info, ok := guilds.Info(gs, cc.playerID)
+		if !ok {
+			return msg("cmd.guild.none"), nil
+		}
+		lines := []string{cc.text("cmd.guild.header", "tag", info.Tag, "name", info.Name)}
+		for _, m := range info.Members {
+			key := "cmd.guild.member"
+			if m.Online {
+				key = "cmd.guild.member_online"
+			}
+			lines = append(lines, cc.text(key, "player", m.Username, "rank", m.Rank))
+		}
+		if len(info.Bank) > 0 {
+			ids := make([]string, 0, len(info.Bank))
+			for id := range info.Bank {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			stacks := make([]string, 0, len(ids))
+			for _, id := range ids {
+				stacks = append(stacks, fmt.Sprintf("%d x %s", info.Bank[id], id))
+			}
+			lines = append(lines, cc.text("cmd.guild.bank", "items", strings.Join(stacks, ", ")))
+		}
+		return msg("cmd.guild.info", "info", strings.Join(lines, "\n")), nil
+	}
+
+	usage := msg("cmd.usage", "usage", chatCommands["guild"].Usage)
+	args := cc.args[1:]
+	switch strings.ToLower(cc.args[0]) {
+	case "create":
+		if len(args) < 2 {
+			return nil, usage
+		}
+		tag, name := args[0], strings.Join(args[1:], " ")
+		if err := guilds.Create(cc.ctx, gs, cc.playerID, tag, name, cc.dispatcher, func(err error) {
+			cc.reply(msg("cmd.guild.founded", "tag", strings.ToUpper(tag), "name", name), err)
+		}); err != nil {
+			return nil, err
+		}
+		return nil, errCommandPending
+	case "invite":
+		if len(args) != 1 {
+			return nil, usage
+		}
+		targetID, ok := gs.findPlayerByName(args[0])
+		if !ok {
+			return nil, msg("error.unknown_player", "player", args[0])
+		}
+		if err := guilds.Invite(cc.ctx, gs, cc.playerID, targetID, cc.dispatcher); err != nil {
+			return nil, err
+		}
+		return msg("cmd.guild.invited", "player", gs.usernameOf(targetID)), nil
+	case "accept":
+		name, err := guilds.Accept(cc.ctx, gs, cc.playerID, cc.dispatcher)
+		if err != nil {
+			return nil, err
+		}
+		return msg("cmd.guild.joined", "guild", name), nil
+	case "leave":
+		if err := guilds.Leave(cc.ctx, gs, cc.playerID, cc.dispatcher); err != nil {
+			return nil, err
+		}
+		return msg("cmd.guild.left"), nil
+	case "kick":
+		if len(args) != 1 {
+			return nil, usage
+		}
+		if err := guilds.Kick(cc.ctx, gs, cc.playerID, args[0], cc.dispatcher); err != nil {
+			return nil, err
+		}
+		return msg("cmd.guild.kicked", "player", args[0]), nil
+	case "promote":
+		if len(args) != 1 {
+			return nil, usage
+		}
+		rank, err := guilds.Promote(cc.ctx, gs, cc.playerID, args[0], cc.dispatcher)
+		if err != nil {
+			return nil, err
+		}
+		return msg("cmd.guild.rank", "player", args[0], "rank", rank), nil
+	case "demote":
+		if len(args) != 1 {
+			return nil, usage
+		}
+		if err := guilds.Demote(cc.ctx, gs, cc.playerID, args[0], cc.dispatcher); err != nil {
+			return nil, err
+		}
+		return msg("cmd.guild.rank", "player", args[0], "rank", GuildRankMember), nil
+	case "deposit", "withdraw":
+		if len(args) < 1 || len(args) > 2 {
+			return nil, usage
+		}
+		count := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return nil, msg("error.bad_count")
+			}
+			count = n
+		}
+		if strings.ToLower(cc.args[0]) == "deposit" {
+			if err := guilds.Deposit(cc.ctx, gs, cc.playerID, args[0], count, cc.dispatcher); err != nil {
+				return nil, err
+			}
+			return msg("cmd.guild.deposited", "count", count, "item", args[0]), nil
+		}
+		if err := guilds.Withdraw(cc.ctx, gs, cc.playerID, args[0], count, cc.dispatcher); err != nil {
+			return nil, err
+		}
+		return msg("cmd.guild.withdrew", "count", count, "item", args[0]), nil
+	case "disband":
+		if err := guilds.Disband(cc.ctx, gs, cc.playerID, cc.dispatcher); err != nil {
+			return nil, err
+		}
+		return msg("cmd.guild.disbanded"), nil
+	default:
+		return nil, usage
+	}
+}
+
+// cmdGuildChat sends a message to the player's online guild mates
+func cmdGuildChat(cc *CommandContext) (*LocalizedText, error) {
+	if len(cc.args) == 0 {
+		return nil, msg("cmd.usage", "usage", chatCommands["g"].Usage)
+	}
+	if err := cc.gameState.guilds.Chat(cc.ctx, cc.gameState, cc.playerID, strings.Join(cc.args, " "), cc.dispatcher, func(err error) {
+		cc.reply(nil, err)
+	}); err != nil {
+		return nil, err
+	}
+	return nil, errCommandPending
+}
+
+// cmdGlobalChat sends a message to the players of every shard
+func cmdGlobalChat(cc *CommandContext) (*LocalizedText, error) {
+	if len(cc.args) == 0 {
+		return nil, msg("cmd.usage", "usage", chatCommands["global"].Usage)
+	}
+	if err := cc.gameState.global.Say(cc.ctx, cc.gameState, cc.playerID, strings.Join(cc.args, " "), func(err error) {
+		cc.reply(nil, err)
+	}); err != nil {
+		return nil, err
+	}
+	return nil, errCommandPending
+}
+
+// cmdLFG announces on every shard that the player looks for a group
+func cmdLFG(cc *CommandContext) (*LocalizedText, error) {
+	if err := cc.gameState.global.LFG(cc.ctx, cc.gameState, cc.playerID, strings.Join(cc.args, " "), func(err error) {
+		cc.reply(msg("cmd.lfg.sent"), err)
+	}); err != nil {
+		return nil, err
+	}
+	return nil, errCommandPending
+}
+
+// cmdPlot describes the plot the player stands on, or changes the access and builders of the
+// plot they own
+func cmdPlot(cc *CommandContext) (*LocalizedText, error) {
+	gs := cc.gameState
+	housing := gs.housing
+	if len(cc.args) == 0 {
+		rb := gs.PlayerBody(cc.playerID)
+		if rb == nil {
+			return nil, msg("error.no_body")
+		}
+		description, ok := housing.Describe(housing.PlotAt(rb.Position))
+		if !ok {
+			return msg("cmd.plot.none"), nil
+		}
+		return description, nil
+	}
+	if len(cc.args) != 2 {
+		return nil, msg("cmd.usage", "usage", chatCommands["plot"].Usage)
+	}
+	switch strings.ToLower(cc.args[0]) {
+	case "access":
+		access := strings.ToLower(cc.args[1])
+		if err := housing.SetAccess(cc.ctx, gs, cc.playerID, access, cc.dispatcher); err != nil {
+			return nil, err
+		}
+		return msg("cmd.plot.access", "access", access), nil
+	case "allow", "deny":
+		builderID, ok := gs.findPlayerByName(cc.args[1])
+		if !ok {
+			return nil, msg("error.unknown_player", "player", cc.args[1])
+		}
+		allowed := strings.ToLower(cc.args[0]) == "allow"
+		if err := housing.SetBuilder(cc.ctx, gs, cc.playerID, builderID, allowed, cc.dispatcher); err != nil {
+			return nil, err
+		}
+		if allowed {
+			return msg("cmd.plot.allowed", "player", gs.usernameOf(builderID)), nil
+		}
+		return msg("cmd.plot.denied", "player", gs.usernameOf(builderID)), nil
+	default:
+		return nil, msg("cmd.usage", "usage", chatCommands["plot"].Usage)
+	}
+}
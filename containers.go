@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Container events published on the event bus
+const (
+	EventContainerOpened = "container_opened" // objectId, name, playerId, items (item ID -> count)
+)
+
+// Container loot modes
+const (
+	ContainerShared    = "shared"     // the first player to open it empties it until it respawns
+	ContainerPerPlayer = "per_player" // every player loots it once per respawn period
+)
+
+// Container tuning. The object properties "loot", "mode", "respawn", "relock", "locked", "key",
+// "consumeKey" and "openGid" configure each container.
+const (
+	containerObjectType           = "container" // ObjectData.Type of chests and other openable containers
+	defaultContainerRespawn       = 300.0       // seconds before a looted container has loot again
+	defaultContainerRelock        = 5.0         // seconds an opened container stays open
+	containerSweepInterval        = 1 * TickRate
+	containerNeverRespawns  int64 = -1 // RefillAt/LootedBy value of containers with respawn 0
+)
+
+// Container is a map object players open for the loot of a loot table. Timers use wall clock
+// time so looted containers stay looted across match restarts.
+type Container struct {
+	ObjectID       int
+	Name           string
+	LootTable      string
+	Mode           string
+	RespawnSeconds float64 // 0 = looted for good
+	RelockSeconds  float64 // 0 = stays open until it has loot again (shared) or for good (per-player)
+	LockedByMap    bool    // the container locks again when it closes
+	Key            string  // item that unlocks it ("" when only scripts can unlock it)
+	ConsumeKey     bool
+	ClosedGID      uint32
+	OpenGID        uint32           // tile shown while open (0 keeps the closed tile)
+	Open           bool             // shown open
+	Locked         bool             // needs the key to open
+	CloseAt        int64            // unix seconds it closes (0 while closed)
+	RefillAt       int64            // shared: unix seconds it has loot again (0 while full)
+	LootedBy       map[string]int64 // per-player: player ID -> unix seconds they may loot again
+}
+
+// ContainerManager tracks the containers of the current map
+type ContainerManager struct {
+	logger     runtime.Logger
+	containers map[int]*Container // object ID -> container
+	dirty      bool               // a container changed since the last save
+	mu         sync.Mutex
+}
+
+// NewContainerManager creates an empty container manager
+func NewContainerManager(logger runtime.Logger) *ContainerManager {
+	return &ContainerManager{
+		logger:     logger,
+		containers: make(map[int]*Container),
+	}
+}
+
+// LoadFromMap registers every "container" object of the current map
+func (cm *ContainerManager) LoadFromMap(gs *GameMatchState) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.containers = make(map[int]*Container)
+	gs.mu.Lock()
+	for oid, obj := range gs.Objects() {
+		if !strings.EqualFold(obj.Type, containerObjectType) {
+			continue
+		}
+		container := &Container{
+			ObjectID:       oid,
+			Name:           obj.Name,
+			Mode:           ContainerShared,
+			RespawnSeconds: defaultContainerRespawn,
+			RelockSeconds:  defaultContainerRelock,
+			ClosedGID:      obj.GID,
+			LootedBy:       make(map[string]int64),
+		}
+		container.LootTable, _ = obj.Props["loot"].(string)
+		if container.LootTable == "" {
+			cm.logger.Warn("Container %d (%s) has no loot property; skipping", oid, obj.Name)
+			continue
+		}
+		if v, ok := obj.Props["mode"].(string); ok && strings.EqualFold(v, ContainerPerPlayer) {
+			container.Mode = ContainerPerPlayer
+		}
+		if v, ok := obj.Props["respawn"].(float64); ok && v >= 0 {
+			container.RespawnSeconds = v
+		}
+		if v, ok := obj.Props["relock"].(float64); ok && v >= 0 {
+			container.RelockSeconds = v
+		}
+		container.LockedByMap, _ = obj.Props["locked"].(bool)
+		container.Locked = container.LockedByMap
+		container.Key, _ = obj.Props["key"].(string)
+		container.ConsumeKey, _ = obj.Props["consumekey"].(bool)
+		if v, ok := obj.Props["opengid"].(float64); ok && v > 0 {
+			container.OpenGID = uint32(v)
+		}
+		cm.containers[oid] = container
+	}
+	gs.mu.Unlock()
+
+	for _, container := range cm.containers {
+		gs.applyContainer(container, nil, cm.logger)
+	}
+	cm.logger.Info("Registered %d containers", len(cm.containers))
+}
+
+// Get returns the container of an object (nil if the object isn't a container)
+func (cm *ContainerManager) Get(oid int) *Container {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.containers[oid]
+}
+
+// Open unlocks (with the key) and opens a container for a player who reached it and gives them
+// its loot. It returns the granted stacks, or a rejection reason.
+func (cm *ContainerManager) Open(ctx context.Context, gs *GameMatchState, playerID string, oid int, dispatcher runtime.MatchDispatcher) ([]LootStack, string) {
+	now := time.Now().Unix()
+	cm.mu.Lock()
+	container, ok := cm.containers[oid]
+	if !ok {
+		cm.mu.Unlock()
+		return nil, RejectInvalidTarget
+	}
+	if reason := container.lootable(playerID); reason != "" {
+		cm.mu.Unlock()
+		return nil, reason
+	}
+	// Mark it looted up front so two players can't both empty a shared container on the same tick
+	again := containerNeverRespawns
+	if container.RespawnSeconds > 0 {
+		again = now + int64(container.RespawnSeconds)
+	}
+	if container.Mode == ContainerPerPlayer {
+		container.LootedBy[playerID] = again
+	} else {
+		container.RefillAt = again
+	}
+	locked, key, consumeKey := container.Locked, container.Key, container.ConsumeKey
+	cm.mu.Unlock()
+
+	if locked {
+		ok := key != "" && gs.inventoryManager.Count(ctx, playerID, key) > 0
+		if ok && consumeKey {
+			ok = gs.inventoryManager.Remove(ctx, playerID, key, 1) == nil
+		}
+		if !ok {
+			cm.mu.Lock()
+			if container.Mode == ContainerPerPlayer {
+				delete(container.LootedBy, playerID)
+			} else {
+				container.RefillAt = 0
+			}
+			cm.mu.Unlock()
+			return nil, RejectLocked
+		}
+	}
+
+	cm.mu.Lock()
+	container.Open, container.Locked = true, false
+	container.CloseAt = 0
+	if container.RelockSeconds > 0 {
+		container.CloseAt = now + int64(container.RelockSeconds)
+	}
+	cm.dirty = true
+	cm.mu.Unlock()
+
+	stacks := gs.lootCatalog.Roll(gs, container.LootTable, LootContext{PlayerID: playerID})
+	entry := &JournalEntry{Key: gs.journal.Key("container", oid, now), Kind: JournalContainerOpen, PlayerID: playerID, Items: stackItems(stacks), Source: container.Name}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		stacks = nil
+	} else {
+		var grantErr error
+		for i, stack := range stacks {
+			if err := gs.inventoryManager.Add(ctx, playerID, stack.ItemID, stack.Count); err != nil {
+				cm.logger.Error("open_container: failed to add %d x %s to %s: %v", stack.Count, stack.ItemID, playerID, err)
+				stacks, grantErr = stacks[:i], err
+				break
+			}
+		}
+		entry.Items = stackItems(stacks)
+		gs.journal.Finish(ctx, entry, grantErr)
+	}
+	gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	gs.applyContainer(container, dispatcher, cm.logger)
+
+	items := stackItems(stacks)
+	gs.eventBus.Publish(EventContainerOpened, map[string]any{"objectId": oid, "name": container.Name, "playerId": playerID, "items": items})
+	return stacks, ""
+}
+
+// lootable returns why a player can't loot the container now, or "". The caller holds cm.mu.
+func (c *Container) lootable(playerID string) string {
+	if c.Mode == ContainerPerPlayer {
+		if _, looted := c.LootedBy[playerID]; looted {
+			return RejectAlreadyLooted
+		}
+		return ""
+	}
+	if c.RefillAt != 0 {
+		return RejectEmpty
+	}
+	return ""
+}
+
+// Refill gives a container its loot back at once, for every player. It returns false for unknown
+// containers.
+func (cm *ContainerManager) Refill(gs *GameMatchState, oid int, dispatcher runtime.MatchDispatcher) bool {
+	cm.mu.Lock()
+	container, ok := cm.containers[oid]
+	if ok {
+		container.refill()
+		cm.dirty = true
+	}
+	cm.mu.Unlock()
+	if ok {
+		gs.applyContainer(container, dispatcher, cm.logger)
+	}
+	return ok
+}
+
+// refill closes the container, locks it again if the map locked it, and restores its loot. The
+// caller holds cm.mu.
+func (c *Container) refill() {
+	c.close()
+	c.RefillAt = 0
+	clear(c.LootedBy)
+}
+
+// close closes the container and locks it again if the map locked it. The caller holds cm.mu.
+func (c *Container) close() {
+	c.Open = false
+	c.CloseAt = 0
+	c.Locked = c.LockedByMap
+}
+
+// Update closes containers whose relock time is up and refills those whose respawn time is up.
+// Called from the match loop.
+func (cm *ContainerManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick%containerSweepInterval != 0 {
+		return
+	}
+	now := time.Now().Unix()
+
+	cm.mu.Lock()
+	var changed []*Container
+	for _, container := range cm.containers {
+		due := false
+		if container.CloseAt != 0 && now >= container.CloseAt {
+			container.close()
+			due = true
+		}
+		if container.RefillAt > 0 && now >= container.RefillAt {
+			container.refill()
+			due = true
+		}
+		for playerID, at := range container.LootedBy {
+			if at != containerNeverRespawns && now >= at {
+				delete(container.LootedBy, playerID)
+				cm.dirty = true
+			}
+		}
+		if due {
+			changed = append(changed, container)
+			cm.dirty = true
+		}
+	}
+	cm.mu.Unlock()
+
+	for _, container := range changed {
+		gs.applyContainer(container, dispatcher, cm.logger)
+	}
+}
+
+// applyContainer mirrors a container's state into its object's tile and properties ("open",
+// "locked" and, for shared containers, "empty") and broadcasts the change
+func (gs *GameMatchState) applyContainer(container *Container, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gs.mu.Lock()
+	obj, ok := gs.Object(container.ObjectID)
+	if ok {
+		obj.Props["open"] = container.Open
+		obj.Props["locked"] = container.Locked
+		if container.Mode == ContainerShared {
+			obj.Props["empty"] = container.RefillAt != 0
+		}
+		obj.GID = container.ClosedGID
+		if container.Open && container.OpenGID != 0 {
+			obj.GID = container.OpenGID
+		}
+	}
+	gs.mu.Unlock()
+	if ok {
+		gs.BroadcastObjectUpdate(container.ObjectID, dispatcher, logger)
+	}
+}
+
+// Save persists the containers' state and timers if one changed since the last save
+func (cm *ContainerManager) Save(ctx context.Context, db *DatabaseManager, mapName string) error {
+	cm.mu.Lock()
+	if !cm.dirty {
+		cm.mu.Unlock()
+		return nil
+	}
+	saved := &PersistedContainers{Map: mapName, Containers: make(map[int]PersistedContainer)}
+	for oid, container := range cm.containers {
+		if !container.Open && container.RefillAt == 0 && len(container.LootedBy) == 0 {
+			continue
+		}
+		state := PersistedContainer{Open: container.Open, CloseAt: container.CloseAt, RefillAt: container.RefillAt}
+		if len(container.LootedBy) > 0 {
+			state.LootedBy = make(map[string]int64, len(container.LootedBy))
+			for playerID, at := range container.LootedBy {
+				state.LootedBy[playerID] = at
+			}
+		}
+		saved.Containers[oid] = state
+	}
+	cm.dirty = false
+	cm.mu.Unlock()
+
+	if err := db.SaveContainers(ctx, saved); err != nil {
+		// Keep the dirty flag so the next periodic save retries
+		cm.mu.Lock()
+		cm.dirty = true
+		cm.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Restore puts back the looted containers and the timers saved before a restart. Timers that ran
+// out meanwhile are handled by the next Update.
+func (cm *ContainerManager) Restore(ctx context.Context, gs *GameMatchState) error {
+	saved, err := gs.databaseManager.LoadContainers(ctx, gs.currentMapName)
+	if err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	restored := make([]*Container, 0, len(saved.Containers))
+	for oid, state := range saved.Containers {
+		container, ok := cm.containers[oid]
+		if !ok {
+			continue
+		}
+		container.Open = state.Open
+		container.Locked = container.LockedByMap && !state.Open
+		container.CloseAt = state.CloseAt
+		container.RefillAt = state.RefillAt
+		for playerID, at := range state.LootedBy {
+			container.LootedBy[playerID] = at
+		}
+		restored = append(restored, container)
+	}
+	cm.mu.Unlock()
+
+	for _, container := range restored {
+		gs.applyContainer(container, nil, cm.logger)
+	}
+	cm.logger.Info("Restored %d looted containers", len(restored))
+	return nil
+}
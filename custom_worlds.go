@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Custom world visibility: who may find and join a world besides its owner
+const (
+	WorldVisibilityPrivate = "private" // the players the owner invited
+	WorldVisibilityFriends = "friends" // the owner's mutual friends
+	WorldVisibilityPublic  = "public"  // everyone
+)
+
+// Custom world tuning
+const (
+	customWorldKind           = "custom_world" // the "kind" of every custom world match label
+	defaultCustomWorldPlayers = 16
+	maxCustomWorldPlayers     = 50
+	maxCustomWorldsPerPlayer  = 3                 // running worlds a player may own at once
+	maxCustomWorldName        = 32                // characters
+	maxCustomWorldScan        = 1000              // directory entries and matches world_list reads
+	customWorldListGrace      = time.Minute       // a new world's match may not be listed yet for this long
+	customWorldWriteRetries   = 3                 // attempts to write a player's world slots when another call changed them in between
+	customWorldIdleTicks      = 5 * 60 * TickRate // an empty world closes after this long
+)
+
+// customWorldRule is a game rule a custom world may set: a flag, or a number of seconds from Min
+// to Max (no upper bound when Max is 0)
+type customWorldRule struct {
+	Flag     bool
+	Min, Max float64
+}
+
+// customWorldRules are the game rules (see ApplyWorldSettings) a custom world may set. The
+// respawn delay and spawn protection can't go below their defaults, so players can't kill each
+// other back to back in a world of their own for kill credit and rewards.
+var customWorldRules = map[string]customWorldRule{
+	"pvpEnabled":      {Flag: true},
+	"respawnTime":     {Min: defaultRespawnDelay, Max: 300},
+	"itemDecayTime":   {},
+	"spawnProtection": {Min: defaultSpawnProtection, Max: 30},
+}
+
+var (
+	errWorldsPlayersOnly = runtime.NewError("worlds are created and browsed by players", rpcCodeUnauthenticated)
+	errInvalidWorld      = runtime.NewError("worlds need a name of up to 32 characters, an existing map, a visibility of private, friends or public, 1 to 50 players and known game rules within their bounds", rpcCodeInvalidArgument)
+	errWorldLimit        = runtime.NewError("too many of your worlds are running", rpcCodeFailedPrecondition)
+	errWorldNameBlocked  = runtime.NewError("the content filter refused the world name", rpcCodeInvalidArgument)
+)
+
+// CustomWorldLabel is the JSON label of a custom world match
+type CustomWorldLabel struct {
+	Kind       string `json:"kind"` // customWorldKind
+	Name       string `json:"name"`
+	Map        string `json:"map"`
+	Owner      string `json:"owner"`
+	Visibility string `json:"visibility"`
+	Players    int    `json:"players"`
+	MaxPlayers int    `json:"maxPlayers"`
+	Open       bool   `json:"open"` // accepts players
+	PvP        bool   `json:"pvp"`
+	Started    int64  `json:"started"` // unix seconds
+}
+
+// CustomWorld is a world a player started on demand (world_create): an instance of a map with
+// its own player cap and game rules, listed in the world directory while it runs. Like dungeon
+// instances, it starts from the map's initial state and saves no world state; players keep their
+// progress and go back to where they left the open world. It is only used from the match handlers.
+type CustomWorld struct {
+	logger    runtime.Logger
+	Entry     *PersistedCustomWorld
+	emptyFrom int64
+	published string
+}
+
+// customWorldFromParams reads the world a match was created for from its "world" parameter
+func customWorldFromParams(logger runtime.Logger, params map[string]interface{}) (*CustomWorld, error) {
+	entry := &PersistedCustomWorld{}
+	s, _ := params["world"].(string)
+	if err := json.Unmarshal([]byte(s), entry); err != nil {
+		return nil, err
+	}
+	return &CustomWorld{logger: logger, Entry: entry}, nil
+}
+
+// instanced reports whether the match is an instance, a dungeon or a custom world: it starts
+// from the map's initial state and saves neither world state nor open world positions
+func (gs *GameMatchState) instanced() bool {
+	return gs.dungeon != nil || gs.customWorld != nil
+}
+
+// Apply returns the world settings with the world's player cap and game rules in place of the
+// server-wide ones (the settings unchanged for matches that aren't custom worlds)
+func (cw *CustomWorld) Apply(settings *WorldSettings) *WorldSettings {
+	if cw == nil {
+		return settings
+	}
+	applied := *settings
+	applied.MaxPlayers = cw.Entry.MaxPlayers
+	applied.GameRules = maps.Clone(settings.GameRules)
+	if applied.GameRules == nil {
+		applied.GameRules = make(map[string]interface{})
+	}
+	maps.Copy(applied.GameRules, cw.Entry.Rules)
+	return &applied
+}
+
+// CanJoin returns why a player may not join the world, or ""
+func (cw *CustomWorld) CanJoin(ctx context.Context, nk runtime.NakamaModule, playerID string) string {
+	if canSeeWorld(ctx, nk, cw.Entry, playerID) {
+		return ""
+	}
+	return "not invited to this world"
+}
+
+// canSeeWorld reports whether a player may find and join a world: its owner always, others by
+// its visibility
+func canSeeWorld(ctx context.Context, nk runtime.NakamaModule, entry *PersistedCustomWorld, playerID string) bool {
+	return worldVisible(entry, playerID, func() bool {
+		friends, err := mutualFriends(ctx, nk, entry.Owner, playerID)
+		return err == nil && friends
+	})
+}
+
+// worldVisible is canSeeWorld with the friendship check supplied: friends reports whether the
+// player and the world's owner are mutual friends, and is only called for friends-only worlds
+func worldVisible(entry *PersistedCustomWorld, playerID string, friends func() bool) bool {
+	if playerID == entry.Owner {
+		return true
+	}
+	switch entry.Visibility {
+	case WorldVisibilityPublic:
+		return true
+	case WorldVisibilityFriends:
+		return friends()
+	default:
+		for _, id := range entry.Invited {
+			if id == playerID {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Label returns the match label for the current population
+func (cw *CustomWorld) Label(gs *GameMatchState) string {
+	label := CustomWorldLabel{
+		Kind:       customWorldKind,
+		Name:       cw.Entry.Name,
+		Map:        gs.currentMapName,
+		Owner:      cw.Entry.Owner,
+		Visibility: cw.Entry.Visibility,
+		Players:    len(gs.presences),
+		MaxPlayers: cw.Entry.MaxPlayers,
+		Open:       len(gs.presences) < cw.Entry.MaxPlayers,
+		PvP:        gs.pvpEnabled(),
+		Started:    cw.Entry.CreatedAt.Unix(),
+	}
+	data, err := json.Marshal(label)
+	if err != nil {
+		cw.logger.Error("Failed to marshal custom world label: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// UpdateLabel publishes the label when the population or PvP rule changed. Called after joins
+// and leaves, and when the world settings change.
+func (cw *CustomWorld) UpdateLabel(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if cw == nil || dispatcher == nil {
+		return
+	}
+	label := cw.Label(gs)
+	if label == "" || label == cw.published {
+		return
+	}
+	if err := dispatcher.MatchLabelUpdate(label); err != nil {
+		cw.logger.Error("Failed to update custom world label: %v", err)
+		return
+	}
+	cw.published = label
+}
+
+// Idle reports whether the world has been empty for customWorldIdleTicks and should close.
+// Called from the match loop.
+func (cw *CustomWorld) Idle(gs *GameMatchState) bool {
+	if len(gs.presences) > 0 {
+		cw.emptyFrom = 0
+		return false
+	}
+	if cw.emptyFrom == 0 {
+		cw.emptyFrom = gs.currentTick
+	}
+	return gs.currentTick-cw.emptyFrom >= customWorldIdleTicks
+}
+
+// Unlist takes the closing world out of the world directory
+func (cw *CustomWorld) Unlist(ctx context.Context, gs *GameMatchState) {
+	if err := gs.databaseManager.DeleteCustomWorld(ctx, cw.Entry.ID); err != nil {
+		cw.logger.Error("Failed to remove custom world %s from the directory: %v", cw.Entry.ID, err)
+	}
+}
+
+// validCustomWorld checks and completes a world_create request: a name, an existing map file, a
+// visibility, a player cap and game rules customWorldRules allows
+func validCustomWorld(entry *PersistedCustomWorld) bool {
+	entry.Name = strings.TrimSpace(entry.Name)
+	if entry.Name == "" || utf8.RuneCountInString(entry.Name) > maxCustomWorldName {
+		return false
+	}
+	if !filepath.IsLocal(entry.Map) || !strings.HasSuffix(entry.Map, ".json") {
+		return false
+	}
+	if info, err := os.Stat(filepath.Join(mapDirectory, entry.Map)); err != nil || info.IsDir() {
+		return false
+	}
+	switch entry.Visibility {
+	case "":
+		entry.Visibility = WorldVisibilityPrivate
+	case WorldVisibilityPrivate, WorldVisibilityFriends, WorldVisibilityPublic:
+	default:
+		return false
+	}
+	if entry.MaxPlayers == 0 {
+		entry.MaxPlayers = defaultCustomWorldPlayers
+	}
+	if entry.MaxPlayers < 1 || entry.MaxPlayers > maxCustomWorldPlayers || len(entry.Invited) > maxCustomWorldPlayers {
+		return false
+	}
+	for key, value := range entry.Rules {
+		rule, known := customWorldRules[key]
+		if !known {
+			return false
+		}
+		if _, isBool := value.(bool); rule.Flag && !isBool {
+			return false
+		}
+		if v, isNumber := value.(float64); !rule.Flag && (!isNumber || v < rule.Min || (rule.Max > 0 && v > rule.Max)) {
+			return false
+		}
+	}
+	return true
+}
+
+// updateWorldSlots applies a change to a player's custom world slots and writes them at the
+// version read, retrying when another world_create changed them in between. It returns the
+// change's error, or the storage error.
+func updateWorldSlots(ctx context.Context, dm *DatabaseManager, userID string, change func(slots *PersistedWorldSlots) error) error {
+	var err error
+	for attempt := 0; attempt < customWorldWriteRetries; attempt++ {
+		slots, version, loadErr := dm.LoadWorldSlots(ctx, userID)
+		if loadErr != nil {
+			return loadErr
+		}
+		if err = change(slots); err != nil {
+			return err
+		}
+		if err = dm.SaveWorldSlots(ctx, userID, slots, version); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// setWorldSlot gives a player's reserved world slot its match, or frees it for "", logging failures
+func setWorldSlot(ctx context.Context, logger runtime.Logger, dm *DatabaseManager, userID, slotID, matchID string) {
+	err := updateWorldSlots(ctx, dm, userID, func(slots *PersistedWorldSlots) error {
+		kept := slots.Slots[:0]
+		for _, slot := range slots.Slots {
+			if slot.ID == slotID {
+				if matchID == "" {
+					continue
+				}
+				slot.MatchID = matchID
+			}
+			kept = append(kept, slot)
+		}
+		slots.Slots = kept
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to update world slot %s of %s: %v", slotID, userID, err)
+	}
+}
+
+// RegisterCustomWorldRpcs registers the RPC players create custom worlds with (world_list,
+// in world_browser.go, lists them)
+func RegisterCustomWorldRpcs(initializer runtime.Initializer) error {
+	return initializer.RegisterRpc("world_create", rpcWorldCreate)
+}
+
+// rpcWorldCreate starts a custom world owned by the caller on a map of their choice, lists it in
+// the world directory and returns its match ID. Private worlds admit the invited players, friends
+// worlds the owner's mutual friends. A slot is reserved with a versioned write before the match
+// starts, so concurrent calls can't start more than maxCustomWorldsPerPlayer worlds.
+// Payload: {"name": "Lazy Sunday", "map": "elderford/world.json", "visibility": "friends",
+// "maxPlayers": 8, "rules": {"pvpEnabled": false}, "invite": ["userId", ...]}
+func rpcWorldCreate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errWorldsPlayersOnly
+	}
+	var req struct {
+		Name       string                 `json:"name"`
+		Map        string                 `json:"map"`
+		Visibility string                 `json:"visibility"`
+		MaxPlayers int                    `json:"maxPlayers"`
+		Rules      map[string]interface{} `json:"rules"`
+		Invite     []string               `json:"invite"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil {
+		return "", errInvalidPayload
+	}
+	entry := &PersistedCustomWorld{
+		Name:       req.Name,
+		Map:        req.Map,
+		Visibility: req.Visibility,
+		MaxPlayers: req.MaxPlayers,
+		Rules:      req.Rules,
+		Invited:    req.Invite,
+	}
+	if !validCustomWorld(entry) {
+		return "", errInvalidWorld
+	}
+	if _, err := moderator.Moderate(ctx, ContentWorldName, userID, entry.Name); err != nil {
+		return "", errWorldNameBlocked
+	}
+
+	running, err := nk.MatchList(ctx, maxCustomWorldsPerPlayer+1, true, "", nil, nil,
+		fmt.Sprintf("+label.kind:%s +label.owner:%q", customWorldKind, userID))
+	if err != nil {
+		logger.Error("Failed to list the worlds of %s: %v", userID, err)
+		return "", errInternalFailure
+	}
+	if len(running) >= maxCustomWorldsPerPlayer {
+		return "", errWorldLimit
+	}
+	live := make(map[string]bool, len(running))
+	for _, match := range running {
+		live[match.GetMatchId()] = true
+	}
+
+	users, err := nk.UsersGetId(ctx, []string{userID}, nil)
+	if err != nil || len(users) == 0 {
+		return "", errInternalFailure
+	}
+
+	// Slots of worlds that closed are freed; a reservation counts until its match is listed
+	dm := NewDatabaseManager(logger, nk)
+	slotID := newUUID()
+	now := time.Now()
+	err = updateWorldSlots(ctx, dm, userID, func(slots *PersistedWorldSlots) error {
+		kept := slots.Slots[:0]
+		for _, slot := range slots.Slots {
+			if live[slot.MatchID] || now.Sub(time.Unix(slot.ReservedAt, 0)) < customWorldListGrace {
+				kept = append(kept, slot)
+			}
+		}
+		slots.Slots = kept
+		if len(slots.Slots) >= maxCustomWorldsPerPlayer {
+			return errWorldLimit
+		}
+		slots.Slots = append(slots.Slots, WorldSlot{ID: slotID, ReservedAt: now.Unix()})
+		return nil
+	})
+	if err == errWorldLimit {
+		return "", errWorldLimit
+	}
+	if err != nil {
+		return "", errInternalFailure
+	}
+
+	entry.Owner = userID
+	entry.OwnerName = users[0].GetUsername()
+	entry.CreatedAt = time.Now().UTC()
+	world, err := json.Marshal(entry)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	matchID, err := nk.MatchCreate(ctx, "game", map[string]interface{}{"map": entry.Map, "world": string(world)})
+	if err != nil {
+		logger.Error("Failed to start world %q on %s for %s: %v", entry.Name, entry.Map, userID, err)
+		setWorldSlot(ctx, logger, dm, userID, slotID, "")
+		return "", errInternalFailure
+	}
+	entry.ID = matchID
+	setWorldSlot(ctx, logger, dm, userID, slotID, matchID)
+
+	// A world that couldn't be listed closes once it stayed empty
+	if err := dm.SaveCustomWorld(ctx, entry); err != nil {
+		return "", errInternalFailure
+	}
+	logger.Info("Player %s created %s world %q on %s: %s", userID, entry.Visibility, entry.Name, entry.Map, matchID)
+
+	out, err := json.Marshal(map[string]any{
+		"matchId":    matchID,
+		"name":       entry.Name,
+		"map":        entry.Map,
+		"visibility": entry.Visibility,
+		"maxPlayers": entry.MaxPlayers,
+	})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Cutscene tuning
+const (
+	defaultCutsceneDuration = 3.0  // seconds
+	maxCutsceneDuration     = 60.0 // seconds; a script can't lock a player out for longer
+)
+
+// Cutscene focus kinds
+const (
+	CutsceneFocusObject = "object"
+	CutsceneFocusNPC    = "npc"
+	CutsceneFocusPlayer = "player"
+	CutscenePanToPoint  = "point"
+)
+
+// Cutscene is a camera directive sent to one player (OpCodeCutscene "cutscene_focus"). The
+// client moves its camera to the focus, following it if it is an entity, until the cutscene is
+// released or Duration runs out.
+type Cutscene struct {
+	Focus     string  `json:"focus"`              // Cutscene* kind
+	TargetID  string  `json:"targetId,omitempty"` // object, NPC or player ID for entity focus
+	X         float64 `json:"x"`                  // focus position when the directive was sent
+	Y         float64 `json:"y"`
+	Pan       float64 `json:"pan"`  // seconds the camera takes to get there (0 cuts)
+	Zoom      float64 `json:"zoom"` // camera zoom (1 = normal)
+	Duration  float64 `json:"duration"`
+	LockInput bool    `json:"lockInput"` // the server rejects the player's inputs meanwhile
+	endTick   int64
+}
+
+// CutsceneSpec is what a script asks for with cutscene_focus
+type CutsceneSpec struct {
+	ObjectID  int      `json:"objectId"`
+	NPCID     int      `json:"npcId"`
+	PlayerID  string   `json:"playerId"`
+	X         *float64 `json:"x"`
+	Y         *float64 `json:"y"`
+	Pan       float64  `json:"pan"`
+	Zoom      float64  `json:"zoom"`
+	Duration  float64  `json:"duration"`
+	LockInput *bool    `json:"lockInput"` // default true
+}
+
+// cutsceneRelease is the payload of OpCodeCutscene "cutscene_release"
+type cutsceneRelease struct {
+	Reason string `json:"reason"` // "released" by a script, "ended" when the duration ran out, "replaced" by a new directive
+}
+
+// StartCutscene sends a player a camera directive, replacing any running one, and stops them
+// when it locks their input. It returns false for offline players and unknown focus targets.
+func (gs *GameMatchState) StartCutscene(playerID string, spec *CutsceneSpec, dispatcher runtime.MatchDispatcher, logger runtime.Logger) bool {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return false
+	}
+	cutscene := &Cutscene{Pan: math.Max(0, spec.Pan), Zoom: spec.Zoom, Duration: spec.Duration, LockInput: spec.LockInput == nil || *spec.LockInput}
+	switch {
+	case spec.ObjectID != 0:
+		gs.mu.Lock()
+		obj, ok := gs.Object(spec.ObjectID)
+		gs.mu.Unlock()
+		if !ok {
+			return false
+		}
+		pos, ok := obj.Position()
+		if !ok {
+			return false
+		}
+		cutscene.Focus, cutscene.X, cutscene.Y = CutsceneFocusObject, pos.X, pos.Y
+		cutscene.TargetID = strconv.Itoa(spec.ObjectID)
+	case spec.NPCID != 0:
+		npc, ok := gs.npcManager.Get(spec.NPCID)
+		if !ok {
+			return false
+		}
+		cutscene.Focus, cutscene.X, cutscene.Y = CutsceneFocusNPC, npc.Body.Position.X, npc.Body.Position.Y
+		cutscene.TargetID = strconv.Itoa(spec.NPCID)
+	case spec.PlayerID != "":
+		target := gs.PlayerBody(spec.PlayerID)
+		if target == nil {
+			return false
+		}
+		cutscene.Focus, cutscene.X, cutscene.Y = CutsceneFocusPlayer, target.Position.X, target.Position.Y
+		cutscene.TargetID = spec.PlayerID
+	case spec.X != nil && spec.Y != nil:
+		cutscene.Focus, cutscene.X, cutscene.Y = CutscenePanToPoint, *spec.X, *spec.Y
+	default:
+		return false
+	}
+	if cutscene.Zoom <= 0 {
+		cutscene.Zoom = 1
+	}
+	if cutscene.Duration <= 0 {
+		cutscene.Duration = defaultCutsceneDuration
+	}
+	cutscene.Duration = math.Min(cutscene.Duration, maxCutsceneDuration)
+	cutscene.endTick = gs.currentTick + int64(cutscene.Duration*TickRate)
+
+	state := gs.GetPlayerState(playerID)
+	if state.Cutscene != nil {
+		gs.sendCutscene(playerID, "cutscene_release", cutsceneRelease{Reason: "replaced"}, dispatcher, logger)
+	}
+	state.Cutscene = cutscene
+	if cutscene.LockInput {
+		rb.Velocity = vector.Vector{}
+		state.Sprinting = false
+	}
+	gs.sendCutscene(playerID, "cutscene_focus", cutscene, dispatcher, logger)
+	return true
+}
+
+// EndCutscene gives a player their camera (and input) back. It returns false if no cutscene ran.
+func (gs *GameMatchState) EndCutscene(playerID, reason string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) bool {
+	state, ok := gs.playerStates[playerID]
+	if !ok || state.Cutscene == nil {
+		return false
+	}
+	state.Cutscene = nil
+	gs.sendCutscene(playerID, "cutscene_release", cutsceneRelease{Reason: reason}, dispatcher, logger)
+	return true
+}
+
+// UpdateCutscenes ends the cutscenes whose duration ran out. Called from the match loop.
+func (gs *GameMatchState) UpdateCutscenes(dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	for playerID, state := range inOrder(sortedKeys(gs.playerStates), gs.playerStates) {
+		if state.Cutscene != nil && gs.currentTick >= state.Cutscene.endTick {
+			gs.EndCutscene(playerID, "ended", dispatcher, logger)
+		}
+	}
+}
+
+// inputLocked reports whether a running cutscene suppresses the player's inputs
+func (ps *PlayerState) inputLocked() bool {
+	return ps.Cutscene != nil && ps.Cutscene.LockInput
+}
+
+// sendCutscene sends an OpCodeCutscene message to one player
+func (gs *GameMatchState) sendCutscene(playerID, msgType string, payload any, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeCutscene, msgType, payload)
+	if err != nil {
+		logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeCutscene, data, []runtime.Presence{presence}, nil, true)
+}
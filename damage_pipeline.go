@@ -0,0 +1,233 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// Damage pipeline stages, in the order a hit goes through them
+const (
+	DamageStageBase        = "base"        // the hit as dealt, after crits and falloff
+	DamageStageArmor       = "armor"       // physical damage scaled by the target's armor
+	DamageStageResistances = "resistances" // damage reduced by the target's resistance to its type
+	DamageStageBuffs       = "buffs"       // damage_taken and damage_dealt status effects
+	DamageStageShields     = "shields"     // shield effects absorb what they can
+	DamageStageFinal       = "final"       // what is left, capped at the target's health
+)
+
+// damageStages lists the pipeline stages in order
+var damageStages = []string{DamageStageBase, DamageStageArmor, DamageStageResistances, DamageStageBuffs, DamageStageShields, DamageStageFinal}
+
+// validDamageStage reports whether a name is a pipeline stage
+func validDamageStage(stage string) bool {
+	return slices.Contains(damageStages, stage)
+}
+
+// DamageStep is the damage left after a pipeline stage, and the modifiers that changed it there.
+// Damage events carry one per stage as their breakdown.
+type DamageStep struct {
+	Stage     string   `json:"stage"`
+	Amount    float64  `json:"amount"`
+	Modifiers []string `json:"modifiers,omitempty"` // e.g. "armor", "resistance", an effect or script modifier ID
+}
+
+// DamageHit is a hit going through the damage pipeline. Hooks read it and change Amount with
+// Scale and Add, which record them in the stage's breakdown step.
+type DamageHit struct {
+	Source     DamageSource
+	TargetType string // "player" or "npc"
+	TargetID   string
+	DamageType string
+	Amount     float64
+	Stage      string
+	Breakdown  []DamageStep
+
+	target     *HealthComponent
+	bonusArmor float64 // armor on top of the target's own, e.g. from buffs
+}
+
+// Scale multiplies the hit's damage by a factor on behalf of a modifier
+func (hit *DamageHit) Scale(modifier string, factor float64) {
+	hit.Add(modifier, hit.Amount*factor-hit.Amount)
+}
+
+// Add adds to the hit's damage (negative to lower it) on behalf of a modifier. Damage never
+// drops below zero.
+func (hit *DamageHit) Add(modifier string, amount float64) {
+	next := max(0, hit.Amount+amount)
+	if next == hit.Amount {
+		return
+	}
+	hit.Amount = next
+	step := &hit.Breakdown[len(hit.Breakdown)-1]
+	step.Modifiers = append(step.Modifiers, modifier)
+}
+
+// DamageHook changes a hit at the stage it was registered for
+type DamageHook func(gs *GameMatchState, hit *DamageHit)
+
+// damageHook is a hook registered under a name
+type damageHook struct {
+	name string
+	hook DamageHook
+}
+
+// DamageModifier is a change scripts make to the hits matching its filters (empty filters match
+// every hit) at one stage: the damage is multiplied by Multiply, then Add is added
+type DamageModifier struct {
+	ID          string
+	Stage       string
+	Multiply    float64
+	Add         float64
+	DamageType  string
+	SourceType  string
+	SourceID    string
+	TargetType  string
+	TargetID    string
+	ExpiresTick int64 // 0 = until removed
+}
+
+// matches reports whether a modifier applies to a hit
+func (m *DamageModifier) matches(hit *DamageHit, tick int64) bool {
+	return (m.ExpiresTick == 0 || tick < m.ExpiresTick) &&
+		(m.DamageType == "" || m.DamageType == hit.DamageType) &&
+		(m.SourceType == "" || m.SourceType == hit.Source.Type) &&
+		(m.SourceID == "" || m.SourceID == hit.Source.ID) &&
+		(m.TargetType == "" || m.TargetType == hit.TargetType) &&
+		(m.TargetID == "" || m.TargetID == hit.TargetID)
+}
+
+// DamagePipeline resolves how much of a hit a player or NPC takes, in ordered stages (base,
+// armor, resistances, buffs, shields, final). Each stage runs its hooks in registration order:
+// the built-in mitigation, status effects, then the modifiers scripts added, so subsystems,
+// effects and scripts change damage at a well-defined point instead of around the health
+// component. The steps are kept as the hit's breakdown.
+type DamagePipeline struct {
+	hooks     map[string][]damageHook // stage -> hooks
+	modifiers []*DamageModifier       // script modifiers, by ID
+}
+
+// NewDamagePipeline creates a pipeline with the built-in armor, resistance, status effect,
+// shield and script modifier hooks
+func NewDamagePipeline() *DamagePipeline {
+	dp := &DamagePipeline{hooks: make(map[string][]damageHook)}
+	dp.Register(DamageStageArmor, "armor", armorHook)
+	dp.Register(DamageStageResistances, "resistance", resistanceHook)
+	dp.Register(DamageStageShields, "shield", shieldHook)
+	for _, stage := range damageStages {
+		dp.Register(stage, "effects", effectDamageHook)
+		dp.Register(stage, "scripts", dp.modifierHook)
+	}
+	return dp
+}
+
+// Register adds a hook to a stage, after the hooks registered before it
+func (dp *DamagePipeline) Register(stage, name string, hook DamageHook) {
+	dp.hooks[stage] = append(dp.hooks[stage], damageHook{name: name, hook: hook})
+}
+
+// Run takes a hit through every stage and returns the damage the target takes. Shields are
+// used up as they absorb it.
+func (dp *DamagePipeline) Run(gs *GameMatchState, hit *DamageHit) float64 {
+	for _, stage := range damageStages {
+		hit.Stage = stage
+		hit.Breakdown = append(hit.Breakdown, DamageStep{Stage: stage})
+		for _, h := range dp.hooks[stage] {
+			h.hook(gs, hit)
+		}
+		if stage == DamageStageFinal {
+			hit.Add("health", min(hit.Amount, hit.target.Health)-hit.Amount)
+		}
+		hit.Breakdown[len(hit.Breakdown)-1].Amount = hit.Amount
+	}
+	return hit.Amount
+}
+
+// armorHook scales physical damage by 100 / (100 + armor)
+func armorHook(gs *GameMatchState, hit *DamageHit) {
+	if hit.DamageType != DamagePhysical {
+		return
+	}
+	if armor := hit.target.Armor + hit.bonusArmor; armor > 0 {
+		hit.Scale("armor", 100/(100+armor))
+	}
+}
+
+// resistanceHook reduces damage by the target's resistance to its type (true damage ignores it)
+func resistanceHook(gs *GameMatchState, hit *DamageHit) {
+	if hit.DamageType == DamageTrue {
+		return
+	}
+	if resistance := min(hit.target.Resistances[hit.DamageType], maxResistance); resistance > 0 {
+		hit.Scale("resistance", 1-resistance)
+	}
+}
+
+// effectDamageHook applies the target's damage_taken and the attacking player's damage_dealt
+// effects whose stage (default buffs) is the hit's, in effect ID order
+func effectDamageHook(gs *GameMatchState, hit *DamageHit) {
+	apply := func(playerID, kind string) {
+		state, ok := gs.playerStates[playerID]
+		if !ok {
+			return
+		}
+		for _, id := range sortedKeys(state.Effects) {
+			effect := state.Effects[id]
+			def := effect.Def
+			if def.Kind != kind || def.DamageStage() != hit.Stage || (def.DamageType != "" && def.DamageType != hit.DamageType) {
+				continue
+			}
+			hit.Scale(id, max(0, 1+def.Magnitude*float64(effect.Stacks)))
+		}
+	}
+	if hit.TargetType == "player" {
+		apply(hit.TargetID, EffectKindDamageTaken)
+	}
+	if hit.Source.Type == DamageSourcePlayer {
+		apply(hit.Source.ID, EffectKindDamageDealt)
+	}
+}
+
+// shieldHook lets the target's shield absorb what it can
+func shieldHook(gs *GameMatchState, hit *DamageHit) {
+	absorbed := min(hit.target.Shield, hit.Amount)
+	if absorbed <= 0 {
+		return
+	}
+	hit.target.Shield -= absorbed
+	hit.Add("shield", -absorbed)
+}
+
+// modifierHook applies the script modifiers of the hit's stage that match it, by ID
+func (dp *DamagePipeline) modifierHook(gs *GameMatchState, hit *DamageHit) {
+	for _, m := range dp.modifiers {
+		if m.Stage != hit.Stage || !m.matches(hit, gs.currentTick) {
+			continue
+		}
+		if m.Multiply != 1 {
+			hit.Scale(m.ID, m.Multiply)
+		}
+		if m.Add != 0 {
+			hit.Add(m.ID, m.Add)
+		}
+	}
+}
+
+// AddModifier adds a script modifier, replacing the one with the same ID. Expired modifiers are
+// dropped along the way.
+func (dp *DamagePipeline) AddModifier(gs *GameMatchState, m *DamageModifier) {
+	dp.modifiers = slices.DeleteFunc(dp.modifiers, func(other *DamageModifier) bool {
+		return other.ID == m.ID || (other.ExpiresTick != 0 && gs.currentTick >= other.ExpiresTick)
+	})
+	i, _ := slices.BinarySearchFunc(dp.modifiers, m.ID, func(other *DamageModifier, id string) int {
+		return strings.Compare(other.ID, id)
+	})
+	dp.modifiers = slices.Insert(dp.modifiers, i, m)
+}
+
+// RemoveModifier removes a script modifier. It returns false if there was none with the ID.
+func (dp *DamagePipeline) RemoveModifier(id string) bool {
+	n := len(dp.modifiers)
+	dp.modifiers = slices.DeleteFunc(dp.modifiers, func(m *DamageModifier) bool { return m.ID == id })
+	return len(dp.modifiers) < n
+}
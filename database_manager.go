@@ -4,232 +4,3878 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/rudransh61/Physix-go/pkg/rigidbody"
 	"github.com/rudransh61/Physix-go/pkg/vector"
 )
 
-// DatabaseManager handles all persistent storage operations for the game
+// DatabaseManager handles all persistent storage operations for the game. Records go to its
+// PersistenceStore (persistence_store.go); wallets and leaderboards to Nakama.
 type DatabaseManager struct {
 	logger runtime.Logger
 	nk     runtime.NakamaModule
+	store  PersistenceStore
+
+	worldSave  sync.Mutex     // serializes world state writes
+	worldTick  int64          // tick of the last world state written, so older snapshots don't land after it
+	worldSaves sync.WaitGroup // world state saves running off the match loop
 }
 
 // Storage collections for organizing game data
 const (
-	COLLECTION_WORLD_STATE    = "world_state"
-	COLLECTION_PLAYER_DATA    = "player_data"
-	COLLECTION_GAME_OBJECTS   = "game_objects"
-	COLLECTION_WORLD_SETTINGS = "world_settings"
+	COLLECTION_WORLD_STATE      = "world_state"
+	COLLECTION_PLAYER_DATA      = "player_data"
+	COLLECTION_GAME_OBJECTS     = "game_objects"
+	COLLECTION_WORLD_SETTINGS   = "world_settings"
+	COLLECTION_INTERACTIONS     = "player_interactions"
+	COLLECTION_WORLD_VARS       = "world_vars"
+	COLLECTION_REGION_VARS      = "region_vars"
+	COLLECTION_SCRIPTS          = "scripts"
+	COLLECTION_SCRIPT_MANIFEST  = "script_manifests"
+	COLLECTION_INVENTORY        = "player_inventory"
+	COLLECTION_PLAYER_STATS     = "player_stats"
+	COLLECTION_PLAYER_EFFECTS   = "player_effects"
+	COLLECTION_RESOURCE_NODES   = "resource_nodes"
+	COLLECTION_WORLD_CLOCK      = "world_clock"
+	COLLECTION_GUILDS           = "guilds"
+	COLLECTION_GUILD_MEMBERS    = "guild_membership"
+	COLLECTION_CONTROL_POINTS   = "control_points"
+	COLLECTION_HOUSING_PLOTS    = "housing_plots"
+	COLLECTION_FARMS            = "farms"
+	COLLECTION_PETS             = "player_pets"
+	COLLECTION_QUESTS           = "player_quests"
+	COLLECTION_REPUTATION       = "player_reputation"
+	COLLECTION_EXPLORATION      = "player_exploration"
+	COLLECTION_GROUP_FINDER     = "group_finder"
+	COLLECTION_DOORS            = "doors"
+	COLLECTION_MECHANISMS       = "mechanisms"
+	COLLECTION_WAYPOINTS        = "player_waypoints"
+	COLLECTION_TRAVEL           = "player_travel"
+	COLLECTION_REPLAYS          = "replays"
+	COLLECTION_ADMIN_LOG        = "admin_log"
+	COLLECTION_WORLD_RESETS     = "world_resets"
+	COLLECTION_LIVE_OPS         = "live_ops"
+	COLLECTION_SURVIVAL         = "player_survival"
+	COLLECTION_LOGIN_REWARDS    = "player_login_rewards"
+	COLLECTION_AUCTIONS         = "auctions"
+	COLLECTION_AUCTION_CLAIMS   = "auction_claims"
+	COLLECTION_REWARD_CLAIMS    = "reward_claims"
+	COLLECTION_PRIVACY          = "player_privacy"
+	COLLECTION_CONTAINERS       = "containers"
+	COLLECTION_WORLD_ITEMS      = "world_items"
+	COLLECTION_ACTION_JOURNAL   = "action_journal"
+	COLLECTION_JOURNAL_OUTCOMES = "action_journal_outcomes"
+	COLLECTION_RNG_AUDIT        = "rng_audit"
+	COLLECTION_MODERATION       = "moderation_violations"
+	COLLECTION_CHEAT_REPORTS    = "cheat_reports"
+	COLLECTION_WORLD_CHUNKS     = "world_chunks"
+	COLLECTION_PREFERENCES      = "player_preferences"
+	COLLECTION_SHOPS            = "shops"
+	COLLECTION_WORLD_DIRECTORY  = "world_directory"
+	COLLECTION_WORLD_SLOTS      = "world_slots"
+	COLLECTION_SHARD_CLAIMS     = "shard_claims"
 )
 
 // Storage keys for different data types
 const (
 	KEY_GLOBAL_WORLD_STATE = "global"
 	KEY_PHYSICS_SETTINGS   = "physics"
+	KEY_GAME_CONFIG        = "game_config"
 )
 
-// Persistent data structures
-type PersistedWorldState struct {
-	LastTick       int64                  `json:"lastTick"`
-	GameObjects    []*rigidbody.RigidBody `json:"gameObjects"`
-	ActivePlayers  []string               `json:"activePlayers"`
-	LastUpdateTime time.Time              `json:"lastUpdateTime"`
-	PhysicsEnabled bool                   `json:"physicsEnabled"`
+// Persistent data structures
+type PersistedWorldState struct {
+	Version        int                    `json:"version"` // persistedWorldVersion when saved
+	LastTick       int64                  `json:"lastTick"`
+	GameObjects    []*rigidbody.RigidBody `json:"gameObjects"`
+	ActivePlayers  []string               `json:"activePlayers"`
+	LastUpdateTime time.Time              `json:"lastUpdateTime"`
+	PhysicsEnabled bool                   `json:"physicsEnabled"`
+}
+
+type PersistedPlayerData struct {
+	PlayerID      string        `json:"playerId"`
+	Username      string        `json:"username"`
+	Position      vector.Vector `json:"position"`
+	Velocity      vector.Vector `json:"velocity"`
+	Health        float64       `json:"health"`
+	Level         int           `json:"level"`
+	Map           string        `json:"map,omitempty"`    // map the position is on
+	Region        string        `json:"region,omitempty"` // display name of the region around the position
+	LastLoginTime time.Time     `json:"lastLoginTime"`
+	PlayTime      time.Duration `json:"playTime"`
+	Inventory     []string      `json:"inventory"`
+	Achievements  []string      `json:"achievements"`
+}
+
+type PersistedGameObject struct {
+	ObjectID    string                 `json:"objectId"`
+	Type        string                 `json:"type"`
+	Position    vector.Vector          `json:"position"`
+	Velocity    vector.Vector          `json:"velocity"`
+	Mass        float64                `json:"mass"`
+	Shape       string                 `json:"shape"`
+	Width       float64                `json:"width"`
+	Height      float64                `json:"height"`
+	IsMovable   bool                   `json:"isMovable"`
+	Properties  map[string]interface{} `json:"properties"`
+	CreatedTime time.Time              `json:"createdTime"`
+	LastUpdated time.Time              `json:"lastUpdated"`
+}
+
+// PersistedInteractions stores per-player interaction cooldowns and once-only flags
+type PersistedInteractions struct {
+	PlayerID  string           `json:"playerId"`
+	Cooldowns map[string]int64 `json:"cooldowns"` // key -> expiry (unix millis)
+	Done      map[string]int64 `json:"done"`      // key -> completion time (unix millis)
+}
+
+// PersistedInventory stores the item stacks a player owns
+type PersistedInventory struct {
+	PlayerID string         `json:"playerId"`
+	Items    map[string]int `json:"items"` // item ID -> count
+}
+
+// PersistedPlayerStats stores a player's lifetime combat statistics
+type PersistedPlayerStats struct {
+	PlayerID    string         `json:"playerId"`
+	Deaths      int            `json:"deaths"`
+	LastDeathAt time.Time      `json:"lastDeathAt"`
+	LastKiller  *DamageSource  `json:"lastKiller,omitempty"` // source of the hit that killed the player last
+	Kills       int            `json:"kills"`                // players killed
+	Karma       int            `json:"karma"`                // PvP karma (pvp.go)
+	DuelWins    int            `json:"duelWins"`
+	DuelLosses  int            `json:"duelLosses"`
+	FishCaught  int            `json:"fishCaught"`        // reels within the bite window
+	FishLost    int            `json:"fishLost"`          // reels too early and escaped bites
+	Catches     map[string]int `json:"catches,omitempty"` // item ID -> total count fished
+}
+
+// PersistedEffects stores the long-running status effects, buffs and ability cooldowns of a
+// player who left. Expiries are wall clock times, so they keep running while the player is away.
+type PersistedEffects struct {
+	PlayerID  string            `json:"playerId"`
+	Effects   []PersistedEffect `json:"effects"`
+	Buffs     []PersistedBuff   `json:"buffs,omitempty"`
+	Cooldowns map[string]int64  `json:"cooldowns,omitempty"` // ability ID -> ready time (unix millis)
+}
+
+// PersistedEffect is a saved status effect
+type PersistedEffect struct {
+	ID        string  `json:"id"`
+	Stacks    int     `json:"stacks"`
+	ExpiresAt int64   `json:"expiresAt,omitempty"` // unix millis (0 = no expiry)
+	Remaining float64 `json:"remaining,omitempty"` // seconds left, in records saved before expiresAt
+}
+
+// PersistedBuff is a saved stat buff
+type PersistedBuff struct {
+	Stat      string  `json:"stat"`
+	Amount    float64 `json:"amount"`
+	ExpiresAt int64   `json:"expiresAt"` // unix millis
+}
+
+// PersistedSurvival stores the hunger and thirst meters of a player who left a survival map
+type PersistedSurvival struct {
+	PlayerID string  `json:"playerId"`
+	Hunger   float64 `json:"hunger"`
+	Thirst   float64 `json:"thirst"`
+}
+
+// PersistedPrivacy is who may see a player's whereabouts in player_location: Location covers
+// the map, region and position, LastSeen the last-seen time and online status. Each is one of
+// the Privacy* values.
+type PersistedPrivacy struct {
+	Location string `json:"location"`
+	LastSeen string `json:"lastSeen"`
+}
+
+// PersistedPreferences is a player's client settings, keyed by names the client picks
+type PersistedPreferences struct {
+	Values map[string]json.RawMessage `json:"values"`
+}
+
+// PersistedLoginRewards is a player's login streak and last daily reward claim
+type PersistedLoginRewards struct {
+	PlayerID   string    `json:"playerId"`
+	Streak     int       `json:"streak"`
+	BestStreak int       `json:"bestStreak"`
+	LastDay    string    `json:"lastDay"` // UTC day of the last claim (2006-01-02)
+	LastClaim  time.Time `json:"lastClaim"`
+	Claims     int       `json:"claims"`
+}
+
+// PersistedAuction is a running auction listing. Its items are held in escrow until it is
+// bought out, won, expires or is cancelled.
+type PersistedAuction struct {
+	ID         string    `json:"id"`
+	SellerID   string    `json:"sellerId"`
+	SellerName string    `json:"sellerName"`
+	ItemID     string    `json:"itemId"`
+	Count      int       `json:"count"`
+	Currency   string    `json:"currency"`
+	StartPrice int64     `json:"startPrice"`
+	Buyout     int64     `json:"buyout,omitempty"` // 0 = no buyout
+	Bid        int64     `json:"bid,omitempty"`    // highest bid, held from the bidder's wallet
+	BidderID   string    `json:"bidderId,omitempty"`
+	BidderName string    `json:"bidderName,omitempty"`
+	Bids       int       `json:"bids"`
+	ListingFee int64     `json:"listingFee,omitempty"` // paid when listed, not refunded
+	HouseCut   *float64  `json:"houseCut,omitempty"`   // share of the sale price the house keeps, the auction_cut rate when listed (nil = auctionHouseCut)
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	version    string    // storage version it was read at
+}
+
+// PersistedAuctionClaim is something the auction house owes a player: items won, bought or
+// returned, or news of a payout already in their wallet
+type PersistedAuctionClaim struct {
+	ListingID string    `json:"listingId"`
+	ItemID    string    `json:"itemId,omitempty"`
+	Count     int       `json:"count,omitempty"`
+	Reason    string    `json:"reason"`             // AuctionClaim*
+	Currency  string    `json:"currency,omitempty"` // currency paid or paid out
+	Amount    int64     `json:"amount,omitempty"`
+	At        time.Time `json:"at"`
+	version   string
+}
+
+// PersistedRewardClaim is a reward owed to a player who wasn't in the match that granted it:
+// items waiting for their next join
+type PersistedRewardClaim struct {
+	Key     string         `json:"key"`    // the grant's journal key, unique
+	Source  string         `json:"source"` // what granted it, e.g. "world_event:dragon"
+	Items   map[string]int `json:"items"`
+	At      time.Time      `json:"at"`
+	version string
+}
+
+// PersistedPets stores the pets a player adopted and which one was out when they left
+type PersistedPets struct {
+	PlayerID string                   `json:"playerId"`
+	Pets     map[string]*PersistedPet `json:"pets"`             // pet ID -> pet
+	Active   string                   `json:"active,omitempty"` // pet summoned again when the player joins
+}
+
+// PersistedPet is an adopted pet
+type PersistedPet struct {
+	Name      string    `json:"name"`
+	AdoptedAt time.Time `json:"adoptedAt"`
+	DownUntil int64     `json:"downUntil,omitempty"` // unix seconds; a defeated pet can't be summoned before this
+}
+
+// PersistedQuestLog stores a player's active and completed quests
+type PersistedQuestLog struct {
+	PlayerID  string                     `json:"playerId"`
+	Active    map[string]*PersistedQuest `json:"active"`    // quest ID -> progress
+	Completed map[string]int             `json:"completed"` // quest ID -> times turned in
+}
+
+// PersistedQuest is the progress of an accepted quest
+type PersistedQuest struct {
+	Progress   []int     `json:"progress"` // per objective; collect objectives are counted from the inventory
+	AcceptedAt time.Time `json:"acceptedAt"`
+}
+
+// PersistedReputation stores a player's faction standings
+type PersistedReputation struct {
+	PlayerID  string         `json:"playerId"`
+	Standings map[string]int `json:"standings"` // faction ID -> standing
+}
+
+// PersistedExploration stores the chunks a player has explored on every map
+type PersistedExploration struct {
+	PlayerID string                              `json:"playerId"`
+	Maps     map[string]*PersistedMapExploration `json:"maps"` // map name -> explored chunks
+}
+
+// PersistedMapExploration is the explored chunk bitset of one map. Chunk (x, y) is bit
+// y*Columns+x, least significant bit first.
+type PersistedMapExploration struct {
+	Columns int    `json:"columns"`
+	Rows    int    `json:"rows"`
+	Chunks  []byte `json:"chunks"` // base64 in JSON
+}
+
+// PersistedGroupFinderQueue stores the players waiting for dungeon groups, longest waiting first
+type PersistedGroupFinderQueue struct {
+	Entries []*GroupFinderEntry `json:"entries"`
+}
+
+// PersistedResourceNodes stores the respawn times of a map's depleted resource nodes. Superseded
+// by PersistedChunk; only read to migrate the timers of maps saved before.
+type PersistedResourceNodes struct {
+	Map       string        `json:"map"`
+	RespawnAt map[int]int64 `json:"respawnAt"` // object ID -> unix seconds
+}
+
+// PersistedChunk stores the persistent entities inside one chunk of a map (world_chunks.go),
+// keyed "<map>:<x>:<y>"
+type PersistedChunk struct {
+	Map       string              `json:"map"`
+	X         int                 `json:"x"`
+	Y         int                 `json:"y"`
+	Resources map[int]int64       `json:"resources,omitempty"` // resource node object ID -> respawn unix seconds
+	Buildings []PersistedBuilding `json:"buildings,omitempty"` // buildings placed outside housing plots
+}
+
+// empty reports whether the chunk holds nothing, so its storage object can be deleted
+func (c *PersistedChunk) empty() bool {
+	return len(c.Resources) == 0 && len(c.Buildings) == 0
+}
+
+// PersistedBuilding stores a building placed outside housing plots
+type PersistedBuilding struct {
+	Buildable string  `json:"buildable"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+
+	Ownership *EntityOwnership `json:"ownership,omitempty"`
+}
+
+// PersistedControlPoints stores the owners of a map's control points
+type PersistedControlPoints struct {
+	Map    string                        `json:"map"`
+	Points map[int]PersistedControlPoint `json:"points"` // object ID -> owner
+}
+
+// PersistedDoors stores whether a map's doors are open and locked
+type PersistedDoors struct {
+	Map   string                `json:"map"`
+	Doors map[int]PersistedDoor `json:"doors"` // object ID -> state
+}
+
+// PersistedDoor is the saved state of a door
+type PersistedDoor struct {
+	Open   bool `json:"open"`
+	Locked bool `json:"locked"`
+}
+
+// PersistedContainers stores the open and looted containers of a map and their timers
+type PersistedContainers struct {
+	Map        string                     `json:"map"`
+	Containers map[int]PersistedContainer `json:"containers"` // object ID -> state
+}
+
+// PersistedContainer is the saved state of a container (times in unix seconds, -1 = never)
+type PersistedContainer struct {
+	Open     bool             `json:"open"`
+	CloseAt  int64            `json:"closeAt,omitempty"`
+	RefillAt int64            `json:"refillAt,omitempty"`
+	LootedBy map[string]int64 `json:"lootedBy,omitempty"` // player ID -> when they may loot again
+}
+
+// PersistedShops is the stock of a map's vendors as it was saved in one record, before each
+// vendor got its own; read once to carry it over
+type PersistedShops struct {
+	Map     string                  `json:"map"`
+	Vendors map[int]PersistedVendor `json:"vendors"` // object ID -> state
+}
+
+// PersistedVendor is the state of a vendor since its last restock, stored per vendor and shared
+// by every shard of the map
+type PersistedVendor struct {
+	Shop        string                    `json:"shop"`
+	Stock       map[string]int            `json:"stock,omitempty"`   // item ID -> count left
+	Offered     map[string]bool           `json:"offered,omitempty"` // rare item ID -> offered
+	Bought      map[string]map[string]int `json:"bought,omitempty"`  // player ID -> item ID -> count
+	LastRestock int                       `json:"lastRestock"`       // game hour, day*24 + hour
+}
+
+// PersistedCustomWorld is a running custom world in the world directory, keyed by its match ID
+type PersistedCustomWorld struct {
+	ID         string                 `json:"matchId"`
+	Name       string                 `json:"name"`
+	Map        string                 `json:"map"`
+	Owner      string                 `json:"owner"`
+	OwnerName  string                 `json:"ownerName"`
+	Visibility string                 `json:"visibility"` // WorldVisibility*
+	MaxPlayers int                    `json:"maxPlayers"`
+	Rules      map[string]interface{} `json:"rules,omitempty"`  // game rules in place of the world settings' ones
+	Invited    []string               `json:"invite,omitempty"` // players a private world admits
+	CreatedAt  time.Time              `json:"createdAt"`
+}
+
+// PersistedShardClaim records who is starting or started a shard number of a map, so two nodes
+// can't both start it
+type PersistedShardClaim struct {
+	MatchID   string `json:"matchId,omitempty"` // empty while the match is being created
+	ClaimedAt int64  `json:"claimedAt"`         // unix seconds
+}
+
+// PersistedWorldSlots are the custom worlds a player started or is starting, stored per player
+// so world_create can count them with a versioned write
+type PersistedWorldSlots struct {
+	Slots []WorldSlot `json:"slots"`
+}
+
+// WorldSlot is one of a player's maxCustomWorldsPerPlayer custom world slots
+type WorldSlot struct {
+	ID         string `json:"id"`                // reservation ID
+	MatchID    string `json:"matchId,omitempty"` // empty until the world's match started
+	ReservedAt int64  `json:"reservedAt"`        // unix seconds
+}
+
+// PersistedWorldItems stores the item stacks lying on a map
+type PersistedWorldItems struct {
+	Map   string               `json:"map"`
+	Items []PersistedWorldItem `json:"items"`
+}
+
+// PersistedWorldItem is a saved item stack (times in unix seconds, 0 = never)
+type PersistedWorldItem struct {
+	ItemID       string  `json:"itemId"`
+	Count        int     `json:"count"`
+	X            float64 `json:"x"`
+	Y            float64 `json:"y"`
+	DroppedBy    string  `json:"droppedBy,omitempty"`
+	ExpiresAt    int64   `json:"expiresAt,omitempty"`
+	Owner        string  `json:"owner,omitempty"`
+	OwnerUntil   int64   `json:"ownerUntil,omitempty"`
+	PickupRadius float64 `json:"pickupRadius,omitempty"`
+}
+
+// PersistedMechanisms stores whether a map's levers and latched pressure plates are active
+type PersistedMechanisms struct {
+	Map    string       `json:"map"`
+	Active map[int]bool `json:"active"` // object ID -> active
+}
+
+// PersistedRegionVars stores the persistent script variables of a map's regions
+type PersistedRegionVars struct {
+	Map     string                    `json:"map"`
+	Regions map[string]map[string]any `json:"regions"` // region ID -> key -> value
+}
+
+// PersistedWaypoints stores the waypoints a player has activated on every map
+type PersistedWaypoints struct {
+	PlayerID  string                        `json:"playerId"`
+	Activated map[string]*PersistedWaypoint `json:"activated"` // waypoint ID -> waypoint
+}
+
+// PersistedWaypoint is an activated waypoint, with what the player needs to travel there from
+// another map
+type PersistedWaypoint struct {
+	Map      string  `json:"map"`
+	Name     string  `json:"name"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Cost     int64   `json:"cost,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+	CostItem string  `json:"costItem,omitempty"`
+}
+
+// PersistedTravel is a travel to a waypoint on another map; the match of that map places the
+// player at the waypoint when they join
+type PersistedTravel struct {
+	PlayerID string  `json:"playerId"`
+	Map      string  `json:"map"`
+	Waypoint string  `json:"waypoint"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+}
+
+// PersistedReplayIndex describes the replay recorded for a match; its segments are stored under
+// "<matchId>/<slot>"
+type PersistedReplayIndex struct {
+	MatchID       string    `json:"matchId"`
+	Map           string    `json:"map"`
+	TickRate      int       `json:"tickRate"`
+	Slots         int       `json:"slots"`         // size of the segment ring buffer
+	SnapshotTicks int64     `json:"snapshotTicks"` // ticks covered by each segment
+	StartedAt     time.Time `json:"startedAt"`
+}
+
+// AdminLogEntry records a privileged action: who did what, where, and whether it worked
+type AdminLogEntry struct {
+	Time      time.Time `json:"time"`
+	ActorID   string    `json:"actorId"`
+	ActorName string    `json:"actorName"`
+	Role      string    `json:"role"`
+	Action    string    `json:"action"` // e.g. the command name
+	Args      []string  `json:"args,omitempty"`
+	MatchID   string    `json:"matchId,omitempty"`
+	Map       string    `json:"map,omitempty"`
+	OK        bool      `json:"ok"`
+	Result    string    `json:"result,omitempty"`
+}
+
+// PersistedCheatReport aggregates the anti-cheat signals of a player (cheat_reports.go). Score
+// decays from ScoreAt on; Recent keeps the latest signals for review.
+type PersistedCheatReport struct {
+	PlayerID   string         `json:"playerId"`
+	Username   string         `json:"username,omitempty"`
+	Score      float64        `json:"score"`
+	ScoreAt    time.Time      `json:"scoreAt"`
+	Counts     map[string]int `json:"counts,omitempty"` // signal kind -> signals counted
+	Recent     []CheatSignal  `json:"recent,omitempty"`
+	Flagged    bool           `json:"flagged"`
+	FlaggedAt  time.Time      `json:"flaggedAt,omitempty"`
+	Kicks      int            `json:"kicks,omitempty"`
+	LastKickAt time.Time      `json:"lastKickAt,omitempty"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+}
+
+// PersistedWorldReset records the last admin_world_reset of a map. Positions saved before
+// PositionsResetAt are ignored when players join the map.
+type PersistedWorldReset struct {
+	Map              string    `json:"map"`
+	ResetAt          time.Time `json:"resetAt"`
+	PositionsResetAt time.Time `json:"positionsResetAt,omitempty"`
+	Scopes           []string  `json:"scopes"`
+	ActorID          string    `json:"actorId,omitempty"`
+}
+
+// PersistedControlPoint is the saved owner of a control point
+type PersistedControlPoint struct {
+	Owner      string `json:"owner"`
+	OwnerName  string `json:"ownerName"`
+	CapturedAt int64  `json:"capturedAt"` // unix seconds
+	NextReward int64  `json:"nextReward"` // unix seconds
+}
+
+// PersistedPlot stores the claim on a housing plot and the furniture placed on it
+type PersistedPlot struct {
+	Map        string               `json:"map"`
+	PlotID     int                  `json:"plotId"`
+	Owner      string               `json:"owner"`
+	OwnerName  string               `json:"ownerName"`
+	OwnerGuild string               `json:"ownerGuild,omitempty"`
+	Access     string               `json:"access"`
+	Builders   []string             `json:"builders,omitempty"`
+	ClaimedAt  time.Time            `json:"claimedAt"`
+	Furniture  []PersistedFurniture `json:"furniture"`
+	version    string
+}
+
+// PersistedFurniture is a saved buildable on a housing plot
+type PersistedFurniture struct {
+	Buildable string  `json:"buildable"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	PlacedBy  string  `json:"placedBy"`
+
+	Ownership *EntityOwnership `json:"ownership,omitempty"`
+}
+
+// PersistedFarm stores a map's tilled soil and the crops planted in it
+type PersistedFarm struct {
+	Map  string                `json:"map"`
+	Soil map[int]PersistedSoil `json:"soil"` // object ID -> tilled soil
+}
+
+// PersistedSoil is a saved tilled soil object
+type PersistedSoil struct {
+	Seed      string `json:"seed,omitempty"` // planted seed item ("" when empty)
+	PlantedBy string `json:"plantedBy,omitempty"`
+	PlantedAt int64  `json:"plantedAt,omitempty"` // unix seconds
+}
+
+// PersistedWorldClock stores the world's time of day
+type PersistedWorldClock struct {
+	Day     int     `json:"day"`
+	Minutes float64 `json:"minutes"`
+}
+
+// PersistedGuildMembership points a player at their guild
+type PersistedGuildMembership struct {
+	GuildID string `json:"guildId"` // "" after leaving
+}
+
+type WorldSettings struct {
+	MaxPlayers    int                    `json:"maxPlayers"`
+	SpawnPoints   []vector.Vector        `json:"spawnPoints"`
+	WorldBounds   map[string]float64     `json:"worldBounds"`
+	PhysicsConfig map[string]interface{} `json:"physicsConfig"`
+	GameRules     map[string]interface{} `json:"gameRules"`
+	Economy       map[string]float64     `json:"economy,omitempty"` // rates of the currency sinks (economy.go)
+}
+
+// NewDatabaseManager creates a new database manager instance
+func NewDatabaseManager(logger runtime.Logger, nk runtime.NakamaModule) *DatabaseManager {
+	return &DatabaseManager{
+		logger: logger,
+		nk:     nk,
+		store:  storeFor(nk),
+	}
+}
+
+// persistedWorldVersion is the version of the saved world state. Version 1 states (no version)
+// also saved the bodies of players, NPCs and pets, so their bodies aren't restored.
+const persistedWorldVersion = 2
+
+// SaveWorldState persists a world snapshot of a map to the database: the bodies nothing in the
+// match owns. The snapshot never changes, so the save may run off the match loop. A snapshot older
+// than the last one saved is skipped.
+func (dm *DatabaseManager) SaveWorldState(ctx context.Context, mapName string, world *WorldSnapshot) error {
+	dm.worldSave.Lock()
+	defer dm.worldSave.Unlock()
+	if world.Tick < dm.worldTick {
+		return nil
+	}
+
+	worldState := PersistedWorldState{
+		Version:        persistedWorldVersion,
+		LastTick:       world.Tick,
+		GameObjects:    world.Saved,
+		ActivePlayers:  world.ActivePlayers,
+		LastUpdateTime: time.Now(),
+		PhysicsEnabled: true,
+	}
+
+	data, err := json.Marshal(worldState)
+	if err != nil {
+		dm.logger.Error("Failed to marshal world state: %v", err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_WORLD_STATE,
+			Key:             mapName,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_READ,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save world state of %s: %v", mapName, err)
+		return err
+	}
+
+	dm.worldTick = world.Tick
+	dm.logger.Info("World state saved successfully at tick %d", world.Tick)
+	return nil
+}
+
+// SaveWorldStateAsync saves a world snapshot off the match loop; WaitWorldSaves waits for it
+func (dm *DatabaseManager) SaveWorldStateAsync(ctx context.Context, mapName string, world *WorldSnapshot) {
+	if world == nil {
+		return
+	}
+	dm.worldSaves.Add(1)
+	go func() {
+		defer dm.worldSaves.Done()
+		// SaveWorldState logs its own failures; the next periodic save retries
+		_ = dm.SaveWorldState(ctx, mapName, world)
+	}()
+}
+
+// WaitWorldSaves waits for the world state saves running off the match loop
+func (dm *DatabaseManager) WaitWorldSaves() {
+	dm.worldSaves.Wait()
+}
+
+// LoadWorldState retrieves the persisted world state of a map from the database. The default map
+// falls back to the single record kept before world states were saved per map.
+func (dm *DatabaseManager) LoadWorldState(ctx context.Context, mapName string) (*PersistedWorldState, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_WORLD_STATE,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+	if mapName == defaultWorldMap {
+		reads = append(reads, &runtime.StorageRead{Collection: COLLECTION_WORLD_STATE, Key: KEY_GLOBAL_WORLD_STATE, UserID: ""})
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read world state: %v", err)
+		return nil, err
+	}
+
+	var object *api.StorageObject
+	for _, obj := range objects {
+		if object == nil || obj.GetKey() == mapName {
+			object = obj
+		}
+	}
+	if object == nil {
+		dm.logger.Info("No existing world state found, creating new world")
+		return dm.createDefaultWorldState(), nil
+	}
+
+	var worldState PersistedWorldState
+	if err := json.Unmarshal([]byte(object.GetValue()), &worldState); err != nil {
+		dm.logger.Error("Failed to unmarshal world state: %v", err)
+		return nil, err
+	}
+
+	dm.logger.Info("World state loaded successfully from tick %d", worldState.LastTick)
+	return &worldState, nil
+}
+
+// SavePlayerData persists individual player data, with the map and region name of the position
+func (dm *DatabaseManager) SavePlayerData(ctx context.Context, presence runtime.Presence, position vector.Vector, velocity vector.Vector, mapName, region string) error {
+	playerData := PersistedPlayerData{
+		PlayerID:      presence.GetUserId(),
+		Username:      presence.GetUsername(),
+		Position:      position,
+		Velocity:      velocity,
+		Health:        100.0,
+		Level:         1,
+		Map:           mapName,
+		Region:        region,
+		LastLoginTime: time.Now(),
+		PlayTime:      time.Hour, // This would be calculated properly
+		Inventory:     []string{},
+		Achievements:  []string{},
+	}
+
+	data, err := json.Marshal(playerData)
+	if err != nil {
+		dm.logger.Error("Failed to marshal player data: %v", err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_PLAYER_DATA,
+			Key:             presence.GetUserId(),
+			UserID:          presence.GetUserId(),
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_OWNER_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save player data for %s: %v", presence.GetUsername(), err)
+		return err
+	}
+
+	// dm.logger.Debug("Player data saved for %s", presence.GetUsername())
+	return nil
+}
+
+// LoadPlayerData retrieves individual player data, or a new profile for players without any
+func (dm *DatabaseManager) LoadPlayerData(ctx context.Context, userID string) (*PersistedPlayerData, error) {
+	playerData, err := dm.FindPlayerData(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if playerData == nil {
+		dm.logger.Info("No existing player data found for %s, creating new profile", userID)
+		return dm.createDefaultPlayerData(userID), nil
+	}
+
+	// dm.logger.Debug("Player data loaded for %s", playerData.Username)
+	return playerData, nil
+}
+
+// FindPlayerData retrieves individual player data (nil if the player never left a match)
+func (dm *DatabaseManager) FindPlayerData(ctx context.Context, userID string) (*PersistedPlayerData, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_PLAYER_DATA,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read player data for %s: %v", userID, err)
+		return nil, err
+	}
+
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	var playerData PersistedPlayerData
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &playerData); err != nil {
+		dm.logger.Error("Failed to unmarshal player data for %s: %v", userID, err)
+		return nil, err
+	}
+	return &playerData, nil
+}
+
+// SavePlayerInteractions persists a player's interaction cooldowns and once-only flags
+func (dm *DatabaseManager) SavePlayerInteractions(ctx context.Context, interactions *PersistedInteractions) error {
+	data, err := json.Marshal(interactions)
+	if err != nil {
+		dm.logger.Error("Failed to marshal interactions for %s: %v", interactions.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_INTERACTIONS,
+			Key:             interactions.PlayerID,
+			UserID:          interactions.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save interactions for %s: %v", interactions.PlayerID, err)
+		return err
+	}
+
+	return nil
+}
+
+// LoadPlayerInteractions retrieves a player's interaction cooldowns and once-only flags
+func (dm *DatabaseManager) LoadPlayerInteractions(ctx context.Context, userID string) (*PersistedInteractions, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_INTERACTIONS,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read interactions for %s: %v", userID, err)
+		return nil, err
+	}
+
+	interactions := &PersistedInteractions{
+		PlayerID:  userID,
+		Cooldowns: map[string]int64{},
+		Done:      map[string]int64{},
+	}
+	if len(objects) == 0 {
+		return interactions, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), interactions); err != nil {
+		dm.logger.Error("Failed to unmarshal interactions for %s: %v", userID, err)
+		return nil, err
+	}
+	if interactions.Cooldowns == nil {
+		interactions.Cooldowns = map[string]int64{}
+	}
+	if interactions.Done == nil {
+		interactions.Done = map[string]int64{}
+	}
+
+	return interactions, nil
+}
+
+// SavePlayerInventory persists a player's inventory
+func (dm *DatabaseManager) SavePlayerInventory(ctx context.Context, inventory *PersistedInventory, with ...*runtime.StorageWrite) error {
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		dm.logger.Error("Failed to marshal inventory for %s: %v", inventory.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_INVENTORY,
+			Key:             inventory.PlayerID,
+			UserID:          inventory.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if len(with) > 0 {
+		// The records the items came from or went to change in the same commit
+		err = dm.store.MultiUpdate(ctx, append(writes, with...), nil, nil)
+	} else {
+		_, err = dm.store.Write(ctx, writes)
+	}
+	if err != nil {
+		dm.logger.Error("Failed to save inventory for %s: %v", inventory.PlayerID, err)
+		return err
+	}
+
+	return nil
+}
+
+// LoadPlayerInventory retrieves a player's inventory (empty if none was saved yet)
+func (dm *DatabaseManager) LoadPlayerInventory(ctx context.Context, userID string) (*PersistedInventory, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_INVENTORY,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read inventory for %s: %v", userID, err)
+		return nil, err
+	}
+
+	inventory := &PersistedInventory{
+		PlayerID: userID,
+		Items:    map[string]int{},
+	}
+	if len(objects) == 0 {
+		return inventory, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), inventory); err != nil {
+		dm.logger.Error("Failed to unmarshal inventory for %s: %v", userID, err)
+		return nil, err
+	}
+	if inventory.Items == nil {
+		inventory.Items = map[string]int{}
+	}
+
+	return inventory, nil
+}
+
+// RecordPlayerDeath increments a player's death count and remembers what killed them
+func (dm *DatabaseManager) RecordPlayerDeath(ctx context.Context, playerID string, killer *DamageSource) error {
+	stats, err := dm.LoadPlayerStats(ctx, playerID)
+	if err != nil {
+		return err
+	}
+	stats.Deaths++
+	stats.LastDeathAt = time.Now()
+	stats.LastKiller = killer
+	return dm.savePlayerStats(ctx, stats)
+}
+
+// RecordPvPKill increments a player's kill count and adjusts their karma by delta (capped at
+// pvpMaxKarma). It returns the new karma.
+func (dm *DatabaseManager) RecordPvPKill(ctx context.Context, playerID string, delta int) (int, error) {
+	stats, err := dm.LoadPlayerStats(ctx, playerID)
+	if err != nil {
+		return 0, err
+	}
+	stats.Kills++
+	stats.Karma += delta
+	if stats.Karma > pvpMaxKarma {
+		stats.Karma = pvpMaxKarma
+	}
+	if err := dm.savePlayerStats(ctx, stats); err != nil {
+		return 0, err
+	}
+	return stats.Karma, nil
+}
+
+// RecordFishing adds a finished fishing attempt to the player's stats. landed is true when the
+// player reeled in during the bite window; stacks are the items granted.
+func (dm *DatabaseManager) RecordFishing(ctx context.Context, playerID string, landed bool, stacks []LootStack) error {
+	stats, err := dm.LoadPlayerStats(ctx, playerID)
+	if err != nil {
+		return err
+	}
+	if !landed {
+		stats.FishLost++
+		return dm.savePlayerStats(ctx, stats)
+	}
+	stats.FishCaught++
+	if len(stacks) > 0 && stats.Catches == nil {
+		stats.Catches = make(map[string]int)
+	}
+	for _, stack := range stacks {
+		stats.Catches[stack.ItemID] += stack.Count
+	}
+	return dm.savePlayerStats(ctx, stats)
+}
+
+// RecordDuelResult adds a duel win and a loss to the players' stats and submits the win to the
+// duel leaderboard. It returns the winner's total wins.
+func (dm *DatabaseManager) RecordDuelResult(ctx context.Context, winnerID, loserID, winnerName string) (int, error) {
+	winner, err := dm.LoadPlayerStats(ctx, winnerID)
+	if err != nil {
+		return 0, err
+	}
+	winner.DuelWins++
+	if err := dm.savePlayerStats(ctx, winner); err != nil {
+		return 0, err
+	}
+
+	loser, err := dm.LoadPlayerStats(ctx, loserID)
+	if err != nil {
+		return winner.DuelWins, err
+	}
+	loser.DuelLosses++
+	if err := dm.savePlayerStats(ctx, loser); err != nil {
+		return winner.DuelWins, err
+	}
+
+	if _, err := dm.nk.LeaderboardRecordWrite(ctx, duelLeaderboardID, winnerID, winnerName, 1, 0, nil, nil); err != nil {
+		dm.logger.Error("Failed to submit duel win of %s: %v", winnerID, err)
+		return winner.DuelWins, err
+	}
+	return winner.DuelWins, nil
+}
+
+// savePlayerStats writes a player's combat statistics
+func (dm *DatabaseManager) savePlayerStats(ctx context.Context, stats *PersistedPlayerStats) error {
+	playerID := stats.PlayerID
+	data, err := json.Marshal(stats)
+	if err != nil {
+		dm.logger.Error("Failed to marshal stats for %s: %v", playerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_PLAYER_STATS,
+			Key:             playerID,
+			UserID:          playerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save stats for %s: %v", playerID, err)
+		return err
+	}
+
+	return nil
+}
+
+// LoadPlayerStats retrieves a player's combat statistics (zeroed if none were saved yet)
+func (dm *DatabaseManager) LoadPlayerStats(ctx context.Context, userID string) (*PersistedPlayerStats, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_PLAYER_STATS,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read stats for %s: %v", userID, err)
+		return nil, err
+	}
+
+	stats := &PersistedPlayerStats{PlayerID: userID}
+	if len(objects) == 0 {
+		return stats, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), stats); err != nil {
+		dm.logger.Error("Failed to unmarshal stats for %s: %v", userID, err)
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// UpdateWallet applies a currency changeset to a player's Nakama wallet and records it in the wallet ledger
+func (dm *DatabaseManager) UpdateWallet(ctx context.Context, userID string, changeset map[string]int64, metadata map[string]interface{}) error {
+	if _, _, err := dm.nk.WalletUpdate(ctx, userID, changeset, metadata, true); err != nil {
+		dm.logger.Error("Failed to update wallet for %s: %v", userID, err)
+		return err
+	}
+	economy.Record(walletSource(metadata), changeset)
+	return nil
+}
+
+// SavePlayerEffects persists a player's long-running status effects, buffs and cooldowns
+func (dm *DatabaseManager) SavePlayerEffects(ctx context.Context, effects *PersistedEffects) error {
+	data, err := json.Marshal(effects)
+	if err != nil {
+		dm.logger.Error("Failed to marshal effects for %s: %v", effects.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_PLAYER_EFFECTS,
+			Key:             effects.PlayerID,
+			UserID:          effects.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save effects for %s: %v", effects.PlayerID, err)
+		return err
+	}
+
+	return nil
+}
+
+// LoadPlayerEffects retrieves a player's saved status effects, buffs and cooldowns (none if
+// nothing was saved)
+func (dm *DatabaseManager) LoadPlayerEffects(ctx context.Context, userID string) (*PersistedEffects, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_PLAYER_EFFECTS,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read effects for %s: %v", userID, err)
+		return nil, err
+	}
+
+	effects := &PersistedEffects{PlayerID: userID}
+	if len(objects) == 0 {
+		return effects, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), effects); err != nil {
+		dm.logger.Error("Failed to unmarshal effects for %s: %v", userID, err)
+		return nil, err
+	}
+
+	return effects, nil
+}
+
+// SavePrivacy persists a player's privacy settings
+func (dm *DatabaseManager) SavePrivacy(ctx context.Context, userID string, privacy *PersistedPrivacy) error {
+	data, err := json.Marshal(privacy)
+	if err != nil {
+		dm.logger.Error("Failed to marshal privacy settings for %s: %v", userID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_PRIVACY,
+			Key:             userID,
+			UserID:          userID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save privacy settings for %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadPrivacy retrieves a player's privacy settings (the defaults if they never set any)
+func (dm *DatabaseManager) LoadPrivacy(ctx context.Context, userID string) (*PersistedPrivacy, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_PRIVACY,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read privacy settings for %s: %v", userID, err)
+		return nil, err
+	}
+	privacy := &PersistedPrivacy{Location: defaultLocationPrivacy, LastSeen: defaultLastSeenPrivacy}
+	if len(objects) == 0 {
+		return privacy, nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), privacy); err != nil {
+		dm.logger.Error("Failed to unmarshal privacy settings for %s: %v", userID, err)
+		return nil, err
+	}
+	return privacy, nil
+}
+
+// SavePreferences persists a player's preferences. version is the one LoadPreferencesVersion
+// returned, so a change made in between isn't overwritten.
+func (dm *DatabaseManager) SavePreferences(ctx context.Context, userID string, prefs *PersistedPreferences, version string) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		dm.logger.Error("Failed to marshal preferences for %s: %v", userID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_PREFERENCES,
+			Key:             userID,
+			UserID:          userID,
+			Value:           string(data),
+			Version:         version,
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save preferences for %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadPreferences retrieves a player's preferences (none if they never saved any)
+func (dm *DatabaseManager) LoadPreferences(ctx context.Context, userID string) (*PersistedPreferences, error) {
+	prefs, _, err := dm.LoadPreferencesVersion(ctx, userID)
+	return prefs, err
+}
+
+// LoadPreferencesVersion retrieves a player's preferences and their storage version ("*" if they
+// never saved any), which SavePreferences needs to detect concurrent changes
+func (dm *DatabaseManager) LoadPreferencesVersion(ctx context.Context, userID string) (*PersistedPreferences, string, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_PREFERENCES,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read preferences for %s: %v", userID, err)
+		return nil, "", err
+	}
+	prefs := &PersistedPreferences{Values: make(map[string]json.RawMessage)}
+	if len(objects) == 0 {
+		return prefs, "*", nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), prefs); err != nil {
+		dm.logger.Error("Failed to unmarshal preferences for %s: %v", userID, err)
+		return nil, "", err
+	}
+	if prefs.Values == nil {
+		prefs.Values = make(map[string]json.RawMessage)
+	}
+	return prefs, objects[0].GetVersion(), nil
+}
+
+// SaveSurvival persists a player's survival meters
+func (dm *DatabaseManager) SaveSurvival(ctx context.Context, survival *PersistedSurvival) error {
+	data, err := json.Marshal(survival)
+	if err != nil {
+		dm.logger.Error("Failed to marshal survival meters for %s: %v", survival.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_SURVIVAL,
+			Key:             survival.PlayerID,
+			UserID:          survival.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save survival meters for %s: %v", survival.PlayerID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadSurvival retrieves a player's saved survival meters (nil if nothing was saved)
+func (dm *DatabaseManager) LoadSurvival(ctx context.Context, userID string) (*PersistedSurvival, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_SURVIVAL,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read survival meters for %s: %v", userID, err)
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	survival := &PersistedSurvival{}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), survival); err != nil {
+		dm.logger.Error("Failed to unmarshal survival meters for %s: %v", userID, err)
+		return nil, err
+	}
+	return survival, nil
+}
+
+// LoadLoginRewards reads a player's login streak with its storage version ("*" when the player
+// never claimed, so the first write only creates)
+func (dm *DatabaseManager) LoadLoginRewards(ctx context.Context, userID string) (*PersistedLoginRewards, string, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_LOGIN_REWARDS,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read login rewards for %s: %v", userID, err)
+		return nil, "", err
+	}
+
+	record := &PersistedLoginRewards{PlayerID: userID}
+	if len(objects) == 0 {
+		return record, "*", nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), record); err != nil {
+		dm.logger.Error("Failed to unmarshal login rewards for %s: %v", userID, err)
+		return nil, "", err
+	}
+	return record, objects[0].GetVersion(), nil
+}
+
+// SaveLoginRewards writes a player's login streak if it is still at version
+func (dm *DatabaseManager) SaveLoginRewards(ctx context.Context, record *PersistedLoginRewards, version string) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		dm.logger.Error("Failed to marshal login rewards for %s: %v", record.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_LOGIN_REWARDS,
+			Key:             record.PlayerID,
+			UserID:          record.PlayerID,
+			Value:           string(data),
+			Version:         version,
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitAuction applies an auction house change in one transaction: listing and claim writes,
+// listing deletes and wallet updates either all happen or none does. Writes and deletes carry
+// versions, so a listing that changed since it was read fails the whole change.
+func (dm *DatabaseManager) CommitAuction(ctx context.Context, writes []*runtime.StorageWrite, deletes []*runtime.StorageDelete, wallets []*runtime.WalletUpdate) error {
+	if err := dm.store.MultiUpdate(ctx, writes, deletes, wallets); err != nil {
+		dm.logger.Warn("Auction update failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// auctionWrite returns the write of a listing if it is still at version ("*" only creates)
+func auctionWrite(listing *PersistedAuction, version string) *runtime.StorageWrite {
+	data, _ := json.Marshal(listing)
+	return &runtime.StorageWrite{
+		Collection:      COLLECTION_AUCTIONS,
+		Key:             listing.ID,
+		UserID:          "",
+		Value:           string(data),
+		Version:         version,
+		PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+}
+
+// auctionDelete returns the delete of a listing at the version it was read at
+func auctionDelete(listing *PersistedAuction) *runtime.StorageDelete {
+	return &runtime.StorageDelete{Collection: COLLECTION_AUCTIONS, Key: listing.ID, UserID: "", Version: listing.version}
+}
+
+// auctionClaimWrite returns the creation of a player's claim on a listing
+func auctionClaimWrite(playerID string, claim *PersistedAuctionClaim) *runtime.StorageWrite {
+	data, _ := json.Marshal(claim)
+	return &runtime.StorageWrite{
+		Collection:      COLLECTION_AUCTION_CLAIMS,
+		Key:             claim.ListingID,
+		UserID:          playerID,
+		Value:           string(data),
+		Version:         "*",
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+}
+
+// LoadAuction retrieves a listing with its version (nil if it doesn't exist)
+func (dm *DatabaseManager) LoadAuction(ctx context.Context, listingID string) (*PersistedAuction, error) {
+	objects, err := dm.store.Read(ctx, []*runtime.StorageRead{{Collection: COLLECTION_AUCTIONS, Key: listingID, UserID: ""}})
+	if err != nil {
+		dm.logger.Error("Failed to read auction %s: %v", listingID, err)
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	listing := &PersistedAuction{}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), listing); err != nil {
+		dm.logger.Error("Failed to unmarshal auction %s: %v", listingID, err)
+		return nil, err
+	}
+	listing.version = objects[0].GetVersion()
+	return listing, nil
+}
+
+// ListAuctions retrieves up to auctionScanLimit listings that match filter (all of them without a
+// filter field), with their versions
+func (dm *DatabaseManager) ListAuctions(ctx context.Context, filter StoreFilter) ([]*PersistedAuction, error) {
+	var listings []*PersistedAuction
+	cursor := ""
+	for len(listings) < auctionScanLimit {
+		var objects []*api.StorageObject
+		var next string
+		var err error
+		if filter.Field != "" {
+			objects, next, err = dm.store.Query(ctx, COLLECTION_AUCTIONS, filter, auctionPageSize, cursor)
+		} else {
+			objects, next, err = dm.store.List(ctx, "", COLLECTION_AUCTIONS, auctionPageSize, cursor)
+		}
+		if err != nil {
+			dm.logger.Error("Failed to list auctions: %v", err)
+			return nil, err
+		}
+		for _, obj := range objects {
+			listing := &PersistedAuction{}
+			if err := json.Unmarshal([]byte(obj.GetValue()), listing); err != nil {
+				dm.logger.Warn("Skipping malformed auction %s: %v", obj.GetKey(), err)
+				continue
+			}
+			listing.version = obj.GetVersion()
+			listings = append(listings, listing)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	return listings, nil
+}
+
+// ListAuctionClaims retrieves the claims waiting for a player, with their versions
+func (dm *DatabaseManager) ListAuctionClaims(ctx context.Context, userID string) ([]*PersistedAuctionClaim, error) {
+	objects, _, err := dm.store.List(ctx, userID, COLLECTION_AUCTION_CLAIMS, auctionPageSize, "")
+	if err != nil {
+		dm.logger.Error("Failed to list auction claims for %s: %v", userID, err)
+		return nil, err
+	}
+	claims := make([]*PersistedAuctionClaim, 0, len(objects))
+	for _, obj := range objects {
+		claim := &PersistedAuctionClaim{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), claim); err != nil {
+			dm.logger.Warn("Skipping malformed auction claim %s of %s: %v", obj.GetKey(), userID, err)
+			continue
+		}
+		claim.version = obj.GetVersion()
+		claims = append(claims, claim)
+	}
+	return claims, nil
+}
+
+// DeleteAuctionClaim removes a claim if it is still at the version it was read at
+func (dm *DatabaseManager) DeleteAuctionClaim(ctx context.Context, userID string, claim *PersistedAuctionClaim) error {
+	deletes := []*runtime.StorageDelete{{Collection: COLLECTION_AUCTION_CLAIMS, Key: claim.ListingID, UserID: userID, Version: claim.version}}
+	return dm.store.Delete(ctx, deletes)
+}
+
+// CreateRewardClaim stores a reward claim for a player; a claim with the same key isn't replaced
+func (dm *DatabaseManager) CreateRewardClaim(ctx context.Context, playerID string, claim *PersistedRewardClaim) error {
+	data, err := json.Marshal(claim)
+	if err != nil {
+		dm.logger.Error("Failed to marshal reward claim %s of %s: %v", claim.Key, playerID, err)
+		return err
+	}
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_REWARD_CLAIMS,
+			Key:             claim.Key,
+			UserID:          playerID,
+			Value:           string(data),
+			Version:         "*",
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save reward claim %s of %s: %v", claim.Key, playerID, err)
+		return err
+	}
+	return nil
+}
+
+// ListRewardClaims retrieves the reward claims waiting for a player, with their versions
+func (dm *DatabaseManager) ListRewardClaims(ctx context.Context, userID string) ([]*PersistedRewardClaim, error) {
+	objects, _, err := dm.store.List(ctx, userID, COLLECTION_REWARD_CLAIMS, auctionPageSize, "")
+	if err != nil {
+		dm.logger.Error("Failed to list reward claims for %s: %v", userID, err)
+		return nil, err
+	}
+	claims := make([]*PersistedRewardClaim, 0, len(objects))
+	for _, obj := range objects {
+		claim := &PersistedRewardClaim{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), claim); err != nil {
+			dm.logger.Warn("Skipping malformed reward claim %s of %s: %v", obj.GetKey(), userID, err)
+			continue
+		}
+		claim.Key = obj.GetKey()
+		claim.version = obj.GetVersion()
+		claims = append(claims, claim)
+	}
+	return claims, nil
+}
+
+// DeleteRewardClaim removes a reward claim if it is still at the version it was read at
+func (dm *DatabaseManager) DeleteRewardClaim(ctx context.Context, userID string, claim *PersistedRewardClaim) error {
+	deletes := []*runtime.StorageDelete{{Collection: COLLECTION_REWARD_CLAIMS, Key: claim.Key, UserID: userID, Version: claim.version}}
+	return dm.store.Delete(ctx, deletes)
+}
+
+// SavePets persists a player's pets
+func (dm *DatabaseManager) SavePets(ctx context.Context, pets *PersistedPets) error {
+	data, err := json.Marshal(pets)
+	if err != nil {
+		dm.logger.Error("Failed to marshal pets for %s: %v", pets.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_PETS,
+			Key:             pets.PlayerID,
+			UserID:          pets.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save pets for %s: %v", pets.PlayerID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadPets retrieves a player's pets (none if the player never adopted one)
+func (dm *DatabaseManager) LoadPets(ctx context.Context, userID string) (*PersistedPets, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_PETS,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read pets for %s: %v", userID, err)
+		return nil, err
+	}
+
+	pets := &PersistedPets{PlayerID: userID}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].GetValue()), pets); err != nil {
+			dm.logger.Error("Failed to unmarshal pets for %s: %v", userID, err)
+			return nil, err
+		}
+	}
+	if pets.Pets == nil {
+		pets.Pets = make(map[string]*PersistedPet)
+	}
+	return pets, nil
+}
+
+// SaveQuestLog persists a player's quest log
+func (dm *DatabaseManager) SaveQuestLog(ctx context.Context, log *PersistedQuestLog) error {
+	data, err := json.Marshal(log)
+	if err != nil {
+		dm.logger.Error("Failed to marshal quest log for %s: %v", log.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_QUESTS,
+			Key:             log.PlayerID,
+			UserID:          log.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save quest log for %s: %v", log.PlayerID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadQuestLog retrieves a player's quest log (empty if they never accepted a quest)
+func (dm *DatabaseManager) LoadQuestLog(ctx context.Context, userID string) (*PersistedQuestLog, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_QUESTS,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read quest log for %s: %v", userID, err)
+		return nil, err
+	}
+
+	log := &PersistedQuestLog{PlayerID: userID}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].GetValue()), log); err != nil {
+			dm.logger.Error("Failed to unmarshal quest log for %s: %v", userID, err)
+			return nil, err
+		}
+	}
+	if log.Active == nil {
+		log.Active = make(map[string]*PersistedQuest)
+	}
+	if log.Completed == nil {
+		log.Completed = make(map[string]int)
+	}
+	return log, nil
+}
+
+// SaveReputation persists a player's faction standings
+func (dm *DatabaseManager) SaveReputation(ctx context.Context, reputation *PersistedReputation) error {
+	data, err := json.Marshal(reputation)
+	if err != nil {
+		dm.logger.Error("Failed to marshal reputation for %s: %v", reputation.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_REPUTATION,
+			Key:             reputation.PlayerID,
+			UserID:          reputation.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save reputation for %s: %v", reputation.PlayerID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadReputation retrieves a player's faction standings (none if they never changed)
+func (dm *DatabaseManager) LoadReputation(ctx context.Context, userID string) (*PersistedReputation, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_REPUTATION,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read reputation for %s: %v", userID, err)
+		return nil, err
+	}
+
+	reputation := &PersistedReputation{PlayerID: userID}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].GetValue()), reputation); err != nil {
+			dm.logger.Error("Failed to unmarshal reputation for %s: %v", userID, err)
+			return nil, err
+		}
+	}
+	if reputation.Standings == nil {
+		reputation.Standings = make(map[string]int)
+	}
+	return reputation, nil
+}
+
+// SaveExploration persists the chunks a player has explored
+func (dm *DatabaseManager) SaveExploration(ctx context.Context, exploration *PersistedExploration) error {
+	data, err := json.Marshal(exploration)
+	if err != nil {
+		dm.logger.Error("Failed to marshal exploration for %s: %v", exploration.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_EXPLORATION,
+			Key:             exploration.PlayerID,
+			UserID:          exploration.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save exploration for %s: %v", exploration.PlayerID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadExploration retrieves the chunks a player has explored (none for new players)
+func (dm *DatabaseManager) LoadExploration(ctx context.Context, userID string) (*PersistedExploration, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_EXPLORATION,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read exploration for %s: %v", userID, err)
+		return nil, err
+	}
+
+	exploration := &PersistedExploration{PlayerID: userID}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].GetValue()), exploration); err != nil {
+			dm.logger.Error("Failed to unmarshal exploration for %s: %v", userID, err)
+			return nil, err
+		}
+	}
+	if exploration.Maps == nil {
+		exploration.Maps = make(map[string]*PersistedMapExploration)
+	}
+	return exploration, nil
+}
+
+// LoadGroupFinderQueue retrieves the group finder queue and its storage version, which
+// SaveGroupFinderQueue needs to detect concurrent changes
+func (dm *DatabaseManager) LoadGroupFinderQueue(ctx context.Context) (*PersistedGroupFinderQueue, string, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_GROUP_FINDER,
+			Key:        groupFinderQueueKey,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read group finder queue: %v", err)
+		return nil, "", err
+	}
+
+	queue := &PersistedGroupFinderQueue{}
+	if len(objects) == 0 {
+		// "*" only creates, so two first writers can't both succeed
+		return queue, "*", nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), queue); err != nil {
+		dm.logger.Error("Failed to unmarshal group finder queue: %v", err)
+		return nil, "", err
+	}
+	return queue, objects[0].GetVersion(), nil
+}
+
+// SaveGroupFinderQueue writes the group finder queue if it is still at version
+func (dm *DatabaseManager) SaveGroupFinderQueue(ctx context.Context, queue *PersistedGroupFinderQueue, version string) error {
+	data, err := json.Marshal(queue)
+	if err != nil {
+		dm.logger.Error("Failed to marshal group finder queue: %v", err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_GROUP_FINDER,
+			Key:             groupFinderQueueKey,
+			UserID:          "",
+			Value:           string(data),
+			Version:         version,
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Warn("Failed to save group finder queue: %v", err)
+		return err
+	}
+	return nil
+}
+
+// LoadResourceNodes retrieves the respawn timers a map saved before they moved into its chunks
+// (none if nothing was saved)
+func (dm *DatabaseManager) LoadResourceNodes(ctx context.Context, mapName string) (*PersistedResourceNodes, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_RESOURCE_NODES,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read resource nodes for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	nodes := &PersistedResourceNodes{Map: mapName}
+	if len(objects) == 0 {
+		return nodes, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), nodes); err != nil {
+		dm.logger.Error("Failed to unmarshal resource nodes for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// DeleteResourceNodes deletes the respawn timers a map saved before they moved into its chunks
+func (dm *DatabaseManager) DeleteResourceNodes(ctx context.Context, mapName string) error {
+	deletes := []*runtime.StorageDelete{{Collection: COLLECTION_RESOURCE_NODES, Key: mapName, UserID: ""}}
+	if err := dm.store.Delete(ctx, deletes); err != nil {
+		dm.logger.Error("Failed to delete resource nodes for %s: %v", mapName, err)
+		return err
+	}
+	return nil
+}
+
+// LoadChunks reads chunks of a map in one batch. Chunks nothing was saved in are left out.
+func (dm *DatabaseManager) LoadChunks(ctx context.Context, mapName string, coords []ChunkCoord) (map[ChunkCoord]*PersistedChunk, error) {
+	reads := make([]*runtime.StorageRead, 0, len(coords))
+	for _, c := range coords {
+		reads = append(reads, &runtime.StorageRead{Collection: COLLECTION_WORLD_CHUNKS, Key: chunkStorageKey(mapName, c), UserID: ""})
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read %d chunks of %s: %v", len(coords), mapName, err)
+		return nil, err
+	}
+
+	chunks := make(map[ChunkCoord]*PersistedChunk, len(objects))
+	for _, obj := range objects {
+		c, ok := parseChunkKey(mapName, obj.GetKey())
+		if !ok {
+			continue
+		}
+		chunk := &PersistedChunk{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), chunk); err != nil {
+			dm.logger.Warn("Skipping malformed chunk %s: %v", obj.GetKey(), err)
+			continue
+		}
+		chunks[c] = chunk
+	}
+	return chunks, nil
+}
+
+// SaveChunks writes chunks of a map in one batch and deletes those left empty
+func (dm *DatabaseManager) SaveChunks(ctx context.Context, mapName string, chunks []*PersistedChunk) error {
+	var writes []*runtime.StorageWrite
+	var deletes []*runtime.StorageDelete
+	for _, chunk := range chunks {
+		key := chunkStorageKey(mapName, ChunkCoord{X: chunk.X, Y: chunk.Y})
+		if chunk.empty() {
+			deletes = append(deletes, &runtime.StorageDelete{Collection: COLLECTION_WORLD_CHUNKS, Key: key, UserID: ""})
+			continue
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			dm.logger.Error("Failed to marshal chunk %s: %v", key, err)
+			return err
+		}
+		writes = append(writes, &runtime.StorageWrite{
+			Collection:      COLLECTION_WORLD_CHUNKS,
+			Key:             key,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		})
+	}
+
+	if len(writes) > 0 {
+		if _, err := dm.store.Write(ctx, writes); err != nil {
+			dm.logger.Error("Failed to save %d chunks of %s: %v", len(writes), mapName, err)
+			return err
+		}
+	}
+	if len(deletes) > 0 {
+		if err := dm.store.Delete(ctx, deletes); err != nil {
+			dm.logger.Error("Failed to delete %d empty chunks of %s: %v", len(deletes), mapName, err)
+			return err
+		}
+	}
+
+	dm.logger.Debug("Saved %d chunks of %s (%d emptied)", len(writes), mapName, len(deletes))
+	return nil
+}
+
+// listChunkKeys returns the storage keys of every saved chunk of a map
+func (dm *DatabaseManager) listChunkKeys(ctx context.Context, mapName string) ([]string, error) {
+	return dm.listKeys(ctx, COLLECTION_WORLD_CHUNKS, func(key string) bool {
+		_, ok := parseChunkKey(mapName, key)
+		return ok
+	})
+}
+
+// listKeys returns the keys of a collection's global records that keep accepts
+func (dm *DatabaseManager) listKeys(ctx context.Context, collection string, keep func(key string) bool) ([]string, error) {
+	var keys []string
+	cursor := ""
+	for {
+		objects, next, err := dm.store.List(ctx, "", collection, 100, cursor)
+		if err != nil {
+			dm.logger.Error("Failed to list %s: %v", collection, err)
+			return nil, err
+		}
+		for _, obj := range objects {
+			if keep(obj.GetKey()) {
+				keys = append(keys, obj.GetKey())
+			}
+		}
+		if next == "" {
+			return keys, nil
+		}
+		cursor = next
+	}
+}
+
+// SaveControlPoints persists the owners of a map's control points
+func (dm *DatabaseManager) SaveControlPoints(ctx context.Context, points *PersistedControlPoints) error {
+	data, err := json.Marshal(points)
+	if err != nil {
+		dm.logger.Error("Failed to marshal control points for %s: %v", points.Map, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_CONTROL_POINTS,
+			Key:             points.Map,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save control points for %s: %v", points.Map, err)
+		return err
+	}
+
+	dm.logger.Debug("Control points for %s saved (%d owned)", points.Map, len(points.Points))
+	return nil
+}
+
+// SaveDoors persists whether a map's doors are open and locked
+func (dm *DatabaseManager) SaveDoors(ctx context.Context, doors *PersistedDoors) error {
+	data, err := json.Marshal(doors)
+	if err != nil {
+		dm.logger.Error("Failed to marshal doors for %s: %v", doors.Map, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_DOORS,
+			Key:             doors.Map,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save doors for %s: %v", doors.Map, err)
+		return err
+	}
+
+	dm.logger.Debug("Doors for %s saved (%d doors)", doors.Map, len(doors.Doors))
+	return nil
+}
+
+// LoadDoors retrieves the door states saved for a map (none if nothing was saved)
+func (dm *DatabaseManager) LoadDoors(ctx context.Context, mapName string) (*PersistedDoors, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_DOORS,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read doors for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	doors := &PersistedDoors{Map: mapName, Doors: map[int]PersistedDoor{}}
+	if len(objects) == 0 {
+		return doors, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), doors); err != nil {
+		dm.logger.Error("Failed to unmarshal doors for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	return doors, nil
+}
+
+// SaveContainers persists the open and looted containers of a map
+func (dm *DatabaseManager) SaveContainers(ctx context.Context, containers *PersistedContainers) error {
+	data, err := json.Marshal(containers)
+	if err != nil {
+		dm.logger.Error("Failed to marshal containers for %s: %v", containers.Map, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_CONTAINERS,
+			Key:             containers.Map,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save containers for %s: %v", containers.Map, err)
+		return err
+	}
+
+	dm.logger.Debug("Containers for %s saved (%d looted)", containers.Map, len(containers.Containers))
+	return nil
+}
+
+// LoadContainers retrieves the container states saved for a map (none if nothing was saved)
+func (dm *DatabaseManager) LoadContainers(ctx context.Context, mapName string) (*PersistedContainers, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_CONTAINERS,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read containers for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	containers := &PersistedContainers{Map: mapName, Containers: map[int]PersistedContainer{}}
+	if len(objects) == 0 {
+		return containers, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), containers); err != nil {
+		dm.logger.Error("Failed to unmarshal containers for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	return containers, nil
+}
+
+// vendorKey is the storage key of a vendor of a map
+func vendorKey(mapName string, oid int) string {
+	return fmt.Sprintf("%s:%d", mapName, oid)
+}
+
+// SaveVendor writes the state of a vendor if it is still at version (from LoadVendor)
+func (dm *DatabaseManager) SaveVendor(ctx context.Context, mapName string, oid int, vendor *PersistedVendor, version string) error {
+	data, err := json.Marshal(vendor)
+	if err != nil {
+		dm.logger.Error("Failed to marshal vendor %d on %s: %v", oid, mapName, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_SHOPS,
+			Key:             vendorKey(mapName, oid),
+			UserID:          "",
+			Value:           string(data),
+			Version:         version,
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Warn("Failed to save vendor %d on %s: %v", oid, mapName, err)
+		return err
+	}
+	return nil
+}
+
+// LoadVendor retrieves the state of a vendor (nil if none was saved) and its storage version,
+// which SaveVendor needs to detect changes by another shard
+func (dm *DatabaseManager) LoadVendor(ctx context.Context, mapName string, oid int) (*PersistedVendor, string, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_SHOPS,
+			Key:        vendorKey(mapName, oid),
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read vendor %d on %s: %v", oid, mapName, err)
+		return nil, "", err
+	}
+	if len(objects) == 0 {
+		// "*" only creates, so two first writers can't both succeed
+		return nil, "*", nil
+	}
+
+	vendor := &PersistedVendor{}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), vendor); err != nil {
+		dm.logger.Error("Failed to unmarshal vendor %d on %s: %v", oid, mapName, err)
+		return nil, "", err
+	}
+	return vendor, objects[0].GetVersion(), nil
+}
+
+// LoadVendors retrieves the saved state of a map's vendors by object ID, in one read
+func (dm *DatabaseManager) LoadVendors(ctx context.Context, mapName string, oids []int) (map[int]*PersistedVendor, error) {
+	vendors := make(map[int]*PersistedVendor, len(oids))
+	if len(oids) == 0 {
+		return vendors, nil
+	}
+	keys := make(map[string]int, len(oids))
+	reads := make([]*runtime.StorageRead, 0, len(oids))
+	for _, oid := range oids {
+		key := vendorKey(mapName, oid)
+		keys[key] = oid
+		reads = append(reads, &runtime.StorageRead{Collection: COLLECTION_SHOPS, Key: key, UserID: ""})
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read vendors on %s: %v", mapName, err)
+		return nil, err
+	}
+	for _, obj := range objects {
+		vendor := &PersistedVendor{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), vendor); err != nil {
+			dm.logger.Error("Failed to unmarshal vendor %s: %v", obj.GetKey(), err)
+			return nil, err
+		}
+		vendors[keys[obj.GetKey()]] = vendor
+	}
+	return vendors, nil
+}
+
+// LoadShops retrieves the vendor stock a map saved in one record (none if nothing was saved)
+func (dm *DatabaseManager) LoadShops(ctx context.Context, mapName string) (*PersistedShops, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_SHOPS,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read shops for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	shops := &PersistedShops{Map: mapName, Vendors: map[int]PersistedVendor{}}
+	if len(objects) == 0 {
+		return shops, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), shops); err != nil {
+		dm.logger.Error("Failed to unmarshal shops for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	return shops, nil
+}
+
+// SaveCustomWorld lists a running custom world in the world directory. Public worlds can be read
+// by clients; the others only through world_list, which checks who may see them.
+func (dm *DatabaseManager) SaveCustomWorld(ctx context.Context, world *PersistedCustomWorld) error {
+	data, err := json.Marshal(world)
+	if err != nil {
+		dm.logger.Error("Failed to marshal custom world %s: %v", world.ID, err)
+		return err
+	}
+
+	read := runtime.STORAGE_PERMISSION_NO_READ
+	if world.Visibility == WorldVisibilityPublic {
+		read = runtime.STORAGE_PERMISSION_PUBLIC_READ
+	}
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_WORLD_DIRECTORY,
+			Key:             world.ID,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  read,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save custom world %s: %v", world.ID, err)
+		return err
+	}
+	return nil
+}
+
+// shardClaimKey is the storage key of the claim on a shard number of a map
+func shardClaimKey(mapName string, shard int) string {
+	return fmt.Sprintf("%s:%d", mapName, shard)
+}
+
+// LoadShardClaim retrieves the claim on a shard number of a map (nil if there is none) and its
+// storage version ("*" when there is none), which SaveShardClaim needs to detect a rival claim
+func (dm *DatabaseManager) LoadShardClaim(ctx context.Context, mapName string, shard int) (*PersistedShardClaim, string, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_SHARD_CLAIMS,
+			Key:        shardClaimKey(mapName, shard),
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read the claim on shard %d of %s: %v", shard, mapName, err)
+		return nil, "", err
+	}
+	if len(objects) == 0 {
+		return nil, "*", nil
+	}
+
+	claim := &PersistedShardClaim{}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), claim); err != nil {
+		dm.logger.Error("Failed to unmarshal the claim on shard %d of %s: %v", shard, mapName, err)
+		return nil, "", err
+	}
+	return claim, objects[0].GetVersion(), nil
+}
+
+// SaveShardClaim writes the claim on a shard number of a map if it is still at version ("" to
+// write it regardless)
+func (dm *DatabaseManager) SaveShardClaim(ctx context.Context, mapName string, shard int, claim *PersistedShardClaim, version string) error {
+	data, err := json.Marshal(claim)
+	if err != nil {
+		dm.logger.Error("Failed to marshal the claim on shard %d of %s: %v", shard, mapName, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_SHARD_CLAIMS,
+			Key:             shardClaimKey(mapName, shard),
+			UserID:          "",
+			Value:           string(data),
+			Version:         version,
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Warn("Failed to save the claim on shard %d of %s: %v", shard, mapName, err)
+		return err
+	}
+	return nil
+}
+
+// LoadWorldSlots retrieves a player's custom world slots and their storage version ("*" when
+// none were saved), which SaveWorldSlots needs to detect concurrent world_create calls
+func (dm *DatabaseManager) LoadWorldSlots(ctx context.Context, userID string) (*PersistedWorldSlots, string, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_WORLD_SLOTS,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read world slots of %s: %v", userID, err)
+		return nil, "", err
+	}
+
+	slots := &PersistedWorldSlots{}
+	if len(objects) == 0 {
+		return slots, "*", nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), slots); err != nil {
+		dm.logger.Error("Failed to unmarshal world slots of %s: %v", userID, err)
+		return nil, "", err
+	}
+	return slots, objects[0].GetVersion(), nil
+}
+
+// SaveWorldSlots writes a player's custom world slots if they are still at version
+func (dm *DatabaseManager) SaveWorldSlots(ctx context.Context, userID string, slots *PersistedWorldSlots, version string) error {
+	data, err := json.Marshal(slots)
+	if err != nil {
+		dm.logger.Error("Failed to marshal world slots of %s: %v", userID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_WORLD_SLOTS,
+			Key:             userID,
+			UserID:          userID,
+			Value:           string(data),
+			Version:         version,
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Warn("Failed to save world slots of %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteCustomWorld takes a custom world out of the world directory
+func (dm *DatabaseManager) DeleteCustomWorld(ctx context.Context, matchID string) error {
+	deletes := []*runtime.StorageDelete{{Collection: COLLECTION_WORLD_DIRECTORY, Key: matchID, UserID: ""}}
+	if err := dm.store.Delete(ctx, deletes); err != nil {
+		dm.logger.Error("Failed to delete custom world %s: %v", matchID, err)
+		return err
+	}
+	return nil
+}
+
+// ListCustomWorlds retrieves the world directory, up to maxCustomWorldScan entries
+func (dm *DatabaseManager) ListCustomWorlds(ctx context.Context) ([]*PersistedCustomWorld, error) {
+	var worlds []*PersistedCustomWorld
+	cursor := ""
+	for len(worlds) < maxCustomWorldScan {
+		objects, next, err := dm.store.List(ctx, "", COLLECTION_WORLD_DIRECTORY, 100, cursor)
+		if err != nil {
+			dm.logger.Error("Failed to list custom worlds: %v", err)
+			return nil, err
+		}
+		for _, obj := range objects {
+			world := &PersistedCustomWorld{}
+			if err := json.Unmarshal([]byte(obj.GetValue()), world); err != nil {
+				dm.logger.Warn("Skipping malformed custom world %s: %v", obj.GetKey(), err)
+				continue
+			}
+			worlds = append(worlds, world)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	return worlds, nil
+}
+
+// SaveWorldItems persists the item stacks lying on a map
+func (dm *DatabaseManager) SaveWorldItems(ctx context.Context, items *PersistedWorldItems) error {
+	write, err := dm.WorldItemsWrite(items)
+	if err != nil {
+		return err
+	}
+
+	_, err = dm.store.Write(ctx, []*runtime.StorageWrite{write})
+	if err != nil {
+		dm.logger.Error("Failed to save world items for %s: %v", items.Map, err)
+		return err
+	}
+
+	dm.logger.Debug("World items for %s saved (%d stacks)", items.Map, len(items.Items))
+	return nil
+}
+
+// WorldItemsWrite returns the storage write of the item stacks lying on a map, for SaveWorldItems
+// or to commit together with the inventory the items came from or went to
+func (dm *DatabaseManager) WorldItemsWrite(items *PersistedWorldItems) (*runtime.StorageWrite, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		dm.logger.Error("Failed to marshal world items for %s: %v", items.Map, err)
+		return nil, err
+	}
+	return &runtime.StorageWrite{
+		Collection:      COLLECTION_WORLD_ITEMS,
+		Key:             items.Map,
+		UserID:          "",
+		Value:           string(data),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}, nil
+}
+
+// LoadWorldItems retrieves the item stacks saved for a map (none if nothing was saved)
+func (dm *DatabaseManager) LoadWorldItems(ctx context.Context, mapName string) (*PersistedWorldItems, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_WORLD_ITEMS,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read world items for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	items := &PersistedWorldItems{Map: mapName}
+	if len(objects) == 0 {
+		return items, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), items); err != nil {
+		dm.logger.Error("Failed to unmarshal world items for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// SaveMechanisms persists whether a map's levers and latched pressure plates are active
+func (dm *DatabaseManager) SaveMechanisms(ctx context.Context, mechanisms *PersistedMechanisms) error {
+	data, err := json.Marshal(mechanisms)
+	if err != nil {
+		dm.logger.Error("Failed to marshal mechanisms for %s: %v", mechanisms.Map, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_MECHANISMS,
+			Key:             mechanisms.Map,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save mechanisms for %s: %v", mechanisms.Map, err)
+		return err
+	}
+
+	dm.logger.Debug("Mechanisms for %s saved (%d mechanisms)", mechanisms.Map, len(mechanisms.Active))
+	return nil
+}
+
+// LoadMechanisms retrieves the mechanism states saved for a map (none if nothing was saved)
+func (dm *DatabaseManager) LoadMechanisms(ctx context.Context, mapName string) (*PersistedMechanisms, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_MECHANISMS,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read mechanisms for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	mechanisms := &PersistedMechanisms{Map: mapName, Active: map[int]bool{}}
+	if len(objects) == 0 {
+		return mechanisms, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), mechanisms); err != nil {
+		dm.logger.Error("Failed to unmarshal mechanisms for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	return mechanisms, nil
+}
+
+// SaveWaypoints persists the waypoints a player has activated
+func (dm *DatabaseManager) SaveWaypoints(ctx context.Context, waypoints *PersistedWaypoints) error {
+	data, err := json.Marshal(waypoints)
+	if err != nil {
+		dm.logger.Error("Failed to marshal waypoints for %s: %v", waypoints.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_WAYPOINTS,
+			Key:             waypoints.PlayerID,
+			UserID:          waypoints.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save waypoints for %s: %v", waypoints.PlayerID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadWaypoints retrieves the waypoints a player has activated (none for new players)
+func (dm *DatabaseManager) LoadWaypoints(ctx context.Context, userID string) (*PersistedWaypoints, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_WAYPOINTS,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read waypoints for %s: %v", userID, err)
+		return nil, err
+	}
+
+	waypoints := &PersistedWaypoints{PlayerID: userID}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].GetValue()), waypoints); err != nil {
+			dm.logger.Error("Failed to unmarshal waypoints for %s: %v", userID, err)
+			return nil, err
+		}
+	}
+	if waypoints.Activated == nil {
+		waypoints.Activated = make(map[string]*PersistedWaypoint)
+	}
+	return waypoints, nil
+}
+
+// SaveTravel records a player's travel to a waypoint on another map
+func (dm *DatabaseManager) SaveTravel(ctx context.Context, travel *PersistedTravel) error {
+	data, err := json.Marshal(travel)
+	if err != nil {
+		dm.logger.Error("Failed to marshal travel for %s: %v", travel.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_TRAVEL,
+			Key:             travel.PlayerID,
+			UserID:          travel.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save travel for %s: %v", travel.PlayerID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadTravel retrieves a player's travel in progress (nil if there is none)
+func (dm *DatabaseManager) LoadTravel(ctx context.Context, userID string) (*PersistedTravel, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_TRAVEL,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read travel for %s: %v", userID, err)
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	travel := &PersistedTravel{}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), travel); err != nil {
+		dm.logger.Error("Failed to unmarshal travel for %s: %v", userID, err)
+		return nil, err
+	}
+	return travel, nil
+}
+
+// DeleteTravel removes a player's travel once they arrived or it failed
+func (dm *DatabaseManager) DeleteTravel(ctx context.Context, userID string) error {
+	deletes := []*runtime.StorageDelete{
+		{
+			Collection: COLLECTION_TRAVEL,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
+
+	if err := dm.store.Delete(ctx, deletes); err != nil {
+		dm.logger.Error("Failed to delete travel for %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// replaySegmentKey is the storage key of a replay segment slot
+func replaySegmentKey(matchID string, slot int) string {
+	return fmt.Sprintf("%s/%d", matchID, slot)
+}
+
+// SaveReplayIndex persists the description of a match's replay. Replays hold every player's
+// inputs, so clients can't read them.
+func (dm *DatabaseManager) SaveReplayIndex(ctx context.Context, index *PersistedReplayIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		dm.logger.Error("Failed to marshal replay index for %s: %v", index.MatchID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_REPLAYS,
+			Key:             index.MatchID,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save replay index for %s: %v", index.MatchID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadReplayIndex retrieves the description of a match's replay (nil if it wasn't recorded)
+func (dm *DatabaseManager) LoadReplayIndex(ctx context.Context, matchID string) (*PersistedReplayIndex, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_REPLAYS,
+			Key:        matchID,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read replay index for %s: %v", matchID, err)
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	index := &PersistedReplayIndex{}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), index); err != nil {
+		dm.logger.Error("Failed to unmarshal replay index for %s: %v", matchID, err)
+		return nil, err
+	}
+	return index, nil
+}
+
+// SaveReplaySegment writes a replay segment into its slot, replacing the oldest one
+func (dm *DatabaseManager) SaveReplaySegment(ctx context.Context, matchID string, segment *ReplaySegment) error {
+	data, err := json.Marshal(segment)
+	if err != nil {
+		dm.logger.Error("Failed to marshal replay segment %d for %s: %v", segment.Slot, matchID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_REPLAYS,
+			Key:             replaySegmentKey(matchID, segment.Slot),
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save replay segment %d for %s: %v", segment.Slot, matchID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadReplaySegments retrieves the recorded segments of a match's replay, in no particular order
+func (dm *DatabaseManager) LoadReplaySegments(ctx context.Context, matchID string, slots int) ([]*ReplaySegment, error) {
+	reads := make([]*runtime.StorageRead, 0, slots)
+	for slot := 0; slot < slots; slot++ {
+		reads = append(reads, &runtime.StorageRead{
+			Collection: COLLECTION_REPLAYS,
+			Key:        replaySegmentKey(matchID, slot),
+			UserID:     "",
+		})
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read replay of %s: %v", matchID, err)
+		return nil, err
+	}
+
+	segments := make([]*ReplaySegment, 0, len(objects))
+	for _, obj := range objects {
+		segment := &ReplaySegment{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), segment); err != nil {
+			dm.logger.Error("Failed to unmarshal replay segment %s: %v", obj.GetKey(), err)
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// adminLogKey orders admin log entries newest first: storage lists keys in ascending order
+func adminLogKey(entry *AdminLogEntry) string {
+	return fmt.Sprintf("%019d-%s", math.MaxInt64-entry.Time.UnixNano(), entry.ActorID)
+}
+
+// AppendAdminLog writes an entry to the admin log. Entries are never overwritten and can't be
+// read by clients.
+func (dm *DatabaseManager) AppendAdminLog(ctx context.Context, entry *AdminLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		dm.logger.Error("Failed to marshal admin log entry %s by %s: %v", entry.Action, entry.ActorID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_ADMIN_LOG,
+			Key:             adminLogKey(entry),
+			UserID:          "",
+			Value:           string(data),
+			Version:         "*", // only write if the key is new
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to write admin log entry %s by %s: %v", entry.Action, entry.ActorID, err)
+		return err
+	}
+	return nil
+}
+
+// journalWrite returns the write of a journal record owned by its player. It is only written if
+// the key is new, so records are never overwritten and can't be read by clients.
+func journalWrite(collection string, entry *JournalEntry) *runtime.StorageWrite {
+	data, _ := json.Marshal(entry)
+	return &runtime.StorageWrite{
+		Collection:      collection,
+		Key:             entry.Key,
+		UserID:          entry.PlayerID,
+		Value:           string(data),
+		Version:         "*", // only write if the key is new
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+}
+
+// AppendJournal writes a journal record (a pending entry or an outcome) to a journal collection.
+// It fails if the player already has a record with the key.
+func (dm *DatabaseManager) AppendJournal(ctx context.Context, collection string, entry *JournalEntry) error {
+	if _, err := dm.store.Write(ctx, []*runtime.StorageWrite{journalWrite(collection, entry)}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadJournal returns the records of a player with the given keys in a journal collection, by
+// key; keys without a record are left out
+func (dm *DatabaseManager) ReadJournal(ctx context.Context, collection, playerID string, keys []string) (map[string]*JournalEntry, error) {
+	entries := make(map[string]*JournalEntry, len(keys))
+	if len(keys) == 0 {
+		return entries, nil
+	}
+	reads := make([]*runtime.StorageRead, 0, len(keys))
+	for _, key := range keys {
+		reads = append(reads, &runtime.StorageRead{Collection: collection, Key: key, UserID: playerID})
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read journal records of %s: %v", playerID, err)
+		return nil, err
+	}
+	for _, obj := range objects {
+		entry := &JournalEntry{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), entry); err != nil {
+			dm.logger.Error("Failed to unmarshal journal record %s of %s: %v", obj.GetKey(), playerID, err)
+			continue
+		}
+		entries[obj.GetKey()] = entry
+	}
+	return entries, nil
+}
+
+// ListJournal returns a page of a player's pending journal entries and the cursor of the next
+// page ("" after the last one)
+func (dm *DatabaseManager) ListJournal(ctx context.Context, playerID string, limit int, cursor string) ([]*JournalEntry, string, error) {
+	objects, next, err := dm.store.List(ctx, playerID, COLLECTION_ACTION_JOURNAL, limit, cursor)
+	if err != nil {
+		dm.logger.Error("Failed to list the journal of %s: %v", playerID, err)
+		return nil, "", err
+	}
+
+	entries := make([]*JournalEntry, 0, len(objects))
+	for _, obj := range objects {
+		entry := &JournalEntry{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), entry); err != nil {
+			dm.logger.Error("Failed to unmarshal journal entry %s of %s: %v", obj.GetKey(), playerID, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, next, nil
+}
+
+// AppendRollAudits writes audit records of rolls, each under its player (the system user for
+// rolls without one). Clients can't read them.
+func (dm *DatabaseManager) AppendRollAudits(ctx context.Context, rolls []*RollAudit) error {
+	writes := make([]*runtime.StorageWrite, 0, len(rolls))
+	for _, roll := range rolls {
+		data, err := json.Marshal(roll)
+		if err != nil {
+			dm.logger.Error("Failed to marshal RNG audit record %s: %v", roll.ID, err)
+			continue
+		}
+		writes = append(writes, &runtime.StorageWrite{
+			Collection:      COLLECTION_RNG_AUDIT,
+			Key:             roll.ID,
+			UserID:          roll.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		})
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListRollAudits returns a page of a player's audited rolls and the cursor of the next page (""
+// after the last one)
+func (dm *DatabaseManager) ListRollAudits(ctx context.Context, playerID string, limit int, cursor string) ([]*RollAudit, string, error) {
+	objects, next, err := dm.store.List(ctx, playerID, COLLECTION_RNG_AUDIT, limit, cursor)
+	if err != nil {
+		dm.logger.Error("Failed to list the RNG audit of %s: %v", playerID, err)
+		return nil, "", err
+	}
+
+	rolls := make([]*RollAudit, 0, len(objects))
+	for _, obj := range objects {
+		roll := &RollAudit{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), roll); err != nil {
+			dm.logger.Error("Failed to unmarshal RNG audit record %s of %s: %v", obj.GetKey(), playerID, err)
+			continue
+		}
+		rolls = append(rolls, roll)
+	}
+	return rolls, next, nil
+}
+
+// SaveViolation records a text the content filter objected to under its player; clients can't
+// read it
+func (dm *DatabaseManager) SaveViolation(ctx context.Context, violation *PersistedViolation) error {
+	data, err := json.Marshal(violation)
+	if err != nil {
+		return err
+	}
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_MODERATION,
+			Key:             violation.ID,
+			UserID:          violation.PlayerID,
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListViolations returns a page of a player's recorded violations and the cursor of the next
+// page ("" after the last one)
+func (dm *DatabaseManager) ListViolations(ctx context.Context, playerID string, limit int, cursor string) ([]*PersistedViolation, string, error) {
+	objects, next, err := dm.store.List(ctx, playerID, COLLECTION_MODERATION, limit, cursor)
+	if err != nil {
+		dm.logger.Error("Failed to list the violations of %s: %v", playerID, err)
+		return nil, "", err
+	}
+
+	violations := make([]*PersistedViolation, 0, len(objects))
+	for _, obj := range objects {
+		violation := &PersistedViolation{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), violation); err != nil {
+			dm.logger.Error("Failed to unmarshal violation %s of %s: %v", obj.GetKey(), playerID, err)
+			continue
+		}
+		violations = append(violations, violation)
+	}
+	return violations, next, nil
+}
+
+// SaveCheatReport persists a player's cheat report; clients can't read it
+func (dm *DatabaseManager) SaveCheatReport(ctx context.Context, report *PersistedCheatReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		dm.logger.Error("Failed to marshal cheat report for %s: %v", report.PlayerID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_CHEAT_REPORTS,
+			Key:             report.PlayerID,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save cheat report for %s: %v", report.PlayerID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadCheatReport retrieves a player's cheat report (an empty one if they have none)
+func (dm *DatabaseManager) LoadCheatReport(ctx context.Context, playerID string) (*PersistedCheatReport, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_CHEAT_REPORTS,
+			Key:        playerID,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read cheat report for %s: %v", playerID, err)
+		return nil, err
+	}
+
+	report := &PersistedCheatReport{PlayerID: playerID}
+	if len(objects) == 0 {
+		return report, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), report); err != nil {
+		dm.logger.Error("Failed to unmarshal cheat report for %s: %v", playerID, err)
+		return nil, err
+	}
+	return report, nil
+}
+
+// ListCheatReports returns a page of cheat reports and the cursor of the next page ("" after the
+// last one)
+func (dm *DatabaseManager) ListCheatReports(ctx context.Context, limit int, cursor string) ([]*PersistedCheatReport, string, error) {
+	objects, next, err := dm.store.List(ctx, "", COLLECTION_CHEAT_REPORTS, limit, cursor)
+	if err != nil {
+		dm.logger.Error("Failed to list cheat reports: %v", err)
+		return nil, "", err
+	}
+
+	reports := make([]*PersistedCheatReport, 0, len(objects))
+	for _, obj := range objects {
+		report := &PersistedCheatReport{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), report); err != nil {
+			dm.logger.Error("Failed to unmarshal cheat report %s: %v", obj.GetKey(), err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports, next, nil
+}
+
+// ListAdminLog returns a page of admin log entries, newest first, and the cursor of the next page
+// ("" after the last one)
+func (dm *DatabaseManager) ListAdminLog(ctx context.Context, limit int, cursor string) ([]*AdminLogEntry, string, error) {
+	objects, next, err := dm.store.List(ctx, "", COLLECTION_ADMIN_LOG, limit, cursor)
+	if err != nil {
+		dm.logger.Error("Failed to list the admin log: %v", err)
+		return nil, "", err
+	}
+
+	entries := make([]*AdminLogEntry, 0, len(objects))
+	for _, obj := range objects {
+		entry := &AdminLogEntry{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), entry); err != nil {
+			dm.logger.Error("Failed to unmarshal admin log entry %s: %v", obj.GetKey(), err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, next, nil
+}
+
+// SaveWorldReset persists the last reset of a map
+func (dm *DatabaseManager) SaveWorldReset(ctx context.Context, reset *PersistedWorldReset) error {
+	data, err := json.Marshal(reset)
+	if err != nil {
+		dm.logger.Error("Failed to marshal world reset for %s: %v", reset.Map, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_WORLD_RESETS,
+			Key:             reset.Map,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save world reset for %s: %v", reset.Map, err)
+		return err
+	}
+	return nil
+}
+
+// LoadWorldReset retrieves the last reset of a map (nil if it was never reset)
+func (dm *DatabaseManager) LoadWorldReset(ctx context.Context, mapName string) (*PersistedWorldReset, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_WORLD_RESETS,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read world reset for %s: %v", mapName, err)
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	reset := &PersistedWorldReset{}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), reset); err != nil {
+		dm.logger.Error("Failed to unmarshal world reset for %s: %v", mapName, err)
+		return nil, err
+	}
+	return reset, nil
+}
+
+// DeleteWorldState deletes saved world state of a map. objects clears the map's resource nodes,
+// control points, doors, mechanisms, farms, dropped items, vendor stock, chunks and the saved dynamic bodies; scripts clears the
+// script world variables, which every map shares, and the map's region variables. Housing plots and player progress are kept.
+func (dm *DatabaseManager) DeleteWorldState(ctx context.Context, mapName string, objects, scripts bool) error {
+	var deletes []*runtime.StorageDelete
+	if objects {
+		for _, collection := range []string{COLLECTION_RESOURCE_NODES, COLLECTION_CONTROL_POINTS, COLLECTION_DOORS, COLLECTION_MECHANISMS, COLLECTION_FARMS, COLLECTION_WORLD_ITEMS, COLLECTION_SHOPS} {
+			deletes = append(deletes, &runtime.StorageDelete{Collection: collection, Key: mapName, UserID: ""})
+		}
+		deletes = append(deletes, &runtime.StorageDelete{Collection: COLLECTION_WORLD_STATE, Key: mapName, UserID: ""})
+		if mapName == defaultWorldMap {
+			deletes = append(deletes, &runtime.StorageDelete{Collection: COLLECTION_WORLD_STATE, Key: KEY_GLOBAL_WORLD_STATE, UserID: ""})
+		}
+
+		bodies, _, err := dm.store.List(ctx, "", COLLECTION_GAME_OBJECTS, 100, "")
+		if err != nil {
+			dm.logger.Error("Failed to list game objects: %v", err)
+			return err
+		}
+		for _, obj := range bodies {
+			deletes = append(deletes, &runtime.StorageDelete{Collection: COLLECTION_GAME_OBJECTS, Key: obj.GetKey(), UserID: ""})
+		}
+
+		chunks, err := dm.listChunkKeys(ctx, mapName)
+		if err != nil {
+			return err
+		}
+		for _, key := range chunks {
+			deletes = append(deletes, &runtime.StorageDelete{Collection: COLLECTION_WORLD_CHUNKS, Key: key, UserID: ""})
+		}
+
+		vendors, err := dm.listKeys(ctx, COLLECTION_SHOPS, func(key string) bool {
+			return strings.HasPrefix(key, mapName+":")
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range vendors {
+			deletes = append(deletes, &runtime.StorageDelete{Collection: COLLECTION_SHOPS, Key: key, UserID: ""})
+		}
+	}
+	if scripts {
+		deletes = append(deletes, &runtime.StorageDelete{Collection: COLLECTION_WORLD_VARS, Key: KEY_GLOBAL_WORLD_STATE, UserID: ""})
+		deletes = append(deletes, &runtime.StorageDelete{Collection: COLLECTION_REGION_VARS, Key: mapName, UserID: ""})
+	}
+	if len(deletes) == 0 {
+		return nil
+	}
+
+	if err := dm.store.Delete(ctx, deletes); err != nil {
+		dm.logger.Error("Failed to delete world state of %s: %v", mapName, err)
+		return err
+	}
+
+	dm.logger.Info("Deleted saved world state of %s (objects: %t, script vars: %t)", mapName, objects, scripts)
+	return nil
+}
+
+// SaveLiveOps persists the live-ops event configuration
+func (dm *DatabaseManager) SaveLiveOps(ctx context.Context, config *LiveOpsConfig) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		dm.logger.Error("Failed to marshal live-ops config: %v", err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_LIVE_OPS,
+			Key:             KEY_GLOBAL_WORLD_STATE,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save live-ops config: %v", err)
+		return err
+	}
+
+	dm.logger.Info("Live-ops config saved (%d events)", len(config.Events))
+	return nil
+}
+
+// LoadLiveOps retrieves the live-ops event configuration (no events if nothing was saved)
+func (dm *DatabaseManager) LoadLiveOps(ctx context.Context) (*LiveOpsConfig, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_LIVE_OPS,
+			Key:        KEY_GLOBAL_WORLD_STATE,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read live-ops config: %v", err)
+		return nil, err
+	}
+
+	config := &LiveOpsConfig{Events: []*LiveOpsEvent{}}
+	if len(objects) == 0 {
+		return config, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), config); err != nil {
+		dm.logger.Error("Failed to unmarshal live-ops config: %v", err)
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// LoadControlPoints retrieves the control point owners saved for a map (none if nothing was saved)
+func (dm *DatabaseManager) LoadControlPoints(ctx context.Context, mapName string) (*PersistedControlPoints, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_CONTROL_POINTS,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read control points for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	points := &PersistedControlPoints{Map: mapName, Points: map[int]PersistedControlPoint{}}
+	if len(objects) == 0 {
+		return points, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), points); err != nil {
+		dm.logger.Error("Failed to unmarshal control points for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	return points, nil
+}
+
+// plotKey is the storage key of a housing plot
+func plotKey(mapName string, plotID int) string {
+	return fmt.Sprintf("%s:%d", mapName, plotID)
+}
+
+// SavePlot persists the claim and furniture of a housing plot if its record is still at version
+// (from LoadPlots, "*" for a plot without one) and returns the record's new version
+func (dm *DatabaseManager) SavePlot(ctx context.Context, plot *PersistedPlot, version string) (string, error) {
+	data, err := json.Marshal(plot)
+	if err != nil {
+		dm.logger.Error("Failed to marshal plot %d on %s: %v", plot.PlotID, plot.Map, err)
+		return "", err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_HOUSING_PLOTS,
+			Key:             plotKey(plot.Map, plot.PlotID),
+			UserID:          "",
+			Value:           string(data),
+			Version:         version,
+			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	acks, err := dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Warn("Failed to save plot %d on %s: %v", plot.PlotID, plot.Map, err)
+		return "", err
+	}
+	if len(acks) == 0 {
+		return "", nil
+	}
+	return acks[0].GetVersion(), nil
+}
+
+// LoadPlots retrieves the saved claims of a map's plots with their storage versions, keyed by
+// plot ID (free plots are missing)
+func (dm *DatabaseManager) LoadPlots(ctx context.Context, mapName string, plotIDs []int) (map[int]*PersistedPlot, error) {
+	reads := make([]*runtime.StorageRead, 0, len(plotIDs))
+	for _, id := range plotIDs {
+		reads = append(reads, &runtime.StorageRead{
+			Collection: COLLECTION_HOUSING_PLOTS,
+			Key:        plotKey(mapName, id),
+			UserID:     "",
+		})
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read plots for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	plots := make(map[int]*PersistedPlot, len(objects))
+	for _, obj := range objects {
+		plot := &PersistedPlot{}
+		if err := json.Unmarshal([]byte(obj.GetValue()), plot); err != nil {
+			dm.logger.Error("Failed to unmarshal plot %s: %v", obj.GetKey(), err)
+			continue
+		}
+		plot.version = obj.GetVersion()
+		plots[plot.PlotID] = plot
+	}
+
+	return plots, nil
+}
+
+// DeletePlot removes the saved claim of a housing plot if its record is still at version
+func (dm *DatabaseManager) DeletePlot(ctx context.Context, mapName string, plotID int, version string) error {
+	deletes := []*runtime.StorageDelete{
+		{
+			Collection: COLLECTION_HOUSING_PLOTS,
+			Key:        plotKey(mapName, plotID),
+			UserID:     "",
+			Version:    version,
+		},
+	}
+
+	if err := dm.store.Delete(ctx, deletes); err != nil {
+		dm.logger.Warn("Failed to delete plot %d on %s: %v", plotID, mapName, err)
+		return err
+	}
+
+	return nil
+}
+
+// SaveFarm persists a map's tilled soil and crops
+func (dm *DatabaseManager) SaveFarm(ctx context.Context, farm *PersistedFarm) error {
+	data, err := json.Marshal(farm)
+	if err != nil {
+		dm.logger.Error("Failed to marshal farm for %s: %v", farm.Map, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_FARMS,
+			Key:             farm.Map,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save farm for %s: %v", farm.Map, err)
+		return err
+	}
+
+	dm.logger.Debug("Farm for %s saved (%d tilled)", farm.Map, len(farm.Soil))
+	return nil
+}
+
+// LoadFarm retrieves the tilled soil and crops saved for a map (none if nothing was saved)
+func (dm *DatabaseManager) LoadFarm(ctx context.Context, mapName string) (*PersistedFarm, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_FARMS,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read farm for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	farm := &PersistedFarm{Map: mapName, Soil: map[int]PersistedSoil{}}
+	if len(objects) == 0 {
+		return farm, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), farm); err != nil {
+		dm.logger.Error("Failed to unmarshal farm for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	return farm, nil
+}
+
+// SaveWorldClock persists the world's time of day
+func (dm *DatabaseManager) SaveWorldClock(ctx context.Context, clock *PersistedWorldClock) error {
+	data, err := json.Marshal(clock)
+	if err != nil {
+		dm.logger.Error("Failed to marshal world clock: %v", err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_WORLD_CLOCK,
+			Key:             KEY_GLOBAL_WORLD_STATE,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save world clock: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// LoadWorldClock retrieves the persisted time of day (nil if none was saved)
+func (dm *DatabaseManager) LoadWorldClock(ctx context.Context) (*PersistedWorldClock, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_WORLD_CLOCK,
+			Key:        KEY_GLOBAL_WORLD_STATE,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read world clock: %v", err)
+		return nil, err
+	}
+
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	var clock PersistedWorldClock
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &clock); err != nil {
+		dm.logger.Error("Failed to unmarshal world clock: %v", err)
+		return nil, err
+	}
+
+	dm.logger.Info("World clock loaded (day %d, %.0f minutes)", clock.Day, clock.Minutes)
+	return &clock, nil
+}
+
+// CreateGuild stores a new guild and its leader's membership. It fails with errGuildTagTaken
+// when a guild with the same tag exists.
+func (dm *DatabaseManager) CreateGuild(ctx context.Context, guild *PersistedGuild) error {
+	existing, err := dm.LoadGuild(ctx, guild.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return errGuildTagTaken
+	}
+	if err := dm.writeGuild(ctx, guild, map[string]string{guild.LeaderID: guild.ID}, "*"); err != nil {
+		// "*" only creates: a guild founded with the tag since the read makes the write fail
+		if existing, rerr := dm.LoadGuild(ctx, guild.ID); rerr == nil && existing != nil {
+			return errGuildTagTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// SaveGuild stores a guild together with membership changes (player ID -> guild ID, "" after
+// leaving) in a single write, if the guild is still at version (from LoadGuildVersion)
+func (dm *DatabaseManager) SaveGuild(ctx context.Context, guild *PersistedGuild, memberships map[string]string, version string) error {
+	return dm.writeGuild(ctx, guild, memberships, version)
+}
+
+// writeGuild writes a guild and membership records; version "*" only creates
+func (dm *DatabaseManager) writeGuild(ctx context.Context, guild *PersistedGuild, memberships map[string]string, version string) error {
+	data, err := json.Marshal(guild)
+	if err != nil {
+		dm.logger.Error("Failed to marshal guild %s: %v", guild.ID, err)
+		return err
+	}
+
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_GUILDS,
+			Key:             guild.ID,
+			UserID:          "",
+			Value:           string(data),
+			Version:         version,
+			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+	for playerID, guildID := range memberships {
+		membership, err := json.Marshal(PersistedGuildMembership{GuildID: guildID})
+		if err != nil {
+			return err
+		}
+		writes = append(writes, &runtime.StorageWrite{
+			Collection:      COLLECTION_GUILD_MEMBERS,
+			Key:             playerID,
+			UserID:          playerID,
+			Value:           string(membership),
+			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		})
+	}
+
+	_, err = dm.store.Write(ctx, writes)
+	if err != nil {
+		dm.logger.Error("Failed to save guild %s: %v", guild.ID, err)
+		return err
+	}
+
+	return nil
+}
+
+// LoadGuild retrieves a guild by ID (nil if it doesn't exist)
+func (dm *DatabaseManager) LoadGuild(ctx context.Context, guildID string) (*PersistedGuild, error) {
+	guild, _, err := dm.LoadGuildVersion(ctx, guildID)
+	return guild, err
+}
+
+// LoadGuildVersion retrieves a guild by ID (nil if it doesn't exist) and its storage version,
+// which SaveGuild needs to detect concurrent changes
+func (dm *DatabaseManager) LoadGuildVersion(ctx context.Context, guildID string) (*PersistedGuild, string, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_GUILDS,
+			Key:        guildID,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read guild %s: %v", guildID, err)
+		return nil, "", err
+	}
+	if len(objects) == 0 {
+		return nil, "", nil
+	}
+
+	guild := &PersistedGuild{}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), guild); err != nil {
+		dm.logger.Error("Failed to unmarshal guild %s: %v", guildID, err)
+		return nil, "", err
+	}
+	if guild.Members == nil {
+		guild.Members = map[string]*GuildMember{}
+	}
+	if guild.Bank == nil {
+		guild.Bank = map[string]int{}
+	}
+
+	return guild, objects[0].GetVersion(), nil
+}
+
+// DeleteGuild removes a guild and clears the membership records of its members
+func (dm *DatabaseManager) DeleteGuild(ctx context.Context, guildID string, memberIDs []string) error {
+	deletes := []*runtime.StorageDelete{
+		{
+			Collection: COLLECTION_GUILDS,
+			Key:        guildID,
+			UserID:     "",
+		},
+	}
+	for _, playerID := range memberIDs {
+		deletes = append(deletes, &runtime.StorageDelete{
+			Collection: COLLECTION_GUILD_MEMBERS,
+			Key:        playerID,
+			UserID:     playerID,
+		})
+	}
+
+	if err := dm.store.Delete(ctx, deletes); err != nil {
+		dm.logger.Error("Failed to delete guild %s: %v", guildID, err)
+		return err
+	}
+
+	return nil
 }
 
-type PersistedPlayerData struct {
-	PlayerID      string        `json:"playerId"`
-	Username      string        `json:"username"`
-	Position      vector.Vector `json:"position"`
-	Velocity      vector.Vector `json:"velocity"`
-	Health        float64       `json:"health"`
-	Level         int           `json:"level"`
-	LastLoginTime time.Time     `json:"lastLoginTime"`
-	PlayTime      time.Duration `json:"playTime"`
-	Inventory     []string      `json:"inventory"`
-	Achievements  []string      `json:"achievements"`
-}
+// LoadGuildMembership returns the ID of the player's guild ("" when not in a guild)
+func (dm *DatabaseManager) LoadGuildMembership(ctx context.Context, userID string) (string, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_GUILD_MEMBERS,
+			Key:        userID,
+			UserID:     userID,
+		},
+	}
 
-type PersistedGameObject struct {
-	ObjectID    string                 `json:"objectId"`
-	Type        string                 `json:"type"`
-	Position    vector.Vector          `json:"position"`
-	Velocity    vector.Vector          `json:"velocity"`
-	Mass        float64                `json:"mass"`
-	Shape       string                 `json:"shape"`
-	Width       float64                `json:"width"`
-	Height      float64                `json:"height"`
-	IsMovable   bool                   `json:"isMovable"`
-	Properties  map[string]interface{} `json:"properties"`
-	CreatedTime time.Time              `json:"createdTime"`
-	LastUpdated time.Time              `json:"lastUpdated"`
-}
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read guild membership for %s: %v", userID, err)
+		return "", err
+	}
+	if len(objects) == 0 {
+		return "", nil
+	}
 
-type WorldSettings struct {
-	MaxPlayers    int                    `json:"maxPlayers"`
-	SpawnPoints   []vector.Vector        `json:"spawnPoints"`
-	WorldBounds   map[string]float64     `json:"worldBounds"`
-	PhysicsConfig map[string]interface{} `json:"physicsConfig"`
-	GameRules     map[string]interface{} `json:"gameRules"`
+	var membership PersistedGuildMembership
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &membership); err != nil {
+		dm.logger.Error("Failed to unmarshal guild membership for %s: %v", userID, err)
+		return "", err
+	}
+
+	return membership.GuildID, nil
 }
 
-// NewDatabaseManager creates a new database manager instance
-func NewDatabaseManager(logger runtime.Logger, nk runtime.NakamaModule) *DatabaseManager {
-	return &DatabaseManager{
-		logger: logger,
-		nk:     nk,
+// SaveWorldVars persists the shared script world variables
+func (dm *DatabaseManager) SaveWorldVars(ctx context.Context, values map[string]any) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		dm.logger.Error("Failed to marshal world vars: %v", err)
+		return err
 	}
-}
 
-// SaveWorldState persists the current world state to the database
-func (dm *DatabaseManager) SaveWorldState(ctx context.Context, gameState *GameMatchState) error {
-	worldState := PersistedWorldState{
-		LastTick:       gameState.currentTick,
-		GameObjects:    gameState.gameObjects,
-		ActivePlayers:  dm.getActivePlayerIDs(gameState),
-		LastUpdateTime: time.Now(),
-		PhysicsEnabled: true,
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_WORLD_VARS,
+			Key:             KEY_GLOBAL_WORLD_STATE,
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
 	}
 
-	data, err := json.Marshal(worldState)
+	_, err = dm.store.Write(ctx, writes)
 	if err != nil {
-		dm.logger.Error("Failed to marshal world state: %v", err)
+		dm.logger.Error("Failed to save world vars: %v", err)
+		return err
+	}
+
+	dm.logger.Debug("World vars saved (%d keys)", len(values))
+	return nil
+}
+
+// SaveRegionVars persists the script variables of a map's regions
+func (dm *DatabaseManager) SaveRegionVars(ctx context.Context, vars *PersistedRegionVars) error {
+	data, err := json.Marshal(vars)
+	if err != nil {
+		dm.logger.Error("Failed to marshal region vars for %s: %v", vars.Map, err)
 		return err
 	}
 
 	writes := []*runtime.StorageWrite{
 		{
-			Collection:      COLLECTION_WORLD_STATE,
-			Key:             KEY_GLOBAL_WORLD_STATE,
+			Collection:      COLLECTION_REGION_VARS,
+			Key:             vars.Map,
 			UserID:          "",
 			Value:           string(data),
-			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
-			PermissionWrite: runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
 		},
 	}
 
-	_, err = dm.nk.StorageWrite(ctx, writes)
+	_, err = dm.store.Write(ctx, writes)
 	if err != nil {
-		dm.logger.Error("Failed to save world state: %v", err)
+		dm.logger.Error("Failed to save region vars for %s: %v", vars.Map, err)
 		return err
 	}
 
-	dm.logger.Info("World state saved successfully at tick %d", gameState.currentTick)
+	dm.logger.Debug("Region vars for %s saved (%d regions)", vars.Map, len(vars.Regions))
 	return nil
 }
 
-// LoadWorldState retrieves the persisted world state from the database
-func (dm *DatabaseManager) LoadWorldState(ctx context.Context) (*PersistedWorldState, error) {
+// LoadRegionVars retrieves the script variables saved for a map's regions (none if nothing was
+// saved)
+func (dm *DatabaseManager) LoadRegionVars(ctx context.Context, mapName string) (*PersistedRegionVars, error) {
 	reads := []*runtime.StorageRead{
 		{
-			Collection: COLLECTION_WORLD_STATE,
+			Collection: COLLECTION_REGION_VARS,
+			Key:        mapName,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read region vars for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	vars := &PersistedRegionVars{Map: mapName, Regions: map[string]map[string]any{}}
+	if len(objects) == 0 {
+		return vars, nil
+	}
+
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), vars); err != nil {
+		dm.logger.Error("Failed to unmarshal region vars for %s: %v", mapName, err)
+		return nil, err
+	}
+
+	return vars, nil
+}
+
+// LoadWorldVars retrieves the persisted script world variables
+func (dm *DatabaseManager) LoadWorldVars(ctx context.Context) (map[string]any, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_WORLD_VARS,
 			Key:        KEY_GLOBAL_WORLD_STATE,
 			UserID:     "",
 		},
 	}
 
-	objects, err := dm.nk.StorageRead(ctx, reads)
+	objects, err := dm.store.Read(ctx, reads)
 	if err != nil {
-		dm.logger.Error("Failed to read world state: %v", err)
+		dm.logger.Error("Failed to read world vars: %v", err)
 		return nil, err
 	}
 
+	values := map[string]any{}
 	if len(objects) == 0 {
-		dm.logger.Info("No existing world state found, creating new world")
-		return dm.createDefaultWorldState(), nil
+		return values, nil
 	}
 
-	var worldState PersistedWorldState
-	if err := json.Unmarshal([]byte(objects[0].GetValue()), &worldState); err != nil {
-		dm.logger.Error("Failed to unmarshal world state: %v", err)
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &values); err != nil {
+		dm.logger.Error("Failed to unmarshal world vars: %v", err)
 		return nil, err
 	}
 
-	dm.logger.Info("World state loaded successfully from tick %d", worldState.LastTick)
-	return &worldState, nil
+	dm.logger.Info("World vars loaded (%d keys)", len(values))
+	return values, nil
 }
 
-// SavePlayerData persists individual player data
-func (dm *DatabaseManager) SavePlayerData(ctx context.Context, presence runtime.Presence, position vector.Vector, velocity vector.Vector) error {
-	playerData := PersistedPlayerData{
-		PlayerID:      presence.GetUserId(),
-		Username:      presence.GetUsername(),
-		Position:      position,
-		Velocity:      velocity,
-		Health:        100.0,
-		Level:         1,
-		LastLoginTime: time.Now(),
-		PlayTime:      time.Hour, // This would be calculated properly
-		Inventory:     []string{},
-		Achievements:  []string{},
+// SaveStoredScript persists an uploaded script version
+func (dm *DatabaseManager) SaveStoredScript(ctx context.Context, script *StoredScript) error {
+	data, err := json.Marshal(script)
+	if err != nil {
+		dm.logger.Error("Failed to marshal script %s@%s: %v", script.Name, script.Version, err)
+		return err
 	}
 
-	data, err := json.Marshal(playerData)
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_SCRIPTS,
+			Key:             storedScriptKey(script.Name, script.Version),
+			UserID:          "",
+			Value:           string(data),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	_, err = dm.store.Write(ctx, writes)
 	if err != nil {
-		dm.logger.Error("Failed to marshal player data: %v", err)
+		dm.logger.Error("Failed to save script %s@%s: %v", script.Name, script.Version, err)
+		return err
+	}
+
+	dm.logger.Info("Script %s@%s saved", script.Name, script.Version)
+	return nil
+}
+
+// LoadStoredScripts retrieves the requested script versions (name -> version); missing ones are skipped
+func (dm *DatabaseManager) LoadStoredScripts(ctx context.Context, versions map[string]string) (map[string]*StoredScript, error) {
+	reads := make([]*runtime.StorageRead, 0, len(versions))
+	for name, version := range versions {
+		reads = append(reads, &runtime.StorageRead{
+			Collection: COLLECTION_SCRIPTS,
+			Key:        storedScriptKey(name, version),
+			UserID:     "",
+		})
+	}
+	scripts := make(map[string]*StoredScript, len(versions))
+	if len(reads) == 0 {
+		return scripts, nil
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read scripts: %v", err)
+		return nil, err
+	}
+
+	for _, obj := range objects {
+		var script StoredScript
+		if err := json.Unmarshal([]byte(obj.GetValue()), &script); err != nil {
+			dm.logger.Error("Failed to unmarshal script %s: %v", obj.GetKey(), err)
+			continue
+		}
+		scripts[script.Name] = &script
+	}
+	return scripts, nil
+}
+
+// SaveScriptManifest persists the per-map mapping of script names to versions
+func (dm *DatabaseManager) SaveScriptManifest(ctx context.Context, manifest *ScriptManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		dm.logger.Error("Failed to marshal script manifest for %s: %v", manifest.Map, err)
 		return err
 	}
 
 	writes := []*runtime.StorageWrite{
 		{
-			Collection:      COLLECTION_PLAYER_DATA,
-			Key:             presence.GetUserId(),
-			UserID:          presence.GetUserId(),
+			Collection:      COLLECTION_SCRIPT_MANIFEST,
+			Key:             manifest.Map,
+			UserID:          "",
 			Value:           string(data),
-			PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
-			PermissionWrite: runtime.STORAGE_PERMISSION_OWNER_WRITE,
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
 		},
 	}
 
-	_, err = dm.nk.StorageWrite(ctx, writes)
+	_, err = dm.store.Write(ctx, writes)
 	if err != nil {
-		dm.logger.Error("Failed to save player data for %s: %v", presence.GetUsername(), err)
+		dm.logger.Error("Failed to save script manifest for %s: %v", manifest.Map, err)
 		return err
 	}
 
-	// dm.logger.Debug("Player data saved for %s", presence.GetUsername())
+	dm.logger.Info("Script manifest for %s saved (%d scripts)", manifest.Map, len(manifest.Scripts))
 	return nil
 }
 
-// LoadPlayerData retrieves individual player data
-func (dm *DatabaseManager) LoadPlayerData(ctx context.Context, userID string) (*PersistedPlayerData, error) {
+// LoadScriptManifest retrieves the script manifest for a map (nil if none was published)
+func (dm *DatabaseManager) LoadScriptManifest(ctx context.Context, mapName string) (*ScriptManifest, error) {
 	reads := []*runtime.StorageRead{
 		{
-			Collection: COLLECTION_PLAYER_DATA,
-			Key:        userID,
-			UserID:     userID,
+			Collection: COLLECTION_SCRIPT_MANIFEST,
+			Key:        mapName,
+			UserID:     "",
 		},
 	}
 
-	objects, err := dm.nk.StorageRead(ctx, reads)
+	objects, err := dm.store.Read(ctx, reads)
 	if err != nil {
-		dm.logger.Error("Failed to read player data for %s: %v", userID, err)
+		dm.logger.Error("Failed to read script manifest for %s: %v", mapName, err)
 		return nil, err
 	}
 
 	if len(objects) == 0 {
-		dm.logger.Info("No existing player data found for %s, creating new profile", userID)
-		return dm.createDefaultPlayerData(userID), nil
+		return nil, nil
 	}
 
-	var playerData PersistedPlayerData
-	if err := json.Unmarshal([]byte(objects[0].GetValue()), &playerData); err != nil {
-		dm.logger.Error("Failed to unmarshal player data for %s: %v", userID, err)
+	var manifest ScriptManifest
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &manifest); err != nil {
+		dm.logger.Error("Failed to unmarshal script manifest for %s: %v", mapName, err)
 		return nil, err
 	}
-
-	// dm.logger.Debug("Player data loaded for %s", playerData.Username)
-	return &playerData, nil
+	return &manifest, nil
 }
 
-// SaveGameObject persists a single game object
+// persistedBodyType tags the game objects SaveGameObject persists. Objects saved before it
+// (type "rigidbody") may be bodies of NPCs, pets or players, so they aren't restored.
+const persistedBodyType = "unowned_body"
+
+// SaveGameObject persists a single game object: a body nothing in the match owns (see
+// WorldSnapshot.Saved), since owned bodies come back with their owner
 func (dm *DatabaseManager) SaveGameObject(ctx context.Context, obj *rigidbody.RigidBody, objectID string) error {
 	gameObject := PersistedGameObject{
 		ObjectID:    objectID,
-		Type:        "rigidbody",
+		Type:        persistedBodyType,
 		Position:    obj.Position,
 		Velocity:    obj.Velocity,
 		Mass:        obj.Mass,
@@ -259,7 +3905,7 @@ func (dm *DatabaseManager) SaveGameObject(ctx context.Context, obj *rigidbody.Ri
 		},
 	}
 
-	_, err = dm.nk.StorageWrite(ctx, writes)
+	_, err = dm.store.Write(ctx, writes)
 	if err != nil {
 		dm.logger.Error("Failed to save game object %s: %v", objectID, err)
 		return err
@@ -272,7 +3918,7 @@ func (dm *DatabaseManager) SaveGameObject(ctx context.Context, obj *rigidbody.Ri
 // LoadAllGameObjects retrieves all persisted game objects
 func (dm *DatabaseManager) LoadAllGameObjects(ctx context.Context) ([]*rigidbody.RigidBody, error) {
 	// List all objects in the game objects collection
-	objects, _, err := dm.nk.StorageList(ctx, "", "", COLLECTION_GAME_OBJECTS, 100, "")
+	objects, _, err := dm.store.List(ctx, "", COLLECTION_GAME_OBJECTS, 100, "")
 	if err != nil {
 		dm.logger.Error("Failed to list game objects: %v", err)
 		return nil, err
@@ -285,16 +3931,20 @@ func (dm *DatabaseManager) LoadAllGameObjects(ctx context.Context) ([]*rigidbody
 			dm.logger.Error("Failed to unmarshal game object: %v", err)
 			continue
 		}
+		if persistedObj.Type != persistedBodyType {
+			dm.logger.Debug("Skipping game object %s of type %q", persistedObj.ObjectID, persistedObj.Type)
+			continue
+		}
 
 		rigidBody := &rigidbody.RigidBody{
 			Position:  persistedObj.Position,
 			Velocity:  persistedObj.Velocity,
-			Mass:      persistedObj.Mass,
 			Shape:     persistedObj.Shape,
 			Width:     persistedObj.Width,
 			Height:    persistedObj.Height,
 			IsMovable: persistedObj.IsMovable,
 		}
+		SetMass(rigidBody, persistedObj.Mass)
 
 		gameObjects = append(gameObjects, rigidBody)
 	}
@@ -303,8 +3953,9 @@ func (dm *DatabaseManager) LoadAllGameObjects(ctx context.Context) ([]*rigidbody
 	return gameObjects, nil
 }
 
-// SaveWorldSettings persists world configuration settings
-func (dm *DatabaseManager) SaveWorldSettings(ctx context.Context, settings *WorldSettings) error {
+// SaveWorldSettings persists world configuration settings. version is the one
+// LoadWorldSettingsVersion returned ("" overwrites whatever is stored).
+func (dm *DatabaseManager) SaveWorldSettings(ctx context.Context, settings *WorldSettings, version string) error {
 	data, err := json.Marshal(settings)
 	if err != nil {
 		dm.logger.Error("Failed to marshal world settings: %v", err)
@@ -317,12 +3968,13 @@ func (dm *DatabaseManager) SaveWorldSettings(ctx context.Context, settings *Worl
 			Key:             KEY_PHYSICS_SETTINGS,
 			UserID:          "",
 			Value:           string(data),
+			Version:         version,
 			PermissionRead:  runtime.STORAGE_PERMISSION_PUBLIC_READ,
 			PermissionWrite: runtime.STORAGE_PERMISSION_NO_READ,
 		},
 	}
 
-	_, err = dm.nk.StorageWrite(ctx, writes)
+	_, err = dm.store.Write(ctx, writes)
 	if err != nil {
 		dm.logger.Error("Failed to save world settings: %v", err)
 		return err
@@ -334,6 +3986,14 @@ func (dm *DatabaseManager) SaveWorldSettings(ctx context.Context, settings *Worl
 
 // LoadWorldSettings retrieves world configuration settings
 func (dm *DatabaseManager) LoadWorldSettings(ctx context.Context) (*WorldSettings, error) {
+	settings, _, err := dm.LoadWorldSettingsVersion(ctx)
+	return settings, err
+}
+
+// LoadWorldSettingsVersion retrieves world configuration settings (the defaults if none are
+// stored) and their storage version ("*" for the defaults), which SaveWorldSettings needs to
+// detect concurrent changes
+func (dm *DatabaseManager) LoadWorldSettingsVersion(ctx context.Context) (*WorldSettings, string, error) {
 	reads := []*runtime.StorageRead{
 		{
 			Collection: COLLECTION_WORLD_SETTINGS,
@@ -342,33 +4002,171 @@ func (dm *DatabaseManager) LoadWorldSettings(ctx context.Context) (*WorldSetting
 		},
 	}
 
-	objects, err := dm.nk.StorageRead(ctx, reads)
+	objects, err := dm.store.Read(ctx, reads)
 	if err != nil {
 		dm.logger.Error("Failed to read world settings: %v", err)
-		return nil, err
+		return nil, "", err
 	}
 
 	if len(objects) == 0 {
 		dm.logger.Info("No existing world settings found, creating defaults")
-		return dm.createDefaultWorldSettings(), nil
+		return dm.createDefaultWorldSettings(), "*", nil
 	}
 
 	var settings WorldSettings
 	if err := json.Unmarshal([]byte(objects[0].GetValue()), &settings); err != nil {
 		dm.logger.Error("Failed to unmarshal world settings: %v", err)
-		return nil, err
+		return nil, "", err
 	}
 
 	dm.logger.Info("World settings loaded successfully")
-	return &settings, nil
+	return &settings, objects[0].GetVersion(), nil
+}
+
+// SaveGameConfig persists the game configuration overrides (a JSON object, see GameConfig)
+func (dm *DatabaseManager) SaveGameConfig(ctx context.Context, overrides json.RawMessage) error {
+	writes := []*runtime.StorageWrite{
+		{
+			Collection:      COLLECTION_WORLD_SETTINGS,
+			Key:             KEY_GAME_CONFIG,
+			UserID:          "",
+			Value:           string(overrides),
+			PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+			PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+		},
+	}
+
+	if _, err := dm.store.Write(ctx, writes); err != nil {
+		dm.logger.Error("Failed to save game config: %v", err)
+		return err
+	}
+	return nil
+}
+
+// LoadGameConfig retrieves the game configuration overrides, or nil if none are stored
+func (dm *DatabaseManager) LoadGameConfig(ctx context.Context) (json.RawMessage, error) {
+	reads := []*runtime.StorageRead{
+		{
+			Collection: COLLECTION_WORLD_SETTINGS,
+			Key:        KEY_GAME_CONFIG,
+			UserID:     "",
+		},
+	}
+
+	objects, err := dm.store.Read(ctx, reads)
+	if err != nil {
+		dm.logger.Error("Failed to read game config: %v", err)
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	return json.RawMessage(objects[0].GetValue()), nil
+}
+
+// savesWorldState reports whether the match saves the world state of its map: dungeon
+// instances, custom worlds, extra open world shards and shards closing for a world reset only
+// save player progress
+func (gs *GameMatchState) savesWorldState() bool {
+	return !gs.instanced() && gs.shard.Primary() && !gs.shard.Closing()
 }
 
 // PeriodicSave performs regular saves of critical game data
 func (dm *DatabaseManager) PeriodicSave(ctx context.Context, gameState *GameMatchState) error {
-	// // Save world state
-	// if err := dm.SaveWorldState(ctx, gameState); err != nil {
-	// 	return fmt.Errorf("failed to save world state: %w", err)
-	// }
+	// Save the chunks players discovered since the last save
+	if gameState.exploration != nil {
+		if err := gameState.exploration.Save(ctx); err != nil {
+			dm.logger.Error("Failed to save exploration: %v", err)
+		}
+	}
+
+	// Save the cheat reports that got new signals or were acted on
+	if gameState.cheats != nil {
+		if err := gameState.cheats.Save(ctx); err != nil {
+			dm.logger.Error("Failed to save cheat reports: %v", err)
+		}
+	}
+
+	// Dungeon instances, custom worlds, extra open world shards and shards closing for a world
+	// reset only save player progress
+	if !gameState.savesWorldState() {
+		return nil
+	}
+
+	// Save shared script variables (only written when a persistent key changed)
+	if gameState.worldVars != nil {
+		if err := gameState.worldVars.Save(ctx, dm); err != nil {
+			dm.logger.Error("Failed to save world vars: %v", err)
+		}
+	}
+
+	// Save the time of day
+	if gameState.worldClock != nil {
+		if err := gameState.worldClock.Save(ctx, dm); err != nil {
+			dm.logger.Error("Failed to save world clock: %v", err)
+		}
+	}
+
+	// Save the chunks whose resource node timers or buildings changed
+	if gameState.chunks != nil {
+		if err := gameState.chunks.Save(ctx, gameState); err != nil {
+			dm.logger.Error("Failed to save world chunks: %v", err)
+		} else if gameState.resourceNodes != nil {
+			gameState.resourceNodes.DropLegacy(ctx, dm, gameState.currentMapName)
+		}
+	}
+
+	// Save control point owners (only written when ownership or a reward timer changed)
+	if gameState.controlPoints != nil {
+		if err := gameState.controlPoints.Save(ctx, dm, gameState.currentMapName); err != nil {
+			dm.logger.Error("Failed to save control points: %v", err)
+		}
+	}
+
+	// Save door states (only written when a door changed)
+	if gameState.doors != nil {
+		if err := gameState.doors.Save(ctx, dm, gameState.currentMapName); err != nil {
+			dm.logger.Error("Failed to save doors: %v", err)
+		}
+	}
+
+	// Save looted containers and their timers (only written when one changed)
+	if gameState.containers != nil {
+		if err := gameState.containers.Save(ctx, dm, gameState.currentMapName); err != nil {
+			dm.logger.Error("Failed to save containers: %v", err)
+		}
+	}
+
+	// Save dropped items and their decay times (only written when one was dropped, taken or expired)
+	if gameState.worldItems != nil {
+		if err := gameState.worldItems.Save(ctx, dm, gameState.currentMapName, gameState.currentTick); err != nil {
+			dm.logger.Error("Failed to save world items: %v", err)
+		}
+	}
+
+	// Save lever positions (only written when one changed)
+	if gameState.mechanisms != nil {
+		if err := gameState.mechanisms.Save(ctx, dm, gameState.currentMapName); err != nil {
+			dm.logger.Error("Failed to save mechanisms: %v", err)
+		}
+	}
+
+	// Save region-scoped script variables (only written when a persistent key changed)
+	if gameState.regionVars != nil {
+		if err := gameState.regionVars.Save(ctx, dm, gameState.currentMapName); err != nil {
+			dm.logger.Error("Failed to save region vars: %v", err)
+		}
+	}
+
+	// Save tilled soil and crops (only written when one changed)
+	if gameState.farms != nil {
+		if err := gameState.farms.Save(ctx, dm, gameState.currentMapName); err != nil {
+			dm.logger.Error("Failed to save farms: %v", err)
+		}
+	}
+
+	// Save the bodies nothing owns from the last snapshot, off the match loop
+	dm.SaveWorldStateAsync(ctx, gameState.currentMapName, gameState.World())
 
 	// // Save individual player data
 	// for sessionID, presence := range gameState.presences {
@@ -395,7 +4193,7 @@ func (dm *DatabaseManager) PeriodicSave(ctx context.Context, gameState *GameMatc
 // RestoreWorldFromPersistence initializes game state from saved data
 func (dm *DatabaseManager) RestoreWorldFromPersistence(ctx context.Context, gameState *GameMatchState) error {
 	// Load world state
-	worldState, err := dm.LoadWorldState(ctx)
+	worldState, err := dm.LoadWorldState(ctx, gameState.currentMapName)
 
 	if err != nil {
 		return fmt.Errorf("failed to load world state: %w", err)
@@ -405,8 +4203,12 @@ func (dm *DatabaseManager) RestoreWorldFromPersistence(ctx context.Context, game
 	mapObjectCount := len(gameState.gameObjects)
 	dm.logger.Info("Before restoration: %d existing map objects present", mapObjectCount)
 
-	// Restore dynamic game objects if available (without overwriting map objects)
-	if len(worldState.GameObjects) > 0 {
+	// Restore dynamic game objects if available (without overwriting map objects). Older states
+	// hold the bodies of NPCs, pets and players too, which would come back as owner-less colliders.
+	if worldState.Version < persistedWorldVersion && len(worldState.GameObjects) > 0 {
+		dm.logger.Warn("Skipping %d bodies of a version %d world state", len(worldState.GameObjects), worldState.Version)
+		gameState.currentTick = worldState.LastTick
+	} else if len(worldState.GameObjects) > 0 {
 		// Only add objects that are dynamic (movable)
 		dynamicObjects := make([]*rigidbody.RigidBody, 0)
 		for _, obj := range worldState.GameObjects {
@@ -448,14 +4250,6 @@ func (dm *DatabaseManager) RestoreWorldFromPersistence(ctx context.Context, game
 		}
 	}
 
-	// Load world settings
-	settings, err := dm.LoadWorldSettings(ctx)
-	if err != nil {
-		dm.logger.Error("Failed to load world settings: %v", err)
-	} else {
-		dm.logger.Info("World settings loaded: max players %d", settings.MaxPlayers)
-	}
-
 	// Log a summary of the restoration
 	dm.logger.Info("World restoration complete: %d total game objects (%d new dynamic objects)",
 		len(gameState.gameObjects), len(gameState.gameObjects)-mapObjectCount)
@@ -466,6 +4260,7 @@ func (dm *DatabaseManager) RestoreWorldFromPersistence(ctx context.Context, game
 // Helper methods for creating default data structures
 func (dm *DatabaseManager) createDefaultWorldState() *PersistedWorldState {
 	return &PersistedWorldState{
+		Version:        persistedWorldVersion,
 		LastTick:       0,
 		GameObjects:    initializeGameObjects(),
 		ActivePlayers:  []string{},
@@ -489,40 +4284,20 @@ func (dm *DatabaseManager) createDefaultPlayerData(userID string) *PersistedPlay
 	}
 }
 
+// createDefaultWorldSettings returns the settings used until an operator saves some: no cap beyond
+// the shard capacity, and everything else left to the maps and the engine defaults
 func (dm *DatabaseManager) createDefaultWorldSettings() *WorldSettings {
 	return &WorldSettings{
-		MaxPlayers: 100,
-		SpawnPoints: []vector.Vector{
-			{X: 100, Y: 100},
-			{X: 200, Y: 200},
-			{X: 300, Y: 300},
-		},
-		WorldBounds: map[string]float64{
-			"minX": 0,
-			"maxX": 1000,
-			"minY": 0,
-			"maxY": 1000,
-		},
-		PhysicsConfig: map[string]interface{}{
-			"gravity":       9.81,
-			"friction":      0.8,
-			"airResistance": 0.00,
-		},
+		MaxPlayers:    0,
+		SpawnPoints:   []vector.Vector{},
+		WorldBounds:   map[string]float64{},
+		PhysicsConfig: map[string]interface{}{},
 		GameRules: map[string]interface{}{
-			"pvpEnabled":  true,
-			"respawnTime": 10,
+			"pvpEnabled": true,
 		},
 	}
 }
 
-func (dm *DatabaseManager) getActivePlayerIDs(gameState *GameMatchState) []string {
-	var playerIDs []string
-	for _, presence := range gameState.presences {
-		playerIDs = append(playerIDs, presence.GetUserId())
-	}
-	return playerIDs
-}
-
 // CleanupOldData removes old or unused data from storage
 func (dm *DatabaseManager) CleanupOldData(ctx context.Context) error {
 	// This could implement cleanup logic for old player data, expired objects, etc.
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+)
+
+// Door events published on the event bus
+const (
+	EventDoorOpened = "door_opened" // objectId, name, playerId (empty when a script or mechanism opened it)
+	EventDoorClosed = "door_closed" // objectId, name, playerId
+)
+
+// Door tuning. The object properties "open", "locked", "key", "consumeKey", "openGid" and
+// "autoClose" configure each door.
+const (
+	doorObjectType       = "door" // ObjectData.Type of doors and gates
+	doorNoiseRadius      = 5.0 * TileSize
+	doorBlockedRetry     = TickRate     // ticks before an auto-closing door that was blocked tries again
+	doorInteractCooldown = TickRate / 4 // ticks before a player can toggle the same door again
+)
+
+// Door is a tile object whose colliders block the way while it is closed. Locked doors only open
+// for players carrying the key item, or for scripts and mechanisms.
+type Door struct {
+	ObjectID   int
+	Name       string
+	Open       bool
+	Locked     bool
+	Key        string  // item that unlocks the door ("" when only scripts can unlock it)
+	ConsumeKey bool    // unlocking uses up one key
+	ClosedGID  uint32  // tile shown while closed
+	OpenGID    uint32  // tile shown while open (0 keeps the closed tile)
+	AutoClose  float64 // seconds an open door stays open (0 = until closed)
+	closeAt    int64   // tick the door closes by itself (0 = never)
+	nextUse    int64   // players can't toggle the door again before this tick
+}
+
+// DoorData is a door as sent to clients (world_state "doors")
+type DoorData struct {
+	ObjectID int  `json:"objectId"`
+	Open     bool `json:"open"`
+	Locked   bool `json:"locked"`
+}
+
+// DoorManager tracks the doors of the current map
+type DoorManager struct {
+	logger runtime.Logger
+	doors  map[int]*Door // object ID -> door
+	dirty  bool          // a door changed since the last save
+	mu     sync.Mutex
+}
+
+// NewDoorManager creates an empty door manager
+func NewDoorManager(logger runtime.Logger) *DoorManager {
+	return &DoorManager{
+		logger: logger,
+		doors:  make(map[int]*Door),
+	}
+}
+
+// LoadFromMap registers every "door" object of the current map. Doors whose tile has no
+// collision shape get a tile-sized box.
+func (dm *DoorManager) LoadFromMap(gs *GameMatchState) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	dm.doors = make(map[int]*Door)
+	gs.mu.Lock()
+	var missingColliders []*Door
+	for oid, obj := range gs.Objects() {
+		if !strings.EqualFold(obj.Type, doorObjectType) {
+			continue
+		}
+		if _, ok := obj.Position(); !ok {
+			dm.logger.Warn("Door %d (%s) has no position; skipping", oid, obj.Name)
+			continue
+		}
+		door := &Door{ObjectID: oid, Name: obj.Name, ClosedGID: obj.GID}
+		door.Open, _ = obj.Props["open"].(bool)
+		door.Locked, _ = obj.Props["locked"].(bool)
+		door.Key, _ = obj.Props["key"].(string)
+		door.ConsumeKey, _ = obj.Props["consumekey"].(bool)
+		if v, ok := obj.Props["opengid"].(float64); ok && v > 0 {
+			door.OpenGID = uint32(v)
+		}
+		if v, ok := obj.Props["autoclose"].(float64); ok && v > 0 {
+			door.AutoClose = v
+		}
+		if len(gs.entities.ObjectColliders(oid)) == 0 {
+			missingColliders = append(missingColliders, door)
+		}
+		dm.doors[oid] = door
+	}
+	gs.mu.Unlock()
+
+	for _, door := range missingColliders {
+		obj, _ := gs.Object(door.ObjectID)
+		pos, _ := obj.Position()
+		gs.AddOwnerCollider(door.ObjectID, MakeRectangleRigidBody(pos.X, pos.Y, TileSize, TileSize), nil)
+	}
+	for _, door := range dm.doors {
+		gs.applyDoor(door)
+	}
+	dm.logger.Info("Registered %d doors", len(dm.doors))
+}
+
+// Get returns the door of an object (nil if the object isn't a door)
+func (dm *DoorManager) Get(oid int) *Door {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.doors[oid]
+}
+
+// Interact opens or closes a door for a player who reached it. Locked doors need the key item,
+// which unlocks them for good. It returns a reject reason, or "" on success.
+func (dm *DoorManager) Interact(ctx context.Context, gs *GameMatchState, door *Door, playerID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	if gs.currentTick < door.nextUse {
+		return RejectRateLimited
+	}
+	if door.Locked {
+		if door.Key == "" || gs.inventoryManager.Count(ctx, playerID, door.Key) <= 0 {
+			return RejectLocked
+		}
+		if door.ConsumeKey {
+			if err := gs.inventoryManager.Remove(ctx, playerID, door.Key, 1); err != nil {
+				return RejectLocked
+			}
+			gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+		}
+		dm.SetLocked(gs, door.ObjectID, false, dispatcher, logger)
+	}
+	if reason := dm.SetOpen(gs, door.ObjectID, !door.Open, playerID, dispatcher, logger); reason != "" {
+		return reason
+	}
+	door.nextUse = gs.currentTick + doorInteractCooldown
+	return ""
+}
+
+// SetOpen opens or closes a door (playerID is who did it, "" for scripts and mechanisms). A door
+// can't close on a player or NPC standing in it. It returns a reject reason, or "" on success
+// (including when the door already was in that state).
+func (dm *DoorManager) SetOpen(gs *GameMatchState, oid int, open bool, playerID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	dm.mu.Lock()
+	door, ok := dm.doors[oid]
+	if !ok {
+		dm.mu.Unlock()
+		return RejectUnknownObject
+	}
+	if door.Open == open {
+		dm.mu.Unlock()
+		return ""
+	}
+	if !open && gs.doorwayBlocked(oid) {
+		dm.mu.Unlock()
+		return RejectDoorBlocked
+	}
+	door.Open = open
+	door.closeAt = 0
+	if open && door.AutoClose > 0 {
+		door.closeAt = gs.currentTick + int64(door.AutoClose*TickRate)
+	}
+	dm.dirty = true
+	dm.mu.Unlock()
+
+	gs.applyDoor(door)
+	gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+
+	obj, _ := gs.Object(oid)
+	pos, _ := obj.Position()
+	gs.MakeNoise(NoiseDoor, pos, doorNoiseRadius, playerID, dispatcher, logger)
+	event := EventDoorClosed
+	if open {
+		event = EventDoorOpened
+	}
+	gs.eventBus.Publish(event, map[string]any{"objectId": oid, "name": door.Name, "playerId": playerID})
+	return ""
+}
+
+// SetLocked locks or unlocks a door without opening or closing it. It returns false for unknown doors.
+func (dm *DoorManager) SetLocked(gs *GameMatchState, oid int, locked bool, dispatcher runtime.MatchDispatcher, logger runtime.Logger) bool {
+	dm.mu.Lock()
+	door, ok := dm.doors[oid]
+	if !ok {
+		dm.mu.Unlock()
+		return false
+	}
+	changed := door.Locked != locked
+	door.Locked = locked
+	if changed {
+		dm.dirty = true
+	}
+	dm.mu.Unlock()
+
+	if changed {
+		gs.applyDoor(door)
+		gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+	}
+	return true
+}
+
+// Update closes auto-closing doors whose time is up. Called from the match loop.
+func (dm *DoorManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	dm.mu.Lock()
+	var due []*Door
+	for _, door := range dm.doors {
+		if door.Open && door.closeAt > 0 && gs.currentTick >= door.closeAt {
+			due = append(due, door)
+		}
+	}
+	dm.mu.Unlock()
+
+	for _, door := range due {
+		if dm.SetOpen(gs, door.ObjectID, false, "", dispatcher, dm.logger) == RejectDoorBlocked {
+			dm.mu.Lock()
+			door.closeAt = gs.currentTick + doorBlockedRetry
+			dm.mu.Unlock()
+		}
+	}
+}
+
+// Snapshot returns the doors for clients, ordered by object ID
+func (dm *DoorManager) Snapshot() []DoorData {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	doors := make([]DoorData, 0, len(dm.doors))
+	for _, door := range dm.doors {
+		doors = append(doors, DoorData{ObjectID: door.ObjectID, Open: door.Open, Locked: door.Locked})
+	}
+	sort.Slice(doors, func(i, j int) bool { return doors[i].ObjectID < doors[j].ObjectID })
+	return doors
+}
+
+// Save persists whether each door is open and locked if one changed since the last save
+func (dm *DoorManager) Save(ctx context.Context, db *DatabaseManager, mapName string) error {
+	dm.mu.Lock()
+	if !dm.dirty {
+		dm.mu.Unlock()
+		return nil
+	}
+	saved := &PersistedDoors{Map: mapName, Doors: make(map[int]PersistedDoor, len(dm.doors))}
+	for oid, door := range dm.doors {
+		saved.Doors[oid] = PersistedDoor{Open: door.Open, Locked: door.Locked}
+	}
+	dm.dirty = false
+	dm.mu.Unlock()
+
+	if err := db.SaveDoors(ctx, saved); err != nil {
+		// Keep the dirty flag so the next periodic save retries
+		dm.mu.Lock()
+		dm.dirty = true
+		dm.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Restore puts the map's doors back in the state saved before a restart. Auto-closing doors come
+// back closed.
+func (dm *DoorManager) Restore(ctx context.Context, gs *GameMatchState) error {
+	saved, err := gs.databaseManager.LoadDoors(ctx, gs.currentMapName)
+	if err != nil {
+		return err
+	}
+
+	dm.mu.Lock()
+	restored := make([]*Door, 0, len(saved.Doors))
+	for oid, state := range saved.Doors {
+		door, ok := dm.doors[oid]
+		if !ok {
+			continue
+		}
+		door.Open = state.Open && door.AutoClose == 0
+		door.Locked = state.Locked
+		restored = append(restored, door)
+	}
+	dm.mu.Unlock()
+
+	for _, door := range restored {
+		gs.applyDoor(door)
+	}
+	dm.logger.Info("Restored %d doors", len(restored))
+	return nil
+}
+
+// applyDoor turns the door's colliders on or off and mirrors its state into the object's tile and
+// properties. Open doors stop blocking movement, sight, projectiles and paths.
+func (gs *GameMatchState) applyDoor(door *Door) {
+	gs.mu.Lock()
+	bodies := gs.entities.ObjectColliders(door.ObjectID)
+	if obj, ok := gs.Object(door.ObjectID); ok {
+		obj.Props["open"] = door.Open
+		obj.Props["locked"] = door.Locked
+		obj.GID = door.ClosedGID
+		if door.Open && door.OpenGID != 0 {
+			obj.GID = door.OpenGID
+		}
+	}
+	gs.mu.Unlock()
+
+	for _, rb := range bodies {
+		gs.physicsEngine.SetCollisionsEnabled(rb, !door.Open)
+	}
+	gs.pathfinder.Invalidate()
+}
+
+// doorwayBlocked reports whether a player or NPC body overlaps one of the door's colliders
+func (gs *GameMatchState) doorwayBlocked(oid int) bool {
+	gs.mu.Lock()
+	bodies := gs.entities.ObjectColliders(oid)
+	movable := make([]*rigidbody.RigidBody, 0, len(gs.gameObjects))
+	for _, rb := range gs.gameObjects {
+		if rb.IsMovable && gs.physicsEngine.CollisionsEnabled(rb) {
+			movable = append(movable, rb)
+		}
+	}
+	gs.mu.Unlock()
+
+	for _, rb := range bodies {
+		if len(gs.physicsEngine.QueryOverlap(rb, movable)) > 0 {
+			return true
+		}
+	}
+	return false
+}
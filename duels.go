@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Duel end reasons sent with duel_ended
+const (
+	DuelEndDefeated    = "defeated"    // the loser's health dropped to the yield threshold
+	DuelEndFled        = "fled"        // the loser left the duel area
+	DuelEndLeft        = "left"        // the loser left the match
+	DuelEndTimeout     = "timeout"     // nobody won in time (draw)
+	DuelEndInterrupted = "interrupted" // a duelist died to something else (draw)
+)
+
+// Duel tuning
+const (
+	duelLeaderboardID  = "duel_wins"
+	duelRadius         = 320.0          // duelists must stay this close to the duel's center
+	duelRequestTicks   = 30 * TickRate  // a challenge can be accepted this long
+	duelCountdownTicks = 3 * TickRate   // damage is allowed once the countdown is over
+	duelMaxTicks       = 180 * TickRate // a duel nobody wins in this time is a draw
+	duelYieldFraction  = 0.1            // a duelist at or below this fraction of max health loses
+	duelCheckInterval  = TickRate / 6   // ticks between area, timeout and disconnect checks
+)
+
+// DuelRequest is a pending challenge
+type DuelRequest struct {
+	From        string
+	To          string
+	ExpiresTick int64
+}
+
+// Duel is a fight between two consenting players. Only the duelists may hurt each other while it runs.
+type Duel struct {
+	Players   [2]string
+	Center    vector.Vector
+	StartTick int64 // damage is allowed from this tick
+	EndTick   int64 // the duel is a draw at this tick
+	Winner    string
+	Loser     string
+	Reason    string // set once the duel is decided; Update then finalizes it
+}
+
+// Opponent returns the other duelist, or "" if playerID isn't in the duel
+func (d *Duel) Opponent(playerID string) string {
+	switch playerID {
+	case d.Players[0]:
+		return d.Players[1]
+	case d.Players[1]:
+		return d.Players[0]
+	}
+	return ""
+}
+
+// finish decides the duel; the first decision wins
+func (d *Duel) finish(winner, loser, reason string) {
+	if d.Reason != "" {
+		return
+	}
+	d.Winner, d.Loser, d.Reason = winner, loser, reason
+}
+
+// DuelEvent is sent to the duelists and players nearby (OpCodeDuel)
+type DuelEvent struct {
+	PlayerID   string   `json:"playerId,omitempty"` // challenger (duel_request) or the player who declined (duel_declined)
+	Username   string   `json:"username,omitempty"`
+	Players    []string `json:"players,omitempty"` // duelists (duel_started, duel_ended)
+	X          float64  `json:"x,omitempty"`
+	Y          float64  `json:"y,omitempty"`
+	Radius     float64  `json:"radius,omitempty"`
+	StartsIn   float64  `json:"startsIn,omitempty"`  // seconds of countdown (duel_started)
+	ExpiresIn  float64  `json:"expiresIn,omitempty"` // seconds to accept (duel_request)
+	WinnerID   string   `json:"winnerId,omitempty"`
+	LoserID    string   `json:"loserId,omitempty"`
+	Reason     string   `json:"reason,omitempty"` // DuelEnd*
+	WinnerWins int      `json:"winnerWins,omitempty"`
+}
+
+// DuelManager tracks challenges and running duels. It is only used from the match loop.
+type DuelManager struct {
+	logger   runtime.Logger
+	requests map[string]*DuelRequest // challenged player -> latest challenge
+	duels    map[string]*Duel        // player -> their duel (both duelists map to the same duel)
+}
+
+// NewDuelManager creates a duel manager without duels
+func NewDuelManager(logger runtime.Logger) *DuelManager {
+	return &DuelManager{
+		logger:   logger,
+		requests: make(map[string]*DuelRequest),
+		duels:    make(map[string]*Duel),
+	}
+}
+
+// DuelOf returns the running duel of a player (nil when not dueling)
+func (dm *DuelManager) DuelOf(playerID string) *Duel {
+	return dm.duels[playerID]
+}
+
+// allowsDamage reports whether the duel rules decide an attack, and if so whether it is allowed:
+// duelists may only hurt their opponent once the countdown is over, and nobody else may hurt them
+func (dm *DuelManager) allowsDamage(attackerID, targetID string, tick int64) (decided, allowed bool) {
+	attackerDuel, targetDuel := dm.duels[attackerID], dm.duels[targetID]
+	if attackerDuel == nil && targetDuel == nil {
+		return false, false
+	}
+	ok := attackerDuel != nil && attackerDuel == targetDuel && attackerDuel.Reason == "" && tick >= attackerDuel.StartTick
+	return true, ok
+}
+
+// Challenge sends a duel request from one player to another. It returns a rejection reason, or "".
+func (dm *DuelManager) Challenge(gs *GameMatchState, fromID, toID string, dispatcher runtime.MatchDispatcher) string {
+	from, to := gs.PlayerBody(fromID), gs.PlayerBody(toID)
+	if from == nil {
+		return RejectNoPlayerObject
+	}
+	if to == nil || fromID == toID || gs.GetPlayerState(toID).IsDead() {
+		return RejectInvalidTarget
+	}
+	if from.Position.Sub(to.Position).Magnitude() > duelRadius {
+		return RejectOutOfRange
+	}
+	if dm.duels[fromID] != nil || dm.duels[toID] != nil {
+		return RejectInDuel
+	}
+
+	dm.requests[toID] = &DuelRequest{From: fromID, To: toID, ExpiresTick: gs.currentTick + duelRequestTicks}
+	event := DuelEvent{PlayerID: fromID, ExpiresIn: float64(duelRequestTicks) / TickRate}
+	if presence, ok := gs.presences[fromID]; ok {
+		event.Username = presence.GetUsername()
+	}
+	dm.send(gs, "duel_request", event, []string{toID}, dispatcher)
+	return ""
+}
+
+// Accept starts the duel challengerID offered to playerID. It returns a rejection reason, or "".
+func (dm *DuelManager) Accept(gs *GameMatchState, playerID, challengerID string, dispatcher runtime.MatchDispatcher) string {
+	request, ok := dm.requests[playerID]
+	if !ok || request.From != challengerID || gs.currentTick >= request.ExpiresTick {
+		return RejectNoRequest
+	}
+	delete(dm.requests, playerID)
+
+	a, b := gs.PlayerBody(challengerID), gs.PlayerBody(playerID)
+	if a == nil || b == nil || gs.GetPlayerState(challengerID).IsDead() {
+		return RejectInvalidTarget
+	}
+	if a.Position.Sub(b.Position).Magnitude() > duelRadius {
+		return RejectOutOfRange
+	}
+	if dm.duels[challengerID] != nil || dm.duels[playerID] != nil {
+		return RejectInDuel
+	}
+
+	duel := &Duel{
+		Players:   [2]string{challengerID, playerID},
+		Center:    a.Position.Add(b.Position).Scale(0.5),
+		StartTick: gs.currentTick + duelCountdownTicks,
+		EndTick:   gs.currentTick + duelCountdownTicks + duelMaxTicks,
+	}
+	dm.duels[challengerID] = duel
+	dm.duels[playerID] = duel
+	dm.logger.Info("Duel started between %s and %s", challengerID, playerID)
+
+	dm.send(gs, "duel_started", DuelEvent{
+		Players:  duel.Players[:],
+		X:        duel.Center.X,
+		Y:        duel.Center.Y,
+		Radius:   duelRadius,
+		StartsIn: float64(duelCountdownTicks) / TickRate,
+	}, duel.Players[:], dispatcher)
+	return ""
+}
+
+// Decline turns down the challenge challengerID offered to playerID. It returns a rejection reason, or "".
+func (dm *DuelManager) Decline(gs *GameMatchState, playerID, challengerID string, dispatcher runtime.MatchDispatcher) string {
+	request, ok := dm.requests[playerID]
+	if !ok || request.From != challengerID {
+		return RejectNoRequest
+	}
+	delete(dm.requests, playerID)
+	dm.send(gs, "duel_declined", DuelEvent{PlayerID: playerID}, []string{challengerID}, dispatcher)
+	return ""
+}
+
+// onDamage checks a hit between duelists: the target never dies from duel damage, and losing
+// enough health decides the duel. Called from damagePlayer after the damage was applied.
+func (dm *DuelManager) onDamage(attackerID string, target *PlayerState) {
+	duel := dm.duels[attackerID]
+	if duel == nil || duel.Opponent(attackerID) != target.PlayerID {
+		return
+	}
+	if target.Health < 1 {
+		target.Health = 1
+	}
+	if target.Health <= target.MaxHealth*duelYieldFraction {
+		duel.finish(attackerID, target.PlayerID, DuelEndDefeated)
+	}
+}
+
+// Update expires challenges and decides duels whose duelists fled, left or died, or that ran out
+// of time; then it finalizes decided duels. Called from the match loop.
+func (dm *DuelManager) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick%duelCheckInterval != 0 {
+		return
+	}
+	for playerID, request := range dm.requests {
+		if gs.currentTick >= request.ExpiresTick || gs.PlayerBody(request.From) == nil {
+			delete(dm.requests, playerID)
+		}
+	}
+
+	finished := make([]*Duel, 0)
+	for playerID, duel := range dm.duels {
+		if playerID != duel.Players[0] {
+			continue // visit each duel once
+		}
+		for _, id := range duel.Players {
+			rb := gs.PlayerBody(id)
+			switch {
+			case rb == nil:
+				duel.finish(duel.Opponent(id), id, DuelEndLeft)
+			case gs.GetPlayerState(id).IsDead():
+				duel.finish("", "", DuelEndInterrupted)
+			case rb.Position.Sub(duel.Center).Magnitude() > duelRadius:
+				duel.finish(duel.Opponent(id), id, DuelEndFled)
+			}
+		}
+		if gs.currentTick >= duel.EndTick {
+			duel.finish("", "", DuelEndTimeout)
+		}
+		if duel.Reason != "" {
+			finished = append(finished, duel)
+		}
+	}
+	for _, duel := range finished {
+		dm.end(ctx, gs, duel, dispatcher)
+	}
+}
+
+// end removes a decided duel, clears the effects the duelists put on each other, records the
+// result and announces it
+func (dm *DuelManager) end(ctx context.Context, gs *GameMatchState, duel *Duel, dispatcher runtime.MatchDispatcher) {
+	for _, id := range duel.Players {
+		delete(dm.duels, id)
+		if gs.PlayerBody(id) == nil {
+			continue
+		}
+		state := gs.GetPlayerState(id)
+		opponent := duel.Opponent(id)
+		for effectID, effect := range state.Effects {
+			if effect.Source.Type == DamageSourcePlayer && effect.Source.ID == opponent {
+				state.RemoveEffect(effectID)
+			}
+		}
+	}
+
+	event := DuelEvent{
+		Players:  duel.Players[:],
+		X:        duel.Center.X,
+		Y:        duel.Center.Y,
+		WinnerID: duel.Winner,
+		LoserID:  duel.Loser,
+		Reason:   duel.Reason,
+	}
+	if duel.Winner != "" {
+		wins, err := gs.databaseManager.RecordDuelResult(ctx, duel.Winner, duel.Loser, gs.usernameOf(duel.Winner))
+		if err != nil {
+			dm.logger.Error("Failed to record duel result (%s beat %s): %v", duel.Winner, duel.Loser, err)
+		}
+		event.WinnerWins = wins
+	}
+	dm.logger.Info("Duel between %s and %s ended: %s (winner %q)", duel.Players[0], duel.Players[1], duel.Reason, duel.Winner)
+
+	// Spectators around the duel see the result too
+	recipients := append([]string(nil), duel.Players[:]...)
+	for playerID, rb := range gs.PlayerBodies() {
+		if playerID != duel.Players[0] && playerID != duel.Players[1] && rb.Position.Sub(duel.Center).Magnitude() <= damageEventRange {
+			recipients = append(recipients, playerID)
+		}
+	}
+	dm.send(gs, "duel_ended", event, recipients, dispatcher)
+}
+
+// send delivers a duel message to the given players that are online
+func (dm *DuelManager) send(gs *GameMatchState, msgType string, event DuelEvent, playerIDs []string, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	presences := make([]runtime.Presence, 0, len(playerIDs))
+	for _, id := range playerIDs {
+		if presence, ok := gs.presences[id]; ok {
+			presences = append(presences, presence)
+		}
+	}
+	if len(presences) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeDuel, msgType, event)
+	if err != nil {
+		dm.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeDuel, data, presences, nil, true)
+}
+
+// duelOpponent returns the opponent of a player's running duel ("" when not dueling)
+func (gs *GameMatchState) duelOpponent(playerID string) string {
+	if duel := gs.duels.DuelOf(playerID); duel != nil {
+		return duel.Opponent(playerID)
+	}
+	return ""
+}
+
+// usernameOf returns the username of an online player ("" when offline)
+func (gs *GameMatchState) usernameOf(playerID string) string {
+	if presence, ok := gs.presences[playerID]; ok {
+		return presence.GetUsername()
+	}
+	return ""
+}
+
+// EnsureDuelLeaderboard creates the authoritative duel wins leaderboard if it doesn't exist yet
+func EnsureDuelLeaderboard(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger) error {
+	if err := nk.LeaderboardCreate(ctx, duelLeaderboardID, true, "desc", "incr", "", map[string]interface{}{}, true); err != nil {
+		return err
+	}
+	logger.Info("Duel leaderboard %s ready", duelLeaderboardID)
+	return nil
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// EventDungeonEnded is published when a dungeon instance is completed, failed or abandoned
+const EventDungeonEnded = "dungeon_ended"
+
+// Dungeon results
+const (
+	DungeonCompleted = "completed" // every boss was killed
+	DungeonFailed    = "failed"    // the time limit ran out
+	DungeonAbandoned = "abandoned" // the whole party left
+)
+
+// Dungeon tuning
+const (
+	dungeonMatchLabel          = "dungeon_instance"
+	dungeonDefinitionsPath     = "/nakama/data/dungeons.json"
+	defaultDungeonTimeLimit    = 1800.0 // seconds
+	defaultDungeonMaxPlayers   = 5
+	dungeonEmptyTimeout        = 60 // seconds an instance waits for its party to (re)join
+	dungeonReturnDelay         = 10 // seconds between the result and the instance shutting down
+	notificationDungeonInvite  = 100
+	dungeonStateSyncInterval   = 5 * TickRate // ticks between dungeon_state refreshes (remaining time)
+	maxDungeonPartyRequestSize = 16
+)
+
+var (
+	errUnknownDungeon    = runtime.NewError("unknown dungeon", rpcCodeNotFound)
+	errDungeonPartySize  = runtime.NewError("party size outside the dungeon's limits", rpcCodeFailedPrecondition)
+	errUnknownPartyMates = runtime.NewError("party contains unknown users", rpcCodeInvalidArgument)
+)
+
+// DungeonDefinition describes an instanced dungeon
+type DungeonDefinition struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Map        string            `json:"map"`
+	MinPlayers int               `json:"minPlayers,omitempty"` // default 1
+	MaxPlayers int               `json:"maxPlayers,omitempty"` // default 5
+	TimeLimit  float64           `json:"timeLimit,omitempty"`  // seconds (default 1800)
+	Bosses     []string          `json:"bosses"`               // NPC types that must all be killed to complete the dungeon
+	Roles      map[string]int    `json:"roles,omitempty"`      // group finder slots per role (default maxPlayers of any role)
+	MinLevel   int               `json:"minLevel,omitempty"`   // group finder level range (0 = no limit)
+	MaxLevel   int               `json:"maxLevel,omitempty"`
+	Rewards    WorldEventRewards `json:"rewards"` // granted to every party member in the instance on completion
+}
+
+// LoadDungeonDefinitions reads the dungeon definitions (a JSON object keyed by dungeon ID)
+func LoadDungeonDefinitions(path string) (map[string]*DungeonDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var dungeons map[string]*DungeonDefinition
+	if err := json.Unmarshal(data, &dungeons); err != nil {
+		return nil, err
+	}
+	for id, def := range dungeons {
+		def.ID = id
+		if def.Name == "" {
+			def.Name = id
+		}
+		if def.MinPlayers <= 0 {
+			def.MinPlayers = 1
+		}
+		if def.MaxPlayers <= 0 {
+			def.MaxPlayers = defaultDungeonMaxPlayers
+		}
+		if def.TimeLimit <= 0 {
+			def.TimeLimit = defaultDungeonTimeLimit
+		}
+	}
+	return dungeons, nil
+}
+
+// DungeonInstance is the state of a dungeon match: its party, seed and progress. Dungeon
+// matches run the same simulation as the open world on the dungeon's map, but start from the
+// map's initial state, don't save world state and never move players' open world positions.
+type DungeonInstance struct {
+	logger       runtime.Logger
+	Def          *DungeonDefinition
+	Party        map[string]bool // player IDs allowed to join
+	Seed         int64
+	DeadlineTick int64
+	Killed       map[string]bool // boss NPC types killed
+	Result       string          // "" while running
+	EndTick      int64           // the match ends at this tick once there is a result
+	emptySince   int64           // tick the last player left (0 while occupied)
+	returnMatch  string          // open world match ID sent with the result
+	resultSent   bool
+}
+
+// NewDungeonInstance creates the state of a new instance for a party
+func NewDungeonInstance(logger runtime.Logger, def *DungeonDefinition, party []string, seed int64) *DungeonInstance {
+	di := &DungeonInstance{
+		logger:       logger,
+		Def:          def,
+		Party:        make(map[string]bool, len(party)),
+		Seed:         seed,
+		DeadlineTick: int64(def.TimeLimit * TickRate),
+		Killed:       make(map[string]bool),
+	}
+	for _, playerID := range party {
+		di.Party[playerID] = true
+	}
+	return di
+}
+
+// SubscribeEvents tracks boss kills
+func (di *DungeonInstance) SubscribeEvents(eb *EventBus) {
+	eb.Subscribe(EventNPCKilled, func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		npcType, _ := event.Data["npcType"].(string)
+		if di.Result != "" || !di.isBoss(npcType) || di.Killed[npcType] {
+			return
+		}
+		di.Killed[npcType] = true
+		if len(di.Killed) == len(di.Def.Bosses) {
+			di.finish(ctx, gs, DungeonCompleted, dispatcher)
+			return
+		}
+		di.broadcastState(gs, dispatcher)
+	})
+}
+
+// CanJoin returns why a player may not join the instance, or ""
+func (di *DungeonInstance) CanJoin(playerID string) string {
+	if !di.Party[playerID] {
+		return "not a member of this dungeon's party"
+	}
+	if di.Result != "" {
+		return "the dungeon is over"
+	}
+	return ""
+}
+
+// Join sends a joining party member the dungeon's progress
+func (di *DungeonInstance) Join(gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	di.emptySince = 0
+	presence, ok := gs.presences[playerID]
+	if !ok {
+		return
+	}
+	di.send(gs, []runtime.Presence{presence}, "dungeon_state", di.state(gs), dispatcher)
+}
+
+// Update fails the dungeon when its time runs out, abandons it when the party stayed away and
+// reports true once the match should end. Called from the match loop.
+func (di *DungeonInstance) Update(ctx context.Context, gs *GameMatchState, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher) bool {
+	if di.Result != "" {
+		if !di.resultSent {
+			di.resultSent = true
+			di.returnMatch = di.returnTarget(ctx, nk)
+			di.broadcastState(gs, dispatcher)
+		}
+		return gs.currentTick >= di.EndTick
+	}
+	if len(gs.presences) == 0 {
+		if di.emptySince == 0 {
+			di.emptySince = gs.currentTick
+		} else if gs.currentTick-di.emptySince >= dungeonEmptyTimeout*TickRate {
+			di.finish(ctx, gs, DungeonAbandoned, dispatcher)
+			// Nobody is left to return
+			return true
+		}
+		return false
+	}
+	di.emptySince = 0
+
+	if gs.currentTick >= di.DeadlineTick {
+		di.finish(ctx, gs, DungeonFailed, dispatcher)
+		return false
+	}
+	if gs.currentTick%dungeonStateSyncInterval == 0 {
+		di.broadcastState(gs, dispatcher)
+	}
+	return false
+}
+
+// Complete ends the dungeon as completed (for scripted objectives). It reports false if the
+// dungeon is already over.
+func (di *DungeonInstance) Complete(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) bool {
+	if di.Result != "" {
+		return false
+	}
+	di.finish(ctx, gs, DungeonCompleted, dispatcher)
+	return true
+}
+
+// returnTarget returns the open world shard players go back to ("" if none can be found)
+func (di *DungeonInstance) returnTarget(ctx context.Context, nk runtime.NakamaModule) string {
+	shard, err := FindShard(ctx, di.logger, nk, defaultWorldMap)
+	if err != nil {
+		di.logger.Warn("Dungeon %s: no open world match to return to: %v", di.Def.ID, err)
+		return ""
+	}
+	return shard.MatchID
+}
+
+// finish records the result, rewards the party on completion and publishes EventDungeonEnded.
+// The next Update sends the result with the match to return to; the match keeps running for
+// dungeonReturnDelay so clients can show it.
+func (di *DungeonInstance) finish(ctx context.Context, gs *GameMatchState, result string, dispatcher runtime.MatchDispatcher) {
+	di.Result = result
+	di.EndTick = gs.currentTick + dungeonReturnDelay*TickRate
+
+	players := make([]string, 0, len(gs.presences))
+	for playerID := range gs.Presences() {
+		players = append(players, playerID)
+		if result == DungeonCompleted {
+			di.reward(ctx, gs, playerID, dispatcher)
+		}
+	}
+	di.logger.Info("Dungeon %s (seed %d) ended: %s with %d players", di.Def.ID, di.Seed, result, len(players))
+	gs.eventBus.Publish(EventDungeonEnded, map[string]any{"dungeon": di.Def.ID, "result": result, "players": players})
+}
+
+// reward grants the dungeon's rewards to one party member and tells them what they got
+func (di *DungeonInstance) reward(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	granted := WorldEventReward{ID: di.Def.ID, Items: make(map[string]int)}
+	stacks := make([]LootStack, 0, len(di.Def.Rewards.Items))
+	for itemID, count := range di.Def.Rewards.Items {
+		stacks = append(stacks, LootStack{ItemID: itemID, Count: count})
+	}
+	if di.Def.Rewards.Loot != "" {
+		stacks = append(stacks, gs.lootCatalog.Roll(gs, di.Def.Rewards.Loot, LootContext{PlayerID: playerID})...)
+	}
+	// The match ID makes the key unique per instance, so a party member is rewarded once
+	entry := &JournalEntry{Key: gs.journal.Key("dungeon", di.Def.ID), Kind: JournalItemGrant, PlayerID: playerID, Items: stackItems(stacks), Currency: di.Def.Rewards.Currency, Source: "dungeon:" + di.Def.ID}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		return
+	}
+	var grantErr error
+	for _, stack := range stacks {
+		if err := gs.inventoryManager.Add(ctx, playerID, stack.ItemID, stack.Count); err != nil {
+			di.logger.Error("Dungeon %s: failed to give %d x %s to %s: %v", di.Def.ID, stack.Count, stack.ItemID, playerID, err)
+			grantErr = err
+			continue
+		}
+		granted.Items[stack.ItemID] += stack.Count
+	}
+	if len(di.Def.Rewards.Currency) > 0 {
+		metadata := map[string]interface{}{"reason": "dungeon", "dungeon": di.Def.ID}
+		if err := gs.databaseManager.UpdateWallet(ctx, playerID, di.Def.Rewards.Currency, metadata); err != nil {
+			di.logger.Error("Dungeon %s: failed to pay %s: %v", di.Def.ID, playerID, err)
+			grantErr = err
+		} else {
+			granted.Currency = di.Def.Rewards.Currency
+		}
+	}
+	entry.Items, entry.Currency = granted.Items, granted.Currency
+	gs.journal.Finish(ctx, entry, grantErr)
+
+	presence, online := gs.presences[playerID]
+	if !online {
+		return
+	}
+	if len(granted.Items) > 0 {
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	}
+	di.send(gs, []runtime.Presence{presence}, "dungeon_reward", granted, dispatcher)
+}
+
+// state returns the dungeon's progress for clients
+func (di *DungeonInstance) state(gs *GameMatchState) map[string]any {
+	bosses := make([]map[string]any, 0, len(di.Def.Bosses))
+	for _, npcType := range di.Def.Bosses {
+		bosses = append(bosses, map[string]any{"type": npcType, "killed": di.Killed[npcType]})
+	}
+	remaining := float64(di.DeadlineTick-gs.currentTick) / TickRate
+	if di.Result != "" {
+		remaining = 0
+	}
+	state := map[string]any{
+		"id":        di.Def.ID,
+		"name":      di.Def.Name,
+		"seed":      di.Seed,
+		"bosses":    bosses,
+		"remaining": remaining,
+		"result":    di.Result,
+	}
+	if di.Result != "" {
+		state["closesIn"] = float64(di.EndTick-gs.currentTick) / TickRate
+		state["returnMatchId"] = di.returnMatch
+	}
+	return state
+}
+
+// isBoss reports whether killing the NPC type counts towards completion
+func (di *DungeonInstance) isBoss(npcType string) bool {
+	for _, boss := range di.Def.Bosses {
+		if boss == npcType {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcastState sends dungeon_state to everyone in the instance
+func (di *DungeonInstance) broadcastState(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	di.send(gs, nil, "dungeon_state", di.state(gs), dispatcher)
+}
+
+// send delivers an OpCodeDungeon message (to everyone when presences is nil)
+func (di *DungeonInstance) send(gs *GameMatchState, presences []runtime.Presence, msgType string, data any, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	payload, err := EncodeMessage(OpCodeDungeon, msgType, data)
+	if err != nil {
+		di.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeDungeon, payload, presences, nil, true)
+}
+
+// RegisterDungeonRpcs registers the RPCs players use to start dungeon instances and find groups
+func RegisterDungeonRpcs(initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("dungeon_create", rpcDungeonCreate); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("group_finder_join", rpcGroupFinderJoin); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("group_finder_leave", rpcGroupFinderLeave); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("group_finder_status", rpcGroupFinderStatus); err != nil {
+		return err
+	}
+	return nil
+}
+
+// rpcDungeonCreate creates a private dungeon instance for the caller and their party and sends
+// the other members an invite notification with the match ID.
+// Payload: {"dungeon": "crypt", "party": ["userId", ...], "seed": 0}
+func rpcDungeonCreate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", runtime.NewError("dungeons are created by players", rpcCodeUnauthenticated)
+	}
+
+	var req struct {
+		Dungeon string   `json:"dungeon"`
+		Party   []string `json:"party"`
+		Seed    int64    `json:"seed"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.Dungeon == "" || len(req.Party) > maxDungeonPartyRequestSize {
+		return "", errInvalidPayload
+	}
+
+	dungeons, err := LoadDungeonDefinitions(dungeonDefinitionsPath)
+	if err != nil {
+		logger.Error("Failed to load dungeons: %v", err)
+		return "", errInternalFailure
+	}
+	def, ok := dungeons[req.Dungeon]
+	if !ok {
+		return "", errUnknownDungeon
+	}
+
+	party := []string{userID}
+	seen := map[string]bool{userID: true}
+	for _, id := range req.Party {
+		if !seen[id] {
+			seen[id] = true
+			party = append(party, id)
+		}
+	}
+	if len(party) < def.MinPlayers || len(party) > def.MaxPlayers {
+		return "", errDungeonPartySize
+	}
+	if len(party) > 1 {
+		users, err := nk.UsersGetId(ctx, party[1:], nil)
+		if err != nil {
+			logger.Error("Failed to look up dungeon party: %v", err)
+			return "", errInternalFailure
+		}
+		if len(users) != len(party)-1 {
+			return "", errUnknownPartyMates
+		}
+	}
+
+	matchID, err := CreateDungeonMatch(ctx, nk, logger, def, party, req.Seed)
+	if err != nil {
+		logger.Error("Failed to create dungeon %s: %v", def.ID, err)
+		return "", errInternalFailure
+	}
+
+	out, err := json.Marshal(map[string]any{"matchId": matchID, "dungeon": def.ID, "party": party})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// CreateDungeonMatch starts a dungeon instance for a party (seed 0 picks a random seed) and
+// invites every member but the first, who created it, with a notification
+func CreateDungeonMatch(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, def *DungeonDefinition, party []string, seed int64) (string, error) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	partyJSON, err := json.Marshal(party)
+	if err != nil {
+		return "", err
+	}
+	matchID, err := nk.MatchCreate(ctx, "game", map[string]interface{}{
+		"map":     def.Map,
+		"dungeon": def.ID,
+		"party":   string(partyJSON),
+		"seed":    seed,
+	})
+	if err != nil {
+		return "", err
+	}
+	logger.Info("Dungeon %s instance %s created for %d players (seed %d)", def.ID, matchID, len(party), seed)
+
+	content := map[string]interface{}{"matchId": matchID, "dungeon": def.ID, "name": def.Name}
+	for _, playerID := range party[1:] {
+		if err := nk.NotificationSend(ctx, playerID, "Dungeon invite", content, notificationDungeonInvite, party[0], false); err != nil {
+			logger.Warn("Failed to invite %s to dungeon %s: %v", playerID, matchID, err)
+		}
+	}
+	return matchID, nil
+}
+
+// dungeonFromParams builds the instance described by a dungeon match's creation parameters
+func dungeonFromParams(logger runtime.Logger, params map[string]interface{}) (*DungeonInstance, error) {
+	id, _ := params["dungeon"].(string)
+	dungeons, err := LoadDungeonDefinitions(dungeonDefinitionsPath)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := dungeons[id]
+	if !ok {
+		return nil, errUnknownDungeon
+	}
+	var party []string
+	if s, ok := params["party"].(string); ok {
+		if err := json.Unmarshal([]byte(s), &party); err != nil {
+			return nil, err
+		}
+	}
+	var seed int64
+	switch v := params["seed"].(type) {
+	case int64:
+		seed = v
+	case float64:
+		seed = int64(v)
+	}
+	return NewDungeonInstance(logger, def, party, seed), nil
+}
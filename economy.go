@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Currency sinks: what players pay fees for. Each is also the key of its rate in the economy
+// world settings.
+const (
+	SinkTravel     = "travel"      // waypoint travel; multiplies the waypoint's cost
+	SinkListing    = "listing"     // auction listings; share of the starting price charged up front
+	SinkAuctionCut = "auction_cut" // auction sales; share of the price the house keeps
+	SinkRepair     = "repair"      // repairs scripts sell; multiplies the script's base cost
+	SinkShop       = "shop"        // vendor purchases; multiplies the shop's prices
+)
+
+// defaultEconomyRates are the rates of sinks the economy settings leave out. Scripts may price
+// other sinks too (e.g. "training"); those default to 1.
+var defaultEconomyRates = map[string]float64{
+	SinkTravel:     1,
+	SinkListing:    0.02,
+	SinkAuctionCut: auctionHouseCut,
+	SinkRepair:     1,
+	SinkShop:       1,
+}
+
+// shareSinks are the sinks whose rate is a share of a price, so at most 1
+var shareSinks = map[string]bool{SinkListing: true, SinkAuctionCut: true}
+
+// Economy tuning
+const (
+	economyStatsHours  = 48     // hours of currency flows admin_economy reports
+	defaultFeeCurrency = "gold" // currency charge_fee takes without one
+)
+
+var errInvalidEconomyRates = runtime.NewError("invalid economy rates: rates must not be negative, listing and auction_cut at most 1", rpcCodeInvalidArgument)
+
+// economyRate returns the rate of a sink in the settings, or its default
+func economyRate(settings *WorldSettings, sink string) float64 {
+	if settings != nil {
+		if rate, ok := settings.Economy[sink]; ok {
+			return rate
+		}
+	}
+	if rate, ok := defaultEconomyRates[sink]; ok {
+		return rate
+	}
+	return 1
+}
+
+// economyRates returns the rates of every known sink plus the ones the settings add
+func economyRates(settings *WorldSettings) map[string]float64 {
+	rates := make(map[string]float64, len(defaultEconomyRates))
+	for sink := range defaultEconomyRates {
+		rates[sink] = economyRate(settings, sink)
+	}
+	if settings != nil {
+		for sink, rate := range settings.Economy {
+			rates[sink] = rate
+		}
+	}
+	return rates
+}
+
+// validEconomyRates checks the economy rates of world settings
+func validEconomyRates(rates map[string]float64) bool {
+	for sink, rate := range rates {
+		if rate < 0 || math.IsNaN(rate) || math.IsInf(rate, 0) || (shareSinks[sink] && rate > 1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Price returns what a sink charges for base: base times the sink's rate, rounded up so a fee
+// above zero never rounds away
+func (gs *GameMatchState) Price(sink string, base int64) int64 {
+	if base <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(float64(base) * economyRate(gs.worldSettings, sink)))
+}
+
+// ChargeFee takes a sink's fee (already priced) from a player's wallet. It returns a reject
+// reason, or "" when paid (or when the fee is 0).
+func (gs *GameMatchState) ChargeFee(ctx context.Context, playerID, sink, currency string, fee int64) string {
+	if fee <= 0 {
+		return ""
+	}
+	source := "fee:" + sink
+	changeset := map[string]int64{currency: -fee}
+	entry := &JournalEntry{Key: gs.journal.UniqueKey("fee", sink), Kind: JournalCurrency, PlayerID: playerID, Currency: changeset, Source: source}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		return RejectRateLimited
+	}
+	// The wallet update fails rather than go negative
+	err := gs.databaseManager.UpdateWallet(ctx, playerID, changeset, map[string]interface{}{"source": source})
+	gs.journal.Finish(ctx, entry, err)
+	if err != nil {
+		return RejectCannotAfford
+	}
+	return ""
+}
+
+// walletReject is the reject reason for a wallet update taking amount of currency that failed:
+// cannot_afford when the player's balance is short of it, storage_error when it failed otherwise
+func (gs *GameMatchState) walletReject(ctx context.Context, playerID, currency string, amount int64) string {
+	_, wallet, err := accountWallet(ctx, gs.databaseManager.nk, playerID)
+	if err == nil && wallet[currency] < amount {
+		return RejectCannotAfford
+	}
+	return RejectStorageError
+}
+
+// RefundFee gives a fee back to a player when what it paid for didn't happen
+func (gs *GameMatchState) RefundFee(ctx context.Context, playerID, sink, currency string, fee int64) error {
+	if fee <= 0 {
+		return nil
+	}
+	source := "fee_refund:" + sink
+	changeset := map[string]int64{currency: fee}
+	entry := &JournalEntry{Key: gs.journal.UniqueKey("fee_refund", sink), Kind: JournalCurrency, PlayerID: playerID, Currency: changeset, Source: source}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		return err
+	}
+	err := gs.databaseManager.UpdateWallet(ctx, playerID, changeset, map[string]interface{}{"source": source})
+	gs.journal.Finish(ctx, entry, err)
+	return err
+}
+
+// EconomyHour is the currency created and destroyed in one hour, per currency, and the net
+// change per source (what caused it: a reward, a fee, ...)
+type EconomyHour struct {
+	Hour      time.Time                   `json:"hour"`
+	Created   map[string]int64            `json:"created"`
+	Destroyed map[string]int64            `json:"destroyed"`
+	Sources   map[string]map[string]int64 `json:"sources"` // source -> currency -> net change
+}
+
+// EconomyStats counts the currency entering and leaving the players' wallets. Every amount is
+// handed to Nakama's metrics as the economy_currency_created and economy_currency_destroyed
+// counters (tagged with currency and source), and kept per hour for admin_economy. Transfers
+// between players (trades, auction escrow) aren't flows; the auction house's cut is. Shared by
+// every match and RPC of the node.
+type EconomyStats struct {
+	mu    sync.Mutex
+	nk    runtime.NakamaModule
+	hours []*EconomyHour // oldest first, at most economyStatsHours
+}
+
+// economy is the node's currency flow statistics, set up by InitModule
+var economy *EconomyStats
+
+// NewEconomyStats creates the flow statistics of the node
+func NewEconomyStats(nk runtime.NakamaModule) *EconomyStats {
+	return &EconomyStats{nk: nk}
+}
+
+// Record counts a wallet changeset: positive amounts were created, negative ones destroyed
+func (es *EconomyStats) Record(source string, changeset map[string]int64) {
+	if es == nil {
+		return
+	}
+	if source == "" {
+		source = "other"
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	hour := es.current(time.Now().UTC())
+	for currency, amount := range changeset {
+		if amount == 0 {
+			continue
+		}
+		tags := map[string]string{"currency": currency, "source": source}
+		if amount > 0 {
+			hour.Created[currency] += amount
+			es.nk.MetricsCounterAdd("economy_currency_created", tags, amount)
+		} else {
+			hour.Destroyed[currency] -= amount
+			es.nk.MetricsCounterAdd("economy_currency_destroyed", tags, -amount)
+		}
+		if hour.Sources[source] == nil {
+			hour.Sources[source] = make(map[string]int64)
+		}
+		hour.Sources[source][currency] += amount
+	}
+}
+
+// Hours returns copies of the recorded hours, oldest first
+func (es *EconomyStats) Hours() []EconomyHour {
+	if es == nil {
+		return []EconomyHour{}
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	hours := make([]EconomyHour, 0, len(es.hours))
+	for _, hour := range es.hours {
+		copied := EconomyHour{Hour: hour.Hour, Created: make(map[string]int64), Destroyed: make(map[string]int64), Sources: make(map[string]map[string]int64)}
+		for currency, amount := range hour.Created {
+			copied.Created[currency] = amount
+		}
+		for currency, amount := range hour.Destroyed {
+			copied.Destroyed[currency] = amount
+		}
+		for source, amounts := range hour.Sources {
+			copied.Sources[source] = make(map[string]int64, len(amounts))
+			for currency, amount := range amounts {
+				copied.Sources[source][currency] = amount
+			}
+		}
+		hours = append(hours, copied)
+	}
+	return hours
+}
+
+// current returns the bucket of the hour now falls in, starting it (and dropping the oldest)
+// when the hour is new
+func (es *EconomyStats) current(now time.Time) *EconomyHour {
+	start := now.Truncate(time.Hour)
+	if n := len(es.hours); n > 0 && es.hours[n-1].Hour.Equal(start) {
+		return es.hours[n-1]
+	}
+	hour := &EconomyHour{Hour: start, Created: make(map[string]int64), Destroyed: make(map[string]int64), Sources: make(map[string]map[string]int64)}
+	es.hours = append(es.hours, hour)
+	if len(es.hours) > economyStatsHours {
+		es.hours = es.hours[len(es.hours)-economyStatsHours:]
+	}
+	return hour
+}
+
+// walletSource returns what a wallet update's metadata says caused it
+func walletSource(metadata map[string]interface{}) string {
+	for _, key := range []string{"source", "reason"} {
+		if source, ok := metadata[key].(string); ok && source != "" {
+			return source
+		}
+	}
+	return ""
+}
+
+// rpcAdminEconomy returns the economy rates in effect and the currency flows of the last hours,
+// or changes rates and has every running match apply them. Rates set to null go back to their
+// default.
+// Payload: {} to read, or {"rates": {"travel": 1.5, "listing": 0.05, "auction_cut": null}}
+func rpcAdminEconomy(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		Rates map[string]*float64 `json:"rates"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	matches := 0
+	var settings *WorldSettings
+	var err error
+	if len(req.Rates) == 0 {
+		if settings, err = dm.LoadWorldSettings(ctx); err != nil {
+			return "", errInternalFailure
+		}
+	} else {
+		sinks := make([]string, 0, len(req.Rates))
+		for sink := range req.Rates {
+			sinks = append(sinks, sink)
+		}
+		settings, err = updateWorldSettings(ctx, dm, func(settings *WorldSettings) error {
+			changed := make(map[string]float64, len(settings.Economy)+len(req.Rates))
+			for sink, rate := range settings.Economy {
+				changed[sink] = rate
+			}
+			for sink, rate := range req.Rates {
+				if rate == nil {
+					delete(changed, sink)
+				} else {
+					changed[sink] = *rate
+				}
+			}
+			if !validEconomyRates(changed) {
+				return errInvalidEconomyRates
+			}
+			settings.Economy = changed
+			return nil
+		})
+		if err == errInvalidEconomyRates {
+			return "", err
+		} else if err != nil {
+			return "", errInternalFailure
+		}
+		responses, err := signalMatches(ctx, logger, nk, "", MatchSignalRequest{Type: SignalWorldSettings})
+		if err != nil {
+			return "", err
+		}
+		matches = len(responses)
+		sort.Strings(sinks)
+		logger.Info("Economy rates changed: %v", sinks)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{"rates": economyRates(settings), "hours": economy.Hours(), "matches": matches})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
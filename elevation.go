@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Elevation tuning
+const (
+	ledgeObjectType           = "ledge"
+	fallSafeLevels            = 1.0          // levels a player drops without getting hurt
+	fallDamagePerLevel        = 15.0         // damage per level dropped beyond fallSafeLevels
+	rampMaxStep               = 1.0          // levels a ramp tile lets bodies walk up or down
+	elevationTeleportDistance = 2 * TileSize // moves longer than this in one tick are teleports: no climb check, no fall
+)
+
+// Bus event published when a player drops to lower ground
+const EventPlayerFell = "player_fell" // playerId, levels, x, y
+
+// Ledge is a "ledge" map object: a one-way collider bodies pass in its Drop direction (jumping
+// down a cliff) and bump into from everywhere else
+type Ledge struct {
+	Body *rigidbody.RigidBody
+	Drop vector.Vector // unit direction bodies may cross in
+}
+
+// ledgeDirections are the "drop" property values of ledges
+var ledgeDirections = map[string]vector.Vector{
+	"down":  {X: 0, Y: 1},
+	"up":    {X: 0, Y: -1},
+	"left":  {X: -1, Y: 0},
+	"right": {X: 1, Y: 0},
+}
+
+// parseLedge reads a "ledge" rectangle and its "drop" direction (default down)
+func (ml *MapLoader) parseLedge(obj *TiledObject) (Ledge, bool) {
+	if obj.Width <= 0 || obj.Height <= 0 {
+		ml.logger.Warn("Ledge %d is not a rectangle; skipping", obj.ID)
+		return Ledge{}, false
+	}
+	drop := "down"
+	for _, p := range obj.Properties {
+		if v, ok := p.Value.(string); ok && strings.ToLower(p.Name) == "drop" {
+			drop = strings.ToLower(v)
+		}
+	}
+	dir, ok := ledgeDirections[drop]
+	if !ok {
+		ml.logger.Warn("Ledge %d has unknown drop direction %q; skipping", obj.ID, drop)
+		return Ledge{}, false
+	}
+	body := MakeRectangleRigidBody(obj.X+obj.Width/2, obj.Y+obj.Height/2, obj.Width, obj.Height)
+	return Ledge{Body: body, Drop: dir}, true
+}
+
+// SetOneWay makes a static body a ledge bodies pass through while moving along drop. A zero
+// drop makes it a plain collider again.
+func (pe *PhysicsEngine) SetOneWay(rb *rigidbody.RigidBody, drop vector.Vector) {
+	if drop.X == 0 && drop.Y == 0 {
+		delete(pe.oneWay, rb)
+		return
+	}
+	pe.oneWay[rb] = drop
+}
+
+// passesLedge reports whether one body of an overlapping pair is crossing a ledge the other is,
+// in the ledge's drop direction. The pair then stays apart until it separates, so a body that
+// stops halfway down isn't pushed back up.
+func (pe *PhysicsEngine) passesLedge(a, b *rigidbody.RigidBody) bool {
+	for _, pair := range [2][2]*rigidbody.RigidBody{{a, b}, {b, a}} {
+		drop, ok := pe.oneWay[pair[1]]
+		if !ok || !pair[0].IsMovable {
+			continue
+		}
+		if pair[0].Velocity.X*drop.X+pair[0].Velocity.Y*drop.Y > 0 {
+			pe.SeparateBodies(pair[0], pair[1])
+			return true
+		}
+	}
+	return false
+}
+
+// ElevationAt returns the height level of the ground at a position: the "elevation" property of
+// the topmost tile layer that has one and a tile there (0 elsewhere), and whether that tile is a
+// ramp (a tile with a "ramp" property) bodies may walk up and down
+func (gs *GameMatchState) ElevationAt(position vector.Vector) (float64, bool) {
+	lm := gs.currentMap
+	if lm == nil || lm.TileWidth <= 0 || lm.TileHeight <= 0 || position.X < 0 || position.Y < 0 {
+		return 0, false
+	}
+	tx := int(position.X) / lm.TileWidth
+	ty := int(position.Y) / lm.TileHeight
+	for i := len(lm.TileLayers) - 1; i >= 0; i-- {
+		layer := &lm.TileLayers[i]
+		if !layer.HasElevation || tx >= layer.Width || ty >= layer.Height {
+			continue
+		}
+		gid := layer.Data[ty*layer.Width+tx]
+		if gid == 0 {
+			continue
+		}
+		ramp, _ := lm.TileProperties[int(gid)]["ramp"].(bool)
+		return layer.Elevation, ramp
+	}
+	return 0, false
+}
+
+// UpdateElevation follows the players over the map's height levels after physics moved them.
+// Walking onto higher ground is refused (the player is put back where they stood) unless a ramp
+// tile leads there; dropping to lower ground hurts by the levels fallen beyond fallSafeLevels.
+// Players who died or were moved by the server (a queued position correction other than a
+// collision push, or a jump further than elevationTeleportDistance) just take the level they are on.
+func (gs *GameMatchState) UpdateElevation(dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	for playerID, rb := range gs.PlayerBodies() {
+		if rb == nil {
+			continue
+		}
+		state := gs.GetPlayerState(playerID)
+		level, ramp := gs.ElevationAt(rb.Position)
+		cause, corrected := gs.corrections.pending[playerID]
+		moved := corrected && cause != CorrectionCollision
+		if !state.groundKnown || moved || state.IsDead() || rb.Position.Sub(state.groundPos).Magnitude() > elevationTeleportDistance {
+			state.Elevation, state.groundRamp, state.groundPos, state.groundKnown = level, ramp, rb.Position, true
+			continue
+		}
+
+		change := level - state.Elevation
+		switch {
+		case change == 0:
+		case (ramp || state.groundRamp) && math.Abs(change) <= rampMaxStep:
+		case change > 0:
+			// A cliff face: back to where the player stood
+			rb.Position = state.groundPos
+			rb.Velocity = vector.Vector{X: 0, Y: 0}
+			gs.corrections.Queue(playerID, CorrectionElevation)
+			continue
+		default:
+			if fallen := -change - fallSafeLevels; fallen > 0 {
+				source := DamageSource{Type: DamageSourceEnvironment, ID: "fall"}
+				gs.DamagePlayer(playerID, source, fallen*fallDamagePerLevel, DamageFall, dispatcher, logger)
+			}
+			gs.eventBus.Publish(EventPlayerFell, map[string]any{"playerId": playerID, "levels": -change, "x": rb.Position.X, "y": rb.Position.Y})
+		}
+		state.Elevation, state.groundRamp, state.groundPos = level, ramp, rb.Position
+	}
+}
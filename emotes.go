@@ -0,0 +1,31 @@
+package main
+
+// emoteRange is how far (pixels) emotes are relayed; players further away don't receive them.
+// The two-per-second limit lives in actionLimits.
+const emoteRange = 640.0
+
+// allowedEmotes lists the emote IDs clients may send; anything else is rejected
+var allowedEmotes = map[string]bool{
+	"wave":    true,
+	"bow":     true,
+	"cheer":   true,
+	"dance":   true,
+	"laugh":   true,
+	"point":   true,
+	"sit":     true,
+	"shrug":   true,
+	"thumbs":  true,
+	"salute":  true,
+	"cry":     true,
+	"angry":   true,
+	"confuse": true,
+}
+
+// EmoteEvent is relayed to nearby players when someone emotes
+type EmoteEvent struct {
+	PlayerID string  `json:"playerId"`
+	EmoteID  string  `json:"emoteId"`
+	TargetID string  `json:"targetId,omitempty"` // optional player the emote is aimed at
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// What starts an encounter
+const (
+	EncounterTriggerEnter  = "enter"  // a living player walks into the area (default)
+	EncounterTriggerEvent  = "event"  // the world event named by Event starts
+	EncounterTriggerManual = "manual" // only scripts start it (start_encounter)
+)
+
+// Encounter states sent in encounter messages
+const (
+	EncounterIdle      = "idle"      // waiting for its trigger
+	EncounterRunning   = "running"   // waves are spawning or alive
+	EncounterCompleted = "completed" // every wave was defeated; cooling down
+	EncounterFailed    = "failed"    // time ran out, the area emptied or it was stopped; cooling down
+)
+
+// Encounter notifications published on the event bus
+const (
+	EventEncounterStarted   = "encounter_started"   // area, encounter
+	EventEncounterWave      = "encounter_wave"      // area, encounter, wave (1-based), npcs
+	EventEncounterCompleted = "encounter_completed" // area, encounter, participants
+	EventEncounterFailed    = "encounter_failed"    // area, encounter, wave
+)
+
+// Encounter tuning
+const (
+	encounterObjectType       = "encounter"
+	encounterCheckInterval    = TickRate / 4 // ticks between encounter checks
+	defaultEncounterResetTime = 10.0         // seconds without a living player in the area before a running encounter fails
+	defaultEncounterCooldown  = 60.0         // seconds before an encounter that ended can start again
+)
+
+// EncounterDefinition describes a wave encounter: NPC waves spawned one after the other in an
+// area, rewarding the players who took part once every wave is defeated
+type EncounterDefinition struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Trigger   string            `json:"trigger,omitempty"`   // EncounterTrigger* (default enter)
+	Event     string            `json:"event,omitempty"`     // world event that starts it (trigger "event"); it fails when the event ends first
+	Waves     []EncounterWave   `json:"waves"`               // spawned in order
+	TimeLimit float64           `json:"timeLimit,omitempty"` // seconds to defeat every wave (0 = no limit)
+	ResetTime float64           `json:"resetTime,omitempty"` // seconds the area may stay without living players (default defaultEncounterResetTime)
+	Cooldown  float64           `json:"cooldown,omitempty"`  // seconds before it can start again (default defaultEncounterCooldown)
+	Script    string            `json:"script,omitempty"`    // runs with ctx.event = started/wave/completed/failed
+	Rewards   WorldEventRewards `json:"rewards"`             // granted to every participant on completion
+}
+
+// EncounterWave is one wave of NPCs
+type EncounterWave struct {
+	Spawns     []WorldEventBoss `json:"spawns"`               // NPCs to spawn; without a marker or x/y they spawn at the area's center
+	Delay      float64          `json:"delay,omitempty"`      // seconds after the previous wave started (or was cleared with afterClear)
+	AfterClear bool             `json:"afterClear,omitempty"` // wait until every NPC of the earlier waves is dead
+	Message    string           `json:"message,omitempty"`    // announced with the wave
+}
+
+// EncounterArea is a rectangular "encounter" map object running an encounter definition
+type EncounterArea struct {
+	Name      string // unique area ID (object name, default the encounter ID)
+	Encounter string // definition ID ("encounter" property, default the object name)
+	Min       vector.Vector
+	Max       vector.Vector
+}
+
+// Contains reports whether a point lies inside the area
+func (a *EncounterArea) Contains(p vector.Vector) bool {
+	return p.X >= a.Min.X && p.X <= a.Max.X && p.Y >= a.Min.Y && p.Y <= a.Max.Y
+}
+
+// Center returns the middle of the area
+func (a *EncounterArea) Center() vector.Vector {
+	return vector.Vector{X: (a.Min.X + a.Max.X) / 2, Y: (a.Min.Y + a.Max.Y) / 2}
+}
+
+// Encounter is the state of an encounter area
+type Encounter struct {
+	Area         *EncounterArea
+	Def          *EncounterDefinition
+	State        string          // Encounter*
+	Wave         int             // waves spawned so far
+	NPCs         []int           // living NPCs of the spawned waves
+	Participants map[string]bool // living players seen in the area while it ran
+	startTick    int64
+	nextWave     int64 // tick the next wave spawns (-1: once the earlier waves are cleared)
+	emptySince   int64 // tick the area was last seen without living players (0 while occupied)
+	readyTick    int64 // a completed or failed encounter becomes idle at this tick
+}
+
+// EncounterData is an encounter as sent to clients (OpCodeEncounter)
+type EncounterData struct {
+	ID        string  `json:"id"` // area
+	Encounter string  `json:"encounter"`
+	Name      string  `json:"name"`
+	State     string  `json:"state"`
+	Wave      int     `json:"wave"`
+	Waves     int     `json:"waves"`
+	Remaining float64 `json:"remaining,omitempty"` // seconds left of the time limit
+	Message   string  `json:"message,omitempty"`   // the latest wave's announcement
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+}
+
+// EncounterManager runs the wave encounters of the map's "encounter" areas: it starts them on
+// their trigger, spawns their waves through the NPC manager, rewards the participants when the
+// last wave falls and resets them when they fail. It is only used from the match loop.
+type EncounterManager struct {
+	logger     runtime.Logger
+	defs       map[string]*EncounterDefinition
+	encounters map[string]*Encounter // area name -> encounter
+	next       int64
+}
+
+// NewEncounterManager creates a manager and loads definitions from path (a JSON object keyed by encounter ID)
+func NewEncounterManager(logger runtime.Logger, path string) *EncounterManager {
+	em := &EncounterManager{
+		logger:     logger,
+		defs:       make(map[string]*EncounterDefinition),
+		encounters: make(map[string]*Encounter),
+	}
+	if err := em.Load(path); err != nil {
+		logger.Warn("Failed to load encounter definitions from %s: %v", path, err)
+	}
+	return em
+}
+
+// Load replaces the encounter definitions with the ones found in path
+func (em *EncounterManager) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var defs map[string]*EncounterDefinition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return err
+	}
+	for id, def := range defs {
+		def.ID = id
+		if def.Name == "" {
+			def.Name = id
+		}
+		switch def.Trigger {
+		case "":
+			def.Trigger = EncounterTriggerEnter
+		case EncounterTriggerEnter, EncounterTriggerManual:
+		case EncounterTriggerEvent:
+			if def.Event == "" {
+				em.logger.Warn("Encounter %s is started by a world event but names none; only scripts start it", id)
+			}
+		default:
+			em.logger.Warn("Encounter %s has unknown trigger %q; using %s", id, def.Trigger, EncounterTriggerEnter)
+			def.Trigger = EncounterTriggerEnter
+		}
+		if def.ResetTime <= 0 {
+			def.ResetTime = defaultEncounterResetTime
+		}
+		if def.Cooldown <= 0 {
+			def.Cooldown = defaultEncounterCooldown
+		}
+		for i := range def.Waves {
+			for j := range def.Waves[i].Spawns {
+				if def.Waves[i].Spawns[j].Count <= 0 {
+					def.Waves[i].Spawns[j].Count = 1
+				}
+			}
+		}
+	}
+	em.defs = defs
+
+	em.logger.Info("Loaded %d encounter definitions from %s", len(defs), path)
+	return nil
+}
+
+// LoadFromMap registers the map's encounter areas, all idle
+func (em *EncounterManager) LoadFromMap(gs *GameMatchState) {
+	em.encounters = make(map[string]*Encounter)
+	if gs.currentMap == nil {
+		return
+	}
+	for i := range gs.currentMap.Encounters {
+		area := &gs.currentMap.Encounters[i]
+		def, ok := em.defs[area.Encounter]
+		if !ok {
+			em.logger.Warn("Encounter area %q runs unknown encounter %q; skipping it", area.Name, area.Encounter)
+			continue
+		}
+		if _, taken := em.encounters[area.Name]; taken {
+			em.logger.Warn("Duplicate encounter area %q; skipping it", area.Name)
+			continue
+		}
+		em.encounters[area.Name] = &Encounter{Area: area, Def: def, State: EncounterIdle}
+	}
+	em.logger.Info("Registered %d encounter areas", len(em.encounters))
+}
+
+// SubscribeEvents starts the encounters triggered by world events when their event starts, and
+// fails them if the event ends before they are done
+func (em *EncounterManager) SubscribeEvents(eb *EventBus) {
+	eb.Subscribe(EventWorldEventStart, func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		id, _ := event.Data["id"].(string)
+		for _, name := range em.sortedAreas() {
+			encounter := em.encounters[name]
+			if encounter.Def.Trigger == EncounterTriggerEvent && encounter.Def.Event == id && encounter.State == EncounterIdle {
+				em.start(ctx, gs, encounter, dispatcher)
+			}
+		}
+	})
+	eb.Subscribe(EventWorldEventEnd, func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		id, _ := event.Data["id"].(string)
+		for _, name := range em.sortedAreas() {
+			encounter := em.encounters[name]
+			if encounter.Def.Trigger == EncounterTriggerEvent && encounter.Def.Event == id && encounter.State == EncounterRunning {
+				em.fail(ctx, gs, encounter, dispatcher)
+			}
+		}
+	})
+}
+
+// Join sends a joining player the encounters that aren't idle
+func (em *EncounterManager) Join(gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	if !ok {
+		return
+	}
+	for _, name := range em.sortedAreas() {
+		if encounter := em.encounters[name]; encounter.State != EncounterIdle {
+			em.send(gs, encounter, "", []runtime.Presence{presence}, dispatcher)
+		}
+	}
+}
+
+// Update starts the encounters players walked into, spawns the waves that are due, completes the
+// encounters whose last wave fell and fails the ones that ran out of time or players. Called
+// from the match loop.
+func (em *EncounterManager) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if len(em.encounters) == 0 || gs.currentTick < em.next {
+		return
+	}
+	em.next = gs.currentTick + encounterCheckInterval
+	for _, name := range em.sortedAreas() {
+		encounter := em.encounters[name]
+		inside := em.livingPlayersIn(gs, encounter.Area)
+
+		switch encounter.State {
+		case EncounterCompleted, EncounterFailed:
+			if gs.currentTick < encounter.readyTick {
+				continue
+			}
+			encounter.State = EncounterIdle
+			em.send(gs, encounter, "", nil, dispatcher)
+			fallthrough
+		case EncounterIdle:
+			if encounter.Def.Trigger == EncounterTriggerEnter && len(inside) > 0 {
+				em.start(ctx, gs, encounter, dispatcher)
+			}
+			continue
+		}
+
+		for _, playerID := range inside {
+			encounter.Participants[playerID] = true
+		}
+		if len(inside) > 0 {
+			encounter.emptySince = 0
+		} else if encounter.emptySince == 0 {
+			encounter.emptySince = gs.currentTick
+		}
+		if encounter.emptySince != 0 && gs.currentTick-encounter.emptySince >= int64(encounter.Def.ResetTime*TickRate) {
+			em.fail(ctx, gs, encounter, dispatcher)
+			continue
+		}
+		if encounter.Def.TimeLimit > 0 && gs.currentTick-encounter.startTick >= int64(encounter.Def.TimeLimit*TickRate) {
+			em.fail(ctx, gs, encounter, dispatcher)
+			continue
+		}
+
+		alive := encounter.NPCs[:0]
+		for _, npcID := range encounter.NPCs {
+			if _, ok := gs.npcManager.Get(npcID); ok {
+				alive = append(alive, npcID)
+			}
+		}
+		encounter.NPCs = alive
+
+		if encounter.Wave >= len(encounter.Def.Waves) {
+			if len(alive) == 0 {
+				em.complete(ctx, gs, encounter, dispatcher)
+			}
+			continue
+		}
+		if encounter.nextWave < 0 && len(alive) == 0 {
+			encounter.nextWave = gs.currentTick + int64(encounter.Def.Waves[encounter.Wave].Delay*TickRate)
+		}
+		if encounter.nextWave >= 0 && gs.currentTick >= encounter.nextWave {
+			em.spawnWave(ctx, gs, encounter, dispatcher)
+		}
+	}
+}
+
+// Start starts the idle encounter of an area. It returns false for unknown areas and
+// encounters that are running or cooling down.
+func (em *EncounterManager) Start(ctx context.Context, gs *GameMatchState, area string, dispatcher runtime.MatchDispatcher) bool {
+	encounter, ok := em.encounters[area]
+	if !ok || encounter.State != EncounterIdle {
+		return false
+	}
+	em.start(ctx, gs, encounter, dispatcher)
+	return true
+}
+
+// Stop fails the running encounter of an area, removing its NPCs. It returns false for unknown
+// areas and encounters that aren't running.
+func (em *EncounterManager) Stop(ctx context.Context, gs *GameMatchState, area string, dispatcher runtime.MatchDispatcher) bool {
+	encounter, ok := em.encounters[area]
+	if !ok || encounter.State != EncounterRunning {
+		return false
+	}
+	em.fail(ctx, gs, encounter, dispatcher)
+	return true
+}
+
+// Get returns the encounter of an area
+func (em *EncounterManager) Get(area string) (*Encounter, bool) {
+	encounter, ok := em.encounters[area]
+	return encounter, ok
+}
+
+// start begins an encounter; its first wave spawns after its delay
+func (em *EncounterManager) start(ctx context.Context, gs *GameMatchState, encounter *Encounter, dispatcher runtime.MatchDispatcher) {
+	encounter.State = EncounterRunning
+	encounter.Wave = 0
+	encounter.NPCs = nil
+	encounter.Participants = make(map[string]bool)
+	encounter.startTick = gs.currentTick
+	encounter.emptySince = 0
+	encounter.nextWave = gs.currentTick
+	if len(encounter.Def.Waves) > 0 {
+		encounter.nextWave += int64(encounter.Def.Waves[0].Delay * TickRate)
+	}
+	em.logger.Info("Encounter %s started in %s", encounter.Def.ID, encounter.Area.Name)
+	gs.eventBus.Publish(EventEncounterStarted, map[string]any{"area": encounter.Area.Name, "encounter": encounter.Def.ID})
+	em.runScript(ctx, gs, encounter, "started", dispatcher)
+	em.send(gs, encounter, "", nil, dispatcher)
+}
+
+// spawnWave spawns the next wave and schedules the one after it
+func (em *EncounterManager) spawnWave(ctx context.Context, gs *GameMatchState, encounter *Encounter, dispatcher runtime.MatchDispatcher) {
+	wave := encounter.Def.Waves[encounter.Wave]
+	encounter.Wave++
+	spawned := make([]int, 0)
+	for _, spawn := range wave.Spawns {
+		position := encounter.Area.Center()
+		if spawn.X != 0 || spawn.Y != 0 {
+			position = vector.Vector{X: spawn.X, Y: spawn.Y}
+		}
+		if spawn.Marker != "" {
+			marker, ok := gs.currentMap.Markers[spawn.Marker]
+			if !ok {
+				em.logger.Warn("Encounter %s: unknown spawn marker %q", encounter.Def.ID, spawn.Marker)
+				continue
+			}
+			position = marker
+		}
+		for i := 0; i < spawn.Count; i++ {
+			npcID := gs.npcManager.Spawn(gs, spawn.NPC, position, nil)
+			if npcID == 0 {
+				em.logger.Warn("Encounter %s: unknown NPC type %q", encounter.Def.ID, spawn.NPC)
+				break
+			}
+			spawned = append(spawned, npcID)
+		}
+	}
+	encounter.NPCs = append(encounter.NPCs, spawned...)
+
+	encounter.nextWave = -1
+	if encounter.Wave < len(encounter.Def.Waves) && !encounter.Def.Waves[encounter.Wave].AfterClear {
+		encounter.nextWave = gs.currentTick + int64(encounter.Def.Waves[encounter.Wave].Delay*TickRate)
+	}
+
+	em.logger.Info("Encounter %s in %s: wave %d/%d (%d NPCs)", encounter.Def.ID, encounter.Area.Name, encounter.Wave, len(encounter.Def.Waves), len(spawned))
+	gs.eventBus.Publish(EventEncounterWave, map[string]any{"area": encounter.Area.Name, "encounter": encounter.Def.ID, "wave": encounter.Wave, "npcs": spawned})
+	em.runScript(ctx, gs, encounter, "wave", dispatcher)
+	em.send(gs, encounter, wave.Message, nil, dispatcher)
+}
+
+// complete ends an encounter whose waves were all defeated and rewards its participants
+func (em *EncounterManager) complete(ctx context.Context, gs *GameMatchState, encounter *Encounter, dispatcher runtime.MatchDispatcher) {
+	encounter.State = EncounterCompleted
+	encounter.readyTick = gs.currentTick + int64(encounter.Def.Cooldown*TickRate)
+	participants := make([]string, 0, len(encounter.Participants))
+	for playerID := range encounter.Participants {
+		participants = append(participants, playerID)
+	}
+	sort.Strings(participants)
+	for _, playerID := range participants {
+		em.reward(ctx, gs, encounter, playerID, dispatcher)
+	}
+
+	em.logger.Info("Encounter %s completed in %s (%d participants)", encounter.Def.ID, encounter.Area.Name, len(participants))
+	gs.eventBus.Publish(EventEncounterCompleted, map[string]any{"area": encounter.Area.Name, "encounter": encounter.Def.ID, "participants": participants})
+	em.runScript(ctx, gs, encounter, "completed", dispatcher)
+	em.send(gs, encounter, "", nil, dispatcher)
+}
+
+// fail ends a running encounter without rewards and removes its surviving NPCs, so it starts
+// over from the first wave next time
+func (em *EncounterManager) fail(ctx context.Context, gs *GameMatchState, encounter *Encounter, dispatcher runtime.MatchDispatcher) {
+	for _, npcID := range encounter.NPCs {
+		gs.npcManager.Despawn(gs, npcID)
+	}
+	encounter.NPCs = nil
+	encounter.State = EncounterFailed
+	encounter.readyTick = gs.currentTick + int64(encounter.Def.Cooldown*TickRate)
+
+	em.logger.Info("Encounter %s failed in %s at wave %d", encounter.Def.ID, encounter.Area.Name, encounter.Wave)
+	gs.eventBus.Publish(EventEncounterFailed, map[string]any{"area": encounter.Area.Name, "encounter": encounter.Def.ID, "wave": encounter.Wave})
+	em.runScript(ctx, gs, encounter, "failed", dispatcher)
+	em.send(gs, encounter, "", nil, dispatcher)
+}
+
+// reward grants an encounter's rewards to one participant through the inventory and the Nakama
+// wallet, as world event rewards are
+func (em *EncounterManager) reward(ctx context.Context, gs *GameMatchState, encounter *Encounter, playerID string, dispatcher runtime.MatchDispatcher) {
+	def := encounter.Def
+	granted := WorldEventReward{ID: def.ID, Items: make(map[string]int)}
+	stacks := make([]LootStack, 0, len(def.Rewards.Items))
+	for itemID, count := range def.Rewards.Items {
+		stacks = append(stacks, LootStack{ItemID: itemID, Count: count})
+	}
+	sort.Slice(stacks, func(i, j int) bool { return stacks[i].ItemID < stacks[j].ItemID })
+	if def.Rewards.Loot != "" {
+		stacks = append(stacks, gs.lootCatalog.Roll(gs, def.Rewards.Loot, LootContext{PlayerID: playerID})...)
+	}
+	if len(stacks) == 0 && len(def.Rewards.Currency) == 0 {
+		return
+	}
+	entry := &JournalEntry{Key: gs.journal.Key("encounter", encounter.Area.Name, encounter.startTick), Kind: JournalItemGrant, PlayerID: playerID, Items: stackItems(stacks), Currency: def.Rewards.Currency, Source: "encounter:" + def.ID}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		return
+	}
+	// Participants who left are sent a reward claim rather than having their inventory written here
+	items, grantErr := gs.giveRewardItems(ctx, playerID, entry.Key, entry.Source, stacks)
+	if grantErr != nil {
+		em.logger.Error("Encounter %s: failed to give items to %s: %v", def.ID, playerID, grantErr)
+	}
+	granted.Items = items
+	if len(def.Rewards.Currency) > 0 {
+		metadata := map[string]interface{}{"reason": "encounter", "encounter": def.ID}
+		if err := gs.databaseManager.UpdateWallet(ctx, playerID, def.Rewards.Currency, metadata); err != nil {
+			em.logger.Error("Encounter %s: failed to pay %s: %v", def.ID, playerID, err)
+			grantErr = err
+		} else {
+			granted.Currency = def.Rewards.Currency
+		}
+	}
+	entry.Items, entry.Currency = granted.Items, granted.Currency
+	gs.journal.Finish(ctx, entry, grantErr)
+
+	presence, online := gs.presences[playerID]
+	if !online || dispatcher == nil {
+		return
+	}
+	if len(granted.Items) > 0 {
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	}
+	data, err := EncodeMessage(OpCodeEncounter, "encounter_reward", granted)
+	if err != nil {
+		em.logger.Error("Failed to marshal encounter_reward: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeEncounter, data, []runtime.Presence{presence}, nil, true)
+}
+
+// runScript runs the encounter's script with ctx.event, ctx.area, ctx.encounter and ctx.wave
+func (em *EncounterManager) runScript(ctx context.Context, gs *GameMatchState, encounter *Encounter, event string, dispatcher runtime.MatchDispatcher) {
+	if encounter.Def.Script == "" {
+		return
+	}
+	params := map[string]any{
+		"event":     event,
+		"area":      encounter.Area.Name,
+		"encounter": encounter.Def.ID,
+		"wave":      encounter.Wave,
+	}
+	if err := gs.RunScript(ctx, encounter.Def.Script, params, dispatcher, em.logger); err != nil {
+		em.logger.Error("Encounter %s %s script error: %v", encounter.Def.ID, event, err)
+	}
+}
+
+// livingPlayersIn returns the living players inside an area, sorted
+func (em *EncounterManager) livingPlayersIn(gs *GameMatchState, area *EncounterArea) []string {
+	inside := make([]string, 0)
+	for playerID, rb := range gs.PlayerBodies() {
+		if rb != nil && area.Contains(rb.Position) && !gs.GetPlayerState(playerID).IsDead() {
+			inside = append(inside, playerID)
+		}
+	}
+	sort.Strings(inside)
+	return inside
+}
+
+// sortedAreas returns the area names in a stable order
+func (em *EncounterManager) sortedAreas() []string {
+	names := make([]string, 0, len(em.encounters))
+	for name := range em.encounters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// data converts an encounter for clients
+func (em *EncounterManager) data(gs *GameMatchState, encounter *Encounter, message string) EncounterData {
+	data := EncounterData{
+		ID:        encounter.Area.Name,
+		Encounter: encounter.Def.ID,
+		Name:      encounter.Def.Name,
+		State:     encounter.State,
+		Wave:      encounter.Wave,
+		Waves:     len(encounter.Def.Waves),
+		Message:   message,
+		X:         encounter.Area.Min.X,
+		Y:         encounter.Area.Min.Y,
+		Width:     encounter.Area.Max.X - encounter.Area.Min.X,
+		Height:    encounter.Area.Max.Y - encounter.Area.Min.Y,
+	}
+	if encounter.State == EncounterRunning && encounter.Def.TimeLimit > 0 {
+		data.Remaining = max(0, encounter.Def.TimeLimit-float64(gs.currentTick-encounter.startTick)/TickRate)
+	}
+	return data
+}
+
+// send sends an encounter's state as an encounter message to presences (nil: every player)
+func (em *EncounterManager) send(gs *GameMatchState, encounter *Encounter, message string, presences []runtime.Presence, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil || len(gs.presences) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeEncounter, "encounter", em.data(gs, encounter, message))
+	if err != nil {
+		em.logger.Error("Failed to marshal encounter %s: %v", encounter.Area.Name, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeEncounter, data, presences, nil, true)
+}
+
+// parseEncounterArea reads an "encounter" rectangle
+func (ml *MapLoader) parseEncounterArea(obj *TiledObject) (EncounterArea, bool) {
+	area := EncounterArea{
+		Name:      obj.Name,
+		Encounter: obj.Name,
+		Min:       vector.Vector{X: obj.X, Y: obj.Y},
+		Max:       vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+	}
+	for _, p := range obj.Properties {
+		if v, ok := p.Value.(string); ok && strings.ToLower(p.Name) == "encounter" && v != "" {
+			area.Encounter = v
+		}
+	}
+	if area.Name == "" {
+		area.Name = area.Encounter
+	}
+	if area.Encounter == "" {
+		ml.logger.Warn("Encounter area %d has no name or encounter property; skipping", obj.ID)
+		return area, false
+	}
+	return area, true
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+)
+
+// EntityKind is what an entity of the match is
+type EntityKind uint8
+
+// Entity kinds
+const (
+	EntityPlayer EntityKind = iota + 1 // a player's character, keyed by user ID
+	EntityNPC                          // a spawned NPC, keyed by NPC ID
+	EntityObject                       // a scripted map or runtime object, keyed by object ID
+)
+
+// String returns the kind's name, as used in logs
+func (k EntityKind) String() string {
+	switch k {
+	case EntityPlayer:
+		return "player"
+	case EntityNPC:
+		return "npc"
+	case EntityObject:
+		return "object"
+	}
+	return "unknown"
+}
+
+// EntityRef identifies an entity. NPC and object IDs are both small integers, so the kind is
+// part of the key.
+type EntityRef struct {
+	Kind EntityKind
+	ID   string
+}
+
+// PlayerRef, NPCRef and ObjectRef identify the entity of a player, an NPC and an object
+func PlayerRef(playerID string) EntityRef { return EntityRef{Kind: EntityPlayer, ID: playerID} }
+func NPCRef(id int) EntityRef             { return EntityRef{Kind: EntityNPC, ID: strconv.Itoa(id)} }
+func ObjectRef(oid int) EntityRef         { return EntityRef{Kind: EntityObject, ID: strconv.Itoa(oid)} }
+
+// Entity is anything of the match with an identity: a player, an NPC or a scripted object. It
+// holds the bodies it owns in the physics world and typed components the systems attach to it
+// (the *ObjectData of an object, the *NPC of an NPC), looked up with Component.
+type Entity struct {
+	EntityRef
+	Body      *rigidbody.RigidBody   // the player's or NPC's body; nil for objects
+	Colliders []*rigidbody.RigidBody // the colliders an object owns
+	Props     map[string]any         // an object's props; nil for players and NPCs
+	Owner     string                 // the player who placed a player-placed object
+
+	components map[reflect.Type]any
+}
+
+// Component returns the component of type T attached to an entity
+func Component[T any](e *Entity) (T, bool) {
+	var zero T
+	if e == nil {
+		return zero, false
+	}
+	v, ok := e.components[reflect.TypeFor[T]()]
+	if !ok {
+		return zero, false
+	}
+	return v.(T), true
+}
+
+// SetComponent attaches a component of type T to an entity, replacing the one it had
+func SetComponent[T any](e *Entity, v T) {
+	if e.components == nil {
+		e.components = make(map[reflect.Type]any)
+	}
+	e.components[reflect.TypeFor[T]()] = v
+}
+
+// EntityRegistry is the one store of the match's entities and of which entity owns each body.
+// Players are looked up by user ID and NPCs and objects by their numeric ID, so the hot lookups
+// (an object's data while filtering collisions, a player's body) don't build an EntityRef.
+// Guarded by the match mutex.
+type EntityRegistry struct {
+	players map[string]*Entity
+	npcs    map[int]*Entity
+	objects map[int]*Entity
+	bodies  map[*rigidbody.RigidBody]*Entity // body -> owning entity
+}
+
+// NewEntityRegistry creates an empty registry
+func NewEntityRegistry() *EntityRegistry {
+	return &EntityRegistry{
+		players: make(map[string]*Entity),
+		npcs:    make(map[int]*Entity),
+		objects: make(map[int]*Entity),
+		bodies:  make(map[*rigidbody.RigidBody]*Entity),
+	}
+}
+
+// Get returns an entity
+func (er *EntityRegistry) Get(ref EntityRef) (*Entity, bool) {
+	if ref.Kind == EntityPlayer {
+		e, ok := er.players[ref.ID]
+		return e, ok
+	}
+	id, err := strconv.Atoi(ref.ID)
+	if err != nil {
+		return nil, false
+	}
+	switch ref.Kind {
+	case EntityNPC:
+		e, ok := er.npcs[id]
+		return e, ok
+	case EntityObject:
+		e, ok := er.objects[id]
+		return e, ok
+	}
+	return nil, false
+}
+
+// ensure returns an entity, creating it without bodies or components if it isn't registered
+func (er *EntityRegistry) ensure(ref EntityRef) *Entity {
+	if e, ok := er.Get(ref); ok {
+		return e
+	}
+	e := &Entity{EntityRef: ref}
+	switch ref.Kind {
+	case EntityPlayer:
+		er.players[ref.ID] = e
+	case EntityNPC:
+		id, _ := strconv.Atoi(ref.ID)
+		er.npcs[id] = e
+	case EntityObject:
+		id, _ := strconv.Atoi(ref.ID)
+		er.objects[id] = e
+	}
+	return e
+}
+
+// SetBody sets the body of a player or NPC entity, creating the entity if needed
+func (er *EntityRegistry) SetBody(ref EntityRef, rb *rigidbody.RigidBody) *Entity {
+	e := er.ensure(ref)
+	if e.Body != nil {
+		delete(er.bodies, e.Body)
+	}
+	e.Body = rb
+	if rb != nil {
+		er.bodies[rb] = e
+	}
+	return e
+}
+
+// AddCollider records a collider an entity owns, creating the entity if needed
+func (er *EntityRegistry) AddCollider(ref EntityRef, rb *rigidbody.RigidBody) {
+	e := er.ensure(ref)
+	e.Colliders = append(e.Colliders, rb)
+	er.bodies[rb] = e
+}
+
+// RemoveColliders forgets the colliders an entity owns and returns them
+func (er *EntityRegistry) RemoveColliders(ref EntityRef) []*rigidbody.RigidBody {
+	e, ok := er.Get(ref)
+	if !ok {
+		return nil
+	}
+	colliders := e.Colliders
+	for _, rb := range colliders {
+		delete(er.bodies, rb)
+	}
+	e.Colliders = nil
+	return colliders
+}
+
+// Remove forgets an entity and its bodies and returns it
+func (er *EntityRegistry) Remove(ref EntityRef) (*Entity, bool) {
+	e, ok := er.Get(ref)
+	if !ok {
+		return nil, false
+	}
+	er.forget(e)
+	return e, true
+}
+
+// forget drops an entity and its bodies
+func (er *EntityRegistry) forget(e *Entity) {
+	if e.Body != nil {
+		delete(er.bodies, e.Body)
+	}
+	for _, rb := range e.Colliders {
+		delete(er.bodies, rb)
+	}
+	switch e.Kind {
+	case EntityPlayer:
+		delete(er.players, e.ID)
+	case EntityNPC:
+		id, _ := strconv.Atoi(e.ID)
+		delete(er.npcs, id)
+	case EntityObject:
+		id, _ := strconv.Atoi(e.ID)
+		delete(er.objects, id)
+	}
+}
+
+// RemoveKind forgets every entity of a kind, e.g. the objects of a map that is replaced
+func (er *EntityRegistry) RemoveKind(kind EntityKind) {
+	var entities map[int]*Entity
+	switch kind {
+	case EntityPlayer:
+		for _, e := range er.players {
+			er.forget(e)
+		}
+		return
+	case EntityNPC:
+		entities = er.npcs
+	case EntityObject:
+		entities = er.objects
+	}
+	for _, e := range entities {
+		er.forget(e)
+	}
+}
+
+// OwnerOf returns the entity owning a body
+func (er *EntityRegistry) OwnerOf(rb *rigidbody.RigidBody) (*Entity, bool) {
+	e, ok := er.bodies[rb]
+	return e, ok
+}
+
+// ObjectColliders returns the colliders an object owns. The slice must not be modified.
+func (er *EntityRegistry) ObjectColliders(oid int) []*rigidbody.RigidBody {
+	if e, ok := er.objects[oid]; ok {
+		return e.Colliders
+	}
+	return nil
+}
+
+// PlayerBody returns a player's body, or nil if they have none in the match
+func (er *EntityRegistry) PlayerBody(playerID string) *rigidbody.RigidBody {
+	if e, ok := er.players[playerID]; ok {
+		return e.Body
+	}
+	return nil
+}
+
+// PlayerCount counts the players with a body in the match
+func (er *EntityRegistry) PlayerCount() int {
+	return len(er.players)
+}
+
+// ObjectCount counts the entities of objects, including any that only own colliders
+func (er *EntityRegistry) ObjectCount() int {
+	return len(er.objects)
+}
+
+// Object returns a scripted object's data. An ID whose entity only owns colliders (its object
+// was removed, or they were built before it was registered) has none.
+func (er *EntityRegistry) Object(oid int) (*ObjectData, bool) {
+	return Component[*ObjectData](er.objects[oid])
+}
+
+// ObjectIDs returns the IDs of the registered objects, sorted
+func (er *EntityRegistry) ObjectIDs() []int {
+	ids := make([]int, 0, len(er.objects))
+	for oid, e := range er.objects {
+		if _, ok := Component[*ObjectData](e); ok {
+			ids = append(ids, oid)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// registerObject records a scripted object as an entity with its props, owner and data
+func (er *EntityRegistry) registerObject(obj *ObjectData) {
+	e := er.ensure(ObjectRef(obj.ID))
+	e.Props = obj.Props
+	e.Owner = ""
+	if obj.Ownership != nil {
+		e.Owner = obj.Ownership.Owner
+	}
+	SetComponent(e, obj)
+}
+
+// PlayerBody returns a player's body, or nil if they aren't in the match
+func (gs *GameMatchState) PlayerBody(playerID string) *rigidbody.RigidBody {
+	return gs.entities.PlayerBody(playerID)
+}
+
+// Object returns a scripted object's data. The caller holds gs.mu.
+func (gs *GameMatchState) Object(oid int) (*ObjectData, bool) {
+	return gs.entities.Object(oid)
+}
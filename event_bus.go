@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// GameEvent is a named event published on the match event bus
+type GameEvent struct {
+	Name string
+	Data map[string]any
+}
+
+// EventHandler reacts to an event in Go code
+type EventHandler func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher)
+
+// eventScript is a script subscribed to an event; ObjectID is passed as ctx.objectId when set
+type eventScript struct {
+	Path     string
+	ObjectID int
+}
+
+// EventBus delivers match events (sunrise, sunset, ...) to Go subsystems and scripts. Events are
+// queued by Publish and delivered by Dispatch from the match loop, so publishers never run
+// subscribers re-entrantly; events published while dispatching are delivered on the next tick.
+type EventBus struct {
+	logger   runtime.Logger
+	handlers map[string][]EventHandler
+	scripts  map[string][]eventScript
+	queue    []GameEvent
+	mu       sync.Mutex
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus(logger runtime.Logger) *EventBus {
+	return &EventBus{
+		logger:   logger,
+		handlers: make(map[string][]EventHandler),
+		scripts:  make(map[string][]eventScript),
+	}
+}
+
+// Subscribe registers a Go handler for an event
+func (eb *EventBus) Subscribe(name string, handler EventHandler) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.handlers[name] = append(eb.handlers[name], handler)
+}
+
+// SubscribeScript runs scriptPath whenever the event is published. Subscribing the same script
+// and object twice has no effect.
+func (eb *EventBus) SubscribeScript(name, scriptPath string, objectID int) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	sub := eventScript{Path: scriptPath, ObjectID: objectID}
+	for _, existing := range eb.scripts[name] {
+		if existing == sub {
+			return
+		}
+	}
+	eb.scripts[name] = append(eb.scripts[name], sub)
+}
+
+// UnsubscribeScript removes a script subscription. It returns false if there was none.
+func (eb *EventBus) UnsubscribeScript(name, scriptPath string, objectID int) bool {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	subs := eb.scripts[name]
+	for i, existing := range subs {
+		if existing.Path == scriptPath && existing.ObjectID == objectID {
+			eb.scripts[name] = append(subs[:i:i], subs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SubscribeMapObjects subscribes the script of every map object with an "events" property
+// (comma-separated event names) to those events
+func (eb *EventBus) SubscribeMapObjects(gs *GameMatchState) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for oid, obj := range gs.Objects() {
+		events, _ := obj.Props["events"].(string)
+		script, _ := obj.Props["script"].(string)
+		if events == "" || script == "" {
+			continue
+		}
+		for _, name := range strings.Split(events, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				eb.SubscribeScript(name, script, oid)
+			}
+		}
+	}
+}
+
+// Publish queues an event for the next Dispatch
+func (eb *EventBus) Publish(name string, data map[string]any) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.queue = append(eb.queue, GameEvent{Name: name, Data: data})
+}
+
+// Dispatch delivers the queued events: Go handlers first, then subscribed scripts with
+// ctx.event set to the event name and the event data merged into ctx. Called from the match loop.
+func (eb *EventBus) Dispatch(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	eb.mu.Lock()
+	queue := eb.queue
+	eb.queue = nil
+	eb.mu.Unlock()
+
+	for _, event := range queue {
+		eb.mu.Lock()
+		handlers := append([]EventHandler(nil), eb.handlers[event.Name]...)
+		scripts := append([]eventScript(nil), eb.scripts[event.Name]...)
+		eb.mu.Unlock()
+
+		for _, handler := range handlers {
+			handler(ctx, gs, event, dispatcher)
+		}
+		for _, sub := range scripts {
+			params := make(map[string]any, len(event.Data)+2)
+			for k, v := range event.Data {
+				params[k] = v
+			}
+			params["event"] = event.Name
+			if sub.ObjectID != 0 {
+				params["objectId"] = sub.ObjectID
+			}
+			if err := gs.RunScript(ctx, sub.Path, params, dispatcher, eb.logger); err != nil {
+				eb.logger.Error("Event %s: script %s failed: %v", event.Name, sub.Path, err)
+			}
+		}
+	}
+}
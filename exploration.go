@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/bits"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// EventChunkDiscovered is published when a player enters a map chunk for the first time
+const EventChunkDiscovered = "chunk_discovered"
+
+// Exploration tuning. The map property "exploreChunkSize" (tiles) overrides the chunk size.
+const (
+	defaultExploreChunkTiles = 16
+	explorationCheckInterval = 10 // ticks between chunk checks
+)
+
+// ChunkCoord is a chunk's column and row
+type ChunkCoord struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// playerExploration is the explored chunk bitset of an online player on the current map
+type playerExploration struct {
+	saved     *PersistedExploration // the player's record for every map, written back on save
+	chunks    []byte
+	explored  int
+	lastChunk int // chunk index the player was last seen in (-1 before the first check)
+	dirty     bool
+}
+
+// ExplorationManager tracks which chunks of the current map each player has visited. The
+// server decides what is explored, so fog-of-war and minimap reveal can't be faked by clients.
+// It is only used from the match loop.
+type ExplorationManager struct {
+	logger    runtime.Logger
+	db        *DatabaseManager
+	mapName   string
+	chunkSize float64 // pixels
+	columns   int
+	rows      int
+	players   map[string]*playerExploration // player ID -> exploration of online players
+	nextCheck int64
+}
+
+// NewExplorationManager creates an exploration manager; Configure sets up the map's chunk grid
+func NewExplorationManager(logger runtime.Logger, db *DatabaseManager) *ExplorationManager {
+	return &ExplorationManager{
+		logger:  logger,
+		db:      db,
+		players: make(map[string]*playerExploration),
+	}
+}
+
+// Configure divides the map into square chunks of "exploreChunkSize" tiles (default 16)
+func (em *ExplorationManager) Configure(m *LoadedMap, mapName string) {
+	chunkTiles := defaultExploreChunkTiles
+	if v, ok := m.Properties["exploreChunkSize"].(float64); ok && v >= 1 {
+		chunkTiles = int(v)
+	}
+	tileWidth := m.TileWidth
+	if tileWidth <= 0 {
+		tileWidth = TileSize
+	}
+	em.mapName = mapName
+	em.chunkSize = float64(chunkTiles * tileWidth)
+	em.columns = int(math.Max(1, math.Ceil(float64(m.Width*m.TileWidth)/em.chunkSize)))
+	em.rows = int(math.Max(1, math.Ceil(float64(m.Height*m.TileHeight)/em.chunkSize)))
+}
+
+// LoadPlayer loads a joining player's explored chunks, reveals the chunk they stand in and sends
+// them the full bitset
+func (em *ExplorationManager) LoadPlayer(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	saved, err := em.db.LoadExploration(ctx, playerID)
+	if err != nil {
+		em.logger.Error("Failed to load exploration for %s: %v", playerID, err)
+		return
+	}
+	pe := &playerExploration{saved: saved, chunks: make([]byte, (em.columns*em.rows+7)/8), lastChunk: -1}
+	if stored, ok := saved.Maps[em.mapName]; ok {
+		if stored.Columns == em.columns && stored.Rows == em.rows && len(stored.Chunks) == len(pe.chunks) {
+			copy(pe.chunks, stored.Chunks)
+			for _, b := range pe.chunks {
+				pe.explored += bits.OnesCount8(b)
+			}
+		} else {
+			em.logger.Warn("Chunk grid of %s changed; resetting the exploration of %s", em.mapName, playerID)
+			pe.dirty = true
+		}
+	}
+	em.players[playerID] = pe
+
+	// Reveal the spawn chunk before sending, so the first message already includes it
+	if rb := gs.PlayerBody(playerID); rb != nil {
+		if index, ok := em.chunkIndex(rb.Position.X, rb.Position.Y); ok {
+			pe.lastChunk = index
+			if em.discover(gs, playerID, pe, index) {
+				pe.dirty = true
+			}
+		}
+	}
+	em.send(gs, playerID, "exploration", map[string]any{
+		"map":       em.mapName,
+		"chunkSize": em.chunkSize,
+		"columns":   em.columns,
+		"rows":      em.rows,
+		"chunks":    pe.chunks,
+		"explored":  pe.explored,
+	}, dispatcher)
+}
+
+// UnloadPlayer saves a leaving player's unsaved discoveries and releases them
+func (em *ExplorationManager) UnloadPlayer(ctx context.Context, playerID string) {
+	pe, ok := em.players[playerID]
+	delete(em.players, playerID)
+	if !ok || !pe.dirty {
+		return
+	}
+	if err := em.save(ctx, pe); err != nil {
+		em.logger.Error("Failed to save exploration for %s on leave: %v", playerID, err)
+	}
+}
+
+// Update reveals the chunks players walk into and sends them the new discoveries. Called from
+// the match loop.
+func (em *ExplorationManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick < em.nextCheck {
+		return
+	}
+	em.nextCheck = gs.currentTick + explorationCheckInterval
+	for playerID, pe := range em.players {
+		rb := gs.PlayerBody(playerID)
+		if rb == nil {
+			continue
+		}
+		index, ok := em.chunkIndex(rb.Position.X, rb.Position.Y)
+		if !ok || index == pe.lastChunk {
+			continue
+		}
+		pe.lastChunk = index
+		if !em.discover(gs, playerID, pe, index) {
+			continue
+		}
+		pe.dirty = true
+		em.send(gs, playerID, "chunks_discovered", map[string]any{
+			"chunks":   []ChunkCoord{{X: index % em.columns, Y: index / em.columns}},
+			"explored": pe.explored,
+		}, dispatcher)
+	}
+}
+
+// Save persists the discoveries players made since the last save. Called from the periodic save.
+func (em *ExplorationManager) Save(ctx context.Context) error {
+	var lastErr error
+	for _, playerID := range sortedKeys(em.players) {
+		pe := em.players[playerID]
+		if !pe.dirty {
+			continue
+		}
+		if err := em.save(ctx, pe); err != nil {
+			em.logger.Error("Failed to save exploration for %s: %v", playerID, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// IsExplored reports whether the player has visited the chunk containing the world position
+func (em *ExplorationManager) IsExplored(playerID string, x, y float64) bool {
+	pe, ok := em.players[playerID]
+	if !ok {
+		return false
+	}
+	index, ok := em.chunkIndex(x, y)
+	return ok && pe.chunks[index/8]&(1<<(index%8)) != 0
+}
+
+// Progress returns how many of the map's chunks the player has explored, and the total
+func (em *ExplorationManager) Progress(playerID string) (int, int) {
+	pe, ok := em.players[playerID]
+	if !ok {
+		return 0, em.columns * em.rows
+	}
+	return pe.explored, em.columns * em.rows
+}
+
+// chunkIndex returns the index of the chunk containing the world position
+func (em *ExplorationManager) chunkIndex(x, y float64) (int, bool) {
+	if em.chunkSize <= 0 || x < 0 || y < 0 {
+		return 0, false
+	}
+	cx, cy := int(x/em.chunkSize), int(y/em.chunkSize)
+	if cx >= em.columns || cy >= em.rows {
+		return 0, false
+	}
+	return cy*em.columns + cx, true
+}
+
+// discover sets the chunk's bit and publishes EventChunkDiscovered; it reports false if the
+// chunk was explored already
+func (em *ExplorationManager) discover(gs *GameMatchState, playerID string, pe *playerExploration, index int) bool {
+	mask := byte(1 << (index % 8))
+	if pe.chunks[index/8]&mask != 0 {
+		return false
+	}
+	pe.chunks[index/8] |= mask
+	pe.explored++
+	gs.eventBus.Publish(EventChunkDiscovered, map[string]any{
+		"playerId": playerID,
+		"x":        index % em.columns,
+		"y":        index / em.columns,
+		"explored": pe.explored,
+		"total":    em.columns * em.rows,
+	})
+	return true
+}
+
+// save writes the player's bitset for this map into their record and persists it
+func (em *ExplorationManager) save(ctx context.Context, pe *playerExploration) error {
+	pe.saved.Maps[em.mapName] = &PersistedMapExploration{
+		Columns: em.columns,
+		Rows:    em.rows,
+		Chunks:  append([]byte(nil), pe.chunks...),
+	}
+	if err := em.db.SaveExploration(ctx, pe.saved); err != nil {
+		// Keep the dirty flag so the next periodic save retries
+		return err
+	}
+	pe.dirty = false
+	return nil
+}
+
+// send delivers an OpCodeExploration message to one player
+func (em *ExplorationManager) send(gs *GameMatchState, playerID, msgType string, data map[string]any, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+	payload, err := EncodeMessage(OpCodeExploration, msgType, data)
+	if err != nil {
+		em.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeExploration, payload, []runtime.Presence{presence}, nil, true)
+}
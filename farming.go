@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Farming tuning
+const (
+	soilObjectType         = "soil" // ObjectData.Type of farmable soil
+	defaultTillTool        = "hoe"  // item required to till soil without a "tool" property
+	defaultCropStages      = 4      // growth stages including the ripe one
+	defaultCropGrowSeconds = 600.0  // seconds from planting to ripe
+	farmUpdateInterval     = 1 * TickRate
+)
+
+// CropDefinition describes what a seed item grows into. Crops live in the crops data file,
+// keyed by the seed's item ID; items missing from the file can't be planted.
+type CropDefinition struct {
+	Seed        string   `json:"seed"`
+	Name        string   `json:"name"`
+	Stages      int      `json:"stages,omitempty"`      // growth stages, the last one is ripe (default 4)
+	GrowSeconds float64  `json:"growSeconds,omitempty"` // seconds from planting to ripe (default 600)
+	StageGIDs   []uint32 `json:"stageGids,omitempty"`   // tile GID shown for each stage
+	Produce     string   `json:"produce,omitempty"`     // item granted on harvest
+	Amount      int      `json:"amount,omitempty"`      // produce count (default 1)
+	Loot        string   `json:"loot,omitempty"`        // loot table rolled on harvest instead of produce
+}
+
+// CropCatalog holds the crop definitions loaded from the crops data file
+type CropCatalog struct {
+	logger runtime.Logger
+	crops  map[string]*CropDefinition
+	mu     sync.RWMutex
+}
+
+// NewCropCatalog creates a catalog and loads definitions from path (a JSON object keyed by seed item ID)
+func NewCropCatalog(logger runtime.Logger, path string) *CropCatalog {
+	cc := &CropCatalog{
+		logger: logger,
+		crops:  make(map[string]*CropDefinition),
+	}
+	if err := cc.Load(path); err != nil {
+		logger.Warn("Failed to load crop definitions from %s: %v", path, err)
+	}
+	return cc
+}
+
+// Load replaces the catalog with the definitions found in path
+func (cc *CropCatalog) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var crops map[string]*CropDefinition
+	if err := json.Unmarshal(data, &crops); err != nil {
+		return err
+	}
+	for seed, def := range crops {
+		def.Seed = seed
+		if def.Stages <= 0 {
+			def.Stages = defaultCropStages
+		}
+		if def.GrowSeconds <= 0 {
+			def.GrowSeconds = defaultCropGrowSeconds
+		}
+		if def.Amount <= 0 {
+			def.Amount = 1
+		}
+		if def.Produce == "" && def.Loot == "" {
+			cc.logger.Warn("Crop %s has neither produce nor loot; harvesting it yields nothing", seed)
+		}
+	}
+
+	cc.mu.Lock()
+	cc.crops = crops
+	cc.mu.Unlock()
+
+	cc.logger.Info("Loaded %d crop definitions from %s", len(crops), path)
+	return nil
+}
+
+// Get returns the crop grown from a seed item
+func (cc *CropCatalog) Get(seed string) (*CropDefinition, bool) {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	def, ok := cc.crops[seed]
+	return def, ok
+}
+
+// Stage returns the growth stage of a crop planted at plantedAt (unix seconds), from 0 to
+// Stages-1 (ripe)
+func (def *CropDefinition) Stage(plantedAt, now int64) int {
+	if def.Stages <= 1 {
+		return 0
+	}
+	elapsed := float64(now - plantedAt)
+	if elapsed >= def.GrowSeconds {
+		return def.Stages - 1
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return int(elapsed / def.GrowSeconds * float64(def.Stages-1))
+}
+
+// FarmSoil is a farmable map object. Its "tool" property names the item needed to till it
+// ("none" for no tool).
+type FarmSoil struct {
+	ObjectID  int
+	Tool      string
+	Tilled    bool
+	Seed      string // planted seed item ("" when empty)
+	PlantedBy string
+	PlantedAt int64 // unix seconds
+	Stage     int
+}
+
+// FarmManager tracks the map's soil and the crops growing in it. Crops grow by wall clock time
+// saved with the map, so they keep growing while their planter is offline or the match restarts.
+type FarmManager struct {
+	logger runtime.Logger
+	soil   map[int]*FarmSoil // object ID -> soil
+	dirty  bool              // soil changed since the last save
+	mu     sync.Mutex
+}
+
+// NewFarmManager creates an empty farm manager
+func NewFarmManager(logger runtime.Logger) *FarmManager {
+	return &FarmManager{
+		logger: logger,
+		soil:   make(map[int]*FarmSoil),
+	}
+}
+
+// LoadFromMap registers every "soil" object of the current map
+func (fm *FarmManager) LoadFromMap(gs *GameMatchState) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.soil = make(map[int]*FarmSoil)
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for oid, obj := range gs.Objects() {
+		if !strings.EqualFold(obj.Type, soilObjectType) {
+			continue
+		}
+		soil := &FarmSoil{ObjectID: oid, Tool: defaultTillTool}
+		if v, ok := obj.Props["tool"].(string); ok {
+			soil.Tool = v
+		}
+		if strings.EqualFold(soil.Tool, "none") {
+			soil.Tool = ""
+		}
+		fm.soil[oid] = soil
+	}
+	fm.logger.Info("Registered %d soil objects", len(fm.soil))
+}
+
+// Till prepares empty soil for planting. It returns a rejection reason, or "".
+func (fm *FarmManager) Till(ctx context.Context, gs *GameMatchState, playerID string, oid int, dispatcher runtime.MatchDispatcher) string {
+	fm.mu.Lock()
+	soil, ok := fm.soil[oid]
+	if !ok {
+		fm.mu.Unlock()
+		return RejectInvalidTarget
+	}
+	if soil.Tilled {
+		fm.mu.Unlock()
+		return RejectAlreadyTilled
+	}
+	tool := soil.Tool
+	fm.mu.Unlock()
+
+	if tool != "" && gs.inventoryManager.Count(ctx, playerID, tool) <= 0 {
+		return RejectMissingTool
+	}
+
+	fm.mu.Lock()
+	soil.Tilled = true
+	fm.dirty = true
+	fm.mu.Unlock()
+	gs.setSoilProps(soil, nil, dispatcher, fm.logger)
+	return ""
+}
+
+// Plant sows a seed item from the player's inventory into tilled, empty soil. It returns a
+// rejection reason, or "".
+func (fm *FarmManager) Plant(ctx context.Context, gs *GameMatchState, playerID string, oid int, seed string, dispatcher runtime.MatchDispatcher) string {
+	crop, ok := gs.cropCatalog.Get(seed)
+	if !ok {
+		return RejectNotPlantable
+	}
+
+	fm.mu.Lock()
+	soil, ok := fm.soil[oid]
+	if !ok {
+		fm.mu.Unlock()
+		return RejectInvalidTarget
+	}
+	if !soil.Tilled {
+		fm.mu.Unlock()
+		return RejectNotTilled
+	}
+	if soil.Seed != "" {
+		fm.mu.Unlock()
+		return RejectOccupied
+	}
+	// Reserve the soil so two players can't plant into it on the same tick
+	soil.Seed = seed
+	fm.mu.Unlock()
+
+	if err := gs.inventoryManager.Remove(ctx, playerID, seed, 1); err != nil {
+		fm.mu.Lock()
+		soil.Seed = ""
+		fm.mu.Unlock()
+		if err == errNotEnoughItems {
+			return RejectNotOwned
+		}
+		return RejectStorageError
+	}
+
+	fm.mu.Lock()
+	soil.PlantedBy = playerID
+	soil.PlantedAt = time.Now().Unix()
+	soil.Stage = 0
+	fm.dirty = true
+	fm.mu.Unlock()
+	gs.setSoilProps(soil, crop, dispatcher, fm.logger)
+	return ""
+}
+
+// Harvest picks a ripe crop and grants its produce to the player who planted it. The soil has
+// to be tilled again afterwards. It returns the granted stacks, or a rejection reason.
+func (fm *FarmManager) Harvest(ctx context.Context, gs *GameMatchState, playerID string, oid int, dispatcher runtime.MatchDispatcher) ([]LootStack, string) {
+	fm.mu.Lock()
+	soil, ok := fm.soil[oid]
+	if !ok || soil.Seed == "" {
+		fm.mu.Unlock()
+		return nil, RejectInvalidTarget
+	}
+	if soil.PlantedBy != playerID && !roleAllows(gs.GetPlayerState(playerID).Role, RoleGM) {
+		fm.mu.Unlock()
+		return nil, RejectNotOwned
+	}
+	crop, known := gs.cropCatalog.Get(soil.Seed)
+	if known && crop.Stage(soil.PlantedAt, time.Now().Unix()) < crop.Stages-1 {
+		fm.mu.Unlock()
+		return nil, RejectNotRipe
+	}
+	// Clear the soil up front so the crop can only be harvested once
+	previous := *soil
+	soil.Seed, soil.PlantedBy, soil.PlantedAt, soil.Stage, soil.Tilled = "", "", 0, 0, false
+	fm.dirty = true
+	fm.mu.Unlock()
+
+	var stacks []LootStack
+	switch {
+	case !known:
+		// The crop was removed from the data file; clear the soil without a harvest
+	case crop.Loot != "":
+		stacks = gs.lootCatalog.Roll(gs, crop.Loot, LootContext{PlayerID: playerID})
+	case crop.Produce != "":
+		stacks = []LootStack{{ItemID: crop.Produce, Count: crop.Amount}}
+	}
+	for i, stack := range stacks {
+		if err := gs.inventoryManager.Add(ctx, playerID, stack.ItemID, stack.Count); err != nil {
+			fm.logger.Error("harvest: failed to add %d x %s to %s: %v", stack.Count, stack.ItemID, playerID, err)
+			if i == 0 {
+				fm.mu.Lock()
+				*soil = previous
+				fm.mu.Unlock()
+				return nil, RejectStorageError
+			}
+			// Earlier stacks were granted; keep the crop harvested
+			stacks = stacks[:i]
+			break
+		}
+	}
+
+	gs.setSoilProps(soil, nil, dispatcher, fm.logger)
+	return stacks, ""
+}
+
+// Update advances the growth stages of planted crops. Called from the match loop.
+func (fm *FarmManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick%farmUpdateInterval != 0 {
+		return
+	}
+	now := time.Now().Unix()
+
+	type grown struct {
+		soil *FarmSoil
+		crop *CropDefinition
+	}
+	changed := make([]grown, 0)
+	fm.mu.Lock()
+	for _, soil := range fm.soil {
+		if soil.Seed == "" {
+			continue
+		}
+		crop, ok := gs.cropCatalog.Get(soil.Seed)
+		if !ok {
+			continue
+		}
+		if stage := crop.Stage(soil.PlantedAt, now); stage != soil.Stage {
+			soil.Stage = stage
+			changed = append(changed, grown{soil: soil, crop: crop})
+		}
+	}
+	fm.mu.Unlock()
+
+	for _, g := range changed {
+		gs.setSoilProps(g.soil, g.crop, dispatcher, fm.logger)
+	}
+}
+
+// Save persists the state of tilled and planted soil if any changed since the last save
+func (fm *FarmManager) Save(ctx context.Context, dm *DatabaseManager, mapName string) error {
+	fm.mu.Lock()
+	if !fm.dirty {
+		fm.mu.Unlock()
+		return nil
+	}
+	saved := &PersistedFarm{Map: mapName, Soil: make(map[int]PersistedSoil)}
+	for oid, soil := range fm.soil {
+		if soil.Tilled {
+			saved.Soil[oid] = PersistedSoil{Seed: soil.Seed, PlantedBy: soil.PlantedBy, PlantedAt: soil.PlantedAt}
+		}
+	}
+	fm.dirty = false
+	fm.mu.Unlock()
+
+	if err := dm.SaveFarm(ctx, saved); err != nil {
+		// Keep the dirty flag so the next periodic save retries
+		fm.mu.Lock()
+		fm.dirty = true
+		fm.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Restore reapplies the saved tilled soil and crops; crops catch up on the growth they made
+// while the match was down
+func (fm *FarmManager) Restore(ctx context.Context, gs *GameMatchState) error {
+	saved, err := gs.databaseManager.LoadFarm(ctx, gs.currentMapName)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+
+	type restored struct {
+		soil *FarmSoil
+		crop *CropDefinition
+	}
+	restoredSoil := make([]restored, 0, len(saved.Soil))
+	fm.mu.Lock()
+	for oid, record := range saved.Soil {
+		soil, ok := fm.soil[oid]
+		if !ok {
+			continue
+		}
+		soil.Tilled = true
+		soil.Seed = record.Seed
+		soil.PlantedBy = record.PlantedBy
+		soil.PlantedAt = record.PlantedAt
+		var crop *CropDefinition
+		if record.Seed != "" {
+			if def, ok := gs.cropCatalog.Get(record.Seed); ok {
+				crop = def
+				soil.Stage = crop.Stage(soil.PlantedAt, now)
+			}
+		}
+		restoredSoil = append(restoredSoil, restored{soil: soil, crop: crop})
+	}
+	fm.mu.Unlock()
+
+	for _, r := range restoredSoil {
+		gs.setSoilProps(r.soil, r.crop, nil, fm.logger)
+	}
+	fm.logger.Info("Restored %d tilled soil objects", len(restoredSoil))
+	return nil
+}
+
+// setSoilProps mirrors the soil's state into its object properties so clients can draw the
+// crop, and broadcasts the change. crop is nil for empty soil.
+func (gs *GameMatchState) setSoilProps(soil *FarmSoil, crop *CropDefinition, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gs.mu.Lock()
+	obj, ok := gs.Object(soil.ObjectID)
+	if ok {
+		obj.Props["tilled"] = soil.Tilled
+		if soil.Seed == "" || crop == nil {
+			delete(obj.Props, "crop")
+			delete(obj.Props, "stage")
+			delete(obj.Props, "ripe")
+			delete(obj.Props, "cropGid")
+			delete(obj.Props, "plantedBy")
+		} else {
+			obj.Props["crop"] = crop.Seed
+			obj.Props["stage"] = float64(soil.Stage)
+			obj.Props["ripe"] = soil.Stage >= crop.Stages-1
+			obj.Props["plantedBy"] = soil.PlantedBy
+			if soil.Stage < len(crop.StageGIDs) {
+				obj.Props["cropGid"] = crop.StageGIDs[soil.Stage]
+			}
+		}
+	}
+	gs.mu.Unlock()
+	if ok {
+		gs.BroadcastObjectUpdate(soil.ObjectID, dispatcher, logger)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Fishing results sent with fishing_result
+const (
+	FishingCaught    = "caught"    // reeled in during the bite window
+	FishingNothing   = "nothing"   // reeled in on time, but the spot's loot roll came up empty
+	FishingTooEarly  = "too_early" // reeled in before the bite
+	FishingEscaped   = "escaped"   // the bite window passed without a reel
+	FishingCancelled = "cancelled" // the player moved away, died or fished elsewhere
+)
+
+// Fishing tuning. The spot properties "biteMin", "biteMax" and "window" (seconds) and "tool"
+// override the defaults.
+const (
+	fishingSpotObjectType = "fishing_spot"
+	defaultFishingTool    = "fishing_rod"
+	defaultBiteMinSeconds = 2.0
+	defaultBiteMaxSeconds = 8.0
+	defaultBiteWindow     = 1.2   // seconds to reel in after the bite (includes round-trip latency)
+	fishingCastRange      = 160.0 // max distance from the player to the spot
+	fishingMoveTolerance  = 16.0  // the line breaks when the player moves further than this from the cast position
+)
+
+// FishingSession is a player's line in the water. Bite timing is chosen by the server and only
+// revealed when the bite happens, so clients can't reel in at the right moment in advance.
+type FishingSession struct {
+	SpotID       int
+	LootTable    string
+	CastPosition vector.Vector
+	BiteTick     int64 // the fish bites at this tick
+	DeadlineTick int64 // last tick a reel counts
+	BiteSent     bool
+}
+
+// FishingEvent is the payload of OpCodeFishing messages
+type FishingEvent struct {
+	SpotID int         `json:"spotId"`
+	Result string      `json:"result,omitempty"`
+	Window float64     `json:"window,omitempty"` // seconds left to reel in (fish_bite)
+	Items  []LootStack `json:"items,omitempty"`
+}
+
+// FishingManager runs the cast/bite/reel sequence of every fishing player. It is only used from
+// the match loop.
+type FishingManager struct {
+	logger   runtime.Logger
+	sessions map[string]*FishingSession // player ID -> session
+}
+
+// NewFishingManager creates a fishing manager without sessions
+func NewFishingManager(logger runtime.Logger) *FishingManager {
+	return &FishingManager{
+		logger:   logger,
+		sessions: make(map[string]*FishingSession),
+	}
+}
+
+// Cast throws the player's line at the fishing spot oid. It returns a rejection reason, or "".
+func (fm *FishingManager) Cast(ctx context.Context, gs *GameMatchState, playerID string, oid int, dispatcher runtime.MatchDispatcher) string {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	gs.mu.Unlock()
+	if !ok {
+		return RejectUnknownObject
+	}
+	if !strings.EqualFold(obj.Type, fishingSpotObjectType) {
+		return RejectInvalidTarget
+	}
+	spotPos, ok := obj.Position()
+	if !ok {
+		return RejectInvalidTarget
+	}
+	if spotPos.Sub(rb.Position).Magnitude() > fishingCastRange {
+		return RejectOutOfRange
+	}
+	table, _ := obj.Props["loot"].(string)
+	if table == "" {
+		fm.logger.Warn("Fishing spot %d (%s) has no loot property", oid, obj.Name)
+		return RejectInvalidTarget
+	}
+	tool := defaultFishingTool
+	if v, ok := obj.Props["tool"].(string); ok {
+		tool = v
+	}
+	if !strings.EqualFold(tool, "none") && gs.inventoryManager.Count(ctx, playerID, tool) <= 0 {
+		return RejectMissingTool
+	}
+
+	// Casting again reels the old line in without a catch
+	if _, fishing := fm.sessions[playerID]; fishing {
+		fm.finish(ctx, gs, playerID, FishingCancelled, nil, dispatcher)
+	}
+
+	biteMin, biteMax, window := defaultBiteMinSeconds, defaultBiteMaxSeconds, defaultBiteWindow
+	if v, ok := obj.Props["bitemin"].(float64); ok && v >= 0 {
+		biteMin = v
+	}
+	if v, ok := obj.Props["bitemax"].(float64); ok && v >= biteMin {
+		biteMax = v
+	}
+	if biteMax < biteMin {
+		biteMax = biteMin
+	}
+	if v, ok := obj.Props["window"].(float64); ok && v > 0 {
+		window = v
+	}
+	roll := gs.random.Roll(gs, RollFishingBite, playerID, map[string]any{"spot": oid, "biteMin": biteMin, "biteMax": biteMax})
+	biteSeconds := biteMin + roll.Float64()*(biteMax-biteMin)
+	gs.random.Record(roll, biteSeconds)
+	biteTick := gs.currentTick + int64(biteSeconds*TickRate)
+	fm.sessions[playerID] = &FishingSession{
+		SpotID:       oid,
+		LootTable:    table,
+		CastPosition: rb.Position,
+		BiteTick:     biteTick,
+		DeadlineTick: biteTick + int64(window*TickRate),
+	}
+	return ""
+}
+
+// Reel pulls the player's line in. Within the bite window the spot's loot table is rolled and
+// granted; before the bite the fish is scared off. It returns the result, the granted stacks
+// and a rejection reason.
+func (fm *FishingManager) Reel(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) (string, []LootStack, string) {
+	session, ok := fm.sessions[playerID]
+	if !ok {
+		return "", nil, RejectNotFishing
+	}
+	if gs.currentTick < session.BiteTick {
+		fm.finish(ctx, gs, playerID, FishingTooEarly, nil, dispatcher)
+		return FishingTooEarly, nil, ""
+	}
+
+	stacks := gs.lootCatalog.Roll(gs, session.LootTable, LootContext{PlayerID: playerID})
+	for i, stack := range stacks {
+		if err := gs.inventoryManager.Add(ctx, playerID, stack.ItemID, stack.Count); err != nil {
+			fm.logger.Error("reel: failed to add %d x %s to %s: %v", stack.Count, stack.ItemID, playerID, err)
+			if i == 0 {
+				// Nothing was granted; keep the line out so the player can try again in the window
+				return "", nil, RejectStorageError
+			}
+			stacks = stacks[:i]
+			break
+		}
+	}
+	result := FishingCaught
+	if len(stacks) == 0 {
+		result = FishingNothing
+	} else {
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	}
+	fm.finish(ctx, gs, playerID, result, stacks, dispatcher)
+	return result, stacks, ""
+}
+
+// Update announces bites, lets fish whose window passed escape and breaks the lines of players
+// who moved away, died or left. Called from the match loop.
+func (fm *FishingManager) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	for playerID, session := range fm.sessions {
+		rb := gs.PlayerBody(playerID)
+		if rb == nil {
+			// The player left; nothing to tell or record
+			delete(fm.sessions, playerID)
+			continue
+		}
+		if gs.GetPlayerState(playerID).IsDead() || rb.Position.Sub(session.CastPosition).Magnitude() > fishingMoveTolerance {
+			fm.finish(ctx, gs, playerID, FishingCancelled, nil, dispatcher)
+			continue
+		}
+		if gs.currentTick > session.DeadlineTick {
+			fm.finish(ctx, gs, playerID, FishingEscaped, nil, dispatcher)
+			continue
+		}
+		if !session.BiteSent && gs.currentTick >= session.BiteTick {
+			session.BiteSent = true
+			fm.send(gs, playerID, "fish_bite", FishingEvent{
+				SpotID: session.SpotID,
+				Window: float64(session.DeadlineTick-gs.currentTick) / TickRate,
+			}, dispatcher)
+		}
+	}
+}
+
+// IsFishing reports whether the player has a line in the water
+func (fm *FishingManager) IsFishing(playerID string) bool {
+	_, ok := fm.sessions[playerID]
+	return ok
+}
+
+// finish ends a session, tells the player and records catches and escapes in their stats
+func (fm *FishingManager) finish(ctx context.Context, gs *GameMatchState, playerID, result string, stacks []LootStack, dispatcher runtime.MatchDispatcher) {
+	session := fm.sessions[playerID]
+	delete(fm.sessions, playerID)
+	if session == nil {
+		return
+	}
+	fm.send(gs, playerID, "fishing_result", FishingEvent{SpotID: session.SpotID, Result: result, Items: stacks}, dispatcher)
+	if result == FishingCancelled {
+		return
+	}
+	if err := gs.databaseManager.RecordFishing(ctx, playerID, result == FishingCaught || result == FishingNothing, stacks); err != nil {
+		fm.logger.Error("Failed to record fishing result for %s: %v", playerID, err)
+	}
+}
+
+// send delivers an OpCodeFishing message to the fishing player
+func (fm *FishingManager) send(gs *GameMatchState, playerID, msgType string, event FishingEvent, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeFishing, msgType, event)
+	if err != nil {
+		fm.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeFishing, data, []runtime.Presence{presence}, nil, true)
+}
@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/rudransh61/Physix-go/pkg/rigidbody"
@@ -14,11 +17,50 @@ import (
 
 // OpCode constants for different message types
 const (
-	OpCodeWorldState   = 1 // Initial world state for new players
-	OpCodeWorldUpdate  = 2 // Regular world state updates
-	OpCodeMapChange    = 3 // Map change notifications
-	OpCodeInputACK     = 4 // Input acknowledgments
-	OpCodeObjectUpdate = 5 // Interaction notifications (e.g., item pickups)
+	OpCodeWorldState         = 1  // Initial world state for new players
+	OpCodeWorldUpdate        = 2  // Regular world state updates
+	OpCodeMapChange          = 3  // Map change notifications
+	OpCodeInputACK           = 4  // Input acknowledgments
+	OpCodeObjectUpdate       = 5  // Interaction notifications (e.g., item pickups)
+	OpCodeWorldVarChange     = 6  // Shared world variable changes for watching clients
+	OpCodeInventoryUpdate    = 7  // Player's own inventory after it changes
+	OpCodeEmote              = 8  // Emotes relayed to nearby players
+	OpCodePlayerStatus       = 9  // Owning player's health/stamina
+	OpCodeAbilityResult      = 10 // Ability casts relayed to nearby players
+	OpCodeCommandResult      = 11 // Slash command output for the player who ran it
+	OpCodeRespawn            = 12 // Player death and respawn events
+	OpCodeDamage             = 13 // Damage dealt to players and NPCs, relayed to nearby players
+	OpCodeWorldClock         = 14 // Time of day, sent periodically and at sunrise/sunset
+	OpCodeWeather            = 15 // Weather changes
+	OpCodeWorldEvent         = 16 // World event start/end announcements and participation rewards
+	OpCodeDuel               = 17 // Duel challenges, starts and results
+	OpCodeGuild              = 18 // Guild updates, invites and guild chat for guild members
+	OpCodeHousing            = 19 // Housing plot claims and releases
+	OpCodeFishing            = 20 // Fishing bites and results, sent to the fishing player
+	OpCodePet                = 21 // A player's pet list, sent to the owner
+	OpCodeQuest              = 22 // Quest log, NPC dialogue and quest markers, sent to one player
+	OpCodeReputation         = 23 // A player's faction standings, sent to that player
+	OpCodeExploration        = 24 // A player's explored map chunks, sent to that player
+	OpCodeRegion             = 25 // Region transitions, sent to the player who moved
+	OpCodeDungeon            = 26 // Dungeon instance progress, results and rewards
+	OpCodeProjectile         = 27 // Projectile launches, bounces, hits and ends, sent to players nearby
+	OpCodeCombat             = 28 // Area effects with all their hits, sent to players nearby
+	OpCodeNoise              = 29 // Noises (footsteps, explosions, ...), sent to the players who hear them
+	OpCodeTravel             = 30 // A player's activated waypoints and travels to other maps, sent to that player
+	OpCodeAnnouncement       = 31 // Server announcements (maintenance warnings, events), shown as a banner
+	OpCodeClock              = 32 // Clock sync: players send pings, the match answers with pongs and pings them for RTT
+	OpCodeLoginReward        = 33 // Daily login reward and streak, sent to the player who got it
+	OpCodeAuction            = 34 // Auction listings made and items or payouts delivered, sent to one player
+	OpCodeCutscene           = 35 // Scripted camera directives (focus, pan, input lock), sent to one player
+	OpCodePositionCorrection = 36 // The server moved a player (teleport, respawn, collision, anti-cheat); sent to that player
+	OpCodeAudio              = 37 // Audio cues (music, ambience) a player entered or left, sent to that player
+	OpCodeBark               = 38 // Lines said by NPCs, sent to the players near them
+	OpCodeMinimap            = 39 // Points of interest (quest givers, party, events, waypoints) for a player's minimap, sent to that player
+	OpCodeTrap               = 40 // Traps a player spotted, placed or saw go off, sent to the players who see them
+	OpCodeEncounter          = 41 // Wave encounter state changes and participant rewards
+	OpCodePreferences        = 42 // A player's saved client preferences, sent to that player when they join
+	OpCodeShop               = 43 // A vendor's items, prices and stock, sent to the player browsing it
+	OpCodeParty              = 44 // Party invites, membership and loot rolls, sent to the members
 )
 
 // Coordinate / tile sizing constants
@@ -32,75 +74,387 @@ const (
 	HalfTile = TileSize / 2.0
 )
 
+// TickRate is the number of match ticks per second; tick-based timers convert seconds with it
+const TickRate = 60
+
 type GameMatch struct{}
 
 type GameMatchState struct {
 	presences          map[string]runtime.Presence
-	objects            map[int]*ObjectData
+	presenceOrder      []string // presences' IDs, sorted (ordering.go)
 	gameObjects        []*rigidbody.RigidBody
-	playerObjects      map[string]*rigidbody.RigidBody
+	playerOrder        []string // IDs of the players with a body, sorted (ordering.go)
+	playerStates       map[string]*PlayerState
 	currentTick        int64
 	inputProcessor     *InputProcessor
 	physicsEngine      *PhysicsEngine
 	databaseManager    *DatabaseManager
 	mapLoader          *MapLoader
 	currentMap         *LoadedMap
+	currentMapName     string
 	scriptEngine       *ScriptEngine
+	interactionTracker *InteractionTracker
+	interactGuard      *InteractionGuard
+	worldVars          *WorldVars
+	regionVars         *RegionVars
+	inventoryManager   *InventoryManager
+	itemCatalog        *ItemCatalog
+	worldItems         *WorldItemManager
+	resourceNodes      *ResourceNodeManager
+	chunks             *ChunkStore
+	abilityCatalog     *AbilityCatalog
+	buildableCatalog   *BuildableCatalog
+	effectCatalog      *EffectCatalog
+	damagePipeline     *DamagePipeline
+	lootCatalog        *LootCatalog
+	cropCatalog        *CropCatalog
+	npcManager         *NPCManager
+	pathfinder         *Pathfinder
+	eventBus           *EventBus
+	worldClock         *WorldClock
+	weather            *WeatherSystem
+	worldEvents        *WorldEventScheduler
+	duels              *DuelManager
+	parties            *PartyManager
+	customWorld        *CustomWorld // set in custom world matches (custom_worlds.go)
+	guilds             *GuildManager
+	controlPoints      *ControlPointManager
+	doors              *DoorManager
+	containers         *ContainerManager
+	shops              *ShopManager
+	timedObjects       *TimedObjectManager
+	lights             *LightManager
+	attachments        *AttachmentManager
+	mechanisms         *MechanismManager
+	hazards            *HazardManager
+	traps              *TrapManager
+	encounters         *EncounterManager
+	survival           *SurvivalManager
+	loginRewards       *LoginRewardManager
+	auctions           *AuctionHouse
+	housing            *HousingManager
+	farms              *FarmManager
+	fishing            *FishingManager
+	pets               *PetManager
+	quests             *QuestManager
+	reputation         *ReputationManager
+	exploration        *ExplorationManager
+	waypoints          *WaypointManager
+	replay             *ReplayRecorder
+	bots               *BotDriver
+	announcements      *AnnouncementBoard
+	global             *GlobalChannel
+	moderation         *ModerationQueue
+	shard              *ShardManager
+	clock              *ClockSync
+	liveOps            *LiveOpsManager
+	worldSettings      *WorldSettings // server-wide settings in effect (world_settings.go)
+	config             *GameConfig    // gameplay constants in effect (game_config.go)
+	tuning             *LiveTuning    // parameters adjusted on the running match (live_tuning.go)
+	positionsResetAt   time.Time      // positions saved before the map's last world reset are ignored (world_reset.go)
+	metrics            *MatchMetrics
+	load               *LoadShedder
+	journal            *ActionJournal
+	cheats             *CheatMonitor
+	audioCues          *AudioCueManager
+	minimap            *MinimapManager
+	projectiles        *ProjectileManager
+	positionHistory    *PositionHistory
+	stealth            *StealthManager
+	encoder            *BroadcastEncoder  // reused encode buffers of world updates and input ACKs (broadcast_encoder.go)
+	updates            *UpdatePrioritizer // which entities each player's world updates carry (update_priority.go)
+	colliders          *ColliderChanges   // static colliders changed since the map was loaded, sent to clients (collider_changes.go)
+	snapshots          *SnapshotArena     // the player map and NPC and pet slices world broadcasts reuse (pools.go)
+	dungeon            *DungeonInstance   // nil in the open world
+	headless           bool               // driven by the replay harness: never registered, saves nothing (replay_harness.go)
+	random             *RNGService        // seeded per match; audits loot, fishing and crit rolls (rng.go)
+	rng                *rand.Rand         // the stream of random, for randomness that isn't audited (NPC behavior, loot scatter)
+	nextObjectID       int                // ID assigned to the next runtime-spawned object
+	objectUpdates      *ObjectUpdateBatcher
+	corrections        *PositionCorrector
 	mu                 sync.Mutex
-	gameObjectsByOwner map[int][]*rigidbody.RigidBody // map from object ID -> colliders owned by that object (authoritative owner index)
-	rbOwner            map[*rigidbody.RigidBody]int   // reverse lookup from rigid body pointer -> owner object id (helps cleanup)
+	snapshot           atomic.Pointer[WorldSnapshot] // the bodies as of this tick, read without the mutex (world_snapshot.go)
+	entities           *EntityRegistry               // players, NPCs and objects and the bodies each owns (entities.go)
+}
+
+// MatchSignalRequest is the envelope for signals sent to the match via nk.MatchSignal (e.g. from admin RPCs)
+type MatchSignalRequest struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
 }
 
+// Match signal types
+const (
+	SignalScriptStats    = "script_stats"    // returns per-script execution statistics
+	SignalReloadScripts  = "reload_scripts"  // reloads the storage script manifest for the current map
+	SignalReplayFlush    = "replay_flush"    // writes the replay segment being recorded
+	SignalBots           = "bots"            // sets the number of load test bots and returns the load report
+	SignalAnnounce       = "announce"        // schedules a server announcement
+	SignalWorldSettings  = "world_settings"  // reloads the world settings from storage and applies them
+	SignalWorldReset     = "world_reset"     // resets the match's world, or sends its players to the restarted map
+	SignalLiveOps        = "live_ops"        // reloads the live-ops events from storage and applies them
+	SignalAuctionClaims  = "auction_claims"  // delivers the auction claims waiting for the listed players
+	SignalGameConfig     = "game_config"     // reloads the game config from its file and storage and applies it
+	SignalTune           = "tune"            // adjusts the match's live tuning and returns the values it runs with
+	SignalStaticGeometry = "static_geometry" // returns the match's static colliders, which world updates leave out
+	SignalLoad           = "load"            // returns the match's load level and its recent changes
+)
+
 type GameMessage struct {
 	Type string      `json:"type"`
 	Data interface{} `json:"data"`
 }
 
 type PlayerInput struct {
-	PlayerID      string  `json:"playerId"`
-	ObjectID      int     `json:"objectId,omitempty"`
-	Action        string  `json:"action"`
-	InputSequence uint64  `json:"inputSequence"`       // Added
-	X             float64 `json:"x,omitempty"`         // For direct position (spawn/teleport)
-	Y             float64 `json:"y,omitempty"`         // For direct position (spawn/teleport)
-	VelocityX     float64 `json:"velocityX,omitempty"` // For movement vector
-	VelocityY     float64 `json:"velocityY,omitempty"` // For movement vector
-	DeltaTime     float64 `json:"deltaTime,omitempty"` // Time delta for movement calculation
+	PlayerID      string   `json:"playerId"`
+	ObjectID      int      `json:"objectId,omitempty"`
+	Action        string   `json:"action"`
+	InputSequence uint64   `json:"inputSequence"`         // Added
+	X             float64  `json:"x,omitempty"`           // For direct position (spawn/teleport)
+	Y             float64  `json:"y,omitempty"`           // For direct position (spawn/teleport)
+	VelocityX     float64  `json:"velocityX,omitempty"`   // For movement vector
+	VelocityY     float64  `json:"velocityY,omitempty"`   // For movement vector
+	DeltaTime     float64  `json:"deltaTime,omitempty"`   // Time delta for movement calculation
+	Keys          []string `json:"keys,omitempty"`        // World variable keys for watch_vars/unwatch_vars
+	ItemID        string   `json:"itemId,omitempty"`      // Item for use_item/drop
+	Count         int      `json:"count,omitempty"`       // Stack size for drop (defaults to 1)
+	EmoteID       string   `json:"emoteId,omitempty"`     // Emote to play
+	TargetID      string   `json:"targetId,omitempty"`    // Target player (emote, cast, target)
+	Facing        *float64 `json:"facing,omitempty"`      // Aim/facing angle in radians; any input may carry it
+	Sprint        bool     `json:"sprint,omitempty"`      // Sprint modifier for move (consumes stamina)
+	AbilityID     string   `json:"abilityId,omitempty"`   // Ability to cast
+	Text          string   `json:"text,omitempty"`        // Slash command line for command, new name for rename_pet
+	BuildableID   string   `json:"buildableId,omitempty"` // Buildable to place
+	PetID         string   `json:"petId,omitempty"`       // Pet to summon or rename
+	NPCID         int      `json:"npcId,omitempty"`       // NPC to talk to or hand a quest to
+	QuestID       string   `json:"questId,omitempty"`     // Quest to accept, turn in or abandon
+	Waypoint      string   `json:"waypoint,omitempty"`    // Waypoint to travel to
+	ViewTick      int64    `json:"viewTick,omitempty"`    // Tick of the latest world update the client showed; area casts are resolved against it
+	Price         int64    `json:"price,omitempty"`       // Auction starting price for auction_list
+	Buyout        int64    `json:"buyout,omitempty"`      // Auction buyout price for auction_list (0 = none)
+	Duration      float64  `json:"duration,omitempty"`    // Auction duration in hours for auction_list
+	Currency      string   `json:"currency,omitempty"`    // Auction wallet currency for auction_list
+	LootRule      string   `json:"lootRule,omitempty"`    // Party loot rule for party_loot_rule
+	RollID        int      `json:"rollId,omitempty"`      // Need/greed roll to answer with loot_roll
+	Choice        string   `json:"choice,omitempty"`      // need, greed or pass for loot_roll
 }
 
 // ACK response structure
 type InputACK struct {
-	PlayerID      string  `json:"playerId"`
-	ObjectID      int     `json:"objectId,omitempty"`
-	Action        string  `json:"action"`
-	InputSequence uint64  `json:"inputSequence"` // Added
-	Approved      bool    `json:"approved"`
-	Reason        string  `json:"reason,omitempty"`
-	Timestamp     int64   `json:"timestamp"`
-	X             float64 `json:"x,omitempty"` // Server authoritative position
-	Y             float64 `json:"y,omitempty"` // Server authoritative position
-	Gid           uint32  `json:"gid,omitempty"`
+	PlayerID      string    `json:"playerId"`
+	ObjectID      int       `json:"objectId,omitempty"`
+	Action        string    `json:"action"`
+	InputSequence uint64    `json:"inputSequence"` // Added
+	Approved      bool      `json:"approved"`
+	Reason        string    `json:"reason,omitempty"`
+	Timestamp     int64     `json:"timestamp"`
+	X             float64   `json:"x,omitempty"` // Server authoritative position
+	Y             float64   `json:"y,omitempty"` // Server authoritative position
+	Gid           uint32    `json:"gid,omitempty"`
+	DashCooldown  float64   `json:"dashCooldown,omitempty"`  // Seconds until the next dash is allowed
+	ItemID        string    `json:"itemId,omitempty"`        // Item used, picked up or dropped
+	Health        float64   `json:"health,omitempty"`        // Player health after use_item
+	Stamina       *float64  `json:"stamina,omitempty"`       // Owning player's stamina after the input
+	AbilityID     string    `json:"abilityId,omitempty"`     // Ability cast by the input
+	Cooldown      float64   `json:"cooldown,omitempty"`      // Seconds until the ability can be cast again
+	TargetID      string    `json:"targetId,omitempty"`      // Player locked onto by target
+	BuildableID   string    `json:"buildableId,omitempty"`   // Buildable placed (objectId is the new object)
+	Blocked       bool      `json:"blocked,omitempty"`       // A wall or the world edge pushed the player back this tick
+	ContactNormal *Position `json:"contactNormal,omitempty"` // Unit push-back direction when blocked
+}
+
+// Input rejection reason codes sent in InputACK.Reason. Clients use them to roll back
+// predicted actions and show feedback, so treat them as part of the protocol.
+const (
+	RejectInvalidAction        = "invalid_action"        // unknown action name
+	RejectInvalidPlayer        = "invalid_player"        // playerId doesn't match the sender
+	RejectRateLimited          = "rate_limited"          // too many inputs/uses in a short time
+	RejectMoving               = "moving"                // the action requires standing still
+	RejectDead                 = "dead"                  // the player is dead; only respawn is accepted
+	RejectInCutscene           = "in_cutscene"           // a cutscene locks the player's input
+	RejectNotDead              = "not_dead"              // respawn while alive
+	RejectNoPlayerObject       = "no_player_object"      // the player has no body in the world yet
+	RejectOnCooldown           = "on_cooldown"           // the action is cooling down
+	RejectOutOfRange           = "out_of_range"          // target too far away
+	RejectNoLineOfSight        = "no_line_of_sight"      // a wall is in the way
+	RejectInvalidTarget        = "invalid_target"        // missing or unsuitable target
+	RejectNoDirection          = "no_direction"          // directional action without a direction
+	RejectUnknownItem          = "unknown_item"          // item ID not in the item definitions
+	RejectNotOwned             = "not_owned"             // the player doesn't own the item
+	RejectFullHealth           = "full_health"           // healing at full health
+	RejectNotUsable            = "not_usable"            // the item has no usable effect
+	RejectEffectFailed         = "effect_failed"         // the effect script failed
+	RejectStorageError         = "storage_error"         // persisting the change failed; nothing changed
+	RejectNotFound             = "not_found"             // the world item no longer exists
+	RejectUnknownEmote         = "unknown_emote"         // emote not in the allow-list
+	RejectUnknownAbility       = "unknown_ability"       // ability ID not in the ability definitions
+	RejectInsufficientResource = "insufficient_resource" // not enough stamina/health for the cost
+	RejectUnknownObject        = "unknown_object"        // object ID doesn't exist
+	RejectUnknownCommand       = "unknown_command"       // slash command not in the command table
+	RejectPermissionDenied     = "permission_denied"     // the player's role can't run the command or build here
+	RejectUnknownBuildable     = "unknown_buildable"     // buildable ID not in the buildable definitions
+	RejectBlocked              = "blocked"               // the placement overlaps a collider, player or building
+	RejectMissingMaterials     = "missing_materials"     // the inventory lacks the building materials
+	RejectOccupied             = "occupied"              // the mount or carryable object is already in use
+	RejectAlreadyMounted       = "already_mounted"       // the player is riding another mount
+	RejectNotMounted           = "not_mounted"           // dismount while not riding
+	RejectNotCarryable         = "not_carryable"         // grab on an object without "carryable"
+	RejectAlreadyHolding       = "already_holding"       // grab while carrying another object
+	RejectNotHolding           = "not_holding"           // release while carrying nothing
+	RejectDepleted             = "depleted"              // the resource node is waiting to respawn
+	RejectMissingTool          = "missing_tool"          // the resource node requires a tool the player doesn't own
+	RejectInCombat             = "in_combat"             // unflagging PvP too soon after a PvP hit
+	RejectOutlaw               = "outlaw"                // outlaws can't turn their PvP flag off
+	RejectInDuel               = "in_duel"               // one of the players is already dueling
+	RejectNoRequest            = "no_request"            // no pending duel challenge or party invite from that player
+	RejectPlotClaimed          = "plot_claimed"          // the housing plot already has an owner
+	RejectPlotLimit            = "plot_limit"            // the player already owns a plot on this map
+	RejectPlotFull             = "plot_full"             // the plot reached its furniture limit
+	RejectOutsidePlot          = "outside_plot"          // the footprint crosses a plot's border
+	RejectAlreadyTilled        = "already_tilled"        // the soil is tilled already
+	RejectNotTilled            = "not_tilled"            // planting into soil that isn't tilled
+	RejectNotPlantable         = "not_plantable"         // the item isn't a seed in the crop definitions
+	RejectNotRipe              = "not_ripe"              // the crop is still growing
+	RejectNotFishing           = "not_fishing"           // reel without a line in the water
+	RejectNoPet                = "no_pet"                // dismiss without a summoned pet
+	RejectPetOwned             = "pet_owned"             // adopting a pet the player already has
+	RejectUnknownQuest         = "unknown_quest"         // quest ID not in the quest definitions
+	RejectQuestUnavailable     = "quest_unavailable"     // the quest can't be accepted (requirements, done) or isn't in the quest log
+	RejectQuestIncomplete      = "quest_incomplete"      // turning in a quest with unmet objectives
+	RejectQuestLogFull         = "quest_log_full"        // too many accepted quests
+	RejectHostile              = "hostile"               // the NPC's faction is hostile to the player
+	RejectLocked               = "locked"                // the door is locked and the player has no key
+	RejectDoorBlocked          = "door_blocked"          // someone stands in the doorway
+	RejectNotActivated         = "not_activated"         // the player hasn't activated the waypoint
+	RejectCannotTravel         = "cannot_travel"         // travel from a dungeon instance or custom world, or while leaving for another map
+	RejectCannotAfford         = "cannot_afford"         // the player can't pay the travel cost
+	RejectGMModeOff            = "gm_mode_off"           // GM commands need GM mode (/gm on)
+	RejectNotHungry            = "not_hungry"            // eating or drinking with the meters it restores full
+	RejectInvalidListing       = "invalid_listing"       // auction price, buyout or duration out of range
+	RejectEmpty                = "empty"                 // the shared container was looted and hasn't respawned
+	RejectAlreadyLooted        = "already_looted"        // the player looted the per-player container and it hasn't respawned for them
+	RejectClosed               = "closed"                // the object is outside its opening hours
+	RejectDisarmFailed         = "disarm_failed"         // the disarm roll missed the trap's DC
+	RejectInvalidName          = "invalid_name"          // an empty or too long name
+	RejectContentBlocked       = "content_blocked"       // the content filter refused the text
+	RejectFrozen               = "frozen"                // a script or GM froze the player's body
+	RejectObjectBusy           = "object_busy"           // another player is using the object; retry shortly
+	RejectLoading              = "loading"               // the saved state around the target is still being read; retry shortly
+	RejectDuplicate            = "duplicate"             // the input sequence was already handled
+	RejectOutOfStock           = "out_of_stock"          // the vendor has fewer of the item left than asked for
+	RejectPurchaseLimit        = "purchase_limit"        // the player bought as many as the vendor sells one player until its next restock
+	RejectInvalidCount         = "invalid_count"         // more than the action takes at once
+	RejectInParty              = "in_party"              // the invited player is already in a party
+	RejectPartyFull            = "party_full"            // the party has maxPartySize members
+	RejectNotInParty           = "not_in_party"          // a party action without a party
+	RejectUnknownRoll          = "unknown_roll"          // the loot roll ended or the player isn't rolling in it
+	RejectInvalidChoice        = "invalid_choice"        // an unknown loot rule or need/greed choice
+	RejectUnsavedWorld         = "unsaved_world"         // building outside plots on an extra or closing shard, which doesn't save its world
+)
+
+// Reject marks the input as rejected with a machine-readable reason code
+func (a *InputACK) Reject(reason string) {
+	a.Approved = false
+	a.Reason = reason
+}
+
+// WorldStateMessage is the world_state a joining player is sent: the whole world as it is. Its
+// fields keep the alphabetical order the message had as a map, so its bytes stay the same.
+type WorldStateMessage struct {
+	Clock         WorldClockData         `json:"clock"`
+	Colliders     []ColliderChange       `json:"colliders"` // object colliders changed since the map was loaded
+	ControlPoints []ControlPointData     `json:"controlPoints"`
+	Doors         []DoorData             `json:"doors"`
+	GameObjects   []*rigidbody.RigidBody `json:"gameObjects"`
+	LiveOps       LiveOpsSnapshot        `json:"liveOps"`
+	MapInfo       *MapInfo               `json:"mapInfo,omitempty"`
+	Mechanisms    []MechanismData        `json:"mechanisms"`
+	NPCs          []NPCData              `json:"npcs"`
+	Objects       []map[string]any       `json:"objects"`
+	Pets          []PetData              `json:"pets"`
+	PlayerCount   int                    `json:"playerCount"` // visible players
+	Plots         []PlotData             `json:"plots"`
+	Protocol      int                    `json:"protocol"`
+	Weather       WeatherData            `json:"weather"`
+	WorldEvents   []WorldEventData       `json:"worldEvents"`
 }
 
 type GameState struct {
 	Tick        int64                  `json:"tick"`
 	GameObjects []*rigidbody.RigidBody `json:"gameObjects"`
 	Players     map[string]PlayerData  `json:"players"`
+	NPCs        []NPCData              `json:"npcs"`
+	Pets        []PetData              `json:"pets"`
+	Lights      []LightData            `json:"lights,omitempty"`    // lit lights, for drawing and vision
+	Colliders   []ColliderChange       `json:"colliders,omitempty"` // static colliders changed since the viewer's last update
 }
 
 type ObjectData struct {
-	ID    int
-	Name  string
-	Type  string
-	GID   uint32
-	Props map[string]interface{}
+	ID        int
+	Name      string
+	Type      string
+	GID       uint32
+	Props     map[string]interface{}
+	Ownership *EntityOwnership // player-placed objects only
+	Collision *ObjectCollision // collision filtering of its colliders, set by scripts
+}
+
+// payload returns the fields clients need to render the object, as sent in the world_state
+// objects and the first object_updates entry of an object
+func (o *ObjectData) payload() map[string]any {
+	payload := map[string]any{
+		"objectId": o.ID,
+		"gid":      o.GID,
+		"props":    o.Props,
+	}
+	if pos, ok := o.Position(); ok {
+		payload["pos"] = map[string]any{"x": pos.X - HalfTile, "y": pos.Y + HalfTile}
+	}
+	return payload
+}
+
+// ObjectSnapshot returns every object with all its fields, by ID, so players joining late see
+// the GIDs and props scripts changed since the map was loaded
+func (gs *GameMatchState) ObjectSnapshot() []map[string]any {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	snapshot := make([]map[string]any, 0, gs.entities.ObjectCount())
+	for _, obj := range gs.Objects() {
+		snapshot = append(snapshot, obj.payload())
+	}
+	return snapshot
+}
+
+// Position returns the object's world center as stored in Props by the map loader
+func (o *ObjectData) Position() (vector.Vector, bool) {
+	x, okX := o.Props["x"].(float64)
+	y, okY := o.Props["y"].(float64)
+	if !okX || !okY {
+		return vector.Vector{}, false
+	}
+	return vector.Vector{X: x, Y: y}, true
 }
 
 type PlayerData struct {
-	SessionID string   `json:"sessionId"`
-	UserID    string   `json:"userId"`
-	Username  string   `json:"username"`
-	Position  Position `json:"position"`
+	SessionID string       `json:"sessionId"`
+	UserID    string       `json:"userId"`
+	Username  string       `json:"username"`
+	Position  Position     `json:"position"`
+	Facing    float64      `json:"facing"`                 // Aim/facing angle in radians
+	MountID   int          `json:"mountId,omitempty"`      // Mount object the player rides (rendered at the player's position)
+	HeldID    int          `json:"heldObjectId,omitempty"` // Object the player carries (rendered in front of the player)
+	MoveMode  string       `json:"moveMode"`               // MoveModeWalk or MoveModeSwim (animation set)
+	Health    float64      `json:"health"`
+	MaxHealth float64      `json:"maxHealth"`
+	Effects   []EffectData `json:"effects,omitempty"`   // active status effects (icons)
+	PvP       bool         `json:"pvp,omitempty"`       // flagged for PvP (or an outlaw)
+	Outlaw    bool         `json:"outlaw,omitempty"`    // karma at or below the outlaw threshold
+	DuelWith  string       `json:"duelWith,omitempty"`  // opponent of a running duel
+	GuildTag  string       `json:"guildTag,omitempty"`  // tag of the player's guild
+	Stealthed bool         `json:"stealthed,omitempty"` // in stealth; only sent to the player and those who detected them
+	Light     float64      `json:"light,omitempty"`     // radius of the light the player carries
+	Elevation float64      `json:"elevation,omitempty"` // height level the player stands on
+	Protected bool         `json:"protected,omitempty"` // under spawn protection
 }
 
 // Position represents a 2D position with lowercase JSON field names for client compatibility
@@ -128,31 +482,196 @@ func (p Position) ToVector() vector.Vector {
 func (m *GameMatch) MatchInit(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, params map[string]interface{}) (interface{}, int, string) {
 	// Create all required components
 	physicsEngine := NewPhysicsEngine()
-	mapLoader := NewMapLoader(logger, "/nakama/data/maps")
+	mapLoader := NewMapLoader(logger, mapDirectory)
+	databaseManager := NewDatabaseManager(logger, nk)
 
 	// Connect the physics engine to the map loader
 	mapLoader.SetPhysicsEngine(physicsEngine)
 
 	state := &GameMatchState{
 		presences:       make(map[string]runtime.Presence),
-		objects:         make(map[int]*ObjectData),
 		gameObjects:     make([]*rigidbody.RigidBody, 0),
-		playerObjects:   make(map[string]*rigidbody.RigidBody),
+		playerStates:    make(map[string]*PlayerState),
 		currentTick:     0,
 		inputProcessor:  NewInputProcessor(),
+		config:          DefaultGameConfig(),
+		tuning:          &LiveTuning{},
 		physicsEngine:   physicsEngine,
-		databaseManager: NewDatabaseManager(logger, nk),
+		databaseManager: databaseManager,
 		mapLoader:       mapLoader,
 		currentMap:      nil,
-		scriptEngine:    NewScriptEngine(logger, "/nakama/data/scripts"),
-		// map from object ID -> colliders owned by that object (authoritative owner index)
-		gameObjectsByOwner: make(map[int][]*rigidbody.RigidBody),
-		// reverse lookup from rigid body pointer -> owner object id (helps cleanup)
-		rbOwner: make(map[*rigidbody.RigidBody]int),
+		scriptEngine:    NewScriptEngine(logger, nk, "/nakama/data/scripts"),
+		// per-player interaction cooldowns and once-only flags used by scripts
+		interactionTracker: NewInteractionTracker(logger, databaseManager),
+		// per-object interaction locks and the claims scripts make on shared objects
+		interactGuard: NewInteractionGuard(),
+		// shared variables scripts use to coordinate across objects
+		worldVars: NewWorldVars(),
+		// script variables scoped to the map's regions, e.g. one dungeon room's puzzle
+		regionVars: NewRegionVars(),
+		// persistent player inventories and the item definitions use_item applies
+		inventoryManager: NewInventoryManager(logger, databaseManager),
+		itemCatalog:      NewItemCatalog(logger, "/nakama/data/items.json"),
+		// item stacks lying in the world (dropped by players or spawned by scripts)
+		worldItems: NewWorldItemManager(logger),
+		// gatherable "resource" map objects and their respawn timers
+		resourceNodes: NewResourceNodeManager(logger),
+		// resource timers and buildings saved by map chunk, loaded as players reach them
+		chunks: NewChunkStore(logger, databaseManager),
+		// castable abilities for the cast action
+		abilityCatalog: NewAbilityCatalog(logger, "/nakama/data/abilities.json"),
+		// whitelisted objects players may place
+		buildableCatalog: NewBuildableCatalog(logger, "/nakama/data/buildables.json"),
+		// status effects applied by abilities, scripts and effect zones
+		effectCatalog: NewEffectCatalog(logger, "/nakama/data/effects.json"),
+		// ordered damage stages that armor, effects, shields and script modifiers hook into
+		damagePipeline: NewDamagePipeline(),
+		// weighted loot tables rolled on NPC death and by chest scripts
+		lootCatalog: NewLootCatalog(logger, "/nakama/data/loot_tables.json"),
+		// crops grown from seed items
+		cropCatalog: NewCropCatalog(logger, "/nakama/data/crops.json"),
+		// NPC definitions and the NPCs spawned from the map's spawners
+		npcManager: NewNPCManager(logger, "/nakama/data/npcs.json"),
+		// A* over the walkability grid derived from static colliders
+		pathfinder: NewPathfinder(),
+		// match events (sunrise, sunset, ...) delivered to Go subsystems and scripts
+		eventBus: NewEventBus(logger),
+		// server-authoritative time of day
+		worldClock: NewWorldClock(),
+		// weather state machine and its gameplay effects
+		weather: NewWeatherSystem(logger),
+		// cron-scheduled world events with bosses, event zones and participation rewards
+		worldEvents: NewWorldEventScheduler(logger, "/nakama/data/world_events.json"),
+		// duel challenges and running duels
+		duels: NewDuelManager(logger),
+		// parties, their loot rules and need/greed rolls
+		parties: NewPartyManager(logger),
+		// guilds of the connected players
+		guilds: NewGuildManager(logger, databaseManager),
+		// capturable control points and their owners
+		controlPoints: NewControlPointManager(logger),
+		// doors and gates, open or closed
+		doors: NewDoorManager(logger),
+		// chests and other openable containers, and their loot timers
+		containers: NewContainerManager(logger),
+		// vendors, their stock and its restock schedules
+		shops: NewShopManager(logger, "/nakama/data/shops.json"),
+		// shops with opening hours and lamps switching tiles at night
+		timedObjects: NewTimedObjectManager(logger),
+		// map, object and script lights that can be lit and put out
+		lights: NewLightManager(logger),
+		// colliders, lights and bodies following players and NPCs
+		attachments: NewAttachmentManager(logger),
+		// levers and pressure plates linked to doors, objects and spawners
+		mechanisms: NewMechanismManager(logger),
+		// lava, poison and cold areas hurting the bodies inside
+		hazards: NewHazardManager(logger),
+		// map traps and the traps players placed, and who spotted them
+		traps: NewTrapManager(logger),
+		// wave encounters of the map's arenas and public event areas
+		encounters: NewEncounterManager(logger, "/nakama/data/encounters.json"),
+		// hunger and thirst meters on survival maps
+		survival: NewSurvivalManager(logger, databaseManager),
+		// daily login rewards and streaks
+		loginRewards: NewLoginRewardManager(logger, databaseManager, "/nakama/data/login_rewards.json"),
+		// auction listings, bids and the items and payouts waiting for players
+		auctions: NewAuctionHouse(logger, databaseManager),
+		// housing plots, their owners and furniture
+		housing: NewHousingManager(logger),
+		// farmable soil and growing crops
+		farms: NewFarmManager(logger),
+		// fishing lines in the water
+		fishing: NewFishingManager(logger),
+		// pet definitions and the pets of online players
+		pets: NewPetManager(logger, databaseManager, "/nakama/data/pets.json"),
+		// quest definitions and the quest logs of online players
+		quests: NewQuestManager(logger, databaseManager, "/nakama/data/quests.json"),
+		// factions and the standings of online players
+		reputation: NewReputationManager(logger, databaseManager, "/nakama/data/factions.json"),
+		// the map chunks each online player has explored
+		exploration: NewExplorationManager(logger, databaseManager),
+		// the waypoints each online player has activated and travels between them
+		waypoints: NewWaypointManager(logger, databaseManager),
+		// recorded inputs and snapshots of this match, for debugging and cheat reports
+		replay: NewReplayRecorder(logger, databaseManager),
+		// object changes waiting for the end of the tick
+		objectUpdates: NewObjectUpdateBatcher(logger),
+		// forced player moves, sent as position corrections after physics
+		corrections: NewPositionCorrector(logger),
+		// headless bots for load testing ("bots" match parameter or the admin_bots RPC)
+		bots: NewBotDriver(logger),
+		// server announcements sent through the admin_announce RPC
+		announcements: NewAnnouncementBoard(logger),
+		// global chat, LFG announcements and friend presence shared by every shard
+		global: NewGlobalChannel(logger, nk),
+		// player texts waiting on the moderation service, applied when it answers
+		moderation: NewModerationQueue(),
+		// which shard of its map this open world match is, and its occupancy label
+		shard: NewShardManager(logger),
+		// clock sync with clients and each player's round trip time
+		clock: NewClockSync(logger),
+		// seasonal and live-ops events from storage: special spawns, tile swaps, XP and loot modifiers
+		liveOps: NewLiveOpsManager(logger),
+		// tick time, traffic and entity counts reported through Nakama's metrics
+		metrics: NewMatchMetrics(nk),
+		// tick overrun detection and the load shed while ticks run over budget
+		load: NewLoadShedder(logger),
+		// append-only storage journal of item grants, currency changes, trades and container opens
+		journal: NewActionJournal(logger, databaseManager),
+		// the match's seeded RNG and the storage audit of the rolls players may dispute
+		random: NewRNGService(logger, databaseManager),
+		// anti-cheat signals of the online players, their persisted reports and automatic actions
+		cheats: NewCheatMonitor(logger, databaseManager),
+		// the map's audio cues each player stands in
+		audioCues: NewAudioCueManager(logger),
+		// the minimap points of interest last sent to each player
+		minimap: NewMinimapManager(logger),
+		// projectiles in flight, launched by abilities and scripts
+		projectiles: NewProjectileManager(logger),
+		// recent player and NPC positions for resolving hits against what clients saw
+		positionHistory: NewPositionHistory(),
+		// hidden players and who detected them
+		stealth: NewStealthManager(),
+		// the snapshot buffers world broadcasts fill every tick
+		snapshots: NewSnapshotArena(),
+		// the buffers world updates and input ACKs are encoded into
+		encoder: NewBroadcastEncoder(),
+		// what each player's client holds of the world, for prioritized world updates
+		updates: NewUpdatePrioritizer(),
+		// the object colliders changed after the map was loaded, which clients don't have
+		colliders: NewColliderChanges(),
+		// players, NPCs and objects and the bodies each owns
+		entities: NewEntityRegistry(),
 	}
 
+	// Dungeon instances are created with the dungeon, its party and a seed (dungeons.go)
+	if _, isDungeon := params["dungeon"]; isDungeon {
+		dungeon, err := dungeonFromParams(logger, params)
+		if err != nil {
+			logger.Error("Failed to set up dungeon instance: %v", err)
+			return nil, 0, ""
+		}
+		state.dungeon = dungeon
+		state.random.Seed(dungeon.Seed)
+	}
+	// Custom worlds are created by world_create with their owner, visibility and rules
+	if _, isCustom := params["world"]; isCustom {
+		world, err := customWorldFromParams(logger, params)
+		if err != nil {
+			logger.Error("Failed to set up custom world: %v", err)
+			return nil, 0, ""
+		}
+		world.Entry.ID, _ = ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+		state.customWorld = world
+	}
+	// A seed given at creation makes any match deterministic, for replays and tests
+	if seed, ok := rngSeedParam(params); ok {
+		state.random.Seed(seed)
+	}
+	state.rng = state.random.Stream()
+
 	// Try to load default map
-	defaultMap := "elderford/world.json" // Default map file
+	defaultMap := defaultWorldMap
 	if mapName, exists := params["map"]; exists {
 		if mapStr, ok := mapName.(string); ok {
 			defaultMap = mapStr
@@ -164,20 +683,227 @@ func (m *GameMatch) MatchInit(ctx context.Context, logger runtime.Logger, db *sq
 		panic(fmt.Sprintf("Failed to load default map %s: %v", defaultMap, err))
 	} else {
 		state.currentMap = loadedMap
+		state.currentMapName = defaultMap
 		state.mapLoader.ApplyMapToGameState(loadedMap, state)
 		logger.Info("Loaded map: %s", defaultMap)
 	}
 
-	logger.Debug("Debug state after initialization: %d game objects, %d player objects", len(state.gameObjects), len(state.playerObjects))
+	// Gameplay constants from the config file and the stored overrides; the defaults stay when
+	// they are invalid
+	state.reloadGameConfig(ctx, logger)
+
+	// Server-wide settings: player cap, bounds and physics overrides, fallback spawns, game rules
+	if settings, err := state.databaseManager.LoadWorldSettings(ctx); err != nil {
+		logger.Error("Failed to load world settings: %v", err)
+	} else {
+		state.ApplyWorldSettings(settings, logger)
+	}
+
+	// Dungeon instances, custom worlds and replay harness runs start from the map's initial
+	// state; only the open world restores and saves world state
+	state.headless = harnessParam(params)
+	persistent := !state.instanced() && !state.headless
+
+	// Saved positions from before the map's last world reset are dropped on join
+	if persistent {
+		if reset, err := state.databaseManager.LoadWorldReset(ctx, state.currentMapName); err != nil {
+			logger.Error("Failed to load world reset for %s: %v", state.currentMapName, err)
+		} else if reset != nil {
+			state.positionsResetAt = reset.PositionsResetAt
+		}
+	}
+
+	// Clock settings come from the map; the persisted time (if any) wins over its start hour.
+	// Restored before NPCs spawn so scheduled NPCs start on or off duty correctly
+	state.worldClock.Configure(state.currentMap.Properties)
+	state.survival.Configure(state.currentMap.Properties)
+	if persistent {
+		if err := state.worldClock.Restore(ctx, state.databaseManager); err != nil {
+			logger.Error("Failed to restore world clock: %v", err)
+		}
+	}
+
+	// Weather states and durations allowed on this map
+	state.weather.Configure(state.currentMap.Properties)
+
+	// Record the match's inputs into a storage ring buffer sized by the map
+	matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	state.replay.Configure(ctx, matchID, state.currentMapName, state.currentMap.Properties)
+
+	// Tag the match's metrics so dashboards can split them by map and mode
+	mode := "open_world"
+	if state.dungeon != nil {
+		mode = "dungeon"
+	}
+	state.metrics.Configure(matchID, state.currentMapName, mode)
+	state.journal.Configure(matchID, state.currentMapName)
+	state.random.Configure(matchID, state.currentMapName)
+
+	// Load test bots requested at creation
+	if count := botCountParam(params); count > 0 {
+		state.bots.SetCount(state, count, nil, logger)
+	}
+
+	// Chunk grid players explore
+	state.exploration.Configure(state.currentMap, state.currentMapName)
+
+	// Chunk grid the world's resource timers and buildings are saved by; only the primary shard saves it
+	state.chunks.Configure(state.currentMap, state.currentMapName, persistent)
+
+	// Populate the map's NPC spawners (after the map reset gameObjects)
+	state.npcManager.SpawnFromMap(state)
+
+	// Subscribe map object scripts and NPCs to match events
+	state.eventBus.SubscribeMapObjects(state)
+	state.npcManager.SubscribeEvents(state.eventBus)
+	state.quests.SubscribeEvents(state.eventBus)
+	state.reputation.SubscribeEvents(state.eventBus)
+	state.timedObjects.SubscribeEvents(state.eventBus)
+	state.shops.SubscribeEvents(state.eventBus)
+	state.encounters.SubscribeEvents(state.eventBus)
+	if state.dungeon != nil {
+		state.dungeon.SubscribeEvents(state.eventBus)
+	}
+
+	// Open or close the objects with opening hours and light the lamps for the restored time
+	state.timedObjects.LoadFromMap(state)
+
+	// Register the map's lights and the lights of objects with a light radius
+	state.lights.LoadFromMap(state)
+
+	// Apply the live-ops events running now (after the map objects and NPCs exist)
+	if err := state.liveOps.Refresh(ctx, state, nil); err != nil {
+		logger.Error("Failed to load live-ops events: %v", err)
+	}
+
+	// Register gatherable nodes; nodes depleted before a restart stay depleted until their timer
+	// ends, applied as their chunks load
+	state.resourceNodes.LoadFromMap(state)
+	if persistent {
+		if err := state.resourceNodes.Restore(ctx, state); err != nil {
+			logger.Error("Failed to restore resource nodes: %v", err)
+		}
+	}
+
+	// Register control points and hand them back to their owners from before a restart
+	state.controlPoints.LoadFromMap(state)
+	if persistent {
+		if err := state.controlPoints.Restore(ctx, state); err != nil {
+			logger.Error("Failed to restore control points: %v", err)
+		}
+	}
+
+	// Register doors and put them back the way they were before a restart
+	state.doors.LoadFromMap(state)
+	if persistent {
+		if err := state.doors.Restore(ctx, state); err != nil {
+			logger.Error("Failed to restore doors: %v", err)
+		}
+	}
+
+	// Link levers and pressure plates to their targets; saved levers move their targets again
+	state.mechanisms.LoadFromMap(state)
+	if persistent {
+		if err := state.mechanisms.Restore(ctx, state); err != nil {
+			logger.Error("Failed to restore mechanisms: %v", err)
+		}
+	}
+
+	// Register containers; containers looted before a restart stay looted until their timers end
+	state.containers.LoadFromMap(state)
+	if persistent {
+		if err := state.containers.Restore(ctx, state); err != nil {
+			logger.Error("Failed to restore containers: %v", err)
+		}
+	}
+
+	// Register vendors; stock bought before a restart stays bought until the next restock
+	state.shops.LoadFromMap(state)
+	if persistent {
+		if err := state.shops.Restore(ctx, state); err != nil {
+			logger.Error("Failed to restore shops: %v", err)
+		}
+	}
+
+	// Build the sensors of the map's hazards
+	state.hazards.LoadFromMap(state)
+
+	// Arm the map's traps
+	state.traps.LoadFromMap(state)
+
+	// Register the map's encounter areas
+	state.encounters.LoadFromMap(state)
+
+	// Register housing plots and respawn the furniture saved on claimed ones
+	state.housing.LoadFromMap(state)
+	if persistent {
+		if err := state.housing.Restore(ctx, state); err != nil {
+			logger.Error("Failed to restore housing plots: %v", err)
+		}
+	}
+
+	// Register farmable soil; crops planted before a restart have kept growing
+	state.farms.LoadFromMap(state)
+	if persistent {
+		if err := state.farms.Restore(ctx, state); err != nil {
+			logger.Error("Failed to restore farms: %v", err)
+		}
+	}
+
+	logger.Debug("Debug state after initialization: %d game objects, %d player objects", len(state.gameObjects), state.entities.PlayerCount())
 
 	// Try to restore world state from persistent storage
-	if err := state.databaseManager.RestoreWorldFromPersistence(ctx, state); err != nil {
-		logger.Error("Failed to restore world from persistence: %v", err)
-		// Continue with default initialization
+	if persistent {
+		if err := state.databaseManager.RestoreWorldFromPersistence(ctx, state); err != nil {
+			logger.Error("Failed to restore world from persistence: %v", err)
+			// Continue with default initialization
+		}
+	}
+
+	// Load storage-backed script overrides published for this map
+	if err := state.scriptEngine.LoadManifest(ctx, state.databaseManager, state.currentMapName); err != nil {
+		logger.Error("Failed to load script manifest for %s: %v", state.currentMapName, err)
+	}
+
+	// Restore persisted script world variables
+	if !persistent {
+		// Instances keep their own variables
+	} else if values, err := state.databaseManager.LoadWorldVars(ctx); err != nil {
+		logger.Error("Failed to restore world vars: %v", err)
+	} else {
+		state.worldVars.Restore(values)
+	}
+	if persistent {
+		if err := state.regionVars.Restore(ctx, state); err != nil {
+			logger.Error("Failed to restore region vars: %v", err)
+		}
+	}
+
+	tickRate := TickRate // 60 ticks per second for game simulation
+	if state.dungeon != nil {
+		logger.Info("Dungeon %s instance initialized for %d players (seed %d)", state.dungeon.Def.ID, len(state.dungeon.Party), state.random.seed)
+		return state, tickRate, dungeonMatchLabel
+	}
+	if state.customWorld != nil {
+		logger.Info("Custom world %q of %s initialized on %s for up to %d players", state.customWorld.Entry.Name, state.customWorld.Entry.Owner, state.currentMapName, state.customWorld.Entry.MaxPlayers)
+		return state, tickRate, state.customWorld.Label(state)
+	}
+	if state.headless {
+		return state, tickRate, ""
 	}
 
-	tickRate := 60 // 60 ticks per second for game simulation
-	label := "open_world_game"
+	// Open world matches are shards of their map, labelled with their occupancy so find_world
+	// and travels can route players (shards.go)
+	state.shard.Configure(state, params)
+	label := state.shard.Label(state)
+
+	// Put back the items dropped before a restart; only the primary shard owns them, so loot
+	// isn't copied into every shard
+	if state.shard.Primary() {
+		if err := state.worldItems.RestoreSaved(ctx, state); err != nil {
+			logger.Error("Failed to restore world items: %v", err)
+		}
+	}
 
 	logger.Info("Open world game match initialized - always active with persistent storage")
 
@@ -192,8 +918,9 @@ func (m *GameMatch) MatchJoin(ctx context.Context, logger runtime.Logger, db *sq
 	}
 
 	for _, presence := range presences {
-		gameState.presences[presence.GetUserId()] = presence
+		gameState.addPresence(presence)
 		logger.Info("Player joined open world: %s", presence.GetUsername())
+		gameState.replay.RecordPresence(gameState, presence, true)
 
 		// Try to load player's saved position and data
 		playerData, err := gameState.databaseManager.LoadPlayerData(ctx, presence.GetUserId())
@@ -201,39 +928,186 @@ func (m *GameMatch) MatchJoin(ctx context.Context, logger runtime.Logger, db *sq
 			logger.Error("Failed to load player data for %s: %v", presence.GetUsername(), err)
 		}
 
-		// Use saved position if available, otherwise use map spawn point
+		// Use saved position if available, otherwise use map spawn point. Saved positions belong
+		// to the open world, so dungeon instances always use the spawn point.
 		spawnPosition := vector.Vector{X: 100, Y: 100} // Default fallback
-		if playerData != nil {
+		if arrival, ok := gameState.waypoints.Arrival(ctx, gameState, presence.GetUserId()); ok {
+			// Travelling here from a waypoint on another map
+			spawnPosition = arrival
+			logger.Info("Player %s arrived by waypoint at (%f, %f)", presence.GetUsername(), spawnPosition.X, spawnPosition.Y)
+		} else if playerData != nil && !gameState.instanced() && playerData.LastLoginTime.After(gameState.positionsResetAt) {
 			spawnPosition = playerData.Position
 			logger.Info("Restored player %s to saved position (%f, %f)", presence.GetUsername(), spawnPosition.X, spawnPosition.Y)
-		} else if gameState.currentMap != nil {
-			// Use map spawn point for new players
-			spawnPosition = gameState.mapLoader.GetRandomSpawnPoint(gameState.currentMap)
-			logger.Info("Spawning new player %s at map spawn point (%f, %f)", presence.GetUsername(), spawnPosition.X, spawnPosition.Y)
+		} else {
+			// Use the map's spawn point (or the world settings' ones) for new players
+			spawnPosition = gameState.spawnPoint()
+			logger.Info("Spawning new player %s at spawn point (%f, %f)", presence.GetUsername(), spawnPosition.X, spawnPosition.Y)
 		}
 
 		// Create player object for new player
 		gameState.inputProcessor.CreatePlayerObject(gameState, presence.GetUserId(), spawnPosition)
+
+		// New arrivals can't be attacked or noticed by NPCs for a few seconds
+		gameState.GrantSpawnProtection(presence.GetUserId())
+
+		// Remember the account role so slash commands can be permission-checked without a lookup per command
+		gameState.GetPlayerState(presence.GetUserId()).Role = accountRole(ctx, nk, presence.GetUserId())
+
+		// Server messages sent to the player carry text rendered in their account language
+		gameState.GetPlayerState(presence.GetUserId()).Locale = accountLocale(ctx, nk, presence.GetUserId())
+
+		// Karma decides whether the player is an outlaw
+		if stats, err := gameState.databaseManager.LoadPlayerStats(ctx, presence.GetUserId()); err != nil {
+			logger.Error("Failed to load stats for %s: %v", presence.GetUsername(), err)
+		} else {
+			gameState.GetPlayerState(presence.GetUserId()).Karma = stats.Karma
+		}
+
+		// Load interaction cooldowns/once-only flags so scripts can gate rewards
+		gameState.interactionTracker.LoadPlayer(ctx, presence.GetUserId())
+
+		// Load the player's inventory and send it to their client
+		gameState.inventoryManager.LoadPlayer(ctx, presence.GetUserId())
+		gameState.inventoryManager.SyncToClient(ctx, gameState, presence.GetUserId(), dispatcher)
+
+		// Load the player's guild and send it to the online members
+		gameState.guilds.LoadPlayer(ctx, presence.GetUserId(), presence.GetUsername())
+		gameState.guilds.SyncMembers(gameState, presence.GetUserId(), dispatcher)
+
+		// Load the player's pets and bring back the one they left with
+		gameState.pets.LoadPlayer(ctx, gameState, presence.GetUserId(), dispatcher)
+
+		// Load the player's quest log and send it to their client
+		gameState.quests.LoadPlayer(ctx, gameState, presence.GetUserId(), dispatcher)
+
+		// Load the player's faction standings and send them to their client
+		gameState.reputation.LoadPlayer(ctx, gameState, presence.GetUserId(), dispatcher)
+
+		// Send the player the chunks they explored on this map, revealing the one they spawned in
+		gameState.exploration.LoadPlayer(ctx, gameState, presence.GetUserId(), dispatcher)
+
+		// Load the player's cheat report so new signals add to it
+		gameState.cheats.LoadPlayer(ctx, presence.GetUserId(), presence.GetUsername())
+
+		// Send the player the waypoints they can travel to
+		gameState.waypoints.LoadPlayer(ctx, gameState, presence.GetUserId(), dispatcher)
+
+		// Send the player the client settings they saved with player_preferences
+		gameState.SendPreferences(ctx, presence.GetUserId(), dispatcher, logger)
+
+		// Grant the daily login reward on the player's first join of the day
+		gameState.loginRewards.Claim(ctx, gameState, presence.GetUserId(), dispatcher)
+
+		// Hand over items won, bought or returned at the auction house while the player was away
+		gameState.auctions.Deliver(ctx, gameState, presence.GetUserId(), dispatcher)
+
+		// Hand over the rewards of world events and encounters that ended after the player left them
+		gameState.DeliverRewardClaims(ctx, presence.GetUserId(), dispatcher, logger)
+
+		// Let the player's friends know they came online in the world
+		if gameState.dungeon == nil {
+			notifier.FriendOnline(ctx, presence.GetUserId(), presence.GetUsername(), gameState.currentMapName)
+		}
+
+		// Show the player the announcements currently up
+		gameState.announcements.Join(gameState, presence.GetUserId(), dispatcher)
+
+		// Put the player on the global chat stream, with the map they are on
+		gameState.global.Join(gameState, presence)
+
+		// Restore the hunger and thirst the player left a survival map with
+		gameState.survival.LoadPlayer(ctx, gameState, presence.GetUserId())
+
+		// Reapply long-running status effects saved when the player last left
+		if err := gameState.RestorePlayerEffects(ctx, presence.GetUserId()); err != nil {
+			logger.Error("Failed to restore effects for %s: %v", presence.GetUsername(), err)
+		}
+
+		// Show the dungeon's progress to party members
+		if gameState.dungeon != nil {
+			gameState.dungeon.Join(gameState, presence.GetUserId(), dispatcher)
+		}
+
+		// Show the sprung traps, those in plain sight and the player's own
+		gameState.traps.Join(gameState, presence.GetUserId(), dispatcher)
+
+		// Show the encounters under way
+		gameState.encounters.Join(gameState, presence.GetUserId(), dispatcher)
+
+		// world_state below gives the player the whole world; updates start over from it
+		gameState.updates.Forget(presence.GetUserId())
 	}
 
 	// Send current world state to new players
-	worldData := map[string]interface{}{
-		"playerCount": len(gameState.presences),
-		"gameObjects": gameState.gameObjects,
+	bodies, owners := gameState.DynamicBodies()
+	playerIDs := make([]string, 0, len(gameState.presences))
+	for playerID := range gameState.Presences() {
+		playerIDs = append(playerIDs, playerID)
+	}
+	worldData := WorldStateMessage{
+		Protocol:      ProtocolVersion,
+		PlayerCount:   len(gameState.presences) - gameState.stealth.InvisibleCount(gameState),
+		GameObjects:   bodies,
+		Colliders:     gameState.AllColliderChanges(playerIDs),
+		Objects:       gameState.ObjectSnapshot(),
+		NPCs:          gameState.npcManager.Snapshot(),
+		Pets:          gameState.npcManager.PetSnapshot(),
+		Clock:         gameState.worldClock.Snapshot(),
+		Weather:       gameState.weather.Snapshot(gameState.currentTick),
+		WorldEvents:   gameState.worldEvents.Snapshot(gameState),
+		ControlPoints: gameState.controlPoints.Snapshot(),
+		Doors:         gameState.doors.Snapshot(),
+		Mechanisms:    gameState.mechanisms.Snapshot(),
+		Plots:         gameState.housing.Snapshot(),
+		LiveOps:       gameState.liveOps.Snapshot(gameState),
 	}
 
 	// Include map information if available
 	if gameState.currentMap != nil {
-		worldData["mapInfo"] = gameState.mapLoader.GetMapInfo(gameState.currentMap)
+		worldData.MapInfo = gameState.mapLoader.GetMapInfo(gameState.currentMap)
 	}
 
-	message := GameMessage{
-		Type: "world_state",
-		Data: worldData,
+	hiding, dark := gameState.stealth.AnyHidden(), gameState.VisionLimited()
+	if !hiding && !dark {
+		if data, err := EncodeMessage(OpCodeWorldState, "world_state", worldData); err != nil {
+			logger.Error("Failed to marshal world state: %v", err)
+		} else {
+			dispatcher.BroadcastMessage(OpCodeWorldState, data, nil, nil, true)
+		}
+	} else {
+		// Hidden players' bodies only go to themselves and the players who detected them, and
+		// what stands in the dark only to those who can see it, as in world updates
+		var lights []LightSource
+		if dark {
+			lights = gameState.LightSources()
+		}
+		npcs, pets := worldData.NPCs, worldData.Pets
+		for viewerID, presence := range gameState.Presences() {
+			inSight := func(vector.Vector) bool { return true }
+			if dark {
+				view := gameState.litWorld(viewerID, GameState{NPCs: npcs, Pets: pets}, lights)
+				worldData.NPCs, worldData.Pets = view.NPCs, view.Pets
+				inSight = gameState.inSight(viewerID, lights)
+			}
+			worldData.GameObjects = SeenBodies(bodies, owners, func(playerID string) bool {
+				if playerID == viewerID {
+					return true
+				}
+				rb := gameState.PlayerBody(playerID)
+				return gameState.stealth.CanSee(viewerID, playerID, gameState.currentTick) && (rb == nil || inSight(rb.Position))
+			})
+			data, err := EncodeMessage(OpCodeWorldState, "world_state", worldData)
+			if err != nil {
+				logger.Error("Failed to marshal world state for %s: %v", viewerID, err)
+				continue
+			}
+			dispatcher.BroadcastMessage(OpCodeWorldState, data, []runtime.Presence{presence}, nil, true)
+		}
 	}
 
-	data, _ := json.Marshal(message)
-	dispatcher.BroadcastMessage(OpCodeWorldState, data, nil, nil, true)
+	// Publish the new occupancy for find_world
+	gameState.shard.UpdateLabel(gameState, dispatcher)
+	gameState.customWorld.UpdateLabel(gameState, dispatcher)
 
 	return gameState
 }
@@ -245,7 +1119,28 @@ func (m *GameMatch) MatchJoinAttempt(ctx context.Context, logger runtime.Logger,
 		return nil, false, "Internal server error"
 	}
 
-	// Open world - allow all players to join
+	// Clients speaking another protocol couldn't read the match's messages
+	if !supportedProtocol(metadata) {
+		return gameState, false, "protocol_unsupported"
+	}
+
+	// Dungeon instances only admit their party while running
+	if gameState.dungeon != nil {
+		if reason := gameState.dungeon.CanJoin(presence.GetUserId()); reason != "" {
+			return gameState, false, reason
+		}
+	}
+	// Custom worlds admit the players their visibility allows
+	if gameState.customWorld != nil {
+		if reason := gameState.customWorld.CanJoin(ctx, nk, presence.GetUserId()); reason != "" {
+			return gameState, false, reason
+		}
+	}
+
+	// Open world shards take players up to their capacity, every match up to the settings' cap
+	if gameState.shard.Full(gameState) || gameState.maxPlayersReached() {
+		return gameState, false, "world_full"
+	}
 	return gameState, true, ""
 }
 
@@ -257,23 +1152,81 @@ func (m *GameMatch) MatchLeave(ctx context.Context, logger runtime.Logger, db *s
 	}
 
 	for _, presence := range presences {
-		// Save player data before they leave
+		// Save player data before they leave (not in dungeons or custom worlds: the open world
+		// position is kept; nor for players travelling to another map, whose position is set where
+		// they arrive)
+		departed := gameState.waypoints.UnloadPlayer(presence.GetUserId())
 		if playerObj := gameState.inputProcessor.FindPlayerObject(gameState, presence.GetUserId()); playerObj != nil {
-			if err := gameState.databaseManager.SavePlayerData(ctx, presence, playerObj.Position, playerObj.Velocity); err != nil {
+			if gameState.instanced() || departed {
+				// Players go back to where they left the open world
+			} else if err := gameState.databaseManager.SavePlayerData(ctx, presence, playerObj.Position, playerObj.Velocity, gameState.currentMapName, gameState.regionName(playerObj.Position)); err != nil {
 				logger.Error("Failed to save player data for %s: %v", presence.GetUsername(), err)
 			} else {
 				logger.Info("Saved player data for %s at position (%f, %f)", presence.GetUsername(), playerObj.Position.X, playerObj.Position.Y)
 			}
+			if err := gameState.SavePlayerEffects(ctx, presence.GetUserId()); err != nil {
+				logger.Error("Failed to save effects for %s: %v", presence.GetUsername(), err)
+			}
+			if err := gameState.survival.SavePlayer(ctx, gameState, presence.GetUserId()); err != nil {
+				logger.Error("Failed to save survival meters for %s: %v", presence.GetUsername(), err)
+			}
 		}
 
-		delete(gameState.presences, presence.GetUserId())
+		gameState.removePresence(presence.GetUserId())
 		logger.Info("Player left open world: %s", presence.GetUsername())
+		gameState.replay.RecordPresence(gameState, presence, false)
+
+		// Leave the mount and any carried object where the player was
+		gameState.Dismount(presence.GetUserId(), dispatcher, logger)
+		gameState.Release(presence.GetUserId(), true, dispatcher, logger)
 
 		// Remove player object when they leave
 		gameState.inputProcessor.RemovePlayerObject(gameState, presence.GetUserId())
+
+		// Persist and release interaction cooldowns/flags
+		gameState.interactionTracker.UnloadPlayer(ctx, presence.GetUserId())
+
+		// Drop world variable subscriptions
+		gameState.worldVars.Unwatch(presence.GetUserId(), nil)
+
+		// Inventory changes are written through, so only the cached copy needs releasing
+		gameState.inventoryManager.UnloadPlayer(presence.GetUserId())
+
+		// Release the guild cache and show the player as offline to their guild
+		guildID := gameState.guilds.GuildOf(presence.GetUserId())
+		gameState.guilds.UnloadPlayer(presence.GetUserId())
+		gameState.guilds.SyncGuild(gameState, guildID, dispatcher)
+
+		// Leave the party; the next member leads if the player led it
+		gameState.parties.RemovePlayer(gameState, presence.GetUserId(), dispatcher)
+
+		// NPCs fighting the player lose them
+		gameState.npcManager.ForgetPlayer(presence.GetUserId())
+
+		// Take the player's pet out of the world; it stays active for their next visit
+		gameState.pets.UnloadPlayer(gameState, presence.GetUserId())
+
+		// Quest progress is written through, so only the cached log needs releasing. Escorts
+		// don't wait for the player: their quests fail when the player returns.
+		gameState.quests.UnloadPlayer(gameState, presence.GetUserId())
+		gameState.reputation.UnloadPlayer(presence.GetUserId())
+
+		// Save discoveries made since the last periodic save
+		gameState.exploration.UnloadPlayer(ctx, presence.GetUserId())
+		gameState.cheats.UnloadPlayer(ctx, presence.GetUserId())
+		gameState.clock.UnloadPlayer(presence.GetUserId())
+		gameState.corrections.Leave(presence.GetUserId())
+		gameState.audioCues.Leave(presence.GetUserId())
+		gameState.minimap.Leave(presence.GetUserId())
+		gameState.traps.Leave(presence.GetUserId())
+		gameState.updates.Forget(presence.GetUserId())
+		gameState.ForgetColliderChanges(presence.GetUserId())
+		gameState.interactGuard.ForgetPlayer(presence.GetUserId())
 	}
 
-	// Open world continues running regardless of player count
+	// Publish the new occupancy; the primary shard keeps running regardless of player count
+	gameState.shard.UpdateLabel(gameState, dispatcher)
+	gameState.customWorld.UpdateLabel(gameState, dispatcher)
 	return gameState
 }
 
@@ -285,11 +1238,28 @@ func (m *GameMatch) MatchTerminate(ctx context.Context, logger runtime.Logger, d
 		return nil
 	}
 
+	// Loot rolls still open end now, so their stacks aren't lost with the match
+	gameState.parties.ResolveRolls(ctx, gameState, dispatcher)
+
 	if err := gameState.databaseManager.PeriodicSave(ctx, gameState); err != nil {
 		logger.Error("Failed to perform final save during termination: %v", err)
 	} else {
 		logger.Info("Final world state and player data saved successfully during termination")
 	}
+	gameState.databaseManager.WaitWorldSaves()
+	gameState.load.WaitLog()
+
+	// Keep the last seconds of the replay and the last rolls' audit
+	gameState.replay.Flush(ctx, gameState)
+	gameState.random.Flush(ctx)
+
+	// Start a replacement with the shard number and send the players to it (match_handoff.go)
+	gameState.HandOff(ctx, logger, nk, dispatcher, graceSeconds)
+
+	// Custom worlds end with the match
+	if gameState.customWorld != nil {
+		gameState.customWorld.Unlist(ctx, gameState)
+	}
 
 	logger.Info("Open world match terminating - all data saved")
 
@@ -306,10 +1276,133 @@ func (m *GameMatch) MatchSignal(ctx context.Context, logger runtime.Logger, db *
 
 	logger.Info("Open world match signal received: %s", data)
 
-	// Handle map change signals
-	var signal map[string]interface{}
-	_ = json.Unmarshal([]byte(data), &signal)
-	// No signals supported yet.
+	var signal MatchSignalRequest
+	if err := json.Unmarshal([]byte(data), &signal); err != nil {
+		logger.Warn("Ignoring malformed match signal: %v", err)
+		return gameState, ""
+	}
+
+	switch signal.Type {
+	case SignalScriptStats:
+		var opts struct {
+			Reset bool `json:"reset"`
+		}
+		if len(signal.Payload) > 0 {
+			_ = json.Unmarshal(signal.Payload, &opts)
+		}
+		report, err := json.Marshal(gameState.scriptEngine.StatsReport())
+		if err != nil {
+			logger.Error("Failed to marshal script stats: %v", err)
+			return gameState, ""
+		}
+		if opts.Reset {
+			gameState.scriptEngine.ResetStats()
+		}
+		return gameState, string(report)
+	case SignalReloadScripts:
+		if err := gameState.scriptEngine.LoadManifest(ctx, gameState.databaseManager, gameState.currentMapName); err != nil {
+			logger.Error("Failed to reload script manifest: %v", err)
+			return gameState, `{"reloaded":false}`
+		}
+		return gameState, `{"reloaded":true}`
+	case SignalBots:
+		var opts struct {
+			Count *int `json:"count"`
+		}
+		if len(signal.Payload) > 0 {
+			_ = json.Unmarshal(signal.Payload, &opts)
+		}
+		if opts.Count != nil {
+			gameState.bots.SetCount(gameState, *opts.Count, dispatcher, logger)
+		}
+		report, err := json.Marshal(BotSignalReport{Bots: gameState.bots.Count(), Report: gameState.bots.Report()})
+		if err != nil {
+			logger.Error("Failed to marshal bot report: %v", err)
+			return gameState, ""
+		}
+		return gameState, string(report)
+	case SignalAnnounce:
+		announcement := &Announcement{}
+		if err := json.Unmarshal(signal.Payload, announcement); err != nil || announcement.ID == "" {
+			logger.Warn("Ignoring malformed announcement: %v", err)
+			return gameState, `{"scheduled":false}`
+		}
+		gameState.announcements.Schedule(announcement)
+		return gameState, `{"scheduled":true}`
+	case SignalWorldSettings:
+		settings, err := gameState.databaseManager.LoadWorldSettings(ctx)
+		if err != nil {
+			return gameState, `{"applied":false}`
+		}
+		gameState.ApplyWorldSettings(settings, logger)
+		gameState.shard.UpdateLabel(gameState, dispatcher)
+		gameState.customWorld.UpdateLabel(gameState, dispatcher)
+		return gameState, `{"applied":true}`
+	case SignalGameConfig:
+		if !gameState.reloadGameConfig(ctx, logger) {
+			return gameState, `{"applied":false}`
+		}
+		return gameState, `{"applied":true}`
+	case SignalTune:
+		req := &TuningRequest{}
+		if len(signal.Payload) > 0 {
+			if err := json.Unmarshal(signal.Payload, req); err != nil {
+				return gameState, gameState.tuneResponse(false)
+			}
+		}
+		return gameState, gameState.tuneResponse(gameState.Tune(req, logger))
+	case SignalLoad:
+		report, err := json.Marshal(gameState.load.LoadReport())
+		if err != nil {
+			return gameState, ""
+		}
+		return gameState, string(report)
+	case SignalStaticGeometry:
+		world := gameState.World()
+		if world == nil {
+			return gameState, ""
+		}
+		report, err := json.Marshal(StaticGeometryReport{Map: gameState.currentMapName, Tick: world.Tick, Colliders: world.Static()})
+		if err != nil {
+			logger.Error("Failed to marshal static geometry: %v", err)
+			return gameState, ""
+		}
+		return gameState, string(report)
+	case SignalLiveOps:
+		if err := gameState.liveOps.Refresh(ctx, gameState, dispatcher); err != nil {
+			return gameState, `{"applied":false}`
+		}
+		return gameState, `{"applied":true}`
+	case SignalAuctionClaims:
+		var claims struct {
+			PlayerIDs []string `json:"playerIds"`
+		}
+		if err := json.Unmarshal(signal.Payload, &claims); err != nil {
+			return gameState, `{"delivered":0}`
+		}
+		delivered := 0
+		for _, playerID := range claims.PlayerIDs {
+			if _, online := gameState.presences[playerID]; online {
+				gameState.auctions.Deliver(ctx, gameState, playerID, dispatcher)
+				delivered++
+			}
+		}
+		return gameState, fmt.Sprintf(`{"delivered":%d}`, delivered)
+	case SignalWorldReset:
+		reset := &WorldReset{}
+		if err := json.Unmarshal(signal.Payload, reset); err != nil {
+			logger.Warn("Ignoring malformed world reset: %v", err)
+			return gameState, `{"reset":false}`
+		}
+		gameState.ResetWorld(ctx, reset, dispatcher, logger)
+		return gameState, `{"reset":true}`
+	case SignalReplayFlush:
+		gameState.replay.Flush(ctx, gameState)
+		return gameState, fmt.Sprintf(`{"recording":%t}`, gameState.replay.Enabled())
+	default:
+		logger.Warn("Unsupported match signal type: %s", signal.Type)
+	}
+
 	return gameState, ""
 }
 
@@ -322,11 +1415,35 @@ func (m *GameMatch) MatchLoop(ctx context.Context, logger runtime.Logger, db *sq
 
 	gameState.currentTick = tick
 
-	// Process incoming messages (player inputs)
+	// Report the tick's duration and traffic to Nakama's metrics (metrics.go)
+	defer gameState.metrics.RecordTick(gameState, time.Now())
+	dispatcher = gameState.metrics.Dispatcher(gameState, dispatcher)
+	gameState.metrics.RecordMessages(messages)
+
+	// Shed load while ticks keep running over budget (load_shedding.go)
+	defer gameState.load.RecordTick(gameState, time.Now())
+
+	// While load test bots run, measure the tick and what it sends
+	defer gameState.bots.RecordTick(gameState, time.Now())
+	dispatcher = gameState.bots.Dispatcher(gameState, dispatcher)
+
+	// Let go of the objects whose interaction lock or script claims ran out
+	gameState.interactGuard.Update(gameState)
+
+	// Process incoming messages (player inputs). Each processed input yields an ACK that is
+	// queued and sent after the physics step so it carries the most up-to-date position.
+	pendingAcks := make([]*InputACK, 0, len(messages))
 	for _, message := range messages {
+		// Clock sync messages aren't inputs: they get no ACK and aren't recorded
+		if message.GetOpCode() == OpCodeClock {
+			gameState.clock.HandleMessage(gameState, message.GetUserId(), message.GetData(), dispatcher)
+			continue
+		}
+
 		var input PlayerInput
-		if err := json.Unmarshal(message.GetData(), &input); err != nil {
+		if err := DecodeMessage(message.GetOpCode(), message.GetData(), &input); err != nil {
 			logger.Error("Failed to unmarshal player input: %v", err)
+			gameState.replay.RecordInput(gameState, message.GetUserId(), message.GetData(), nil)
 			continue
 		}
 
@@ -335,94 +1452,302 @@ func (m *GameMatch) MatchLoop(ctx context.Context, logger runtime.Logger, db *sq
 			input.PlayerID = message.GetUserId()
 		}
 
+		// Players may only send input for themselves
+		if input.PlayerID != message.GetUserId() {
+			ack := &InputACK{
+				PlayerID:      message.GetUserId(),
+				Action:        input.Action,
+				InputSequence: input.InputSequence,
+				Timestamp:     tick,
+			}
+			ack.Reject(RejectInvalidPlayer)
+			gameState.cheats.ReportACK(gameState, ack)
+			pendingAcks = append(pendingAcks, ack)
+			gameState.replay.RecordInput(gameState, message.GetUserId(), message.GetData(), ack)
+			continue
+		}
+
 		// logger.Debug("Received input from %s (OpCode: %d): Action: %s, Seq: %d, VelX: %f, VelY: %f",
 		// 	input.PlayerID, message.GetOpCode(), input.Action, input.InputSequence, input.VelocityX, input.VelocityY)
 
 		// Process the input (e.g., update velocity)
-		gameState.inputProcessor.ProcessPlayerInput(gameState, &input, dispatcher, logger)
-
-		// After processing input, especially movement, prepare an ACK
-		// The actual position update will happen in the physics step.
-		// We will send the ACK *after* the physics step for the most up-to-date position.
-		// For now, let's just log that we'd prepare an ACK.
-		// The ACK needs to be associated with this specific input and player.
+		ack := gameState.inputProcessor.ProcessPlayerInput(ctx, gameState, &input, dispatcher, logger)
+		if ack != nil {
+			pendingAcks = append(pendingAcks, ack)
+			gameState.cheats.ReportACK(gameState, ack)
+		}
+		gameState.corrections.NoteInput(input.PlayerID, input.InputSequence)
+		gameState.replay.RecordInput(gameState, message.GetUserId(), message.GetData(), ack)
 	}
 
+	// Bots send their inputs after the players'
+	pendingAcks = append(pendingAcks, gameState.bots.Inputs(ctx, gameState, dispatcher, logger)...)
+
+	// Drain/regenerate stamina and enforce sprint limits before bodies move
+	gameState.UpdatePlayerStates(ctx, dispatcher, logger)
+
+	// Advance the time of day and the weather, then deliver the events published since the last tick
+	gameState.worldClock.Update(gameState, dispatcher, logger)
+	gameState.weather.Update(gameState, dispatcher, logger)
+	gameState.eventBus.Dispatch(ctx, gameState, dispatcher)
+
+	// Ping players to measure their round trip times
+	gameState.clock.Update(gameState, dispatcher)
+
+	// Apply the player texts the moderation service judged since the last tick
+	gameState.moderation.Update()
+
+	// Show scheduled server announcements
+	gameState.announcements.Update(gameState, dispatcher)
+
+	// Start and end live-ops events as their date ranges pass
+	gameState.liveOps.Update(gameState, dispatcher)
+
+	// Start scheduled world events and end the ones that are over
+	gameState.worldEvents.Update(ctx, gameState, dispatcher)
+
+	// Start, advance and reset wave encounters
+	gameState.encounters.Update(ctx, gameState, dispatcher)
+
+	// Respawn, think and steer NPCs so physics moves them with everything else
+	gameState.npcManager.Update(ctx, gameState, dispatcher)
+
+	// Send defeated pets back to their owners' pet lists
+	gameState.pets.Update(ctx, gameState, dispatcher)
+
+	// Tell players which nearby NPCs have quests for them
+	gameState.quests.Update(ctx, gameState, dispatcher)
+
+	// Serve the path requests queued by NPCs within this tick's search budget
+	gameState.pathfinder.Update(gameState)
+
 	// Update game world using physics engine
 	// fixedDeltaTime := 1.0 / 60.0 // Assuming 60 ticks per second // This is handled by the physics engine internally
+	gameState.corrections.BeforePhysics(gameState)
 	gameState.physicsEngine.UpdatePhysics(gameState, logger) // Corrected method name and parameters
+	gameState.corrections.AfterPhysics(gameState)
 
-	// After physics update, send ACKs for processed inputs and broadcast world state
-	// This needs to be more robust to link specific inputs to their resulting state.
-	// For simplicity in this step, we iterate presences and if their input was processed this tick, send ACK.
-	// A better way would be to queue ACKs when inputs are processed.
+	// Refuse climbs onto higher ground and hurt players who dropped down a cliff
+	gameState.UpdateElevation(dispatcher, logger)
 
-	for _, message := range messages { // Iterate again to send ACKs based on inputs processed in *this* tick
-		var input PlayerInput
-		if err := json.Unmarshal(message.GetData(), &input); err != nil {
-			// Already logged, skip
+	// Attached colliders, lights and bodies follow their parents' new positions
+	gameState.attachments.Update(gameState, dispatcher, logger)
+
+	// Carried objects follow their carriers' new positions
+	gameState.UpdateHeldObjects(dispatcher, logger)
+
+	// Give players whose cutscene ran out their camera and input back
+	gameState.UpdateCutscenes(dispatcher, logger)
+
+	// Fly projectiles and resolve their hits against the bodies' new positions
+	gameState.projectiles.Update(ctx, gameState, dispatcher)
+
+	// Remember where everything ended up, for lag-compensated hits
+	gameState.positionHistory.Record(gameState)
+
+	// Sprinting players make noise NPCs and players can hear
+	gameState.UpdateFootsteps(dispatcher, logger)
+
+	// Copy where the bodies ended up; the ACKs, the broadcast and persistence read the copy
+	world := gameState.TakeWorldSnapshot()
+
+	// After physics update, send the queued ACKs with the authoritative position
+	for _, ack := range pendingAcks {
+		// Rejections are sent even without a player object so the client can roll back
+		if position, ok := world.Players[ack.PlayerID]; ok {
+			ack.X = position.X
+			ack.Y = position.Y
+			stamina := gameState.GetPlayerState(ack.PlayerID).Stamina
+			ack.Stamina = &stamina
+
+			// Tell the mover it was pushed back so prediction stops sliding into the wall
+			if playerObject := gameState.PlayerBody(ack.PlayerID); playerObject != nil && ack.Approved && (ack.Action == "move" || ack.Action == "dash") {
+				if normal, blocked := gameState.physicsEngine.Contact(playerObject); blocked && !ack.Blocked {
+					ack.Blocked = true
+					contact := ToPosition(normal)
+					ack.ContactNormal = &contact
+				}
+			}
+		}
+
+		ackData, err := gameState.encoder.Message("input_ack", ack)
+		if err != nil {
+			logger.Error("Failed to marshal InputACK: %v", err)
 			continue
 		}
-		if input.PlayerID == "" {
-			input.PlayerID = message.GetUserId()
+
+		// Send the ACK to the specific player who sent the input
+		if presence, ok := gameState.presences[ack.PlayerID]; ok {
+			dispatcher.BroadcastMessage(OpCodeInputACK, ackData, []runtime.Presence{presence}, nil, true)
+			// logger.Debug("Sent ACK for seq %d to player %s, Pos: (%.2f, %.2f)", ack.InputSequence, ack.PlayerID, ack.X, ack.Y)
 		}
+	}
 
-		playerObject := gameState.inputProcessor.FindPlayerObject(gameState, input.PlayerID)
-		if playerObject != nil {
-			ack := InputACK{
-				PlayerID:      input.PlayerID,
-				Action:        input.Action,
-				InputSequence: input.InputSequence,
-				Approved:      true, // Assuming input is always approved for now
-				Timestamp:     tick, // Or a more precise server timestamp
-				X:             playerObject.Position.X,
-				Y:             playerObject.Position.Y,
-			}
-			ackMessage := GameMessage{
-				Type: "input_ack",
-				Data: ack,
-			}
-			ackData, err := json.Marshal(ackMessage)
-			if err != nil {
-				logger.Error("Failed to marshal InputACK: %v", err)
-				continue
-			}
+	// Tell players the server moved them, after the ACKs so the snap wins over reconciliation
+	gameState.corrections.Flush(gameState, dispatcher)
 
-			// Send the ACK to the specific player who sent the input
-			if presence, ok := gameState.presences[input.PlayerID]; ok {
-				dispatcher.BroadcastMessage(OpCodeInputACK, ackData, []runtime.Presence{presence}, nil, true)
-				// logger.Debug("Sent ACK for seq %d to player %s, Pos: (%.2f, %.2f)", input.InputSequence, input.PlayerID, ack.X, ack.Y)
-			}
+	// Push world variable changes made by scripts this tick to watching clients
+	gameState.worldVars.FlushChanges(gameState, dispatcher, logger)
+
+	// Despawn dropped items whose timer ran out
+	gameState.worldItems.Update(gameState, dispatcher)
+
+	// Bring back depleted resource nodes
+	gameState.resourceNodes.Update(gameState, dispatcher)
+
+	// Load the world chunks players came near: their resource timers and buildings
+	gameState.chunks.Update(ctx, gameState, dispatcher)
+
+	// Advance control point captures from the players standing in them and pay their owners
+	gameState.controlPoints.Update(ctx, gameState, dispatcher)
+
+	// Close auto-closing doors whose time is up
+	gameState.doors.Update(gameState, dispatcher)
+
+	// Close opened containers and refill looted ones whose time is up
+	gameState.containers.Update(gameState, dispatcher)
+
+	// Press and release pressure plates under the bodies' new positions
+	gameState.mechanisms.Update(gameState, dispatcher)
+
+	// Hurt the players and NPCs standing in hazards
+	gameState.hazards.Update(gameState, dispatcher, logger)
+
+	// Set off the traps someone stepped into and roll to spot hidden ones
+	gameState.traps.Update(gameState, dispatcher, logger)
+
+	// Drain hunger and thirst on survival maps
+	gameState.survival.Update(gameState, dispatcher, logger)
+
+	// End expired auctions
+	gameState.auctions.Update(ctx, gameState, dispatcher)
+
+	// Advance the growth stages of planted crops
+	gameState.farms.Update(gameState, dispatcher)
+
+	// Announce fish bites and let fish escape whose bite window passed
+	gameState.fishing.Update(ctx, gameState, dispatcher)
+
+	// Reveal the map chunks players walked into
+	gameState.exploration.Update(gameState, dispatcher)
+
+	// Shadow-flag and kick players whose anti-cheat score crossed a threshold
+	gameState.cheats.Update(ctx, gameState, dispatcher)
+
+	// Start and stop the music and ambience of the audio cues players walked into or out of
+	gameState.audioCues.Update(gameState, dispatcher)
+
+	// Refresh the points of interest on the players' minimaps
+	gameState.minimap.Update(ctx, gameState, dispatcher)
+
+	// Activate the waypoints players reached and hand travellers over to other maps
+	gameState.waypoints.Update(ctx, gameState, nk, dispatcher)
+
+	// Hide stealthed players and detect them
+	gameState.stealth.Update(gameState)
+
+	// Drop target locks that are no longer valid
+	gameState.ValidateTargets()
+
+	// Decide duels whose duelists fled, left or ran out of time, and announce the results
+	gameState.duels.Update(ctx, gameState, dispatcher)
+
+	// Expire party invites and end need/greed rolls whose time is up
+	gameState.parties.Update(gameState, dispatcher)
+
+	// Tell players about health/stamina changes
+	gameState.SyncPlayerStatus(dispatcher, logger)
+
+	// Send the objects changed this tick as one batch of deltas
+	gameState.objectUpdates.Flush(gameState, dispatcher)
+
+	// Broadcast world state; each player gets it at the update rate of their region (broadcast_rates.go)
+	m.broadcastWorldState(gameState, dispatcher, logger)
+
+	// Write finished replay segments and start the next one with a snapshot
+	gameState.replay.Update(ctx, gameState)
+
+	// Write the audit records of this second's rolls
+	gameState.random.Update(ctx, gameState)
+
+	// Persist world state periodically; an overloaded match puts it off for a while
+	if !gameState.headless && gameState.load.SaveDue(tick, gameState.config.SaveIntervalTicks()) {
+		if err := gameState.databaseManager.PeriodicSave(ctx, gameState); err != nil {
+			logger.Error("Failed to persist world state: %v", err)
 		}
 	}
 
-	// Broadcast world state periodically (e.g., every few ticks or if changed significantly)
-	// For now, let's broadcast every tick for testing
-	if tick%2 == 0 { // Broadcast every other tick
-		m.broadcastWorldState(gameState, dispatcher, logger)
+	// Tell admins when the match started or stopped shedding load
+	gameState.load.Report(ctx, gameState)
+
+	// End shards whose map a world reset restarted; their players were sent to the new shard
+	if gameState.shard.Ended() {
+		logger.Info("Shard of %s closed for a world reset", gameState.currentMapName)
+		return nil
+	}
+
+	// End shards handed over to a replacement once their players moved; leaving saved them
+	if gameState.shard.HandedOff() && len(gameState.presences) == 0 {
+		logger.Info("Shard of %s closed after its players moved to the replacement", gameState.currentMapName)
+		return nil
+	}
+
+	// Close extra shards that stayed empty; their players' progress is already saved
+	if gameState.shard.Idle(gameState) {
+		logger.Info("Shard of %s closed after being empty for %d seconds", gameState.currentMapName, shardIdleTicks/TickRate)
+		return nil
+	}
+
+	// Close custom worlds that stayed empty and take them out of the world directory
+	if gameState.customWorld != nil && gameState.customWorld.Idle(gameState) {
+		gameState.customWorld.Unlist(ctx, gameState)
+		logger.Info("Custom world %q closed after being empty for %d seconds", gameState.customWorld.Entry.Name, customWorldIdleTicks/TickRate)
+		return nil
 	}
 
-	// Persist world state periodically
-	if tick%300 == 0 { // Every 5 seconds (300 ticks / 60hz)
+	// End dungeon instances whose result was shown, or whose party never came back
+	if gameState.dungeon != nil && gameState.dungeon.Update(ctx, gameState, nk, dispatcher) {
 		if err := gameState.databaseManager.PeriodicSave(ctx, gameState); err != nil {
-			logger.Error("Failed to persist world state: %v", err)
+			logger.Error("Failed to save before closing dungeon: %v", err)
 		}
+		logger.Info("Dungeon %s instance closed", gameState.dungeon.Def.ID)
+		return nil
 	}
 
 	return gameState
 }
 
 func (m *GameMatch) broadcastWorldState(gameState *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	recipients, all := gameState.worldUpdateRecipients(gameState.currentTick)
+	world := gameState.World()
+	if len(recipients) == 0 || world == nil {
+		return
+	}
+
 	// Construct player data for all current presences
-	playersData := make(map[string]PlayerData)
-	for userID, presence := range gameState.presences {
-		playerObj := gameState.inputProcessor.FindPlayerObject(gameState, userID)
-		if playerObj != nil {
+	playersData := gameState.snapshots.Players()
+	for userID, presence := range gameState.Presences() {
+		if position, ok := world.Players[userID]; ok {
 			playersData[userID] = PlayerData{
 				SessionID: presence.GetSessionId(),
 				UserID:    userID,
 				Username:  presence.GetUsername(),
-				Position:  ToPosition(playerObj.Position),
+				Position:  ToPosition(position),
+				Facing:    gameState.GetPlayerState(userID).Facing,
+				MountID:   gameState.GetPlayerState(userID).MountID,
+				HeldID:    gameState.GetPlayerState(userID).HeldObjectID,
+				MoveMode:  gameState.GetPlayerState(userID).MoveMode,
+				Health:    gameState.GetPlayerState(userID).Health,
+				MaxHealth: gameState.GetPlayerState(userID).MaxHealth,
+				Effects:   gameState.GetPlayerState(userID).EffectList(gameState.currentTick),
+				PvP:       gameState.GetPlayerState(userID).Attackable(),
+				Outlaw:    gameState.GetPlayerState(userID).Outlaw(),
+				DuelWith:  gameState.duelOpponent(userID),
+				GuildTag:  gameState.guilds.TagOf(userID),
+				Stealthed: gameState.stealth.IsHidden(userID),
+				Light:     gameState.GetPlayerState(userID).Light,
+				Elevation: gameState.GetPlayerState(userID).Elevation,
+				Protected: gameState.SpawnProtected(userID),
 			}
 		} else {
 			// Player might have just joined and object not fully synced, or an error occurred
@@ -432,24 +1757,79 @@ func (m *GameMatch) broadcastWorldState(gameState *GameMatchState, dispatcher ru
 	}
 
 	// Prepare game state for broadcasting
+	lights := gameState.LightSources()
 	worldState := GameState{
 		Tick:        gameState.currentTick,
-		GameObjects: gameState.gameObjects, // Consider if all game objects need to be sent every time
+		GameObjects: world.Dynamic, // static colliders come from the map (admin_static_geometry)
 		Players:     playersData,
+		NPCs:        gameState.snapshots.NPCs(gameState.npcManager),
+		Pets:        gameState.snapshots.Pets(gameState.npcManager),
+		Lights:      lightData(lights, nil),
 	}
 
-	message := GameMessage{
-		Type: "world_update",
-		Data: worldState,
+	// Every entity is encoded once; each view below is spliced from those fragments
+	if err := gameState.encoder.Begin(worldState); err != nil {
+		logger.Error("Failed to marshal world state: %v", err)
+		return
 	}
 
-	data, err := json.Marshal(message)
-	if err != nil {
-		logger.Error("Failed to marshal world state: %v", err)
+	// Static colliders changed since a player's last update go to them once; while anyone has
+	// some, updates are assembled per player
+	colliders := gameState.TakeColliderChanges(recipients)
+
+	hiding := gameState.stealth.AnyHidden()
+	dark := gameState.VisionLimited()
+	budget := gameState.updateBudget()
+	if !hiding && !dark && budget == 0 && len(colliders) == 0 {
+		data, err := gameState.encoder.View(worldState)
+		if err != nil {
+			logger.Error("Failed to marshal world state: %v", err)
+			return
+		}
+		if all {
+			dispatcher.BroadcastMessage(OpCodeWorldUpdate, data, nil, nil, true) // Broadcast to all
+		} else {
+			dispatcher.BroadcastMessage(OpCodeWorldUpdate, data, recipients, nil, true)
+		}
 		return
 	}
 
-	dispatcher.BroadcastMessage(OpCodeWorldUpdate, data, nil, nil, true) // Broadcast to all
+	// Hidden players are only sent to themselves and the players who detected them, and what
+	// stands in the dark only to those who can see it. With an update budget, each player gets the
+	// part of their view its priority selects (update_priority.go).
+	if budget > 0 {
+		gameState.updates.Begin(gameState)
+	}
+	for _, presence := range recipients {
+		viewerID := presence.GetUserId()
+		view := worldState
+		view.Colliders = colliders[viewerID]
+		if hiding {
+			view.Players = gameState.stealth.visiblePlayers(viewerID, playersData, gameState.currentTick)
+			view.Lights = lightData(lights, view.Players)
+		}
+		if dark {
+			view = gameState.litWorld(viewerID, view, lights)
+		}
+		// The bodies of the players left out go with them
+		view.GameObjects = SeenBodies(world.Dynamic, world.Owners, func(playerID string) bool {
+			_, listed := worldState.Players[playerID]
+			_, seen := view.Players[playerID]
+			return seen || !listed
+		})
+		var data []byte
+		var err error
+		if budget > 0 {
+			data, err = gameState.encoder.PartialView(view, gameState.updates.Select(gameState, viewerID, view, gameState.encoder, budget))
+		} else {
+			data, err = gameState.encoder.View(view)
+		}
+		if err != nil {
+			logger.Error("Failed to marshal world state for %s: %v", viewerID, err)
+			continue
+		}
+		dispatcher.BroadcastMessage(OpCodeWorldUpdate, data, []runtime.Presence{presence}, nil, true)
+	}
 	// logger.Debug("Broadcasted world update at tick %d. Player count: %d", gameState.currentTick, len(playersData))
 }
 
@@ -457,57 +1837,60 @@ func initializeGameObjects() []*rigidbody.RigidBody {
 	return []*rigidbody.RigidBody{}
 }
 
-// CreateDefaultMatch creates a default open world match that's always available
-func CreateDefaultMatch(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger) (string, error) {
-	logger.Info("Creating default open world match")
-
-	// Create match parameters
-	params := map[string]interface{}{
-		"map": "elderford/world.json", // Default map
-	}
-
-	// Create the match using the "game" module
-	matchId, err := nk.MatchCreate(ctx, "game", params)
-	if err != nil {
-		return "", fmt.Errorf("failed to create default match: %v", err)
-	}
-
-	logger.Info("Default open world match created: %s", matchId)
-	return matchId, nil
-}
-
-// EnsureDefaultMatch ensures there's always at least one open world match available
+// EnsureDefaultMatch ensures the primary shard of the default map is running; find_world starts
+// further shards as it fills up
 func EnsureDefaultMatch(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger) error {
-	// List existing matches
-	matches, err := nk.MatchList(ctx, 10, true, "open_world_game", nil, nil, "")
+	shards, err := ListShards(ctx, nk, defaultWorldMap)
 	if err != nil {
 		logger.Error("Failed to list matches: %v", err)
 		return err
 	}
-
-	// If no matches exist, create one
-	if len(matches) == 0 {
-		_, err := CreateDefaultMatch(ctx, nk, logger)
-		return err
+	for _, shard := range shards {
+		if shard.Label.Shard == 1 {
+			logger.Info("Found %d existing shards of %s", len(shards), defaultWorldMap)
+			return nil
+		}
 	}
 
-	logger.Info("Found %d existing open world matches", len(matches))
-	return nil
+	logger.Info("Creating default open world match")
+	_, err = StartShard(ctx, logger, nk, defaultWorldMap, shards)
+	if err == errShardClaimed {
+		logger.Info("Another node is starting the default open world match")
+		return nil
+	}
+	return err
 }
 
 // AddOwnerCollider adds a collider to the physics slice and records ownership.
 // If polygonPoints is non-nil and non-empty, the polygon will be registered with the physics engine.
+// The collider is in its object's collision group, and the bodies it appears on top of pass
+// through it until they step off instead of being pushed out.
 func (gs *GameMatchState) AddOwnerCollider(owner int, rb *rigidbody.RigidBody, polygonPoints []vector.Vector) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 
 	gs.gameObjects = append(gs.gameObjects, rb)
-	gs.gameObjectsByOwner[owner] = append(gs.gameObjectsByOwner[owner], rb)
-	gs.rbOwner[rb] = owner
+	gs.entities.AddCollider(ObjectRef(owner), rb)
+	gs.colliders.Mark(owner)
+	if !rb.IsMovable && gs.pathfinder != nil {
+		gs.pathfinder.Invalidate()
+	}
 
-	if gs.physicsEngine != nil && len(polygonPoints) > 0 {
+	if gs.physicsEngine == nil {
+		return
+	}
+	if len(polygonPoints) > 0 {
 		AddPolygonToPhysicsEngine(gs.physicsEngine, rb, polygonPoints)
 	}
+	gs.physicsEngine.SetCollisionFilter(rb, gs.objectColliderFilter(owner))
+	for _, body := range gs.gameObjects {
+		if body == rb || !body.IsMovable || !gs.physicsEngine.aabbOverlap(rb, body) {
+			continue
+		}
+		if gs.physicsEngine.detectCollision(rb, body).collided {
+			gs.physicsEngine.SeparateBodies(rb, body)
+		}
+	}
 }
 
 // RemoveOwnerColliders removes all colliders owned by the given object and cleans up physics registry.
@@ -516,12 +1899,12 @@ func (gs *GameMatchState) RemoveOwnerColliders(owner int) {
 	defer gs.mu.Unlock()
 
 	toRemove := make(map[*rigidbody.RigidBody]bool)
-	for _, rb := range gs.gameObjectsByOwner[owner] {
+	for _, rb := range gs.entities.RemoveColliders(ObjectRef(owner)) {
 		toRemove[rb] = true
 		if gs.physicsEngine != nil {
 			delete(gs.physicsEngine.polygonRegistry, rb)
+			gs.physicsEngine.forgetFilters(rb)
 		}
-		delete(gs.rbOwner, rb)
 	}
 
 	// filter gameObjects
@@ -532,7 +1915,146 @@ func (gs *GameMatchState) RemoveOwnerColliders(owner int) {
 		}
 	}
 	gs.gameObjects = newList
-	delete(gs.gameObjectsByOwner, owner)
+	if len(toRemove) > 0 {
+		gs.colliders.Mark(owner)
+	}
+	if len(toRemove) > 0 && gs.pathfinder != nil {
+		gs.pathfinder.Invalidate()
+	}
+}
+
+// RebuildObjectColliders replaces the colliders owned by a scripted object with those of its
+// tile's collision template. It returns false if the object has no template or no world position.
+func (gs *GameMatchState) RebuildObjectColliders(oid int, logger runtime.Logger) bool {
+	// Remove any existing colliders owned by this object
+	gs.RemoveOwnerColliders(oid)
+
+	if gs.currentMap == nil {
+		logger.Info("Current map is nil, cannot rebuild colliders for object %d", oid)
+		return false
+	}
+
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	var gid uint32
+	var center vector.Vector
+	var hasPosition bool
+	if ok {
+		gid = obj.GID
+		center, hasPosition = obj.Position()
+	}
+	gs.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	template, ok := gs.currentMap.TileCollisions[int(gid)]
+	if !ok {
+		// No tile collision template for this gid
+		logger.Info("No tile collision template for this gid %d", gid)
+		return false
+	}
+
+	if !hasPosition {
+		logger.Info("Object %d missing world position props x/y; skipping collider rebuild", oid)
+		return false
+	}
+
+	// Tile top-left (templates are stored relative to tile top-left)
+	tileW := float64(gs.currentMap.TileWidth)
+	tileH := float64(gs.currentMap.TileHeight)
+	tileX := center.X - tileW/2.0
+	tileY := center.Y - tileH/2.0
+
+	// Create colliders from template and register them as owned by this object
+	for _, ct := range template.Colliders {
+		rb, pts := MakeRigidBodyFromTileTemplate(tileX, tileY, ct)
+		if rb == nil {
+			continue
+		}
+		gs.AddOwnerCollider(oid, rb, pts)
+	}
+	return true
+}
+
+// SpawnObject registers a scripted object created at runtime (e.g. by an item), builds its
+// tile colliders and announces it to clients. obj.Props must contain the world center as x/y.
+// It returns the ID assigned to the object.
+func (gs *GameMatchState) SpawnObject(obj *ObjectData, dispatcher runtime.MatchDispatcher, logger runtime.Logger) int {
+	gs.mu.Lock()
+	if gs.nextObjectID == 0 {
+		// Start above the highest map object ID so runtime objects never collide with Tiled IDs
+		for _, id := range gs.entities.ObjectIDs() {
+			if id >= gs.nextObjectID {
+				gs.nextObjectID = id + 1
+			}
+		}
+		if gs.nextObjectID == 0 {
+			gs.nextObjectID = 1
+		}
+	}
+	obj.ID = gs.nextObjectID
+	gs.nextObjectID++
+	if obj.Props == nil {
+		obj.Props = make(map[string]interface{})
+	}
+	gs.entities.registerObject(obj)
+	gs.mu.Unlock()
+
+	gs.RebuildObjectColliders(obj.ID, logger)
+	gs.BroadcastObjectUpdate(obj.ID, dispatcher, logger)
+	return obj.ID
+}
+
+// objectRemoved is the payload broadcast when a scripted object leaves the world
+type objectRemoved struct {
+	ObjectID int `json:"objectId"`
+}
+
+// RemoveObject deletes a runtime object and its colliders and tells clients to remove it
+func (gs *GameMatchState) RemoveObject(oid int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gs.mu.Lock()
+	_, ok := gs.Object(oid)
+	gs.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	gs.objectUpdates.Forget(oid)
+	gs.interactGuard.ForgetObject(oid)
+	// The entity goes last: its colliders are found through it
+	gs.RemoveOwnerColliders(oid)
+	gs.mu.Lock()
+	gs.entities.Remove(ObjectRef(oid))
+	gs.mu.Unlock()
+	gs.chunks.RemoveBuilding(oid)
+	gs.lights.Detach(oid)
+
+	if dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeObjectUpdate, "object_removed", objectRemoved{ObjectID: oid})
+	if err != nil {
+		logger.Error("Failed to marshal object removal for %d: %v", oid, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeObjectUpdate, data, nil, nil, true)
+}
+
+// PresencesInRange returns the presences whose player object is within radius of center
+func (gs *GameMatchState) PresencesInRange(center vector.Vector, radius float64) []runtime.Presence {
+	result := make([]runtime.Presence, 0, len(gs.presences))
+	for playerID, presence := range gs.Presences() {
+		rb := gs.PlayerBody(playerID)
+		if rb == nil {
+			continue
+		}
+		if rb.Position.Sub(center).Magnitude() <= radius {
+			result = append(result, presence)
+		}
+	}
+	return result
 }
 
 // AddStaticCollider adds a collider to gameObjects without assigning an owner.
@@ -542,21 +2064,25 @@ func (gs *GameMatchState) AddStaticCollider(rb *rigidbody.RigidBody, polygonPoin
 	defer gs.mu.Unlock()
 
 	gs.gameObjects = append(gs.gameObjects, rb)
+	if !rb.IsMovable && gs.pathfinder != nil {
+		gs.pathfinder.Invalidate()
+	}
 	if gs.physicsEngine != nil && len(polygonPoints) > 0 {
 		AddPolygonToPhysicsEngine(gs.physicsEngine, rb, polygonPoints)
 	}
 }
 
-// AddPlayerObject registers a player-owned rigid body and keeps playerObjects mapping consistent.
+// AddPlayerObject registers a player's entity and body.
 func (gs *GameMatchState) AddPlayerObject(playerID string, rb *rigidbody.RigidBody) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 
 	gs.gameObjects = append(gs.gameObjects, rb)
-	if gs.playerObjects == nil {
-		gs.playerObjects = make(map[string]*rigidbody.RigidBody)
+	gs.playerOrder = withID(gs.playerOrder, playerID)
+	gs.entities.SetBody(PlayerRef(playerID), rb)
+	if gs.physicsEngine != nil {
+		gs.physicsEngine.SetCollisionFilter(rb, CollisionFilter{Group: playerCollisionGroup(playerID)})
 	}
-	gs.playerObjects[playerID] = rb
 }
 
 // RemovePlayerObject removes a player's rigidbody from gameObjects and cleans up any related registries.
@@ -564,8 +2090,8 @@ func (gs *GameMatchState) RemovePlayerObject(playerID string) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 
-	rb, ok := gs.playerObjects[playerID]
-	if !ok || rb == nil {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
 		return
 	}
 
@@ -577,71 +2103,61 @@ func (gs *GameMatchState) RemovePlayerObject(playerID string) {
 		}
 	}
 
-	// remove from player mapping
-	delete(gs.playerObjects, playerID)
+	// remove from the entity registry
+	gs.entities.Remove(PlayerRef(playerID))
+	gs.playerOrder = withoutID(gs.playerOrder, playerID)
+	delete(gs.playerStates, playerID)
 
-	// remove polygon registry entry if present
+	// remove polygon registry entry and drag override if present
 	if gs.physicsEngine != nil {
 		delete(gs.physicsEngine.polygonRegistry, rb)
-	}
-
-	// If this rigidbody was tracked in rbOwner, clean up owner indexes
-	if owner, found := gs.rbOwner[rb]; found {
-		// remove rb from owner's list
-		list := gs.gameObjectsByOwner[owner]
-		newList := make([]*rigidbody.RigidBody, 0, len(list))
-		for _, r := range list {
-			if r != rb {
-				newList = append(newList, r)
-			}
-		}
-		if len(newList) == 0 {
-			delete(gs.gameObjectsByOwner, owner)
-		} else {
-			gs.gameObjectsByOwner[owner] = newList
-		}
-		delete(gs.rbOwner, rb)
+		delete(gs.physicsEngine.bodyDrag, rb)
+		delete(gs.physicsEngine.noCollide, rb)
+		gs.physicsEngine.forgetFilters(rb)
+		gs.physicsEngine.forgetBodyPhysics(rb)
 	}
 }
 
-// BroadcastObjectUpdate builds a small object delta and broadcasts it to connected clients.
-// If dispatcher is nil the function returns after preparing the payload (no-op for broadcast).
-func (gs *GameMatchState) BroadcastObjectUpdate(oid int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
-	// Read object state under lock
+// AddNPCObject registers a spawned NPC's entity and adds its body to gameObjects
+func (gs *GameMatchState) AddNPCObject(npc *NPC) {
 	gs.mu.Lock()
-	obj, ok := gs.objects[oid]
-	gs.mu.Unlock()
-
-	logger.Info("BroadcastObjectUpdate: broadcasting update for object ID %d", oid)
+	defer gs.mu.Unlock()
 
-	if !ok || obj == nil {
-		logger.Warn("BroadcastObjectUpdate: object ID %d not found", oid)
-		return
+	gs.gameObjects = append(gs.gameObjects, npc.Body)
+	SetComponent(gs.entities.SetBody(NPCRef(npc.ID), npc.Body), npc)
+	if !npc.Body.IsMovable && gs.pathfinder != nil {
+		gs.pathfinder.Invalidate()
 	}
+}
 
-	// Build payload with minimal fields clients need to render
-	payload := map[string]any{
-		"objectId": obj.ID,
-		"gid":      obj.GID,
-		"props":    obj.Props,
-		"pos":      map[string]any{"x": obj.Props["x"].(float64) - HalfTile, "y": obj.Props["y"].(float64) + HalfTile},
-	}
+// RemoveNPCObject removes a despawned NPC's entity and body
+func (gs *GameMatchState) RemoveNPCObject(npc *NPC) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
 
-	msg := GameMessage{
-		Type: "object_update",
-		Data: payload,
+	for i, rb := range gs.gameObjects {
+		if rb == npc.Body {
+			gs.gameObjects = append(gs.gameObjects[:i], gs.gameObjects[i+1:]...)
+			break
+		}
 	}
-
-	data, err := json.Marshal(msg)
-	if err != nil {
-		logger.Error("BroadcastObjectUpdate: failed to marshal object update: %v", err)
-		return
+	gs.entities.Remove(NPCRef(npc.ID))
+	if gs.physicsEngine != nil {
+		gs.physicsEngine.forgetFilters(npc.Body)
+		gs.physicsEngine.forgetBodyPhysics(npc.Body)
 	}
+}
 
-	if dispatcher != nil {
-		logger.Info("BroadcastObjectUpdate: dispatching update for object ID %d", oid)
-		dispatcher.BroadcastMessage(OpCodeObjectUpdate, data, nil, nil, true)
-	} else {
-		// No dispatcher available; caller can choose to enqueue or log. For now we do nothing.
+// BroadcastObjectUpdate queues an object whose GID or props changed. The changes made during a
+// tick are sent together when it ends (ObjectUpdateBatcher), so the dispatcher isn't used here;
+// changes made without one are sent by the next tick as well.
+func (gs *GameMatchState) BroadcastObjectUpdate(oid int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gs.mu.Lock()
+	_, ok := gs.Object(oid)
+	gs.mu.Unlock()
+	if !ok {
+		logger.Warn("BroadcastObjectUpdate: object ID %d not found", oid)
+		return
 	}
+	gs.objectUpdates.Mark(oid)
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// gameConfigPath is the game configuration file shipped with the server data
+const gameConfigPath = "/nakama/data/game_config.json"
+
+var errInvalidGameConfig = runtime.NewError("invalid game config: only known keys, playerMaxSpeed, playerSize and playerMass positive, dashDistance, dashExitSpeed and dashCooldown not negative, drag in (0, 1], bounce in [0, 1] and saveInterval at least 1 second", rpcCodeInvalidArgument)
+
+// GameConfig holds the gameplay constants of the match. The defaults are overridden by
+// /nakama/data/game_config.json and then by the overrides stored with admin_game_config; both
+// may set any subset of the keys. Durations are in seconds.
+type GameConfig struct {
+	PlayerMaxSpeed float64 `json:"playerMaxSpeed"` // px/s without buffs, sprint or mounts
+	PlayerSize     float64 `json:"playerSize"`     // width and height of an unmounted player's collider
+	PlayerMass     float64 `json:"playerMass"`
+	DashDistance   float64 `json:"dashDistance"`  // px covered instantly by a dash
+	DashExitSpeed  float64 `json:"dashExitSpeed"` // px/s carried out of the dash so it doesn't stop dead
+	DashCooldown   float64 `json:"dashCooldown"`
+	Drag           float64 `json:"drag"`         // velocity factor applied to movable bodies every step
+	Bounce         float64 `json:"bounce"`       // share of velocity kept when bouncing off the world bounds
+	SaveInterval   float64 `json:"saveInterval"` // between periodic saves of the world state
+}
+
+// DefaultGameConfig returns the configuration used when neither the file nor storage set a key
+func DefaultGameConfig() *GameConfig {
+	return &GameConfig{
+		PlayerMaxSpeed: 300,
+		PlayerSize:     40,
+		PlayerMass:     10,
+		DashDistance:   96,
+		DashExitSpeed:  200,
+		DashCooldown:   1.5,
+		Drag:           0.95,
+		Bounce:         0.7,
+		SaveInterval:   5,
+	}
+}
+
+// Validate checks that the configuration is usable
+func (c *GameConfig) Validate() error {
+	finite := func(v float64) bool { return !math.IsNaN(v) && !math.IsInf(v, 0) }
+	switch {
+	case !finite(c.PlayerMaxSpeed) || c.PlayerMaxSpeed <= 0:
+		return errors.New("playerMaxSpeed must be positive")
+	case !finite(c.PlayerSize) || c.PlayerSize <= 0:
+		return errors.New("playerSize must be positive")
+	case !finite(c.PlayerMass) || c.PlayerMass <= 0:
+		return errors.New("playerMass must be positive")
+	case !finite(c.DashDistance) || c.DashDistance < 0:
+		return errors.New("dashDistance must not be negative")
+	case !finite(c.DashExitSpeed) || c.DashExitSpeed < 0:
+		return errors.New("dashExitSpeed must not be negative")
+	case !finite(c.DashCooldown) || c.DashCooldown < 0:
+		return errors.New("dashCooldown must not be negative")
+	case !(c.Drag > 0 && c.Drag <= 1):
+		return errors.New("drag must be in (0, 1]")
+	case !(c.Bounce >= 0 && c.Bounce <= 1):
+		return errors.New("bounce must be in [0, 1]")
+	case !finite(c.SaveInterval) || c.SaveInterval < 1:
+		return errors.New("saveInterval must be at least 1 second")
+	}
+	return nil
+}
+
+// DashCooldownTicks returns the dash cooldown in match ticks
+func (c *GameConfig) DashCooldownTicks() int64 {
+	return int64(math.Round(c.DashCooldown * TickRate))
+}
+
+// SaveIntervalTicks returns the match ticks between periodic saves
+func (c *GameConfig) SaveIntervalTicks() int64 {
+	return int64(math.Round(math.Max(1, c.SaveInterval) * TickRate))
+}
+
+// overlay applies a JSON object of overrides to the configuration. Unknown keys are errors so
+// a typo doesn't silently keep the default.
+func (c *GameConfig) overlay(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(c)
+}
+
+// BuildGameConfig layers the file and the stored overrides (either may be nil) over the
+// defaults and validates the result
+func BuildGameConfig(file, stored []byte) (*GameConfig, error) {
+	config := DefaultGameConfig()
+	if len(file) > 0 {
+		if err := config.overlay(file); err != nil {
+			return nil, fmt.Errorf("%s: %w", gameConfigPath, err)
+		}
+	}
+	if len(stored) > 0 {
+		if err := config.overlay(stored); err != nil {
+			return nil, fmt.Errorf("stored overrides: %w", err)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readGameConfigFile returns the contents of the game configuration file, or nil if there is none
+func readGameConfigFile() ([]byte, error) {
+	data, err := os.ReadFile(gameConfigPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// LoadGameConfig reads the file and the stored overrides and builds the configuration
+func LoadGameConfig(ctx context.Context, dm *DatabaseManager) (*GameConfig, error) {
+	file, err := readGameConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := dm.LoadGameConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return BuildGameConfig(file, stored)
+}
+
+// ApplyGameConfig puts a game configuration into effect: the player speed cap, body and dash
+// read it on use, and the physics engine takes its drag and bounce as the defaults the world
+// settings' physicsConfig may still override. Bodies already in the world keep their size and
+// mass until they respawn or dismount. Called on match start and when the configuration
+// changes (SignalGameConfig).
+func (gs *GameMatchState) ApplyGameConfig(config *GameConfig, logger runtime.Logger) {
+	if config == nil {
+		return
+	}
+	// The match's live tuning (admin_tune) stays in effect
+	gs.config = gs.tuning.Config(config)
+	gs.inputProcessor.Configure(config)
+	gs.physicsEngine.SetDefaults(config.Drag, config.Bounce)
+	gs.configurePhysics()
+	logger.Info("Game config applied: max speed %.0f, player size %.0f, drag %.2f, bounce %.2f, save every %.0fs",
+		config.PlayerMaxSpeed, config.PlayerSize, config.Drag, config.Bounce, config.SaveInterval)
+}
+
+// reloadGameConfig loads the configuration and applies it, keeping the current one when it is
+// invalid
+func (gs *GameMatchState) reloadGameConfig(ctx context.Context, logger runtime.Logger) bool {
+	config, err := LoadGameConfig(ctx, gs.databaseManager)
+	if err != nil {
+		logger.Error("Failed to load game config, keeping the current one: %v", err)
+		return false
+	}
+	gs.ApplyGameConfig(config, logger)
+	return true
+}
+
+// rpcGameConfig returns the effective game configuration and the stored overrides, or replaces
+// the overrides and has every open world shard reload the configuration.
+// Payload: {} to read, or {"overrides": {"playerMaxSpeed": 320, "drag": 0.9}} ({"overrides": {}} clears them)
+func rpcGameConfig(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		Overrides json.RawMessage `json:"overrides"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	file, err := readGameConfigFile()
+	if err != nil {
+		logger.Error("Failed to read %s: %v", gameConfigPath, err)
+		return "", errInternalFailure
+	}
+
+	if len(req.Overrides) == 0 || string(req.Overrides) == "null" {
+		stored, err := dm.LoadGameConfig(ctx)
+		if err != nil {
+			return "", errInternalFailure
+		}
+		config, err := BuildGameConfig(file, stored)
+		if err != nil {
+			logger.Warn("Game config is invalid: %v", err)
+			return "", errInvalidGameConfig
+		}
+		overrides := json.RawMessage("{}")
+		if len(stored) > 0 {
+			overrides = stored
+		}
+		out, err := json.Marshal(map[string]interface{}{"config": config, "overrides": overrides})
+		if err != nil {
+			return "", errInternalFailure
+		}
+		return string(out), nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(req.Overrides, &object); err != nil {
+		return "", errInvalidGameConfig
+	}
+	config, err := BuildGameConfig(file, req.Overrides)
+	if err != nil {
+		return "", errInvalidGameConfig
+	}
+	if err := dm.SaveGameConfig(ctx, req.Overrides); err != nil {
+		return "", errInternalFailure
+	}
+	responses, err := signalMatches(ctx, logger, nk, "", MatchSignalRequest{Type: SignalGameConfig})
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(map[string]interface{}{"config": config, "overrides": req.Overrides, "matches": len(responses)})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
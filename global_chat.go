@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// The global stream every world shard's players are on. Nakama streams deliver to sessions
+// wherever they are connected, so a message sent by any match or RPC reaches every shard. Players
+// are tracked hidden: their status holds the map they are on, which only friends_online shows,
+// by their privacy settings.
+const (
+	streamModeGlobal    uint8 = 120 // a custom stream mode, apart from Nakama's own (0-7)
+	streamSubjectGlobal       = "world"
+)
+
+// Global chat tuning
+const (
+	globalChatMaxLength = 200
+	globalChatCooldown  = 5 * time.Second // between two global chat lines of a player
+	lfgAnnounceCooldown = 2 * time.Minute // a player's LFG announcements go out at most this often
+	maxFriendsOnline    = friendPageSize  // friends one friends_online call returns
+)
+
+// Global stream message types, sent as stream data {"type", "data"}
+const (
+	globalChatMessage = "global_chat" // playerId, username, map, text
+	globalLFGMessage  = "lfg"         // playerId, username, and map, text (/lfg) or dungeon, name, role, level (group finder)
+)
+
+// GlobalStatus is a player's status on the global stream
+type GlobalStatus struct {
+	Map     string `json:"map"`
+	Dungeon string `json:"dungeon,omitempty"` // the dungeon's ID while in an instance
+}
+
+// GlobalChannel puts the match's players on the global stream and sends their global chat
+type GlobalChannel struct {
+	logger runtime.Logger
+	nk     runtime.NakamaModule
+}
+
+// NewGlobalChannel creates the match's side of the global stream
+func NewGlobalChannel(logger runtime.Logger, nk runtime.NakamaModule) *GlobalChannel {
+	return &GlobalChannel{logger: logger, nk: nk}
+}
+
+// Join puts a joining player on the global stream, or updates their status there when they come
+// from another match. They stay on it until their session ends, so players between maps still
+// hear global chat.
+func (gc *GlobalChannel) Join(gs *GameMatchState, presence runtime.Presence) {
+	if gc.nk == nil || IsBot(presence.GetUserId()) {
+		return
+	}
+	status := GlobalStatus{Map: gs.currentMapName}
+	if gs.dungeon != nil {
+		status.Dungeon = gs.dungeon.Def.ID
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	tracked, err := gc.nk.StreamUserJoin(streamModeGlobal, streamSubjectGlobal, "", "", presence.GetUserId(), presence.GetSessionId(), true, false, string(data))
+	if err == nil && !tracked {
+		err = gc.nk.StreamUserUpdate(streamModeGlobal, streamSubjectGlobal, "", "", presence.GetUserId(), presence.GetSessionId(), true, false, string(data))
+	}
+	if err != nil {
+		gc.logger.Error("Failed to put %s on the global stream: %v", presence.GetUsername(), err)
+	}
+}
+
+// Say sends a global chat line from a player to every shard, as the content filter let it
+// through. It returns what stops the line before the filter at once; done gets the outcome, from
+// the match loop. The cooldown is kept by the module rather than the match, like the LFG one, so
+// hopping to another shard or map doesn't reset it.
+func (gc *GlobalChannel) Say(ctx context.Context, gs *GameMatchState, playerID, text string, done func(err error)) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return msg("global.chat_empty")
+	}
+	if len(text) > globalChatMaxLength {
+		return msg("global.chat_too_long", "max", globalChatMaxLength)
+	}
+	// The cooldown starts now, so lines waiting on the filter don't pile up
+	if remaining := notifier.ThrottleWait("chat/"+playerID, globalChatCooldown); remaining > 0 {
+		return msg("global.chat_cooldown", "seconds", int64((remaining+time.Second-1)/time.Second))
+	}
+	gs.moderation.Submit(ctx, ContentChat, playerID, text, func(text string, err error) {
+		if err == nil {
+			err = sendGlobal(gc.logger, gc.nk, globalChatMessage, map[string]any{
+				"playerId": playerID,
+				"username": gs.usernameOf(playerID),
+				"map":      gs.currentMapName,
+				"text":     text,
+			})
+		}
+		done(err)
+	})
+	return nil
+}
+
+// LFG announces on every shard that a player looks for a group, at most once per
+// lfgAnnounceCooldown. It returns overlong texts at once; done gets the outcome, from the match
+// loop.
+func (gc *GlobalChannel) LFG(ctx context.Context, gs *GameMatchState, playerID, text string, done func(err error)) error {
+	text = strings.TrimSpace(text)
+	if len(text) > globalChatMaxLength {
+		return msg("global.chat_too_long", "max", globalChatMaxLength)
+	}
+	gs.moderation.Submit(ctx, ContentChat, playerID, text, func(text string, err error) {
+		if err == nil && !notifier.Throttle("lfg/"+playerID, lfgAnnounceCooldown) {
+			err = msg("global.lfg_cooldown")
+		}
+		if err == nil {
+			err = sendGlobal(gc.logger, gc.nk, globalLFGMessage, map[string]any{
+				"playerId": playerID,
+				"username": gs.usernameOf(playerID),
+				"map":      gs.currentMapName,
+				"text":     text,
+			})
+		}
+		done(err)
+	})
+	return nil
+}
+
+// announceGroupFinder tells every shard a player queued for a dungeon, once per
+// lfgAnnounceCooldown
+func announceGroupFinder(logger runtime.Logger, nk runtime.NakamaModule, playerID, username string, def *DungeonDefinition, role string, level int) {
+	if !notifier.Throttle("lfg/"+playerID, lfgAnnounceCooldown) {
+		return
+	}
+	if err := sendGlobal(logger, nk, globalLFGMessage, map[string]any{
+		"playerId": playerID,
+		"username": username,
+		"level":    level,
+		"dungeon":  def.ID,
+		"name":     def.Name,
+		"role":     role,
+	}); err != nil {
+		logger.Warn("Failed to announce the group finder entry of %s: %v", playerID, err)
+	}
+}
+
+// sendGlobal sends a message to everyone on the global stream
+func sendGlobal(logger runtime.Logger, nk runtime.NakamaModule, msgType string, data any) error {
+	payload, err := EncodeStreamMessage(msgType, data)
+	if err != nil {
+		logger.Error("Failed to marshal %s: %v", msgType, err)
+		return msg("global.send_failed")
+	}
+	if err := nk.StreamSend(streamModeGlobal, streamSubjectGlobal, "", "", string(payload), nil, true); err != nil {
+		logger.Error("Failed to send %s on the global stream: %v", msgType, err)
+		return msg("global.send_failed")
+	}
+	return nil
+}
+
+// OnlineFriend is an online friend as friends_online returns them
+type OnlineFriend struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Map      string `json:"map,omitempty"`     // left out when their privacy hides it
+	Dungeon  string `json:"dungeon,omitempty"` // likewise
+}
+
+// rpcFriendsOnline lists the caller's mutual friends who are online, with the map they are on
+// when their location privacy setting lets friends see it.
+// Payload: {}
+func rpcFriendsOnline(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errLocationPlayersOnly
+	}
+
+	presences, err := nk.StreamUserList(streamModeGlobal, streamSubjectGlobal, "", "", true, true)
+	if err != nil {
+		logger.Error("Failed to list the global stream: %v", err)
+		return "", errInternalFailure
+	}
+	online := make(map[string]runtime.Presence, len(presences))
+	for _, presence := range presences {
+		online[presence.GetUserId()] = presence
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	friends := make([]OnlineFriend, 0)
+	mutual := 0
+	cursor := ""
+	for scanned := 0; scanned < maxFriendScan && len(friends) < maxFriendsOnline; scanned += friendPageSize {
+		page, next, err := nk.FriendsList(ctx, userID, friendPageSize, &mutual, cursor)
+		if err != nil {
+			return "", errInternalFailure
+		}
+		for _, friend := range page {
+			presence, ok := online[friend.GetUser().GetId()]
+			if !ok || len(friends) >= maxFriendsOnline {
+				continue
+			}
+			entry := OnlineFriend{UserID: presence.GetUserId(), Username: friend.GetUser().GetUsername()}
+			privacy, err := dm.LoadPrivacy(ctx, presence.GetUserId())
+			if err == nil && privacyAllows(privacy.Location, false, true) {
+				var status GlobalStatus
+				if json.Unmarshal([]byte(presence.GetStatus()), &status) == nil {
+					entry.Map, entry.Dungeon = status.Map, status.Dungeon
+				}
+			}
+			friends = append(friends, entry)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	sort.Slice(friends, func(i, j int) bool { return friends[i].Username < friends[j].Username })
+
+	out, err := json.Marshal(map[string]interface{}{"friends": friends})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
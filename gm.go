@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// maxAdminLogPage caps how many admin log entries one admin_log call returns
+const maxAdminLogPage = 100
+
+// gmToggle parses an optional "on"/"off" argument; without one the current value is flipped
+func gmToggle(cc *CommandContext, current bool, usage string) (bool, error) {
+	if len(cc.args) == 0 {
+		return !current, nil
+	}
+	switch strings.ToLower(cc.args[0]) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		return false, msg("cmd.usage", "usage", usage)
+	}
+}
+
+// inGMMode reports whether a player turned GM mode on
+func (gs *GameMatchState) inGMMode(playerID string) bool {
+	return gs.GetPlayerState(playerID).GMMode
+}
+
+// cmdGM turns GM mode on or off. The role is read from the account metadata again when turning it
+// on, so a GM who lost the role since joining can't use it. Turning it off also ends invisibility
+// god mode and no-clip.
+func cmdGM(cc *CommandContext) (*LocalizedText, error) {
+	gs := cc.gameState
+	state := gs.GetPlayerState(cc.playerID)
+	on, err := gmToggle(cc, state.GMMode, chatCommands["gm"].Usage)
+	if err != nil {
+		return nil, err
+	}
+	if on {
+		state.Role = accountRole(cc.ctx, gs.databaseManager.nk, cc.playerID)
+		if !roleAllows(state.Role, RoleGM) {
+			state.GMMode = false
+			return nil, msg("cmd.gm.not_gm")
+		}
+		state.GMMode = true
+		return msg("cmd.gm.on"), nil
+	}
+	state.GMMode = false
+	state.GodMode = false
+	gs.stealth.SetInvisible(cc.playerID, false)
+	if rb := gs.PlayerBody(cc.playerID); rb != nil {
+		gs.physicsEngine.SetNoClip(rb, false)
+	}
+	return msg("cmd.gm.off"), nil
+}
+
+// cmdInvisible leaves the GM out of everyone else's world updates; NPCs ignore them too
+func cmdInvisible(cc *CommandContext) (*LocalizedText, error) {
+	stealth := cc.gameState.stealth
+	on, err := gmToggle(cc, stealth.IsInvisible(cc.playerID), chatCommands["invisible"].Usage)
+	if err != nil {
+		return nil, err
+	}
+	stealth.SetInvisible(cc.playerID, on)
+	if on {
+		return msg("cmd.invisible.on"), nil
+	}
+	return msg("cmd.invisible.off"), nil
+}
+
+// cmdGod makes the GM ignore all damage
+func cmdGod(cc *CommandContext) (*LocalizedText, error) {
+	state := cc.gameState.GetPlayerState(cc.playerID)
+	on, err := gmToggle(cc, state.GodMode, chatCommands["god"].Usage)
+	if err != nil {
+		return nil, err
+	}
+	state.GodMode = on
+	if on {
+		return msg("cmd.god.on"), nil
+	}
+	return msg("cmd.god.off"), nil
+}
+
+// cmdNoClip lets the GM walk through walls and other static colliders
+func cmdNoClip(cc *CommandContext) (*LocalizedText, error) {
+	gs := cc.gameState
+	rb := gs.PlayerBody(cc.playerID)
+	if rb == nil {
+		return nil, msg("error.no_body")
+	}
+	on, err := gmToggle(cc, gs.physicsEngine.BodyPhysics(rb).NoClip, chatCommands["noclip"].Usage)
+	if err != nil {
+		return nil, err
+	}
+	gs.physicsEngine.SetNoClip(rb, on)
+	if on {
+		return msg("cmd.noclip.on"), nil
+	}
+	return msg("cmd.noclip.off"), nil
+}
+
+// cmdFreeze holds a player in place, or lets them move again
+func cmdFreeze(cc *CommandContext) (*LocalizedText, error) {
+	if len(cc.args) == 0 || len(cc.args) > 2 {
+		return nil, msg("cmd.usage", "usage", chatCommands["freeze"].Usage)
+	}
+	gs := cc.gameState
+	targetID, ok := gs.findPlayerByName(cc.args[0])
+	if !ok {
+		return nil, msg("error.unknown_player", "player", cc.args[0])
+	}
+	rb := gs.PlayerBody(targetID)
+	if rb == nil {
+		return nil, msg("cmd.tp.no_body")
+	}
+	cc.args = cc.args[1:]
+	on, err := gmToggle(cc, gs.physicsEngine.BodyPhysics(rb).Frozen, chatCommands["freeze"].Usage)
+	if err != nil {
+		return nil, err
+	}
+	gs.physicsEngine.SetFrozen(rb, on)
+	if on {
+		return msg("cmd.freeze.on", "player", gs.usernameOf(targetID)), nil
+	}
+	return msg("cmd.freeze.off", "player", gs.usernameOf(targetID)), nil
+}
+
+// cmdSpawnItem drops an item stack at the GM's feet; it stays until picked up
+func cmdSpawnItem(cc *CommandContext) (*LocalizedText, error) {
+	if len(cc.args) == 0 || len(cc.args) > 2 {
+		return nil, msg("cmd.usage", "usage", chatCommands["spawn_item"].Usage)
+	}
+	gs := cc.gameState
+	itemID := cc.args[0]
+	if _, ok := gs.itemCatalog.Get(itemID); !ok {
+		return nil, msg("error.unknown_item", "item", itemID)
+	}
+	count := 1
+	if len(cc.args) == 2 {
+		n, err := strconv.Atoi(cc.args[1])
+		if err != nil || n <= 0 {
+			return nil, msg("error.bad_count")
+		}
+		count = n
+	}
+	rb := gs.PlayerBody(cc.playerID)
+	if rb == nil {
+		return nil, msg("error.no_body")
+	}
+	id := gs.worldItems.Spawn(gs, itemID, count, rb.Position, cc.playerID, 0, cc.dispatcher)
+	return msg("cmd.spawn_item.done", "count", count, "item", itemID, "objectId", id), nil
+}
+
+// auditCommand writes a privileged command to the admin log
+func (gs *GameMatchState) auditCommand(ctx context.Context, playerID, name string, args []string, result CommandResult, logger runtime.Logger) {
+	logger.Info("Player %s ran /%s %v: ok=%t", playerID, name, args, result.OK)
+	matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	entry := &AdminLogEntry{
+		Time:      time.Now().UTC(),
+		ActorID:   playerID,
+		ActorName: gs.usernameOf(playerID),
+		Role:      gs.GetPlayerState(playerID).Role,
+		Action:    name,
+		Args:      args,
+		MatchID:   matchID,
+		Map:       gs.currentMapName,
+		OK:        result.OK,
+		Result:    messageCatalog.Render(defaultLocale, result.Key, result.Params),
+	}
+	if err := gs.databaseManager.AppendAdminLog(ctx, entry); err != nil {
+		logger.Error("Failed to audit /%s by %s: %v", name, playerID, err)
+	}
+}
+
+// rpcAdminLog pages through the admin log, newest first.
+// Payload: {"limit": 50, "cursor": "optional"}
+func rpcAdminLog(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	req := struct {
+		Limit  int    `json:"limit"`
+		Cursor string `json:"cursor"`
+	}{Limit: 50}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+	if req.Limit <= 0 || req.Limit > maxAdminLogPage {
+		req.Limit = maxAdminLogPage
+	}
+
+	entries, cursor, err := NewDatabaseManager(logger, nk).ListAdminLog(ctx, req.Limit, req.Cursor)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	out, err := json.Marshal(map[string]interface{}{"entries": entries, "cursor": cursor})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
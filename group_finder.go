@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Group finder tuning
+const (
+	groupFinderAnyRole      = "any"   // the role of every entry for dungeons without role slots
+	groupFinderEntryTimeout = 15 * 60 // seconds an entry stays queued
+	groupFinderWriteRetries = 3       // attempts to write the queue when another write got in first
+	groupFinderQueueKey     = "queue" // storage key of the shared queue
+)
+
+var (
+	errGroupFinderRole        = runtime.NewError("role not wanted by this dungeon", rpcCodeInvalidArgument)
+	errGroupFinderLevel       = runtime.NewError("level outside the dungeon's range", rpcCodeFailedPrecondition)
+	errGroupFinderPlayersOnly = runtime.NewError("the group finder is for players", rpcCodeUnauthenticated)
+)
+
+// GroupFinderEntry is a player waiting for a dungeon group
+type GroupFinderEntry struct {
+	PlayerID string `json:"playerId"`
+	Dungeon  string `json:"dungeon"`
+	Role     string `json:"role"`
+	Level    int    `json:"level"`
+	QueuedAt int64  `json:"queuedAt"` // unix seconds
+}
+
+// groupSlots returns how many players of each role make a group finder group for the dungeon
+func (def *DungeonDefinition) groupSlots() map[string]int {
+	slots := make(map[string]int, len(def.Roles))
+	for role, count := range def.Roles {
+		slots[role] = count
+	}
+	if len(slots) == 0 {
+		slots[groupFinderAnyRole] = def.MaxPlayers
+	}
+	return slots
+}
+
+// formGroup picks the longest waiting entries that fill every role slot of the dungeon. It
+// returns their indices in the queue, or nil if the queue can't fill the group yet.
+func formGroup(def *DungeonDefinition, entries []*GroupFinderEntry) []int {
+	slots := def.groupSlots()
+	open := 0
+	for _, count := range slots {
+		open += count
+	}
+	picked := make([]int, 0, open)
+	for i, entry := range entries {
+		if entry.Dungeon != def.ID || slots[entry.Role] <= 0 {
+			continue
+		}
+		slots[entry.Role]--
+		picked = append(picked, i)
+		if len(picked) == open {
+			return picked
+		}
+	}
+	return nil
+}
+
+// updateGroupFinderQueue applies change to the stored queue and writes it back, retrying with
+// a fresh copy when another writer changed it in between. Entries past their timeout are dropped.
+func updateGroupFinderQueue(ctx context.Context, dm *DatabaseManager, change func(queue *PersistedGroupFinderQueue) error) error {
+	var err error
+	for attempt := 0; attempt < groupFinderWriteRetries; attempt++ {
+		queue, version, loadErr := dm.LoadGroupFinderQueue(ctx)
+		if loadErr != nil {
+			return loadErr
+		}
+		cutoff := time.Now().Unix() - groupFinderEntryTimeout
+		live := queue.Entries[:0]
+		for _, entry := range queue.Entries {
+			if entry.QueuedAt >= cutoff {
+				live = append(live, entry)
+			}
+		}
+		queue.Entries = live
+
+		if err = change(queue); err != nil {
+			return err
+		}
+		if err = dm.SaveGroupFinderQueue(ctx, queue, version); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// removeEntries drops the player's entries from the queue
+func removeEntries(queue *PersistedGroupFinderQueue, playerID string) {
+	kept := queue.Entries[:0]
+	for _, entry := range queue.Entries {
+		if entry.PlayerID != playerID {
+			kept = append(kept, entry)
+		}
+	}
+	queue.Entries = kept
+}
+
+// rpcGroupFinderJoin queues the caller for a dungeon in a role, replacing any earlier entry.
+// When the queue can fill the dungeon's role slots, the group is taken out of the queue and a
+// dungeon instance is created for it; the other members get the dungeon invite notification.
+// Payload: {"dungeon": "crypt", "role": "healer"}
+func rpcGroupFinderJoin(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errGroupFinderPlayersOnly
+	}
+
+	var req struct {
+		Dungeon string `json:"dungeon"`
+		Role    string `json:"role"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.Dungeon == "" {
+		return "", errInvalidPayload
+	}
+
+	dungeons, err := LoadDungeonDefinitions(dungeonDefinitionsPath)
+	if err != nil {
+		logger.Error("Failed to load dungeons: %v", err)
+		return "", errInternalFailure
+	}
+	def, ok := dungeons[req.Dungeon]
+	if !ok {
+		return "", errUnknownDungeon
+	}
+	if len(def.Roles) == 0 {
+		req.Role = groupFinderAnyRole
+	} else if def.Roles[req.Role] <= 0 {
+		return "", errGroupFinderRole
+	}
+
+	// Levels come from the saved player data, not the client
+	dm := NewDatabaseManager(logger, nk)
+	player, err := dm.LoadPlayerData(ctx, userID)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	level := player.Level
+	if (def.MinLevel > 0 && level < def.MinLevel) || (def.MaxLevel > 0 && level > def.MaxLevel) {
+		return "", errGroupFinderLevel
+	}
+
+	var group []*GroupFinderEntry
+	err = updateGroupFinderQueue(ctx, dm, func(queue *PersistedGroupFinderQueue) error {
+		group = nil
+		removeEntries(queue, userID)
+		queue.Entries = append(queue.Entries, &GroupFinderEntry{
+			PlayerID: userID,
+			Dungeon:  def.ID,
+			Role:     req.Role,
+			Level:    level,
+			QueuedAt: time.Now().Unix(),
+		})
+
+		picked := formGroup(def, queue.Entries)
+		if picked == nil {
+			return nil
+		}
+		inGroup := make(map[int]bool, len(picked))
+		for _, i := range picked {
+			inGroup[i] = true
+			group = append(group, queue.Entries[i])
+		}
+		kept := make([]*GroupFinderEntry, 0, len(queue.Entries)-len(picked))
+		for i, entry := range queue.Entries {
+			if !inGroup[i] {
+				kept = append(kept, entry)
+			}
+		}
+		queue.Entries = kept
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to update the group finder queue: %v", err)
+		return "", errInternalFailure
+	}
+
+	if group == nil {
+		username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+		announceGroupFinder(logger, nk, userID, username, def, req.Role, level)
+		out, _ := json.Marshal(map[string]any{"queued": true, "dungeon": def.ID, "role": req.Role})
+		return string(out), nil
+	}
+
+	// The caller completed the group and leads it; everyone else is invited
+	party := []string{userID}
+	roles := map[string]string{}
+	for _, entry := range group {
+		roles[entry.PlayerID] = entry.Role
+		if entry.PlayerID != userID {
+			party = append(party, entry.PlayerID)
+		}
+	}
+	matchID, err := CreateDungeonMatch(ctx, nk, logger, def, party, 0)
+	if err != nil {
+		logger.Error("Failed to create dungeon %s for a group finder group: %v", def.ID, err)
+		// Put the group back so it forms again with the next join
+		if requeueErr := updateGroupFinderQueue(ctx, dm, func(queue *PersistedGroupFinderQueue) error {
+			queue.Entries = append(group, queue.Entries...)
+			return nil
+		}); requeueErr != nil {
+			logger.Error("Failed to requeue the group finder group: %v", requeueErr)
+		}
+		return "", errInternalFailure
+	}
+
+	out, _ := json.Marshal(map[string]any{"matchId": matchID, "dungeon": def.ID, "party": party, "roles": roles})
+	return string(out), nil
+}
+
+// rpcGroupFinderLeave takes the caller out of the group finder queue
+func rpcGroupFinderLeave(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errGroupFinderPlayersOnly
+	}
+	dm := NewDatabaseManager(logger, nk)
+	if err := updateGroupFinderQueue(ctx, dm, func(queue *PersistedGroupFinderQueue) error {
+		removeEntries(queue, userID)
+		return nil
+	}); err != nil {
+		logger.Error("Failed to update the group finder queue: %v", err)
+		return "", errInternalFailure
+	}
+	return `{"queued":false}`, nil
+}
+
+// rpcGroupFinderStatus returns the caller's entry and how many players wait for each role of
+// its dungeon
+func rpcGroupFinderStatus(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errGroupFinderPlayersOnly
+	}
+	queue, _, err := NewDatabaseManager(logger, nk).LoadGroupFinderQueue(ctx)
+	if err != nil {
+		return "", errInternalFailure
+	}
+
+	var own *GroupFinderEntry
+	for _, entry := range queue.Entries {
+		if entry.PlayerID == userID && entry.QueuedAt >= time.Now().Unix()-groupFinderEntryTimeout {
+			own = entry
+		}
+	}
+	if own == nil {
+		return `{"queued":false}`, nil
+	}
+	waiting := make(map[string]int)
+	for _, entry := range queue.Entries {
+		if entry.Dungeon == own.Dungeon && entry.QueuedAt >= time.Now().Unix()-groupFinderEntryTimeout {
+			waiting[entry.Role]++
+		}
+	}
+	out, _ := json.Marshal(map[string]any{
+		"queued":    true,
+		"dungeon":   own.Dungeon,
+		"role":      own.Role,
+		"waitedFor": time.Now().Unix() - own.QueuedAt,
+		"waiting":   waiting,
+	})
+	return string(out), nil
+}
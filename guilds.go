@@ -0,0 +1,727 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Guild ranks, from the lowest to the highest
+const (
+	GuildRankMember  = "member"
+	GuildRankOfficer = "officer"
+	GuildRankLeader  = "leader"
+)
+
+// Guild tuning
+const (
+	guildInviteTTL      = 60 * time.Second
+	guildNameMinLength  = 3
+	guildNameMaxLength  = 24
+	guildMaxMembers     = 50
+	guildChatMaxLength  = 200
+	guildBankMaxStacks  = 100 // distinct item types the bank can hold
+	guildWriteRetries   = 3   // attempts to write a guild when another shard changed it in between
+	guildUpdateMessage  = "guild_update"
+	guildChatMessage    = "guild_chat"
+	guildInviteMessage  = "guild_invite"
+	guildRemovedMessage = "guild_removed"
+)
+
+// guildRankLevels orders the ranks for permission checks
+var guildRankLevels = map[string]int{
+	GuildRankMember:  0,
+	GuildRankOfficer: 1,
+	GuildRankLeader:  2,
+}
+
+// guildTagPattern is what a guild tag may look like (shown next to player names)
+var guildTagPattern = regexp.MustCompile(`^[A-Za-z0-9]{2,5}$`)
+
+// errGuildTagTaken is returned by DatabaseManager.CreateGuild when the tag is in use
+var errGuildTagTaken = msg("guild.tag_taken")
+
+// GuildMember is a member entry of a persisted guild
+type GuildMember struct {
+	Username string    `json:"username"`
+	Rank     string    `json:"rank"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// PersistedGuild is a guild as stored in the "guilds" collection, keyed by its lowercased tag
+type PersistedGuild struct {
+	ID        string                  `json:"id"` // lowercased tag
+	Tag       string                  `json:"tag"`
+	Name      string                  `json:"name"`
+	LeaderID  string                  `json:"leaderId"`
+	Members   map[string]*GuildMember `json:"members"` // player ID -> member
+	Bank      map[string]int          `json:"bank"`    // item ID -> count
+	CreatedAt time.Time               `json:"createdAt"`
+}
+
+// GuildMemberData is a member entry of a guild update
+type GuildMemberData struct {
+	PlayerID string `json:"playerId"`
+	Username string `json:"username"`
+	Rank     string `json:"rank"`
+	Online   bool   `json:"online"`
+}
+
+// GuildData is the guild sent to its online members (OpCodeGuild "guild_update")
+type GuildData struct {
+	ID      string            `json:"id"`
+	Tag     string            `json:"tag"`
+	Name    string            `json:"name"`
+	Members []GuildMemberData `json:"members"`
+	Bank    map[string]int    `json:"bank"`
+}
+
+// GuildChatData is a guild chat line (OpCodeGuild "guild_chat")
+type GuildChatData struct {
+	PlayerID string `json:"playerId"`
+	Username string `json:"username"`
+	Rank     string `json:"rank"`
+	Text     string `json:"text"`
+}
+
+// guildInvite is a pending invitation
+type guildInvite struct {
+	GuildID   string
+	InviterID string
+	Expires   time.Time
+}
+
+// GuildManager keeps the guilds of online players cached and applies membership and bank
+// changes. Every change is saved before the cached copy is replaced.
+type GuildManager struct {
+	logger  runtime.Logger
+	db      *DatabaseManager
+	guilds  map[string]*PersistedGuild // guild ID -> guild with at least one online member
+	members map[string]string          // online player ID -> guild ID
+	invites map[string]*guildInvite    // invited player ID -> invite
+	mu      sync.Mutex
+}
+
+// NewGuildManager creates an empty guild manager
+func NewGuildManager(logger runtime.Logger, db *DatabaseManager) *GuildManager {
+	return &GuildManager{
+		logger:  logger,
+		db:      db,
+		guilds:  make(map[string]*PersistedGuild),
+		members: make(map[string]string),
+		invites: make(map[string]*guildInvite),
+	}
+}
+
+// LoadPlayer loads the guild of a joining player into the cache
+func (gm *GuildManager) LoadPlayer(ctx context.Context, playerID, username string) {
+	guildID, err := gm.db.LoadGuildMembership(ctx, playerID)
+	if err != nil || guildID == "" {
+		return
+	}
+
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild := gm.guilds[guildID]
+	if guild == nil {
+		if guild, err = gm.db.LoadGuild(ctx, guildID); err != nil {
+			return
+		}
+	}
+	// The membership record outlived the guild entry (kicked or disbanded while offline)
+	if guild == nil || guild.Members[playerID] == nil {
+		return
+	}
+	// Keep the stored username current for the member list; saved with the next change
+	guild.Members[playerID].Username = username
+	gm.guilds[guildID] = guild
+	gm.members[playerID] = guildID
+}
+
+// UnloadPlayer releases a leaving player, and their guild once no member is online
+func (gm *GuildManager) UnloadPlayer(playerID string) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	delete(gm.invites, playerID)
+	guildID, ok := gm.members[playerID]
+	if !ok {
+		return
+	}
+	delete(gm.members, playerID)
+	for _, id := range gm.members {
+		if id == guildID {
+			return
+		}
+	}
+	delete(gm.guilds, guildID)
+}
+
+// TagOf returns the tag of an online player's guild ("" when not in a guild)
+func (gm *GuildManager) TagOf(playerID string) string {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	if guild := gm.guilds[gm.members[playerID]]; guild != nil {
+		return guild.Tag
+	}
+	return ""
+}
+
+// GuildOf returns the ID of an online player's guild ("" when not in a guild)
+func (gm *GuildManager) GuildOf(playerID string) string {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	return gm.members[playerID]
+}
+
+// Info returns a snapshot of an online player's guild
+func (gm *GuildManager) Info(gs *GameMatchState, playerID string) (*GuildData, bool) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild := gm.guilds[gm.members[playerID]]
+	if guild == nil {
+		return nil, false
+	}
+	data := gm.snapshot(gs, guild)
+	return &data, true
+}
+
+// SyncMembers sends a player's guild to its online members, e.g. after the player joined
+func (gm *GuildManager) SyncMembers(gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	gm.SyncGuild(gs, gm.GuildOf(playerID), dispatcher)
+}
+
+// SyncGuild sends a guild to its online members; guilds without online members are skipped
+func (gm *GuildManager) SyncGuild(gs *GameMatchState, guildID string, dispatcher runtime.MatchDispatcher) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	if guild := gm.guilds[guildID]; guild != nil {
+		gm.broadcastUpdate(gs, guild, dispatcher)
+	}
+}
+
+// Create founds a guild led by the player once the content filter accepted its tag and name.
+// It returns invalid tags and names at once; done gets the outcome, from the match loop.
+func (gm *GuildManager) Create(ctx context.Context, gs *GameMatchState, playerID, tag, name string, dispatcher runtime.MatchDispatcher, done func(err error)) error {
+	name = strings.TrimSpace(name)
+	if !guildTagPattern.MatchString(tag) {
+		return msg("guild.bad_tag")
+	}
+	if len(name) < guildNameMinLength || len(name) > guildNameMaxLength {
+		return msg("guild.bad_name", "min", guildNameMinLength, "max", guildNameMaxLength)
+	}
+	gs.moderation.Submit(ctx, ContentGuildName, playerID, tag+" "+name, func(_ string, err error) {
+		if err == nil {
+			err = gm.create(ctx, gs, playerID, tag, name, dispatcher)
+		}
+		done(err)
+	})
+	return nil
+}
+
+// create founds a guild whose tag and name the content filter accepted
+func (gm *GuildManager) create(ctx context.Context, gs *GameMatchState, playerID, tag, name string, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	if _, ok := gm.members[playerID]; ok {
+		return msg("guild.already_member")
+	}
+	now := time.Now().UTC()
+	guild := &PersistedGuild{
+		ID:        strings.ToLower(tag),
+		Tag:       strings.ToUpper(tag),
+		Name:      name,
+		LeaderID:  playerID,
+		Members:   map[string]*GuildMember{playerID: {Username: gs.usernameOf(playerID), Rank: GuildRankLeader, JoinedAt: now}},
+		Bank:      map[string]int{},
+		CreatedAt: now,
+	}
+	if err := gm.db.CreateGuild(ctx, guild); err != nil {
+		if err == errGuildTagTaken {
+			return err
+		}
+		return msg("guild.create_failed")
+	}
+	gm.guilds[guild.ID] = guild
+	gm.members[playerID] = guild.ID
+	delete(gm.invites, playerID)
+	gm.logger.Info("Player %s founded guild [%s] %s", playerID, guild.Tag, guild.Name)
+	gm.broadcastUpdate(gs, guild, dispatcher)
+	return nil
+}
+
+// Invite invites an online player who isn't in a guild. Officers and the leader can invite. The
+// invite is also sent as a notification, which reaches the player outside the match too.
+func (gm *GuildManager) Invite(ctx context.Context, gs *GameMatchState, inviterID, targetID string, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild, err := gm.requireRank(inviterID, GuildRankOfficer)
+	if err != nil {
+		return err
+	}
+	if _, ok := gm.members[targetID]; ok {
+		return msg("guild.target_in_guild", "player", gs.usernameOf(targetID))
+	}
+	if len(guild.Members) >= guildMaxMembers {
+		return msg("guild.full")
+	}
+	gm.invites[targetID] = &guildInvite{GuildID: guild.ID, InviterID: inviterID, Expires: time.Now().Add(guildInviteTTL)}
+	invite := map[string]any{
+		"guildId":   guild.ID,
+		"tag":       guild.Tag,
+		"name":      guild.Name,
+		"inviter":   gs.usernameOf(inviterID),
+		"expiresIn": guildInviteTTL.Seconds(),
+	}
+	gm.send(gs, guildInviteMessage, invite, []string{targetID}, dispatcher)
+	notifier.Queue(ctx, targetID, notificationGuildInvite, fmt.Sprintf("Invite to [%s] %s", guild.Tag, guild.Name), invite, inviterID, false)
+	return nil
+}
+
+// Accept joins the guild the player was last invited to
+func (gm *GuildManager) Accept(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) (string, error) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	invite := gm.invites[playerID]
+	delete(gm.invites, playerID)
+	if invite == nil || time.Now().After(invite.Expires) {
+		return "", msg("guild.no_invite")
+	}
+	if _, ok := gm.members[playerID]; ok {
+		return "", msg("guild.already_member")
+	}
+	// The guild is read back whether or not it is cached: members on other shards change it too
+	updated, err := gm.updateGuild(ctx, invite.GuildID, func(guild *PersistedGuild) (map[string]string, error) {
+		if len(guild.Members) >= guildMaxMembers {
+			return nil, msg("guild.full")
+		}
+		guild.Members[playerID] = &GuildMember{Username: gs.usernameOf(playerID), Rank: GuildRankMember, JoinedAt: time.Now().UTC()}
+		return map[string]string{playerID: guild.ID}, nil
+	})
+	if err != nil {
+		return "", gm.guildError(err, "guild.join_failed")
+	}
+	gm.guilds[updated.ID] = updated
+	gm.members[playerID] = updated.ID
+	gm.broadcastUpdate(gs, updated, dispatcher)
+	return updated.Name, nil
+}
+
+// Leave removes the player from their guild. The leader can only leave once they are the
+// last member, which disbands the guild.
+func (gm *GuildManager) Leave(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild, err := gm.requireRank(playerID, GuildRankMember)
+	if err != nil {
+		return err
+	}
+	if guild.LeaderID == playerID {
+		if len(guild.Members) > 1 {
+			return msg("guild.leader_leaving")
+		}
+		return gm.disband(ctx, gs, guild, dispatcher)
+	}
+	return gm.removeMember(ctx, gs, guild, playerID, "left", dispatcher)
+}
+
+// Kick removes a lower-ranked member. Officers and the leader can kick.
+func (gm *GuildManager) Kick(ctx context.Context, gs *GameMatchState, actorID, targetName string, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild, err := gm.requireRank(actorID, GuildRankOfficer)
+	if err != nil {
+		return err
+	}
+	targetID, member := guild.memberByName(targetName)
+	if member == nil {
+		return msg("guild.not_in_your_guild", "player", targetName)
+	}
+	if guildRankLevels[member.Rank] >= guildRankLevels[guild.Members[actorID].Rank] {
+		return msg("guild.kick_rank")
+	}
+	return gm.removeMember(ctx, gs, guild, targetID, "kicked", dispatcher)
+}
+
+// Promote raises a member to officer. Promoting an officer hands them the leadership and
+// makes the old leader an officer. Only the leader can promote.
+func (gm *GuildManager) Promote(ctx context.Context, gs *GameMatchState, actorID, targetName string, dispatcher runtime.MatchDispatcher) (string, error) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild, err := gm.requireRank(actorID, GuildRankLeader)
+	if err != nil {
+		return "", err
+	}
+	targetID, member := guild.memberByName(targetName)
+	if member == nil || targetID == actorID {
+		return "", msg("guild.not_other_member", "player", targetName)
+	}
+
+	updated, err := gm.updateGuild(ctx, guild.ID, func(guild *PersistedGuild) (map[string]string, error) {
+		target, actor := guild.Members[targetID], guild.Members[actorID]
+		if target == nil || actor == nil || guild.LeaderID != actorID {
+			return nil, msg("guild.not_other_member", "player", targetName)
+		}
+		switch target.Rank {
+		case GuildRankMember:
+			target.Rank = GuildRankOfficer
+		case GuildRankOfficer:
+			target.Rank = GuildRankLeader
+			actor.Rank = GuildRankOfficer
+			guild.LeaderID = targetID
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return "", gm.guildError(err, "guild.update_failed")
+	}
+	gm.guilds[updated.ID] = updated
+	gm.broadcastUpdate(gs, updated, dispatcher)
+	return updated.Members[targetID].Rank, nil
+}
+
+// Demote lowers an officer to member. Only the leader can demote.
+func (gm *GuildManager) Demote(ctx context.Context, gs *GameMatchState, actorID, targetName string, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild, err := gm.requireRank(actorID, GuildRankLeader)
+	if err != nil {
+		return err
+	}
+	targetID, member := guild.memberByName(targetName)
+	if member == nil || member.Rank != GuildRankOfficer {
+		return msg("guild.not_officer", "player", targetName)
+	}
+
+	updated, err := gm.updateGuild(ctx, guild.ID, func(guild *PersistedGuild) (map[string]string, error) {
+		if guild.Members[targetID] == nil || guild.Members[targetID].Rank != GuildRankOfficer {
+			return nil, msg("guild.not_officer", "player", targetName)
+		}
+		guild.Members[targetID].Rank = GuildRankMember
+		return nil, nil
+	})
+	if err != nil {
+		return gm.guildError(err, "guild.update_failed")
+	}
+	gm.guilds[updated.ID] = updated
+	gm.broadcastUpdate(gs, updated, dispatcher)
+	return nil
+}
+
+// Disband deletes the player's guild. Only the leader can disband; the bank is lost.
+func (gm *GuildManager) Disband(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild, err := gm.requireRank(playerID, GuildRankLeader)
+	if err != nil {
+		return err
+	}
+	return gm.disband(ctx, gs, guild, dispatcher)
+}
+
+// Deposit moves items from the player's inventory into the guild bank. Any member can deposit.
+func (gm *GuildManager) Deposit(ctx context.Context, gs *GameMatchState, playerID, itemID string, count int, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild, err := gm.requireRank(playerID, GuildRankMember)
+	if err != nil {
+		return err
+	}
+	if _, ok := guild.Bank[itemID]; !ok && len(guild.Bank) >= guildBankMaxStacks {
+		return msg("guild.bank_full")
+	}
+	if err := gs.inventoryManager.Remove(ctx, playerID, itemID, count); err != nil {
+		if err == errNotEnoughItems {
+			return msg("guild.missing_items", "count", count, "item", itemID)
+		}
+		return msg("guild.deposit_failed")
+	}
+
+	updated, err := gm.updateGuild(ctx, guild.ID, func(guild *PersistedGuild) (map[string]string, error) {
+		if _, ok := guild.Bank[itemID]; !ok && len(guild.Bank) >= guildBankMaxStacks {
+			return nil, msg("guild.bank_full")
+		}
+		guild.Bank[itemID] += count
+		return nil, nil
+	})
+	if err != nil {
+		// Give the items back so nothing is lost
+		if rerr := gs.inventoryManager.Add(ctx, playerID, itemID, count); rerr != nil {
+			gm.logger.Error("Failed to return %d x %s to %s after a failed deposit: %v", count, itemID, playerID, rerr)
+		}
+		return gm.guildError(err, "guild.deposit_failed")
+	}
+	gm.guilds[updated.ID] = updated
+	gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	gm.broadcastUpdate(gs, updated, dispatcher)
+	return nil
+}
+
+// Withdraw moves items from the guild bank into the player's inventory. Officers and the
+// leader can withdraw.
+func (gm *GuildManager) Withdraw(ctx context.Context, gs *GameMatchState, playerID, itemID string, count int, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild, err := gm.requireRank(playerID, GuildRankOfficer)
+	if err != nil {
+		return err
+	}
+	if guild.Bank[itemID] < count {
+		return msg("guild.bank_short", "count", guild.Bank[itemID], "item", itemID)
+	}
+
+	// Save the bank first: a failed inventory write can be rolled back, a duplicated item can't
+	updated, err := gm.updateGuild(ctx, guild.ID, func(guild *PersistedGuild) (map[string]string, error) {
+		if guild.Bank[itemID] < count {
+			return nil, msg("guild.bank_short", "count", guild.Bank[itemID], "item", itemID)
+		}
+		if guild.Bank[itemID] -= count; guild.Bank[itemID] <= 0 {
+			delete(guild.Bank, itemID)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return gm.guildError(err, "guild.withdraw_failed")
+	}
+	if err := gs.inventoryManager.Add(ctx, playerID, itemID, count); err != nil {
+		restored, rerr := gm.updateGuild(ctx, guild.ID, func(guild *PersistedGuild) (map[string]string, error) {
+			guild.Bank[itemID] += count
+			return nil, nil
+		})
+		if rerr != nil {
+			gm.logger.Error("Failed to restore guild bank of %s after a failed withdrawal: %v", guild.ID, rerr)
+			restored = updated
+		}
+		gm.guilds[restored.ID] = restored
+		return msg("guild.withdraw_failed")
+	}
+	gm.guilds[updated.ID] = updated
+	gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	gm.broadcastUpdate(gs, updated, dispatcher)
+	return nil
+}
+
+// CreditBank adds items to a guild's bank, whether or not any member is online (e.g. control
+// point rewards)
+func (gm *GuildManager) CreditBank(ctx context.Context, gs *GameMatchState, guildID, itemID string, count int, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	_, cached := gm.guilds[guildID]
+	updated, err := gm.updateGuild(ctx, guildID, func(guild *PersistedGuild) (map[string]string, error) {
+		if _, ok := guild.Bank[itemID]; !ok && len(guild.Bank) >= guildBankMaxStacks {
+			return nil, msg("guild.bank_full")
+		}
+		guild.Bank[itemID] += count
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	if cached {
+		gm.guilds[guildID] = updated
+		gm.broadcastUpdate(gs, updated, dispatcher)
+	}
+	return nil
+}
+
+// Chat sends a line to the online members of the player's guild, as the content filter let it
+// through. It returns empty and overlong lines at once; done gets the outcome, from the match
+// loop.
+func (gm *GuildManager) Chat(ctx context.Context, gs *GameMatchState, playerID, text string, dispatcher runtime.MatchDispatcher, done func(err error)) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return msg("guild.chat_empty")
+	}
+	if len(text) > guildChatMaxLength {
+		return msg("guild.chat_too_long", "max", guildChatMaxLength)
+	}
+	gs.moderation.Submit(ctx, ContentChat, playerID, text, func(text string, err error) {
+		if err == nil {
+			err = gm.chat(gs, playerID, text, dispatcher)
+		}
+		done(err)
+	})
+	return nil
+}
+
+// chat sends a line the content filter let through to the player's online guild mates
+func (gm *GuildManager) chat(gs *GameMatchState, playerID, text string, dispatcher runtime.MatchDispatcher) error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	guild, err := gm.requireRank(playerID, GuildRankMember)
+	if err != nil {
+		return err
+	}
+	gm.send(gs, guildChatMessage, GuildChatData{
+		PlayerID: playerID,
+		Username: gs.usernameOf(playerID),
+		Rank:     guild.Members[playerID].Rank,
+		Text:     text,
+	}, gm.onlineMembers(guild), dispatcher)
+	return nil
+}
+
+// updateGuild applies change to the stored guild and writes it back together with the
+// membership changes change returns, retrying with a fresh copy when another shard changed the
+// guild in between. It returns the guild as written, or msg("guild.gone") once it is deleted.
+func (gm *GuildManager) updateGuild(ctx context.Context, guildID string, change func(guild *PersistedGuild) (map[string]string, error)) (*PersistedGuild, error) {
+	var err error
+	for attempt := 0; attempt < guildWriteRetries; attempt++ {
+		guild, version, loadErr := gm.db.LoadGuildVersion(ctx, guildID)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		if guild == nil {
+			return nil, msg("guild.gone")
+		}
+		memberships, changeErr := change(guild)
+		if changeErr != nil {
+			return nil, changeErr
+		}
+		if err = gm.db.SaveGuild(ctx, guild, memberships, version); err == nil {
+			return guild, nil
+		}
+	}
+	return nil, err
+}
+
+// guildError is the error a player sees for a failed guild change: the message the change
+// rejected it with, or the failure message when storage failed
+func (gm *GuildManager) guildError(err error, failed string) error {
+	if _, ok := err.(*LocalizedText); ok {
+		return err
+	}
+	gm.logger.Error("Failed to update guild: %v", err)
+	return msg(failed)
+}
+
+// requireRank returns the player's guild if they hold at least minRank in it. Called with the lock held.
+func (gm *GuildManager) requireRank(playerID, minRank string) (*PersistedGuild, error) {
+	guild := gm.guilds[gm.members[playerID]]
+	if guild == nil || guild.Members[playerID] == nil {
+		return nil, msg("guild.not_member")
+	}
+	if guildRankLevels[guild.Members[playerID].Rank] < guildRankLevels[minRank] {
+		return nil, msg("guild.rank_required", "rank", minRank)
+	}
+	return guild, nil
+}
+
+// removeMember drops a member and clears their membership record. Called with the lock held.
+func (gm *GuildManager) removeMember(ctx context.Context, gs *GameMatchState, guild *PersistedGuild, playerID, reason string, dispatcher runtime.MatchDispatcher) error {
+	updated, err := gm.updateGuild(ctx, guild.ID, func(guild *PersistedGuild) (map[string]string, error) {
+		delete(guild.Members, playerID)
+		return map[string]string{playerID: ""}, nil
+	})
+	if err != nil {
+		return gm.guildError(err, "guild.update_failed")
+	}
+	gm.guilds[updated.ID] = updated
+	if _, online := gm.members[playerID]; online {
+		delete(gm.members, playerID)
+		gm.send(gs, guildRemovedMessage, map[string]any{"guildId": updated.ID, "reason": reason}, []string{playerID}, dispatcher)
+	}
+	gm.logger.Info("Player %s %s guild [%s]", playerID, reason, updated.Tag)
+	gm.broadcastUpdate(gs, updated, dispatcher)
+	return nil
+}
+
+// disband deletes a guild and releases its online members. Called with the lock held.
+func (gm *GuildManager) disband(ctx context.Context, gs *GameMatchState, guild *PersistedGuild, dispatcher runtime.MatchDispatcher) error {
+	memberIDs := make([]string, 0, len(guild.Members))
+	for id := range guild.Members {
+		memberIDs = append(memberIDs, id)
+	}
+	if err := gm.db.DeleteGuild(ctx, guild.ID, memberIDs); err != nil {
+		return msg("guild.disband_failed")
+	}
+	online := gm.onlineMembers(guild)
+	for _, id := range online {
+		delete(gm.members, id)
+	}
+	delete(gm.guilds, guild.ID)
+	for id, invite := range gm.invites {
+		if invite.GuildID == guild.ID {
+			delete(gm.invites, id)
+		}
+	}
+	gm.send(gs, guildRemovedMessage, map[string]any{"guildId": guild.ID, "reason": "disbanded"}, online, dispatcher)
+	gm.logger.Info("Guild [%s] %s disbanded", guild.Tag, guild.Name)
+	return nil
+}
+
+// memberByName finds a member by username (case-insensitive) or player ID
+func (g *PersistedGuild) memberByName(name string) (string, *GuildMember) {
+	if member, ok := g.Members[name]; ok {
+		return name, member
+	}
+	for id, member := range g.Members {
+		if strings.EqualFold(member.Username, name) {
+			return id, member
+		}
+	}
+	return "", nil
+}
+
+// onlineMembers returns the IDs of the guild's members connected to this match
+func (gm *GuildManager) onlineMembers(guild *PersistedGuild) []string {
+	ids := make([]string, 0, len(guild.Members))
+	for id, guildID := range gm.members {
+		if guildID == guild.ID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// snapshot converts a guild for clients, members ordered by rank and name
+func (gm *GuildManager) snapshot(gs *GameMatchState, guild *PersistedGuild) GuildData {
+	members := make([]GuildMemberData, 0, len(guild.Members))
+	for id, member := range guild.Members {
+		_, online := gm.members[id]
+		members = append(members, GuildMemberData{PlayerID: id, Username: member.Username, Rank: member.Rank, Online: online})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Rank != members[j].Rank {
+			return guildRankLevels[members[i].Rank] > guildRankLevels[members[j].Rank]
+		}
+		return strings.ToLower(members[i].Username) < strings.ToLower(members[j].Username)
+	})
+	bank := make(map[string]int, len(guild.Bank))
+	for id, n := range guild.Bank {
+		bank[id] = n
+	}
+	return GuildData{ID: guild.ID, Tag: guild.Tag, Name: guild.Name, Members: members, Bank: bank}
+}
+
+// broadcastUpdate sends the guild to its online members. Called with the lock held.
+func (gm *GuildManager) broadcastUpdate(gs *GameMatchState, guild *PersistedGuild, dispatcher runtime.MatchDispatcher) {
+	gm.send(gs, guildUpdateMessage, gm.snapshot(gs, guild), gm.onlineMembers(guild), dispatcher)
+}
+
+// send delivers an OpCodeGuild message to the given online players
+func (gm *GuildManager) send(gs *GameMatchState, msgType string, payload any, playerIDs []string, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	presences := make([]runtime.Presence, 0, len(playerIDs))
+	for _, id := range playerIDs {
+		if presence, ok := gs.presences[id]; ok {
+			presences = append(presences, presence)
+		}
+	}
+	if len(presences) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeGuild, msgType, payload)
+	if err != nil {
+		gm.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeGuild, data, presences, nil, true)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Hazards are "hazard" objects, or any rectangle on an object layer named "hazards"
+const (
+	hazardObjectType = "hazard"
+	hazardLayerName  = "hazards"
+)
+
+// Hazard defaults. The object properties "damage", "damageType", "interval" and "effect" override
+// them per hazard.
+const (
+	defaultHazardInterval = 1.0 // seconds between two hits
+)
+
+// HazardZone is a rectangular map area (lava, poison swamp, freezing water) that hurts the
+// players and NPCs inside it every Interval ticks. Effect, if set, is applied to players too.
+type HazardZone struct {
+	Name       string
+	Min        vector.Vector
+	Max        vector.Vector
+	Damage     float64
+	DamageType string
+	Interval   int64 // ticks
+	Effect     string
+	Animation  *TileAnimation // hazard tiles: only live on the animation's damaging frames
+}
+
+// hazard is a hazard zone of the current map with its sensor body
+type hazard struct {
+	zone     *HazardZone
+	sensor   *rigidbody.RigidBody
+	nextTick int64
+	live     bool // hazard tiles: on a damaging frame at the last update
+}
+
+// HazardManager hurts the bodies standing in the hazards of the current map. It is only used
+// from the match loop.
+type HazardManager struct {
+	logger  runtime.Logger
+	hazards []*hazard
+}
+
+// NewHazardManager creates a hazard manager without hazards
+func NewHazardManager(logger runtime.Logger) *HazardManager {
+	return &HazardManager{logger: logger}
+}
+
+// LoadFromMap builds a sensor for every hazard zone of the current map
+func (hm *HazardManager) LoadFromMap(gs *GameMatchState) {
+	hm.hazards = nil
+	if gs.currentMap == nil {
+		return
+	}
+	for i := range gs.currentMap.Hazards {
+		zone := &gs.currentMap.Hazards[i]
+		w, h := zone.Max.X-zone.Min.X, zone.Max.Y-zone.Min.Y
+		hm.hazards = append(hm.hazards, &hazard{
+			zone:   zone,
+			sensor: MakeRectangleRigidBody(zone.Min.X+w/2, zone.Min.Y+h/2, w, h),
+		})
+	}
+	if len(hm.hazards) > 0 {
+		hm.logger.Info("Loaded %d hazards", len(hm.hazards))
+	}
+}
+
+// Update hits the players and NPCs whose bodies overlap a hazard that is due. Called from the
+// match loop after physics.
+func (hm *HazardManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	var due []*hazard
+	for _, hz := range hm.hazards {
+		if hz.zone.Animation != nil {
+			// A hazard tile's sensor is only on during its damaging frames, and hits as it turns on
+			if !hz.zone.Animation.DamagingAt(gs.currentTick) {
+				hz.live = false
+				continue
+			}
+			if !hz.live {
+				hz.live = true
+				hz.nextTick = gs.currentTick
+			}
+		}
+		if gs.currentTick >= hz.nextTick {
+			hz.nextTick = gs.currentTick + hz.zone.Interval
+			due = append(due, hz)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	gs.mu.Lock()
+	bodies := make([]*rigidbody.RigidBody, 0, len(gs.gameObjects))
+	for _, rb := range gs.gameObjects {
+		if rb.IsMovable && gs.physicsEngine.CollisionsEnabled(rb) {
+			bodies = append(bodies, rb)
+		}
+	}
+	gs.mu.Unlock()
+
+	players := make(map[*rigidbody.RigidBody]string, gs.entities.PlayerCount())
+	for playerID, rb := range gs.PlayerBodies() {
+		players[rb] = playerID
+	}
+	npcs := gs.npcManager.BodyOwners()
+
+	for _, hz := range due {
+		source := DamageSource{Type: DamageSourceEnvironment, ID: hz.zone.Name}
+		for _, rb := range gs.physicsEngine.QueryOverlap(hz.sensor, bodies) {
+			if playerID, ok := players[rb]; ok {
+				if gs.GetPlayerState(playerID).IsDead() {
+					continue
+				}
+				if hz.zone.Damage > 0 {
+					gs.damagePlayer(playerID, source, hz.zone.Damage, hz.zone.DamageType, 0, dispatcher, logger)
+				}
+				if hz.zone.Effect != "" {
+					gs.ApplyEffect(playerID, hz.zone.Effect, source, 0)
+				}
+				continue
+			}
+			if id, ok := npcs[rb]; ok && hz.zone.Damage > 0 {
+				gs.npcManager.Damage(gs, id, source, hz.zone.Damage, hz.zone.DamageType, dispatcher)
+			}
+		}
+	}
+}
+
+// parseHazard reads a hazard zone from a map object. It returns false for hazards that would do
+// nothing.
+func (ml *MapLoader) parseHazard(obj *TiledObject) (HazardZone, bool) {
+	zone := HazardZone{
+		Name:       obj.Name,
+		Min:        vector.Vector{X: obj.X, Y: obj.Y},
+		Max:        vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+		DamageType: DamagePhysical,
+		Interval:   int64(defaultHazardInterval * TickRate),
+	}
+	if zone.Name == "" {
+		zone.Name = hazardObjectType
+	}
+	for _, p := range obj.Properties {
+		switch strings.ToLower(p.Name) {
+		case "damage":
+			if v, ok := p.Value.(float64); ok && v > 0 {
+				zone.Damage = v
+			}
+		case "damagetype":
+			if v, ok := p.Value.(string); ok && v != "" {
+				zone.DamageType = strings.ToLower(v)
+			}
+		case "interval":
+			if v, ok := p.Value.(float64); ok && v > 0 {
+				zone.Interval = int64(v * TickRate)
+			}
+		case "effect":
+			zone.Effect, _ = p.Value.(string)
+		}
+	}
+	switch zone.DamageType {
+	case DamagePhysical, DamageFire, DamageFrost, DamagePoison, DamageTrue:
+	default:
+		ml.logger.Warn("Hazard %q (id %d) has unknown damageType %q; using physical", obj.Name, obj.ID, zone.DamageType)
+		zone.DamageType = DamagePhysical
+	}
+	if zone.Interval < 1 {
+		zone.Interval = 1
+	}
+	if zone.Damage <= 0 && zone.Effect == "" {
+		ml.logger.Warn("Hazard %q (id %d) has neither damage nor effect; skipping", obj.Name, obj.ID)
+		return zone, false
+	}
+	return zone, true
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Damage types. Physical damage is reduced by armor, the elemental types by resistances.
+const (
+	DamagePhysical = "physical"
+	DamageFire     = "fire"
+	DamageFrost    = "frost"
+	DamagePoison   = "poison"
+	DamageTrue     = "true" // ignores armor and resistances
+	DamageFall     = "fall" // dropping down a cliff (elevation.go)
+)
+
+// Damage source types
+const (
+	DamageSourcePlayer      = "player"
+	DamageSourceNPC         = "npc"
+	DamageSourceEnvironment = "environment"
+	DamageSourceScript      = "script"
+)
+
+// Damage tuning
+const (
+	playerInvulnerabilityTicks = TickRate / 2 // players ignore damage for this long after being hit
+	maxResistance              = 0.9          // resistances are capped so nothing becomes immune by stacking
+	damageEventRange           = 640.0        // damage events are relayed to players within this distance
+)
+
+// HealthComponent is the health pool of a player or NPC
+type HealthComponent struct {
+	Health            float64
+	MaxHealth         float64
+	Armor             float64            // physical damage is scaled by 100 / (100 + armor)
+	Resistances       map[string]float64 // damage type -> fraction of that damage absorbed (0..maxResistance)
+	InvulnerableUntil int64              // damage is ignored before this tick
+	LastDamage        *DamageSource      // source of the last hit that landed; credited with the kill
+	Shield            float64            // absorbs damage after mitigation, before health (shield effects)
+}
+
+// DamageSource identifies who or what dealt damage
+type DamageSource struct {
+	Type string `json:"type"`         // DamageSource*
+	ID   string `json:"id,omitempty"` // player ID or NPC ID, depending on Type
+}
+
+// DamageEvent is relayed to nearby players whenever a player or NPC takes damage (OpCodeDamage)
+type DamageEvent struct {
+	TargetType string       `json:"targetType"` // "player" or "npc"
+	TargetID   string       `json:"targetId"`
+	Source     DamageSource `json:"source"`
+	DamageType string       `json:"damageType"`
+	Amount     float64      `json:"amount"` // after the damage pipeline
+	Health     float64      `json:"health"`
+	MaxHealth  float64      `json:"maxHealth"`
+	Killed     bool         `json:"killed,omitempty"` // this hit brought the target to zero
+	X          float64      `json:"x"`
+	Y          float64      `json:"y"`
+	Breakdown  []DamageStep `json:"breakdown,omitempty"` // the damage after each pipeline stage
+}
+
+// applyDamage takes a hit through the damage pipeline (armor plus the hit's bonus armor,
+// resistances, effects, the shield and script modifiers) and subtracts the result from health.
+// Hits that start i-frames (invulnerabilityTicks > 0) are ignored while the target is still
+// invulnerable; periodic damage (0) neither starts nor respects them. It returns the damage
+// actually taken.
+func (h *HealthComponent) applyDamage(gs *GameMatchState, hit *DamageHit, invulnerabilityTicks int64) float64 {
+	tick := gs.currentTick
+	if hit.Amount <= 0 || h.Health <= 0 || (invulnerabilityTicks > 0 && tick < h.InvulnerableUntil) {
+		return 0
+	}
+	hit.target = h
+	amount := gs.damagePipeline.Run(gs, hit)
+	if amount <= 0 {
+		return 0
+	}
+	h.Health -= amount
+	source := hit.Source
+	h.LastDamage = &source
+	if invulnerabilityTicks > 0 {
+		h.InvulnerableUntil = tick + invulnerabilityTicks
+	}
+	return amount
+}
+
+// SetResistance sets the fraction of a damage type the component absorbs
+func (h *HealthComponent) SetResistance(damageType string, fraction float64) {
+	if h.Resistances == nil {
+		h.Resistances = make(map[string]float64)
+	}
+	h.Resistances[damageType] = max(0, min(fraction, maxResistance))
+}
+
+// DamagePlayer deals damage to a player after the damage pipeline (armor including "armor" buffs,
+// resistances, effects, shields) and i-frames, and relays a damage event to nearby players. Damage from another player is dropped
+// unless the PvP rules allow it, and all damage while the player is under spawn protection. Reaching zero health is handled as a
+// death by UpdatePlayerStates. It returns the damage actually taken.
+func (gs *GameMatchState) DamagePlayer(playerID string, source DamageSource, amount float64, damageType string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) float64 {
+	return gs.damagePlayer(playerID, source, amount, damageType, playerInvulnerabilityTicks, dispatcher, logger)
+}
+
+// damagePlayer is DamagePlayer with the i-frames to start; periodic damage (e.g. poison) passes 0
+func (gs *GameMatchState) damagePlayer(playerID string, source DamageSource, amount float64, damageType string, invulnerabilityTicks int64, dispatcher runtime.MatchDispatcher, logger runtime.Logger) float64 {
+	event, ok := gs.hurtPlayer(playerID, source, amount, damageType, invulnerabilityTicks)
+	if !ok {
+		return 0
+	}
+	gs.broadcastDamage(event, vector.Vector{X: event.X, Y: event.Y}, dispatcher, logger)
+	return event.Amount
+}
+
+// hurtPlayer applies damage to a player under the PvP rules without relaying it. It returns the
+// damage event, and false when no damage was taken.
+func (gs *GameMatchState) hurtPlayer(playerID string, source DamageSource, amount float64, damageType string, invulnerabilityTicks int64) (DamageEvent, bool) {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return DamageEvent{}, false
+	}
+	pvp := source.Type == DamageSourcePlayer && source.ID != playerID
+	if pvp && !gs.CanDamagePlayer(source.ID, playerID) {
+		return DamageEvent{}, false
+	}
+	state := gs.GetPlayerState(playerID)
+	if state.GodMode || state.spawnProtected(gs.currentTick) {
+		return DamageEvent{}, false
+	}
+	hit := &DamageHit{Source: source, TargetType: "player", TargetID: playerID, DamageType: damageType, Amount: amount, bonusArmor: state.BuffAmount("armor", gs.currentTick)}
+	dealt := state.applyDamage(gs, hit, invulnerabilityTicks)
+	if dealt <= 0 {
+		return DamageEvent{}, false
+	}
+	state.statusDirty = true
+	// Fighting gives hidden players away
+	if source.Type == DamageSourcePlayer || source.Type == DamageSourceNPC {
+		gs.RevealStealth(playerID)
+		if attacker := gs.npcManager.creditedPlayer(source); attacker != "" {
+			gs.RevealStealth(attacker)
+			gs.EndSpawnProtection(attacker, "attacked")
+		}
+	}
+	if pvp && gs.duels.DuelOf(source.ID) != nil {
+		// Duel hits never kill; low health decides the duel instead
+		gs.duels.onDamage(source.ID, state)
+	} else if pvp {
+		gs.markPvPCombat(source.ID, playerID)
+	}
+
+	return DamageEvent{
+		TargetType: "player",
+		TargetID:   playerID,
+		Source:     source,
+		DamageType: damageType,
+		Amount:     dealt,
+		Health:     state.Health,
+		MaxHealth:  state.MaxHealth,
+		Killed:     state.IsDead(),
+		X:          rb.Position.X,
+		Y:          rb.Position.Y,
+		Breakdown:  hit.Breakdown,
+	}, true
+}
+
+// broadcastDamage relays a damage event to the players within damageEventRange of position
+func (gs *GameMatchState) broadcastDamage(event DamageEvent, position vector.Vector, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if dispatcher == nil {
+		return
+	}
+	recipients := gs.PresencesInRange(position, damageEventRange)
+	if len(recipients) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeDamage, "damage", event)
+	if err != nil {
+		logger.Error("Failed to marshal damage event for %s %s: %v", event.TargetType, event.TargetID, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeDamage, data, recipients, nil, true)
+}
+
+// npcDamageSource returns the damage source for an NPC
+func npcDamageSource(id int) DamageSource {
+	return DamageSource{Type: DamageSourceNPC, ID: strconv.Itoa(id)}
+}
+
+// scriptDamageSource attributes script damage to a player when one is given
+func scriptDamageSource(playerID string) DamageSource {
+	if playerID == "" {
+		return DamageSource{Type: DamageSourceScript}
+	}
+	return DamageSource{Type: DamageSourcePlayer, ID: playerID}
+}
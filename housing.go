@@ -0,0 +1,645 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Plot access modes: who besides the owner and their builders may use the furniture on a plot
+const (
+	PlotAccessOwner    = "owner"    // nobody else
+	PlotAccessGuild    = "guild"    // members of the owner's guild
+	PlotAccessEveryone = "everyone" // every visitor
+)
+
+// Housing tuning
+const (
+	plotObjectType          = "plot" // map object type of claimable plots
+	defaultPlotMaxFurniture = 40
+	plotMaxBuilders         = 10 // players besides the owner allowed to build on a plot
+	plotsPerPlayer          = 1  // plots a player may own per map
+)
+
+// PlotArea is a claimable rectangular map area ("plot" objects). The "deed" property names an
+// item consumed when claiming; "maxFurniture" caps the objects placed inside.
+type PlotArea struct {
+	ID           int
+	Name         string
+	Min          vector.Vector
+	Max          vector.Vector
+	Deed         string
+	MaxFurniture int
+}
+
+// Contains reports whether a point lies inside the plot
+func (a *PlotArea) Contains(p vector.Vector) bool {
+	return p.X >= a.Min.X && p.X <= a.Max.X && p.Y >= a.Min.Y && p.Y <= a.Max.Y
+}
+
+// Encloses reports whether a footprint centered on p lies entirely inside the plot
+func (a *PlotArea) Encloses(p vector.Vector, width, height float64) bool {
+	return p.X-width/2 >= a.Min.X && p.X+width/2 <= a.Max.X && p.Y-height/2 >= a.Min.Y && p.Y+height/2 <= a.Max.Y
+}
+
+// Overlaps reports whether a footprint centered on p touches the plot
+func (a *PlotArea) Overlaps(p vector.Vector, width, height float64) bool {
+	return p.X+width/2 > a.Min.X && p.X-width/2 < a.Max.X && p.Y+height/2 > a.Min.Y && p.Y-height/2 < a.Max.Y
+}
+
+// PlacedFurniture is a buildable placed on a plot
+type PlacedFurniture struct {
+	ObjectID  int
+	Buildable string
+	Position  vector.Vector
+	PlacedBy  string
+	Ownership *EntityOwnership
+}
+
+// HousingPlot is a plot and its claim
+type HousingPlot struct {
+	Area       *PlotArea
+	Owner      string
+	OwnerName  string
+	OwnerGuild string // owner's guild when the plot was claimed or its access last changed
+	Access     string
+	Builders   []string
+	ClaimedAt  time.Time
+	Furniture  []*PlacedFurniture
+	version    string // storage version of the plot's record ("*" while it has none), which saves must match
+}
+
+// PlotData is a plot as sent to clients (world_state "plots" and OpCodeHousing "plot_update")
+type PlotData struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+	Owner     string  `json:"owner,omitempty"`
+	OwnerName string  `json:"ownerName,omitempty"`
+	Access    string  `json:"access,omitempty"`
+	Furniture int     `json:"furniture"`
+	Max       int     `json:"maxFurniture"`
+}
+
+// HousingManager tracks the map's plots, their owners and the furniture placed on them. Every
+// change is written through to storage so plots survive match restarts, at the version the plot
+// was read at: when another shard of the map changed the plot first, the write fails and the
+// plot is reloaded from storage instead.
+type HousingManager struct {
+	logger    runtime.Logger
+	plots     map[int]*HousingPlot // plot ID -> plot
+	furniture map[int]int          // furniture object ID -> plot ID
+	mu        sync.Mutex
+}
+
+// NewHousingManager creates an empty housing manager
+func NewHousingManager(logger runtime.Logger) *HousingManager {
+	return &HousingManager{
+		logger:    logger,
+		plots:     make(map[int]*HousingPlot),
+		furniture: make(map[int]int),
+	}
+}
+
+// LoadFromMap registers the plots of the current map
+func (hm *HousingManager) LoadFromMap(gs *GameMatchState) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.plots = make(map[int]*HousingPlot)
+	hm.furniture = make(map[int]int)
+	if gs.currentMap == nil {
+		return
+	}
+	for i := range gs.currentMap.Plots {
+		area := &gs.currentMap.Plots[i]
+		hm.plots[area.ID] = &HousingPlot{Area: area, version: "*"}
+	}
+	hm.logger.Info("Registered %d housing plots", len(hm.plots))
+}
+
+// Restore reapplies the saved claims and respawns the saved furniture
+func (hm *HousingManager) Restore(ctx context.Context, gs *GameMatchState) error {
+	hm.mu.Lock()
+	ids := make([]int, 0, len(hm.plots))
+	for id := range hm.plots {
+		ids = append(ids, id)
+	}
+	hm.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	saved, err := gs.databaseManager.LoadPlots(ctx, gs.currentMapName, ids)
+	if err != nil {
+		return err
+	}
+
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	furniture := 0
+	for id, record := range saved {
+		if plot := hm.plots[id]; plot != nil {
+			furniture += hm.apply(gs, plot, record, nil)
+		}
+	}
+	hm.logger.Info("Restored %d claimed plots with %d furniture objects", len(saved), furniture)
+	return nil
+}
+
+// apply takes over a plot's saved record: its claim and version, and its furniture, spawned. It
+// returns the furniture objects spawned. Called with the lock held.
+func (hm *HousingManager) apply(gs *GameMatchState, plot *HousingPlot, record *PersistedPlot, dispatcher runtime.MatchDispatcher) int {
+	id := plot.Area.ID
+	plot.version = record.version
+	if record.Owner == "" {
+		return 0
+	}
+	plot.Owner = record.Owner
+	plot.OwnerName = record.OwnerName
+	plot.OwnerGuild = record.OwnerGuild
+	plot.Access = record.Access
+	plot.Builders = record.Builders
+	plot.ClaimedAt = record.ClaimedAt
+	for _, f := range record.Furniture {
+		def, ok := gs.buildableCatalog.Get(f.Buildable)
+		if !ok {
+			hm.logger.Warn("Dropping furniture %s on plot %d: unknown buildable", f.Buildable, id)
+			continue
+		}
+		placed := &PlacedFurniture{Buildable: f.Buildable, Position: vector.Vector{X: f.X, Y: f.Y}, PlacedBy: f.PlacedBy, Ownership: f.Ownership}
+		// Furniture saved before ownership existed gets the buildable's current permissions
+		if placed.Ownership == nil {
+			placed.Ownership = &EntityOwnership{Owner: f.PlacedBy, Permissions: def.Permissions}
+		}
+		placed.ObjectID = gs.spawnBuilding(def, placed.Position, placed.Ownership, id, dispatcher, hm.logger)
+		plot.Furniture = append(plot.Furniture, placed)
+		hm.furniture[placed.ObjectID] = id
+	}
+	return len(plot.Furniture)
+}
+
+// save writes a plot at the version it was read at and takes the new version. Called with the
+// lock held.
+func (hm *HousingManager) save(ctx context.Context, gs *GameMatchState, plot *HousingPlot) error {
+	version, err := gs.databaseManager.SavePlot(ctx, plot.persisted(gs.currentMapName), plot.version)
+	if err != nil {
+		return err
+	}
+	plot.version = version
+	return nil
+}
+
+// refresh reloads a plot whose write failed, e.g. because another shard of the map claimed or
+// changed it first: the furniture spawned here is removed and the saved claim and furniture
+// take its place. Called with the lock held.
+func (hm *HousingManager) refresh(ctx context.Context, gs *GameMatchState, plot *HousingPlot, dispatcher runtime.MatchDispatcher) {
+	saved, err := gs.databaseManager.LoadPlots(ctx, gs.currentMapName, []int{plot.Area.ID})
+	if err != nil {
+		hm.logger.Warn("Failed to reload plot %d: %v", plot.Area.ID, err)
+		return
+	}
+	for _, f := range plot.Furniture {
+		delete(hm.furniture, f.ObjectID)
+		gs.RemoveObject(f.ObjectID, dispatcher, hm.logger)
+	}
+	*plot = HousingPlot{Area: plot.Area, version: "*"}
+	if record := saved[plot.Area.ID]; record != nil {
+		hm.apply(gs, plot, record, dispatcher)
+	}
+	hm.broadcast(gs, plot, dispatcher)
+}
+
+// PlotAt returns the ID of the plot containing a point (0 when outside plots)
+func (hm *HousingManager) PlotAt(p vector.Vector) int {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	for id, plot := range hm.plots {
+		if plot.Area.Contains(p) {
+			return id
+		}
+	}
+	return 0
+}
+
+// Claim makes the player the owner of a free plot they stand in, taking its deed item. It
+// returns a rejection reason, or "".
+func (hm *HousingManager) Claim(ctx context.Context, gs *GameMatchState, playerID string, plotID int, dispatcher runtime.MatchDispatcher) string {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	plot := hm.plots[plotID]
+	if plot == nil {
+		return RejectInvalidTarget
+	}
+	if !plot.Area.Contains(rb.Position) {
+		return RejectOutOfRange
+	}
+	if plot.Owner != "" {
+		return RejectPlotClaimed
+	}
+	owned := 0
+	for _, other := range hm.plots {
+		if other.Owner == playerID {
+			owned++
+		}
+	}
+	if owned >= plotsPerPlayer {
+		return RejectPlotLimit
+	}
+
+	if plot.Area.Deed != "" {
+		if err := gs.inventoryManager.Remove(ctx, playerID, plot.Area.Deed, 1); err != nil {
+			if err == errNotEnoughItems {
+				return RejectMissingMaterials
+			}
+			return RejectStorageError
+		}
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	}
+
+	plot.Owner = playerID
+	plot.OwnerName = gs.usernameOf(playerID)
+	plot.OwnerGuild = gs.guilds.GuildOf(playerID)
+	plot.Access = PlotAccessOwner
+	plot.Builders = nil
+	plot.ClaimedAt = time.Now().UTC()
+	if err := hm.save(ctx, gs, plot); err != nil {
+		*plot = HousingPlot{Area: plot.Area, version: plot.version}
+		if plot.Area.Deed != "" {
+			if rerr := gs.inventoryManager.Add(ctx, playerID, plot.Area.Deed, 1); rerr != nil {
+				hm.logger.Error("Failed to return deed %s to %s after a failed claim: %v", plot.Area.Deed, playerID, rerr)
+			}
+			gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+		}
+		// Another shard of the map may have claimed the plot first
+		hm.refresh(ctx, gs, plot, dispatcher)
+		if plot.Owner != "" {
+			return RejectPlotClaimed
+		}
+		return RejectStorageError
+	}
+	hm.logger.Info("Player %s claimed plot %d (%s)", playerID, plotID, plot.Area.Name)
+	hm.broadcast(gs, plot, dispatcher)
+	return ""
+}
+
+// Release gives up the player's claim on a plot. The furniture is removed and its building
+// materials returned to whoever placed it; the deed is not returned.
+func (hm *HousingManager) Release(ctx context.Context, gs *GameMatchState, playerID string, plotID int, dispatcher runtime.MatchDispatcher) string {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	plot := hm.plots[plotID]
+	if plot == nil {
+		return RejectInvalidTarget
+	}
+	if plot.Owner != playerID {
+		return RejectNotOwned
+	}
+	if err := gs.databaseManager.DeletePlot(ctx, gs.currentMapName, plotID, plot.version); err != nil {
+		hm.refresh(ctx, gs, plot, dispatcher)
+		return RejectStorageError
+	}
+	for _, f := range plot.Furniture {
+		delete(hm.furniture, f.ObjectID)
+		gs.RemoveObject(f.ObjectID, dispatcher, hm.logger)
+		hm.refund(ctx, gs, f, dispatcher)
+	}
+	hm.logger.Info("Player %s released plot %d (%s)", playerID, plotID, plot.Area.Name)
+	*plot = HousingPlot{Area: plot.Area, version: "*"}
+	hm.broadcast(gs, plot, dispatcher)
+	return ""
+}
+
+// CheckPlacement decides whether the player may place a footprint at position with respect to
+// plots. It returns the plot the footprint lies in (0 outside plots) and a rejection reason.
+// Footprints must lie entirely inside or entirely outside a plot; inside, only the owner, their
+// builders and GMs may build, up to the plot's furniture limit.
+func (hm *HousingManager) CheckPlacement(gs *GameMatchState, playerID string, position vector.Vector, width, height float64) (int, string) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	for id, plot := range hm.plots {
+		if !plot.Area.Overlaps(position, width, height) {
+			continue
+		}
+		if !plot.Area.Encloses(position, width, height) {
+			return id, RejectOutsidePlot
+		}
+		if !plot.canBuild(gs, playerID) {
+			return id, RejectPermissionDenied
+		}
+		if len(plot.Furniture) >= plot.Area.MaxFurniture {
+			return id, RejectPlotFull
+		}
+		return id, ""
+	}
+	return 0, ""
+}
+
+// AddFurniture records a building placed on a plot and saves the plot
+func (hm *HousingManager) AddFurniture(ctx context.Context, gs *GameMatchState, plotID, objectID int, buildableID string, position vector.Vector, playerID string, dispatcher runtime.MatchDispatcher) error {
+	ownership := gs.ObjectOwnership(objectID)
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	plot := hm.plots[plotID]
+	if plot == nil {
+		return msg("plot.unknown", "plot", plotID)
+	}
+	placed := &PlacedFurniture{ObjectID: objectID, Buildable: buildableID, Position: position, PlacedBy: playerID, Ownership: ownership}
+	plot.Furniture = append(plot.Furniture, placed)
+	if err := hm.save(ctx, gs, plot); err != nil {
+		plot.Furniture = plot.Furniture[:len(plot.Furniture)-1]
+		hm.refresh(ctx, gs, plot, dispatcher)
+		return err
+	}
+	hm.furniture[objectID] = plotID
+	return nil
+}
+
+// RemoveFurniture takes a building off a plot and returns its materials to whoever placed it.
+// The plot owner and GMs may remove any furniture, builders what its permissions let them
+// remove. It returns a rejection reason, or "".
+func (hm *HousingManager) RemoveFurniture(ctx context.Context, gs *GameMatchState, playerID string, objectID int, dispatcher runtime.MatchDispatcher) string {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	plot := hm.plots[hm.furniture[objectID]]
+	if plot == nil {
+		return RejectInvalidTarget
+	}
+	index := -1
+	for i, f := range plot.Furniture {
+		if f.ObjectID == objectID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return RejectInvalidTarget
+	}
+	placed := plot.Furniture[index]
+	if !plot.canBuild(gs, playerID) || (plot.Owner != playerID && !gs.CanAffectObject(playerID, objectID, EntityRemove)) {
+		return RejectPermissionDenied
+	}
+	if placed.Position.Sub(rb.Position).Magnitude() > placeRange {
+		return RejectOutOfRange
+	}
+
+	remaining := make([]*PlacedFurniture, 0, len(plot.Furniture)-1)
+	remaining = append(remaining, plot.Furniture[:index]...)
+	remaining = append(remaining, plot.Furniture[index+1:]...)
+	previous := plot.Furniture
+	plot.Furniture = remaining
+	if err := hm.save(ctx, gs, plot); err != nil {
+		plot.Furniture = previous
+		hm.refresh(ctx, gs, plot, dispatcher)
+		return RejectStorageError
+	}
+	delete(hm.furniture, objectID)
+	gs.RemoveObject(objectID, dispatcher, hm.logger)
+	hm.refund(ctx, gs, placed, dispatcher)
+	return ""
+}
+
+// IsFurniture reports whether an object is furniture on a plot
+func (hm *HousingManager) IsFurniture(objectID int) bool {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	_, ok := hm.furniture[objectID]
+	return ok
+}
+
+// CanUse reports whether a player may interact with an object. Objects that aren't furniture
+// are always allowed; furniture follows its plot's access mode.
+func (hm *HousingManager) CanUse(gs *GameMatchState, playerID string, objectID int) bool {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	plotID, ok := hm.furniture[objectID]
+	if !ok {
+		return true
+	}
+	plot := hm.plots[plotID]
+	if plot == nil || plot.canBuild(gs, playerID) {
+		return true
+	}
+	switch plot.Access {
+	case PlotAccessEveryone:
+		return true
+	case PlotAccessGuild:
+		return plot.OwnerGuild != "" && gs.guilds.GuildOf(playerID) == plot.OwnerGuild
+	default:
+		return false
+	}
+}
+
+// SetAccess changes who may use the furniture on the player's plot
+func (hm *HousingManager) SetAccess(ctx context.Context, gs *GameMatchState, playerID, access string, dispatcher runtime.MatchDispatcher) error {
+	switch access {
+	case PlotAccessOwner, PlotAccessGuild, PlotAccessEveryone:
+	default:
+		return msg("plot.bad_access")
+	}
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	plot := hm.ownedPlot(playerID)
+	if plot == nil {
+		return msg("plot.not_owner")
+	}
+	previous := *plot
+	plot.Access = access
+	plot.OwnerGuild = gs.guilds.GuildOf(playerID)
+	if err := hm.save(ctx, gs, plot); err != nil {
+		*plot = previous
+		hm.refresh(ctx, gs, plot, dispatcher)
+		return msg("plot.update_failed")
+	}
+	hm.broadcast(gs, plot, dispatcher)
+	return nil
+}
+
+// SetBuilder allows or stops another player building on the player's plot
+func (hm *HousingManager) SetBuilder(ctx context.Context, gs *GameMatchState, playerID, builderID string, allowed bool, dispatcher runtime.MatchDispatcher) error {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	plot := hm.ownedPlot(playerID)
+	if plot == nil {
+		return msg("plot.not_owner")
+	}
+	if builderID == playerID {
+		return msg("plot.own_builder")
+	}
+	builders := make([]string, 0, len(plot.Builders)+1)
+	for _, id := range plot.Builders {
+		if id != builderID {
+			builders = append(builders, id)
+		}
+	}
+	if allowed {
+		if len(builders) >= plotMaxBuilders {
+			return msg("plot.max_builders", "max", plotMaxBuilders)
+		}
+		builders = append(builders, builderID)
+	}
+	previous := plot.Builders
+	plot.Builders = builders
+	if err := hm.save(ctx, gs, plot); err != nil {
+		plot.Builders = previous
+		hm.refresh(ctx, gs, plot, dispatcher)
+		return msg("plot.update_failed")
+	}
+	return nil
+}
+
+// Describe returns a one-line summary of a plot for chat commands
+func (hm *HousingManager) Describe(plotID int) (*LocalizedText, bool) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	plot := hm.plots[plotID]
+	if plot == nil {
+		return nil, false
+	}
+	if plot.Owner == "" {
+		if plot.Area.Deed != "" {
+			return msg("plot.free_deed", "plot", plotID, "name", plot.Area.Name, "deed", plot.Area.Deed), true
+		}
+		return msg("plot.free", "plot", plotID, "name", plot.Area.Name), true
+	}
+	return msg("plot.owned", "plot", plotID, "name", plot.Area.Name, "owner", plot.OwnerName, "access", plot.Access,
+		"furniture", len(plot.Furniture), "maxFurniture", plot.Area.MaxFurniture, "builders", len(plot.Builders)), true
+}
+
+// Snapshot returns the plots for clients, ordered by ID
+func (hm *HousingManager) Snapshot() []PlotData {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	plots := make([]PlotData, 0, len(hm.plots))
+	for _, plot := range hm.plots {
+		plots = append(plots, plot.data())
+	}
+	sort.Slice(plots, func(i, j int) bool { return plots[i].ID < plots[j].ID })
+	return plots
+}
+
+// ownedPlot returns the plot the player owns on this map. Called with the lock held.
+func (hm *HousingManager) ownedPlot(playerID string) *HousingPlot {
+	for _, plot := range hm.plots {
+		if plot.Owner == playerID {
+			return plot
+		}
+	}
+	return nil
+}
+
+// refund returns a piece of furniture's building materials to the player who placed it
+func (hm *HousingManager) refund(ctx context.Context, gs *GameMatchState, placed *PlacedFurniture, dispatcher runtime.MatchDispatcher) {
+	def, ok := gs.buildableCatalog.Get(placed.Buildable)
+	if !ok || len(def.Cost) == 0 {
+		return
+	}
+	for itemID, count := range def.Cost {
+		if err := gs.inventoryManager.Add(ctx, placed.PlacedBy, itemID, count); err != nil {
+			hm.logger.Error("Failed to refund %d x %s to %s: %v", count, itemID, placed.PlacedBy, err)
+		}
+	}
+	if _, online := gs.presences[placed.PlacedBy]; online {
+		gs.inventoryManager.SyncToClient(ctx, gs, placed.PlacedBy, dispatcher)
+	}
+}
+
+// broadcast sends a plot's claim to every player
+func (hm *HousingManager) broadcast(gs *GameMatchState, plot *HousingPlot, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeHousing, "plot_update", plot.data())
+	if err != nil {
+		hm.logger.Error("Failed to marshal plot %d: %v", plot.Area.ID, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeHousing, data, nil, nil, true)
+}
+
+// canBuild reports whether the player may place and remove furniture on the plot
+func (p *HousingPlot) canBuild(gs *GameMatchState, playerID string) bool {
+	if p.Owner == "" {
+		return false
+	}
+	if p.Owner == playerID || roleAllows(gs.GetPlayerState(playerID).Role, RoleGM) {
+		return true
+	}
+	for _, id := range p.Builders {
+		if id == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+// data converts the plot for clients
+func (p *HousingPlot) data() PlotData {
+	return PlotData{
+		ID:        p.Area.ID,
+		Name:      p.Area.Name,
+		X:         p.Area.Min.X,
+		Y:         p.Area.Min.Y,
+		Width:     p.Area.Max.X - p.Area.Min.X,
+		Height:    p.Area.Max.Y - p.Area.Min.Y,
+		Owner:     p.Owner,
+		OwnerName: p.OwnerName,
+		Access:    p.Access,
+		Furniture: len(p.Furniture),
+		Max:       p.Area.MaxFurniture,
+	}
+}
+
+// persisted converts the plot for storage
+func (p *HousingPlot) persisted(mapName string) *PersistedPlot {
+	record := &PersistedPlot{
+		Map:        mapName,
+		PlotID:     p.Area.ID,
+		Owner:      p.Owner,
+		OwnerName:  p.OwnerName,
+		OwnerGuild: p.OwnerGuild,
+		Access:     p.Access,
+		Builders:   append([]string(nil), p.Builders...),
+		ClaimedAt:  p.ClaimedAt,
+		Furniture:  make([]PersistedFurniture, 0, len(p.Furniture)),
+	}
+	for _, f := range p.Furniture {
+		record.Furniture = append(record.Furniture, PersistedFurniture{Buildable: f.Buildable, X: f.Position.X, Y: f.Position.Y, PlacedBy: f.PlacedBy, Ownership: f.Ownership})
+	}
+	return record
+}
+
+// spawnBuilding creates the world object of a placed buildable
+func (gs *GameMatchState) spawnBuilding(def *BuildableDefinition, position vector.Vector, ownership *EntityOwnership, plotID int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) int {
+	props := map[string]interface{}{
+		"x":         position.X,
+		"y":         position.Y,
+		"width":     def.Width,
+		"height":    def.Height,
+		"owner":     ownership.Owner,
+		"buildable": def.ID,
+	}
+	if def.Script != "" {
+		props["script"] = def.Script
+	}
+	if plotID != 0 {
+		props["plot"] = plotID
+	}
+	return gs.SpawnObject(&ObjectData{Name: def.Name, Type: buildingObjectType, GID: def.GID, Props: props, Ownership: ownership}, dispatcher, logger)
+}
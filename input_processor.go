@@ -1,30 +1,266 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"math"
+
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/rudransh61/Physix-go/pkg/rigidbody"
 	"github.com/rudransh61/Physix-go/pkg/vector"
 )
 
-type InputProcessor struct{}
+// defaultInteractRange is how far (in pixels, edge of the player body to object center)
+// a player can reach objects that don't set an "interactRange" property
+const defaultInteractRange = 48.0
+
+type InputProcessor struct {
+	config *GameConfig // player body and dash tuning (game_config.go)
+}
 
 // NewInputProcessor creates a new input processor instance
 func NewInputProcessor() *InputProcessor {
-	return &InputProcessor{}
+	return &InputProcessor{config: DefaultGameConfig()}
 }
 
-// ProcessPlayerInput handles different types of player actions
-func (ip *InputProcessor) ProcessPlayerInput(gameState *GameMatchState, input *PlayerInput, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+// Configure sets the game config the player bodies and dashes are made with
+func (ip *InputProcessor) Configure(config *GameConfig) {
+	ip.config = config
+}
+
+// ProcessPlayerInput handles different types of player actions and returns the ACK to send
+// back to the player once the physics step has run. Handlers may reject the input or attach
+// extra data to the ACK.
+func (ip *InputProcessor) ProcessPlayerInput(ctx context.Context, gameState *GameMatchState, input *PlayerInput, dispatcher runtime.MatchDispatcher, logger runtime.Logger) *InputACK {
+	ack := &InputACK{
+		PlayerID:      input.PlayerID,
+		ObjectID:      input.ObjectID,
+		Action:        input.Action,
+		InputSequence: input.InputSequence,
+		Approved:      true, // Assume approved unless a handler rejects it
+		Timestamp:     gameState.currentTick,
+	}
+
+	var state *PlayerState
+	if playerObject := gameState.PlayerBody(input.PlayerID); playerObject != nil {
+		state = gameState.GetPlayerState(input.PlayerID)
+
+		// Flood protection: count inputs per tick
+		if state.inputTick != gameState.currentTick {
+			state.inputTick = gameState.currentTick
+			state.inputsThisTick = 0
+		}
+		state.inputsThisTick++
+		if state.inputsThisTick > maxInputsPerTick {
+			ack.Reject(RejectRateLimited)
+			return ack
+		}
+
+		// Per-action limits (see actionLimits)
+		if reason := state.checkActionLimit(input.Action, gameState.currentTick, playerObject.Velocity.Magnitude() > 0); reason != "" {
+			ack.Reject(reason)
+			return ack
+		}
+
+		// A cutscene that locks input leaves the player only able to respawn
+		if state.inputLocked() && input.Action != "respawn" {
+			ack.Reject(RejectInCutscene)
+			return ack
+		}
+
+		// Any input may carry the aim direction, so facing stays correct while standing still
+		if input.Facing != nil {
+			state.SetFacing(*input.Facing)
+		}
+	}
+
 	switch input.Action {
 	case "spawn":
 		ip.handleSpawn(gameState, input, logger)
 	case "move":
-		ip.handleMovement(gameState, input, logger)
+		ip.handleMovement(gameState, input, ack, logger)
+	case "respawn":
+		if reason := gameState.Respawn(input.PlayerID, ack, dispatcher, logger); reason != "" {
+			ack.Reject(reason)
+		}
+	case "aim":
+		// Facing was already applied above; the action only exists to send aim without moving
+	case "dash":
+		ip.handleDash(gameState, input, ack, logger)
+	case "use_item":
+		ip.handleUseItem(ctx, gameState, input, ack, dispatcher, logger)
+	case "pickup":
+		ip.handlePickup(ctx, gameState, input, ack, dispatcher, logger)
+	case "drop":
+		ip.handleDrop(ctx, gameState, input, ack, dispatcher, logger)
+	case "cast":
+		ip.handleCast(ctx, gameState, input, ack, dispatcher, logger)
+	case "place":
+		ip.handlePlace(ctx, gameState, input, ack, dispatcher, logger)
+	case "mount":
+		if reason := gameState.Mount(input.PlayerID, input.ObjectID, dispatcher, logger); reason != "" {
+			ack.Reject(reason)
+		}
+	case "dismount":
+		if !gameState.Dismount(input.PlayerID, dispatcher, logger) {
+			ack.Reject(RejectNotMounted)
+		}
+	case "grab":
+		if reason := gameState.Grab(input.PlayerID, input.ObjectID, dispatcher, logger); reason != "" {
+			ack.Reject(reason)
+		}
+	case "release":
+		if reason := gameState.Release(input.PlayerID, false, dispatcher, logger); reason != "" {
+			ack.Reject(reason)
+		}
+	case "command":
+		ip.handleCommand(ctx, gameState, input, ack, dispatcher, logger)
+	case "target":
+		ip.handleTarget(gameState, input, ack)
+	case "untarget":
+		gameState.GetPlayerState(input.PlayerID).ClearTarget()
+	case "duel_request":
+		if reason := gameState.duels.Challenge(gameState, input.PlayerID, input.TargetID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "duel_accept":
+		if reason := gameState.duels.Accept(gameState, input.PlayerID, input.TargetID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "duel_decline":
+		if reason := gameState.duels.Decline(gameState, input.PlayerID, input.TargetID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "party_invite":
+		if reason := gameState.parties.Invite(gameState, input.PlayerID, input.TargetID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "party_accept":
+		if reason := gameState.parties.Accept(gameState, input.PlayerID, input.TargetID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "party_decline":
+		if reason := gameState.parties.Decline(gameState, input.PlayerID, input.TargetID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "party_leave":
+		if reason := gameState.parties.Leave(gameState, input.PlayerID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "party_kick":
+		if reason := gameState.parties.Kick(gameState, input.PlayerID, input.TargetID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "party_loot_rule":
+		if reason := gameState.parties.SetLootRule(gameState, input.PlayerID, input.LootRule, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "loot_roll":
+		if reason := gameState.parties.Choose(gameState, input.PlayerID, input.RollID, input.Choice, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "flag_pvp", "unflag_pvp":
+		if reason := gameState.SetPvPFlag(input.PlayerID, input.Action == "flag_pvp", ack); reason != "" {
+			ack.Reject(reason)
+		}
+	case "talk":
+		if reason := gameState.quests.Talk(ctx, gameState, input.PlayerID, input.NPCID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "quest_accept":
+		if reason := gameState.quests.Accept(ctx, gameState, input.PlayerID, input.NPCID, input.QuestID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "quest_turn_in":
+		rewards, reason := gameState.quests.TurnIn(ctx, gameState, input.PlayerID, input.NPCID, input.QuestID, dispatcher)
+		if reason != "" {
+			ack.Reject(reason)
+		} else if len(rewards) > 0 {
+			ack.ItemID = rewards[0].ItemID
+		}
+	case "quest_abandon":
+		if reason := gameState.quests.Abandon(ctx, gameState, input.PlayerID, input.QuestID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "summon_pet":
+		if reason := gameState.pets.Summon(ctx, gameState, input.PlayerID, input.PetID, ack, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "rename_pet":
+		if reason := gameState.pets.Rename(ctx, gameState, input.PlayerID, input.PetID, input.Text, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "dismiss_pet":
+		if reason := gameState.pets.Dismiss(ctx, gameState, input.PlayerID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "fish_cast":
+		if reason := gameState.fishing.Cast(ctx, gameState, input.PlayerID, input.ObjectID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "fish_reel":
+		_, stacks, reason := gameState.fishing.Reel(ctx, gameState, input.PlayerID, dispatcher)
+		if reason != "" {
+			ack.Reject(reason)
+		} else if len(stacks) > 0 {
+			ack.ItemID = stacks[0].ItemID
+		}
+	case "till", "plant", "harvest":
+		ip.handleFarming(ctx, gameState, input, ack, dispatcher, logger)
+	case "claim_plot":
+		if reason := gameState.housing.Claim(ctx, gameState, input.PlayerID, input.ObjectID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "release_plot":
+		if reason := gameState.housing.Release(ctx, gameState, input.PlayerID, input.ObjectID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "remove_furniture":
+		// Furniture follows its plot; buildings elsewhere only their own permissions
+		reason := ""
+		if gameState.housing.IsFurniture(input.ObjectID) {
+			reason = gameState.housing.RemoveFurniture(ctx, gameState, input.PlayerID, input.ObjectID, dispatcher)
+		} else {
+			reason = gameState.RemoveBuilding(ctx, input.PlayerID, input.ObjectID, dispatcher, logger)
+		}
+		if reason != "" {
+			ack.Reject(reason)
+		}
+	case "emote":
+		ip.handleEmote(gameState, input, ack, dispatcher, logger)
 	case "interact":
-		ip.handleInteract(gameState, input, dispatcher, logger)
+		ip.handleInteract(ctx, gameState, input, ack, dispatcher, logger)
+	case "disarm":
+		if reason := gameState.traps.Disarm(ctx, gameState, input.PlayerID, input.ObjectID, dispatcher, logger); reason != "" {
+			ack.Reject(reason)
+		}
+	case "gather":
+		ip.handleGather(ctx, gameState, input, ack, dispatcher, logger)
+	case "buy":
+		ip.handleBuy(ctx, gameState, input, ack, dispatcher, logger)
+	case "travel":
+		if reason := gameState.waypoints.Travel(ctx, gameState, input.PlayerID, input.Waypoint, ack, dispatcher, logger); reason != "" {
+			ack.Reject(reason)
+		}
+	case "auction_list":
+		if reason := gameState.auctions.List(ctx, gameState, input, ack, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+	case "auction_collect":
+		gameState.auctions.Deliver(ctx, gameState, input.PlayerID, dispatcher)
+	case "watch_vars":
+		gameState.worldVars.Watch(input.PlayerID, input.Keys)
+	case "unwatch_vars":
+		gameState.worldVars.Unwatch(input.PlayerID, input.Keys)
 	default:
 		// logger.Debug("Unknown action: %s from player: %s", input.Action, input.PlayerID)
+		ack.Reject(RejectInvalidAction)
+	}
+
+	if state != nil && ack.Approved {
+		state.recordApproved(input.Action, gameState.currentTick)
 	}
+	return ack
 }
 
 // handleSpawn processes player spawn action
@@ -40,9 +276,18 @@ func (ip *InputProcessor) handleSpawn(gameState *GameMatchState, input *PlayerIn
 		ip.CreatePlayerObject(gameState, input.PlayerID, spawnPosition)
 		logger.Info("Created new player object for %s at position (%f, %f)", input.PlayerID, spawnPosition.X, spawnPosition.Y)
 	} else {
-		// Player object already exists, update position
+		// Player object already exists: the position is the server's, so a client claiming one far
+		// from it is snapped back instead of moved
 		if input.X != 0 || input.Y != 0 {
-			playerObject.Position = vector.Vector{X: input.X, Y: input.Y}
+			claimed := vector.Vector{X: input.X, Y: input.Y}
+			if claimed.Sub(playerObject.Position).Magnitude() > antiCheatPositionTolerance {
+				logger.Warn("Player %s claimed position (%.1f, %.1f), %.1f px from the server's; correcting", input.PlayerID,
+					input.X, input.Y, claimed.Sub(playerObject.Position).Magnitude())
+				gameState.Teleport(input.PlayerID, playerObject.Position, CorrectionAntiCheat)
+				gameState.cheats.Report(gameState, input.PlayerID, CheatTeleport, fmt.Sprintf("%.0f px", claimed.Sub(playerObject.Position).Magnitude()))
+				return
+			}
+			playerObject.Position = claimed
 			playerObject.Velocity = vector.Vector{X: 0, Y: 0}
 			// logger.Debug("Player %s re-spawned at position (%f, %f)", input.PlayerID, input.X, input.Y)
 		}
@@ -51,10 +296,11 @@ func (ip *InputProcessor) handleSpawn(gameState *GameMatchState, input *PlayerIn
 
 // handleMovement processes player movement input by setting player velocity.
 // The physics engine will then update the position based on this velocity and its fixed deltaTime.
-func (ip *InputProcessor) handleMovement(gameState *GameMatchState, input *PlayerInput, logger runtime.Logger) {
+func (ip *InputProcessor) handleMovement(gameState *GameMatchState, input *PlayerInput, ack *InputACK, logger runtime.Logger) {
 	playerObject := ip.FindPlayerObject(gameState, input.PlayerID)
 	if playerObject == nil {
 		logger.Error("Player object not found for %s", input.PlayerID)
+		ack.Reject(RejectNoPlayerObject)
 		return
 	}
 
@@ -67,9 +313,15 @@ func (ip *InputProcessor) handleMovement(gameState *GameMatchState, input *Playe
 
 	// Validate movement speed to prevent cheating (max speed should be reasonable)
 	// This check is now on the magnitude of the raw velocity vector sent by client.
-	maxSpeed := 300.0 // Maximum pixels per second
+	// The cap includes speed buffs and sprint; sprint only applies while stamina lasts.
+	state := gameState.GetPlayerState(input.PlayerID)
+	state.Sprinting = input.Sprint && state.Stamina > 0 && state.MoveMode != MoveModeSwim
+	maxSpeed := state.MaxSpeed(gameState.config.PlayerMaxSpeed, gameState.currentTick) // Maximum pixels per second
 	speed := targetVelocity.Magnitude()
 
+	if legit := state.legitSpeed(maxSpeed, gameState.currentTick); speed > legit*cheatSpeedTolerance {
+		gameState.cheats.Report(gameState, input.PlayerID, CheatSpeed, fmt.Sprintf("%.0f of %.0f px/s", speed, legit))
+	}
 	if speed > maxSpeed {
 		// Clamp velocity to maximum allowed
 		if speed > 0 {
@@ -80,9 +332,19 @@ func (ip *InputProcessor) handleMovement(gameState *GameMatchState, input *Playe
 		// logger.Debug("Player %s velocity clamped from %f to %f", input.PlayerID, speed, maxSpeed)
 	}
 
+	// Mounts with a turn rate can't change direction instantly
+	if state.Mount != nil {
+		targetVelocity = state.steer(playerObject.Velocity, targetVelocity, gameState.currentTick)
+	}
+
 	// Set the player's velocity. The physics engine will handle position updates.
 	playerObject.Velocity = targetVelocity
 
+	// Without an explicit aim, players face the way they move (and keep facing that way once they stop)
+	if input.Facing == nil && targetVelocity.Magnitude() > 0 {
+		state.SetFacing(math.Atan2(targetVelocity.Y, targetVelocity.X))
+	}
+
 	// Position will be updated by the physics engine based on this new velocity.
 	// Boundary checks will also be handled by the physics engine after it updates the position.
 
@@ -90,13 +352,740 @@ func (ip *InputProcessor) handleMovement(gameState *GameMatchState, input *Playe
 	// 	input.PlayerID, playerObject.Velocity.X, playerObject.Velocity.Y)
 }
 
+// handleDash performs a short burst of movement in the requested direction (or the current
+// movement or facing direction when none is given). The dash is swept against static colliders so it
+// stops at walls instead of tunnelling through them.
+func (ip *InputProcessor) handleDash(gameState *GameMatchState, input *PlayerInput, ack *InputACK, logger runtime.Logger) {
+	playerObject := ip.FindPlayerObject(gameState, input.PlayerID)
+	if playerObject == nil {
+		logger.Error("Player object not found for %s", input.PlayerID)
+		ack.Reject(RejectNoPlayerObject)
+		return
+	}
+
+	if gameState.physicsEngine.BodyPhysics(playerObject).Frozen {
+		ack.Reject(RejectFrozen)
+		return
+	}
+	state := gameState.GetPlayerState(input.PlayerID)
+	if remaining := state.DashReadyTick - gameState.currentTick; remaining > 0 {
+		ack.Reject(RejectOnCooldown)
+		ack.DashCooldown = float64(remaining) / TickRate
+		return
+	}
+
+	direction := vector.Vector{X: input.VelocityX, Y: input.VelocityY}
+	if direction.Magnitude() == 0 {
+		direction = playerObject.Velocity
+	}
+	if direction.Magnitude() == 0 {
+		// Standing still: dash the way the player is facing
+		direction = state.FacingVector()
+	}
+	length := direction.Magnitude()
+	if length == 0 || math.IsNaN(length) || math.IsInf(length, 0) {
+		ack.Reject(RejectNoDirection)
+		return
+	}
+	direction = direction.Scale(1.0 / length)
+
+	target, blocked := gameState.physicsEngine.SweepBody(playerObject, direction.Scale(ip.config.DashDistance), gameState.gameObjects)
+	playerObject.Position = target
+	if blocked {
+		// The wall faces back along the dash; report it like a physics push-back
+		playerObject.Velocity = vector.Vector{X: 0, Y: 0}
+		ack.Blocked = true
+		normal := ToPosition(direction.Scale(-1))
+		ack.ContactNormal = &normal
+	} else {
+		playerObject.Velocity = direction.Scale(ip.config.DashExitSpeed)
+	}
+
+	cooldown := ip.config.DashCooldownTicks()
+	state.DashReadyTick = gameState.currentTick + cooldown
+	ack.DashCooldown = float64(cooldown) / TickRate
+}
+
+// handleUseItem applies the effect of an item the player owns and removes it from their inventory
+// (unless it is reusable). The item is taken before the effect runs and refunded if the effect
+// fails, so a storage error can never hand out the effect without consuming the item.
+func (ip *InputProcessor) handleUseItem(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	def, ok := gameState.itemCatalog.Get(input.ItemID)
+	if !ok {
+		ack.Reject(RejectUnknownItem)
+		return
+	}
+	playerObject := ip.FindPlayerObject(gameState, input.PlayerID)
+	if playerObject == nil {
+		ack.Reject(RejectNoPlayerObject)
+		return
+	}
+	if gameState.inventoryManager.Count(ctx, input.PlayerID, def.ID) <= 0 {
+		ack.Reject(RejectNotOwned)
+		return
+	}
+
+	state := gameState.GetPlayerState(input.PlayerID)
+
+	// Check effect preconditions before taking the item
+	switch def.Effect {
+	case ItemEffectHeal:
+		if state.Health >= state.MaxHealth {
+			ack.Reject(RejectFullHealth)
+			return
+		}
+	case ItemEffectBuff:
+		if def.Stat == "" {
+			ack.Reject(RejectNotUsable)
+			return
+		}
+	case ItemEffectPet:
+		if reason := gameState.pets.CanAdopt(input.PlayerID, def.Pet); reason != "" {
+			ack.Reject(reason)
+			return
+		}
+	case ItemEffectLight:
+		if def.Amount <= 0 {
+			ack.Reject(RejectNotUsable)
+			return
+		}
+	case ItemEffectFood:
+		if !state.Survival {
+			ack.Reject(RejectNotUsable)
+			return
+		}
+		if !state.CanFeed(def.Hunger, def.Thirst) {
+			ack.Reject(RejectNotHungry)
+			return
+		}
+	case ItemEffectTrap:
+		if def.Trap == nil {
+			ack.Reject(RejectNotUsable)
+			return
+		}
+	case ItemEffectSpawn, ItemEffectScript:
+	default:
+		ack.Reject(RejectNotUsable)
+		return
+	}
+
+	consume := !def.Reusable && def.Effect != ItemEffectLight
+	if consume {
+		if err := gameState.inventoryManager.Remove(ctx, input.PlayerID, def.ID, 1); err != nil {
+			if err != errNotEnoughItems {
+				logger.Error("use_item: failed to consume %s for %s: %v", def.ID, input.PlayerID, err)
+			}
+			ack.Reject(RejectNotOwned)
+			return
+		}
+	}
+
+	applied := true
+	switch def.Effect {
+	case ItemEffectHeal:
+		gameState.npcManager.HealThreat(gameState, input.PlayerID, input.PlayerID, state.Heal(def.Amount))
+	case ItemEffectBuff:
+		state.AddBuff(def.Stat, def.Amount, gameState.currentTick+int64(def.Duration*TickRate))
+	case ItemEffectSpawn:
+		props := map[string]interface{}{
+			"x":     playerObject.Position.X,
+			"y":     playerObject.Position.Y,
+			"owner": input.PlayerID,
+			"item":  def.ID,
+		}
+		if def.Script != "" {
+			props["script"] = def.Script
+		}
+		ownership := gameState.newOwnership(input.PlayerID, EntityPermissions{})
+		gameState.SpawnObject(&ObjectData{Name: def.Name, Type: "item_spawn", GID: def.SpawnGID, Props: props, Ownership: ownership}, dispatcher, logger)
+	case ItemEffectScript:
+		params := map[string]any{
+			"playerId": input.PlayerID,
+			"itemId":   def.ID,
+			"event":    input.Action,
+			"x":        playerObject.Position.X,
+			"y":        playerObject.Position.Y,
+		}
+		effects, err := gameState.scriptEngine.Execute(ctx, def.Script, params, gameState, dispatcher)
+		if err != nil {
+			logger.Error("use_item script error for item %s: %v", def.ID, err)
+			applied = false
+			break
+		}
+		gameState.ApplyScriptEffects(ctx, effects, dispatcher, logger)
+	case ItemEffectPet:
+		applied = gameState.pets.Adopt(ctx, gameState, input.PlayerID, def.Pet, dispatcher) == ""
+	case ItemEffectLight:
+		state.ToggleLight(def.ID, def.Amount)
+	case ItemEffectTrap:
+		gameState.traps.Place(gameState, input.PlayerID, def, playerObject.Position, dispatcher)
+	case ItemEffectFood:
+		// fed below, like every item restoring hunger or thirst
+	}
+
+	if !applied {
+		if consume {
+			if err := gameState.inventoryManager.Add(ctx, input.PlayerID, def.ID, 1); err != nil {
+				logger.Error("use_item: failed to refund %s to %s: %v", def.ID, input.PlayerID, err)
+			}
+		}
+		ack.Reject(RejectEffectFailed)
+		return
+	}
+
+	if state.Survival {
+		state.Feed(def.Hunger, def.Thirst)
+	}
+	ack.ItemID = def.ID
+	ack.Health = state.Health
+	gameState.inventoryManager.SyncToClient(ctx, gameState, input.PlayerID, dispatcher)
+}
+
+// handlePickup moves a world item into the player's inventory if the player is touching it
+func (ip *InputProcessor) handlePickup(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	playerObject := ip.FindPlayerObject(gameState, input.PlayerID)
+	if playerObject == nil {
+		ack.Reject(RejectNoPlayerObject)
+		return
+	}
+
+	item, reason := gameState.worldItems.Take(gameState, input.ObjectID, input.PlayerID, playerObject)
+	if item == nil {
+		ack.Reject(reason)
+		return
+	}
+
+	entry := &JournalEntry{Key: gameState.journal.Key("pickup", item.ObjectID, gameState.currentTick), Kind: JournalItemGrant, PlayerID: input.PlayerID, Items: map[string]int{item.ItemID: item.Count}, Source: "pickup"}
+	if err := gameState.journal.Begin(ctx, entry); err != nil {
+		gameState.worldItems.Restore(item)
+		ack.Reject(RejectNotFound)
+		return
+	}
+	// The world items without the stack are stored with the inventory
+	writes := gameState.worldItems.Writes(gameState)
+	err := gameState.inventoryManager.Add(ctx, input.PlayerID, item.ItemID, item.Count, writes...)
+	gameState.journal.Finish(ctx, entry, err)
+	if err != nil {
+		logger.Error("pickup: failed to add %d x %s to %s: %v", item.Count, item.ItemID, input.PlayerID, err)
+		gameState.worldItems.Restore(item)
+		ack.Reject(RejectStorageError)
+		return
+	}
+	gameState.worldItems.Committed(writes)
+
+	gameState.RemoveObject(item.ObjectID, dispatcher, logger)
+	gameState.inventoryManager.SyncToClient(ctx, gameState, input.PlayerID, dispatcher)
+	ack.ItemID = item.ItemID
+}
+
+// handleDrop takes items from the player's inventory and places them in the world at the player's feet
+func (ip *InputProcessor) handleDrop(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	playerObject := ip.FindPlayerObject(gameState, input.PlayerID)
+	if playerObject == nil {
+		ack.Reject(RejectNoPlayerObject)
+		return
+	}
+	count := input.Count
+	if count <= 0 {
+		count = 1
+	}
+	if input.ItemID == "" {
+		ack.Reject(RejectUnknownItem)
+		return
+	}
+
+	if gameState.inventoryManager.Count(ctx, input.PlayerID, input.ItemID) < count {
+		ack.Reject(RejectNotOwned)
+		return
+	}
+
+	// The stack is placed first, so the world items with it are stored with the inventory
+	oid := gameState.worldItems.Spawn(gameState, input.ItemID, count, playerObject.Position, input.PlayerID, gameState.droppedItemLifetimeTicks(), dispatcher)
+	writes := gameState.worldItems.Writes(gameState)
+	if err := gameState.inventoryManager.Remove(ctx, input.PlayerID, input.ItemID, count, writes...); err != nil {
+		gameState.worldItems.Discard(gameState, oid, dispatcher)
+		if err != errNotEnoughItems {
+			logger.Error("drop: failed to remove %d x %s from %s: %v", count, input.ItemID, input.PlayerID, err)
+			ack.Reject(RejectStorageError)
+			return
+		}
+		ack.Reject(RejectNotOwned)
+		return
+	}
+	gameState.worldItems.Committed(writes)
+
+	ack.ObjectID = oid
+	ack.ItemID = input.ItemID
+	gameState.inventoryManager.SyncToClient(ctx, gameState, input.PlayerID, dispatcher)
+}
+
+// handleGather gathers from the resource node objectId if the player can reach it and owns the
+// required tool
+func (ip *InputProcessor) handleGather(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gameState.mu.Lock()
+	obj, ok := gameState.Object(input.ObjectID)
+	gameState.mu.Unlock()
+	if !ok {
+		ack.Reject(RejectUnknownObject)
+		return
+	}
+	if reason := ip.validateInteractReach(gameState, input.PlayerID, input.ObjectID, obj); reason != "" {
+		ack.Reject(reason)
+		return
+	}
+
+	stacks, reason := gameState.resourceNodes.Gather(ctx, gameState, input.PlayerID, input.ObjectID, dispatcher)
+	if reason != "" {
+		ack.Reject(reason)
+		return
+	}
+	if len(stacks) > 0 {
+		ack.ItemID = stacks[0].ItemID
+	}
+	gameState.inventoryManager.SyncToClient(ctx, gameState, input.PlayerID, dispatcher)
+}
+
+// handleBuy buys count (default 1) of itemId from the vendor objectId if the player can reach it
+// and the vendor is open
+func (ip *InputProcessor) handleBuy(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gameState.mu.Lock()
+	obj, ok := gameState.Object(input.ObjectID)
+	gameState.mu.Unlock()
+	if !ok {
+		ack.Reject(RejectUnknownObject)
+		return
+	}
+	if reason := ip.validateInteractReach(gameState, input.PlayerID, input.ObjectID, obj); reason != "" {
+		ack.Reject(reason)
+		return
+	}
+	if gameState.timedObjects.Closed(input.ObjectID) {
+		ack.Reject(RejectClosed)
+		return
+	}
+
+	if _, reason := gameState.shops.Buy(ctx, gameState, input.PlayerID, input.ObjectID, input.ItemID, input.Count, dispatcher); reason != "" {
+		ack.Reject(reason)
+		return
+	}
+	ack.ItemID = input.ItemID
+	gameState.inventoryManager.SyncToClient(ctx, gameState, input.PlayerID, dispatcher)
+}
+
+// handleFarming tills soil, plants a seed (itemId) or harvests a ripe crop on the soil object
+// objectId, within interact reach
+func (ip *InputProcessor) handleFarming(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gameState.mu.Lock()
+	obj, ok := gameState.Object(input.ObjectID)
+	gameState.mu.Unlock()
+	if !ok {
+		ack.Reject(RejectUnknownObject)
+		return
+	}
+	if reason := ip.validateInteractReach(gameState, input.PlayerID, input.ObjectID, obj); reason != "" {
+		ack.Reject(reason)
+		return
+	}
+
+	var reason string
+	switch input.Action {
+	case "till":
+		reason = gameState.farms.Till(ctx, gameState, input.PlayerID, input.ObjectID, dispatcher)
+	case "plant":
+		ack.ItemID = input.ItemID
+		reason = gameState.farms.Plant(ctx, gameState, input.PlayerID, input.ObjectID, input.ItemID, dispatcher)
+	case "harvest":
+		var stacks []LootStack
+		stacks, reason = gameState.farms.Harvest(ctx, gameState, input.PlayerID, input.ObjectID, dispatcher)
+		if len(stacks) > 0 {
+			ack.ItemID = stacks[0].ItemID
+		}
+	}
+	if reason != "" {
+		ack.Reject(reason)
+		return
+	}
+	if input.Action != "till" {
+		gameState.inventoryManager.SyncToClient(ctx, gameState, input.PlayerID, dispatcher)
+	}
+}
+
+// validateInteractReach checks that the player can reach obj and returns a rejection reason if not
+func (ip *InputProcessor) validateInteractReach(gameState *GameMatchState, playerID string, oid int, obj *ObjectData) string {
+	playerObject := ip.FindPlayerObject(gameState, playerID)
+	if playerObject == nil {
+		return RejectNoPlayerObject
+	}
+	objPos, ok := obj.Position()
+	if !ok {
+		// Objects without a world position can't be range-checked; keep them usable
+		return ""
+	}
+
+	interactRange := defaultInteractRange
+	if r, ok := obj.Props["interactrange"].(float64); ok && r > 0 {
+		interactRange = r
+	}
+	// Measure from the edge of the player's body so large players aren't penalised
+	reach := interactRange + max(playerObject.Width, playerObject.Height)/2
+	if playerObject.Position.Sub(objPos).Magnitude() > reach {
+		return RejectOutOfRange
+	}
+
+	if los, _ := obj.Props["requirelineofsight"].(bool); los {
+		if !gameState.HasLineOfSight(playerObject.Position, objPos, oid) {
+			return RejectNoLineOfSight
+		}
+	}
+	return ""
+}
+
+// handlePlace builds a whitelisted object at (x, y) after checking range, build permissions,
+// overlap and material costs. Materials are only taken once every check passed.
+func (ip *InputProcessor) handlePlace(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	playerObject := ip.FindPlayerObject(gameState, input.PlayerID)
+	if playerObject == nil {
+		ack.Reject(RejectNoPlayerObject)
+		return
+	}
+	ack.BuildableID = input.BuildableID
+	def, ok := gameState.buildableCatalog.Get(input.BuildableID)
+	if !ok {
+		ack.Reject(RejectUnknownBuildable)
+		return
+	}
+
+	position := vector.Vector{X: input.X, Y: input.Y}
+	if position.Sub(playerObject.Position).Magnitude() > placeRange {
+		ack.Reject(RejectOutOfRange)
+		return
+	}
+	role := gameState.GetPlayerState(input.PlayerID).Role
+	if !roleAllows(role, def.Role) || !gameState.CanBuildAt(position, role) {
+		ack.Reject(RejectPermissionDenied)
+		return
+	}
+	plotID, reason := gameState.housing.CheckPlacement(gameState, input.PlayerID, position, def.Width, def.Height)
+	if reason != "" {
+		ack.Reject(reason)
+		return
+	}
+	// Buildings outside plots are saved with their map chunk, which only the primary shard of
+	// the open world writes: elsewhere they would take the materials and vanish with the match
+	if plotID == 0 && !gameState.instanced() && !gameState.savesWorldState() {
+		ack.Reject(RejectUnsavedWorld)
+		return
+	}
+	if gameState.FootprintBlocked(MakeRectangleRigidBody(position.X, position.Y, def.Width, def.Height)) {
+		ack.Reject(RejectBlocked)
+		return
+	}
+
+	if err := gameState.inventoryManager.RemoveAll(ctx, input.PlayerID, def.Cost); err != nil {
+		if err != errNotEnoughItems {
+			logger.Error("place: failed to take materials for %s from %s: %v", def.ID, input.PlayerID, err)
+			ack.Reject(RejectStorageError)
+			return
+		}
+		ack.Reject(RejectMissingMaterials)
+		return
+	}
+	if len(def.Cost) > 0 {
+		gameState.inventoryManager.SyncToClient(ctx, gameState, input.PlayerID, dispatcher)
+	}
+
+	ack.ObjectID = gameState.spawnBuilding(def, position, gameState.newOwnership(input.PlayerID, def.Permissions), plotID, dispatcher, logger)
+	if plotID != 0 {
+		// Furniture is persisted with its plot; undo the placement if that fails
+		if err := gameState.housing.AddFurniture(ctx, gameState, plotID, ack.ObjectID, def.ID, position, input.PlayerID, dispatcher); err != nil {
+			logger.Error("place: failed to save %s on plot %d: %v", def.ID, plotID, err)
+			gameState.RemoveObject(ack.ObjectID, dispatcher, logger)
+			if len(def.Cost) > 0 {
+				for itemID, count := range def.Cost {
+					if rerr := gameState.inventoryManager.Add(ctx, input.PlayerID, itemID, count); rerr != nil {
+						logger.Error("place: failed to return %d x %s to %s: %v", count, itemID, input.PlayerID, rerr)
+					}
+				}
+				gameState.inventoryManager.SyncToClient(ctx, gameState, input.PlayerID, dispatcher)
+			}
+			ack.ObjectID = 0
+			ack.Reject(RejectStorageError)
+			return
+		}
+	} else {
+		// Buildings outside plots are saved with their map chunk
+		gameState.chunks.AddBuilding(ctx, ack.ObjectID, position)
+	}
+	logger.Info("Player %s placed %s (object %d) at (%.1f, %.1f)", input.PlayerID, def.ID, ack.ObjectID, position.X, position.Y)
+}
+
+// handleTarget locks the player onto another player (targetId) or an object (objectId) after
+// checking that it exists, is within targetRange and is in line of sight
+func (ip *InputProcessor) handleTarget(gameState *GameMatchState, input *PlayerInput, ack *InputACK) {
+	playerObject := ip.FindPlayerObject(gameState, input.PlayerID)
+	if playerObject == nil {
+		ack.Reject(RejectNoPlayerObject)
+		return
+	}
+
+	target := &PlayerTarget{PlayerID: input.TargetID}
+	if input.TargetID == "" {
+		target = &PlayerTarget{ObjectID: input.ObjectID}
+	}
+	if target.PlayerID == input.PlayerID {
+		ack.Reject(RejectInvalidTarget)
+		return
+	}
+	if reason := gameState.validateTarget(playerObject, target, targetRange); reason != "" {
+		ack.Reject(reason)
+		return
+	}
+
+	gameState.GetPlayerState(input.PlayerID).SetTarget(target)
+	ack.TargetID = target.PlayerID
+}
+
+// handleEmote relays an allow-listed emote to the players around the sender
+func (ip *InputProcessor) handleEmote(gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if !allowedEmotes[input.EmoteID] {
+		ack.Reject(RejectUnknownEmote)
+		return
+	}
+	playerObject := ip.FindPlayerObject(gameState, input.PlayerID)
+	if playerObject == nil {
+		ack.Reject(RejectNoPlayerObject)
+		return
+	}
+
+	// A target must be a player close enough to see the emote
+	if input.TargetID != "" {
+		target := ip.FindPlayerObject(gameState, input.TargetID)
+		if target == nil || target.Position.Sub(playerObject.Position).Magnitude() > emoteRange {
+			ack.Reject(RejectInvalidTarget)
+			return
+		}
+	}
+
+	data, err := EncodeMessage(OpCodeEmote, "emote", EmoteEvent{
+		PlayerID: input.PlayerID,
+		EmoteID:  input.EmoteID,
+		TargetID: input.TargetID,
+		X:        playerObject.Position.X,
+		Y:        playerObject.Position.Y,
+	})
+	if err != nil {
+		logger.Error("Failed to marshal emote from %s: %v", input.PlayerID, err)
+		return
+	}
+
+	recipients := gameState.PresencesInRange(playerObject.Position, emoteRange)
+	if len(recipients) > 0 && dispatcher != nil {
+		dispatcher.BroadcastMessage(OpCodeEmote, data, recipients, nil, true)
+	}
+}
+
+// handleCast casts an ability: it checks cooldown, range and cost, runs the ability's effect
+// script and optional knockback, then relays the result to nearby players. The cost is refunded
+// and no cooldown is started if the effect script fails.
+func (ip *InputProcessor) handleCast(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	def, ok := gameState.abilityCatalog.Get(input.AbilityID)
+	if !ok {
+		ack.Reject(RejectUnknownAbility)
+		return
+	}
+	ack.AbilityID = def.ID
+
+	caster := ip.FindPlayerObject(gameState, input.PlayerID)
+	if caster == nil {
+		ack.Reject(RejectNoPlayerObject)
+		return
+	}
+	state := gameState.GetPlayerState(input.PlayerID)
+	if remaining := state.AbilityReady[def.ID] - gameState.currentTick; remaining > 0 {
+		ack.Cooldown = float64(remaining) / TickRate
+		ack.Reject(RejectOnCooldown)
+		return
+	}
+
+	// Resolve the target position for range checks and the effect context
+	cast := AbilityCast{CasterID: input.PlayerID, AbilityID: def.ID, X: caster.Position.X, Y: caster.Position.Y}
+	var targetBody *rigidbody.RigidBody
+	switch def.Target {
+	case AbilityTargetPoint:
+		cast.X, cast.Y = input.X, input.Y
+	case AbilityTargetPlayer:
+		// Fall back to the locked target when the cast doesn't name one
+		if input.TargetID == "" && state.Target != nil {
+			input.TargetID = state.Target.PlayerID
+		}
+		targetBody = ip.FindPlayerObject(gameState, input.TargetID)
+		if targetBody == nil || input.TargetID == input.PlayerID {
+			ack.Reject(RejectInvalidTarget)
+			return
+		}
+		cast.TargetID = input.TargetID
+		cast.X, cast.Y = targetBody.Position.X, targetBody.Position.Y
+	case AbilityTargetObject:
+		if input.ObjectID == 0 && state.Target != nil {
+			input.ObjectID = state.Target.ObjectID
+		}
+		obj, ok := gameState.Object(input.ObjectID)
+		if !ok {
+			ack.Reject(RejectInvalidTarget)
+			return
+		}
+		pos, ok := obj.Position()
+		if !ok {
+			ack.Reject(RejectInvalidTarget)
+			return
+		}
+		cast.ObjectID = obj.ID
+		cast.X, cast.Y = pos.X, pos.Y
+	}
+	target := vector.Vector{X: cast.X, Y: cast.Y}
+	if def.Range > 0 && target.Sub(caster.Position).Magnitude() > def.Range {
+		ack.Reject(RejectOutOfRange)
+		return
+	}
+
+	if !state.SpendResource(def.Resource, def.Cost) {
+		ack.Reject(RejectInsufficientResource)
+		return
+	}
+
+	if def.Script != "" {
+		params := map[string]any{
+			"playerId":  input.PlayerID,
+			"abilityId": def.ID,
+			"event":     input.Action,
+			"targetId":  cast.TargetID,
+			"objectId":  cast.ObjectID,
+			"x":         cast.X,
+			"y":         cast.Y,
+			"facing":    state.Facing,
+		}
+		effects, err := gameState.scriptEngine.Execute(ctx, def.Script, params, gameState, dispatcher)
+		if err != nil {
+			logger.Error("cast: ability %s script error: %v", def.ID, err)
+			state.RefundResource(def.Resource, def.Cost)
+			ack.Reject(RejectEffectFailed)
+			return
+		}
+		for _, effect := range gameState.ApplyScriptEffects(ctx, effects, dispatcher, logger) {
+			if effect.AckMessage != "" {
+				cast.Messages = append(cast.Messages, effect.AckMessage)
+			}
+		}
+	}
+
+	// Casting gives a hidden caster away, unless the ability is what hides them
+	if !gameState.grantsStealth(def) {
+		gameState.RevealStealth(input.PlayerID)
+	}
+	// Attacking gives up spawn protection
+	if def.Projectile != nil || def.AoE != nil || def.Knockback > 0 {
+		gameState.EndSpawnProtection(input.PlayerID, "attacked")
+	}
+
+	if len(def.Effects) > 0 {
+		effectTarget := cast.TargetID
+		if def.Target == AbilityTargetSelf {
+			effectTarget = input.PlayerID
+		}
+		if effectTarget != "" {
+			for _, effectID := range def.Effects {
+				gameState.ApplyEffect(effectTarget, effectID, DamageSource{Type: DamageSourcePlayer, ID: input.PlayerID}, 0)
+			}
+		}
+	}
+
+	if def.Projectile != nil {
+		// Self abilities shoot along the caster's facing
+		aim := target
+		if def.Target == AbilityTargetSelf {
+			aim = caster.Position.Add(state.FacingVector().Scale(def.Projectile.MaxRange))
+		}
+		owner := DamageSource{Type: DamageSourcePlayer, ID: input.PlayerID}
+		cast.ProjectileID = gameState.projectiles.Launch(gameState, def.Projectile, owner, def.ID, caster.Position, aim, dispatcher)
+		// The shot flies through the world the caster saw, like area casts
+		gameState.projectiles.Rewind(cast.ProjectileID, gameState.currentTick-gameState.RewindTick(input.PlayerID, input.ViewTick))
+	}
+
+	if def.AoE != nil {
+		// Circles land on the target; cones and rects point from the caster at it (or along the
+		// caster's facing when there is nothing to point at)
+		origin, direction := target, state.Facing
+		if def.AoE.Shape != AoEShapeCircle {
+			origin = caster.Position
+			if aim := target.Sub(caster.Position); aim.Magnitude() > 0 {
+				direction = math.Atan2(aim.Y, aim.X)
+			}
+		}
+		owner := DamageSource{Type: DamageSourcePlayer, ID: input.PlayerID}
+		result := gameState.ResolveAoE(def.AoE, owner, def.ID, origin, direction, gameState.RewindTick(input.PlayerID, input.ViewTick), dispatcher, logger)
+		cast.AoEHits = len(result.Hits)
+	}
+
+	if def.Knockback > 0 && targetBody != nil && targetBody.IsMovable && gameState.CanDamagePlayer(input.PlayerID, cast.TargetID) {
+		if away := targetBody.Position.Sub(caster.Position); away.Magnitude() > 0 {
+			targetBody.Velocity = targetBody.Velocity.Add(away.Scale(def.Knockback / away.Magnitude()))
+		}
+	}
+
+	cooldownTicks := int64(def.Cooldown * TickRate)
+	state.AbilityReady[def.ID] = gameState.currentTick + cooldownTicks
+	ack.Cooldown = def.Cooldown
+
+	data, err := EncodeMessage(OpCodeAbilityResult, "ability_cast", cast)
+	if err != nil {
+		logger.Error("Failed to marshal ability cast %s: %v", def.ID, err)
+		return
+	}
+	if recipients := gameState.PresencesInRange(caster.Position, abilityBroadcastRange); len(recipients) > 0 && dispatcher != nil {
+		dispatcher.BroadcastMessage(OpCodeAbilityResult, data, recipients, nil, true)
+	}
+}
+
+// handleCommand runs a slash command from the permission-checked command table and sends the
+// output back to the player
+func (ip *InputProcessor) handleCommand(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	name, args := ParseCommand(input.Text)
+	cmd, ok := chatCommands[name]
+	if !ok {
+		ack.Reject(RejectUnknownCommand)
+		return
+	}
+	state := gameState.GetPlayerState(input.PlayerID)
+	if !roleAllows(state.Role, cmd.Role) {
+		logger.Warn("Player %s (role %q) tried to run /%s", input.PlayerID, state.Role, name)
+		ack.Reject(RejectPermissionDenied)
+		return
+	}
+	if cmd.Role != RolePlayer && cmd.Name != "gm" && !state.GMMode {
+		ack.Reject(RejectGMModeOff)
+		return
+	}
+	cc := &CommandContext{
+		ctx:       ctx,
+		gameState: gameState,
+		playerID:  input.PlayerID,
+		name:      name,
+		args:      args,
+		// Everything GMs do in GM mode is audited, including the GM parts of player commands
+		audited:    cmd.Role != RolePlayer || state.GMMode,
+		dispatcher: dispatcher,
+		logger:     logger,
+	}
+	message, err := cmd.Handler(cc)
+	if err == errCommandPending {
+		return
+	}
+	cc.reply(message, err)
+}
+
 // FindPlayerObject finds the game object associated with a player
 func (ip *InputProcessor) FindPlayerObject(gameState *GameMatchState, playerID string) *rigidbody.RigidBody {
-	// Use the player objects mapping to find the player's object
-	if playerObject, exists := gameState.playerObjects[playerID]; exists {
-		return playerObject
-	}
-	return nil
+	return gameState.PlayerBody(playerID)
 }
 
 // CreatePlayerObject creates a new game object for a joining player
@@ -104,10 +1093,10 @@ func (ip *InputProcessor) CreatePlayerObject(gameState *GameMatchState, playerID
 	playerObject := &rigidbody.RigidBody{
 		Position:  spawnPosition,
 		Velocity:  vector.Vector{X: 0, Y: 0},
-		Mass:      10.0,
+		Mass:      ip.config.PlayerMass,
 		Shape:     "rectangle",
-		Width:     40,
-		Height:    40,
+		Width:     ip.config.PlayerSize,
+		Height:    ip.config.PlayerSize,
 		IsMovable: true,
 	}
 
@@ -123,29 +1112,100 @@ func (ip *InputProcessor) RemovePlayerObject(gameState *GameMatchState, playerID
 	gameState.RemovePlayerObject(playerID)
 }
 
-func (ip *InputProcessor) handleInteract(gameState *GameMatchState, input *PlayerInput, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+// handleInteract runs the script of the object the player interacts with. The player must be
+// within the object's interaction range (the "interactRange" property, or defaultInteractRange)
+// and, for objects with "requireLineOfSight", have no static collider in between.
+func (ip *InputProcessor) handleInteract(ctx context.Context, gameState *GameMatchState, input *PlayerInput, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
 	if gameState.currentMap == nil && input.ObjectID != 0 {
 		return
 	}
-	obj := gameState.objects[input.ObjectID]
-	if obj == nil {
+	obj, ok := gameState.Object(input.ObjectID)
+	if !ok {
 		logger.Warn("interact: unknown object id %d", input.ObjectID)
+		ack.Reject(RejectUnknownObject)
 		return
 	}
 	// log object properties
 	logger.Info("interact: object %d properties: %+v", input.ObjectID, obj.Props)
 	scriptPathAny := obj.Props["script"]
 	scriptPath, _ := scriptPathAny.(string)
-	if scriptPath == "" {
+	door := gameState.doors.Get(input.ObjectID)
+	lever := gameState.mechanisms.Lever(input.ObjectID)
+	container := gameState.containers.Get(input.ObjectID)
+	vendor := gameState.shops.Get(input.ObjectID)
+	if scriptPath == "" && door == nil && lever == nil && container == nil && vendor == nil {
 		logger.Warn("interact: object %d has no 'script' property", input.ObjectID)
 		return
 	}
+
+	if reason := ip.validateInteractReach(gameState, input.PlayerID, input.ObjectID, obj); reason != "" {
+		logger.Warn("interact: player %s rejected for object %d: %s", input.PlayerID, input.ObjectID, reason)
+		ack.Reject(reason)
+		return
+	}
+	// Furniture on housing plots follows the plot's access mode
+	if !gameState.housing.CanUse(gameState, input.PlayerID, input.ObjectID) {
+		ack.Reject(RejectPermissionDenied)
+		return
+	}
+	// Shops and other objects with opening hours turn players away while closed
+	if gameState.timedObjects.Closed(input.ObjectID) {
+		ack.Reject(RejectClosed)
+		return
+	}
+
+	// One player at a time: a second interaction with the object in the same moment, or a resent
+	// input, is turned away before anything runs
+	if reason := gameState.interactGuard.Begin(gameState, input.PlayerID, input.ObjectID, input.InputSequence); reason != "" {
+		ack.Reject(reason)
+		return
+	}
+	defer gameState.interactGuard.End(input.ObjectID)
+
+	// Doors open and close, and levers flip, before their script (if any) runs
+	if door != nil {
+		if reason := gameState.doors.Interact(ctx, gameState, door, input.PlayerID, dispatcher, logger); reason != "" {
+			ack.Reject(reason)
+			return
+		}
+	}
+	if lever != nil {
+		if reason := gameState.mechanisms.Pull(gameState, lever, input.PlayerID, dispatcher, logger); reason != "" {
+			ack.Reject(reason)
+			return
+		}
+	}
+	// Containers without a script open by themselves; chest scripts call open_container
+	if container != nil && scriptPath == "" {
+		stacks, reason := gameState.containers.Open(ctx, gameState, input.PlayerID, input.ObjectID, dispatcher)
+		if reason != "" {
+			ack.Reject(reason)
+			return
+		}
+		if len(stacks) > 0 {
+			ack.ItemID = stacks[0].ItemID
+		}
+		return
+	}
+	// Vendors without a script show their shop; vendor scripts call open_shop
+	if vendor != nil && scriptPath == "" {
+		if reason := gameState.shops.Open(gameState, input.PlayerID, input.ObjectID, dispatcher); reason != "" {
+			ack.Reject(reason)
+		}
+		return
+	}
+	if scriptPath == "" {
+		return
+	}
+
 	// Execute script
 	params := map[string]any{
 		"playerId": input.PlayerID,
 		"objectId": input.ObjectID,
 		"event":    input.Action,
 		"gid":      obj.GID,
+		// the same for a resent input: scripts key mark_done_once and claim_object on it
+		"interactionId": InteractionID(input.ObjectID, input.PlayerID, input.InputSequence),
 	}
 
 	// Build a serializable object state map to pass to scripts (includes runtime properties)
@@ -158,19 +1218,15 @@ func (ip *InputProcessor) handleInteract(gameState *GameMatchState, input *Playe
 	}
 	params["object"] = objectState
 
-	effects, err := gameState.scriptEngine.Execute(scriptPath, params, gameState, dispatcher)
+	effects, err := gameState.scriptEngine.Execute(ctx, scriptPath, params, gameState, dispatcher)
 	if err != nil {
+		// A failed script applies none of the effects it queued
 		logger.Error("interact script error for object %d: %v", input.ObjectID, err)
 		return
 	}
-	if len(effects) == 0 {
-		return
-	}
-
-	// go through effects and log them
-	for _, effect := range effects {
-		if effect.AckMessage != "" {
-			logger.Info("interact: object %d effect: ACK message: %s", input.ObjectID, effect.AckMessage)
+	for _, effect := range gameState.ApplyScriptEffects(ctx, effects, dispatcher, logger) {
+		if effect.Type == EffectGiveItem && effect.PlayerID == input.PlayerID && ack.ItemID == "" {
+			ack.ItemID = effect.ItemID
 		}
 	}
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Interaction guard tuning
+const (
+	interactLockTicks  = 6        // ticks an object used by one player turns other players away
+	maxObjectClaims    = 4096     // claims kept per match
+	guardPruneInterval = TickRate // ticks between sweeps of expired locks and claims
+)
+
+// objectLock is the player an object is reserved for and until when
+type objectLock struct {
+	playerID string
+	until    int64
+}
+
+// claimKey identifies a claim on an object
+type claimKey struct {
+	oid int
+	key string
+}
+
+// InteractionGuard serializes interactions with shared objects. The first player to interact
+// with an object holds it for interactLockTicks, so two players using the same chest in the same
+// tick don't both run its script: the other is turned away with object_busy and retries. An
+// object whose interaction is running (a script interacting with it again) is busy as well. A
+// player's interact inputs are handled once per input sequence, so a resent input doesn't run
+// the script twice. Scripts make their effects idempotent with claim_object, which only the
+// first caller wins. Only the match loop uses it.
+type InteractionGuard struct {
+	locks   map[int]objectLock
+	running map[int]bool
+	lastSeq map[string]uint64 // player ID -> input sequence of their last interact
+	claims  map[claimKey]int64
+}
+
+// NewInteractionGuard creates a guard without locks or claims
+func NewInteractionGuard() *InteractionGuard {
+	return &InteractionGuard{
+		locks:   make(map[int]objectLock),
+		running: make(map[int]bool),
+		lastSeq: make(map[string]uint64),
+		claims:  make(map[claimKey]int64),
+	}
+}
+
+// Begin reserves an object for a player's interaction. It returns RejectDuplicate for an
+// interact input the player already sent, RejectObjectBusy while the object is in use by someone
+// else, or "" and marks the interaction running until End.
+func (ig *InteractionGuard) Begin(gs *GameMatchState, playerID string, oid int, sequence uint64) string {
+	if sequence != 0 && sequence <= ig.lastSeq[playerID] {
+		return RejectDuplicate
+	}
+	tick := gs.currentTick
+	if ig.running[oid] {
+		return RejectObjectBusy
+	}
+	if lock, ok := ig.locks[oid]; ok && lock.playerID != playerID && tick < lock.until {
+		return RejectObjectBusy
+	}
+	if sequence != 0 {
+		ig.lastSeq[playerID] = sequence
+	}
+	ig.locks[oid] = objectLock{playerID: playerID, until: tick + interactLockTicks}
+	ig.running[oid] = true
+	return ""
+}
+
+// End marks an object's interaction finished; the object stays reserved until its lock runs out
+func (ig *InteractionGuard) End(oid int) {
+	delete(ig.running, oid)
+}
+
+// InteractionID is the idempotency key of an interaction, passed to scripts as
+// ctx.interactionId: the same for a resent input, different for every new interact
+func InteractionID(oid int, playerID string, sequence uint64) string {
+	return fmt.Sprintf("%d:%s:%d", oid, playerID, sequence)
+}
+
+// Claim claims a key on an object for seconds (0 or less: until the match ends). It
+// returns true only for the first caller while the claim lasts, so a script gating a shared
+// reward on it hands the reward out once however many players race for it.
+func (ig *InteractionGuard) Claim(gs *GameMatchState, oid int, key string, seconds float64) bool {
+	tick := gs.currentTick
+	k := claimKey{oid: oid, key: key}
+	if expiry, ok := ig.claims[k]; ok && (expiry == 0 || tick < expiry) {
+		return false
+	}
+	if len(ig.claims) >= maxObjectClaims {
+		ig.prune(tick)
+		if len(ig.claims) >= maxObjectClaims {
+			return false
+		}
+	}
+	expiry := int64(0)
+	if seconds > 0 {
+		expiry = tick + int64(math.Ceil(seconds*TickRate))
+	}
+	ig.claims[k] = expiry
+	return true
+}
+
+// Release drops a claim, or every claim on the object when key is empty
+func (ig *InteractionGuard) Release(oid int, key string) {
+	for k := range ig.claims {
+		if k.oid == oid && (key == "" || k.key == key) {
+			delete(ig.claims, k)
+		}
+	}
+}
+
+// Update sweeps the expired locks and claims. Called from the match loop.
+func (ig *InteractionGuard) Update(gs *GameMatchState) {
+	if gs.currentTick%guardPruneInterval == 0 {
+		ig.prune(gs.currentTick)
+	}
+}
+
+// prune drops the locks and claims that ran out
+func (ig *InteractionGuard) prune(tick int64) {
+	for oid, lock := range ig.locks {
+		if tick >= lock.until {
+			delete(ig.locks, oid)
+		}
+	}
+	for k, expiry := range ig.claims {
+		if expiry != 0 && tick >= expiry {
+			delete(ig.claims, k)
+		}
+	}
+}
+
+// ForgetPlayer drops a leaving player's input sequence; a rejoining client starts over
+func (ig *InteractionGuard) ForgetPlayer(playerID string) {
+	delete(ig.lastSeq, playerID)
+}
+
+// ForgetObject drops the lock and claims of a removed object
+func (ig *InteractionGuard) ForgetObject(oid int) {
+	delete(ig.locks, oid)
+	delete(ig.running, oid)
+	ig.Release(oid, "")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// InteractionTracker keeps per-player interaction cooldowns and once-only flags.
+// Scripts use it to stop objects (e.g. chests) being farmed by spamming interact,
+// and to keep one-time rewards one-time across sessions.
+type InteractionTracker struct {
+	logger          runtime.Logger
+	databaseManager *DatabaseManager
+	records         map[string]*PersistedInteractions // player ID -> loaded record
+	mu              sync.Mutex
+}
+
+// NewInteractionTracker creates a new interaction tracker backed by the given database manager
+func NewInteractionTracker(logger runtime.Logger, databaseManager *DatabaseManager) *InteractionTracker {
+	return &InteractionTracker{
+		logger:          logger,
+		databaseManager: databaseManager,
+		records:         make(map[string]*PersistedInteractions),
+	}
+}
+
+// LoadPlayer reads a player's persisted record into memory (called on join)
+func (it *InteractionTracker) LoadPlayer(ctx context.Context, playerID string) {
+	if _, err := it.record(ctx, playerID); err != nil {
+		it.logger.Error("Failed to load interactions for %s: %v", playerID, err)
+	}
+}
+
+// UnloadPlayer persists and drops a player's record (called on leave)
+func (it *InteractionTracker) UnloadPlayer(ctx context.Context, playerID string) {
+	it.mu.Lock()
+	rec, ok := it.records[playerID]
+	delete(it.records, playerID)
+	it.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	it.pruneExpired(rec, time.Now().UnixMilli())
+	if err := it.databaseManager.SavePlayerInteractions(ctx, rec); err != nil {
+		it.logger.Error("Failed to save interactions for %s on leave: %v", playerID, err)
+	}
+}
+
+// SetCooldown starts (or restarts) a cooldown for the given player and key
+func (it *InteractionTracker) SetCooldown(ctx context.Context, playerID, key string, seconds float64) error {
+	rec, err := it.record(ctx, playerID)
+	if err != nil {
+		return err
+	}
+
+	it.mu.Lock()
+	rec.Cooldowns[key] = time.Now().Add(time.Duration(seconds * float64(time.Second))).UnixMilli()
+	it.mu.Unlock()
+
+	return it.databaseManager.SavePlayerInteractions(ctx, rec)
+}
+
+// IsOnCooldown reports whether the key is still cooling down and the remaining time in seconds
+func (it *InteractionTracker) IsOnCooldown(ctx context.Context, playerID, key string) (bool, float64) {
+	rec, err := it.record(ctx, playerID)
+	if err != nil {
+		return false, 0
+	}
+
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	expiry, ok := rec.Cooldowns[key]
+	if !ok {
+		return false, 0
+	}
+	remaining := expiry - time.Now().UnixMilli()
+	if remaining <= 0 {
+		delete(rec.Cooldowns, key)
+		return false, 0
+	}
+	return true, float64(remaining) / 1000.0
+}
+
+// MarkDoneOnce records that the player completed the key. It returns true only the first time,
+// so callers can gate one-time rewards on the result. When the record can't be saved the key is
+// left undone and false is returned with the error, so nothing is granted that a restart would
+// grant again.
+func (it *InteractionTracker) MarkDoneOnce(ctx context.Context, playerID, key string) (bool, error) {
+	rec, err := it.record(ctx, playerID)
+	if err != nil {
+		return false, err
+	}
+
+	it.mu.Lock()
+	if _, done := rec.Done[key]; done {
+		it.mu.Unlock()
+		return false, nil
+	}
+	rec.Done[key] = time.Now().UnixMilli()
+	it.mu.Unlock()
+
+	// Persist immediately so a crash can't hand out the reward twice
+	if err := it.databaseManager.SavePlayerInteractions(ctx, rec); err != nil {
+		it.mu.Lock()
+		delete(rec.Done, key)
+		it.mu.Unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// IsDone reports whether the player has already completed the key
+func (it *InteractionTracker) IsDone(ctx context.Context, playerID, key string) bool {
+	rec, err := it.record(ctx, playerID)
+	if err != nil {
+		return false
+	}
+
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	_, done := rec.Done[key]
+	return done
+}
+
+// record returns the in-memory record for a player, loading it from storage if needed
+func (it *InteractionTracker) record(ctx context.Context, playerID string) (*PersistedInteractions, error) {
+	it.mu.Lock()
+	rec, ok := it.records[playerID]
+	it.mu.Unlock()
+	if ok {
+		return rec, nil
+	}
+
+	rec, err := it.databaseManager.LoadPlayerInteractions(ctx, playerID)
+	if err != nil {
+		return nil, err
+	}
+
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	// Another caller may have loaded it meanwhile; keep the first one
+	if existing, ok := it.records[playerID]; ok {
+		return existing, nil
+	}
+	it.records[playerID] = rec
+	return rec, nil
+}
+
+// pruneExpired drops cooldowns that have already elapsed so records don't grow forever
+func (it *InteractionTracker) pruneExpired(rec *PersistedInteractions, nowMillis int64) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	for key, expiry := range rec.Cooldowns {
+		if expiry <= nowMillis {
+			delete(rec.Cooldowns, key)
+		}
+	}
+}
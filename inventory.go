@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var errNotEnoughItems = errors.New("not enough items")
+
+// InventoryManager keeps the item stacks of connected players in memory and writes every
+// change through to storage, so items can't be duplicated or lost by a crash mid-session.
+type InventoryManager struct {
+	logger          runtime.Logger
+	databaseManager *DatabaseManager
+	inventories     map[string]*PersistedInventory // player ID -> loaded inventory
+	mu              sync.Mutex
+}
+
+// InventoryUpdate is the payload sent to a player whenever their inventory changes
+type InventoryUpdate struct {
+	Items map[string]int `json:"items"`
+}
+
+// NewInventoryManager creates a new inventory manager backed by the given database manager
+func NewInventoryManager(logger runtime.Logger, databaseManager *DatabaseManager) *InventoryManager {
+	return &InventoryManager{
+		logger:          logger,
+		databaseManager: databaseManager,
+		inventories:     make(map[string]*PersistedInventory),
+	}
+}
+
+// LoadPlayer reads a player's inventory into memory (called on join)
+func (im *InventoryManager) LoadPlayer(ctx context.Context, playerID string) {
+	if _, err := im.inventory(ctx, playerID); err != nil {
+		im.logger.Error("Failed to load inventory for %s: %v", playerID, err)
+	}
+}
+
+// UnloadPlayer drops a player's inventory from memory (called on leave). Changes are already
+// persisted when they happen, so nothing needs to be written here.
+func (im *InventoryManager) UnloadPlayer(playerID string) {
+	im.mu.Lock()
+	delete(im.inventories, playerID)
+	im.mu.Unlock()
+}
+
+// Count returns how many of an item the player owns
+func (im *InventoryManager) Count(ctx context.Context, playerID, itemID string) int {
+	inv, err := im.inventory(ctx, playerID)
+	if err != nil {
+		return 0
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return inv.Items[itemID]
+}
+
+// Items returns a copy of the player's item stacks
+func (im *InventoryManager) Items(ctx context.Context, playerID string) map[string]int {
+	inv, err := im.inventory(ctx, playerID)
+	if err != nil {
+		return map[string]int{}
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	items := make(map[string]int, len(inv.Items))
+	for id, count := range inv.Items {
+		items[id] = count
+	}
+	return items
+}
+
+// Add gives count items to the player and persists the inventory, in one commit with the
+// records given in with (e.g. the world items a pickup took the stack from)
+func (im *InventoryManager) Add(ctx context.Context, playerID, itemID string, count int, with ...*runtime.StorageWrite) error {
+	if count <= 0 {
+		return nil
+	}
+	inv, err := im.inventory(ctx, playerID)
+	if err != nil {
+		return err
+	}
+
+	im.mu.Lock()
+	inv.Items[itemID] += count
+	im.mu.Unlock()
+
+	if err := im.databaseManager.SavePlayerInventory(ctx, inv, with...); err != nil {
+		// Roll back so memory doesn't drift from storage
+		im.mu.Lock()
+		im.decrement(inv, itemID, count)
+		im.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Remove takes count items from the player and persists the inventory, in one commit with the
+// records given in with. It fails with errNotEnoughItems (and changes nothing) if the player
+// owns fewer than count.
+func (im *InventoryManager) Remove(ctx context.Context, playerID, itemID string, count int, with ...*runtime.StorageWrite) error {
+	if count <= 0 {
+		return nil
+	}
+	inv, err := im.inventory(ctx, playerID)
+	if err != nil {
+		return err
+	}
+
+	im.mu.Lock()
+	if inv.Items[itemID] < count {
+		im.mu.Unlock()
+		return errNotEnoughItems
+	}
+	im.decrement(inv, itemID, count)
+	im.mu.Unlock()
+
+	if err := im.databaseManager.SavePlayerInventory(ctx, inv, with...); err != nil {
+		im.mu.Lock()
+		inv.Items[itemID] += count
+		im.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// RemoveAll takes several item stacks (item ID -> count) from the player in one write, together
+// with the records given in with. Either every stack is removed or, on errNotEnoughItems or a
+// storage error, none is.
+func (im *InventoryManager) RemoveAll(ctx context.Context, playerID string, items map[string]int, with ...*runtime.StorageWrite) error {
+	if len(items) == 0 {
+		return nil
+	}
+	inv, err := im.inventory(ctx, playerID)
+	if err != nil {
+		return err
+	}
+
+	im.mu.Lock()
+	for itemID, count := range items {
+		if inv.Items[itemID] < count {
+			im.mu.Unlock()
+			return errNotEnoughItems
+		}
+	}
+	for itemID, count := range items {
+		im.decrement(inv, itemID, count)
+	}
+	im.mu.Unlock()
+
+	if err := im.databaseManager.SavePlayerInventory(ctx, inv, with...); err != nil {
+		im.mu.Lock()
+		for itemID, count := range items {
+			inv.Items[itemID] += count
+		}
+		im.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// SyncToClient sends the player's full inventory to their client
+func (im *InventoryManager) SyncToClient(ctx context.Context, gameState *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gameState.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+
+	data, err := EncodeMessage(OpCodeInventoryUpdate, "inventory_update", InventoryUpdate{Items: im.Items(ctx, playerID)})
+	if err != nil {
+		im.logger.Error("Failed to marshal inventory update for %s: %v", playerID, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeInventoryUpdate, data, []runtime.Presence{presence}, nil, true)
+}
+
+// decrement lowers a stack and removes it when empty; callers must hold im.mu
+func (im *InventoryManager) decrement(inv *PersistedInventory, itemID string, count int) {
+	inv.Items[itemID] -= count
+	if inv.Items[itemID] <= 0 {
+		delete(inv.Items, itemID)
+	}
+}
+
+// inventory returns the in-memory inventory for a player, loading it from storage if needed
+func (im *InventoryManager) inventory(ctx context.Context, playerID string) (*PersistedInventory, error) {
+	im.mu.Lock()
+	inv, ok := im.inventories[playerID]
+	im.mu.Unlock()
+	if ok {
+		return inv, nil
+	}
+
+	inv, err := im.databaseManager.LoadPlayerInventory(ctx, playerID)
+	if err != nil {
+		return nil, err
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	// Another caller may have loaded it meanwhile; keep the first one
+	if existing, ok := im.inventories[playerID]; ok {
+		return existing, nil
+	}
+	im.inventories[playerID] = inv
+	return inv, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Item effect types supported by use_item
+const (
+	ItemEffectHeal   = "heal"   // restores Amount health
+	ItemEffectBuff   = "buff"   // adds Amount to Stat for Duration seconds
+	ItemEffectSpawn  = "spawn"  // places an object with SpawnGID at the player's position
+	ItemEffectScript = "script" // runs Script; the item is only consumed if the script succeeds
+	ItemEffectPet    = "pet"    // adopts the pet Pet (pets.go)
+	ItemEffectLight  = "light"  // lights or puts out a carried light of radius Amount (vision.go); never consumed
+	ItemEffectFood   = "food"   // restores Hunger and Thirst on survival maps (survival.go)
+	ItemEffectTrap   = "trap"   // places the trap Trap at the player's feet (traps.go)
+)
+
+// ItemDefinition describes an item and what happens when a player uses it
+type ItemDefinition struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	Effect   string      `json:"effect,omitempty"`
+	Amount   float64     `json:"amount,omitempty"`
+	Stat     string      `json:"stat,omitempty"`     // buffed stat (e.g. "speed")
+	Duration float64     `json:"duration,omitempty"` // buff duration in seconds
+	SpawnGID uint32      `json:"spawnGid,omitempty"` // tile GID of the spawned object
+	Script   string      `json:"script,omitempty"`   // script run by the "script" effect, or by spawned objects on interact
+	Reusable bool        `json:"reusable,omitempty"` // reusable items are not removed from the inventory on use
+	WorldGID uint32      `json:"worldGid,omitempty"` // tile GID shown when the item lies in the world
+	Pet      string      `json:"pet,omitempty"`      // pet adopted by the "pet" effect
+	Hunger   float64     `json:"hunger,omitempty"`   // hunger meter restored on use, with any effect (survival maps)
+	Thirst   float64     `json:"thirst,omitempty"`   // thirst meter restored on use, with any effect (survival maps)
+	Color    string      `json:"color,omitempty"`    // light color of "light" items ("#rrggbb")
+	Flicker  float64     `json:"flicker,omitempty"`  // 0-1, how much the light of "light" items flickers
+	Trap     *TrapConfig `json:"trap,omitempty"`     // trap placed by the "trap" effect
+
+	DropOnDeath bool `json:"dropOnDeath,omitempty"` // the whole stack falls out of the inventory when the owner dies
+}
+
+// ItemCatalog holds the item definitions loaded from the item config table
+type ItemCatalog struct {
+	logger runtime.Logger
+	items  map[string]*ItemDefinition
+	mu     sync.RWMutex
+}
+
+// NewItemCatalog creates a catalog and loads definitions from path (a JSON object keyed by item ID)
+func NewItemCatalog(logger runtime.Logger, path string) *ItemCatalog {
+	ic := &ItemCatalog{
+		logger: logger,
+		items:  make(map[string]*ItemDefinition),
+	}
+	if err := ic.Load(path); err != nil {
+		logger.Warn("Failed to load item definitions from %s: %v", path, err)
+	}
+	return ic
+}
+
+// Load replaces the catalog with the definitions found in path
+func (ic *ItemCatalog) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var items map[string]*ItemDefinition
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	for id, def := range items {
+		def.ID = id
+	}
+
+	ic.mu.Lock()
+	ic.items = items
+	ic.mu.Unlock()
+
+	ic.logger.Info("Loaded %d item definitions from %s", len(items), path)
+	return nil
+}
+
+// Get returns the definition for an item ID
+func (ic *ItemCatalog) Get(itemID string) (*ItemDefinition, bool) {
+	ic.mu.RLock()
+	defer ic.mu.RUnlock()
+	def, ok := ic.items[itemID]
+	return def, ok
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// maxJournalPage caps how many journal entries one admin_journal call returns
+const maxJournalPage = 100
+
+// Action journal entry kinds
+const (
+	JournalItemGrant     = "item_grant"     // items (and currency) given to a player: pickups, /give, rewards, auction claims
+	JournalCurrency      = "currency"       // a wallet change on its own, e.g. a travel fee
+	JournalTrade         = "trade"          // items and currency changing hands between two players
+	JournalContainerOpen = "container_open" // a container looted by a player
+	JournalPurchase      = "purchase"       // items bought from a vendor
+)
+
+// Action journal stages: an entry is written as pending before its mutation, and an outcome
+// (done or failed) after it
+const (
+	JournalPending = "pending"
+	JournalDone    = "done"
+	JournalFailed  = "failed"
+)
+
+// errJournalDuplicate is returned by Begin when the idempotency key was used before: the action
+// already ran (or started) once and must not be applied again
+var errJournalDuplicate = errors.New("action already journaled")
+
+// JournalEntry is one critical mutation. Key is its idempotency key, unique per player; items
+// and currency are positive when the player gains them.
+type JournalEntry struct {
+	Key         string           `json:"key"`
+	Kind        string           `json:"kind"`
+	Stage       string           `json:"stage"`
+	PlayerID    string           `json:"playerId"`
+	Counterpart string           `json:"counterpart,omitempty"` // the other player of a trade
+	Items       map[string]int   `json:"items,omitempty"`
+	Currency    map[string]int64 `json:"currency,omitempty"`
+	Source      string           `json:"source,omitempty"` // what caused it, e.g. "dungeon:crypt"
+	MatchID     string           `json:"matchId,omitempty"`
+	Map         string           `json:"map,omitempty"`
+	Error       string           `json:"error,omitempty"` // why a failed entry failed
+	Time        time.Time        `json:"time"`
+}
+
+// ActionJournal is the append-only journal of a match's critical mutations (item grants,
+// currency changes, trades, container opens), kept in storage so support can investigate loss
+// reports and a crash mid-operation leaves a pending entry without outcome to reconcile.
+// Entries are written once under their idempotency key and never changed; the outcome is a
+// second record. A journal write that fails is logged and doesn't stop the action, only a
+// reused key does.
+type ActionJournal struct {
+	logger  runtime.Logger
+	db      *DatabaseManager
+	matchID string
+	mapName string
+	seq     atomic.Uint64 // last sequence number handed out by UniqueKey
+}
+
+// NewActionJournal creates the journal of a match; Configure sets the match and map it records
+func NewActionJournal(logger runtime.Logger, db *DatabaseManager) *ActionJournal {
+	return &ActionJournal{logger: logger, db: db}
+}
+
+// Configure sets the match and map recorded with every entry
+func (aj *ActionJournal) Configure(matchID, mapName string) {
+	aj.matchID, aj.mapName = matchID, mapName
+}
+
+// Key returns an idempotency key made of its parts, e.g. Key("pickup", 42) ->
+// "pickup:<match ID>:42" for actions that can only happen once per match
+func (aj *ActionJournal) Key(kind string, parts ...any) string {
+	key := kind + ":" + aj.matchID
+	for _, part := range parts {
+		key += fmt.Sprintf(":%v", part)
+	}
+	return key
+}
+
+// UniqueKey returns a key like Key's with the match's next sequence number appended, for actions
+// a player may repeat within a tick (purchases, fees, travels, /give): the key only guards one
+// action against being recorded twice
+func (aj *ActionJournal) UniqueKey(kind string, parts ...any) string {
+	return aj.Key(kind, append(parts, aj.seq.Add(1))...)
+}
+
+// Begin writes an entry as pending before its mutation. It returns errJournalDuplicate when the
+// player already has an entry with the key. Bots have no storage and aren't journaled.
+func (aj *ActionJournal) Begin(ctx context.Context, entry *JournalEntry) error {
+	if IsBot(entry.PlayerID) {
+		return nil
+	}
+	entry.Stage = JournalPending
+	entry.MatchID, entry.Map = aj.matchID, aj.mapName
+	entry.Time = time.Now().UTC()
+	err := aj.db.AppendJournal(ctx, COLLECTION_ACTION_JOURNAL, entry)
+	if err == nil {
+		return nil
+	}
+	if existing, rerr := aj.db.ReadJournal(ctx, COLLECTION_ACTION_JOURNAL, entry.PlayerID, []string{entry.Key}); rerr == nil && existing[entry.Key] != nil {
+		aj.logger.Warn("Journal: %s for %s already applied; skipping", entry.Key, entry.PlayerID)
+		return errJournalDuplicate
+	}
+	aj.logger.Error("Journal: failed to record %s for %s: %v", entry.Key, entry.PlayerID, err)
+	return nil
+}
+
+// Finish records the outcome of an entry: done, or failed with err. Items and currency are
+// recorded as the entry holds them now, so callers set them to what was actually granted.
+func (aj *ActionJournal) Finish(ctx context.Context, entry *JournalEntry, err error) {
+	if IsBot(entry.PlayerID) {
+		return
+	}
+	outcome := *entry
+	outcome.Stage = JournalDone
+	if err != nil {
+		outcome.Stage = JournalFailed
+		outcome.Error = err.Error()
+	}
+	outcome.Time = time.Now().UTC()
+	if werr := aj.db.AppendJournal(ctx, COLLECTION_JOURNAL_OUTCOMES, &outcome); werr != nil {
+		aj.logger.Error("Journal: failed to record the outcome of %s for %s: %v", entry.Key, entry.PlayerID, werr)
+	}
+}
+
+// stackItems sums loot stacks by item, as journal entries record them
+func stackItems(stacks []LootStack) map[string]int {
+	items := make(map[string]int, len(stacks))
+	for _, stack := range stacks {
+		items[stack.ItemID] += stack.Count
+	}
+	return items
+}
+
+// tradeJournalWrites returns the journal records of a trade for both players, written as done
+// in the same transaction as the trade itself. items are what the buyer gets and the seller
+// gives up; paid and earned are the wallet changes of the buyer and the seller.
+func tradeJournalWrites(key, buyerID, sellerID, source string, items map[string]int, paid, earned map[string]int64) []*runtime.StorageWrite {
+	now := time.Now().UTC()
+	sold := make(map[string]int, len(items))
+	for itemID, count := range items {
+		sold[itemID] = -count
+	}
+	entries := []*JournalEntry{
+		{Key: key, Kind: JournalTrade, PlayerID: buyerID, Counterpart: sellerID, Items: items, Currency: paid, Source: source, Time: now},
+		{Key: key, Kind: JournalTrade, PlayerID: sellerID, Counterpart: buyerID, Items: sold, Currency: earned, Source: source, Time: now},
+	}
+	writes := make([]*runtime.StorageWrite, 0, 2*len(entries))
+	for _, entry := range entries {
+		entry.Stage = JournalPending
+		writes = append(writes, journalWrite(COLLECTION_ACTION_JOURNAL, entry))
+		done := *entry
+		done.Stage = JournalDone
+		writes = append(writes, journalWrite(COLLECTION_JOURNAL_OUTCOMES, &done))
+	}
+	return writes
+}
+
+// JournalRecord is an entry as returned by admin_journal: the pending record and its outcome
+// (nil while the action hasn't finished, e.g. after a crash)
+type JournalRecord struct {
+	*JournalEntry
+	Outcome *JournalEntry `json:"outcome,omitempty"`
+}
+
+// rpcAdminJournal pages through a player's action journal, newest first within the page.
+// unfinished keeps only the entries without outcome, the ones to reconcile after a crash.
+// Payload: {"playerId": "...", "unfinished": false, "limit": 50, "cursor": "optional"}
+func rpcAdminJournal(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	req := struct {
+		PlayerID   string `json:"playerId"`
+		Unfinished bool   `json:"unfinished"`
+		Limit      int    `json:"limit"`
+		Cursor     string `json:"cursor"`
+	}{Limit: 50}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.PlayerID == "" {
+		return "", errInvalidPayload
+	}
+	if req.Limit <= 0 || req.Limit > maxJournalPage {
+		req.Limit = maxJournalPage
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	entries, cursor, err := dm.ListJournal(ctx, req.PlayerID, req.Limit, req.Cursor)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	outcomes, err := dm.ReadJournal(ctx, COLLECTION_JOURNAL_OUTCOMES, req.PlayerID, keys)
+	if err != nil {
+		return "", errInternalFailure
+	}
+
+	records := make([]JournalRecord, 0, len(entries))
+	for _, entry := range entries {
+		outcome := outcomes[entry.Key]
+		if req.Unfinished && outcome != nil {
+			continue
+		}
+		records = append(records, JournalRecord{JournalEntry: entry, Outcome: outcome})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Time.After(records[j].Time) })
+
+	out, err := json.Marshal(map[string]interface{}{"entries": records, "cursor": cursor})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
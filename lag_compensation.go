@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Lag compensation tuning
+const (
+	positionHistoryTicks     = TickRate     // ticks of player and NPC positions kept for rewinding and get_entity_position_at
+	maxRewindTicks           = TickRate / 5 // furthest back (200ms) a client's view tick is honored
+	worldUpdateIntervalTicks = 2            // world updates go out every other tick outside regions with their own rate
+)
+
+// positionFrame holds where every player and NPC stood at the end of one tick
+type positionFrame struct {
+	tick    int64
+	players map[string]vector.Vector
+	npcs    map[int]vector.Vector
+}
+
+// PositionHistory is a ring buffer of recent positions. Hits that clients aim at what they see
+// (area abilities and projectiles) are resolved against the positions of the tick they were
+// looking at, so latency doesn't make targets dodge what was on their screen. Scripts read it
+// with get_entity_position_at.
+type PositionHistory struct {
+	frames [positionHistoryTicks]positionFrame
+}
+
+// NewPositionHistory creates an empty history
+func NewPositionHistory() *PositionHistory {
+	h := &PositionHistory{}
+	for i := range h.frames {
+		h.frames[i] = positionFrame{
+			tick:    -1,
+			players: make(map[string]vector.Vector),
+			npcs:    make(map[int]vector.Vector),
+		}
+	}
+	return h
+}
+
+// Record stores the positions at the end of the current tick. Called from the match loop after
+// everything moved.
+func (h *PositionHistory) Record(gs *GameMatchState) {
+	frame := &h.frames[gs.currentTick%positionHistoryTicks]
+	frame.tick = gs.currentTick
+	clear(frame.players)
+	clear(frame.npcs)
+	for playerID, rb := range gs.PlayerBodies() {
+		frame.players[playerID] = rb.Position
+	}
+	nm := gs.npcManager
+	nm.mu.RLock()
+	for id, npc := range nm.live() {
+		frame.npcs[id] = npc.Body.Position
+	}
+	nm.mu.RUnlock()
+}
+
+// frame returns the recorded frame of a tick, or nil if it is no longer (or not yet) kept
+func (h *PositionHistory) frame(tick int64) *positionFrame {
+	if tick < 0 {
+		return nil
+	}
+	frame := &h.frames[tick%positionHistoryTicks]
+	if frame.tick != tick {
+		return nil
+	}
+	return frame
+}
+
+// PlayerAt returns where a player stood at a tick, falling back to their current position
+func (gs *GameMatchState) PlayerAt(playerID string, tick int64) (vector.Vector, bool) {
+	if frame := gs.positionHistory.frame(tick); frame != nil {
+		if pos, ok := frame.players[playerID]; ok {
+			return pos, true
+		}
+	}
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return vector.Vector{}, false
+	}
+	return rb.Position, true
+}
+
+// npcAt returns where an NPC stood at a tick, falling back to its current position. The caller
+// holds the NPC manager's lock.
+func (gs *GameMatchState) npcAt(npc *NPC, tick int64) vector.Vector {
+	if frame := gs.positionHistory.frame(tick); frame != nil {
+		if pos, ok := frame.npcs[npc.ID]; ok {
+			return pos
+		}
+	}
+	return npc.Body.Position
+}
+
+// EntityPositionAt returns where an entity stood ticksAgo ticks ago: a player by user ID or an
+// NPC (pets included) by its numeric ID. Looks further back than the history are clamped to its
+// oldest tick, and entities missing from the frame (spawned since, or before this tick was
+// recorded) report their current position. It returns false for entities not in the match.
+func (gs *GameMatchState) EntityPositionAt(entityID string, ticksAgo int64) (vector.Vector, bool) {
+	ticksAgo = int64(math.Max(0, math.Min(positionHistoryTicks-1, float64(ticksAgo))))
+	tick := gs.currentTick - ticksAgo
+	npcID, err := strconv.Atoi(entityID)
+	if err != nil {
+		return gs.PlayerAt(entityID, tick)
+	}
+	nm := gs.npcManager
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	npc, ok := nm.npcs[npcID]
+	if !ok {
+		return vector.Vector{}, false
+	}
+	return gs.npcAt(npc, tick), true
+}
+
+// RewindTick returns the tick to resolve a player's input against: the tick of the world update
+// the client last saw (its viewTick), no further back than the player's rewind limit. Inputs
+// without a viewTick are rewound by the player's one-way latency when their RTT is known, and
+// use the current tick otherwise.
+func (gs *GameMatchState) RewindTick(playerID string, viewTick int64) int64 {
+	limit := gs.rewindLimit(playerID)
+	if viewTick <= 0 || viewTick >= gs.currentTick {
+		if rtt, ok := gs.clock.RTT(playerID); ok {
+			return gs.currentTick - int64(math.Min(float64(limit), rtt/2*TickRate/1000))
+		}
+		return gs.currentTick
+	}
+	if gs.currentTick-viewTick > limit {
+		return gs.currentTick - limit
+	}
+	return viewTick
+}
+
+// rewindLimit is how many ticks a player's inputs may be rewound: their one-way latency plus the
+// interval between world updates, at most maxRewindTicks. Players without an RTT sample get
+// maxRewindTicks.
+func (gs *GameMatchState) rewindLimit(playerID string) int64 {
+	rtt, ok := gs.clock.RTT(playerID)
+	if !ok {
+		return maxRewindTicks
+	}
+	return int64(math.Min(maxRewindTicks, math.Ceil(rtt/2*TickRate/1000)+float64(gs.worldUpdateInterval(playerID))))
+}
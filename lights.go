@@ -0,0 +1,241 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// LightData is a lit light as sent in world_update
+type LightData struct {
+	ID       int     `json:"id,omitempty"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Radius   float64 `json:"radius"`
+	Color    string  `json:"color,omitempty"`
+	Flicker  float64 `json:"flicker,omitempty"`
+	ObjectID int     `json:"objectId,omitempty"`
+	PlayerID string  `json:"playerId,omitempty"`
+}
+
+// clampFlicker keeps a flicker amount in 0..1
+func clampFlicker(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// LightManager holds the light entities of the match other than the lights players carry: the
+// map's "light" objects, lights attached to map objects with a "light" property and lights
+// scripts place or attach. Lights can be lit and put out (a campfire) and are removed with the
+// object they are attached to.
+type LightManager struct {
+	logger runtime.Logger
+	lights map[int]*LightSource // light ID -> light
+	nextID int
+	mu     sync.Mutex
+}
+
+// NewLightManager creates an empty light manager
+func NewLightManager(logger runtime.Logger) *LightManager {
+	return &LightManager{
+		logger: logger,
+		lights: make(map[int]*LightSource),
+	}
+}
+
+// LoadFromMap registers the map's "light" objects and a light for each map object with a
+// "light" property (its radius), lit unless the object's "lit" property is false
+func (lm *LightManager) LoadFromMap(gs *GameMatchState) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.lights = make(map[int]*LightSource)
+	lm.nextID = 0
+	if gs.currentMap == nil {
+		return
+	}
+	for i := range gs.currentMap.Lights {
+		light := gs.currentMap.Lights[i]
+		lm.lights[light.ID] = &light
+		if light.ID > lm.nextID {
+			lm.nextID = light.ID
+		}
+	}
+
+	var attached []*LightSource
+	gs.mu.Lock()
+	for oid, obj := range gs.Objects() {
+		if oid > lm.nextID {
+			lm.nextID = oid
+		}
+		radius, ok := obj.Props["light"].(float64)
+		if !ok || radius <= 0 {
+			continue
+		}
+		light := &LightSource{Name: obj.Name, Radius: radius, Lit: true, ObjectID: oid}
+		light.Color, _ = obj.Props["lightcolor"].(string)
+		if v, ok := obj.Props["lightflicker"].(float64); ok {
+			light.Flicker = clampFlicker(v)
+		}
+		if lit, ok := obj.Props["lit"].(bool); ok {
+			light.Lit = lit
+		}
+		attached = append(attached, light)
+	}
+	gs.mu.Unlock()
+	// IDs start above every map object ID so they never match a "light" object's
+	sort.Slice(attached, func(i, j int) bool { return attached[i].ObjectID < attached[j].ObjectID })
+	for _, light := range attached {
+		lm.add(light)
+	}
+	lm.logger.Info("Registered %d lights", len(lm.lights))
+}
+
+// add gives a light the next free ID and registers it. Callers hold lm.mu.
+func (lm *LightManager) add(light *LightSource) int {
+	lm.nextID++
+	light.ID = lm.nextID
+	lm.lights[light.ID] = light
+	return light.ID
+}
+
+// Place adds a lit light at a fixed position and returns its ID
+func (lm *LightManager) Place(name string, position vector.Vector, radius float64, color string, flicker float64) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.add(&LightSource{Name: name, Position: position, Radius: radius, Color: color, Flicker: clampFlicker(flicker), Lit: true})
+}
+
+// Attach adds a lit light that follows an object and returns its ID. The light takes the
+// object's name. It returns false for unknown objects.
+func (lm *LightManager) Attach(gs *GameMatchState, oid int, radius float64, color string, flicker float64) (int, bool) {
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	name := ""
+	if ok {
+		name = obj.Name
+	}
+	gs.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.add(&LightSource{Name: name, Radius: radius, Color: color, Flicker: clampFlicker(flicker), Lit: true, ObjectID: oid}), true
+}
+
+// SetLit lights or puts out the light with the given ID, or with name every light of that name
+// (id 0). It returns how many lights matched.
+func (lm *LightManager) SetLit(id int, name string, lit bool) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	matched := 0
+	for _, light := range lm.lights {
+		if (id != 0 && light.ID == id) || (id == 0 && name != "" && light.Name == name) {
+			light.Lit = lit
+			matched++
+		}
+	}
+	return matched
+}
+
+// Remove deletes a light and reports whether it existed
+func (lm *LightManager) Remove(id int) bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	_, ok := lm.lights[id]
+	delete(lm.lights, id)
+	return ok
+}
+
+// Exists reports whether a light exists
+func (lm *LightManager) Exists(id int) bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	_, ok := lm.lights[id]
+	return ok
+}
+
+// Follow moves a light that follows a player or NPC (attachments.go) to its parent's position;
+// playerID is the player carrying it, whose visibility it shares. Without move it only lets go
+// of the carrier. It reports whether the light exists.
+func (lm *LightManager) Follow(id int, position vector.Vector, playerID string, move bool) bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	light, ok := lm.lights[id]
+	if !ok {
+		return false
+	}
+	light.PlayerID = playerID
+	if move {
+		light.Position = position
+		light.ObjectID = 0
+	}
+	return true
+}
+
+// Detach removes the lights attached to an object that left the world
+func (lm *LightManager) Detach(oid int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	for id, light := range lm.lights {
+		if light.ObjectID == oid {
+			delete(lm.lights, id)
+		}
+	}
+}
+
+// Lit returns the lit lights, attached lights at their object's current position
+func (lm *LightManager) Lit(gs *GameMatchState) []LightSource {
+	lm.mu.Lock()
+	lights := make([]LightSource, 0, len(lm.lights))
+	for _, light := range lm.lights {
+		if light.Lit {
+			lights = append(lights, *light)
+		}
+	}
+	lm.mu.Unlock()
+	sort.Slice(lights, func(i, j int) bool { return lights[i].ID < lights[j].ID })
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	placed := lights[:0]
+	for _, light := range lights {
+		if light.ObjectID != 0 {
+			obj, ok := gs.Object(light.ObjectID)
+			if !ok {
+				continue
+			}
+			if light.Position, ok = obj.Position(); !ok {
+				continue
+			}
+		}
+		placed = append(placed, light)
+	}
+	return placed
+}
+
+// lightData converts lit lights for world_update, leaving out the lights carried by players the
+// viewer isn't sent (players nil: every light)
+func lightData(lights []LightSource, players map[string]PlayerData) []LightData {
+	data := make([]LightData, 0, len(lights))
+	for _, light := range lights {
+		if light.PlayerID != "" && players != nil {
+			if _, visible := players[light.PlayerID]; !visible {
+				continue
+			}
+		}
+		data = append(data, LightData{
+			ID:       light.ID,
+			X:        light.Position.X,
+			Y:        light.Position.Y,
+			Radius:   light.Radius,
+			Color:    light.Color,
+			Flicker:  light.Flicker,
+			ObjectID: light.ObjectID,
+			PlayerID: light.PlayerID,
+		})
+	}
+	return data
+}
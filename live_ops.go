@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Live-ops event notifications published on the event bus
+const (
+	EventLiveOpsStart = "live_ops_start" // id, name
+	EventLiveOpsEnd   = "live_ops_end"   // id, name
+)
+
+// Live-ops tuning
+const (
+	liveOpsCheckInterval = 60 * TickRate // ticks between checks of the events' date ranges
+	maxLiveOpsEvents     = 100
+)
+
+var errInvalidLiveOps = runtime.NewError("invalid live-ops events: at most 100, each with a unique id, a start before its end, a positive xpMultiplier (or none) and an npc for every spawn", rpcCodeInvalidArgument)
+
+// LiveOpsEvent is a seasonal or live-ops event: a set of modifiers that apply between Start and
+// End on its maps
+type LiveOpsEvent struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name,omitempty"`
+	Start         time.Time         `json:"start"` // RFC 3339
+	End           time.Time         `json:"end"`
+	Maps          []string          `json:"maps,omitempty"`          // map files it applies to (every map when empty)
+	XPMultiplier  float64           `json:"xpMultiplier,omitempty"`  // multiplies progression gains (0 = unchanged)
+	Spawns        []LiveOpsSpawn    `json:"spawns,omitempty"`        // NPCs present while the event runs
+	GIDOverrides  map[uint32]uint32 `json:"gidOverrides,omitempty"`  // map object tile GID -> GID shown instead
+	LootOverrides map[string]string `json:"lootOverrides,omitempty"` // loot table ID -> table rolled instead
+}
+
+// LiveOpsSpawn is an NPC spawned when its event starts and removed when it ends
+type LiveOpsSpawn struct {
+	NPC    string  `json:"npc"`
+	Marker string  `json:"marker,omitempty"` // named map marker to spawn at (X/Y when empty)
+	X      float64 `json:"x,omitempty"`
+	Y      float64 `json:"y,omitempty"`
+	Count  int     `json:"count,omitempty"` // default 1
+}
+
+// LiveOpsConfig is the stored live-ops configuration, edited with admin_live_ops
+type LiveOpsConfig struct {
+	Events []*LiveOpsEvent `json:"events"`
+}
+
+// runsOn reports whether the event applies to a map
+func (e *LiveOpsEvent) runsOn(mapName string) bool {
+	if len(e.Maps) == 0 {
+		return true
+	}
+	for _, m := range e.Maps {
+		if m == mapName {
+			return true
+		}
+	}
+	return false
+}
+
+// LiveOpsData is a running live-ops event sent to clients
+type LiveOpsData struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name,omitempty"`
+	End          time.Time `json:"end"`
+	XPMultiplier float64   `json:"xpMultiplier,omitempty"`
+}
+
+// LiveOpsObject is a map object whose tile a running event swapped
+type LiveOpsObject struct {
+	ObjectID int    `json:"objectId"`
+	GID      uint32 `json:"gid"`
+}
+
+// LiveOpsSnapshot is what clients get on join and whenever the running events change
+type LiveOpsSnapshot struct {
+	Events  []LiveOpsData   `json:"events"`
+	Objects []LiveOpsObject `json:"objects,omitempty"`
+}
+
+// liveOpsGID is the tile of an object swapped by a running event
+type liveOpsGID struct {
+	original uint32
+	override uint32
+}
+
+// LiveOpsManager applies the live-ops events running on the match's map: it spawns their NPCs,
+// swaps their tiles and answers XP multiplier and loot table lookups. It is only used from the
+// match loop and match signals.
+type LiveOpsManager struct {
+	logger    runtime.Logger
+	events    []*LiveOpsEvent // configured for this map, in configuration order
+	running   map[string][]int
+	swapped   map[int]liveOpsGID // object ID -> its swapped tile
+	nextCheck int64
+}
+
+// NewLiveOpsManager creates a manager without events
+func NewLiveOpsManager(logger runtime.Logger) *LiveOpsManager {
+	return &LiveOpsManager{
+		logger:  logger,
+		running: make(map[string][]int),
+		swapped: make(map[int]liveOpsGID),
+	}
+}
+
+// Refresh loads the configuration from storage and applies it. Called on match init and when
+// admin_live_ops changes it (SignalLiveOps).
+func (lm *LiveOpsManager) Refresh(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) error {
+	config, err := gs.databaseManager.LoadLiveOps(ctx)
+	if err != nil {
+		return err
+	}
+	lm.events = lm.events[:0]
+	for _, event := range config.Events {
+		if event.runsOn(gs.currentMapName) {
+			lm.events = append(lm.events, event)
+		}
+	}
+	lm.evaluate(gs, dispatcher)
+	lm.logger.Info("Live-ops config loaded: %d events for %s, %d running", len(lm.events), gs.currentMapName, len(lm.running))
+	return nil
+}
+
+// Update starts and ends events as their date ranges pass. Called from the match loop.
+func (lm *LiveOpsManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick < lm.nextCheck {
+		return
+	}
+	lm.nextCheck = gs.currentTick + liveOpsCheckInterval
+	lm.evaluate(gs, dispatcher)
+}
+
+// evaluate starts the events whose date range began, ends the ones that are over or no longer
+// configured and applies the tile swaps of the running ones
+func (lm *LiveOpsManager) evaluate(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	now := time.Now()
+	wanted := make(map[string]*LiveOpsEvent, len(lm.events))
+	for _, event := range lm.events {
+		if !now.Before(event.Start) && now.Before(event.End) {
+			wanted[event.ID] = event
+		}
+	}
+
+	changed := false
+	for id, npcs := range lm.running {
+		if _, ok := wanted[id]; ok {
+			continue
+		}
+		for _, npcID := range npcs {
+			gs.npcManager.Despawn(gs, npcID)
+		}
+		delete(lm.running, id)
+		changed = true
+		lm.logger.Info("Live-ops event %s ended", id)
+		gs.eventBus.Publish(EventLiveOpsEnd, map[string]any{"id": id})
+	}
+	for _, event := range lm.events {
+		if _, ok := wanted[event.ID]; !ok {
+			continue
+		}
+		if _, ok := lm.running[event.ID]; ok {
+			continue
+		}
+		lm.running[event.ID] = lm.spawn(gs, event)
+		changed = true
+		lm.logger.Info("Live-ops event %s started (%d NPCs)", event.ID, len(lm.running[event.ID]))
+		gs.eventBus.Publish(EventLiveOpsStart, map[string]any{"id": event.ID, "name": event.Name})
+	}
+
+	if lm.swapTiles(gs, dispatcher) || changed {
+		lm.broadcast(gs, dispatcher)
+	}
+}
+
+// spawn places the NPCs of an event; they have no spawner, so they don't come back once killed
+func (lm *LiveOpsManager) spawn(gs *GameMatchState, event *LiveOpsEvent) []int {
+	npcs := make([]int, 0)
+	for _, spawn := range event.Spawns {
+		position := vector.Vector{X: spawn.X, Y: spawn.Y}
+		if spawn.Marker != "" && gs.currentMap != nil {
+			marker, ok := gs.currentMap.Markers[spawn.Marker]
+			if !ok {
+				lm.logger.Warn("Live-ops event %s: unknown spawn marker %q", event.ID, spawn.Marker)
+				continue
+			}
+			position = marker
+		}
+		count := spawn.Count
+		if count <= 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			npcID := gs.npcManager.Spawn(gs, spawn.NPC, position, nil)
+			if npcID == 0 {
+				lm.logger.Warn("Live-ops event %s: unknown NPC type %q", event.ID, spawn.NPC)
+				break
+			}
+			npcs = append(npcs, npcID)
+		}
+	}
+	return npcs
+}
+
+// swapTiles gives map objects the tiles the running events override and puts back the tiles of
+// events that ended. Objects whose tile something else changed meanwhile are left alone. It
+// reports whether any tile changed.
+func (lm *LiveOpsManager) swapTiles(gs *GameMatchState, dispatcher runtime.MatchDispatcher) bool {
+	overrides := make(map[uint32]uint32)
+	for _, event := range lm.events {
+		if _, ok := lm.running[event.ID]; !ok {
+			continue
+		}
+		for from, to := range event.GIDOverrides {
+			if _, taken := overrides[from]; !taken {
+				overrides[from] = to
+			}
+		}
+	}
+
+	updated := make([]int, 0)
+	gs.mu.Lock()
+	for oid, obj := range gs.Objects() {
+		swap, isSwapped := lm.swapped[oid]
+		original := obj.GID
+		if isSwapped {
+			if obj.GID != swap.override {
+				delete(lm.swapped, oid)
+				continue
+			}
+			original = swap.original
+		}
+		override, ok := overrides[original]
+		switch {
+		case ok && obj.GID != override:
+			obj.GID = override
+			lm.swapped[oid] = liveOpsGID{original: original, override: override}
+			updated = append(updated, oid)
+		case !ok && isSwapped:
+			obj.GID = original
+			delete(lm.swapped, oid)
+			updated = append(updated, oid)
+		}
+	}
+	gs.mu.Unlock()
+
+	sort.Ints(updated)
+	for _, oid := range updated {
+		gs.BroadcastObjectUpdate(oid, dispatcher, lm.logger)
+	}
+	return len(updated) > 0
+}
+
+// IsActive reports whether an event is running
+func (lm *LiveOpsManager) IsActive(id string) bool {
+	_, ok := lm.running[id]
+	return ok
+}
+
+// XPMultiplier is the product of the running events' XP multipliers (1 when none runs)
+func (lm *LiveOpsManager) XPMultiplier() float64 {
+	multiplier := 1.0
+	for _, event := range lm.events {
+		if _, ok := lm.running[event.ID]; ok && event.XPMultiplier > 0 {
+			multiplier *= event.XPMultiplier
+		}
+	}
+	return multiplier
+}
+
+// LootTable returns the table rolled in place of tableID: the override of the first running event
+// that has one, else tableID
+func (lm *LiveOpsManager) LootTable(tableID string) string {
+	for _, event := range lm.events {
+		if _, ok := lm.running[event.ID]; !ok {
+			continue
+		}
+		if override, ok := event.LootOverrides[tableID]; ok {
+			return override
+		}
+	}
+	return tableID
+}
+
+// Snapshot returns the running events and the tiles they swapped
+func (lm *LiveOpsManager) Snapshot(gs *GameMatchState) LiveOpsSnapshot {
+	snapshot := LiveOpsSnapshot{Events: make([]LiveOpsData, 0, len(lm.running))}
+	for _, event := range lm.events {
+		if _, ok := lm.running[event.ID]; ok {
+			snapshot.Events = append(snapshot.Events, LiveOpsData{ID: event.ID, Name: event.Name, End: event.End, XPMultiplier: event.XPMultiplier})
+		}
+	}
+	for oid, swap := range lm.swapped {
+		snapshot.Objects = append(snapshot.Objects, LiveOpsObject{ObjectID: oid, GID: swap.override})
+	}
+	sort.Slice(snapshot.Objects, func(i, j int) bool { return snapshot.Objects[i].ObjectID < snapshot.Objects[j].ObjectID })
+	return snapshot
+}
+
+// broadcast sends everyone the running events (OpCodeWorldEvent "live_ops")
+func (lm *LiveOpsManager) broadcast(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil || len(gs.presences) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeWorldEvent, "live_ops", lm.Snapshot(gs))
+	if err != nil {
+		lm.logger.Error("Failed to marshal live-ops events: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeWorldEvent, data, nil, nil, true)
+}
+
+// validLiveOps checks a configuration sent to admin_live_ops
+func validLiveOps(config *LiveOpsConfig) bool {
+	if len(config.Events) > maxLiveOpsEvents {
+		return false
+	}
+	seen := make(map[string]bool, len(config.Events))
+	for _, event := range config.Events {
+		if event == nil || event.ID == "" || seen[event.ID] || !event.Start.Before(event.End) || event.XPMultiplier < 0 {
+			return false
+		}
+		seen[event.ID] = true
+		for _, spawn := range event.Spawns {
+			if spawn.NPC == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rpcLiveOps returns the live-ops configuration, or replaces it and has every open world match
+// apply it.
+// Payload: {} to read, or {"events": [{"id": "harvest", "start": "2025-10-01T00:00:00Z", "end": "2025-10-15T00:00:00Z", ...}]}
+func rpcLiveOps(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		Events []*LiveOpsEvent `json:"events"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	if req.Events == nil {
+		config, err := dm.LoadLiveOps(ctx)
+		if err != nil {
+			return "", errInternalFailure
+		}
+		out, err := json.Marshal(config)
+		if err != nil {
+			return "", errInternalFailure
+		}
+		return string(out), nil
+	}
+
+	config := &LiveOpsConfig{Events: req.Events}
+	if !validLiveOps(config) {
+		return "", errInvalidLiveOps
+	}
+	if err := dm.SaveLiveOps(ctx, config); err != nil {
+		return "", errInternalFailure
+	}
+	responses, err := signalMatches(ctx, logger, nk, "", MatchSignalRequest{Type: SignalLiveOps})
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(map[string]interface{}{"events": config.Events, "matches": len(responses)})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
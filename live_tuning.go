@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Live tuning bounds
+const (
+	maxTunedGravity   = 5000.0  // px/s² on either axis
+	maxTunedSpeed     = 2000.0  // px/s
+	maxTunedAOIRadius = 10000.0 // px
+)
+
+var errInvalidTuning = runtime.NewError("invalid tuning: only known keys, gravityX and gravityY within ±5000, drag in (0, 1], maxSpeed in (0, 2000], aoiRadius in [0, 10000] and snapshotRate in [1, 60]; reset lists tuned keys or \"*\"", rpcCodeInvalidArgument)
+
+// tuningKeys are the parameters admin_tune adjusts
+var tuningKeys = []string{"gravityX", "gravityY", "drag", "maxSpeed", "aoiRadius", "snapshotRate"}
+
+// LiveTuning holds the parameters a balancing session set on a running match with admin_tune.
+// They override the game config and the world settings' physicsConfig until they are reset or
+// the match ends, and are never saved. Unset (nil) parameters keep their configured values.
+type LiveTuning struct {
+	GravityX     *float64 `json:"gravityX,omitempty"`     // px/s²
+	GravityY     *float64 `json:"gravityY,omitempty"`     // px/s²
+	Drag         *float64 `json:"drag,omitempty"`         // velocity factor applied every step
+	MaxSpeed     *float64 `json:"maxSpeed,omitempty"`     // px/s, the game config's playerMaxSpeed
+	AOIRadius    *float64 `json:"aoiRadius,omitempty"`    // px; changed entities this close go out in every world update
+	SnapshotRate *float64 `json:"snapshotRate,omitempty"` // world updates per second outside regions with an updateRate
+
+	base *GameConfig // the game config the tuned one derives from
+}
+
+// TuningValues are the parameters a match currently runs with, tuned or not
+type TuningValues struct {
+	GravityX     float64 `json:"gravityX"`
+	GravityY     float64 `json:"gravityY"`
+	Drag         float64 `json:"drag"`
+	MaxSpeed     float64 `json:"maxSpeed"`
+	AOIRadius    float64 `json:"aoiRadius"`
+	SnapshotRate float64 `json:"snapshotRate"`
+}
+
+// TuningRequest is the payload of SignalTune: the parameters to set and those to return to their
+// configured values ("*" for all). Without either the match only reports its values.
+type TuningRequest struct {
+	Set   json.RawMessage `json:"set,omitempty"`
+	Reset []string        `json:"reset,omitempty"`
+}
+
+// parseTuning decodes and validates the parameters of a tuning request
+func parseTuning(data json.RawMessage) (*LiveTuning, error) {
+	t := &LiveTuning{}
+	if len(data) == 0 || string(data) == "null" {
+		return t, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(t); err != nil {
+		return nil, err
+	}
+	return t, t.Validate()
+}
+
+// Validate checks that the parameters set are in range
+func (lt *LiveTuning) Validate() error {
+	within := func(v *float64, lo, hi float64, loOpen bool) bool {
+		if v == nil {
+			return true
+		}
+		if math.IsNaN(*v) || *v > hi || *v < lo {
+			return false
+		}
+		return !loOpen || *v > lo
+	}
+	switch {
+	case !within(lt.GravityX, -maxTunedGravity, maxTunedGravity, false) || !within(lt.GravityY, -maxTunedGravity, maxTunedGravity, false):
+		return errors.New("gravity out of range")
+	case !within(lt.Drag, 0, 1, true):
+		return errors.New("drag must be in (0, 1]")
+	case !within(lt.MaxSpeed, 0, maxTunedSpeed, true):
+		return errors.New("maxSpeed out of range")
+	case !within(lt.AOIRadius, 0, maxTunedAOIRadius, false):
+		return errors.New("aoiRadius out of range")
+	case !within(lt.SnapshotRate, minWorldUpdateRate, maxWorldUpdateRate, false):
+		return errors.New("snapshotRate out of range")
+	}
+	return nil
+}
+
+// validResetKeys reports whether reset names only tuning parameters or "*"
+func validResetKeys(keys []string) bool {
+	for _, key := range keys {
+		if key != "*" && !slices.Contains(tuningKeys, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// merge sets the parameters another tuning sets
+func (lt *LiveTuning) merge(other *LiveTuning) {
+	for _, p := range []struct{ dst, src **float64 }{
+		{&lt.GravityX, &other.GravityX}, {&lt.GravityY, &other.GravityY}, {&lt.Drag, &other.Drag},
+		{&lt.MaxSpeed, &other.MaxSpeed}, {&lt.AOIRadius, &other.AOIRadius}, {&lt.SnapshotRate, &other.SnapshotRate},
+	} {
+		if *p.src != nil {
+			v := **p.src
+			*p.dst = &v
+		}
+	}
+}
+
+// reset returns parameters to their configured values
+func (lt *LiveTuning) reset(keys []string) {
+	for _, key := range keys {
+		all := key == "*"
+		if all || key == "gravityX" {
+			lt.GravityX = nil
+		}
+		if all || key == "gravityY" {
+			lt.GravityY = nil
+		}
+		if all || key == "drag" {
+			lt.Drag = nil
+		}
+		if all || key == "maxSpeed" {
+			lt.MaxSpeed = nil
+		}
+		if all || key == "aoiRadius" {
+			lt.AOIRadius = nil
+		}
+		if all || key == "snapshotRate" {
+			lt.SnapshotRate = nil
+		}
+	}
+}
+
+// Tuned lists the parameters that are set, in tuningKeys order
+func (lt *LiveTuning) Tuned() []string {
+	set := []bool{lt.GravityX != nil, lt.GravityY != nil, lt.Drag != nil, lt.MaxSpeed != nil, lt.AOIRadius != nil, lt.SnapshotRate != nil}
+	tuned := make([]string, 0, len(tuningKeys))
+	for i, key := range tuningKeys {
+		if set[i] {
+			tuned = append(tuned, key)
+		}
+	}
+	return tuned
+}
+
+// Config returns the game config with the tuned max speed, remembering the untuned one
+func (lt *LiveTuning) Config(base *GameConfig) *GameConfig {
+	lt.base = base
+	if lt.MaxSpeed == nil {
+		return base
+	}
+	tuned := *base
+	tuned.PlayerMaxSpeed = *lt.MaxSpeed
+	return &tuned
+}
+
+// applyPhysics overrides the gravity and drag the physics engine was configured with
+func (lt *LiveTuning) applyPhysics(pe *PhysicsEngine) {
+	if lt.GravityX != nil {
+		pe.gravity.X = *lt.GravityX
+	}
+	if lt.GravityY != nil {
+		pe.gravity.Y = *lt.GravityY
+	}
+	if lt.Drag != nil {
+		pe.drag = *lt.Drag
+	}
+}
+
+// NearRadius returns the distance within which changed entities go out in every world update
+func (lt *LiveTuning) NearRadius() float64 {
+	if lt.AOIRadius != nil {
+		return *lt.AOIRadius
+	}
+	return priorityNearRadius
+}
+
+// UpdateIntervalTicks returns the ticks between the world updates of players outside regions
+// with their own update rate
+func (lt *LiveTuning) UpdateIntervalTicks() int64 {
+	if lt.SnapshotRate != nil {
+		return updateIntervalTicks(*lt.SnapshotRate)
+	}
+	return worldUpdateIntervalTicks
+}
+
+// configurePhysics configures the physics engine from the game config defaults, the world
+// settings' physicsConfig and the live tuning, in that order
+func (gs *GameMatchState) configurePhysics() {
+	if gs.worldSettings != nil {
+		gs.physicsEngine.Configure(gs.worldSettings.PhysicsConfig)
+	} else {
+		gs.physicsEngine.Configure(nil)
+	}
+	gs.tuning.applyPhysics(gs.physicsEngine)
+}
+
+// Tune applies a tuning request to the match. It returns false, changing nothing, when the
+// request is invalid.
+func (gs *GameMatchState) Tune(req *TuningRequest, logger runtime.Logger) bool {
+	set, err := parseTuning(req.Set)
+	if err != nil || !validResetKeys(req.Reset) {
+		logger.Warn("Ignoring invalid tuning: %v", err)
+		return false
+	}
+	if len(req.Set) == 0 && len(req.Reset) == 0 {
+		return true
+	}
+	base := gs.tuning.base
+	if base == nil {
+		base = gs.config // the defaults, no game config was applied
+	}
+	gs.tuning.reset(req.Reset)
+	gs.tuning.merge(set)
+	gs.config = gs.tuning.Config(base)
+	gs.configurePhysics()
+	logger.Info("Live tuning of %s: %+v", gs.currentMapName, gs.TuningValues())
+	return true
+}
+
+// TuningValues returns the parameters the match currently runs with
+func (gs *GameMatchState) TuningValues() TuningValues {
+	pe := gs.physicsEngine
+	return TuningValues{
+		GravityX:     pe.gravity.X,
+		GravityY:     pe.gravity.Y,
+		Drag:         pe.drag,
+		MaxSpeed:     gs.config.PlayerMaxSpeed,
+		AOIRadius:    gs.tuning.NearRadius(),
+		SnapshotRate: float64(TickRate) / float64(gs.tuning.UpdateIntervalTicks()),
+	}
+}
+
+// tuneResponse is the reply of SignalTune
+func (gs *GameMatchState) tuneResponse(applied bool) string {
+	out, err := json.Marshal(map[string]any{"applied": applied, "values": gs.TuningValues(), "tuned": gs.tuning.Tuned()})
+	if err != nil {
+		return `{"applied":false}`
+	}
+	return string(out)
+}
+
+// rpcTune adjusts physics and movement parameters of a running match for balancing sessions and
+// reports the values it runs with. The changes last until reset or the match ends. Admins and
+// GMs may use it.
+// Payload: {"matchId": "<id>"} to read, {"matchId": "<id>", "set": {"drag": 0.9, "maxSpeed": 340}},
+// {"matchId": "<id>", "reset": ["drag"]} or {"matchId": "<id>", "reset": ["*"]}
+func rpcTune(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	actorID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	role := ""
+	if actorID != "" {
+		role = accountRole(ctx, nk, actorID)
+		if !roleAllows(role, RoleGM) {
+			return "", errAdminRequired
+		}
+	}
+
+	var req struct {
+		MatchID string `json:"matchId"`
+		TuningRequest
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.MatchID == "" {
+		return "", errInvalidPayload
+	}
+	if _, err := parseTuning(req.Set); err != nil || !validResetKeys(req.Reset) {
+		return "", errInvalidTuning
+	}
+
+	signalPayload, err := json.Marshal(req.TuningRequest)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	responses, err := signalMatches(ctx, logger, nk, req.MatchID, MatchSignalRequest{Type: SignalTune, Payload: signalPayload})
+	if err != nil {
+		return "", err
+	}
+	response := responses[req.MatchID]
+
+	if len(req.Set) > 0 || len(req.Reset) > 0 {
+		var args []string
+		if len(req.Set) > 0 {
+			args = append(args, "set", string(req.Set))
+		}
+		if len(req.Reset) > 0 {
+			args = append(args, "reset", strings.Join(req.Reset, ","))
+		}
+		username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+		entry := &AdminLogEntry{
+			Time:      time.Now().UTC(),
+			ActorID:   actorID,
+			ActorName: username,
+			Role:      role,
+			Action:    "tune",
+			Args:      args,
+			MatchID:   req.MatchID,
+			OK:        true,
+			Result:    string(response),
+		}
+		if err := NewDatabaseManager(logger, nk).AppendAdminLog(ctx, entry); err != nil {
+			logger.Error("Failed to audit tuning of %s: %v", req.MatchID, err)
+		}
+	}
+	return string(response), nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Load levels: what a match sheds while its ticks overrun their budget. Each level sheds what
+// the ones below it do too.
+const (
+	LoadLevelNormal      = 0 // nothing shed
+	LoadLevelSnapshots   = 1 // world updates at half their rate
+	LoadLevelAOI         = 2 // the near radius of world updates halved, updates prioritized by distance even without a budget
+	LoadLevelAmbient     = 3 // idle ambient NPCs paused and their populations not refilled
+	LoadLevelPersistence = 4 // periodic saves put off, up to maxSaveDeferralTicks
+	maxLoadLevel         = LoadLevelPersistence
+)
+
+// loadLevelNames name the load levels in logs, metrics and admin_load
+var loadLevelNames = []string{"normal", "snapshots", "aoi", "ambient", "persistence"}
+
+// Load shedding tuning
+const (
+	tickBudget             = time.Second / TickRate
+	loadWindowTicks        = TickRate          // ticks the overrun share is measured over
+	loadDegradeShare       = 0.5               // share of a window's ticks over budget that raises the level
+	loadRecoverShare       = 0.1               // share at or under which a window counts as calm
+	loadRecoverWindows     = 5                 // calm windows in a row that lower the level
+	maxSaveDeferralTicks   = 5 * 60 * TickRate // longest periodic saves are put off
+	maxLoadChangesReported = 20
+)
+
+// LoadChange is a change of a match's load level
+type LoadChange struct {
+	Time     time.Time `json:"time"`
+	Tick     int64     `json:"tick"`
+	Level    int       `json:"level"`
+	Name     string    `json:"name"`
+	Overruns int       `json:"overruns"` // ticks over budget in the window that caused it
+}
+
+// LoadShedder watches how long match ticks take. When more than half of a second's ticks overrun
+// the tick budget it raises the load level by one, shedding load in a fixed order: world update
+// rate, then the area of interest, then ambient NPCs, then periodic saves. It lowers the level by
+// one after five calm seconds in a row, so a level has time to take effect before the next.
+// Headless matches never shed: replays must run the same whatever the machine. It is only used
+// from the match loop, but for the goroutine writing its admin log entries.
+type LoadShedder struct {
+	logger   runtime.Logger
+	level    int
+	ticks    int
+	overruns int
+	last     int // overruns of the last full window
+	calm     int
+	lastSave int64
+	changes  []LoadChange
+	changed  bool // the level changed since the admin log last recorded it
+
+	logMu     sync.Mutex
+	logQueue  []*AdminLogEntry // level changes waiting to be written to the admin log
+	logging   bool             // a goroutine is writing logQueue
+	logWrites sync.WaitGroup
+}
+
+// NewLoadShedder creates a load shedder at the normal level
+func NewLoadShedder(logger runtime.Logger) *LoadShedder {
+	return &LoadShedder{logger: logger}
+}
+
+// Level returns the current load level
+func (ls *LoadShedder) Level() int {
+	return ls.level
+}
+
+// RecordTick counts the tick that started at started and changes the level at the end of each
+// window. Deferred at the start of the match loop.
+func (ls *LoadShedder) RecordTick(gs *GameMatchState, started time.Time) {
+	if gs.headless {
+		return
+	}
+	ls.ticks++
+	if time.Since(started) > tickBudget {
+		ls.overruns++
+	}
+	if ls.ticks < loadWindowTicks {
+		return
+	}
+	share := float64(ls.overruns) / float64(ls.ticks)
+	ls.last = ls.overruns
+	ls.ticks, ls.overruns = 0, 0
+
+	switch {
+	case share > loadDegradeShare:
+		ls.calm = 0
+		if ls.level < maxLoadLevel {
+			ls.setLevel(gs, ls.level+1)
+		}
+	case share <= loadRecoverShare:
+		ls.calm++
+		if ls.level > LoadLevelNormal && ls.calm >= loadRecoverWindows {
+			ls.calm = 0
+			ls.setLevel(gs, ls.level-1)
+		}
+	default:
+		ls.calm = 0
+	}
+}
+
+// setLevel changes the load level and logs it
+func (ls *LoadShedder) setLevel(gs *GameMatchState, level int) {
+	raised := level > ls.level
+	ls.level = level
+	ls.changes = append(ls.changes, LoadChange{Time: time.Now().UTC(), Tick: gs.currentTick, Level: level, Name: loadLevelNames[level], Overruns: ls.last})
+	if len(ls.changes) > maxLoadChangesReported {
+		ls.changes = ls.changes[len(ls.changes)-maxLoadChangesReported:]
+	}
+	ls.changed = true
+	if raised {
+		ls.logger.Warn("Match on %s is overloaded (%d of %d ticks over %v): load level %d (%s)",
+			gs.currentMapName, ls.last, loadWindowTicks, tickBudget, level, loadLevelNames[level])
+	} else {
+		ls.logger.Info("Match on %s recovered: load level %d (%s)", gs.currentMapName, level, loadLevelNames[level])
+	}
+}
+
+// Report records a level change in the admin log, so admins see when and where matches shed
+// load. The entry is queued and written off the match loop, which is overrunning already. Called
+// from the match loop after the tick's work.
+func (ls *LoadShedder) Report(ctx context.Context, gs *GameMatchState) {
+	if !ls.changed {
+		return
+	}
+	ls.changed = false
+	change := ls.changes[len(ls.changes)-1]
+	matchID, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	entry := &AdminLogEntry{
+		Time:    change.Time,
+		ActorID: "system",
+		Action:  "load_level",
+		Args:    []string{change.Name},
+		MatchID: matchID,
+		Map:     gs.currentMapName,
+		OK:      true,
+	}
+	ls.queueLog(ctx, gs.databaseManager, entry)
+}
+
+// queueLog queues an admin log entry and has a goroutine write the queue, one entry after
+// another. While storage is slow, at most maxLoadChangesReported entries wait; older ones are
+// dropped.
+func (ls *LoadShedder) queueLog(ctx context.Context, db *DatabaseManager, entry *AdminLogEntry) {
+	ls.logMu.Lock()
+	defer ls.logMu.Unlock()
+	if len(ls.logQueue) >= maxLoadChangesReported {
+		ls.logger.Warn("Admin log queue full; dropping the load level change of %s", ls.logQueue[0].Time)
+		ls.logQueue = ls.logQueue[1:]
+	}
+	ls.logQueue = append(ls.logQueue, entry)
+	if ls.logging {
+		return
+	}
+	ls.logging = true
+	ls.logWrites.Add(1)
+	go func() {
+		defer ls.logWrites.Done()
+		for {
+			ls.logMu.Lock()
+			if len(ls.logQueue) == 0 {
+				ls.logging = false
+				ls.logMu.Unlock()
+				return
+			}
+			next := ls.logQueue[0]
+			ls.logQueue = ls.logQueue[1:]
+			ls.logMu.Unlock()
+			if err := db.AppendAdminLog(ctx, next); err != nil {
+				ls.logger.Error("Failed to record load level change: %v", err)
+			}
+		}
+	}()
+}
+
+// WaitLog waits for the queued level changes to be written to the admin log
+func (ls *LoadShedder) WaitLog() {
+	ls.logWrites.Wait()
+}
+
+// UpdateInterval returns the ticks between a player's world updates: their interval, doubled
+// from the snapshots level on
+func (ls *LoadShedder) UpdateInterval(interval int64) int64 {
+	if ls.level >= LoadLevelSnapshots {
+		return interval * 2
+	}
+	return interval
+}
+
+// NearRadius returns the distance within which changed entities go out in every prioritized
+// world update: the radius, halved from the aoi level on
+func (ls *LoadShedder) NearRadius(radius float64) float64 {
+	if ls.level >= LoadLevelAOI {
+		return radius / 2
+	}
+	return radius
+}
+
+// AmbientPaused reports whether idle ambient NPCs stand still and populations aren't refilled
+func (ls *LoadShedder) AmbientPaused() bool {
+	return ls.level >= LoadLevelAmbient
+}
+
+// SaveDue reports whether the periodic save runs this tick: every interval ticks, or from the
+// persistence level on only once saves were put off for maxSaveDeferralTicks
+func (ls *LoadShedder) SaveDue(tick, interval int64) bool {
+	if tick%interval != 0 {
+		return false
+	}
+	if ls.level >= LoadLevelPersistence && tick-ls.lastSave < maxSaveDeferralTicks {
+		return false
+	}
+	ls.lastSave = tick
+	return true
+}
+
+// LoadReport is the load state of a match as admin_load returns it
+type LoadReport struct {
+	Level        int          `json:"level"`
+	Name         string       `json:"name"`
+	Overruns     int          `json:"overruns"` // ticks over budget in the last full window
+	WindowTicks  int          `json:"windowTicks"`
+	TickBudgetMs float64      `json:"tickBudgetMs"`
+	Changes      []LoadChange `json:"changes"` // the latest level changes, oldest first
+}
+
+// LoadReport returns the match's load state
+func (ls *LoadShedder) LoadReport() *LoadReport {
+	changes := ls.changes
+	if changes == nil {
+		changes = []LoadChange{}
+	}
+	return &LoadReport{
+		Level:        ls.level,
+		Name:         loadLevelNames[ls.level],
+		Overruns:     ls.last,
+		WindowTicks:  loadWindowTicks,
+		TickBudgetMs: float64(tickBudget) / float64(time.Millisecond),
+		Changes:      changes,
+	}
+}
+
+// rpcAdminLoad returns the load level of each match (or one), what caused its changes and the
+// tick budget. Admins and GMs may use it.
+// Payload: {"matchId": "optional"}
+func rpcAdminLoad(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if actorID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); actorID != "" && !roleAllows(accountRole(ctx, nk, actorID), RoleGM) {
+		return "", errAdminRequired
+	}
+	var req struct {
+		MatchID string `json:"matchId"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+
+	responses, err := signalMatches(ctx, logger, nk, req.MatchID, MatchSignalRequest{Type: SignalLoad})
+	if err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(map[string]interface{}{"matches": responses})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// defaultLocale is the locale messages fall back to; its templates are built in
+const defaultLocale = "en"
+
+// maxLocaleLength caps the locale tags players can pick
+const maxLocaleLength = 16
+
+// LocalizedText is a server-authored message: a catalog key with parameters, so clients can render
+// it in the player's language
+type LocalizedText struct {
+	Key    string         `json:"key"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// msg builds a localized message from a catalog key and name/value parameter pairs, e.g.
+// msg("cmd.gave", "count", 3, "item", "apple"). It is also an error, so command handlers and
+// managers can fail with a localized reason.
+func msg(key string, pairs ...any) *LocalizedText {
+	lt := &LocalizedText{Key: key}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		name, ok := pairs[i].(string)
+		if !ok {
+			continue
+		}
+		if lt.Params == nil {
+			lt.Params = make(map[string]any, len(pairs)/2)
+		}
+		lt.Params[name] = pairs[i+1]
+	}
+	return lt
+}
+
+// Error renders the message in the default locale
+func (lt *LocalizedText) Error() string {
+	return messageCatalog.Render(defaultLocale, lt.Key, lt.Params)
+}
+
+// localizedError returns err as a localized message. Errors that aren't one are sent as the
+// "error.text" message carrying their English text.
+func localizedError(err error) *LocalizedText {
+	var lt *LocalizedText
+	if errors.As(err, &lt) {
+		return lt
+	}
+	return msg("error.text", "text", err.Error())
+}
+
+// MessageCatalog holds the message templates by locale. Templates name their parameters in
+// braces ("gave {count} x {item}"). Lookups fall back from "pt-BR" to "pt", then to the default
+// locale, then to the key itself.
+type MessageCatalog struct {
+	locales map[string]map[string]string // locale -> key -> template
+	mu      sync.RWMutex
+}
+
+// messageCatalog is shared by all matches and RPCs; InitModule loads the translations into it
+var messageCatalog = &MessageCatalog{locales: map[string]map[string]string{defaultLocale: defaultMessages}}
+
+// Load adds the templates found in path, a JSON object keyed by locale and then by message key.
+// Templates for the default locale override the built-in ones.
+func (mc *MessageCatalog) Load(logger runtime.Logger, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var locales map[string]map[string]string
+	if err := json.Unmarshal(data, &locales); err != nil {
+		return err
+	}
+
+	mc.mu.Lock()
+	count := 0
+	for locale, templates := range locales {
+		locale = normalizeLocale(locale)
+		merged := make(map[string]string, len(templates))
+		for key, template := range mc.locales[locale] {
+			merged[key] = template
+		}
+		for key, template := range templates {
+			merged[key] = template
+		}
+		mc.locales[locale] = merged
+		count += len(templates)
+	}
+	mc.mu.Unlock()
+
+	logger.Info("Loaded %d message templates in %d locales from %s", count, len(locales), path)
+	return nil
+}
+
+// Lookup returns the template of a key in a locale or the locales it falls back to
+func (mc *MessageCatalog) Lookup(locale, key string) (string, bool) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	for _, candidate := range localeFallbacks(locale) {
+		if template, ok := mc.locales[candidate][key]; ok {
+			return template, true
+		}
+	}
+	return "", false
+}
+
+// Render fills in the template of a key for a locale; unknown keys render as the key
+func (mc *MessageCatalog) Render(locale, key string, params map[string]any) string {
+	template, ok := mc.Lookup(locale, key)
+	if !ok {
+		template = key
+	}
+	return fillTemplate(template, params)
+}
+
+// localizedOr returns the template of a key in a locale, or fallback if no locale has it. Data
+// texts (quest names, NPC greetings) use it so definitions keep working without translations.
+func localizedOr(locale, key, fallback string) string {
+	if template, ok := messageCatalog.Lookup(locale, key); ok {
+		return template
+	}
+	return fallback
+}
+
+// Templates returns every key a client needs for a locale, with the fallbacks resolved
+func (mc *MessageCatalog) Templates(locale string) map[string]string {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	fallbacks := localeFallbacks(locale)
+	out := make(map[string]string)
+	for i := len(fallbacks) - 1; i >= 0; i-- {
+		for key, template := range mc.locales[fallbacks[i]] {
+			out[key] = template
+		}
+	}
+	return out
+}
+
+// Locales returns the locales with templates, sorted
+func (mc *MessageCatalog) Locales() []string {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	locales := make([]string, 0, len(mc.locales))
+	for locale := range mc.locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// fillTemplate replaces the {name} placeholders of a template with their parameters
+func fillTemplate(template string, params map[string]any) string {
+	if len(params) == 0 || !strings.Contains(template, "{") {
+		return template
+	}
+	replacements := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replacements...).Replace(template)
+}
+
+// normalizeLocale turns "pt_br" into "pt-BR" style tags, lowercasing the language
+func normalizeLocale(locale string) string {
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+	language, region, ok := strings.Cut(locale, "-")
+	if !ok {
+		return strings.ToLower(locale)
+	}
+	return strings.ToLower(language) + "-" + strings.ToUpper(region)
+}
+
+// localeFallbacks returns the locales to try for a locale, most specific first
+func localeFallbacks(locale string) []string {
+	locale = normalizeLocale(locale)
+	fallbacks := make([]string, 0, 3)
+	if locale != "" {
+		fallbacks = append(fallbacks, locale)
+		if language, _, ok := strings.Cut(locale, "-"); ok {
+			fallbacks = append(fallbacks, language)
+		}
+	}
+	return append(fallbacks, defaultLocale)
+}
+
+// validLocale reports whether a locale tag looks like "de" or "pt-BR"
+func validLocale(locale string) bool {
+	if locale == "" || len(locale) > maxLocaleLength {
+		return false
+	}
+	for _, r := range locale {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// accountLocale returns the language tag of a user's account ("" if unset or unreadable)
+func accountLocale(ctx context.Context, nk runtime.NakamaModule, userID string) string {
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil || account.GetUser() == nil {
+		return ""
+	}
+	return normalizeLocale(account.GetUser().GetLangTag())
+}
+
+// Locale returns the locale messages to a player are rendered in
+func (gs *GameMatchState) Locale(playerID string) string {
+	if locale := gs.GetPlayerState(playerID).Locale; locale != "" {
+		return locale
+	}
+	return defaultLocale
+}
+
+// presencesByLocale groups recipients (every player when nil) by the locale they read
+func (gs *GameMatchState) presencesByLocale(recipients []runtime.Presence) map[string][]runtime.Presence {
+	if recipients == nil {
+		recipients = make([]runtime.Presence, 0, len(gs.presences))
+		for _, presence := range gs.Presences() {
+			recipients = append(recipients, presence)
+		}
+	}
+	groups := make(map[string][]runtime.Presence)
+	for _, presence := range recipients {
+		locale := gs.Locale(presence.GetUserId())
+		groups[locale] = append(groups[locale], presence)
+	}
+	return groups
+}
+
+// cmdLanguage shows the player's language, or changes it and stores it as the account's language
+// tag so it follows them to other matches
+func cmdLanguage(cc *CommandContext) (*LocalizedText, error) {
+	gs := cc.gameState
+	if len(cc.args) == 0 {
+		return msg("cmd.language.current", "locale", gs.Locale(cc.playerID), "available", strings.Join(messageCatalog.Locales(), ", ")), nil
+	}
+	if len(cc.args) != 1 || !validLocale(cc.args[0]) {
+		return nil, msg("cmd.usage", "usage", chatCommands["language"].Usage)
+	}
+	locale := normalizeLocale(cc.args[0])
+	if err := gs.databaseManager.nk.AccountUpdateId(cc.ctx, cc.playerID, "", nil, "", "", "", locale, ""); err != nil {
+		cc.logger.Error("Failed to store language %s for %s: %v", locale, cc.playerID, err)
+		return nil, msg("cmd.language.failed")
+	}
+	gs.GetPlayerState(cc.playerID).Locale = locale
+	return msg("cmd.language.set", "locale", locale), nil
+}
+
+// rpcMessages returns the message templates of a locale (the caller's account language by
+// default) so clients can render localized messages.
+// Payload: {"locale": "optional"}
+func rpcMessages(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req struct {
+		Locale string `json:"locale"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+	locale := normalizeLocale(req.Locale)
+	if locale == "" {
+		if userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); userID != "" {
+			locale = accountLocale(ctx, nk, userID)
+		}
+	}
+	if locale == "" {
+		locale = defaultLocale
+	}
+	out, err := json.Marshal(map[string]any{
+		"locale":   locale,
+		"messages": messageCatalog.Templates(locale),
+	})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
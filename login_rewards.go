@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Login reward events published on the event bus
+const EventLoginReward = "login_reward" // playerId, streak, day
+
+// loginRewardDayFormat is the UTC calendar day a claim counts for; the streak goes on when the
+// previous claim was on the day before
+const loginRewardDayFormat = "2006-01-02"
+
+// LoginRewardConfig is the login reward table. Day n of a streak gets Days[(n-1) % len(Days)],
+// so the table starts over after its last day while the streak keeps counting.
+type LoginRewardConfig struct {
+	Days []WorldEventRewards `json:"days"`
+}
+
+// LoginReward is sent to a player when they got their daily reward
+type LoginReward struct {
+	Streak     int              `json:"streak"`     // days in a row, today included
+	Day        int              `json:"day"`        // 1-based index into the reward table
+	BestStreak int              `json:"bestStreak"` // longest streak the player ever had
+	Items      map[string]int   `json:"items,omitempty"`
+	Currency   map[string]int64 `json:"currency,omitempty"`
+	NextDay    int              `json:"nextDay"` // table day of tomorrow's reward if the streak goes on
+}
+
+// LoginRewardManager grants the daily login reward the first time a player joins a match on a
+// UTC day. The claim is written with the version it was read at before anything is granted, so
+// joining two matches at once can't grant the reward twice.
+type LoginRewardManager struct {
+	logger runtime.Logger
+	db     *DatabaseManager
+	config LoginRewardConfig
+}
+
+// NewLoginRewardManager creates a manager and loads the reward table from path
+func NewLoginRewardManager(logger runtime.Logger, db *DatabaseManager, path string) *LoginRewardManager {
+	lm := &LoginRewardManager{logger: logger, db: db}
+	if err := lm.Load(path); err != nil {
+		logger.Warn("Failed to load login rewards from %s: %v", path, err)
+	}
+	return lm
+}
+
+// Load replaces the reward table with the one found in path
+func (lm *LoginRewardManager) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var config LoginRewardConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	lm.config = config
+
+	lm.logger.Info("Loaded %d login reward days from %s", len(config.Days), path)
+	return nil
+}
+
+// Claim grants a joining player today's reward unless they already got it, and sends it to them
+func (lm *LoginRewardManager) Claim(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	if len(lm.config.Days) == 0 {
+		return
+	}
+	record, version, err := lm.db.LoadLoginRewards(ctx, playerID)
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	today := now.Format(loginRewardDayFormat)
+	if record.LastDay == today {
+		return
+	}
+
+	if record.LastDay == now.AddDate(0, 0, -1).Format(loginRewardDayFormat) {
+		record.Streak++
+	} else {
+		record.Streak = 1
+	}
+	if record.Streak > record.BestStreak {
+		record.BestStreak = record.Streak
+	}
+	record.LastDay = today
+	record.LastClaim = now
+	record.Claims++
+	// Another match may have claimed since the read; then that one grants the reward
+	if err := lm.db.SaveLoginRewards(ctx, record, version); err != nil {
+		lm.logger.Warn("Login reward for %s not granted: %v", playerID, err)
+		return
+	}
+
+	day := (record.Streak-1)%len(lm.config.Days) + 1
+	rewards := lm.config.Days[day-1]
+	granted := LoginReward{
+		Streak:     record.Streak,
+		Day:        day,
+		BestStreak: record.BestStreak,
+		Items:      make(map[string]int),
+		NextDay:    day%len(lm.config.Days) + 1,
+	}
+	stacks := make([]LootStack, 0, len(rewards.Items))
+	for itemID, count := range rewards.Items {
+		stacks = append(stacks, LootStack{ItemID: itemID, Count: count})
+	}
+	if rewards.Loot != "" {
+		stacks = append(stacks, gs.lootCatalog.Roll(gs, rewards.Loot, LootContext{PlayerID: playerID})...)
+	}
+	entry := &JournalEntry{Key: fmt.Sprintf("login_reward:%d", record.Claims), Kind: JournalItemGrant, PlayerID: playerID, Items: stackItems(stacks), Currency: rewards.Currency, Source: "login_reward"}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		return
+	}
+	var grantErr error
+	for _, stack := range stacks {
+		if err := gs.inventoryManager.Add(ctx, playerID, stack.ItemID, stack.Count); err != nil {
+			lm.logger.Error("Login reward: failed to give %d x %s to %s: %v", stack.Count, stack.ItemID, playerID, err)
+			grantErr = err
+			continue
+		}
+		granted.Items[stack.ItemID] += stack.Count
+	}
+	if len(rewards.Currency) > 0 {
+		metadata := map[string]interface{}{"reason": "login_reward", "streak": record.Streak}
+		if err := lm.db.UpdateWallet(ctx, playerID, rewards.Currency, metadata); err != nil {
+			lm.logger.Error("Login reward: failed to pay %s: %v", playerID, err)
+			grantErr = err
+		} else {
+			granted.Currency = rewards.Currency
+		}
+	}
+	entry.Items, entry.Currency = granted.Items, granted.Currency
+	gs.journal.Finish(ctx, entry, grantErr)
+	gs.eventBus.Publish(EventLoginReward, map[string]any{"playerId": playerID, "streak": record.Streak, "day": day})
+
+	presence, online := gs.presences[playerID]
+	if !online || dispatcher == nil {
+		return
+	}
+	if len(granted.Items) > 0 {
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	}
+	data, err := EncodeMessage(OpCodeLoginReward, "login_reward", granted)
+	if err != nil {
+		lm.logger.Error("Failed to marshal login_reward: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeLoginReward, data, []runtime.Presence{presence}, nil, true)
+}
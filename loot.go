@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Loot ownership rules
+const (
+	LootOwnershipFree   = "ffa"    // anyone can pick the loot up (default)
+	LootOwnershipKiller = "killer" // only the killer/opener can pick it up until the owner window ends
+)
+
+// Loot tuning
+const (
+	defaultLootOwnerSeconds = 60.0         // how long owned loot is reserved for its owner
+	lootScatter             = TileSize / 2 // max offset of each dropped stack from the drop point
+	maxLootTableDepth       = 4            // nested table references deeper than this are ignored
+)
+
+// LootTable describes what a roll produces. Each roll picks one entry by weight; Always entries
+// are added on every roll of the table regardless of Rolls.
+type LootTable struct {
+	ID             string      `json:"id"`
+	Rolls          int         `json:"rolls,omitempty"`          // weighted picks per roll (default 1)
+	Entries        []LootEntry `json:"entries"`                  // weighted entries (an entry without item or table drops nothing)
+	Always         []LootEntry `json:"always,omitempty"`         // guaranteed entries (still subject to their conditions)
+	Ownership      string      `json:"ownership,omitempty"`      // LootOwnership* (default ffa)
+	OwnerSeconds   float64     `json:"ownerSeconds,omitempty"`   // reservation for killer loot (default defaultLootOwnerSeconds)
+	DespawnSeconds float64     `json:"despawnSeconds,omitempty"` // lifetime of the dropped stacks (default worldItemLifetimeTicks)
+	PickupRadius   float64     `json:"pickupRadius,omitempty"`   // half-size of the pickup sensor (default half a tile)
+}
+
+// LootEntry is one weighted outcome of a loot table
+type LootEntry struct {
+	ItemID     string         `json:"item,omitempty"`
+	Table      string         `json:"table,omitempty"`  // roll another table instead of dropping an item
+	Weight     float64        `json:"weight,omitempty"` // relative weight among Entries (default 1)
+	Min        int            `json:"min,omitempty"`    // quantity range (default 1..Min)
+	Max        int            `json:"max,omitempty"`
+	Conditions *LootCondition `json:"conditions,omitempty"`
+}
+
+// LootCondition restricts an entry; an entry whose conditions fail is left out of the roll
+type LootCondition struct {
+	KilledByPlayer bool    `json:"killedByPlayer,omitempty"` // the roll must be credited to a player
+	WorldVar       string  `json:"worldVar,omitempty"`       // world variable that must be set
+	Equals         any     `json:"equals,omitempty"`         // value WorldVar must hold (any truthy value when omitted)
+	Chance         float64 `json:"chance,omitempty"`         // extra probability 0..1 the entry is kept (0 = always)
+}
+
+// LootStack is an item stack produced by a roll
+type LootStack struct {
+	ItemID string `json:"item"`
+	Count  int    `json:"count"`
+}
+
+// LootContext is what conditions are checked against
+type LootContext struct {
+	PlayerID string // player credited with the roll (killer or chest opener); empty for none
+}
+
+// LootCatalog holds the loot tables loaded from the loot data file
+type LootCatalog struct {
+	logger runtime.Logger
+	tables map[string]*LootTable
+	mu     sync.RWMutex
+}
+
+// NewLootCatalog creates a catalog and loads tables from path (a JSON object keyed by table ID)
+func NewLootCatalog(logger runtime.Logger, path string) *LootCatalog {
+	lc := &LootCatalog{
+		logger: logger,
+		tables: make(map[string]*LootTable),
+	}
+	if err := lc.Load(path); err != nil {
+		logger.Warn("Failed to load loot tables from %s: %v", path, err)
+	}
+	return lc
+}
+
+// Load replaces the catalog with the tables found in path
+func (lc *LootCatalog) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var tables map[string]*LootTable
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return err
+	}
+	for id, table := range tables {
+		table.ID = id
+		if table.Rolls <= 0 {
+			table.Rolls = 1
+		}
+		if table.Ownership == "" {
+			table.Ownership = LootOwnershipFree
+		}
+		if table.OwnerSeconds <= 0 {
+			table.OwnerSeconds = defaultLootOwnerSeconds
+		}
+		if table.DespawnSeconds <= 0 {
+			table.DespawnSeconds = float64(worldItemLifetimeTicks) / TickRate
+		}
+		if table.PickupRadius <= 0 {
+			table.PickupRadius = worldItemSensorSize / 2
+		}
+		for _, entries := range [][]LootEntry{table.Entries, table.Always} {
+			for i := range entries {
+				e := &entries[i]
+				if e.Weight <= 0 {
+					e.Weight = 1
+				}
+				if e.Min <= 0 {
+					e.Min = 1
+				}
+				if e.Max < e.Min {
+					e.Max = e.Min
+				}
+			}
+		}
+	}
+
+	lc.mu.Lock()
+	lc.tables = tables
+	lc.mu.Unlock()
+
+	lc.logger.Info("Loaded %d loot tables from %s", len(tables), path)
+	return nil
+}
+
+// Get returns a loot table
+func (lc *LootCatalog) Get(id string) (*LootTable, bool) {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	table, ok := lc.tables[id]
+	return table, ok
+}
+
+// Roll rolls a table and returns the item stacks it produced, merged by item. Unknown tables
+// produce nothing. Every roll is audited for the player credited with it (rng.go).
+func (lc *LootCatalog) Roll(gs *GameMatchState, tableID string, lctx LootContext) []LootStack {
+	counts := make(map[string]int)
+	var order []string
+	rng := gs.random.Roll(gs, RollLoot, lctx.PlayerID, map[string]any{"table": tableID})
+	lc.roll(gs, rng.Rand, tableID, lctx, 0, func(itemID string, count int) {
+		if _, ok := counts[itemID]; !ok {
+			order = append(order, itemID)
+		}
+		counts[itemID] += count
+	})
+
+	stacks := make([]LootStack, 0, len(order))
+	for _, itemID := range order {
+		stacks = append(stacks, LootStack{ItemID: itemID, Count: counts[itemID]})
+	}
+	gs.random.Record(rng, stacks)
+	return stacks
+}
+
+// roll adds the outcome of one table roll through add, following nested table references
+func (lc *LootCatalog) roll(gs *GameMatchState, rng *rand.Rand, tableID string, lctx LootContext, depth int, add func(string, int)) {
+	// Running live-ops events may roll another table instead
+	table, ok := lc.Get(gs.liveOps.LootTable(tableID))
+	if !ok || depth > maxLootTableDepth {
+		return
+	}
+	resolve := func(e *LootEntry) {
+		if e.Table != "" {
+			lc.roll(gs, rng, e.Table, lctx, depth+1, add)
+			return
+		}
+		if e.ItemID == "" {
+			return
+		}
+		add(e.ItemID, e.Min+rng.Intn(e.Max-e.Min+1))
+	}
+
+	for i := range table.Always {
+		if e := &table.Always[i]; e.Conditions.Met(gs, rng, lctx) {
+			resolve(e)
+		}
+	}
+
+	candidates := make([]*LootEntry, 0, len(table.Entries))
+	total := 0.0
+	for i := range table.Entries {
+		if e := &table.Entries[i]; e.Conditions.Met(gs, rng, lctx) {
+			candidates = append(candidates, e)
+			total += e.Weight
+		}
+	}
+	if total <= 0 {
+		return
+	}
+	for r := 0; r < table.Rolls; r++ {
+		pick := rng.Float64() * total
+		for _, e := range candidates {
+			if pick -= e.Weight; pick < 0 {
+				resolve(e)
+				break
+			}
+		}
+	}
+}
+
+// Met reports whether the condition holds for a roll. A nil condition always holds.
+func (c *LootCondition) Met(gs *GameMatchState, rng *rand.Rand, lctx LootContext) bool {
+	if c == nil {
+		return true
+	}
+	if c.KilledByPlayer && lctx.PlayerID == "" {
+		return false
+	}
+	if c.WorldVar != "" {
+		value, ok := gs.worldVars.Get(c.WorldVar)
+		if !ok {
+			return false
+		}
+		if c.Equals != nil {
+			if !reflect.DeepEqual(value, c.Equals) {
+				return false
+			}
+		} else if value == false || value == 0.0 || value == "" {
+			return false
+		}
+	}
+	return c.Chance <= 0 || rng.Float64() < c.Chance
+}
+
+// DropLoot rolls a table and spawns the result around position as world items. owner is the
+// player credited with the roll; killer-owned tables reserve the items for them, or share them by
+// their party's loot rule when other members are at the drop. It returns the object IDs of the
+// spawned items (not those held for a need/greed roll) and the stacks they hold.
+func (gs *GameMatchState) DropLoot(tableID string, position vector.Vector, owner string, dispatcher runtime.MatchDispatcher) ([]int, []LootStack) {
+	table, ok := gs.lootCatalog.Get(tableID)
+	if !ok {
+		return nil, nil
+	}
+	stacks := gs.lootCatalog.Roll(gs, tableID, LootContext{PlayerID: owner})
+
+	var ownerTicks int64
+	if table.Ownership != LootOwnershipKiller {
+		owner = ""
+	} else if owner != "" {
+		ownerTicks = int64(table.OwnerSeconds * TickRate)
+	}
+
+	spawns := make([]WorldItemSpawn, 0, len(stacks))
+	for _, stack := range stacks {
+		at := position
+		if len(stacks) > 1 {
+			at = at.Add(vector.Vector{X: (gs.rng.Float64()*2 - 1) * lootScatter, Y: (gs.rng.Float64()*2 - 1) * lootScatter})
+		}
+		spawns = append(spawns, WorldItemSpawn{
+			ItemID:        stack.ItemID,
+			Count:         stack.Count,
+			Position:      at,
+			LifetimeTicks: int64(table.DespawnSeconds * TickRate),
+			Owner:         owner,
+			OwnerTicks:    ownerTicks,
+			PickupRadius:  table.PickupRadius,
+		})
+	}
+
+	if ownerTicks > 0 {
+		if ids, shared := gs.parties.ShareLoot(gs, owner, position, spawns, dispatcher); shared {
+			return ids, stacks
+		}
+	}
+	ids := make([]int, 0, len(spawns))
+	for _, spawn := range spawns {
+		ids = append(ids, gs.worldItems.spawn(gs, spawn, dispatcher))
+	}
+	return ids, stacks
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
@@ -47,6 +48,7 @@ type TiledTile struct {
 	Type        string          `json:"type,omitempty"`
 	Properties  []TiledProperty `json:"properties,omitempty"`
 	ObjectGroup TiledLayer      `json:"objectgroup,omitempty"` // Collision data
+	Animation   []TiledFrame    `json:"animation,omitempty"`
 }
 
 type TiledLayer struct {
@@ -79,6 +81,10 @@ type TiledObject struct {
 		X float64 `json:"x"`
 		Y float64 `json:"y"`
 	} `json:"polygon,omitempty"`
+	Polyline []struct { // for polyline objects (NPC patrol paths)
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+	} `json:"polyline,omitempty"`
 	Ellipse bool `json:"ellipse,omitempty"`
 	// gid may exist for tile objects; we don't need it server-side
 	GID uint32 `json:"gid,omitempty"`
@@ -144,6 +150,82 @@ type LoadedMap struct {
 	TileCollisions map[int]TileCollisionTemplate // Map of tile ID to collision data
 	// per-object colliders for scripted tile objects (owner => list of colliders)
 	ObjectColliders map[int][]OwnedCollider
+	// spawn points by their "group" property (team name, "graveyard", ...)
+	SpawnGroups map[string][]vector.Vector
+	// named spawn points / marker objects (name => world position) exposed to scripts
+	Markers map[string]vector.Vector
+	// tile layers kept for tile lookups at world coordinates (bottom to top)
+	TileLayers []MapTileLayer
+	// custom tile properties from tilesets (global tile ID => properties)
+	TileProperties map[int]map[string]interface{}
+	// frame loops of animated tiles (global tile ID => animation)
+	TileAnimations map[int]*TileAnimation
+	// the map's tilesets in firstgid order, as clients load them (asset_manifest)
+	Tilesets []MapTileset
+	// areas with build permissions ("build_zone" objects)
+	BuildZones []BuildZone
+	// areas where players swim ("water" objects)
+	WaterVolumes []WaterVolume
+	// areas that apply a status effect to the players inside ("effect_zone" objects)
+	EffectZones []EffectZone
+	// areas that hurt the players and NPCs inside ("hazard" objects and the "hazards" object layer)
+	Hazards []HazardZone
+	// areas that hide the players inside ("stealth_zone" objects, e.g. bushes)
+	StealthZones []StealthZone
+	// areas that are dark during the day too ("dark_zone" objects)
+	DarkZones []DarkZone
+	// fixed light sources ("light" objects)
+	Lights []LightSource
+	// fast travel points and checkpoints ("waypoint" objects)
+	Waypoints []Waypoint
+	// areas opened by world events ("event_zone" objects)
+	EventZones []EventZone
+	// arenas running wave encounters ("encounter" objects)
+	Encounters []EncounterArea
+	// areas with their own PvP rules ("pvp_zone" objects, and "region" objects with a pvp property)
+	PvPZones []PvPZone
+	// named areas players are told about when they enter them ("region" objects)
+	Regions []Region
+	// music and ambience tracks played inside areas or around points ("audio_cue" objects)
+	AudioCues []AudioCue
+	// hidden or visible traps players set off, spot and disarm ("trap" objects)
+	Traps []TrapSpawn
+	// one-way colliders along cliffs players may drop down ("ledge" objects)
+	Ledges []Ledge
+	// claimable housing plots ("plot" objects)
+	Plots []PlotArea
+	// polyline/"path" objects by object ID, used as NPC patrol routes
+	Paths map[int]*MapPath
+	// "npc_spawner" objects
+	NPCSpawners []NPCSpawner
+}
+
+// MapPath is a route drawn in Tiled as a polyline (open) or a polygon of type "path" (closed).
+// Points are world coordinates.
+type MapPath struct {
+	ID     int
+	Name   string
+	Points []vector.Vector
+	Closed bool
+}
+
+// MapTileLayer stores the tile grid of a single tile layer (flip bits stripped)
+type MapTileLayer struct {
+	Name         string
+	Width        int
+	Height       int
+	Data         []uint32
+	Elevation    float64 // height level of the layer's tiles ("elevation" layer property)
+	HasElevation bool
+}
+
+// TileInfo describes the tile found at a world coordinate
+type TileInfo struct {
+	Layer      string
+	GID        uint32
+	TileX      int
+	TileY      int
+	Properties map[string]interface{}
 }
 
 // OwnedCollider stores a rigidbody plus optional polygon points for physics registration
@@ -154,6 +236,9 @@ type OwnedCollider struct {
 
 // ---- Public API ----
 
+// mapDirectory holds the Tiled maps matches load
+const mapDirectory = "/nakama/data/maps"
+
 func NewMapLoader(logger runtime.Logger, mapDirectory string) *MapLoader {
 	return &MapLoader{
 		logger: logger,
@@ -182,9 +267,11 @@ func (ml *MapLoader) LoadMap(filename string) (*LoadedMap, error) {
 	// Load tilesets and external tilesets
 	ml.logger.Debug("Processing %d tilesets in map", len(tiledMap.Tilesets))
 	tilesetData := make(map[int]*TiledTilesetData)
+	tilesets := make([]MapTileset, 0, len(tiledMap.Tilesets))
 
 	mapDir := filepath.Dir(filePath)
 	for _, tileset := range tiledMap.Tilesets {
+		tilesets = append(tilesets, describeTileset(&tileset, filename))
 		if tileset.Source != "" {
 			// It's an external tileset
 			tilesetPath := filepath.Join(mapDir, tileset.Source)
@@ -201,6 +288,7 @@ func (ml *MapLoader) LoadMap(filename string) (*LoadedMap, error) {
 			}
 
 			tilesetData[tileset.FirstGID] = data
+			tilesets[len(tilesets)-1] = describeExternalTileset(tileset.FirstGID, relPath, data)
 		} else if len(tileset.Tiles) > 0 {
 			// Convert embedded tileset to our internal format
 			embeddedTileset := &TiledTilesetData{
@@ -231,6 +319,12 @@ func (ml *MapLoader) LoadMap(filename string) (*LoadedMap, error) {
 		Background:     tiledMap.BackgroundColor,
 		Properties:     map[string]interface{}{},
 		TileCollisions: make(map[int]TileCollisionTemplate),
+		Markers:        make(map[string]vector.Vector),
+		SpawnGroups:    make(map[string][]vector.Vector),
+		TileProperties: make(map[int]map[string]interface{}),
+		TileAnimations: make(map[int]*TileAnimation),
+		Tilesets:       tilesets,
+		Paths:          make(map[int]*MapPath),
 	}
 
 	for _, p := range tiledMap.Properties {
@@ -240,6 +334,12 @@ func (ml *MapLoader) LoadMap(filename string) (*LoadedMap, error) {
 	// Process tileset collision objects (if any)
 	ml.processTilesetColliders(tilesetData, lm)
 
+	// Collect custom tile properties so scripts can query them by coordinate
+	ml.processTilesetProperties(tilesetData, lm)
+
+	// Animated tiles, and the hazards of those with hazard frames (spike traps)
+	hazardTiles := ml.processTileAnimations(tilesetData, lm)
+
 	// Process layers
 	for i := range tiledMap.Layers {
 		layer := &tiledMap.Layers[i]
@@ -248,6 +348,7 @@ func (ml *MapLoader) LoadMap(filename string) (*LoadedMap, error) {
 		}
 		switch layer.Type {
 		case "tilelayer":
+			ml.storeTileLayer(layer, lm)
 			ml.processTileLayer(&tiledMap, layer, lm)
 			// Additionally check if any tiles in this layer need special collision processing
 			if len(tilesetData) > 0 {
@@ -264,8 +365,14 @@ func (ml *MapLoader) LoadMap(filename string) (*LoadedMap, error) {
 		}
 	}
 
-	ml.logger.Info("Map loaded: objects=%d, spawnPoints=%d, colliders=%d",
-		len(lm.GameObjects), len(lm.SpawnPoints), len(lm.Colliders))
+	// Spawners may reference paths drawn on later layers
+	ml.resolveSpawnerPaths(lm)
+
+	// Hazard tiles hurt wherever the tile layers show them
+	ml.placeHazardTiles(hazardTiles, lm)
+
+	ml.logger.Info("Map loaded: objects=%d, spawnPoints=%d, colliders=%d, npcSpawners=%d",
+		len(lm.GameObjects), len(lm.SpawnPoints), len(lm.Colliders), len(lm.NPCSpawners))
 
 	return lm, nil
 }
@@ -292,11 +399,19 @@ func (ml *MapLoader) ApplyMapToGameState(loadedMap *LoadedMap, gameState *GameMa
 		gameState.AddStaticCollider(rb, nil)
 	}
 
+	// Ledges collide like walls except for bodies dropping down them
+	for _, ledge := range loadedMap.Ledges {
+		gameState.AddStaticCollider(ledge.Body, nil)
+		if gameState.physicsEngine != nil {
+			gameState.physicsEngine.SetOneWay(ledge.Body, ledge.Drop)
+		}
+	}
+
 	// clear and set scripted objects
 	gameState.mu.Lock()
-	gameState.objects = make(map[int]*ObjectData)
-	for k, v := range loadedMap.Objects {
-		gameState.objects[k] = v
+	gameState.entities.RemoveKind(EntityObject)
+	for _, v := range loadedMap.Objects {
+		gameState.entities.registerObject(v)
 	}
 	gameState.mu.Unlock()
 
@@ -310,6 +425,11 @@ func (ml *MapLoader) ApplyMapToGameState(loadedMap *LoadedMap, gameState *GameMa
 		}
 	}
 
+	// The colliders so far are the map's own, which clients have; only later changes are sent
+	gameState.mu.Lock()
+	gameState.colliders.Reset()
+	gameState.mu.Unlock()
+
 	// set world bounds
 	if gameState.physicsEngine != nil {
 		worldBounds := WorldBounds{
@@ -323,7 +443,7 @@ func (ml *MapLoader) ApplyMapToGameState(loadedMap *LoadedMap, gameState *GameMa
 
 	ml.logger.Info("Map applied. Total objects: %d, scripted objects: %d, world size: %dx%d px",
 		len(gameState.gameObjects),
-		len(gameState.objects),
+		gameState.entities.ObjectCount(),
 		loadedMap.Width*loadedMap.TileWidth,
 		loadedMap.Height*loadedMap.TileHeight)
 }
@@ -335,6 +455,15 @@ func (ml *MapLoader) GetRandomSpawnPoint(loadedMap *LoadedMap) vector.Vector {
 	return loadedMap.SpawnPoints[0] // deterministic for now
 }
 
+// GetSpawnPointInGroup returns a random spawn point of the given group
+func (ml *MapLoader) GetSpawnPointInGroup(loadedMap *LoadedMap, group string) (vector.Vector, bool) {
+	points := loadedMap.SpawnGroups[group]
+	if len(points) == 0 {
+		return vector.Vector{}, false
+	}
+	return points[rand.Intn(len(points))], true
+}
+
 func (ml *MapLoader) GetSpawnPointByIndex(loadedMap *LoadedMap, index int) vector.Vector {
 	if index < 0 || index >= len(loadedMap.SpawnPoints) {
 		return ml.GetRandomSpawnPoint(loadedMap)
@@ -342,17 +471,68 @@ func (ml *MapLoader) GetSpawnPointByIndex(loadedMap *LoadedMap, index int) vecto
 	return loadedMap.SpawnPoints[index]
 }
 
-func (ml *MapLoader) GetMapInfo(loadedMap *LoadedMap) map[string]interface{} {
-	return map[string]interface{}{
-		"width":       loadedMap.Width,
-		"height":      loadedMap.Height,
-		"tileWidth":   loadedMap.TileWidth,
-		"tileHeight":  loadedMap.TileHeight,
-		"objectCount": len(loadedMap.GameObjects),
-		"spawnPoints": len(loadedMap.SpawnPoints),
-		"colliders":   len(loadedMap.Colliders),
-		"properties":  loadedMap.Properties,
+// MapInfo is the summary of the loaded map world_state carries in mapInfo. Its fields keep the
+// alphabetical order it had as a map, so its bytes stay the same.
+type MapInfo struct {
+	Colliders   int                    `json:"colliders"`
+	Height      int                    `json:"height"`
+	ObjectCount int                    `json:"objectCount"`
+	Properties  map[string]interface{} `json:"properties"`
+	SpawnPoints int                    `json:"spawnPoints"`
+	TileHeight  int                    `json:"tileHeight"`
+	TileWidth   int                    `json:"tileWidth"`
+	Width       int                    `json:"width"`
+}
+
+func (ml *MapLoader) GetMapInfo(loadedMap *LoadedMap) *MapInfo {
+	return &MapInfo{
+		Width:       loadedMap.Width,
+		Height:      loadedMap.Height,
+		TileWidth:   loadedMap.TileWidth,
+		TileHeight:  loadedMap.TileHeight,
+		ObjectCount: len(loadedMap.GameObjects),
+		SpawnPoints: len(loadedMap.SpawnPoints),
+		Colliders:   len(loadedMap.Colliders),
+		Properties:  loadedMap.Properties,
+	}
+}
+
+// GetMarker returns the world position of a named spawn point or marker object
+func (ml *MapLoader) GetMarker(loadedMap *LoadedMap, name string) (vector.Vector, bool) {
+	pos, ok := loadedMap.Markers[name]
+	return pos, ok
+}
+
+// GetTileAt returns the top-most non-empty tile at the given world coordinate.
+// If layerName is non-empty only that layer is inspected.
+func (ml *MapLoader) GetTileAt(loadedMap *LoadedMap, x, y float64, layerName string) *TileInfo {
+	if loadedMap.TileWidth <= 0 || loadedMap.TileHeight <= 0 || x < 0 || y < 0 {
+		return nil
+	}
+	tx := int(x) / loadedMap.TileWidth
+	ty := int(y) / loadedMap.TileHeight
+
+	for i := len(loadedMap.TileLayers) - 1; i >= 0; i-- {
+		layer := &loadedMap.TileLayers[i]
+		if layerName != "" && !strings.EqualFold(layer.Name, layerName) {
+			continue
+		}
+		if tx >= layer.Width || ty >= layer.Height {
+			continue
+		}
+		gid := layer.Data[ty*layer.Width+tx]
+		if gid == 0 {
+			continue
+		}
+		return &TileInfo{
+			Layer:      layer.Name,
+			GID:        gid,
+			TileX:      tx,
+			TileY:      ty,
+			Properties: loadedMap.TileProperties[int(gid)],
+		}
 	}
+	return nil
 }
 
 // SetPhysicsEngine sets a reference to the physics engine
@@ -411,6 +591,31 @@ func (ml *MapLoader) processTileLayer(tmap *TiledMap, layer *TiledLayer, lm *Loa
 	ml.logger.Debug("Built %d tile colliders from layer: %s", len(lm.Colliders), layer.Name)
 }
 
+// storeTileLayer keeps a sanitized copy of a tile layer grid for coordinate lookups
+func (ml *MapLoader) storeTileLayer(layer *TiledLayer, lm *LoadedMap) {
+	if len(layer.Data) != layer.Width*layer.Height {
+		ml.logger.Warn("Tile layer %s has %d tiles, expected %dx%d; skipping lookup data",
+			layer.Name, len(layer.Data), layer.Width, layer.Height)
+		return
+	}
+	data := make([]uint32, len(layer.Data))
+	for i, gid := range layer.Data {
+		data[i] = sanitizeGID(gid)
+	}
+	stored := MapTileLayer{
+		Name:   layer.Name,
+		Width:  layer.Width,
+		Height: layer.Height,
+		Data:   data,
+	}
+	for _, p := range layer.Properties {
+		if v, ok := p.Value.(float64); ok && strings.EqualFold(p.Name, "elevation") {
+			stored.Elevation, stored.HasElevation = v, true
+		}
+	}
+	lm.TileLayers = append(lm.TileLayers, stored)
+}
+
 // processTileLayerCollisions processes collision objects from tiles in a tilelayer
 func (ml *MapLoader) processTileLayerCollisions(tmap *TiledMap, layer *TiledLayer, tilesetData map[int]*TiledTilesetData, lm *LoadedMap) {
 	if len(layer.Data) == 0 || len(lm.TileCollisions) == 0 {
@@ -677,13 +882,378 @@ func (ml *MapLoader) processObjectLayer(tmap *TiledMap, layer *TiledLayer, lm *L
 			continue
 		}
 
+		// Checked before spawn points: spawner names usually contain "spawn"
+		if strings.EqualFold(obj.Type, "npc_spawner") {
+			spawner := NPCSpawner{
+				ID:           obj.ID,
+				Position:     vector.Vector{X: worldX, Y: worldY},
+				Count:        1,
+				RespawnTicks: int64(defaultNPCRespawnDelay * TickRate),
+			}
+			for _, p := range obj.Properties {
+				switch strings.ToLower(p.Name) {
+				case "npc":
+					spawner.NPC, _ = p.Value.(string)
+				case "count":
+					if v, ok := p.Value.(float64); ok && v > 0 {
+						spawner.Count = int(v)
+					}
+				case "respawndelay":
+					if v, ok := p.Value.(float64); ok && v >= 0 {
+						spawner.RespawnTicks = int64(v * TickRate)
+					}
+				case "path":
+					// object reference (ID) or the name of the path object
+					spawner.pathRef = p.Value
+				case "dormant":
+					spawner.Disabled, _ = p.Value.(bool)
+				case "leashradius":
+					if v, ok := p.Value.(float64); ok && v > 0 {
+						spawner.LeashRadius = v
+					}
+				case "maxchase":
+					if v, ok := p.Value.(float64); ok && v > 0 {
+						spawner.MaxChase = v
+					}
+				}
+			}
+			if spawner.NPC == "" {
+				ml.logger.Warn("Skipping npc_spawner %d without an npc property", obj.ID)
+				continue
+			}
+			lm.NPCSpawners = append(lm.NPCSpawners, spawner)
+			continue
+		}
+
 		if strings.EqualFold(obj.Type, "spawn_point") || strings.Contains(strings.ToLower(obj.Name), "spawn") {
 			lm.SpawnPoints = append(lm.SpawnPoints, vector.Vector{X: worldX, Y: worldY})
+			for _, p := range obj.Properties {
+				if group, ok := p.Value.(string); ok && group != "" && strings.EqualFold(p.Name, "group") {
+					lm.SpawnGroups[group] = append(lm.SpawnGroups[group], vector.Vector{X: worldX, Y: worldY})
+				}
+			}
+			if obj.Name != "" {
+				lm.Markers[obj.Name] = vector.Vector{X: worldX, Y: worldY}
+			}
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, "water") && obj.Width > 0 && obj.Height > 0 {
+			lm.WaterVolumes = append(lm.WaterVolumes, WaterVolume{
+				Min:  vector.Vector{X: obj.X, Y: obj.Y},
+				Max:  vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+				Deep: ml.hasTrueProperty(obj.Properties, "deep"),
+			})
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, "effect_zone") && obj.Width > 0 && obj.Height > 0 {
+			zone := EffectZone{
+				Name: obj.Name,
+				Min:  vector.Vector{X: obj.X, Y: obj.Y},
+				Max:  vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+			}
+			for _, p := range obj.Properties {
+				if v, ok := p.Value.(string); ok && strings.ToLower(p.Name) == "effect" {
+					zone.Effect = v
+				}
+			}
+			if zone.Effect == "" {
+				ml.logger.Warn("Effect zone %q (id %d) has no effect property; skipping", obj.Name, obj.ID)
+				continue
+			}
+			lm.EffectZones = append(lm.EffectZones, zone)
+			continue
+		}
+
+		if (strings.EqualFold(obj.Type, hazardObjectType) || strings.EqualFold(layer.Name, hazardLayerName)) && obj.Width > 0 && obj.Height > 0 {
+			if zone, ok := ml.parseHazard(obj); ok {
+				lm.Hazards = append(lm.Hazards, zone)
+			}
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, stealthZoneObjectType) && obj.Width > 0 && obj.Height > 0 {
+			lm.StealthZones = append(lm.StealthZones, StealthZone{
+				Name: obj.Name,
+				Min:  vector.Vector{X: obj.X, Y: obj.Y},
+				Max:  vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+			})
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, darkZoneObjectType) && obj.Width > 0 && obj.Height > 0 {
+			lm.DarkZones = append(lm.DarkZones, DarkZone{
+				Name: obj.Name,
+				Min:  vector.Vector{X: obj.X, Y: obj.Y},
+				Max:  vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+			})
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, lightObjectType) {
+			light := LightSource{ID: obj.ID, Name: obj.Name, Position: vector.Vector{X: worldX, Y: worldY}, Radius: defaultLightRadius, Lit: true}
+			for _, p := range obj.Properties {
+				switch strings.ToLower(p.Name) {
+				case "radius":
+					if v, ok := p.Value.(float64); ok && v > 0 {
+						light.Radius = v
+					}
+				case "color":
+					light.Color, _ = p.Value.(string)
+				case "flicker":
+					if v, ok := p.Value.(float64); ok {
+						light.Flicker = clampFlicker(v)
+					}
+				case "lit":
+					if v, ok := p.Value.(bool); ok {
+						light.Lit = v
+					}
+				}
+			}
+			lm.Lights = append(lm.Lights, light)
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, waypointObjectType) {
+			waypoint := Waypoint{ID: obj.Name, Name: obj.Name, Position: vector.Vector{X: worldX, Y: worldY}, Radius: defaultWaypointRadius}
+			for _, p := range obj.Properties {
+				switch strings.ToLower(p.Name) {
+				case "id":
+					if v, ok := p.Value.(string); ok && v != "" {
+						waypoint.ID = v
+					}
+				case "radius":
+					if v, ok := p.Value.(float64); ok && v > 0 {
+						waypoint.Radius = v
+					}
+				case "checkpoint":
+					waypoint.Checkpoint, _ = p.Value.(bool)
+				case "cost":
+					if v, ok := p.Value.(float64); ok && v > 0 {
+						waypoint.Cost = int64(v)
+					}
+				case "currency":
+					waypoint.Currency, _ = p.Value.(string)
+				case "costitem":
+					waypoint.CostItem, _ = p.Value.(string)
+				}
+			}
+			if waypoint.ID == "" {
+				ml.logger.Warn("Skipping waypoint %d without a name or id property", obj.ID)
+				continue
+			}
+			lm.Waypoints = append(lm.Waypoints, waypoint)
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, "event_zone") && obj.Width > 0 && obj.Height > 0 {
+			zone := EventZone{
+				Name: obj.Name,
+				Min:  vector.Vector{X: obj.X, Y: obj.Y},
+				Max:  vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+			}
+			for _, p := range obj.Properties {
+				if v, ok := p.Value.(string); ok && strings.ToLower(p.Name) == "event" {
+					zone.Event = v
+				}
+			}
+			if zone.Event == "" {
+				ml.logger.Warn("Event zone %q (id %d) has no event property; skipping", obj.Name, obj.ID)
+				continue
+			}
+			lm.EventZones = append(lm.EventZones, zone)
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, plotObjectType) && obj.Width > 0 && obj.Height > 0 {
+			plot := PlotArea{
+				ID:           obj.ID,
+				Name:         obj.Name,
+				Min:          vector.Vector{X: obj.X, Y: obj.Y},
+				Max:          vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+				MaxFurniture: defaultPlotMaxFurniture,
+			}
+			for _, p := range obj.Properties {
+				switch strings.ToLower(p.Name) {
+				case "deed":
+					plot.Deed, _ = p.Value.(string)
+				case "maxfurniture":
+					if v, ok := p.Value.(float64); ok && v >= 0 {
+						plot.MaxFurniture = int(v)
+					}
+				}
+			}
+			lm.Plots = append(lm.Plots, plot)
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, "pvp_zone") && obj.Width > 0 && obj.Height > 0 {
+			zone := PvPZone{
+				Name: obj.Name,
+				Mode: PvPSafe,
+				Min:  vector.Vector{X: obj.X, Y: obj.Y},
+				Max:  vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+			}
+			for _, p := range obj.Properties {
+				if v, ok := p.Value.(string); ok && strings.ToLower(p.Name) == "pvp" {
+					zone.Mode = strings.ToLower(v)
+				}
+			}
+			if _, known := pvpModeRank[zone.Mode]; !known {
+				ml.logger.Warn("PvP zone %q (id %d) has unknown mode %q; treating it as safe", obj.Name, obj.ID, zone.Mode)
+				zone.Mode = PvPSafe
+			}
+			lm.PvPZones = append(lm.PvPZones, zone)
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, regionObjectType) && obj.Width > 0 && obj.Height > 0 {
+			if obj.Name == "" {
+				ml.logger.Warn("Region object %d has no name; skipping", obj.ID)
+				continue
+			}
+			region := Region{
+				ID:   obj.Name,
+				Name: obj.Name,
+				Min:  vector.Vector{X: obj.X, Y: obj.Y},
+				Max:  vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+			}
+			for _, p := range obj.Properties {
+				if strings.EqualFold(p.Name, "updateRate") {
+					rate, _ := p.Value.(float64)
+					if validUpdateRate(rate) {
+						region.UpdateRate = rate
+					} else {
+						ml.logger.Warn("Region %q (id %d) has update rate %v outside %.0f-%.0f; using the default", obj.Name, obj.ID, p.Value, minWorldUpdateRate, maxWorldUpdateRate)
+					}
+					continue
+				}
+				v, ok := p.Value.(string)
+				if !ok {
+					continue
+				}
+				switch strings.ToLower(p.Name) {
+				case "displayname":
+					region.Name = v
+				case "music":
+					region.Music = v
+				case "pvp":
+					region.PvP = strings.ToLower(v)
+				case "script":
+					region.Script = v
+				case "population":
+					population, err := parsePopulation(v)
+					if err != nil {
+						ml.logger.Warn("Region %q (id %d) has an invalid population: %v; ignoring it", obj.Name, obj.ID, err)
+						continue
+					}
+					region.Population = population
+				}
+			}
+			if region.PvP != "" {
+				if _, known := pvpModeRank[region.PvP]; known {
+					lm.PvPZones = append(lm.PvPZones, PvPZone{Name: region.ID, Mode: region.PvP, Min: region.Min, Max: region.Max})
+				} else {
+					ml.logger.Warn("Region %q (id %d) has unknown PvP mode %q; ignoring it", obj.Name, obj.ID, region.PvP)
+					region.PvP = ""
+				}
+			}
+			lm.Regions = append(lm.Regions, region)
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, encounterObjectType) && obj.Width > 0 && obj.Height > 0 {
+			if area, ok := ml.parseEncounterArea(obj); ok {
+				lm.Encounters = append(lm.Encounters, area)
+			}
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, ledgeObjectType) {
+			if ledge, ok := ml.parseLedge(obj); ok {
+				lm.Ledges = append(lm.Ledges, ledge)
+			}
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, trapObjectType) {
+			if trap, ok := ml.parseTrap(obj, worldX, worldY); ok {
+				lm.Traps = append(lm.Traps, trap)
+			}
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, audioCueObjectType) {
+			if cue, ok := ml.parseAudioCue(obj, worldX, worldY); ok {
+				lm.AudioCues = append(lm.AudioCues, cue)
+			}
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, "build_zone") && obj.Width > 0 && obj.Height > 0 {
+			zone := BuildZone{
+				Name:       obj.Name,
+				Min:        vector.Vector{X: obj.X, Y: obj.Y},
+				Max:        vector.Vector{X: obj.X + obj.Width, Y: obj.Y + obj.Height},
+				AllowBuild: true,
+			}
+			for _, p := range obj.Properties {
+				switch strings.ToLower(p.Name) {
+				case "allowbuild":
+					if v, ok := p.Value.(bool); ok {
+						zone.AllowBuild = v
+					}
+				case "buildrole":
+					if v, ok := p.Value.(string); ok {
+						zone.Role = v
+					}
+				}
+			}
+			lm.BuildZones = append(lm.BuildZones, zone)
+			continue
+		}
+
+		if strings.EqualFold(obj.Type, "marker") && obj.Name != "" {
+			lm.Markers[obj.Name] = vector.Vector{X: worldX, Y: worldY}
+			continue
+		}
+
+		if len(obj.Polyline) > 1 || (strings.EqualFold(obj.Type, "path") && len(obj.Polygon) > 1) {
+			path := &MapPath{ID: obj.ID, Name: obj.Name, Closed: len(obj.Polyline) == 0}
+			for _, p := range obj.Polyline {
+				path.Points = append(path.Points, vector.Vector{X: obj.X + p.X, Y: obj.Y + p.Y})
+			}
+			for _, p := range obj.Polygon {
+				path.Points = append(path.Points, vector.Vector{X: obj.X + p.X, Y: obj.Y + p.Y})
+			}
+			lm.Paths[obj.ID] = path
 			continue
 		}
 	}
 }
 
+// resolveSpawnerPaths links NPC spawners to the path objects named in their "path" property
+func (ml *MapLoader) resolveSpawnerPaths(lm *LoadedMap) {
+	for i := range lm.NPCSpawners {
+		spawner := &lm.NPCSpawners[i]
+		switch ref := spawner.pathRef.(type) {
+		case float64:
+			spawner.Path = lm.Paths[int(ref)]
+		case string:
+			for _, path := range lm.Paths {
+				if path.Name == ref {
+					spawner.Path = path
+					break
+				}
+			}
+		}
+		if spawner.pathRef != nil && spawner.Path == nil {
+			ml.logger.Warn("npc_spawner %d references unknown path %v", spawner.ID, spawner.pathRef)
+		}
+	}
+}
+
 // processObjectLayerTileCollisions processes tile objects in an objectgroup that reference tilesets with collision data
 func (ml *MapLoader) processObjectLayerTileCollisions(tmap *TiledMap, layer *TiledLayer, tilesetData map[int]*TiledTilesetData, lm *LoadedMap) {
 	if len(layer.Objects) == 0 || len(lm.TileCollisions) == 0 {
@@ -701,8 +1271,13 @@ func (ml *MapLoader) processObjectLayerTileCollisions(tmap *TiledMap, layer *Til
 		// Get the real GID (removing flip bits)
 		realGID := sanitizeGID(obj.GID)
 
-		// If this object has a "Script" property, register it as a game object
-		if len(obj.Properties) > 0 && ml.hasStringProperty(obj.Properties, "Script", true) {
+		// If this object has a "Script" property (or is a mount, carryable, resource node, control point, soil, fishing spot, door or mechanism), register it as a game object
+		if (len(obj.Properties) > 0 && ml.hasStringProperty(obj.Properties, "Script", true)) ||
+			strings.EqualFold(obj.Type, mountObjectType) || ml.hasTrueProperty(obj.Properties, "carryable") ||
+			strings.EqualFold(obj.Type, resourceObjectType) || strings.EqualFold(obj.Type, controlPointObjectType) ||
+			strings.EqualFold(obj.Type, soilObjectType) || strings.EqualFold(obj.Type, fishingSpotObjectType) ||
+			strings.EqualFold(obj.Type, doorObjectType) || strings.EqualFold(obj.Type, MechanismLever) ||
+			strings.EqualFold(obj.Type, MechanismPressurePlate) {
 			lm.Objects[obj.ID] = &ObjectData{
 				ID:    obj.ID,
 				Name:  obj.Name,
@@ -797,6 +1372,16 @@ func (ml *MapLoader) hasStringProperty(props []TiledProperty, name string, caseI
 	return false
 }
 
+// hasTrueProperty reports whether a boolean property (case-insensitive name) is set to true
+func (ml *MapLoader) hasTrueProperty(props []TiledProperty, name string) bool {
+	for _, p := range props {
+		if v, ok := p.Value.(bool); ok && v && strings.EqualFold(p.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
 const (
 	hFlip uint32 = 0x80000000
 	vFlip uint32 = 0x40000000
@@ -934,3 +1519,20 @@ func (ml *MapLoader) processTilesetColliders(tilesetData map[int]*TiledTilesetDa
 	ml.logger.Info("Finished processing tileset colliders, created %d tile collision templates",
 		len(lm.TileCollisions))
 }
+
+// processTilesetProperties collects custom tile properties keyed by global tile ID
+func (ml *MapLoader) processTilesetProperties(tilesetData map[int]*TiledTilesetData, lm *LoadedMap) {
+	for firstGID, tileset := range tilesetData {
+		for _, tile := range tileset.Tiles {
+			if len(tile.Properties) == 0 {
+				continue
+			}
+			props := make(map[string]interface{}, len(tile.Properties))
+			for _, p := range tile.Properties {
+				props[p.Name] = p.Value
+			}
+			lm.TileProperties[firstGID+tile.ID] = props
+		}
+	}
+	ml.logger.Debug("Collected properties for %d tiles", len(lm.TileProperties))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// MatchMigration is the migrate message sent to the players of a shard that shuts down: join
+// MatchID, the shard replacing it, or call find_world for Map when no replacement could be
+// started (MatchID is empty)
+type MatchMigration struct {
+	Map          string `json:"map"`
+	MatchID      string `json:"matchId"`
+	Reason       string `json:"reason"`       // "shutdown"
+	GraceSeconds int    `json:"graceSeconds"` // time left before the old match is stopped
+}
+
+// HandOff hands an open world shard's map over when the server shuts it down with a grace
+// period (a deploy), so its players aren't dropped into a cold world. The world state must
+// already be saved. The shard gives up its number and starts a replacement with it (or routes
+// to the one another node claimed first), which restores the saved state in MatchInit. The
+// shard stops taking players and saving, and its players are sent a migrate message
+// (OpCodeTravel) naming the replacement. Dungeon instances aren't handed off.
+func (gs *GameMatchState) HandOff(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, graceSeconds int) {
+	if gs.dungeon != nil || !gs.shard.enabled || gs.shard.Closing() || graceSeconds <= 0 {
+		return
+	}
+
+	logger.Info("Handing shard %d of %s over", gs.shard.label.Shard, gs.currentMapName)
+	gs.shard.HandOff()
+	gs.shard.UpdateLabel(gs, dispatcher)
+	matchID := gs.startReplacement(ctx, logger, nk)
+
+	if dispatcher == nil || len(gs.presences) == 0 {
+		return
+	}
+	migration := MatchMigration{Map: gs.currentMapName, MatchID: matchID, Reason: "shutdown", GraceSeconds: graceSeconds}
+	payload, err := EncodeMessage(OpCodeTravel, "migrate", migration)
+	if err != nil {
+		logger.Error("Failed to marshal migrate message: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeTravel, payload, nil, nil, true)
+}
+
+// startReplacement starts the shard replacing one that handed off, or finds the one another
+// node claimed its number for, and returns its match ID ("" when there is none yet). The
+// match's own listing may still show its old number, so it is counted under 0: that way its
+// claim on the number lapses and the number is free.
+func (gs *GameMatchState) startReplacement(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) string {
+	if nk == nil {
+		return ""
+	}
+	shards, err := ListShards(ctx, nk, gs.currentMapName)
+	if err != nil {
+		logger.Error("Failed to list shards of %s for a handoff: %v", gs.currentMapName, err)
+		return ""
+	}
+	self, _ := ctx.Value(runtime.RUNTIME_CTX_MATCH_ID).(string)
+	running := make([]*ShardInfo, 0, len(shards)+1)
+	for _, shard := range shards {
+		if shard.MatchID != self {
+			running = append(running, shard)
+		}
+	}
+	if self != "" {
+		running = append(running, &ShardInfo{MatchID: self, Label: gs.shard.label})
+	}
+
+	shard, err := StartShard(ctx, logger, nk, gs.currentMapName, running)
+	if err != nil {
+		logger.Warn("No replacement for the shard of %s handing off: %v", gs.currentMapName, err)
+		return ""
+	}
+	return shard.MatchID
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+)
+
+// Mechanism events published on the event bus
+const EventMechanismChanged = "mechanism_changed" // objectId, name, active, playerId (empty for plates and scripts)
+
+// Mechanism kinds (ObjectData.Type)
+const (
+	MechanismLever         = "lever"          // toggled by interact
+	MechanismPressurePlate = "pressure_plate" // active while a player or NPC stands on it
+)
+
+// Mechanism tuning. The object properties "target"/"targets", "invert", "latch", "active" and
+// "activeGid" configure each mechanism.
+const (
+	pressurePlateCheckInterval = TickRate / 10 // ticks between two pressure plate checks
+	leverCooldown              = TickRate / 2  // ticks before a lever can be pulled again
+)
+
+// Mechanism target kinds
+const (
+	mechanismTargetDoor    = "door"    // opened while the mechanism is active
+	mechanismTargetSpawner = "spawner" // spawns NPCs while the mechanism is active
+	mechanismTargetObject  = "object"  // gets the "active" property; its colliders are off while active (bridges)
+)
+
+// mechanismTarget is a resolved link from a mechanism to an object it drives
+type mechanismTarget struct {
+	kind string
+	id   int
+}
+
+// Mechanism is a lever or pressure plate linked to doors, objects and NPC spawners. Whenever it
+// turns on or off, its targets follow (the other way round for inverted mechanisms).
+type Mechanism struct {
+	ObjectID  int
+	Name      string
+	Kind      string
+	Active    bool
+	Invert    bool                 // targets are on while the mechanism is off
+	Latch     bool                 // a pressure plate stays down once pressed
+	Sensor    *rigidbody.RigidBody // pressure plate area, queried for overlapping bodies
+	BaseGID   uint32               // tile shown while inactive
+	ActiveGID uint32               // tile shown while active (0 keeps the base tile)
+	targets   []mechanismTarget
+	nextUse   int64 // a lever can't be pulled again before this tick
+}
+
+// MechanismData is a mechanism as sent to clients (world_state "mechanisms")
+type MechanismData struct {
+	ObjectID int    `json:"objectId"`
+	Kind     string `json:"kind"`
+	Active   bool   `json:"active"`
+}
+
+// MechanismManager tracks the levers and pressure plates of the current map and propagates their
+// state to their targets
+type MechanismManager struct {
+	logger     runtime.Logger
+	mechanisms map[int]*Mechanism // object ID -> mechanism
+	dirty      bool               // a lever or latched plate changed since the last save
+	mu         sync.Mutex
+}
+
+// NewMechanismManager creates an empty mechanism manager
+func NewMechanismManager(logger runtime.Logger) *MechanismManager {
+	return &MechanismManager{
+		logger:     logger,
+		mechanisms: make(map[int]*Mechanism),
+	}
+}
+
+// LoadFromMap registers every "lever" and "pressure_plate" object of the current map and resolves
+// their targets. Called after doors and NPC spawners were loaded; unknown targets are dropped.
+func (mm *MechanismManager) LoadFromMap(gs *GameMatchState) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.mechanisms = make(map[int]*Mechanism)
+	for oid, obj := range gs.Objects() {
+		kind := strings.ToLower(obj.Type)
+		if kind != MechanismLever && kind != MechanismPressurePlate {
+			continue
+		}
+		pos, ok := obj.Position()
+		if !ok {
+			mm.logger.Warn("Mechanism %d (%s) has no position; skipping", oid, obj.Name)
+			continue
+		}
+		m := &Mechanism{ObjectID: oid, Name: obj.Name, Kind: kind, BaseGID: obj.GID}
+		m.Active, _ = obj.Props["active"].(bool)
+		m.Invert, _ = obj.Props["invert"].(bool)
+		m.Latch, _ = obj.Props["latch"].(bool)
+		if v, ok := obj.Props["activegid"].(float64); ok && v > 0 {
+			m.ActiveGID = uint32(v)
+		}
+		if kind == MechanismPressurePlate {
+			m.Sensor = MakeRectangleRigidBody(pos.X, pos.Y, TileSize, TileSize)
+		}
+		for _, id := range mechanismTargetIDs(obj.Props) {
+			target, ok := gs.resolveMechanismTarget(id)
+			if !ok {
+				mm.logger.Warn("Mechanism %d (%s) links to unknown object %d; ignoring it", oid, obj.Name, id)
+				continue
+			}
+			m.targets = append(m.targets, target)
+		}
+		mm.mechanisms[oid] = m
+		gs.mirrorMechanism(m)
+	}
+	mm.logger.Info("Registered %d mechanisms", len(mm.mechanisms))
+}
+
+// mechanismTargetIDs reads the linked object IDs from the "target" property (an object reference)
+// and the "targets" property (a comma-separated list of object IDs)
+func mechanismTargetIDs(props map[string]interface{}) []int {
+	var ids []int
+	if v, ok := props["target"].(float64); ok && v > 0 {
+		ids = append(ids, int(v))
+	}
+	switch v := props["targets"].(type) {
+	case float64:
+		ids = append(ids, int(v))
+	case string:
+		for _, part := range strings.Split(v, ",") {
+			if id, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && id > 0 {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// resolveMechanismTarget works out what kind of object a mechanism links to
+func (gs *GameMatchState) resolveMechanismTarget(id int) (mechanismTarget, bool) {
+	if gs.doors.Get(id) != nil {
+		return mechanismTarget{kind: mechanismTargetDoor, id: id}, true
+	}
+	if gs.npcManager.HasSpawner(id) {
+		return mechanismTarget{kind: mechanismTargetSpawner, id: id}, true
+	}
+	if _, ok := gs.Object(id); ok {
+		return mechanismTarget{kind: mechanismTargetObject, id: id}, true
+	}
+	return mechanismTarget{}, false
+}
+
+// Lever returns the lever of an object (nil if the object isn't a lever)
+func (mm *MechanismManager) Lever(oid int) *Mechanism {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if m := mm.mechanisms[oid]; m != nil && m.Kind == MechanismLever {
+		return m
+	}
+	return nil
+}
+
+// Pull toggles a lever for a player who reached it. It returns a reject reason, or "" on success.
+func (mm *MechanismManager) Pull(gs *GameMatchState, lever *Mechanism, playerID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	if gs.currentTick < lever.nextUse {
+		return RejectRateLimited
+	}
+	lever.nextUse = gs.currentTick + leverCooldown
+	mm.Set(gs, lever.ObjectID, !lever.Active, playerID, dispatcher, logger)
+	return ""
+}
+
+// Set turns a mechanism on or off and makes its targets follow. It returns false for unknown
+// mechanisms.
+func (mm *MechanismManager) Set(gs *GameMatchState, oid int, active bool, playerID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) bool {
+	mm.mu.Lock()
+	m, ok := mm.mechanisms[oid]
+	if !ok {
+		mm.mu.Unlock()
+		return false
+	}
+	if m.Active == active {
+		mm.mu.Unlock()
+		return true
+	}
+	m.Active = active
+	if m.Kind == MechanismLever || m.Latch {
+		mm.dirty = true
+	}
+	mm.mu.Unlock()
+
+	gs.mirrorMechanism(m)
+	gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+	gs.propagateMechanism(m, playerID, dispatcher, logger)
+	gs.eventBus.Publish(EventMechanismChanged, map[string]any{"objectId": oid, "name": m.Name, "active": active, "playerId": playerID})
+	return true
+}
+
+// Update presses and releases pressure plates from the bodies standing on them. Called from the
+// match loop after physics.
+func (mm *MechanismManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick%pressurePlateCheckInterval != 0 {
+		return
+	}
+	gs.mu.Lock()
+	bodies := make([]*rigidbody.RigidBody, 0, len(gs.gameObjects))
+	for _, rb := range gs.gameObjects {
+		if rb.IsMovable && gs.physicsEngine.CollisionsEnabled(rb) {
+			bodies = append(bodies, rb)
+		}
+	}
+	gs.mu.Unlock()
+
+	mm.mu.Lock()
+	changed := make(map[int]bool)
+	for oid, m := range mm.mechanisms {
+		if m.Sensor == nil || (m.Latch && m.Active) {
+			continue
+		}
+		if pressed := len(gs.physicsEngine.QueryOverlap(m.Sensor, bodies)) > 0; pressed != m.Active {
+			changed[oid] = pressed
+		}
+	}
+	mm.mu.Unlock()
+
+	// Ordered so linked targets change in the same order every run
+	oids := make([]int, 0, len(changed))
+	for oid := range changed {
+		oids = append(oids, oid)
+	}
+	sort.Ints(oids)
+	for _, oid := range oids {
+		mm.Set(gs, oid, changed[oid], "", dispatcher, mm.logger)
+	}
+}
+
+// Snapshot returns the mechanisms for clients, ordered by object ID
+func (mm *MechanismManager) Snapshot() []MechanismData {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mechanisms := make([]MechanismData, 0, len(mm.mechanisms))
+	for _, m := range mm.mechanisms {
+		mechanisms = append(mechanisms, MechanismData{ObjectID: m.ObjectID, Kind: m.Kind, Active: m.Active})
+	}
+	sort.Slice(mechanisms, func(i, j int) bool { return mechanisms[i].ObjectID < mechanisms[j].ObjectID })
+	return mechanisms
+}
+
+// Save persists the state of levers and latched pressure plates if one changed since the last save
+func (mm *MechanismManager) Save(ctx context.Context, db *DatabaseManager, mapName string) error {
+	mm.mu.Lock()
+	if !mm.dirty {
+		mm.mu.Unlock()
+		return nil
+	}
+	saved := &PersistedMechanisms{Map: mapName, Active: make(map[int]bool)}
+	for oid, m := range mm.mechanisms {
+		if m.Kind == MechanismLever || m.Latch {
+			saved.Active[oid] = m.Active
+		}
+	}
+	mm.dirty = false
+	mm.mu.Unlock()
+
+	if err := db.SaveMechanisms(ctx, saved); err != nil {
+		// Keep the dirty flag so the next periodic save retries
+		mm.mu.Lock()
+		mm.dirty = true
+		mm.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Restore puts levers and latched plates back the way they were before a restart and makes their
+// targets follow again
+func (mm *MechanismManager) Restore(ctx context.Context, gs *GameMatchState) error {
+	saved, err := gs.databaseManager.LoadMechanisms(ctx, gs.currentMapName)
+	if err != nil {
+		return err
+	}
+
+	mm.mu.Lock()
+	restored := make([]*Mechanism, 0, len(saved.Active))
+	for oid, active := range saved.Active {
+		m, ok := mm.mechanisms[oid]
+		if !ok || m.Active == active {
+			continue
+		}
+		m.Active = active
+		restored = append(restored, m)
+	}
+	mm.mu.Unlock()
+
+	for _, m := range restored {
+		gs.mirrorMechanism(m)
+		gs.propagateMechanism(m, "", nil, mm.logger)
+	}
+	mm.logger.Info("Restored %d mechanisms", len(restored))
+	return nil
+}
+
+// mirrorMechanism mirrors a mechanism's state into its object's tile and "active" property
+func (gs *GameMatchState) mirrorMechanism(m *Mechanism) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	obj, ok := gs.Object(m.ObjectID)
+	if !ok {
+		return
+	}
+	obj.Props["active"] = m.Active
+	obj.GID = m.BaseGID
+	if m.Active && m.ActiveGID != 0 {
+		obj.GID = m.ActiveGID
+	}
+}
+
+// propagateMechanism switches a mechanism's targets on or off with it
+func (gs *GameMatchState) propagateMechanism(m *Mechanism, playerID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	on := m.Active != m.Invert
+	for _, target := range m.targets {
+		switch target.kind {
+		case mechanismTargetDoor:
+			if reason := gs.doors.SetOpen(gs, target.id, on, playerID, dispatcher, logger); reason != "" {
+				logger.Debug("Mechanism %d couldn't move door %d: %s", m.ObjectID, target.id, reason)
+			}
+		case mechanismTargetSpawner:
+			gs.npcManager.SetSpawnerEnabled(gs, target.id, on)
+		case mechanismTargetObject:
+			gs.setObjectActive(target.id, on, dispatcher, logger)
+		}
+	}
+}
+
+// setObjectActive sets an object's "active" property and switches its colliders off while it is
+// active (a lowered bridge stops blocking the chasm), then tells clients
+func (gs *GameMatchState) setObjectActive(oid int, active bool, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	if ok {
+		obj.Props["active"] = active
+	}
+	bodies := gs.entities.ObjectColliders(oid)
+	gs.mu.Unlock()
+	if !ok {
+		return
+	}
+	for _, rb := range bodies {
+		gs.physicsEngine.SetCollisionsEnabled(rb, !active)
+	}
+	if len(bodies) > 0 {
+		gs.pathfinder.Invalidate()
+	}
+	gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+}
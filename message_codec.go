@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// MessageCodec encodes the messages the match sends on an opcode and decodes the ones players
+// send on it
+type MessageCodec struct {
+	Marshal   func(msgType string, data any) ([]byte, error)
+	Unmarshal func(data []byte, v any) error
+}
+
+// Protocol is a version of the match protocol: a default codec and the opcodes that override it
+type Protocol struct {
+	Version int
+	Default MessageCodec           // opcodes without a codec of their own, and stream messages
+	Codecs  map[int64]MessageCodec // opcode -> codec, overriding Default
+}
+
+// codec returns the codec of an opcode
+func (p *Protocol) codec(opCode int64) MessageCodec {
+	if c, ok := p.Codecs[opCode]; ok {
+		return c
+	}
+	return p.Default
+}
+
+// jsonCodecV1 is the version 1 encoding: messages sent are a JSON {"type", "data"} envelope
+// (GameMessage), messages received a bare JSON value
+var jsonCodecV1 = MessageCodec{
+	Marshal: func(msgType string, data any) ([]byte, error) {
+		return json.Marshal(GameMessage{Type: msgType, Data: data})
+	},
+	Unmarshal: json.Unmarshal,
+}
+
+// errPayloadType is returned for a message whose data isn't the payload struct of its type on a
+// typed opcode
+var errPayloadType = errors.New("message data isn't its type's payload")
+
+// typedJSONCodecV1 is the version 1 encoding of an opcode whose messages have payload structs
+// (message type -> zero payload): the same bytes as jsonCodecV1, for data of its type's payload
+// struct (or a pointer to it) only. A hand-built map, or a message type the opcode doesn't carry,
+// is refused, so what the opcode sends is declared in one place.
+func typedJSONCodecV1(payloads map[string]any) MessageCodec {
+	types := make(map[string]reflect.Type, len(payloads))
+	for msgType, payload := range payloads {
+		types[msgType] = reflect.TypeOf(payload)
+	}
+	return MessageCodec{
+		Marshal: func(msgType string, data any) ([]byte, error) {
+			want, ok := types[msgType]
+			got := reflect.TypeOf(data)
+			if got != nil && got.Kind() == reflect.Pointer {
+				got = got.Elem()
+			}
+			if !ok || got != want {
+				return nil, fmt.Errorf("%w: %s with %v", errPayloadType, msgType, got)
+			}
+			return jsonCodecV1.Marshal(msgType, data)
+		},
+		Unmarshal: jsonCodecV1.Unmarshal,
+	}
+}
+
+// protocolV1 is the protocol every opcode has spoken since opcodes were introduced: the JSON
+// envelope throughout. The opcodes with payload structs have typed codecs; the others take any
+// data. World updates and input ACKs are encoded by BroadcastEncoder, which gives the bytes of
+// their codec here; changing them means changing it too.
+var protocolV1 = &Protocol{
+	Version: 1,
+	Default: jsonCodecV1,
+	Codecs: map[int64]MessageCodec{
+		OpCodeWorldState:  typedJSONCodecV1(map[string]any{"world_state": WorldStateMessage{}}),
+		OpCodeWorldUpdate: typedJSONCodecV1(map[string]any{"world_update": GameState{}}),
+		OpCodeInputACK:    typedJSONCodecV1(map[string]any{"input_ack": InputACK{}}),
+		OpCodeTravel: typedJSONCodecV1(map[string]any{
+			"waypoints":          WaypointList{},
+			"waypoint_activated": WaypointActivated{},
+			"travel":             WaypointTravel{},
+			"travel_failed":      WaypointTravel{},
+			"world_reset":        WorldResetTravel{},
+			"migrate":            MatchMigration{},
+		}),
+	},
+}
+
+// currentProtocol is the protocol matches speak. A protocol change adds a version with the
+// codecs of the opcodes it changes (the others keep theirs) and makes it current, so the change
+// is one reviewable diff here rather than edits to every sender.
+var currentProtocol = protocolV1
+
+// ProtocolVersion is the version of currentProtocol, sent in world_state
+var ProtocolVersion = currentProtocol.Version
+
+// EncodeMessage encodes a message the match sends on an opcode
+func EncodeMessage(opCode int64, msgType string, data any) ([]byte, error) {
+	return currentProtocol.codec(opCode).Marshal(msgType, data)
+}
+
+// EncodeStreamMessage encodes a message sent on a Nakama stream rather than a match opcode, such
+// as the global chat
+func EncodeStreamMessage(msgType string, data any) ([]byte, error) {
+	return currentProtocol.Default.Marshal(msgType, data)
+}
+
+// DecodeMessage decodes a message a player sent on an opcode into v
+func DecodeMessage(opCode int64, data []byte, v any) error {
+	return currentProtocol.codec(opCode).Unmarshal(data, v)
+}
+
+// supportedProtocol reports whether the match speaks the protocol a joining client named in its
+// "protocol" join metadata. Clients that don't name one are taken to speak the current one.
+func supportedProtocol(metadata map[string]string) bool {
+	v, ok := metadata["protocol"]
+	if !ok {
+		return true
+	}
+	version, err := strconv.Atoi(v)
+	return err == nil && version == currentProtocol.Version
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// codecGolden is the payload golden messages of opcodes without payload structs carry
+var codecGolden = map[string]any{"id": 7, "name": "Ada", "x": 1.5}
+
+// codecStamina is the stamina of codecInputACK
+var codecStamina = 80.0
+
+// codecInputACK is an approved move as the match acknowledges it
+var codecInputACK = InputACK{PlayerID: "p1", Action: "move", InputSequence: 17, Approved: true, Timestamp: 1700000000000, X: 10.5, Y: -3, Stamina: &codecStamina}
+
+// codecWorldUpdate is a tick's world with one player and no NPCs
+var codecWorldUpdate = GameState{
+	Tick:    42,
+	Players: map[string]PlayerData{"p1": {SessionID: "s1", UserID: "p1", Username: "Ada", Position: Position{X: 10.5, Y: -3}, MoveMode: "walk", Health: 90, MaxHealth: 100}},
+	NPCs:    []NPCData{},
+}
+
+// codecGoldens are the bytes the current protocol sends for a message of each opcode, with the
+// payload structs of the opcodes that have them. A protocol change that alters one of them must
+// bump the protocol version.
+var codecGoldens = []struct {
+	opCode  int64
+	msgType string
+	data    any
+	want    string
+}{
+	{OpCodeWorldState, "world_state", WorldStateMessage{Protocol: 1, PlayerCount: 1, MapInfo: &MapInfo{Colliders: 5, Height: 48, ObjectCount: 3, SpawnPoints: 2, TileHeight: 16, TileWidth: 16, Width: 64}},
+		`{"type":"world_state","data":{"clock":{"day":0,"hour":0,"minute":0,"time":0,"isDay":false,"dayLength":0},"colliders":null,"controlPoints":null,"doors":null,"gameObjects":null,"liveOps":{"events":null},"mapInfo":{"colliders":5,"height":48,"objectCount":3,"properties":null,"spawnPoints":2,"tileHeight":16,"tileWidth":16,"width":64},"mechanisms":null,"npcs":null,"objects":null,"pets":null,"playerCount":1,"plots":null,"protocol":1,"weather":{"state":"","remaining":0},"worldEvents":null}}`},
+	{OpCodeWorldUpdate, "world_update", codecWorldUpdate,
+		`{"type":"world_update","data":{"tick":42,"gameObjects":null,"players":{"p1":{"sessionId":"s1","userId":"p1","username":"Ada","position":{"x":10.5,"y":-3},"facing":0,"moveMode":"walk","health":90,"maxHealth":100}},"npcs":[],"pets":null}}`},
+	{OpCodeMapChange, "map_change", codecGolden, `{"type":"map_change","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeInputACK, "input_ack", codecInputACK,
+		`{"type":"input_ack","data":{"playerId":"p1","action":"move","inputSequence":17,"approved":true,"timestamp":1700000000000,"x":10.5,"y":-3,"stamina":80}}`},
+	{OpCodeObjectUpdate, "object_removed", codecGolden, `{"type":"object_removed","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeWorldVarChange, "world_var_changed", codecGolden, `{"type":"world_var_changed","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeInventoryUpdate, "inventory_update", codecGolden, `{"type":"inventory_update","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeEmote, "emote", codecGolden, `{"type":"emote","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodePlayerStatus, "player_status", codecGolden, `{"type":"player_status","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeAbilityResult, "ability_cast", codecGolden, `{"type":"ability_cast","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeCommandResult, "command_result", codecGolden, `{"type":"command_result","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeRespawn, "npc_died", codecGolden, `{"type":"npc_died","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeDamage, "damage", codecGolden, `{"type":"damage","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeWorldClock, "world_clock", codecGolden, `{"type":"world_clock","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeWeather, "weather", codecGolden, `{"type":"weather","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeWorldEvent, "live_ops", codecGolden, `{"type":"live_ops","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeDuel, "duel_challenge", codecGolden, `{"type":"duel_challenge","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeGuild, "guild_update", codecGolden, `{"type":"guild_update","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeHousing, "plot_update", codecGolden, `{"type":"plot_update","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeFishing, "fish_bite", codecGolden, `{"type":"fish_bite","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodePet, "pet_list", codecGolden, `{"type":"pet_list","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeQuest, "quest_log", codecGolden, `{"type":"quest_log","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeReputation, "reputation", codecGolden, `{"type":"reputation","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeExploration, "explored", codecGolden, `{"type":"explored","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeRegion, "region_entered", codecGolden, `{"type":"region_entered","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeDungeon, "dungeon_progress", codecGolden, `{"type":"dungeon_progress","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeProjectile, "projectile_launched", codecGolden, `{"type":"projectile_launched","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeCombat, "aoe", codecGolden, `{"type":"aoe","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeNoise, "noise", codecGolden, `{"type":"noise","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeTravel, "migrate", MatchMigration{Map: "overworld", MatchID: "match.node", Reason: "shutdown", GraceSeconds: 30},
+		`{"type":"migrate","data":{"map":"overworld","matchId":"match.node","reason":"shutdown","graceSeconds":30}}`},
+	{OpCodeAnnouncement, "announcement", codecGolden, `{"type":"announcement","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeClock, "pong", codecGolden, `{"type":"pong","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeLoginReward, "login_reward", codecGolden, `{"type":"login_reward","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeAuction, "auction_listed", codecGolden, `{"type":"auction_listed","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeCutscene, "cutscene", codecGolden, `{"type":"cutscene","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodePositionCorrection, "position_correction", codecGolden, `{"type":"position_correction","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeAudio, "audio_cues", codecGolden, `{"type":"audio_cues","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeBark, "npc_bark", codecGolden, `{"type":"npc_bark","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeMinimap, "poi", codecGolden, `{"type":"poi","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeTrap, "trap", codecGolden, `{"type":"trap","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeEncounter, "encounter", codecGolden, `{"type":"encounter","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodePreferences, "preferences", codecGolden, `{"type":"preferences","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeShop, "shop", codecGolden, `{"type":"shop","data":{"id":7,"name":"Ada","x":1.5}}`},
+	{OpCodeParty, "party_update", codecGolden, `{"type":"party_update","data":{"id":7,"name":"Ada","x":1.5}}`},
+}
+
+func TestEncodeMessageGolden(t *testing.T) {
+	if ProtocolVersion != 1 {
+		t.Fatalf("protocol version %d has no goldens", ProtocolVersion)
+	}
+	if len(codecGoldens) != OpCodeParty {
+		t.Fatalf("%d goldens for %d opcodes", len(codecGoldens), OpCodeParty)
+	}
+	for _, golden := range codecGoldens {
+		got, err := EncodeMessage(golden.opCode, golden.msgType, golden.data)
+		if err != nil {
+			t.Errorf("opcode %d: %v", golden.opCode, err)
+			continue
+		}
+		if string(got) != golden.want {
+			t.Errorf("opcode %d: got %s, want %s", golden.opCode, got, golden.want)
+		}
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	for _, golden := range codecGoldens {
+		var input struct {
+			Type   string `json:"type"`
+			Action string `json:"action"`
+		}
+		if err := DecodeMessage(golden.opCode, []byte(`{"type":"move","action":"interact"}`), &input); err != nil {
+			t.Errorf("opcode %d: %v", golden.opCode, err)
+			continue
+		}
+		if input.Type != "move" || input.Action != "interact" {
+			t.Errorf("opcode %d: decoded %+v", golden.opCode, input)
+		}
+	}
+}
+
+func TestEncodeStreamMessage(t *testing.T) {
+	got, err := EncodeStreamMessage("global_chat", codecGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"type":"global_chat","data":{"id":7,"name":"Ada","x":1.5}}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// TestBroadcastEncoderGolden checks that the match loop's encoder sends the bytes of the world
+// update and input ACK codecs
+func TestBroadcastEncoderGolden(t *testing.T) {
+	for _, golden := range codecGoldens {
+		be := NewBroadcastEncoder()
+		var got []byte
+		var err error
+		switch golden.opCode {
+		case OpCodeWorldUpdate:
+			world := golden.data.(GameState)
+			if err = be.Begin(world); err == nil {
+				got, err = be.View(world)
+			}
+		case OpCodeInputACK:
+			ack := golden.data.(InputACK)
+			got, err = be.Message(golden.msgType, &ack)
+		default:
+			continue
+		}
+		if err != nil {
+			t.Errorf("opcode %d: %v", golden.opCode, err)
+			continue
+		}
+		if string(got) != golden.want {
+			t.Errorf("opcode %d: got %s, want %s", golden.opCode, got, golden.want)
+		}
+	}
+}
+
+func TestTypedCodecRefusesOtherPayloads(t *testing.T) {
+	if _, err := EncodeMessage(OpCodeWorldState, "world_state", codecGolden); !errors.Is(err, errPayloadType) {
+		t.Errorf("world_state map: got %v, want %v", err, errPayloadType)
+	}
+	if _, err := EncodeMessage(OpCodeTravel, "teleport", MatchMigration{}); !errors.Is(err, errPayloadType) {
+		t.Errorf("unknown travel message: got %v, want %v", err, errPayloadType)
+	}
+	if _, err := EncodeMessage(OpCodeTravel, "migrate", &MatchMigration{Map: "overworld"}); err != nil {
+		t.Errorf("migrate by pointer: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+// defaultMessages are the built-in English templates of every message key the server sends.
+// Translations (and English overrides) come from messages.json; see MessageCatalog.
+var defaultMessages = map[string]string{
+	// Generic
+	"error.text":           "{text}",
+	"error.no_body":        "you have no body in the world",
+	"error.unknown_player": "unknown player \"{player}\"",
+	"error.unknown_item":   "unknown item \"{item}\"",
+	"error.bad_count":      "count must be a positive number",
+	"common.on":            "on",
+	"common.off":           "off",
+
+	// Slash commands (command.<name> is the /help description)
+	"cmd.usage":               "usage: {usage}",
+	"cmd.help":                "{commands}",
+	"cmd.help.line":           "{usage} — {description}",
+	"cmd.where":               "{x}, {y} (tile {tileX}, {tileY}) on {map}",
+	"cmd.players":             "{count} online: {names}",
+	"cmd.tp.bad_coords":       "coordinates must be numbers",
+	"cmd.tp.no_body":          "player has no body in the world",
+	"cmd.tp.blocked":          "no free spot near the destination",
+	"cmd.tp.done":             "teleported to {x}, {y}",
+	"cmd.give.failed":         "failed to give items",
+	"cmd.give.done":           "gave {count} x {item}",
+	"cmd.spawn_npc.unknown":   "unknown NPC type \"{type}\"",
+	"cmd.spawn_npc.done":      "spawned {type} (npc {npcId})",
+	"cmd.time.gm_only":        "only GMs in GM mode can set the time",
+	"cmd.time.now":            "day {day}, {time} ({period})",
+	"cmd.weather.gm_only":     "only GMs in GM mode can set the weather",
+	"cmd.weather.unknown":     "unknown weather \"{weather}\" (clear, rain, storm, fog)",
+	"cmd.weather.now":         "{weather} for another {seconds}s",
+	"cmd.event.none":          "no world events on this map",
+	"cmd.event.list":          "{events}",
+	"cmd.event.line":          "{event} ({status})",
+	"cmd.event.gm_only":       "only GMs in GM mode can start or stop world events",
+	"cmd.event.started":       "started {event}",
+	"cmd.event.not_running":   "world event \"{event}\" is not running",
+	"cmd.event.stopped":       "stopped {event}",
+	"cmd.pvp.cooldown":        "you can change your PvP flag again in {seconds}s",
+	"cmd.pvp.in_combat":       "you are in PvP combat; try again in {seconds}s",
+	"cmd.pvp.outlaw":          "outlaws can't turn PvP off",
+	"cmd.pvp.status":          "zone {zone}, PvP {flag}, karma {karma}",
+	"cmd.pvp.status_outlaw":   "zone {zone}, PvP {flag}, karma {karma} (outlaw)",
+	"cmd.guild.none":          "you are not in a guild",
+	"cmd.guild.info":          "{info}",
+	"cmd.guild.header":        "[{tag}] {name}",
+	"cmd.guild.member":        "{player} — {rank}",
+	"cmd.guild.member_online": "{player} — {rank} (online)",
+	"cmd.guild.bank":          "bank: {items}",
+	"cmd.guild.founded":       "founded [{tag}] {name}",
+	"cmd.guild.invited":       "invited {player}",
+	"cmd.guild.joined":        "joined {guild}",
+	"cmd.guild.left":          "left the guild",
+	"cmd.guild.kicked":        "kicked {player}",
+	"cmd.guild.rank":          "{player} is now {rank}",
+	"cmd.guild.deposited":     "deposited {count} x {item}",
+	"cmd.guild.withdrew":      "withdrew {count} x {item}",
+	"cmd.guild.disbanded":     "disbanded the guild",
+	"cmd.plot.none":           "you are not standing on a plot",
+	"cmd.plot.access":         "plot access set to {access}",
+	"cmd.plot.allowed":        "{player} can now build on your plot",
+	"cmd.plot.denied":         "{player} can no longer build on your plot",
+	"cmd.gm.not_gm":           "your account is not a GM",
+	"cmd.gm.on":               "GM mode on",
+	"cmd.gm.off":              "GM mode off",
+	"cmd.invisible.on":        "you are invisible",
+	"cmd.invisible.off":       "you are visible",
+	"cmd.god.on":              "god mode on",
+	"cmd.god.off":             "god mode off",
+	"cmd.noclip.on":           "no-clip on",
+	"cmd.noclip.off":          "no-clip off",
+	"cmd.freeze.on":           "{player} is frozen",
+	"cmd.freeze.off":          "{player} can move again",
+	"cmd.spawn_item.done":     "spawned {count} x {item} (object {objectId})",
+	"cmd.language.current":    "your language is {locale} (available: {available})",
+	"cmd.language.set":        "language set to {locale}",
+	"cmd.language.failed":     "failed to change your language",
+	"command.help":            "list the commands you can use",
+	"command.where":           "show your position",
+	"command.players":         "list connected players",
+	"command.gm":              "turn GM mode on or off; the other GM commands need it",
+	"command.invisible":       "hide yourself from players and NPCs",
+	"command.god":             "ignore all damage",
+	"command.noclip":          "walk through walls",
+	"command.freeze":          "hold a player in place",
+	"command.spawn_item":      "drop items at your position",
+	"command.tp":              "teleport yourself or another player",
+	"command.give":            "give items to yourself or another player",
+	"command.spawn_npc":       "spawn an NPC at your position",
+	"command.weather":         "show the weather, or set it (GM)",
+	"command.event":           "list world events, or start/stop one (GM)",
+	"command.pvp":             "show your PvP status, or flag/unflag yourself",
+	"command.guild":           "show your guild, or manage it",
+	"command.g":               "talk to the online members of your guild",
+	"command.global":          "talk to the players of every map",
+	"command.lfg":             "tell the players of every map you are looking for a group",
+	"command.plot":            "show the plot you stand on, or manage your plot",
+	"command.time":            "show the time of day, or set it (GM)",
+	"command.language":        "show your language, or change it",
+	"time.day":                "day",
+	"time.night":              "night",
+	"event.status.running":    "running",
+	"event.status.scheduled":  "scheduled",
+	"event.unknown":           "unknown world event \"{event}\"",
+	"event.already_running":   "world event \"{event}\" is already running",
+	"guild.tag_taken":         "guild tag is already taken",
+	"guild.bad_tag":           "guild tags are 2-5 letters or digits",
+	"guild.bad_name":          "guild names are {min}-{max} characters long",
+	"guild.already_member":    "you are already in a guild",
+	"guild.create_failed":     "failed to create the guild",
+	"guild.target_in_guild":   "{player} is already in a guild",
+	"guild.full":              "the guild is full",
+	"guild.no_invite":         "you have no pending guild invite",
+	"guild.gone":              "the guild no longer exists",
+	"guild.join_failed":       "failed to join the guild",
+	"guild.leader_leaving":    "promote a new leader before leaving",
+	"guild.not_in_your_guild": "{player} is not in your guild",
+	"guild.kick_rank":         "you can only kick lower-ranked members",
+	"guild.not_other_member":  "{player} is not another member of your guild",
+	"guild.update_failed":     "failed to update the guild",
+	"guild.not_officer":       "{player} is not an officer of your guild",
+	"guild.bank_full":         "the guild bank is full",
+	"guild.missing_items":     "you don't have {count} x {item}",
+	"guild.deposit_failed":    "failed to deposit items",
+	"guild.bank_short":        "the guild bank holds only {count} x {item}",
+	"guild.withdraw_failed":   "failed to withdraw items",
+	"guild.chat_empty":        "nothing to say",
+	"moderation.blocked":      "that contains words that aren't allowed",
+	"guild.chat_too_long":     "guild messages are at most {max} characters",
+	"global.chat_empty":       "nothing to say",
+	"global.chat_too_long":    "global messages are at most {max} characters",
+	"global.chat_cooldown":    "wait {seconds}s before talking globally again",
+	"global.lfg_cooldown":     "you announced you are looking for a group recently",
+	"global.send_failed":      "failed to send the message",
+	"cmd.lfg.sent":            "your looking for group announcement went out",
+	"guild.not_member":        "you are not in a guild",
+	"guild.rank_required":     "only guild {rank}s can do that",
+	"guild.disband_failed":    "failed to disband the guild",
+	"plot.free":               "plot {plot} ({name}) is free",
+	"plot.free_deed":          "plot {plot} ({name}) is free (claiming takes 1 x {deed})",
+	"plot.owned":              "plot {plot} ({name}) belongs to {owner}; access {access}, {furniture}/{maxFurniture} furniture, {builders} builders",
+	"plot.unknown":            "unknown plot {plot}",
+	"plot.bad_access":         "access must be owner, guild or everyone",
+	"plot.not_owner":          "you don't own a plot on this map",
+	"plot.update_failed":      "failed to update the plot",
+	"plot.own_builder":        "you can always build on your own plot",
+	"plot.max_builders":       "a plot can have at most {max} builders",
+
+	// Input rejections (reject.<InputACK.Reason>)
+	"reject.invalid_action":        "you can't do that",
+	"reject.invalid_player":        "that isn't you",
+	"reject.rate_limited":          "slow down",
+	"reject.moving":                "stand still first",
+	"reject.dead":                  "you are dead",
+	"reject.in_cutscene":           "wait for the cutscene to end",
+	"reject.not_dead":              "you are alive",
+	"reject.no_player_object":      "you aren't in the world yet",
+	"reject.on_cooldown":           "not ready yet",
+	"reject.out_of_range":          "too far away",
+	"reject.no_line_of_sight":      "something is in the way",
+	"reject.invalid_target":        "invalid target",
+	"reject.no_direction":          "pick a direction",
+	"reject.unknown_item":          "unknown item",
+	"reject.not_owned":             "you don't have that",
+	"reject.full_health":           "you are at full health",
+	"reject.not_usable":            "that can't be used",
+	"reject.effect_failed":         "nothing happens",
+	"reject.storage_error":         "something went wrong; try again",
+	"reject.not_found":             "it's gone",
+	"reject.unknown_emote":         "unknown emote",
+	"reject.unknown_ability":       "unknown ability",
+	"reject.insufficient_resource": "not enough stamina",
+	"reject.unknown_object":        "that isn't there",
+	"reject.unknown_command":       "unknown command",
+	"reject.permission_denied":     "you aren't allowed to do that",
+	"reject.unknown_buildable":     "unknown building",
+	"reject.blocked":               "something is in the way",
+	"reject.missing_materials":     "you lack the materials",
+	"reject.occupied":              "someone else is using it",
+	"reject.already_mounted":       "you are already riding",
+	"reject.not_mounted":           "you aren't riding",
+	"reject.not_carryable":         "that can't be carried",
+	"reject.already_holding":       "your hands are full",
+	"reject.not_holding":           "you aren't carrying anything",
+	"reject.depleted":              "nothing left to gather",
+	"reject.missing_tool":          "you need a tool for that",
+	"reject.in_combat":             "you are in combat",
+	"reject.outlaw":                "outlaws can't do that",
+	"reject.in_duel":               "already in a duel",
+	"reject.no_request":            "no pending challenge",
+	"reject.plot_claimed":          "the plot is already claimed",
+	"reject.plot_limit":            "you already own a plot here",
+	"reject.plot_full":             "the plot is full",
+	"reject.outside_plot":          "that crosses the plot's border",
+	"reject.already_tilled":        "the soil is already tilled",
+	"reject.not_tilled":            "till the soil first",
+	"reject.not_plantable":         "that can't be planted",
+	"reject.not_ripe":              "it isn't ripe yet",
+	"reject.not_fishing":           "your line isn't in the water",
+	"reject.no_pet":                "you have no pet out",
+	"reject.pet_owned":             "you already have that pet",
+	"reject.unknown_quest":         "unknown quest",
+	"reject.quest_unavailable":     "that quest isn't available",
+	"reject.quest_incomplete":      "the quest isn't finished",
+	"reject.quest_log_full":        "your quest log is full",
+	"reject.hostile":               "they won't talk to you",
+	"reject.locked":                "it's locked",
+	"reject.door_blocked":          "someone is in the doorway",
+	"reject.not_activated":         "you haven't found that waypoint",
+	"reject.cannot_travel":         "you can't travel now",
+	"reject.cannot_afford":         "you can't afford that",
+	"reject.gm_mode_off":           "turn GM mode on first (/gm on)",
+	"reject.not_hungry":            "you aren't hungry",
+	"reject.invalid_listing":       "invalid listing",
+	"reject.empty":                 "it's empty",
+	"reject.already_looted":        "you already looted this",
+	"reject.closed":                "it's closed",
+}
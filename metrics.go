@@ -0,0 +1,191 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// metricsFlushInterval is how often counters and gauges are handed to Nakama's metrics
+const metricsFlushInterval = TickRate
+
+// opcodeTraffic counts the messages and bytes of one opcode since the last flush
+type opcodeTraffic struct {
+	messages int64
+	bytes    int64
+}
+
+// MatchMetrics reports the health of the match through Nakama's metrics API (exported by Nakama
+// in Prometheus format). Every metric is tagged with the match, its map and its mode. Tick and
+// script times are recorded every tick; counters and gauges are flushed once a second. It is
+// only used from the match loop.
+type MatchMetrics struct {
+	nk   runtime.NakamaModule
+	tags map[string]string
+
+	out        map[int64]*opcodeTraffic
+	in         map[int64]*opcodeTraffic
+	ticks      int
+	pairs      int
+	overlaps   int
+	collisions int
+	iterations int
+	nextFlush  int64
+}
+
+// NewMatchMetrics creates the metrics of a match; Configure sets its tags
+func NewMatchMetrics(nk runtime.NakamaModule) *MatchMetrics {
+	return &MatchMetrics{
+		nk:   nk,
+		tags: map[string]string{},
+		out:  make(map[int64]*opcodeTraffic),
+		in:   make(map[int64]*opcodeTraffic),
+	}
+}
+
+// Configure tags the match's metrics with its ID, map and mode ("open_world" or "dungeon")
+func (mm *MatchMetrics) Configure(matchID, mapName, mode string) {
+	mm.tags = map[string]string{"match": matchID, "map": mapName, "mode": mode}
+}
+
+// RecordMessages counts the messages players sent this tick
+func (mm *MatchMetrics) RecordMessages(messages []runtime.MatchData) {
+	for _, message := range messages {
+		traffic := mm.traffic(mm.in, message.GetOpCode())
+		traffic.messages++
+		traffic.bytes += int64(len(message.GetData()))
+	}
+}
+
+// RecordTick records how long the tick that started at started took and the time spent in
+// scripts, and flushes the counters and gauges once a second. Deferred at the start of the
+// match loop.
+func (mm *MatchMetrics) RecordTick(gs *GameMatchState, started time.Time) {
+	if mm.nk == nil {
+		return
+	}
+	mm.nk.MetricsTimerRecord("match_tick_time", mm.tags, time.Since(started))
+	if scripts := gs.scriptEngine.TakeExecutionTime(); scripts > 0 {
+		mm.nk.MetricsTimerRecord("match_script_time", mm.tags, scripts)
+	}
+	step := gs.physicsEngine.LastStepStats()
+	mm.ticks++
+	mm.pairs += step.Pairs
+	mm.overlaps += step.Overlaps
+	mm.collisions += step.Collisions
+	mm.iterations += step.Iterations
+
+	if gs.currentTick < mm.nextFlush {
+		return
+	}
+	mm.nextFlush = gs.currentTick + metricsFlushInterval
+	mm.flush(gs)
+}
+
+// RecordExpiredItems counts dropped items that decayed; the world item sweep reports them
+func (mm *MatchMetrics) RecordExpiredItems(count int) {
+	if mm.nk == nil {
+		return
+	}
+	mm.nk.MetricsCounterAdd("match_world_items_expired", mm.tags, int64(count))
+}
+
+// Dispatcher returns a dispatcher that counts every message the match sends, per opcode and
+// recipient
+func (mm *MatchMetrics) Dispatcher(gs *GameMatchState, dispatcher runtime.MatchDispatcher) runtime.MatchDispatcher {
+	if mm.nk == nil {
+		return dispatcher
+	}
+	return &meteredDispatcher{MatchDispatcher: dispatcher, metrics: mm, gs: gs}
+}
+
+// flush hands the traffic counters, entity counts and physics pair averages to Nakama
+func (mm *MatchMetrics) flush(gs *GameMatchState) {
+	for opCode, traffic := range mm.out {
+		tags := mm.opcodeTags(opCode)
+		mm.nk.MetricsCounterAdd("match_messages_out", tags, traffic.messages)
+		mm.nk.MetricsCounterAdd("match_bytes_out", tags, traffic.bytes)
+	}
+	for opCode, traffic := range mm.in {
+		tags := mm.opcodeTags(opCode)
+		mm.nk.MetricsCounterAdd("match_messages_in", tags, traffic.messages)
+		mm.nk.MetricsCounterAdd("match_bytes_in", tags, traffic.bytes)
+	}
+	clear(mm.out)
+	clear(mm.in)
+
+	mm.nk.MetricsGaugeSet("match_players", mm.tags, float64(len(gs.presences)-gs.bots.Count()))
+	mm.nk.MetricsGaugeSet("match_bots", mm.tags, float64(gs.bots.Count()))
+	mm.nk.MetricsGaugeSet("match_npcs", mm.tags, float64(len(gs.npcManager.Snapshot())))
+	mm.nk.MetricsGaugeSet("match_pets", mm.tags, float64(len(gs.npcManager.PetSnapshot())))
+	mm.nk.MetricsGaugeSet("match_projectiles", mm.tags, float64(gs.projectiles.Count()))
+	mm.nk.MetricsGaugeSet("match_world_items", mm.tags, float64(gs.worldItems.Count()))
+	gs.mu.Lock()
+	bodies := len(gs.gameObjects)
+	gs.mu.Unlock()
+	mm.nk.MetricsGaugeSet("match_bodies", mm.tags, float64(bodies))
+	mm.nk.MetricsGaugeSet("match_load_level", mm.tags, float64(gs.load.Level()))
+
+	if avg, highest, measured := gs.clock.Stats(); measured > 0 {
+		mm.nk.MetricsGaugeSet("match_rtt_avg", mm.tags, avg)
+		mm.nk.MetricsGaugeSet("match_rtt_max", mm.tags, highest)
+	}
+
+	if mm.ticks > 0 {
+		mm.nk.MetricsGaugeSet("match_physics_pairs", mm.tags, float64(mm.pairs)/float64(mm.ticks))
+		mm.nk.MetricsGaugeSet("match_physics_overlaps", mm.tags, float64(mm.overlaps)/float64(mm.ticks))
+		mm.nk.MetricsGaugeSet("match_physics_collisions", mm.tags, float64(mm.collisions)/float64(mm.ticks))
+		mm.nk.MetricsGaugeSet("match_physics_iterations", mm.tags, float64(mm.iterations)/float64(mm.ticks))
+	}
+	mm.ticks, mm.pairs, mm.overlaps, mm.collisions, mm.iterations = 0, 0, 0, 0, 0
+}
+
+// opcodeTags returns the match's tags plus the opcode
+func (mm *MatchMetrics) opcodeTags(opCode int64) map[string]string {
+	tags := make(map[string]string, len(mm.tags)+1)
+	for k, v := range mm.tags {
+		tags[k] = v
+	}
+	tags["opcode"] = strconv.FormatInt(opCode, 10)
+	return tags
+}
+
+// traffic returns the counters of an opcode, creating them on first use
+func (mm *MatchMetrics) traffic(counters map[int64]*opcodeTraffic, opCode int64) *opcodeTraffic {
+	traffic, ok := counters[opCode]
+	if !ok {
+		traffic = &opcodeTraffic{}
+		counters[opCode] = traffic
+	}
+	return traffic
+}
+
+// meteredDispatcher counts what the match sends before handing it to Nakama
+type meteredDispatcher struct {
+	runtime.MatchDispatcher
+	metrics *MatchMetrics
+	gs      *GameMatchState
+}
+
+func (d *meteredDispatcher) BroadcastMessage(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	d.count(opCode, data, presences)
+	return d.MatchDispatcher.BroadcastMessage(opCode, data, presences, sender, reliable)
+}
+
+func (d *meteredDispatcher) BroadcastMessageDeferred(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	d.count(opCode, data, presences)
+	return d.MatchDispatcher.BroadcastMessageDeferred(opCode, data, presences, sender, reliable)
+}
+
+// count adds a message for each recipient: every connected player when presences is nil (bots
+// don't receive anything from Nakama)
+func (d *meteredDispatcher) count(opCode int64, data []byte, presences []runtime.Presence) {
+	recipients := len(presences)
+	if presences == nil {
+		recipients = len(d.gs.presences) - d.gs.bots.Count()
+	}
+	traffic := d.metrics.traffic(d.metrics.out, opCode)
+	traffic.messages += int64(recipients)
+	traffic.bytes += int64(len(data)) * int64(recipients)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Points of interest shown on the minimap
+const (
+	POIQuestGiver  = "quest"      // an NPC with a quest marker for the player
+	POIPartyMember = "party"      // a member of the player's party or dungeon party
+	POIGuildMember = "guild"      // a guild mate on the map
+	POIEventZone   = "event_zone" // a zone of a running world event
+	POIEventBoss   = "event_boss" // a living boss of a running world event
+	POIWaypoint    = "waypoint"   // a waypoint of this map the player activated
+)
+
+// Minimap tuning
+const (
+	minimapInterval   = 2 * TickRate // ticks between point of interest refreshes
+	minimapQuestRange = 1280.0       // px; quest NPCs farther from the player aren't listed
+)
+
+// MinimapPOI is a point of interest on a player's minimap. ID is the NPC ID, player ID, zone
+// name or waypoint ID, depending on Kind.
+type MinimapPOI struct {
+	Kind   string  `json:"kind"`
+	ID     string  `json:"id"`
+	Name   string  `json:"name,omitempty"`
+	X      float64 `json:"x"` // center
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width,omitempty"` // event zones
+	Height float64 `json:"height,omitempty"`
+	Marker string  `json:"marker,omitempty"` // quest givers: the QuestMarker* status
+	Event  string  `json:"event,omitempty"`  // event zones and bosses: the world event ID
+}
+
+// MinimapManager sends each player a compact list of the points of interest on their map
+// (quest givers near them, party and guild members, running world events and the waypoints
+// they activated) as a poi message (OpCodeMinimap), so minimaps are drawn from authoritative
+// data rather than full world snapshots. Lists are refreshed every minimapInterval and only
+// sent when they changed. It is only used from the match loop.
+type MinimapManager struct {
+	logger runtime.Logger
+	sent   map[string][]byte // player ID -> payload last sent
+	next   int64
+}
+
+// NewMinimapManager creates a minimap manager with no players
+func NewMinimapManager(logger runtime.Logger) *MinimapManager {
+	return &MinimapManager{
+		logger: logger,
+		sent:   make(map[string][]byte),
+	}
+}
+
+// Leave forgets a player who left the match
+func (mm *MinimapManager) Leave(playerID string) {
+	delete(mm.sent, playerID)
+}
+
+// Update rebuilds every player's points of interest and sends the lists that changed. Called
+// from the match loop.
+func (mm *MinimapManager) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick < mm.next || dispatcher == nil || len(gs.presences) == 0 {
+		return
+	}
+	mm.next = gs.currentTick + minimapInterval
+
+	npcs := gs.npcManager.Snapshot()
+	byID := make(map[int]NPCData, len(npcs))
+	for _, npc := range npcs {
+		byID[npc.ID] = npc
+	}
+	shared := mm.eventPOIs(gs, byID)
+
+	for playerID, presence := range gs.Presences() {
+		rb := gs.PlayerBody(playerID)
+		if rb == nil {
+			continue
+		}
+		pois := mm.questPOIs(ctx, gs, playerID, rb.Position, npcs)
+		pois = append(pois, mm.memberPOIs(gs, playerID)...)
+		pois = append(pois, shared...)
+		pois = append(pois, mm.waypointPOIs(gs, playerID)...)
+
+		payload, err := EncodeMessage(OpCodeMinimap, "poi", map[string]any{"pois": pois})
+		if err != nil {
+			mm.logger.Error("Failed to marshal points of interest for %s: %v", playerID, err)
+			continue
+		}
+		if previous, ok := mm.sent[playerID]; ok && string(previous) == string(payload) {
+			continue
+		}
+		mm.sent[playerID] = payload
+		dispatcher.BroadcastMessage(OpCodeMinimap, payload, []runtime.Presence{presence}, nil, true)
+	}
+}
+
+// questPOIs lists the NPCs near the player that have a quest marker for them
+func (mm *MinimapManager) questPOIs(ctx context.Context, gs *GameMatchState, playerID string, position vector.Vector, npcs []NPCData) []MinimapPOI {
+	log := gs.quests.logs[playerID]
+	if log == nil {
+		return nil
+	}
+	var pois []MinimapPOI
+	for _, npc := range npcs {
+		if len(gs.quests.byNPC[npc.Type]) == 0 || npc.Position.ToVector().Sub(position).Magnitude() > minimapQuestRange {
+			continue
+		}
+		if def, ok := gs.npcManager.Definition(npc.Type); ok && gs.reputation.IsHostile(playerID, def.Faction) {
+			continue
+		}
+		marker := gs.quests.marker(ctx, gs, playerID, log, npc.Type)
+		if marker == "" {
+			continue
+		}
+		pois = append(pois, MinimapPOI{Kind: POIQuestGiver, ID: strconv.Itoa(npc.ID), Name: npc.Name, X: npc.Position.X, Y: npc.Position.Y, Marker: marker})
+	}
+	sort.Slice(pois, func(i, j int) bool { return pois[i].ID < pois[j].ID })
+	return pois
+}
+
+// memberPOIs lists the player's dungeon party, or in the open world their party members and
+// guild mates on the map. Guild mates in stealth the player hasn't detected aren't listed.
+func (mm *MinimapManager) memberPOIs(gs *GameMatchState, playerID string) []MinimapPOI {
+	guildID := ""
+	party := gs.parties.PartyOf(playerID)
+	if gs.dungeon == nil {
+		if guildID = gs.guilds.GuildOf(playerID); guildID == "" && party == nil {
+			return nil
+		}
+	}
+	var pois []MinimapPOI
+	for otherID, rb := range gs.PlayerBodies() {
+		if otherID == playerID || rb == nil {
+			continue
+		}
+		kind := POIPartyMember
+		if gs.dungeon != nil {
+			if !gs.dungeon.Party[otherID] {
+				continue
+			}
+		} else if party == nil || !party.Has(otherID) {
+			if guildID == "" || gs.guilds.GuildOf(otherID) != guildID || !gs.stealth.CanSee(playerID, otherID, gs.currentTick) {
+				continue
+			}
+			kind = POIGuildMember
+		}
+		pois = append(pois, MinimapPOI{Kind: kind, ID: otherID, Name: gs.usernameOf(otherID), X: rb.Position.X, Y: rb.Position.Y})
+	}
+	sort.Slice(pois, func(i, j int) bool { return pois[i].ID < pois[j].ID })
+	return pois
+}
+
+// eventPOIs lists the zones and living bosses of the running world events; every player gets
+// the same ones
+func (mm *MinimapManager) eventPOIs(gs *GameMatchState, npcs map[int]NPCData) []MinimapPOI {
+	var pois []MinimapPOI
+	for _, event := range gs.worldEvents.Snapshot(gs) {
+		for _, zone := range event.Zones {
+			pois = append(pois, MinimapPOI{
+				Kind:   POIEventZone,
+				ID:     zone.Name,
+				Name:   event.Name,
+				X:      zone.X + zone.Width/2,
+				Y:      zone.Y + zone.Height/2,
+				Width:  zone.Width,
+				Height: zone.Height,
+				Event:  event.ID,
+			})
+		}
+		for _, bossID := range event.Bosses {
+			boss, alive := npcs[bossID]
+			if !alive {
+				continue
+			}
+			pois = append(pois, MinimapPOI{Kind: POIEventBoss, ID: strconv.Itoa(bossID), Name: boss.Name, X: boss.Position.X, Y: boss.Position.Y, Event: event.ID})
+		}
+	}
+	return pois
+}
+
+// waypointPOIs lists the waypoints of this map the player activated
+func (mm *MinimapManager) waypointPOIs(gs *GameMatchState, playerID string) []MinimapPOI {
+	saved := gs.waypoints.players[playerID]
+	if saved == nil {
+		return nil
+	}
+	var pois []MinimapPOI
+	for id, entry := range saved.Activated {
+		if entry.Map != gs.currentMapName {
+			continue
+		}
+		pois = append(pois, MinimapPOI{Kind: POIWaypoint, ID: id, Name: entry.Name, X: entry.X, Y: entry.Y})
+	}
+	sort.Slice(pois, func(i, j int) bool { return pois[i].ID < pois[j].ID })
+	return pois
+}
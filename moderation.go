@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Kinds of player-written content the moderator checks
+const (
+	ContentChat      = "chat"       // channel chat and guild chat lines
+	ContentGuildName = "guild_name" // guild names and tags
+	ContentPetName   = "pet_name"   // names players give their pets
+	ContentWorldName = "world_name" // names of the worlds players create
+	ContentMail      = "mail"       // direct messages between two players
+)
+
+// directChannelPrefix starts the IDs of direct message channels: Nakama channel IDs begin with
+// their stream mode, 4 for direct messages
+const directChannelPrefix = "4."
+
+// Moderation tuning. The runtime env keys moderation_url, moderation_token and
+// moderation_timeout_ms set up the HTTP backend.
+const (
+	defaultModerationTimeout = 500 * time.Millisecond
+	maxModerationPage        = 100 // violations one admin_moderation call returns
+)
+
+// ContentVerdict is a filter's judgement of a text
+type ContentVerdict struct {
+	Blocked bool     `json:"blocked"`          // the text must not be used at all
+	Text    string   `json:"text,omitempty"`   // the text to use instead, e.g. with words masked ("" = unchanged)
+	Terms   []string `json:"terms,omitempty"`  // what the filter matched
+	Reason  string   `json:"reason,omitempty"` // the filter's own explanation
+}
+
+// violation reports whether the verdict found anything to record
+func (v ContentVerdict) violation() bool {
+	return v.Blocked || len(v.Terms) > 0 || v.Text != ""
+}
+
+// ContentFilter judges texts players write. Implementations must be safe for concurrent use:
+// matches and hooks share the module's filter.
+type ContentFilter interface {
+	Name() string
+	Check(ctx context.Context, kind, playerID, text string) (ContentVerdict, error)
+}
+
+// WordListFilter is the default filter: a list of banned words, masked in chat and mail and
+// refused in names
+type WordListFilter struct {
+	words map[string]bool // lowercase
+}
+
+// NewWordListFilter creates a filter of the words in path (a JSON array of strings). A missing
+// file gives an empty list that lets everything through.
+func NewWordListFilter(logger runtime.Logger, path string) *WordListFilter {
+	wf := &WordListFilter{words: make(map[string]bool)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Warn("No word list at %s; the word filter lets everything through", path)
+		return wf
+	}
+	var words []string
+	if err := json.Unmarshal(data, &words); err != nil {
+		logger.Error("Failed to parse word list %s: %v", path, err)
+		return wf
+	}
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			wf.words[word] = true
+		}
+	}
+	logger.Info("Loaded %d filtered words from %s", len(wf.words), path)
+	return wf
+}
+
+// Name implements ContentFilter
+func (wf *WordListFilter) Name() string {
+	return "wordlist"
+}
+
+// Check implements ContentFilter. Names are refused when a listed word appears anywhere in them
+// (ignoring case, spaces and punctuation); in chat and mail only whole listed words count, and
+// they are replaced by asterisks.
+func (wf *WordListFilter) Check(ctx context.Context, kind, playerID, text string) (ContentVerdict, error) {
+	var verdict ContentVerdict
+	if len(wf.words) == 0 {
+		return verdict, nil
+	}
+
+	if kind == ContentGuildName || kind == ContentPetName {
+		squashed := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, text)
+		for word := range wf.words {
+			if strings.Contains(squashed, word) {
+				verdict.Terms = append(verdict.Terms, word)
+			}
+		}
+		verdict.Blocked = len(verdict.Terms) > 0
+		return verdict, nil
+	}
+
+	runes := []rune(text)
+	masked := false
+	for start := 0; start < len(runes); {
+		if !unicode.IsLetter(runes[start]) && !unicode.IsDigit(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+			end++
+		}
+		if word := strings.ToLower(string(runes[start:end])); wf.words[word] {
+			verdict.Terms = append(verdict.Terms, word)
+			for i := start; i < end; i++ {
+				runes[i] = '*'
+			}
+			masked = true
+		}
+		start = end
+	}
+	if masked {
+		verdict.Text = string(runes)
+	}
+	return verdict, nil
+}
+
+// HTTPContentFilter asks an external moderation service. It POSTs {"kind", "playerId", "text"}
+// and reads a ContentVerdict back; when the service fails or is too slow, the fallback decides.
+type HTTPContentFilter struct {
+	url      string
+	token    string
+	client   *http.Client
+	fallback ContentFilter
+}
+
+// NewHTTPContentFilter creates a filter calling url (with token as a bearer token if set)
+func NewHTTPContentFilter(url, token string, timeout time.Duration, fallback ContentFilter) *HTTPContentFilter {
+	return &HTTPContentFilter{url: url, token: token, client: &http.Client{Timeout: timeout}, fallback: fallback}
+}
+
+// Name implements ContentFilter
+func (hf *HTTPContentFilter) Name() string {
+	return "http"
+}
+
+// Check implements ContentFilter
+func (hf *HTTPContentFilter) Check(ctx context.Context, kind, playerID, text string) (ContentVerdict, error) {
+	verdict, err := hf.call(ctx, kind, playerID, text)
+	if err != nil {
+		fallback, ferr := hf.fallback.Check(ctx, kind, playerID, text)
+		if ferr != nil {
+			return fallback, ferr
+		}
+		return fallback, fmt.Errorf("moderation service failed, used %s: %w", hf.fallback.Name(), err)
+	}
+	return verdict, nil
+}
+
+func (hf *HTTPContentFilter) call(ctx context.Context, kind, playerID, text string) (ContentVerdict, error) {
+	var verdict ContentVerdict
+	body, err := json.Marshal(map[string]string{"kind": kind, "playerId": playerID, "text": text})
+	if err != nil {
+		return verdict, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hf.url, bytes.NewReader(body))
+	if err != nil {
+		return verdict, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hf.token != "" {
+		req.Header.Set("Authorization", "Bearer "+hf.token)
+	}
+	resp, err := hf.client.Do(req)
+	if err != nil {
+		return verdict, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return verdict, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return verdict, err
+	}
+	return verdict, nil
+}
+
+// PersistedViolation is a text a filter objected to, kept for moderators to escalate
+type PersistedViolation struct {
+	ID       string    `json:"id"`
+	PlayerID string    `json:"playerId"`
+	Kind     string    `json:"kind"`
+	Text     string    `json:"text"` // as the player wrote it
+	Terms    []string  `json:"terms,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Filter   string    `json:"filter"`
+	Blocked  bool      `json:"blocked"` // refused rather than masked
+	Time     time.Time `json:"time"`
+}
+
+// ContentModerator runs the module's content filter over player-written text and records what
+// it objects to
+type ContentModerator struct {
+	logger runtime.Logger
+	db     *DatabaseManager
+	filter ContentFilter
+}
+
+// moderator is the module's content moderator, set up by InitModule
+var moderator *ContentModerator
+
+// NewContentModerator creates the moderator: the word list, behind the HTTP backend when the
+// runtime env sets moderation_url
+func NewContentModerator(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, wordListPath string) *ContentModerator {
+	var filter ContentFilter = NewWordListFilter(logger, wordListPath)
+	env, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	if url := env["moderation_url"]; url != "" {
+		timeout := defaultModerationTimeout
+		if ms, err := strconv.Atoi(env["moderation_timeout_ms"]); err == nil && ms > 0 {
+			timeout = time.Duration(ms) * time.Millisecond
+		}
+		filter = NewHTTPContentFilter(url, env["moderation_token"], timeout, filter)
+		logger.Info("Content moderation uses %s (timeout %v)", url, timeout)
+	}
+	return &ContentModerator{logger: logger, db: NewDatabaseManager(logger, nk), filter: filter}
+}
+
+// Moderate checks a text a player wrote. It returns the text to use (with words masked, for
+// chat and mail) or an error when the text must not be used. Violations are recorded; a filter
+// that fails lets the text through.
+func (cm *ContentModerator) Moderate(ctx context.Context, kind, playerID, text string) (string, error) {
+	if cm == nil || text == "" {
+		return text, nil
+	}
+	verdict, err := cm.filter.Check(ctx, kind, playerID, text)
+	if err != nil {
+		cm.logger.Warn("Content filter %s: %v", cm.filter.Name(), err)
+	}
+	if !verdict.violation() {
+		return text, nil
+	}
+
+	violation := &PersistedViolation{
+		ID:       fmt.Sprintf("%d", time.Now().UnixNano()),
+		PlayerID: playerID,
+		Kind:     kind,
+		Text:     text,
+		Terms:    verdict.Terms,
+		Reason:   verdict.Reason,
+		Filter:   cm.filter.Name(),
+		Blocked:  verdict.Blocked,
+		Time:     time.Now().UTC(),
+	}
+	if !IsBot(playerID) {
+		if err := cm.db.SaveViolation(ctx, violation); err != nil {
+			cm.logger.Error("Failed to record the %s violation of %s: %v", kind, playerID, err)
+		}
+	}
+	cm.logger.Info("Content filter flagged %s by %s (blocked: %t)", kind, playerID, verdict.Blocked)
+	if verdict.Blocked {
+		return "", msg("moderation.blocked")
+	}
+	if verdict.Text == "" {
+		return text, nil
+	}
+	return verdict.Text, nil
+}
+
+// Remote reports whether the moderator asks the moderation service, which may take up to its
+// timeout: match code then moderates through a ModerationQueue rather than in the match loop
+func (cm *ContentModerator) Remote() bool {
+	if cm == nil {
+		return false
+	}
+	_, remote := cm.filter.(*HTTPContentFilter)
+	return remote
+}
+
+// ModerationQueue moderates the texts players write in a match off the match loop, since the
+// filter may wait on the moderation service: each text is checked on a goroutine of its own and
+// the result handed back to the loop, which applies it in Update. Without the service the word
+// list judges the text at once.
+type ModerationQueue struct {
+	mu      sync.Mutex
+	results []moderationResult
+}
+
+// moderationResult is a finished check waiting for the match loop
+type moderationResult struct {
+	text  string
+	err   error
+	apply func(text string, err error)
+}
+
+// NewModerationQueue creates an empty moderation queue
+func NewModerationQueue() *ModerationQueue {
+	return &ModerationQueue{}
+}
+
+// Submit moderates a text a player wrote and calls apply from the match loop with what
+// ContentModerator.Moderate returns: the text to use, or an error when it must not be used.
+// apply runs before Submit returns when the check didn't need the moderation service.
+func (mq *ModerationQueue) Submit(ctx context.Context, kind, playerID, text string, apply func(text string, err error)) {
+	if !moderator.Remote() {
+		apply(moderator.Moderate(ctx, kind, playerID, text))
+		return
+	}
+	go func() {
+		moderated, err := moderator.Moderate(ctx, kind, playerID, text)
+		mq.mu.Lock()
+		mq.results = append(mq.results, moderationResult{text: moderated, err: err, apply: apply})
+		mq.mu.Unlock()
+	}()
+}
+
+// Update applies the checks that finished since the last tick. Called from the match loop.
+func (mq *ModerationQueue) Update() {
+	mq.mu.Lock()
+	results := mq.results
+	mq.results = nil
+	mq.mu.Unlock()
+	for _, r := range results {
+		r.apply(r.text, r.err)
+	}
+}
+
+// beforeChannelMessageSend moderates the "message" field of channel chat messages
+func beforeChannelMessageSend(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *rtapi.Envelope) (*rtapi.Envelope, error) {
+	send := in.GetChannelMessageSend()
+	if send == nil {
+		return in, nil
+	}
+	var content map[string]any
+	if err := json.Unmarshal([]byte(send.Content), &content); err != nil {
+		return in, nil
+	}
+	text, ok := content["message"].(string)
+	if !ok {
+		return in, nil
+	}
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	// Direct messages are the players' mail; the others are chat
+	kind := ContentChat
+	if strings.HasPrefix(send.ChannelId, directChannelPrefix) {
+		kind = ContentMail
+	}
+	moderated, err := moderator.Moderate(ctx, kind, userID, text)
+	if err != nil {
+		return nil, runtime.NewError(err.Error(), rpcCodeInvalidArgument)
+	}
+	if moderated != text {
+		content["message"] = moderated
+		data, err := json.Marshal(content)
+		if err != nil {
+			return nil, errInternalFailure
+		}
+		send.Content = string(data)
+	}
+	return in, nil
+}
+
+// rpcAdminModeration pages through a player's recorded violations, oldest first
+// Payload: {"playerId": "...", "limit": 50, "cursor": "optional"}
+func rpcAdminModeration(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	req := struct {
+		PlayerID string `json:"playerId"`
+		Limit    int    `json:"limit"`
+		Cursor   string `json:"cursor"`
+	}{Limit: 50}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.PlayerID == "" {
+		return "", errInvalidPayload
+	}
+	if req.Limit <= 0 || req.Limit > maxModerationPage {
+		req.Limit = maxModerationPage
+	}
+
+	violations, cursor, err := NewDatabaseManager(logger, nk).ListViolations(ctx, req.PlayerID, req.Limit, req.Cursor)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	out, err := json.Marshal(map[string]interface{}{"violations": violations, "cursor": cursor})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Mount tuning
+const (
+	mountRange       = 64.0    // max distance (pixels) from the player to the mount to get on
+	mountObjectType  = "mount" // ObjectData.Type of rideable objects
+	defaultMountSize = 56.0    // rider collider size when the mount has no width/height props
+)
+
+// MountStats are the movement parameters a mount gives its rider. They come from the mount
+// object's properties: "speed" (multiplier of the walking cap, default 1.5), "turnRate"
+// (radians per second, 0 turns instantly) and "width"/"height" (rider collider size).
+type MountStats struct {
+	Speed    float64
+	TurnRate float64
+	Width    float64
+	Height   float64
+}
+
+// mountStatsFor reads a mount's movement parameters from its object properties
+func mountStatsFor(obj *ObjectData) *MountStats {
+	stats := &MountStats{Speed: 1.5, Width: defaultMountSize, Height: defaultMountSize}
+	if v, ok := obj.Props["speed"].(float64); ok && v > 0 {
+		stats.Speed = v
+	}
+	if v, ok := obj.Props["turnrate"].(float64); ok && v > 0 {
+		stats.TurnRate = v
+	}
+	if v, ok := obj.Props["width"].(float64); ok && v > 0 {
+		stats.Width = v
+	}
+	if v, ok := obj.Props["height"].(float64); ok && v > 0 {
+		stats.Height = v
+	}
+	return stats
+}
+
+// Mount puts a player on the mount object oid. The mount's colliders are removed while it is
+// ridden and the rider's body takes the mount's size. It returns a rejection reason, or "".
+func (gs *GameMatchState) Mount(playerID string, oid int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+	state := gs.GetPlayerState(playerID)
+	if state.MountID != 0 {
+		return RejectAlreadyMounted
+	}
+
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	gs.mu.Unlock()
+	if !ok {
+		return RejectUnknownObject
+	}
+	if obj.Type != mountObjectType {
+		return RejectInvalidTarget
+	}
+	if rider, _ := obj.Props["rider"].(string); rider != "" {
+		return RejectOccupied
+	}
+	pos, ok := obj.Position()
+	if !ok || pos.Sub(rb.Position).Magnitude() > mountRange {
+		return RejectOutOfRange
+	}
+
+	stats := mountStatsFor(obj)
+	gs.mu.Lock()
+	obj.Props["rider"] = playerID
+	gs.mu.Unlock()
+	gs.RemoveOwnerColliders(oid)
+
+	state.MountID = oid
+	state.Mount = stats
+	state.lastSteerTick = gs.currentTick
+	rb.Position = pos
+	gs.corrections.Queue(playerID, CorrectionMount)
+	rb.Width = stats.Width
+	rb.Height = stats.Height
+
+	gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+	logger.Info("Player %s mounted object %d", playerID, oid)
+	return ""
+}
+
+// Dismount gets the player off their mount, leaving it at the player's position.
+// It returns false if the player wasn't riding.
+func (gs *GameMatchState) Dismount(playerID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) bool {
+	state, ok := gs.playerStates[playerID]
+	if !ok || state.MountID == 0 {
+		return false
+	}
+	oid := state.MountID
+	state.MountID = 0
+	state.Mount = nil
+
+	rb := gs.PlayerBody(playerID)
+	if rb != nil {
+		rb.Width = gs.config.PlayerSize
+		rb.Height = gs.config.PlayerSize
+		if limit := state.MaxSpeed(gs.config.PlayerMaxSpeed, gs.currentTick); rb.Velocity.Magnitude() > limit {
+			rb.Velocity = rb.Velocity.Scale(limit / rb.Velocity.Magnitude())
+		}
+	}
+
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	if ok {
+		delete(obj.Props, "rider")
+		if rb != nil {
+			obj.Props["x"] = rb.Position.X
+			obj.Props["y"] = rb.Position.Y
+		}
+	}
+	gs.mu.Unlock()
+
+	if ok {
+		gs.RebuildObjectColliders(oid, logger)
+		gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+	}
+	logger.Info("Player %s dismounted object %d", playerID, oid)
+	return true
+}
+
+// steer limits how far a mounted player's heading may turn towards the desired velocity since
+// the last move, based on the mount's turn rate. The desired speed is kept.
+func (ps *PlayerState) steer(current, desired vector.Vector, tick int64) vector.Vector {
+	elapsed := max(float64(tick-ps.lastSteerTick), 1)
+	ps.lastSteerTick = tick
+	speed := desired.Magnitude()
+	if ps.Mount.TurnRate <= 0 || speed == 0 || current.Magnitude() == 0 {
+		return desired
+	}
+
+	heading := math.Atan2(current.Y, current.X)
+	diff := math.Atan2(desired.Y, desired.X) - heading
+	diff = math.Atan2(math.Sin(diff), math.Cos(diff))
+	maxTurn := ps.Mount.TurnRate * elapsed / TickRate
+	if math.Abs(diff) <= maxTurn {
+		return desired
+	}
+	heading += math.Copysign(maxTurn, diff)
+	return vector.Vector{X: math.Cos(heading) * speed, Y: math.Sin(heading) * speed}
+}
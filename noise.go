@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Noise kinds made by the server
+const (
+	NoiseFootsteps = "footsteps" // a sprinting player
+	NoiseExplosion = "explosion" // a projectile's explosion
+	NoiseDoor      = "door"      // a door opening or slamming shut
+)
+
+// Noise tuning
+const (
+	noiseFootstepInterval = TickRate / 2 // ticks between footstep noises of a sprinting player
+	noiseFootstepRadius   = 5.0 * TileSize
+	noiseExplosionRadius  = 15.0 * TileSize
+)
+
+// NoiseEvent is a sound in the world. Players within Radius hear it (OpCodeNoise) and hostile NPCs
+// within Radius go and investigate.
+type NoiseEvent struct {
+	Kind   string  `json:"kind"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Radius float64 `json:"radius"`
+	Source string  `json:"source,omitempty"` // player who made the noise
+}
+
+// MakeNoise propagates a noise: it is sent to the players who hear it (except its maker) and
+// alerts the NPCs in earshot. Invisible GMs make no noise.
+func (gs *GameMatchState) MakeNoise(kind string, position vector.Vector, radius float64, source string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if radius <= 0 || (source != "" && gs.stealth.IsInvisible(source)) {
+		return
+	}
+	noise := NoiseEvent{Kind: kind, X: position.X, Y: position.Y, Radius: radius, Source: source}
+	gs.npcManager.Hear(gs, noise, gs.currentTick)
+
+	if dispatcher == nil {
+		return
+	}
+	recipients := gs.PresencesInRange(position, radius)
+	for i := 0; i < len(recipients); i++ {
+		if recipients[i].GetUserId() == source {
+			recipients = append(recipients[:i], recipients[i+1:]...)
+			break
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeNoise, "noise", noise)
+	if err != nil {
+		logger.Error("Failed to marshal noise: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeNoise, data, recipients, nil, true)
+}
+
+// UpdateFootsteps makes footstep noises for sprinting players who are moving. Called from the
+// match loop.
+func (gs *GameMatchState) UpdateFootsteps(dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if gs.currentTick%noiseFootstepInterval != 0 {
+		return
+	}
+	for playerID, rb := range gs.PlayerBodies() {
+		state := gs.GetPlayerState(playerID)
+		if !state.Sprinting || state.IsDead() || math.Hypot(rb.Velocity.X, rb.Velocity.Y) < 1 {
+			continue
+		}
+		gs.MakeNoise(NoiseFootsteps, rb.Position, noiseFootstepRadius, playerID, dispatcher, logger)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Nakama notification codes (the dungeon invite is notificationDungeonInvite)
+const (
+	notificationMailReceived = 101 // reserved for in-game mail
+	notificationAuctionSold  = 102
+	notificationGuildInvite  = 103
+	notificationFriendOnline = 104
+)
+
+// Notification batching tuning
+const (
+	notificationBatchWindow   = 10 * time.Second // one notification per player and code within this window
+	notificationFlushInterval = time.Second
+	maxNotificationBatch      = 20               // entries kept in a batched notification
+	friendOnlineCooldown      = 10 * time.Minute // a player's friends hear they came online at most this often
+	maxOnlineFriendNotices    = 100              // friends told when a player comes online
+)
+
+// notificationBatchSubjects are the subjects of notifications that batch several
+var notificationBatchSubjects = map[int]string{
+	notificationMailReceived: "New mail",
+	notificationAuctionSold:  "Auctions sold",
+	notificationGuildInvite:  "Guild invites",
+	notificationFriendOnline: "Friends online",
+}
+
+// notificationBatch is what a player is owed for one notification code: the window after the
+// last send, and the notifications queued within it
+type notificationBatch struct {
+	userID     string
+	code       int
+	subject    string
+	persistent bool
+	senderID   string
+	entries    []map[string]interface{}
+	count      int
+	windowEnd  time.Time
+}
+
+// Notifier sends Nakama notifications for events players should hear about even when they aren't
+// in a match. The first notification of a code goes out at once; those following within
+// notificationBatchWindow are sent as one when the window closes, with "count" and "entries".
+// It is shared by all matches and RPCs.
+type Notifier struct {
+	logger  runtime.Logger
+	nk      runtime.NakamaModule
+	batches map[string]*notificationBatch // user ID/code -> batch
+	recent  map[string]time.Time          // throttle key -> when it may fire again
+	mu      sync.Mutex
+}
+
+// notifier is started by InitModule; until then notifications are dropped
+var notifier *Notifier
+
+// StartNotifier creates the notifier and flushes its batches for the life of the module
+func StartNotifier(logger runtime.Logger, nk runtime.NakamaModule) *Notifier {
+	n := &Notifier{
+		logger:  logger,
+		nk:      nk,
+		batches: make(map[string]*notificationBatch),
+		recent:  make(map[string]time.Time),
+	}
+	go func() {
+		for now := range time.Tick(notificationFlushInterval) {
+			n.flush(context.Background(), now)
+		}
+	}()
+	return n
+}
+
+// Queue notifies a player, sending at once or batching with the notifications of the same code
+// sent within the window
+func (n *Notifier) Queue(ctx context.Context, userID string, code int, subject string, content map[string]interface{}, senderID string, persistent bool) {
+	if n == nil || userID == "" {
+		return
+	}
+	now := time.Now()
+	key := fmt.Sprintf("%s/%d", userID, code)
+
+	n.mu.Lock()
+	batch := n.batches[key]
+	if batch != nil && now.Before(batch.windowEnd) {
+		if batch.count == 0 {
+			batch.subject, batch.senderID = subject, senderID
+		} else if batch.senderID != senderID {
+			batch.senderID = ""
+		}
+		batch.count++
+		if len(batch.entries) < maxNotificationBatch {
+			batch.entries = append(batch.entries, content)
+		}
+		batch.persistent = batch.persistent || persistent
+		n.mu.Unlock()
+		return
+	}
+	n.batches[key] = &notificationBatch{userID: userID, code: code, windowEnd: now.Add(notificationBatchWindow)}
+	n.mu.Unlock()
+
+	n.send(ctx, userID, subject, content, code, senderID, persistent)
+}
+
+// Throttle reports whether an event with key may be notified now, and if so holds it back for
+// cooldown
+func (n *Notifier) Throttle(key string, cooldown time.Duration) bool {
+	return n.ThrottleWait(key, cooldown) == 0
+}
+
+// ThrottleWait is Throttle returning how long the event with key is still held back (0 when it
+// may go now, and is held back for cooldown from here)
+func (n *Notifier) ThrottleWait(key string, cooldown time.Duration) time.Duration {
+	if n == nil {
+		return cooldown
+	}
+	now := time.Now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if until := n.recent[key]; now.Before(until) {
+		return until.Sub(now)
+	}
+	n.recent[key] = now.Add(cooldown)
+	return 0
+}
+
+// FriendOnline tells a player's mutual friends that they came online in the world, at most once
+// per friendOnlineCooldown so hopping between maps and shards doesn't spam them
+func (n *Notifier) FriendOnline(ctx context.Context, userID, username, mapName string) {
+	if !n.Throttle("online/"+userID, friendOnlineCooldown) {
+		return
+	}
+	mutual := 0
+	friends, _, err := n.nk.FriendsList(ctx, userID, maxOnlineFriendNotices, &mutual, "")
+	if err != nil {
+		n.logger.Warn("Failed to list the friends of %s: %v", userID, err)
+		return
+	}
+	content := map[string]interface{}{"userId": userID, "username": username, "map": mapName}
+	for _, friend := range friends {
+		n.Queue(ctx, friend.GetUser().GetId(), notificationFriendOnline, fmt.Sprintf("%s is online", username), content, userID, false)
+	}
+}
+
+// flush sends the batches whose window closed, and forgets the idle ones
+func (n *Notifier) flush(ctx context.Context, now time.Time) {
+	var due []*notificationBatch
+	n.mu.Lock()
+	for key, batch := range n.batches {
+		if now.Before(batch.windowEnd) {
+			continue
+		}
+		if batch.count == 0 {
+			delete(n.batches, key)
+			continue
+		}
+		due = append(due, &notificationBatch{
+			userID:     batch.userID,
+			code:       batch.code,
+			subject:    batch.subject,
+			persistent: batch.persistent,
+			senderID:   batch.senderID,
+			entries:    batch.entries,
+			count:      batch.count,
+		})
+		// The batch just sent opens the next window
+		batch.entries, batch.count, batch.senderID, batch.persistent = nil, 0, "", false
+		batch.windowEnd = now.Add(notificationBatchWindow)
+	}
+	for key, until := range n.recent {
+		if !now.Before(until) {
+			delete(n.recent, key)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, batch := range due {
+		content := batch.entries[0]
+		subject := batch.subject
+		if batch.count > 1 {
+			content = map[string]interface{}{"count": batch.count, "entries": batch.entries}
+			subject = fmt.Sprintf("%s (%d)", notificationBatchSubjects[batch.code], batch.count)
+		}
+		n.send(ctx, batch.userID, subject, content, batch.code, batch.senderID, batch.persistent)
+	}
+}
+
+// send delivers one notification
+func (n *Notifier) send(ctx context.Context, userID, subject string, content map[string]interface{}, code int, senderID string, persistent bool) {
+	if err := n.nk.NotificationSend(ctx, userID, subject, content, code, senderID, persistent); err != nil {
+		n.logger.Warn("Failed to send notification %d to %s: %v", code, userID, err)
+	}
+}
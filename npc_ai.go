@@ -0,0 +1,396 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// NPC combat states. Idle NPCs follow their behavior; the other states are driven by the threat table.
+const (
+	NPCStateIdle   = "idle"   // following its behavior (wander/patrol/idle)
+	NPCStateChase  = "chase"  // walking towards its target
+	NPCStateAttack = "attack" // in range of its target and attacking
+	NPCStateFlee   = "flee"   // low on health, running away from its target
+	NPCStateReturn = "return" // lost its targets, walking back home
+
+	NPCStateInvestigate = "investigate" // walking to a noise it heard, then looking around
+)
+
+// Bus event published when an NPC dies
+const EventNPCKilled = "npc_killed" // npcId, npcType, killer (player credited with the kill, may be empty), x, y
+
+// Combat AI tuning
+const (
+	npcPerceptionInterval = TickRate / 6 // ticks between perception scans
+	npcRepathDistance     = TileSize     // a chasing NPC re-paths once its target moved this far from its goal
+	npcSightThreat        = 1.0          // threat added per scan for a perceived player
+	npcThreatDecay        = 2.0          // threat lost per second by players the NPC can't perceive
+	npcFleeDistance       = 4 * TileSize // how far a fleeing NPC runs from its target per goal
+	npcSearchTicks        = 3 * TickRate // how long an investigating NPC looks around at the noise
+	npcSearchTurnRate     = math.Pi      // radians per second an investigating NPC turns while looking around
+	defaultAggroRadius    = 160.0
+	defaultLeashRadius    = 480.0
+	defaultAttackRange    = 40.0
+	defaultAttackDamage   = 10.0
+	defaultAttackCooldown = 1.5
+)
+
+// updateAI runs the NPC's perception and combat state machine. Idle states leave movement to the
+// behavior; the other states set the goal steer walks towards.
+func (nm *NPCManager) updateAI(gameState *GameMatchState, npc *NPC, tick int64, dispatcher runtime.MatchDispatcher) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	// Evading NPCs ignore everyone until they are back home
+	if npc.evading {
+		return
+	}
+
+	if tick >= npc.nextPerception {
+		npc.nextPerception = tick + npcPerceptionInterval
+		nm.perceive(gameState, npc)
+	}
+
+	// Leashing: pulled too far from home, or chased too far from where it was pulled, the NPC
+	// drops every target and evades home
+	if npc.State != NPCStateIdle && npc.State != NPCStateReturn && npc.leashBroken() {
+		npc.evade(tick)
+		return
+	}
+
+	top := npc.topThreat(gameState, tick)
+	for top != "" && gameState.PlayerBody(top) == nil {
+		// The player left since the last perception scan
+		delete(npc.Threat, top)
+		top = npc.topThreat(gameState, tick)
+	}
+	if top != "" && npc.Target == "" {
+		npc.pullPoint = npc.Body.Position
+	}
+	npc.Target = top
+	if npc.Target == "" && npc.State == NPCStateInvestigate {
+		nm.search(npc, tick)
+		return
+	}
+	if npc.Target == "" {
+		if npc.State != NPCStateIdle && npc.State != NPCStateReturn {
+			npc.State = NPCStateReturn
+			home := npc.Home
+			npc.goal, npc.goalTick, npc.route = &home, tick, nil
+		}
+		return
+	}
+
+	target := gameState.PlayerBody(npc.Target).Position
+	delta := target.Sub(npc.Body.Position)
+	dist := delta.Magnitude()
+
+	switch {
+	case npc.Def.FleeHealth > 0 && npc.Health <= npc.Def.FleeHealth*npc.MaxHealth:
+		if npc.State != NPCStateFlee || npc.goal == nil {
+			npc.State = NPCStateFlee
+			away := npc.Body.Position.Sub(delta.Scale(npcFleeDistance / math.Max(dist, 1)))
+			npc.goal, npc.goalTick, npc.route = &away, tick, nil
+		}
+
+	case dist <= npc.Def.AttackRange && gameState.HasLineOfSight(npc.Body.Position, target, 0):
+		npc.State = NPCStateAttack
+		npc.goal, npc.route = nil, nil
+		npc.Facing = math.Atan2(delta.Y, delta.X)
+		if tick >= npc.attackReady {
+			npc.attackReady = tick + int64(npc.Def.AttackCooldown*TickRate)
+			nm.attack(gameState, npc, dispatcher)
+		}
+
+	default:
+		if npc.State != NPCStateChase || npc.goal == nil || npc.goal.Sub(target).Magnitude() > npcRepathDistance {
+			npc.State = NPCStateChase
+			npc.goal, npc.goalTick, npc.route = &target, tick, nil
+		}
+	}
+}
+
+// perceive adds threat for visible players within the aggro radius (shrunk by fog) that the NPC
+// is hostile to (a hostile NPC, or one whose faction is hostile to the player) and who aren't
+// under spawn protection, and decays the
+// threat of everyone else. Targets that died, left or moved beyond the leash are forgotten.
+func (nm *NPCManager) perceive(gameState *GameMatchState, npc *NPC) {
+	seen := make(map[string]bool)
+	aggroRadius := npc.Def.AggroRadius * gameState.weather.PerceptionScale()
+	if npc.Def.Hostile || npc.Def.Faction != "" {
+		for playerID, rb := range gameState.PlayerBodies() {
+			if state := gameState.GetPlayerState(playerID); state.IsDead() || state.spawnProtected(gameState.currentTick) {
+				continue
+			}
+			if !npc.Def.Hostile && !gameState.reputation.IsHostile(playerID, npc.Def.Faction) {
+				continue
+			}
+			if rb.Position.Sub(npc.Body.Position).Magnitude() > aggroRadius {
+				continue
+			}
+			if !gameState.stealth.NPCDetects(gameState, npc, playerID, rb.Position) {
+				continue
+			}
+			if !gameState.HasLineOfSight(npc.Body.Position, rb.Position, 0) {
+				continue
+			}
+			seen[playerID] = true
+			npc.Threat[playerID] += npcSightThreat
+		}
+	}
+
+	decay := npcThreatDecay * float64(npcPerceptionInterval) / TickRate
+	for playerID, threat := range npc.Threat {
+		rb := gameState.PlayerBody(playerID)
+		if rb == nil || gameState.GetPlayerState(playerID).IsDead() ||
+			rb.Position.Sub(npc.Home).Magnitude() > npc.leashRadius() {
+			delete(npc.Threat, playerID)
+			continue
+		}
+		if !seen[playerID] {
+			if threat -= decay; threat <= 0 {
+				delete(npc.Threat, playerID)
+			} else {
+				npc.Threat[playerID] = threat
+			}
+		}
+	}
+}
+
+// Hear sends NPCs that would fight the noise's maker (hostile NPCs, and faction NPCs hostile to
+// the player who made it) to investigate it, if they aren't fighting and the noise lies within
+// their earshot and leash
+func (nm *NPCManager) Hear(gameState *GameMatchState, noise NoiseEvent, tick int64) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	position := vector.Vector{X: noise.X, Y: noise.Y}
+	if noise.Source != "" && gameState.SpawnProtected(noise.Source) {
+		return
+	}
+	for _, npc := range nm.live() {
+		if npc.Pet != nil || npc.Target != "" || npc.evading {
+			continue
+		}
+		if !npc.Def.Hostile && (npc.Def.Faction == "" || noise.Source == "" ||
+			!gameState.reputation.IsHostile(noise.Source, npc.Def.Faction)) {
+			continue
+		}
+		if position.Sub(npc.Body.Position).Magnitude() > noise.Radius ||
+			position.Sub(npc.Home).Magnitude() > npc.leashRadius() {
+			continue
+		}
+		npc.State = NPCStateInvestigate
+		npc.searchUntil = 0
+		goal := position
+		npc.goal, npc.goalTick, npc.route = &goal, tick, nil
+	}
+}
+
+// search runs an investigating NPC without a target: once it reached the noise it turns around
+// looking for the culprit, then heads home
+func (nm *NPCManager) search(npc *NPC, tick int64) {
+	if npc.goal != nil {
+		return
+	}
+	if npc.searchUntil == 0 {
+		npc.searchUntil = tick + npcSearchTicks
+	}
+	if tick < npc.searchUntil {
+		npc.Facing = math.Mod(npc.Facing+npcSearchTurnRate/TickRate, 2*math.Pi)
+		return
+	}
+	npc.State = NPCStateReturn
+	home := npc.Home
+	npc.goal, npc.goalTick, npc.route = &home, tick, nil
+}
+
+// leashRadius returns how far the NPC may be pulled from home: its spawner's leashRadius, or
+// its definition's
+func (npc *NPC) leashRadius() float64 {
+	if npc.leash > 0 {
+		return npc.leash
+	}
+	return npc.Def.LeashRadius
+}
+
+// leashBroken reports whether a fighting NPC was pulled beyond its leash radius from home, or
+// chased further than its spawner's maxChase from where it took its first target
+func (npc *NPC) leashBroken() bool {
+	if npc.Body.Position.Sub(npc.Home).Magnitude() > npc.leashRadius() {
+		return true
+	}
+	return npc.maxChase > 0 && npc.Body.Position.Sub(npc.pullPoint).Magnitude() > npc.maxChase
+}
+
+// evade drops every target and sends the NPC home; it takes no damage and perceives no one
+// until it arrives, then heals (finishGoal)
+func (npc *NPC) evade(tick int64) {
+	clear(npc.Threat)
+	npc.Target, npc.tauntedBy = "", ""
+	npc.evading = true
+	npc.State = NPCStateReturn
+	home := npc.Home
+	npc.goal, npc.goalTick, npc.route = &home, tick, nil
+}
+
+// topThreat returns the player with the highest threat (empty when the table is empty), or the
+// player who taunted the NPC while the taunt lasts and they are still in the table and the match
+func (npc *NPC) topThreat(gameState *GameMatchState, tick int64) string {
+	if npc.tauntedBy != "" {
+		if _, ok := npc.Threat[npc.tauntedBy]; ok && tick < npc.tauntUntil && gameState.PlayerBody(npc.tauntedBy) != nil {
+			return npc.tauntedBy
+		}
+		npc.tauntedBy = ""
+	}
+	best, bestThreat := "", 0.0
+	for playerID, threat := range npc.Threat {
+		// Ties go to the lowest ID so the target doesn't flip between equal entries
+		if threat > bestThreat || (threat == bestThreat && playerID < best) {
+			best, bestThreat = playerID, threat
+		}
+	}
+	return best
+}
+
+// ForgetPlayer drops a player who left the match from every NPC's threat table and target
+func (nm *NPCManager) ForgetPlayer(playerID string) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	for _, npc := range nm.live() {
+		delete(npc.Threat, playerID)
+		if npc.Target == playerID {
+			npc.Target = ""
+		}
+		if npc.tauntedBy == playerID {
+			npc.tauntedBy = ""
+		}
+	}
+}
+
+// attack deals the NPC's attack damage to its target
+func (nm *NPCManager) attack(gameState *GameMatchState, npc *NPC, dispatcher runtime.MatchDispatcher) {
+	dealt := gameState.DamagePlayer(npc.Target, npcDamageSource(npc.ID), npc.Def.AttackDamage, DamagePhysical, dispatcher, nm.logger)
+	nm.logger.Debug("NPC %d hit player %s for %.1f", npc.ID, npc.Target, dealt)
+}
+
+// Damage hurts an NPC after its armor and resistances and relays a damage event to nearby
+// players. Damage from a player or their pet adds as much threat against the player, so even
+// non-hostile NPCs fight back. The NPC is removed when its health runs out. It returns the remaining health and
+// false if the NPC doesn't exist.
+func (nm *NPCManager) Damage(gameState *GameMatchState, id int, source DamageSource, amount float64, damageType string, dispatcher runtime.MatchDispatcher) (float64, bool) {
+	event, npc, ok := nm.hurt(gameState, id, source, amount, damageType)
+	if !ok {
+		return 0, false
+	}
+	if event.Amount > 0 {
+		gameState.broadcastDamage(event, vector.Vector{X: event.X, Y: event.Y}, dispatcher, nm.logger)
+	}
+	if event.Killed {
+		nm.handleDeath(gameState, npc, dispatcher)
+	}
+	return event.Health, true
+}
+
+// hurt applies damage to an NPC and adds the threat without relaying anything or handling its
+// death. It returns the damage event, the NPC and false if the NPC doesn't exist.
+func (nm *NPCManager) hurt(gameState *GameMatchState, id int, source DamageSource, amount float64, damageType string) (DamageEvent, *NPC, bool) {
+	nm.mu.Lock()
+	npc, ok := nm.npcs[id]
+	if !ok {
+		nm.mu.Unlock()
+		return DamageEvent{}, nil, false
+	}
+	hit := &DamageHit{Source: source, TargetType: "npc", TargetID: strconv.Itoa(id), DamageType: damageType, Amount: amount}
+	dealt := 0.0
+	if !npc.evading {
+		dealt = npc.applyDamage(gameState, hit, 0)
+	}
+	attacker := nm.creditedPlayer(source)
+	if attacker != "" && !npc.evading && gameState.PlayerBody(attacker) != nil {
+		npc.Threat[attacker] += gameState.threatFor(attacker, dealt)
+	}
+	health := npc.Health
+	position := npc.Body.Position
+	nm.mu.Unlock()
+
+	if attacker != "" {
+		gameState.worldEvents.RecordBossDamage(id, attacker, dealt)
+		gameState.RevealStealth(attacker)
+		gameState.EndSpawnProtection(attacker, "attacked")
+	}
+	return DamageEvent{
+		TargetType: "npc",
+		TargetID:   strconv.Itoa(id),
+		Source:     source,
+		DamageType: damageType,
+		Amount:     dealt,
+		Health:     health,
+		MaxHealth:  npc.MaxHealth,
+		Killed:     health <= 0,
+		X:          position.X,
+		Y:          position.Y,
+		Breakdown:  hit.Breakdown,
+	}, npc, true
+}
+
+// handleDeath drops an NPC's loot (fixed drops and its loot table) where it died, announces the death and removes it. Its spawner
+// replaces it after the respawn delay.
+func (nm *NPCManager) handleDeath(gameState *GameMatchState, npc *NPC, dispatcher runtime.MatchDispatcher) {
+	position := npc.Body.Position
+	killer := ""
+	if npc.LastDamage != nil {
+		nm.mu.RLock()
+		killer = nm.creditedPlayer(*npc.LastDamage)
+		nm.mu.RUnlock()
+	}
+	loot := make(map[string]int)
+	if len(npc.Def.Loot) > 0 {
+		roll := gameState.random.Roll(gameState, RollLoot, killer, map[string]any{"npcType": npc.Def.ID})
+		dropped := make(map[string]int)
+		for _, drop := range npc.Def.Loot {
+			if roll.Float64() >= drop.Chance {
+				continue
+			}
+			gameState.worldItems.Spawn(gameState, drop.ItemID, drop.Count, position, "", gameState.droppedItemLifetimeTicks(), dispatcher)
+			dropped[drop.ItemID] += drop.Count
+			loot[drop.ItemID] += drop.Count
+		}
+		gameState.random.Record(roll, dropped)
+	}
+	if npc.Def.LootTable != "" {
+		_, stacks := gameState.DropLoot(npc.Def.LootTable, position, killer, dispatcher)
+		for _, stack := range stacks {
+			loot[stack.ItemID] += stack.Count
+		}
+	}
+	nm.Despawn(gameState, npc.ID)
+	gameState.eventBus.Publish(EventNPCKilled, map[string]any{
+		"npcId":   npc.ID,
+		"npcType": npc.Def.ID,
+		"killer":  killer,
+		"x":       position.X,
+		"y":       position.Y,
+	})
+	nm.logger.Info("NPC %d (%s) died at (%.1f, %.1f)", npc.ID, npc.Def.ID, position.X, position.Y)
+
+	if dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeRespawn, "npc_died", NPCLifeEvent{
+		NPCID:    npc.ID,
+		Type:     npc.Def.ID,
+		X:        position.X,
+		Y:        position.Y,
+		KilledBy: npc.LastDamage,
+		Loot:     loot,
+	})
+	if err != nil {
+		nm.logger.Error("Failed to marshal npc_died for NPC %d: %v", npc.ID, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeRespawn, data, nil, nil, true)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// NPC avoidance tuning
+const (
+	npcAvoidLookahead  = 0.5  // seconds of movement an NPC looks ahead for bodies in its way
+	npcAvoidMinReach   = 16.0 // px looked ahead however slow the NPC walks
+	npcAvoidPushWeight = 1.5  // how hard nearby bodies push, relative to the path direction
+	npcAvoidSideWeight = 1.0  // how hard a body ahead turns the NPC aside
+)
+
+// collectCrowd gathers the bodies NPCs and pets steer around this tick: every NPC, pet and
+// player. Called from Update; callers hold nm.mu.
+func (nm *NPCManager) collectCrowd(gameState *GameMatchState) {
+	nm.crowd = nm.crowd[:0]
+	for _, npc := range nm.live() {
+		nm.crowd = append(nm.crowd, npc.Body)
+	}
+	for _, rb := range gameState.PlayerBodies() {
+		if rb != nil {
+			nm.crowd = append(nm.crowd, rb)
+		}
+	}
+}
+
+// avoid bends the velocity an NPC's A* route asks for around the bodies just ahead of it, so
+// NPCs sharing a corridor flow past each other and around players instead of piling up. Nearby
+// bodies (found with the physics overlap query) push the NPC away and bodies ahead turn it to
+// the side they aren't on; the speed is kept, the NPC never turns back on its route and it
+// keeps the route's velocity when the detour would run into a wall. The NPC's target and a
+// pet's owner aren't avoided. Callers hold nm.mu.
+func (nm *NPCManager) avoid(gameState *GameMatchState, npc *NPC, desired vector.Vector) vector.Vector {
+	speed := desired.Magnitude()
+	if speed == 0 || len(nm.crowd) < 2 {
+		return desired
+	}
+	ignore := map[*rigidbody.RigidBody]bool{npc.Body: true}
+	if rb := gameState.PlayerBody(npc.Target); rb != nil {
+		ignore[rb] = true
+	}
+	if npc.Pet != nil {
+		if rb := gameState.PlayerBody(npc.Pet.OwnerID); rb != nil {
+			ignore[rb] = true
+		}
+		if target := nm.npcs[npc.Pet.Target]; target != nil {
+			ignore[target.Body] = true
+		}
+	}
+
+	position := npc.Body.Position
+	dir := desired.Scale(1 / speed)
+	radius := bodyRadius(npc.Body)
+	reach := math.Max(speed*npcAvoidLookahead, npcAvoidMinReach)
+	center := position.Add(dir.Scale(reach / 2))
+	probe := acquireCircleProbe(center.X, center.Y, radius+reach/2)
+	nearby := gameState.physicsEngine.QueryOverlap(probe, nm.crowd)
+	releaseProbe(probe)
+
+	var push vector.Vector
+	for _, rb := range nearby {
+		if ignore[rb] {
+			continue
+		}
+		away := position.Sub(rb.Position)
+		dist := away.Magnitude()
+		if dist == 0 {
+			away, dist = vector.Vector{X: -dir.Y, Y: dir.X}, 1
+		}
+		weight := 1 - dist/(radius+bodyRadius(rb)+reach)
+		if weight <= 0 {
+			continue
+		}
+		push = push.Add(away.Scale(weight * npcAvoidPushWeight / dist))
+
+		// A body ahead: step to the side it isn't on (by ID when it is dead ahead, so two NPCs
+		// meeting head-on pick opposite sides)
+		if away.X*dir.X+away.Y*dir.Y < 0 {
+			side := vector.Vector{X: -dir.Y, Y: dir.X}
+			lateral := side.X*away.X + side.Y*away.Y
+			if lateral < 0 || (lateral == 0 && npc.ID%2 == 1) {
+				side = side.Scale(-1)
+			}
+			push = push.Add(side.Scale(weight * npcAvoidSideWeight))
+		}
+	}
+	if push.Magnitude() == 0 {
+		return desired
+	}
+
+	steered := dir.Add(push)
+	if back := steered.X*dir.X + steered.Y*dir.Y; back < 0 {
+		steered = steered.Sub(dir.Scale(back))
+	}
+	length := steered.Magnitude()
+	if length == 0 {
+		return desired
+	}
+	steered = steered.Scale(speed / length)
+
+	if grid := gameState.pathfinder.grid; grid != nil && !grid.lineWalkable(position, position.Add(steered.Scale(npcAvoidLookahead)), math.Min(radius, pathClearance)) {
+		return desired
+	}
+	return steered
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Bark and routine tuning
+const (
+	defaultBarkInterval  = 30.0         // seconds between barks
+	defaultBarkRadius    = 6 * TileSize // players within this distance hear a bark
+	npcRoutineSpeedSlack = 2.0          // a routine walk may take this many times its straight-line time before it is dropped
+)
+
+// NPCBarks are the ambient lines an NPC says to the players around it
+type NPCBarks struct {
+	Lines    []string `json:"lines"`
+	Interval float64  `json:"interval,omitempty"` // seconds between barks (default defaultBarkInterval)
+	Radius   float64  `json:"radius,omitempty"`   // hearing distance (default defaultBarkRadius)
+}
+
+// NPCRoutineEntry is where an NPC spends some game hours: around a map marker, with an optional
+// behavior of its own there
+type NPCRoutineEntry struct {
+	Hours    string `json:"hours"`              // game hours like "9-17"
+	Marker   string `json:"marker"`             // named map marker the NPC walks to
+	Behavior string `json:"behavior,omitempty"` // NPCBehaviorIdle or NPCBehaviorWander while there (default the definition's)
+	hours    HourRange
+}
+
+// NPCBark is a bark sent to the players near an NPC (OpCodeBark). Key names the catalog
+// template clients may render instead of Text ("npc.<type>.bark.<line>").
+type NPCBark struct {
+	NPCID int     `json:"npcId"`
+	Key   string  `json:"key,omitempty"`
+	Text  string  `json:"text"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+}
+
+// normalizeRoutine drops the routine entries with invalid hours or no marker and fills in the
+// bark defaults of a definition
+func (nm *NPCManager) normalizeRoutine(def *NPCDefinition) {
+	if def.Barks != nil {
+		if def.Barks.Interval <= 0 {
+			def.Barks.Interval = defaultBarkInterval
+		}
+		if def.Barks.Radius <= 0 {
+			def.Barks.Radius = defaultBarkRadius
+		}
+	}
+	valid := def.Routine[:0]
+	for _, entry := range def.Routine {
+		hours, ok := parseHourRange(entry.Hours)
+		if !ok || entry.Marker == "" {
+			nm.logger.Warn("NPC %s has an invalid routine entry (%q at %q); skipping it", def.ID, entry.Hours, entry.Marker)
+			continue
+		}
+		if entry.Behavior != "" && entry.Behavior != NPCBehaviorIdle && entry.Behavior != NPCBehaviorWander {
+			nm.logger.Warn("NPC %s routine entry at %q has unknown behavior %q; using the definition's", def.ID, entry.Marker, entry.Behavior)
+			entry.Behavior = ""
+		}
+		entry.hours = hours
+		valid = append(valid, entry)
+	}
+	def.Routine = valid
+}
+
+// behavior returns what the NPC does while idle: its routine entry's behavior or its definition's
+func (npc *NPC) behavior() string {
+	if npc.routine != nil && npc.routine.Behavior != "" {
+		return npc.routine.Behavior
+	}
+	return npc.Def.Behavior
+}
+
+// followRoutine moves the NPC's home to the marker of the routine entry covering the game hour
+// (back to where it spawned when none does) and, if it isn't fighting, walks it there with the
+// pathfinder. Callers hold nm.mu.
+func (nm *NPCManager) followRoutine(gameState *GameMatchState, npc *NPC, tick int64) {
+	if len(npc.Def.Routine) == 0 || npc.Pet != nil || npc.Escort != nil || gameState.currentMap == nil {
+		return
+	}
+	var entry *NPCRoutineEntry
+	home := npc.spawnHome
+	hour := gameState.worldClock.Hour()
+	for i := range npc.Def.Routine {
+		candidate := &npc.Def.Routine[i]
+		if !candidate.hours.Contains(hour) {
+			continue
+		}
+		marker, ok := gameState.currentMap.Markers[candidate.Marker]
+		if !ok {
+			continue
+		}
+		entry, home = candidate, marker
+		break
+	}
+	if entry == npc.routine && home == npc.Home {
+		return
+	}
+	npc.routine = entry
+	npc.Home = home
+	if npc.State != NPCStateIdle {
+		// Fights end with a walk to the new home
+		return
+	}
+	goal := home
+	npc.goal, npc.goalTick, npc.route = &goal, tick, nil
+	npc.routineGoal = npc.goal
+	npc.goalSlack = int64(home.Sub(npc.Body.Position).Magnitude() / npc.Def.Speed * npcRoutineSpeedSlack * TickRate)
+}
+
+// bark has an idle NPC say a random line of its barks to the players around it every interval
+func (nm *NPCManager) bark(gameState *GameMatchState, npc *NPC, tick int64, dispatcher runtime.MatchDispatcher) {
+	barks := npc.Def.Barks
+	if barks == nil || len(barks.Lines) == 0 || tick < npc.nextBark {
+		return
+	}
+	if npc.nextBark == 0 {
+		// Spread the first barks so NPCs spawned together don't talk in chorus
+		npc.nextBark = tick + gameState.rng.Int63n(int64(barks.Interval*TickRate)+1)
+		return
+	}
+	npc.nextBark = tick + int64(barks.Interval*TickRate)
+	if npc.State != NPCStateIdle || dispatcher == nil {
+		return
+	}
+	recipients := gameState.PresencesInRange(npc.Body.Position, barks.Radius)
+	if len(recipients) == 0 {
+		return
+	}
+	line := gameState.rng.Intn(len(barks.Lines))
+	nm.sendBark(gameState, npc, "npc."+npc.Def.ID+".bark."+strconv.Itoa(line), barks.Lines[line], recipients, dispatcher)
+}
+
+// sendBark sends a line said by an NPC to recipients, rendered in each one's locale
+func (nm *NPCManager) sendBark(gameState *GameMatchState, npc *NPC, key, text string, recipients []runtime.Presence, dispatcher runtime.MatchDispatcher) {
+	for locale, presences := range gameState.presencesByLocale(recipients) {
+		bark := NPCBark{NPCID: npc.ID, Text: text, X: npc.Body.Position.X, Y: npc.Body.Position.Y}
+		if key != "" {
+			bark.Key = key
+			bark.Text = localizedOr(locale, key, text)
+		}
+		data, err := EncodeMessage(OpCodeBark, "npc_bark", bark)
+		if err != nil {
+			nm.logger.Error("Failed to marshal bark of NPC %d: %v", npc.ID, err)
+			return
+		}
+		dispatcher.BroadcastMessage(OpCodeBark, data, presences, nil, true)
+	}
+}
+
+// Say has an NPC say a line to the players within its bark radius (the default radius for NPCs
+// without barks). It returns false for unknown NPCs.
+func (nm *NPCManager) Say(gameState *GameMatchState, id int, text string, dispatcher runtime.MatchDispatcher) bool {
+	npc, ok := nm.Get(id)
+	if !ok {
+		return false
+	}
+	radius := float64(defaultBarkRadius)
+	if npc.Def.Barks != nil {
+		radius = npc.Def.Barks.Radius
+	}
+	if dispatcher == nil {
+		return true
+	}
+	if recipients := gameState.PresencesInRange(npc.Body.Position, radius); len(recipients) > 0 {
+		nm.sendBark(gameState, npc, "", text, recipients, dispatcher)
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Threat tuning
+const (
+	npcHealThreat     = 0.5 // threat per point of health healed, against every NPC fighting the healed player
+	npcTauntMargin    = 1.1 // a taunt raises the taunter's threat to this share of the top threat
+	minThreatModifier = 0.0 // threat effects never make threat negative
+)
+
+// ThreatEntry is a player's threat on an NPC, as get_threat returns it
+type ThreatEntry struct {
+	PlayerID string
+	Threat   float64
+}
+
+// EffectThreat returns the factor the player's threat is multiplied by: 1 plus the magnitude of
+// each threat effect stack (a tank stance of 1 doubles threat, a fade of -0.5 halves it)
+func (ps *PlayerState) EffectThreat() float64 {
+	modifier := 1.0
+	for _, effect := range ps.Effects {
+		if effect.Def.Kind == EffectKindThreat {
+			modifier += effect.Def.Magnitude * float64(effect.Stacks)
+		}
+	}
+	return math.Max(minThreatModifier, modifier)
+}
+
+// threatFor scales threat a player generates by their threat effects
+func (gs *GameMatchState) threatFor(playerID string, amount float64) float64 {
+	return amount * gs.GetPlayerState(playerID).EffectThreat()
+}
+
+// AddThreat adds threat (negative to lower it) against a player on an NPC, unscaled. Entries
+// that drop to zero are removed. It returns the new threat and false for unknown NPCs, pets,
+// evading NPCs and players who aren't in the match.
+func (nm *NPCManager) AddThreat(gameState *GameMatchState, npcID int, playerID string, amount float64) (float64, bool) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	npc, ok := nm.npcs[npcID]
+	if !ok || npc.Pet != nil || npc.evading || gameState.PlayerBody(playerID) == nil {
+		return 0, false
+	}
+	threat := npc.Threat[playerID] + amount
+	if threat <= 0 {
+		delete(npc.Threat, playerID)
+		return 0, true
+	}
+	npc.Threat[playerID] = threat
+	return threat, true
+}
+
+// HealThreat gives a healer threat for healing a player: npcHealThreat per point healed, scaled
+// by the healer's threat effects, on every NPC that has the healed player in its threat table.
+// Healers and healed players who aren't in the match add none.
+func (nm *NPCManager) HealThreat(gameState *GameMatchState, healerID, healedID string, healed float64) {
+	if healed <= 0 || healerID == "" || gameState.PlayerBody(healerID) == nil || gameState.PlayerBody(healedID) == nil {
+		return
+	}
+	threat := gameState.threatFor(healerID, healed*npcHealThreat)
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	for _, npc := range nm.live() {
+		if npc.Pet != nil || npc.evading {
+			continue
+		}
+		if _, fighting := npc.Threat[healedID]; fighting {
+			npc.Threat[healerID] += threat
+		}
+	}
+}
+
+// Taunt makes an NPC attack a player for some seconds: the player's threat is raised to
+// npcTauntMargin times the top threat, and the NPC keeps them as its target until the taunt
+// ends, whatever others do. It returns false for unknown NPCs, pets, evading NPCs and players
+// who aren't in the match or are dead.
+func (nm *NPCManager) Taunt(gameState *GameMatchState, npcID int, playerID string, seconds float64) bool {
+	if gameState.PlayerBody(playerID) == nil || gameState.GetPlayerState(playerID).IsDead() {
+		return false
+	}
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	npc, ok := nm.npcs[npcID]
+	if !ok || npc.Pet != nil || npc.evading {
+		return false
+	}
+	top := 0.0
+	for _, threat := range npc.Threat {
+		top = math.Max(top, threat)
+	}
+	npc.Threat[playerID] = math.Max(npc.Threat[playerID], top*npcTauntMargin+npcSightThreat)
+	npc.tauntedBy = playerID
+	npc.tauntUntil = gameState.currentTick + int64(seconds*TickRate)
+	return true
+}
+
+// ThreatTable returns an NPC's threat table, highest first, and false for unknown NPCs
+func (nm *NPCManager) ThreatTable(npcID int) ([]ThreatEntry, bool) {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	npc, ok := nm.npcs[npcID]
+	if !ok {
+		return nil, false
+	}
+	entries := make([]ThreatEntry, 0, len(npc.Threat))
+	for playerID, threat := range npc.Threat {
+		entries = append(entries, ThreatEntry{PlayerID: playerID, Threat: threat})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Threat != entries[j].Threat {
+			return entries[i].Threat > entries[j].Threat
+		}
+		return entries[i].PlayerID < entries[j].PlayerID
+	})
+	return entries, true
+}
@@ -0,0 +1,714 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"math"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// NPC behaviors
+const (
+	NPCBehaviorIdle   = "idle"   // stands still (scripts may still move it)
+	NPCBehaviorWander = "wander" // walks to random points around its home
+	NPCBehaviorPatrol = "patrol" // follows its spawner's path
+)
+
+// NPC tuning
+const (
+	npcArriveDistance      = 4.0          // an NPC has reached its goal when this close (pixels)
+	npcThinkInterval       = TickRate     // ticks between behavior script runs
+	npcWanderPauseTicks    = 2 * TickRate // max pause before a wandering NPC picks a new goal
+	npcGoalTimeoutTicks    = 8 * TickRate // goals not reached in this time are dropped (stuck on a wall)
+	defaultNPCSpeed        = 80.0
+	defaultWanderRadius    = 96.0
+	defaultNPCRespawnDelay = 30.0 // seconds before a spawner replaces a missing NPC
+)
+
+// NPC schedules: when an NPC follows its behavior (e.g. shopkeepers only work during the day)
+const (
+	NPCScheduleAlways = ""      // always on duty (default)
+	NPCScheduleDay    = "day"   // on duty between sunrise and sunset
+	NPCScheduleNight  = "night" // on duty between sunset and sunrise
+)
+
+// NPCDefinition describes a kind of NPC
+type NPCDefinition struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	GID          uint32  `json:"gid"`                    // sprite tile GID
+	MaxHealth    float64 `json:"maxHealth,omitempty"`    // default defaultMaxHealth
+	Speed        float64 `json:"speed,omitempty"`        // pixels per second (default defaultNPCSpeed)
+	Size         float64 `json:"size,omitempty"`         // collider width/height (default one tile)
+	Behavior     string  `json:"behavior,omitempty"`     // NPCBehavior* (default idle)
+	WanderRadius float64 `json:"wanderRadius,omitempty"` // how far wandering NPCs stray from home
+	Script       string  `json:"script,omitempty"`       // behavior script run every npcThinkInterval ticks
+	Schedule     string  `json:"schedule,omitempty"`     // NPCSchedule* or game hours like "9-17": outside it the NPC goes home and stays there
+	Greeting     string  `json:"greeting,omitempty"`     // shown when a player talks to the NPC (quests.go)
+
+	// Ambient lines and daily routine (npc_routines.go)
+	Barks   *NPCBarks         `json:"barks,omitempty"`   // lines said to nearby players while idle
+	Routine []NPCRoutineEntry `json:"routine,omitempty"` // where the NPC spends each part of the day
+
+	// Reputation (reputation.go)
+	Faction    string         `json:"faction,omitempty"`    // faction the NPC belongs to; it attacks players hostile to the faction
+	Reputation map[string]int `json:"reputation,omitempty"` // faction ID -> standing change for the player who kills the NPC
+
+	// Combat AI (npc_ai.go). Non-hostile NPCs only fight back once damaged.
+	Armor          float64            `json:"armor,omitempty"`          // reduces physical damage (health.go)
+	Resistances    map[string]float64 `json:"resistances,omitempty"`    // damage type -> fraction absorbed
+	Hostile        bool               `json:"hostile,omitempty"`        // attacks players it perceives
+	AggroRadius    float64            `json:"aggroRadius,omitempty"`    // perception radius (default defaultAggroRadius)
+	LeashRadius    float64            `json:"leashRadius,omitempty"`    // max chase distance from home (default defaultLeashRadius)
+	AttackRange    float64            `json:"attackRange,omitempty"`    // center distance to attack from (default defaultAttackRange)
+	AttackDamage   float64            `json:"attackDamage,omitempty"`   // damage per attack (default defaultAttackDamage)
+	AttackCooldown float64            `json:"attackCooldown,omitempty"` // seconds between attacks (default defaultAttackCooldown)
+	FleeHealth     float64            `json:"fleeHealth,omitempty"`     // flee below this fraction of max health (0 = never)
+
+	Loot      []LootDrop `json:"loot,omitempty"`      // item stacks dropped on death
+	LootTable string     `json:"lootTable,omitempty"` // loot table rolled on death (loot.go), credited to the killer
+}
+
+// LootDrop is an item stack an NPC may drop when it dies
+type LootDrop struct {
+	ItemID string  `json:"item"`
+	Count  int     `json:"count,omitempty"`  // default 1
+	Chance float64 `json:"chance,omitempty"` // probability 0..1 (default 1)
+}
+
+// NPCLifeEvent is broadcast when an NPC dies (OpCodeRespawn)
+type NPCLifeEvent struct {
+	NPCID    int            `json:"npcId"`
+	Type     string         `json:"type"`
+	X        float64        `json:"x"`
+	Y        float64        `json:"y"`
+	KilledBy *DamageSource  `json:"killedBy,omitempty"`
+	Loot     map[string]int `json:"loot,omitempty"` // item ID -> count dropped
+}
+
+// NPC is a spawned NPC instance. Its body is a movable rigid body in gameObjects, so it
+// collides with the world and players like a player body does.
+type NPC struct {
+	ID   int
+	Def  *NPCDefinition
+	Body *rigidbody.RigidBody
+	HealthComponent
+	Facing     float64
+	Home       vector.Vector
+	Path       *MapPath // patrol path (nil for non-patrolling NPCs)
+	pathIndex  int
+	pathStep   int // +1 or -1 while walking an open path back and forth
+	goal       *vector.Vector
+	goalTick   int64           // tick the current goal was set
+	route      []vector.Vector // waypoints towards goal returned by the pathfinder
+	routing    bool            // a path request for goal is queued
+	idleUntil  int64           // wandering NPCs pause until this tick
+	spawner    *NPCSpawner
+	ambient    *AmbientPopulation // region population the NPC belongs to (ambient_population.go)
+	nextThinks int64
+
+	State          string             // NPCState*; behavior movement only runs while idle
+	Threat         map[string]float64 // player ID -> threat; the highest is the combat target
+	Target         string             // player the NPC is fighting (empty when none)
+	nextPerception int64
+	attackReady    int64         // first tick the NPC may attack again
+	searchUntil    int64         // an investigating NPC looks around until this tick once it reached the noise
+	offDuty        bool          // outside the definition's schedule; set from world clock events
+	leash          float64       // how far the NPC may be pulled from home (0 = the definition's leashRadius)
+	maxChase       float64       // how far the NPC chases from pullPoint (0 = no limit)
+	pullPoint      vector.Vector // where the NPC was when it took its first target
+	evading        bool          // broke its leash: walks home taking no damage, then heals
+	tauntedBy      string        // player who taunted the NPC (npc_threat.go)
+	tauntUntil     int64         // the taunt holds the target until this tick
+
+	spawnHome   vector.Vector    // where the NPC spawned; its home when no routine entry applies
+	routine     *NPCRoutineEntry // routine entry the NPC follows now (npc_routines.go)
+	routineGoal *vector.Vector   // goal of the walk to the routine's marker
+	goalSlack   int64            // extra ticks the routine walk may take before it is dropped
+	nextBark    int64
+
+	Pet    *ActivePet   // owner link of a summoned pet (pets.go); nil for world NPCs
+	Escort *QuestEscort // quest escort link (quest_escort.go); nil for other NPCs
+}
+
+// NPCData is the NPC representation sent in world updates
+type NPCData struct {
+	ID        int      `json:"id"`
+	Type      string   `json:"type"`
+	Name      string   `json:"name"`
+	GID       uint32   `json:"gid"`
+	Position  Position `json:"position"`
+	Facing    float64  `json:"facing"`
+	Health    float64  `json:"health"`
+	MaxHealth float64  `json:"maxHealth"`
+	State     string   `json:"state"`
+	OffDuty   bool     `json:"offDuty,omitempty"`   // outside its schedule (e.g. a closed shop)
+	Evading   bool     `json:"evading,omitempty"`   // broke its leash and walks home immune to damage
+	Escorting string   `json:"escorting,omitempty"` // player escorting the NPC for a quest
+}
+
+// NPCSpawner is an "npc_spawner" map object that keeps Count NPCs of type NPC alive
+type NPCSpawner struct {
+	ID           int
+	NPC          string
+	Position     vector.Vector
+	Count        int
+	Path         *MapPath
+	RespawnTicks int64   // delay before a missing NPC is replaced
+	Disabled     bool    // spawns nothing until a mechanism enables it ("dormant" property)
+	LeashRadius  float64 // how far its NPCs may be pulled from home (0 = the definition's leashRadius)
+	MaxChase     float64 // how far its NPCs chase from where they were pulled (0 = no limit)
+	pathRef      any     // "path" property as authored (object ID or name), resolved into Path by the map loader
+	alive        int
+	nextSpawn    int64
+}
+
+// NPCManager owns the NPC definitions and the NPCs alive in the match
+type NPCManager struct {
+	logger      runtime.Logger
+	definitions map[string]*NPCDefinition
+	npcs        map[int]*NPC
+	order       []int // npcs' IDs, sorted (ordering.go)
+	spawners    []*NPCSpawner
+	populations []*AmbientPopulation // the regions' ambient NPC budgets (ambient_population.go)
+	nextID      int
+	crowd       []*rigidbody.RigidBody // bodies NPCs steer around this tick (npc_avoidance.go)
+	mu          sync.RWMutex
+}
+
+// NewNPCManager creates a manager and loads definitions from path (a JSON object keyed by NPC type)
+func NewNPCManager(logger runtime.Logger, path string) *NPCManager {
+	nm := &NPCManager{
+		logger:      logger,
+		definitions: make(map[string]*NPCDefinition),
+		npcs:        make(map[int]*NPC),
+		nextID:      1,
+	}
+	if err := nm.Load(path); err != nil {
+		logger.Warn("Failed to load NPC definitions from %s: %v", path, err)
+	}
+	return nm
+}
+
+// Load replaces the NPC definitions with the ones found in path
+func (nm *NPCManager) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var definitions map[string]*NPCDefinition
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return err
+	}
+	for id, def := range definitions {
+		def.ID = id
+		if def.MaxHealth <= 0 {
+			def.MaxHealth = defaultMaxHealth
+		}
+		if def.Speed <= 0 {
+			def.Speed = defaultNPCSpeed
+		}
+		if def.Size <= 0 {
+			def.Size = TileSize
+		}
+		if def.Behavior == "" {
+			def.Behavior = NPCBehaviorIdle
+		}
+		if def.WanderRadius <= 0 {
+			def.WanderRadius = defaultWanderRadius
+		}
+		if def.AggroRadius <= 0 {
+			def.AggroRadius = defaultAggroRadius
+		}
+		if def.LeashRadius <= 0 {
+			def.LeashRadius = defaultLeashRadius
+		}
+		if def.AttackRange <= 0 {
+			def.AttackRange = defaultAttackRange
+		}
+		if def.AttackDamage <= 0 {
+			def.AttackDamage = defaultAttackDamage
+		}
+		if def.AttackCooldown <= 0 {
+			def.AttackCooldown = defaultAttackCooldown
+		}
+		switch def.Schedule {
+		case NPCScheduleAlways, NPCScheduleDay, NPCScheduleNight:
+		default:
+			if _, ok := parseHourRange(def.Schedule); !ok {
+				nm.logger.Warn("NPC %s has invalid schedule %q; always on duty", id, def.Schedule)
+				def.Schedule = NPCScheduleAlways
+			}
+		}
+		nm.normalizeRoutine(def)
+		for i := range def.Loot {
+			if def.Loot[i].Count <= 0 {
+				def.Loot[i].Count = 1
+			}
+			if def.Loot[i].Chance <= 0 {
+				def.Loot[i].Chance = 1
+			}
+		}
+	}
+
+	nm.mu.Lock()
+	nm.definitions = definitions
+	nm.mu.Unlock()
+
+	nm.logger.Info("Loaded %d NPC definitions from %s", len(definitions), path)
+	return nil
+}
+
+// Definition returns the definition of an NPC type
+func (nm *NPCManager) Definition(npcType string) (*NPCDefinition, bool) {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	def, ok := nm.definitions[npcType]
+	return def, ok
+}
+
+// Get returns a live NPC by ID
+func (nm *NPCManager) Get(id int) (*NPC, bool) {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	npc, ok := nm.npcs[id]
+	return npc, ok
+}
+
+// BodyOwners maps the bodies of the live NPCs to their IDs
+func (nm *NPCManager) BodyOwners() map[*rigidbody.RigidBody]int {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	owners := make(map[*rigidbody.RigidBody]int, len(nm.npcs))
+	for id, npc := range nm.live() {
+		owners[npc.Body] = id
+	}
+	return owners
+}
+
+// SpawnFromMap creates the spawners and region populations of the current map and fills them
+func (nm *NPCManager) SpawnFromMap(gameState *GameMatchState) {
+	if gameState.currentMap == nil {
+		return
+	}
+	for i := range gameState.currentMap.NPCSpawners {
+		spawner := gameState.currentMap.NPCSpawners[i]
+		nm.spawners = append(nm.spawners, &spawner)
+	}
+	for _, spawner := range nm.spawners {
+		for !spawner.Disabled && spawner.alive < spawner.Count {
+			if nm.spawnFor(gameState, spawner) == 0 {
+				break
+			}
+		}
+	}
+	nm.createPopulations(gameState)
+	for _, population := range nm.populations {
+		nm.fillPopulation(gameState, population, population.Target)
+	}
+}
+
+// HasSpawner reports whether an "npc_spawner" object with this ID exists
+func (nm *NPCManager) HasSpawner(id int) bool {
+	for _, spawner := range nm.spawners {
+		if spawner.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSpawnerEnabled starts or stops a spawner. An enabled spawner fills up right away; disabling
+// one keeps its living NPCs but stops replacing them.
+func (nm *NPCManager) SetSpawnerEnabled(gameState *GameMatchState, id int, enabled bool) bool {
+	for _, spawner := range nm.spawners {
+		if spawner.ID != id {
+			continue
+		}
+		if spawner.Disabled == enabled {
+			spawner.Disabled = !enabled
+			spawner.nextSpawn = gameState.currentTick
+		}
+		return true
+	}
+	return false
+}
+
+// Spawn places a new NPC of the given type at position and returns its ID (0 if the type is unknown)
+func (nm *NPCManager) Spawn(gameState *GameMatchState, npcType string, position vector.Vector, path *MapPath) int {
+	def, ok := nm.Definition(npcType)
+	if !ok {
+		return 0
+	}
+
+	body := MakeRectangleRigidBody(position.X, position.Y, def.Size, def.Size)
+	SetMovable(body, 10.0)
+
+	nm.mu.Lock()
+	npc := &NPC{
+		ID:   nm.nextID,
+		Def:  def,
+		Body: body,
+		HealthComponent: HealthComponent{
+			Health:      def.MaxHealth,
+			MaxHealth:   def.MaxHealth,
+			Armor:       def.Armor,
+			Resistances: maps.Clone(def.Resistances),
+		},
+		Home:      position,
+		spawnHome: position,
+		Path:      path,
+		pathStep:  1,
+		State:     NPCStateIdle,
+		Threat:    make(map[string]float64),
+		offDuty:   !def.OnDuty(gameState.worldClock),
+	}
+	nm.nextID++
+	nm.npcs[npc.ID] = npc
+	nm.order = withID(nm.order, npc.ID)
+	nm.followRoutine(gameState, npc, gameState.currentTick)
+	nm.mu.Unlock()
+
+	gameState.AddNPCObject(npc)
+	nm.logger.Info("Spawned NPC %d (%s) at (%.1f, %.1f)", npc.ID, def.ID, position.X, position.Y)
+	return npc.ID
+}
+
+// spawnFor spawns one NPC for a spawner
+func (nm *NPCManager) spawnFor(gameState *GameMatchState, spawner *NPCSpawner) int {
+	id := nm.Spawn(gameState, spawner.NPC, spawner.Position, spawner.Path)
+	if id == 0 {
+		// The definitions don't change at runtime, so stop retrying every tick
+		nm.logger.Warn("NPC spawner %d references unknown NPC type %q; disabling it", spawner.ID, spawner.NPC)
+		spawner.Count = 0
+		return 0
+	}
+	nm.mu.Lock()
+	npc := nm.npcs[id]
+	npc.spawner = spawner
+	npc.leash, npc.maxChase = spawner.LeashRadius, spawner.MaxChase
+	spawner.alive++
+	nm.mu.Unlock()
+	return id
+}
+
+// Despawn removes an NPC and its body from the world. Its spawner replaces it after its respawn
+// delay, its region population at the next check.
+func (nm *NPCManager) Despawn(gameState *GameMatchState, id int) {
+	nm.mu.Lock()
+	npc, ok := nm.npcs[id]
+	if ok {
+		delete(nm.npcs, id)
+		nm.order = withoutID(nm.order, id)
+		if npc.spawner != nil {
+			npc.spawner.alive--
+			npc.spawner.nextSpawn = gameState.currentTick + npc.spawner.RespawnTicks
+		}
+		if npc.ambient != nil {
+			npc.ambient.alive--
+		}
+	}
+	nm.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	gameState.RemoveNPCObject(npc)
+}
+
+// SetGoal makes an NPC walk to a position, overriding its behavior until it arrives
+func (nm *NPCManager) SetGoal(id int, goal vector.Vector, tick int64) bool {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	npc, ok := nm.npcs[id]
+	if !ok {
+		return false
+	}
+	npc.goal = &goal
+	npc.goalTick = tick
+	npc.route = nil
+	return true
+}
+
+// Update refills spawners and region populations, runs behavior scripts and steers every NPC
+// towards its goal. Called from the match loop before physics.
+func (nm *NPCManager) Update(ctx context.Context, gameState *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	tick := gameState.currentTick
+	for _, spawner := range nm.spawners {
+		if !spawner.Disabled && spawner.alive < spawner.Count && tick >= spawner.nextSpawn {
+			nm.spawnFor(gameState, spawner)
+		}
+	}
+	// An overloaded match leaves its ambient life as it is
+	ambientPaused := gameState.load.AmbientPaused()
+	if !ambientPaused {
+		nm.updatePopulations(gameState)
+	}
+
+	nm.mu.Lock()
+	npcs := make([]*NPC, 0, len(nm.npcs))
+	for _, npc := range nm.live() {
+		npcs = append(npcs, npc)
+	}
+	nm.collectCrowd(gameState)
+	nm.mu.Unlock()
+
+	for _, npc := range npcs {
+		if ambientPaused && npc.ambient != nil && npc.State == NPCStateIdle {
+			continue
+		}
+		if npc.Def.Script != "" && tick >= npc.nextThinks {
+			npc.nextThinks = tick + npcThinkInterval
+			params := map[string]any{
+				"npcId":   npc.ID,
+				"npcType": npc.Def.ID,
+				"x":       npc.Body.Position.X,
+				"y":       npc.Body.Position.Y,
+				"event":   "think",
+				"state":   npc.State,
+				"target":  npc.Target,
+				"isDay":   gameState.worldClock.IsDay(),
+				"offDuty": npc.offDuty,
+			}
+			if err := gameState.RunScript(ctx, npc.Def.Script, params, dispatcher, nm.logger); err != nil {
+				nm.logger.Error("NPC %d behavior script error: %v", npc.ID, err)
+			}
+		}
+		if npc.Pet != nil {
+			nm.updatePet(gameState, npc, tick, dispatcher)
+		} else if npc.Escort != nil {
+			nm.updateEscort(gameState, npc, tick)
+		} else {
+			nm.updateAI(gameState, npc, tick, dispatcher)
+			nm.bark(gameState, npc, tick, dispatcher)
+		}
+		nm.steer(gameState, npc, tick)
+	}
+}
+
+// OnDuty reports whether NPCs of this type follow their behavior at the clock's time of day
+func (def *NPCDefinition) OnDuty(wc *WorldClock) bool {
+	switch def.Schedule {
+	case NPCScheduleAlways:
+		return true
+	case NPCScheduleDay:
+		return wc.IsDay()
+	case NPCScheduleNight:
+		return !wc.IsDay()
+	}
+	hours, ok := parseHourRange(def.Schedule)
+	return !ok || hours.Contains(wc.Hour())
+}
+
+// SubscribeEvents updates NPC schedules every game hour and at sunrise and sunset, and passes
+// sunrise and sunset to the NPCs' behavior scripts (ctx.event = "sunrise" or "sunset")
+func (nm *NPCManager) SubscribeEvents(eb *EventBus) {
+	handler := func(ctx context.Context, gameState *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		isDay := gameState.worldClock.IsDay()
+		nm.mu.Lock()
+		scripted := make([]*NPC, 0)
+		for _, npc := range nm.live() {
+			if offDuty := !npc.Def.OnDuty(gameState.worldClock); offDuty != npc.offDuty {
+				npc.offDuty = offDuty
+				if offDuty && npc.State == NPCStateIdle {
+					// Drop the current wander/patrol goal so the NPC heads home right away
+					npc.goal, npc.route = nil, nil
+				}
+			}
+			nm.followRoutine(gameState, npc, gameState.currentTick)
+			if npc.Def.Script != "" && event.Name != EventHour {
+				scripted = append(scripted, npc)
+			}
+		}
+		nm.mu.Unlock()
+
+		// Scripts may call back into the manager, so they run without the lock
+		for _, npc := range scripted {
+			params := map[string]any{
+				"npcId":   npc.ID,
+				"npcType": npc.Def.ID,
+				"x":       npc.Body.Position.X,
+				"y":       npc.Body.Position.Y,
+				"event":   event.Name,
+				"state":   npc.State,
+				"isDay":   isDay,
+				"offDuty": npc.offDuty,
+			}
+			if err := gameState.RunScript(ctx, npc.Def.Script, params, dispatcher, nm.logger); err != nil {
+				nm.logger.Error("NPC %d %s script error: %v", npc.ID, event.Name, err)
+			}
+		}
+	}
+	eb.Subscribe(EventSunrise, handler)
+	eb.Subscribe(EventSunset, handler)
+	eb.Subscribe(EventHour, handler)
+}
+
+// steer picks the NPC's next goal from its behavior and sets its velocity along the path
+// the pathfinder returned for it, bent around the bodies in its way (npc_avoidance.go)
+func (nm *NPCManager) steer(gameState *GameMatchState, npc *NPC, tick int64) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	if npc.goal != nil {
+		// The route may end short of the goal when the goal lies inside a wall
+		end := *npc.goal
+		if len(npc.route) > 0 {
+			end = npc.route[len(npc.route)-1]
+		}
+		timeout := int64(npcGoalTimeoutTicks)
+		if npc.goal == npc.routineGoal {
+			timeout += npc.goalSlack
+		}
+		if end.Sub(npc.Body.Position).Magnitude() <= npcArriveDistance || tick-npc.goalTick > timeout {
+			if npc.evading && tick-npc.goalTick > timeout {
+				// An evading NPC that got stuck on its way is put back home, so it can't be
+				// left where players dragged it
+				npc.Body.Position = npc.Home
+				npc.Body.Velocity = vector.Vector{X: 0, Y: 0}
+			}
+			npc.finishGoal(gameState.rng, tick)
+		}
+	}
+
+	if npc.Pet != nil || npc.Escort != nil {
+		// Pets and escorts get their goals from updatePet and updateEscort
+	} else if npc.goal == nil && npc.State == NPCStateIdle && npc.offDuty {
+		// Off duty: walk home once, then stand there until the schedule starts again
+		if npc.Home.Sub(npc.Body.Position).Magnitude() > npcArriveDistance {
+			home := npc.Home
+			npc.goal, npc.goalTick = &home, tick
+		}
+	} else if npc.goal == nil && npc.State == NPCStateIdle {
+		switch npc.behavior() {
+		case NPCBehaviorWander:
+			if tick >= npc.idleUntil {
+				angle := gameState.rng.Float64() * 2 * math.Pi
+				dist := gameState.rng.Float64() * npc.Def.WanderRadius
+				goal := npc.Home.Add(vector.Vector{X: math.Cos(angle) * dist, Y: math.Sin(angle) * dist})
+				npc.goal, npc.goalTick = &goal, tick
+			}
+		case NPCBehaviorPatrol:
+			if npc.Path != nil && len(npc.Path.Points) > 0 {
+				goal := npc.Path.Points[npc.pathIndex]
+				npc.goal, npc.goalTick = &goal, tick
+			}
+		}
+	}
+
+	if npc.goal == nil || npc.route == nil {
+		npc.Body.Velocity = vector.Vector{X: 0, Y: 0}
+		if npc.goal != nil && !npc.routing {
+			nm.requestRoute(gameState, npc)
+		}
+		return
+	}
+	if len(npc.route) > 1 && npc.route[0].Sub(npc.Body.Position).Magnitude() <= npcArriveDistance {
+		npc.route = npc.route[1:]
+	}
+	delta := npc.route[0].Sub(npc.Body.Position)
+	if dist := delta.Magnitude(); dist > 0 {
+		velocity := delta.Scale(npc.Def.Speed * gameState.TerrainSpeedAt(npc.Body.Position) / dist)
+		npc.Body.Velocity = nm.avoid(gameState, npc, velocity)
+		npc.Facing = math.Atan2(delta.Y, delta.X)
+	}
+}
+
+// requestRoute queues a path search towards the NPC's goal. The NPC stands still until the
+// pathfinder answers; results for a goal that has since changed are dropped.
+func (nm *NPCManager) requestRoute(gameState *GameMatchState, npc *NPC) {
+	goal := npc.goal
+	npc.routing = true
+	gameState.pathfinder.RequestPath(npc.Body.Position, *goal, func(path []vector.Vector, ok bool) {
+		nm.mu.Lock()
+		defer nm.mu.Unlock()
+		npc.routing = false
+		if npc.goal != goal {
+			return
+		}
+		if !ok {
+			npc.finishGoal(gameState.rng, gameState.currentTick)
+			return
+		}
+		npc.route = path
+	})
+}
+
+// finishGoal clears the reached (or abandoned) goal and moves the behavior on
+func (npc *NPC) finishGoal(rng *rand.Rand, tick int64) {
+	npc.goal = nil
+	npc.route = nil
+	npc.routineGoal, npc.goalSlack = nil, 0
+	if npc.State == NPCStateReturn {
+		// Back home after a fight: the NPC resets to full health
+		npc.State = NPCStateIdle
+		npc.Health = npc.MaxHealth
+		npc.evading = false
+		return
+	}
+	if npc.State != NPCStateIdle {
+		return
+	}
+	if npc.behavior() == NPCBehaviorWander {
+		npc.idleUntil = tick + rng.Int63n(npcWanderPauseTicks+1)
+	}
+	if npc.Path != nil && len(npc.Path.Points) > 1 {
+		npc.advancePath()
+	}
+}
+
+// advancePath moves to the next patrol point: closed paths loop, open paths walk back and forth
+func (npc *NPC) advancePath() {
+	n := len(npc.Path.Points)
+	if npc.Path.Closed {
+		npc.pathIndex = (npc.pathIndex + 1) % n
+		return
+	}
+	if next := npc.pathIndex + npc.pathStep; next < 0 || next >= n {
+		npc.pathStep = -npc.pathStep
+	}
+	npc.pathIndex += npc.pathStep
+}
+
+// Snapshot returns the NPCs for world updates. Pets are sent separately (PetSnapshot).
+func (nm *NPCManager) Snapshot() []NPCData {
+	return nm.AppendSnapshot(make([]NPCData, 0))
+}
+
+// AppendSnapshot appends the snapshot of the NPCs (pets aside) to out and returns it
+func (nm *NPCManager) AppendSnapshot(out []NPCData) []NPCData {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	for _, npc := range nm.live() {
+		if npc.Pet != nil {
+			continue
+		}
+		escorting := ""
+		if npc.Escort != nil {
+			escorting = npc.Escort.PlayerID
+		}
+		out = append(out, NPCData{
+			ID:        npc.ID,
+			Type:      npc.Def.ID,
+			Name:      npc.Def.Name,
+			GID:       npc.Def.GID,
+			Position:  ToPosition(npc.Body.Position),
+			Facing:    npc.Facing,
+			Health:    npc.Health,
+			MaxHealth: npc.MaxHealth,
+			State:     npc.State,
+			OffDuty:   npc.offDuty,
+			Evading:   npc.evading,
+			Escorting: escorting,
+		})
+	}
+	return out
+}
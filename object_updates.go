@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// objectDelta is what changed about one object since it was last sent. Objects sent for the
+// first time carry every field.
+type objectDelta struct {
+	ObjectID     int            `json:"objectId"`
+	GID          *uint32        `json:"gid,omitempty"`
+	Props        map[string]any `json:"props,omitempty"`        // props added or changed
+	RemovedProps []string       `json:"removedProps,omitempty"` // props no longer set
+	Pos          map[string]any `json:"pos,omitempty"`
+}
+
+// sentObject is the state of an object as clients last saw it
+type sentObject struct {
+	gid   uint32
+	props map[string]string // prop -> JSON of its value
+	pos   string            // JSON of the position, "" if it had none
+}
+
+// ObjectUpdateBatcher collects the objects changed during a tick and sends them as one
+// OpCodeObjectUpdate "object_updates" message at the end of it, with only the GIDs and props
+// that changed since each object was last sent. A script touching 50 objects sends one message.
+type ObjectUpdateBatcher struct {
+	logger runtime.Logger
+	dirty  map[int]struct{}
+	sent   map[int]*sentObject
+	mu     sync.Mutex
+}
+
+// NewObjectUpdateBatcher creates an empty batcher
+func NewObjectUpdateBatcher(logger runtime.Logger) *ObjectUpdateBatcher {
+	return &ObjectUpdateBatcher{
+		logger: logger,
+		dirty:  make(map[int]struct{}),
+		sent:   make(map[int]*sentObject),
+	}
+}
+
+// Mark queues an object to be sent at the end of the tick
+func (b *ObjectUpdateBatcher) Mark(oid int) {
+	b.mu.Lock()
+	b.dirty[oid] = struct{}{}
+	b.mu.Unlock()
+}
+
+// Forget drops a removed object, so nothing more is sent for it
+func (b *ObjectUpdateBatcher) Forget(oid int) {
+	b.mu.Lock()
+	delete(b.dirty, oid)
+	delete(b.sent, oid)
+	b.mu.Unlock()
+}
+
+// Flush broadcasts the changes of the objects marked this tick. Called from the match loop.
+func (b *ObjectUpdateBatcher) Flush(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	b.mu.Lock()
+	if len(b.dirty) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	ids := make([]int, 0, len(b.dirty))
+	for oid := range b.dirty {
+		ids = append(ids, oid)
+	}
+	b.dirty = make(map[int]struct{})
+	b.mu.Unlock()
+	sort.Ints(ids)
+
+	deltas := make([]objectDelta, 0, len(ids))
+	for _, oid := range ids {
+		if delta, changed := b.diff(gs, oid); changed {
+			deltas = append(deltas, delta)
+		}
+	}
+	if len(deltas) == 0 || dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeObjectUpdate, "object_updates", map[string]any{"objects": deltas})
+	if err != nil {
+		b.logger.Error("Failed to marshal %d object updates: %v", len(deltas), err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeObjectUpdate, data, nil, nil, true)
+}
+
+// diff compares an object with what was last sent for it and remembers its current state. It
+// reports false if nothing clients see changed, or the object is gone.
+func (b *ObjectUpdateBatcher) diff(gs *GameMatchState, oid int) (objectDelta, bool) {
+	delta := objectDelta{ObjectID: oid}
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	if !ok {
+		gs.mu.Unlock()
+		return delta, false
+	}
+	payload := obj.payload()
+	current := &sentObject{gid: obj.GID, props: make(map[string]string, len(obj.Props))}
+	values := make(map[string]any, len(obj.Props))
+	for key, value := range obj.Props {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			b.logger.Warn("Object %d prop %s can't be sent: %v", oid, key, err)
+			continue
+		}
+		current.props[key] = string(encoded)
+		values[key] = value
+	}
+	gs.mu.Unlock()
+	pos, _ := payload["pos"].(map[string]any)
+	if pos != nil {
+		encoded, _ := json.Marshal(pos)
+		current.pos = string(encoded)
+	}
+
+	b.mu.Lock()
+	last := b.sent[oid]
+	b.sent[oid] = current
+	b.mu.Unlock()
+
+	if last == nil || last.gid != current.gid {
+		gid := current.gid
+		delta.GID = &gid
+	}
+	for key, encoded := range current.props {
+		if last == nil || last.props[key] != encoded {
+			if delta.Props == nil {
+				delta.Props = make(map[string]any)
+			}
+			delta.Props[key] = values[key]
+		}
+	}
+	if last != nil {
+		for key := range last.props {
+			if _, ok := current.props[key]; !ok {
+				delta.RemovedProps = append(delta.RemovedProps, key)
+			}
+		}
+		sort.Strings(delta.RemovedProps)
+	}
+	if pos != nil && (last == nil || last.pos != current.pos) {
+		delta.Pos = pos
+	}
+	changed := delta.GID != nil || delta.Props != nil || delta.RemovedProps != nil || delta.Pos != nil
+	return delta, changed
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"cmp"
+	"iter"
+	"maps"
+	"slices"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+)
+
+// Deterministic iteration. Go randomizes the order maps are ranged over, so whatever depends on
+// that order (physics side effects, RNG draws, the order messages go out or records are saved in)
+// walks the match's players, presences, objects and NPCs in ID order instead: through the sorted
+// ID lists kept next to the maps, or sortedKeys for the rest. The ID lists are copied on write, so
+// a loop over one may add or remove entries; the ones removed meanwhile are skipped.
+
+// sortedKeys returns the keys of a map in ascending order
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	return slices.Sorted(maps.Keys(m))
+}
+
+// withID returns a copy of a sorted ID list with id added
+func withID[K cmp.Ordered](ids []K, id K) []K {
+	i, found := slices.BinarySearch(ids, id)
+	if found {
+		return ids
+	}
+	return slices.Insert(slices.Clip(ids), i, id)
+}
+
+// withoutID returns a copy of a sorted ID list without id
+func withoutID[K cmp.Ordered](ids []K, id K) []K {
+	i, found := slices.BinarySearch(ids, id)
+	if !found {
+		return ids
+	}
+	return slices.Concat(ids[:i], ids[i+1:])
+}
+
+// inOrder ranges over the entries of m whose keys are in ids, in the order of ids
+func inOrder[K comparable, V any](ids []K, m map[K]V) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, id := range ids {
+			if v, ok := m[id]; ok && !yield(id, v) {
+				return
+			}
+		}
+	}
+}
+
+// addPresence adds a connected player (or bot)
+func (gs *GameMatchState) addPresence(presence runtime.Presence) {
+	gs.presences[presence.GetUserId()] = presence
+	gs.presenceOrder = withID(gs.presenceOrder, presence.GetUserId())
+}
+
+// removePresence removes a player (or bot) who left
+func (gs *GameMatchState) removePresence(playerID string) {
+	delete(gs.presences, playerID)
+	gs.presenceOrder = withoutID(gs.presenceOrder, playerID)
+}
+
+// Presences ranges over the connected players (and bots) by ID
+func (gs *GameMatchState) Presences() iter.Seq2[string, runtime.Presence] {
+	return inOrder(gs.presenceOrder, gs.presences)
+}
+
+// PlayerBodies ranges over the players' bodies by player ID
+func (gs *GameMatchState) PlayerBodies() iter.Seq2[string, *rigidbody.RigidBody] {
+	return func(yield func(string, *rigidbody.RigidBody) bool) {
+		for _, playerID := range gs.playerOrder {
+			if rb := gs.PlayerBody(playerID); rb != nil && !yield(playerID, rb) {
+				return
+			}
+		}
+	}
+}
+
+// Objects ranges over the map and runtime objects by ID. The caller holds gs.mu.
+func (gs *GameMatchState) Objects() iter.Seq2[int, *ObjectData] {
+	return func(yield func(int, *ObjectData) bool) {
+		for _, oid := range gs.entities.ObjectIDs() {
+			if obj, ok := gs.Object(oid); ok && !yield(oid, obj) {
+				return
+			}
+		}
+	}
+}
+
+// live ranges over the NPCs and pets by ID. The caller holds nm.mu.
+func (nm *NPCManager) live() iter.Seq2[int, *NPC] {
+	return inOrder(nm.order, nm.npcs)
+}
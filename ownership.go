@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Actions on an owned entity that its permissions control
+const (
+	EntityMove   = "move"   // grab and carry it
+	EntityDamage = "damage" // hurt it (checked by scripts with can_affect_object)
+	EntityRemove = "remove" // take it down
+)
+
+// Who besides the owner may perform an action on an owned entity
+const (
+	EntityAllowOwner    = "owner"    // nobody else
+	EntityAllowGuild    = "guild"    // members of the owner's guild
+	EntityAllowEveryone = "everyone" // every player
+)
+
+// EntityPermissions says who may perform each action on an owned entity. Empty fields mean
+// EntityAllowOwner.
+type EntityPermissions struct {
+	Move   string `json:"move,omitempty"`
+	Damage string `json:"damage,omitempty"`
+	Remove string `json:"remove,omitempty"`
+}
+
+// EntityOwnership is who owns a player-placed entity (buildings, spawned items) and who else
+// may move, damage or remove it. Map objects have none and follow their own rules.
+type EntityOwnership struct {
+	Owner       string            `json:"owner"`
+	Guild       string            `json:"guild,omitempty"` // the owner's guild when the entity was placed
+	Permissions EntityPermissions `json:"permissions"`
+}
+
+// valid reports whether every permission is a known value
+func (p EntityPermissions) valid() bool {
+	for _, allow := range []string{p.Move, p.Damage, p.Remove} {
+		switch allow {
+		case "", EntityAllowOwner, EntityAllowGuild, EntityAllowEveryone:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// allow returns who may perform an action
+func (p EntityPermissions) allow(action string) string {
+	var allow string
+	switch action {
+	case EntityMove:
+		allow = p.Move
+	case EntityDamage:
+		allow = p.Damage
+	case EntityRemove:
+		allow = p.Remove
+	}
+	if allow == "" {
+		return EntityAllowOwner
+	}
+	return allow
+}
+
+// newOwnership returns the ownership of an entity a player places now
+func (gs *GameMatchState) newOwnership(playerID string, permissions EntityPermissions) *EntityOwnership {
+	return &EntityOwnership{Owner: playerID, Guild: gs.guilds.GuildOf(playerID), Permissions: permissions}
+}
+
+// ObjectOwnership returns the ownership of an object, or nil for unowned and unknown objects
+func (gs *GameMatchState) ObjectOwnership(oid int) *EntityOwnership {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if obj, ok := gs.Object(oid); ok {
+		return obj.Ownership
+	}
+	return nil
+}
+
+// CanAffectObject reports whether a player may perform an action on an object. Unowned objects
+// allow everything; owners and GMs may do anything to owned ones.
+func (gs *GameMatchState) CanAffectObject(playerID string, oid int, action string) bool {
+	ownership := gs.ObjectOwnership(oid)
+	if ownership == nil || ownership.Owner == playerID {
+		return true
+	}
+	if roleAllows(gs.GetPlayerState(playerID).Role, RoleGM) {
+		return true
+	}
+	switch ownership.Permissions.allow(action) {
+	case EntityAllowEveryone:
+		return true
+	case EntityAllowGuild:
+		return ownership.Guild != "" && gs.guilds.GuildOf(playerID) == ownership.Guild
+	default:
+		return false
+	}
+}
+
+// RemoveBuilding takes down a building placed outside housing plots, within placeRange, if the
+// player may remove it. Its materials go back to its owner. It returns a rejection reason, or "".
+func (gs *GameMatchState) RemoveBuilding(ctx context.Context, playerID string, oid int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	gs.mu.Unlock()
+	if !ok || obj.Type != buildingObjectType || obj.Ownership == nil {
+		return RejectInvalidTarget
+	}
+	if !gs.CanAffectObject(playerID, oid, EntityRemove) {
+		return RejectPermissionDenied
+	}
+	pos, ok := obj.Position()
+	if !ok || pos.Sub(rb.Position).Magnitude() > placeRange {
+		return RejectOutOfRange
+	}
+
+	gs.RemoveObject(oid, dispatcher, logger)
+	buildableID, _ := obj.Props["buildable"].(string)
+	owner := obj.Ownership.Owner
+	if def, ok := gs.buildableCatalog.Get(buildableID); ok && len(def.Cost) > 0 {
+		for itemID, count := range def.Cost {
+			if err := gs.inventoryManager.Add(ctx, owner, itemID, count); err != nil {
+				logger.Error("Failed to refund %d x %s to %s: %v", count, itemID, owner, err)
+			}
+		}
+		if _, online := gs.presences[owner]; online {
+			gs.inventoryManager.SyncToClient(ctx, gs, owner, dispatcher)
+		}
+	}
+	logger.Info("Player %s removed %s (object %d) of %s", playerID, buildableID, oid, owner)
+	return ""
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Party loot rules: how loot reserved for a party member's kill is shared with the members
+// present at the drop
+const (
+	LootRuleFreeForAll = "free_for_all" // any present member may pick each stack up (default)
+	LootRuleRoundRobin = "round_robin"  // each stack is reserved for the next present member in turn
+	LootRuleNeedGreed  = "need_greed"   // present members roll need, greed or pass for each stack
+)
+
+// Need/greed roll choices
+const (
+	LootChoiceNeed  = "need"
+	LootChoiceGreed = "greed"
+	LootChoicePass  = "pass"
+)
+
+// Party tuning
+const (
+	maxPartySize     = 5
+	partyShareRange  = 1280.0        // px; members this close to a kill, gather or drop share it
+	partyInviteTicks = 60 * TickRate // how long an invite can be accepted
+	lootRollTicks    = 30 * TickRate // how long members have to choose need, greed or pass
+)
+
+// Party is a group of players in a match sharing quest credit and loot. Parties last as long as
+// the match their members play in.
+type Party struct {
+	ID         int
+	Leader     string
+	Members    []string // in joining order
+	LootRule   string
+	nextLooter int // round robin: index into Members of the member whose turn is next
+}
+
+// Has reports whether a player is a member of the party
+func (p *Party) Has(playerID string) bool {
+	return slices.Contains(p.Members, playerID)
+}
+
+// partyInvite is an invitation waiting for its answer
+type partyInvite struct {
+	From    string
+	Expires int64
+}
+
+// LootRoll is a need/greed roll for a stack dropped for a party. The stack isn't in the world
+// until the roll ends; then it drops where it would have, reserved for the winner.
+type LootRoll struct {
+	ID       int
+	PartyID  int
+	Spawn    WorldItemSpawn
+	Eligible []string          // the members present at the drop
+	Choices  map[string]string // player ID -> LootChoice*
+	Expires  int64
+}
+
+// PartyMember is a member in the party state sent to clients
+type PartyMember struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// PartyData is the party state sent to its members; ID 0 and no members means no party
+type PartyData struct {
+	ID       int           `json:"id"`
+	Leader   string        `json:"leader,omitempty"`
+	Members  []PartyMember `json:"members"`
+	LootRule string        `json:"lootRule,omitempty"`
+}
+
+// LootRollResult is one member's answer to a need/greed roll; Roll is 1-100 (0 for pass)
+type LootRollResult struct {
+	PlayerID string `json:"playerId"`
+	Choice   string `json:"choice"`
+	Roll     int    `json:"roll,omitempty"`
+}
+
+// PartyManager tracks the match's parties, pending invites and need/greed rolls. It is only used
+// from the match loop.
+type PartyManager struct {
+	logger   runtime.Logger
+	parties  map[int]*Party
+	memberOf map[string]int         // player ID -> party ID
+	invites  map[string]partyInvite // invited player ID -> invite
+	rolls    map[int]*LootRoll
+	nextID   int
+	nextRoll int
+}
+
+// NewPartyManager creates a party manager without parties
+func NewPartyManager(logger runtime.Logger) *PartyManager {
+	return &PartyManager{
+		logger:   logger,
+		parties:  make(map[int]*Party),
+		memberOf: make(map[string]int),
+		invites:  make(map[string]partyInvite),
+		rolls:    make(map[int]*LootRoll),
+	}
+}
+
+// PartyOf returns a player's party (nil when they aren't in one)
+func (pm *PartyManager) PartyOf(playerID string) *Party {
+	return pm.parties[pm.memberOf[playerID]]
+}
+
+// InParty reports whether a player is a member of the party partyID
+func (pm *PartyManager) InParty(partyID int, playerID string) bool {
+	return partyID != 0 && pm.memberOf[playerID] == partyID
+}
+
+// NearbyMembers returns the other members of a player's party whose bodies are within
+// partyShareRange of a position, in joining order
+func (pm *PartyManager) NearbyMembers(gs *GameMatchState, playerID string, position vector.Vector) []string {
+	party := pm.PartyOf(playerID)
+	if party == nil {
+		return nil
+	}
+	var nearby []string
+	for _, memberID := range party.Members {
+		if memberID == playerID {
+			continue
+		}
+		if rb := gs.PlayerBody(memberID); rb != nil && rb.Position.Sub(position).Magnitude() <= partyShareRange {
+			nearby = append(nearby, memberID)
+		}
+	}
+	return nearby
+}
+
+// Invite invites a player to the inviter's party (a new one if the inviter has none). Only the
+// leader invites. It returns a rejection reason, or "".
+func (pm *PartyManager) Invite(gs *GameMatchState, playerID, targetID string, dispatcher runtime.MatchDispatcher) string {
+	if targetID == playerID || gs.PlayerBody(targetID) == nil {
+		return RejectInvalidTarget
+	}
+	if pm.PartyOf(targetID) != nil {
+		return RejectInParty
+	}
+	if party := pm.PartyOf(playerID); party != nil {
+		if party.Leader != playerID {
+			return RejectPermissionDenied
+		}
+		if len(party.Members) >= maxPartySize {
+			return RejectPartyFull
+		}
+	}
+	pm.invites[targetID] = partyInvite{From: playerID, Expires: gs.currentTick + partyInviteTicks}
+	pm.send(gs, "party_invite", map[string]any{"from": playerID, "name": gs.usernameOf(playerID)}, []string{targetID}, dispatcher)
+	return ""
+}
+
+// Accept answers an invite from the player inviterID: the player joins the inviter's party,
+// which is created if the inviter had none. It returns a rejection reason, or "".
+func (pm *PartyManager) Accept(gs *GameMatchState, playerID, inviterID string, dispatcher runtime.MatchDispatcher) string {
+	invite, ok := pm.invites[playerID]
+	if !ok || invite.From != inviterID || gs.currentTick >= invite.Expires || gs.PlayerBody(inviterID) == nil {
+		return RejectNoRequest
+	}
+	if pm.PartyOf(playerID) != nil {
+		return RejectInParty
+	}
+	party := pm.PartyOf(inviterID)
+	if party == nil {
+		pm.nextID++
+		party = &Party{ID: pm.nextID, Leader: inviterID, Members: []string{inviterID}, LootRule: LootRuleFreeForAll}
+		pm.parties[party.ID] = party
+		pm.memberOf[inviterID] = party.ID
+	} else if party.Leader != inviterID {
+		return RejectNoRequest
+	}
+	if len(party.Members) >= maxPartySize {
+		return RejectPartyFull
+	}
+	delete(pm.invites, playerID)
+	party.Members = append(party.Members, playerID)
+	pm.memberOf[playerID] = party.ID
+	pm.logger.Info("Player %s joined party %d of %s", playerID, party.ID, party.Leader)
+	pm.sync(gs, party, dispatcher)
+	return ""
+}
+
+// Decline turns an invite from inviterID down. It returns a rejection reason, or "".
+func (pm *PartyManager) Decline(gs *GameMatchState, playerID, inviterID string, dispatcher runtime.MatchDispatcher) string {
+	invite, ok := pm.invites[playerID]
+	if !ok || invite.From != inviterID {
+		return RejectNoRequest
+	}
+	delete(pm.invites, playerID)
+	pm.send(gs, "party_declined", map[string]any{"playerId": playerID, "name": gs.usernameOf(playerID)}, []string{inviterID}, dispatcher)
+	return ""
+}
+
+// Leave takes a player out of their party. The next member leads when the leader leaves, and a
+// party of one is disbanded. It returns a rejection reason, or "".
+func (pm *PartyManager) Leave(gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) string {
+	party := pm.PartyOf(playerID)
+	if party == nil {
+		return RejectNotInParty
+	}
+	pm.remove(gs, party, playerID, dispatcher)
+	return ""
+}
+
+// Kick lets the leader take a member out of the party. It returns a rejection reason, or "".
+func (pm *PartyManager) Kick(gs *GameMatchState, playerID, targetID string, dispatcher runtime.MatchDispatcher) string {
+	party := pm.PartyOf(playerID)
+	if party == nil {
+		return RejectNotInParty
+	}
+	if party.Leader != playerID {
+		return RejectPermissionDenied
+	}
+	if targetID == playerID || !party.Has(targetID) {
+		return RejectInvalidTarget
+	}
+	pm.remove(gs, party, targetID, dispatcher)
+	return ""
+}
+
+// SetLootRule lets the leader choose how the party shares loot. It returns a rejection reason, or "".
+func (pm *PartyManager) SetLootRule(gs *GameMatchState, playerID, rule string, dispatcher runtime.MatchDispatcher) string {
+	party := pm.PartyOf(playerID)
+	if party == nil {
+		return RejectNotInParty
+	}
+	if party.Leader != playerID {
+		return RejectPermissionDenied
+	}
+	switch rule {
+	case LootRuleFreeForAll, LootRuleRoundRobin, LootRuleNeedGreed:
+	default:
+		return RejectInvalidChoice
+	}
+	party.LootRule = rule
+	pm.sync(gs, party, dispatcher)
+	return ""
+}
+
+// RemovePlayer takes a leaving player out of their party, their invites and the rolls they
+// haven't answered
+func (pm *PartyManager) RemovePlayer(gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	delete(pm.invites, playerID)
+	for invitee, invite := range pm.invites {
+		if invite.From == playerID {
+			delete(pm.invites, invitee)
+		}
+	}
+	if party := pm.PartyOf(playerID); party != nil {
+		pm.remove(gs, party, playerID, dispatcher)
+	}
+}
+
+// remove takes a member out of a party
+func (pm *PartyManager) remove(gs *GameMatchState, party *Party, playerID string, dispatcher runtime.MatchDispatcher) {
+	i := slices.Index(party.Members, playerID)
+	party.Members = slices.Delete(party.Members, i, i+1)
+	delete(pm.memberOf, playerID)
+	if party.nextLooter > i {
+		party.nextLooter--
+	}
+	for _, roll := range pm.rolls {
+		if roll.PartyID == party.ID {
+			roll.Eligible = slices.DeleteFunc(roll.Eligible, func(id string) bool { return id == playerID })
+		}
+	}
+	pm.send(gs, "party", PartyData{Members: []PartyMember{}}, []string{playerID}, dispatcher)
+	pm.logger.Info("Player %s left party %d", playerID, party.ID)
+
+	if len(party.Members) <= 1 {
+		for _, memberID := range party.Members {
+			delete(pm.memberOf, memberID)
+			pm.send(gs, "party", PartyData{Members: []PartyMember{}}, []string{memberID}, dispatcher)
+		}
+		delete(pm.parties, party.ID)
+		for _, roll := range pm.rolls {
+			if roll.PartyID == party.ID {
+				roll.PartyID = 0
+			}
+		}
+		return
+	}
+	if party.Leader == playerID {
+		party.Leader = party.Members[0]
+	}
+	pm.sync(gs, party, dispatcher)
+}
+
+// ShareLoot places loot dropped for a party member's kill following the party's loot rule, when
+// another member is within partyShareRange of the drop. It returns the IDs of the stacks it
+// spawned (need/greed stacks spawn when their roll ends) and false if the loot isn't shared.
+func (pm *PartyManager) ShareLoot(gs *GameMatchState, owner string, position vector.Vector, spawns []WorldItemSpawn, dispatcher runtime.MatchDispatcher) ([]int, bool) {
+	party := pm.PartyOf(owner)
+	if party == nil {
+		return nil, false
+	}
+	present := append([]string{owner}, pm.NearbyMembers(gs, owner, position)...)
+	if len(present) < 2 {
+		return nil, false
+	}
+
+	ids := make([]int, 0, len(spawns))
+	for _, spawn := range spawns {
+		switch party.LootRule {
+		case LootRuleRoundRobin:
+			spawn.Owner = pm.nextLooter(party, present)
+			ids = append(ids, gs.worldItems.spawn(gs, spawn, dispatcher))
+		case LootRuleNeedGreed:
+			pm.startRoll(gs, party, present, spawn, dispatcher)
+		default:
+			spawn.PartyID = party.ID
+			ids = append(ids, gs.worldItems.spawn(gs, spawn, dispatcher))
+		}
+	}
+	return ids, true
+}
+
+// nextLooter returns the present member whose round robin turn is next, and moves the turn on
+func (pm *PartyManager) nextLooter(party *Party, present []string) string {
+	for range party.Members {
+		memberID := party.Members[party.nextLooter%len(party.Members)]
+		party.nextLooter = (party.nextLooter + 1) % len(party.Members)
+		if slices.Contains(present, memberID) {
+			return memberID
+		}
+	}
+	return present[0]
+}
+
+// startRoll holds a stack back and asks the present members to roll for it
+func (pm *PartyManager) startRoll(gs *GameMatchState, party *Party, present []string, spawn WorldItemSpawn, dispatcher runtime.MatchDispatcher) {
+	pm.nextRoll++
+	roll := &LootRoll{
+		ID:       pm.nextRoll,
+		PartyID:  party.ID,
+		Spawn:    spawn,
+		Eligible: slices.Clone(present),
+		Choices:  make(map[string]string),
+		Expires:  gs.currentTick + lootRollTicks,
+	}
+	pm.rolls[roll.ID] = roll
+	pm.send(gs, "loot_roll", map[string]any{
+		"rollId":  roll.ID,
+		"itemId":  spawn.ItemID,
+		"count":   spawn.Count,
+		"x":       spawn.Position.X,
+		"y":       spawn.Position.Y,
+		"seconds": lootRollTicks / TickRate,
+	}, roll.Eligible, dispatcher)
+}
+
+// Choose records a member's need, greed or pass for a roll. The roll ends once every present
+// member chose. It returns a rejection reason, or "".
+func (pm *PartyManager) Choose(gs *GameMatchState, playerID string, rollID int, choice string, dispatcher runtime.MatchDispatcher) string {
+	roll, ok := pm.rolls[rollID]
+	if !ok || !slices.Contains(roll.Eligible, playerID) {
+		return RejectUnknownRoll
+	}
+	switch choice {
+	case LootChoiceNeed, LootChoiceGreed, LootChoicePass:
+	default:
+		return RejectInvalidChoice
+	}
+	if _, chosen := roll.Choices[playerID]; chosen {
+		return RejectDuplicate
+	}
+	roll.Choices[playerID] = choice
+	if len(roll.Choices) >= len(roll.Eligible) {
+		pm.resolve(gs, roll, dispatcher)
+	}
+	return ""
+}
+
+// Update expires invites and ends the rolls whose time is up; members who didn't choose pass.
+// Called from the match loop.
+func (pm *PartyManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	for invitee, invite := range pm.invites {
+		if gs.currentTick >= invite.Expires {
+			delete(pm.invites, invitee)
+		}
+	}
+	for _, id := range sortedKeys(pm.rolls) {
+		if roll := pm.rolls[id]; gs.currentTick >= roll.Expires || len(roll.Choices) >= len(roll.Eligible) {
+			pm.resolve(gs, roll, dispatcher)
+		}
+	}
+}
+
+// resolve ends a need/greed roll: need beats greed, then the higher 1-100 roll wins (the audited
+// roll is drawn for the members in ID order). The stack drops reserved for the winner, or free
+// for anyone when everyone passed.
+func (pm *PartyManager) resolve(gs *GameMatchState, roll *LootRoll, dispatcher runtime.MatchDispatcher) {
+	winner, results := pm.decide(gs, roll)
+	spawn := roll.Spawn
+	spawn.Owner = winner
+	oid := gs.worldItems.spawn(gs, spawn, dispatcher)
+	pm.logger.Info("Loot roll %d for %d x %s won by %q (object %d)", roll.ID, spawn.Count, spawn.ItemID, winner, oid)
+	pm.sendResult(gs, roll, winner, oid, results, dispatcher)
+}
+
+// ResolveRolls ends the rolls still open when the match ends, with the choices made so far. The
+// world the stacks would drop in is going away, so each winner gets theirs straight into their
+// inventory, or as a reward claim when they already left (objectId 0 in loot_roll_result); a
+// stack everyone passed on, or that can't be given, drops as usual and is kept by the final save
+// where the match saves its world. Called from MatchTerminate before that save.
+func (pm *PartyManager) ResolveRolls(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	for _, id := range sortedKeys(pm.rolls) {
+		roll := pm.rolls[id]
+		winner, results := pm.decide(gs, roll)
+		spawn := roll.Spawn
+		spawn.Owner = winner
+		oid := 0
+		if winner == "" {
+			oid = gs.worldItems.spawn(gs, spawn, dispatcher)
+		} else if _, err := gs.giveRewardItems(ctx, winner, gs.journal.UniqueKey("loot_roll", roll.ID), "loot_roll", []LootStack{{ItemID: spawn.ItemID, Count: spawn.Count}}); err != nil {
+			pm.logger.Error("Failed to give %d x %s of loot roll %d to %s: %v", spawn.Count, spawn.ItemID, roll.ID, winner, err)
+			oid = gs.worldItems.spawn(gs, spawn, dispatcher)
+		}
+		pm.logger.Info("Loot roll %d for %d x %s ended with the match, won by %q (object %d)", roll.ID, spawn.Count, spawn.ItemID, winner, oid)
+		pm.sendResult(gs, roll, winner, oid, results, dispatcher)
+	}
+}
+
+// decide ends a roll and draws its outcome: the winner ("" when everyone passed) and each
+// member's result
+func (pm *PartyManager) decide(gs *GameMatchState, roll *LootRoll) (string, []LootRollResult) {
+	delete(pm.rolls, roll.ID)
+
+	players := slices.Clone(roll.Eligible)
+	slices.Sort(players)
+	audit := gs.random.Roll(gs, RollNeedGreed, "", map[string]any{"item": roll.Spawn.ItemID, "count": roll.Spawn.Count, "choices": roll.Choices})
+	results := make([]LootRollResult, 0, len(players))
+	winner, best := "", LootRollResult{}
+	for _, playerID := range players {
+		result := LootRollResult{PlayerID: playerID, Choice: roll.Choices[playerID]}
+		if result.Choice == "" {
+			result.Choice = LootChoicePass
+		}
+		if result.Choice != LootChoicePass {
+			result.Roll = audit.Intn(100) + 1
+			if winner == "" || (result.Choice == LootChoiceNeed && best.Choice == LootChoiceGreed) ||
+				(result.Choice == best.Choice && result.Roll > best.Roll) {
+				winner, best = playerID, result
+			}
+		}
+		results = append(results, result)
+	}
+	gs.random.Record(audit, map[string]any{"rolls": results, "winner": winner})
+	return winner, results
+}
+
+// sendResult tells the members who could roll how a roll ended
+func (pm *PartyManager) sendResult(gs *GameMatchState, roll *LootRoll, winner string, oid int, results []LootRollResult, dispatcher runtime.MatchDispatcher) {
+	pm.send(gs, "loot_roll_result", map[string]any{
+		"rollId":   roll.ID,
+		"itemId":   roll.Spawn.ItemID,
+		"count":    roll.Spawn.Count,
+		"winner":   winner,
+		"objectId": oid,
+		"rolls":    results,
+	}, roll.Eligible, dispatcher)
+}
+
+// sync sends the party state to its members
+func (pm *PartyManager) sync(gs *GameMatchState, party *Party, dispatcher runtime.MatchDispatcher) {
+	data := PartyData{ID: party.ID, Leader: party.Leader, LootRule: party.LootRule, Members: make([]PartyMember, 0, len(party.Members))}
+	for _, memberID := range party.Members {
+		data.Members = append(data.Members, PartyMember{ID: memberID, Name: gs.usernameOf(memberID)})
+	}
+	pm.send(gs, "party", data, party.Members, dispatcher)
+}
+
+// send delivers a party message to the given players that are online
+func (pm *PartyManager) send(gs *GameMatchState, msgType string, payload any, playerIDs []string, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	presences := make([]runtime.Presence, 0, len(playerIDs))
+	for _, id := range playerIDs {
+		if presence, ok := gs.presences[id]; ok {
+			presences = append(presences, presence)
+		}
+	}
+	if len(presences) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeParty, msgType, payload)
+	if err != nil {
+		pm.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeParty, data, presences, nil, true)
+}
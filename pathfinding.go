@@ -0,0 +1,325 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"strings"
+
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Pathfinding tuning
+const (
+	navCellSize         = TileSize // nav grid resolution (pixels per cell)
+	pathBudgetPerTick   = 4000     // A* node expansions spent on queued requests per tick
+	maxPathSearchNodes  = 2000     // expansions after which a single search gives up
+	pathGoalSearchCells = 2        // how far (cells) a blocked goal is moved to the nearest walkable cell
+	pathClearance       = 8.0      // half-width (pixels) kept clear of walls when smoothing corners
+)
+
+// NavGrid is the walkability grid derived from static colliders. A cell is blocked when any
+// static collider's bounding box overlaps it.
+type NavGrid struct {
+	Width    int
+	Height   int
+	CellSize float64
+	blocked  []bool
+}
+
+// PathRequest is a queued path search; Done is called from Pathfinder.Update with the result
+type PathRequest struct {
+	From vector.Vector
+	To   vector.Vector
+	Done func(path []vector.Vector, ok bool)
+}
+
+// Pathfinder owns the nav grid and serves path requests within a per-tick budget
+type Pathfinder struct {
+	grid  *NavGrid
+	dirty bool // static colliders changed; the grid is rebuilt before the next search
+	queue []*PathRequest
+	spent int // expansions used this tick (synchronous searches count too)
+}
+
+// NewPathfinder creates a pathfinder; the grid is built on first use
+func NewPathfinder() *Pathfinder {
+	return &Pathfinder{dirty: true}
+}
+
+// Invalidate marks the grid stale after static colliders were added or removed
+func (pf *Pathfinder) Invalidate() {
+	pf.dirty = true
+}
+
+// rebuild rasterizes the static colliders of the current map into the grid
+func (pf *Pathfinder) rebuild(gs *GameMatchState) {
+	pf.dirty = false
+	if gs.currentMap == nil {
+		pf.grid = nil
+		return
+	}
+	grid := &NavGrid{
+		Width:    int(math.Ceil(float64(gs.currentMap.Width*gs.currentMap.TileWidth) / navCellSize)),
+		Height:   int(math.Ceil(float64(gs.currentMap.Height*gs.currentMap.TileHeight) / navCellSize)),
+		CellSize: navCellSize,
+	}
+	grid.blocked = make([]bool, grid.Width*grid.Height)
+
+	gs.mu.Lock()
+	for _, rb := range gs.gameObjects {
+		if rb.IsMovable || !gs.physicsEngine.CollisionsEnabled(rb) || gs.physicsEngine.Attached(rb) {
+			continue
+		}
+		halfW, halfH := rb.Width/2, rb.Height/2
+		if strings.ToLower(rb.Shape) == "circle" {
+			halfW, halfH = rb.Radius, rb.Radius
+		}
+		// Shrink slightly so colliders that only touch a cell edge don't block it
+		minX, minY := grid.cellAt(vector.Vector{X: rb.Position.X - halfW + 0.5, Y: rb.Position.Y - halfH + 0.5})
+		maxX, maxY := grid.cellAt(vector.Vector{X: rb.Position.X + halfW - 0.5, Y: rb.Position.Y + halfH - 0.5})
+		for y := minY; y <= maxY; y++ {
+			for x := minX; x <= maxX; x++ {
+				if x >= 0 && y >= 0 && x < grid.Width && y < grid.Height {
+					grid.blocked[y*grid.Width+x] = true
+				}
+			}
+		}
+	}
+	gs.mu.Unlock()
+	pf.grid = grid
+}
+
+// cellAt returns the cell containing a world position
+func (g *NavGrid) cellAt(p vector.Vector) (int, int) {
+	return int(math.Floor(p.X / g.CellSize)), int(math.Floor(p.Y / g.CellSize))
+}
+
+// center returns the world position of a cell's center
+func (g *NavGrid) center(x, y int) vector.Vector {
+	return vector.Vector{X: (float64(x) + 0.5) * g.CellSize, Y: (float64(y) + 0.5) * g.CellSize}
+}
+
+// Walkable reports whether a cell is inside the grid and not blocked
+func (g *NavGrid) Walkable(x, y int) bool {
+	return x >= 0 && y >= 0 && x < g.Width && y < g.Height && !g.blocked[y*g.Width+x]
+}
+
+// WalkableAt reports whether a world position lies in a walkable cell
+func (g *NavGrid) WalkableAt(p vector.Vector) bool {
+	return g.Walkable(g.cellAt(p))
+}
+
+// lineWalkable reports whether a body of the given half-width can move straight from a to b
+// without entering a blocked cell
+func (g *NavGrid) lineWalkable(a, b vector.Vector, clearance float64) bool {
+	delta := b.Sub(a)
+	dist := delta.Magnitude()
+	if dist == 0 {
+		return g.WalkableAt(a)
+	}
+	dir := delta.Scale(1 / dist)
+	side := vector.Vector{X: -dir.Y * clearance, Y: dir.X * clearance}
+	step := g.CellSize / 4
+	for t := 0.0; t <= dist+step; t += step {
+		p := a.Add(dir.Scale(min(t, dist)))
+		if !g.WalkableAt(p) || !g.WalkableAt(p.Add(side)) || !g.WalkableAt(p.Sub(side)) {
+			return false
+		}
+	}
+	return true
+}
+
+// nearestWalkable returns the walkable cell closest to (x, y) within radius cells
+func (g *NavGrid) nearestWalkable(x, y, radius int) (int, int, bool) {
+	if g.Walkable(x, y) {
+		return x, y, true
+	}
+	for r := 1; r <= radius; r++ {
+		for dy := -r; dy <= r; dy++ {
+			for dx := -r; dx <= r; dx++ {
+				if (dx == -r || dx == r || dy == -r || dy == r) && g.Walkable(x+dx, y+dy) {
+					return x + dx, y + dy, true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// WalkableAt reports whether a world position lies in a walkable cell of the current grid
+func (pf *Pathfinder) WalkableAt(gs *GameMatchState, p vector.Vector) bool {
+	grid := pf.Grid(gs)
+	return grid != nil && grid.WalkableAt(p)
+}
+
+// Grid returns the current nav grid, rebuilding it if static colliders changed (nil without a map)
+func (pf *Pathfinder) Grid(gs *GameMatchState) *NavGrid {
+	if pf.dirty || pf.grid == nil {
+		pf.rebuild(gs)
+	}
+	return pf.grid
+}
+
+// RequestPath queues a search that runs within the per-tick budget
+func (pf *Pathfinder) RequestPath(from, to vector.Vector, done func(path []vector.Vector, ok bool)) {
+	pf.queue = append(pf.queue, &PathRequest{From: from, To: to, Done: done})
+}
+
+// Update serves queued requests until this tick's budget is spent. Called from the match loop.
+func (pf *Pathfinder) Update(gs *GameMatchState) {
+	for len(pf.queue) > 0 && pf.spent < pathBudgetPerTick {
+		req := pf.queue[0]
+		pf.queue = pf.queue[1:]
+		path, ok := pf.PathFind(gs, req.From, req.To)
+		req.Done(path, ok)
+	}
+	pf.spent = 0
+}
+
+// PathFind returns a smoothed list of waypoints from -> to (excluding from, ending at to) over
+// the nav grid, or false if no path was found within maxPathSearchNodes expansions
+func (pf *Pathfinder) PathFind(gs *GameMatchState, from, to vector.Vector) ([]vector.Vector, bool) {
+	if pf.dirty || pf.grid == nil {
+		pf.rebuild(gs)
+	}
+	g := pf.grid
+	if g == nil {
+		return nil, false
+	}
+
+	sx, sy := g.cellAt(from)
+	if sx < 0 || sy < 0 || sx >= g.Width || sy >= g.Height {
+		return nil, false
+	}
+	cx, cy := g.cellAt(to)
+	gx, gy, ok := g.nearestWalkable(cx, cy, pathGoalSearchCells)
+	if !ok {
+		return nil, false
+	}
+	// The goal cell moved if the requested point was blocked; end at the cell center instead
+	goal := to
+	if cx != gx || cy != gy {
+		goal = g.center(gx, gy)
+	}
+	if sx == gx && sy == gy {
+		return []vector.Vector{goal}, true
+	}
+
+	cells, expanded, found := g.astar(sx, sy, gx, gy)
+	pf.spent += expanded
+	if !found {
+		return nil, false
+	}
+
+	points := make([]vector.Vector, 0, len(cells))
+	for _, c := range cells[:len(cells)-1] {
+		points = append(points, g.center(c[0], c[1]))
+	}
+	points = append(points, goal)
+	return g.smooth(from, points), true
+}
+
+// smooth drops waypoints that can be skipped by walking straight to a later one
+func (g *NavGrid) smooth(from vector.Vector, points []vector.Vector) []vector.Vector {
+	out := make([]vector.Vector, 0, len(points))
+	anchor := from
+	for i := 0; i < len(points); {
+		next := i
+		for j := len(points) - 1; j > i; j-- {
+			if g.lineWalkable(anchor, points[j], pathClearance) {
+				next = j
+				break
+			}
+		}
+		out = append(out, points[next])
+		anchor = points[next]
+		i = next + 1
+	}
+	return out
+}
+
+// astar searches the grid with 8-way movement (no corner cutting) and returns the cells from
+// start (exclusive) to goal (inclusive), the number of expanded nodes and whether goal was reached
+func (g *NavGrid) astar(sx, sy, gx, gy int) ([][2]int, int, bool) {
+	start := sy*g.Width + sx
+	target := gy*g.Width + gx
+	heuristic := func(idx int) float64 {
+		dx := math.Abs(float64(idx%g.Width - gx))
+		dy := math.Abs(float64(idx/g.Width - gy))
+		return dx + dy + (math.Sqrt2-2)*math.Min(dx, dy)
+	}
+
+	cost := map[int]float64{start: 0}
+	parent := map[int]int{}
+	closed := map[int]bool{}
+	open := &pathQueue{{idx: start, f: heuristic(start)}}
+	expanded := 0
+
+	for open.Len() > 0 && expanded < maxPathSearchNodes {
+		cur := heap.Pop(open).(pathNode).idx
+		if closed[cur] {
+			continue
+		}
+		if cur == target {
+			var cells [][2]int
+			for n := cur; n != start; n = parent[n] {
+				cells = append(cells, [2]int{n % g.Width, n / g.Width})
+			}
+			for i, j := 0, len(cells)-1; i < j; i, j = i+1, j-1 {
+				cells[i], cells[j] = cells[j], cells[i]
+			}
+			return cells, expanded, true
+		}
+		closed[cur] = true
+		expanded++
+
+		cx, cy := cur%g.Width, cur/g.Width
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if dx == 0 && dy == 0 || !g.Walkable(cx+dx, cy+dy) {
+					continue
+				}
+				step := 1.0
+				if dx != 0 && dy != 0 {
+					// Diagonals may not squeeze between two blocked cells
+					if !g.Walkable(cx+dx, cy) || !g.Walkable(cx, cy+dy) {
+						continue
+					}
+					step = math.Sqrt2
+				}
+				next := (cy+dy)*g.Width + cx + dx
+				if closed[next] {
+					continue
+				}
+				c := cost[cur] + step
+				if old, seen := cost[next]; seen && old <= c {
+					continue
+				}
+				cost[next] = c
+				parent[next] = cur
+				heap.Push(open, pathNode{idx: next, f: c + heuristic(next)})
+			}
+		}
+	}
+	return nil, expanded, false
+}
+
+// pathNode is an open-set entry of the A* search
+type pathNode struct {
+	idx int
+	f   float64
+}
+
+// pathQueue is a min-heap of open nodes ordered by f
+type pathQueue []pathNode
+
+func (q pathQueue) Len() int           { return len(q) }
+func (q pathQueue) Less(i, j int) bool { return q[i].f < q[j].f }
+func (q pathQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x any)        { *q = append(*q, x.(pathNode)) }
+func (q *pathQueue) Pop() any {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
@@ -0,0 +1,641 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// PersistenceStore is where DatabaseManager keeps its records: objects of a collection, owned by
+// a user ("" for the system user) and addressed by key. Writes and deletes follow Nakama's
+// version rules: "" writes unconditionally, "*" only creates, any other version must match the
+// stored one.
+type PersistenceStore interface {
+	Read(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error)
+	Write(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error)
+	Delete(ctx context.Context, deletes []*runtime.StorageDelete) error
+	// List returns a page of a collection, by owner and key, and the cursor of the next page (""
+	// after the last one). An empty userID lists the objects of every owner.
+	List(ctx context.Context, userID, collection string, limit int, cursor string) ([]*api.StorageObject, string, error)
+	// Query returns the objects of a collection (of every owner) that match filter, in pages like
+	// List. A page may hold more than limit objects.
+	Query(ctx context.Context, collection string, filter StoreFilter, limit int, cursor string) ([]*api.StorageObject, string, error)
+	// MultiUpdate applies writes, deletes and wallet updates together: all of them or none
+	MultiUpdate(ctx context.Context, writes []*runtime.StorageWrite, deletes []*runtime.StorageDelete, wallets []*runtime.WalletUpdate) error
+}
+
+// StoreFilter selects objects by a string field of their JSON value: those whose field is Equals,
+// or, with Before set, those whose field sorts before it (UTC RFC 3339 timestamps sort in time
+// order)
+type StoreFilter struct {
+	Field  string
+	Equals string
+	Before string
+}
+
+// matches tells whether an object's value passes the filter
+func (f StoreFilter) matches(value string) bool {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return false
+	}
+	field, ok := fields[f.Field].(string)
+	if !ok {
+		return false
+	}
+	if f.Before != "" {
+		return field < f.Before
+	}
+	return field == f.Equals
+}
+
+// persistence is the module's store, set up by InitModule from the runtime env. Managers created
+// before that (or without it) use Nakama storage.
+var persistence PersistenceStore
+
+// storeFor returns the module's store, or Nakama storage when there is none
+func storeFor(nk runtime.NakamaModule) PersistenceStore {
+	if persistence != nil {
+		return persistence
+	}
+	return NewNakamaStore(nk)
+}
+
+// NakamaStore keeps records in Nakama storage objects, JSON blobs in Nakama's own table
+type NakamaStore struct {
+	nk runtime.NakamaModule
+}
+
+// NewNakamaStore creates a store on Nakama storage
+func NewNakamaStore(nk runtime.NakamaModule) *NakamaStore {
+	return &NakamaStore{nk: nk}
+}
+
+func (s *NakamaStore) Read(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	return s.nk.StorageRead(ctx, reads)
+}
+
+func (s *NakamaStore) Write(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	return s.nk.StorageWrite(ctx, writes)
+}
+
+func (s *NakamaStore) Delete(ctx context.Context, deletes []*runtime.StorageDelete) error {
+	return s.nk.StorageDelete(ctx, deletes)
+}
+
+func (s *NakamaStore) List(ctx context.Context, userID, collection string, limit int, cursor string) ([]*api.StorageObject, string, error) {
+	return s.nk.StorageList(ctx, "", userID, collection, limit, cursor)
+}
+
+// Query filters the pages of a listing, as Nakama storage can't look into values
+func (s *NakamaStore) Query(ctx context.Context, collection string, filter StoreFilter, limit int, cursor string) ([]*api.StorageObject, string, error) {
+	var matched []*api.StorageObject
+	for {
+		objects, next, err := s.nk.StorageList(ctx, "", "", collection, limit, cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, obj := range objects {
+			if filter.matches(obj.GetValue()) {
+				matched = append(matched, obj)
+			}
+		}
+		cursor = next
+		if next == "" || len(matched) >= limit {
+			return matched, cursor, nil
+		}
+	}
+}
+
+func (s *NakamaStore) MultiUpdate(ctx context.Context, writes []*runtime.StorageWrite, deletes []*runtime.StorageDelete, wallets []*runtime.WalletUpdate) error {
+	_, _, err := s.nk.MultiUpdate(ctx, nil, writes, deletes, wallets, true)
+	return err
+}
+
+// errVersionMismatch is returned when a write or delete's version doesn't match the stored one
+var errVersionMismatch = errors.New("storage version check failed")
+
+// errMixedUpdate is returned for a MultiUpdate of SQL records together with records of the
+// fallback store, which no transaction covers
+var errMixedUpdate = errors.New("update spans SQL and Nakama storage")
+
+// errWalletNegative is returned for a wallet update that would leave a balance below zero
+var errWalletNegative = errors.New("wallet update leaves a negative balance")
+
+// sqlTableIndexes are the indexes the SQL store creates on the table of a collection besides its
+// (user_id, key) primary key, so queries and reports on its JSON fields don't scan the table.
+// Query looks up the JSON fields indexed here.
+var sqlTableIndexes = map[string][]string{
+	COLLECTION_AUCTIONS:       {"(value->>'itemId')", "(value->>'sellerId')", "(value->>'expiresAt')"},
+	COLLECTION_ADMIN_LOG:      {"(value->>'actorId')", "(value->>'action')"},
+	COLLECTION_RNG_AUDIT:      {"(update_time)"},
+	COLLECTION_CHEAT_REPORTS:  {"(update_time)"},
+	COLLECTION_MODERATION:     {"(update_time)"},
+	COLLECTION_ACTION_JOURNAL: {"(update_time)"},
+}
+
+// sqlCommittedTogether are collections whose records are committed in one MultiUpdate: keeping
+// one of them in SQL keeps the others there too. An auction sale commits the trade's journal
+// records with its claims.
+var sqlCommittedTogether = [][]string{
+	{COLLECTION_AUCTIONS, COLLECTION_AUCTION_CLAIMS, COLLECTION_ACTION_JOURNAL, COLLECTION_JOURNAL_OUTCOMES},
+	{COLLECTION_INVENTORY, COLLECTION_WORLD_ITEMS},
+}
+
+// SQLStore keeps the collections it was set up with in tables of their own, one row per object
+// with a JSONB value and indexes on the fields it is looked up by, through the database handle
+// Nakama gives the module. Other collections go to the fallback store. Versions are the MD5 of
+// the value, as in Nakama storage. A table starts as a copy of the collection in the fallback
+// store, so moving a collection to SQL keeps its records.
+type SQLStore struct {
+	db       *sql.DB
+	tables   map[string]string // collection -> table
+	fallback PersistenceStore
+}
+
+// sqlIdentifier matches the collection names the SQL store makes tables for
+var sqlIdentifier = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// sqlTable is the table of a collection
+func sqlTable(collection string) string {
+	return "wildspark_" + collection
+}
+
+// NewSQLStore creates a store keeping the collections in tables (created when missing), and the
+// others in the fallback store
+func NewSQLStore(ctx context.Context, db *sql.DB, collections []string, fallback PersistenceStore) (*SQLStore, error) {
+	s := &SQLStore{db: db, tables: make(map[string]string, len(collections)), fallback: fallback}
+	for _, collection := range collections {
+		// Table names can't be query parameters
+		if !sqlIdentifier.MatchString(collection) {
+			return nil, fmt.Errorf("collection %q can't be a table name", collection)
+		}
+		table := sqlTable(collection)
+		statements := []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			user_id     TEXT        NOT NULL,
+			key         TEXT        NOT NULL,
+			value       JSONB       NOT NULL,
+			version     TEXT        NOT NULL,
+			read        SMALLINT    NOT NULL DEFAULT 0,
+			write       SMALLINT    NOT NULL DEFAULT 0,
+			create_time TIMESTAMPTZ NOT NULL DEFAULT now(),
+			update_time TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (user_id, key)
+		)`, table)}
+		for i, index := range sqlTableIndexes[collection] {
+			statements = append(statements, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_idx%d ON %s (%s)", table, i, table, index))
+		}
+		for _, statement := range statements {
+			if _, err := db.ExecContext(ctx, statement); err != nil {
+				return nil, fmt.Errorf("set up table %s: %w", table, err)
+			}
+		}
+		if err := s.copyFallback(ctx, collection, table); err != nil {
+			return nil, fmt.Errorf("copy %s into table %s: %w", collection, table, err)
+		}
+		s.tables[collection] = table
+	}
+	return s, nil
+}
+
+// copyFallback fills an empty table with the collection's objects in the fallback store. Nodes
+// starting together may both copy; rows that are already there are kept.
+func (s *SQLStore) copyFallback(ctx context.Context, collection, table string) error {
+	var filled bool
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)", table)).Scan(&filled); err != nil || filled {
+		return err
+	}
+	cursor := ""
+	for {
+		objects, next, err := s.fallback.List(ctx, "", collection, 100, cursor)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			created, updated := time.Now(), time.Now()
+			if obj.GetCreateTime() != nil {
+				created = obj.GetCreateTime().AsTime()
+			}
+			if obj.GetUpdateTime() != nil {
+				updated = obj.GetUpdateTime().AsTime()
+			}
+			if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (user_id, key, value, version, read, write, create_time, update_time)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (user_id, key) DO NOTHING`, table),
+				obj.GetUserId(), obj.GetKey(), obj.GetValue(), sqlVersion(obj.GetValue()), obj.GetPermissionRead(), obj.GetPermissionWrite(), created, updated); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// NewPersistenceStore creates the module's store: Nakama storage, with the collections the
+// runtime env lists in persistence_sql_collections (comma separated) in SQL tables
+func NewPersistenceStore(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) PersistenceStore {
+	var store PersistenceStore = NewNakamaStore(nk)
+	env, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	collections := sqlCollections(env["persistence_sql_collections"])
+	if len(collections) == 0 || db == nil {
+		return store
+	}
+	sqlStore, err := NewSQLStore(ctx, db, collections, store)
+	if err != nil {
+		logger.Error("Failed to set up SQL persistence, keeping Nakama storage: %v", err)
+		return store
+	}
+	logger.Info("Persistence keeps %s in SQL tables", strings.Join(collections, ", "))
+	return sqlStore
+}
+
+// sqlCollections returns the collections of a persistence_sql_collections list, with those
+// committed together with one of them (sqlCommittedTogether)
+func sqlCollections(list string) []string {
+	var collections []string
+	for _, c := range strings.Split(list, ",") {
+		if c = strings.TrimSpace(c); c != "" && !slices.Contains(collections, c) {
+			collections = append(collections, c)
+		}
+	}
+	for _, group := range sqlCommittedTogether {
+		if slices.ContainsFunc(group, func(c string) bool { return slices.Contains(collections, c) }) {
+			for _, c := range group {
+				if !slices.Contains(collections, c) {
+					collections = append(collections, c)
+				}
+			}
+		}
+	}
+	return collections
+}
+
+// sqlVersion is the version of a value
+func sqlVersion(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// sqlColumns are the columns sqlObject reads
+const sqlColumns = "user_id, key, value, version, read, write, create_time, update_time"
+
+// sqlObject reads an object from a row of sqlColumns
+func sqlObject(collection string, rows *sql.Rows) (*api.StorageObject, error) {
+	obj := &api.StorageObject{Collection: collection}
+	var created, updated time.Time
+	if err := rows.Scan(&obj.UserId, &obj.Key, &obj.Value, &obj.Version, &obj.PermissionRead, &obj.PermissionWrite, &created, &updated); err != nil {
+		return nil, err
+	}
+	obj.CreateTime = timestamppb.New(created)
+	obj.UpdateTime = timestamppb.New(updated)
+	return obj, nil
+}
+
+func (s *SQLStore) Read(ctx context.Context, reads []*runtime.StorageRead) ([]*api.StorageObject, error) {
+	var objects []*api.StorageObject
+	var others []*runtime.StorageRead
+	for _, read := range reads {
+		table, ok := s.tables[read.Collection]
+		if !ok {
+			others = append(others, read)
+			continue
+		}
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE user_id = $1 AND key = $2", sqlColumns, table), read.UserID, read.Key)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			obj, err := sqlObject(read.Collection, rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			objects = append(objects, obj)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(others) > 0 {
+		fallback, err := s.fallback.Read(ctx, others)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, fallback...)
+	}
+	return objects, nil
+}
+
+// split separates the writes and deletes of the SQL store's collections from the others
+func (s *SQLStore) split(writes []*runtime.StorageWrite, deletes []*runtime.StorageDelete) (sqlWrites, otherWrites []*runtime.StorageWrite, sqlDeletes, otherDeletes []*runtime.StorageDelete) {
+	for _, w := range writes {
+		if _, ok := s.tables[w.Collection]; ok {
+			sqlWrites = append(sqlWrites, w)
+		} else {
+			otherWrites = append(otherWrites, w)
+		}
+	}
+	for _, d := range deletes {
+		if _, ok := s.tables[d.Collection]; ok {
+			sqlDeletes = append(sqlDeletes, d)
+		} else {
+			otherDeletes = append(otherDeletes, d)
+		}
+	}
+	return
+}
+
+// apply makes writes and deletes of the SQL store's collections in a transaction. A version
+// that doesn't match fails them all.
+func (s *SQLStore) apply(ctx context.Context, tx *sql.Tx, writes []*runtime.StorageWrite, deletes []*runtime.StorageDelete) ([]*api.StorageObjectAck, error) {
+	acks := make([]*api.StorageObjectAck, 0, len(writes))
+	for _, w := range writes {
+		table := s.tables[w.Collection]
+		version := sqlVersion(w.Value)
+		var result sql.Result
+		var err error
+		switch w.Version {
+		case "":
+			result, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (user_id, key, value, version, read, write) VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (user_id, key) DO UPDATE SET value = $3, version = $4, read = $5, write = $6, update_time = now()`, table),
+				w.UserID, w.Key, w.Value, version, w.PermissionRead, w.PermissionWrite)
+		case "*":
+			result, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (user_id, key, value, version, read, write) VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (user_id, key) DO NOTHING`, table),
+				w.UserID, w.Key, w.Value, version, w.PermissionRead, w.PermissionWrite)
+		default:
+			result, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET value = $3, version = $4, read = $5, write = $6, update_time = now()
+				WHERE user_id = $1 AND key = $2 AND version = $7`, table),
+				w.UserID, w.Key, w.Value, version, w.PermissionRead, w.PermissionWrite, w.Version)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return nil, errVersionMismatch
+		}
+		acks = append(acks, &api.StorageObjectAck{Collection: w.Collection, Key: w.Key, Version: version, UserId: w.UserID})
+	}
+	for _, d := range deletes {
+		table := s.tables[d.Collection]
+		var result sql.Result
+		var err error
+		if d.Version == "" {
+			result, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND key = $2", table), d.UserID, d.Key)
+		} else {
+			result, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND key = $2 AND version = $3", table), d.UserID, d.Key, d.Version)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); d.Version != "" && (err != nil || n == 0) {
+			return nil, errVersionMismatch
+		}
+	}
+	return acks, nil
+}
+
+// update applies writes and deletes, with the changes to the fallback store (fallbackUpdate)
+// made inside the SQL transaction: when they fail, the SQL changes are rolled back
+func (s *SQLStore) update(ctx context.Context, writes []*runtime.StorageWrite, deletes []*runtime.StorageDelete, fallbackUpdate func(writes []*runtime.StorageWrite, deletes []*runtime.StorageDelete) ([]*api.StorageObjectAck, error)) ([]*api.StorageObjectAck, error) {
+	sqlWrites, otherWrites, sqlDeletes, otherDeletes := s.split(writes, deletes)
+	if len(sqlWrites) == 0 && len(sqlDeletes) == 0 {
+		return fallbackUpdate(otherWrites, otherDeletes)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	acks, err := s.apply(ctx, tx, sqlWrites, sqlDeletes)
+	if err != nil {
+		return nil, err
+	}
+	if len(otherWrites) > 0 || len(otherDeletes) > 0 {
+		other, err := fallbackUpdate(otherWrites, otherDeletes)
+		if err != nil {
+			return nil, err
+		}
+		acks = append(acks, other...)
+	}
+	// The fallback changes are made: only a failing commit could split the update now
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return acks, nil
+}
+
+func (s *SQLStore) Write(ctx context.Context, writes []*runtime.StorageWrite) ([]*api.StorageObjectAck, error) {
+	return s.update(ctx, writes, nil, func(writes []*runtime.StorageWrite, _ []*runtime.StorageDelete) ([]*api.StorageObjectAck, error) {
+		if len(writes) == 0 {
+			return nil, nil
+		}
+		return s.fallback.Write(ctx, writes)
+	})
+}
+
+func (s *SQLStore) Delete(ctx context.Context, deletes []*runtime.StorageDelete) error {
+	_, err := s.update(ctx, nil, deletes, func(_ []*runtime.StorageWrite, deletes []*runtime.StorageDelete) ([]*api.StorageObjectAck, error) {
+		if len(deletes) == 0 {
+			return nil, nil
+		}
+		return nil, s.fallback.Delete(ctx, deletes)
+	})
+	return err
+}
+
+// MultiUpdate applies an update of SQL records and wallets in one transaction, the wallets
+// changed in Nakama's own tables as Nakama does. Updates without SQL records go to the fallback
+// store; updates of SQL records together with fallback records are refused (errMixedUpdate).
+func (s *SQLStore) MultiUpdate(ctx context.Context, writes []*runtime.StorageWrite, deletes []*runtime.StorageDelete, wallets []*runtime.WalletUpdate) error {
+	sqlWrites, otherWrites, sqlDeletes, otherDeletes := s.split(writes, deletes)
+	if len(sqlWrites) == 0 && len(sqlDeletes) == 0 {
+		return s.fallback.MultiUpdate(ctx, writes, deletes, wallets)
+	}
+	if len(otherWrites) > 0 || len(otherDeletes) > 0 {
+		return errMixedUpdate
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := s.apply(ctx, tx, sqlWrites, sqlDeletes); err != nil {
+		return err
+	}
+	if err := sqlUpdateWallets(ctx, tx, wallets); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlUpdateWallets applies wallet updates in a transaction, with their wallet ledger entries
+func sqlUpdateWallets(ctx context.Context, tx *sql.Tx, wallets []*runtime.WalletUpdate) error {
+	for _, update := range wallets {
+		var data string
+		if err := tx.QueryRowContext(ctx, "SELECT wallet FROM users WHERE id = $1 FOR UPDATE", update.UserID).Scan(&data); err != nil {
+			return fmt.Errorf("read wallet of %s: %w", update.UserID, err)
+		}
+		wallet := map[string]int64{}
+		if err := json.Unmarshal([]byte(data), &wallet); err != nil {
+			return fmt.Errorf("read wallet of %s: %w", update.UserID, err)
+		}
+		for currency, delta := range update.Changeset {
+			wallet[currency] += delta
+			if wallet[currency] < 0 {
+				return errWalletNegative
+			}
+		}
+		walletData, _ := json.Marshal(wallet)
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET wallet = $2, update_time = now() WHERE id = $1", update.UserID, string(walletData)); err != nil {
+			return err
+		}
+		changeset, _ := json.Marshal(update.Changeset)
+		metadata := []byte("{}")
+		if len(update.Metadata) > 0 {
+			metadata, _ = json.Marshal(update.Metadata)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO wallet_ledger (id, user_id, changeset, metadata) VALUES ($1, $2, $3, $4)",
+			newUUID(), update.UserID, string(changeset), string(metadata)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newUUID returns a random (version 4) UUID, e.g. for a wallet ledger entry
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// sqlCursor encodes the position after an object of a listing
+func sqlCursor(userID, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(userID + "\x00" + key))
+}
+
+// parseSQLCursor decodes a cursor made by sqlCursor
+func parseSQLCursor(cursor string) (userID, key string, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", err
+	}
+	userID, key, ok := strings.Cut(string(data), "\x00")
+	if !ok {
+		return "", "", errors.New("invalid cursor")
+	}
+	return userID, key, nil
+}
+
+func (s *SQLStore) List(ctx context.Context, userID, collection string, limit int, cursor string) ([]*api.StorageObject, string, error) {
+	table, ok := s.tables[collection]
+	if !ok {
+		return s.fallback.List(ctx, userID, collection, limit, cursor)
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	afterUser, afterKey := "", ""
+	if cursor != "" {
+		var err error
+		if afterUser, afterKey, err = parseSQLCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var rows *sql.Rows
+	var err error
+	if userID != "" {
+		rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s
+			WHERE user_id = $1 AND key > $2 ORDER BY key LIMIT $3`, sqlColumns, table), userID, afterKey, limit+1)
+	} else {
+		rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s
+			WHERE (user_id, key) > ($1, $2) ORDER BY user_id, key LIMIT $3`, sqlColumns, table), afterUser, afterKey, limit+1)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return sqlPage(collection, rows, limit)
+}
+
+// sqlJSONField matches the JSON fields Query can look up
+var sqlJSONField = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// Query looks the filter's field up through its index (sqlTableIndexes)
+func (s *SQLStore) Query(ctx context.Context, collection string, filter StoreFilter, limit int, cursor string) ([]*api.StorageObject, string, error) {
+	table, ok := s.tables[collection]
+	if !ok {
+		return s.fallback.Query(ctx, collection, filter, limit, cursor)
+	}
+	// Field names can't be query parameters, and only an expression matching the index uses it
+	if !sqlJSONField.MatchString(filter.Field) {
+		return nil, "", fmt.Errorf("field %q can't be queried", filter.Field)
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	afterUser, afterKey := "", ""
+	if cursor != "" {
+		var err error
+		if afterUser, afterKey, err = parseSQLCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	op, value := "=", filter.Equals
+	if filter.Before != "" {
+		op, value = "<", filter.Before
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s
+		WHERE (value->>'%s') %s $1 AND (user_id, key) > ($2, $3) ORDER BY user_id, key LIMIT $4`, sqlColumns, table, filter.Field, op),
+		value, afterUser, afterKey, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	return sqlPage(collection, rows, limit)
+}
+
+// sqlPage reads a page of at most limit objects from rows that may hold one more, and returns the
+// cursor of the next page
+func sqlPage(collection string, rows *sql.Rows, limit int) ([]*api.StorageObject, string, error) {
+	defer rows.Close()
+
+	objects := make([]*api.StorageObject, 0, limit)
+	for rows.Next() {
+		obj, err := sqlObject(collection, rows)
+		if err != nil {
+			return nil, "", err
+		}
+		objects = append(objects, obj)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(objects) > limit {
+		objects = slices.Delete(objects, limit, len(objects))
+		last := objects[limit-1]
+		next = sqlCursor(last.GetUserId(), last.GetKey())
+	}
+	return objects, next, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// fakeSQL is a database that accepts every statement, records the ones run and commits, and
+// answers the queries the SQL store makes outside its tables: tables are filled, and every
+// wallet holds 1000 gold
+type fakeSQL struct {
+	mu        sync.Mutex
+	execs     []string
+	commits   int
+	rollbacks int
+}
+
+func (db *fakeSQL) Connect(context.Context) (driver.Conn, error) { return &fakeSQLConn{db: db}, nil }
+func (db *fakeSQL) Driver() driver.Driver                        { return nil }
+
+// written reports whether a statement wrote to a table
+func (db *fakeSQL) written(table string) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, query := range db.execs {
+		if strings.Contains(query, "INSERT INTO "+table+" ") || strings.Contains(query, "UPDATE "+table+" ") || strings.Contains(query, "DELETE FROM "+table+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeSQLConn struct{ db *fakeSQL }
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{db: c.db, query: query}, nil
+}
+func (c *fakeSQLConn) Close() error              { return nil }
+func (c *fakeSQLConn) Begin() (driver.Tx, error) { return &fakeSQLTx{db: c.db}, nil }
+
+type fakeSQLTx struct{ db *fakeSQL }
+
+func (tx *fakeSQLTx) Commit() error {
+	tx.db.mu.Lock()
+	tx.db.commits++
+	tx.db.mu.Unlock()
+	return nil
+}
+
+func (tx *fakeSQLTx) Rollback() error {
+	tx.db.mu.Lock()
+	tx.db.rollbacks++
+	tx.db.mu.Unlock()
+	return nil
+}
+
+type fakeSQLStmt struct {
+	db    *fakeSQL
+	query string
+}
+
+func (s *fakeSQLStmt) Close() error  { return nil }
+func (s *fakeSQLStmt) NumInput() int { return -1 }
+
+func (s *fakeSQLStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	s.db.execs = append(s.db.execs, strings.Join(strings.Fields(s.query), " "))
+	s.db.mu.Unlock()
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeSQLStmt) Query([]driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.HasPrefix(s.query, "SELECT EXISTS"):
+		return &fakeSQLRows{values: []driver.Value{true}}, nil
+	case strings.HasPrefix(s.query, "SELECT wallet"):
+		return &fakeSQLRows{values: []driver.Value{`{"gold":1000}`}}, nil
+	}
+	return &fakeSQLRows{}, nil
+}
+
+// fakeSQLRows is a result of at most one row
+type fakeSQLRows struct {
+	values []driver.Value
+	read   bool
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	columns := make([]string, len(r.values))
+	for i := range columns {
+		columns[i] = "c"
+	}
+	return columns
+}
+
+func (r *fakeSQLRows) Close() error { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if r.read || len(r.values) == 0 {
+		return io.EOF
+	}
+	r.read = true
+	copy(dest, r.values)
+	return nil
+}
+
+// TestSQLStoreAuctionSale commits a buyout through a SQL store keeping only the auctions
+// configured: the sale's claims, journal records, listing delete and seller payout must all go
+// in one SQL transaction rather than being refused as a mixed update
+func TestSQLStoreAuctionSale(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeSQL{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	collections := sqlCollections(COLLECTION_AUCTIONS)
+	store, err := NewSQLStore(ctx, db, collections, NewNakamaStore(nil))
+	if err != nil {
+		t.Fatalf("NewSQLStore: %v", err)
+	}
+
+	listing := &PersistedAuction{ID: "listing-1", SellerID: "seller", ItemID: "iron_ore", Count: 5, Currency: "gold", StartPrice: 10, Buyout: 100, version: "v1"}
+	writes, wallets := saleWrites(listing, "buyer", listing.Buyout, AuctionClaimBought)
+	if err := store.MultiUpdate(ctx, writes, []*runtime.StorageDelete{auctionDelete(listing)}, wallets); err != nil {
+		t.Fatalf("sale through the SQL store with %v: %v", collections, err)
+	}
+
+	for _, collection := range []string{COLLECTION_AUCTIONS, COLLECTION_AUCTION_CLAIMS, COLLECTION_ACTION_JOURNAL, COLLECTION_JOURNAL_OUTCOMES} {
+		if !fake.written(sqlTable(collection)) {
+			t.Errorf("sale didn't write %s in SQL", collection)
+		}
+	}
+	if !fake.written("users") || !fake.written("wallet_ledger") {
+		t.Errorf("sale didn't pay the seller in SQL")
+	}
+	if fake.commits != 1 {
+		t.Errorf("sale made %d commits, want 1", fake.commits)
+	}
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Pet tuning
+const (
+	petFollowDistance        = 2 * TileSize  // a pet walks after its owner once further away than this
+	petTeleportDistance      = 20 * TileSize // pets this far from their owner (stuck, or the owner rode off) jump back to them
+	petAssistRadius          = 8 * TileSize  // combat pets attack NPCs fighting their owner within this distance of the owner
+	petLeashRadius           = 12 * TileSize // pets give up targets further than this from their owner
+	defaultPetHealthScale    = 0.5
+	defaultPetArmorScale     = 0.5
+	defaultPetDamageScale    = 1.0
+	defaultPetRecoverSeconds = 60.0
+	petNameMaxLength         = 24 // characters
+)
+
+// PetDefinition describes a kind of pet. Pets are NPCs of the NPC type named by NPC, which
+// provides the sprite, size, speed and attack range and cooldown; health, armor and damage come
+// from the owner when the pet is summoned.
+type PetDefinition struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	NPC            string  `json:"npc"`                      // NPC type the pet spawns as
+	Combat         bool    `json:"combat,omitempty"`         // attacks NPCs that are fighting its owner
+	HealthScale    float64 `json:"healthScale,omitempty"`    // max health = healthScale × owner's max health
+	ArmorScale     float64 `json:"armorScale,omitempty"`     // armor = armorScale × owner's armor (resistances are copied)
+	DamageScale    float64 `json:"damageScale,omitempty"`    // damage = damageScale × NPC attack damage × owner's max health / defaultMaxHealth
+	RecoverSeconds float64 `json:"recoverSeconds,omitempty"` // a defeated pet can't be summoned for this long
+}
+
+// ActivePet links a summoned pet's NPC to its owner
+type ActivePet struct {
+	OwnerID      string
+	PetID        string
+	Name         string
+	Combat       bool
+	AttackDamage float64
+	Target       int // NPC the pet is fighting (0 while following)
+}
+
+// PetData is the pet representation sent in world updates
+type PetData struct {
+	ID        int      `json:"id"` // NPC ID; damage events address pets like NPCs
+	Pet       string   `json:"pet"`
+	Name      string   `json:"name"`
+	Owner     string   `json:"owner"`
+	GID       uint32   `json:"gid"`
+	Position  Position `json:"position"`
+	Facing    float64  `json:"facing"`
+	Health    float64  `json:"health"`
+	MaxHealth float64  `json:"maxHealth"`
+	State     string   `json:"state"`
+	Target    int      `json:"target,omitempty"` // NPC the pet is attacking
+}
+
+// PetInfo is an entry of the pet_list sent to a pet's owner
+type PetInfo struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Active  bool    `json:"active,omitempty"`
+	DownFor float64 `json:"downFor,omitempty"` // seconds until a defeated pet can be summoned again
+}
+
+// PetManager owns the pet definitions, the adopted pets of online players and their summoned
+// pets. It is only used from the match loop.
+type PetManager struct {
+	logger      runtime.Logger
+	db          *DatabaseManager
+	definitions map[string]*PetDefinition
+	owned       map[string]*PersistedPets // player ID -> pets of online players
+	summoned    map[string]int            // player ID -> NPC ID of their summoned pet
+}
+
+// NewPetManager creates a manager and loads definitions from path (a JSON object keyed by pet ID)
+func NewPetManager(logger runtime.Logger, db *DatabaseManager, path string) *PetManager {
+	pm := &PetManager{
+		logger:      logger,
+		db:          db,
+		definitions: make(map[string]*PetDefinition),
+		owned:       make(map[string]*PersistedPets),
+		summoned:    make(map[string]int),
+	}
+	if err := pm.Load(path); err != nil {
+		logger.Warn("Failed to load pet definitions from %s: %v", path, err)
+	}
+	return pm
+}
+
+// Load replaces the pet definitions with the ones found in path
+func (pm *PetManager) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var definitions map[string]*PetDefinition
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return err
+	}
+	for id, def := range definitions {
+		def.ID = id
+		if def.Name == "" {
+			def.Name = id
+		}
+		if def.HealthScale <= 0 {
+			def.HealthScale = defaultPetHealthScale
+		}
+		if def.ArmorScale <= 0 {
+			def.ArmorScale = defaultPetArmorScale
+		}
+		if def.DamageScale <= 0 {
+			def.DamageScale = defaultPetDamageScale
+		}
+		if def.RecoverSeconds <= 0 {
+			def.RecoverSeconds = defaultPetRecoverSeconds
+		}
+	}
+	pm.definitions = definitions
+
+	pm.logger.Info("Loaded %d pet definitions from %s", len(definitions), path)
+	return nil
+}
+
+// LoadPlayer loads a joining player's pets, summons the pet they left with and sends them their
+// pet list
+func (pm *PetManager) LoadPlayer(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	pets, err := pm.db.LoadPets(ctx, playerID)
+	if err != nil {
+		pm.logger.Error("Failed to load pets for %s: %v", playerID, err)
+		return
+	}
+	pm.owned[playerID] = pets
+	if pets.Active != "" {
+		if reason := pm.spawn(gs, playerID, pets.Active); reason != "" {
+			pm.logger.Warn("Could not summon pet %s of %s on join: %s", pets.Active, playerID, reason)
+		}
+	}
+	pm.sendList(gs, playerID, dispatcher)
+}
+
+// UnloadPlayer removes a leaving player's pet from the world. The pet stays active, so it comes
+// back with the player.
+func (pm *PetManager) UnloadPlayer(gs *GameMatchState, playerID string) {
+	if id, ok := pm.summoned[playerID]; ok {
+		gs.npcManager.Despawn(gs, id)
+		delete(pm.summoned, playerID)
+	}
+	delete(pm.owned, playerID)
+}
+
+// CanAdopt returns the reason the player can't adopt petID, or ""
+func (pm *PetManager) CanAdopt(playerID, petID string) string {
+	if _, ok := pm.definitions[petID]; !ok {
+		return RejectNotUsable
+	}
+	pets, ok := pm.owned[playerID]
+	if !ok {
+		return RejectStorageError
+	}
+	if _, owned := pets.Pets[petID]; owned {
+		return RejectPetOwned
+	}
+	return ""
+}
+
+// Adopt adds the pet petID to the player's pets. It returns a rejection reason, or "".
+func (pm *PetManager) Adopt(ctx context.Context, gs *GameMatchState, playerID, petID string, dispatcher runtime.MatchDispatcher) string {
+	if reason := pm.CanAdopt(playerID, petID); reason != "" {
+		return reason
+	}
+	pets := pm.owned[playerID]
+	pets.Pets[petID] = &PersistedPet{Name: pm.definitions[petID].Name, AdoptedAt: time.Now()}
+	if err := pm.db.SavePets(ctx, pets); err != nil {
+		delete(pets.Pets, petID)
+		return RejectStorageError
+	}
+	pm.logger.Info("Player %s adopted pet %s", playerID, petID)
+	pm.sendList(gs, playerID, dispatcher)
+	return ""
+}
+
+// Summon calls the player's pet petID to their side, sending any other summoned pet away. It
+// returns a rejection reason, or "". A defeated pet can't be summoned until it recovered.
+func (pm *PetManager) Summon(ctx context.Context, gs *GameMatchState, playerID, petID string, ack *InputACK, dispatcher runtime.MatchDispatcher) string {
+	pets, ok := pm.owned[playerID]
+	if !ok {
+		return RejectStorageError
+	}
+	pet, ok := pets.Pets[petID]
+	if !ok {
+		return RejectNotOwned
+	}
+	if remaining := pet.DownUntil - time.Now().Unix(); remaining > 0 {
+		ack.Cooldown = float64(remaining)
+		return RejectOnCooldown
+	}
+
+	previous, hadPet := pm.summoned[playerID]
+	if hadPet {
+		gs.npcManager.Despawn(gs, previous)
+		delete(pm.summoned, playerID)
+	}
+	if reason := pm.spawn(gs, playerID, petID); reason != "" {
+		return reason
+	}
+	if pets.Active != petID {
+		pets.Active = petID
+		if err := pm.db.SavePets(ctx, pets); err != nil {
+			// The pet is out; it just won't come back automatically on the next join
+			pm.logger.Error("Failed to save active pet of %s: %v", playerID, err)
+		}
+	}
+	pm.sendList(gs, playerID, dispatcher)
+	return ""
+}
+
+// Dismiss sends the player's summoned pet away. It returns a rejection reason, or "".
+func (pm *PetManager) Dismiss(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) string {
+	id, ok := pm.summoned[playerID]
+	if !ok {
+		return RejectNoPet
+	}
+	gs.npcManager.Despawn(gs, id)
+	delete(pm.summoned, playerID)
+
+	if pets := pm.owned[playerID]; pets != nil && pets.Active != "" {
+		pets.Active = ""
+		if err := pm.db.SavePets(ctx, pets); err != nil {
+			pm.logger.Error("Failed to save dismissed pet of %s: %v", playerID, err)
+		}
+	}
+	pm.sendList(gs, playerID, dispatcher)
+	return ""
+}
+
+// Rename names the player's pet petID, after the content filter accepted the name. It returns
+// a rejection reason, or "". A summoned pet shows the new name once the filter answered.
+func (pm *PetManager) Rename(ctx context.Context, gs *GameMatchState, playerID, petID, name string, dispatcher runtime.MatchDispatcher) string {
+	pets, ok := pm.owned[playerID]
+	if !ok {
+		return RejectStorageError
+	}
+	if _, ok := pets.Pets[petID]; !ok {
+		return RejectNotOwned
+	}
+	name = strings.TrimSpace(name)
+	if n := utf8.RuneCountInString(name); n == 0 || n > petNameMaxLength {
+		return RejectInvalidName
+	}
+
+	// The filter may answer on a later tick; a rejection then goes out as pet_rename_rejected
+	// because the input was already acknowledged
+	reason, submitted := "", false
+	gs.moderation.Submit(ctx, ContentPetName, playerID, name, func(_ string, err error) {
+		if err != nil {
+			reason = RejectContentBlocked
+		} else {
+			reason = pm.rename(ctx, gs, playerID, petID, name, dispatcher)
+		}
+		if submitted && reason != "" {
+			pm.sendRenameRejected(gs, playerID, petID, reason, dispatcher)
+		}
+	})
+	submitted = true
+	return reason
+}
+
+// rename gives a pet a name the content filter accepted
+func (pm *PetManager) rename(ctx context.Context, gs *GameMatchState, playerID, petID, name string, dispatcher runtime.MatchDispatcher) string {
+	pets, ok := pm.owned[playerID]
+	if !ok {
+		return RejectStorageError
+	}
+	pet, ok := pets.Pets[petID]
+	if !ok {
+		return RejectNotOwned
+	}
+	previous := pet.Name
+	pet.Name = name
+	if err := pm.db.SavePets(ctx, pets); err != nil {
+		pet.Name = previous
+		return RejectStorageError
+	}
+	if id, summoned := pm.summoned[playerID]; summoned && pets.Active == petID {
+		gs.npcManager.renamePet(id, name)
+	}
+	pm.sendList(gs, playerID, dispatcher)
+	return ""
+}
+
+// sendRenameRejected tells the player a rename failed after its input was acknowledged
+// (OpCodePet pet_rename_rejected)
+func (pm *PetManager) sendRenameRejected(gs *GameMatchState, playerID, petID, reason string, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodePet, "pet_rename_rejected", map[string]any{"petId": petID, "reason": reason})
+	if err != nil {
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodePet, data, []runtime.Presence{presence}, nil, true)
+}
+
+// Update notices summoned pets that were defeated (or removed by a script). They go back to
+// their owner's pet list and need to recover before they can be summoned again.
+func (pm *PetManager) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	for playerID, id := range pm.summoned {
+		if _, alive := gs.npcManager.Get(id); alive {
+			continue
+		}
+		delete(pm.summoned, playerID)
+
+		pets := pm.owned[playerID]
+		if pets == nil {
+			continue
+		}
+		if pet, ok := pets.Pets[pets.Active]; ok {
+			recoverSeconds := defaultPetRecoverSeconds
+			if def, ok := pm.definitions[pets.Active]; ok {
+				recoverSeconds = def.RecoverSeconds
+			}
+			pet.DownUntil = time.Now().Unix() + int64(recoverSeconds)
+		}
+		pm.logger.Info("Pet %s of %s was defeated", pets.Active, playerID)
+		pets.Active = ""
+		if err := pm.db.SavePets(ctx, pets); err != nil {
+			pm.logger.Error("Failed to save defeated pet of %s: %v", playerID, err)
+		}
+		pm.sendList(gs, playerID, dispatcher)
+	}
+}
+
+// spawn places the player's pet petID next to them with stats derived from theirs
+func (pm *PetManager) spawn(gs *GameMatchState, playerID, petID string) string {
+	def, ok := pm.definitions[petID]
+	if !ok {
+		return RejectInvalidTarget
+	}
+	npcDef, ok := gs.npcManager.Definition(def.NPC)
+	if !ok {
+		pm.logger.Warn("Pet %s references unknown NPC type %q", petID, def.NPC)
+		return RejectInvalidTarget
+	}
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+
+	owner := gs.GetPlayerState(playerID)
+	position := rb.Position.Sub(owner.FacingVector().Scale(TileSize))
+	id := gs.npcManager.Spawn(gs, def.NPC, position, nil)
+	if id == 0 {
+		return RejectInvalidTarget
+	}
+	name := def.Name
+	if pet, ok := pm.owned[playerID].Pets[petID]; ok && pet.Name != "" {
+		name = pet.Name
+	}
+	maxHealth := def.HealthScale * owner.MaxHealth
+	gs.npcManager.makePet(id, &ActivePet{
+		OwnerID:      playerID,
+		PetID:        petID,
+		Name:         name,
+		Combat:       def.Combat,
+		AttackDamage: def.DamageScale * npcDef.AttackDamage * owner.MaxHealth / defaultMaxHealth,
+	}, HealthComponent{
+		Health:      maxHealth,
+		MaxHealth:   maxHealth,
+		Armor:       def.ArmorScale * owner.Armor,
+		Resistances: maps.Clone(owner.Resistances),
+	})
+	pm.summoned[playerID] = id
+	return ""
+}
+
+// sendList sends the player their pets (OpCodePet pet_list)
+func (pm *PetManager) sendList(gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	pets := pm.owned[playerID]
+	if !ok || pets == nil || dispatcher == nil {
+		return
+	}
+	now := time.Now().Unix()
+	list := make([]PetInfo, 0, len(pets.Pets))
+	for id, pet := range pets.Pets {
+		info := PetInfo{ID: id, Name: pet.Name, Active: id == pets.Active}
+		if pet.DownUntil > now {
+			info.DownFor = float64(pet.DownUntil - now)
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	data, err := EncodeMessage(OpCodePet, "pet_list", map[string]any{"pets": list})
+	if err != nil {
+		pm.logger.Error("Failed to marshal pet_list: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodePet, data, []runtime.Presence{presence}, nil, true)
+}
+
+// makePet turns a freshly spawned NPC into a pet with its owner-derived health
+func (nm *NPCManager) makePet(id int, pet *ActivePet, health HealthComponent) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	npc, ok := nm.npcs[id]
+	if !ok {
+		return
+	}
+	npc.Pet = pet
+	npc.HealthComponent = health
+	npc.offDuty = false
+}
+
+// renamePet changes the name a summoned pet shows
+func (nm *NPCManager) renamePet(id int, name string) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if npc, ok := nm.npcs[id]; ok && npc.Pet != nil {
+		npc.Pet.Name = name
+	}
+}
+
+// updatePet keeps a pet at its owner's side and, for combat pets, attacks the NPCs fighting the
+// owner. The pet's goal is set here; steer walks it there.
+func (nm *NPCManager) updatePet(gameState *GameMatchState, npc *NPC, tick int64, dispatcher runtime.MatchDispatcher) {
+	nm.mu.Lock()
+	pet := npc.Pet
+	owner := gameState.PlayerBody(pet.OwnerID)
+	if owner == nil {
+		nm.mu.Unlock()
+		return
+	}
+	ownerPos := owner.Position
+	if ownerPos.Sub(npc.Body.Position).Magnitude() > petTeleportDistance {
+		npc.Body.Position = ownerPos
+		npc.Body.Velocity = vector.Vector{X: 0, Y: 0}
+		npc.goal, npc.route = nil, nil
+		pet.Target = 0
+	}
+
+	if pet.Combat && tick >= npc.nextPerception {
+		npc.nextPerception = tick + npcPerceptionInterval
+		pet.Target = nm.petTarget(npc, ownerPos)
+	}
+
+	strike := 0
+	var target *NPC
+	if pet.Target != 0 {
+		target = nm.npcs[pet.Target]
+		if target == nil || target.Body.Position.Sub(ownerPos).Magnitude() > petLeashRadius {
+			pet.Target, target = 0, nil
+		}
+	}
+
+	if target == nil {
+		// Follow the owner, stopping a little short of them
+		if npc.State != NPCStateIdle {
+			npc.State = NPCStateIdle
+			npc.goal, npc.route = nil, nil
+		}
+		dist := ownerPos.Sub(npc.Body.Position).Magnitude()
+		switch {
+		case dist <= petFollowDistance:
+			npc.goal, npc.route = nil, nil
+		case npc.goal == nil || npc.goal.Sub(ownerPos).Magnitude() > npcRepathDistance:
+			goal := ownerPos
+			npc.goal, npc.goalTick, npc.route = &goal, tick, nil
+		}
+	} else {
+		targetPos := target.Body.Position
+		delta := targetPos.Sub(npc.Body.Position)
+		if delta.Magnitude() <= npc.Def.AttackRange && gameState.HasLineOfSight(npc.Body.Position, targetPos, 0) {
+			npc.State = NPCStateAttack
+			npc.goal, npc.route = nil, nil
+			npc.Facing = math.Atan2(delta.Y, delta.X)
+			if tick >= npc.attackReady {
+				npc.attackReady = tick + int64(npc.Def.AttackCooldown*TickRate)
+				strike = target.ID
+			}
+		} else if npc.State != NPCStateChase || npc.goal == nil || npc.goal.Sub(targetPos).Magnitude() > npcRepathDistance {
+			npc.State = NPCStateChase
+			npc.goal, npc.goalTick, npc.route = &targetPos, tick, nil
+		}
+	}
+	damage := pet.AttackDamage
+	nm.mu.Unlock()
+
+	// Damage takes the lock itself and may kill the target
+	if strike != 0 {
+		nm.Damage(gameState, strike, npcDamageSource(npc.ID), damage, DamagePhysical, dispatcher)
+	}
+}
+
+// petTarget picks the NPC a combat pet attacks: its current target while that one still fights
+// the owner, otherwise the nearest NPC with threat against the owner near them. Callers hold nm.mu.
+func (nm *NPCManager) petTarget(npc *NPC, ownerPos vector.Vector) int {
+	ownerID := npc.Pet.OwnerID
+	fighting := func(other *NPC) bool {
+		return other.Pet == nil && other.Threat[ownerID] > 0 &&
+			other.Body.Position.Sub(ownerPos).Magnitude() <= petAssistRadius
+	}
+	if current, ok := nm.npcs[npc.Pet.Target]; ok && fighting(current) {
+		return current.ID
+	}
+	best, bestDist := 0, math.Inf(1)
+	for _, other := range nm.live() {
+		if !fighting(other) {
+			continue
+		}
+		if dist := other.Body.Position.Sub(npc.Body.Position).Magnitude(); dist < bestDist {
+			best, bestDist = other.ID, dist
+		}
+	}
+	return best
+}
+
+// creditedPlayer returns the player credited with damage from source: the player themselves, or
+// the owner of the pet that dealt it. Callers hold nm.mu.
+func (nm *NPCManager) creditedPlayer(source DamageSource) string {
+	switch source.Type {
+	case DamageSourcePlayer:
+		return source.ID
+	case DamageSourceNPC:
+		id, err := strconv.Atoi(source.ID)
+		if err != nil {
+			return ""
+		}
+		if npc, ok := nm.npcs[id]; ok && npc.Pet != nil {
+			return npc.Pet.OwnerID
+		}
+	}
+	return ""
+}
+
+// PetSnapshot returns the summoned pets for world updates
+func (nm *NPCManager) PetSnapshot() []PetData {
+	return nm.AppendPetSnapshot(make([]PetData, 0))
+}
+
+// AppendPetSnapshot appends the snapshot of the pets to out and returns it
+func (nm *NPCManager) AppendPetSnapshot(out []PetData) []PetData {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	for _, npc := range nm.live() {
+		if npc.Pet == nil {
+			continue
+		}
+		out = append(out, PetData{
+			ID:        npc.ID,
+			Pet:       npc.Pet.PetID,
+			Name:      npc.Pet.Name,
+			Owner:     npc.Pet.OwnerID,
+			GID:       npc.Def.GID,
+			Position:  ToPosition(npc.Body.Position),
+			Facing:    npc.Facing,
+			Health:    npc.Health,
+			MaxHealth: npc.MaxHealth,
+			State:     npc.State,
+			Target:    npc.Pet.Target,
+		})
+	}
+	return out
+}
@@ -14,7 +14,34 @@ type PhysicsEngine struct {
 	gravity         vector.Vector
 	worldBounds     WorldBounds
 	deltaTime       float64
+	drag            float64 // velocity factor applied to movable bodies every step (baseDrag unless configured)
+	bounce          float64 // share of velocity kept when bouncing off the world bounds (baseBounce unless configured)
+	baseDrag        float64 // drag of the game config (SetDefaults)
+	baseBounce      float64 // bounce of the game config (SetDefaults)
+	iterations      int     // collision passes per step (defaultSolverIterations)
+	slop            float64 // penetration depth left alone so resting contacts don't jitter (defaultPenetrationSlop)
+	bias            float64 // share of the penetration beyond the slop corrected per pass (defaultCorrectionBias)
 	polygonRegistry polygonRegistry
+	bodyDrag        map[*rigidbody.RigidBody]float64              // per-body drag overrides (e.g. swimming players)
+	contacts        map[*rigidbody.RigidBody]vector.Vector        // summed push-back normals of the last step, for movable bodies hitting walls or bounds
+	noCollide       map[*rigidbody.RigidBody]bool                 // bodies that skip collision resolution (e.g. dead players); world bounds still apply
+	filters         map[*rigidbody.RigidBody]CollisionFilter      // collision groups and the groups a body passes through
+	separating      map[bodyPair]bool                             // overlapping pairs kept apart until they separate (SeparateBodies)
+	oneWay          map[*rigidbody.RigidBody]vector.Vector        // ledges and the direction bodies may cross them in (SetOneWay)
+	frozen          map[*rigidbody.RigidBody]bool                 // bodies held in place (SetFrozen)
+	noClip          map[*rigidbody.RigidBody]bool                 // bodies passing through static colliders (SetNoClip)
+	gravityScale    map[*rigidbody.RigidBody]float64              // per-body gravity factors (SetGravityScale)
+	attachedTo      map[*rigidbody.RigidBody]*rigidbody.RigidBody // attached colliders and bodies -> the body they follow (attachments.go)
+	lastStep        PhysicsStepStats                              // pair counts of the last collision pass, for metrics
+	scratch         collisionScratch                              // SAT buffers reused by every narrow phase check (pools.go)
+}
+
+// PhysicsStepStats counts the body pairs one collision pass looked at
+type PhysicsStepStats struct {
+	Pairs      int // pairs with a movable body that went through the broad phase
+	Overlaps   int // pairs whose bounding boxes overlapped (narrow phase)
+	Collisions int // pairs that collided and were resolved
+	Iterations int // collision passes the solver ran
 }
 
 type WorldBounds struct {
@@ -30,11 +57,30 @@ func NewPhysicsEngine() *PhysicsEngine {
 			MaxX: 1600, MaxY: 1200,
 		},
 		deltaTime:       1.0 / 60.0,
+		drag:            defaultDrag,
+		bounce:          defaultBounce,
+		baseDrag:        defaultDrag,
+		baseBounce:      defaultBounce,
+		iterations:      defaultSolverIterations,
+		slop:            defaultPenetrationSlop,
+		bias:            defaultCorrectionBias,
 		polygonRegistry: make(polygonRegistry), // Initialize the polygon registry
+		bodyDrag:        make(map[*rigidbody.RigidBody]float64),
+		contacts:        make(map[*rigidbody.RigidBody]vector.Vector),
+		noCollide:       make(map[*rigidbody.RigidBody]bool),
+		filters:         make(map[*rigidbody.RigidBody]CollisionFilter),
+		separating:      make(map[bodyPair]bool),
+		oneWay:          make(map[*rigidbody.RigidBody]vector.Vector),
+		frozen:          make(map[*rigidbody.RigidBody]bool),
+		noClip:          make(map[*rigidbody.RigidBody]bool),
+		attachedTo:      make(map[*rigidbody.RigidBody]*rigidbody.RigidBody),
+		gravityScale:    make(map[*rigidbody.RigidBody]float64),
 	}
 }
 
 func (pe *PhysicsEngine) UpdatePhysics(gameState *GameMatchState, logger runtime.Logger) {
+	clear(pe.contacts)
+
 	// Count movable objects for debugging
 	movableCount := 0
 	for _, obj := range gameState.gameObjects {
@@ -56,9 +102,18 @@ func (pe *PhysicsEngine) UpdatePhysics(gameState *GameMatchState, logger runtime
 }
 
 func (pe *PhysicsEngine) updateRigidBody(obj *rigidbody.RigidBody) {
+	// Frozen bodies stay put whatever set their velocity meanwhile
+	if pe.frozen[obj] {
+		obj.Velocity = vector.Vector{}
+		return
+	}
+
 	// Store old position to check if we've moved significantly
 	oldPosition := obj.Position
 
+	if pe.gravity.X != 0 || pe.gravity.Y != 0 {
+		obj.Velocity = obj.Velocity.Add(pe.gravity.Scale(pe.bodyGravityScale(obj) * pe.deltaTime))
+	}
 	obj.Position.X += obj.Velocity.X * pe.deltaTime
 	obj.Position.Y += obj.Velocity.Y * pe.deltaTime
 
@@ -72,28 +127,130 @@ func (pe *PhysicsEngine) updateRigidBody(obj *rigidbody.RigidBody) {
 }
 
 func (pe *PhysicsEngine) handleBoundaryCollision(obj *rigidbody.RigidBody) {
-	bounce := 0.7
+	bounce := pe.bounce
 
 	if obj.Position.X-obj.Width/2 < pe.worldBounds.MinX {
 		obj.Position.X = pe.worldBounds.MinX + obj.Width/2
 		obj.Velocity.X = -obj.Velocity.X * bounce
+		pe.recordContact(obj, vector.Vector{X: 1, Y: 0})
 	}
 	if obj.Position.X+obj.Width/2 > pe.worldBounds.MaxX {
 		obj.Position.X = pe.worldBounds.MaxX - obj.Width/2
 		obj.Velocity.X = -obj.Velocity.X * bounce
+		pe.recordContact(obj, vector.Vector{X: -1, Y: 0})
 	}
 	if obj.Position.Y-obj.Height/2 < pe.worldBounds.MinY {
 		obj.Position.Y = pe.worldBounds.MinY + obj.Height/2
 		obj.Velocity.Y = -obj.Velocity.Y * bounce
+		pe.recordContact(obj, vector.Vector{X: 0, Y: 1})
 	}
 	if obj.Position.Y+obj.Height/2 > pe.worldBounds.MaxY {
 		obj.Position.Y = pe.worldBounds.MaxY - obj.Height/2
 		obj.Velocity.Y = -obj.Velocity.Y * bounce
+		pe.recordContact(obj, vector.Vector{X: 0, Y: -1})
+	}
+}
+
+// recordContact adds a push-back normal for a body blocked during this step
+func (pe *PhysicsEngine) recordContact(obj *rigidbody.RigidBody, normal vector.Vector) {
+	pe.contacts[obj] = pe.contacts[obj].Add(normal)
+}
+
+// Contact returns the unit push-back normal of a body blocked by a wall or the world bounds
+// during the last step, and whether it was blocked at all
+func (pe *PhysicsEngine) Contact(obj *rigidbody.RigidBody) (vector.Vector, bool) {
+	normal, ok := pe.contacts[obj]
+	if !ok {
+		return vector.Vector{}, false
+	}
+	if length := normal.Magnitude(); length > 0 {
+		normal = normal.Scale(1 / length)
+	}
+	return normal, true
+}
+
+// SetCollisionsEnabled turns collision resolution for a body on or off. Disabled bodies pass
+// through walls and other bodies but stay inside the world bounds.
+func (pe *PhysicsEngine) SetCollisionsEnabled(obj *rigidbody.RigidBody, enabled bool) {
+	if enabled {
+		delete(pe.noCollide, obj)
+		return
+	}
+	pe.noCollide[obj] = true
+}
+
+// CollisionsEnabled reports whether a body takes part in collisions. Static bodies with collisions
+// turned off (open doors) don't block sight, projectiles or paths either.
+func (pe *PhysicsEngine) CollisionsEnabled(obj *rigidbody.RigidBody) bool {
+	return !pe.noCollide[obj]
+}
+
+// Physics defaults, overridable through the game config (SetDefaults) and the world settings
+// (see Configure)
+const (
+	defaultDrag             = 0.95 // velocity factor applied to movable bodies every step
+	defaultBounce           = 0.7  // share of velocity kept when bouncing off the world bounds
+	defaultSolverIterations = 4    // collision passes per step
+	defaultPenetrationSlop  = 0.5  // px of penetration left alone
+	defaultCorrectionBias   = 0.8  // share of the penetration beyond the slop corrected per pass
+	maxSolverIterations     = 16
+	solverTolerance         = 0.01 // px; a pass correcting less than this ends the step
+)
+
+// Configure applies the physicsConfig of the world settings: "drag" (0..1], "bounce" [0..1],
+// "gravityX"/"gravityY" (px/s²), "solverIterations" [1..16], "penetrationSlop" (px, >= 0) and
+// "correctionBias" (0..1]. Missing keys go back to the defaults.
+func (pe *PhysicsEngine) Configure(config map[string]interface{}) {
+	pe.drag = pe.baseDrag
+	if v, ok := config["drag"].(float64); ok && v > 0 && v <= 1 {
+		pe.drag = v
+	}
+	pe.bounce = pe.baseBounce
+	if v, ok := config["bounce"].(float64); ok && v >= 0 && v <= 1 {
+		pe.bounce = v
+	}
+	pe.iterations = defaultSolverIterations
+	if v, ok := config["solverIterations"].(float64); ok && v >= 1 && v <= maxSolverIterations {
+		pe.iterations = int(v)
+	}
+	pe.slop = defaultPenetrationSlop
+	if v, ok := config["penetrationSlop"].(float64); ok && v >= 0 {
+		pe.slop = v
+	}
+	pe.bias = defaultCorrectionBias
+	if v, ok := config["correctionBias"].(float64); ok && v > 0 && v <= 1 {
+		pe.bias = v
+	}
+	pe.gravity = vector.Vector{}
+	if v, ok := config["gravityX"].(float64); ok {
+		pe.gravity.X = v
+	}
+	if v, ok := config["gravityY"].(float64); ok {
+		pe.gravity.Y = v
 	}
 }
 
+// SetDefaults sets the drag and bounce Configure falls back to when the world settings don't
+// set them. Configure applies them.
+func (pe *PhysicsEngine) SetDefaults(drag, bounce float64) {
+	pe.baseDrag = drag
+	pe.baseBounce = bounce
+}
+
+// SetDrag overrides the drag of a body; a drag of 0 or less restores the default
+func (pe *PhysicsEngine) SetDrag(obj *rigidbody.RigidBody, drag float64) {
+	if drag <= 0 {
+		delete(pe.bodyDrag, obj)
+		return
+	}
+	pe.bodyDrag[obj] = drag
+}
+
 func (pe *PhysicsEngine) applyDrag(obj *rigidbody.RigidBody) {
-	drag := 0.95
+	drag := pe.drag
+	if d, ok := pe.bodyDrag[obj]; ok {
+		drag = d
+	}
 	obj.Velocity.X *= drag
 	obj.Velocity.Y *= drag
 	if obj.Velocity.Magnitude() < 0.5 {
@@ -101,35 +258,183 @@ func (pe *PhysicsEngine) applyDrag(obj *rigidbody.RigidBody) {
 	}
 }
 
+// handleCollisions resolves the step's collisions in up to pe.iterations passes. A body pushed out
+// of one collider into another is pushed out of that one on the next pass, instead of popping
+// back and forth from tick to tick; the passes stop early once nothing moves more than
+// solverTolerance.
 func (pe *PhysicsEngine) handleCollisions(objects []*rigidbody.RigidBody, logger runtime.Logger) {
+	pe.lastStep = PhysicsStepStats{}
+	pe.releaseSeparated()
+	for pass := 0; pass < pe.iterations; pass++ {
+		pe.lastStep.Iterations++
+		if !pe.collisionPass(objects, pass == 0, logger) {
+			break
+		}
+	}
+}
+
+// collisionPass resolves every colliding pair once and reports whether it corrected any of them
+// by more than solverTolerance. Only the first pass is counted in the step stats.
+func (pe *PhysicsEngine) collisionPass(objects []*rigidbody.RigidBody, first bool, logger runtime.Logger) bool {
+	corrected := false
 	for i := 0; i < len(objects); i++ {
 		for j := i + 1; j < len(objects); j++ {
 			a := objects[i]
 			b := objects[j]
 
-			// Skip static-static
-			if !a.IsMovable && !b.IsMovable {
+			// Skip pairs of bodies that can't move (static or frozen)
+			if !pe.moves(a) && !pe.moves(b) {
 				continue
 			}
+			if pe.noCollide[a] || pe.noCollide[b] || !pe.canCollide(a, b) {
+				continue
+			}
+			if first {
+				pe.lastStep.Pairs++
+			}
 
 			// First use AABB as a quick check (broad phase)
 			if !pe.aabbOverlap(a, b) {
 				continue
 			}
+			if first {
+				pe.lastStep.Overlaps++
+			}
+			if pe.passesLedge(a, b) {
+				continue
+			}
 
 			// Detailed collision check (narrow phase)
 			collisionInfo := pe.detectCollision(a, b)
 			if !collisionInfo.collided {
 				continue
 			}
+			if first {
+				pe.lastStep.Collisions++
+			}
 
 			logger.Debug("Collision detected: Object A(pos: %.2f,%.2f, size: %.2fx%.2f, movable: %t) <-> Object B(pos: %.2f,%.2f, size: %.2fx%.2f, movable: %t)",
 				a.Position.X, a.Position.Y, a.Width, a.Height, a.IsMovable,
 				b.Position.X, b.Position.Y, b.Width, b.Height, b.IsMovable)
 
-			pe.resolvePolygonCollision(a, b, collisionInfo, logger)
+			if pe.resolvePolygonCollision(a, b, collisionInfo, logger) > solverTolerance {
+				corrected = true
+			}
 		}
 	}
+	return corrected
+}
+
+// LastStepStats returns the pair counts of the last collision pass
+func (pe *PhysicsEngine) LastStepStats() PhysicsStepStats {
+	return pe.lastStep
+}
+
+// SweepBody moves rb along delta in small steps and returns the furthest position reachable
+// without overlapping a static collider or leaving the world bounds. The second result reports
+// whether the sweep was cut short. Used for instant moves (e.g. dash) that would otherwise
+// tunnel through thin walls.
+func (pe *PhysicsEngine) SweepBody(rb *rigidbody.RigidBody, delta vector.Vector, objects []*rigidbody.RigidBody) (vector.Vector, bool) {
+	distance := delta.Magnitude()
+	if distance == 0 {
+		return rb.Position, false
+	}
+
+	// Step at most a quarter of the body's smallest extent so thin colliders can't be skipped
+	stepSize := min(rb.Width, rb.Height) / 4
+	if rb.Shape == "circle" {
+		stepSize = rb.Radius / 2
+	}
+	if stepSize < 1 {
+		stepSize = 1
+	}
+	steps := int(math.Ceil(distance / stepSize))
+	step := delta.Scale(1.0 / float64(steps))
+
+	probe := *rb
+	last := rb.Position
+	for i := 1; i <= steps; i++ {
+		probe.Position = rb.Position.Add(step.Scale(float64(i)))
+
+		if probe.Position.X-probe.Width/2 < pe.worldBounds.MinX || probe.Position.X+probe.Width/2 > pe.worldBounds.MaxX ||
+			probe.Position.Y-probe.Height/2 < pe.worldBounds.MinY || probe.Position.Y+probe.Height/2 > pe.worldBounds.MaxY {
+			return last, true
+		}
+
+		for _, other := range objects {
+			if other == rb || other.IsMovable || !pe.canCollide(rb, other) {
+				continue
+			}
+			if !pe.aabbOverlap(&probe, other) {
+				continue
+			}
+			if pe.detectCollision(&probe, other).collided {
+				return last, true
+			}
+		}
+		last = probe.Position
+	}
+	return last, false
+}
+
+// Raycast reports whether the segment from -> to is blocked by a static body. Bodies are tested
+// by their bounding boxes, which is precise enough for line-of-sight checks against walls.
+// Bodies for which ignore returns true are skipped (ignore may be nil).
+func (pe *PhysicsEngine) Raycast(from, to vector.Vector, objects []*rigidbody.RigidBody, ignore func(*rigidbody.RigidBody) bool) bool {
+	dir := to.Sub(from)
+	for _, rb := range objects {
+		if rb.IsMovable || pe.noCollide[rb] || (ignore != nil && ignore(rb)) {
+			continue
+		}
+		halfW, halfH := rb.Width/2, rb.Height/2
+		if strings.ToLower(rb.Shape) == "circle" {
+			halfW, halfH = rb.Radius, rb.Radius
+		}
+		if segmentIntersectsBox(from, dir, rb.Position.X-halfW, rb.Position.Y-halfH, rb.Position.X+halfW, rb.Position.Y+halfH) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentIntersectsBox tests the segment from origin to origin+dir against an axis-aligned box (slab method)
+func segmentIntersectsBox(origin, dir vector.Vector, minX, minY, maxX, maxY float64) bool {
+	tMin, tMax := 0.0, 1.0
+	axes := [2]struct{ o, d, lo, hi float64 }{
+		{origin.X, dir.X, minX, maxX},
+		{origin.Y, dir.Y, minY, maxY},
+	}
+	for _, a := range axes {
+		if a.d == 0 {
+			if a.o < a.lo || a.o > a.hi {
+				return false
+			}
+			continue
+		}
+		t1 := (a.lo - a.o) / a.d
+		t2 := (a.hi - a.o) / a.d
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		tMin = max(tMin, t1)
+		tMax = min(tMax, t2)
+		if tMin > tMax {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryOverlap returns the bodies that overlap a probe body (circles exactly, rectangles by their
+// axis-aligned boxes). The probe doesn't need to be part of the world.
+func (pe *PhysicsEngine) QueryOverlap(probe *rigidbody.RigidBody, bodies []*rigidbody.RigidBody) []*rigidbody.RigidBody {
+	var out []*rigidbody.RigidBody
+	for _, rb := range bodies {
+		if rb != probe && pe.aabbOverlap(probe, rb) {
+			out = append(out, rb)
+		}
+	}
+	return out
 }
 
 func (pe *PhysicsEngine) aabbOverlap(a, b *rigidbody.RigidBody) bool {
@@ -264,19 +569,14 @@ func (pe *PhysicsEngine) detectCircleCollision(a, b *rigidbody.RigidBody) Collis
 
 // detectPolygonCollision checks for collision between two rigidbodies using SAT
 func (pe *PhysicsEngine) detectPolygonCollision(a, b *rigidbody.RigidBody) CollisionInfo {
-	// Get polygon vertices for both objects
-	verticesA := pe.getPolygonVertices(a)
-	verticesB := pe.getPolygonVertices(b)
-
-	// Get edges and normals for each polygon
-	edgesA := pe.getEdges(verticesA)
-	edgesB := pe.getEdges(verticesB)
-
-	normalsA := pe.getNormals(edgesA)
-	normalsB := pe.getNormals(edgesB)
+	// Get polygon vertices for both objects, outlines going into the scratch buffers
+	verticesA := pe.polygonVertices(a, &pe.scratch.a)
+	verticesB := pe.polygonVertices(b, &pe.scratch.b)
 
-	// Combine all normals to test
-	axes := append(normalsA, normalsB...)
+	// The edge normals of both polygons are the axes to test
+	axes := pe.appendNormals(pe.scratch.axes[:0], verticesA)
+	axes = pe.appendNormals(axes, verticesB)
+	pe.scratch.axes = axes
 
 	smallestOverlap := math.MaxFloat64
 	var smallestAxis vector.Vector
@@ -322,17 +622,25 @@ func (pe *PhysicsEngine) detectPolygonCollision(a, b *rigidbody.RigidBody) Colli
 }
 
 func (pe *PhysicsEngine) getPolygonVertices(rb *rigidbody.RigidBody) []vector.Vector {
+	var buf []vector.Vector
+	return pe.polygonVertices(rb, &buf)
+}
+
+// polygonVertices returns the vertices of a body: its registered polygon, or its outline written
+// over *buf (which keeps the grown buffer for the next call)
+func (pe *PhysicsEngine) polygonVertices(rb *rigidbody.RigidBody, buf *[]vector.Vector) []vector.Vector {
 	switch strings.ToLower(rb.Shape) {
 	case "circle":
-		return pe.createCirclePolygon(rb.Position, rb.Radius, 16)
+		*buf = pe.appendCirclePolygon((*buf)[:0], rb.Position, rb.Radius, 16)
 	case "polygon":
 		if customVertices := pe.getCustomPolygonVertices(rb); customVertices != nil {
 			return customVertices
 		}
-		return pe.createRectanglePolygon(rb.Position, rb.Width, rb.Height)
+		*buf = pe.appendRectanglePolygon((*buf)[:0], rb.Position, rb.Width, rb.Height)
 	default:
-		return pe.createRectanglePolygon(rb.Position, rb.Width, rb.Height)
+		*buf = pe.appendRectanglePolygon((*buf)[:0], rb.Position, rb.Width, rb.Height)
 	}
+	return *buf
 }
 
 // getCustomPolygonVertices retrieves custom polygon vertices from the registry
@@ -351,52 +659,42 @@ func (pe *PhysicsEngine) getCustomPolygonVertices(rb *rigidbody.RigidBody) []vec
 	return nil
 }
 
-// createRectanglePolygon creates vertices for a rectangle
-func (pe *PhysicsEngine) createRectanglePolygon(position vector.Vector, width, height float64) []vector.Vector {
+// appendRectanglePolygon appends the vertices of a rectangle to vertices
+func (pe *PhysicsEngine) appendRectanglePolygon(vertices []vector.Vector, position vector.Vector, width, height float64) []vector.Vector {
 	halfWidth := width / 2
 	halfHeight := height / 2
 
-	return []vector.Vector{
-		{X: position.X - halfWidth, Y: position.Y - halfHeight},
-		{X: position.X + halfWidth, Y: position.Y - halfHeight},
-		{X: position.X + halfWidth, Y: position.Y + halfHeight},
-		{X: position.X - halfWidth, Y: position.Y + halfHeight},
-	}
+	return append(vertices,
+		vector.Vector{X: position.X - halfWidth, Y: position.Y - halfHeight},
+		vector.Vector{X: position.X + halfWidth, Y: position.Y - halfHeight},
+		vector.Vector{X: position.X + halfWidth, Y: position.Y + halfHeight},
+		vector.Vector{X: position.X - halfWidth, Y: position.Y + halfHeight},
+	)
 }
 
-// createCirclePolygon approximates a circle with a regular polygon
-func (pe *PhysicsEngine) createCirclePolygon(position vector.Vector, radius float64, numVertices int) []vector.Vector {
+// appendCirclePolygon appends the vertices of a regular polygon approximating a circle
+func (pe *PhysicsEngine) appendCirclePolygon(vertices []vector.Vector, position vector.Vector, radius float64, numVertices int) []vector.Vector {
 	if numVertices < 3 {
 		numVertices = 8 // Minimum number of vertices
 	}
 
-	vertices := make([]vector.Vector, numVertices)
 	angleStep := 2 * math.Pi / float64(numVertices)
 
 	for i := 0; i < numVertices; i++ {
 		angle := float64(i) * angleStep
 		x := position.X + radius*math.Cos(angle)
 		y := position.Y + radius*math.Sin(angle)
-		vertices[i] = vector.Vector{X: x, Y: y}
+		vertices = append(vertices, vector.Vector{X: x, Y: y})
 	}
 
 	return vertices
 }
 
-// getEdges returns the edges of a polygon as vectors
-func (pe *PhysicsEngine) getEdges(vertices []vector.Vector) []vector.Vector {
-	edges := make([]vector.Vector, len(vertices))
+// appendNormals appends the normals of a polygon's edges to normals
+func (pe *PhysicsEngine) appendNormals(normals []vector.Vector, vertices []vector.Vector) []vector.Vector {
 	for i := 0; i < len(vertices); i++ {
-		edges[i] = vertices[(i+1)%len(vertices)].Sub(vertices[i])
-	}
-	return edges
-}
-
-// getNormals returns the normals of a polygon's edges
-func (pe *PhysicsEngine) getNormals(edges []vector.Vector) []vector.Vector {
-	normals := make([]vector.Vector, len(edges))
-	for i, edge := range edges {
-		normals[i] = vector.Vector{X: -edge.Y, Y: edge.X}.Normalize() // Perpendicular vector
+		edge := vertices[(i+1)%len(vertices)].Sub(vertices[i])
+		normals = append(normals, vector.Vector{X: -edge.Y, Y: edge.X}.Normalize()) // Perpendicular vector
 	}
 	return normals
 }
@@ -435,42 +733,70 @@ func (pe *PhysicsEngine) checkOverlap(min1, max1, min2, max2 float64) (bool, flo
 	return true, overlap2
 }
 
-// resolvePolygonCollision resolves a collision between two rigidbodies
-func (pe *PhysicsEngine) resolvePolygonCollision(a, b *rigidbody.RigidBody, info CollisionInfo, logger runtime.Logger) {
+// resolvePolygonCollision resolves a collision between two rigidbodies and returns how far it
+// moved them apart. Only the penetration beyond the slop is corrected, by the bias share of it.
+func (pe *PhysicsEngine) resolvePolygonCollision(a, b *rigidbody.RigidBody, info CollisionInfo, logger runtime.Logger) float64 {
 	// Skip if no collision
 	if !info.collided {
-		return
+		return 0
 	}
 
-	moveA := a.IsMovable
-	moveB := b.IsMovable
+	moveA := pe.moves(a)
+	moveB := pe.moves(b)
 
 	logger.Debug("Resolving polygon collision with depth: %.2f", info.depth)
 
-	// Apply the Minimum Translation Vector (MTV) to separate objects
+	// The part of the Minimum Translation Vector (MTV) the solver corrects this pass
+	correction := vector.Vector{}
+	if excess := info.depth - pe.slop; excess > 0 && info.depth > 0 {
+		correction = info.mtv.Scale(excess * pe.bias / info.depth)
+	}
+
+	// Apply the correction to separate objects
 	if moveA && moveB {
-		// Both objects are movable, move each by half
-		a.Position = a.Position.Sub(info.mtv.Scale(0.5))
-		b.Position = b.Position.Add(info.mtv.Scale(0.5))
+		// Both objects are movable: the lighter one moves further (by half each when both have
+		// infinite mass)
+		shareA, shareB := 0.5, 0.5
+		if invA, invB := InverseMass(a), InverseMass(b); invA+invB > 0 {
+			shareA, shareB = invA/(invA+invB), invB/(invA+invB)
+		}
+		a.Position = a.Position.Sub(correction.Scale(shareA))
+		b.Position = b.Position.Add(correction.Scale(shareB))
 		logger.Debug("Both objects movable: A moved by (%.2f, %.2f), B moved by (%.2f, %.2f)",
-			-info.mtv.X/2, -info.mtv.Y/2, info.mtv.X/2, info.mtv.Y/2)
+			-correction.X*shareA, -correction.Y*shareA, correction.X*shareB, correction.Y*shareB)
 
 		// Apply impulse to change velocities
 		pe.applyCollisionImpulse(a, b, info, logger)
 	} else if moveA && !moveB {
 		// Only A is movable
-		a.Position = a.Position.Sub(info.mtv)
-		logger.Debug("Only A movable: moved by (%.2f, %.2f)", -info.mtv.X, -info.mtv.Y)
-		a.Velocity = vector.Vector{X: 0, Y: 0}
+		a.Position = a.Position.Sub(correction)
+		logger.Debug("Only A movable: moved by (%.2f, %.2f)", -correction.X, -correction.Y)
+		normal := info.mtv.Scale(-1).Normalize()
+		a.Velocity = slideAlong(a.Velocity, normal)
+		pe.recordContact(a, normal)
 	} else if !moveA && moveB {
 		// Only B is movable
-		b.Position = b.Position.Add(info.mtv)
-		logger.Debug("Only B movable: moved by (%.2f, %.2f)", info.mtv.X, info.mtv.Y)
-		b.Velocity = vector.Vector{X: 0, Y: 0}
+		b.Position = b.Position.Add(correction)
+		logger.Debug("Only B movable: moved by (%.2f, %.2f)", correction.X, correction.Y)
+		normal := info.mtv.Normalize()
+		b.Velocity = slideAlong(b.Velocity, normal)
+		pe.recordContact(b, normal)
 	}
 
 	logger.Debug("After resolution - A: (%.2f, %.2f), B: (%.2f, %.2f)",
 		a.Position.X, a.Position.Y, b.Position.X, b.Position.Y)
+	return correction.Magnitude()
+}
+
+// slideAlong returns a velocity with the part going into a static collider taken out, normal
+// pointing away from the collider: what is left slides along its surface, so players moving
+// diagonally against a wall keep moving along it
+func slideAlong(velocity, normal vector.Vector) vector.Vector {
+	into := velocity.InnerProduct(normal)
+	if into >= 0 {
+		return velocity
+	}
+	return velocity.Sub(normal.Scale(into))
 }
 
 // applyCollisionImpulse applies an impulse to change object velocities after collision
@@ -492,14 +818,20 @@ func (pe *PhysicsEngine) applyCollisionImpulse(a, b *rigidbody.RigidBody, info C
 		return
 	}
 
+	// Bodies of infinite mass take no impulse; two of them don't exchange any
+	invA, invB := InverseMass(a), InverseMass(b)
+	if invA+invB == 0 {
+		return
+	}
+
 	// Calculate impulse scalar
 	impulseScalar := -(1 + restitution) * velAlongNormal
-	impulseScalar /= 1/a.Mass + 1/b.Mass
+	impulseScalar /= invA + invB
 
 	// Apply impulse
 	impulse := normal.Scale(impulseScalar)
-	a.Velocity = a.Velocity.Sub(impulse.Scale(1 / a.Mass))
-	b.Velocity = b.Velocity.Add(impulse.Scale(1 / b.Mass))
+	a.Velocity = a.Velocity.Sub(impulse.Scale(invA))
+	b.Velocity = b.Velocity.Add(impulse.Scale(invB))
 
 	logger.Debug("Applied impulse: %.2f, new velocities - A: (%.2f, %.2f), B: (%.2f, %.2f)",
 		impulseScalar, a.Velocity.X, a.Velocity.Y, b.Velocity.X, b.Velocity.Y)
@@ -635,6 +967,40 @@ func (pe *PhysicsEngine) DumpPolygonRegistry(logger runtime.Logger) {
 	}
 }
 
+// Masses follow the inverse mass convention: a Mass of 0 means infinite mass, the mass of static
+// colliders. The solver only ever multiplies by InverseMass, which is 0 for those, so a body
+// flagged movable by mistake can't turn velocities into Inf or NaN.
+
+// InverseMass returns 1/mass of a body, or 0 for static bodies and bodies of infinite mass
+func InverseMass(rb *rigidbody.RigidBody) float64 {
+	if !rb.IsMovable || !(rb.Mass > 0) || math.IsInf(rb.Mass, 1) || rb.Mass >= rigidbody.Infinite_mass {
+		return 0
+	}
+	return 1 / rb.Mass
+}
+
+// SetMass gives a movable body its mass. Masses that aren't positive and finite are stored as 0,
+// infinite mass: the body still moves by its own velocity but collisions don't push it.
+func SetMass(rb *rigidbody.RigidBody, mass float64) {
+	if !(mass > 0) || math.IsInf(mass, 1) || mass >= rigidbody.Infinite_mass {
+		mass = 0
+	}
+	rb.Mass = mass
+}
+
+// SetMovable makes a body movable with a mass (see SetMass)
+func SetMovable(rb *rigidbody.RigidBody, mass float64) {
+	rb.IsMovable = true
+	SetMass(rb, mass)
+}
+
+// SetStatic makes a body a static collider at rest, of infinite mass
+func SetStatic(rb *rigidbody.RigidBody) {
+	rb.IsMovable = false
+	rb.Mass = 0
+	rb.Velocity = vector.Vector{}
+}
+
 // MakeRectangleRigidBody creates a rectangle rigidbody centered at (cx,cy)
 func MakeRectangleRigidBody(cx, cy, width, height float64) *rigidbody.RigidBody {
 	return &rigidbody.RigidBody{
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Privacy settings: who may see a part of a player's whereabouts
+const (
+	PrivacyEveryone = "everyone"
+	PrivacyFriends  = "friends" // mutual friends
+	PrivacyNobody   = "nobody"
+)
+
+// Privacy defaults for players who never set any
+const (
+	defaultLocationPrivacy = PrivacyFriends
+	defaultLastSeenPrivacy = PrivacyEveryone
+	maxFriendScan          = 1000 // mutual friends checked when a setting is friends-only
+	friendPageSize         = 100
+)
+
+var (
+	errLocationPlayersOnly = runtime.NewError("only players can look up other players", rpcCodeUnauthenticated)
+	errUnknownPlayer       = runtime.NewError("no such player", rpcCodeNotFound)
+	errInvalidPrivacy      = runtime.NewError("privacy settings must be everyone, friends or nobody", rpcCodeInvalidArgument)
+)
+
+// PlayerLocation is what player_location returns. Parts the target's privacy settings hide
+// from the caller are left out.
+type PlayerLocation struct {
+	UserID   string     `json:"userId"`
+	Username string     `json:"username"`
+	Level    int        `json:"level"`
+	Online   *bool      `json:"online,omitempty"`
+	LastSeen *time.Time `json:"lastSeen,omitempty"` // when the player last left an open world match
+	Map      string     `json:"map,omitempty"`
+	Region   string     `json:"region,omitempty"`
+	Position *struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+	} `json:"position,omitempty"`
+}
+
+// RegisterPlayerLocationRpcs registers the RPCs that show where players were last seen, or are now
+func RegisterPlayerLocationRpcs(initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("player_location", rpcPlayerLocation); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc("friends_online", rpcFriendsOnline); err != nil {
+		return err
+	}
+	return initializer.RegisterRpc("player_privacy", rpcPlayerPrivacy)
+}
+
+// rpcPlayerLocation returns where and when a player was last seen, from what was saved when they
+// last left an open world match, so social screens don't need to join a match.
+// Payload: {"userId": "..."} or {"username": "..."}
+func rpcPlayerLocation(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	callerID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if callerID == "" {
+		return "", errLocationPlayersOnly
+	}
+	var req struct {
+		UserID   string `json:"userId"`
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || (req.UserID == "") == (req.Username == "") {
+		return "", errInvalidPayload
+	}
+
+	var users []*api.User
+	var err error
+	if req.UserID != "" {
+		users, err = nk.UsersGetId(ctx, []string{req.UserID}, nil)
+	} else {
+		users, err = nk.UsersGetUsername(ctx, []string{req.Username})
+	}
+	if err != nil {
+		logger.Error("Failed to look up player %s%s: %v", req.UserID, req.Username, err)
+		return "", errInternalFailure
+	}
+	if len(users) == 0 {
+		return "", errUnknownPlayer
+	}
+	user := users[0]
+
+	dm := NewDatabaseManager(logger, nk)
+	saved, err := dm.FindPlayerData(ctx, user.GetId())
+	if err != nil {
+		return "", errInternalFailure
+	}
+	privacy, err := dm.LoadPrivacy(ctx, user.GetId())
+	if err != nil {
+		return "", errInternalFailure
+	}
+
+	location := PlayerLocation{UserID: user.GetId(), Username: user.GetUsername(), Level: 1}
+	if saved != nil {
+		location.Level = saved.Level
+	}
+	friend := false
+	if callerID != user.GetId() && (privacy.Location == PrivacyFriends || privacy.LastSeen == PrivacyFriends) {
+		if friend, err = mutualFriends(ctx, nk, user.GetId(), callerID); err != nil {
+			logger.Error("Failed to list the friends of %s: %v", user.GetId(), err)
+			return "", errInternalFailure
+		}
+	}
+	if privacyAllows(privacy.LastSeen, callerID == user.GetId(), friend) {
+		online := user.GetOnline()
+		location.Online = &online
+		if saved != nil {
+			location.LastSeen = &saved.LastLoginTime
+		}
+	}
+	if saved != nil && privacyAllows(privacy.Location, callerID == user.GetId(), friend) {
+		location.Map = saved.Map
+		location.Region = saved.Region
+		location.Position = &struct {
+			X float64 `json:"x"`
+			Y float64 `json:"y"`
+		}{saved.Position.X, saved.Position.Y}
+	}
+
+	out, err := json.Marshal(location)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// rpcPlayerPrivacy reads or changes who may see the caller's whereabouts. Settings left out of
+// the payload are kept.
+// Payload: {"location": "friends", "lastSeen": "everyone"} or {} to read
+func rpcPlayerPrivacy(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errLocationPlayersOnly
+	}
+	var req struct {
+		Location string `json:"location"`
+		LastSeen string `json:"lastSeen"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+	for _, setting := range []string{req.Location, req.LastSeen} {
+		switch setting {
+		case "", PrivacyEveryone, PrivacyFriends, PrivacyNobody:
+		default:
+			return "", errInvalidPrivacy
+		}
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	privacy, err := dm.LoadPrivacy(ctx, userID)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	if req.Location != "" || req.LastSeen != "" {
+		if req.Location != "" {
+			privacy.Location = req.Location
+		}
+		if req.LastSeen != "" {
+			privacy.LastSeen = req.LastSeen
+		}
+		if err := dm.SavePrivacy(ctx, userID, privacy); err != nil {
+			return "", errInternalFailure
+		}
+	}
+
+	out, err := json.Marshal(privacy)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// privacyAllows reports whether a setting shows a player's data to a caller
+func privacyAllows(setting string, self, friend bool) bool {
+	switch setting {
+	case PrivacyEveryone:
+		return true
+	case PrivacyFriends:
+		return self || friend
+	default:
+		return self
+	}
+}
+
+// mutualFriendSet returns the IDs of the first maxFriendScan mutual friends of userID
+func mutualFriendSet(ctx context.Context, nk runtime.NakamaModule, userID string) (map[string]bool, error) {
+	mutual := 0
+	cursor := ""
+	ids := make(map[string]bool)
+	for scanned := 0; scanned < maxFriendScan; scanned += friendPageSize {
+		friends, next, err := nk.FriendsList(ctx, userID, friendPageSize, &mutual, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, friend := range friends {
+			ids[friend.GetUser().GetId()] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	return ids, nil
+}
+
+// mutualFriends reports whether otherID is among the first maxFriendScan mutual friends of userID
+func mutualFriends(ctx context.Context, nk runtime.NakamaModule, userID, otherID string) (bool, error) {
+	mutual := 0
+	cursor := ""
+	for scanned := 0; scanned < maxFriendScan; scanned += friendPageSize {
+		friends, next, err := nk.FriendsList(ctx, userID, friendPageSize, &mutual, cursor)
+		if err != nil {
+			return false, err
+		}
+		for _, friend := range friends {
+			if friend.GetUser().GetId() == otherID {
+				return true, nil
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	return false, nil
+}
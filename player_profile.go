@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// profileCollections are the storage collections a player profile is built from, all keyed by
+// the player's ID. Their object versions make up the profile's ETag.
+var profileCollections = []string{
+	COLLECTION_PLAYER_DATA,
+	COLLECTION_INVENTORY,
+	COLLECTION_PLAYER_STATS,
+	COLLECTION_QUESTS,
+	COLLECTION_REPUTATION,
+	COLLECTION_EXPLORATION,
+}
+
+var errProfilePlayersOnly = runtime.NewError("only players have a profile", rpcCodeUnauthenticated)
+
+// PlayerProfile is what player_profile returns: the consolidated saved state of the caller
+type PlayerProfile struct {
+	UserID       string                    `json:"userId"`
+	Username     string                    `json:"username"`
+	ETag         string                    `json:"etag"`
+	UpdatedAt    time.Time                 `json:"updatedAt"` // latest save of any part
+	Level        int                       `json:"level"`
+	PlayTime     float64                   `json:"playTime"` // seconds
+	LastSeen     *time.Time                `json:"lastSeen,omitempty"`
+	Location     *ProfileLocation          `json:"location,omitempty"`
+	Wallet       map[string]int64          `json:"wallet"`
+	Stats        *PersistedPlayerStats     `json:"stats"`
+	Inventory    ProfileInventory          `json:"inventory"`
+	Achievements []string                  `json:"achievements"`
+	Quests       ProfileQuests             `json:"quests"`
+	Reputation   map[string]int            `json:"reputation"`  // faction ID -> standing
+	Exploration  map[string]ProfileExplore `json:"exploration"` // map name -> explored share
+}
+
+// ProfileLocation is where the player was saved when they last left an open world match
+type ProfileLocation struct {
+	Map    string  `json:"map,omitempty"`
+	Region string  `json:"region,omitempty"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+}
+
+// ProfileInventory summarizes the player's item stacks
+type ProfileInventory struct {
+	Stacks int            `json:"stacks"` // distinct items
+	Total  int            `json:"total"`  // items over all stacks
+	Items  map[string]int `json:"items"`  // item ID -> count
+}
+
+// ProfileQuests summarizes the player's quest log
+type ProfileQuests struct {
+	Active    []string       `json:"active"`    // quest IDs, sorted
+	Completed map[string]int `json:"completed"` // quest ID -> times turned in
+}
+
+// ProfileExplore is how much of one map the player explored
+type ProfileExplore struct {
+	Explored int     `json:"explored"` // chunks
+	Total    int     `json:"total"`
+	Percent  float64 `json:"percent"`
+}
+
+// rpcPlayerProfile returns the caller's consolidated profile (stats, inventory, achievements,
+// quests, reputation, exploration and last location) for external services such as the
+// companion web app, so they don't read raw storage keys. The profile carries an ETag made of
+// the versions of the storage objects and the wallet it was built from; a caller that sends the
+// ETag it has gets {"etag", "notModified": true} while nothing changed.
+// Payload: {"etag": "optional"}
+func rpcPlayerProfile(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errProfilePlayersOnly
+	}
+	var req struct {
+		ETag string `json:"etag"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+
+	reads := make([]*runtime.StorageRead, 0, len(profileCollections))
+	for _, collection := range profileCollections {
+		reads = append(reads, &runtime.StorageRead{Collection: collection, Key: userID, UserID: userID})
+	}
+	objects, err := storeFor(nk).Read(ctx, reads)
+	if err != nil {
+		logger.Error("Failed to read the profile of %s: %v", userID, err)
+		return "", errInternalFailure
+	}
+	username, wallet, err := accountWallet(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Failed to read the account of %s: %v", userID, err)
+		return "", errInternalFailure
+	}
+
+	etag := profileETag(objects, wallet)
+	if req.ETag != "" && req.ETag == etag {
+		out, err := json.Marshal(map[string]interface{}{"etag": etag, "notModified": true})
+		if err != nil {
+			return "", errInternalFailure
+		}
+		return string(out), nil
+	}
+
+	profile, err := buildPlayerProfile(userID, username, wallet, objects)
+	if err != nil {
+		logger.Error("Failed to build the profile of %s: %v", userID, err)
+		return "", errInternalFailure
+	}
+	profile.ETag = etag
+
+	out, err := json.Marshal(profile)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// profileETag hashes the collections and versions of the profile's storage objects and the
+// wallet, which has no storage version of its own
+func profileETag(objects []*api.StorageObject, wallet map[string]int64) string {
+	versions := make([]string, 0, len(objects))
+	for _, object := range objects {
+		versions = append(versions, object.GetCollection()+"="+object.GetVersion())
+	}
+	sort.Strings(versions)
+
+	h := sha256.New()
+	for _, version := range versions {
+		h.Write([]byte(version))
+		h.Write([]byte{0})
+	}
+	walletJSON, _ := json.Marshal(wallet) // map keys are sorted
+	h.Write(walletJSON)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// buildPlayerProfile assembles a profile from the player's storage objects; parts the player
+// never saved are left empty
+func buildPlayerProfile(userID, username string, wallet map[string]int64, objects []*api.StorageObject) (*PlayerProfile, error) {
+	profile := &PlayerProfile{
+		UserID:       userID,
+		Username:     username,
+		Level:        1,
+		Wallet:       wallet,
+		Stats:        &PersistedPlayerStats{PlayerID: userID},
+		Inventory:    ProfileInventory{Items: map[string]int{}},
+		Achievements: []string{},
+		Quests:       ProfileQuests{Active: []string{}, Completed: map[string]int{}},
+		Reputation:   map[string]int{},
+		Exploration:  map[string]ProfileExplore{},
+	}
+
+	for _, object := range objects {
+		if updated := object.GetUpdateTime().AsTime(); updated.After(profile.UpdatedAt) {
+			profile.UpdatedAt = updated
+		}
+		value := []byte(object.GetValue())
+		switch object.GetCollection() {
+		case COLLECTION_PLAYER_DATA:
+			var data PersistedPlayerData
+			if err := json.Unmarshal(value, &data); err != nil {
+				return nil, err
+			}
+			profile.Level = data.Level
+			profile.PlayTime = data.PlayTime.Seconds()
+			lastSeen := data.LastLoginTime
+			profile.LastSeen = &lastSeen
+			profile.Location = &ProfileLocation{Map: data.Map, Region: data.Region, X: data.Position.X, Y: data.Position.Y}
+			if data.Achievements != nil {
+				profile.Achievements = data.Achievements
+			}
+		case COLLECTION_INVENTORY:
+			var inventory PersistedInventory
+			if err := json.Unmarshal(value, &inventory); err != nil {
+				return nil, err
+			}
+			for itemID, count := range inventory.Items {
+				if count <= 0 {
+					continue
+				}
+				profile.Inventory.Items[itemID] = count
+				profile.Inventory.Stacks++
+				profile.Inventory.Total += count
+			}
+		case COLLECTION_PLAYER_STATS:
+			if err := json.Unmarshal(value, profile.Stats); err != nil {
+				return nil, err
+			}
+		case COLLECTION_QUESTS:
+			var log PersistedQuestLog
+			if err := json.Unmarshal(value, &log); err != nil {
+				return nil, err
+			}
+			for questID := range log.Active {
+				profile.Quests.Active = append(profile.Quests.Active, questID)
+			}
+			sort.Strings(profile.Quests.Active)
+			if log.Completed != nil {
+				profile.Quests.Completed = log.Completed
+			}
+		case COLLECTION_REPUTATION:
+			var reputation PersistedReputation
+			if err := json.Unmarshal(value, &reputation); err != nil {
+				return nil, err
+			}
+			if reputation.Standings != nil {
+				profile.Reputation = reputation.Standings
+			}
+		case COLLECTION_EXPLORATION:
+			var exploration PersistedExploration
+			if err := json.Unmarshal(value, &exploration); err != nil {
+				return nil, err
+			}
+			for mapName, explored := range exploration.Maps {
+				if explored == nil {
+					continue
+				}
+				profile.Exploration[mapName] = mapExplore(explored)
+			}
+		}
+	}
+	return profile, nil
+}
+
+// mapExplore counts the explored chunks of a map
+func mapExplore(explored *PersistedMapExploration) ProfileExplore {
+	out := ProfileExplore{Total: explored.Columns * explored.Rows}
+	for _, b := range explored.Chunks {
+		out.Explored += bits.OnesCount8(b)
+	}
+	if out.Total > 0 {
+		out.Percent = float64(out.Explored) * 100 / float64(out.Total)
+	}
+	return out
+}
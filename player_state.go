@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"math"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// defaultMaxHealth is the health a freshly spawned player starts with
+const defaultMaxHealth = 100.0
+
+// Sprint/stamina tuning. Rates are per second.
+const (
+	defaultMaxStamina        = 100.0
+	sprintSpeedMultiplier    = 1.6  // sprinting raises the movement cap by this factor
+	sprintStaminaDrain       = 25.0 // stamina spent per second while sprinting and moving
+	staminaRegenRate         = 20.0 // stamina recovered per second once regen kicks in
+	staminaRegenDelayTicks   = TickRate / 2
+	playerStatusSyncInterval = 10 // ticks between player_status messages for players whose stats changed
+)
+
+// PlayerState holds per-player gameplay state that isn't part of the physics body
+type PlayerState struct {
+	PlayerID             string
+	Role                 string                   // account metadata role (RoleGM, RoleAdmin or "" for players)
+	Locale               string                   // account language tag server messages are rendered in ("" = defaultLocale)
+	GMMode               bool                     // GM commands are enabled (gm.go)
+	GodMode              bool                     // a GM who ignores all damage
+	DashReadyTick        int64                    // first tick at which the player may dash again
+	AbilityReady         map[string]int64         // ability ID -> first tick the ability may be cast again
+	HealthComponent                               // health, armor, resistances and i-frames (health.go)
+	Died                 bool                     // set once the death was handled; only respawn is accepted until it clears
+	RespawnReadyTick     int64                    // first tick at which respawn is accepted
+	ProtectedUntil       int64                    // spawn protection lasts until this tick (spawn_protection.go)
+	Team                 string                   // spawn group the player respawns at (set by scripts)
+	Buffs                map[string]*PlayerBuff   // stat -> active buff
+	Effects              map[string]*StatusEffect // effect ID -> active status effect (status_effects.go)
+	Target               *PlayerTarget            // current target lock (nil when none)
+	MountID              int                      // object ID of the ridden mount (0 when on foot)
+	Mount                *MountStats              // movement parameters of the ridden mount (nil when on foot)
+	lastSteerTick        int64                    // tick of the last mounted move; bounds how far the mount may turn
+	HeldObjectID         int                      // carried object (0 when empty-handed)
+	lastHealth           float64                  // health at the previous held-object update; a drop means damage
+	Facing               float64                  // aim/facing angle in radians (0 = +X, clockwise in screen space since +Y points down)
+	Stamina              float64
+	MaxStamina           float64
+	Sprinting            bool    // set by move inputs with sprint; cleared when stamina runs out
+	LastSprintTick       int64   // last tick stamina was spent; regen waits staminaRegenDelayTicks after it
+	MoveMode             string  // MoveModeWalk or MoveModeSwim
+	Muddy                bool    // walking on a rain-soaked "dirt" tile (weather.go)
+	TerrainSpeed         float64 // speed factor of the tile underfoot (terrain.go; 0 until first set, meaning 1)
+	speedPeak            float64 // highest max speed within cheatSpeedWindow (cheat_reports.go)
+	speedPeakTick        int64   // when speedPeak was set
+	Elevation            float64 // height level the player stands on (elevation.go)
+	groundPos            vector.Vector
+	groundRamp           bool // the player stood on a ramp tile at groundPos
+	groundKnown          bool // Elevation and groundPos were set since the player joined
+	Oxygen               float64
+	MaxOxygen            float64
+	PvPFlagged           bool           // opted into contested PvP (pvp.go)
+	PvPFlagReadyTick     int64          // first tick the PvP flag may change again
+	PvPCombatTick        int64          // last tick the player dealt or took PvP damage
+	PvPZone              string         // PvP mode of the area the player stands in
+	Region               string         // ID of the region the player stands in ("" outside regions, regions.go)
+	Stealthed            bool           // hidden from players who haven't detected them (stealth.go)
+	StealthDetected      bool           // someone detected the player while stealthed
+	Light                float64        // radius of the light the player carries (0 when none, vision.go)
+	LightItem            string         // item ID of the carried light
+	StealthRevealedUntil int64          // stealth is suppressed until this tick after attacking, casting or getting hurt
+	Checkpoint           *vector.Vector // respawn point set by the last checkpoint waypoint reached (waypoints.go)
+	Karma                int            // persisted; negative after killing unflagged players
+	Survival             bool           // the map runs the hunger and thirst meters (survival.go)
+	Hunger               float64        // persisted per player on survival maps
+	Thirst               float64
+	Cutscene             *Cutscene // running camera directive (nil when none, cutscene.go)
+	statusDirty          bool      // health/stamina changed since the last player_status message
+	inputTick            int64     // tick inputsThisTick counts for
+	inputsThisTick       int
+	actionUsage          map[string]*actionUsage // action -> recent use, for actionLimits
+}
+
+// PlayerStatus is sent to the owning player so the UI can display their resources
+type PlayerStatus struct {
+	Health     float64            `json:"health"`
+	MaxHealth  float64            `json:"maxHealth"`
+	Stamina    float64            `json:"stamina"`
+	MaxStamina float64            `json:"maxStamina"`
+	Sprinting  bool               `json:"sprinting"`
+	Oxygen     float64            `json:"oxygen"`
+	MaxOxygen  float64            `json:"maxOxygen"`
+	Target     *PlayerTarget      `json:"target"` // current target lock (null when none)
+	Shield     float64            `json:"shield"`
+	Effects    []EffectData       `json:"effects"`
+	PvPFlag    bool               `json:"pvpFlag"`
+	PvPZone    string             `json:"pvpZone"` // safe, contested or war
+	Karma      int                `json:"karma"`
+	Outlaw     bool               `json:"outlaw"`
+	Stealthed  bool               `json:"stealthed"`
+	Detected   bool               `json:"detected"`            // someone has noticed the stealthed player
+	Survival   *SurvivalStatus    `json:"survival,omitempty"`  // hunger and thirst, on survival maps only
+	Protection float64            `json:"protection"`          // seconds of spawn protection left (0 = none)
+	Cooldowns  map[string]float64 `json:"cooldowns,omitempty"` // ability ID -> seconds until it can be cast again
+}
+
+// PlayerBuff is a temporary bonus to a stat (e.g. from a consumable)
+type PlayerBuff struct {
+	Stat        string  `json:"stat"`
+	Amount      float64 `json:"amount"`
+	ExpiresTick int64   `json:"expiresTick"`
+}
+
+// NewPlayerState creates the gameplay state for a newly spawned player
+func NewPlayerState(playerID string) *PlayerState {
+	return &PlayerState{
+		PlayerID:        playerID,
+		HealthComponent: HealthComponent{Health: defaultMaxHealth, MaxHealth: defaultMaxHealth},
+		Stamina:         defaultMaxStamina,
+		MaxStamina:      defaultMaxStamina,
+		MoveMode:        MoveModeWalk,
+		Oxygen:          defaultMaxOxygen,
+		MaxOxygen:       defaultMaxOxygen,
+		Buffs:           make(map[string]*PlayerBuff),
+		Effects:         make(map[string]*StatusEffect),
+		AbilityReady:    make(map[string]int64),
+		// send the initial status with the first sync after spawning
+		statusDirty: true,
+	}
+}
+
+// GetPlayerState returns the gameplay state for a player, creating it if needed
+func (gs *GameMatchState) GetPlayerState(playerID string) *PlayerState {
+	if gs.playerStates == nil {
+		gs.playerStates = make(map[string]*PlayerState)
+	}
+	state, ok := gs.playerStates[playerID]
+	if !ok {
+		state = NewPlayerState(playerID)
+		gs.playerStates[playerID] = state
+	}
+	return state
+}
+
+// IsDead reports whether the player has no health left
+func (ps *PlayerState) IsDead() bool {
+	return ps.Health <= 0
+}
+
+// Heal restores health up to MaxHealth and returns the amount actually restored
+func (ps *PlayerState) Heal(amount float64) float64 {
+	before := ps.Health
+	ps.Health = min(ps.MaxHealth, ps.Health+amount)
+	if ps.Health != before {
+		ps.statusDirty = true
+	}
+	return ps.Health - before
+}
+
+// AddBuff applies (or refreshes) a buff on a stat until expiresTick
+func (ps *PlayerState) AddBuff(stat string, amount float64, expiresTick int64) {
+	ps.Buffs[stat] = &PlayerBuff{Stat: stat, Amount: amount, ExpiresTick: expiresTick}
+}
+
+// BuffAmount returns the active bonus for a stat, dropping the buff once it has expired
+func (ps *PlayerState) BuffAmount(stat string, tick int64) float64 {
+	buff, ok := ps.Buffs[stat]
+	if !ok {
+		return 0
+	}
+	if tick >= buff.ExpiresTick {
+		delete(ps.Buffs, stat)
+		return 0
+	}
+	return buff.Amount
+}
+
+// SpendResource deducts amount from a resource pool if the player can afford it
+func (ps *PlayerState) SpendResource(resource string, amount float64) bool {
+	if amount <= 0 {
+		return true
+	}
+	switch resource {
+	case AbilityResourceStamina:
+		if ps.Stamina < amount {
+			return false
+		}
+		ps.Stamina -= amount
+	case AbilityResourceHealth:
+		// Health costs can't be lethal
+		if ps.Health <= amount {
+			return false
+		}
+		ps.Health -= amount
+	default:
+		return false
+	}
+	ps.statusDirty = true
+	return true
+}
+
+// RefundResource gives back a cost spent by SpendResource
+func (ps *PlayerState) RefundResource(resource string, amount float64) {
+	switch resource {
+	case AbilityResourceStamina:
+		ps.Stamina = min(ps.MaxStamina, ps.Stamina+amount)
+	case AbilityResourceHealth:
+		ps.Health = min(ps.MaxHealth, ps.Health+amount)
+	}
+	ps.statusDirty = true
+}
+
+// MaxSpeed returns the player's current movement cap in pixels per second (buffs, slows and sprint
+// included), given the unbuffed cap of the game config
+func (ps *PlayerState) MaxSpeed(base float64, tick int64) float64 {
+	speed := base + ps.BuffAmount("speed", tick)
+	if ps.Mount != nil {
+		speed *= ps.Mount.Speed
+	}
+	if ps.MoveMode == MoveModeSwim {
+		speed *= swimSpeedMultiplier
+	}
+	if ps.Sprinting && ps.Stamina > 0 {
+		speed *= sprintSpeedMultiplier
+	}
+	if ps.TerrainSpeed > 0 {
+		speed *= ps.TerrainSpeed
+	}
+	return speed * (1 - ps.EffectSlow())
+}
+
+// Status returns the resource snapshot sent to the owning player
+func (ps *PlayerState) Status(tick int64) PlayerStatus {
+	return PlayerStatus{
+		Health:     ps.Health,
+		MaxHealth:  ps.MaxHealth,
+		Stamina:    ps.Stamina,
+		MaxStamina: ps.MaxStamina,
+		Sprinting:  ps.Sprinting,
+		Oxygen:     ps.Oxygen,
+		MaxOxygen:  ps.MaxOxygen,
+		Target:     ps.Target,
+		Shield:     ps.Shield,
+		Effects:    ps.EffectList(tick),
+		PvPFlag:    ps.PvPFlagged,
+		PvPZone:    ps.PvPZone,
+		Karma:      ps.Karma,
+		Outlaw:     ps.Outlaw(),
+		Stealthed:  ps.Stealthed,
+		Detected:   ps.StealthDetected,
+		Survival:   ps.SurvivalStatus(),
+		Protection: max(0, float64(ps.ProtectedUntil-tick)) / TickRate,
+		Cooldowns:  ps.CooldownList(tick),
+	}
+}
+
+// CooldownList returns the seconds left on the abilities still cooling down
+func (ps *PlayerState) CooldownList(tick int64) map[string]float64 {
+	var cooldowns map[string]float64
+	for abilityID, ready := range ps.AbilityReady {
+		if ready > tick {
+			if cooldowns == nil {
+				cooldowns = make(map[string]float64)
+			}
+			cooldowns[abilityID] = float64(ready-tick) / TickRate
+		}
+	}
+	return cooldowns
+}
+
+// updateStamina drains stamina while sprinting and moving and regenerates it after a short
+// rest. When stamina runs out the sprint ends and the body is slowed back to the normal cap.
+func (ps *PlayerState) updateStamina(rb *rigidbody.RigidBody, baseSpeed float64, tick int64) {
+	moving := rb.Velocity.Magnitude() > 0
+	if ps.Sprinting && moving {
+		before := ps.Stamina
+		ps.Stamina = max(0, ps.Stamina-sprintStaminaDrain/TickRate)
+		ps.LastSprintTick = tick
+		if ps.Stamina != before {
+			ps.statusDirty = true
+		}
+		if ps.Stamina == 0 {
+			ps.Sprinting = false
+			if limit := ps.MaxSpeed(baseSpeed, tick); rb.Velocity.Magnitude() > limit {
+				rb.Velocity = rb.Velocity.Scale(limit / rb.Velocity.Magnitude())
+			}
+		}
+		return
+	}
+
+	if ps.Stamina < ps.MaxStamina && tick-ps.LastSprintTick >= staminaRegenDelayTicks {
+		ps.Stamina = min(ps.MaxStamina, ps.Stamina+staminaRegenRate/TickRate)
+		ps.statusDirty = true
+	}
+}
+
+// UpdatePlayerStates advances per-tick player state and handles players who just died.
+// Called from the match loop before physics.
+func (gs *GameMatchState) UpdatePlayerStates(ctx context.Context, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	for playerID, rb := range gs.PlayerBodies() {
+		state := gs.GetPlayerState(playerID)
+		if state.IsDead() {
+			if !state.Died {
+				gs.handleDeath(ctx, playerID, dispatcher, logger)
+			}
+			continue
+		}
+		gs.updateSwimming(state, rb)
+		gs.updateGroundDrag(state, rb)
+		gs.updateTerrain(state, rb)
+		gs.updatePvPZone(state, rb.Position)
+		gs.updateRegion(ctx, playerID, state, rb.Position, dispatcher, logger)
+		state.updateStamina(rb, gs.config.PlayerMaxSpeed, gs.currentTick)
+		gs.updateEffects(playerID, state, dispatcher, logger)
+	}
+}
+
+// SyncPlayerStatus sends player_status to every player whose health or stamina changed,
+// at most once every playerStatusSyncInterval ticks
+func (gs *GameMatchState) SyncPlayerStatus(dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if gs.currentTick%playerStatusSyncInterval != 0 || dispatcher == nil {
+		return
+	}
+	for playerID, state := range inOrder(sortedKeys(gs.playerStates), gs.playerStates) {
+		if !state.statusDirty {
+			continue
+		}
+		presence, ok := gs.presences[playerID]
+		if !ok {
+			continue
+		}
+		state.statusDirty = false
+
+		data, err := EncodeMessage(OpCodePlayerStatus, "player_status", state.Status(gs.currentTick))
+		if err != nil {
+			logger.Error("Failed to marshal player status for %s: %v", playerID, err)
+			continue
+		}
+		dispatcher.BroadcastMessage(OpCodePlayerStatus, data, []runtime.Presence{presence}, nil, true)
+	}
+}
+
+// SetFacing stores a facing angle normalised to (-Pi, Pi]
+func (ps *PlayerState) SetFacing(angle float64) {
+	if math.IsNaN(angle) || math.IsInf(angle, 0) {
+		return
+	}
+	ps.Facing = math.Atan2(math.Sin(angle), math.Cos(angle))
+}
+
+// FacingVector returns the unit vector the player is facing
+func (ps *PlayerState) FacingVector() vector.Vector {
+	return vector.Vector{X: math.Cos(ps.Facing), Y: math.Sin(ps.Facing)}
+}
+
+// inFacingCone reports whether target lies within maxRange of origin and no more than halfAngle
+// radians away from the facing direction. Used for attack cones, shield blocking and perception.
+// A maxRange of 0 or less ignores distance.
+func inFacingCone(origin vector.Vector, facing float64, target vector.Vector, halfAngle, maxRange float64) bool {
+	delta := target.Sub(origin)
+	dist := delta.Magnitude()
+	if maxRange > 0 && dist > maxRange {
+		return false
+	}
+	if dist == 0 {
+		return true
+	}
+	diff := math.Atan2(delta.Y, delta.X) - facing
+	diff = math.Atan2(math.Sin(diff), math.Cos(diff))
+	return math.Abs(diff) <= halfAngle
+}
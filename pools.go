@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Pools for the allocations of the match loop's hot paths. At 60 ticks a second the world
+// broadcasts, overlap probes and collision checks of a busy match would otherwise allocate
+// thousands of short-lived objects a second. What is shared between matches is a sync.Pool;
+// what only one match loop touches is a slice or map of its own, reused from tick to tick (the
+// encode buffers of world updates are in broadcast_encoder.go).
+
+var probeBodies = sync.Pool{New: func() any { return new(rigidbody.RigidBody) }}
+
+// acquireCircleProbe returns a pooled static circle body at (cx,cy) for an overlap query. Give
+// it back with releaseProbe once the query is done; probes are never added to the world.
+func acquireCircleProbe(cx, cy, r float64) *rigidbody.RigidBody {
+	probe := probeBodies.Get().(*rigidbody.RigidBody)
+	*probe = rigidbody.RigidBody{Position: vector.Vector{X: cx, Y: cy}, Shape: "circle", Radius: r}
+	return probe
+}
+
+// releaseProbe puts a probe of acquireCircleProbe back in the pool
+func releaseProbe(probe *rigidbody.RigidBody) {
+	probeBodies.Put(probe)
+}
+
+// collisionScratch holds the vertices and axes of the SAT test, reused by every check of a
+// physics engine (its match loop is the only caller)
+type collisionScratch struct {
+	a, b []vector.Vector // outlines of bodies without a registered polygon
+	axes []vector.Vector
+}
+
+// SnapshotArena holds the map and slices a world broadcast fills, reused from one broadcast to
+// the next. What it hands out is only valid until the next broadcast.
+type SnapshotArena struct {
+	players map[string]PlayerData
+	npcs    []NPCData
+	pets    []PetData
+}
+
+// NewSnapshotArena creates the broadcast arena of a match
+func NewSnapshotArena() *SnapshotArena {
+	return &SnapshotArena{players: make(map[string]PlayerData), npcs: make([]NPCData, 0), pets: make([]PetData, 0)}
+}
+
+// Players returns the emptied player map
+func (sa *SnapshotArena) Players() map[string]PlayerData {
+	clear(sa.players)
+	return sa.players
+}
+
+// NPCs fills the NPC slice with the manager's snapshot
+func (sa *SnapshotArena) NPCs(nm *NPCManager) []NPCData {
+	sa.npcs = nm.AppendSnapshot(sa.npcs[:0])
+	return sa.npcs
+}
+
+// Pets fills the pet slice with the manager's pet snapshot
+func (sa *SnapshotArena) Pets(nm *NPCManager) []PetData {
+	sa.pets = nm.AppendPetSnapshot(sa.pets[:0])
+	return sa.pets
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Position correction causes sent in position_correction; clients may pick the snap effect
+// (fade, particles) from them
+const (
+	CorrectionTeleport   = "teleport"    // a GM used /tp
+	CorrectionScript     = "script"      // a script called teleport_player
+	CorrectionCollision  = "collision"   // physics pushed the body out of a collider further than it moved itself
+	CorrectionAntiCheat  = "anti_cheat"  // a position claimed by the client was refused
+	CorrectionRespawn    = "respawn"     // the player came back at a spawn point
+	CorrectionTravel     = "travel"      // waypoint travel on the same map
+	CorrectionMount      = "mount"       // the player was moved onto the mount they rode
+	CorrectionWorldReset = "world_reset" // an admin moved everyone on the map to a spawn point
+	CorrectionElevation  = "elevation"   // the player walked into higher ground without a ramp
+)
+
+// Position correction tuning
+const (
+	collisionCorrectionDistance = 8.0  // px a body may be pushed beyond its own movement in a tick before the push is a correction
+	antiCheatPositionTolerance  = 32.0 // px a client-claimed position may differ from the server's
+)
+
+// PositionCorrection tells a player the server moved them. Unlike the position in input ACKs,
+// which prediction reconciles with smoothly, it asks the client to snap to X/Y and replay only
+// the inputs sent after InputSequence.
+type PositionCorrection struct {
+	PlayerID      string  `json:"playerId"`
+	X             float64 `json:"x"`
+	Y             float64 `json:"y"`
+	Cause         string  `json:"cause"`
+	Tick          int64   `json:"tick"`
+	InputSequence uint64  `json:"inputSequence"` // last input the server processed before the correction
+}
+
+// bodyMotion is where a player's body was and how fast it moved before physics ran
+type bodyMotion struct {
+	position vector.Vector
+	velocity vector.Vector
+}
+
+// PositionCorrector queues the forced moves of players during a tick and sends each player one
+// position_correction (OpCodePositionCorrection) with their final position after physics. It
+// also notices the bodies physics threw further than their velocity explains. Knock-back moves
+// bodies through their velocity, so it never counts as a correction. It is only used from the
+// match loop.
+type PositionCorrector struct {
+	logger       runtime.Logger
+	pending      map[string]string     // player ID -> cause
+	lastSequence map[string]uint64     // player ID -> last input sequence processed
+	motions      map[string]bodyMotion // player ID -> body before physics, this tick
+}
+
+// NewPositionCorrector creates an empty position corrector
+func NewPositionCorrector(logger runtime.Logger) *PositionCorrector {
+	return &PositionCorrector{
+		logger:       logger,
+		pending:      make(map[string]string),
+		lastSequence: make(map[string]uint64),
+		motions:      make(map[string]bodyMotion),
+	}
+}
+
+// NoteInput remembers the latest input sequence processed for a player
+func (pc *PositionCorrector) NoteInput(playerID string, sequence uint64) {
+	if sequence > pc.lastSequence[playerID] {
+		pc.lastSequence[playerID] = sequence
+	}
+}
+
+// Queue sends the player a correction at the end of the tick. A later cause in the same tick
+// replaces an earlier one.
+func (pc *PositionCorrector) Queue(playerID, cause string) {
+	pc.pending[playerID] = cause
+}
+
+// Leave forgets a player who left the match
+func (pc *PositionCorrector) Leave(playerID string) {
+	delete(pc.pending, playerID)
+	delete(pc.lastSequence, playerID)
+	delete(pc.motions, playerID)
+}
+
+// BeforePhysics records the players' bodies before physics moves them
+func (pc *PositionCorrector) BeforePhysics(gs *GameMatchState) {
+	clear(pc.motions)
+	for playerID, rb := range gs.PlayerBodies() {
+		if rb != nil {
+			pc.motions[playerID] = bodyMotion{position: rb.Position, velocity: rb.Velocity}
+		}
+	}
+}
+
+// AfterPhysics queues a collision correction for the players physics moved further from where
+// their own velocity took them than collisionCorrectionDistance, e.g. out of a collider that
+// appeared on top of them
+func (pc *PositionCorrector) AfterPhysics(gs *GameMatchState) {
+	dt := gs.physicsEngine.deltaTime
+	for playerID, motion := range pc.motions {
+		rb := gs.PlayerBody(playerID)
+		if rb == nil {
+			continue
+		}
+		expected := motion.position.Add(motion.velocity.Scale(dt))
+		if rb.Position.Sub(expected).Magnitude() > collisionCorrectionDistance {
+			if _, queued := pc.pending[playerID]; !queued {
+				pc.Queue(playerID, CorrectionCollision)
+			}
+		}
+	}
+}
+
+// Flush sends the queued corrections with the players' positions after this tick's physics
+func (pc *PositionCorrector) Flush(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if len(pc.pending) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(pc.pending))
+	for playerID := range pc.pending {
+		ids = append(ids, playerID)
+	}
+	sort.Strings(ids)
+	for _, playerID := range ids {
+		cause := pc.pending[playerID]
+		delete(pc.pending, playerID)
+		rb := gs.PlayerBody(playerID)
+		presence, ok := gs.presences[playerID]
+		if rb == nil || !ok || dispatcher == nil {
+			continue
+		}
+		correction := PositionCorrection{
+			PlayerID:      playerID,
+			X:             rb.Position.X,
+			Y:             rb.Position.Y,
+			Cause:         cause,
+			Tick:          gs.currentTick,
+			InputSequence: pc.lastSequence[playerID],
+		}
+		data, err := EncodeMessage(OpCodePositionCorrection, "position_correction", correction)
+		if err != nil {
+			pc.logger.Error("Failed to marshal position correction for %s: %v", playerID, err)
+			continue
+		}
+		dispatcher.BroadcastMessage(OpCodePositionCorrection, data, []runtime.Presence{presence}, nil, true)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"maps"
+	"regexp"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Preference limits: a player's preferences are small client settings, not a general store
+const (
+	maxPreferenceKeys       = 64
+	maxPreferenceValueBytes = 1024 // one value, JSON encoded
+	maxPreferencesBytes     = 8192 // every value, JSON encoded
+	preferenceWriteRetries  = 3    // attempts to write a player's preferences when another call changed them in between
+)
+
+// preferenceKeyPattern is what preference keys may look like, e.g. "ui.scale" or "tutorial_done"
+var preferenceKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,64}$`)
+
+var (
+	errPreferencesPlayersOnly = runtime.NewError("only players have preferences", rpcCodeUnauthenticated)
+	errInvalidPreferenceKey   = runtime.NewError("preference keys are 1 to 64 letters, digits, '.', '_' or '-'", rpcCodeInvalidArgument)
+	errPreferenceTooLarge     = runtime.NewError("preference value too large", rpcCodeInvalidArgument)
+	errPreferencesFull        = runtime.NewError("too many preferences", rpcCodeFailedPrecondition)
+)
+
+// RegisterPreferenceRpcs registers the RPC players keep their client settings with
+func RegisterPreferenceRpcs(initializer runtime.Initializer) error {
+	return initializer.RegisterRpc("player_preferences", rpcPlayerPreferences)
+}
+
+// applyPreferences sets the values of a player's preferences; null values delete their key. It
+// checks the limits on the result and leaves prefs unchanged if the change breaks one.
+func applyPreferences(prefs *PersistedPreferences, set map[string]json.RawMessage) error {
+	values := maps.Clone(prefs.Values)
+	if values == nil {
+		values = make(map[string]json.RawMessage)
+	}
+	for key, value := range set {
+		if !preferenceKeyPattern.MatchString(key) {
+			return errInvalidPreferenceKey
+		}
+		if len(value) == 0 || string(value) == "null" {
+			delete(values, key)
+			continue
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, value); err != nil {
+			return errInvalidPayload
+		}
+		if compact.Len() > maxPreferenceValueBytes {
+			return errPreferenceTooLarge
+		}
+		values[key] = compact.Bytes()
+	}
+
+	total := 0
+	for _, value := range values {
+		total += len(value)
+	}
+	if len(values) > maxPreferenceKeys || total > maxPreferencesBytes {
+		return errPreferencesFull
+	}
+	prefs.Values = values
+	return nil
+}
+
+// updatePreferences applies a change to a player's stored preferences and writes them with the
+// version they were read at, reading again if another call wrote in between, so changes made from
+// two clients at once both stick
+func updatePreferences(ctx context.Context, dm *DatabaseManager, userID string, set map[string]json.RawMessage) (*PersistedPreferences, error) {
+	for attempt := 0; attempt < preferenceWriteRetries; attempt++ {
+		prefs, version, err := dm.LoadPreferencesVersion(ctx, userID)
+		if err != nil {
+			return nil, errInternalFailure
+		}
+		if err := applyPreferences(prefs, set); err != nil {
+			return nil, err
+		}
+		if err := dm.SavePreferences(ctx, userID, prefs, version); err == nil {
+			return prefs, nil
+		}
+	}
+	return nil, errInternalFailure
+}
+
+// rpcPlayerPreferences reads or changes the caller's preferences: small client settings (UI
+// scale, tutorials seen, the selected hotbar slot) kept with their account, so clients don't need
+// storage of their own for them. Values are any JSON; null deletes a key, keys left out are kept.
+// Payload: {"set": {"ui.scale": 1.25, "tutorial.fishing": true}} or {} to read
+func rpcPlayerPreferences(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errPreferencesPlayersOnly
+	}
+	var req struct {
+		Set map[string]json.RawMessage `json:"set"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	var prefs *PersistedPreferences
+	var err error
+	if len(req.Set) == 0 {
+		if prefs, err = dm.LoadPreferences(ctx, userID); err != nil {
+			return "", errInternalFailure
+		}
+	} else if prefs, err = updatePreferences(ctx, dm, userID, req.Set); err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(map[string]any{"preferences": prefs.Values})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
+
+// SendPreferences sends a joining player their preferences
+func (gs *GameMatchState) SendPreferences(ctx context.Context, playerID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+	prefs, err := gs.databaseManager.LoadPreferences(ctx, playerID)
+	if err != nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodePreferences, "preferences", map[string]any{"preferences": prefs.Values})
+	if err != nil {
+		logger.Error("Failed to marshal preferences for %s: %v", playerID, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodePreferences, data, []runtime.Presence{presence}, nil, true)
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Projectile tuning
+const (
+	defaultProjectileSpeed   = 480.0 // pixels per second
+	defaultProjectileRadius  = 4.0
+	defaultProjectileRange   = 640.0
+	projectileBroadcastRange = 960.0 // projectile messages are relayed to players within this distance
+	projectileBounceDamping  = 0.6   // share of its vertical speed an arc keeps when it bounces
+	maxProjectiles           = 256   // projectiles in flight per match; launches beyond are dropped
+	projectileBounceOffset   = 0.01  // px a bounced projectile is moved off the wall, so it doesn't strike it again
+)
+
+// Reasons a projectile ended, sent in projectile_ended and to its script
+const (
+	ProjectileEndHit     = "hit"     // it hit as many targets as it may
+	ProjectileEndWall    = "wall"    // it struck a wall with no bounces left
+	ProjectileEndLanded  = "landed"  // an arc came down with no bounces left
+	ProjectileEndExpired = "expired" // it flew its max range or left the world
+)
+
+// ProjectileSpec describes a projectile launched by an ability ("projectile" in abilities.json)
+// or by a script
+type ProjectileSpec struct {
+	Speed          float64  `json:"speed,omitempty"`          // pixels per second (default 480)
+	Radius         float64  `json:"radius,omitempty"`         // hit radius in pixels (default 4)
+	MaxRange       float64  `json:"maxRange,omitempty"`       // pixels flown before it expires (default 640); arcs land at most this far away
+	Gravity        float64  `json:"gravity,omitempty"`        // pixels/s²; above 0 the projectile arcs over bodies and walls and lands on the aimed point
+	Pierce         int      `json:"pierce,omitempty"`         // extra targets it passes through before stopping
+	Bounces        int      `json:"bounces,omitempty"`        // times it rebounds off walls (arcs: off the ground)
+	Damage         float64  `json:"damage,omitempty"`         // dealt to every target hit
+	DamageType     string   `json:"damageType,omitempty"`     // default physical
+	CritChance     float64  `json:"critChance,omitempty"`     // chance (0..1) a hit is critical
+	CritMultiplier float64  `json:"critMultiplier,omitempty"` // damage factor of critical hits (default 2)
+	Effects        []string `json:"effects,omitempty"`        // status effects applied to players hit
+	FriendlyFire   bool     `json:"friendlyFire,omitempty"`   // also hit the owner's allies (guild or team mates and their pets; other NPCs for NPC owners)
+	Script         string   `json:"script,omitempty"`         // runs on every hit (event projectile_hit) and when the projectile ends (projectile_end)
+	Explosion      *AoESpec `json:"explosion,omitempty"`      // area effect where it ends, unless it expired
+}
+
+// normalize fills in the defaults of unset fields
+func (spec *ProjectileSpec) normalize() {
+	if spec.Speed <= 0 {
+		spec.Speed = defaultProjectileSpeed
+	}
+	if spec.Radius <= 0 {
+		spec.Radius = defaultProjectileRadius
+	}
+	if spec.MaxRange <= 0 {
+		spec.MaxRange = defaultProjectileRange
+	}
+	if spec.DamageType == "" {
+		spec.DamageType = DamagePhysical
+	}
+	spec.Pierce = int(math.Max(0, float64(spec.Pierce)))
+	spec.Bounces = int(math.Max(0, float64(spec.Bounces)))
+	spec.CritChance = math.Max(0, math.Min(spec.CritChance, 1))
+	if spec.CritMultiplier <= 0 {
+		spec.CritMultiplier = defaultCritMultiplier
+	}
+	if spec.Explosion != nil {
+		spec.Explosion.normalize()
+	}
+}
+
+// Projectile is a projectile in flight. Its owner is credited with the damage it deals and
+// decides whom it may hit.
+type Projectile struct {
+	ID          int
+	Spec        *ProjectileSpec
+	AbilityID   string
+	Owner       DamageSource
+	Position    vector.Vector
+	Velocity    vector.Vector // pixels per second
+	Height      float64       // arcs only: height above the ground
+	VelocityZ   float64       // arcs only: vertical speed, pixels per second
+	travelled   float64
+	hitsLeft    int
+	bouncesLeft int
+	hit         map[string]bool // targets already hit, so piercing projectiles hit each once
+	rewind      int64           // ticks its hits look back: the lag of the player who fired it (see RewindTick)
+}
+
+// ProjectileData is the projectile representation sent to clients, enough to simulate its flight
+type ProjectileData struct {
+	ID        int          `json:"id"`
+	AbilityID string       `json:"abilityId,omitempty"`
+	Owner     DamageSource `json:"owner"`
+	X         float64      `json:"x"`
+	Y         float64      `json:"y"`
+	VX        float64      `json:"vx"`
+	VY        float64      `json:"vy"`
+	Height    float64      `json:"height,omitempty"`
+	VZ        float64      `json:"vz,omitempty"`
+	Gravity   float64      `json:"gravity,omitempty"`
+	Radius    float64      `json:"radius"`
+}
+
+// ProjectileManager flies the projectiles of the match and resolves their hits. It is only used
+// from the match loop.
+type ProjectileManager struct {
+	logger      runtime.Logger
+	projectiles map[int]*Projectile
+	nextID      int
+}
+
+// NewProjectileManager creates an empty projectile manager
+func NewProjectileManager(logger runtime.Logger) *ProjectileManager {
+	return &ProjectileManager{
+		logger:      logger,
+		projectiles: make(map[int]*Projectile),
+		nextID:      1,
+	}
+}
+
+// Count returns how many projectiles are in flight
+func (pm *ProjectileManager) Count() int {
+	return len(pm.projectiles)
+}
+
+// Launch fires a projectile from one point towards another and announces it to nearby players.
+// Arcs are thrown so they land on the aimed point (at most MaxRange away). It returns the
+// projectile ID, or 0 if nothing was launched.
+func (pm *ProjectileManager) Launch(gs *GameMatchState, spec *ProjectileSpec, owner DamageSource, abilityID string, from, to vector.Vector, dispatcher runtime.MatchDispatcher) int {
+	dir := to.Sub(from)
+	distance := dir.Magnitude()
+	if distance == 0 || len(pm.projectiles) >= maxProjectiles {
+		return 0
+	}
+	p := &Projectile{
+		ID:          pm.nextID,
+		Spec:        spec,
+		AbilityID:   abilityID,
+		Owner:       owner,
+		Position:    from,
+		Velocity:    dir.Scale(spec.Speed / distance),
+		hitsLeft:    1 + spec.Pierce,
+		bouncesLeft: spec.Bounces,
+		hit:         make(map[string]bool),
+	}
+	if spec.Gravity > 0 {
+		flightTime := math.Min(distance, spec.MaxRange) / spec.Speed
+		p.VelocityZ = spec.Gravity * flightTime / 2
+	}
+	pm.nextID++
+	pm.projectiles[p.ID] = p
+
+	pm.broadcast(gs, p.Position, "projectile_spawned", p.data(), dispatcher)
+	return p.ID
+}
+
+// Rewind makes a projectile hit bodies where they stood ticks ago, as the player who fired it saw
+// them. It returns false for unknown projectiles.
+func (pm *ProjectileManager) Rewind(id int, ticks int64) bool {
+	p, ok := pm.projectiles[id]
+	if !ok {
+		return false
+	}
+	p.rewind = int64(math.Max(0, math.Min(maxRewindTicks, float64(ticks))))
+	return true
+}
+
+// Update advances every projectile by one tick and applies its hits. Called after physics, so
+// projectiles hit bodies where they are this tick, or where they stood for rewound ones.
+func (pm *ProjectileManager) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if len(pm.projectiles) == 0 {
+		return
+	}
+	// Fly them in launch order so hits resolve the same way on every run
+	ids := make([]int, 0, len(pm.projectiles))
+	for id := range pm.projectiles {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		p := pm.projectiles[id]
+		var reason string
+		if p.Spec.Gravity > 0 {
+			reason = pm.stepArc(ctx, gs, p, dispatcher)
+		} else {
+			reason = pm.stepStraight(ctx, gs, p, dispatcher)
+		}
+		if reason == "" && !gs.insideWorld(p.Position) {
+			reason = ProjectileEndExpired
+		}
+		if reason != "" {
+			pm.end(ctx, gs, p, reason, dispatcher)
+		}
+	}
+}
+
+// stepStraight moves a flat projectile along its velocity, hitting the bodies on its way up to the
+// first wall, where it bounces or stops. It returns the end reason, or "" while it keeps flying.
+func (pm *ProjectileManager) stepStraight(ctx context.Context, gs *GameMatchState, p *Projectile, dispatcher runtime.MatchDispatcher) string {
+	delta := p.Velocity.Scale(1.0 / TickRate)
+	step := delta.Magnitude()
+	if remaining := p.Spec.MaxRange - p.travelled; step > remaining {
+		delta = delta.Scale(remaining / step)
+		step = remaining
+	}
+
+	wallT, normal, blocked := pm.sweepWalls(gs, p.Position, delta, p.Spec.Radius)
+	reach := 1.0
+	if blocked {
+		reach = wallT
+	}
+	for _, target := range pm.targetsOnSegment(gs, p, p.Position, delta.Scale(reach)) {
+		pm.hitTarget(ctx, gs, p, target, dispatcher)
+		if p.hitsLeft == 0 {
+			p.Position = p.Position.Add(delta.Scale(target.t))
+			return ProjectileEndHit
+		}
+	}
+
+	p.Position = p.Position.Add(delta.Scale(reach))
+	p.travelled += step * reach
+	if blocked {
+		if p.bouncesLeft == 0 {
+			return ProjectileEndWall
+		}
+		// Reflect off the wall: v - 2(v·n)n
+		p.bouncesLeft--
+		dot := p.Velocity.X*normal.X + p.Velocity.Y*normal.Y
+		p.Velocity = p.Velocity.Sub(normal.Scale(2 * dot))
+		p.Position = p.Position.Add(normal.Scale(projectileBounceOffset))
+		pm.broadcast(gs, p.Position, "projectile_bounced", p.data(), dispatcher)
+		return ""
+	}
+	if p.travelled >= p.Spec.MaxRange {
+		return ProjectileEndExpired
+	}
+	return ""
+}
+
+// stepArc moves an arcing projectile. It flies over everything and only hits the bodies under it
+// where it comes down, then bounces along the ground or stops.
+func (pm *ProjectileManager) stepArc(ctx context.Context, gs *GameMatchState, p *Projectile, dispatcher runtime.MatchDispatcher) string {
+	dt := 1.0 / TickRate
+	delta := p.Velocity.Scale(dt)
+	p.Position = p.Position.Add(delta)
+	p.travelled += delta.Magnitude()
+	p.Height += p.VelocityZ*dt - p.Spec.Gravity*dt*dt/2
+	p.VelocityZ -= p.Spec.Gravity * dt
+	if p.Height > 0 {
+		return ""
+	}
+	p.Height = 0
+
+	for _, target := range pm.targetsAround(gs, p, p.Position, p.Spec.Radius) {
+		pm.hitTarget(ctx, gs, p, target, dispatcher)
+		if p.hitsLeft == 0 {
+			return ProjectileEndHit
+		}
+	}
+	if p.bouncesLeft == 0 {
+		return ProjectileEndLanded
+	}
+	p.bouncesLeft--
+	p.VelocityZ = -p.VelocityZ * projectileBounceDamping
+	pm.broadcast(gs, p.Position, "projectile_bounced", p.data(), dispatcher)
+	return ""
+}
+
+// sweepWalls finds the first static collider a projectile of the given radius runs into along
+// from -> from+delta. It returns the fraction of delta travelled and the wall's normal. Colliders
+// the projectile starts inside are ignored, so shots fired while touching a wall still leave, and
+// so are the walls it starts on and moves away from or along, as after a bounce.
+func (pm *ProjectileManager) sweepWalls(gs *GameMatchState, from, delta vector.Vector, radius float64) (float64, vector.Vector, bool) {
+	best := math.Inf(1)
+	var bestNormal vector.Vector
+	for _, rb := range gs.gameObjects {
+		if rb.IsMovable || !gs.physicsEngine.CollisionsEnabled(rb) {
+			continue
+		}
+		halfW, halfH := rb.Width/2+radius, rb.Height/2+radius
+		if strings.ToLower(rb.Shape) == "circle" {
+			halfW, halfH = rb.Radius+radius, rb.Radius+radius
+		}
+		minX, minY := rb.Position.X-halfW, rb.Position.Y-halfH
+		maxX, maxY := rb.Position.X+halfW, rb.Position.Y+halfH
+		if from.X > minX && from.X < maxX && from.Y > minY && from.Y < maxY {
+			continue
+		}
+		// A zero normal means the segment starts on the box's surface without entering it
+		if t, normal, ok := segmentBoxEntry(from, delta, minX, minY, maxX, maxY); ok && t < best && (normal.X != 0 || normal.Y != 0) {
+			best, bestNormal = t, normal
+		}
+	}
+	if math.IsInf(best, 1) {
+		return 1, vector.Vector{}, false
+	}
+	return best, bestNormal, true
+}
+
+// segmentBoxEntry returns where the segment from origin to origin+dir enters an axis-aligned box
+// (0..1) and the normal of the side it enters through. The normal is zero when the segment starts
+// on the surface and leaves or slides along it.
+func segmentBoxEntry(origin, dir vector.Vector, minX, minY, maxX, maxY float64) (float64, vector.Vector, bool) {
+	tMin, tMax := 0.0, 1.0
+	var normal vector.Vector
+	axes := [2]struct {
+		o, d, lo, hi float64
+		axis         vector.Vector
+	}{
+		{origin.X, dir.X, minX, maxX, vector.Vector{X: 1}},
+		{origin.Y, dir.Y, minY, maxY, vector.Vector{Y: 1}},
+	}
+	for _, a := range axes {
+		if a.d == 0 {
+			if a.o < a.lo || a.o > a.hi {
+				return 0, vector.Vector{}, false
+			}
+			continue
+		}
+		t1, t2 := (a.lo-a.o)/a.d, (a.hi-a.o)/a.d
+		side := a.axis.Scale(-1) // entering through the low side faces backwards
+		if t1 > t2 {
+			t1, t2 = t2, t1
+			side = a.axis
+		}
+		if t1 >= tMin {
+			tMin, normal = t1, side
+		}
+		tMax = min(tMax, t2)
+		if tMin > tMax {
+			return 0, vector.Vector{}, false
+		}
+	}
+	return tMin, normal, true
+}
+
+// targetsOnSegment returns the bodies a flat projectile touches along from -> from+delta that it
+// may hit, nearest first
+func (pm *ProjectileManager) targetsOnSegment(gs *GameMatchState, p *Projectile, from, delta vector.Vector) []combatTarget {
+	lengthSq := delta.X*delta.X + delta.Y*delta.Y
+	var hits []combatTarget
+	for _, target := range gs.CombatTargets(p.Owner, p.Spec.FriendlyFire, gs.currentTick-p.rewind, p.hit) {
+		t := 0.0
+		if lengthSq > 0 {
+			rel := target.position.Sub(from)
+			t = math.Max(0, math.Min(1, (rel.X*delta.X+rel.Y*delta.Y)/lengthSq))
+		}
+		closest := from.Add(delta.Scale(t))
+		if closest.Sub(target.position).Magnitude() <= target.radius+p.Spec.Radius {
+			target.t = t
+			hits = append(hits, target)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].t < hits[j].t })
+	return hits
+}
+
+// targetsAround returns the bodies within radius of a point that the projectile may hit, nearest first
+func (pm *ProjectileManager) targetsAround(gs *GameMatchState, p *Projectile, center vector.Vector, radius float64) []combatTarget {
+	var hits []combatTarget
+	for _, target := range gs.CombatTargets(p.Owner, p.Spec.FriendlyFire, gs.currentTick-p.rewind, p.hit) {
+		distance := target.position.Sub(center).Magnitude()
+		if distance <= target.radius+radius {
+			target.t = distance
+			hits = append(hits, target)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].t < hits[j].t })
+	return hits
+}
+
+// hitTarget applies the projectile's damage and effects to a target, runs its script and tells
+// nearby players. Every hit uses up one of the projectile's hits.
+func (pm *ProjectileManager) hitTarget(ctx context.Context, gs *GameMatchState, p *Projectile, target combatTarget, dispatcher runtime.MatchDispatcher) {
+	p.hit[target.key()] = true
+	p.hitsLeft--
+	damage, crit := gs.RollCrit(critPlayer(p.Owner, target.kind, target.id), p.Owner, target.id, p.Spec.Damage, p.Spec.CritChance, p.Spec.CritMultiplier)
+
+	switch target.kind {
+	case "player":
+		if damage > 0 {
+			gs.DamagePlayer(target.id, p.Owner, damage, p.Spec.DamageType, dispatcher, pm.logger)
+		}
+		for _, effectID := range p.Spec.Effects {
+			gs.ApplyEffect(target.id, effectID, p.Owner, 0)
+		}
+	case "npc":
+		if damage > 0 {
+			gs.npcManager.Damage(gs, target.npcID, p.Owner, damage, p.Spec.DamageType, dispatcher)
+		}
+	}
+
+	pm.broadcast(gs, target.position, "projectile_hit", map[string]any{
+		"id":         p.ID,
+		"targetType": target.kind,
+		"targetId":   target.id,
+		"crit":       crit,
+		"x":          target.position.X,
+		"y":          target.position.Y,
+	}, dispatcher)
+	pm.runScript(ctx, gs, p, "projectile_hit", map[string]any{"targetType": target.kind, "targetId": target.id}, dispatcher)
+}
+
+// end removes a projectile, tells nearby players where and why it stopped, sets off its explosion
+// and runs its script
+func (pm *ProjectileManager) end(ctx context.Context, gs *GameMatchState, p *Projectile, reason string, dispatcher runtime.MatchDispatcher) {
+	delete(pm.projectiles, p.ID)
+	pm.broadcast(gs, p.Position, "projectile_ended", map[string]any{
+		"id":     p.ID,
+		"reason": reason,
+		"x":      p.Position.X,
+		"y":      p.Position.Y,
+	}, dispatcher)
+	if p.Spec.Explosion != nil && reason != ProjectileEndExpired {
+		direction := math.Atan2(p.Velocity.Y, p.Velocity.X)
+		gs.ResolveAoE(p.Spec.Explosion, p.Owner, p.AbilityID, p.Position, direction, gs.currentTick, dispatcher, pm.logger)
+		gs.MakeNoise(NoiseExplosion, p.Position, noiseExplosionRadius, gs.npcManager.creditedPlayer(p.Owner), dispatcher, pm.logger)
+	}
+	pm.runScript(ctx, gs, p, "projectile_end", map[string]any{"reason": reason}, dispatcher)
+}
+
+// runScript runs the projectile's script with its owner, position and the event's data
+func (pm *ProjectileManager) runScript(ctx context.Context, gs *GameMatchState, p *Projectile, event string, data map[string]any, dispatcher runtime.MatchDispatcher) {
+	if p.Spec.Script == "" {
+		return
+	}
+	params := map[string]any{
+		"event":        event,
+		"projectileId": p.ID,
+		"abilityId":    p.AbilityID,
+		"playerId":     gs.npcManager.creditedPlayer(p.Owner),
+		"ownerType":    p.Owner.Type,
+		"ownerId":      p.Owner.ID,
+		"x":            p.Position.X,
+		"y":            p.Position.Y,
+	}
+	for k, v := range data {
+		params[k] = v
+	}
+	if err := gs.RunScript(ctx, p.Spec.Script, params, dispatcher, pm.logger); err != nil {
+		pm.logger.Error("Projectile %d %s script error: %v", p.ID, event, err)
+	}
+}
+
+// broadcast relays an OpCodeProjectile message to the players near a position
+func (pm *ProjectileManager) broadcast(gs *GameMatchState, position vector.Vector, msgType string, data any, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	recipients := gs.PresencesInRange(position, projectileBroadcastRange)
+	if len(recipients) == 0 {
+		return
+	}
+	payload, err := EncodeMessage(OpCodeProjectile, msgType, data)
+	if err != nil {
+		pm.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeProjectile, payload, recipients, nil, true)
+}
+
+// data returns the projectile's client representation
+func (p *Projectile) data() ProjectileData {
+	return ProjectileData{
+		ID:        p.ID,
+		AbilityID: p.AbilityID,
+		Owner:     p.Owner,
+		X:         p.Position.X,
+		Y:         p.Position.Y,
+		VX:        p.Velocity.X,
+		VY:        p.Velocity.Y,
+		Height:    p.Height,
+		VZ:        p.VelocityZ,
+		Gravity:   p.Spec.Gravity,
+		Radius:    p.Spec.Radius,
+	}
+}
+
+// insideWorld reports whether a point lies within the physics world bounds
+func (gs *GameMatchState) insideWorld(p vector.Vector) bool {
+	b := gs.physicsEngine.GetWorldBounds()
+	return p.X >= b.MinX && p.X <= b.MaxX && p.Y >= b.MinY && p.Y <= b.MaxY
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// PvP zone modes, from the least to the most permissive
+const (
+	PvPSafe      = "safe"      // players can't hurt each other
+	PvPContested = "contested" // flagged players may attack anyone; killing an unflagged player costs karma
+	PvPWar       = "war"       // everyone may attack everyone, no flags or karma involved
+)
+
+// PvP tuning
+const (
+	pvpFlagCooldownTicks = 10 * TickRate // ticks between two flag changes
+	pvpCombatTicks       = 30 * TickRate // unflagging is refused this long after the last PvP hit
+	pvpMurderKarma       = 10            // karma lost for killing an unflagged player in a contested zone
+	pvpBountyKarma       = 5             // karma gained for killing an outlaw outside safe zones
+	pvpOutlawKarma       = -30           // at or below this karma a player is an outlaw: always flagged
+	pvpMaxKarma          = 100
+)
+
+// pvpModeRank orders the modes so the stricter of two areas can be picked
+var pvpModeRank = map[string]int{
+	PvPSafe:      0,
+	PvPContested: 1,
+	PvPWar:       2,
+}
+
+// PvPZone is a rectangular map area ("pvp_zone" objects) with its own PvP mode
+type PvPZone struct {
+	Name string
+	Mode string
+	Min  vector.Vector
+	Max  vector.Vector
+}
+
+// Contains reports whether a point lies inside the zone
+func (z *PvPZone) Contains(p vector.Vector) bool {
+	return p.X >= z.Min.X && p.X <= z.Max.X && p.Y >= z.Min.Y && p.Y <= z.Max.Y
+}
+
+// PvPModeAt returns the PvP mode at a position: the strictest zone containing it, or the map's
+// "pvp" property (contested when unset) outside zones
+func (gs *GameMatchState) PvPModeAt(p vector.Vector) string {
+	if gs.currentMap == nil {
+		return PvPContested
+	}
+	mode := ""
+	for i := range gs.currentMap.PvPZones {
+		zone := &gs.currentMap.PvPZones[i]
+		if zone.Contains(p) && (mode == "" || pvpModeRank[zone.Mode] < pvpModeRank[mode]) {
+			mode = zone.Mode
+		}
+	}
+	if mode != "" {
+		return mode
+	}
+	if v, ok := gs.currentMap.Properties["pvp"].(string); ok {
+		if _, known := pvpModeRank[strings.ToLower(v)]; known {
+			return strings.ToLower(v)
+		}
+	}
+	return PvPContested
+}
+
+// Outlaw reports whether the player's karma has dropped to the outlaw threshold
+func (ps *PlayerState) Outlaw() bool {
+	return ps.Karma <= pvpOutlawKarma
+}
+
+// Attackable reports whether the player takes part in contested PvP (flagged or outlaw)
+func (ps *PlayerState) Attackable() bool {
+	return ps.PvPFlagged || ps.Outlaw()
+}
+
+// CanDamagePlayer reports whether attackerID may hurt targetID under the PvP rules. Duelists may
+// only hurt each other. Otherwise the stricter of the two players' areas applies: nobody is hurt in safe zones, contested zones require the
+// attacker to be flagged, and war zones allow everything.
+func (gs *GameMatchState) CanDamagePlayer(attackerID, targetID string) bool {
+	if attackerID == targetID {
+		return true
+	}
+	// Players who just spawned can't be attacked
+	if gs.SpawnProtected(targetID) {
+		return false
+	}
+	// Duels override the zone rules for the duelists
+	if decided, allowed := gs.duels.allowsDamage(attackerID, targetID, gs.currentTick); decided {
+		return allowed
+	}
+	// The world settings can turn PvP off everywhere else
+	if !gs.pvpEnabled() {
+		return false
+	}
+	attacker, target := gs.PlayerBody(attackerID), gs.PlayerBody(targetID)
+	if attacker == nil || target == nil {
+		return false
+	}
+	mode := gs.PvPModeAt(attacker.Position)
+	if targetMode := gs.PvPModeAt(target.Position); pvpModeRank[targetMode] < pvpModeRank[mode] {
+		mode = targetMode
+	}
+	switch mode {
+	case PvPWar:
+		return true
+	case PvPContested:
+		return gs.GetPlayerState(attackerID).Attackable()
+	default:
+		return false
+	}
+}
+
+// markPvPCombat starts the combat timer of both players after a PvP hit landed
+func (gs *GameMatchState) markPvPCombat(attackerID, targetID string) {
+	gs.GetPlayerState(attackerID).PvPCombatTick = gs.currentTick
+	gs.GetPlayerState(targetID).PvPCombatTick = gs.currentTick
+}
+
+// SetPvPFlag turns a player's PvP flag on or off. It returns a rejection reason, or "" once the
+// flag is set. Flag changes have a cooldown, and players can't unflag during PvP combat or while
+// they are outlaws.
+func (gs *GameMatchState) SetPvPFlag(playerID string, flagged bool, ack *InputACK) string {
+	state := gs.GetPlayerState(playerID)
+	if state.PvPFlagged == flagged {
+		return ""
+	}
+	if remaining := state.PvPFlagReadyTick - gs.currentTick; remaining > 0 {
+		ack.Cooldown = float64(remaining) / TickRate
+		return RejectOnCooldown
+	}
+	if !flagged {
+		if state.Outlaw() {
+			return RejectOutlaw
+		}
+		if remaining := state.PvPCombatTick + pvpCombatTicks - gs.currentTick; state.PvPCombatTick > 0 && remaining > 0 {
+			ack.Cooldown = float64(remaining) / TickRate
+			return RejectInCombat
+		}
+	}
+	state.PvPFlagged = flagged
+	state.PvPFlagReadyTick = gs.currentTick + pvpFlagCooldownTicks
+	state.statusDirty = true
+	return ""
+}
+
+// updatePvPZone tracks the PvP mode of the area the player stands in for their status
+func (gs *GameMatchState) updatePvPZone(state *PlayerState, position vector.Vector) {
+	if mode := gs.PvPModeAt(position); mode != state.PvPZone {
+		state.PvPZone = mode
+		state.statusDirty = true
+	}
+}
+
+// recordPvPKill credits a player kill to the killer and applies the karma rules: killing an
+// unflagged player in a contested zone costs karma, killing an outlaw outside safe zones earns
+// some back. The kill and the new karma are persisted.
+func (gs *GameMatchState) recordPvPKill(ctx context.Context, killerID, victimID string, position vector.Vector, logger runtime.Logger) {
+	victim := gs.GetPlayerState(victimID)
+	delta := 0
+	switch mode := gs.PvPModeAt(position); {
+	case mode == PvPContested && !victim.Attackable():
+		delta = -pvpMurderKarma
+	case mode != PvPSafe && victim.Outlaw():
+		delta = pvpBountyKarma
+	}
+
+	karma, err := gs.databaseManager.RecordPvPKill(ctx, killerID, delta)
+	if err != nil {
+		logger.Error("Failed to record PvP kill of %s by %s: %v", victimID, killerID, err)
+		return
+	}
+	if delta != 0 {
+		logger.Info("Player %s killed %s: karma %+d (now %d)", killerID, victimID, delta, karma)
+	}
+	// The killer may have left since the killing blow (e.g. poison)
+	if killer, online := gs.playerStates[killerID]; online {
+		if !killer.Outlaw() && karma <= pvpOutlawKarma {
+			logger.Info("Player %s became an outlaw", killerID)
+		}
+		killer.Karma = karma
+		killer.statusDirty = true
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Escort tuning
+const (
+	escortCheckInterval      = TickRate / 4  // ticks between escort checks
+	escortFollowDistance     = 2 * TileSize  // an escort without a path walks after its player once further away than this
+	escortWaitDistance       = 5 * TileSize  // an escort on a path waits while its player is further away than this
+	defaultEscortMaxDistance = 15 * TileSize // the player may stray this far from the escort
+	defaultEscortLeaveTime   = 30.0          // seconds the player may stay beyond maxDistance
+)
+
+// Reasons an escort quest fails, sent in quest_failed
+const (
+	QuestFailedEscortKilled = "escort_killed"    // the escorted NPC died or was removed
+	QuestFailedAbandoned    = "escort_abandoned" // the player stayed too far from it for too long, or left the match
+	QuestFailedTimeout      = "escort_timeout"   // the NPC didn't reach its destination within the time limit
+)
+
+// Bus event published when a quest fails
+const EventQuestFailed = "quest_failed" // playerId, questId, reason
+
+// QuestEscort links an NPC spawned for an escort objective to the player escorting it
+type QuestEscort struct {
+	PlayerID  string
+	QuestID   string
+	Objective int // index in the quest's objectives
+	NPCID     int
+	Path      *MapPath // path the NPC walks (nil: it follows the player)
+	pathIndex int
+	walking   bool  // a goal towards Path.Points[pathIndex] was set
+	deadline  int64 // tick the quest fails at (0 = no time limit)
+	awaySince int64 // tick the player strayed beyond maxDistance (0 while in range)
+}
+
+// normalizeEscort fills in the defaults of an escort objective
+func (qm *QuestManager) normalizeEscort(questID string, objective *QuestObjective) {
+	objective.Count = 1
+	if objective.MaxDistance <= 0 {
+		objective.MaxDistance = defaultEscortMaxDistance
+	}
+	if objective.LeaveTime <= 0 {
+		objective.LeaveTime = defaultEscortLeaveTime
+	}
+	if objective.Destination == "" {
+		qm.logger.Warn("Quest %s escorts %s without a destination; it can't be completed", questID, objective.Target)
+	}
+}
+
+// SpawnEscort spawns an NPC that escort drives instead of its behavior and returns its ID (0 if
+// the type is unknown)
+func (nm *NPCManager) SpawnEscort(gameState *GameMatchState, npcType string, position vector.Vector, escort *QuestEscort) int {
+	id := nm.Spawn(gameState, npcType, position, nil)
+	if id == 0 {
+		return 0
+	}
+	nm.mu.Lock()
+	npc := nm.npcs[id]
+	npc.Escort = escort
+	npc.goal, npc.route, npc.routine, npc.routineGoal = nil, nil, nil, nil
+	nm.mu.Unlock()
+	return id
+}
+
+// updateEscort walks an escort NPC: point by point along its path while its player keeps up, or
+// after the player, stopping a little short of them. The goal is set here; steer walks it there.
+func (nm *NPCManager) updateEscort(gameState *GameMatchState, npc *NPC, tick int64) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	escort := npc.Escort
+	player := gameState.PlayerBody(escort.PlayerID)
+	if player == nil {
+		npc.goal, npc.route = nil, nil
+		return
+	}
+	playerPos := player.Position
+	dist := playerPos.Sub(npc.Body.Position).Magnitude()
+
+	if escort.Path == nil {
+		switch {
+		case dist <= escortFollowDistance:
+			npc.goal, npc.route = nil, nil
+		case npc.goal == nil || npc.goal.Sub(playerPos).Magnitude() > npcRepathDistance:
+			goal := playerPos
+			npc.goal, npc.goalTick, npc.route = &goal, tick, nil
+		}
+		return
+	}
+
+	if escort.walking && npc.goal == nil {
+		// steer dropped the goal: the point was reached, or can't be
+		escort.pathIndex++
+	}
+	escort.walking = false
+	point, ok := escort.point()
+	if dist > escortWaitDistance || !ok {
+		// Wait for the player to catch up, or stand at the end of the path
+		npc.goal, npc.route = nil, nil
+		return
+	}
+	if npc.goal == nil {
+		npc.goal, npc.goalTick, npc.route = &point, tick, nil
+	}
+	escort.walking = true
+}
+
+// point returns the path point the escort walks to next; false past the end of its path
+func (e *QuestEscort) point() (vector.Vector, bool) {
+	if e.Path == nil || e.pathIndex < 0 || e.pathIndex >= len(e.Path.Points) {
+		return vector.Vector{}, false
+	}
+	return e.Path.Points[e.pathIndex], true
+}
+
+// objective returns the quest objective the escort is for; false once the quest's definition no
+// longer has it (the definitions were reloaded)
+func (qm *QuestManager) objective(escort *QuestEscort) (*QuestObjective, bool) {
+	def, ok := qm.definitions[escort.QuestID]
+	if !ok || escort.Objective < 0 || escort.Objective >= len(def.Objectives) {
+		return nil, false
+	}
+	return &def.Objectives[escort.Objective], true
+}
+
+// startEscorts spawns the NPCs of the escort objectives of a quest the player just accepted, at
+// the objective's start marker or else where the giver stands (the player, for quests started
+// without one)
+func (qm *QuestManager) startEscorts(gs *GameMatchState, playerID string, def *QuestDefinition, giver *NPC) {
+	for i, objective := range def.Objectives {
+		if objective.Type != QuestObjectiveEscort {
+			continue
+		}
+		var position vector.Vector
+		if giver != nil {
+			position = giver.Body.Position
+		} else if rb := gs.PlayerBody(playerID); rb != nil {
+			position = rb.Position
+		}
+		escort := &QuestEscort{PlayerID: playerID, QuestID: def.ID, Objective: i}
+		if gs.currentMap != nil {
+			if marker, ok := gs.currentMap.Markers[objective.Start]; ok {
+				position = marker
+			}
+			for _, path := range gs.currentMap.Paths {
+				if objective.Path != "" && path.Name == objective.Path && len(path.Points) > 0 {
+					escort.Path = path
+					break
+				}
+			}
+		}
+		if objective.Path != "" && escort.Path == nil {
+			qm.logger.Warn("Quest %s escort path %q not found on this map; the NPC follows the player", def.ID, objective.Path)
+		}
+		if objective.TimeLimit > 0 {
+			escort.deadline = gs.currentTick + int64(objective.TimeLimit*TickRate)
+		}
+		escort.NPCID = gs.npcManager.SpawnEscort(gs, objective.Target, position, escort)
+		if escort.NPCID == 0 {
+			qm.logger.Error("Quest %s escorts unknown NPC type %q", def.ID, objective.Target)
+			continue
+		}
+		qm.escorts[escort.NPCID] = escort
+	}
+}
+
+// stopEscorts removes the escort NPCs of a player's quest (every quest for questID "")
+func (qm *QuestManager) stopEscorts(gs *GameMatchState, playerID, questID string) {
+	for id, escort := range qm.escorts {
+		if escort.PlayerID == playerID && (questID == "" || escort.QuestID == questID) {
+			delete(qm.escorts, id)
+			gs.npcManager.Despawn(gs, id)
+		}
+	}
+}
+
+// failLostEscorts fails the joining player's quests with an unfinished escort objective: escorts
+// don't outlive their player leaving the match
+func (qm *QuestManager) failLostEscorts(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	log := qm.logs[playerID]
+	failed := make([]string, 0)
+	for questID, quest := range log.Active {
+		def, ok := qm.definitions[questID]
+		if !ok {
+			continue
+		}
+		for i, objective := range def.Objectives {
+			if objective.Type == QuestObjectiveEscort && qm.progress(ctx, gs, playerID, objective, quest, i) < objective.Count {
+				failed = append(failed, questID)
+				break
+			}
+		}
+	}
+	sort.Strings(failed)
+	for _, questID := range failed {
+		qm.failQuest(ctx, gs, playerID, questID, QuestFailedAbandoned, dispatcher)
+	}
+}
+
+// updateEscorts completes the escort objectives whose NPC reached its destination region and
+// fails the quests whose NPC is gone, whose player left it behind for too long or whose time ran
+// out. The player is sent escort_warning when they stray too far and escort_status once back.
+func (qm *QuestManager) updateEscorts(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if len(qm.escorts) == 0 || gs.currentTick < qm.nextEscorts {
+		return
+	}
+	qm.nextEscorts = gs.currentTick + escortCheckInterval
+
+	ids := make([]int, 0, len(qm.escorts))
+	for id := range qm.escorts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		escort, ok := qm.escorts[id]
+		if !ok {
+			// Ended with another escort of its quest
+			continue
+		}
+		objective, ok := qm.objective(escort)
+		if !ok {
+			qm.logger.Warn("Quest %s has no escort objective %d any more; removing NPC %d", escort.QuestID, escort.Objective, id)
+			delete(qm.escorts, id)
+			gs.npcManager.Despawn(gs, id)
+			continue
+		}
+		npc, alive := gs.npcManager.Get(id)
+		switch {
+		case !alive:
+			qm.failQuest(ctx, gs, escort.PlayerID, escort.QuestID, QuestFailedEscortKilled, dispatcher)
+			continue
+		case gs.inRegion(objective.Destination, npc.Body.Position):
+			qm.arrive(ctx, gs, escort, dispatcher)
+			continue
+		case escort.deadline != 0 && gs.currentTick >= escort.deadline:
+			qm.failQuest(ctx, gs, escort.PlayerID, escort.QuestID, QuestFailedTimeout, dispatcher)
+			continue
+		}
+
+		rb := gs.PlayerBody(escort.PlayerID)
+		if rb != nil && rb.Position.Sub(npc.Body.Position).Magnitude() <= objective.MaxDistance {
+			if escort.awaySince != 0 {
+				escort.awaySince = 0
+				qm.send(gs, escort.PlayerID, "escort_status", map[string]any{"questId": escort.QuestID, "npcId": id, "away": false}, dispatcher)
+			}
+			continue
+		}
+		if escort.awaySince == 0 {
+			escort.awaySince = gs.currentTick
+			qm.send(gs, escort.PlayerID, "escort_warning", map[string]any{"questId": escort.QuestID, "npcId": id, "seconds": objective.LeaveTime}, dispatcher)
+		}
+		if gs.currentTick-escort.awaySince >= int64(objective.LeaveTime*TickRate) {
+			qm.failQuest(ctx, gs, escort.PlayerID, escort.QuestID, QuestFailedAbandoned, dispatcher)
+		}
+	}
+}
+
+// arrive completes an escort objective: the NPC, safe at its destination, leaves the world
+func (qm *QuestManager) arrive(ctx context.Context, gs *GameMatchState, escort *QuestEscort, dispatcher runtime.MatchDispatcher) {
+	delete(qm.escorts, escort.NPCID)
+	gs.npcManager.Despawn(gs, escort.NPCID)
+	log := qm.logs[escort.PlayerID]
+	if log == nil {
+		return
+	}
+	quest, ok := log.Active[escort.QuestID]
+	if !ok || escort.Objective >= len(quest.Progress) {
+		return
+	}
+	quest.Progress[escort.Objective] = 1
+	if err := qm.db.SaveQuestLog(ctx, log); err != nil {
+		// The progress stays in memory and is written with the next change
+		qm.logger.Error("Failed to save quest progress of %s: %v", escort.PlayerID, err)
+	}
+	qm.logger.Info("Player %s escorted NPC %d of quest %s to its destination", escort.PlayerID, escort.NPCID, escort.QuestID)
+	qm.sendLog(ctx, gs, escort.PlayerID, dispatcher)
+	qm.refreshMarkers(ctx, gs, escort.PlayerID, gs.npcManager.Snapshot(), dispatcher)
+}
+
+// failQuest drops a quest the player can no longer finish: its escorts are removed, and the
+// player is sent quest_failed with the reason and their new log
+func (qm *QuestManager) failQuest(ctx context.Context, gs *GameMatchState, playerID, questID, reason string, dispatcher runtime.MatchDispatcher) {
+	qm.stopEscorts(gs, playerID, questID)
+	log := qm.logs[playerID]
+	if log == nil {
+		return
+	}
+	if _, ok := log.Active[questID]; !ok {
+		return
+	}
+	delete(log.Active, questID)
+	if err := qm.db.SaveQuestLog(ctx, log); err != nil {
+		// Saved with the next change; until then the quest fails again when the player returns
+		qm.logger.Error("Failed to save the failed quest %s of %s: %v", questID, playerID, err)
+	}
+	qm.logger.Info("Player %s failed quest %s (%s)", playerID, questID, reason)
+	gs.eventBus.Publish(EventQuestFailed, map[string]any{"playerId": playerID, "questId": questID, "reason": reason})
+	qm.send(gs, playerID, "quest_failed", map[string]any{"questId": questID, "reason": reason}, dispatcher)
+	qm.sendLog(ctx, gs, playerID, dispatcher)
+	qm.refreshMarkers(ctx, gs, playerID, gs.npcManager.Snapshot(), dispatcher)
+}
+
+// inRegion reports whether a point lies in any rectangle of the region id
+func (gs *GameMatchState) inRegion(id string, p vector.Vector) bool {
+	if gs.currentMap == nil || id == "" {
+		return false
+	}
+	for i := range gs.currentMap.Regions {
+		if gs.currentMap.Regions[i].ID == id && gs.currentMap.Regions[i].Contains(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,701 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Quest objective types
+const (
+	QuestObjectiveKill    = "kill"    // kill Count NPCs of type Target (kills by the player's pet count)
+	QuestObjectiveGather  = "gather"  // gather Count of the item Target from resource nodes
+	QuestObjectiveCollect = "collect" // hand in Count of the item Target when turning the quest in
+	QuestObjectiveEscort  = "escort"  // bring a spawned NPC of type Target to the Destination region (quest_escort.go)
+)
+
+// Quest markers: what an NPC has for a player, shown above its head
+const (
+	QuestMarkerAvailable   = "available"   // offers a quest the player can accept
+	QuestMarkerInProgress  = "in_progress" // gave or takes back a quest the player hasn't finished
+	QuestMarkerCompletable = "completable" // takes back a finished quest
+)
+
+// Bus event published when a player turns a quest in
+const EventQuestCompleted = "quest_completed" // playerId, questId, npcId
+
+// Quest tuning
+const (
+	questMaxActive      = 20       // quests a player may have accepted at once
+	questMarkerRange    = 640.0    // markers are sent for quest NPCs within this distance of the player
+	questMarkerInterval = TickRate // ticks between marker refreshes
+)
+
+// QuestObjective is one goal of a quest
+type QuestObjective struct {
+	Type   string `json:"type"`            // QuestObjective*
+	Target string `json:"target"`          // NPC type (kill, escort) or item ID (gather, collect)
+	Count  int    `json:"count,omitempty"` // default 1
+
+	// Escort objectives (quest_escort.go)
+	Start       string  `json:"start,omitempty"`       // map marker the NPC spawns at (default where the giver stands)
+	Destination string  `json:"destination,omitempty"` // region the NPC must reach
+	Path        string  `json:"path,omitempty"`        // map path the NPC walks (default it follows the player)
+	MaxDistance float64 `json:"maxDistance,omitempty"` // how far the player may stray from the NPC (default defaultEscortMaxDistance)
+	LeaveTime   float64 `json:"leaveTime,omitempty"`   // seconds the player may stay further away (default defaultEscortLeaveTime)
+	TimeLimit   float64 `json:"timeLimit,omitempty"`   // seconds to reach the destination (0 = no limit)
+}
+
+// QuestDialogue is what the quest's NPCs say about it, by state
+type QuestDialogue struct {
+	Offer    string `json:"offer,omitempty"`    // the giver offering the quest
+	Progress string `json:"progress,omitempty"` // while the quest is unfinished
+	Complete string `json:"complete,omitempty"` // the turn-in NPC when the quest is finished
+}
+
+// QuestDefinition describes a quest, who gives it and what it rewards
+type QuestDefinition struct {
+	ID               string           `json:"id"`
+	Name             string           `json:"name"`
+	Description      string           `json:"description,omitempty"`
+	Giver            string           `json:"giver"`                // NPC type offering the quest
+	TurnIn           string           `json:"turnIn,omitempty"`     // NPC type taking it back (default Giver)
+	Requires         []string         `json:"requires,omitempty"`   // quests that must have been turned in first
+	Repeatable       bool             `json:"repeatable,omitempty"` // may be accepted again after turning it in
+	Solo             bool             `json:"solo,omitempty"`       // kills and gathers by party members don't count
+	Objectives       []QuestObjective `json:"objectives"`
+	RewardItems      map[string]int   `json:"rewardItems,omitempty"`      // item ID -> count granted on turn-in
+	RewardLoot       string           `json:"rewardLoot,omitempty"`       // loot table rolled on turn-in
+	RewardReputation map[string]int   `json:"rewardReputation,omitempty"` // faction ID -> standing change on turn-in (reputation.go)
+	Dialogue         QuestDialogue    `json:"dialogue"`
+}
+
+// QuestData is an accepted quest in the quest_log sent to its player. Texts are rendered in the
+// player's locale from the quest's message keys (see questTextKey), falling back to the
+// definition.
+type QuestData struct {
+	ID             string               `json:"id"`
+	Name           string               `json:"name"`
+	NameKey        string               `json:"nameKey"`
+	Description    string               `json:"description,omitempty"`
+	DescriptionKey string               `json:"descriptionKey,omitempty"`
+	Objectives     []QuestObjectiveData `json:"objectives"`
+	Completable    bool                 `json:"completable"`
+}
+
+// QuestObjectiveData is an objective with the player's progress
+type QuestObjectiveData struct {
+	Type     string `json:"type"`
+	Target   string `json:"target"`
+	Count    int    `json:"count"`
+	Progress int    `json:"progress"`
+}
+
+// QuestOption is a quest an NPC talks about in quest_dialogue
+type QuestOption struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	NameKey string `json:"nameKey"`
+	Status  string `json:"status"` // QuestMarker*
+	Text    string `json:"text,omitempty"`
+	TextKey string `json:"textKey,omitempty"`
+}
+
+// questTextKey is the message key of a quest text ("name", "description", "offer", "progress"
+// or "complete"), e.g. "quest.wolves.offer"
+func questTextKey(questID, text string) string {
+	return "quest." + questID + "." + text
+}
+
+// QuestManager owns the quest definitions and the quest logs of online players, tracks kill and
+// escort objectives and sends quest markers for nearby NPCs. It is only used from the match loop.
+type QuestManager struct {
+	logger      runtime.Logger
+	db          *DatabaseManager
+	definitions map[string]*QuestDefinition
+	byNPC       map[string][]*QuestDefinition // NPC type -> quests it gives or takes back
+	logs        map[string]*PersistedQuestLog // player ID -> quest log of online players
+	markers     map[string]map[int]string     // player ID -> markers last sent (NPC ID -> marker)
+	nextMarkers int64
+	escorts     map[int]*QuestEscort // escort NPC ID -> escort (quest_escort.go)
+	nextEscorts int64
+}
+
+// NewQuestManager creates a manager and loads definitions from path (a JSON object keyed by quest ID)
+func NewQuestManager(logger runtime.Logger, db *DatabaseManager, path string) *QuestManager {
+	qm := &QuestManager{
+		logger:      logger,
+		db:          db,
+		definitions: make(map[string]*QuestDefinition),
+		byNPC:       make(map[string][]*QuestDefinition),
+		logs:        make(map[string]*PersistedQuestLog),
+		markers:     make(map[string]map[int]string),
+		escorts:     make(map[int]*QuestEscort),
+	}
+	if err := qm.Load(path); err != nil {
+		logger.Warn("Failed to load quest definitions from %s: %v", path, err)
+	}
+	return qm
+}
+
+// Load replaces the quest definitions with the ones found in path
+func (qm *QuestManager) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var definitions map[string]*QuestDefinition
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return err
+	}
+	byNPC := make(map[string][]*QuestDefinition)
+	for id, def := range definitions {
+		def.ID = id
+		if def.Name == "" {
+			def.Name = id
+		}
+		if def.TurnIn == "" {
+			def.TurnIn = def.Giver
+		}
+		for i := range def.Objectives {
+			if def.Objectives[i].Count <= 0 {
+				def.Objectives[i].Count = 1
+			}
+			if def.Objectives[i].Type == QuestObjectiveEscort {
+				qm.normalizeEscort(id, &def.Objectives[i])
+			}
+		}
+		byNPC[def.Giver] = append(byNPC[def.Giver], def)
+		if def.TurnIn != def.Giver {
+			byNPC[def.TurnIn] = append(byNPC[def.TurnIn], def)
+		}
+	}
+	for _, quests := range byNPC {
+		sort.Slice(quests, func(i, j int) bool { return quests[i].ID < quests[j].ID })
+	}
+	qm.definitions = definitions
+	qm.byNPC = byNPC
+
+	qm.logger.Info("Loaded %d quest definitions from %s", len(definitions), path)
+	return nil
+}
+
+// SubscribeEvents counts NPC kills towards kill objectives and gathered items towards gather
+// objectives, for the player and the members of their party near them
+func (qm *QuestManager) SubscribeEvents(eb *EventBus) {
+	eb.Subscribe(EventNPCKilled, func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		killer, _ := event.Data["killer"].(string)
+		npcType, _ := event.Data["npcType"].(string)
+		if killer != "" && npcType != "" {
+			qm.credit(ctx, gs, killer, eventPosition(event), QuestObjectiveKill, map[string]int{npcType: 1}, dispatcher)
+		}
+	})
+	eb.Subscribe(EventResourceGathered, func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		playerID, _ := event.Data["playerId"].(string)
+		items, _ := event.Data["items"].(map[string]any)
+		gathered := make(map[string]int, len(items))
+		for itemID, count := range items {
+			if n, ok := count.(int); ok {
+				gathered[itemID] = n
+			}
+		}
+		if playerID != "" && len(gathered) > 0 {
+			qm.credit(ctx, gs, playerID, eventPosition(event), QuestObjectiveGather, gathered, dispatcher)
+		}
+	})
+}
+
+// eventPosition reads the x and y of a bus event
+func eventPosition(event GameEvent) vector.Vector {
+	x, _ := event.Data["x"].(float64)
+	y, _ := event.Data["y"].(float64)
+	return vector.Vector{X: x, Y: y}
+}
+
+// credit advances the player's objectives of a type for the given targets (NPC types or item
+// IDs, with their counts), and those of the members of their party within partyShareRange of
+// position, except on solo quests
+func (qm *QuestManager) credit(ctx context.Context, gs *GameMatchState, playerID string, position vector.Vector, objectiveType string, targets map[string]int, dispatcher runtime.MatchDispatcher) {
+	qm.recordProgress(ctx, gs, playerID, objectiveType, targets, false, dispatcher)
+	for _, memberID := range gs.parties.NearbyMembers(gs, playerID, position) {
+		qm.recordProgress(ctx, gs, memberID, objectiveType, targets, true, dispatcher)
+	}
+}
+
+// LoadPlayer loads a joining player's quest log and sends it to them. Escort quests they left
+// unfinished fail.
+func (qm *QuestManager) LoadPlayer(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	log, err := qm.db.LoadQuestLog(ctx, playerID)
+	if err != nil {
+		qm.logger.Error("Failed to load quest log for %s: %v", playerID, err)
+		return
+	}
+	qm.logs[playerID] = log
+	qm.failLostEscorts(ctx, gs, playerID, dispatcher)
+	qm.sendLog(ctx, gs, playerID, dispatcher)
+}
+
+// UnloadPlayer releases a leaving player's quest log and removes their escorts. Changes are
+// saved as they happen.
+func (qm *QuestManager) UnloadPlayer(gs *GameMatchState, playerID string) {
+	qm.stopEscorts(gs, playerID, "")
+	delete(qm.logs, playerID)
+	delete(qm.markers, playerID)
+}
+
+// Update checks the running escorts and refreshes the quest markers of every online player.
+// Called from the match loop.
+func (qm *QuestManager) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	qm.updateEscorts(ctx, gs, dispatcher)
+	if gs.currentTick < qm.nextMarkers || len(qm.byNPC) == 0 {
+		return
+	}
+	qm.nextMarkers = gs.currentTick + questMarkerInterval
+	npcs := gs.npcManager.Snapshot()
+	for playerID := range qm.logs {
+		qm.refreshMarkers(ctx, gs, playerID, npcs, dispatcher)
+	}
+}
+
+// Talk opens the dialogue of the NPC npcID: its greeting and the quests it offers, follows or
+// takes back for the player. The NPC's behavior script runs with ctx.event = "talk". It returns
+// a rejection reason, or "".
+func (qm *QuestManager) Talk(ctx context.Context, gs *GameMatchState, playerID string, npcID int, dispatcher runtime.MatchDispatcher) string {
+	npc, reason := qm.reachNPC(gs, playerID, npcID)
+	if reason != "" {
+		return reason
+	}
+
+	locale := gs.Locale(playerID)
+	options := make([]QuestOption, 0)
+	if log := qm.logs[playerID]; log != nil {
+		for _, def := range qm.byNPC[npc.Def.ID] {
+			status := qm.status(ctx, gs, playerID, log, def, npc.Def.ID)
+			if status == "" {
+				continue
+			}
+			nameKey := questTextKey(def.ID, "name")
+			option := QuestOption{ID: def.ID, Name: localizedOr(locale, nameKey, def.Name), NameKey: nameKey, Status: status}
+			text, textName := "", ""
+			switch status {
+			case QuestMarkerAvailable:
+				text, textName = def.Dialogue.Offer, "offer"
+			case QuestMarkerInProgress:
+				text, textName = def.Dialogue.Progress, "progress"
+			case QuestMarkerCompletable:
+				text, textName = def.Dialogue.Complete, "complete"
+			}
+			if textName != "" {
+				option.TextKey = questTextKey(def.ID, textName)
+				option.Text = localizedOr(locale, option.TextKey, text)
+			}
+			options = append(options, option)
+		}
+	}
+	qm.send(gs, playerID, "quest_dialogue", map[string]any{
+		"npcId":       npc.ID,
+		"name":        npc.Def.Name,
+		"greeting":    localizedOr(locale, "npc."+npc.Def.ID+".greeting", npc.Def.Greeting),
+		"greetingKey": "npc." + npc.Def.ID + ".greeting",
+		"quests":      options,
+	}, dispatcher)
+
+	if npc.Def.Script != "" {
+		params := map[string]any{
+			"npcId":    npc.ID,
+			"npcType":  npc.Def.ID,
+			"x":        npc.Body.Position.X,
+			"y":        npc.Body.Position.Y,
+			"event":    "talk",
+			"playerId": playerID,
+		}
+		if err := gs.RunScript(ctx, npc.Def.Script, params, dispatcher, qm.logger); err != nil {
+			qm.logger.Error("NPC %d talk script error: %v", npc.ID, err)
+		}
+	}
+	return ""
+}
+
+// Accept takes the quest questID from its giver npcID. It returns a rejection reason, or "".
+func (qm *QuestManager) Accept(ctx context.Context, gs *GameMatchState, playerID string, npcID int, questID string, dispatcher runtime.MatchDispatcher) string {
+	def, ok := qm.definitions[questID]
+	if !ok {
+		return RejectUnknownQuest
+	}
+	npc, reason := qm.reachNPC(gs, playerID, npcID)
+	if reason != "" {
+		return reason
+	}
+	if npc.Def.ID != def.Giver {
+		return RejectInvalidTarget
+	}
+	return qm.start(ctx, gs, playerID, def, npc, dispatcher)
+}
+
+// Start gives a player the quest questID without its giver, e.g. from a script effect. Escorted
+// NPCs without a start marker appear at the player. It returns a rejection reason, or "".
+func (qm *QuestManager) Start(ctx context.Context, gs *GameMatchState, playerID, questID string, dispatcher runtime.MatchDispatcher) string {
+	def, ok := qm.definitions[questID]
+	if !ok {
+		return RejectUnknownQuest
+	}
+	return qm.start(ctx, gs, playerID, def, nil, dispatcher)
+}
+
+// start adds an available quest to a player's log and starts its escorts; giver is nil for
+// quests not taken from an NPC
+func (qm *QuestManager) start(ctx context.Context, gs *GameMatchState, playerID string, def *QuestDefinition, giver *NPC, dispatcher runtime.MatchDispatcher) string {
+	questID := def.ID
+	log := qm.logs[playerID]
+	if log == nil {
+		return RejectStorageError
+	}
+	if !qm.available(log, def) {
+		return RejectQuestUnavailable
+	}
+	if len(log.Active) >= questMaxActive {
+		return RejectQuestLogFull
+	}
+
+	log.Active[questID] = &PersistedQuest{Progress: make([]int, len(def.Objectives)), AcceptedAt: time.Now()}
+	if err := qm.db.SaveQuestLog(ctx, log); err != nil {
+		delete(log.Active, questID)
+		return RejectStorageError
+	}
+	qm.logger.Info("Player %s accepted quest %s", playerID, questID)
+	qm.startEscorts(gs, playerID, def, giver)
+	qm.sendLog(ctx, gs, playerID, dispatcher)
+	qm.refreshMarkers(ctx, gs, playerID, gs.npcManager.Snapshot(), dispatcher)
+	return ""
+}
+
+// TurnIn hands the finished quest questID to its turn-in NPC npcID: collect objectives take
+// their items, and the rewards are granted. It returns the rewards and a rejection reason.
+func (qm *QuestManager) TurnIn(ctx context.Context, gs *GameMatchState, playerID string, npcID int, questID string, dispatcher runtime.MatchDispatcher) ([]LootStack, string) {
+	def, ok := qm.definitions[questID]
+	if !ok {
+		return nil, RejectUnknownQuest
+	}
+	npc, reason := qm.reachNPC(gs, playerID, npcID)
+	if reason != "" {
+		return nil, reason
+	}
+	if npc.Def.ID != def.TurnIn {
+		return nil, RejectInvalidTarget
+	}
+	log := qm.logs[playerID]
+	if log == nil {
+		return nil, RejectStorageError
+	}
+	quest, ok := log.Active[questID]
+	if !ok {
+		return nil, RejectQuestUnavailable
+	}
+	if !qm.completable(ctx, gs, playerID, def, quest) {
+		return nil, RejectQuestIncomplete
+	}
+
+	handIn := make(map[string]int)
+	for _, objective := range def.Objectives {
+		if objective.Type == QuestObjectiveCollect {
+			handIn[objective.Target] += objective.Count
+		}
+	}
+	if err := gs.inventoryManager.RemoveAll(ctx, playerID, handIn); err != nil {
+		if err == errNotEnoughItems {
+			return nil, RejectQuestIncomplete
+		}
+		qm.logger.Error("turn_in: failed to take quest items from %s: %v", playerID, err)
+		return nil, RejectStorageError
+	}
+
+	delete(log.Active, questID)
+	log.Completed[questID]++
+	if err := qm.db.SaveQuestLog(ctx, log); err != nil {
+		log.Active[questID] = quest
+		if log.Completed[questID]--; log.Completed[questID] <= 0 {
+			delete(log.Completed, questID)
+		}
+		for itemID, count := range handIn {
+			if err := gs.inventoryManager.Add(ctx, playerID, itemID, count); err != nil {
+				qm.logger.Error("turn_in: failed to refund %d x %s to %s: %v", count, itemID, playerID, err)
+			}
+		}
+		return nil, RejectStorageError
+	}
+
+	rewards := make([]LootStack, 0, len(def.RewardItems))
+	for itemID, count := range def.RewardItems {
+		rewards = append(rewards, LootStack{ItemID: itemID, Count: count})
+	}
+	sort.Slice(rewards, func(i, j int) bool { return rewards[i].ItemID < rewards[j].ItemID })
+	if def.RewardLoot != "" {
+		rewards = append(rewards, gs.lootCatalog.Roll(gs, def.RewardLoot, LootContext{PlayerID: playerID})...)
+	}
+	for _, stack := range rewards {
+		if err := gs.inventoryManager.Add(ctx, playerID, stack.ItemID, stack.Count); err != nil {
+			qm.logger.Error("turn_in: failed to grant %d x %s to %s: %v", stack.Count, stack.ItemID, playerID, err)
+		}
+	}
+	gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+
+	qm.logger.Info("Player %s turned in quest %s", playerID, questID)
+	gs.eventBus.Publish(EventQuestCompleted, map[string]any{"playerId": playerID, "questId": questID, "npcId": npcID})
+	qm.sendLog(ctx, gs, playerID, dispatcher)
+	qm.refreshMarkers(ctx, gs, playerID, gs.npcManager.Snapshot(), dispatcher)
+	return rewards, ""
+}
+
+// Abandon drops the accepted quest questID and its progress, removing its escorts. It returns a
+// rejection reason, or "".
+func (qm *QuestManager) Abandon(ctx context.Context, gs *GameMatchState, playerID, questID string, dispatcher runtime.MatchDispatcher) string {
+	log := qm.logs[playerID]
+	if log == nil {
+		return RejectStorageError
+	}
+	quest, ok := log.Active[questID]
+	if !ok {
+		return RejectQuestUnavailable
+	}
+	delete(log.Active, questID)
+	if err := qm.db.SaveQuestLog(ctx, log); err != nil {
+		log.Active[questID] = quest
+		return RejectStorageError
+	}
+	qm.stopEscorts(gs, playerID, questID)
+	qm.sendLog(ctx, gs, playerID, dispatcher)
+	qm.refreshMarkers(ctx, gs, playerID, gs.npcManager.Snapshot(), dispatcher)
+	return ""
+}
+
+// recordProgress advances the player's objectives of a type for the targets; a party member's
+// credit skips solo quests
+func (qm *QuestManager) recordProgress(ctx context.Context, gs *GameMatchState, playerID, objectiveType string, targets map[string]int, byParty bool, dispatcher runtime.MatchDispatcher) {
+	log := qm.logs[playerID]
+	if log == nil {
+		return
+	}
+	changed := false
+	for questID, quest := range log.Active {
+		def, ok := qm.definitions[questID]
+		if !ok || (byParty && def.Solo) {
+			continue
+		}
+		for i, objective := range def.Objectives {
+			amount := targets[objective.Target]
+			if objective.Type != objectiveType || amount <= 0 || i >= len(quest.Progress) {
+				continue
+			}
+			if quest.Progress[i] < objective.Count {
+				quest.Progress[i] += amount
+				if quest.Progress[i] > objective.Count {
+					quest.Progress[i] = objective.Count
+				}
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := qm.db.SaveQuestLog(ctx, log); err != nil {
+		// The progress stays in memory and is written with the next change
+		qm.logger.Error("Failed to save quest progress of %s: %v", playerID, err)
+	}
+	qm.sendLog(ctx, gs, playerID, dispatcher)
+}
+
+// available reports whether the player may accept the quest
+func (qm *QuestManager) available(log *PersistedQuestLog, def *QuestDefinition) bool {
+	if _, active := log.Active[def.ID]; active {
+		return false
+	}
+	if log.Completed[def.ID] > 0 && !def.Repeatable {
+		return false
+	}
+	for _, required := range def.Requires {
+		if log.Completed[required] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// progress returns the player's progress on an objective: kills or gathers so far, whether the
+// escort arrived, or the items they carry
+func (qm *QuestManager) progress(ctx context.Context, gs *GameMatchState, playerID string, objective QuestObjective, quest *PersistedQuest, i int) int {
+	count := 0
+	switch objective.Type {
+	case QuestObjectiveKill, QuestObjectiveGather, QuestObjectiveEscort:
+		if i < len(quest.Progress) {
+			count = quest.Progress[i]
+		}
+	case QuestObjectiveCollect:
+		count = gs.inventoryManager.Count(ctx, playerID, objective.Target)
+	}
+	if count > objective.Count {
+		count = objective.Count
+	}
+	return count
+}
+
+// completable reports whether every objective of an accepted quest is met
+func (qm *QuestManager) completable(ctx context.Context, gs *GameMatchState, playerID string, def *QuestDefinition, quest *PersistedQuest) bool {
+	for i, objective := range def.Objectives {
+		if qm.progress(ctx, gs, playerID, objective, quest, i) < objective.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// status returns the marker an NPC of type npcType shows the player for the quest ("" for none)
+func (qm *QuestManager) status(ctx context.Context, gs *GameMatchState, playerID string, log *PersistedQuestLog, def *QuestDefinition, npcType string) string {
+	if quest, active := log.Active[def.ID]; active {
+		if npcType == def.TurnIn && qm.completable(ctx, gs, playerID, def, quest) {
+			return QuestMarkerCompletable
+		}
+		return QuestMarkerInProgress
+	}
+	if npcType == def.Giver && qm.available(log, def) {
+		return QuestMarkerAvailable
+	}
+	return ""
+}
+
+// marker returns the most important marker of an NPC type for the player: completable, then
+// available, then in progress
+func (qm *QuestManager) marker(ctx context.Context, gs *GameMatchState, playerID string, log *PersistedQuestLog, npcType string) string {
+	best := ""
+	for _, def := range qm.byNPC[npcType] {
+		switch qm.status(ctx, gs, playerID, log, def, npcType) {
+		case QuestMarkerCompletable:
+			return QuestMarkerCompletable
+		case QuestMarkerAvailable:
+			best = QuestMarkerAvailable
+		case QuestMarkerInProgress:
+			if best == "" {
+				best = QuestMarkerInProgress
+			}
+		}
+	}
+	return best
+}
+
+// refreshMarkers sends the player the markers of the quest NPCs near them when they changed
+func (qm *QuestManager) refreshMarkers(ctx context.Context, gs *GameMatchState, playerID string, npcs []NPCData, dispatcher runtime.MatchDispatcher) {
+	log := qm.logs[playerID]
+	rb := gs.PlayerBody(playerID)
+	if log == nil || rb == nil {
+		return
+	}
+	markers := make(map[int]string)
+	for _, npc := range npcs {
+		if len(qm.byNPC[npc.Type]) == 0 {
+			continue
+		}
+		if npc.Position.ToVector().Sub(rb.Position).Magnitude() > questMarkerRange {
+			continue
+		}
+		if def, ok := gs.npcManager.Definition(npc.Type); ok && gs.reputation.IsHostile(playerID, def.Faction) {
+			continue
+		}
+		if marker := qm.marker(ctx, gs, playerID, log, npc.Type); marker != "" {
+			markers[npc.ID] = marker
+		}
+	}
+	if previous, sent := qm.markers[playerID]; sent && maps.Equal(previous, markers) {
+		return
+	}
+	qm.markers[playerID] = markers
+	qm.send(gs, playerID, "quest_markers", map[string]any{"markers": markers}, dispatcher)
+}
+
+// reachNPC returns the NPC npcID if the player can talk to it: within interact reach of its
+// edge and in line of sight. Pets and NPCs whose faction is hostile to the player don't talk.
+func (qm *QuestManager) reachNPC(gs *GameMatchState, playerID string, npcID int) (*NPC, string) {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return nil, RejectNoPlayerObject
+	}
+	npc, ok := gs.npcManager.Get(npcID)
+	if !ok || npc.Pet != nil {
+		return nil, RejectInvalidTarget
+	}
+	if gs.reputation.IsHostile(playerID, npc.Def.Faction) {
+		return nil, RejectHostile
+	}
+	reach := defaultInteractRange + max(rb.Width, rb.Height)/2 + npc.Def.Size/2
+	if npc.Body.Position.Sub(rb.Position).Magnitude() > reach {
+		return nil, RejectOutOfRange
+	}
+	if !gs.HasLineOfSight(rb.Position, npc.Body.Position, 0) {
+		return nil, RejectNoLineOfSight
+	}
+	return npc, ""
+}
+
+// sendLog sends the player their accepted quests with progress and the quests they completed
+func (qm *QuestManager) sendLog(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	log := qm.logs[playerID]
+	if log == nil {
+		return
+	}
+	active := make([]QuestData, 0, len(log.Active))
+	for questID, quest := range log.Active {
+		def, ok := qm.definitions[questID]
+		if !ok {
+			continue
+		}
+		data := QuestData{
+			ID:             def.ID,
+			Name:           localizedOr(gs.Locale(playerID), questTextKey(def.ID, "name"), def.Name),
+			NameKey:        questTextKey(def.ID, "name"),
+			Description:    localizedOr(gs.Locale(playerID), questTextKey(def.ID, "description"), def.Description),
+			DescriptionKey: questTextKey(def.ID, "description"),
+			Completable:    true,
+		}
+		for i, objective := range def.Objectives {
+			progress := qm.progress(ctx, gs, playerID, objective, quest, i)
+			data.Objectives = append(data.Objectives, QuestObjectiveData{
+				Type:     objective.Type,
+				Target:   objective.Target,
+				Count:    objective.Count,
+				Progress: progress,
+			})
+			if progress < objective.Count {
+				data.Completable = false
+			}
+		}
+		active = append(active, data)
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].ID < active[j].ID })
+	completed := make([]string, 0, len(log.Completed))
+	for questID := range log.Completed {
+		completed = append(completed, questID)
+	}
+	sort.Strings(completed)
+
+	qm.send(gs, playerID, "quest_log", map[string]any{"active": active, "completed": completed}, dispatcher)
+}
+
+// send delivers an OpCodeQuest message to one player
+func (qm *QuestManager) send(gs *GameMatchState, playerID, msgType string, payload any, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeQuest, msgType, payload)
+	if err != nil {
+		qm.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeQuest, data, []runtime.Presence{presence}, nil, true)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// maxRegionVars bounds the variables one region may hold
+const maxRegionVars = 256
+
+// RegionVars holds script variables scoped to a map region: a script reads and writes those of
+// the region its object sits in, so the four levers of one dungeon room share a "levers_pulled"
+// count without clashing with another room's. They are kept per map; persistent ones survive
+// restarts.
+type RegionVars struct {
+	values     map[string]map[string]any  // region ID -> key -> value
+	persistent map[string]map[string]bool // region ID -> keys that survive match restarts
+	dirty      bool                       // persistent keys changed since last save
+	mu         sync.Mutex
+}
+
+// NewRegionVars creates an empty region variable store
+func NewRegionVars() *RegionVars {
+	return &RegionVars{
+		values:     make(map[string]map[string]any),
+		persistent: make(map[string]map[string]bool),
+	}
+}
+
+// Get returns the value a region stores under key
+func (rv *RegionVars) Get(region, key string) (any, bool) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	v, ok := rv.values[region][key]
+	return v, ok
+}
+
+// Set stores a value in a region; a nil value deletes the variable. It returns false when the
+// region already holds maxRegionVars other variables.
+func (rv *RegionVars) Set(region, key string, value any, persist bool) bool {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	values := rv.values[region]
+	if value == nil {
+		if rv.persistent[region][key] {
+			rv.dirty = true
+		}
+		delete(values, key)
+		delete(rv.persistent[region], key)
+		if len(values) == 0 {
+			delete(rv.values, region)
+			delete(rv.persistent, region)
+		}
+		return true
+	}
+	if values == nil {
+		values = make(map[string]any)
+		rv.values[region] = values
+	}
+	if _, ok := values[key]; !ok && len(values) >= maxRegionVars {
+		return false
+	}
+	values[key] = value
+	if persist {
+		if rv.persistent[region] == nil {
+			rv.persistent[region] = make(map[string]bool)
+		}
+		rv.persistent[region][key] = true
+	}
+	if rv.persistent[region][key] {
+		rv.dirty = true
+	}
+	return true
+}
+
+// Clear deletes every variable of a region, e.g. when its puzzle resets
+func (rv *RegionVars) Clear(region string) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	if len(rv.persistent[region]) > 0 {
+		rv.dirty = true
+	}
+	delete(rv.values, region)
+	delete(rv.persistent, region)
+}
+
+// Snapshot returns a copy of the persistent variables by region and clears the dirty flag
+func (rv *RegionVars) Snapshot() (map[string]map[string]any, bool) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	out := make(map[string]map[string]any, len(rv.persistent))
+	for region, keys := range rv.persistent {
+		for key := range keys {
+			if v, ok := rv.values[region][key]; ok {
+				if out[region] == nil {
+					out[region] = make(map[string]any, len(keys))
+				}
+				out[region][key] = v
+			}
+		}
+	}
+	dirty := rv.dirty
+	rv.dirty = false
+	return out, dirty
+}
+
+// Restore loads the variables saved for the match's map (called once on match init)
+func (rv *RegionVars) Restore(ctx context.Context, gs *GameMatchState) error {
+	saved, err := gs.databaseManager.LoadRegionVars(ctx, gs.currentMapName)
+	if err != nil {
+		return err
+	}
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	for region, values := range saved.Regions {
+		for key, v := range values {
+			if rv.values[region] == nil {
+				rv.values[region] = make(map[string]any)
+				rv.persistent[region] = make(map[string]bool)
+			}
+			rv.values[region][key] = v
+			rv.persistent[region][key] = true
+		}
+	}
+	return nil
+}
+
+// Reset deletes every variable; the world reset deletes the saved ones
+func (rv *RegionVars) Reset() {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.values = make(map[string]map[string]any)
+	rv.persistent = make(map[string]map[string]bool)
+	rv.dirty = false
+}
+
+// Save writes the persistent variables of a map to storage if any changed since the last save
+func (rv *RegionVars) Save(ctx context.Context, dm *DatabaseManager, mapName string) error {
+	values, dirty := rv.Snapshot()
+	if !dirty {
+		return nil
+	}
+	if err := dm.SaveRegionVars(ctx, &PersistedRegionVars{Map: mapName, Regions: values}); err != nil {
+		// Keep the dirty flag so the next periodic save retries
+		rv.mu.Lock()
+		rv.dirty = true
+		rv.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// scriptRegion returns the region a script's variables are scoped to: the region its object
+// (ctx.objectId) sits in, the region of a region script, or the region of the player it runs for.
+// It returns "" outside regions.
+func (gs *GameMatchState) scriptRegion(params map[string]any) string {
+	if oid, ok := params["objectId"].(int); ok && oid != 0 {
+		if obj, ok := gs.Object(oid); ok {
+			if p, ok := obj.Position(); ok {
+				if region := gs.RegionAt(p); region != nil {
+					return region.ID
+				}
+			}
+			return ""
+		}
+	}
+	if region, ok := params["region"].(string); ok {
+		return region
+	}
+	if playerID, ok := params["playerId"].(string); ok {
+		if state, ok := gs.playerStates[playerID]; ok {
+			return state.Region
+		}
+	}
+	return ""
+}
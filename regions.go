@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Region events published on the event bus
+const (
+	EventRegionEntered = "region_entered"
+	EventRegionExited  = "region_exited"
+)
+
+const regionObjectType = "region"
+
+// Region is a named map area ("region" objects), e.g. a town, the wilderness or a dungeon
+// entrance. Rectangles with the same object name form one region.
+type Region struct {
+	ID     string // object name
+	Name   string // shown to players ("displayName" property, default the object name)
+	Music  string
+	PvP    string // PvP mode inside ("" keeps the surrounding rules); also registered as a PvP zone
+	Script string // runs on enter and exit with ctx.event = region_entered/region_exited
+	// world updates per second sent to the players inside (0 = defaultWorldUpdateRate; broadcast_rates.go)
+	UpdateRate float64
+	// ambient NPCs kept alive inside: NPC type -> count ("population" property; ambient_population.go)
+	Population map[string]int
+	Min        vector.Vector
+	Max        vector.Vector
+}
+
+// Contains reports whether a point lies inside the region
+func (r *Region) Contains(p vector.Vector) bool {
+	return p.X >= r.Min.X && p.X <= r.Max.X && p.Y >= r.Min.Y && p.Y <= r.Max.Y
+}
+
+// RegionAt returns the innermost (smallest) region containing a position, or nil outside regions
+func (gs *GameMatchState) RegionAt(p vector.Vector) *Region {
+	if gs.currentMap == nil {
+		return nil
+	}
+	var found *Region
+	foundArea := 0.0
+	for i := range gs.currentMap.Regions {
+		region := &gs.currentMap.Regions[i]
+		if !region.Contains(p) {
+			continue
+		}
+		area := (region.Max.X - region.Min.X) * (region.Max.Y - region.Min.Y)
+		if found == nil || area < foundArea {
+			found, foundArea = region, area
+		}
+	}
+	return found
+}
+
+// regionName returns the display name of the region containing a position, or "" outside regions
+func (gs *GameMatchState) regionName(p vector.Vector) string {
+	if region := gs.RegionAt(p); region != nil {
+		return region.Name
+	}
+	return ""
+}
+
+// updateRegion detects the player moving into another region: it sends them region_entered,
+// runs the scripts of the regions left and entered and publishes the transition on the event bus
+func (gs *GameMatchState) updateRegion(ctx context.Context, playerID string, state *PlayerState, position vector.Vector, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	region := gs.RegionAt(position)
+	id := ""
+	if region != nil {
+		id = region.ID
+	}
+	if id == state.Region {
+		return
+	}
+	previous := state.Region
+	state.Region = id
+
+	if previous != "" {
+		data := map[string]any{"playerId": playerID, "region": previous, "next": id}
+		gs.eventBus.Publish(EventRegionExited, data)
+		gs.runRegionScript(ctx, gs.regionByID(previous), EventRegionExited, data, dispatcher, logger)
+	}
+
+	msg := map[string]any{"region": id, "previous": previous, "pvp": gs.PvPModeAt(position)}
+	if region != nil {
+		msg["name"] = region.Name
+		msg["music"] = region.Music
+		data := map[string]any{"playerId": playerID, "region": id, "previous": previous}
+		gs.eventBus.Publish(EventRegionEntered, data)
+		gs.runRegionScript(ctx, region, EventRegionEntered, data, dispatcher, logger)
+	}
+
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+	payload, err := EncodeMessage(OpCodeRegion, "region_entered", msg)
+	if err != nil {
+		logger.Error("Failed to marshal region_entered: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeRegion, payload, []runtime.Presence{presence}, nil, true)
+}
+
+// regionByID returns the first rectangle of a region, or nil
+func (gs *GameMatchState) regionByID(id string) *Region {
+	if gs.currentMap == nil {
+		return nil
+	}
+	for i := range gs.currentMap.Regions {
+		if gs.currentMap.Regions[i].ID == id {
+			return &gs.currentMap.Regions[i]
+		}
+	}
+	return nil
+}
+
+// runRegionScript runs a region's script with the transition's event data
+func (gs *GameMatchState) runRegionScript(ctx context.Context, region *Region, event string, data map[string]any, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if region == nil || region.Script == "" {
+		return
+	}
+	params := make(map[string]any, len(data)+1)
+	for k, v := range data {
+		params[k] = v
+	}
+	params["event"] = event
+	if err := gs.RunScript(ctx, region.Script, params, dispatcher, logger); err != nil {
+		logger.Error("Region %s %s script error: %v", region.ID, event, err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Replay tuning. The map properties "replaySeconds" (0 turns recording off) and
+// "replaySnapshotSeconds" override the defaults.
+const (
+	defaultReplaySeconds         = 120.0
+	defaultReplaySnapshotSeconds = 5.0
+	replayFormatVersion          = 1
+)
+
+var errReplayNotFound = runtime.NewError("no replay recorded for that match", rpcCodeNotFound)
+
+// ReplayInput is one player message as the match received it, with the outcome of processing it
+type ReplayInput struct {
+	Tick     int64           `json:"tick"`
+	UserID   string          `json:"userId"`
+	Data     json.RawMessage `json:"data"` // the message as sent by the client
+	Approved bool            `json:"approved"`
+	Reason   string          `json:"reason,omitempty"`
+}
+
+// ReplayPresence is a player joining or leaving
+type ReplayPresence struct {
+	Tick     int64  `json:"tick"`
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Joined   bool   `json:"joined"`
+}
+
+// ReplayBody is a player's body and health in a snapshot
+type ReplayBody struct {
+	UserID string   `json:"userId"`
+	Pos    Position `json:"position"`
+	Vel    Position `json:"velocity"`
+	Facing float64  `json:"facing"`
+	Health float64  `json:"health"`
+	Dead   bool     `json:"dead,omitempty"`
+}
+
+// ReplaySnapshot is the state of the match at the start of a segment
+type ReplaySnapshot struct {
+	Tick    int64        `json:"tick"`
+	Players []ReplayBody `json:"players"`
+	NPCs    []NPCData    `json:"npcs"`
+}
+
+// ReplaySegment covers the ticks from one snapshot to the next: the snapshot, then every input
+// and presence change until EndTick
+type ReplaySegment struct {
+	Slot      int              `json:"slot"`
+	StartTick int64            `json:"startTick"`
+	EndTick   int64            `json:"endTick"`
+	Snapshot  ReplaySnapshot   `json:"snapshot"`
+	Inputs    []ReplayInput    `json:"inputs"`
+	Presences []ReplayPresence `json:"presences,omitempty"`
+}
+
+// ReplayFile is an exported replay
+type ReplayFile struct {
+	Version    int              `json:"version"`
+	MatchID    string           `json:"matchId"`
+	Map        string           `json:"map"`
+	TickRate   int              `json:"tickRate"`
+	ExportedAt time.Time        `json:"exportedAt"`
+	Segments   []*ReplaySegment `json:"segments"` // oldest first
+}
+
+// ReplayRecorder records the inputs a match receives and periodic snapshots, for debugging
+// desyncs and investigating cheat reports. Segments are written to the storage ring buffer
+// of the match (replaySeconds long) as they complete, so only the current one is kept in memory.
+// It is only used from the match loop.
+type ReplayRecorder struct {
+	logger        runtime.Logger
+	db            *DatabaseManager
+	matchID       string
+	mapName       string
+	snapshotTicks int64
+	slots         int
+	nextSlot      int
+	current       *ReplaySegment
+}
+
+// NewReplayRecorder creates a recorder that records nothing until Configure turns it on
+func NewReplayRecorder(logger runtime.Logger, db *DatabaseManager) *ReplayRecorder {
+	return &ReplayRecorder{logger: logger, db: db}
+}
+
+// Configure sizes the ring buffer from the map properties and writes the replay's index.
+// Recording stays off without a match ID or with "replaySeconds" 0.
+func (rr *ReplayRecorder) Configure(ctx context.Context, matchID, mapName string, props map[string]interface{}) {
+	seconds := defaultReplaySeconds
+	if v, ok := props["replaySeconds"].(float64); ok && v >= 0 {
+		seconds = v
+	}
+	snapshotSeconds := defaultReplaySnapshotSeconds
+	if v, ok := props["replaySnapshotSeconds"].(float64); ok && v > 0 {
+		snapshotSeconds = v
+	}
+	if matchID == "" || seconds == 0 {
+		return
+	}
+	rr.matchID = matchID
+	rr.mapName = mapName
+	rr.snapshotTicks = int64(math.Max(1, snapshotSeconds*TickRate))
+	rr.slots = int(math.Max(1, math.Ceil(seconds/snapshotSeconds)))
+
+	index := &PersistedReplayIndex{
+		MatchID:       matchID,
+		Map:           mapName,
+		TickRate:      TickRate,
+		Slots:         rr.slots,
+		SnapshotTicks: rr.snapshotTicks,
+		StartedAt:     time.Now().UTC(),
+	}
+	if err := rr.db.SaveReplayIndex(ctx, index); err != nil {
+		rr.logger.Error("Failed to start replay recording: %v", err)
+		rr.matchID = ""
+		return
+	}
+	rr.logger.Info("Recording replay of %s: %d segments of %.0f seconds", matchID, rr.slots, snapshotSeconds)
+}
+
+// Enabled reports whether the match is being recorded
+func (rr *ReplayRecorder) Enabled() bool {
+	return rr.matchID != ""
+}
+
+// RecordInput adds a player message and its ACK (nil when it produced none) to the replay
+func (rr *ReplayRecorder) RecordInput(gs *GameMatchState, userID string, data []byte, ack *InputACK) {
+	if rr.current == nil {
+		return
+	}
+	input := ReplayInput{Tick: gs.currentTick, UserID: userID, Data: append(json.RawMessage(nil), data...)}
+	if !json.Valid(data) {
+		input.Data = nil
+		input.Reason = "malformed"
+	} else if ack != nil {
+		input.Approved = ack.Approved
+		input.Reason = ack.Reason
+	}
+	rr.current.Inputs = append(rr.current.Inputs, input)
+}
+
+// RecordPresence adds a player joining or leaving to the replay
+func (rr *ReplayRecorder) RecordPresence(gs *GameMatchState, presence runtime.Presence, joined bool) {
+	if rr.current == nil {
+		return
+	}
+	rr.current.Presences = append(rr.current.Presences, ReplayPresence{
+		Tick:     gs.currentTick,
+		UserID:   presence.GetUserId(),
+		Username: presence.GetUsername(),
+		Joined:   joined,
+	})
+}
+
+// Update writes the current segment once it covers snapshotTicks and starts the next one with a
+// snapshot. Called at the end of the match loop.
+func (rr *ReplayRecorder) Update(ctx context.Context, gs *GameMatchState) {
+	if !rr.Enabled() {
+		return
+	}
+	if rr.current != nil && gs.currentTick-rr.current.StartTick < rr.snapshotTicks {
+		return
+	}
+	if rr.current != nil {
+		rr.Flush(ctx, gs)
+		rr.nextSlot = (rr.nextSlot + 1) % rr.slots
+	}
+	rr.current = &ReplaySegment{
+		Slot:      rr.nextSlot,
+		StartTick: gs.currentTick,
+		EndTick:   gs.currentTick,
+		Snapshot:  rr.snapshot(gs),
+		Inputs:    []ReplayInput{},
+	}
+}
+
+// Flush writes the current segment as it is, so an export includes the latest ticks
+func (rr *ReplayRecorder) Flush(ctx context.Context, gs *GameMatchState) {
+	if rr.current == nil {
+		return
+	}
+	rr.current.EndTick = gs.currentTick
+	if err := rr.db.SaveReplaySegment(ctx, rr.matchID, rr.current); err != nil {
+		rr.logger.Error("Failed to save replay segment %d of %s: %v", rr.current.Slot, rr.matchID, err)
+	}
+}
+
+// snapshot captures the players' bodies and the NPCs
+func (rr *ReplayRecorder) snapshot(gs *GameMatchState) ReplaySnapshot {
+	players := make([]ReplayBody, 0, gs.entities.PlayerCount())
+	for userID, rb := range gs.PlayerBodies() {
+		state := gs.GetPlayerState(userID)
+		players = append(players, ReplayBody{
+			UserID: userID,
+			Pos:    ToPosition(rb.Position),
+			Vel:    ToPosition(rb.Velocity),
+			Facing: state.Facing,
+			Health: state.Health,
+			Dead:   state.IsDead(),
+		})
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].UserID < players[j].UserID })
+	return ReplaySnapshot{Tick: gs.currentTick, Players: players, NPCs: gs.npcManager.Snapshot()}
+}
+
+// rpcReplayExport exports the replay recorded for a match, oldest segment first. A running match
+// first writes its current segment.
+// Payload: {"matchId": "required", "fromTick": 0, "toTick": 0}
+func rpcReplayExport(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		MatchID  string `json:"matchId"`
+		FromTick int64  `json:"fromTick"`
+		ToTick   int64  `json:"toTick"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.MatchID == "" {
+		return "", errInvalidPayload
+	}
+
+	// Ended matches can still be exported; their last segment was written on terminate
+	if _, err := nk.MatchSignal(ctx, req.MatchID, fmt.Sprintf(`{"type":%q}`, SignalReplayFlush)); err != nil {
+		logger.Debug("Replay export: match %s did not flush: %v", req.MatchID, err)
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	index, err := dm.LoadReplayIndex(ctx, req.MatchID)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	if index == nil {
+		return "", errReplayNotFound
+	}
+	segments, err := dm.LoadReplaySegments(ctx, req.MatchID, index.Slots)
+	if err != nil {
+		return "", errInternalFailure
+	}
+
+	replay := &ReplayFile{
+		Version:    replayFormatVersion,
+		MatchID:    index.MatchID,
+		Map:        index.Map,
+		TickRate:   index.TickRate,
+		ExportedAt: time.Now().UTC(),
+		Segments:   make([]*ReplaySegment, 0, len(segments)),
+	}
+	for _, segment := range segments {
+		if req.FromTick > 0 && segment.EndTick < req.FromTick {
+			continue
+		}
+		if req.ToTick > 0 && segment.StartTick > req.ToTick {
+			continue
+		}
+		replay.Segments = append(replay.Segments, segment)
+	}
+	sort.Slice(replay.Segments, func(i, j int) bool { return replay.Segments[i].StartTick < replay.Segments[j].StartTick })
+
+	out, err := json.Marshal(replay)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Replay harness tuning
+const (
+	harnessIDPrefix    = botIDPrefix + "replay-" // recorded players run as bots, so nothing is saved for their accounts
+	maxHarnessTicks    = 10 * 60 * TickRate      // longest replay one run may drive
+	defaultHarnessSeed = 1
+	harnessInputOpCode = 0 // op code of the replayed inputs; the match reads inputs whatever their op code
+)
+
+var (
+	errInvalidReplay  = runtime.NewError("invalid replay: an exported replay file (admin_replay_export) with at least one segment is required", rpcCodeInvalidArgument)
+	errReplayTooLong  = runtime.NewError("replay too long: at most 10 minutes of ticks can be run", rpcCodeInvalidArgument)
+	errHarnessNoMatch = runtime.NewError("the replay's map could not be started", rpcCodeInternal)
+)
+
+// HarnessResult is the outcome of driving a match from a replay
+type HarnessResult struct {
+	Map       string         `json:"map"`
+	Seed      int64          `json:"seed"`
+	StartTick int64          `json:"startTick"`
+	EndTick   int64          `json:"endTick"`
+	Ticks     int64          `json:"ticks"`
+	Inputs    int            `json:"inputs"`   // replayed inputs
+	Messages  int            `json:"messages"` // messages the match sent, per recipient
+	Bytes     int64          `json:"bytes"`
+	Checksum  string         `json:"checksum"` // of Final
+	Expected  string         `json:"expected,omitempty"`
+	Match     *bool          `json:"match,omitempty"` // Checksum equals Expected
+	Final     ReplaySnapshot `json:"final"`
+	Seconds   float64        `json:"seconds"` // wall time of the run
+}
+
+// harnessMessage is a recorded input fed to the match loop
+type harnessMessage struct {
+	botPresence
+	data     []byte
+	received int64
+}
+
+func (m *harnessMessage) GetOpCode() int64      { return harnessInputOpCode }
+func (m *harnessMessage) GetData() []byte       { return m.data }
+func (m *harnessMessage) GetReliable() bool     { return true }
+func (m *harnessMessage) GetReceiveTime() int64 { return m.received }
+
+// harnessDispatcher counts what a headless match sends; nobody receives it
+type harnessDispatcher struct {
+	gs       *GameMatchState
+	messages int
+	bytes    int64
+}
+
+func (d *harnessDispatcher) count(data []byte, presences []runtime.Presence) {
+	recipients := len(presences)
+	if presences == nil {
+		recipients = len(d.gs.presences)
+	}
+	d.messages += recipients
+	d.bytes += int64(len(data) * recipients)
+}
+
+func (d *harnessDispatcher) BroadcastMessage(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	d.count(data, presences)
+	return nil
+}
+
+func (d *harnessDispatcher) BroadcastMessageDeferred(opCode int64, data []byte, presences []runtime.Presence, sender runtime.Presence, reliable bool) error {
+	d.count(data, presences)
+	return nil
+}
+
+func (d *harnessDispatcher) MatchKick(presences []runtime.Presence) error { return nil }
+func (d *harnessDispatcher) MatchLabelUpdate(label string) error          { return nil }
+
+// harnessParam reads the "headless" match parameter the replay harness starts its matches with
+func harnessParam(params map[string]interface{}) bool {
+	headless, _ := params["headless"].(bool)
+	return headless
+}
+
+// ReplayHarness drives a headless match from a recorded replay: it starts the replay's map with
+// a fixed seed, puts the players of the first snapshot where they stood, feeds every recorded
+// input to MatchLoop at the tick it was received and joins and removes players when they did.
+// The state the match ends in is summed up in a checksum, so a physics or input change can be
+// checked against the checksum of a golden run of the same replay. The match is never
+// registered with Nakama: nobody can join it, it saves nothing and is dropped after the run.
+type ReplayHarness struct {
+	replay *ReplayFile
+	seed   int64
+	ids    map[string]string // recorded user ID -> harness player ID
+	nextID int
+}
+
+// NewReplayHarness checks a replay file and prepares a run with a seed
+func NewReplayHarness(replay *ReplayFile, seed int64) (*ReplayHarness, error) {
+	if replay == nil || replay.Version != replayFormatVersion || replay.Map == "" || len(replay.Segments) == 0 {
+		return nil, errInvalidReplay
+	}
+	for _, segment := range replay.Segments {
+		if segment == nil {
+			return nil, errInvalidReplay
+		}
+	}
+	sort.Slice(replay.Segments, func(i, j int) bool { return replay.Segments[i].StartTick < replay.Segments[j].StartTick })
+	first, last := replay.Segments[0], replay.Segments[len(replay.Segments)-1]
+	if last.EndTick < first.StartTick {
+		return nil, errInvalidReplay
+	}
+	if last.EndTick-first.StartTick > maxHarnessTicks {
+		return nil, errReplayTooLong
+	}
+	return &ReplayHarness{replay: replay, seed: seed, ids: make(map[string]string)}, nil
+}
+
+// Run starts the match and drives it to the replay's last tick
+func (rh *ReplayHarness) Run(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (*HarnessResult, error) {
+	started := time.Now()
+	// A map that doesn't load would take the match down with it
+	if _, err := os.Stat(filepath.Join(mapDirectory, rh.replay.Map)); err != nil {
+		return nil, errHarnessNoMatch
+	}
+	m := &GameMatch{}
+	state, _, _ := m.MatchInit(ctx, logger, db, nk, map[string]interface{}{"map": rh.replay.Map, "rngSeed": rh.seed, "headless": true})
+	gs, ok := state.(*GameMatchState)
+	if !ok || gs == nil {
+		return nil, errHarnessNoMatch
+	}
+	dispatcher := &harnessDispatcher{gs: gs}
+
+	first := rh.replay.Segments[0]
+	endTick := rh.replay.Segments[len(rh.replay.Segments)-1].EndTick
+	gs.currentTick = first.StartTick
+	for _, body := range first.Snapshot.Players {
+		rh.join(gs, body.UserID, "", &body)
+	}
+
+	// Presence changes happen between loops: those recorded at a tick come before the next one
+	inputs := make(map[int64][]ReplayInput)
+	var presences []ReplayPresence
+	for _, segment := range rh.replay.Segments {
+		for _, input := range segment.Inputs {
+			if input.Tick > first.StartTick && input.Tick <= endTick && len(input.Data) > 0 {
+				inputs[input.Tick] = append(inputs[input.Tick], input)
+			}
+		}
+		presences = append(presences, segment.Presences...)
+	}
+	sort.SliceStable(presences, func(i, j int) bool { return presences[i].Tick < presences[j].Tick })
+
+	result := &HarnessResult{Map: rh.replay.Map, Seed: rh.seed, StartTick: first.StartTick, EndTick: first.StartTick}
+	next := 0
+	for tick := first.StartTick + 1; tick <= endTick; tick++ {
+		for ; next < len(presences) && presences[next].Tick < tick; next++ {
+			p := presences[next]
+			if p.Tick < first.StartTick {
+				continue
+			}
+			if p.Joined {
+				rh.join(gs, p.UserID, p.Username, nil)
+			} else {
+				rh.leave(gs, p.UserID, dispatcher, logger)
+			}
+		}
+
+		messages := make([]runtime.MatchData, 0, len(inputs[tick]))
+		for _, input := range inputs[tick] {
+			playerID, ok := rh.ids[input.UserID]
+			if !ok {
+				continue // sent by a player who joined before the replay without a snapshot
+			}
+			messages = append(messages, &harnessMessage{
+				botPresence: botPresence{userID: playerID, username: playerID},
+				data:        rewritePlayerID(input.Data, input.UserID, playerID),
+				received:    tick,
+			})
+		}
+		result.Inputs += len(messages)
+
+		if m.MatchLoop(ctx, logger, db, nk, dispatcher, tick, gs, messages) == nil {
+			break
+		}
+		result.EndTick = tick
+	}
+
+	result.Ticks = result.EndTick - result.StartTick
+	result.Messages = dispatcher.messages
+	result.Bytes = dispatcher.bytes
+	result.Final = rh.finalSnapshot(gs)
+	checksum, err := replayChecksum(result.Final)
+	if err != nil {
+		return nil, err
+	}
+	result.Checksum = checksum
+	result.Seconds = time.Since(started).Seconds()
+	logger.Info("Replay harness ran %d ticks of %s with seed %d: checksum %s", result.Ticks, rh.replay.Map, rh.seed, checksum)
+	return result, nil
+}
+
+// join adds a recorded player as a harness player, where the snapshot saw them or else at a
+// spawn point
+func (rh *ReplayHarness) join(gs *GameMatchState, userID, username string, body *ReplayBody) {
+	if _, ok := rh.ids[userID]; ok {
+		return
+	}
+	rh.nextID++
+	playerID := fmt.Sprintf("%s%d", harnessIDPrefix, rh.nextID)
+	rh.ids[userID] = playerID
+	if username == "" {
+		username = playerID
+	}
+	gs.addPresence(&botPresence{userID: playerID, username: username})
+
+	position := gs.spawnPoint()
+	if body != nil {
+		position = vector.Vector{X: body.Pos.X, Y: body.Pos.Y}
+	}
+	gs.inputProcessor.CreatePlayerObject(gs, playerID, position)
+	if body == nil {
+		return
+	}
+	if rb := gs.PlayerBody(playerID); rb != nil {
+		rb.Velocity = vector.Vector{X: body.Vel.X, Y: body.Vel.Y}
+	}
+	state := gs.GetPlayerState(playerID)
+	state.Facing = body.Facing
+	state.Health = body.Health
+}
+
+// leave removes a harness player like a bot
+func (rh *ReplayHarness) leave(gs *GameMatchState, userID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	playerID, ok := rh.ids[userID]
+	if !ok {
+		return
+	}
+	delete(rh.ids, userID)
+	gs.Dismount(playerID, dispatcher, logger)
+	gs.Release(playerID, true, dispatcher, logger)
+	gs.inputProcessor.RemovePlayerObject(gs, playerID)
+	gs.removePresence(playerID)
+}
+
+// finalSnapshot captures the state the run ended in, with the recorded user IDs
+func (rh *ReplayHarness) finalSnapshot(gs *GameMatchState) ReplaySnapshot {
+	recorded := make(map[string]string, len(rh.ids))
+	for userID, playerID := range rh.ids {
+		recorded[playerID] = userID
+	}
+	snapshot := gs.replay.snapshot(gs)
+	for i := range snapshot.Players {
+		if userID, ok := recorded[snapshot.Players[i].UserID]; ok {
+			snapshot.Players[i].UserID = userID
+		}
+	}
+	for i := range snapshot.NPCs {
+		if userID, ok := recorded[snapshot.NPCs[i].Escorting]; ok {
+			snapshot.NPCs[i].Escorting = userID
+		}
+	}
+	sort.Slice(snapshot.Players, func(i, j int) bool { return snapshot.Players[i].UserID < snapshot.Players[j].UserID })
+	sort.Slice(snapshot.NPCs, func(i, j int) bool { return snapshot.NPCs[i].ID < snapshot.NPCs[j].ID })
+	return snapshot
+}
+
+// rewritePlayerID points a recorded input at the harness player that replays its sender
+func rewritePlayerID(data json.RawMessage, userID, playerID string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data
+	}
+	if raw, ok := fields["playerId"]; ok {
+		var id string
+		if json.Unmarshal(raw, &id) != nil || id != userID {
+			return data // inputs sent for another player stay rejected
+		}
+	}
+	fields["playerId"], _ = json.Marshal(playerID)
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// replayChecksum hashes a snapshot: equal snapshots give equal checksums
+func replayChecksum(snapshot ReplaySnapshot) (string, error) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf("%016x", h.Sum64()), nil
+}
+
+// rpcReplayRun drives a headless match from an exported replay and returns the checksum of the
+// state it ends in, compared with the expected one when given. The run is synchronous: the RPC
+// returns once every tick of the replay was simulated.
+// Payload: {"replay": <admin_replay_export output>, "seed": 1, "expected": "<checksum of a golden run>"}
+func rpcReplayRun(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		Replay   *ReplayFile `json:"replay"`
+		Seed     *int64      `json:"seed"`
+		Expected string      `json:"expected"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil {
+		return "", errInvalidPayload
+	}
+	seed := int64(defaultHarnessSeed)
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+
+	harness, err := NewReplayHarness(req.Replay, seed)
+	if err != nil {
+		return "", err
+	}
+	result, err := harness.Run(ctx, logger, db, nk)
+	if err != nil {
+		logger.Error("Replay harness failed: %v", err)
+		if errors.Is(err, errHarnessNoMatch) {
+			return "", err
+		}
+		return "", errInternalFailure
+	}
+	if req.Expected != "" {
+		result.Expected = req.Expected
+		match := strings.EqualFold(req.Expected, result.Checksum)
+		result.Match = &match
+		if !match {
+			logger.Warn("Replay harness: checksum mismatch on %s (expected %s, got %s)", result.Map, req.Expected, result.Checksum)
+		}
+	}
+
+	out, err := json.Marshal(result)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
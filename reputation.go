@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Reputation tuning
+const (
+	reputationCap              = 10000 // standings are kept within ±reputationCap
+	defaultFactionHostileBelow = -1000
+)
+
+var (
+	errUnknownFaction      = errors.New("unknown faction")
+	errReputationNotLoaded = errors.New("player's reputation is not loaded")
+)
+
+// FactionRank is a named standing band. The rank with the highest Min at or below a player's
+// standing applies.
+type FactionRank struct {
+	Name          string  `json:"name"`
+	Min           int     `json:"min"`
+	PriceModifier float64 `json:"priceModifier,omitempty"` // multiplies the faction's shop prices (default 1)
+}
+
+// FactionDefinition describes a faction players earn standing with
+type FactionDefinition struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Initial      int           `json:"initial,omitempty"`      // standing of players who never dealt with the faction
+	HostileBelow *int          `json:"hostileBelow,omitempty"` // the faction's NPCs attack players below this standing (default -1000)
+	Ranks        []FactionRank `json:"ranks,omitempty"`
+}
+
+// FactionStanding is a player's standing with one faction, as sent in reputation messages
+type FactionStanding struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	Standing      int     `json:"standing"`
+	Rank          string  `json:"rank,omitempty"`
+	PriceModifier float64 `json:"priceModifier"`
+	Hostile       bool    `json:"hostile,omitempty"`
+}
+
+// ReputationManager owns the faction definitions and the standings of online players, and
+// adjusts standings when players kill NPCs or turn in quests. It is only used from the match loop.
+type ReputationManager struct {
+	logger    runtime.Logger
+	db        *DatabaseManager
+	factions  map[string]*FactionDefinition
+	standings map[string]*PersistedReputation // player ID -> standings of online players
+}
+
+// NewReputationManager creates a manager and loads factions from path (a JSON object keyed by faction ID)
+func NewReputationManager(logger runtime.Logger, db *DatabaseManager, path string) *ReputationManager {
+	rm := &ReputationManager{
+		logger:    logger,
+		db:        db,
+		factions:  make(map[string]*FactionDefinition),
+		standings: make(map[string]*PersistedReputation),
+	}
+	if err := rm.Load(path); err != nil {
+		logger.Warn("Failed to load factions from %s: %v", path, err)
+	}
+	return rm
+}
+
+// Load replaces the faction definitions with the ones found in path
+func (rm *ReputationManager) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var factions map[string]*FactionDefinition
+	if err := json.Unmarshal(data, &factions); err != nil {
+		return err
+	}
+	for id, faction := range factions {
+		faction.ID = id
+		if faction.Name == "" {
+			faction.Name = id
+		}
+		if faction.HostileBelow == nil {
+			hostileBelow := defaultFactionHostileBelow
+			faction.HostileBelow = &hostileBelow
+		}
+		for i := range faction.Ranks {
+			if faction.Ranks[i].PriceModifier <= 0 {
+				faction.Ranks[i].PriceModifier = 1
+			}
+		}
+		sort.Slice(faction.Ranks, func(i, j int) bool { return faction.Ranks[i].Min < faction.Ranks[j].Min })
+	}
+	rm.factions = factions
+
+	rm.logger.Info("Loaded %d factions from %s", len(factions), path)
+	return nil
+}
+
+// SubscribeEvents applies the reputation changes of NPC kills (the NPC definition's
+// "reputation") and quest turn-ins (the quest's "rewardReputation")
+func (rm *ReputationManager) SubscribeEvents(eb *EventBus) {
+	eb.Subscribe(EventNPCKilled, func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		killer, _ := event.Data["killer"].(string)
+		npcType, _ := event.Data["npcType"].(string)
+		if killer == "" {
+			return
+		}
+		if def, ok := gs.npcManager.Definition(npcType); ok {
+			rm.apply(ctx, gs, killer, def.Reputation, dispatcher)
+		}
+	})
+	eb.Subscribe(EventQuestCompleted, func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		playerID, _ := event.Data["playerId"].(string)
+		questID, _ := event.Data["questId"].(string)
+		if def, ok := gs.quests.definitions[questID]; ok {
+			rm.apply(ctx, gs, playerID, def.RewardReputation, dispatcher)
+		}
+	})
+}
+
+// LoadPlayer loads a joining player's standings and sends them to the player
+func (rm *ReputationManager) LoadPlayer(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	reputation, err := rm.db.LoadReputation(ctx, playerID)
+	if err != nil {
+		rm.logger.Error("Failed to load reputation for %s: %v", playerID, err)
+		return
+	}
+	rm.standings[playerID] = reputation
+	rm.sync(gs, playerID, dispatcher)
+}
+
+// UnloadPlayer releases a leaving player's standings. Changes are saved as they happen.
+func (rm *ReputationManager) UnloadPlayer(playerID string) {
+	delete(rm.standings, playerID)
+}
+
+// Standing returns the player's standing with a faction. Unknown factions report 0; players who
+// never dealt with the faction (or whose standings aren't loaded) have its initial standing.
+func (rm *ReputationManager) Standing(playerID, factionID string) int {
+	faction, ok := rm.factions[factionID]
+	if !ok {
+		return 0
+	}
+	reputation, ok := rm.standings[playerID]
+	if !ok {
+		return faction.Initial
+	}
+	if standing, ok := reputation.Standings[factionID]; ok {
+		return standing
+	}
+	return faction.Initial
+}
+
+// Rank returns the player's rank with a faction (nil when no rank applies)
+func (rm *ReputationManager) Rank(playerID, factionID string) *FactionRank {
+	faction, ok := rm.factions[factionID]
+	if !ok {
+		return nil
+	}
+	standing := rm.Standing(playerID, factionID)
+	var rank *FactionRank
+	for i := range faction.Ranks {
+		if faction.Ranks[i].Min <= standing {
+			rank = &faction.Ranks[i]
+		}
+	}
+	return rank
+}
+
+// PriceModifier returns the multiplier the faction's shops apply to the player's prices
+func (rm *ReputationManager) PriceModifier(playerID, factionID string) float64 {
+	if rank := rm.Rank(playerID, factionID); rank != nil {
+		return rank.PriceModifier
+	}
+	return 1
+}
+
+// IsHostile reports whether the faction's NPCs attack the player
+func (rm *ReputationManager) IsHostile(playerID, factionID string) bool {
+	faction, ok := rm.factions[factionID]
+	if !ok {
+		return false
+	}
+	return rm.Standing(playerID, factionID) < *faction.HostileBelow
+}
+
+// Modify changes the player's standing with a faction by delta and returns the new standing.
+// It fails for unknown factions and players who aren't online.
+func (rm *ReputationManager) Modify(ctx context.Context, gs *GameMatchState, playerID, factionID string, delta int, dispatcher runtime.MatchDispatcher) (int, error) {
+	standing, err := rm.modify(ctx, playerID, map[string]int{factionID: delta})
+	if err != nil {
+		return 0, err
+	}
+	rm.sync(gs, playerID, dispatcher)
+	return standing[factionID], nil
+}
+
+// apply changes several standings at once, logging failures. Gains are scaled by the XP
+// multiplier of the running live-ops events; losses aren't.
+func (rm *ReputationManager) apply(ctx context.Context, gs *GameMatchState, playerID string, deltas map[string]int, dispatcher runtime.MatchDispatcher) {
+	if len(deltas) == 0 {
+		return
+	}
+	if multiplier := gs.liveOps.XPMultiplier(); multiplier != 1 {
+		scaled := make(map[string]int, len(deltas))
+		for factionID, delta := range deltas {
+			if delta > 0 {
+				delta = int(math.Round(float64(delta) * multiplier))
+			}
+			scaled[factionID] = delta
+		}
+		deltas = scaled
+	}
+	if _, err := rm.modify(ctx, playerID, deltas); err != nil {
+		rm.logger.Error("Failed to change reputation of %s: %v", playerID, err)
+		return
+	}
+	rm.sync(gs, playerID, dispatcher)
+}
+
+// modify changes standings, saves them and returns the new values; nothing changes if the save fails
+func (rm *ReputationManager) modify(ctx context.Context, playerID string, deltas map[string]int) (map[string]int, error) {
+	reputation, ok := rm.standings[playerID]
+	if !ok {
+		return nil, errReputationNotLoaded
+	}
+	previous := make(map[string]int, len(reputation.Standings))
+	for factionID, standing := range reputation.Standings {
+		previous[factionID] = standing
+	}
+
+	updated := make(map[string]int, len(deltas))
+	for factionID, delta := range deltas {
+		if _, ok := rm.factions[factionID]; !ok {
+			reputation.Standings = previous
+			return nil, errUnknownFaction
+		}
+		standing := rm.Standing(playerID, factionID) + delta
+		if standing > reputationCap {
+			standing = reputationCap
+		} else if standing < -reputationCap {
+			standing = -reputationCap
+		}
+		reputation.Standings[factionID] = standing
+		updated[factionID] = standing
+	}
+	if err := rm.db.SaveReputation(ctx, reputation); err != nil {
+		reputation.Standings = previous
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Snapshot returns the player's standing with every faction
+func (rm *ReputationManager) Snapshot(playerID string) []FactionStanding {
+	out := make([]FactionStanding, 0, len(rm.factions))
+	for id, faction := range rm.factions {
+		entry := FactionStanding{
+			ID:            id,
+			Name:          faction.Name,
+			Standing:      rm.Standing(playerID, id),
+			PriceModifier: rm.PriceModifier(playerID, id),
+			Hostile:       rm.IsHostile(playerID, id),
+		}
+		if rank := rm.Rank(playerID, id); rank != nil {
+			entry.Rank = rank.Name
+		}
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// sync sends the player their standings (OpCodeReputation reputation)
+func (rm *ReputationManager) sync(gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil || len(rm.factions) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeReputation, "reputation", map[string]any{"factions": rm.Snapshot(playerID)})
+	if err != nil {
+		rm.logger.Error("Failed to marshal reputation: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeReputation, data, []runtime.Presence{presence}, nil, true)
+}
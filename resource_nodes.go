@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Resource node kinds
+const (
+	ResourceOre  = "ore"
+	ResourceHerb = "herb"
+	ResourceTree = "tree"
+)
+
+// Bus event published when a player gathers from a resource node
+const EventResourceGathered = "resource_gathered" // objectId, playerId, resource, items (item ID -> count), x, y
+
+// Resource node tuning
+const (
+	resourceObjectType           = "resource"   // ObjectData.Type of gatherable nodes
+	defaultResourceRespawn       = 120.0        // seconds before a depleted node is back
+	resourceRespawnSweepInterval = 1 * TickRate // how often depleted nodes are checked
+)
+
+// defaultResourceTools is the item a node kind requires when the node has no "tool" property
+var defaultResourceTools = map[string]string{
+	ResourceOre:  "pickaxe",
+	ResourceTree: "axe",
+}
+
+// ResourceNode is a gatherable map object. Its settings come from the object's properties:
+// "resource" (kind), "item" and "amount" (granted per gather) or "loot" (a loot table rolled
+// instead), "tool" (required item; "none" for no tool), "charges" (gathers before depletion)
+// and "respawn" (seconds).
+type ResourceNode struct {
+	ObjectID       int
+	Position       vector.Vector // the object's world center, which places it in a chunk
+	Kind           string
+	ItemID         string
+	Amount         int
+	LootTable      string
+	Tool           string
+	MaxCharges     int
+	Charges        int
+	RespawnSeconds float64
+	RespawnAt      int64 // unix seconds the node comes back (0 while available)
+}
+
+// ResourceNodeManager tracks the map's resource nodes and their respawn timers. Timers use wall
+// clock time so depleted nodes stay depleted across match restarts; they are saved with the
+// chunk the node is in (ChunkStore), so a map with thousands of nodes only reads and writes the
+// timers of the area players are in.
+type ResourceNodeManager struct {
+	logger runtime.Logger
+	nodes  map[int]*ResourceNode // object ID -> node
+	legacy bool                  // timers were migrated from the map's former single record, deleted once the chunks are saved
+	mu     sync.Mutex
+}
+
+// NewResourceNodeManager creates an empty resource node manager
+func NewResourceNodeManager(logger runtime.Logger) *ResourceNodeManager {
+	return &ResourceNodeManager{
+		logger: logger,
+		nodes:  make(map[int]*ResourceNode),
+	}
+}
+
+// LoadFromMap registers every "resource" object of the current map as a node
+func (rm *ResourceNodeManager) LoadFromMap(gs *GameMatchState) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.nodes = make(map[int]*ResourceNode)
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for oid, obj := range gs.Objects() {
+		if !strings.EqualFold(obj.Type, resourceObjectType) {
+			continue
+		}
+		node := &ResourceNode{
+			ObjectID:       oid,
+			Amount:         1,
+			MaxCharges:     1,
+			RespawnSeconds: defaultResourceRespawn,
+		}
+		node.Position, _ = obj.Position()
+		node.Kind, _ = obj.Props["resource"].(string)
+		node.ItemID, _ = obj.Props["item"].(string)
+		node.LootTable, _ = obj.Props["loot"].(string)
+		if v, ok := obj.Props["amount"].(float64); ok && v > 0 {
+			node.Amount = int(v)
+		}
+		if v, ok := obj.Props["charges"].(float64); ok && v > 0 {
+			node.MaxCharges = int(v)
+		}
+		if v, ok := obj.Props["respawn"].(float64); ok && v >= 0 {
+			node.RespawnSeconds = v
+		}
+		node.Tool = defaultResourceTools[node.Kind]
+		if v, ok := obj.Props["tool"].(string); ok {
+			node.Tool = v
+		}
+		if strings.EqualFold(node.Tool, "none") {
+			node.Tool = ""
+		}
+		if node.ItemID == "" && node.LootTable == "" {
+			rm.logger.Warn("Resource node %d (%s) has neither an item nor a loot property; skipping", oid, obj.Name)
+			continue
+		}
+		node.Charges = node.MaxCharges
+		rm.nodes[oid] = node
+	}
+	rm.logger.Info("Registered %d resource nodes", len(rm.nodes))
+}
+
+// Gather takes one charge from the node oid and grants its yield to the player. Range is checked
+// by the caller. It returns the granted stacks, or a rejection reason.
+func (rm *ResourceNodeManager) Gather(ctx context.Context, gs *GameMatchState, playerID string, oid int, dispatcher runtime.MatchDispatcher) ([]LootStack, string) {
+	rm.mu.Lock()
+	node, ok := rm.nodes[oid]
+	rm.mu.Unlock()
+	if !ok {
+		return nil, RejectInvalidTarget
+	}
+	// The node's saved timer must be applied before it can be gathered
+	if !gs.chunks.LoadedAt(node.Position) {
+		gs.chunks.RequestAt(ctx, node.Position)
+		return nil, RejectLoading
+	}
+
+	rm.mu.Lock()
+	if node.Charges <= 0 {
+		rm.mu.Unlock()
+		return nil, RejectDepleted
+	}
+	// Take the charge up front so two players can't both gather the last one on the same tick
+	node.Charges--
+	rm.mu.Unlock()
+
+	restore := func() {
+		rm.mu.Lock()
+		node.Charges++
+		rm.mu.Unlock()
+	}
+	if node.Tool != "" && gs.inventoryManager.Count(ctx, playerID, node.Tool) <= 0 {
+		restore()
+		return nil, RejectMissingTool
+	}
+
+	var stacks []LootStack
+	if node.LootTable != "" {
+		stacks = gs.lootCatalog.Roll(gs, node.LootTable, LootContext{PlayerID: playerID})
+	} else {
+		stacks = []LootStack{{ItemID: node.ItemID, Count: node.Amount}}
+	}
+	for i, stack := range stacks {
+		if err := gs.inventoryManager.Add(ctx, playerID, stack.ItemID, stack.Count); err != nil {
+			rm.logger.Error("gather: failed to add %d x %s to %s: %v", stack.Count, stack.ItemID, playerID, err)
+			if i == 0 {
+				restore()
+				return nil, RejectStorageError
+			}
+			// Earlier stacks were granted; keep the charge spent
+			stacks = stacks[:i]
+			break
+		}
+	}
+
+	rm.mu.Lock()
+	depleted := node.Charges <= 0 && node.RespawnAt == 0
+	if depleted {
+		node.RespawnAt = time.Now().Unix() + int64(node.RespawnSeconds)
+	}
+	rm.mu.Unlock()
+
+	if depleted {
+		gs.chunks.Changed(node.Position)
+	}
+	gs.setResourceProps(oid, node, dispatcher, rm.logger)
+
+	items := make(map[string]any, len(stacks))
+	for _, stack := range stacks {
+		count, _ := items[stack.ItemID].(int)
+		items[stack.ItemID] = count + stack.Count
+	}
+	gs.eventBus.Publish(EventResourceGathered, map[string]any{
+		"objectId": oid,
+		"playerId": playerID,
+		"resource": node.Kind,
+		"items":    items,
+		"x":        node.Position.X,
+		"y":        node.Position.Y,
+	})
+	return stacks, ""
+}
+
+// Update brings back depleted nodes whose respawn time has passed. Called from the match loop.
+func (rm *ResourceNodeManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick%resourceRespawnSweepInterval != 0 {
+		return
+	}
+	now := time.Now().Unix()
+
+	rm.mu.Lock()
+	respawned := make([]*ResourceNode, 0)
+	for _, node := range rm.nodes {
+		if node.RespawnAt != 0 && now >= node.RespawnAt {
+			node.RespawnAt = 0
+			node.Charges = node.MaxCharges
+			respawned = append(respawned, node)
+		}
+	}
+	rm.mu.Unlock()
+
+	for _, node := range respawned {
+		gs.chunks.Changed(node.Position)
+		gs.setResourceProps(node.ObjectID, node, dispatcher, rm.logger)
+	}
+}
+
+// setResourceProps mirrors a node's charges and depletion into its object properties so clients
+// can swap sprites, and broadcasts the change
+func (gs *GameMatchState) setResourceProps(oid int, node *ResourceNode, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gs.mu.Lock()
+	obj, ok := gs.Object(oid)
+	if ok {
+		obj.Props["charges"] = float64(node.Charges)
+		if node.Charges <= 0 {
+			obj.Props["depleted"] = true
+		} else {
+			delete(obj.Props, "depleted")
+		}
+	}
+	gs.mu.Unlock()
+	if ok {
+		gs.BroadcastObjectUpdate(oid, dispatcher, logger)
+	}
+}
+
+// chunkTimers returns the respawn timers of the depleted nodes in a chunk, as saved with it
+func (rm *ResourceNodeManager) chunkTimers(cs *ChunkStore, c ChunkCoord) map[int]int64 {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	timers := make(map[int]int64)
+	for oid, node := range rm.nodes {
+		if node.RespawnAt != 0 && cs.ChunkAt(node.Position) == c {
+			timers[oid] = node.RespawnAt
+		}
+	}
+	return timers
+}
+
+// applyChunk depletes the nodes of a loaded chunk whose saved respawn time hasn't passed yet
+func (rm *ResourceNodeManager) applyChunk(gs *GameMatchState, timers map[int]int64, dispatcher runtime.MatchDispatcher) {
+	now := time.Now().Unix()
+
+	rm.mu.Lock()
+	restored := make([]*ResourceNode, 0, len(timers))
+	expired := make([]*ResourceNode, 0)
+	for oid, at := range timers {
+		node, ok := rm.nodes[oid]
+		if !ok {
+			continue
+		}
+		if at <= now {
+			expired = append(expired, node)
+			continue
+		}
+		if node.RespawnAt == 0 {
+			node.Charges = 0
+			node.RespawnAt = at
+			restored = append(restored, node)
+		}
+	}
+	rm.mu.Unlock()
+
+	// Timers that ran out while the chunk wasn't loaded are dropped from it on the next save
+	for _, node := range expired {
+		gs.chunks.Changed(node.Position)
+	}
+	for _, node := range restored {
+		gs.setResourceProps(node.ObjectID, node, dispatcher, rm.logger)
+	}
+}
+
+// Restore migrates the respawn timers a map saved in a single record before they moved into its
+// chunks: the chunks of the depleted nodes are loaded, the nodes depleted and the chunks saved
+// with the next periodic save, which then deletes the old record (DropLegacy)
+func (rm *ResourceNodeManager) Restore(ctx context.Context, gs *GameMatchState) error {
+	saved, err := gs.databaseManager.LoadResourceNodes(ctx, gs.currentMapName)
+	if err != nil {
+		return err
+	}
+	if len(saved.RespawnAt) == 0 {
+		return nil
+	}
+
+	rm.mu.Lock()
+	var positions []vector.Vector
+	for oid := range saved.RespawnAt {
+		if node, ok := rm.nodes[oid]; ok {
+			positions = append(positions, node.Position)
+		}
+	}
+	rm.mu.Unlock()
+	chunks := make([]ChunkCoord, 0, len(positions))
+	for _, p := range positions {
+		chunks = append(chunks, gs.chunks.ChunkAt(p))
+	}
+	gs.chunks.Load(ctx, gs, chunks)
+
+	rm.applyChunk(gs, saved.RespawnAt, nil)
+	for _, p := range positions {
+		gs.chunks.Changed(p)
+	}
+	rm.legacy = true
+	rm.logger.Info("Migrating the respawn timers of %d resource nodes into world chunks", len(saved.RespawnAt))
+	return nil
+}
+
+// DropLegacy deletes the map's former single record of respawn timers once they were saved with
+// their chunks
+func (rm *ResourceNodeManager) DropLegacy(ctx context.Context, dm *DatabaseManager, mapName string) {
+	if !rm.legacy {
+		return
+	}
+	if err := dm.DeleteResourceNodes(ctx, mapName); err != nil {
+		return
+	}
+	rm.legacy = false
+}
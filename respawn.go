@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// defaultRespawnDelay is how long (seconds) a dead player waits before respawn is accepted,
+// unless the map sets a "respawnDelay" property
+const defaultRespawnDelay = 5.0
+
+// graveyardSpawnGroup is the spawn group used for players without a team spawn group
+const graveyardSpawnGroup = "graveyard"
+
+// PlayerLifeEvent is broadcast when a player dies or respawns (OpCodeRespawn)
+type PlayerLifeEvent struct {
+	PlayerID  string         `json:"playerId"`
+	X         float64        `json:"x"`
+	Y         float64        `json:"y"`
+	RespawnIn float64        `json:"respawnIn,omitempty"` // seconds until respawn is accepted (player_died only)
+	KilledBy  *DamageSource  `json:"killedBy,omitempty"`  // source of the killing hit (player_died only)
+	Dropped   map[string]int `json:"dropped,omitempty"`   // dropOnDeath items left at the body (player_died only)
+}
+
+// respawnDelayTicks returns the map's respawn delay in ticks, falling back to the world settings'
+// respawnTime rule
+func (gs *GameMatchState) respawnDelayTicks() int64 {
+	delay := defaultRespawnDelay
+	if v, ok := gs.settingsRespawnDelay(); ok {
+		delay = v
+	}
+	if gs.currentMap != nil {
+		for name, value := range gs.currentMap.Properties {
+			if v, ok := value.(float64); ok && v >= 0 && strings.EqualFold(name, "respawndelay") {
+				delay = v
+			}
+		}
+	}
+	return int64(delay * TickRate)
+}
+
+// handleDeath puts a player who just ran out of health into the dead state: they stop, get off
+// their mount, drop what they carry and lose their target. Their body stops colliding, their
+// dropOnDeath items fall to the ground and the death is added to their stats (and a player
+// killer's kills and karma). Until the respawn
+// delay has passed and they respawn, only respawn is accepted.
+func (gs *GameMatchState) handleDeath(ctx context.Context, playerID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	state := gs.GetPlayerState(playerID)
+	state.Died = true
+	state.RespawnReadyTick = gs.currentTick + gs.respawnDelayTicks()
+	state.Sprinting = false
+	state.ClearTarget()
+	state.ClearEffects()
+	state.Light, state.LightItem = 0, ""
+	gs.Dismount(playerID, dispatcher, logger)
+	gs.Release(playerID, true, dispatcher, logger)
+
+	if err := gs.databaseManager.RecordPlayerDeath(ctx, playerID, state.LastDamage); err != nil {
+		logger.Error("Failed to record death of %s: %v", playerID, err)
+	}
+
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return
+	}
+	if killer := state.LastDamage; killer != nil && killer.Type == DamageSourcePlayer && killer.ID != playerID {
+		gs.recordPvPKill(ctx, killer.ID, playerID, rb.Position, logger)
+	}
+	rb.Velocity = vector.Vector{X: 0, Y: 0}
+	gs.physicsEngine.SetCollisionsEnabled(rb, false)
+	dropped := gs.dropDeathItems(ctx, playerID, rb.Position, dispatcher, logger)
+
+	logger.Info("Player %s died at (%.1f, %.1f)", playerID, rb.Position.X, rb.Position.Y)
+	gs.broadcastLifeEvent("player_died", PlayerLifeEvent{
+		PlayerID:  playerID,
+		X:         rb.Position.X,
+		Y:         rb.Position.Y,
+		RespawnIn: float64(state.RespawnReadyTick-gs.currentTick) / TickRate,
+		KilledBy:  state.LastDamage,
+		Dropped:   dropped,
+	}, dispatcher, logger)
+}
+
+// dropDeathItems moves the player's dropOnDeath stacks from their inventory to the ground at
+// position and returns what was dropped
+func (gs *GameMatchState) dropDeathItems(ctx context.Context, playerID string, position vector.Vector, dispatcher runtime.MatchDispatcher, logger runtime.Logger) map[string]int {
+	dropped := make(map[string]int)
+	for itemID, count := range gs.inventoryManager.Items(ctx, playerID) {
+		if def, ok := gs.itemCatalog.Get(itemID); !ok || !def.DropOnDeath || count <= 0 {
+			continue
+		}
+		dropped[itemID] = count
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	// The stacks are placed first, so the world items with them are stored with the inventory
+	oids := make([]int, 0, len(dropped))
+	for _, itemID := range sortedKeys(dropped) {
+		oids = append(oids, gs.worldItems.Spawn(gs, itemID, dropped[itemID], position, playerID, gs.droppedItemLifetimeTicks(), dispatcher))
+	}
+	writes := gs.worldItems.Writes(gs)
+	if err := gs.inventoryManager.RemoveAll(ctx, playerID, dropped, writes...); err != nil {
+		logger.Error("Failed to drop death items of %s: %v", playerID, err)
+		for _, oid := range oids {
+			gs.worldItems.Discard(gs, oid, dispatcher)
+		}
+		return nil
+	}
+	gs.worldItems.Committed(writes)
+	gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	return dropped
+}
+
+// respawnPoint picks where a player comes back: their team's spawn group, then the last
+// checkpoint they reached, then the graveyard group, then the map's default spawn point
+func (gs *GameMatchState) respawnPoint(state *PlayerState) vector.Vector {
+	if gs.currentMap == nil {
+		return vector.Vector{X: 100, Y: 100}
+	}
+	if state.Team != "" {
+		if pos, ok := gs.mapLoader.GetSpawnPointInGroup(gs.currentMap, state.Team); ok {
+			return pos
+		}
+	}
+	if state.Checkpoint != nil {
+		return *state.Checkpoint
+	}
+	if pos, ok := gs.mapLoader.GetSpawnPointInGroup(gs.currentMap, graveyardSpawnGroup); ok {
+		return pos
+	}
+	return gs.spawnPoint()
+}
+
+// Respawn brings a dead player back at their spawn group with full health, stamina and oxygen and no
+// debuffs. It returns a rejection reason, or "" once the player has respawned.
+func (gs *GameMatchState) Respawn(playerID string, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+	state := gs.GetPlayerState(playerID)
+	if !state.Died {
+		return RejectNotDead
+	}
+	if remaining := state.RespawnReadyTick - gs.currentTick; remaining > 0 {
+		ack.Cooldown = float64(remaining) / TickRate
+		return RejectOnCooldown
+	}
+
+	for stat, buff := range state.Buffs {
+		if buff.Amount < 0 {
+			delete(state.Buffs, stat)
+		}
+	}
+	state.Died = false
+	state.LastDamage = nil
+	state.Health = state.MaxHealth
+	state.Stamina = state.MaxStamina
+	state.Oxygen = state.MaxOxygen
+	state.reviveMeters()
+	state.statusDirty = true
+
+	if _, ok := gs.Teleport(playerID, gs.respawnPoint(state), CorrectionRespawn); !ok {
+		logger.Warn("Respawn point of %s is blocked; respawning them where they died", playerID)
+	}
+	gs.physicsEngine.SetCollisionsEnabled(rb, true)
+	gs.GrantSpawnProtection(playerID)
+	logger.Info("Player %s respawned at (%.1f, %.1f)", playerID, rb.Position.X, rb.Position.Y)
+	gs.broadcastLifeEvent("player_respawned", PlayerLifeEvent{
+		PlayerID: playerID,
+		X:        rb.Position.X,
+		Y:        rb.Position.Y,
+	}, dispatcher, logger)
+	return ""
+}
+
+// broadcastLifeEvent sends a death/respawn event to every player
+func (gs *GameMatchState) broadcastLifeEvent(eventType string, event PlayerLifeEvent, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(OpCodeRespawn, eventType, event)
+	if err != nil {
+		logger.Error("Failed to marshal %s for %s: %v", eventType, event.PlayerID, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeRespawn, data, nil, nil, true)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// RewardClaimDelivery is what reward_claims_delivered tells a player: the rewards granted while
+// they were away, now in their inventory
+type RewardClaimDelivery struct {
+	Claims []*PersistedRewardClaim `json:"claims"`
+}
+
+// giveRewardItems gives reward stacks to a player: into the inventory of a player in the match,
+// or as one reward claim, keyed by the grant's journal key, that the player collects on their
+// next join. A match never writes the inventory of a player it doesn't hold, since the one they
+// are on (or join next) keeps its own copy. It returns the items given or claimed and the error
+// of each stack that couldn't be given.
+func (gs *GameMatchState) giveRewardItems(ctx context.Context, playerID, key, source string, stacks []LootStack) (map[string]int, error) {
+	given := make(map[string]int)
+	if len(stacks) == 0 {
+		return given, nil
+	}
+	if _, present := gs.presences[playerID]; !present {
+		items := stackItems(stacks)
+		claim := &PersistedRewardClaim{Key: key, Source: source, Items: items, At: time.Now().UTC()}
+		if err := gs.databaseManager.CreateRewardClaim(ctx, playerID, claim); err != nil {
+			return given, err
+		}
+		return items, nil
+	}
+	var errs []error
+	for _, stack := range stacks {
+		if err := gs.inventoryManager.Add(ctx, playerID, stack.ItemID, stack.Count); err != nil {
+			errs = append(errs, fmt.Errorf("%d x %s: %w", stack.Count, stack.ItemID, err))
+			continue
+		}
+		given[stack.ItemID] += stack.Count
+	}
+	return given, errors.Join(errs...)
+}
+
+// DeliverRewardClaims hands a joining player the reward claims waiting for them. Each claim is
+// deleted at the version it was read at before its items are added, so a claim two matches
+// deliver at once only pays out once; a claim whose items can't be added is written back.
+func (gs *GameMatchState) DeliverRewardClaims(ctx context.Context, playerID string, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	claims, err := gs.databaseManager.ListRewardClaims(ctx, playerID)
+	if err != nil || len(claims) == 0 {
+		return
+	}
+
+	delivered := make([]*PersistedRewardClaim, 0, len(claims))
+	for _, claim := range claims {
+		if err := gs.databaseManager.DeleteRewardClaim(ctx, playerID, claim); err != nil {
+			continue
+		}
+		entry := &JournalEntry{Key: gs.journal.Key("reward_claim", claim.Key), Kind: JournalItemGrant, PlayerID: playerID, Items: claim.Items, Source: claim.Source}
+		// The versioned delete above already keeps the claim from being delivered twice
+		_ = gs.journal.Begin(ctx, entry)
+		added := make(map[string]int, len(claim.Items))
+		for _, itemID := range sortedKeys(claim.Items) {
+			if err = gs.inventoryManager.Add(ctx, playerID, itemID, claim.Items[itemID]); err != nil {
+				break
+			}
+			added[itemID] = claim.Items[itemID]
+		}
+		entry.Items = added
+		gs.journal.Finish(ctx, entry, err)
+		if err != nil {
+			logger.Error("Failed to deliver reward claim %s to %s: %v", claim.Key, playerID, err)
+			rest := make(map[string]int, len(claim.Items))
+			for itemID, count := range claim.Items {
+				if added[itemID] == 0 {
+					rest[itemID] = count
+				}
+			}
+			claim.Items = rest
+			if err := gs.databaseManager.CreateRewardClaim(ctx, playerID, claim); err != nil {
+				logger.Error("Lost reward claim %s of %s: %v", claim.Key, playerID, err)
+			}
+			continue
+		}
+		delivered = append(delivered, claim)
+	}
+
+	presence, ok := gs.presences[playerID]
+	if len(delivered) == 0 || !ok || dispatcher == nil {
+		return
+	}
+	gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	data, err := EncodeMessage(OpCodeInventoryUpdate, "reward_claims_delivered", RewardClaimDelivery{Claims: delivered})
+	if err != nil {
+		logger.Error("Failed to marshal reward_claims_delivered: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeInventoryUpdate, data, []runtime.Presence{presence}, nil, true)
+}
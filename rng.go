@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// RNG audit tuning
+const (
+	rngAuditFlushInterval = TickRate // ticks between audit writes
+	maxRNGAuditBuffer     = 1000     // audit records kept while storage writes fail; older ones are dropped
+	maxRNGAuditAttempts   = 5        // failed writes after which the queued records go to the server log instead
+	maxRNGAuditPage       = 100      // audit records one admin_rng_audit call returns
+	defaultCritMultiplier = 2.0      // damage factor of critical hits without critMultiplier
+)
+
+// Kinds of audited rolls
+const (
+	RollLoot        = "loot"         // a loot table roll; inputs: table, outcome: the stacks
+	RollFishingBite = "fishing_bite" // when a fish bites; inputs: spot, biteMin, biteMax, outcome: seconds
+	RollCrit        = "crit"         // a critical hit check; inputs: attacker, target, chance, damage, outcome: crit
+	RollNeedGreed   = "need_greed"   // a party loot roll; inputs: item, count, choices, outcome: rolls, winner
+)
+
+// RollAudit records one audited roll: the seed its generator started from, what it was rolled
+// with and what came out. Rolling the same kind with the same seed and inputs gives the same
+// outcome, so support can check a disputed roll against the code that made it.
+type RollAudit struct {
+	ID       string         `json:"id"` // <match ID>:<roll number>
+	Kind     string         `json:"kind"`
+	PlayerID string         `json:"playerId,omitempty"` // the player the roll was for ("" for none)
+	Seed     int64          `json:"seed"`
+	Inputs   map[string]any `json:"inputs,omitempty"`
+	Outcome  any            `json:"outcome"`
+	MatchID  string         `json:"matchId,omitempty"`
+	Map      string         `json:"map,omitempty"`
+	Tick     int64          `json:"tick"`
+	Time     time.Time      `json:"time"`
+}
+
+// Roll is the generator of one audited roll, seeded from the match's stream. Its draws don't
+// depend on anything else that used the match's RNG, only on its seed.
+type Roll struct {
+	*rand.Rand
+	audit *RollAudit
+}
+
+// RNGService is the match's seeded random number generator. Everyday randomness (NPC wandering,
+// barks, loot scatter) draws from its stream directly; rolls players may dispute (loot, fishing,
+// critical hits) get a generator of their own and are audited to storage. A match created with a
+// seed (the rngSeed parameter, or a dungeon's seed) is deterministic: the same seed and inputs
+// roll the same way, for replays and tests.
+type RNGService struct {
+	logger        runtime.Logger
+	db            *DatabaseManager
+	seed          int64
+	deterministic bool
+	stream        *rand.Rand
+	rolls         int64 // rolls audited so far; numbers their IDs
+	pending       []*RollAudit
+	failures      int // writes of the queued records that failed in a row
+	nextFlush     int64
+	matchID       string
+	mapName       string
+}
+
+// NewRNGService creates the RNG of a match seeded with the current time; Seed makes it
+// deterministic
+func NewRNGService(logger runtime.Logger, db *DatabaseManager) *RNGService {
+	rs := &RNGService{logger: logger, db: db}
+	rs.reseed(time.Now().UnixNano())
+	return rs
+}
+
+// Seed restarts the stream from a fixed seed, making the match deterministic
+func (rs *RNGService) Seed(seed int64) {
+	rs.reseed(seed)
+	rs.deterministic = true
+}
+
+func (rs *RNGService) reseed(seed int64) {
+	rs.seed = seed
+	rs.stream = rand.New(rand.NewSource(seed))
+}
+
+// Configure sets the match and map recorded with every audit record
+func (rs *RNGService) Configure(matchID, mapName string) {
+	rs.matchID, rs.mapName = matchID, mapName
+	rs.logger.Info("Match RNG seeded with %d (deterministic: %t)", rs.seed, rs.deterministic)
+}
+
+// Stream returns the match's generator for randomness that isn't audited
+func (rs *RNGService) Stream() *rand.Rand {
+	return rs.stream
+}
+
+// Roll starts an audited roll for a player. Draw from it, then pass the outcome to Record.
+func (rs *RNGService) Roll(gs *GameMatchState, kind, playerID string, inputs map[string]any) *Roll {
+	seed := rs.stream.Int63()
+	rs.rolls++
+	return &Roll{
+		Rand: rand.New(rand.NewSource(seed)),
+		audit: &RollAudit{
+			ID:       fmt.Sprintf("%s:%012d", rs.matchID, rs.rolls),
+			Kind:     kind,
+			PlayerID: playerID,
+			Seed:     seed,
+			Inputs:   inputs,
+			MatchID:  rs.matchID,
+			Map:      rs.mapName,
+			Tick:     gs.currentTick,
+		},
+	}
+}
+
+// Record queues the audit record of a finished roll; records are written about once a second.
+// Bots have no storage and aren't audited.
+func (rs *RNGService) Record(roll *Roll, outcome any) {
+	if IsBot(roll.audit.PlayerID) {
+		return
+	}
+	roll.audit.Outcome = outcome
+	roll.audit.Time = time.Now().UTC()
+	if len(rs.pending) >= maxRNGAuditBuffer {
+		rs.logger.Warn("RNG audit buffer full; dropping roll %s", rs.pending[0].ID)
+		rs.pending = rs.pending[1:]
+	}
+	rs.pending = append(rs.pending, roll.audit)
+}
+
+// Update writes the queued audit records once per rngAuditFlushInterval
+func (rs *RNGService) Update(ctx context.Context, gs *GameMatchState) {
+	if gs.currentTick < rs.nextFlush {
+		return
+	}
+	rs.nextFlush = gs.currentTick + rngAuditFlushInterval
+	rs.Flush(ctx)
+}
+
+// Flush writes the queued audit records. Records that fail to write stay queued for the next try;
+// after maxRNGAuditAttempts failures in a row they are dead-lettered to the server log and
+// dropped, so one record storage keeps rejecting can't hold back every roll after it.
+func (rs *RNGService) Flush(ctx context.Context) {
+	if len(rs.pending) == 0 {
+		return
+	}
+	if err := rs.db.AppendRollAudits(ctx, rs.pending); err != nil {
+		rs.failures++
+		rs.logger.Error("Failed to write %d RNG audit records (attempt %d of %d): %v", len(rs.pending), rs.failures, maxRNGAuditAttempts, err)
+		if rs.failures < maxRNGAuditAttempts {
+			return
+		}
+		for _, roll := range rs.pending {
+			data, _ := json.Marshal(roll)
+			rs.logger.Error("Dropping RNG audit record %s: %s", roll.ID, data)
+		}
+	}
+	rs.failures = 0
+	rs.pending = rs.pending[:0]
+}
+
+// RollCrit checks a hit for a critical: with chance (0..1) the damage is multiplied. Hits that
+// can't crit don't roll. playerID is the player the roll is audited for: the attacker, or the
+// target when an NPC attacks.
+func (gs *GameMatchState) RollCrit(playerID string, source DamageSource, targetID string, damage, chance, multiplier float64) (float64, bool) {
+	if chance <= 0 || damage <= 0 {
+		return damage, false
+	}
+	roll := gs.random.Roll(gs, RollCrit, playerID, map[string]any{
+		"attacker": source.Type + ":" + source.ID,
+		"target":   targetID,
+		"chance":   chance,
+		"damage":   damage,
+	})
+	crit := roll.Float64() < chance
+	gs.random.Record(roll, crit)
+	if crit {
+		damage *= multiplier
+	}
+	return damage, crit
+}
+
+// rngSeedParam returns the rngSeed match parameter, which makes a match deterministic
+func rngSeedParam(params map[string]interface{}) (int64, bool) {
+	switch v := params["rngSeed"].(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case string:
+		seed, err := strconv.ParseInt(v, 10, 64)
+		return seed, err == nil
+	}
+	return 0, false
+}
+
+// critPlayer returns the player a crit by source on a target is audited for
+func critPlayer(source DamageSource, targetKind, targetID string) string {
+	if source.Type == DamageSourcePlayer {
+		return source.ID
+	}
+	if targetKind == "player" {
+		return targetID
+	}
+	return ""
+}
+
+// rpcAdminRNGAudit pages through the audited rolls of a player (in roll order within a match)
+// Payload: {"playerId": "...", "limit": 50, "cursor": "optional"}
+func rpcAdminRNGAudit(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	req := struct {
+		PlayerID string `json:"playerId"`
+		Limit    int    `json:"limit"`
+		Cursor   string `json:"cursor"`
+	}{Limit: 50}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.PlayerID == "" {
+		return "", errInvalidPayload
+	}
+	if req.Limit <= 0 || req.Limit > maxRNGAuditPage {
+		req.Limit = maxRNGAuditPage
+	}
+
+	rolls, cursor, err := NewDatabaseManager(logger, nk).ListRollAudits(ctx, req.PlayerID, req.Limit, req.Cursor)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	out, err := json.Marshal(map[string]interface{}{"rolls": rolls, "cursor": cursor})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Script effect types
+const (
+	EffectAck         = "ack"          // AckMessage, logged (relayed in ability cast results)
+	EffectSendMessage = "send_message" // PlayerID, Text or Key/Params
+	EffectGiveItem    = "give_item"    // PlayerID, ItemID, Count
+	EffectTeleport    = "teleport"     // PlayerID, Position
+	EffectSpawnEntity = "spawn_entity" // Kind, Entity, Position, Count
+	EffectPlaySound   = "play_sound"   // Sound, Position, Radius
+	EffectStartQuest  = "start_quest"  // PlayerID, QuestID
+)
+
+// Spawned entity kinds of EffectSpawnEntity
+const (
+	SpawnKindNPC  = "npc"
+	SpawnKindItem = "item"
+)
+
+// Script effect tuning
+const (
+	maxScriptEffects   = 64    // effects one script run may queue
+	maxEffectCount     = 100   // items or entities one give or spawn effect may create
+	defaultSoundRadius = 640.0 // px; players this close hear a sound effect without a radius
+)
+
+// ScriptEffect is a change a script asks the match to make once it finished, queued with the
+// effect_* script functions. Scripts that only queue effects don't touch the match state
+// themselves, and a script that fails applies none of them.
+type ScriptEffect struct {
+	Type     string `json:"type"`
+	ObjectID int    `json:"objectId,omitempty"` // object whose script queued the effect
+
+	AckMessage string         `json:"ackMessage,omitempty"`
+	PlayerID   string         `json:"playerId,omitempty"`
+	Text       string         `json:"text,omitempty"`
+	Key        string         `json:"key,omitempty"` // message catalog key, rendered in the player's language
+	Params     map[string]any `json:"params,omitempty"`
+	ItemID     string         `json:"itemId,omitempty"`
+	Count      int            `json:"count,omitempty"`
+	Position   vector.Vector  `json:"position"`
+	Kind       string         `json:"kind,omitempty"`
+	Entity     string         `json:"entity,omitempty"` // NPC type or item ID to spawn
+	Sound      string         `json:"sound,omitempty"`
+	Radius     float64        `json:"radius,omitempty"`
+	QuestID    string         `json:"questId,omitempty"`
+}
+
+// ScriptMessage is a message a script effect shows one player
+type ScriptMessage struct {
+	ObjectID int    `json:"objectId,omitempty"`
+	Text     string `json:"text"`
+}
+
+// SoundEffect is a one-shot sound played at a point, sent to the players who hear it
+type SoundEffect struct {
+	Sound string  `json:"sound"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+}
+
+// RunScript executes a hook's script and applies the effects it queued. It returns the script's
+// error, in which case nothing is applied.
+func (gs *GameMatchState) RunScript(ctx context.Context, scriptPath string, params map[string]any, dispatcher runtime.MatchDispatcher, logger runtime.Logger) error {
+	effects, err := gs.scriptEngine.Execute(ctx, scriptPath, params, gs, dispatcher)
+	if err != nil {
+		return err
+	}
+	gs.ApplyScriptEffects(ctx, effects, dispatcher, logger)
+	return nil
+}
+
+// ApplyScriptEffects executes the effects a script queued, in order. It returns the effects that
+// were applied; the others are logged and skipped.
+func (gs *GameMatchState) ApplyScriptEffects(ctx context.Context, effects []ScriptEffect, dispatcher runtime.MatchDispatcher, logger runtime.Logger) []ScriptEffect {
+	applied := make([]ScriptEffect, 0, len(effects))
+	for _, effect := range effects {
+		if reason := gs.applyScriptEffect(ctx, effect, dispatcher, logger); reason != "" {
+			logger.Warn("Script effect %s of object %d skipped: %s", effect.Type, effect.ObjectID, reason)
+			continue
+		}
+		applied = append(applied, effect)
+	}
+	return applied
+}
+
+// applyScriptEffect executes one effect. It returns why it couldn't, or "".
+func (gs *GameMatchState) applyScriptEffect(ctx context.Context, effect ScriptEffect, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	if effect.Count < 1 {
+		effect.Count = 1
+	}
+	if effect.Count > maxEffectCount {
+		effect.Count = maxEffectCount
+	}
+	switch effect.Type {
+	case EffectAck:
+		logger.Info("Script effect of object %d: ACK message: %s", effect.ObjectID, effect.AckMessage)
+	case EffectSendMessage:
+		presence, ok := gs.presences[effect.PlayerID]
+		if !ok {
+			return "player not in the match"
+		}
+		text := effect.Text
+		if effect.Key != "" {
+			text = messageCatalog.Render(gs.Locale(effect.PlayerID), effect.Key, effect.Params)
+		}
+		gs.sendEffectMessage("script_message", OpCodeObjectUpdate, ScriptMessage{ObjectID: effect.ObjectID, Text: text}, []runtime.Presence{presence}, dispatcher, logger)
+	case EffectGiveItem:
+		if _, ok := gs.itemCatalog.Get(effect.ItemID); !ok {
+			return "unknown item " + effect.ItemID
+		}
+		if gs.PlayerBody(effect.PlayerID) == nil {
+			return "player not in the match"
+		}
+		if err := gs.inventoryManager.Add(ctx, effect.PlayerID, effect.ItemID, effect.Count); err != nil {
+			return err.Error()
+		}
+		gs.inventoryManager.SyncToClient(ctx, gs, effect.PlayerID, dispatcher)
+	case EffectTeleport:
+		if gs.PlayerBody(effect.PlayerID) == nil {
+			return "player not in the match"
+		}
+		if _, ok := gs.Teleport(effect.PlayerID, effect.Position, CorrectionScript); !ok {
+			return "no free spot near the destination"
+		}
+	case EffectSpawnEntity:
+		switch effect.Kind {
+		case SpawnKindNPC:
+			for i := 0; i < effect.Count; i++ {
+				if gs.npcManager.Spawn(gs, effect.Entity, effect.Position, nil) == 0 {
+					return "unknown NPC type " + effect.Entity
+				}
+			}
+		case SpawnKindItem:
+			if _, ok := gs.itemCatalog.Get(effect.Entity); !ok {
+				return "unknown item " + effect.Entity
+			}
+			gs.worldItems.Spawn(gs, effect.Entity, effect.Count, effect.Position, "", 0, dispatcher)
+		default:
+			return "unknown entity kind " + effect.Kind
+		}
+	case EffectPlaySound:
+		radius := effect.Radius
+		if radius <= 0 {
+			radius = defaultSoundRadius
+		}
+		listeners := gs.PresencesInRange(effect.Position, radius)
+		if len(listeners) > 0 {
+			gs.sendEffectMessage("sound", OpCodeAudio, SoundEffect{Sound: effect.Sound, X: effect.Position.X, Y: effect.Position.Y}, listeners, dispatcher, logger)
+		}
+	case EffectStartQuest:
+		if gs.PlayerBody(effect.PlayerID) == nil {
+			return "player not in the match"
+		}
+		if reason := gs.quests.Start(ctx, gs, effect.PlayerID, effect.QuestID, dispatcher); reason != "" {
+			return reason
+		}
+	default:
+		return "unknown effect type"
+	}
+	return ""
+}
+
+// sendEffectMessage sends a script effect's message to its recipients
+func (gs *GameMatchState) sendEffectMessage(msgType string, opCode int64, payload any, recipients []runtime.Presence, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if dispatcher == nil {
+		return
+	}
+	data, err := EncodeMessage(opCode, msgType, payload)
+	if err != nil {
+		logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(opCode, data, recipients, nil, true)
+}
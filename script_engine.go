@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/rudransh61/Physix-go/pkg/polygon"
@@ -15,20 +20,48 @@ import (
 
 type ScriptEngine struct {
 	logger  runtime.Logger
+	nk      runtime.NakamaModule
 	baseDir string
 	pool    sync.Pool
+	stats   map[string]*ScriptStats // script path -> execution statistics
+	statsMu sync.Mutex
+	// time spent in scripts since TakeExecutionTime was last called
+	pendingTime time.Duration
+	// storage-backed script versions active for the current map (script path -> script)
+	overrides   map[string]*StoredScript
+	overridesMu sync.RWMutex
 }
 
-type ScriptEffect struct {
-	ObjectID int
+// ScriptStats aggregates execution statistics for a single script
+type ScriptStats struct {
+	Invocations   int64         `json:"invocations"`
+	Errors        int64         `json:"errors"`
+	TotalDuration time.Duration `json:"-"`
+	MaxDuration   time.Duration `json:"-"`
+}
 
-	AckMessage string
+// ScriptStatsReport is the serializable view of ScriptStats returned by the admin RPC
+type ScriptStatsReport struct {
+	Script      string  `json:"script"`
+	Invocations int64   `json:"invocations"`
+	Errors      int64   `json:"errors"`
+	ErrorRate   float64 `json:"errorRate"`
+	AvgMillis   float64 `json:"avgMs"`
+	MaxMillis   float64 `json:"maxMs"`
+	TotalMillis float64 `json:"totalMs"`
 }
 
-func NewScriptEngine(logger runtime.Logger, baseDir string) *ScriptEngine {
+// slowScriptThreshold is the execution time above which a single run is logged as slow
+// (a 60Hz tick has ~16ms in total for physics, scripts and broadcasting)
+const slowScriptThreshold = 5 * time.Millisecond
+
+func NewScriptEngine(logger runtime.Logger, nk runtime.NakamaModule, baseDir string) *ScriptEngine {
 	return &ScriptEngine{
-		logger:  logger,
-		baseDir: baseDir,
+		logger:    logger,
+		nk:        nk,
+		baseDir:   baseDir,
+		stats:     make(map[string]*ScriptStats),
+		overrides: make(map[string]*StoredScript),
 		pool: sync.Pool{
 			New: func() any {
 				L := lua.NewState(
@@ -42,79 +75,93 @@ func NewScriptEngine(logger runtime.Logger, baseDir string) *ScriptEngine {
 	}
 }
 
-func (se *ScriptEngine) Execute(scriptPath string, params map[string]any, gs *GameMatchState, dispatcher runtime.MatchDispatcher) ([]ScriptEffect, error) {
+func (se *ScriptEngine) Execute(ctx context.Context, scriptPath string, params map[string]any, gs *GameMatchState, dispatcher runtime.MatchDispatcher) (effects []ScriptEffect, err error) {
 	L := se.pool.Get().(*lua.LState)
+	start := time.Now()
 	defer func() {
 		L.Close()
+		se.recordExecution(scriptPath, time.Since(start), err)
 	}()
 
-	effects := make([]ScriptEffect, 0, 4)
+	effects = make([]ScriptEffect, 0, 4)
 
 	register := func(name string, fn lua.LGFunction) {
 		L.SetGlobal(name, L.NewFunction(fn))
 	}
 
+	// Effects are queued for the caller to apply once the script finished (script_effects.go)
+	queue := func(effect ScriptEffect) {
+		if len(effects) >= maxScriptEffects {
+			L.RaiseError("more than %d effects", maxScriptEffects)
+			return
+		}
+		if oid, ok := params["objectId"].(int); ok {
+			effect.ObjectID = oid
+		}
+		effects = append(effects, effect)
+	}
+
 	register("effect_ack", func(L *lua.LState) int {
 		msg := L.CheckString(1)
-		effects = append(effects, ScriptEffect{AckMessage: msg})
+		queue(ScriptEffect{Type: EffectAck, AckMessage: msg})
 		return 0
 	})
 
-	// helper to convert lua table back to Go types
-	var luaTableToGo func(*lua.LTable) any
-	luaTableToGo = func(tbl *lua.LTable) any {
-		// detect if array-like
-		maxIdx := 0
-		isArray := true
-		tbl.ForEach(func(k, v lua.LValue) {
-			if keyNum, ok := k.(lua.LNumber); ok {
-				if int(keyNum) > maxIdx {
-					maxIdx = int(keyNum)
-				}
-			} else {
-				isArray = false
-			}
+	// Script API: effect_message(playerId, text) and effect_message(playerId, key, params) show a
+	// player a message, literal or from the message catalog in their language
+	register("effect_message", func(L *lua.LState) int {
+		effect := ScriptEffect{Type: EffectSendMessage, PlayerID: L.CheckString(1)}
+		if tbl, ok := L.Get(3).(*lua.LTable); ok {
+			effect.Key = L.CheckString(2)
+			effect.Params, _ = luaValueToGo(tbl).(map[string]any)
+		} else {
+			effect.Text = L.CheckString(2)
+		}
+		queue(effect)
+		return 0
+	})
+
+	// Script API: effect_give_item(playerId, itemId[, count])
+	register("effect_give_item", func(L *lua.LState) int {
+		queue(ScriptEffect{Type: EffectGiveItem, PlayerID: L.CheckString(1), ItemID: L.CheckString(2), Count: L.OptInt(3, 1)})
+		return 0
+	})
+
+	// Script API: effect_teleport(playerId, x, y)
+	register("effect_teleport", func(L *lua.LState) int {
+		queue(ScriptEffect{Type: EffectTeleport, PlayerID: L.CheckString(1), Position: vector.Vector{X: float64(L.CheckNumber(2)), Y: float64(L.CheckNumber(3))}})
+		return 0
+	})
+
+	// Script API: effect_spawn(kind, type, x, y[, count]) spawns NPCs ("npc") or a stack of items
+	// ("item") lying in the world
+	register("effect_spawn", func(L *lua.LState) int {
+		queue(ScriptEffect{
+			Type:     EffectSpawnEntity,
+			Kind:     L.CheckString(1),
+			Entity:   L.CheckString(2),
+			Position: vector.Vector{X: float64(L.CheckNumber(3)), Y: float64(L.CheckNumber(4))},
+			Count:    L.OptInt(5, 1),
 		})
-		if isArray && maxIdx > 0 {
-			arr := make([]any, 0, maxIdx)
-			for i := 1; i <= maxIdx; i++ {
-				val := tbl.RawGetInt(i)
-				if vtbl, ok := val.(*lua.LTable); ok {
-					arr = append(arr, luaTableToGo(vtbl))
-				} else {
-					switch vv := val.(type) {
-					case lua.LString:
-						arr = append(arr, string(vv))
-					case lua.LNumber:
-						arr = append(arr, float64(vv))
-					case lua.LBool:
-						arr = append(arr, bool(vv))
-					default:
-						arr = append(arr, val.String())
-					}
-				}
-			}
-			return arr
-		}
-
-		m := make(map[string]any)
-		tbl.ForEach(func(k, v lua.LValue) {
-			keyStr := k.String()
-			switch val := v.(type) {
-			case lua.LString:
-				m[keyStr] = string(val)
-			case lua.LNumber:
-				m[keyStr] = float64(val)
-			case lua.LBool:
-				m[keyStr] = bool(val)
-			case *lua.LTable:
-				m[keyStr] = luaTableToGo(val)
-			default:
-				m[keyStr] = v.String()
-			}
+		return 0
+	})
+
+	// Script API: effect_play_sound(sound, x, y[, radius]) plays a sound to the players in range
+	register("effect_play_sound", func(L *lua.LState) int {
+		queue(ScriptEffect{
+			Type:     EffectPlaySound,
+			Sound:    L.CheckString(1),
+			Position: vector.Vector{X: float64(L.CheckNumber(2)), Y: float64(L.CheckNumber(3))},
+			Radius:   float64(L.OptNumber(4, 0)),
 		})
-		return m
-	}
+		return 0
+	})
+
+	// Script API: effect_start_quest(playerId, questId) gives the player a quest without its giver
+	register("effect_start_quest", func(L *lua.LState) int {
+		queue(ScriptEffect{Type: EffectStartQuest, PlayerID: L.CheckString(1), QuestID: L.CheckString(2)})
+		return 0
+	})
 
 	// Script API: set_object_prop(objectId, key, value)
 	register("set_object_prop", func(L *lua.LState) int {
@@ -122,25 +169,13 @@ func (se *ScriptEngine) Execute(scriptPath string, params map[string]any, gs *Ga
 		key := L.CheckString(2)
 		val := L.CheckAny(3)
 
-		var gv any
-		switch val.Type() {
-		case lua.LTNil:
-			gv = nil
-		case lua.LTBool:
-			gv = lua.LVAsBool(val)
-		case lua.LTNumber:
-			gv = float64(lua.LVAsNumber(val))
-		case lua.LTString:
-			gv = string(lua.LVAsString(val))
-		case lua.LTTable:
-			gv = luaTableToGo(val.(*lua.LTable))
-		default:
-			gv = val.String()
-		}
+		gv := luaValueToGo(val)
 
 		if gs != nil {
-			if obj := gs.objects[oid]; obj != nil {
+			// The owner prop of owned objects mirrors their ownership, which scripts can't change
+			if obj, ok := gs.Object(oid); ok && (obj.Ownership == nil || key != "owner") {
 				obj.Props[key] = gv
+				gs.objectUpdates.Mark(oid)
 			}
 		}
 		return 0
@@ -151,7 +186,7 @@ func (se *ScriptEngine) Execute(scriptPath string, params map[string]any, gs *Ga
 		key := L.CheckString(2)
 
 		if gs != nil {
-			if obj := gs.objects[oid]; obj != nil {
+			if obj, ok := gs.Object(oid); ok {
 				if v, ok := obj.Props[key]; ok {
 					switch vv := v.(type) {
 					case string:
@@ -206,7 +241,7 @@ func (se *ScriptEngine) Execute(scriptPath string, params map[string]any, gs *Ga
 		key := L.CheckString(2)
 
 		if gs != nil {
-			if obj := gs.objects[oid]; obj != nil {
+			if obj, ok := gs.Object(oid); ok {
 				_, ok := obj.Props[key]
 				L.Push(lua.LBool(ok))
 				return 1
@@ -216,228 +251,1904 @@ func (se *ScriptEngine) Execute(scriptPath string, params map[string]any, gs *Ga
 		return 1
 	})
 
-	// Script API: set_object_gid(objectId, gid)
-	register("set_object_gid", func(L *lua.LState) int {
-		oid := int(L.CheckNumber(1))
-		gid := uint32(L.CheckNumber(2))
+	// Script API: set_cooldown(playerId, key, seconds)
+	register("set_cooldown", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		key := L.CheckString(2)
+		seconds := float64(L.CheckNumber(3))
 
-		if gs == nil {
+		if gs == nil || gs.interactionTracker == nil {
 			return 0
 		}
+		if err := gs.interactionTracker.SetCooldown(ctx, playerID, key, seconds); err != nil {
+			se.logger.Error("set_cooldown: failed to persist cooldown %s for %s: %v", key, playerID, err)
+		}
+		return 0
+	})
 
-		// Update GID under lock to avoid races with other state mutations
-		gs.mu.Lock()
-		obj := gs.objects[oid]
-		if obj == nil {
-			gs.mu.Unlock()
-			return 0
+	// Script API: is_on_cooldown(playerId, key) -> bool, remainingSeconds
+	register("is_on_cooldown", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		key := L.CheckString(2)
+
+		if gs == nil || gs.interactionTracker == nil {
+			L.Push(lua.LBool(false))
+			L.Push(lua.LNumber(0))
+			return 2
 		}
-		obj.GID = gid
+		active, remaining := gs.interactionTracker.IsOnCooldown(ctx, playerID, key)
+		L.Push(lua.LBool(active))
+		L.Push(lua.LNumber(remaining))
+		return 2
+	})
+
+	// Script API: mark_done_once(playerId, key) -> true the first time, false afterwards
+	register("mark_done_once", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		key := L.CheckString(2)
+
+		if gs == nil || gs.interactionTracker == nil {
+			L.Push(lua.LBool(false))
+			return 1
+		}
+		// A flag that couldn't be saved isn't set: the script sees false and grants nothing
+		first, err := gs.interactionTracker.MarkDoneOnce(ctx, playerID, key)
+		if err != nil {
+			se.logger.Error("mark_done_once: failed to persist flag %s for %s: %v", key, playerID, err)
+		}
+		L.Push(lua.LBool(first))
+		return 1
+	})
+
+	// Script API: is_done(playerId, key) -> bool
+	register("is_done", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		key := L.CheckString(2)
+
+		if gs == nil || gs.interactionTracker == nil {
+			L.Push(lua.LBool(false))
+			return 1
+		}
+		L.Push(lua.LBool(gs.interactionTracker.IsDone(ctx, playerID, key)))
+		return 1
+	})
+
+	// Script API: claim_object(objectId, key[, seconds]) -> true for the first caller only, until
+	// the claim expires (0: until the match ends)
+	register("claim_object", func(L *lua.LState) int {
+		oid := L.CheckInt(1)
+		key := L.CheckString(2)
+		seconds := float64(L.OptNumber(3, 0))
+
+		if gs == nil || gs.interactGuard == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		gs.mu.Lock()
+		_, ok := gs.Object(oid)
 		gs.mu.Unlock()
+		L.Push(lua.LBool(ok && gs.interactGuard.Claim(gs, oid, key, seconds)))
+		return 1
+	})
 
-		// Remove any existing colliders owned by this object
-		gs.RemoveOwnerColliders(oid)
+	// Script API: release_object_claim(objectId[, key]) drops a claim, or every claim on the object
+	register("release_object_claim", func(L *lua.LState) int {
+		oid := L.CheckInt(1)
+		key := L.OptString(2, "")
 
-		// If we have map tile collision templates, rebuild colliders automatically
-		if gs.currentMap == nil {
-			se.logger.Info("Current map is nil, cannot set object gid %d", gid)
-			return 0
+		if gs != nil && gs.interactGuard != nil {
+			gs.interactGuard.Release(oid, key)
 		}
+		return 0
+	})
 
-		template, ok := gs.currentMap.TileCollisions[int(gid)]
+	// Script API: get_world_var(key) -> value or nil
+	register("get_world_var", func(L *lua.LState) int {
+		key := L.CheckString(1)
+
+		if gs == nil || gs.worldVars == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		v, ok := gs.worldVars.Get(key)
 		if !ok {
-			// No tile collision template for this gid
-			se.logger.Info("No tile collision template for this gid %d", gid)
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(se.toLValue(L, v))
+		return 1
+	})
+
+	// Script API: set_world_var(key, value[, persist]) - nil value deletes the variable
+	register("set_world_var", func(L *lua.LState) int {
+		key := L.CheckString(1)
+		val := L.CheckAny(2)
+		persist := L.OptBool(3, false)
+
+		if gs == nil || gs.worldVars == nil {
 			return 0
 		}
+		gs.worldVars.Set(key, luaValueToGo(val), persist)
+		return 0
+	})
 
-		// Read object's world center position from Props (set by MapLoader when map objects were created)
-		gs.mu.Lock()
-		od := gs.objects[oid]
-		var centerX, centerY float64
-		if od != nil {
-			if xv, ok := od.Props["x"]; ok {
-				if xf, ok2 := xv.(float64); ok2 {
-					centerX = xf
-				}
+	// Script API: get_region_var(key) -> value or nil, from the variables of the script's region
+	// (region_vars.go)
+	register("get_region_var", func(L *lua.LState) int {
+		key := L.CheckString(1)
+
+		if gs == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		region := gs.scriptRegion(params)
+		if region == "" {
+			L.Push(lua.LNil)
+			return 1
+		}
+		v, ok := gs.regionVars.Get(region, key)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(se.toLValue(L, v))
+		return 1
+	})
+
+	// Script API: set_region_var(key, value[, persist]) -> false outside regions or when the
+	// region holds too many variables; nil value deletes the variable
+	register("set_region_var", func(L *lua.LState) int {
+		key := L.CheckString(1)
+		val := L.CheckAny(2)
+		persist := L.OptBool(3, false)
+
+		ok := false
+		if gs != nil {
+			if region := gs.scriptRegion(params); region != "" {
+				ok = gs.regionVars.Set(region, key, luaValueToGo(val), persist)
 			}
-			if yv, ok := od.Props["y"]; ok {
-				if yf, ok2 := yv.(float64); ok2 {
-					centerY = yf
-				}
+		}
+		L.Push(lua.LBool(ok))
+		return 1
+	})
+
+	// Script API: clear_region_vars() deletes every variable of the script's region
+	register("clear_region_vars", func(L *lua.LState) int {
+		if gs != nil {
+			if region := gs.scriptRegion(params); region != "" {
+				gs.regionVars.Clear(region)
 			}
 		}
-		gs.mu.Unlock()
+		return 0
+	})
 
-		if centerX == 0 && centerY == 0 {
-			se.logger.Info("set_object_gid: object %d missing world position props x/y; skipping auto-rebuild", oid)
-			return 0
+	// Script API: get_script_region() -> ID of the region the script's variables are scoped to,
+	// or nil outside regions
+	register("get_script_region", func(L *lua.LState) int {
+		if gs == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		if region := gs.scriptRegion(params); region != "" {
+			L.Push(lua.LString(region))
+			return 1
 		}
+		L.Push(lua.LNil)
+		return 1
+	})
 
-		// Tile top-left (templates are stored relative to tile top-left)
-		tileW := float64(gs.currentMap.TileWidth)
-		tileH := float64(gs.currentMap.TileHeight)
-		tileX := centerX - tileW/2.0
-		tileY := centerY - tileH/2.0
+	// Script API: get_map_property(name) -> value or nil
+	register("get_map_property", func(L *lua.LState) int {
+		name := L.CheckString(1)
 
-		// Create colliders from template and register them as owned by this object
-		for _, ct := range template.Colliders {
-			rb, pts := MakeRigidBodyFromTileTemplate(tileX, tileY, ct)
-			if rb == nil {
-				continue
-			}
-			// If polygon, ensure physics engine gets the vertex list later when registered by GameMatchState
-			if len(pts) > 0 {
-				se.logger.Info("set_object_gid: object %d adding polygon collider with %d points", oid, len(pts))
-			}
-			gs.AddOwnerCollider(oid, rb, pts)
+		if gs == nil || gs.currentMap == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		v, ok := gs.currentMap.Properties[name]
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
 		}
+		L.Push(se.toLValue(L, v))
+		return 1
+	})
 
-		// Broadcast an immediate object update to clients so they can update texture/frame
-		// Pass the dispatcher from Execute so scripts that run via the match can push updates immediately.
-		if dispatcher != nil {
-			gs.BroadcastObjectUpdate(oid, dispatcher, se.logger)
-		} else {
-			// Best-effort: still call with nil dispatcher so match loop/world snapshots will include the change
-			gs.BroadcastObjectUpdate(oid, nil, se.logger)
+	// Script API: get_map_properties() -> table of all custom map properties
+	register("get_map_properties", func(L *lua.LState) int {
+		if gs == nil || gs.currentMap == nil {
+			L.Push(L.NewTable())
+			return 1
 		}
+		L.Push(se.toLValue(L, gs.currentMap.Properties))
+		return 1
+	})
 
-		return 0
+	// Script API: add_light(x, y, radius[, color, flicker]) -> lightId
+	register("add_light", func(L *lua.LState) int {
+		x := float64(L.CheckNumber(1))
+		y := float64(L.CheckNumber(2))
+		radius := float64(L.CheckNumber(3))
+		color := L.OptString(4, "")
+		flicker := float64(L.OptNumber(5, 0))
+
+		if gs == nil || radius <= 0 {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(gs.lights.Place("", vector.Vector{X: x, Y: y}, radius, color, flicker)))
+		return 1
 	})
 
-	// Script API: add_object_collider(objectId, colliderTable)
-	register("add_object_collider", func(L *lua.LState) int {
-		oid := int(L.CheckNumber(1))
-		tbl := L.CheckTable(2)
+	// Script API: attach_light(objectId, radius[, color, flicker]) -> lightId (nil for unknown objects)
+	register("attach_light", func(L *lua.LState) int {
+		oid := L.CheckInt(1)
+		radius := float64(L.CheckNumber(2))
+		color := L.OptString(3, "")
+		flicker := float64(L.OptNumber(4, 0))
+
+		if gs == nil || radius <= 0 {
+			L.Push(lua.LNil)
+			return 1
+		}
+		id, ok := gs.lights.Attach(gs, oid, radius, color, flicker)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(id))
+		return 1
+	})
+
+	// Script API: set_light(lightId or name, lit) -> bool. A name lights or puts out every light of that name
+	register("set_light", func(L *lua.LState) int {
+		lit := L.CheckBool(2)
 
 		if gs == nil {
-			return 0
+			L.Push(lua.LFalse)
+			return 1
 		}
-		if obj := gs.objects[oid]; obj == nil {
-			return 0
+		matched := 0
+		switch key := L.CheckAny(1).(type) {
+		case lua.LNumber:
+			matched = gs.lights.SetLit(int(key), "", lit)
+		case lua.LString:
+			matched = gs.lights.SetLit(0, string(key), lit)
+		default:
+			L.ArgError(1, "light ID or name expected")
 		}
+		L.Push(lua.LBool(matched > 0))
+		return 1
+	})
 
-		shape := L.GetField(tbl, "shape")
-		var rb rigidbody.RigidBody
-		rb.Velocity = vector.Vector{X: 0, Y: 0}
-		rb.Mass = 0
-		rb.IsMovable = false
+	// Script API: remove_light(lightId) -> bool
+	register("remove_light", func(L *lua.LState) int {
+		id := L.CheckInt(1)
+		L.Push(lua.LBool(gs != nil && gs.lights.Remove(id)))
+		return 1
+	})
 
-		if shapeStr, ok := shape.(lua.LString); ok {
-			switch string(shapeStr) {
-			case "rectangle":
-				rb.Shape = "rectangle"
-				rb.Width = float64(L.GetField(tbl, "width").(lua.LNumber))
-				rb.Height = float64(L.GetField(tbl, "height").(lua.LNumber))
-				rb.Position.X = float64(L.GetField(tbl, "x").(lua.LNumber))
-				rb.Position.Y = float64(L.GetField(tbl, "y").(lua.LNumber))
-				// add collider via helper (empty polygonPoints)
-				gs.AddOwnerCollider(oid, &rb, nil)
-			case "circle":
-				rb.Shape = "circle"
-				rb.Radius = float64(L.GetField(tbl, "radius").(lua.LNumber))
-				rb.Position.X = float64(L.GetField(tbl, "x").(lua.LNumber))
-				rb.Position.Y = float64(L.GetField(tbl, "y").(lua.LNumber))
-				// add collider via helper (empty polygonPoints)
-				gs.AddOwnerCollider(oid, &rb, nil)
-			case "polygon":
-				polyTbl := L.GetField(tbl, "polygon")
-				if ptbl, ok := polyTbl.(*lua.LTable); ok {
-					points := make([]vector.Vector, 0)
-					ptbl.ForEach(func(key, val lua.LValue) {
-						if vtbl, ok := val.(*lua.LTable); ok {
-							x := float64(L.GetField(vtbl, "x").(lua.LNumber))
-							y := float64(L.GetField(vtbl, "y").(lua.LNumber))
-							points = append(points, vector.Vector{X: x, Y: y})
-						}
-					})
-					poly := polygon.NewPolygon(points, 0, false)
-					poly.RigidBody.IsMovable = false
-					poly.RigidBody.Shape = "polygon"
+	// Script API: get_marker(name) -> x, y (nil if no spawn point/marker has that name)
+	register("get_marker", func(L *lua.LState) int {
+		name := L.CheckString(1)
 
-					// add collider via helper (handles ownership and physics registration)
-					gs.AddOwnerCollider(oid, &poly.RigidBody, points)
-				}
+		if gs == nil || gs.currentMap == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		pos, ok := gs.mapLoader.GetMarker(gs.currentMap, name)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(pos.X))
+		L.Push(lua.LNumber(pos.Y))
+		return 2
+	})
+
+	// Script API: get_spawn_points() -> array of {x, y}
+	register("get_spawn_points", func(L *lua.LState) int {
+		tbl := L.NewTable()
+		if gs != nil && gs.currentMap != nil {
+			for i, sp := range gs.currentMap.SpawnPoints {
+				pt := L.NewTable()
+				pt.RawSetString("x", lua.LNumber(sp.X))
+				pt.RawSetString("y", lua.LNumber(sp.Y))
+				tbl.RawSetInt(i+1, pt)
 			}
 		}
-		return 0
+		L.Push(tbl)
+		return 1
 	})
 
-	// Script API: remove_object_colliders(objectId)
-	register("remove_object_colliders", func(L *lua.LState) int {
-		oid := int(L.CheckNumber(1))
+	// Script API: get_tile_at(x, y[, layerName]) -> {gid, layer, tileX, tileY, props} or nil
+	register("get_tile_at", func(L *lua.LState) int {
+		x := float64(L.CheckNumber(1))
+		y := float64(L.CheckNumber(2))
+		layerName := L.OptString(3, "")
+
+		if gs == nil || gs.currentMap == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		tile := gs.mapLoader.GetTileAt(gs.currentMap, x, y, layerName)
+		if tile == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		tbl := L.NewTable()
+		tbl.RawSetString("gid", lua.LNumber(tile.GID))
+		tbl.RawSetString("layer", lua.LString(tile.Layer))
+		tbl.RawSetString("tileX", lua.LNumber(tile.TileX))
+		tbl.RawSetString("tileY", lua.LNumber(tile.TileY))
+		props := map[string]interface{}{}
+		for k, v := range tile.Properties {
+			props[k] = v
+		}
+		tbl.RawSetString("props", se.toLValue(L, props))
+		L.Push(tbl)
+		return 1
+	})
+
+	// Script API: get_player_facing(playerId) -> radians (or nil)
+	register("get_player_facing", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		if gs == nil || gs.PlayerBody(playerID) == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(gs.GetPlayerState(playerID).Facing))
+		return 1
+	})
+
+	// Script API: set_player_team(playerId, team) -> bool. The team names the spawn group the player respawns at ("" clears it)
+	register("set_player_team", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		team := L.CheckString(2)
+		if gs == nil || gs.PlayerBody(playerID) == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		gs.GetPlayerState(playerID).Team = team
+		L.Push(lua.LTrue)
+		return 1
+	})
+
+	// Script API: teleport_player(playerId, x, y) -> bool, x, y. The player gets a position_correction
+	// and snaps to the destination, or the nearest free spot when it is blocked
+	register("teleport_player", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		x := float64(L.CheckNumber(2))
+		y := float64(L.CheckNumber(3))
 		if gs == nil {
-			return 0
+			L.Push(lua.LFalse)
+			return 1
+		}
+		position, ok := gs.Teleport(playerID, vector.Vector{X: x, Y: y}, CorrectionScript)
+		if !ok {
+			L.Push(lua.LFalse)
+			return 1
 		}
+		L.Push(lua.LTrue)
+		L.Push(lua.LNumber(position.X))
+		L.Push(lua.LNumber(position.Y))
+		return 3
+	})
 
-		// delegate to GameMatchState helper (handles locking and cleanup)
-		gs.RemoveOwnerColliders(oid)
+	// Script API: is_in_facing_cone(playerId, x, y, halfAngleDegrees[, range]) -> bool
+	register("is_in_facing_cone", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		x := float64(L.CheckNumber(2))
+		y := float64(L.CheckNumber(3))
+		halfAngle := float64(L.CheckNumber(4)) * math.Pi / 180
+		maxRange := float64(L.OptNumber(5, 0))
 
-		return 0
+		if gs == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		rb := gs.PlayerBody(playerID)
+		if rb == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		facing := gs.GetPlayerState(playerID).Facing
+		L.Push(lua.LBool(inFacingCone(rb.Position, facing, vector.Vector{X: x, Y: y}, halfAngle, maxRange)))
+		return 1
 	})
 
-	// Helper to convert Go values (including nested maps/slices) to lua.LValue
-	var toLValue func(any) lua.LValue
-	toLValue = func(v any) lua.LValue {
-		switch v := v.(type) {
-		case nil:
-			return lua.LNil
-		case string:
-			return lua.LString(v)
-		case bool:
-			return lua.LBool(v)
-		case float32:
-			return lua.LNumber(v)
-		case float64:
-			return lua.LNumber(v)
-		case int:
-			return lua.LNumber(v)
-		case int32:
-			return lua.LNumber(v)
-		case int64:
-			return lua.LNumber(v)
-		case uint:
-			return lua.LNumber(v)
-		case uint32:
-			return lua.LNumber(v)
-		case uint64:
-			return lua.LNumber(v)
-		case map[string]interface{}:
-			tbl := L.NewTable()
-			for kk, vv := range v {
-				tbl.RawSetString(kk, toLValue(vv))
-			}
-			return tbl
-		case []interface{}:
-			tbl := L.NewTable()
-			for i, vv := range v {
-				tbl.RawSetInt(i+1, toLValue(vv))
+	// Script API: get_player_target(playerId) -> "player", targetPlayerId | "object", objectId | nil
+	register("get_player_target", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		if gs == nil || gs.PlayerBody(playerID) == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		target := gs.GetPlayerState(playerID).Target
+		if target == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		if target.PlayerID != "" {
+			L.Push(lua.LString("player"))
+			L.Push(lua.LString(target.PlayerID))
+			return 2
+		}
+		L.Push(lua.LString("object"))
+		L.Push(lua.LNumber(target.ObjectID))
+		return 2
+	})
+
+	// Script API: give_item(playerId, itemId[, count]) -> ok
+	register("give_item", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		itemID := L.CheckString(2)
+		count := L.OptInt(3, 1)
+
+		if gs == nil || gs.inventoryManager == nil {
+			L.Push(lua.LBool(false))
+			return 1
+		}
+		if err := gs.inventoryManager.Add(ctx, playerID, itemID, count); err != nil {
+			se.logger.Error("give_item: failed to give %d x %s to %s: %v", count, itemID, playerID, err)
+			L.Push(lua.LBool(false))
+			return 1
+		}
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+		L.Push(lua.LBool(true))
+		return 1
+	})
+
+	// Script API: take_item(playerId, itemId[, count]) -> ok (false if the player owns fewer)
+	register("take_item", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		itemID := L.CheckString(2)
+		count := L.OptInt(3, 1)
+
+		if gs == nil || gs.inventoryManager == nil {
+			L.Push(lua.LBool(false))
+			return 1
+		}
+		if err := gs.inventoryManager.Remove(ctx, playerID, itemID, count); err != nil {
+			if err != errNotEnoughItems {
+				se.logger.Error("take_item: failed to take %d x %s from %s: %v", count, itemID, playerID, err)
 			}
-			return tbl
-		default:
-			// Fallback: try to stringify
-			se.logger.Debug("script: converting unknown param type to string: %T", v)
-			return lua.LString(fmt.Sprintf("%v", v))
+			L.Push(lua.LBool(false))
+			return 1
 		}
-	}
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+		L.Push(lua.LBool(true))
+		return 1
+	})
 
-	ctxTbl := L.NewTable()
-	for k, v := range params {
-		// Use generic converter for all supported types (including maps/slices)
-		L.SetField(ctxTbl, k, toLValue(v))
-	}
-	L.SetGlobal("ctx", ctxTbl)
+	// Script API: spawn_world_item(itemId, count, x, y[, lifetimeSeconds]) -> objectId
+	register("spawn_world_item", func(L *lua.LState) int {
+		itemID := L.CheckString(1)
+		count := L.CheckInt(2)
+		x := float64(L.CheckNumber(3))
+		y := float64(L.CheckNumber(4))
+		lifetime := float64(L.OptNumber(5, 0))
 
-	abs := filepath.Join(se.baseDir, scriptPath)
-	if _, err := os.Stat(abs); err != nil {
-		se.logger.Error("Script file not found: %s", scriptPath)
-		return effects, err
-	}
+		if gs == nil || gs.worldItems == nil || count <= 0 {
+			L.Push(lua.LNil)
+			return 1
+		}
+		oid := gs.worldItems.Spawn(gs, itemID, count, vector.Vector{X: x, Y: y}, "", int64(lifetime*TickRate), dispatcher)
+		L.Push(lua.LNumber(oid))
+		return 1
+	})
 
-	if err := L.DoFile(abs); err != nil {
-		se.logger.Error("Error executing script %s: %v", scriptPath, err)
-		return effects, err
-	}
+	// Script API: roll_loot(tableId[, playerId]) -> { {item=, count=}, ... } without spawning anything
+	register("roll_loot", func(L *lua.LState) int {
+		tableID := L.CheckString(1)
+		playerID := L.OptString(2, "")
 
-	return effects, nil
+		tbl := L.NewTable()
+		if gs == nil || gs.lootCatalog == nil {
+			L.Push(tbl)
+			return 1
+		}
+		for i, stack := range gs.lootCatalog.Roll(gs, tableID, LootContext{PlayerID: playerID}) {
+			st := L.NewTable()
+			st.RawSetString("item", lua.LString(stack.ItemID))
+			st.RawSetString("count", lua.LNumber(stack.Count))
+			tbl.RawSetInt(i+1, st)
+		}
+		L.Push(tbl)
+		return 1
+	})
+
+	// Script API: drop_loot(tableId, x, y[, playerId]) -> { objectId, ... }
+	// playerId is credited with the roll and owns the loot if the table uses killer ownership
+	register("drop_loot", func(L *lua.LState) int {
+		tableID := L.CheckString(1)
+		x := float64(L.CheckNumber(2))
+		y := float64(L.CheckNumber(3))
+		playerID := L.OptString(4, "")
+
+		tbl := L.NewTable()
+		if gs == nil || gs.lootCatalog == nil || gs.worldItems == nil {
+			L.Push(tbl)
+			return 1
+		}
+		ids, _ := gs.DropLoot(tableID, vector.Vector{X: x, Y: y}, playerID, dispatcher)
+		for i, oid := range ids {
+			tbl.RawSetInt(i+1, lua.LNumber(oid))
+		}
+		L.Push(tbl)
+		return 1
+	})
+
+	// Script API: open_container(playerId, objectId) -> {itemId = count, ...} or nil, reason
+	// Unlocks (with the key), opens and loots a container for the player
+	register("open_container", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		oid := int(L.CheckNumber(2))
+
+		if gs == nil || gs.containers == nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(RejectInvalidTarget))
+			return 2
+		}
+		stacks, reason := gs.containers.Open(ctx, gs, playerID, oid, dispatcher)
+		if reason != "" {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(reason))
+			return 2
+		}
+		items := L.NewTable()
+		for _, stack := range stacks {
+			count := 0
+			if v, ok := items.RawGetString(stack.ItemID).(lua.LNumber); ok {
+				count = int(v)
+			}
+			items.RawSetString(stack.ItemID, lua.LNumber(count+stack.Count))
+		}
+		L.Push(items)
+		return 1
+	})
+
+	// Script API: refill_container(objectId) -> bool
+	// Closes a container and gives its loot back to every player at once
+	register("refill_container", func(L *lua.LState) int {
+		oid := int(L.CheckNumber(1))
+		if gs == nil || gs.containers == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.containers.Refill(gs, oid, dispatcher)))
+		return 1
+	})
+
+	// Script API: open_shop(playerId, objectId) -> true or false, reason
+	// Shows the player the shop of a vendor object
+	register("open_shop", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		oid := int(L.CheckNumber(2))
+
+		if gs == nil || gs.shops == nil {
+			L.Push(lua.LFalse)
+			L.Push(lua.LString(RejectInvalidTarget))
+			return 2
+		}
+		if reason := gs.shops.Open(gs, playerID, oid, dispatcher); reason != "" {
+			L.Push(lua.LFalse)
+			L.Push(lua.LString(reason))
+			return 2
+		}
+		L.Push(lua.LTrue)
+		return 1
+	})
+
+	// Script API: restock_shop(objectId) -> bool
+	// Restocks a vendor now, as its restock hours do
+	register("restock_shop", func(L *lua.LState) int {
+		oid := int(L.CheckNumber(1))
+		if gs == nil || gs.shops == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.shops.Restock(ctx, gs, oid)))
+		return 1
+	})
+
+	// Script API: get_item_count(playerId, itemId) -> count
+	register("get_item_count", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		itemID := L.CheckString(2)
+
+		if gs == nil || gs.inventoryManager == nil {
+			L.Push(lua.LNumber(0))
+			return 1
+		}
+		L.Push(lua.LNumber(gs.inventoryManager.Count(ctx, playerID, itemID)))
+		return 1
+	})
+
+	// Script API: spawn_npc(npcType, x, y) -> npcId (nil for unknown types)
+	register("spawn_npc", func(L *lua.LState) int {
+		npcType := L.CheckString(1)
+		x := float64(L.CheckNumber(2))
+		y := float64(L.CheckNumber(3))
+
+		if gs == nil || gs.npcManager == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		id := gs.npcManager.Spawn(gs, npcType, vector.Vector{X: x, Y: y}, nil)
+		if id == 0 {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(id))
+		return 1
+	})
+
+	// Script API: despawn_npc(npcId)
+	register("despawn_npc", func(L *lua.LState) int {
+		id := L.CheckInt(1)
+		if gs != nil && gs.npcManager != nil {
+			gs.npcManager.Despawn(gs, id)
+		}
+		return 0
+	})
+
+	// Script API: npc_move_to(npcId, x, y) -> bool. The NPC walks there before resuming its behavior
+	register("npc_move_to", func(L *lua.LState) int {
+		id := L.CheckInt(1)
+		x := float64(L.CheckNumber(2))
+		y := float64(L.CheckNumber(3))
+
+		if gs == nil || gs.npcManager == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.npcManager.SetGoal(id, vector.Vector{X: x, Y: y}, gs.currentTick)))
+		return 1
+	})
+
+	// Script API: get_npc(npcId) -> {id, type, x, y, health, maxHealth, state, target} or nil
+	register("get_npc", func(L *lua.LState) int {
+		id := L.CheckInt(1)
+		if gs == nil || gs.npcManager == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		npc, ok := gs.npcManager.Get(id)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		tbl := L.NewTable()
+		tbl.RawSetString("id", lua.LNumber(npc.ID))
+		tbl.RawSetString("type", lua.LString(npc.Def.ID))
+		tbl.RawSetString("x", lua.LNumber(npc.Body.Position.X))
+		tbl.RawSetString("y", lua.LNumber(npc.Body.Position.Y))
+		tbl.RawSetString("health", lua.LNumber(npc.Health))
+		tbl.RawSetString("maxHealth", lua.LNumber(npc.MaxHealth))
+		tbl.RawSetString("state", lua.LString(npc.State))
+		tbl.RawSetString("target", lua.LString(npc.Target))
+		L.Push(tbl)
+		return 1
+	})
+
+	// Script API: npc_say(npcId, text) -> bool. The NPC says the line to the players near it (npc_bark).
+	register("npc_say", func(L *lua.LState) int {
+		id := L.CheckInt(1)
+		text := L.CheckString(2)
+		if gs == nil || gs.npcManager == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.npcManager.Say(gs, id, text, dispatcher)))
+		return 1
+	})
+
+	// Script API: damage_npc(npcId, amount[, playerId[, damageType]]) -> remaining health (nil for unknown NPCs).
+	// Damage from a player makes the NPC fight them.
+	register("damage_npc", func(L *lua.LState) int {
+		id := L.CheckInt(1)
+		amount := float64(L.CheckNumber(2))
+		source := scriptDamageSource(L.OptString(3, ""))
+		damageType := L.OptString(4, DamagePhysical)
+
+		if gs == nil || gs.npcManager == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		health, ok := gs.npcManager.Damage(gs, id, source, amount, damageType, dispatcher)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(health))
+		return 1
+	})
+
+	// Script API: damage_player(playerId, amount[, damageType[, sourcePlayerId]]) -> damage taken after mitigation (nil for unknown players)
+	register("damage_player", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		amount := float64(L.CheckNumber(2))
+		damageType := L.OptString(3, DamagePhysical)
+		source := scriptDamageSource(L.OptString(4, ""))
+
+		if gs == nil || gs.PlayerBody(playerID) == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(gs.DamagePlayer(playerID, source, amount, damageType, dispatcher, se.logger)))
+		return 1
+	})
+
+	// Script API: heal_player(playerId, amount[, healerId]) -> health restored (nil for unknown or dead players).
+	// Healing draws threat to the healer (the healed player when omitted) from the NPCs fighting the healed player.
+	register("heal_player", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		amount := float64(L.CheckNumber(2))
+		healerID := L.OptString(3, playerID)
+
+		if gs == nil || gs.PlayerBody(playerID) == nil || gs.GetPlayerState(playerID).IsDead() {
+			L.Push(lua.LNil)
+			return 1
+		}
+		healed := gs.GetPlayerState(playerID).Heal(amount)
+		if gs.npcManager != nil {
+			gs.npcManager.HealThreat(gs, healerID, playerID, healed)
+		}
+		L.Push(lua.LNumber(healed))
+		return 1
+	})
+
+	// Script API: get_threat(npcId) -> list of {playerId, threat}, highest first (nil for unknown NPCs)
+	register("get_threat", func(L *lua.LState) int {
+		id := L.CheckInt(1)
+		if gs == nil || gs.npcManager == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		entries, ok := gs.npcManager.ThreatTable(id)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		tbl := L.NewTable()
+		for _, entry := range entries {
+			row := L.NewTable()
+			row.RawSetString("playerId", lua.LString(entry.PlayerID))
+			row.RawSetString("threat", lua.LNumber(entry.Threat))
+			tbl.Append(row)
+		}
+		L.Push(tbl)
+		return 1
+	})
+
+	// Script API: add_threat(npcId, playerId, amount) -> new threat (nil for unknown NPCs or players).
+	// Negative amounts lower threat (e.g. a fade ability); the amount isn't scaled by threat effects.
+	register("add_threat", func(L *lua.LState) int {
+		id := L.CheckInt(1)
+		playerID := L.CheckString(2)
+		amount := float64(L.CheckNumber(3))
+		if gs == nil || gs.npcManager == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		threat, ok := gs.npcManager.AddThreat(gs, id, playerID, amount)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(threat))
+		return 1
+	})
+
+	// Script API: taunt(npcId, playerId, seconds) -> bool. The NPC attacks the player until the taunt ends.
+	register("taunt", func(L *lua.LState) int {
+		id := L.CheckInt(1)
+		playerID := L.CheckString(2)
+		seconds := float64(L.CheckNumber(3))
+		if gs == nil || gs.npcManager == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.npcManager.Taunt(gs, id, playerID, seconds)))
+		return 1
+	})
+
+	// Script API: set_player_resistance(playerId, damageType, fraction) -> bool. fraction is capped at 0.9
+	register("set_player_resistance", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		damageType := L.CheckString(2)
+		fraction := float64(L.CheckNumber(3))
+
+		if gs == nil || gs.PlayerBody(playerID) == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		gs.GetPlayerState(playerID).SetResistance(damageType, fraction)
+		L.Push(lua.LTrue)
+		return 1
+	})
+
+	// Script API: add_damage_modifier(id, stage, {multiply, add, damageType, sourceType, sourceId,
+	// targetType, targetId, duration}) -> bool
+	// Changes the hits matching the filters at a damage pipeline stage until removed or for duration
+	// seconds; replaces the modifier with the same ID
+	register("add_damage_modifier", func(L *lua.LState) int {
+		id := L.CheckString(1)
+		stage := L.CheckString(2)
+		var opts struct {
+			Multiply   *float64 `json:"multiply"`
+			Add        float64  `json:"add"`
+			DamageType string   `json:"damageType"`
+			SourceType string   `json:"sourceType"`
+			SourceID   string   `json:"sourceId"`
+			TargetType string   `json:"targetType"`
+			TargetID   string   `json:"targetId"`
+			Duration   float64  `json:"duration"`
+		}
+		if tbl := L.OptTable(3, nil); tbl != nil {
+			if err := luaTableInto(tbl, &opts); err != nil {
+				L.ArgError(3, "invalid modifier table: "+err.Error())
+				return 0
+			}
+		}
+		if gs == nil || !validDamageStage(stage) {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		modifier := &DamageModifier{
+			ID:         id,
+			Stage:      stage,
+			Multiply:   1,
+			Add:        opts.Add,
+			DamageType: opts.DamageType,
+			SourceType: opts.SourceType,
+			SourceID:   opts.SourceID,
+			TargetType: opts.TargetType,
+			TargetID:   opts.TargetID,
+		}
+		if opts.Multiply != nil {
+			modifier.Multiply = max(0, *opts.Multiply)
+		}
+		if opts.Duration > 0 {
+			modifier.ExpiresTick = gs.currentTick + int64(opts.Duration*TickRate)
+		}
+		gs.damagePipeline.AddModifier(gs, modifier)
+		L.Push(lua.LTrue)
+		return 1
+	})
+
+	// Script API: remove_damage_modifier(id) -> bool
+	register("remove_damage_modifier", func(L *lua.LState) int {
+		id := L.CheckString(1)
+		L.Push(lua.LBool(gs != nil && gs.damagePipeline.RemoveModifier(id)))
+		return 1
+	})
+
+	// Script API: apply_effect(playerId, effectId[, durationSeconds[, sourcePlayerId]]) -> bool
+	register("apply_effect", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		effectID := L.CheckString(2)
+		duration := float64(L.OptNumber(3, 0))
+		source := scriptDamageSource(L.OptString(4, ""))
+
+		if gs == nil || gs.effectCatalog == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.ApplyEffect(playerID, effectID, source, duration)))
+		return 1
+	})
+
+	// Script API: remove_effect(playerId, effectId) -> bool (false if it wasn't active)
+	register("remove_effect", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		effectID := L.CheckString(2)
+		if gs == nil || gs.PlayerBody(playerID) == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.GetPlayerState(playerID).RemoveEffect(effectID)))
+		return 1
+	})
+
+	// Script API: get_effect_stacks(playerId, effectId) -> stacks (0 when not active)
+	register("get_effect_stacks", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		effectID := L.CheckString(2)
+		if gs == nil || gs.PlayerBody(playerID) == nil {
+			L.Push(lua.LNumber(0))
+			return 1
+		}
+		stacks := 0
+		if effect, ok := gs.GetPlayerState(playerID).Effects[effectID]; ok {
+			stacks = effect.Stacks
+		}
+		L.Push(lua.LNumber(stacks))
+		return 1
+	})
+
+	// Script API: get_world_time() -> {day, hour, minute, time, isDay}
+	register("get_world_time", func(L *lua.LState) int {
+		if gs == nil || gs.worldClock == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		snap := gs.worldClock.Snapshot()
+		tbl := L.NewTable()
+		tbl.RawSetString("day", lua.LNumber(snap.Day))
+		tbl.RawSetString("hour", lua.LNumber(snap.Hour))
+		tbl.RawSetString("minute", lua.LNumber(snap.Minute))
+		tbl.RawSetString("time", lua.LNumber(snap.Time))
+		tbl.RawSetString("isDay", lua.LBool(snap.IsDay))
+		L.Push(tbl)
+		return 1
+	})
+
+	// Script API: set_world_time(hour) - jumps the clock, firing sunrise/sunset if crossed
+	register("set_world_time", func(L *lua.LState) int {
+		hour := float64(L.CheckNumber(1))
+		if gs == nil || gs.worldClock == nil {
+			return 0
+		}
+		gs.worldClock.SetTime(gs, hour, dispatcher, se.logger)
+		return 0
+	})
+
+	// Script API: get_weather() -> state ("clear", "rain", "storm" or "fog")
+	register("get_weather", func(L *lua.LState) int {
+		if gs == nil || gs.weather == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LString(gs.weather.State))
+		return 1
+	})
+
+	// Script API: set_weather(state[, durationSeconds]) -> bool (false for unknown states)
+	register("set_weather", func(L *lua.LState) int {
+		state := L.CheckString(1)
+		duration := float64(L.OptNumber(2, 0))
+		if gs == nil || gs.weather == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.weather.Set(gs, state, duration, dispatcher, se.logger)))
+		return 1
+	})
+
+	// Script API: can_damage_player(attackerId, targetId) -> bool under the PvP rules
+	register("can_damage_player", func(L *lua.LState) int {
+		attackerID := L.CheckString(1)
+		targetID := L.CheckString(2)
+		L.Push(lua.LBool(gs != nil && gs.CanDamagePlayer(attackerID, targetID)))
+		return 1
+	})
+
+	// Script API: get_player_karma(playerId) -> karma (or nil)
+	register("get_player_karma", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		if gs == nil || gs.PlayerBody(playerID) == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(gs.GetPlayerState(playerID).Karma))
+		return 1
+	})
+
+	// Script API: get_reputation(playerId, factionId) -> standing, rank name, price modifier, hostile (nil for unknown factions)
+	register("get_reputation", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		factionID := L.CheckString(2)
+		if gs == nil || gs.reputation.factions[factionID] == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		rankName := ""
+		if rank := gs.reputation.Rank(playerID, factionID); rank != nil {
+			rankName = rank.Name
+		}
+		L.Push(lua.LNumber(gs.reputation.Standing(playerID, factionID)))
+		L.Push(lua.LString(rankName))
+		L.Push(lua.LNumber(gs.reputation.PriceModifier(playerID, factionID)))
+		L.Push(lua.LBool(gs.reputation.IsHostile(playerID, factionID)))
+		return 4
+	})
+
+	// Script API: price(sink, baseCost) -> what the sink charges for baseCost at the economy rates
+	register("price", func(L *lua.LState) int {
+		sink := L.CheckString(1)
+		base := int64(L.CheckNumber(2))
+		if gs == nil {
+			L.Push(lua.LNumber(base))
+			return 1
+		}
+		L.Push(lua.LNumber(gs.Price(sink, base)))
+		return 1
+	})
+
+	// Script API: charge_fee(playerId, sink, baseCost[, currency]) -> ok, charged. Prices baseCost
+	// by the sink's rate and takes it from the wallet (e.g. a smith's repair: sink "repair").
+	register("charge_fee", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		sink := L.CheckString(2)
+		base := int64(L.CheckNumber(3))
+		currency := L.OptString(4, defaultFeeCurrency)
+		if gs == nil {
+			L.Push(lua.LBool(false))
+			L.Push(lua.LNumber(0))
+			return 2
+		}
+		fee := gs.Price(sink, base)
+		if reason := gs.ChargeFee(ctx, playerID, sink, currency, fee); reason != "" {
+			L.Push(lua.LBool(false))
+			L.Push(lua.LNumber(0))
+			return 2
+		}
+		L.Push(lua.LBool(true))
+		L.Push(lua.LNumber(fee))
+		return 2
+	})
+
+	// Script API: modify_reputation(playerId, factionId, delta) -> new standing (nil for unknown
+	// factions, offline players or a failed save)
+	register("modify_reputation", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		factionID := L.CheckString(2)
+		delta := L.CheckInt(3)
+		if gs == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		standing, err := gs.reputation.Modify(ctx, gs, playerID, factionID, delta, dispatcher)
+		if err != nil {
+			se.logger.Warn("modify_reputation: %v", err)
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(standing))
+		return 1
+	})
+
+	// Script API: is_explored(playerId, x, y) -> whether the player explored the chunk at the world position
+	register("is_explored", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		x := float64(L.CheckNumber(2))
+		y := float64(L.CheckNumber(3))
+		L.Push(lua.LBool(gs != nil && gs.exploration.IsExplored(playerID, x, y)))
+		return 1
+	})
+
+	// Script API: get_exploration(playerId) -> explored chunks, total chunks of the map
+	register("get_exploration", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		if gs == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		explored, total := gs.exploration.Progress(playerID)
+		L.Push(lua.LNumber(explored))
+		L.Push(lua.LNumber(total))
+		return 2
+	})
+
+	// Script API: get_player_region(playerId) -> region ID (nil outside regions or for unknown players)
+	register("get_player_region", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		if gs == nil || gs.playerStates[playerID] == nil || gs.playerStates[playerID].Region == "" {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LString(gs.playerStates[playerID].Region))
+		return 1
+	})
+
+	// Script API: get_object_owner(objectId) -> owner user ID (nil for unowned objects)
+	register("get_object_owner", func(L *lua.LState) int {
+		oid := int(L.CheckNumber(1))
+		if gs == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		if ownership := gs.ObjectOwnership(oid); ownership != nil {
+			L.Push(lua.LString(ownership.Owner))
+			return 1
+		}
+		L.Push(lua.LNil)
+		return 1
+	})
+
+	// Script API: can_affect_object(playerId, objectId, action) -> whether the object's ownership
+	// lets the player move, damage or remove it
+	register("can_affect_object", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		oid := int(L.CheckNumber(2))
+		action := L.CheckString(3)
+		L.Push(lua.LBool(gs != nil && gs.CanAffectObject(playerID, oid, action)))
+		return 1
+	})
+
+	// Script API: cutscene_focus(playerId, spec) -> whether the directive was sent. spec is a table
+	// with the focus (objectId, npcId, playerId, or x and y to pan to a point) and pan, zoom,
+	// duration (seconds) and lockInput (default true).
+	register("cutscene_focus", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		spec := &CutsceneSpec{}
+		if err := luaTableInto(L.CheckTable(2), spec); err != nil {
+			L.ArgError(2, "invalid cutscene table: "+err.Error())
+			return 0
+		}
+		L.Push(lua.LBool(gs != nil && gs.StartCutscene(playerID, spec, dispatcher, se.logger)))
+		return 1
+	})
+
+	// Script API: cutscene_release(playerId) -> whether a cutscene was running
+	register("cutscene_release", func(L *lua.LState) int {
+		playerID := L.CheckString(1)
+		L.Push(lua.LBool(gs != nil && gs.EndCutscene(playerID, "released", dispatcher, se.logger)))
+		return 1
+	})
+
+	// Script API: complete_dungeon() -> whether the dungeon instance was running and is now completed
+	register("complete_dungeon", func(L *lua.LState) int {
+		L.Push(lua.LBool(gs != nil && gs.dungeon != nil && gs.dungeon.Complete(ctx, gs, dispatcher)))
+		return 1
+	})
+
+	// Script API: spawn_projectile(spec, x, y, targetX, targetY[, ownerPlayerId[, ownerNpcId]]) -> projectileId
+	// (nil if not launched). spec is an ability ID with a projectile or a table of projectile fields
+	// (speed, radius, maxRange, gravity, pierce, bounces, damage, damageType, effects, friendlyFire, script).
+	// The owner is credited with the damage and decides whom the projectile may hit.
+	register("spawn_projectile", func(L *lua.LState) int {
+		from := vector.Vector{X: float64(L.CheckNumber(2)), Y: float64(L.CheckNumber(3))}
+		to := vector.Vector{X: float64(L.CheckNumber(4)), Y: float64(L.CheckNumber(5))}
+		owner := scriptDamageSource(L.OptString(6, ""))
+		if npcID := L.OptInt(7, 0); npcID != 0 {
+			owner = npcDamageSource(npcID)
+		}
+		if gs == nil || gs.projectiles == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+
+		var spec *ProjectileSpec
+		abilityID := ""
+		switch arg := L.CheckAny(1).(type) {
+		case lua.LString:
+			def, ok := gs.abilityCatalog.Get(string(arg))
+			if !ok || def.Projectile == nil {
+				L.Push(lua.LNil)
+				return 1
+			}
+			spec, abilityID = def.Projectile, def.ID
+		case *lua.LTable:
+			spec = &ProjectileSpec{}
+			if err := luaTableInto(arg, spec); err != nil {
+				L.ArgError(1, "invalid projectile table: "+err.Error())
+				return 0
+			}
+			spec.normalize()
+		default:
+			L.ArgError(1, "ability ID or projectile table expected")
+			return 0
+		}
+
+		id := gs.projectiles.Launch(gs, spec, owner, abilityID, from, to, dispatcher)
+		if id == 0 {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(id))
+		return 1
+	})
+
+	// Script API: get_entity_position_at(entityId, ticksAgo) -> x, y (nil for entities not in the
+	// match). entityId is a player's user ID or an NPC ID; ticksAgo is clamped to the position
+	// history (one second).
+	register("get_entity_position_at", func(L *lua.LState) int {
+		entityID := L.CheckString(1)
+		ticksAgo := int64(L.CheckInt(2))
+		if gs == nil || gs.positionHistory == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		position, ok := gs.EntityPositionAt(entityID, ticksAgo)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(position.X))
+		L.Push(lua.LNumber(position.Y))
+		return 2
+	})
+
+	// Script API: resolve_aoe(spec, x, y[, direction[, ownerPlayerId[, ownerNpcId]]]) -> { {targetType, targetId, damage, killed}, ... }
+	// (nil for an ability without an aoe).
+	// spec is an ability ID with an aoe or a table of area fields (shape, radius, angle, length, width,
+	// damage, damageType, falloff, effects, maxTargets, friendlyFire). direction is in radians.
+	register("resolve_aoe", func(L *lua.LState) int {
+		origin := vector.Vector{X: float64(L.CheckNumber(2)), Y: float64(L.CheckNumber(3))}
+		direction := float64(L.OptNumber(4, 0))
+		owner := scriptDamageSource(L.OptString(5, ""))
+		if npcID := L.OptInt(6, 0); npcID != 0 {
+			owner = npcDamageSource(npcID)
+		}
+		if gs == nil {
+			L.Push(L.NewTable())
+			return 1
+		}
+
+		var spec *AoESpec
+		abilityID := ""
+		switch arg := L.CheckAny(1).(type) {
+		case lua.LString:
+			def, ok := gs.abilityCatalog.Get(string(arg))
+			if !ok || def.AoE == nil {
+				L.Push(lua.LNil)
+				return 1
+			}
+			spec, abilityID = def.AoE, def.ID
+		case *lua.LTable:
+			spec = &AoESpec{}
+			if err := luaTableInto(arg, spec); err != nil {
+				L.ArgError(1, "invalid aoe table: "+err.Error())
+				return 0
+			}
+			spec.normalize()
+		default:
+			L.ArgError(1, "ability ID or aoe table expected")
+			return 0
+		}
+
+		result := gs.ResolveAoE(spec, owner, abilityID, origin, direction, gs.currentTick, dispatcher, se.logger)
+		hits := L.NewTable()
+		for _, hit := range result.Hits {
+			entry := L.NewTable()
+			entry.RawSetString("targetType", lua.LString(hit.TargetType))
+			entry.RawSetString("targetId", lua.LString(hit.TargetID))
+			entry.RawSetString("damage", lua.LNumber(hit.Damage))
+			entry.RawSetString("killed", lua.LBool(hit.Killed))
+			hits.Append(entry)
+		}
+		L.Push(hits)
+		return 1
+	})
+
+	// Script API: make_noise(kind, x, y, radius[, playerId]) -- a noise players in radius hear and NPCs
+	// investigate (door slams, alarms, ...); playerId is its maker, who isn't sent it
+	register("make_noise", func(L *lua.LState) int {
+		kind := L.CheckString(1)
+		position := vector.Vector{X: float64(L.CheckNumber(2)), Y: float64(L.CheckNumber(3))}
+		radius := float64(L.CheckNumber(4))
+		source := L.OptString(5, "")
+		if gs != nil {
+			gs.MakeNoise(kind, position, radius, source, dispatcher, se.logger)
+		}
+		return 0
+	})
+
+	// Script API: set_door(objectId, open) -> bool (false if it isn't a door or someone blocks the doorway)
+	// Opens or closes a door regardless of its lock.
+	register("set_door", func(L *lua.LState) int {
+		oid := L.CheckInt(1)
+		open := L.CheckBool(2)
+		if gs == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.doors.SetOpen(gs, oid, open, "", dispatcher, se.logger) == ""))
+		return 1
+	})
+
+	// Script API: lock_door(objectId, locked) -> bool (false if it isn't a door)
+	register("lock_door", func(L *lua.LState) int {
+		oid := L.CheckInt(1)
+		locked := L.CheckBool(2)
+		if gs == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.doors.SetLocked(gs, oid, locked, dispatcher, se.logger)))
+		return 1
+	})
+
+	// Script API: set_mechanism(objectId, active) -> bool (false if it isn't a lever or pressure plate)
+	// Targets follow as if a player had pulled the lever.
+	register("set_mechanism", func(L *lua.LState) int {
+		oid := L.CheckInt(1)
+		active := L.CheckBool(2)
+		if gs == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.mechanisms.Set(gs, oid, active, "", dispatcher, se.logger)))
+		return 1
+	})
+
+	// Script API: start_world_event(id) -> bool (false if unknown or already running)
+	register("start_world_event", func(L *lua.LState) int {
+		id := L.CheckString(1)
+		if gs == nil || gs.worldEvents == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		err := gs.worldEvents.Start(gs, id, dispatcher)
+		if err != nil {
+			se.logger.Warn("start_world_event: %v", err)
+		}
+		L.Push(lua.LBool(err == nil))
+		return 1
+	})
+
+	// Script API: end_world_event(id[, completed]) -> bool - ends a running event; participants are
+	// rewarded only when completed is true
+	register("end_world_event", func(L *lua.LState) int {
+		id := L.CheckString(1)
+		result := WorldEventCancelled
+		if L.OptBool(2, false) {
+			result = WorldEventCompleted
+		}
+		if gs == nil || gs.worldEvents == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.worldEvents.End(ctx, gs, id, result, dispatcher)))
+		return 1
+	})
+
+	// Script API: is_world_event_active(id) -> bool
+	register("is_world_event_active", func(L *lua.LState) int {
+		id := L.CheckString(1)
+		L.Push(lua.LBool(gs != nil && gs.worldEvents != nil && gs.worldEvents.IsActive(id)))
+		return 1
+	})
+
+	// Script API: start_encounter(area) -> bool (false if unknown, running or cooling down)
+	register("start_encounter", func(L *lua.LState) int {
+		area := L.CheckString(1)
+		L.Push(lua.LBool(gs != nil && gs.encounters != nil && gs.encounters.Start(ctx, gs, area, dispatcher)))
+		return 1
+	})
+
+	// Script API: stop_encounter(area) -> bool - fails a running encounter and removes its NPCs
+	register("stop_encounter", func(L *lua.LState) int {
+		area := L.CheckString(1)
+		L.Push(lua.LBool(gs != nil && gs.encounters != nil && gs.encounters.Stop(ctx, gs, area, dispatcher)))
+		return 1
+	})
+
+	// Script API: get_encounter(area) -> {encounter, state, wave, waves, npcs} or nil
+	register("get_encounter", func(L *lua.LState) int {
+		area := L.CheckString(1)
+		if gs == nil || gs.encounters == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		encounter, ok := gs.encounters.Get(area)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		npcs := L.NewTable()
+		for _, npcID := range encounter.NPCs {
+			npcs.Append(lua.LNumber(npcID))
+		}
+		t := L.NewTable()
+		t.RawSetString("encounter", lua.LString(encounter.Def.ID))
+		t.RawSetString("state", lua.LString(encounter.State))
+		t.RawSetString("wave", lua.LNumber(encounter.Wave))
+		t.RawSetString("waves", lua.LNumber(len(encounter.Def.Waves)))
+		t.RawSetString("npcs", npcs)
+		L.Push(t)
+		return 1
+	})
+
+	// Script API: is_live_ops_active(id) -> bool
+	register("is_live_ops_active", func(L *lua.LState) int {
+		id := L.CheckString(1)
+		L.Push(lua.LBool(gs != nil && gs.liveOps != nil && gs.liveOps.IsActive(id)))
+		return 1
+	})
+
+	// Script API: get_xp_multiplier() -> number - product of the running live-ops events' multipliers
+	register("get_xp_multiplier", func(L *lua.LState) int {
+		multiplier := 1.0
+		if gs != nil && gs.liveOps != nil {
+			multiplier = gs.liveOps.XPMultiplier()
+		}
+		L.Push(lua.LNumber(multiplier))
+		return 1
+	})
+
+	// Script API: subscribe_event(event, scriptPath[, objectId]) - run scriptPath whenever the event fires
+	register("subscribe_event", func(L *lua.LState) int {
+		name := L.CheckString(1)
+		scriptPath := L.CheckString(2)
+		oid := L.OptInt(3, 0)
+		if gs == nil || gs.eventBus == nil {
+			return 0
+		}
+		gs.eventBus.SubscribeScript(name, scriptPath, oid)
+		return 0
+	})
+
+	// Script API: unsubscribe_event(event, scriptPath[, objectId]) -> bool
+	register("unsubscribe_event", func(L *lua.LState) int {
+		name := L.CheckString(1)
+		scriptPath := L.CheckString(2)
+		oid := L.OptInt(3, 0)
+		if gs == nil || gs.eventBus == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.eventBus.UnsubscribeScript(name, scriptPath, oid)))
+		return 1
+	})
+
+	// Script API: publish_event(event[, data]) - delivered to subscribers on the next tick
+	register("publish_event", func(L *lua.LState) int {
+		name := L.CheckString(1)
+		data := map[string]any{}
+		if tbl, ok := L.Get(2).(*lua.LTable); ok {
+			if m, ok := luaTableToGo(tbl).(map[string]any); ok {
+				data = m
+			}
+		}
+		if gs == nil || gs.eventBus == nil {
+			return 0
+		}
+		gs.eventBus.Publish(name, data)
+		return 0
+	})
+
+	// Script API: find_path(x1, y1, x2, y2) -> {{x, y}, ...} waypoints ending at the goal, or nil if unreachable
+	register("find_path", func(L *lua.LState) int {
+		from := vector.Vector{X: float64(L.CheckNumber(1)), Y: float64(L.CheckNumber(2))}
+		to := vector.Vector{X: float64(L.CheckNumber(3)), Y: float64(L.CheckNumber(4))}
+
+		if gs == nil || gs.pathfinder == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		path, ok := gs.pathfinder.PathFind(gs, from, to)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		tbl := L.NewTable()
+		for _, p := range path {
+			point := L.NewTable()
+			point.RawSetString("x", lua.LNumber(p.X))
+			point.RawSetString("y", lua.LNumber(p.Y))
+			tbl.Append(point)
+		}
+		L.Push(tbl)
+		return 1
+	})
+
+	// Script API: set_object_gid(objectId, gid)
+	register("set_object_gid", func(L *lua.LState) int {
+		oid := int(L.CheckNumber(1))
+		gid := uint32(L.CheckNumber(2))
+
+		if gs == nil {
+			return 0
+		}
+
+		// Update GID under lock to avoid races with other state mutations
+		gs.mu.Lock()
+		obj, ok := gs.Object(oid)
+		if !ok {
+			gs.mu.Unlock()
+			return 0
+		}
+		obj.GID = gid
+		gs.mu.Unlock()
+
+		// Rebuild colliders from the map's tile collision templates for the new gid
+		gs.RebuildObjectColliders(oid, se.logger)
+
+		// Clients get the new gid with the other object changes at the end of the tick
+		gs.BroadcastObjectUpdate(oid, dispatcher, se.logger)
+
+		return 0
+	})
+
+	// Script API: add_object_collider(objectId, colliderTable)
+	register("add_object_collider", func(L *lua.LState) int {
+		oid := int(L.CheckNumber(1))
+		tbl := L.CheckTable(2)
+
+		if gs == nil {
+			return 0
+		}
+		if _, ok := gs.Object(oid); !ok {
+			return 0
+		}
+
+		shape := L.GetField(tbl, "shape")
+		var rb rigidbody.RigidBody
+		SetStatic(&rb)
+
+		if shapeStr, ok := shape.(lua.LString); ok {
+			switch string(shapeStr) {
+			case "rectangle":
+				rb.Shape = "rectangle"
+				rb.Width = float64(L.GetField(tbl, "width").(lua.LNumber))
+				rb.Height = float64(L.GetField(tbl, "height").(lua.LNumber))
+				rb.Position.X = float64(L.GetField(tbl, "x").(lua.LNumber))
+				rb.Position.Y = float64(L.GetField(tbl, "y").(lua.LNumber))
+				// add collider via helper (empty polygonPoints)
+				gs.AddOwnerCollider(oid, &rb, nil)
+			case "circle":
+				rb.Shape = "circle"
+				rb.Radius = float64(L.GetField(tbl, "radius").(lua.LNumber))
+				rb.Position.X = float64(L.GetField(tbl, "x").(lua.LNumber))
+				rb.Position.Y = float64(L.GetField(tbl, "y").(lua.LNumber))
+				// add collider via helper (empty polygonPoints)
+				gs.AddOwnerCollider(oid, &rb, nil)
+			case "polygon":
+				polyTbl := L.GetField(tbl, "polygon")
+				if ptbl, ok := polyTbl.(*lua.LTable); ok {
+					points := make([]vector.Vector, 0)
+					ptbl.ForEach(func(key, val lua.LValue) {
+						if vtbl, ok := val.(*lua.LTable); ok {
+							x := float64(L.GetField(vtbl, "x").(lua.LNumber))
+							y := float64(L.GetField(vtbl, "y").(lua.LNumber))
+							points = append(points, vector.Vector{X: x, Y: y})
+						}
+					})
+					poly := polygon.NewPolygon(points, 0, false)
+					poly.RigidBody.IsMovable = false
+					poly.RigidBody.Shape = "polygon"
+
+					// add collider via helper (handles ownership and physics registration)
+					gs.AddOwnerCollider(oid, &poly.RigidBody, points)
+				}
+			}
+		}
+		return 0
+	})
+
+	// Script API: remove_object_colliders(objectId)
+	register("remove_object_colliders", func(L *lua.LState) int {
+		oid := int(L.CheckNumber(1))
+		if gs == nil {
+			return 0
+		}
+
+		// delegate to GameMatchState helper (handles locking and cleanup)
+		gs.RemoveOwnerColliders(oid)
+
+		return 0
+	})
+
+	// Script API: set_object_collision(objectId, {ignoreOwner = true, ignore = {"object/12", ...}})
+	// Which bodies the object's colliders let through; nil resets to colliding with everything
+	register("set_object_collision", func(L *lua.LState) int {
+		oid := int(L.CheckNumber(1))
+		tbl := L.OptTable(2, nil)
+		if gs == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		var collision *ObjectCollision
+		if tbl != nil {
+			collision = &ObjectCollision{IgnoreOwner: lua.LVAsBool(tbl.RawGetString("ignoreOwner"))}
+			if ignore, ok := tbl.RawGetString("ignore").(*lua.LTable); ok {
+				ignore.ForEach(func(_, group lua.LValue) {
+					if s, ok := group.(lua.LString); ok && s != "" {
+						collision.Ignore = append(collision.Ignore, string(s))
+					}
+				})
+			}
+		}
+		L.Push(lua.LBool(gs.SetObjectCollision(oid, collision)))
+		return 1
+	})
+
+	// Script API: set_body_physics(entityId, {frozen = true, noclip = false, gravityScale = 0.5})
+	// -> whether the entity has a body. entityId is a player's user ID or an NPC ID; missing fields
+	// keep their value.
+	register("set_body_physics", func(L *lua.LState) int {
+		entityID := L.CheckString(1)
+		tbl := L.CheckTable(2)
+		if gs == nil || gs.physicsEngine == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		rb := gs.EntityBody(entityID)
+		if rb == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		if v := tbl.RawGetString("frozen"); v != lua.LNil {
+			gs.physicsEngine.SetFrozen(rb, lua.LVAsBool(v))
+		}
+		if v := tbl.RawGetString("noclip"); v != lua.LNil {
+			gs.physicsEngine.SetNoClip(rb, lua.LVAsBool(v))
+		}
+		if v, ok := tbl.RawGetString("gravityScale").(lua.LNumber); ok {
+			gs.physicsEngine.SetGravityScale(rb, float64(v))
+		}
+		L.Push(lua.LTrue)
+		return 1
+	})
+
+	// Script API: get_body_physics(entityId) -> {frozen, noclip, gravityScale} (nil without a body)
+	register("get_body_physics", func(L *lua.LState) int {
+		entityID := L.CheckString(1)
+		if gs == nil || gs.physicsEngine == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		rb := gs.EntityBody(entityID)
+		if rb == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		physics := gs.physicsEngine.BodyPhysics(rb)
+		tbl := L.NewTable()
+		tbl.RawSetString("frozen", lua.LBool(physics.Frozen))
+		tbl.RawSetString("noclip", lua.LBool(physics.NoClip))
+		tbl.RawSetString("gravityScale", lua.LNumber(physics.GravityScale))
+		L.Push(tbl)
+		return 1
+	})
+
+	// Script API: attach(kind, id, parentId[, offsetX, offsetY]) -> bool. kind is "object",
+	// "light" or "entity" (a player's user ID or an NPC ID); parentId is the player or NPC the
+	// child follows at the offset from its center.
+	register("attach", func(L *lua.LState) int {
+		kind := L.CheckString(1)
+		id := L.ToString(2)
+		parent := L.ToString(3)
+		offset := vector.Vector{X: float64(L.OptNumber(4, 0)), Y: float64(L.OptNumber(5, 0))}
+		if gs == nil || id == "" || parent == "" {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.attachments.Attach(gs, kind, id, parent, offset, dispatcher, se.logger)))
+		return 1
+	})
+
+	// Script API: detach(kind, id) -> whether it was attached. An object stays where it is.
+	register("detach", func(L *lua.LState) int {
+		kind := L.CheckString(1)
+		id := L.ToString(2)
+		if gs == nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		L.Push(lua.LBool(gs.attachments.Detach(gs, kind, id, dispatcher, se.logger)))
+		return 1
+	})
+
+	// Script API: get_attachment(kind, id) -> {parent, offsetX, offsetY} (nil when not attached)
+	register("get_attachment", func(L *lua.LState) int {
+		kind := L.CheckString(1)
+		id := L.ToString(2)
+		if gs == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		a, ok := gs.attachments.Get(kind, id)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		tbl := L.NewTable()
+		tbl.RawSetString("parent", lua.LString(a.Parent))
+		tbl.RawSetString("offsetX", lua.LNumber(a.Offset.X))
+		tbl.RawSetString("offsetY", lua.LNumber(a.Offset.Y))
+		L.Push(tbl)
+		return 1
+	})
+
+	ctxTbl := L.NewTable()
+	for k, v := range params {
+		// Use generic converter for all supported types (including maps/slices)
+		L.SetField(ctxTbl, k, se.toLValue(L, v))
+	}
+	L.SetGlobal("ctx", ctxTbl)
+
+	// Storage-backed versions published through the script manifest take precedence over disk
+	if stored, ok := se.storedScript(scriptPath); ok {
+		if err := L.DoString(stored.Source); err != nil {
+			se.logger.Error("Error executing stored script %s@%s: %v", scriptPath, stored.Version, err)
+			return effects, err
+		}
+		return effects, nil
+	}
+
+	abs := filepath.Join(se.baseDir, scriptPath)
+	if _, err := os.Stat(abs); err != nil {
+		se.logger.Error("Script file not found: %s", scriptPath)
+		return effects, err
+	}
+
+	if err := L.DoFile(abs); err != nil {
+		se.logger.Error("Error executing script %s: %v", scriptPath, err)
+		return effects, err
+	}
+
+	return effects, nil
+}
+
+// recordExecution updates per-script statistics and reports them to Nakama metrics
+func (se *ScriptEngine) recordExecution(scriptPath string, elapsed time.Duration, err error) {
+	se.statsMu.Lock()
+	st, ok := se.stats[scriptPath]
+	if !ok {
+		st = &ScriptStats{}
+		se.stats[scriptPath] = st
+	}
+	st.Invocations++
+	st.TotalDuration += elapsed
+	se.pendingTime += elapsed
+	if elapsed > st.MaxDuration {
+		st.MaxDuration = elapsed
+	}
+	if err != nil {
+		st.Errors++
+	}
+	se.statsMu.Unlock()
+
+	if elapsed > slowScriptThreshold {
+		se.logger.Warn("Slow script %s took %v", scriptPath, elapsed)
+	}
+
+	if se.nk != nil {
+		tags := map[string]string{"script": scriptPath}
+		se.nk.MetricsTimerRecord("script_execution_time", tags, elapsed)
+		se.nk.MetricsCounterAdd("script_invocations", tags, 1)
+		if err != nil {
+			se.nk.MetricsCounterAdd("script_errors", tags, 1)
+		}
+	}
+}
+
+// TakeExecutionTime returns the time spent running scripts since the last call
+func (se *ScriptEngine) TakeExecutionTime() time.Duration {
+	se.statsMu.Lock()
+	defer se.statsMu.Unlock()
+	elapsed := se.pendingTime
+	se.pendingTime = 0
+	return elapsed
+}
+
+// StatsReport returns per-script statistics sorted by total execution time (hottest first)
+func (se *ScriptEngine) StatsReport() []ScriptStatsReport {
+	se.statsMu.Lock()
+	defer se.statsMu.Unlock()
+
+	report := make([]ScriptStatsReport, 0, len(se.stats))
+	for path, st := range se.stats {
+		r := ScriptStatsReport{
+			Script:      path,
+			Invocations: st.Invocations,
+			Errors:      st.Errors,
+			MaxMillis:   float64(st.MaxDuration) / float64(time.Millisecond),
+			TotalMillis: float64(st.TotalDuration) / float64(time.Millisecond),
+		}
+		if st.Invocations > 0 {
+			r.ErrorRate = float64(st.Errors) / float64(st.Invocations)
+			r.AvgMillis = r.TotalMillis / float64(st.Invocations)
+		}
+		report = append(report, r)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].TotalMillis != report[j].TotalMillis {
+			return report[i].TotalMillis > report[j].TotalMillis
+		}
+		return report[i].Script < report[j].Script
+	})
+	return report
+}
+
+// ResetStats clears all collected script statistics
+func (se *ScriptEngine) ResetStats() {
+	se.statsMu.Lock()
+	defer se.statsMu.Unlock()
+	se.stats = make(map[string]*ScriptStats)
+}
+
+// luaTableToGo converts a lua table back to Go types (array-like tables become slices)
+func luaTableToGo(tbl *lua.LTable) any {
+	// detect if array-like
+	maxIdx := 0
+	isArray := true
+	tbl.ForEach(func(k, v lua.LValue) {
+		if keyNum, ok := k.(lua.LNumber); ok {
+			if int(keyNum) > maxIdx {
+				maxIdx = int(keyNum)
+			}
+		} else {
+			isArray = false
+		}
+	})
+	if isArray && maxIdx > 0 {
+		arr := make([]any, 0, maxIdx)
+		for i := 1; i <= maxIdx; i++ {
+			arr = append(arr, luaValueToGo(tbl.RawGetInt(i)))
+		}
+		return arr
+	}
+
+	m := make(map[string]any)
+	tbl.ForEach(func(k, v lua.LValue) {
+		m[k.String()] = luaValueToGo(v)
+	})
+	return m
+}
+
+// luaTableInto decodes a lua table into a Go struct through its JSON field names
+func luaTableInto(tbl *lua.LTable, out any) error {
+	raw, err := json.Marshal(luaTableToGo(tbl))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// luaValueToGo converts a single lua value to its Go counterpart
+func luaValueToGo(val lua.LValue) any {
+	switch val.Type() {
+	case lua.LTNil:
+		return nil
+	case lua.LTBool:
+		return lua.LVAsBool(val)
+	case lua.LTNumber:
+		return float64(lua.LVAsNumber(val))
+	case lua.LTString:
+		return string(lua.LVAsString(val))
+	case lua.LTTable:
+		return luaTableToGo(val.(*lua.LTable))
+	default:
+		return val.String()
+	}
+}
+
+// toLValue converts Go values (including nested maps/slices) to lua.LValue
+func (se *ScriptEngine) toLValue(L *lua.LState, v any) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LNil
+	case string:
+		return lua.LString(v)
+	case bool:
+		return lua.LBool(v)
+	case float32:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case int32:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case uint:
+		return lua.LNumber(v)
+	case uint32:
+		return lua.LNumber(v)
+	case uint64:
+		return lua.LNumber(v)
+	case map[string]interface{}:
+		tbl := L.NewTable()
+		for kk, vv := range v {
+			tbl.RawSetString(kk, se.toLValue(L, vv))
+		}
+		return tbl
+	case []interface{}:
+		tbl := L.NewTable()
+		for i, vv := range v {
+			tbl.RawSetInt(i+1, se.toLValue(L, vv))
+		}
+		return tbl
+	default:
+		// Fallback: try to stringify
+		se.logger.Debug("script: converting unknown param type to string: %T", v)
+		return lua.LString(fmt.Sprintf("%v", v))
+	}
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// StoredScript is a script version uploaded to Nakama storage. Stored scripts let live-ops
+// push hotfixes without redeploying the container that mounts /nakama/data/scripts.
+type StoredScript struct {
+	Name       string    `json:"name"` // script path as referenced by an object's "script" property
+	Version    string    `json:"version"`
+	Source     string    `json:"source"`
+	Checksum   string    `json:"checksum"`
+	UploadedAt time.Time `json:"uploadedAt"`
+	UploadedBy string    `json:"uploadedBy,omitempty"`
+}
+
+// ScriptManifest maps script names to the stored version active for a map.
+// Scripts missing from the manifest keep loading from disk.
+type ScriptManifest struct {
+	Map       string            `json:"map"`
+	Scripts   map[string]string `json:"scripts"` // script name -> version
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// storedScriptKey builds the storage key for a script version
+func storedScriptKey(name, version string) string {
+	return name + "@" + version
+}
+
+// scriptChecksum returns the hex sha256 of a script source
+func scriptChecksum(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadManifest replaces the storage-backed script overrides with those published for mapName
+func (se *ScriptEngine) LoadManifest(ctx context.Context, dm *DatabaseManager, mapName string) error {
+	manifest, err := dm.LoadScriptManifest(ctx, mapName)
+	if err != nil {
+		return err
+	}
+
+	overrides := make(map[string]*StoredScript)
+	if manifest != nil {
+		scripts, err := dm.LoadStoredScripts(ctx, manifest.Scripts)
+		if err != nil {
+			return err
+		}
+		for name, version := range manifest.Scripts {
+			script, ok := scripts[name]
+			if !ok || script.Version != version {
+				se.logger.Warn("Script manifest for %s references missing script %s@%s; using disk copy", mapName, name, version)
+				continue
+			}
+			if script.Checksum != "" && script.Checksum != scriptChecksum(script.Source) {
+				se.logger.Error("Stored script %s@%s failed checksum verification; using disk copy", name, version)
+				continue
+			}
+			overrides[name] = script
+		}
+	}
+
+	se.overridesMu.Lock()
+	se.overrides = overrides
+	se.overridesMu.Unlock()
+
+	se.logger.Info("Loaded %d storage script overrides for map %s", len(overrides), mapName)
+	return nil
+}
+
+// storedScript returns the storage override for a script path, if one is active
+func (se *ScriptEngine) storedScript(scriptPath string) (*StoredScript, bool) {
+	se.overridesMu.RLock()
+	defer se.overridesMu.RUnlock()
+	script, ok := se.overrides[scriptPath]
+	return script, ok
+}
+
+// ActiveScriptVersions returns the active override version for each overridden script
+func (se *ScriptEngine) ActiveScriptVersions() map[string]string {
+	se.overridesMu.RLock()
+	defer se.overridesMu.RUnlock()
+	versions := make(map[string]string, len(se.overrides))
+	for name, script := range se.overrides {
+		versions[name] = script.Version
+	}
+	return versions
+}
+
+// rpcScriptUpload stores a script version. The source is syntax-checked before it is accepted.
+// Payload: {"name": "chests/chest.lua", "version": "3", "source": "..."}
+func rpcScriptUpload(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Source  string `json:"source"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil {
+		return "", errInvalidPayload
+	}
+	if req.Name == "" || req.Version == "" || req.Source == "" || strings.Contains(req.Version, "@") {
+		return "", errInvalidPayload
+	}
+
+	// Reject scripts that don't parse so a typo can't break every interaction with the object
+	chunk, err := parse.Parse(strings.NewReader(req.Source), req.Name)
+	if err == nil {
+		_, err = lua.Compile(chunk, req.Name)
+	}
+	if err != nil {
+		return "", runtime.NewError("script does not compile: "+err.Error(), rpcCodeInvalidArgument)
+	}
+
+	uploadedBy, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	script := &StoredScript{
+		Name:       req.Name,
+		Version:    req.Version,
+		Source:     req.Source,
+		Checksum:   scriptChecksum(req.Source),
+		UploadedAt: time.Now(),
+		UploadedBy: uploadedBy,
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	if err := dm.SaveStoredScript(ctx, script); err != nil {
+		return "", errInternalFailure
+	}
+
+	out, _ := json.Marshal(map[string]string{"name": script.Name, "version": script.Version, "checksum": script.Checksum})
+	return string(out), nil
+}
+
+// rpcScriptManifestSet publishes script versions for a map and tells running matches to reload.
+// Payload: {"map": "elderford/world.json", "scripts": {"chests/chest.lua": "3"}, "merge": true}
+// With merge=true the given entries are added to the existing manifest; an empty version removes an entry.
+func rpcScriptManifestSet(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		Map     string            `json:"map"`
+		Scripts map[string]string `json:"scripts"`
+		Merge   bool              `json:"merge"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.Map == "" {
+		return "", errInvalidPayload
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	manifest := &ScriptManifest{Map: req.Map, Scripts: map[string]string{}}
+	if req.Merge {
+		existing, err := dm.LoadScriptManifest(ctx, req.Map)
+		if err != nil {
+			return "", errInternalFailure
+		}
+		if existing != nil {
+			for name, version := range existing.Scripts {
+				manifest.Scripts[name] = version
+			}
+		}
+	}
+	for name, version := range req.Scripts {
+		if version == "" {
+			delete(manifest.Scripts, name)
+			continue
+		}
+		manifest.Scripts[name] = version
+	}
+
+	// Every referenced version must exist before the manifest goes live
+	stored, err := dm.LoadStoredScripts(ctx, manifest.Scripts)
+	if err != nil {
+		return "", errInternalFailure
+	}
+	for name, version := range manifest.Scripts {
+		if _, ok := stored[name]; !ok {
+			return "", runtime.NewError("unknown script version "+storedScriptKey(name, version), rpcCodeFailedPrecondition)
+		}
+	}
+
+	manifest.UpdatedAt = time.Now()
+	if err := dm.SaveScriptManifest(ctx, manifest); err != nil {
+		return "", errInternalFailure
+	}
+
+	responses, err := signalMatches(ctx, logger, nk, "", MatchSignalRequest{Type: SignalReloadScripts})
+	if err != nil {
+		return "", err
+	}
+
+	out, _ := json.Marshal(map[string]interface{}{"manifest": manifest, "matches": responses})
+	return string(out), nil
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Sharding tuning. The map property "shardCapacity" overrides the capacity.
+const (
+	defaultShardCapacity = 100
+	shardSplitRatio      = 0.8 // a new shard starts once every shard of the map is this full
+	shardIdleTicks       = 5 * 60 * TickRate
+	maxShardsListed      = 100
+	defaultWorldMap      = "elderford/world.json"
+	shardClaimGrace      = 30 // seconds a claim on a shard number holds before its match is listed
+)
+
+var (
+	errNoWorld      = runtime.NewError("no world shard could be found or started", rpcCodeInternal)
+	errUnknownWorld = runtime.NewError("no world is running that map", rpcCodeNotFound)
+	errShardClaimed = runtime.NewError("the world is starting; try again shortly", rpcCodeUnavailable)
+)
+
+// openWorldKind is the "kind" of every open world match label
+const openWorldKind = "open_world"
+
+// ShardLabel is the JSON label of an open world match, kept up to date with its population so
+// MatchList queries can route players
+type ShardLabel struct {
+	Kind     string `json:"kind"` // openWorldKind
+	Map      string `json:"map"`
+	Shard    int    `json:"shard"` // 1 is the primary shard, the only one saving world state; 0 a shard handing its map over
+	Players  int    `json:"players"`
+	Capacity int    `json:"capacity"`
+	Open     bool   `json:"open"` // accepts players
+	PvP      bool   `json:"pvp"`
+	Started  int64  `json:"started"` // unix seconds
+}
+
+// load is the fraction of the shard's capacity in use
+func (l *ShardLabel) load() float64 {
+	if l.Capacity <= 0 {
+		return 1
+	}
+	return float64(l.Players) / float64(l.Capacity)
+}
+
+// ShardInfo is a running shard of a map
+type ShardInfo struct {
+	MatchID string
+	Label   ShardLabel
+}
+
+// ShardManager keeps the label of an open world match in line with its population, turns away
+// players once it is full and closes extra shards nobody used for a while. It is only used from
+// the match handlers.
+type ShardManager struct {
+	logger    runtime.Logger
+	label     ShardLabel
+	capacity  int  // from the map; the world settings' maxPlayers may lower it
+	enabled   bool // open world matches only
+	closing   bool // a world reset restarts the map: takes no players and saves no world state
+	ended     bool // players were sent to the restarted map; the match ends on its next tick
+	handoff   bool // the match shuts down and gave up its shard number (match_handoff.go)
+	emptyFrom int64
+	published string
+}
+
+// NewShardManager creates a shard manager that does nothing until Configure
+func NewShardManager(logger runtime.Logger) *ShardManager {
+	return &ShardManager{logger: logger}
+}
+
+// Configure makes the match a shard of its map: its number comes from the "shard" match
+// parameter (1 when missing) and its capacity from the map properties
+func (sm *ShardManager) Configure(gs *GameMatchState, params map[string]interface{}) {
+	shard := 1
+	switch v := params["shard"].(type) {
+	case int:
+		shard = v
+	case int64:
+		shard = int(v)
+	case float64:
+		shard = int(v)
+	}
+	capacity := defaultShardCapacity
+	if v, ok := gs.currentMap.Properties["shardCapacity"].(float64); ok && v >= 1 {
+		capacity = int(v)
+	}
+	sm.enabled = true
+	sm.capacity = capacity
+	sm.label = ShardLabel{
+		Kind:    openWorldKind,
+		Map:     gs.currentMapName,
+		Shard:   int(math.Max(1, float64(shard))),
+		Open:    true,
+		Started: time.Now().Unix(),
+	}
+}
+
+// capacityFor returns how many players the shard takes: its map's capacity, capped by the
+// world settings' maxPlayers
+func (sm *ShardManager) capacityFor(gs *GameMatchState) int {
+	if gs.worldSettings != nil && gs.worldSettings.MaxPlayers > 0 && gs.worldSettings.MaxPlayers < sm.capacity {
+		return gs.worldSettings.MaxPlayers
+	}
+	return sm.capacity
+}
+
+// Primary reports whether the match saves world state: every match but the extra shards of an
+// open world map
+func (sm *ShardManager) Primary() bool {
+	return !sm.enabled || sm.label.Shard == 1
+}
+
+// Full reports whether the shard turns away joining players
+func (sm *ShardManager) Full(gs *GameMatchState) bool {
+	return sm.closing || (sm.enabled && len(gs.presences) >= sm.capacityFor(gs))
+}
+
+// Close stops the shard from admitting players and saving world state while a world reset
+// restarts its map
+func (sm *ShardManager) Close() {
+	sm.closing = true
+}
+
+// Closing reports whether a world reset is restarting the shard's map
+func (sm *ShardManager) Closing() bool {
+	return sm.closing
+}
+
+// End makes the match end on its next tick
+func (sm *ShardManager) End() {
+	sm.closing = true
+	sm.ended = true
+}
+
+// Ended reports whether the match should end. Called from the match loop.
+func (sm *ShardManager) Ended() bool {
+	return sm.ended
+}
+
+// HandOff gives up the number of a shard that is shutting down, so a replacement can take it.
+// Like a world reset, the shard then takes no players and saves no world state.
+func (sm *ShardManager) HandOff() {
+	sm.closing = true
+	sm.handoff = true
+	sm.label.Shard = 0
+}
+
+// HandedOff reports whether the shard handed its map over to a replacement
+func (sm *ShardManager) HandedOff() bool {
+	return sm.handoff
+}
+
+// Label returns the match label for the current population
+func (sm *ShardManager) Label(gs *GameMatchState) string {
+	sm.label.Players = len(gs.presences)
+	sm.label.Capacity = sm.capacityFor(gs)
+	sm.label.Open = !sm.closing && sm.label.Players < sm.label.Capacity
+	sm.label.PvP = gs.pvpEnabled()
+	data, err := json.Marshal(sm.label)
+	if err != nil {
+		sm.logger.Error("Failed to marshal shard label: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// UpdateLabel publishes the label when the population, capacity or PvP rule changed. Called
+// after joins and leaves, and when the world settings change.
+func (sm *ShardManager) UpdateLabel(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if !sm.enabled || dispatcher == nil {
+		return
+	}
+	label := sm.Label(gs)
+	if label == "" || label == sm.published {
+		return
+	}
+	if err := dispatcher.MatchLabelUpdate(label); err != nil {
+		sm.logger.Error("Failed to update shard label: %v", err)
+		return
+	}
+	sm.published = label
+}
+
+// Idle reports whether an extra shard has been empty for shardIdleTicks and should close; the
+// primary shard always stays up. Called from the match loop.
+func (sm *ShardManager) Idle(gs *GameMatchState) bool {
+	if !sm.enabled || sm.Primary() || len(gs.presences) > 0 {
+		sm.emptyFrom = 0
+		return false
+	}
+	if sm.emptyFrom == 0 {
+		sm.emptyFrom = gs.currentTick
+	}
+	return gs.currentTick-sm.emptyFrom >= shardIdleTicks
+}
+
+// openWorldQuery is the MatchList query matching the open world shards of a map (all maps for "")
+func openWorldQuery(mapName string) string {
+	query := "+label.kind:" + openWorldKind
+	if mapName != "" {
+		query += fmt.Sprintf(" +label.map:%q", mapName)
+	}
+	return query
+}
+
+// ListShards returns the running open world shards of a map (all maps for ""), by shard number
+func ListShards(ctx context.Context, nk runtime.NakamaModule, mapName string) ([]*ShardInfo, error) {
+	matches, err := nk.MatchList(ctx, maxShardsListed, true, "", nil, nil, openWorldQuery(mapName))
+	if err != nil {
+		return nil, err
+	}
+	shards := make([]*ShardInfo, 0, len(matches))
+	for _, m := range matches {
+		shard := &ShardInfo{MatchID: m.GetMatchId()}
+		if err := json.Unmarshal([]byte(m.GetLabel().GetValue()), &shard.Label); err != nil {
+			continue
+		}
+		shards = append(shards, shard)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i].Label.Shard < shards[j].Label.Shard })
+	return shards, nil
+}
+
+// FindShard returns the least loaded open shard of a map, starting a new shard when there is
+// none or every shard is at least shardSplitRatio full
+func FindShard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, mapName string) (*ShardInfo, error) {
+	shards, err := ListShards(ctx, nk, mapName)
+	if err != nil {
+		logger.Error("Failed to list shards of %s: %v", mapName, err)
+		return nil, err
+	}
+
+	var best *ShardInfo
+	for _, shard := range shards {
+		if !shard.Label.Open {
+			continue
+		}
+		if best == nil || shard.Label.load() < best.Label.load() {
+			best = shard
+		}
+	}
+	if best != nil && best.Label.load() < shardSplitRatio {
+		return best, nil
+	}
+
+	shard, err := StartShard(ctx, logger, nk, mapName, shards)
+	if err != nil {
+		if best != nil {
+			// Crowded beats nothing
+			return best, nil
+		}
+		return nil, err
+	}
+	return shard, nil
+}
+
+// StartShard starts a shard of a map with the lowest number not in use by running. The number is
+// claimed in storage with a versioned write first, so two nodes routing players at the same time
+// (or a shard that handed off starting its replacement) can't both start it. When another node holds
+// the claim, its match is returned, or errShardClaimed while it is still being created.
+func StartShard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, mapName string, running []*ShardInfo) (*ShardInfo, error) {
+	used := make(map[int]bool, len(running))
+	listed := make(map[string]bool, len(running))
+	for _, shard := range running {
+		used[shard.Label.Shard] = true
+		listed[shard.MatchID] = true
+	}
+	number := 1
+	for used[number] {
+		number++
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	claim, version, err := dm.LoadShardClaim(ctx, mapName, number)
+	if err != nil {
+		return nil, err
+	}
+	// A claim lapses once its match is listed under another number (it handed off) or after
+	// shardClaimGrace, by when a running match would be listed under this one
+	if claim != nil && !listed[claim.MatchID] && time.Now().Unix()-claim.ClaimedAt < shardClaimGrace {
+		if claim.MatchID == "" {
+			return nil, errShardClaimed
+		}
+		return newShardInfo(claim.MatchID, mapName, number), nil
+	}
+	if err := dm.SaveShardClaim(ctx, mapName, number, &PersistedShardClaim{ClaimedAt: time.Now().Unix()}, version); err != nil {
+		// Another node claimed it in between
+		return nil, errShardClaimed
+	}
+	return createShard(ctx, logger, nk, dm, mapName, number)
+}
+
+// ReplaceShard starts a new shard 1 of a map while the old one still runs, as a world reset
+// does, taking over the claim on the number
+func ReplaceShard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, mapName string) (*ShardInfo, error) {
+	dm := NewDatabaseManager(logger, nk)
+	if err := dm.SaveShardClaim(ctx, mapName, 1, &PersistedShardClaim{ClaimedAt: time.Now().Unix()}, ""); err != nil {
+		return nil, err
+	}
+	return createShard(ctx, logger, nk, dm, mapName, 1)
+}
+
+// createShard starts the match of a claimed shard number and records it in the claim. A failed
+// start gives the claim up.
+func createShard(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, dm *DatabaseManager, mapName string, number int) (*ShardInfo, error) {
+	matchID, err := nk.MatchCreate(ctx, "game", map[string]interface{}{"map": mapName, "shard": number})
+	if err != nil {
+		logger.Error("Failed to start shard %d of %s: %v", number, mapName, err)
+		_ = dm.SaveShardClaim(ctx, mapName, number, &PersistedShardClaim{}, "")
+		return nil, err
+	}
+	if err := dm.SaveShardClaim(ctx, mapName, number, &PersistedShardClaim{MatchID: matchID, ClaimedAt: time.Now().Unix()}, ""); err != nil {
+		logger.Warn("Failed to record shard %d of %s as %s: %v", number, mapName, matchID, err)
+	}
+	logger.Info("Started shard %d of %s: %s", number, mapName, matchID)
+	return newShardInfo(matchID, mapName, number), nil
+}
+
+// newShardInfo describes a shard that was just started; the match publishes its real capacity
+// with its label
+func newShardInfo(matchID, mapName string, number int) *ShardInfo {
+	return &ShardInfo{
+		MatchID: matchID,
+		Label:   ShardLabel{Kind: openWorldKind, Map: mapName, Shard: number, Capacity: defaultShardCapacity, Open: true, Started: time.Now().Unix()},
+	}
+}
+
+// RegisterWorldRpcs registers the RPCs players use to find an open world match
+func RegisterWorldRpcs(initializer runtime.Initializer) error {
+	if err := initializer.RegisterRpc("find_world", rpcFindWorld); err != nil {
+		return err
+	}
+	return initializer.RegisterRpc("world_list", rpcWorldList)
+}
+
+// rpcFindWorld returns the open world shard a player should join: the least loaded one of the
+// map, or a new one when all are crowded.
+// Payload: {"map": "optional"}
+func rpcFindWorld(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req struct {
+		Map string `json:"map"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+	if req.Map == "" {
+		req.Map = defaultWorldMap
+	}
+	// Players may only start shards of maps already running, so they can't start matches for
+	// maps that don't exist
+	if req.Map != defaultWorldMap {
+		if shards, err := ListShards(ctx, nk, req.Map); err != nil || len(shards) == 0 {
+			return "", errUnknownWorld
+		}
+	}
+
+	shard, err := FindShard(ctx, logger, nk, req.Map)
+	if err == errShardClaimed {
+		return "", errShardClaimed
+	}
+	if err != nil {
+		return "", errNoWorld
+	}
+	out, err := json.Marshal(map[string]interface{}{
+		"matchId":  shard.MatchID,
+		"map":      shard.Label.Map,
+		"shard":    shard.Label.Shard,
+		"players":  shard.Label.Players,
+		"capacity": shard.Label.Capacity,
+	})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Shop events published on the event bus
+const (
+	EventShopPurchase = "shop_purchase" // objectId, shop, playerId, itemId, count, price, currency
+)
+
+// Shop tuning. The object properties "shop" (definition ID) and "restock" (hours, e.g. "6,18")
+// configure each vendor.
+const (
+	vendorObjectType   = "vendor" // ObjectData.Type of the objects players buy from
+	maxShopPurchase    = 99       // items one buy input may take
+	defaultShopRestock = 6        // game hour shops restock at when neither they nor their object set hours
+	shopWriteRetries   = 3        // attempts to write a vendor's state when another shard changed it in between
+)
+
+// ShopItem is an item a shop sells. Stock 0 sells without limit; otherwise the shop holds at most
+// Stock and each restock adds Restock (all of it when 0). A Rare item is only offered after a
+// restock with that chance (0-1), and PerPlayer caps what one player may buy between restocks.
+type ShopItem struct {
+	ItemID    string  `json:"item"`
+	Price     int64   `json:"price"`
+	Stock     int     `json:"stock,omitempty"`
+	Restock   int     `json:"restock,omitempty"`
+	Rare      float64 `json:"rare,omitempty"`
+	PerPlayer int     `json:"perPlayer,omitempty"`
+}
+
+// ShopDefinition is a shop vendor objects can reference. Prices are in Currency (default gold)
+// and follow the "shop" economy rate and, with a Faction, the player's reputation rank.
+type ShopDefinition struct {
+	ID       string     `json:"-"`
+	Name     string     `json:"name"`
+	Currency string     `json:"currency,omitempty"`
+	Faction  string     `json:"faction,omitempty"`
+	Restock  []int      `json:"restock,omitempty"` // game hours the stock is restocked at (default 6)
+	Items    []ShopItem `json:"items"`
+}
+
+// item returns the shop's entry for an item
+func (def *ShopDefinition) item(itemID string) (*ShopItem, bool) {
+	for i := range def.Items {
+		if def.Items[i].ItemID == itemID {
+			return &def.Items[i], true
+		}
+	}
+	return nil, false
+}
+
+// Vendor is a map object with a shop and the shop's state at that vendor: two vendors of the
+// same shop keep their own stock. In persistent matches the state is stored per vendor and every
+// shard of the map reads and writes it there; the Vendor holds the state last read or written,
+// which is what players see when they open it.
+type Vendor struct {
+	ObjectID    int
+	Name        string
+	Shop        *ShopDefinition
+	Hours       []int                     // game hours it restocks at
+	Stock       map[string]int            // item ID -> count left, for items with a stock
+	Offered     map[string]bool           // rare item ID -> whether the last restock offered it
+	Bought      map[string]map[string]int // player ID -> item ID -> count since the last restock
+	LastRestock int                       // game hour (day*24 + hour) of the last restock, -1 for none
+}
+
+// offers reports whether the vendor sells an item now
+func (v *Vendor) offers(item *ShopItem) bool {
+	return item.Rare <= 0 || v.Offered[item.ItemID]
+}
+
+// state returns a copy of the vendor's stock, rare items and purchases
+func (v *Vendor) state() *PersistedVendor {
+	state := &PersistedVendor{
+		Shop:        v.Shop.ID,
+		Stock:       make(map[string]int, len(v.Stock)),
+		Offered:     make(map[string]bool, len(v.Offered)),
+		Bought:      make(map[string]map[string]int, len(v.Bought)),
+		LastRestock: v.LastRestock,
+	}
+	for itemID, count := range v.Stock {
+		state.Stock[itemID] = count
+	}
+	for itemID, offered := range v.Offered {
+		state.Offered[itemID] = offered
+	}
+	for playerID, bought := range v.Bought {
+		state.Bought[playerID] = make(map[string]int, len(bought))
+		for itemID, count := range bought {
+			state.Bought[playerID][itemID] = count
+		}
+	}
+	return state
+}
+
+// clone returns a copy of the vendor whose state can be changed without touching it
+func (v *Vendor) clone() *Vendor {
+	c := *v
+	state := v.state()
+	c.Stock, c.Offered, c.Bought = state.Stock, state.Offered, state.Bought
+	return &c
+}
+
+// restore puts back a stored state. A state of another shop is ignored; items added to the shop
+// since keep the stock they have.
+func (v *Vendor) restore(state *PersistedVendor) {
+	if state.Shop != v.Shop.ID {
+		return
+	}
+	for _, item := range v.Shop.Items {
+		if count, ok := state.Stock[item.ItemID]; ok && item.Stock > 0 {
+			v.Stock[item.ItemID] = int(math.Min(float64(count), float64(item.Stock)))
+		}
+		if offered, ok := state.Offered[item.ItemID]; ok && item.Rare > 0 {
+			v.Offered[item.ItemID] = offered
+		}
+	}
+	v.Bought = make(map[string]map[string]int, len(state.Bought))
+	for playerID, bought := range state.Bought {
+		v.Bought[playerID] = bought
+	}
+	v.LastRestock = state.LastRestock
+}
+
+// ShopCatalog holds the shop definitions loaded from a JSON file keyed by shop ID
+type ShopCatalog struct {
+	logger runtime.Logger
+	shops  map[string]*ShopDefinition
+	mu     sync.RWMutex
+}
+
+// NewShopCatalog creates a catalog and loads definitions from path
+func NewShopCatalog(logger runtime.Logger, path string) *ShopCatalog {
+	sc := &ShopCatalog{
+		logger: logger,
+		shops:  make(map[string]*ShopDefinition),
+	}
+	if err := sc.Load(path); err != nil {
+		logger.Warn("Failed to load shop definitions from %s: %v", path, err)
+	}
+	return sc
+}
+
+// Load replaces the catalog with the definitions found in path
+func (sc *ShopCatalog) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var shops map[string]*ShopDefinition
+	if err := json.Unmarshal(data, &shops); err != nil {
+		return err
+	}
+	for id, def := range shops {
+		def.ID = id
+		if def.Currency == "" {
+			def.Currency = defaultFeeCurrency
+		}
+		if len(def.Restock) == 0 {
+			def.Restock = []int{defaultShopRestock}
+		}
+		items := def.Items[:0]
+		for _, item := range def.Items {
+			if item.ItemID == "" || item.Price < 0 || item.Stock < 0 || item.Restock < 0 || item.Rare < 0 || item.Rare > 1 {
+				sc.logger.Warn("Shop %s has an invalid entry for %q; skipping it", id, item.ItemID)
+				continue
+			}
+			items = append(items, item)
+		}
+		def.Items = items
+	}
+
+	sc.mu.Lock()
+	sc.shops = shops
+	sc.mu.Unlock()
+
+	sc.logger.Info("Loaded %d shop definitions from %s", len(shops), path)
+	return nil
+}
+
+// Get returns the definition for a shop ID
+func (sc *ShopCatalog) Get(shopID string) (*ShopDefinition, bool) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	def, ok := sc.shops[shopID]
+	return def, ok
+}
+
+// ShopManager tracks the map's vendors and their stock. Stock is restocked on the world clock's
+// hours, so it follows game time rather than wall time.
+type ShopManager struct {
+	logger  runtime.Logger
+	catalog *ShopCatalog
+	vendors map[int]*Vendor // object ID -> vendor
+	shared  bool            // the vendors' state is in storage, shared with the map's other shards (after Restore)
+	mu      sync.Mutex
+}
+
+// NewShopManager creates a shop manager with the shop definitions found in path
+func NewShopManager(logger runtime.Logger, path string) *ShopManager {
+	return &ShopManager{
+		logger:  logger,
+		catalog: NewShopCatalog(logger, path),
+		vendors: make(map[int]*Vendor),
+	}
+}
+
+// parseRestockHours parses a list of game hours such as "6,18"
+func parseRestockHours(s string) ([]int, bool) {
+	var hours []int
+	for _, field := range strings.Split(s, ",") {
+		hour, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || hour < 0 || hour > 23 {
+			return nil, false
+		}
+		hours = append(hours, hour)
+	}
+	return hours, len(hours) > 0
+}
+
+// LoadFromMap registers every "vendor" object of the current map with a known shop and stocks it
+func (sm *ShopManager) LoadFromMap(gs *GameMatchState) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.vendors = make(map[int]*Vendor)
+	gs.mu.Lock()
+	for oid, obj := range gs.Objects() {
+		if !strings.EqualFold(obj.Type, vendorObjectType) {
+			continue
+		}
+		shopID, _ := obj.Props["shop"].(string)
+		def, ok := sm.catalog.Get(shopID)
+		if !ok {
+			sm.logger.Warn("Vendor %d (%s) has unknown shop %q; skipping", oid, obj.Name, shopID)
+			continue
+		}
+		vendor := &Vendor{ObjectID: oid, Name: obj.Name, Shop: def, Hours: def.Restock, LastRestock: -1}
+		if v, ok := obj.Props["restock"].(string); ok && v != "" {
+			if hours, ok := parseRestockHours(v); ok {
+				vendor.Hours = hours
+			} else {
+				sm.logger.Warn("Vendor %d (%s) has invalid restock hours %q; using the shop's", oid, obj.Name, v)
+			}
+		}
+		sm.restock(gs, vendor, true)
+		sm.vendors[oid] = vendor
+	}
+	gs.mu.Unlock()
+	sm.logger.Info("Registered %d vendors", len(sm.vendors))
+}
+
+// restock refills a vendor's stock, rolls which rare items it offers until the next restock and
+// clears what players bought. full fills every item up to its stock, as a fresh vendor is.
+func (sm *ShopManager) restock(gs *GameMatchState, vendor *Vendor, full bool) {
+	if vendor.Stock == nil {
+		vendor.Stock = make(map[string]int)
+	}
+	vendor.Offered = make(map[string]bool)
+	vendor.Bought = make(map[string]map[string]int)
+	for _, item := range vendor.Shop.Items {
+		if item.Rare > 0 {
+			vendor.Offered[item.ItemID] = gs.rng.Float64() < item.Rare
+		}
+		if item.Stock == 0 {
+			continue
+		}
+		count, ok := vendor.Stock[item.ItemID]
+		if full || !ok || item.Restock == 0 {
+			count = item.Stock
+		} else {
+			count = int(math.Min(float64(count+item.Restock), float64(item.Stock)))
+		}
+		vendor.Stock[item.ItemID] = count
+	}
+}
+
+// errAlreadyRestocked is the reason a vendor's hourly restock isn't written: another shard of
+// the map restocked it at that hour
+const errAlreadyRestocked = "already_restocked"
+
+// SubscribeEvents restocks the vendors at their restock hours. Every shard of the map gets the
+// hour; the first to write a vendor restocks it and the others read what it wrote.
+func (sm *ShopManager) SubscribeEvents(eb *EventBus) {
+	eb.Subscribe(EventHour, func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		day, _ := event.Data["day"].(int)
+		hour, _ := event.Data["hour"].(int)
+		at := day*24 + hour
+		sm.mu.Lock()
+		var due []*Vendor
+		for _, oid := range sortedKeys(sm.vendors) {
+			vendor := sm.vendors[oid]
+			if vendor.LastRestock != at && containsHour(vendor.Hours, hour) {
+				due = append(due, vendor)
+			}
+		}
+		sm.mu.Unlock()
+
+		restocked := 0
+		for _, vendor := range due {
+			reason := sm.updateVendor(ctx, gs, vendor, func(v *Vendor) string {
+				if v.LastRestock == at {
+					return errAlreadyRestocked
+				}
+				sm.restock(gs, v, false)
+				v.LastRestock = at
+				return ""
+			})
+			if reason == "" {
+				restocked++
+			}
+		}
+		if restocked > 0 {
+			sm.logger.Info("Restocked %d vendors at hour %d of day %d", restocked, hour, day)
+		}
+	})
+}
+
+// Restock restocks a vendor now. It returns false if the object isn't a vendor or its state
+// couldn't be written.
+func (sm *ShopManager) Restock(ctx context.Context, gs *GameMatchState, oid int) bool {
+	vendor := sm.Get(oid)
+	if vendor == nil {
+		return false
+	}
+	return sm.updateVendor(ctx, gs, vendor, func(v *Vendor) string {
+		sm.restock(gs, v, false)
+		return ""
+	}) == ""
+}
+
+// updateVendor applies a change to a vendor's state. In a shared match the state is read from
+// storage and written back at the version read, retrying when another shard changed it in
+// between. change gets a copy of the state and returns a rejection reason, or "" to write it;
+// the vendor then holds the state written, or the state read when change rejected it. It
+// returns change's reason, or RejectStorageError when the state couldn't be read or written.
+func (sm *ShopManager) updateVendor(ctx context.Context, gs *GameMatchState, vendor *Vendor, change func(v *Vendor) string) string {
+	if !sm.shared {
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		next := vendor.clone()
+		if reason := change(next); reason != "" {
+			return reason
+		}
+		*vendor = *next
+		return ""
+	}
+
+	var err error
+	for attempt := 0; attempt < shopWriteRetries; attempt++ {
+		stored, version, loadErr := gs.databaseManager.LoadVendor(ctx, gs.currentMapName, vendor.ObjectID)
+		if loadErr != nil {
+			return RejectStorageError
+		}
+		sm.mu.Lock()
+		if stored != nil {
+			vendor.restore(stored)
+		}
+		next := vendor.clone()
+		sm.mu.Unlock()
+
+		if reason := change(next); reason != "" {
+			return reason
+		}
+		if err = gs.databaseManager.SaveVendor(ctx, gs.currentMapName, vendor.ObjectID, next.state(), version); err == nil {
+			sm.mu.Lock()
+			*vendor = *next
+			sm.mu.Unlock()
+			return ""
+		}
+	}
+	sm.logger.Error("Failed to update vendor %d: %v", vendor.ObjectID, err)
+	return RejectStorageError
+}
+
+// containsHour reports whether a list of game hours has an hour
+func containsHour(hours []int, hour int) bool {
+	for _, h := range hours {
+		if h == hour {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the vendor of an object (nil if the object isn't a vendor)
+func (sm *ShopManager) Get(oid int) *Vendor {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.vendors[oid]
+}
+
+// ShopOffer is an item of a shop as a player sees it: their price, and what's left of a limited
+// stock or of their purchase limit
+type ShopOffer struct {
+	ItemID    string `json:"item"`
+	Price     int64  `json:"price"`
+	Stock     *int   `json:"stock,omitempty"`     // nil when unlimited
+	Remaining *int   `json:"remaining,omitempty"` // the player's purchases left before the next restock; nil when unlimited
+	Rare      bool   `json:"rare,omitempty"`
+}
+
+// unitPrice is what a player pays for one of an item: its price with the player's reputation
+// rank with the shop's faction and the "shop" economy rate applied
+func (gs *GameMatchState) unitPrice(def *ShopDefinition, item *ShopItem, playerID string) int64 {
+	price := float64(item.Price)
+	if def.Faction != "" {
+		price *= gs.reputation.PriceModifier(playerID, def.Faction)
+	}
+	return gs.Price(SinkShop, int64(math.Ceil(price)))
+}
+
+// offers returns what a vendor sells a player now. Called with sm.mu held.
+func (sm *ShopManager) offers(gs *GameMatchState, vendor *Vendor, playerID string) []ShopOffer {
+	offers := make([]ShopOffer, 0, len(vendor.Shop.Items))
+	for i := range vendor.Shop.Items {
+		item := &vendor.Shop.Items[i]
+		if !vendor.offers(item) {
+			continue
+		}
+		offer := ShopOffer{ItemID: item.ItemID, Price: gs.unitPrice(vendor.Shop, item, playerID), Rare: item.Rare > 0}
+		if item.Stock > 0 {
+			stock := vendor.Stock[item.ItemID]
+			offer.Stock = &stock
+		}
+		if item.PerPlayer > 0 {
+			remaining := max(0, float64(item.PerPlayer-vendor.Bought[playerID][item.ItemID]))
+			left := int(remaining)
+			offer.Remaining = &left
+		}
+		offers = append(offers, offer)
+	}
+	return offers
+}
+
+// Open sends a player the shop of a vendor they reached. It returns a rejection reason, or "".
+func (sm *ShopManager) Open(gs *GameMatchState, playerID string, oid int, dispatcher runtime.MatchDispatcher) string {
+	sm.mu.Lock()
+	vendor, ok := sm.vendors[oid]
+	if !ok {
+		sm.mu.Unlock()
+		return RejectInvalidTarget
+	}
+	data := map[string]any{
+		"objectId": oid,
+		"shop":     vendor.Shop.ID,
+		"name":     vendor.Shop.Name,
+		"currency": vendor.Shop.Currency,
+		"items":    sm.offers(gs, vendor, playerID),
+	}
+	sm.mu.Unlock()
+
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return ""
+	}
+	payload, err := EncodeMessage(OpCodeShop, "shop", data)
+	if err != nil {
+		sm.logger.Error("Failed to marshal shop %s: %v", vendor.Shop.ID, err)
+		return ""
+	}
+	dispatcher.BroadcastMessage(OpCodeShop, payload, []runtime.Presence{presence}, nil, true)
+	return ""
+}
+
+// Buy sells a player count of an item from a vendor they reached: the stock and the player's
+// purchase limit are taken first, then the price from their wallet, then the items go to their
+// inventory, undoing the earlier steps if a later one fails. The stock is taken from the
+// vendor's stored state, so players on two shards can't both buy the last one. Each purchase is
+// recorded in the action journal. It returns the price paid, or a rejection reason.
+func (sm *ShopManager) Buy(ctx context.Context, gs *GameMatchState, playerID string, oid int, itemID string, count int, dispatcher runtime.MatchDispatcher) (int64, string) {
+	if count <= 0 {
+		count = 1
+	}
+	if count > maxShopPurchase {
+		return 0, RejectInvalidCount
+	}
+
+	vendor := sm.Get(oid)
+	if vendor == nil {
+		return 0, RejectInvalidTarget
+	}
+	def := vendor.Shop
+	item, ok := def.item(itemID)
+	if !ok {
+		return 0, RejectUnknownItem
+	}
+	reason := sm.updateVendor(ctx, gs, vendor, func(v *Vendor) string {
+		if !v.offers(item) {
+			return RejectUnknownItem
+		}
+		if item.Stock > 0 && v.Stock[itemID] < count {
+			return RejectOutOfStock
+		}
+		if item.PerPlayer > 0 && v.Bought[playerID][itemID]+count > item.PerPlayer {
+			return RejectPurchaseLimit
+		}
+		takeStock(v, item, playerID, count)
+		return ""
+	})
+	if reason != "" {
+		return 0, reason
+	}
+
+	undo := func() {
+		if reason := sm.updateVendor(ctx, gs, vendor, func(v *Vendor) string {
+			takeStock(v, item, playerID, -count)
+			return ""
+		}); reason != "" {
+			sm.logger.Error("Shop %s: failed to give back %d x %s to vendor %d: %s", def.ID, count, itemID, oid, reason)
+		}
+	}
+
+	price := gs.unitPrice(def, item, playerID) * int64(count)
+	source := "shop:" + def.ID
+	changeset := map[string]int64{def.Currency: -price}
+	entry := &JournalEntry{
+		Key:      gs.journal.UniqueKey("purchase", oid, playerID),
+		Kind:     JournalPurchase,
+		PlayerID: playerID,
+		Items:    map[string]int{itemID: count},
+		Currency: changeset,
+		Source:   source,
+	}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		undo()
+		return 0, RejectRateLimited
+	}
+	if price > 0 {
+		// The wallet update fails rather than go negative
+		if err := gs.databaseManager.UpdateWallet(ctx, playerID, changeset, map[string]interface{}{"source": source}); err != nil {
+			undo()
+			gs.journal.Finish(ctx, entry, err)
+			return 0, gs.walletReject(ctx, playerID, def.Currency, price)
+		}
+	}
+	if err := gs.inventoryManager.Add(ctx, playerID, itemID, count); err != nil {
+		sm.logger.Error("Shop %s: failed to give %d x %s to %s: %v", def.ID, count, itemID, playerID, err)
+		if price > 0 {
+			if rerr := gs.databaseManager.UpdateWallet(ctx, playerID, map[string]int64{def.Currency: price}, map[string]interface{}{"source": "shop_refund:" + def.ID}); rerr != nil {
+				sm.logger.Error("Shop %s: failed to refund %d %s to %s: %v", def.ID, price, def.Currency, playerID, rerr)
+			}
+		}
+		undo()
+		gs.journal.Finish(ctx, entry, fmt.Errorf("inventory: %w", err))
+		return 0, RejectStorageError
+	}
+	gs.journal.Finish(ctx, entry, nil)
+
+	sm.logger.Info("Player %s bought %d x %s from %s (vendor %d) for %d %s", playerID, count, itemID, def.ID, oid, price, def.Currency)
+	gs.eventBus.Publish(EventShopPurchase, map[string]any{"objectId": oid, "shop": def.ID, "playerId": playerID, "itemId": itemID, "count": count, "price": price, "currency": def.Currency})
+	sm.Open(gs, playerID, oid, dispatcher)
+	return price, ""
+}
+
+// takeStock removes count of an item from a vendor's stock and adds it to the player's purchases
+// (or gives it back with a negative count)
+func takeStock(vendor *Vendor, item *ShopItem, playerID string, count int) {
+	if item.Stock > 0 {
+		vendor.Stock[item.ItemID] -= count
+	}
+	if item.PerPlayer > 0 {
+		if vendor.Bought[playerID] == nil {
+			vendor.Bought[playerID] = make(map[string]int)
+		}
+		vendor.Bought[playerID][item.ItemID] += count
+	}
+}
+
+// Restore reads the vendors' state from storage, where the map's shards share it. Vendors stored
+// as part of the map's old single record carry that over; vendors without a stored state write
+// theirs, so every shard sells from the same stock and rare items.
+func (sm *ShopManager) Restore(ctx context.Context, gs *GameMatchState) error {
+	sm.mu.Lock()
+	oids := sortedKeys(sm.vendors)
+	sm.mu.Unlock()
+
+	stored, err := gs.databaseManager.LoadVendors(ctx, gs.currentMapName, oids)
+	if err != nil {
+		return err
+	}
+	legacy := &PersistedShops{}
+	if len(stored) < len(oids) {
+		if legacy, err = gs.databaseManager.LoadShops(ctx, gs.currentMapName); err != nil {
+			return err
+		}
+	}
+
+	sm.mu.Lock()
+	sm.shared = true
+	var missing []*Vendor
+	for _, oid := range oids {
+		vendor := sm.vendors[oid]
+		if state, ok := stored[oid]; ok {
+			vendor.restore(state)
+			continue
+		}
+		if state, ok := legacy.Vendors[oid]; ok {
+			vendor.restore(&state)
+		}
+		missing = append(missing, vendor)
+	}
+	sm.mu.Unlock()
+
+	for _, vendor := range missing {
+		if reason := sm.updateVendor(ctx, gs, vendor, func(*Vendor) string { return "" }); reason != "" {
+			sm.logger.Warn("Failed to store the state of vendor %d: %s", vendor.ObjectID, reason)
+		}
+	}
+	sm.logger.Info("Restored the stock of %d vendors", len(oids))
+	return nil
+}
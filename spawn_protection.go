@@ -0,0 +1,43 @@
+package main
+
+// defaultSpawnProtection is how long (seconds) players are protected after spawning or
+// respawning unless the spawnProtection game rule says otherwise
+const defaultSpawnProtection = 5.0
+
+// Bus event published when a player's spawn protection ends before it runs out
+const EventSpawnProtectionEnded = "spawn_protection_ended" // playerId, reason
+
+// GrantSpawnProtection protects a player who just spawned or respawned: for the spawnProtection
+// game rule's seconds they take no damage and NPCs don't notice them, until they attack
+func (gs *GameMatchState) GrantSpawnProtection(playerID string) {
+	seconds := defaultSpawnProtection
+	if gs.worldSettings != nil {
+		if v, ok := gs.worldSettings.GameRules["spawnProtection"].(float64); ok && v >= 0 {
+			seconds = v
+		}
+	}
+	state := gs.GetPlayerState(playerID)
+	state.ProtectedUntil = gs.currentTick + int64(seconds*TickRate)
+	state.statusDirty = true
+}
+
+// SpawnProtected reports whether a player is under spawn protection
+func (gs *GameMatchState) SpawnProtected(playerID string) bool {
+	return gs.GetPlayerState(playerID).spawnProtected(gs.currentTick)
+}
+
+// spawnProtected reports whether the player is under spawn protection at tick
+func (ps *PlayerState) spawnProtected(tick int64) bool {
+	return tick < ps.ProtectedUntil
+}
+
+// EndSpawnProtection lifts a player's spawn protection early, e.g. because they attacked
+func (gs *GameMatchState) EndSpawnProtection(playerID, reason string) {
+	state := gs.GetPlayerState(playerID)
+	if !state.spawnProtected(gs.currentTick) {
+		return
+	}
+	state.ProtectedUntil = 0
+	state.statusDirty = true
+	gs.eventBus.Publish(EventSpawnProtectionEnded, map[string]any{"playerId": playerID, "reason": reason})
+}
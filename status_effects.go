@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Status effect kinds
+const (
+	EffectKindSlow    = "slow"    // lowers the movement cap by Magnitude (fraction) per stack
+	EffectKindPoison  = "poison"  // deals Magnitude poison damage per stack every Interval seconds
+	EffectKindRegen   = "regen"   // heals Magnitude per stack every Interval seconds
+	EffectKindShield  = "shield"  // absorbs up to Magnitude damage per stack before health is lost
+	EffectKindStealth = "stealth" // hides the player from others until detected (stealth.go); Magnitude is unused
+	EffectKindThreat  = "threat"  // changes the threat the player generates on NPCs by Magnitude (fraction) per stack (npc_threat.go)
+
+	EffectKindDamageTaken = "damage_taken" // changes the damage the player takes by Magnitude (fraction) per stack (damage_pipeline.go)
+	EffectKindDamageDealt = "damage_dealt" // changes the damage the player deals by Magnitude (fraction) per stack
+)
+
+// Stacking rules for reapplying an active effect
+const (
+	EffectStackRefresh = "refresh" // resets the duration (default)
+	EffectStackAdd     = "stack"   // adds a stack (up to MaxStacks) and resets the duration
+	EffectStackExtend  = "extend"  // adds the duration to the time left
+	EffectStackIgnore  = "ignore"  // keeps the active effect untouched
+)
+
+// Status effect tuning
+const (
+	defaultEffectInterval   = 1.0          // seconds between poison/regen ticks
+	maxEffectSlow           = 0.9          // slows never stop a player completely
+	persistentEffectSeconds = 60.0         // effects, buffs and cooldowns with at least this much time left are saved when the player leaves
+	effectZoneInterval      = TickRate / 2 // ticks between effect zone checks
+)
+
+// EffectDefinition describes a status effect
+type EffectDefinition struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Kind      string  `json:"kind"`                // EffectKind*
+	Icon      string  `json:"icon,omitempty"`      // icon key sent to clients
+	Magnitude float64 `json:"magnitude"`           // per stack; meaning depends on Kind
+	Duration  float64 `json:"duration,omitempty"`  // seconds (0 = until removed)
+	Interval  float64 `json:"interval,omitempty"`  // seconds between poison/regen ticks (default defaultEffectInterval)
+	Stacking  string  `json:"stacking,omitempty"`  // EffectStack* (default refresh)
+	MaxStacks int     `json:"maxStacks,omitempty"` // cap for the stack rule (default 1)
+
+	DamageType string `json:"damageType,omitempty"` // damage_taken/damage_dealt: the damage type it changes (default all)
+	Stage      string `json:"stage,omitempty"`      // damage_taken/damage_dealt: the damage pipeline stage it applies at (default buffs)
+}
+
+// DamageStage returns the damage pipeline stage a damage_taken or damage_dealt effect applies at
+func (def *EffectDefinition) DamageStage() string {
+	if def.Stage == "" {
+		return DamageStageBuffs
+	}
+	return def.Stage
+}
+
+// StatusEffect is an effect active on a player
+type StatusEffect struct {
+	Def         *EffectDefinition
+	Stacks      int
+	ExpiresTick int64 // 0 = until removed
+	Source      DamageSource
+	nextTick    int64 // next poison/regen tick
+}
+
+// EffectData is the effect representation sent to clients
+type EffectData struct {
+	ID        string  `json:"id"`
+	Icon      string  `json:"icon,omitempty"`
+	Stacks    int     `json:"stacks"`
+	Remaining float64 `json:"remaining,omitempty"` // seconds left (omitted for effects without expiry)
+}
+
+// EffectZone is a rectangular map area ("effect_zone" objects) that keeps applying an effect
+// to the players inside it
+type EffectZone struct {
+	Name   string
+	Effect string
+	Min    vector.Vector
+	Max    vector.Vector
+}
+
+// Contains reports whether a point lies inside the zone
+func (z *EffectZone) Contains(p vector.Vector) bool {
+	return p.X >= z.Min.X && p.X <= z.Max.X && p.Y >= z.Min.Y && p.Y <= z.Max.Y
+}
+
+// EffectCatalog holds the status effect definitions loaded from the effects data file
+type EffectCatalog struct {
+	logger  runtime.Logger
+	effects map[string]*EffectDefinition
+	mu      sync.RWMutex
+}
+
+// NewEffectCatalog creates a catalog and loads definitions from path (a JSON object keyed by effect ID)
+func NewEffectCatalog(logger runtime.Logger, path string) *EffectCatalog {
+	ec := &EffectCatalog{
+		logger:  logger,
+		effects: make(map[string]*EffectDefinition),
+	}
+	if err := ec.Load(path); err != nil {
+		logger.Warn("Failed to load effect definitions from %s: %v", path, err)
+	}
+	return ec
+}
+
+// Load replaces the catalog with the definitions found in path
+func (ec *EffectCatalog) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var effects map[string]*EffectDefinition
+	if err := json.Unmarshal(data, &effects); err != nil {
+		return err
+	}
+	for id, def := range effects {
+		def.ID = id
+		if def.Interval <= 0 {
+			def.Interval = defaultEffectInterval
+		}
+		if def.Stacking == "" {
+			def.Stacking = EffectStackRefresh
+		}
+		if def.MaxStacks <= 0 {
+			def.MaxStacks = 1
+		}
+		if def.Stage != "" && !validDamageStage(def.Stage) {
+			ec.logger.Warn("Effect %s has unknown damage stage %q; using %s", id, def.Stage, DamageStageBuffs)
+			def.Stage = ""
+		}
+	}
+
+	ec.mu.Lock()
+	ec.effects = effects
+	ec.mu.Unlock()
+
+	ec.logger.Info("Loaded %d effect definitions from %s", len(effects), path)
+	return nil
+}
+
+// Get returns the definition of an effect
+func (ec *EffectCatalog) Get(id string) (*EffectDefinition, bool) {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	def, ok := ec.effects[id]
+	return def, ok
+}
+
+// ApplyEffect puts an effect on a player following its stacking rule. duration overrides the
+// definition's duration when positive. It returns false for unknown effects, dead players or an
+// ignored reapplication.
+func (gs *GameMatchState) ApplyEffect(playerID, effectID string, source DamageSource, duration float64) bool {
+	def, ok := gs.effectCatalog.Get(effectID)
+	if !ok || gs.PlayerBody(playerID) == nil {
+		return false
+	}
+	state := gs.GetPlayerState(playerID)
+	if state.IsDead() {
+		return false
+	}
+	// Harmful effects from other players follow the PvP rules
+	harmful := def.Kind == EffectKindSlow || def.Kind == EffectKindPoison ||
+		(def.Kind == EffectKindDamageTaken && def.Magnitude > 0) || (def.Kind == EffectKindDamageDealt && def.Magnitude < 0)
+	if harmful && source.Type == DamageSourcePlayer && source.ID != playerID && !gs.CanDamagePlayer(source.ID, playerID) {
+		return false
+	}
+	if duration <= 0 {
+		duration = def.Duration
+	}
+	var expires int64
+	if duration > 0 {
+		expires = gs.currentTick + int64(duration*TickRate)
+	}
+
+	effect, active := state.Effects[effectID]
+	if !active {
+		effect = &StatusEffect{
+			Def:         def,
+			Stacks:      1,
+			ExpiresTick: expires,
+			Source:      source,
+			nextTick:    gs.currentTick + int64(def.Interval*TickRate),
+		}
+		state.Effects[effectID] = effect
+		if def.Kind == EffectKindShield {
+			state.Shield += def.Magnitude
+		}
+		state.statusDirty = true
+		return true
+	}
+
+	switch def.Stacking {
+	case EffectStackIgnore:
+		return false
+	case EffectStackAdd:
+		if effect.Stacks < def.MaxStacks {
+			effect.Stacks++
+			if def.Kind == EffectKindShield {
+				state.Shield += def.Magnitude
+			}
+		}
+		effect.ExpiresTick = expires
+	case EffectStackExtend:
+		if effect.ExpiresTick != 0 && expires != 0 {
+			effect.ExpiresTick += expires - gs.currentTick
+		}
+	default:
+		effect.ExpiresTick = expires
+	}
+	effect.Source = source
+	state.statusDirty = true
+	return true
+}
+
+// RemoveEffect ends an effect early. It returns false if the effect wasn't active.
+func (ps *PlayerState) RemoveEffect(effectID string) bool {
+	effect, ok := ps.Effects[effectID]
+	if !ok {
+		return false
+	}
+	delete(ps.Effects, effectID)
+	if effect.Def.Kind == EffectKindShield {
+		// Keep only as much shield as the remaining shield effects provide
+		remaining := 0.0
+		for _, other := range ps.Effects {
+			if other.Def.Kind == EffectKindShield {
+				remaining += other.Def.Magnitude * float64(other.Stacks)
+			}
+		}
+		ps.Shield = min(ps.Shield, remaining)
+	}
+	ps.statusDirty = true
+	return true
+}
+
+// ClearEffects removes every effect (on death)
+func (ps *PlayerState) ClearEffects() {
+	if len(ps.Effects) == 0 {
+		return
+	}
+	clear(ps.Effects)
+	ps.Shield = 0
+	ps.statusDirty = true
+}
+
+// HasEffectKind reports whether any active effect is of the kind
+func (ps *PlayerState) HasEffectKind(kind string) bool {
+	for _, effect := range ps.Effects {
+		if effect.Def.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectSlow returns the fraction the player's movement cap is lowered by slow effects
+func (ps *PlayerState) EffectSlow() float64 {
+	slow := 0.0
+	for _, effect := range ps.Effects {
+		if effect.Def.Kind == EffectKindSlow {
+			slow += effect.Def.Magnitude * float64(effect.Stacks)
+		}
+	}
+	return max(0, min(slow, maxEffectSlow))
+}
+
+// EffectList returns the player's active effects for clients, sorted by ID
+func (ps *PlayerState) EffectList(tick int64) []EffectData {
+	if len(ps.Effects) == 0 {
+		return nil
+	}
+	list := make([]EffectData, 0, len(ps.Effects))
+	for id, effect := range ps.Effects {
+		data := EffectData{ID: id, Icon: effect.Def.Icon, Stacks: effect.Stacks}
+		if effect.ExpiresTick != 0 {
+			data.Remaining = float64(effect.ExpiresTick-tick) / TickRate
+		}
+		list = append(list, data)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// updateEffects expires effects, runs poison/regen ticks and drops depleted shields.
+// Called for living players from UpdatePlayerStates.
+func (gs *GameMatchState) updateEffects(playerID string, state *PlayerState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	tick := gs.currentTick
+	if tick%effectZoneInterval == 0 && gs.currentMap != nil {
+		if rb := gs.PlayerBody(playerID); rb != nil {
+			for i := range gs.currentMap.EffectZones {
+				zone := &gs.currentMap.EffectZones[i]
+				if zone.Contains(rb.Position) {
+					gs.ApplyEffect(playerID, zone.Effect, DamageSource{Type: DamageSourceEnvironment, ID: zone.Name}, 0)
+				}
+			}
+		}
+	}
+
+	for id, effect := range state.Effects {
+		if effect.ExpiresTick != 0 && tick >= effect.ExpiresTick {
+			state.RemoveEffect(id)
+			continue
+		}
+		switch effect.Def.Kind {
+		case EffectKindShield:
+			if state.Shield <= 0 {
+				state.RemoveEffect(id)
+			}
+		case EffectKindPoison, EffectKindRegen:
+			if tick < effect.nextTick {
+				continue
+			}
+			effect.nextTick = tick + int64(effect.Def.Interval*TickRate)
+			amount := effect.Def.Magnitude * float64(effect.Stacks)
+			if effect.Def.Kind == EffectKindRegen {
+				// A regen from another player is their healing, and draws threat to them
+				healer := playerID
+				if effect.Source.Type == DamageSourcePlayer && effect.Source.ID != "" {
+					healer = effect.Source.ID
+				}
+				gs.npcManager.HealThreat(gs, healer, playerID, state.Heal(amount))
+			} else {
+				gs.damagePlayer(playerID, effect.Source, amount, DamagePoison, 0, dispatcher, logger)
+			}
+		}
+	}
+}
+
+// SavePlayerEffects persists the player's long-running effects (at least persistentEffectSeconds
+// left, or no expiry), buffs and ability cooldowns so they survive a logout. Their expiries are
+// saved as wall clock times: they keep running while the player is offline.
+func (gs *GameMatchState) SavePlayerEffects(ctx context.Context, playerID string) error {
+	saved := &PersistedEffects{PlayerID: playerID, Cooldowns: make(map[string]int64)}
+	state := gs.GetPlayerState(playerID)
+	now := time.Now().UnixMilli()
+	// expiresAt turns an expiry tick into a wall clock time; ok is false when too little is left
+	expiresAt := func(tick int64) (int64, bool) {
+		remaining := tick - gs.currentTick
+		return now + remaining*1000/TickRate, remaining >= int64(persistentEffectSeconds*TickRate)
+	}
+	for _, id := range sortedKeys(state.Effects) {
+		effect := state.Effects[id]
+		var at int64
+		if effect.ExpiresTick != 0 {
+			var ok bool
+			if at, ok = expiresAt(effect.ExpiresTick); !ok {
+				continue
+			}
+		}
+		saved.Effects = append(saved.Effects, PersistedEffect{ID: id, Stacks: effect.Stacks, ExpiresAt: at})
+	}
+	for _, stat := range sortedKeys(state.Buffs) {
+		buff := state.Buffs[stat]
+		if at, ok := expiresAt(buff.ExpiresTick); ok {
+			saved.Buffs = append(saved.Buffs, PersistedBuff{Stat: stat, Amount: buff.Amount, ExpiresAt: at})
+		}
+	}
+	for abilityID, ready := range state.AbilityReady {
+		if at, ok := expiresAt(ready); ok {
+			saved.Cooldowns[abilityID] = at
+		}
+	}
+	return gs.databaseManager.SavePlayerEffects(ctx, saved)
+}
+
+// RestorePlayerEffects reapplies the effects and buffs saved by SavePlayerEffects and resumes the
+// ability cooldowns, with the time that passed since dropped; whatever ran out meanwhile is gone
+func (gs *GameMatchState) RestorePlayerEffects(ctx context.Context, playerID string) error {
+	saved, err := gs.databaseManager.LoadPlayerEffects(ctx, playerID)
+	if err != nil {
+		return err
+	}
+	state := gs.GetPlayerState(playerID)
+	now := time.Now().UnixMilli()
+	// ticksUntil turns a wall clock time into the ticks left until it
+	ticksUntil := func(at int64) int64 {
+		return (at - now) * TickRate / 1000
+	}
+	for _, e := range saved.Effects {
+		remaining := e.Remaining
+		if e.ExpiresAt != 0 {
+			if remaining = float64(ticksUntil(e.ExpiresAt)) / TickRate; remaining <= 0 {
+				continue
+			}
+		}
+		for i := 0; i < e.Stacks || i == 0; i++ {
+			gs.ApplyEffect(playerID, e.ID, DamageSource{Type: DamageSourceEnvironment}, remaining)
+		}
+	}
+	for _, buff := range saved.Buffs {
+		if ticks := ticksUntil(buff.ExpiresAt); ticks > 0 {
+			state.AddBuff(buff.Stat, buff.Amount, gs.currentTick+ticks)
+		}
+	}
+	for abilityID, at := range saved.Cooldowns {
+		if ticks := ticksUntil(at); ticks > 0 {
+			state.AbilityReady[abilityID] = gs.currentTick + ticks
+		}
+	}
+	state.statusDirty = true
+	return nil
+}
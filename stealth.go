@@ -0,0 +1,240 @@
+package main
+
+import (
+	"math"
+
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+const stealthZoneObjectType = "stealth_zone"
+
+// Stealth tuning
+const (
+	stealthCheckInterval      = 6           // ticks between detection checks
+	stealthProximityRange     = 40.0        // anyone this close notices a hidden player, whichever way they face
+	stealthDetectionRange     = 160.0       // players and NPCs notice hidden players in front of them within this range
+	stealthDetectionHalfAngle = math.Pi / 3 // half-width of the detection cone
+	stealthDetectionLinger    = 2 * TickRate
+	stealthRevealTicks        = 3 * TickRate // attacking, casting or getting hurt keeps a player out of stealth this long
+)
+
+// StealthZone is a rectangular map area ("stealth_zone" objects, e.g. bushes) that hides the
+// players inside it while they don't sprint
+type StealthZone struct {
+	Name string
+	Min  vector.Vector
+	Max  vector.Vector
+}
+
+// Contains reports whether a point lies inside the zone
+func (z *StealthZone) Contains(p vector.Vector) bool {
+	return p.X >= z.Min.X && p.X <= z.Max.X && p.Y >= z.Min.Y && p.Y <= z.Max.Y
+}
+
+// StealthManager decides which players are hidden and who detected them. Hidden players are left
+// out of the world updates of everyone who hasn't detected them; invisible GMs are left out of
+// everyone's. It is only used from the match loop.
+type StealthManager struct {
+	hidden    map[string]bool
+	detected  map[string]map[string]int64 // hidden player -> viewer -> tick the detection lasts until
+	invisible map[string]bool             // GMs nobody can see or detect (gm.go)
+	nextCheck int64
+}
+
+// NewStealthManager creates a stealth manager with nobody hidden
+func NewStealthManager() *StealthManager {
+	return &StealthManager{
+		hidden:    make(map[string]bool),
+		detected:  make(map[string]map[string]int64),
+		invisible: make(map[string]bool),
+	}
+}
+
+// SetInvisible hides a GM from every other player and NPC, or shows them again
+func (sm *StealthManager) SetInvisible(playerID string, invisible bool) {
+	if invisible {
+		sm.invisible[playerID] = true
+	} else {
+		delete(sm.invisible, playerID)
+	}
+}
+
+// IsInvisible reports whether a GM made themselves invisible
+func (sm *StealthManager) IsInvisible(playerID string) bool {
+	return sm.invisible[playerID]
+}
+
+// InvisibleCount returns how many GMs in the match are invisible, whom player counts leave out
+func (sm *StealthManager) InvisibleCount(gs *GameMatchState) int {
+	count := 0
+	for playerID := range sm.invisible {
+		if _, ok := gs.presences[playerID]; ok {
+			count++
+		}
+	}
+	return count
+}
+
+// IsHidden reports whether a player is in stealth
+func (sm *StealthManager) IsHidden(playerID string) bool {
+	return sm.hidden[playerID]
+}
+
+// AnyHidden reports whether anyone is in stealth, so world updates can skip per-viewer filtering
+func (sm *StealthManager) AnyHidden() bool {
+	return len(sm.hidden) > 0 || len(sm.invisible) > 0
+}
+
+// CanSee reports whether viewer may see target: targets not in stealth, themselves, and hidden
+// players the viewer detected. Nobody else sees invisible GMs.
+func (sm *StealthManager) CanSee(viewerID, targetID string, tick int64) bool {
+	if viewerID == targetID {
+		return true
+	}
+	if sm.invisible[targetID] {
+		return false
+	}
+	if !sm.hidden[targetID] {
+		return true
+	}
+	return sm.detected[targetID][viewerID] >= tick
+}
+
+// Update works out who is hidden and which players detect them. Called from the match loop.
+func (sm *StealthManager) Update(gs *GameMatchState) {
+	tick := gs.currentTick
+	if tick < sm.nextCheck {
+		return
+	}
+	sm.nextCheck = tick + stealthCheckInterval
+
+	for playerID, rb := range gs.PlayerBodies() {
+		state := gs.GetPlayerState(playerID)
+		hidden := !state.IsDead() && tick >= state.StealthRevealedUntil &&
+			(state.HasEffectKind(EffectKindStealth) || (gs.inStealthZone(rb.Position) && !state.Sprinting))
+		if hidden != state.Stealthed {
+			state.Stealthed = hidden
+			state.statusDirty = true
+		}
+		if !hidden {
+			delete(sm.hidden, playerID)
+			delete(sm.detected, playerID)
+			continue
+		}
+		sm.hidden[playerID] = true
+
+		detections := sm.detected[playerID]
+		if detections == nil {
+			detections = make(map[string]int64)
+			sm.detected[playerID] = detections
+		}
+		for viewerID, viewer := range gs.PlayerBodies() {
+			if viewerID == playerID || gs.GetPlayerState(viewerID).IsDead() {
+				continue
+			}
+			if detects(gs, viewer.Position, gs.GetPlayerState(viewerID).Facing, rb.Position, stealthDetectionRange) {
+				detections[viewerID] = tick + stealthDetectionLinger
+			} else if detections[viewerID] < tick {
+				delete(detections, viewerID)
+			}
+		}
+		if detected := len(detections) > 0; detected != state.StealthDetected {
+			state.StealthDetected = detected
+			state.statusDirty = true
+		}
+	}
+	for playerID := range sm.hidden {
+		if gs.PlayerBody(playerID) == nil {
+			delete(sm.hidden, playerID)
+			delete(sm.detected, playerID)
+		}
+	}
+	for playerID := range sm.invisible {
+		if gs.PlayerBody(playerID) == nil {
+			delete(sm.invisible, playerID)
+		}
+	}
+}
+
+// NPCDetects reports whether an NPC notices a player: never when they are an invisible GM, always
+// unless the player is hidden, in which case the player must be close, or in front of the NPC
+// within the detection range (shortened by fog). Line of sight is checked by the caller.
+func (sm *StealthManager) NPCDetects(gs *GameMatchState, npc *NPC, playerID string, position vector.Vector) bool {
+	if sm.invisible[playerID] {
+		return false
+	}
+	if !sm.hidden[playerID] {
+		return true
+	}
+	return detects(gs, npc.Body.Position, npc.Facing, position, stealthDetectionRange*gs.weather.PerceptionScale())
+}
+
+// RevealStealth takes a player out of stealth for stealthRevealTicks: their stealth effects end
+// and stealth zones don't hide them meanwhile. Called when they attack, cast or get hurt.
+func (gs *GameMatchState) RevealStealth(playerID string) {
+	state, ok := gs.playerStates[playerID]
+	if !ok {
+		return
+	}
+	state.StealthRevealedUntil = gs.currentTick + stealthRevealTicks
+	for id, effect := range state.Effects {
+		if effect.Def.Kind == EffectKindStealth {
+			state.RemoveEffect(id)
+		}
+	}
+	if state.Stealthed {
+		state.Stealthed = false
+		state.StealthDetected = false
+		state.statusDirty = true
+		delete(gs.stealth.hidden, playerID)
+		delete(gs.stealth.detected, playerID)
+	}
+}
+
+// grantsStealth reports whether an ability puts its caster into stealth, so casting it doesn't
+// reveal them
+func (gs *GameMatchState) grantsStealth(def *AbilityDefinition) bool {
+	if def.Target != AbilityTargetSelf {
+		return false
+	}
+	for _, effectID := range def.Effects {
+		if effect, ok := gs.effectCatalog.Get(effectID); ok && effect.Kind == EffectKindStealth {
+			return true
+		}
+	}
+	return false
+}
+
+// inStealthZone reports whether a position lies in one of the map's stealth zones
+func (gs *GameMatchState) inStealthZone(p vector.Vector) bool {
+	if gs.currentMap == nil {
+		return false
+	}
+	for i := range gs.currentMap.StealthZones {
+		if gs.currentMap.StealthZones[i].Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// detects combines distance, facing and line of sight: a watcher notices a position right next to
+// them, or in their facing cone within maxRange with nothing in between
+func detects(gs *GameMatchState, watcher vector.Vector, facing float64, target vector.Vector, maxRange float64) bool {
+	distance := target.Sub(watcher).Magnitude()
+	if distance <= stealthProximityRange {
+		return true
+	}
+	return inFacingCone(watcher, facing, target, stealthDetectionHalfAngle, maxRange) && gs.HasLineOfSight(watcher, target, 0)
+}
+
+// visiblePlayers returns the world update players a viewer may see
+func (sm *StealthManager) visiblePlayers(viewerID string, players map[string]PlayerData, tick int64) map[string]PlayerData {
+	visible := make(map[string]PlayerData, len(players))
+	for playerID, data := range players {
+		if sm.CanSee(viewerID, playerID, tick) {
+			visible[playerID] = data
+		}
+	}
+	return visible
+}
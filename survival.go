@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"math"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Survival tuning. Meters run from 0 (starving, parched) to survivalMaxMeter (sated) and drain
+// per game hour, so they follow the map's day length. The map properties "survival" (enables the
+// meters), "hungerRate", "thirstRate", "hungerEffect" and "thirstEffect" configure them per map.
+const (
+	survivalMaxMeter       = 100.0
+	survivalCheckInterval  = TickRate // ticks between two meter updates
+	defaultHungerRate      = 4.0      // hunger lost per game hour
+	defaultThirstRate      = 6.0      // thirst lost per game hour
+	survivalLowMeter       = 25.0     // below this the meter's effect is applied
+	survivalDamageRate     = 2.0      // health lost per second for each empty meter
+	survivalRespawnMeter   = 50.0     // meters below this are raised to it on respawn
+	defaultHungerEffect    = "hungry"
+	defaultThirstEffect    = "thirsty"
+	survivalHungerSourceID = "hunger"
+	survivalThirstSourceID = "thirst"
+)
+
+// SurvivalStatus is the part of player_status carrying the survival meters, only on maps that
+// run them
+type SurvivalStatus struct {
+	Hunger  float64 `json:"hunger"`
+	Thirst  float64 `json:"thirst"`
+	Max     float64 `json:"max"`
+	Hungry  bool    `json:"hungry"`  // below survivalLowMeter
+	Thirsty bool    `json:"thirsty"` // below survivalLowMeter
+}
+
+// SurvivalManager runs the hunger and thirst meters of the players on maps with the "survival"
+// property. The meters live in PlayerState and are saved per player when they leave such a map.
+// It is only used from the match handlers.
+type SurvivalManager struct {
+	logger       runtime.Logger
+	dm           *DatabaseManager
+	enabled      bool
+	hungerRate   float64
+	thirstRate   float64
+	hungerEffect string
+	thirstEffect string
+}
+
+// NewSurvivalManager creates a survival manager that is off until Configure finds the "survival"
+// map property
+func NewSurvivalManager(logger runtime.Logger, dm *DatabaseManager) *SurvivalManager {
+	return &SurvivalManager{
+		logger:       logger,
+		dm:           dm,
+		hungerRate:   defaultHungerRate,
+		thirstRate:   defaultThirstRate,
+		hungerEffect: defaultHungerEffect,
+		thirstEffect: defaultThirstEffect,
+	}
+}
+
+// Configure applies the survival settings found in the map properties
+func (sm *SurvivalManager) Configure(props map[string]interface{}) {
+	sm.enabled, _ = props["survival"].(bool)
+	if v, ok := props["hungerRate"].(float64); ok && v >= 0 {
+		sm.hungerRate = v
+	}
+	if v, ok := props["thirstRate"].(float64); ok && v >= 0 {
+		sm.thirstRate = v
+	}
+	if v, ok := props["hungerEffect"].(string); ok {
+		sm.hungerEffect = v
+	}
+	if v, ok := props["thirstEffect"].(string); ok {
+		sm.thirstEffect = v
+	}
+	if sm.enabled {
+		sm.logger.Info("Survival meters on: hunger -%.1f, thirst -%.1f per game hour", sm.hungerRate, sm.thirstRate)
+	}
+}
+
+// LoadPlayer restores the meters a joining player left with (full for new players)
+func (sm *SurvivalManager) LoadPlayer(ctx context.Context, gs *GameMatchState, playerID string) {
+	if !sm.enabled {
+		return
+	}
+	state := gs.GetPlayerState(playerID)
+	state.Survival = true
+	state.Hunger = survivalMaxMeter
+	state.Thirst = survivalMaxMeter
+	saved, err := sm.dm.LoadSurvival(ctx, playerID)
+	if err != nil || saved == nil {
+		return
+	}
+	state.Hunger = math.Max(0, math.Min(survivalMaxMeter, saved.Hunger))
+	state.Thirst = math.Max(0, math.Min(survivalMaxMeter, saved.Thirst))
+	state.statusDirty = true
+}
+
+// SavePlayer persists the meters of a player who leaves
+func (sm *SurvivalManager) SavePlayer(ctx context.Context, gs *GameMatchState, playerID string) error {
+	if !sm.enabled {
+		return nil
+	}
+	state := gs.GetPlayerState(playerID)
+	return sm.dm.SaveSurvival(ctx, &PersistedSurvival{PlayerID: playerID, Hunger: state.Hunger, Thirst: state.Thirst})
+}
+
+// Update drains the meters of the living players, keeps the low-meter effects on those running
+// low and hurts those with an empty meter. Called from the match loop.
+func (sm *SurvivalManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if !sm.enabled || gs.currentTick%survivalCheckInterval != 0 {
+		return
+	}
+	gameHours := float64(survivalCheckInterval) / TickRate * 24 / gs.worldClock.DayLength
+	seconds := float64(survivalCheckInterval) / TickRate
+	for playerID := range gs.PlayerBodies() {
+		state := gs.GetPlayerState(playerID)
+		if !state.Survival || state.IsDead() || state.GodMode {
+			continue
+		}
+		sm.drain(state, &state.Hunger, sm.hungerRate*gameHours)
+		sm.drain(state, &state.Thirst, sm.thirstRate*gameHours)
+
+		for _, meter := range []struct {
+			value  float64
+			effect string
+			source string
+		}{{state.Hunger, sm.hungerEffect, survivalHungerSourceID}, {state.Thirst, sm.thirstEffect, survivalThirstSourceID}} {
+			source := DamageSource{Type: DamageSourceEnvironment, ID: meter.source}
+			if meter.value < survivalLowMeter && meter.effect != "" {
+				gs.ApplyEffect(playerID, meter.effect, source, 0)
+			}
+			if meter.value == 0 {
+				gs.damagePlayer(playerID, source, survivalDamageRate*seconds, DamageTrue, 0, dispatcher, logger)
+			}
+		}
+	}
+}
+
+// drain lowers a meter, marking the status dirty when its whole number changes so the owner
+// isn't sent a status every second
+func (sm *SurvivalManager) drain(state *PlayerState, meter *float64, amount float64) {
+	before := *meter
+	*meter = math.Max(0, *meter-amount)
+	if math.Ceil(before) != math.Ceil(*meter) {
+		state.statusDirty = true
+	}
+}
+
+// CanFeed reports whether a consumable restoring hunger and thirst would raise a meter that
+// isn't full
+func (ps *PlayerState) CanFeed(hunger, thirst float64) bool {
+	return (hunger > 0 && ps.Hunger < survivalMaxMeter) || (thirst > 0 && ps.Thirst < survivalMaxMeter)
+}
+
+// Feed raises the meters by what a consumable restores
+func (ps *PlayerState) Feed(hunger, thirst float64) {
+	if !ps.CanFeed(hunger, thirst) {
+		return
+	}
+	ps.Hunger = math.Min(survivalMaxMeter, ps.Hunger+math.Max(0, hunger))
+	ps.Thirst = math.Min(survivalMaxMeter, ps.Thirst+math.Max(0, thirst))
+	ps.statusDirty = true
+}
+
+// reviveMeters raises low meters on respawn so players don't starve again right away
+func (ps *PlayerState) reviveMeters() {
+	if !ps.Survival {
+		return
+	}
+	ps.Hunger = math.Max(ps.Hunger, survivalRespawnMeter)
+	ps.Thirst = math.Max(ps.Thirst, survivalRespawnMeter)
+}
+
+// SurvivalStatus returns the meters for player_status, or nil when the map doesn't run them
+func (ps *PlayerState) SurvivalStatus() *SurvivalStatus {
+	if !ps.Survival {
+		return nil
+	}
+	return &SurvivalStatus{
+		Hunger:  math.Round(ps.Hunger*10) / 10,
+		Thirst:  math.Round(ps.Thirst*10) / 10,
+		Max:     survivalMaxMeter,
+		Hungry:  ps.Hunger < survivalLowMeter,
+		Thirsty: ps.Thirst < survivalLowMeter,
+	}
+}
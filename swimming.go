@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Movement modes reported in world updates so clients pick the matching animation set
+const (
+	MoveModeWalk = "walk"
+	MoveModeSwim = "swim"
+)
+
+// Swimming tuning. Rates are per second.
+const (
+	swimSpeedMultiplier = 0.5   // swimming halves the movement cap
+	swimDrag            = 0.85  // water slows bodies faster than ground (see defaultDrag)
+	defaultMaxOxygen    = 100.0 // oxygen is only spent in deep water
+	oxygenDrainRate     = 10.0  // oxygen spent per second while submerged in deep water
+	oxygenRegenRate     = 25.0  // oxygen recovered per second outside deep water
+	drowningDamageRate  = 10.0  // health lost per second with no oxygen left
+)
+
+// WaterVolume is a rectangular map area ("water" objects) where players swim.
+// Deep volumes also use up the oxygen meter.
+type WaterVolume struct {
+	Min  vector.Vector
+	Max  vector.Vector
+	Deep bool
+}
+
+// Contains reports whether a point lies inside the volume
+func (w *WaterVolume) Contains(p vector.Vector) bool {
+	return p.X >= w.Min.X && p.X <= w.Max.X && p.Y >= w.Min.Y && p.Y <= w.Max.Y
+}
+
+// WaterAt reports whether a position is in water (a water volume or a tile with the "water"
+// property) and whether that water is deep
+func (gs *GameMatchState) WaterAt(position vector.Vector) (inWater bool, deep bool) {
+	if gs.currentMap == nil {
+		return false, false
+	}
+	for i := range gs.currentMap.WaterVolumes {
+		volume := &gs.currentMap.WaterVolumes[i]
+		if volume.Contains(position) {
+			inWater = true
+			deep = deep || volume.Deep
+		}
+	}
+	if !inWater {
+		if tile := gs.mapLoader.GetTileAt(gs.currentMap, position.X, position.Y, ""); tile != nil {
+			inWater, _ = tile.Properties["water"].(bool)
+		}
+	}
+	return inWater, deep
+}
+
+// updateSwimming switches the player between walking and swimming, adjusts their drag and
+// runs the oxygen meter. Without oxygen the player takes drowning damage.
+func (gs *GameMatchState) updateSwimming(state *PlayerState, rb *rigidbody.RigidBody) {
+	inWater, deep := gs.WaterAt(rb.Position)
+
+	mode := MoveModeWalk
+	if inWater && state.MountID == 0 {
+		mode = MoveModeSwim
+	}
+	if mode != state.MoveMode {
+		state.MoveMode = mode
+		if mode == MoveModeSwim {
+			state.Sprinting = false
+			gs.physicsEngine.SetDrag(rb, swimDrag)
+		} else {
+			gs.physicsEngine.SetDrag(rb, 0)
+		}
+	}
+
+	if mode == MoveModeSwim && deep {
+		state.Oxygen = max(0, state.Oxygen-oxygenDrainRate/TickRate)
+		if state.Oxygen == 0 && !state.GodMode {
+			state.Health = max(0, state.Health-drowningDamageRate/TickRate)
+		}
+		state.statusDirty = true
+	} else if state.Oxygen < state.MaxOxygen {
+		state.Oxygen = min(state.MaxOxygen, state.Oxygen+oxygenRegenRate/TickRate)
+		state.statusDirty = true
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Targeting tuning
+const (
+	targetRange            = 480.0 // max distance (pixels) to acquire a target
+	targetLockBreakRange   = 640.0 // a locked target further than this is dropped
+	targetValidateInterval = 15    // ticks between lock validations
+)
+
+// PlayerTarget is the entity a player is locked onto: another player or a scripted object
+type PlayerTarget struct {
+	PlayerID string `json:"playerId,omitempty"`
+	ObjectID int    `json:"objectId,omitempty"`
+}
+
+// SetTarget locks the player onto target
+func (ps *PlayerState) SetTarget(target *PlayerTarget) {
+	ps.Target = target
+	ps.statusDirty = true
+}
+
+// ClearTarget drops the player's target lock
+func (ps *PlayerState) ClearTarget() {
+	if ps.Target == nil {
+		return
+	}
+	ps.Target = nil
+	ps.statusDirty = true
+}
+
+// targetPosition returns the world position of a target and whether it still exists
+func (gs *GameMatchState) targetPosition(target *PlayerTarget) (vector.Vector, bool) {
+	if target.PlayerID != "" {
+		rb := gs.PlayerBody(target.PlayerID)
+		if rb == nil {
+			return vector.Vector{}, false
+		}
+		return rb.Position, true
+	}
+	obj, ok := gs.Object(target.ObjectID)
+	if !ok {
+		return vector.Vector{}, false
+	}
+	return obj.Position()
+}
+
+// validateTarget checks that target exists, is within maxRange of body and in line of sight.
+// It returns a rejection reason, or "" if the target is valid.
+func (gs *GameMatchState) validateTarget(body *rigidbody.RigidBody, target *PlayerTarget, maxRange float64) string {
+	pos, ok := gs.targetPosition(target)
+	if !ok {
+		return RejectInvalidTarget
+	}
+	if pos.Sub(body.Position).Magnitude() > maxRange {
+		return RejectOutOfRange
+	}
+	if !gs.HasLineOfSight(body.Position, pos, target.ObjectID) {
+		return RejectNoLineOfSight
+	}
+	return ""
+}
+
+// ValidateTargets drops target locks whose target disappeared, moved out of range or behind a wall.
+// Called from the match loop.
+func (gs *GameMatchState) ValidateTargets() {
+	if gs.currentTick%targetValidateInterval != 0 {
+		return
+	}
+	for playerID, state := range inOrder(sortedKeys(gs.playerStates), gs.playerStates) {
+		if state.Target == nil {
+			continue
+		}
+		rb := gs.PlayerBody(playerID)
+		if rb == nil || gs.validateTarget(rb, state.Target, targetLockBreakRange) != "" {
+			state.ClearTarget()
+			continue
+		}
+		// Locks on players who slipped into stealth break once they are out of sight
+		if state.Target.PlayerID != "" && !gs.stealth.CanSee(playerID, state.Target.PlayerID, gs.currentTick) {
+			state.ClearTarget()
+		}
+	}
+}
+
+// HasLineOfSight reports whether no static collider blocks the segment from -> to. Colliders owned
+// by ignoreOwner (e.g. the target object's own colliders) don't block; pass 0 to ignore none.
+func (gs *GameMatchState) HasLineOfSight(from, to vector.Vector, ignoreOwner int) bool {
+	var owned []*rigidbody.RigidBody
+	if ignoreOwner != 0 {
+		gs.mu.Lock()
+		owned = gs.entities.ObjectColliders(ignoreOwner)
+		gs.mu.Unlock()
+	}
+	ignore := func(rb *rigidbody.RigidBody) bool {
+		for _, o := range owned {
+			if o == rb {
+				return true
+			}
+		}
+		return false
+	}
+	return !gs.physicsEngine.Raycast(from, to, gs.gameObjects, ignore)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// teleportSearchCells is how far (nav cells) a blocked teleport destination is moved to the
+// nearest free spot before the teleport is refused
+const teleportSearchCells = 8
+
+// Teleport moves a player's body to a destination, stops it and queues a position correction
+// with the cause. Scripts, waypoints, respawns and GM commands all teleport through it, so the
+// destination is validated the same way for each: it is clamped into the world bounds, and one
+// where the body would stand in a wall is moved to the nearest free spot (SafePosition). It
+// returns where the player ended up, or false, leaving them in place, if they have no body or
+// nothing near the destination is free.
+func (gs *GameMatchState) Teleport(playerID string, target vector.Vector, cause string) (vector.Vector, bool) {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return vector.Vector{}, false
+	}
+	position, ok := gs.SafePosition(rb, target)
+	if !ok {
+		return vector.Vector{}, false
+	}
+	rb.Position = position
+	rb.Velocity = vector.Vector{X: 0, Y: 0}
+	gs.corrections.Queue(playerID, cause)
+	return position, true
+}
+
+// SafePosition returns where a body can stand closest to a target: the target itself, clamped
+// into the world bounds, when the body fits there without overlapping a static collider it
+// collides with, otherwise the nearest nav grid cell it fits in, searched ring by ring up to
+// teleportSearchCells away. No-clip bodies fit anywhere inside the world.
+func (gs *GameMatchState) SafePosition(rb *rigidbody.RigidBody, target vector.Vector) (vector.Vector, bool) {
+	pe := gs.physicsEngine
+	if pe == nil {
+		return target, true
+	}
+	target = clampToWorld(pe.GetWorldBounds(), rb, target)
+	if pe.noClip[rb] {
+		return target, true
+	}
+
+	gs.mu.Lock()
+	walls := make([]*rigidbody.RigidBody, 0, len(gs.gameObjects))
+	for _, wall := range gs.gameObjects {
+		if !wall.IsMovable && pe.CollisionsEnabled(wall) && pe.canCollide(rb, wall) {
+			walls = append(walls, wall)
+		}
+	}
+	gs.mu.Unlock()
+
+	if bodyFits(pe, rb, target, walls) {
+		return target, true
+	}
+	grid := gs.pathfinder.Grid(gs)
+	if grid == nil {
+		return target, false
+	}
+	cx, cy := grid.cellAt(target)
+	for r := 1; r <= teleportSearchCells; r++ {
+		best, bestDist := target, math.Inf(1)
+		for dy := -r; dy <= r; dy++ {
+			for dx := -r; dx <= r; dx++ {
+				if dx != -r && dx != r && dy != -r && dy != r || !grid.Walkable(cx+dx, cy+dy) {
+					continue
+				}
+				p := clampToWorld(pe.GetWorldBounds(), rb, grid.center(cx+dx, cy+dy))
+				if dist := p.Sub(target).Magnitude(); dist < bestDist && bodyFits(pe, rb, p, walls) {
+					best, bestDist = p, dist
+				}
+			}
+		}
+		if !math.IsInf(bestDist, 1) {
+			return best, true
+		}
+	}
+	return target, false
+}
+
+// clampToWorld moves a body's position inside the world bounds, as the physics engine keeps it
+func clampToWorld(bounds WorldBounds, rb *rigidbody.RigidBody, p vector.Vector) vector.Vector {
+	halfW, halfH := rb.Width/2, rb.Height/2
+	p.X = math.Max(bounds.MinX+halfW, math.Min(p.X, bounds.MaxX-halfW))
+	p.Y = math.Max(bounds.MinY+halfH, math.Min(p.Y, bounds.MaxY-halfH))
+	return p
+}
+
+// bodyFits reports whether a body placed at a position overlaps none of the walls
+func bodyFits(pe *PhysicsEngine, rb *rigidbody.RigidBody, p vector.Vector, walls []*rigidbody.RigidBody) bool {
+	probe := *rb
+	probe.Position = p
+	for _, wall := range walls {
+		if pe.aabbOverlap(&probe, wall) && pe.detectCollision(&probe, wall).collided {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Terrain speed bounds: a tile can't stop bodies outright or more than double their speed
+const (
+	minTerrainSpeed = 0.1
+	maxTerrainSpeed = 2.0
+)
+
+// TerrainSpeedAt returns the factor the ground at a position applies to movement speed (1 on
+// normal ground). It comes from the topmost tile with a "move_cost" (speed is divided by it: 2
+// halves it, 0.8 makes a road faster) or "slow_factor" (share of speed taken away: 0.3 = 30%
+// slower) property, so swamps, roads and snow need no colliders.
+func (gs *GameMatchState) TerrainSpeedAt(position vector.Vector) float64 {
+	lm := gs.currentMap
+	if lm == nil || lm.TileWidth <= 0 || lm.TileHeight <= 0 || position.X < 0 || position.Y < 0 {
+		return 1
+	}
+	tx := int(position.X) / lm.TileWidth
+	ty := int(position.Y) / lm.TileHeight
+	for i := len(lm.TileLayers) - 1; i >= 0; i-- {
+		layer := &lm.TileLayers[i]
+		if tx >= layer.Width || ty >= layer.Height {
+			continue
+		}
+		gid := layer.Data[ty*layer.Width+tx]
+		if gid == 0 {
+			continue
+		}
+		props := lm.TileProperties[int(gid)]
+		cost, hasCost := props["move_cost"].(float64)
+		slow, hasSlow := props["slow_factor"].(float64)
+		if !hasCost && !hasSlow {
+			continue
+		}
+		factor := 1.0
+		if hasCost && cost > 0 {
+			factor /= cost
+		}
+		if hasSlow {
+			factor *= 1 - slow
+		}
+		return math.Max(minTerrainSpeed, math.Min(maxTerrainSpeed, factor))
+	}
+	return 1
+}
+
+// updateTerrain applies the speed factor of the tile under a player, slowing them down at once
+// when they step onto slower ground
+func (gs *GameMatchState) updateTerrain(state *PlayerState, rb *rigidbody.RigidBody) {
+	factor := gs.TerrainSpeedAt(rb.Position)
+	if factor == state.TerrainSpeed {
+		return
+	}
+	state.TerrainSpeed = factor
+	if limit := state.MaxSpeed(gs.config.PlayerMaxSpeed, gs.currentTick); rb.Velocity.Magnitude() > limit {
+		rb.Velocity = rb.Velocity.Scale(limit / rb.Velocity.Magnitude())
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+)
+
+// Control point events published on the event bus
+const (
+	EventControlPointCaptured = "control_point_captured" // objectId, name, owner, ownerName, previous
+)
+
+// Control point tuning. The object properties "radius", "captureTime", "reward", "rewardAmount"
+// and "rewardInterval" override the defaults per point.
+const (
+	controlPointObjectType       = "control_point" // ObjectData.Type of capturable points
+	controlPointCheckInterval    = TickRate / 4    // ticks between two capture updates
+	defaultControlPointRadius    = 3 * TileSize
+	defaultControlPointCapture   = 30.0  // seconds one player needs to capture a point
+	defaultControlPointReward    = 300.0 // seconds between two rewards to the owner
+	controlPointMaxSpeedup       = 2.0   // capture speed multiplier cap for several capturers
+	controlPointSpeedupPerPlayer = 0.5   // extra capture speed per additional capturer
+	controlPointDecayScale       = 0.5   // unattended progress drains at half the capture speed
+	controlPointProgressStep     = 0.05  // progress is mirrored to clients in steps of this size
+)
+
+// Faction prefixes of control point owners
+const (
+	factionGuild = "guild:"
+	factionTeam  = "team:"
+)
+
+// ControlPoint is a capturable map object. Players of one guild (or, outside guilds, one team)
+// standing alone in its capture area raise its progress until they own it.
+type ControlPoint struct {
+	ObjectID       int
+	Name           string
+	Sensor         *rigidbody.RigidBody // capture area, queried for overlapping player bodies
+	CaptureSeconds float64
+	RewardItem     string
+	RewardAmount   int
+	RewardSeconds  float64
+	Owner          string  // faction key ("guild:<id>" or "team:<name>"), "" when neutral
+	OwnerName      string  // guild tag or team name
+	Capturer       string  // faction currently raising the progress
+	Progress       float64 // 0..1 toward Capturer taking the point
+	Contested      bool    // several factions stand in the area
+	CapturedAt     int64   // unix seconds
+	NextReward     int64   // unix seconds of the owner's next reward
+}
+
+// ControlPointData is a control point as sent to clients (world_state "controlPoints")
+type ControlPointData struct {
+	ObjectID  int     `json:"objectId"`
+	Name      string  `json:"name"`
+	Owner     string  `json:"owner,omitempty"`
+	OwnerName string  `json:"ownerName,omitempty"`
+	Capturer  string  `json:"capturer,omitempty"`
+	Progress  float64 `json:"progress"`
+	Contested bool    `json:"contested,omitempty"`
+}
+
+// controlPointReward is a reward due to a point's owner, paid outside the manager lock
+type controlPointReward struct {
+	point  string
+	owner  string
+	itemID string
+	count  int
+}
+
+// ControlPointManager runs the capture loop of the map's control points and pays their owners.
+// Ownership and reward timers use wall clock time and are persisted per map.
+type ControlPointManager struct {
+	logger runtime.Logger
+	points map[int]*ControlPoint // object ID -> point
+	dirty  bool                  // ownership changed since the last save
+	mu     sync.Mutex
+}
+
+// NewControlPointManager creates an empty control point manager
+func NewControlPointManager(logger runtime.Logger) *ControlPointManager {
+	return &ControlPointManager{
+		logger: logger,
+		points: make(map[int]*ControlPoint),
+	}
+}
+
+// LoadFromMap registers every "control_point" object of the current map
+func (cm *ControlPointManager) LoadFromMap(gs *GameMatchState) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.points = make(map[int]*ControlPoint)
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for oid, obj := range gs.Objects() {
+		if !strings.EqualFold(obj.Type, controlPointObjectType) {
+			continue
+		}
+		pos, ok := obj.Position()
+		if !ok {
+			cm.logger.Warn("Control point %d (%s) has no position; skipping", oid, obj.Name)
+			continue
+		}
+		radius := defaultControlPointRadius
+		if v, ok := obj.Props["radius"].(float64); ok && v > 0 {
+			radius = v
+		}
+		point := &ControlPoint{
+			ObjectID:       oid,
+			Name:           obj.Name,
+			Sensor:         MakeCircleRigidBody(pos.X, pos.Y, radius),
+			CaptureSeconds: defaultControlPointCapture,
+			RewardAmount:   1,
+			RewardSeconds:  defaultControlPointReward,
+		}
+		if v, ok := obj.Props["capturetime"].(float64); ok && v > 0 {
+			point.CaptureSeconds = v
+		}
+		point.RewardItem, _ = obj.Props["reward"].(string)
+		if v, ok := obj.Props["rewardamount"].(float64); ok && v > 0 {
+			point.RewardAmount = int(v)
+		}
+		if v, ok := obj.Props["rewardinterval"].(float64); ok && v > 0 {
+			point.RewardSeconds = v
+		}
+		obj.Props["radius"] = radius
+		cm.points[oid] = point
+	}
+	cm.logger.Info("Registered %d control points", len(cm.points))
+}
+
+// Update advances the capture progress of every point from the players standing in it and pays
+// the owners whose reward is due. Called from the match loop.
+func (cm *ControlPointManager) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick%controlPointCheckInterval != 0 {
+		return
+	}
+	dt := float64(controlPointCheckInterval) / TickRate
+	now := time.Now().Unix()
+
+	cm.mu.Lock()
+	if len(cm.points) == 0 {
+		cm.mu.Unlock()
+		return
+	}
+	changed := make([]*ControlPoint, 0)
+	rewards := make([]controlPointReward, 0)
+	for _, point := range cm.points {
+		before := point.mirror()
+		cm.advance(gs, point, cm.presentFactions(gs, point), dt, now)
+		if point.mirror() != before {
+			changed = append(changed, point)
+		}
+		if point.Owner != "" && point.RewardItem != "" && now >= point.NextReward {
+			point.NextReward = now + int64(point.RewardSeconds)
+			cm.dirty = true
+			rewards = append(rewards, controlPointReward{point: point.Name, owner: point.Owner, itemID: point.RewardItem, count: point.RewardAmount})
+		}
+	}
+	cm.mu.Unlock()
+
+	for _, point := range changed {
+		gs.setControlPointProps(point, dispatcher, cm.logger)
+	}
+	for _, reward := range rewards {
+		cm.payReward(ctx, gs, reward, dispatcher)
+	}
+}
+
+// presentFactions counts the living players of each faction whose bodies overlap the capture
+// area. Players without a guild or team don't take part.
+func (cm *ControlPointManager) presentFactions(gs *GameMatchState, point *ControlPoint) map[string]int {
+	pe := gs.physicsEngine
+	present := make(map[string]int)
+	for playerID, rb := range gs.PlayerBodies() {
+		if gs.GetPlayerState(playerID).IsDead() {
+			continue
+		}
+		if !pe.aabbOverlap(rb, point.Sensor) || !pe.detectCollision(rb, point.Sensor).collided {
+			continue
+		}
+		if faction := gs.factionOf(playerID); faction != "" {
+			present[faction]++
+		}
+	}
+	return present
+}
+
+// advance applies one capture step. A lone faction first drains another faction's progress, then
+// builds its own; the owner drains attackers' progress; several factions freeze it; an empty
+// area lets it decay. Called with the lock held.
+func (cm *ControlPointManager) advance(gs *GameMatchState, point *ControlPoint, present map[string]int, dt float64, now int64) {
+	point.Contested = len(present) > 1
+	rate := dt / point.CaptureSeconds
+	switch len(present) {
+	case 0:
+		point.drain(rate * controlPointDecayScale)
+	case 1:
+		for faction, count := range present {
+			speed := math.Min(controlPointMaxSpeedup, 1+controlPointSpeedupPerPlayer*float64(count-1))
+			switch {
+			case faction == point.Owner:
+				point.drain(rate * speed)
+			case point.Capturer != faction && point.Progress > 0:
+				point.drain(rate * speed)
+			default:
+				point.Capturer = faction
+				point.Progress += rate * speed
+				if point.Progress >= 1 {
+					cm.capture(gs, point, faction, now)
+				}
+			}
+		}
+	}
+}
+
+// capture hands the point to a faction. Called with the lock held.
+func (cm *ControlPointManager) capture(gs *GameMatchState, point *ControlPoint, faction string, now int64) {
+	previous := point.OwnerName
+	point.Owner = faction
+	point.OwnerName = factionName(faction)
+	point.Capturer = ""
+	point.Progress = 0
+	point.CapturedAt = now
+	point.NextReward = now + int64(point.RewardSeconds)
+	cm.dirty = true
+	cm.logger.Info("Control point %s captured by %s", point.Name, point.OwnerName)
+	gs.eventBus.Publish(EventControlPointCaptured, map[string]any{
+		"objectId":  point.ObjectID,
+		"name":      point.Name,
+		"owner":     point.Owner,
+		"ownerName": point.OwnerName,
+		"previous":  previous,
+	})
+}
+
+// drain lowers the progress and forgets the capturer once it reaches zero
+func (p *ControlPoint) drain(amount float64) {
+	if p.Progress -= amount; p.Progress <= 0 {
+		p.Progress = 0
+		p.Capturer = ""
+	}
+}
+
+// mirror returns the state clients see, with the progress rounded to controlPointProgressStep
+func (p *ControlPoint) mirror() ControlPointData {
+	return ControlPointData{
+		ObjectID:  p.ObjectID,
+		Name:      p.Name,
+		Owner:     p.Owner,
+		OwnerName: p.OwnerName,
+		Capturer:  p.Capturer,
+		Progress:  math.Floor(p.Progress/controlPointProgressStep) * controlPointProgressStep,
+		Contested: p.Contested,
+	}
+}
+
+// payReward deposits a guild owner's reward into the guild bank, or gives a team owner's reward
+// to every online member of the team
+func (cm *ControlPointManager) payReward(ctx context.Context, gs *GameMatchState, reward controlPointReward, dispatcher runtime.MatchDispatcher) {
+	if guildID, ok := strings.CutPrefix(reward.owner, factionGuild); ok {
+		if err := gs.guilds.CreditBank(ctx, gs, guildID, reward.itemID, reward.count, dispatcher); err != nil {
+			cm.logger.Error("Failed to pay control point %s reward to guild %s: %v", reward.point, guildID, err)
+		}
+		return
+	}
+	team := strings.TrimPrefix(reward.owner, factionTeam)
+	for playerID := range gs.Presences() {
+		if gs.GetPlayerState(playerID).Team != team {
+			continue
+		}
+		if err := gs.inventoryManager.Add(ctx, playerID, reward.itemID, reward.count); err != nil {
+			cm.logger.Error("Failed to pay control point %s reward to %s: %v", reward.point, playerID, err)
+			continue
+		}
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	}
+}
+
+// Snapshot returns the control points for clients, ordered by object ID
+func (cm *ControlPointManager) Snapshot() []ControlPointData {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	points := make([]ControlPointData, 0, len(cm.points))
+	for _, point := range cm.points {
+		points = append(points, point.mirror())
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].ObjectID < points[j].ObjectID })
+	return points
+}
+
+// Save persists the owners and reward timers if ownership changed since the last save
+func (cm *ControlPointManager) Save(ctx context.Context, dm *DatabaseManager, mapName string) error {
+	cm.mu.Lock()
+	if !cm.dirty {
+		cm.mu.Unlock()
+		return nil
+	}
+	saved := &PersistedControlPoints{Map: mapName, Points: make(map[int]PersistedControlPoint)}
+	for oid, point := range cm.points {
+		if point.Owner != "" {
+			saved.Points[oid] = PersistedControlPoint{
+				Owner:      point.Owner,
+				OwnerName:  point.OwnerName,
+				CapturedAt: point.CapturedAt,
+				NextReward: point.NextReward,
+			}
+		}
+	}
+	cm.dirty = false
+	cm.mu.Unlock()
+
+	if err := dm.SaveControlPoints(ctx, saved); err != nil {
+		// Keep the dirty flag so the next periodic save retries
+		cm.mu.Lock()
+		cm.dirty = true
+		cm.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Restore gives the map's control points back to the owners saved before a restart
+func (cm *ControlPointManager) Restore(ctx context.Context, gs *GameMatchState) error {
+	saved, err := gs.databaseManager.LoadControlPoints(ctx, gs.currentMapName)
+	if err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	restored := make([]*ControlPoint, 0, len(saved.Points))
+	for oid, owner := range saved.Points {
+		point, ok := cm.points[oid]
+		if !ok {
+			continue
+		}
+		point.Owner = owner.Owner
+		point.OwnerName = owner.OwnerName
+		point.CapturedAt = owner.CapturedAt
+		point.NextReward = owner.NextReward
+		restored = append(restored, point)
+	}
+	cm.mu.Unlock()
+
+	for _, point := range restored {
+		gs.setControlPointProps(point, nil, cm.logger)
+	}
+	cm.logger.Info("Restored %d owned control points", len(restored))
+	return nil
+}
+
+// factionOf returns the faction a player captures for: their guild, else their team ("" for neither)
+func (gs *GameMatchState) factionOf(playerID string) string {
+	if guildID := gs.guilds.GuildOf(playerID); guildID != "" {
+		return factionGuild + guildID
+	}
+	if team := gs.GetPlayerState(playerID).Team; team != "" {
+		return factionTeam + team
+	}
+	return ""
+}
+
+// factionName returns the display name of a faction key
+func factionName(faction string) string {
+	if guildID, ok := strings.CutPrefix(faction, factionGuild); ok {
+		return strings.ToUpper(guildID)
+	}
+	return strings.TrimPrefix(faction, factionTeam)
+}
+
+// setControlPointProps mirrors a point's owner and progress into its object properties so
+// clients can show them, and broadcasts the change
+func (gs *GameMatchState) setControlPointProps(point *ControlPoint, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	data := point.mirror()
+	gs.mu.Lock()
+	obj, ok := gs.Object(point.ObjectID)
+	if ok {
+		obj.Props["owner"] = data.OwnerName
+		obj.Props["capturer"] = factionName(data.Capturer)
+		obj.Props["progress"] = data.Progress
+		obj.Props["contested"] = data.Contested
+	}
+	gs.mu.Unlock()
+	if ok {
+		gs.BroadcastObjectUpdate(point.ObjectID, dispatcher, logger)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// hazardFramesProperty is the tile property listing the frames of an animated tile that hurt
+const hazardFramesProperty = "hazardFrames"
+
+// TiledFrame is a frame of a Tiled tile animation
+type TiledFrame struct {
+	TileID   int `json:"tileid"`
+	Duration int `json:"duration"` // ms
+}
+
+// TileAnimation is the frame loop of an animated tile. The server keeps the loop's clock so that
+// what depends on the frame (the hazard of a spike trap) follows the same timing for every
+// client: the loop starts at tick 0 of the match and runs at the match's tick rate.
+type TileAnimation struct {
+	Durations []int64 // ms per frame
+	Loop      int64   // ms of one loop
+	Damaging  []bool  // per frame: whether the tile's hazard is live
+}
+
+// FrameAt returns the frame shown at a tick
+func (a *TileAnimation) FrameAt(tick int64) int {
+	if a.Loop <= 0 {
+		return 0
+	}
+	ms := (tick * 1000 / TickRate) % a.Loop
+	for i, d := range a.Durations {
+		if ms < d {
+			return i
+		}
+		ms -= d
+	}
+	return len(a.Durations) - 1
+}
+
+// DamagingAt reports whether the tile's hazard is live at a tick
+func (a *TileAnimation) DamagingAt(tick int64) bool {
+	frame := a.FrameAt(tick)
+	return frame < len(a.Damaging) && a.Damaging[frame]
+}
+
+// processTileAnimations reads the animations of the tilesets' animated tiles, keyed by global tile
+// ID, and returns the hazard of every animated tile with a hazardFrames property. Its damage,
+// damageType, interval and effect properties are read like a hazard object's.
+func (ml *MapLoader) processTileAnimations(tilesetData map[int]*TiledTilesetData, lm *LoadedMap) map[int]HazardZone {
+	hazards := make(map[int]HazardZone)
+	for firstGID, tileset := range tilesetData {
+		for _, tile := range tileset.Tiles {
+			if len(tile.Animation) == 0 {
+				continue
+			}
+			gid := firstGID + tile.ID
+			anim := &TileAnimation{Durations: make([]int64, len(tile.Animation)), Damaging: make([]bool, len(tile.Animation))}
+			for i, frame := range tile.Animation {
+				anim.Durations[i] = int64(max(float64(frame.Duration), 1))
+				anim.Loop += anim.Durations[i]
+			}
+			lm.TileAnimations[gid] = anim
+
+			var frames string
+			for _, p := range tile.Properties {
+				if strings.EqualFold(p.Name, hazardFramesProperty) {
+					frames, _ = p.Value.(string)
+				}
+			}
+			if frames == "" {
+				continue
+			}
+			for _, field := range strings.Split(frames, ",") {
+				i, err := strconv.Atoi(strings.TrimSpace(field))
+				if err != nil || i < 0 || i >= len(anim.Damaging) {
+					ml.logger.Warn("Animated tile %d has invalid hazard frame %q; ignoring it", gid, field)
+					continue
+				}
+				anim.Damaging[i] = true
+			}
+			name := tile.Type
+			if name == "" {
+				name = hazardObjectType
+			}
+			if zone, ok := ml.parseHazard(&TiledObject{ID: gid, Name: name, Properties: tile.Properties}); ok {
+				zone.Animation = anim
+				hazards[gid] = zone
+			}
+		}
+	}
+	return hazards
+}
+
+// placeHazardTiles adds a hazard over every cell of the tile layers showing an animated hazard tile
+func (ml *MapLoader) placeHazardTiles(hazards map[int]HazardZone, lm *LoadedMap) {
+	if len(hazards) == 0 {
+		return
+	}
+	placed := 0
+	for _, layer := range lm.TileLayers {
+		for i, gid := range layer.Data {
+			zone, ok := hazards[int(gid)]
+			if !ok {
+				continue
+			}
+			x, y := float64((i%layer.Width)*lm.TileWidth), float64((i/layer.Width)*lm.TileHeight)
+			zone.Min = vector.Vector{X: x, Y: y}
+			zone.Max = vector.Vector{X: x + float64(lm.TileWidth), Y: y + float64(lm.TileHeight)}
+			lm.Hazards = append(lm.Hazards, zone)
+			placed++
+		}
+	}
+	ml.logger.Info("Placed %d animated hazard tiles", placed)
+}
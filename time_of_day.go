@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// HourRange is a span of game hours, e.g. "8-20" for 8:00 to 20:00. Ranges with an end before
+// their start wrap past midnight ("22-6").
+type HourRange struct {
+	Start float64
+	End   float64
+}
+
+// parseHourRange parses "start-end" with hours in 0..24
+func parseHourRange(s string) (HourRange, bool) {
+	start, end, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return HourRange{}, false
+	}
+	from, err1 := strconv.ParseFloat(strings.TrimSpace(start), 64)
+	to, err2 := strconv.ParseFloat(strings.TrimSpace(end), 64)
+	if err1 != nil || err2 != nil || from < 0 || from > 24 || to < 0 || to > 24 || from == to {
+		return HourRange{}, false
+	}
+	return HourRange{Start: from, End: to}, true
+}
+
+// Contains reports whether a fractional game hour lies in the range
+func (r HourRange) Contains(hour float64) bool {
+	if r.Start < r.End {
+		return hour >= r.Start && hour < r.End
+	}
+	return hour >= r.Start || hour < r.End
+}
+
+// timedObject is a map object whose behavior follows the time of day
+type timedObject struct {
+	ObjectID int
+	Hours    *HourRange // interact is rejected outside these hours (nil = always open)
+	DayGID   uint32     // the object's own tile
+	NightGID uint32     // tile shown between sunset and sunrise (0 = no change)
+	closed   bool
+	night    bool
+}
+
+// TimedObjectManager applies the time of day to map objects: shops with opening hours reject
+// interactions while closed, and lamps switch tiles at sunset and sunrise. Objects are set up
+// with the properties "hours" ("8-20") and "nightGid".
+type TimedObjectManager struct {
+	logger  runtime.Logger
+	objects map[int]*timedObject // object ID -> object
+	mu      sync.Mutex
+}
+
+// NewTimedObjectManager creates an empty timed object manager
+func NewTimedObjectManager(logger runtime.Logger) *TimedObjectManager {
+	return &TimedObjectManager{
+		logger:  logger,
+		objects: make(map[int]*timedObject),
+	}
+}
+
+// LoadFromMap registers the map objects with opening hours or a night tile and puts them in the
+// state of the current time
+func (tm *TimedObjectManager) LoadFromMap(gs *GameMatchState) {
+	tm.mu.Lock()
+	tm.objects = make(map[int]*timedObject)
+	gs.mu.Lock()
+	for oid, obj := range gs.Objects() {
+		timed := &timedObject{ObjectID: oid, DayGID: obj.GID}
+		if hours, ok := obj.Props["hours"].(string); ok && hours != "" {
+			r, ok := parseHourRange(hours)
+			if !ok {
+				tm.logger.Warn("Object %d (%s) has invalid hours %q; ignoring", oid, obj.Name, hours)
+			} else {
+				timed.Hours = &r
+			}
+		}
+		if v, ok := obj.Props["nightgid"].(float64); ok && v > 0 {
+			timed.NightGID = uint32(v)
+		}
+		if timed.Hours != nil || timed.NightGID != 0 {
+			tm.objects[oid] = timed
+		}
+	}
+	gs.mu.Unlock()
+	tm.mu.Unlock()
+
+	tm.apply(gs, nil, true)
+	tm.logger.Info("Registered %d time-of-day objects", len(tm.objects))
+}
+
+// SubscribeEvents re-applies the time of day to the objects every game hour and at sunrise and
+// sunset
+func (tm *TimedObjectManager) SubscribeEvents(eb *EventBus) {
+	handler := func(ctx context.Context, gs *GameMatchState, event GameEvent, dispatcher runtime.MatchDispatcher) {
+		tm.apply(gs, dispatcher, false)
+	}
+	eb.Subscribe(EventHour, handler)
+	eb.Subscribe(EventSunrise, handler)
+	eb.Subscribe(EventSunset, handler)
+}
+
+// Closed reports whether an object is outside its opening hours
+func (tm *TimedObjectManager) Closed(oid int) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	timed, ok := tm.objects[oid]
+	return ok && timed.closed
+}
+
+// apply opens or closes the objects and switches their tiles for the current time, mirroring
+// the state into the "closed" property. Unchanged objects are left alone unless force is set.
+func (tm *TimedObjectManager) apply(gs *GameMatchState, dispatcher runtime.MatchDispatcher, force bool) {
+	hour, isDay := gs.worldClock.Hour(), gs.worldClock.IsDay()
+
+	tm.mu.Lock()
+	var changed []*timedObject
+	for _, timed := range tm.objects {
+		closed := timed.Hours != nil && !timed.Hours.Contains(hour)
+		night := timed.NightGID != 0 && !isDay
+		if force || closed != timed.closed || night != timed.night {
+			timed.closed, timed.night = closed, night
+			changed = append(changed, timed)
+		}
+	}
+	tm.mu.Unlock()
+
+	for _, timed := range changed {
+		gs.mu.Lock()
+		obj, ok := gs.Object(timed.ObjectID)
+		if ok {
+			if timed.Hours != nil {
+				obj.Props["closed"] = timed.closed
+			}
+			if timed.NightGID != 0 {
+				obj.GID = timed.DayGID
+				if timed.night {
+					obj.GID = timed.NightGID
+				}
+			}
+		}
+		gs.mu.Unlock()
+		if ok {
+			gs.BroadcastObjectUpdate(timed.ObjectID, dispatcher, tm.logger)
+		}
+	}
+}
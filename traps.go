@@ -0,0 +1,579 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+const trapObjectType = "trap"
+
+// Trap events published on the event bus
+const (
+	EventTrapTriggered = "trap_triggered" // trapId, owner (empty for map traps), playerId or npcId
+	EventTrapDisarmed  = "trap_disarmed"  // trapId, owner, playerId
+)
+
+// Trap states sent to clients
+const (
+	TrapArmed   = "armed"   // waiting for someone to step on it
+	TrapSprung  = "sprung"  // went off or was disarmed; harmless until it rearms
+	TrapHidden  = "hidden"  // rearmed where the player can no longer see it
+	TrapRemoved = "removed" // gone for good
+)
+
+// Skill stats rolled against traps. Players raise them with "buff" items (Stat "perception" or
+// "disarm").
+const (
+	StatPerception = "perception"
+	StatDisarm     = "disarm"
+)
+
+// Trap tuning. The object properties "damage", "damageType", "effect", "radius", "detectDc",
+// "disarmDc", "rearm", "visible" and "gid" (and the "trap" of trap items) override them per trap.
+const (
+	defaultTrapRadius   = HalfTile // px around the trap that set it off
+	defaultTrapDC       = 12       // d20 plus skill needed to spot or disarm a trap
+	defaultTrapArmDelay = 2.0      // seconds before a placed trap arms
+	trapDie             = 20
+	trapBackfireMargin  = 5             // a disarm roll missing the DC by this much sets the trap off
+	trapCheckInterval   = TickRate / 10 // ticks between trigger checks
+	trapDetectInterval  = TickRate / 2  // ticks between perception rolls
+	trapDetectRange     = 3 * TileSize  // players roll to spot hidden traps within this distance
+	trapDisarmRange     = 48.0          // px from the trap's center a player may disarm it from
+	trapDisarmCooldown  = TickRate      // ticks between two disarm attempts of a player
+	trapSpentLinger     = 10 * TickRate // ticks a sprung placed trap stays before it is removed
+	maxPlayerTraps      = 3             // placing more removes the player's oldest trap
+)
+
+// TrapConfig describes what a trap does, from the properties of a "trap" map object or the
+// "trap" of an item with the trap effect
+type TrapConfig struct {
+	Damage     float64 `json:"damage,omitempty"`
+	DamageType string  `json:"damageType,omitempty"` // default physical
+	Effect     string  `json:"effect,omitempty"`     // status effect applied to players who set it off
+	Radius     float64 `json:"radius,omitempty"`     // trigger radius (default half a tile)
+	DetectDC   int     `json:"detectDc,omitempty"`   // perception roll needed to spot it (default defaultTrapDC)
+	DisarmDC   int     `json:"disarmDc,omitempty"`   // disarm roll needed (default defaultTrapDC)
+	Rearm      float64 `json:"rearm,omitempty"`      // seconds before a sprung or disarmed map trap arms again (0 = never)
+	ArmDelay   float64 `json:"armDelay,omitempty"`   // seconds before a placed trap arms (default defaultTrapArmDelay)
+	GID        uint32  `json:"gid,omitempty"`        // tile clients draw once they see the trap
+	Visible    bool    `json:"visible,omitempty"`    // in plain sight: everyone sees it without rolling
+}
+
+// normalize fills in the defaults of a trap config
+func (c *TrapConfig) normalize() {
+	c.DamageType = strings.ToLower(c.DamageType)
+	switch c.DamageType {
+	case DamagePhysical, DamageFire, DamageFrost, DamagePoison, DamageTrue:
+	default:
+		c.DamageType = DamagePhysical
+	}
+	if c.Radius <= 0 {
+		c.Radius = defaultTrapRadius
+	}
+	if c.DetectDC <= 0 {
+		c.DetectDC = defaultTrapDC
+	}
+	if c.DisarmDC <= 0 {
+		c.DisarmDC = defaultTrapDC
+	}
+	if c.ArmDelay <= 0 {
+		c.ArmDelay = defaultTrapArmDelay
+	}
+}
+
+// TrapSpawn is a "trap" object of the map: a point or shape (never drawn by the map itself, so
+// clients can't see hidden traps) with a TrapConfig in its properties and its tile in "gid"
+type TrapSpawn struct {
+	ID       int // object ID
+	Name     string
+	Position vector.Vector
+	Config   TrapConfig
+}
+
+// parseTrap reads a trap from a map object. It returns false for traps that would do nothing.
+func (ml *MapLoader) parseTrap(obj *TiledObject, worldX, worldY float64) (TrapSpawn, bool) {
+	trap := TrapSpawn{ID: obj.ID, Name: obj.Name, Position: vector.Vector{X: worldX, Y: worldY}}
+	if trap.Name == "" {
+		trap.Name = trapObjectType
+	}
+	for _, p := range obj.Properties {
+		switch strings.ToLower(p.Name) {
+		case "damage":
+			trap.Config.Damage, _ = p.Value.(float64)
+		case "damagetype":
+			trap.Config.DamageType, _ = p.Value.(string)
+		case "effect":
+			trap.Config.Effect, _ = p.Value.(string)
+		case "radius":
+			trap.Config.Radius, _ = p.Value.(float64)
+		case "detectdc":
+			if v, ok := p.Value.(float64); ok {
+				trap.Config.DetectDC = int(v)
+			}
+		case "disarmdc":
+			if v, ok := p.Value.(float64); ok {
+				trap.Config.DisarmDC = int(v)
+			}
+		case "rearm":
+			trap.Config.Rearm, _ = p.Value.(float64)
+		case "visible":
+			trap.Config.Visible, _ = p.Value.(bool)
+		case "gid":
+			if v, ok := p.Value.(float64); ok && v > 0 {
+				trap.Config.GID = uint32(v)
+			}
+		}
+	}
+	if trap.Config.Damage <= 0 && trap.Config.Effect == "" {
+		ml.logger.Warn("Trap %q (id %d) has neither damage nor effect; skipping", obj.Name, obj.ID)
+		return trap, false
+	}
+	trap.Config.normalize()
+	return trap, true
+}
+
+// Trap is an armed or sprung trap of the current map, or one a player placed
+type Trap struct {
+	ID       int
+	Name     string
+	Position vector.Vector
+	Config   TrapConfig
+	Owner    string // player who placed it ("" for map traps)
+	ItemID   string // item it was placed from, given back when the owner picks it up
+	Armed    bool
+	Spent    bool  // went off or was disarmed, and shown to everyone
+	armTick  int64 // tick it arms (again) at; 0 = never
+	gone     int64 // tick a spent placed trap is removed at
+	placed   int64 // tick it was placed, to find a player's oldest trap
+	sensor   *rigidbody.RigidBody
+	seenBy   map[string]bool // players who spotted it
+	rolled   map[string]bool // players in range who already rolled to spot it
+}
+
+// TrapData is a trap as sent to clients (OpCodeTrap "trap")
+type TrapData struct {
+	ID     int     `json:"id"`
+	State  string  `json:"state"` // Trap*
+	X      float64 `json:"x,omitempty"`
+	Y      float64 `json:"y,omitempty"`
+	Radius float64 `json:"radius,omitempty"`
+	GID    uint32  `json:"gid,omitempty"`
+	Owner  string  `json:"owner,omitempty"`
+}
+
+// TrapManager runs the traps of the map and those players place. Armed traps go off on the first
+// player (map traps) or NPC or attackable player (placed traps) stepping into them. Hidden traps
+// are only sent to players who spotted them with a perception roll, to their owner, and to
+// everyone once sprung; the "disarm" action rolls against the trap's disarm DC. It is only used
+// from the match loop.
+type TrapManager struct {
+	logger     runtime.Logger
+	traps      map[int]*Trap // trap ID -> trap
+	nextID     int
+	nextDisarm map[string]int64 // player ID -> first tick of their next disarm attempt
+}
+
+// NewTrapManager creates a trap manager without traps
+func NewTrapManager(logger runtime.Logger) *TrapManager {
+	return &TrapManager{
+		logger:     logger,
+		traps:      make(map[int]*Trap),
+		nextDisarm: make(map[string]int64),
+	}
+}
+
+// LoadFromMap arms the traps of the current map. Placed traps get IDs above every map object ID.
+func (tm *TrapManager) LoadFromMap(gs *GameMatchState) {
+	tm.traps = make(map[int]*Trap)
+	tm.nextID = 0
+	for oid := range gs.Objects() {
+		if oid > tm.nextID {
+			tm.nextID = oid
+		}
+	}
+	if gs.currentMap == nil {
+		return
+	}
+	for _, spawn := range gs.currentMap.Traps {
+		tm.traps[spawn.ID] = newTrap(spawn.ID, spawn.Name, spawn.Position, spawn.Config, true)
+		if spawn.ID > tm.nextID {
+			tm.nextID = spawn.ID
+		}
+	}
+	if len(tm.traps) > 0 {
+		tm.logger.Info("Armed %d traps", len(tm.traps))
+	}
+}
+
+// newTrap builds a trap and its trigger sensor
+func newTrap(id int, name string, position vector.Vector, config TrapConfig, armed bool) *Trap {
+	return &Trap{
+		ID:       id,
+		Name:     name,
+		Position: position,
+		Config:   config,
+		Armed:    armed,
+		sensor:   MakeCircleRigidBody(position.X, position.Y, config.Radius),
+		seenBy:   make(map[string]bool),
+		rolled:   make(map[string]bool),
+	}
+}
+
+// Join sends a joining player the traps they see: sprung ones, traps in plain sight and their own
+func (tm *TrapManager) Join(gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	for _, id := range tm.sortedIDs() {
+		if trap := tm.traps[id]; tm.sees(trap, playerID) {
+			tm.send(gs, trap, tm.state(trap), []string{playerID}, dispatcher)
+		}
+	}
+}
+
+// Leave forgets what a leaving player spotted. Their placed traps stay; they can't hurt players
+// while the owner is away.
+func (tm *TrapManager) Leave(playerID string) {
+	for _, trap := range tm.traps {
+		delete(trap.seenBy, playerID)
+		delete(trap.rolled, playerID)
+	}
+	delete(tm.nextDisarm, playerID)
+}
+
+// Place sets an item's trap at a player's feet. It arms after its arm delay; the player's oldest
+// trap is removed when they have too many.
+func (tm *TrapManager) Place(gs *GameMatchState, playerID string, def *ItemDefinition, position vector.Vector, dispatcher runtime.MatchDispatcher) {
+	config := *def.Trap
+	config.normalize()
+
+	var owned []*Trap
+	for _, trap := range tm.traps {
+		if trap.Owner == playerID {
+			owned = append(owned, trap)
+		}
+	}
+	if len(owned) >= maxPlayerTraps {
+		sort.Slice(owned, func(i, j int) bool { return owned[i].placed < owned[j].placed })
+		for _, trap := range owned[:len(owned)-maxPlayerTraps+1] {
+			tm.remove(gs, trap, dispatcher)
+		}
+	}
+
+	tm.nextID++
+	trap := newTrap(tm.nextID, def.Name, position, config, false)
+	trap.Owner, trap.ItemID = playerID, def.ID
+	trap.placed = gs.currentTick
+	trap.armTick = gs.currentTick + int64(config.ArmDelay*TickRate)
+	tm.traps[trap.ID] = trap
+	tm.send(gs, trap, tm.state(trap), tm.viewers(gs, trap), dispatcher)
+}
+
+// Update arms traps whose timer ran out, sets off the traps someone stepped into and rolls the
+// perception of the players near hidden traps. Called from the match loop after physics.
+func (tm *TrapManager) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if len(tm.traps) == 0 {
+		return
+	}
+	tick := gs.currentTick
+	for _, id := range tm.sortedIDs() {
+		trap := tm.traps[id]
+		if trap.gone != 0 && tick >= trap.gone {
+			tm.remove(gs, trap, dispatcher)
+			continue
+		}
+		if !trap.Armed && trap.armTick != 0 && tick >= trap.armTick {
+			tm.arm(gs, trap, dispatcher)
+		}
+	}
+	if tick%trapCheckInterval == 0 {
+		tm.trigger(gs, dispatcher, logger)
+	}
+	if tick%trapDetectInterval == 0 {
+		tm.detect(gs, dispatcher)
+	}
+}
+
+// arm makes a trap dangerous again. A rearmed map trap is hidden anew: the players who saw it
+// sprung forget it and have to spot it again.
+func (tm *TrapManager) arm(gs *GameMatchState, trap *Trap, dispatcher runtime.MatchDispatcher) {
+	trap.Armed, trap.Spent = true, false
+	trap.armTick = 0
+	if trap.Owner != "" || trap.Config.Visible {
+		tm.send(gs, trap, TrapArmed, tm.viewers(gs, trap), dispatcher)
+		return
+	}
+	var forget []string
+	for playerID := range gs.Presences() {
+		forget = append(forget, playerID)
+	}
+	trap.seenBy = make(map[string]bool)
+	trap.rolled = make(map[string]bool)
+	tm.send(gs, trap, TrapHidden, forget, dispatcher)
+}
+
+// trigger sets off every armed trap with a victim standing in it
+func (tm *TrapManager) trigger(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	gs.mu.Lock()
+	bodies := make([]*rigidbody.RigidBody, 0, len(gs.gameObjects))
+	for _, rb := range gs.gameObjects {
+		if rb.IsMovable && gs.physicsEngine.CollisionsEnabled(rb) {
+			bodies = append(bodies, rb)
+		}
+	}
+	gs.mu.Unlock()
+
+	players := make(map[*rigidbody.RigidBody]string, gs.entities.PlayerCount())
+	for playerID, rb := range gs.PlayerBodies() {
+		players[rb] = playerID
+	}
+	npcs := gs.npcManager.BodyOwners()
+
+	for _, id := range tm.sortedIDs() {
+		trap := tm.traps[id]
+		if !trap.Armed {
+			continue
+		}
+		for _, rb := range gs.physicsEngine.QueryOverlap(trap.sensor, bodies) {
+			if playerID, ok := players[rb]; ok && tm.hurts(gs, trap, playerID) {
+				tm.spring(gs, trap, playerID, 0, dispatcher, logger)
+				break
+			}
+			if npcID, ok := npcs[rb]; ok && trap.Owner != "" {
+				if npc, ok := gs.npcManager.Get(npcID); ok && npc.Pet == nil {
+					tm.spring(gs, trap, "", npcID, dispatcher, logger)
+					break
+				}
+			}
+		}
+	}
+}
+
+// hurts reports whether a player sets a trap off: any living player for map traps, and living
+// players the owner may attack for placed ones
+func (tm *TrapManager) hurts(gs *GameMatchState, trap *Trap, playerID string) bool {
+	if gs.GetPlayerState(playerID).IsDead() {
+		return false
+	}
+	if trap.Owner == "" {
+		return true
+	}
+	return playerID != trap.Owner && gs.CanDamagePlayer(trap.Owner, playerID)
+}
+
+// source is who a trap's damage is credited to: its owner, or the environment
+func (trap *Trap) source() DamageSource {
+	if trap.Owner != "" {
+		return DamageSource{Type: DamageSourcePlayer, ID: trap.Owner}
+	}
+	return DamageSource{Type: DamageSourceEnvironment, ID: trap.Name}
+}
+
+// spring sets a trap off on a player or an NPC (npcID) and shows it sprung to everyone
+func (tm *TrapManager) spring(gs *GameMatchState, trap *Trap, playerID string, npcID int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	source := trap.source()
+	if playerID != "" {
+		if trap.Config.Damage > 0 {
+			gs.damagePlayer(playerID, source, trap.Config.Damage, trap.Config.DamageType, 0, dispatcher, logger)
+		}
+		if trap.Config.Effect != "" {
+			gs.ApplyEffect(playerID, trap.Config.Effect, source, 0)
+		}
+	} else if trap.Config.Damage > 0 {
+		gs.npcManager.Damage(gs, npcID, source, trap.Config.Damage, trap.Config.DamageType, dispatcher)
+	}
+
+	event := map[string]any{"trapId": trap.ID, "owner": trap.Owner}
+	if playerID != "" {
+		event["playerId"] = playerID
+	} else {
+		event["npcId"] = npcID
+	}
+	gs.eventBus.Publish(EventTrapTriggered, event)
+	tm.disable(gs, trap, dispatcher)
+}
+
+// disable takes a trap out of action after it went off or was disarmed: map traps rearm after
+// their rearm time (if any), placed traps are spent and removed a little later
+func (tm *TrapManager) disable(gs *GameMatchState, trap *Trap, dispatcher runtime.MatchDispatcher) {
+	trap.Armed, trap.Spent = false, true
+	trap.armTick = 0
+	if trap.Owner != "" {
+		trap.gone = gs.currentTick + trapSpentLinger
+	} else if trap.Config.Rearm > 0 {
+		trap.armTick = gs.currentTick + int64(trap.Config.Rearm*TickRate)
+	}
+	tm.send(gs, trap, TrapSprung, tm.viewers(gs, trap), dispatcher)
+}
+
+// remove deletes a trap and tells the players who saw it
+func (tm *TrapManager) remove(gs *GameMatchState, trap *Trap, dispatcher runtime.MatchDispatcher) {
+	recipients := tm.viewers(gs, trap)
+	delete(tm.traps, trap.ID)
+	tm.send(gs, trap, TrapRemoved, recipients, dispatcher)
+}
+
+// detect has the players near hidden armed traps roll their perception once per approach: the
+// d20 plus their perception must reach the trap's detect DC. Leaving the detection range allows
+// another roll on the next approach.
+func (tm *TrapManager) detect(gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	for _, id := range tm.sortedIDs() {
+		trap := tm.traps[id]
+		if !trap.Armed || trap.Config.Visible {
+			continue
+		}
+		for _, playerID := range sortedPlayerIDs(gs) {
+			rb := gs.PlayerBody(playerID)
+			if playerID == trap.Owner || trap.seenBy[playerID] || rb == nil {
+				continue
+			}
+			if rb.Position.Sub(trap.Position).Magnitude() > trapDetectRange {
+				delete(trap.rolled, playerID)
+				continue
+			}
+			state := gs.GetPlayerState(playerID)
+			if trap.rolled[playerID] || state.IsDead() || !gs.HasLineOfSight(rb.Position, trap.Position, 0) {
+				continue
+			}
+			trap.rolled[playerID] = true
+			if tm.roll(gs, state.BuffAmount(StatPerception, gs.currentTick)) >= float64(trap.Config.DetectDC) {
+				trap.seenBy[playerID] = true
+				tm.send(gs, trap, TrapArmed, []string{playerID}, dispatcher)
+			}
+		}
+	}
+}
+
+// roll rolls the trap die and adds a skill
+func (tm *TrapManager) roll(gs *GameMatchState, skill float64) float64 {
+	return float64(1+gs.rng.Intn(trapDie)) + skill
+}
+
+// Disarm handles the "disarm" action on a trap the player sees and stands next to. The owner of
+// a placed trap picks it up and gets its item back. Others roll the d20 plus their disarm skill
+// against the trap's disarm DC: success disables the trap like setting it off would, failure
+// rejects the action, and missing the DC by trapBackfireMargin or more sets the trap off on the
+// player. It returns a reject reason, or "" on success.
+func (tm *TrapManager) Disarm(ctx context.Context, gs *GameMatchState, playerID string, trapID int, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	trap, ok := tm.traps[trapID]
+	if !ok || !tm.sees(trap, playerID) {
+		return RejectUnknownObject
+	}
+	if !trap.Armed && trap.Owner == "" {
+		return RejectInvalidTarget
+	}
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+	if rb.Position.Sub(trap.Position).Magnitude() > trapDisarmRange {
+		return RejectOutOfRange
+	}
+	if gs.currentTick < tm.nextDisarm[playerID] {
+		return RejectOnCooldown
+	}
+	tm.nextDisarm[playerID] = gs.currentTick + trapDisarmCooldown
+
+	if trap.Owner == playerID {
+		if trap.gone == 0 && trap.ItemID != "" {
+			if err := gs.inventoryManager.Add(ctx, playerID, trap.ItemID, 1); err != nil {
+				logger.Error("Failed to give trap %s back to %s: %v", trap.ItemID, playerID, err)
+				return RejectStorageError
+			}
+			gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+		}
+		tm.remove(gs, trap, dispatcher)
+		gs.eventBus.Publish(EventTrapDisarmed, map[string]any{"trapId": trap.ID, "owner": trap.Owner, "playerId": playerID})
+		return ""
+	}
+	if !trap.Armed {
+		return RejectInvalidTarget
+	}
+
+	roll := tm.roll(gs, gs.GetPlayerState(playerID).BuffAmount(StatDisarm, gs.currentTick))
+	dc := float64(trap.Config.DisarmDC)
+	switch {
+	case roll >= dc:
+		gs.eventBus.Publish(EventTrapDisarmed, map[string]any{"trapId": trap.ID, "owner": trap.Owner, "playerId": playerID})
+		tm.disable(gs, trap, dispatcher)
+		return ""
+	case roll <= dc-trapBackfireMargin:
+		tm.spring(gs, trap, playerID, 0, dispatcher, logger)
+	}
+	return RejectDisarmFailed
+}
+
+// sees reports whether a player knows about a trap: it is sprung or in plain sight, they placed
+// it, or they spotted it
+func (tm *TrapManager) sees(trap *Trap, playerID string) bool {
+	return trap.Spent || trap.Config.Visible || trap.Owner == playerID || trap.seenBy[playerID]
+}
+
+// state is what a player who sees a trap is told it is; placed traps waiting to arm show as sprung
+func (tm *TrapManager) state(trap *Trap) string {
+	if trap.Armed {
+		return TrapArmed
+	}
+	return TrapSprung
+}
+
+// viewers returns the players who see a trap
+func (tm *TrapManager) viewers(gs *GameMatchState, trap *Trap) []string {
+	var ids []string
+	for playerID := range gs.Presences() {
+		if tm.sees(trap, playerID) {
+			ids = append(ids, playerID)
+		}
+	}
+	return ids
+}
+
+// sortedIDs returns the trap IDs in order, so rolls and triggers happen in the same order every run
+func (tm *TrapManager) sortedIDs() []int {
+	ids := make([]int, 0, len(tm.traps))
+	for id := range tm.traps {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// sortedPlayerIDs returns the IDs of the players with a body, in order
+func sortedPlayerIDs(gs *GameMatchState) []string {
+	ids := make([]string, 0, gs.entities.PlayerCount())
+	for playerID := range gs.PlayerBodies() {
+		ids = append(ids, playerID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// send tells players about a trap (OpCodeTrap "trap")
+func (tm *TrapManager) send(gs *GameMatchState, trap *Trap, state string, playerIDs []string, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil || len(playerIDs) == 0 {
+		return
+	}
+	recipients := make([]runtime.Presence, 0, len(playerIDs))
+	for _, playerID := range playerIDs {
+		if presence, ok := gs.presences[playerID]; ok {
+			recipients = append(recipients, presence)
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	data := TrapData{ID: trap.ID, State: state}
+	if state != TrapHidden && state != TrapRemoved {
+		data.X, data.Y = trap.Position.X, trap.Position.Y
+		data.Radius, data.GID, data.Owner = trap.Config.Radius, trap.Config.GID, trap.Owner
+	}
+	payload, err := EncodeMessage(OpCodeTrap, "trap", data)
+	if err != nil {
+		tm.logger.Error("Failed to marshal trap %d: %v", trap.ID, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeTrap, payload, recipients, nil, true)
+}
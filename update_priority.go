@@ -0,0 +1,308 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Update priority tuning
+const (
+	defaultUpdateBudget = 0             // bytes per tick a player's world updates may carry: off unless the updateBudget game rule sets it
+	aoiUpdateBudget     = math.MaxInt32 // budget of updates prioritized by distance only (aoiRadius tuned, or the aoi load level)
+	priorityNearRadius  = 480.0         // px; changed entities this close to the viewer go out in every update
+	farUpdateTicks      = 15            // ticks between the updates of changed entities further away
+	objectsUpdateTicks  = 30            // ticks between the updates of the game object bodies
+	maxDeferTicks       = TickRate      // a change waits at most this long for budget before it is sent anyway
+	maxBudgetTicks      = TickRate      // budget doesn't accumulate over longer gaps between updates
+	fragmentOverhead    = 8             // bytes an entity takes besides its encoding (key, separators)
+)
+
+// Update priority tiers, sent in this order
+const (
+	tierSelf    = iota // the viewer's own player, always sent
+	tierNear           // near or combat-relevant: every update
+	tierFar            // further away: every farUpdateTicks
+	tierObjects        // the bodies: every objectsUpdateTicks
+)
+
+// entityKind tells what an entity of a world update is
+type entityKind uint8
+
+const (
+	entityPlayer entityKind = iota
+	entityNPC
+	entityPet
+	entityObjects // the gameObjects bodies, sent as one
+)
+
+// entityKey identifies an entity of a world update
+type entityKey struct {
+	kind   entityKind
+	player string // player ID of entityPlayer
+	id     int    // NPC or pet ID
+}
+
+// sentEntity is what a viewer's client holds of an entity
+type sentEntity struct {
+	hash     uint64 // hash of the encoding last sent
+	sent     bool   // the client got the entity at all
+	sentTick int64
+	since    int64 // tick the change waiting to be sent was first noticed (0 = none)
+	seen     int64 // last update the entity was in the viewer's view
+}
+
+// viewerUpdates is the update state of one player: what their client holds and when it was
+// last sent an update
+type viewerUpdates struct {
+	entities   map[entityKey]*sentEntity
+	lastUpdate int64
+}
+
+// updateCandidate is an entity due in a viewer's update
+type updateCandidate struct {
+	key      entityKey
+	size     int
+	tier     int
+	wait     int64 // ticks the change has waited
+	distance float64
+}
+
+// GoneEntities lists the entities a partial world update tells the client to drop: they left the
+// world or the viewer's view (stealth, darkness)
+type GoneEntities struct {
+	Players []string `json:"players,omitempty"`
+	NPCs    []int    `json:"npcs,omitempty"`
+	Pets    []int    `json:"pets,omitempty"`
+}
+
+func (g *GoneEntities) empty() bool {
+	return len(g.Players) == 0 && len(g.NPCs) == 0 && len(g.Pets) == 0
+}
+
+// UpdateSelection is what one viewer's partial world update carries
+type UpdateSelection struct {
+	Objects bool
+	Players map[string]bool
+	NPCs    map[int]bool
+	Pets    map[int]bool
+	Gone    GoneEntities
+}
+
+// UpdatePrioritizer decides which entities each player's world update carries. Entities the
+// client already holds unchanged are left out. Changed entities near the viewer or fighting them
+// go out in every update, those further away at a reduced rate, and all of them within the
+// player's byte budget per tick: what doesn't fit waits for a later update, at most
+// maxDeferTicks. Only the match loop uses it.
+type UpdatePrioritizer struct {
+	viewers    map[string]*viewerUpdates
+	npcTargets map[int]string      // NPC ID -> player it fights, this broadcast
+	attackers  map[string][]string // player ID -> players locked onto them, this broadcast
+	fighting   map[string]bool     // players the current viewer fights
+	candidates []updateCandidate   // reused by every viewer's selection
+	selection  UpdateSelection     // reused by every viewer's selection
+}
+
+// NewUpdatePrioritizer creates the update priority state of a match
+func NewUpdatePrioritizer() *UpdatePrioritizer {
+	return &UpdatePrioritizer{
+		viewers:    make(map[string]*viewerUpdates),
+		npcTargets: make(map[int]string),
+		attackers:  make(map[string][]string),
+		fighting:   make(map[string]bool),
+		selection:  UpdateSelection{Players: make(map[string]bool), NPCs: make(map[int]bool), Pets: make(map[int]bool)},
+	}
+}
+
+// updateBudget returns the bytes per tick a player's world updates may carry; 0 turns update
+// priority off and every update carries the whole view. Without a budget, a tuned aoiRadius or
+// the aoi load level still prioritize updates by distance, with no byte limit: entities outside
+// the near radius only go out every farUpdateTicks, so the radius decides what each player is
+// sent.
+func (gs *GameMatchState) updateBudget() int {
+	budget := defaultUpdateBudget
+	if gs.worldSettings != nil {
+		if v, ok := gs.worldSettings.GameRules["updateBudget"].(float64); ok && v >= 0 {
+			budget = int(v)
+		}
+	}
+	if budget == 0 && (gs.tuning.AOIRadius != nil || gs.load.Level() >= LoadLevelAOI) {
+		return aoiUpdateBudget
+	}
+	return budget
+}
+
+// Begin collects who fights whom for this broadcast's combat relevance
+func (up *UpdatePrioritizer) Begin(gs *GameMatchState) {
+	clear(up.npcTargets)
+	clear(up.attackers)
+	nm := gs.npcManager
+	nm.mu.RLock()
+	for id, npc := range nm.live() {
+		if npc.Target != "" {
+			up.npcTargets[id] = npc.Target
+		}
+	}
+	nm.mu.RUnlock()
+	for playerID, state := range inOrder(sortedKeys(gs.playerStates), gs.playerStates) {
+		if state.Target != nil && state.Target.PlayerID != "" {
+			up.attackers[state.Target.PlayerID] = append(up.attackers[state.Target.PlayerID], playerID)
+		}
+	}
+}
+
+// Select picks the part of a view a viewer's update carries, encoded by be.Begin. The selection
+// is only valid until the next call.
+func (up *UpdatePrioritizer) Select(gs *GameMatchState, viewerID string, view GameState, be *BroadcastEncoder, budget int) *UpdateSelection {
+	tick := gs.currentTick
+	vu := up.viewers[viewerID]
+	if vu == nil {
+		vu = &viewerUpdates{entities: make(map[entityKey]*sentEntity), lastUpdate: tick - worldUpdateIntervalTicks}
+		up.viewers[viewerID] = vu
+	}
+	ticks := tick - vu.lastUpdate
+	if ticks < 1 {
+		ticks = 1
+	} else if ticks > maxBudgetTicks {
+		ticks = maxBudgetTicks
+	}
+	budget *= int(ticks)
+	vu.lastUpdate = tick
+
+	origin, hasOrigin := gs.World().Players[viewerID]
+	nearRadius := gs.load.NearRadius(gs.tuning.NearRadius())
+	up.collectFights(gs, viewerID)
+
+	up.candidates = up.candidates[:0]
+	consider := func(key entityKey, position Position, relevant bool) {
+		rec := vu.entities[key]
+		if rec == nil {
+			rec = &sentEntity{}
+			vu.entities[key] = rec
+		}
+		rec.seen = tick
+		frag, encoded := be.entity(key)
+		if encoded && rec.sent && rec.hash == frag.hash {
+			return // the client holds it unchanged
+		}
+		if rec.since == 0 {
+			rec.since = tick
+		}
+
+		candidate := updateCandidate{key: key, size: frag.size() + fragmentOverhead, wait: tick - rec.since}
+		if hasOrigin {
+			candidate.distance = vector.Vector{X: position.X, Y: position.Y}.Sub(origin).Magnitude()
+		}
+		switch {
+		case key.kind == entityPlayer && key.player == viewerID:
+			candidate.tier = tierSelf
+		case key.kind == entityObjects:
+			candidate.tier = tierObjects
+		case relevant || !hasOrigin || candidate.distance <= nearRadius:
+			candidate.tier = tierNear
+		default:
+			candidate.tier = tierFar
+		}
+		if rec.sent && ((candidate.tier == tierFar && tick-rec.sentTick < farUpdateTicks) ||
+			(candidate.tier == tierObjects && tick-rec.sentTick < objectsUpdateTicks)) {
+			return // sent recently enough for its distance
+		}
+		up.candidates = append(up.candidates, candidate)
+	}
+
+	consider(entityKey{kind: entityObjects}, Position{}, false)
+	for playerID, data := range view.Players {
+		consider(entityKey{kind: entityPlayer, player: playerID}, data.Position, up.fighting[playerID])
+	}
+	for _, npc := range view.NPCs {
+		consider(entityKey{kind: entityNPC, id: npc.ID}, npc.Position, up.npcTargets[npc.ID] == viewerID)
+	}
+	for _, pet := range view.Pets {
+		consider(entityKey{kind: entityPet, id: pet.ID}, pet.Position, pet.Owner == viewerID)
+	}
+
+	slices.SortFunc(up.candidates, func(a, b updateCandidate) int {
+		return cmp.Or(
+			cmp.Compare(a.tier, b.tier),
+			cmp.Compare(b.wait, a.wait),
+			cmp.Compare(a.distance, b.distance),
+			cmp.Compare(a.key.kind, b.key.kind),
+			cmp.Compare(a.key.player, b.key.player),
+			cmp.Compare(a.key.id, b.key.id),
+		)
+	})
+
+	sel := &up.selection
+	sel.Objects = false
+	clear(sel.Players)
+	clear(sel.NPCs)
+	clear(sel.Pets)
+	sel.Gone = GoneEntities{}
+	spent := 0
+	for _, c := range up.candidates {
+		if c.tier != tierSelf && c.wait < maxDeferTicks && spent+c.size > budget {
+			continue // waits for a later update; smaller entities may still fit
+		}
+		spent += c.size
+		frag, _ := be.entity(c.key)
+		rec := vu.entities[c.key]
+		rec.hash, rec.sent, rec.sentTick, rec.since = frag.hash, true, tick, 0
+		switch c.key.kind {
+		case entityObjects:
+			sel.Objects = true
+		case entityPlayer:
+			sel.Players[c.key.player] = true
+		case entityNPC:
+			sel.NPCs[c.key.id] = true
+		case entityPet:
+			sel.Pets[c.key.id] = true
+		}
+	}
+
+	// Entities that left the view are dropped, and those the client had are listed as gone
+	for key, rec := range vu.entities {
+		if rec.seen == tick {
+			continue
+		}
+		delete(vu.entities, key)
+		if !rec.sent {
+			continue
+		}
+		switch key.kind {
+		case entityPlayer:
+			sel.Gone.Players = append(sel.Gone.Players, key.player)
+		case entityNPC:
+			sel.Gone.NPCs = append(sel.Gone.NPCs, key.id)
+		case entityPet:
+			sel.Gone.Pets = append(sel.Gone.Pets, key.id)
+		}
+	}
+	sort.Strings(sel.Gone.Players)
+	sort.Ints(sel.Gone.NPCs)
+	sort.Ints(sel.Gone.Pets)
+	return sel
+}
+
+// collectFights fills fighting with the players a viewer fights: their target and duel
+// opponent, and the players locked onto them (the NPCs fighting them are in npcTargets)
+func (up *UpdatePrioritizer) collectFights(gs *GameMatchState, viewerID string) {
+	clear(up.fighting)
+	if state, ok := gs.playerStates[viewerID]; ok && state.Target != nil && state.Target.PlayerID != "" {
+		up.fighting[state.Target.PlayerID] = true
+	}
+	if opponent := gs.duelOpponent(viewerID); opponent != "" {
+		up.fighting[opponent] = true
+	}
+	for _, attacker := range up.attackers[viewerID] {
+		up.fighting[attacker] = true
+	}
+}
+
+// Forget drops a player's update state: they left, or joined and got the whole world in
+// world_state
+func (up *UpdatePrioritizer) Forget(playerID string) {
+	delete(up.viewers, playerID)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Map object types for darkness and light
+const (
+	darkZoneObjectType = "dark_zone" // rectangles that are dark even during the day (caves, cellars)
+	lightObjectType    = "light"     // lamps, braziers and other fixed light sources
+)
+
+// Vision tuning
+const (
+	darkVisionRadius   = 5.0 * TileSize // how far players see in the dark without a light
+	defaultLightRadius = 4.0 * TileSize // radius of "light" objects without a radius property
+)
+
+// DarkZone is a rectangular map area ("dark_zone" objects) that is dark at any time of day
+type DarkZone struct {
+	Name string
+	Min  vector.Vector
+	Max  vector.Vector
+}
+
+// Contains reports whether a point lies inside the zone
+func (z *DarkZone) Contains(p vector.Vector) bool {
+	return p.X >= z.Min.X && p.X <= z.Max.X && p.Y >= z.Min.Y && p.Y <= z.Max.Y
+}
+
+// LightSource lights up everything within Radius of Position while it is lit: "light" map
+// objects, lights attached to objects or placed by scripts (lights.go) and the lights players
+// carry
+type LightSource struct {
+	ID       int // map object ID of "light" objects, assigned to script lights, 0 for carried lights
+	Name     string
+	Position vector.Vector
+	Radius   float64
+	Color    string  // "#rrggbb" drawn by clients ("" = their default)
+	Flicker  float64 // 0-1, how much clients vary the radius; vision uses the steady radius
+	Lit      bool
+	ObjectID int    // object the light is attached to; it follows the object's position
+	PlayerID string // player carrying the light
+}
+
+// Lights reports whether p lies in the light's radius
+func (l *LightSource) Lights(p vector.Vector) bool {
+	return p.Sub(l.Position).Magnitude() <= l.Radius
+}
+
+// IsDark reports whether a position is in darkness: at night, anywhere on maps with the "dark"
+// property, and in dark zones
+func (gs *GameMatchState) IsDark(p vector.Vector) bool {
+	if !gs.worldClock.IsDay() {
+		return true
+	}
+	if gs.currentMap == nil {
+		return false
+	}
+	if dark, _ := gs.currentMap.Properties["dark"].(bool); dark {
+		return true
+	}
+	for i := range gs.currentMap.DarkZones {
+		if gs.currentMap.DarkZones[i].Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// VisionLimited reports whether any place on the map may be dark, so world updates need to be
+// filtered per player
+func (gs *GameMatchState) VisionLimited() bool {
+	if !gs.worldClock.IsDay() {
+		return true
+	}
+	if gs.currentMap == nil {
+		return false
+	}
+	dark, _ := gs.currentMap.Properties["dark"].(bool)
+	return dark || len(gs.currentMap.DarkZones) > 0
+}
+
+// LightSources returns the lit map, object and script lights and the lights players carry,
+// carried lights taking the color and flicker of their item
+func (gs *GameMatchState) LightSources() []LightSource {
+	lights := gs.lights.Lit(gs)
+	for playerID, rb := range gs.PlayerBodies() {
+		state := gs.GetPlayerState(playerID)
+		if state.Light <= 0 {
+			continue
+		}
+		light := LightSource{Name: state.LightItem, Position: rb.Position, Radius: state.Light, Lit: true, PlayerID: playerID}
+		if def, ok := gs.itemCatalog.Get(state.LightItem); ok {
+			light.Color, light.Flicker = def.Color, clampFlicker(def.Flicker)
+		}
+		lights = append(lights, light)
+	}
+	return lights
+}
+
+// ToggleLight lights a light item for the player, or puts it out if it is the one they carry.
+// It returns the radius the player lights up afterwards.
+func (ps *PlayerState) ToggleLight(itemID string, radius float64) float64 {
+	if ps.LightItem == itemID {
+		ps.LightItem = ""
+		ps.Light = 0
+	} else {
+		ps.LightItem = itemID
+		ps.Light = radius
+	}
+	return ps.Light
+}
+
+// canSeeInDark reports whether a viewer at viewer sees position p: lit places are seen from
+// anywhere, dark ones only within the viewer's vision radius
+func (gs *GameMatchState) canSeeInDark(viewer, p vector.Vector, visionRadius float64, lights []LightSource) bool {
+	if p.Sub(viewer).Magnitude() <= visionRadius || !gs.IsDark(p) {
+		return true
+	}
+	for i := range lights {
+		if lights[i].Lights(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// inSight returns whether a viewer sees a place when it may be dark: within their vision radius
+// (shortened by fog) or in someone's light. Viewers who have no body see everywhere.
+func (gs *GameMatchState) inSight(viewerID string, lights []LightSource) func(p vector.Vector) bool {
+	rb := gs.PlayerBody(viewerID)
+	if rb == nil {
+		return func(vector.Vector) bool { return true }
+	}
+	viewer := rb.Position
+	radius := darkVisionRadius * gs.weather.PerceptionScale()
+	return func(p vector.Vector) bool {
+		return gs.canSeeInDark(viewer, p, radius, lights)
+	}
+}
+
+// litWorld returns the world update a viewer is sent when it may be dark: players, NPCs and pets
+// in darkness are left out unless they are within the viewer's vision radius (shortened by fog)
+// or in someone's light. Viewers always see themselves and their pets.
+func (gs *GameMatchState) litWorld(viewerID string, world GameState, lights []LightSource) GameState {
+	if gs.PlayerBody(viewerID) == nil {
+		return world
+	}
+	inSight := gs.inSight(viewerID, lights)
+	visible := func(p Position) bool {
+		return inSight(vector.Vector{X: p.X, Y: p.Y})
+	}
+
+	players := make(map[string]PlayerData, len(world.Players))
+	for playerID, data := range world.Players {
+		if playerID == viewerID || visible(data.Position) {
+			players[playerID] = data
+		}
+	}
+	npcs := make([]NPCData, 0, len(world.NPCs))
+	for _, npc := range world.NPCs {
+		if visible(npc.Position) {
+			npcs = append(npcs, npc)
+		}
+	}
+	pets := make([]PetData, 0, len(world.Pets))
+	for _, pet := range world.Pets {
+		if pet.Owner == viewerID || visible(pet.Position) {
+			pets = append(pets, pet)
+		}
+	}
+	world.Players = players
+	world.NPCs = npcs
+	world.Pets = pets
+	return world
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Waypoint events published on the event bus
+const (
+	EventWaypointActivated = "waypoint_activated" // playerId, waypoint, map
+	EventWaypointTravel    = "waypoint_travel"    // playerId, from, to, map (the destination's map)
+)
+
+// Waypoint tuning. The object properties "id", "radius", "checkpoint", "cost", "currency" and
+// "costItem" configure each waypoint.
+const (
+	waypointObjectType     = "waypoint"
+	defaultWaypointRadius  = 2.0 * TileSize
+	defaultTravelCurrency  = "gold"
+	waypointCheckInterval  = 10           // ticks between activation checks
+	waypointTravelCooldown = 5 * TickRate // ticks between a player's travels
+	waypointDepartureTries = 3            // ticks spent trying to find or start the destination map's match
+)
+
+// Waypoint is a fast travel point ("waypoint" objects). Players activate it by walking into its
+// radius and can then travel to it from any other activated waypoint, on this map or another.
+// Checkpoint waypoints also become the respawn point of players who reach them.
+type Waypoint struct {
+	ID         string // unique across maps ("id" property, defaults to the object name)
+	Name       string
+	Position   vector.Vector
+	Radius     float64
+	Checkpoint bool
+	Cost       int64  // travel cost (0 = free)
+	Currency   string // wallet currency the cost is paid in (default "gold")
+	CostItem   string // item the cost is paid in instead of currency
+}
+
+// WaypointData is an activated waypoint as sent to its player
+type WaypointData struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Map      string  `json:"map"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Cost     int64   `json:"cost,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+	CostItem string  `json:"costItem,omitempty"`
+}
+
+// WaypointList is the waypoints message: the waypoints a joining player activated
+type WaypointList struct {
+	Waypoints []WaypointData `json:"waypoints"`
+}
+
+// WaypointActivated is the waypoint_activated message
+type WaypointActivated struct {
+	Waypoint WaypointData `json:"waypoint"`
+}
+
+// WaypointTravel is the travel message (join MatchID to arrive at Waypoint on Map) and, without
+// MatchID, travel_failed
+type WaypointTravel struct {
+	Map      string `json:"map"`
+	MatchID  string `json:"matchId,omitempty"`
+	Waypoint string `json:"waypoint"`
+}
+
+// departure is a paid travel to another map waiting for the destination's match ID
+type departure struct {
+	playerID string
+	travel   *PersistedTravel
+	cost     *PersistedWaypoint
+	paid     int64 // what the player was charged, refunded if the travel fails
+	attempts int
+}
+
+// WaypointManager tracks the waypoints each online player has activated, moves players between
+// waypoints and hands players travelling to another map over to that map's match. It is only
+// used from the match loop.
+type WaypointManager struct {
+	logger     runtime.Logger
+	db         *DatabaseManager
+	players    map[string]*PersistedWaypoints // player ID -> activated waypoints of online players
+	nextTravel map[string]int64               // player ID -> first tick they may travel again
+	departures []*departure
+	departed   map[string]bool // players who left for another map; their position isn't saved here
+	nextCheck  int64
+}
+
+// NewWaypointManager creates a waypoint manager with no players loaded
+func NewWaypointManager(logger runtime.Logger, db *DatabaseManager) *WaypointManager {
+	return &WaypointManager{
+		logger:     logger,
+		db:         db,
+		players:    make(map[string]*PersistedWaypoints),
+		nextTravel: make(map[string]int64),
+		departed:   make(map[string]bool),
+	}
+}
+
+// Arrival returns where a joining player travelling to a waypoint of this map appears, and
+// clears their travel. It reports false when the player isn't travelling here.
+func (wm *WaypointManager) Arrival(ctx context.Context, gs *GameMatchState, playerID string) (vector.Vector, bool) {
+	if gs.instanced() {
+		return vector.Vector{}, false
+	}
+	travel, err := wm.db.LoadTravel(ctx, playerID)
+	if err != nil || travel == nil || travel.Map != gs.currentMapName {
+		return vector.Vector{}, false
+	}
+	if err := wm.db.DeleteTravel(ctx, playerID); err != nil {
+		wm.logger.Error("Failed to clear the travel of %s: %v", playerID, err)
+	}
+	position := vector.Vector{X: travel.X, Y: travel.Y}
+	if waypoint := gs.waypoint(travel.Waypoint); waypoint != nil {
+		position = waypoint.Position
+	}
+	gs.eventBus.Publish(EventWaypointTravel, map[string]any{"playerId": playerID, "to": travel.Waypoint, "map": travel.Map})
+	return position, true
+}
+
+// LoadPlayer loads a joining player's activated waypoints and sends them the list
+func (wm *WaypointManager) LoadPlayer(ctx context.Context, gs *GameMatchState, playerID string, dispatcher runtime.MatchDispatcher) {
+	saved, err := wm.db.LoadWaypoints(ctx, playerID)
+	if err != nil {
+		wm.logger.Error("Failed to load waypoints for %s: %v", playerID, err)
+		return
+	}
+	wm.players[playerID] = saved
+	delete(wm.departed, playerID)
+	wm.send(gs, playerID, "waypoints", WaypointList{Waypoints: wm.list(gs, saved)}, dispatcher)
+}
+
+// UnloadPlayer releases a leaving player. It reports whether they left for another map, in which
+// case their position here shouldn't be saved.
+func (wm *WaypointManager) UnloadPlayer(playerID string) bool {
+	departed := wm.departed[playerID]
+	delete(wm.players, playerID)
+	delete(wm.nextTravel, playerID)
+	delete(wm.departed, playerID)
+	return departed
+}
+
+// Update activates the waypoints players walk into and sends players travelling to another map
+// the match to join. Called from the match loop.
+func (wm *WaypointManager) Update(ctx context.Context, gs *GameMatchState, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher) {
+	if len(wm.departures) > 0 {
+		wm.depart(ctx, gs, nk, dispatcher)
+	}
+	if gs.currentTick < wm.nextCheck || gs.currentMap == nil || len(gs.currentMap.Waypoints) == 0 {
+		return
+	}
+	wm.nextCheck = gs.currentTick + waypointCheckInterval
+
+	for playerID, saved := range wm.players {
+		rb := gs.PlayerBody(playerID)
+		state := gs.GetPlayerState(playerID)
+		if rb == nil || state.IsDead() {
+			continue
+		}
+		for i := range gs.currentMap.Waypoints {
+			waypoint := &gs.currentMap.Waypoints[i]
+			if rb.Position.Sub(waypoint.Position).Magnitude() > waypoint.Radius {
+				continue
+			}
+			if waypoint.Checkpoint && (state.Checkpoint == nil || *state.Checkpoint != waypoint.Position) {
+				position := waypoint.Position
+				state.Checkpoint = &position
+			}
+			if _, ok := saved.Activated[waypoint.ID]; !ok {
+				wm.activate(ctx, gs, playerID, saved, waypoint, dispatcher)
+			}
+		}
+	}
+}
+
+// Travel moves a player standing at an activated waypoint to another activated waypoint once
+// they paid its cost. Waypoints on this map are reached at once; for other maps the player is
+// told which match to join (OpCodeTravel "travel") and placed at the waypoint when they join.
+// It returns a reject reason, or "" on success.
+func (wm *WaypointManager) Travel(ctx context.Context, gs *GameMatchState, playerID, waypointID string, ack *InputACK, dispatcher runtime.MatchDispatcher, logger runtime.Logger) string {
+	rb := gs.PlayerBody(playerID)
+	if rb == nil {
+		return RejectNoPlayerObject
+	}
+	saved, ok := wm.players[playerID]
+	if !ok || gs.instanced() || wm.departed[playerID] {
+		return RejectCannotTravel
+	}
+	destination, ok := saved.Activated[waypointID]
+	if !ok {
+		return RejectNotActivated
+	}
+	origin := gs.waypointAt(rb.Position)
+	if origin == nil {
+		return RejectOutOfRange
+	}
+	if _, ok := saved.Activated[origin.ID]; !ok {
+		return RejectNotActivated
+	}
+	if origin.ID == waypointID {
+		return RejectInvalidTarget
+	}
+	state := gs.GetPlayerState(playerID)
+	if remaining := state.PvPCombatTick + pvpCombatTicks - gs.currentTick; state.PvPCombatTick > 0 && remaining > 0 {
+		ack.Cooldown = float64(remaining) / TickRate
+		return RejectInCombat
+	}
+	if remaining := wm.nextTravel[playerID] - gs.currentTick; remaining > 0 {
+		ack.Cooldown = float64(remaining) / TickRate
+		return RejectOnCooldown
+	}
+	paid, reason := wm.pay(ctx, gs, playerID, destination, dispatcher)
+	if reason != "" {
+		return reason
+	}
+	wm.nextTravel[playerID] = gs.currentTick + waypointTravelCooldown
+
+	// Mounts and carried objects stay behind
+	gs.Dismount(playerID, dispatcher, logger)
+	gs.Release(playerID, true, dispatcher, logger)
+
+	if destination.Map != gs.currentMapName {
+		travel := &PersistedTravel{PlayerID: playerID, Map: destination.Map, Waypoint: waypointID, X: destination.X, Y: destination.Y}
+		if err := wm.db.SaveTravel(ctx, travel); err != nil {
+			wm.refund(ctx, gs, playerID, destination, paid, dispatcher)
+			return RejectStorageError
+		}
+		wm.departed[playerID] = true
+		wm.departures = append(wm.departures, &departure{playerID: playerID, travel: travel, cost: destination, paid: paid})
+		logger.Info("Player %s travels from %s to %s on %s", playerID, origin.ID, waypointID, destination.Map)
+		return ""
+	}
+
+	position := vector.Vector{X: destination.X, Y: destination.Y}
+	if waypoint := gs.waypoint(waypointID); waypoint != nil {
+		position = waypoint.Position
+	}
+	gs.Teleport(playerID, position, CorrectionTravel)
+	logger.Info("Player %s travelled from %s to %s", playerID, origin.ID, waypointID)
+	gs.eventBus.Publish(EventWaypointTravel, map[string]any{"playerId": playerID, "from": origin.ID, "to": waypointID, "map": destination.Map})
+	return ""
+}
+
+// activate adds a waypoint to the player's activated ones, persists them and tells the player
+func (wm *WaypointManager) activate(ctx context.Context, gs *GameMatchState, playerID string, saved *PersistedWaypoints, waypoint *Waypoint, dispatcher runtime.MatchDispatcher) {
+	entry := &PersistedWaypoint{
+		Map:      gs.currentMapName,
+		Name:     waypoint.Name,
+		X:        waypoint.Position.X,
+		Y:        waypoint.Position.Y,
+		Cost:     waypoint.Cost,
+		Currency: waypoint.Currency,
+		CostItem: waypoint.CostItem,
+	}
+	saved.Activated[waypoint.ID] = entry
+	if err := wm.db.SaveWaypoints(ctx, saved); err != nil {
+		// Forget it so the next check activates it again
+		delete(saved.Activated, waypoint.ID)
+		return
+	}
+	wm.send(gs, playerID, "waypoint_activated", WaypointActivated{Waypoint: waypointData(gs, waypoint.ID, entry)}, dispatcher)
+	gs.eventBus.Publish(EventWaypointActivated, map[string]any{"playerId": playerID, "waypoint": waypoint.ID, "map": gs.currentMapName})
+}
+
+// depart sends players travelling to another map the match running it, starting one if the
+// map has none. Travels that can't be handed over are refunded.
+func (wm *WaypointManager) depart(ctx context.Context, gs *GameMatchState, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher) {
+	pending := wm.departures[:0]
+	for _, d := range wm.departures {
+		matchID := wm.matchFor(ctx, nk, d.travel.Map)
+		if matchID != "" {
+			wm.send(gs, d.playerID, "travel", WaypointTravel{Map: d.travel.Map, MatchID: matchID, Waypoint: d.travel.Waypoint}, dispatcher)
+			continue
+		}
+		d.attempts++
+		if d.attempts < waypointDepartureTries {
+			pending = append(pending, d)
+			continue
+		}
+		wm.logger.Warn("No match for %s; cancelling the travel of %s", d.travel.Map, d.playerID)
+		if err := wm.db.DeleteTravel(ctx, d.playerID); err != nil {
+			wm.logger.Error("Failed to clear the travel of %s: %v", d.playerID, err)
+		}
+		delete(wm.departed, d.playerID)
+		wm.refund(ctx, gs, d.playerID, d.cost, d.paid, dispatcher)
+		wm.send(gs, d.playerID, "travel_failed", WaypointTravel{Map: d.travel.Map, Waypoint: d.travel.Waypoint}, dispatcher)
+	}
+	wm.departures = pending
+}
+
+// matchFor returns the least loaded open world shard running a map, starting one if none can
+// take the player ("" on failure)
+func (wm *WaypointManager) matchFor(ctx context.Context, nk runtime.NakamaModule, mapName string) string {
+	shard, err := FindShard(ctx, wm.logger, nk, mapName)
+	if err != nil {
+		return ""
+	}
+	return shard.MatchID
+}
+
+// pay takes a waypoint's travel cost (travelCost) from the player. It returns what was paid and
+// a reject reason, or "".
+func (wm *WaypointManager) pay(ctx context.Context, gs *GameMatchState, playerID string, waypoint *PersistedWaypoint, dispatcher runtime.MatchDispatcher) (int64, string) {
+	cost := gs.travelCost(waypoint)
+	if cost <= 0 {
+		return 0, ""
+	}
+	if waypoint.CostItem != "" {
+		if gs.inventoryManager.Count(ctx, playerID, waypoint.CostItem) < int(cost) {
+			return 0, RejectCannotAfford
+		}
+		if err := gs.inventoryManager.Remove(ctx, playerID, waypoint.CostItem, int(cost)); err != nil {
+			return 0, RejectStorageError
+		}
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+		return cost, ""
+	}
+	metadata := map[string]interface{}{"source": "waypoint_travel"}
+	changeset := map[string]int64{travelCurrency(waypoint): -cost}
+	entry := &JournalEntry{Key: gs.journal.UniqueKey("travel"), Kind: JournalCurrency, PlayerID: playerID, Currency: changeset, Source: "waypoint_travel"}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		return 0, RejectRateLimited
+	}
+	// The wallet update fails rather than go negative
+	err := wm.db.UpdateWallet(ctx, playerID, changeset, metadata)
+	gs.journal.Finish(ctx, entry, err)
+	if err != nil {
+		return 0, RejectCannotAfford
+	}
+	return cost, ""
+}
+
+// refund gives back what a travel that didn't happen was paid
+func (wm *WaypointManager) refund(ctx context.Context, gs *GameMatchState, playerID string, waypoint *PersistedWaypoint, paid int64, dispatcher runtime.MatchDispatcher) {
+	if paid <= 0 {
+		return
+	}
+	if waypoint.CostItem != "" {
+		if err := gs.inventoryManager.Add(ctx, playerID, waypoint.CostItem, int(paid)); err != nil {
+			wm.logger.Error("Failed to refund %d x %s to %s: %v", paid, waypoint.CostItem, playerID, err)
+			return
+		}
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+		return
+	}
+	metadata := map[string]interface{}{"source": "waypoint_refund"}
+	changeset := map[string]int64{travelCurrency(waypoint): paid}
+	entry := &JournalEntry{Key: gs.journal.UniqueKey("travel_refund"), Kind: JournalCurrency, PlayerID: playerID, Currency: changeset, Source: "waypoint_refund"}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		return
+	}
+	err := wm.db.UpdateWallet(ctx, playerID, changeset, metadata)
+	gs.journal.Finish(ctx, entry, err)
+	if err != nil {
+		wm.logger.Error("Failed to refund %d %s to %s: %v", paid, travelCurrency(waypoint), playerID, err)
+	}
+}
+
+// list returns a player's activated waypoints, ordered by map and name
+func (wm *WaypointManager) list(gs *GameMatchState, saved *PersistedWaypoints) []WaypointData {
+	waypoints := make([]WaypointData, 0, len(saved.Activated))
+	for id, entry := range saved.Activated {
+		waypoints = append(waypoints, waypointData(gs, id, entry))
+	}
+	sort.Slice(waypoints, func(i, j int) bool {
+		if waypoints[i].Map != waypoints[j].Map {
+			return waypoints[i].Map < waypoints[j].Map
+		}
+		return waypoints[i].Name < waypoints[j].Name
+	})
+	return waypoints
+}
+
+// send delivers an OpCodeTravel message to one player
+func (wm *WaypointManager) send(gs *GameMatchState, playerID, msgType string, data any, dispatcher runtime.MatchDispatcher) {
+	presence, ok := gs.presences[playerID]
+	if !ok || dispatcher == nil {
+		return
+	}
+	payload, err := EncodeMessage(OpCodeTravel, msgType, data)
+	if err != nil {
+		wm.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeTravel, payload, []runtime.Presence{presence}, nil, true)
+}
+
+// waypointData converts a saved waypoint for clients, with its cost at the current rates
+func waypointData(gs *GameMatchState, id string, entry *PersistedWaypoint) WaypointData {
+	return WaypointData{
+		ID:       id,
+		Name:     entry.Name,
+		Map:      entry.Map,
+		X:        entry.X,
+		Y:        entry.Y,
+		Cost:     gs.travelCost(entry),
+		Currency: travelCurrency(entry),
+		CostItem: entry.CostItem,
+	}
+}
+
+// travelCurrency returns the wallet currency a waypoint's cost is paid in
+func travelCurrency(waypoint *PersistedWaypoint) string {
+	if waypoint.Currency == "" {
+		return defaultTravelCurrency
+	}
+	return waypoint.Currency
+}
+
+// travelCost returns what travelling to a waypoint costs: its cost in items as set, a currency
+// cost priced by the travel fee rate
+func (gs *GameMatchState) travelCost(waypoint *PersistedWaypoint) int64 {
+	if waypoint.CostItem != "" {
+		return waypoint.Cost
+	}
+	return gs.Price(SinkTravel, waypoint.Cost)
+}
+
+// waypoint returns the current map's waypoint with the given ID (nil if there is none)
+func (gs *GameMatchState) waypoint(id string) *Waypoint {
+	if gs.currentMap == nil {
+		return nil
+	}
+	for i := range gs.currentMap.Waypoints {
+		if gs.currentMap.Waypoints[i].ID == id {
+			return &gs.currentMap.Waypoints[i]
+		}
+	}
+	return nil
+}
+
+// waypointAt returns the waypoint whose radius contains the position (nil if there is none)
+func (gs *GameMatchState) waypointAt(p vector.Vector) *Waypoint {
+	if gs.currentMap == nil {
+		return nil
+	}
+	for i := range gs.currentMap.Waypoints {
+		if p.Sub(gs.currentMap.Waypoints[i].Position).Magnitude() <= gs.currentMap.Waypoints[i].Radius {
+			return &gs.currentMap.Waypoints[i]
+		}
+	}
+	return nil
+}
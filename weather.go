@@ -0,0 +1,295 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// Weather states
+const (
+	WeatherClear = "clear"
+	WeatherRain  = "rain"
+	WeatherStorm = "storm"
+	WeatherFog   = "fog"
+)
+
+// Weather events published on the event bus
+const (
+	EventWeatherChanged  = "weather_changed"  // state, previous
+	EventLightningStrike = "lightning_strike" // x, y
+)
+
+// Weather tuning. The map properties "weather" (comma-separated states the map allows),
+// "weatherMinDuration" and "weatherMaxDuration" (seconds) override the defaults.
+const (
+	defaultWeatherMinDuration = 120.0            // seconds a weather state lasts at least
+	defaultWeatherMaxDuration = 300.0            // seconds a weather state lasts at most
+	mudDrag                   = 0.88             // drag on "dirt" tiles while it rains (see defaultDrag)
+	fogPerceptionScale        = 0.5              // fog halves NPC aggro radii
+	lightningInterval         = 8 * TickRate     // average ticks between lightning strikes in a storm
+	lightningWarningTicks     = TickRate * 3 / 2 // the strike marker is shown this long before it hits
+	lightningRadius           = 48.0             // players and NPCs this close to the strike are hit
+	lightningDamage           = 35.0
+	lightningSpread           = 5 * TileSize // strikes land within this distance of a random player
+	lightningObjectType       = "lightning"  // ObjectData.Type of strike markers
+)
+
+// weatherTransitions lists the states each state may change into, with weights
+var weatherTransitions = map[string]map[string]float64{
+	WeatherClear: {WeatherRain: 3, WeatherFog: 2, WeatherClear: 2},
+	WeatherRain:  {WeatherClear: 3, WeatherStorm: 2, WeatherRain: 1},
+	WeatherStorm: {WeatherRain: 3, WeatherClear: 1},
+	WeatherFog:   {WeatherClear: 3, WeatherRain: 1},
+}
+
+// WeatherData is the weather sent to clients (OpCodeWeather and world_state)
+type WeatherData struct {
+	State     string  `json:"state"`
+	Previous  string  `json:"previous,omitempty"`
+	Remaining float64 `json:"remaining"` // seconds until the next transition
+}
+
+// lightningStrike is a pending strike: a marker object clients render until it hits
+type lightningStrike struct {
+	ObjectID   int
+	Position   vector.Vector
+	StrikeTick int64
+}
+
+// WeatherSystem is the per-map weather state machine
+type WeatherSystem struct {
+	logger      runtime.Logger
+	State       string
+	Previous    string
+	NextChange  int64           // tick of the next transition
+	allowed     map[string]bool // states the map allows
+	minDuration float64
+	maxDuration float64
+	strikes     []*lightningStrike
+	nextStrike  int64
+}
+
+// NewWeatherSystem creates a weather system with clear skies
+func NewWeatherSystem(logger runtime.Logger) *WeatherSystem {
+	return &WeatherSystem{
+		logger:      logger,
+		State:       WeatherClear,
+		allowed:     map[string]bool{WeatherClear: true, WeatherRain: true, WeatherStorm: true, WeatherFog: true},
+		minDuration: defaultWeatherMinDuration,
+		maxDuration: defaultWeatherMaxDuration,
+	}
+}
+
+// Configure applies the weather settings found in the map properties
+func (ws *WeatherSystem) Configure(props map[string]interface{}) {
+	if v, ok := props["weather"].(string); ok && v != "" {
+		ws.allowed = map[string]bool{WeatherClear: true}
+		for _, state := range strings.Split(v, ",") {
+			state = strings.ToLower(strings.TrimSpace(state))
+			if _, known := weatherTransitions[state]; known {
+				ws.allowed[state] = true
+			} else {
+				ws.logger.Warn("Ignoring unknown weather state %q in map properties", state)
+			}
+		}
+	}
+	if v, ok := props["weatherMinDuration"].(float64); ok && v > 0 {
+		ws.minDuration = v
+	}
+	if v, ok := props["weatherMaxDuration"].(float64); ok && v >= ws.minDuration {
+		ws.maxDuration = v
+	}
+	ws.maxDuration = math.Max(ws.maxDuration, ws.minDuration)
+}
+
+// Raining reports whether rain is falling (rain or storm)
+func (ws *WeatherSystem) Raining() bool {
+	return ws.State == WeatherRain || ws.State == WeatherStorm
+}
+
+// PerceptionScale returns the factor NPC aggro radii are scaled by
+func (ws *WeatherSystem) PerceptionScale() float64 {
+	if ws.State == WeatherFog {
+		return fogPerceptionScale
+	}
+	return 1
+}
+
+// Snapshot returns the weather for clients
+func (ws *WeatherSystem) Snapshot(tick int64) WeatherData {
+	return WeatherData{
+		State:     ws.State,
+		Previous:  ws.Previous,
+		Remaining: math.Max(0, float64(ws.NextChange-tick)/TickRate),
+	}
+}
+
+// Update runs transitions and storm lightning. Called from the match loop.
+func (ws *WeatherSystem) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	tick := gs.currentTick
+	if ws.NextChange == 0 {
+		// First tick: keep the starting state for a full duration
+		ws.NextChange = tick + ws.randomDuration()
+	}
+	if tick >= ws.NextChange {
+		ws.Set(gs, ws.nextState(), 0, dispatcher, logger)
+	}
+	ws.updateLightning(gs, dispatcher, logger)
+}
+
+// Set switches to a weather state for duration seconds (a random duration when 0) and tells
+// clients and event subscribers. It returns false for unknown states.
+func (ws *WeatherSystem) Set(gs *GameMatchState, state string, duration float64, dispatcher runtime.MatchDispatcher, logger runtime.Logger) bool {
+	if _, known := weatherTransitions[state]; !known {
+		return false
+	}
+	ticks := int64(duration * TickRate)
+	if duration <= 0 {
+		ticks = ws.randomDuration()
+	}
+	ws.NextChange = gs.currentTick + ticks
+	if state == ws.State {
+		return true
+	}
+
+	ws.Previous, ws.State = ws.State, state
+	logger.Info("Weather changed from %s to %s", ws.Previous, ws.State)
+	gs.eventBus.Publish(EventWeatherChanged, map[string]any{"state": ws.State, "previous": ws.Previous})
+
+	if dispatcher == nil {
+		return true
+	}
+	data, err := EncodeMessage(OpCodeWeather, "weather", ws.Snapshot(gs.currentTick))
+	if err != nil {
+		logger.Error("Failed to marshal weather: %v", err)
+		return true
+	}
+	dispatcher.BroadcastMessage(OpCodeWeather, data, nil, nil, true)
+	return true
+}
+
+// randomDuration returns a state duration in ticks between the configured bounds
+func (ws *WeatherSystem) randomDuration() int64 {
+	seconds := ws.minDuration + rand.Float64()*(ws.maxDuration-ws.minDuration)
+	return int64(seconds * TickRate)
+}
+
+// nextState picks the next state from the transition weights, restricted to the allowed states
+func (ws *WeatherSystem) nextState() string {
+	total := 0.0
+	for state, weight := range weatherTransitions[ws.State] {
+		if ws.allowed[state] {
+			total += weight
+		}
+	}
+	if total <= 0 {
+		return WeatherClear
+	}
+	pick := rand.Float64() * total
+	// Iterate in a fixed order so the pick only depends on the random number
+	for _, state := range []string{WeatherClear, WeatherRain, WeatherStorm, WeatherFog} {
+		weight := weatherTransitions[ws.State][state]
+		if !ws.allowed[state] || weight == 0 {
+			continue
+		}
+		if pick -= weight; pick < 0 {
+			return state
+		}
+	}
+	return WeatherClear
+}
+
+// updateLightning places strike markers near random players during storms and resolves the
+// strikes whose warning time is over
+func (ws *WeatherSystem) updateLightning(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	tick := gs.currentTick
+	if ws.State == WeatherStorm && tick >= ws.nextStrike {
+		ws.nextStrike = tick + lightningInterval/2 + rand.Int63n(lightningInterval)
+		ws.spawnStrike(gs, dispatcher, logger)
+	}
+
+	pending := ws.strikes[:0]
+	for _, strike := range ws.strikes {
+		if tick < strike.StrikeTick {
+			pending = append(pending, strike)
+			continue
+		}
+		ws.resolveStrike(gs, strike, dispatcher, logger)
+	}
+	ws.strikes = pending
+}
+
+// spawnStrike places a strike marker near a random player
+func (ws *WeatherSystem) spawnStrike(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	bodies := make([]*rigidbody.RigidBody, 0, gs.entities.PlayerCount())
+	for playerID, rb := range gs.PlayerBodies() {
+		if !gs.GetPlayerState(playerID).IsDead() {
+			bodies = append(bodies, rb)
+		}
+	}
+	if len(bodies) == 0 {
+		return
+	}
+	angle := rand.Float64() * 2 * math.Pi
+	dist := rand.Float64() * lightningSpread
+	position := bodies[rand.Intn(len(bodies))].Position.Add(vector.Vector{X: math.Cos(angle) * dist, Y: math.Sin(angle) * dist})
+
+	oid := gs.SpawnObject(&ObjectData{
+		Name: "lightning",
+		Type: lightningObjectType,
+		Props: map[string]interface{}{
+			"x":        position.X,
+			"y":        position.Y,
+			"radius":   lightningRadius,
+			"strikeIn": float64(lightningWarningTicks) / TickRate,
+		},
+	}, dispatcher, logger)
+	ws.strikes = append(ws.strikes, &lightningStrike{ObjectID: oid, Position: position, StrikeTick: gs.currentTick + lightningWarningTicks})
+}
+
+// resolveStrike damages everything within lightningRadius of the strike and removes its marker
+func (ws *WeatherSystem) resolveStrike(gs *GameMatchState, strike *lightningStrike, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	source := DamageSource{Type: DamageSourceEnvironment, ID: lightningObjectType}
+	for playerID, rb := range gs.PlayerBodies() {
+		if rb.Position.Sub(strike.Position).Magnitude() <= lightningRadius {
+			gs.DamagePlayer(playerID, source, lightningDamage, DamageTrue, dispatcher, logger)
+		}
+	}
+	for _, npc := range gs.npcManager.Snapshot() {
+		if (vector.Vector{X: npc.Position.X, Y: npc.Position.Y}).Sub(strike.Position).Magnitude() <= lightningRadius {
+			gs.npcManager.Damage(gs, npc.ID, source, lightningDamage, DamageTrue, dispatcher)
+		}
+	}
+	gs.RemoveObject(strike.ObjectID, dispatcher, logger)
+	gs.eventBus.Publish(EventLightningStrike, map[string]any{"x": strike.Position.X, "y": strike.Position.Y})
+	logger.Debug("Lightning struck at (%.1f, %.1f)", strike.Position.X, strike.Position.Y)
+}
+
+// updateGroundDrag makes rain-soaked "dirt" tiles slow a walking player down
+func (gs *GameMatchState) updateGroundDrag(state *PlayerState, rb *rigidbody.RigidBody) {
+	if state.MoveMode == MoveModeSwim {
+		// Swimming sets its own drag
+		state.Muddy = false
+		return
+	}
+	muddy := false
+	if gs.weather.Raining() && gs.currentMap != nil {
+		if tile := gs.mapLoader.GetTileAt(gs.currentMap, rb.Position.X, rb.Position.Y, ""); tile != nil {
+			muddy, _ = tile.Properties["dirt"].(bool)
+		}
+	}
+	if muddy == state.Muddy {
+		return
+	}
+	state.Muddy = muddy
+	if muddy {
+		gs.physicsEngine.SetDrag(rb, mudDrag)
+	} else {
+		gs.physicsEngine.SetDrag(rb, 0)
+	}
+}
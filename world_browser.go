@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// World browser page sizes
+const (
+	defaultWorldsListed = 20
+	maxWorldsListed     = 100
+)
+
+var errInvalidWorldKind = runtime.NewError("kind must be open_world or custom_world", rpcCodeInvalidArgument)
+
+// WorldInfo is a running world as world_list returns it: an open world shard or a custom world
+type WorldInfo struct {
+	MatchID    string                 `json:"matchId"`
+	Kind       string                 `json:"kind"` // openWorldKind or customWorldKind
+	Map        string                 `json:"map"`
+	Shard      int                    `json:"shard,omitempty"` // open worlds
+	Name       string                 `json:"name,omitempty"`  // custom worlds, like the fields below
+	Owner      string                 `json:"owner,omitempty"`
+	OwnerName  string                 `json:"ownerName,omitempty"`
+	Visibility string                 `json:"visibility,omitempty"`
+	Rules      map[string]interface{} `json:"rules,omitempty"`
+	Players    int                    `json:"players"`
+	Capacity   int                    `json:"capacity"`
+	Open       bool                   `json:"open"`
+	PvP        bool                   `json:"pvp"`
+	Uptime     int64                  `json:"uptime"` // seconds
+}
+
+// uptimeSince returns the seconds since a label's start time (0 when it has none)
+func uptimeSince(started int64, now time.Time) int64 {
+	if started <= 0 || now.Unix() < started {
+		return 0
+	}
+	return now.Unix() - started
+}
+
+// openWorlds returns the running open world shards as world infos, by map and shard
+func openWorlds(ctx context.Context, nk runtime.NakamaModule, now time.Time) ([]WorldInfo, error) {
+	shards, err := ListShards(ctx, nk, "")
+	if err != nil {
+		return nil, err
+	}
+	worlds := make([]WorldInfo, 0, len(shards))
+	for _, shard := range shards {
+		label := shard.Label
+		worlds = append(worlds, WorldInfo{
+			MatchID:  shard.MatchID,
+			Kind:     openWorldKind,
+			Map:      label.Map,
+			Shard:    label.Shard,
+			Players:  label.Players,
+			Capacity: label.Capacity,
+			Open:     label.Open,
+			PvP:      label.PvP,
+			Uptime:   uptimeSince(label.Started, now),
+		})
+	}
+	sort.SliceStable(worlds, func(i, j int) bool { return worlds[i].Map < worlds[j].Map })
+	return worlds, nil
+}
+
+// customWorlds returns the running custom worlds a player may join as world infos, newest
+// first. The matches come from one label query and the player's friends from one friend list
+// read. Directory entries of worlds that no longer run are removed along the way.
+func customWorlds(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, now time.Time) ([]WorldInfo, error) {
+	dm := NewDatabaseManager(logger, nk)
+	entries, err := dm.ListCustomWorlds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := nk.MatchList(ctx, maxCustomWorldScan, true, "", nil, nil, "+label.kind:"+customWorldKind)
+	if err != nil {
+		logger.Error("Failed to list custom world matches: %v", err)
+		return nil, err
+	}
+	running := make(map[string]*api.Match, len(matches))
+	for _, match := range matches {
+		running[match.GetMatchId()] = match
+	}
+
+	var friends map[string]bool
+	friendOf := func(ownerID string) bool {
+		if friends == nil {
+			if friends, err = mutualFriendSet(ctx, nk, userID); err != nil {
+				logger.Warn("Failed to list the friends of %s: %v", userID, err)
+				friends = map[string]bool{}
+			}
+		}
+		return friends[ownerID]
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.After(entries[j].CreatedAt) })
+	worlds := make([]WorldInfo, 0, len(entries))
+	for _, entry := range entries {
+		match, ok := running[entry.ID]
+		if !ok {
+			// The match ended without unlisting the world (e.g. the server stopped). A new
+			// world's label may not be listed yet, and a full page may have left it out.
+			if len(matches) < maxCustomWorldScan && now.Sub(entry.CreatedAt) > customWorldListGrace {
+				_ = dm.DeleteCustomWorld(ctx, entry.ID)
+			}
+			continue
+		}
+		if !worldVisible(entry, userID, func() bool { return friendOf(entry.Owner) }) {
+			continue
+		}
+		var label CustomWorldLabel
+		if err := json.Unmarshal([]byte(match.GetLabel().GetValue()), &label); err != nil {
+			continue
+		}
+		// Who was invited is the owner's business, so it isn't listed
+		worlds = append(worlds, WorldInfo{
+			MatchID:    entry.ID,
+			Kind:       customWorldKind,
+			Map:        entry.Map,
+			Name:       entry.Name,
+			Owner:      entry.Owner,
+			OwnerName:  entry.OwnerName,
+			Visibility: entry.Visibility,
+			Rules:      entry.Rules,
+			Players:    int(match.GetSize()),
+			Capacity:   entry.MaxPlayers,
+			Open:       label.Open,
+			PvP:        label.PvP,
+			Uptime:     uptimeSince(label.Started, now),
+		})
+	}
+	return worlds, nil
+}
+
+// rpcWorldList is the server browser: the running open world shards (by map and shard), then
+// the custom worlds the caller may join (newest first), with their population, capacity, PvP
+// rule and uptime. Filters: kind (open_world or custom_world), map, pvp, and open to only list
+// worlds that accept players.
+// Payload: {"kind": "optional", "map": "optional", "pvp": true, "open": true, "offset": 0, "limit": 20}
+func rpcWorldList(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if userID == "" {
+		return "", errWorldsPlayersOnly
+	}
+	var req struct {
+		Kind   string `json:"kind"`
+		Map    string `json:"map"`
+		PvP    *bool  `json:"pvp"`
+		Open   bool   `json:"open"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+	if req.Kind != "" && req.Kind != openWorldKind && req.Kind != customWorldKind {
+		return "", errInvalidWorldKind
+	}
+	if req.Limit <= 0 || req.Limit > maxWorldsListed {
+		req.Limit = defaultWorldsListed
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	now := time.Now()
+	var worlds []WorldInfo
+	if req.Kind != customWorldKind {
+		open, err := openWorlds(ctx, nk, now)
+		if err != nil {
+			logger.Error("Failed to list open worlds: %v", err)
+			return "", errInternalFailure
+		}
+		worlds = append(worlds, open...)
+	}
+	if req.Kind != openWorldKind {
+		custom, err := customWorlds(ctx, logger, nk, userID, now)
+		if err != nil {
+			return "", errInternalFailure
+		}
+		worlds = append(worlds, custom...)
+	}
+
+	matches := make([]WorldInfo, 0, len(worlds))
+	for _, world := range worlds {
+		if (req.Map != "" && world.Map != req.Map) ||
+			(req.PvP != nil && world.PvP != *req.PvP) ||
+			(req.Open && !world.Open) {
+			continue
+		}
+		matches = append(matches, world)
+	}
+
+	total := len(matches)
+	page := matches[:0]
+	if req.Offset < total {
+		page = matches[req.Offset:]
+		if len(page) > req.Limit {
+			page = page[:req.Limit]
+		}
+	}
+	out, err := json.Marshal(map[string]interface{}{"worlds": page, "total": total})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
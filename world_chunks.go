@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// World chunk tuning. The map property "persistChunkSize" (tiles) overrides the chunk size.
+const (
+	defaultPersistChunkTiles = 32
+	chunkActivationRadius    = 1            // chunks around a player's that are active too
+	chunkScanInterval        = TickRate / 2 // ticks between checks for newly active chunks
+	maxChunkLoadsPerScan     = 32           // chunks read per check; the rest wait for the next one
+)
+
+// ChunkStore persists the world entities of a map that can number in the thousands (resource
+// node timers, buildings placed outside housing plots) sharded by map chunk: one storage object
+// per chunk holding what it contains, instead of one blob for the whole map or one object per
+// entity. A chunk is read when it first becomes active, i.e. a player comes within
+// chunkActivationRadius chunks of it, or when something in it needs it, and only the chunks that
+// changed are written, so storage reads and writes follow the area players are in. Chunks are
+// read in batches off the match loop and applied by Update once they arrive; only MatchInit
+// reads them directly. It is only used from the match loop, but for the reads in flight.
+type ChunkStore struct {
+	logger    runtime.Logger
+	db        *DatabaseManager
+	mapName   string
+	enabled   bool    // persistent matches read and save chunks; others start empty
+	chunkSize float64 // pixels
+	loaded    map[ChunkCoord]bool
+	loading   map[ChunkCoord]bool // read off the loop, not applied yet
+	dirty     map[ChunkCoord]bool
+	buildings map[int]ChunkCoord // building object ID -> its chunk, for buildings outside plots
+	nextScan  int64
+
+	mu    sync.Mutex
+	reads []chunkRead // finished reads, applied by the next Update
+}
+
+// chunkRead is the outcome of a batch of chunk reads
+type chunkRead struct {
+	chunks []ChunkCoord
+	saved  map[ChunkCoord]*PersistedChunk
+	err    error
+}
+
+// NewChunkStore creates a chunk store; Configure sets up the map's chunk grid
+func NewChunkStore(logger runtime.Logger, db *DatabaseManager) *ChunkStore {
+	return &ChunkStore{
+		logger:    logger,
+		db:        db,
+		chunkSize: defaultPersistChunkTiles * TileSize,
+		loaded:    make(map[ChunkCoord]bool),
+		loading:   make(map[ChunkCoord]bool),
+		dirty:     make(map[ChunkCoord]bool),
+		buildings: make(map[int]ChunkCoord),
+	}
+}
+
+// Configure divides the map into square chunks of "persistChunkSize" tiles (default 32). Only
+// persistent matches read and save them.
+func (cs *ChunkStore) Configure(m *LoadedMap, mapName string, persistent bool) {
+	chunkTiles := defaultPersistChunkTiles
+	if v, ok := m.Properties["persistChunkSize"].(float64); ok && v >= 1 {
+		chunkTiles = int(v)
+	}
+	tileWidth := m.TileWidth
+	if tileWidth <= 0 {
+		tileWidth = TileSize
+	}
+	cs.mapName = mapName
+	cs.enabled = persistent
+	cs.chunkSize = float64(chunkTiles * tileWidth)
+}
+
+// ChunkAt returns the chunk containing a world position
+func (cs *ChunkStore) ChunkAt(p vector.Vector) ChunkCoord {
+	return ChunkCoord{X: int(math.Floor(p.X / cs.chunkSize)), Y: int(math.Floor(p.Y / cs.chunkSize))}
+}
+
+// chunkStorageKey is the storage key of a chunk of a map
+func chunkStorageKey(mapName string, c ChunkCoord) string {
+	return fmt.Sprintf("%s:%d:%d", mapName, c.X, c.Y)
+}
+
+// Update applies the chunks whose reads finished and requests the chunks around players that
+// became active. Called from the match loop.
+func (cs *ChunkStore) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	cs.mu.Lock()
+	reads := cs.reads
+	cs.reads = nil
+	cs.mu.Unlock()
+	for _, read := range reads {
+		cs.finish(gs, read, dispatcher)
+	}
+
+	if gs.currentTick < cs.nextScan {
+		return
+	}
+	cs.nextScan = gs.currentTick + chunkScanInterval
+
+	var pending []ChunkCoord
+	seen := make(map[ChunkCoord]bool)
+	for _, rb := range gs.PlayerBodies() {
+		center := cs.ChunkAt(rb.Position)
+		for dy := -chunkActivationRadius; dy <= chunkActivationRadius; dy++ {
+			for dx := -chunkActivationRadius; dx <= chunkActivationRadius; dx++ {
+				c := ChunkCoord{X: center.X + dx, Y: center.Y + dy}
+				if !cs.loaded[c] && !cs.loading[c] && !seen[c] {
+					seen[c] = true
+					pending = append(pending, c)
+				}
+			}
+		}
+	}
+	if len(pending) > maxChunkLoadsPerScan {
+		pending = pending[:maxChunkLoadsPerScan]
+	}
+	cs.Request(ctx, pending)
+}
+
+// missing returns the chunks that are neither loaded nor being read
+func (cs *ChunkStore) missing(chunks []ChunkCoord) []ChunkCoord {
+	var missing []ChunkCoord
+	for _, c := range chunks {
+		if !cs.loaded[c] && !cs.loading[c] && !slices.Contains(missing, c) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// Request reads the chunks that aren't loaded yet in one batch off the match loop; Update
+// applies them once the read finished
+func (cs *ChunkStore) Request(ctx context.Context, chunks []ChunkCoord) {
+	missing := cs.missing(chunks)
+	if len(missing) == 0 {
+		return
+	}
+	if !cs.enabled {
+		for _, c := range missing {
+			cs.loaded[c] = true
+		}
+		return
+	}
+	for _, c := range missing {
+		cs.loading[c] = true
+	}
+	go func() {
+		saved, err := cs.db.LoadChunks(ctx, cs.mapName, missing)
+		cs.mu.Lock()
+		cs.reads = append(cs.reads, chunkRead{chunks: missing, saved: saved, err: err})
+		cs.mu.Unlock()
+	}()
+}
+
+// RequestAt requests the chunk containing a position
+func (cs *ChunkStore) RequestAt(ctx context.Context, p vector.Vector) {
+	cs.Request(ctx, []ChunkCoord{cs.ChunkAt(p)})
+}
+
+// LoadedAt reports whether the chunk containing a position was loaded
+func (cs *ChunkStore) LoadedAt(p vector.Vector) bool {
+	return cs.loaded[cs.ChunkAt(p)]
+}
+
+// finish applies a finished batch of reads to the match
+func (cs *ChunkStore) finish(gs *GameMatchState, read chunkRead, dispatcher runtime.MatchDispatcher) {
+	for _, c := range read.chunks {
+		delete(cs.loading, c)
+	}
+	if read.err != nil {
+		// Left unloaded, so they are neither saved over nor missing once storage is back; the
+		// next scan asks again
+		cs.logger.Error("Failed to load %d chunks of %s: %v", len(read.chunks), cs.mapName, read.err)
+		return
+	}
+	// Buildings placed while their chunk was being read join what it held
+	for _, c := range cs.buildings {
+		if slices.Contains(read.chunks, c) {
+			cs.dirty[c] = true
+		}
+	}
+	for _, c := range read.chunks {
+		cs.loaded[c] = true
+		if chunk, ok := read.saved[c]; ok {
+			cs.apply(gs, c, chunk, dispatcher)
+		}
+	}
+}
+
+// Load reads the chunks that aren't loaded yet in one batch and applies them at once. Only for
+// MatchInit, before the match loop runs.
+func (cs *ChunkStore) Load(ctx context.Context, gs *GameMatchState, chunks []ChunkCoord) {
+	missing := cs.missing(chunks)
+	if len(missing) == 0 {
+		return
+	}
+	if !cs.enabled {
+		for _, c := range missing {
+			cs.loaded[c] = true
+		}
+		return
+	}
+
+	saved, err := cs.db.LoadChunks(ctx, cs.mapName, missing)
+	if err != nil {
+		// Left unloaded, so they are neither saved over nor missing once storage is back
+		cs.logger.Error("Failed to load %d chunks of %s: %v", len(missing), cs.mapName, err)
+		return
+	}
+	for _, c := range missing {
+		cs.loaded[c] = true
+		if chunk, ok := saved[c]; ok {
+			cs.apply(gs, c, chunk, nil)
+		}
+	}
+}
+
+// apply puts what a saved chunk holds into the match
+func (cs *ChunkStore) apply(gs *GameMatchState, c ChunkCoord, chunk *PersistedChunk, dispatcher runtime.MatchDispatcher) {
+	gs.resourceNodes.applyChunk(gs, chunk.Resources, dispatcher)
+	for _, b := range chunk.Buildings {
+		def, ok := gs.buildableCatalog.Get(b.Buildable)
+		if !ok {
+			cs.logger.Warn("Dropping building %s in chunk %d,%d of %s: unknown buildable", b.Buildable, c.X, c.Y, cs.mapName)
+			cs.dirty[c] = true
+			continue
+		}
+		ownership := b.Ownership
+		if ownership == nil {
+			ownership = &EntityOwnership{Permissions: def.Permissions}
+		}
+		oid := gs.spawnBuilding(def, vector.Vector{X: b.X, Y: b.Y}, ownership, 0, dispatcher, cs.logger)
+		cs.buildings[oid] = c
+	}
+}
+
+// Changed marks the chunk containing a position for the next save. A chunk that isn't loaded
+// is left alone, so its saved contents are never replaced by a partial view of them.
+func (cs *ChunkStore) Changed(p vector.Vector) {
+	if c := cs.ChunkAt(p); cs.loaded[c] {
+		cs.dirty[c] = true
+	}
+}
+
+// AddBuilding persists a building placed outside housing plots with its chunk. When the chunk
+// isn't loaded yet, it is saved once the chunk was read.
+func (cs *ChunkStore) AddBuilding(ctx context.Context, oid int, p vector.Vector) {
+	c := cs.ChunkAt(p)
+	cs.buildings[oid] = c
+	if !cs.loaded[c] {
+		cs.Request(ctx, []ChunkCoord{c})
+		return
+	}
+	cs.dirty[c] = true
+}
+
+// RemoveBuilding drops a removed building from its chunk
+func (cs *ChunkStore) RemoveBuilding(oid int) {
+	c, ok := cs.buildings[oid]
+	if !ok {
+		return
+	}
+	delete(cs.buildings, oid)
+	cs.dirty[c] = true
+}
+
+// Save writes the chunks that changed since the last save
+func (cs *ChunkStore) Save(ctx context.Context, gs *GameMatchState) error {
+	if !cs.enabled {
+		return nil
+	}
+
+	// Buildings carried into another chunk move to it, which must be loaded to be written; an
+	// unloaded one is requested and the building moves with a later save
+	moved := make(map[int]ChunkCoord)
+	gs.mu.Lock()
+	for oid, c := range cs.buildings {
+		if obj, ok := gs.Object(oid); ok {
+			if pos, ok := obj.Position(); ok && cs.ChunkAt(pos) != c {
+				moved[oid] = cs.ChunkAt(pos)
+			}
+		}
+	}
+	gs.mu.Unlock()
+	for oid, c := range moved {
+		cs.Request(ctx, []ChunkCoord{c})
+		if cs.loaded[c] {
+			cs.dirty[cs.buildings[oid]] = true
+			cs.dirty[c] = true
+			cs.buildings[oid] = c
+		}
+	}
+	if len(cs.dirty) == 0 {
+		return nil
+	}
+
+	chunks := make([]*PersistedChunk, 0, len(cs.dirty))
+	for _, c := range sortedChunks(cs.dirty) {
+		chunk := &PersistedChunk{Map: cs.mapName, X: c.X, Y: c.Y, Resources: gs.resourceNodes.chunkTimers(cs, c)}
+		gs.mu.Lock()
+		for _, oid := range sortedKeys(cs.buildings) {
+			obj, ok := gs.Object(oid)
+			if cs.buildings[oid] != c || !ok {
+				continue
+			}
+			pos, _ := obj.Position()
+			buildableID, _ := obj.Props["buildable"].(string)
+			chunk.Buildings = append(chunk.Buildings, PersistedBuilding{Buildable: buildableID, X: pos.X, Y: pos.Y, Ownership: obj.Ownership})
+		}
+		gs.mu.Unlock()
+		chunks = append(chunks, chunk)
+	}
+	if err := cs.db.SaveChunks(ctx, cs.mapName, chunks); err != nil {
+		// Keep the dirty chunks so the next periodic save retries
+		return err
+	}
+	cs.dirty = make(map[ChunkCoord]bool)
+	return nil
+}
+
+// sortedChunks returns the chunks of a set in row, then column order
+func sortedChunks(set map[ChunkCoord]bool) []ChunkCoord {
+	chunks := make([]ChunkCoord, 0, len(set))
+	for c := range set {
+		chunks = append(chunks, c)
+	}
+	slices.SortFunc(chunks, func(a, b ChunkCoord) int {
+		if a.Y != b.Y {
+			return a.Y - b.Y
+		}
+		return a.X - b.X
+	})
+	return chunks
+}
+
+// parseChunkKey returns the chunk of a storage key of the map, or false for another map's key
+func parseChunkKey(mapName, key string) (ChunkCoord, bool) {
+	rest, ok := strings.CutPrefix(key, mapName+":")
+	if !ok {
+		return ChunkCoord{}, false
+	}
+	var c ChunkCoord
+	if _, err := fmt.Sscanf(rest, "%d:%d", &c.X, &c.Y); err != nil || chunkStorageKey(mapName, c) != key {
+		return ChunkCoord{}, false
+	}
+	return c, true
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"math"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// World clock events published on the event bus
+const (
+	EventSunrise = "sunrise"
+	EventSunset  = "sunset"
+	EventHour    = "hour" // day, hour (whole game hour that just started)
+)
+
+// World clock tuning. The defaults can be overridden by the map properties "dayLength",
+// "sunriseHour", "sunsetHour" and "startHour".
+const (
+	minutesPerDay               = 24 * 60
+	defaultDayLength            = 1200.0        // real seconds per game day (20 minutes)
+	defaultSunriseHour          = 6.0           // game hour the day starts
+	defaultSunsetHour           = 20.0          // game hour the night starts
+	defaultStartHour            = 8.0           // game hour of a fresh world
+	worldClockBroadcastInterval = 10 * TickRate // ticks between world_clock broadcasts
+)
+
+// WorldClock is the server-authoritative time of day. It advances with the match ticks and is
+// persisted, so the world keeps its time across restarts.
+type WorldClock struct {
+	Day         int     // days since the world started
+	Minutes     float64 // game minutes since midnight (0..minutesPerDay)
+	DayLength   float64 // real seconds per game day
+	SunriseHour float64
+	SunsetHour  float64
+}
+
+// WorldClockData is the clock sent to clients (OpCodeWorldClock and world_state)
+type WorldClockData struct {
+	Day       int     `json:"day"`
+	Hour      int     `json:"hour"`
+	Minute    int     `json:"minute"`
+	Time      float64 `json:"time"` // fractional hour (0..24) for smooth lighting
+	IsDay     bool    `json:"isDay"`
+	DayLength float64 `json:"dayLength"` // real seconds per game day, so clients can interpolate
+}
+
+// NewWorldClock creates a clock at the default start hour
+func NewWorldClock() *WorldClock {
+	return &WorldClock{
+		Minutes:     defaultStartHour * 60,
+		DayLength:   defaultDayLength,
+		SunriseHour: defaultSunriseHour,
+		SunsetHour:  defaultSunsetHour,
+	}
+}
+
+// Configure applies the clock settings found in the map properties
+func (wc *WorldClock) Configure(props map[string]interface{}) {
+	if v, ok := props["dayLength"].(float64); ok && v > 0 {
+		wc.DayLength = v
+	}
+	if v, ok := props["sunriseHour"].(float64); ok && v >= 0 && v < 24 {
+		wc.SunriseHour = v
+	}
+	if v, ok := props["sunsetHour"].(float64); ok && v >= 0 && v < 24 {
+		wc.SunsetHour = v
+	}
+	if v, ok := props["startHour"].(float64); ok && v >= 0 && v < 24 {
+		wc.Minutes = v * 60
+	}
+}
+
+// Hour returns the fractional game hour (0..24)
+func (wc *WorldClock) Hour() float64 {
+	return wc.Minutes / 60
+}
+
+// IsDay reports whether the sun is up
+func (wc *WorldClock) IsDay() bool {
+	return wc.isDayAt(wc.Hour())
+}
+
+// isDayAt reports whether hour lies between sunrise and sunset (which may wrap past midnight)
+func (wc *WorldClock) isDayAt(hour float64) bool {
+	if wc.SunriseHour <= wc.SunsetHour {
+		return hour >= wc.SunriseHour && hour < wc.SunsetHour
+	}
+	return hour >= wc.SunriseHour || hour < wc.SunsetHour
+}
+
+// Snapshot returns the clock for clients
+func (wc *WorldClock) Snapshot() WorldClockData {
+	return WorldClockData{
+		Day:       wc.Day,
+		Hour:      int(wc.Minutes) / 60,
+		Minute:    int(wc.Minutes) % 60,
+		Time:      wc.Hour(),
+		IsDay:     wc.IsDay(),
+		DayLength: wc.DayLength,
+	}
+}
+
+// Update advances the clock by one tick, publishes the hour and sunrise/sunset when the sun
+// crosses the horizon and broadcasts the clock periodically. Called from the match loop.
+func (wc *WorldClock) Update(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	wasDay := wc.IsDay()
+	lastHour := int(wc.Minutes) / 60
+	wc.Minutes += minutesPerDay / (wc.DayLength * TickRate)
+	if wc.Minutes >= minutesPerDay {
+		wc.Minutes -= minutesPerDay
+		wc.Day++
+	}
+	wc.publishHour(gs, lastHour)
+	wc.publishTransition(gs, wasDay, dispatcher, logger)
+
+	if gs.currentTick%worldClockBroadcastInterval == 0 {
+		wc.broadcast(gs, dispatcher, logger)
+	}
+}
+
+// SetTime jumps to a game hour (e.g. from scripts or GM commands), publishing the new hour and
+// sunrise/sunset if the jump crosses one, and broadcasts the new time right away
+func (wc *WorldClock) SetTime(gs *GameMatchState, hour float64, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	wasDay := wc.IsDay()
+	lastHour := int(wc.Minutes) / 60
+	hour = math.Mod(hour, 24)
+	if hour < 0 {
+		hour += 24
+	}
+	wc.Minutes = hour * 60
+	wc.publishHour(gs, lastHour)
+	wc.publishTransition(gs, wasDay, dispatcher, logger)
+	wc.broadcast(gs, dispatcher, logger)
+}
+
+// publishHour publishes the hour event if the whole hour changed since lastHour
+func (wc *WorldClock) publishHour(gs *GameMatchState, lastHour int) {
+	if hour := int(wc.Minutes) / 60; hour != lastHour {
+		gs.eventBus.Publish(EventHour, map[string]any{"day": wc.Day, "hour": hour})
+	}
+}
+
+// publishTransition publishes sunrise or sunset if the day state changed since wasDay
+func (wc *WorldClock) publishTransition(gs *GameMatchState, wasDay bool, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	isDay := wc.IsDay()
+	if isDay == wasDay {
+		return
+	}
+	event := EventSunset
+	if isDay {
+		event = EventSunrise
+	}
+	logger.Info("World clock: %s on day %d", event, wc.Day)
+	gs.eventBus.Publish(event, map[string]any{"day": wc.Day, "hour": wc.Hour()})
+	// Clients switch lighting right away instead of waiting for the next periodic broadcast
+	wc.broadcast(gs, dispatcher, logger)
+}
+
+// broadcast sends the clock to every player
+func (wc *WorldClock) broadcast(gs *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if dispatcher == nil || len(gs.presences) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeWorldClock, "world_clock", wc.Snapshot())
+	if err != nil {
+		logger.Error("Failed to marshal world clock: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeWorldClock, data, nil, nil, true)
+}
+
+// Save persists the clock
+func (wc *WorldClock) Save(ctx context.Context, dm *DatabaseManager) error {
+	return dm.SaveWorldClock(ctx, &PersistedWorldClock{Day: wc.Day, Minutes: wc.Minutes})
+}
+
+// Restore continues from the persisted time, if any
+func (wc *WorldClock) Restore(ctx context.Context, dm *DatabaseManager) error {
+	saved, err := dm.LoadWorldClock(ctx)
+	if err != nil || saved == nil {
+		return err
+	}
+	wc.Day = saved.Day
+	wc.Minutes = math.Mod(math.Max(saved.Minutes, 0), minutesPerDay)
+	return nil
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// World event results sent with world_event_end
+const (
+	WorldEventCompleted = "completed" // every boss was defeated (or a boss-less event ran its course)
+	WorldEventExpired   = "expired"   // time ran out with bosses still alive
+	WorldEventCancelled = "cancelled" // stopped early by a GM or script
+)
+
+// World event notifications published on the event bus
+const (
+	EventWorldEventStart = "world_event_start" // id, name
+	EventWorldEventEnd   = "world_event_end"   // id, name, result, participants
+)
+
+// World event tuning
+const (
+	defaultWorldEventDuration    = 900.0    // seconds an event lasts unless its bosses die first
+	defaultWorldEventMinPresence = 30.0     // seconds in an event zone that count as participation
+	worldEventCheckInterval      = TickRate // ticks between schedule, zone and boss checks
+)
+
+// WorldEventDefinition describes a scheduled world event
+type WorldEventDefinition struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Maps        []string          `json:"maps,omitempty"`        // map files the event runs on (every map when empty)
+	Schedule    string            `json:"schedule,omitempty"`    // cron expression in UTC: "minute hour day month weekday" (manual start only when empty)
+	Duration    float64           `json:"duration,omitempty"`    // seconds (default defaultWorldEventDuration)
+	Message     string            `json:"message,omitempty"`     // announcement shown when the event starts
+	Bosses      []WorldEventBoss  `json:"bosses,omitempty"`      // NPCs spawned for the event; killing them all completes it
+	MinPresence float64           `json:"minPresence,omitempty"` // seconds in an event zone needed to participate (default defaultWorldEventMinPresence)
+	Rewards     WorldEventRewards `json:"rewards"`
+	cron        *cronSchedule
+}
+
+// WorldEventBoss is an NPC spawned when the event starts
+type WorldEventBoss struct {
+	NPC    string  `json:"npc"`
+	Marker string  `json:"marker,omitempty"` // named map marker to spawn at (X/Y when empty)
+	X      float64 `json:"x,omitempty"`
+	Y      float64 `json:"y,omitempty"`
+	Count  int     `json:"count,omitempty"` // default 1
+}
+
+// WorldEventRewards is granted to every participant of a completed event
+type WorldEventRewards struct {
+	Items    map[string]int   `json:"items,omitempty"`
+	Loot     string           `json:"loot,omitempty"`     // loot table rolled per participant
+	Currency map[string]int64 `json:"currency,omitempty"` // Nakama wallet changeset
+}
+
+// EventZone is a rectangular map area ("event_zone" objects) that opens while its event runs.
+// Players inside an open zone take part in the event.
+type EventZone struct {
+	Name  string
+	Event string
+	Min   vector.Vector
+	Max   vector.Vector
+}
+
+// Contains reports whether a point lies inside the zone
+func (z *EventZone) Contains(p vector.Vector) bool {
+	return p.X >= z.Min.X && p.X <= z.Max.X && p.Y >= z.Min.Y && p.Y <= z.Max.Y
+}
+
+// WorldEventParticipant is what a player contributed to a running event
+type WorldEventParticipant struct {
+	Damage    float64 // damage dealt to the event's bosses
+	ZoneTicks int64   // time spent in the event's zones
+}
+
+// ActiveWorldEvent is a running world event
+type ActiveWorldEvent struct {
+	Def          *WorldEventDefinition
+	StartTick    int64
+	EndTick      int64
+	Bosses       []int // NPC IDs
+	Participants map[string]*WorldEventParticipant
+}
+
+// EventZoneData is an open event zone sent to clients
+type EventZoneData struct {
+	Name   string  `json:"name"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// WorldEventData is a running event sent to clients (world_event_start and world_state)
+type WorldEventData struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Message   string          `json:"message,omitempty"`
+	Remaining float64         `json:"remaining"` // seconds until the event expires
+	Bosses    []int           `json:"bosses,omitempty"`
+	Zones     []EventZoneData `json:"zones,omitempty"`
+}
+
+// WorldEventEnd is broadcast when an event ends
+type WorldEventEnd struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Result       string `json:"result"` // WorldEvent*
+	Participants int    `json:"participants"`
+}
+
+// WorldEventReward tells a participant what they received
+type WorldEventReward struct {
+	ID       string           `json:"id"`
+	Items    map[string]int   `json:"items,omitempty"`
+	Currency map[string]int64 `json:"currency,omitempty"`
+}
+
+// WorldEventScheduler starts world events on their cron schedules, tracks participation and
+// hands out the rewards when they end
+type WorldEventScheduler struct {
+	logger     runtime.Logger
+	defs       map[string]*WorldEventDefinition
+	active     map[string]*ActiveWorldEvent
+	lastMinute int64 // unix minute the schedules were last checked
+	mu         sync.Mutex
+}
+
+// NewWorldEventScheduler creates a scheduler and loads definitions from path (a JSON object keyed by event ID)
+func NewWorldEventScheduler(logger runtime.Logger, path string) *WorldEventScheduler {
+	ws := &WorldEventScheduler{
+		logger: logger,
+		defs:   make(map[string]*WorldEventDefinition),
+		active: make(map[string]*ActiveWorldEvent),
+	}
+	if err := ws.Load(path); err != nil {
+		logger.Warn("Failed to load world event definitions from %s: %v", path, err)
+	}
+	return ws
+}
+
+// Load replaces the definitions with the ones found in path. Events with an invalid schedule
+// can still be started manually.
+func (ws *WorldEventScheduler) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var defs map[string]*WorldEventDefinition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return err
+	}
+	for id, def := range defs {
+		def.ID = id
+		if def.Name == "" {
+			def.Name = id
+		}
+		if def.Duration <= 0 {
+			def.Duration = defaultWorldEventDuration
+		}
+		if def.MinPresence <= 0 {
+			def.MinPresence = defaultWorldEventMinPresence
+		}
+		for i := range def.Bosses {
+			if def.Bosses[i].Count <= 0 {
+				def.Bosses[i].Count = 1
+			}
+		}
+		if def.Schedule != "" {
+			if def.cron, err = parseCron(def.Schedule); err != nil {
+				ws.logger.Warn("World event %s has an invalid schedule %q: %v", id, def.Schedule, err)
+			}
+		}
+	}
+
+	ws.mu.Lock()
+	ws.defs = defs
+	ws.mu.Unlock()
+
+	ws.logger.Info("Loaded %d world event definitions from %s", len(defs), path)
+	return nil
+}
+
+// runsOn reports whether the event is defined for a map
+func (def *WorldEventDefinition) runsOn(mapName string) bool {
+	if len(def.Maps) == 0 {
+		return true
+	}
+	for _, m := range def.Maps {
+		if m == mapName {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether an event is running
+func (ws *WorldEventScheduler) IsActive(id string) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	_, ok := ws.active[id]
+	return ok
+}
+
+// Definitions returns the IDs of the events defined for a map, sorted
+func (ws *WorldEventScheduler) Definitions(mapName string) []string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ids := make([]string, 0, len(ws.defs))
+	for id, def := range ws.defs {
+		if def.runsOn(mapName) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Update starts events whose schedule matches the current minute, credits players standing in
+// open event zones and ends events whose bosses died or whose time ran out. Called from the match loop.
+func (ws *WorldEventScheduler) Update(ctx context.Context, gs *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gs.currentTick%worldEventCheckInterval != 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	if minute := now.Unix() / 60; minute != ws.lastMinute {
+		ws.lastMinute = minute
+		ws.mu.Lock()
+		due := make([]string, 0)
+		for id, def := range ws.defs {
+			if _, running := ws.active[id]; !running && def.cron != nil && def.runsOn(gs.currentMapName) && def.cron.Matches(now) {
+				due = append(due, id)
+			}
+		}
+		ws.mu.Unlock()
+		sort.Strings(due)
+		for _, id := range due {
+			ws.Start(gs, id, dispatcher)
+		}
+	}
+
+	ws.mu.Lock()
+	ended := make(map[string]string)
+	for id, event := range ws.active {
+		ws.creditZonePresence(gs, event)
+		alive := 0
+		for _, npcID := range event.Bosses {
+			if _, ok := gs.npcManager.Get(npcID); ok {
+				alive++
+			}
+		}
+		switch {
+		case len(event.Bosses) > 0 && alive == 0:
+			ended[id] = WorldEventCompleted
+		case gs.currentTick >= event.EndTick && len(event.Bosses) == 0:
+			ended[id] = WorldEventCompleted
+		case gs.currentTick >= event.EndTick:
+			ended[id] = WorldEventExpired
+		}
+	}
+	ws.mu.Unlock()
+
+	for id, result := range ended {
+		ws.End(ctx, gs, id, result, dispatcher)
+	}
+}
+
+// creditZonePresence adds the check interval to every living player inside one of the event's
+// zones. Called with ws.mu held.
+func (ws *WorldEventScheduler) creditZonePresence(gs *GameMatchState, event *ActiveWorldEvent) {
+	if gs.currentMap == nil {
+		return
+	}
+	for playerID, rb := range gs.PlayerBodies() {
+		if gs.GetPlayerState(playerID).IsDead() {
+			continue
+		}
+		for i := range gs.currentMap.EventZones {
+			zone := &gs.currentMap.EventZones[i]
+			if zone.Event == event.Def.ID && zone.Contains(rb.Position) {
+				event.participant(playerID).ZoneTicks += worldEventCheckInterval
+				break
+			}
+		}
+	}
+}
+
+// participant returns the contribution record of a player, creating it on first use
+func (event *ActiveWorldEvent) participant(playerID string) *WorldEventParticipant {
+	p, ok := event.Participants[playerID]
+	if !ok {
+		p = &WorldEventParticipant{}
+		event.Participants[playerID] = p
+	}
+	return p
+}
+
+// RecordBossDamage credits a player with damage dealt to an event boss. Damage to other NPCs is ignored.
+func (ws *WorldEventScheduler) RecordBossDamage(npcID int, playerID string, amount float64) {
+	if amount <= 0 {
+		return
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for _, event := range ws.active {
+		for _, id := range event.Bosses {
+			if id == npcID {
+				event.participant(playerID).Damage += amount
+				return
+			}
+		}
+	}
+}
+
+// Start begins an event: spawns its bosses, opens its zones and announces it. It returns an
+// error if the event is unknown, not defined for the map or already running.
+func (ws *WorldEventScheduler) Start(gs *GameMatchState, id string, dispatcher runtime.MatchDispatcher) error {
+	ws.mu.Lock()
+	def, ok := ws.defs[id]
+	if !ok || !def.runsOn(gs.currentMapName) {
+		ws.mu.Unlock()
+		return msg("event.unknown", "event", id)
+	}
+	if _, running := ws.active[id]; running {
+		ws.mu.Unlock()
+		return msg("event.already_running", "event", id)
+	}
+	event := &ActiveWorldEvent{
+		Def:          def,
+		StartTick:    gs.currentTick,
+		EndTick:      gs.currentTick + int64(def.Duration*TickRate),
+		Participants: make(map[string]*WorldEventParticipant),
+	}
+	ws.active[id] = event
+	ws.mu.Unlock()
+
+	// Bosses are spawned outside ws.mu; they have no spawner, so they don't come back once killed
+	bosses := make([]int, 0)
+	for _, boss := range def.Bosses {
+		position := vector.Vector{X: boss.X, Y: boss.Y}
+		if boss.Marker != "" && gs.currentMap != nil {
+			marker, ok := gs.currentMap.Markers[boss.Marker]
+			if !ok {
+				ws.logger.Warn("World event %s: unknown boss marker %q", id, boss.Marker)
+				continue
+			}
+			position = marker
+		}
+		for i := 0; i < boss.Count; i++ {
+			if npcID := gs.npcManager.Spawn(gs, boss.NPC, position, nil); npcID != 0 {
+				bosses = append(bosses, npcID)
+			} else {
+				ws.logger.Warn("World event %s: unknown boss NPC type %q", id, boss.NPC)
+				break
+			}
+		}
+	}
+	ws.mu.Lock()
+	event.Bosses = bosses
+	ws.mu.Unlock()
+
+	ws.logger.Info("World event %s started (%d bosses, %.0fs)", id, len(bosses), def.Duration)
+	gs.eventBus.Publish(EventWorldEventStart, map[string]any{"id": id, "name": def.Name})
+	ws.broadcast(gs, "world_event_start", ws.snapshot(gs, event), dispatcher)
+	return nil
+}
+
+// End stops a running event with the given result, removes its surviving bosses and, if it
+// completed, rewards its participants. It returns false if the event wasn't running.
+func (ws *WorldEventScheduler) End(ctx context.Context, gs *GameMatchState, id, result string, dispatcher runtime.MatchDispatcher) bool {
+	ws.mu.Lock()
+	event, ok := ws.active[id]
+	if !ok {
+		ws.mu.Unlock()
+		return false
+	}
+	delete(ws.active, id)
+	qualified := make([]string, 0, len(event.Participants))
+	for playerID, p := range event.Participants {
+		if p.Damage > 0 || float64(p.ZoneTicks) >= event.Def.MinPresence*TickRate {
+			qualified = append(qualified, playerID)
+		}
+	}
+	ws.mu.Unlock()
+	sort.Strings(qualified)
+
+	for _, npcID := range event.Bosses {
+		gs.npcManager.Despawn(gs, npcID)
+	}
+	if result == WorldEventCompleted {
+		for _, playerID := range qualified {
+			ws.reward(ctx, gs, event, playerID, dispatcher)
+		}
+	}
+
+	ws.logger.Info("World event %s ended: %s (%d participants)", id, result, len(qualified))
+	gs.eventBus.Publish(EventWorldEventEnd, map[string]any{"id": id, "name": event.Def.Name, "result": result, "participants": len(qualified)})
+	ws.broadcast(gs, "world_event_end", WorldEventEnd{ID: id, Name: event.Def.Name, Result: result, Participants: len(qualified)}, dispatcher)
+	return true
+}
+
+// reward grants an event's rewards to one participant through the inventory and the Nakama wallet
+func (ws *WorldEventScheduler) reward(ctx context.Context, gs *GameMatchState, event *ActiveWorldEvent, playerID string, dispatcher runtime.MatchDispatcher) {
+	def := event.Def
+	granted := WorldEventReward{ID: def.ID, Items: make(map[string]int)}
+	stacks := make([]LootStack, 0, len(def.Rewards.Items))
+	for itemID, count := range def.Rewards.Items {
+		stacks = append(stacks, LootStack{ItemID: itemID, Count: count})
+	}
+	if def.Rewards.Loot != "" {
+		stacks = append(stacks, gs.lootCatalog.Roll(gs, def.Rewards.Loot, LootContext{PlayerID: playerID})...)
+	}
+	entry := &JournalEntry{Key: gs.journal.Key("world_event", def.ID, event.StartTick), Kind: JournalItemGrant, PlayerID: playerID, Items: stackItems(stacks), Currency: def.Rewards.Currency, Source: "world_event:" + def.ID}
+	if err := gs.journal.Begin(ctx, entry); err != nil {
+		return
+	}
+	// Participants who left are sent a reward claim rather than having their inventory written here
+	items, grantErr := gs.giveRewardItems(ctx, playerID, entry.Key, entry.Source, stacks)
+	if grantErr != nil {
+		ws.logger.Error("World event %s: failed to give items to %s: %v", def.ID, playerID, grantErr)
+	}
+	granted.Items = items
+	if len(def.Rewards.Currency) > 0 {
+		metadata := map[string]interface{}{"reason": "world_event", "event": def.ID}
+		if err := gs.databaseManager.UpdateWallet(ctx, playerID, def.Rewards.Currency, metadata); err != nil {
+			ws.logger.Error("World event %s: failed to pay %s: %v", def.ID, playerID, err)
+			grantErr = err
+		} else {
+			granted.Currency = def.Rewards.Currency
+		}
+	}
+	entry.Items, entry.Currency = granted.Items, granted.Currency
+	gs.journal.Finish(ctx, entry, grantErr)
+
+	presence, online := gs.presences[playerID]
+	if !online || dispatcher == nil {
+		return
+	}
+	if len(granted.Items) > 0 {
+		gs.inventoryManager.SyncToClient(ctx, gs, playerID, dispatcher)
+	}
+	data, err := EncodeMessage(OpCodeWorldEvent, "world_event_reward", granted)
+	if err != nil {
+		ws.logger.Error("Failed to marshal world_event_reward: %v", err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeWorldEvent, data, []runtime.Presence{presence}, nil, true)
+}
+
+// Snapshot returns the running events for clients
+func (ws *WorldEventScheduler) Snapshot(gs *GameMatchState) []WorldEventData {
+	ws.mu.Lock()
+	events := make([]*ActiveWorldEvent, 0, len(ws.active))
+	for _, event := range ws.active {
+		events = append(events, event)
+	}
+	ws.mu.Unlock()
+
+	list := make([]WorldEventData, 0, len(events))
+	for _, event := range events {
+		list = append(list, ws.snapshot(gs, event))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// snapshot converts a running event to its client representation
+func (ws *WorldEventScheduler) snapshot(gs *GameMatchState, event *ActiveWorldEvent) WorldEventData {
+	data := WorldEventData{
+		ID:        event.Def.ID,
+		Name:      event.Def.Name,
+		Message:   event.Def.Message,
+		Remaining: max(0, float64(event.EndTick-gs.currentTick)/TickRate),
+		Bosses:    event.Bosses,
+	}
+	if gs.currentMap != nil {
+		for _, zone := range gs.currentMap.EventZones {
+			if zone.Event == event.Def.ID {
+				data.Zones = append(data.Zones, EventZoneData{
+					Name:   zone.Name,
+					X:      zone.Min.X,
+					Y:      zone.Min.Y,
+					Width:  zone.Max.X - zone.Min.X,
+					Height: zone.Max.Y - zone.Min.Y,
+				})
+			}
+		}
+	}
+	return data
+}
+
+// broadcast announces an event change to every player
+func (ws *WorldEventScheduler) broadcast(gs *GameMatchState, msgType string, payload interface{}, dispatcher runtime.MatchDispatcher) {
+	if dispatcher == nil || len(gs.presences) == 0 {
+		return
+	}
+	data, err := EncodeMessage(OpCodeWorldEvent, msgType, payload)
+	if err != nil {
+		ws.logger.Error("Failed to marshal %s: %v", msgType, err)
+		return
+	}
+	dispatcher.BroadcastMessage(OpCodeWorldEvent, data, nil, nil, true)
+}
+
+// cronSchedule is a parsed five-field cron expression. Each field is a bit set of allowed values.
+type cronSchedule struct {
+	minute, hour, day, month, weekday uint64
+	dayAny, weekdayAny                bool // the field was "*", used for cron's day/weekday OR rule
+}
+
+// cronAliases are the shorthand schedules accepted in place of five fields
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// parseCron parses "minute hour day month weekday" (UTC). Each field accepts "*", numbers,
+// ranges ("1-5"), steps ("*/15", "0-30/10") and comma-separated lists. Weekday 0 and 7 are Sunday.
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if alias, ok := cronAliases[strings.ToLower(expr)]; ok {
+		expr = alias
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	var cs cronSchedule
+	var err error
+	if cs.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if cs.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if cs.day, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day: %w", err)
+	}
+	if cs.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if cs.weekday, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("weekday: %w", err)
+	}
+	if cs.weekday&(1<<7) != 0 {
+		cs.weekday |= 1 // 7 is another name for Sunday
+	}
+	cs.dayAny = fields[2] == "*"
+	cs.weekdayAny = fields[4] == "*"
+	return &cs, nil
+}
+
+// parseCronField parses one cron field into a bit set of the values between lo and hi
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rangePart = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+		start, end := lo, hi
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				end = hi // "5/10" means every 10 starting at 5
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Matches reports whether t (in UTC) falls on the schedule. As in cron, when both the day and
+// the weekday are restricted, either one matching is enough.
+func (cs *cronSchedule) Matches(t time.Time) bool {
+	t = t.UTC()
+	if cs.minute&(1<<uint(t.Minute())) == 0 || cs.hour&(1<<uint(t.Hour())) == 0 || cs.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dayOK := cs.day&(1<<uint(t.Day())) != 0
+	weekdayOK := cs.weekday&(1<<uint(t.Weekday())) != 0
+	if !cs.dayAny && !cs.weekdayAny {
+		return dayOK || weekdayOK
+	}
+	return dayOK && weekdayOK
+}
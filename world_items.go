@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// World item tuning
+const (
+	worldItemSensorSize     = TileSize       // pickup sensor is one tile square around the item
+	worldItemLifetimeTicks  = 300 * TickRate // dropped items despawn after 5 minutes
+	worldItemSweepInterval  = 1 * TickRate   // how often expired items are checked
+	worldItemReportInterval = 60 * TickRate  // how often the number of expired items is reported
+	worldItemObjectType     = "world_item"   // ObjectData.Type of item entities
+)
+
+// WorldItem is an item stack lying in the world. It is backed by a scripted object (so clients
+// render it through the usual object updates) and a sensor body used for pickup overlap checks.
+// The sensor is not added to gameObjects, so it never blocks movement.
+type WorldItem struct {
+	ObjectID     int
+	ItemID       string
+	Count        int
+	DroppedBy    string
+	DespawnTick  int64  // 0 means the item never despawns
+	Owner        string // only this player may pick the item up before OwnerUntil (loot ownership)
+	OwnerUntil   int64
+	PartyID      int // the members of this party may too (free-for-all party loot); not persisted
+	Position     vector.Vector
+	PickupRadius float64
+	Sensor       *rigidbody.RigidBody
+}
+
+// WorldItemSpawn describes an item entity to place in the world
+type WorldItemSpawn struct {
+	ItemID        string
+	Count         int
+	Position      vector.Vector
+	DroppedBy     string
+	LifetimeTicks int64   // 0 keeps the item until it is picked up
+	Owner         string  // reserve the item for this player...
+	OwnerTicks    int64   // ...for this many ticks
+	PartyID       int     // ...and for the members of this party
+	PickupRadius  float64 // half-size of the pickup sensor (default half of worldItemSensorSize)
+}
+
+// WorldItemManager tracks the item entities currently lying in the world. The primary shard of a
+// map saves them, so dropped loot survives a restart and keeps decaying on the wall clock.
+type WorldItemManager struct {
+	logger  runtime.Logger
+	items   map[int]*WorldItem // object ID -> item
+	dirty   bool               // items were dropped, taken or expired since the last save
+	expired int                // items expired since the last sweep report
+	mu      sync.Mutex
+}
+
+// NewWorldItemManager creates an empty world item manager
+func NewWorldItemManager(logger runtime.Logger) *WorldItemManager {
+	return &WorldItemManager{
+		logger: logger,
+		items:  make(map[int]*WorldItem),
+	}
+}
+
+// Count returns how many item stacks lie in the world
+func (wm *WorldItemManager) Count() int {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return len(wm.items)
+}
+
+// Spawn places an item stack at position and announces it to clients. lifetimeTicks of 0
+// keeps the item until it is picked up. It returns the object ID of the new entity.
+func (wm *WorldItemManager) Spawn(gameState *GameMatchState, itemID string, count int, position vector.Vector, droppedBy string, lifetimeTicks int64, dispatcher runtime.MatchDispatcher) int {
+	return wm.spawn(gameState, WorldItemSpawn{
+		ItemID:        itemID,
+		Count:         count,
+		Position:      position,
+		DroppedBy:     droppedBy,
+		LifetimeTicks: lifetimeTicks,
+	}, dispatcher)
+}
+
+// spawn places an item entity described by s and returns its object ID
+func (wm *WorldItemManager) spawn(gameState *GameMatchState, s WorldItemSpawn, dispatcher runtime.MatchDispatcher) int {
+	itemID, count, position := s.ItemID, s.Count, s.Position
+	var gid uint32
+	name := itemID
+	if def, ok := gameState.itemCatalog.Get(itemID); ok {
+		gid = def.WorldGID
+		if def.Name != "" {
+			name = def.Name
+		}
+	}
+
+	obj := &ObjectData{
+		Name: name,
+		Type: worldItemObjectType,
+		GID:  gid,
+		Props: map[string]interface{}{
+			"x":     position.X,
+			"y":     position.Y,
+			"item":  itemID,
+			"count": float64(count),
+		},
+	}
+	if s.Owner != "" && s.OwnerTicks > 0 {
+		// Lets clients show loot reserved for someone else differently
+		obj.Props["owner"] = s.Owner
+		if s.PartyID != 0 {
+			obj.Props["party"] = float64(s.PartyID)
+		}
+	}
+	oid := gameState.SpawnObject(obj, dispatcher, wm.logger)
+
+	size := worldItemSensorSize
+	if s.PickupRadius > 0 {
+		size = 2 * s.PickupRadius
+	}
+	item := &WorldItem{
+		ObjectID:     oid,
+		ItemID:       itemID,
+		Count:        count,
+		DroppedBy:    s.DroppedBy,
+		Position:     position,
+		PickupRadius: s.PickupRadius,
+		Sensor:       MakeRectangleRigidBody(position.X, position.Y, size, size),
+	}
+	if s.LifetimeTicks > 0 {
+		item.DespawnTick = gameState.currentTick + s.LifetimeTicks
+	}
+	if s.Owner != "" && s.OwnerTicks > 0 {
+		item.Owner = s.Owner
+		item.OwnerUntil = gameState.currentTick + s.OwnerTicks
+		item.PartyID = s.PartyID
+	}
+
+	wm.mu.Lock()
+	wm.items[oid] = item
+	wm.dirty = true
+	wm.mu.Unlock()
+
+	return oid
+}
+
+// Take removes an item entity from the world if body overlaps its sensor and the item isn't
+// reserved for another player. Only one caller can take a given item, so two players picking it
+// up on the same tick can't both receive it. It returns nil and a rejection reason when the item
+// can't be taken.
+func (wm *WorldItemManager) Take(gameState *GameMatchState, objectID int, playerID string, body *rigidbody.RigidBody) (*WorldItem, string) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	item, ok := wm.items[objectID]
+	if !ok {
+		return nil, RejectNotFound
+	}
+	if item.Owner != "" && item.Owner != playerID && gameState.currentTick < item.OwnerUntil &&
+		!gameState.parties.InParty(item.PartyID, playerID) {
+		return nil, RejectNotOwned
+	}
+	pe := gameState.physicsEngine
+	if !pe.aabbOverlap(body, item.Sensor) || !pe.detectCollision(body, item.Sensor).collided {
+		return nil, RejectOutOfRange
+	}
+	delete(wm.items, objectID)
+	wm.dirty = true
+	return item, ""
+}
+
+// Discard takes an item that was just spawned back out of the world (e.g. when the inventory
+// write of the drop failed)
+func (wm *WorldItemManager) Discard(gameState *GameMatchState, objectID int, dispatcher runtime.MatchDispatcher) {
+	wm.mu.Lock()
+	delete(wm.items, objectID)
+	wm.dirty = true
+	wm.mu.Unlock()
+	gameState.RemoveObject(objectID, dispatcher, wm.logger)
+}
+
+// Restore puts back an item returned by Take (e.g. when the inventory write failed)
+func (wm *WorldItemManager) Restore(item *WorldItem) {
+	wm.mu.Lock()
+	wm.items[item.ObjectID] = item
+	wm.dirty = true
+	wm.mu.Unlock()
+}
+
+// Update despawns expired items and frees loot whose owner window ended. Once a minute it reports
+// how many items expired. Called from the match loop.
+func (wm *WorldItemManager) Update(gameState *GameMatchState, dispatcher runtime.MatchDispatcher) {
+	if gameState.currentTick%worldItemSweepInterval != 0 {
+		return
+	}
+	if gameState.currentTick%worldItemReportInterval == 0 {
+		wm.report(gameState)
+	}
+
+	wm.mu.Lock()
+	expired := make([]int, 0)
+	freed := make([]int, 0)
+	for oid, item := range wm.items {
+		if item.DespawnTick > 0 && gameState.currentTick >= item.DespawnTick {
+			expired = append(expired, oid)
+			delete(wm.items, oid)
+			wm.dirty = true
+			wm.expired++
+			continue
+		}
+		if item.Owner != "" && gameState.currentTick >= item.OwnerUntil {
+			item.Owner = ""
+			item.PartyID = 0
+			freed = append(freed, oid)
+		}
+	}
+	wm.mu.Unlock()
+
+	for _, oid := range expired {
+		gameState.RemoveObject(oid, dispatcher, wm.logger)
+	}
+	for _, oid := range freed {
+		gameState.mu.Lock()
+		if obj, ok := gameState.Object(oid); ok {
+			delete(obj.Props, "owner")
+			delete(obj.Props, "party")
+		}
+		gameState.mu.Unlock()
+		gameState.BroadcastObjectUpdate(oid, dispatcher, wm.logger)
+	}
+}
+
+// report logs and counts the items expired since the last report
+func (wm *WorldItemManager) report(gs *GameMatchState) {
+	wm.mu.Lock()
+	expired, left := wm.expired, len(wm.items)
+	wm.expired = 0
+	wm.mu.Unlock()
+	if expired == 0 {
+		return
+	}
+	wm.logger.Info("Dropped item sweep: %d expired, %d left on %s", expired, left, gs.currentMapName)
+	gs.metrics.RecordExpiredItems(expired)
+}
+
+// Save writes the items lying in the world if any was dropped, taken or expired since the last
+// save. Lifetimes and loot reservations are saved as unix times so they keep running while the
+// match is down.
+func (wm *WorldItemManager) Save(ctx context.Context, dm *DatabaseManager, mapName string, currentTick int64) error {
+	wm.mu.Lock()
+	if !wm.dirty {
+		wm.mu.Unlock()
+		return nil
+	}
+	saved := wm.snapshot(mapName, currentTick)
+	wm.dirty = false
+	wm.mu.Unlock()
+
+	if err := dm.SaveWorldItems(ctx, saved); err != nil {
+		// Keep the dirty flag so the next periodic save retries
+		wm.mu.Lock()
+		wm.dirty = true
+		wm.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Writes returns the write of the items lying in the world now, for a pickup or drop to commit
+// with the player's inventory, so a crash can't leave a stack both on the ground and in the
+// inventory, or in neither. It returns nil when the match doesn't save its world items; call
+// Committed once the write succeeded.
+func (wm *WorldItemManager) Writes(gs *GameMatchState) []*runtime.StorageWrite {
+	if !gs.savesWorldState() {
+		return nil
+	}
+	wm.mu.Lock()
+	saved := wm.snapshot(gs.currentMapName, gs.currentTick)
+	wm.mu.Unlock()
+	write, err := gs.databaseManager.WorldItemsWrite(saved)
+	if err != nil {
+		return nil
+	}
+	return []*runtime.StorageWrite{write}
+}
+
+// Committed records that the items returned by Writes were stored
+func (wm *WorldItemManager) Committed(writes []*runtime.StorageWrite) {
+	if len(writes) == 0 {
+		return
+	}
+	wm.mu.Lock()
+	wm.dirty = false
+	wm.mu.Unlock()
+}
+
+// snapshot returns the items lying in the world as they are saved. Called with wm.mu held.
+func (wm *WorldItemManager) snapshot(mapName string, currentTick int64) *PersistedWorldItems {
+	now := time.Now().Unix()
+	saved := &PersistedWorldItems{Map: mapName, Items: make([]PersistedWorldItem, 0, len(wm.items))}
+	for _, oid := range sortedKeys(wm.items) {
+		item := wm.items[oid]
+		state := PersistedWorldItem{
+			ItemID:       item.ItemID,
+			Count:        item.Count,
+			X:            item.Position.X,
+			Y:            item.Position.Y,
+			DroppedBy:    item.DroppedBy,
+			PickupRadius: item.PickupRadius,
+		}
+		if item.DespawnTick > 0 {
+			state.ExpiresAt = now + (item.DespawnTick-currentTick)/TickRate
+		}
+		if item.Owner != "" && item.OwnerUntil > currentTick {
+			state.Owner = item.Owner
+			state.OwnerUntil = now + (item.OwnerUntil-currentTick)/TickRate
+		}
+		saved.Items = append(saved.Items, state)
+	}
+	return saved
+}
+
+// RestoreSaved puts back the items saved before a restart. Items whose lifetime ran out while
+// the match was down are dropped and counted as expired.
+func (wm *WorldItemManager) RestoreSaved(ctx context.Context, gs *GameMatchState) error {
+	saved, err := gs.databaseManager.LoadWorldItems(ctx, gs.currentMapName)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	restored, expired := 0, 0
+	for _, state := range saved.Items {
+		s := WorldItemSpawn{
+			ItemID:       state.ItemID,
+			Count:        state.Count,
+			Position:     vector.Vector{X: state.X, Y: state.Y},
+			DroppedBy:    state.DroppedBy,
+			PickupRadius: state.PickupRadius,
+		}
+		if state.ExpiresAt > 0 {
+			if state.ExpiresAt <= now {
+				expired++
+				continue
+			}
+			s.LifetimeTicks = (state.ExpiresAt - now) * TickRate
+		}
+		if state.Owner != "" && state.OwnerUntil > now {
+			s.Owner = state.Owner
+			s.OwnerTicks = (state.OwnerUntil - now) * TickRate
+		}
+		wm.spawn(gs, s, nil)
+		restored++
+	}
+
+	wm.mu.Lock()
+	// The items that expired meanwhile are gone from storage with the next save
+	wm.dirty = expired > 0
+	wm.expired += expired
+	wm.mu.Unlock()
+	wm.logger.Info("Restored %d dropped items (%d expired while the match was down)", restored, expired)
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+var errEmptyWorldReset = runtime.NewError("a world reset needs at least one of objects, positions, reload or scripts", rpcCodeInvalidArgument)
+
+// WorldReset is the payload of SignalWorldReset. The scopes are what admin_world_reset resets;
+// MatchID is set once the map restarted, to send the old shards' players there.
+type WorldReset struct {
+	Map       string    `json:"map"`
+	Objects   bool      `json:"objects"`   // saved doors, mechanisms, control points, farms, resource nodes and bodies
+	Positions bool      `json:"positions"` // saved and live player positions (inventories are kept)
+	Reload    bool      `json:"reload"`    // restart the map's shards from the map file
+	Scripts   bool      `json:"scripts"`   // script world and region variables and the script manifest
+	At        time.Time `json:"at"`
+	MatchID   string    `json:"matchId,omitempty"`
+}
+
+// scopes lists the parts of the world the reset covers, for logs and the admin log
+func (r *WorldReset) scopes() []string {
+	var scopes []string
+	for _, scope := range []struct {
+		name string
+		on   bool
+	}{{"objects", r.Objects}, {"positions", r.Positions}, {"reload", r.Reload}, {"scripts", r.Scripts}} {
+		if scope.on {
+			scopes = append(scopes, scope.name)
+		}
+	}
+	return scopes
+}
+
+// WorldResetTravel is the world_reset message sent to the players of a shard a reload ended:
+// join MatchID, the map's new match
+type WorldResetTravel struct {
+	Map     string `json:"map"`
+	MatchID string `json:"matchId"`
+}
+
+// ResetWorld applies a world reset to the match. A reload stops the shard from saving and
+// admitting players, so none of its saves land after the reset RPC deleted the saved state; the
+// RPC then starts the map again and signals once more with the new match, which the shard's
+// players are sent to before it ends.
+func (gs *GameMatchState) ResetWorld(ctx context.Context, reset *WorldReset, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	if reset.MatchID != "" {
+		gs.shard.End()
+		if dispatcher == nil {
+			return
+		}
+		payload, err := EncodeMessage(OpCodeTravel, "world_reset", WorldResetTravel{Map: gs.currentMapName, MatchID: reset.MatchID})
+		if err != nil {
+			logger.Error("Failed to marshal world reset: %v", err)
+			return
+		}
+		dispatcher.BroadcastMessage(OpCodeTravel, payload, nil, nil, true)
+		return
+	}
+
+	// A world state save still running must land before the reset RPC deletes the saved state
+	gs.databaseManager.WaitWorldSaves()
+
+	// Players are moved to a spawn point, so the position saved when they leave is one too
+	if reset.Positions {
+		gs.positionsResetAt = reset.At
+		for playerID := range gs.Presences() {
+			rb := gs.PlayerBody(playerID)
+			if rb == nil {
+				continue
+			}
+			gs.Dismount(playerID, dispatcher, logger)
+			gs.Release(playerID, true, dispatcher, logger)
+			gs.Teleport(playerID, gs.spawnPoint(), CorrectionWorldReset)
+		}
+	}
+
+	if reset.Scripts {
+		gs.worldVars.Reset()
+		gs.regionVars.Reset()
+		if err := gs.scriptEngine.LoadManifest(ctx, gs.databaseManager, gs.currentMapName); err != nil {
+			logger.Error("Failed to reload script manifest: %v", err)
+		}
+	}
+
+	if reset.Reload {
+		gs.shard.Close()
+		gs.shard.UpdateLabel(gs, dispatcher)
+	}
+	logger.Info("World reset of %s: %s", gs.currentMapName, strings.Join(reset.scopes(), ", "))
+}
+
+// rpcWorldReset resets a world without touching player progress. Each scope is optional:
+//   - objects deletes the map's saved doors, mechanisms, control points, farms, resource nodes
+//     and dynamic bodies (implies reload, since the running shards hold that state)
+//   - positions sends everyone on the map back to a spawn point; inventories stay
+//   - reload restarts the map's shards from the map file; their players are sent to the new one
+//   - scripts clears the script world variables and the map's region variables and reloads the
+//     script manifest
+//
+// Payload: {"map": "elderford/world.json", "objects": true, "positions": false, "reload": true, "scripts": true}
+func rpcWorldReset(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	reset := &WorldReset{}
+	if err := json.Unmarshal([]byte(payload), reset); err != nil {
+		return "", errInvalidPayload
+	}
+	reset.MatchID = ""
+	reset.At = time.Now().UTC()
+	if reset.Map == "" {
+		reset.Map = defaultWorldMap
+	}
+	if reset.Objects {
+		reset.Reload = true
+	}
+	if !reset.Objects && !reset.Positions && !reset.Reload && !reset.Scripts {
+		return "", errEmptyWorldReset
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	actorID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	record := &PersistedWorldReset{Map: reset.Map, ResetAt: reset.At, Scopes: reset.scopes(), ActorID: actorID}
+	if reset.Positions {
+		record.PositionsResetAt = reset.At
+	} else if previous, err := dm.LoadWorldReset(ctx, reset.Map); err == nil && previous != nil {
+		record.PositionsResetAt = previous.PositionsResetAt
+	}
+	if err := dm.SaveWorldReset(ctx, record); err != nil {
+		return "", errInternalFailure
+	}
+
+	shards, err := ListShards(ctx, nk, reset.Map)
+	if err != nil {
+		logger.Error("Failed to list shards of %s: %v", reset.Map, err)
+		return "", errInternalFailure
+	}
+	signal := func(r *WorldReset) error {
+		payload, err := json.Marshal(r)
+		if err != nil {
+			return errInternalFailure
+		}
+		data, err := json.Marshal(MatchSignalRequest{Type: SignalWorldReset, Payload: payload})
+		if err != nil {
+			return errInternalFailure
+		}
+		for _, shard := range shards {
+			if _, err := nk.MatchSignal(ctx, shard.MatchID, string(data)); err != nil {
+				logger.Warn("Failed to signal world reset to %s: %v", shard.MatchID, err)
+			}
+		}
+		return nil
+	}
+
+	// The saved state is deleted here rather than in the match loop, once the signal stopped the
+	// shards from saving objects (a reload) and cleared the script variables they would save
+	if err := signal(reset); err != nil {
+		return "", err
+	}
+	if err := dm.DeleteWorldState(ctx, reset.Map, reset.Objects, reset.Scripts); err != nil {
+		return "", errInternalFailure
+	}
+
+	// Start the map again from the map file and the cleaned storage, then move everyone over
+	matchID := ""
+	if reset.Reload && len(shards) > 0 {
+		shard, err := ReplaceShard(ctx, logger, nk, reset.Map)
+		if err != nil {
+			return "", errNoWorld
+		}
+		matchID = shard.MatchID
+		if err := signal(&WorldReset{Map: reset.Map, At: reset.At, MatchID: matchID}); err != nil {
+			return "", err
+		}
+	}
+
+	result := fmt.Sprintf("%d shards reset", len(shards))
+	if matchID != "" {
+		result += ", restarted as " + matchID
+	}
+	username, _ := ctx.Value(runtime.RUNTIME_CTX_USERNAME).(string)
+	role := ""
+	if actorID != "" {
+		role = "admin"
+	}
+	entry := &AdminLogEntry{
+		Time:      reset.At,
+		ActorID:   actorID,
+		ActorName: username,
+		Role:      role,
+		Action:    "world_reset",
+		Args:      reset.scopes(),
+		MatchID:   matchID,
+		Map:       reset.Map,
+		OK:        true,
+		Result:    result,
+	}
+	if err := dm.AppendAdminLog(ctx, entry); err != nil {
+		logger.Error("Failed to audit world reset of %s: %v", reset.Map, err)
+	}
+	logger.Info("World reset of %s (%s): %s", reset.Map, strings.Join(reset.scopes(), ", "), result)
+
+	out, err := json.Marshal(map[string]interface{}{
+		"map":     reset.Map,
+		"scopes":  reset.scopes(),
+		"shards":  len(shards),
+		"matchId": matchID,
+	})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
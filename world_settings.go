@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"math/rand"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// worldSettingsWriteRetries is how often a change to the stored world settings is attempted
+// when another admin call changed them in between
+const worldSettingsWriteRetries = 3
+
+var errInvalidWorldSettings = runtime.NewError("invalid world settings: maxPlayers must not be negative, bounds need min below max, drag must be in (0, 1], bounce in [0, 1], solverIterations in [1, 16], penetrationSlop not negative, correctionBias in (0, 1] and economy rates not negative (listing and auction_cut at most 1)", rpcCodeInvalidArgument)
+
+// ApplyWorldSettings puts the server-wide world settings into effect:
+//   - maxPlayers caps the players of the match (0 = no cap besides the shard capacity)
+//   - worldBounds overrides minX/minY/maxX/maxY of the bounds the map sets
+//   - physicsConfig sets drag, bounce, gravity and the collision solver (PhysicsEngine.Configure)
+//   - spawnPoints are used by maps without spawn points
+//   - gameRules: pvpEnabled false stops PvP damage outside duels; respawnTime (seconds) is the
+//     respawn delay of maps without a respawnDelay property; itemDecayTime (seconds, 0 = never)
+//     is how long dropped items lie in the world; spawnProtection (seconds) is how long players
+//     are protected after spawning (spawn_protection.go)
+//   - economy sets the rates of the currency sinks (travel fees, listing fees, the auction cut,
+//     repairs; see economy.go)
+//
+// Custom worlds replace maxPlayers and the game rules they set with their own. Called on match
+// start and when the settings change (SignalWorldSettings).
+func (gs *GameMatchState) ApplyWorldSettings(settings *WorldSettings, logger runtime.Logger) {
+	if settings == nil {
+		return
+	}
+	// Custom worlds keep their own player cap and game rules
+	settings = gs.customWorld.Apply(settings)
+	gs.worldSettings = settings
+
+	if gs.currentMap != nil {
+		bounds := WorldBounds{
+			MaxX: float64(gs.currentMap.Width * gs.currentMap.TileWidth),
+			MaxY: float64(gs.currentMap.Height * gs.currentMap.TileHeight),
+		}
+		if v, ok := settings.WorldBounds["minX"]; ok {
+			bounds.MinX = v
+		}
+		if v, ok := settings.WorldBounds["minY"]; ok {
+			bounds.MinY = v
+		}
+		if v, ok := settings.WorldBounds["maxX"]; ok {
+			bounds.MaxX = v
+		}
+		if v, ok := settings.WorldBounds["maxY"]; ok {
+			bounds.MaxY = v
+		}
+		gs.physicsEngine.SetWorldBounds(bounds)
+	}
+	gs.configurePhysics()
+
+	logger.Info("World settings applied: max players %d, %d fallback spawn points, pvp %t, respawn %.0fs, economy rates %v",
+		settings.MaxPlayers, len(settings.SpawnPoints), gs.pvpEnabled(), float64(gs.respawnDelayTicks())/TickRate, economyRates(settings))
+}
+
+// maxPlayersReached reports whether the world settings' player cap is reached
+func (gs *GameMatchState) maxPlayersReached() bool {
+	return gs.worldSettings != nil && gs.worldSettings.MaxPlayers > 0 && len(gs.presences) >= gs.worldSettings.MaxPlayers
+}
+
+// pvpEnabled reports whether the world settings allow PvP (default true)
+func (gs *GameMatchState) pvpEnabled() bool {
+	if gs.worldSettings == nil {
+		return true
+	}
+	enabled, ok := gs.worldSettings.GameRules["pvpEnabled"].(bool)
+	return !ok || enabled
+}
+
+// settingsRespawnDelay returns the respawnTime game rule in seconds, and false when unset
+func (gs *GameMatchState) settingsRespawnDelay() (float64, bool) {
+	if gs.worldSettings == nil {
+		return 0, false
+	}
+	v, ok := gs.worldSettings.GameRules["respawnTime"].(float64)
+	return v, ok && v >= 0
+}
+
+// droppedItemLifetimeTicks returns how long items dropped by players, NPCs and deaths lie in the
+// world: the itemDecayTime game rule in seconds, else worldItemLifetimeTicks. 0 means forever.
+func (gs *GameMatchState) droppedItemLifetimeTicks() int64 {
+	if gs.worldSettings != nil {
+		if v, ok := gs.worldSettings.GameRules["itemDecayTime"].(float64); ok && v >= 0 {
+			return int64(v * TickRate)
+		}
+	}
+	return worldItemLifetimeTicks
+}
+
+// spawnPoint returns where new players appear: the map's spawn point, else one of the world
+// settings' spawn points, else (100, 100)
+func (gs *GameMatchState) spawnPoint() vector.Vector {
+	if gs.currentMap != nil && len(gs.currentMap.SpawnPoints) > 0 {
+		return gs.mapLoader.GetRandomSpawnPoint(gs.currentMap)
+	}
+	if gs.worldSettings != nil && len(gs.worldSettings.SpawnPoints) > 0 {
+		return gs.worldSettings.SpawnPoints[rand.Intn(len(gs.worldSettings.SpawnPoints))]
+	}
+	return vector.Vector{X: 100, Y: 100}
+}
+
+// updateWorldSettings applies change to the stored world settings and writes them with the
+// version they were read at, reading again if another call wrote in between. It returns the
+// settings written, the change's error, or the storage error.
+func updateWorldSettings(ctx context.Context, dm *DatabaseManager, change func(settings *WorldSettings) error) (*WorldSettings, error) {
+	var err error
+	for attempt := 0; attempt < worldSettingsWriteRetries; attempt++ {
+		settings, version, loadErr := dm.LoadWorldSettingsVersion(ctx)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		if err = change(settings); err != nil {
+			return nil, err
+		}
+		if err = dm.SaveWorldSettings(ctx, settings, version); err == nil {
+			return settings, nil
+		}
+	}
+	return nil, err
+}
+
+// validWorldSettings checks settings sent to admin_world_settings
+func validWorldSettings(settings *WorldSettings) bool {
+	if settings.MaxPlayers < 0 {
+		return false
+	}
+	for _, axis := range []string{"X", "Y"} {
+		lo, hasLo := settings.WorldBounds["min"+axis]
+		hi, hasHi := settings.WorldBounds["max"+axis]
+		if hasLo && hasHi && lo >= hi {
+			return false
+		}
+	}
+	if v, ok := settings.PhysicsConfig["drag"].(float64); ok && (v <= 0 || v > 1) {
+		return false
+	}
+	if v, ok := settings.PhysicsConfig["bounce"].(float64); ok && (v < 0 || v > 1) {
+		return false
+	}
+	if v, ok := settings.PhysicsConfig["solverIterations"].(float64); ok && (v < 1 || v > maxSolverIterations || v != math.Trunc(v)) {
+		return false
+	}
+	if v, ok := settings.PhysicsConfig["penetrationSlop"].(float64); ok && v < 0 {
+		return false
+	}
+	if v, ok := settings.PhysicsConfig["correctionBias"].(float64); ok && (v <= 0 || v > 1) {
+		return false
+	}
+	return validEconomyRates(settings.Economy)
+}
+
+// rpcWorldSettings returns the world settings, or replaces them and has every running match
+// apply them.
+// Payload: {} to read, or {"settings": {"maxPlayers": 100, "spawnPoints": [...], "worldBounds": {...}, "physicsConfig": {...}, "gameRules": {...}, "economy": {...}}}
+func rpcWorldSettings(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if !isAdmin(ctx, nk) {
+		return "", errAdminRequired
+	}
+
+	var req struct {
+		Settings *WorldSettings `json:"settings"`
+	}
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return "", errInvalidPayload
+		}
+	}
+
+	dm := NewDatabaseManager(logger, nk)
+	if req.Settings == nil {
+		settings, err := dm.LoadWorldSettings(ctx)
+		if err != nil {
+			return "", errInternalFailure
+		}
+		out, err := json.Marshal(map[string]interface{}{"settings": settings})
+		if err != nil {
+			return "", errInternalFailure
+		}
+		return string(out), nil
+	}
+
+	if !validWorldSettings(req.Settings) {
+		return "", errInvalidWorldSettings
+	}
+	if err := dm.SaveWorldSettings(ctx, req.Settings, ""); err != nil {
+		return "", errInternalFailure
+	}
+	responses, err := signalMatches(ctx, logger, nk, "", MatchSignalRequest{Type: SignalWorldSettings})
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(map[string]interface{}{"settings": req.Settings, "matches": len(responses)})
+	if err != nil {
+		return "", errInternalFailure
+	}
+	return string(out), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/rudransh61/Physix-go/pkg/rigidbody"
+	"github.com/rudransh61/Physix-go/pkg/vector"
+)
+
+// WorldSnapshot is an immutable copy of the match's bodies, taken once per tick after physics
+// and the moves that settle it (elevation, carried objects, projectiles). Broadcasts, input ACKs
+// and persistence read it instead of gameObjects, so they neither hold the match mutex nor race
+// with scripts adding or removing colliders (AddOwnerCollider) while they read. Nothing may
+// change a published snapshot; the next tick publishes a new one.
+type WorldSnapshot struct {
+	Tick          int64
+	Bodies        []*rigidbody.RigidBody          // copies of gameObjects, in its order
+	Dynamic       []*rigidbody.RigidBody          // the movable ones among Bodies, which world updates carry
+	Owners        map[*rigidbody.RigidBody]string // player ID of each player body among Dynamic
+	Saved         []*rigidbody.RigidBody          // the bodies world saves keep: those no player, NPC, pet or object owns
+	Players       map[string]vector.Vector        // player ID -> position of their body
+	ActivePlayers []string                        // the connected players' IDs
+}
+
+// TakeWorldSnapshot copies the bodies under the match mutex and publishes the copy
+func (gs *GameMatchState) TakeWorldSnapshot() *WorldSnapshot {
+	gs.mu.Lock()
+	playerOf := gs.bodyOwners()
+	copies := make([]rigidbody.RigidBody, len(gs.gameObjects))
+	bodies := make([]*rigidbody.RigidBody, len(gs.gameObjects))
+	owners := make(map[*rigidbody.RigidBody]string, len(playerOf))
+	var dynamic, saved []*rigidbody.RigidBody
+	for i, rb := range gs.gameObjects {
+		copies[i] = *rb
+		bodies[i] = &copies[i]
+		// Owned bodies come back with their owner (players joining, NPCs and pets spawning,
+		// objects loaded from the map); saving them would restore owner-less copies
+		if _, owned := gs.entities.OwnerOf(rb); !owned {
+			saved = append(saved, bodies[i])
+		}
+		if rb.IsMovable {
+			dynamic = append(dynamic, bodies[i])
+			if playerID, ok := playerOf[rb]; ok {
+				owners[bodies[i]] = playerID
+			}
+		}
+	}
+	players := make(map[string]vector.Vector, gs.entities.PlayerCount())
+	for playerID, rb := range gs.PlayerBodies() {
+		players[playerID] = rb.Position
+	}
+	gs.mu.Unlock()
+
+	active := make([]string, 0, len(gs.presences))
+	for playerID := range gs.Presences() {
+		active = append(active, playerID)
+	}
+	snapshot := &WorldSnapshot{Tick: gs.currentTick, Bodies: bodies, Dynamic: dynamic, Owners: owners, Saved: saved, Players: players, ActivePlayers: active}
+	gs.snapshot.Store(snapshot)
+	return snapshot
+}
+
+// World returns the last published snapshot, or nil before the first tick. Safe to call from
+// any goroutine.
+func (gs *GameMatchState) World() *WorldSnapshot {
+	return gs.snapshot.Load()
+}
+
+// StaticGeometryReport is the response to the static geometry debug signal
+type StaticGeometryReport struct {
+	Map       string                 `json:"map"`
+	Tick      int64                  `json:"tick"`
+	Colliders []*rigidbody.RigidBody `json:"colliders"`
+}
+
+// Static returns the bodies that don't move: walls and the colliders of map and placed objects.
+// Clients draw them from the map, so world updates leave them out and carry only the object
+// colliders changed since (collider_changes.go); the static geometry debug signal lists them all.
+func (w *WorldSnapshot) Static() []*rigidbody.RigidBody {
+	static := make([]*rigidbody.RigidBody, 0, len(w.Bodies)-len(w.Dynamic))
+	for _, rb := range w.Bodies {
+		if !rb.IsMovable {
+			static = append(static, rb)
+		}
+	}
+	return static
+}
+
+// DynamicBodies returns the movable bodies as world_state and world_update carry them, and the
+// player of each player body among them: from the last snapshot, or from the bodies themselves
+// before the first tick
+func (gs *GameMatchState) DynamicBodies() ([]*rigidbody.RigidBody, map[*rigidbody.RigidBody]string) {
+	if world := gs.World(); world != nil {
+		return world.Dynamic, world.Owners
+	}
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	playerOf := gs.bodyOwners()
+	var dynamic []*rigidbody.RigidBody
+	owners := make(map[*rigidbody.RigidBody]string, len(playerOf))
+	for _, rb := range gs.gameObjects {
+		if rb.IsMovable {
+			copied := *rb
+			dynamic = append(dynamic, &copied)
+			if playerID, ok := playerOf[rb]; ok {
+				owners[&copied] = playerID
+			}
+		}
+	}
+	return dynamic, owners
+}
+
+// bodyOwners maps the players' bodies to their IDs. The caller holds gs.mu.
+func (gs *GameMatchState) bodyOwners() map[*rigidbody.RigidBody]string {
+	owners := make(map[*rigidbody.RigidBody]string, gs.entities.PlayerCount())
+	for playerID, rb := range gs.PlayerBodies() {
+		owners[rb] = playerID
+	}
+	return owners
+}
+
+// SeenBodies returns the bodies a viewer is sent: all but the bodies of the players sees says
+// the viewer doesn't see. Bodies is returned as it is when the viewer sees every player.
+func SeenBodies(bodies []*rigidbody.RigidBody, owners map[*rigidbody.RigidBody]string, sees func(playerID string) bool) []*rigidbody.RigidBody {
+	var seen []*rigidbody.RigidBody
+	for i, rb := range bodies {
+		if playerID, ok := owners[rb]; ok && !sees(playerID) {
+			if seen == nil {
+				seen = append(make([]*rigidbody.RigidBody, 0, len(bodies)), bodies[:i]...)
+			}
+			continue
+		}
+		if seen != nil {
+			seen = append(seen, rb)
+		}
+	}
+	if seen == nil {
+		return bodies
+	}
+	return seen
+}
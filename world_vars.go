@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// worldVarWildcard subscribes a client to every world variable
+const worldVarWildcard = "*"
+
+// WorldVars holds shared variables that every script can read and write.
+// It lets separate scripted objects coordinate, e.g. "all four levers pulled opens the gate".
+type WorldVars struct {
+	values     map[string]any
+	persistent map[string]bool            // keys that survive match restarts
+	watchers   map[string]map[string]bool // key (or "*") -> set of player IDs
+	changed    map[string]bool            // keys changed since last flush
+	dirty      bool                       // persistent keys changed since last save
+	mu         sync.Mutex
+}
+
+// WorldVarChange is the payload broadcast to watching clients when a variable changes
+type WorldVarChange struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// NewWorldVars creates an empty world variable store
+func NewWorldVars() *WorldVars {
+	return &WorldVars{
+		values:     make(map[string]any),
+		persistent: make(map[string]bool),
+		watchers:   make(map[string]map[string]bool),
+		changed:    make(map[string]bool),
+	}
+}
+
+// Get returns the value stored under key
+func (wv *WorldVars) Get(key string) (any, bool) {
+	wv.mu.Lock()
+	defer wv.mu.Unlock()
+	v, ok := wv.values[key]
+	return v, ok
+}
+
+// Set stores a value and queues a change event. A nil value deletes the variable.
+// Persistent variables are written to storage on the next periodic save.
+func (wv *WorldVars) Set(key string, value any, persist bool) {
+	wv.mu.Lock()
+	defer wv.mu.Unlock()
+
+	if value == nil {
+		delete(wv.values, key)
+	} else {
+		wv.values[key] = value
+	}
+	if persist {
+		wv.persistent[key] = true
+	}
+	if wv.persistent[key] {
+		wv.dirty = true
+	}
+	if value == nil {
+		delete(wv.persistent, key)
+	}
+	wv.changed[key] = true
+}
+
+// Watch subscribes a player to change events for the given keys ("*" for all)
+func (wv *WorldVars) Watch(playerID string, keys []string) {
+	wv.mu.Lock()
+	defer wv.mu.Unlock()
+	for _, key := range keys {
+		if wv.watchers[key] == nil {
+			wv.watchers[key] = make(map[string]bool)
+		}
+		wv.watchers[key][playerID] = true
+	}
+}
+
+// Unwatch removes a player's subscriptions (all of them when keys is empty)
+func (wv *WorldVars) Unwatch(playerID string, keys []string) {
+	wv.mu.Lock()
+	defer wv.mu.Unlock()
+	if len(keys) == 0 {
+		for key, set := range wv.watchers {
+			delete(set, playerID)
+			if len(set) == 0 {
+				delete(wv.watchers, key)
+			}
+		}
+		return
+	}
+	for _, key := range keys {
+		if set := wv.watchers[key]; set != nil {
+			delete(set, playerID)
+			if len(set) == 0 {
+				delete(wv.watchers, key)
+			}
+		}
+	}
+}
+
+// FlushChanges broadcasts queued change events to the clients watching each key
+func (wv *WorldVars) FlushChanges(gameState *GameMatchState, dispatcher runtime.MatchDispatcher, logger runtime.Logger) {
+	wv.mu.Lock()
+	if len(wv.changed) == 0 {
+		wv.mu.Unlock()
+		return
+	}
+	keys := make([]string, 0, len(wv.changed))
+	for key := range wv.changed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	type pendingChange struct {
+		change    WorldVarChange
+		playerIDs []string
+	}
+	pending := make([]pendingChange, 0, len(keys))
+	for _, key := range keys {
+		recipients := make(map[string]bool)
+		for playerID := range wv.watchers[key] {
+			recipients[playerID] = true
+		}
+		for playerID := range wv.watchers[worldVarWildcard] {
+			recipients[playerID] = true
+		}
+		if len(recipients) == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(recipients))
+		for playerID := range recipients {
+			ids = append(ids, playerID)
+		}
+		pending = append(pending, pendingChange{
+			change:    WorldVarChange{Key: key, Value: wv.values[key]},
+			playerIDs: ids,
+		})
+	}
+	wv.changed = make(map[string]bool)
+	wv.mu.Unlock()
+
+	if dispatcher == nil {
+		return
+	}
+
+	for _, p := range pending {
+		presences := make([]runtime.Presence, 0, len(p.playerIDs))
+		for _, playerID := range p.playerIDs {
+			if presence, ok := gameState.presences[playerID]; ok {
+				presences = append(presences, presence)
+			}
+		}
+		if len(presences) == 0 {
+			continue
+		}
+
+		data, err := EncodeMessage(OpCodeWorldVarChange, "world_var_changed", p.change)
+		if err != nil {
+			logger.Error("Failed to marshal world var change for %s: %v", p.change.Key, err)
+			continue
+		}
+		dispatcher.BroadcastMessage(OpCodeWorldVarChange, data, presences, nil, true)
+	}
+}
+
+// Snapshot returns a copy of the persistent variables and clears the dirty flag
+func (wv *WorldVars) Snapshot() (map[string]any, bool) {
+	wv.mu.Lock()
+	defer wv.mu.Unlock()
+	out := make(map[string]any, len(wv.persistent))
+	for key := range wv.persistent {
+		if v, ok := wv.values[key]; ok {
+			out[key] = v
+		}
+	}
+	dirty := wv.dirty
+	wv.dirty = false
+	return out, dirty
+}
+
+// Restore loads persisted variables (called once on match init)
+func (wv *WorldVars) Restore(values map[string]any) {
+	wv.mu.Lock()
+	defer wv.mu.Unlock()
+	for key, v := range values {
+		wv.values[key] = v
+		wv.persistent[key] = true
+	}
+}
+
+// Reset deletes every variable; watching clients are told they are gone on the next flush
+func (wv *WorldVars) Reset() {
+	wv.mu.Lock()
+	defer wv.mu.Unlock()
+	for key := range wv.values {
+		wv.changed[key] = true
+	}
+	wv.values = make(map[string]any)
+	wv.persistent = make(map[string]bool)
+	wv.dirty = false
+}
+
+// Save writes persistent variables to storage if any changed since the last save
+func (wv *WorldVars) Save(ctx context.Context, dm *DatabaseManager) error {
+	values, dirty := wv.Snapshot()
+	if !dirty {
+		return nil
+	}
+	if err := dm.SaveWorldVars(ctx, values); err != nil {
+		// Keep the dirty flag so the next periodic save retries
+		wv.mu.Lock()
+		wv.dirty = true
+		wv.mu.Unlock()
+		return err
+	}
+	return nil
+}